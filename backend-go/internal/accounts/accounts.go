@@ -0,0 +1,148 @@
+// Package accounts changes the email address of an account and merges
+// duplicate accounts. An email change is proven by a token sent to the new
+// address and then held for a security period, during which the old address
+// can cancel it. A merge is proven by a token sent to the duplicate's
+// address and moves everything the duplicate owns to the account that
+// asked for it.
+package accounts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+const (
+	// DefaultEmailChangeHold is how long a verified email change waits before
+	// it takes effect
+	DefaultEmailChangeHold = 72 * time.Hour
+	// EmailChangeTokenTTL is how long the new address has to verify itself
+	EmailChangeTokenTTL = 24 * time.Hour
+	// MergeTokenTTL is how long the duplicate account has to approve a merge
+	MergeTokenTTL = time.Hour
+)
+
+var (
+	ErrSameEmail       = errors.New("new email is the current email")
+	ErrSameAccount     = errors.New("cannot merge an account into itself")
+	ErrAccountInactive = errors.New("account is inactive")
+)
+
+// NewToken returns a random token to email and the hash to store for it
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the stored form of a token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeEmail returns the form addresses are stored and compared in
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// CheckEmailChange reports whether a user may move to newEmail
+func CheckEmailChange(user *models.User, newEmail string) error {
+	if !user.IsActive {
+		return ErrAccountInactive
+	}
+	if NormalizeEmail(user.Email) == NormalizeEmail(newEmail) {
+		return ErrSameEmail
+	}
+	return nil
+}
+
+// CheckMerge reports whether source may be merged into target. Both must
+// be active: a deactivated account has either been merged already or been
+// suspended, and neither should pass its data on.
+func CheckMerge(source, target *models.User) error {
+	if source.ID == target.ID {
+		return ErrSameAccount
+	}
+	if !source.IsActive || !target.IsActive {
+		return ErrAccountInactive
+	}
+	return nil
+}
+
+// Store applies email changes whose hold has ended
+type Store interface {
+	DueEmailChanges(ctx context.Context, limit int) ([]models.EmailChange, error)
+	// ApplyEmailChange moves the account to the new address, or cancels the
+	// change when the address has been taken
+	ApplyEmailChange(ctx context.Context, id int64) (*models.EmailChange, error)
+}
+
+// AuditLogs records what happened to an account
+type AuditLogs interface {
+	Insert(ctx context.Context, log *models.AuditLog) (*models.AuditLog, error)
+}
+
+// Transactor makes a change and its audit record atomic
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// ApplyDue applies up to limit email changes whose hold has ended, each in
+// a transaction with its audit record, and returns how many moved an
+// account to its new address. A change that fails is left held and retried
+// on the next run.
+func ApplyDue(ctx context.Context, tx Transactor, store Store, audit AuditLogs, limit int) (int, error) {
+	due, err := store.DueEmailChanges(ctx, limit)
+	if err != nil {
+		return 0, err
+	}
+	applied := 0
+	var errs []error
+	for _, change := range due {
+		var out *models.EmailChange
+		err := tx.WithTx(ctx, func(ctx context.Context) error {
+			var err error
+			if out, err = store.ApplyEmailChange(ctx, change.ID); err != nil {
+				return err
+			}
+			action := "email_change_applied"
+			if out.Status != models.EmailChangeApplied {
+				action = "email_change_cancelled"
+			}
+			raw, _ := json.Marshal(map[string]any{
+				"old_email": out.OldEmail,
+				"new_email": out.NewEmail,
+				"reason":    out.CancelReason,
+			})
+			resourceID := strconv.FormatInt(out.ID, 10)
+			_, err = audit.Insert(ctx, &models.AuditLog{
+				UserID:     &out.UserID,
+				Action:     action,
+				Resource:   "email_change",
+				ResourceID: &resourceID,
+				Metadata:   string(raw),
+			})
+			return err
+		})
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if out.Status == models.EmailChangeApplied {
+			applied++
+		}
+	}
+	return applied, errors.Join(errs...)
+}
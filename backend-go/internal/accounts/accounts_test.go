@@ -0,0 +1,106 @@
+// Package accounts_test provides unit tests for email changes and account merges
+package accounts_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/accounts"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := accounts.NewToken()
+	require.NoError(t, err)
+	assert.Len(t, token, 64)
+	assert.Equal(t, hash, accounts.HashToken(token))
+	assert.Equal(t, hash, accounts.HashToken(" "+token+"\n"), "pasted tokens are trimmed")
+	assert.NotEqual(t, token, hash)
+
+	other, _, err := accounts.NewToken()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestCheckEmailChange(t *testing.T) {
+	user := &models.User{ID: 1, Email: "ada@example.com", IsActive: true}
+	assert.NoError(t, accounts.CheckEmailChange(user, "ada@newco.io"))
+	assert.ErrorIs(t, accounts.CheckEmailChange(user, " Ada@Example.com "), accounts.ErrSameEmail)
+
+	user.IsActive = false
+	assert.ErrorIs(t, accounts.CheckEmailChange(user, "ada@newco.io"), accounts.ErrAccountInactive)
+}
+
+func TestCheckMerge(t *testing.T) {
+	target := &models.User{ID: 1, IsActive: true}
+	source := &models.User{ID: 2, IsActive: true}
+	assert.NoError(t, accounts.CheckMerge(source, target))
+	assert.ErrorIs(t, accounts.CheckMerge(target, target), accounts.ErrSameAccount)
+
+	source.IsActive = false
+	assert.ErrorIs(t, accounts.CheckMerge(source, target), accounts.ErrAccountInactive)
+}
+
+type fakeStore struct {
+	due     []models.EmailChange
+	taken   map[string]bool
+	failing map[int64]bool
+}
+
+func (s *fakeStore) DueEmailChanges(ctx context.Context, limit int) ([]models.EmailChange, error) {
+	return s.due, nil
+}
+
+func (s *fakeStore) ApplyEmailChange(ctx context.Context, id int64) (*models.EmailChange, error) {
+	if s.failing[id] {
+		return nil, errors.New("connection reset")
+	}
+	for _, c := range s.due {
+		if c.ID != id {
+			continue
+		}
+		c.Status = models.EmailChangeApplied
+		if s.taken[c.NewEmail] {
+			reason := "email_unavailable"
+			c.Status, c.CancelReason = models.EmailChangeCancelled, &reason
+		}
+		return &c, nil
+	}
+	return nil, errors.New("not held")
+}
+
+type fakeAudit struct{ logs []models.AuditLog }
+
+func (a *fakeAudit) Insert(ctx context.Context, log *models.AuditLog) (*models.AuditLog, error) {
+	a.logs = append(a.logs, *log)
+	return log, nil
+}
+
+type inline struct{}
+
+func (inline) WithTx(ctx context.Context, fn func(ctx context.Context) error) error { return fn(ctx) }
+
+func TestApplyDue(t *testing.T) {
+	store := &fakeStore{
+		due: []models.EmailChange{
+			{ID: 1, UserID: 10, OldEmail: "ada@example.com", NewEmail: "ada@newco.io", Status: models.EmailChangeHeld},
+			{ID: 2, UserID: 11, OldEmail: "bob@example.com", NewEmail: "taken@newco.io", Status: models.EmailChangeHeld},
+			{ID: 3, UserID: 12, OldEmail: "cy@example.com", NewEmail: "cy@newco.io", Status: models.EmailChangeHeld},
+		},
+		taken:   map[string]bool{"taken@newco.io": true},
+		failing: map[int64]bool{3: true},
+	}
+	audit := &fakeAudit{}
+
+	n, err := accounts.ApplyDue(context.Background(), inline{}, store, audit, 100)
+	assert.ErrorContains(t, err, "connection reset", "a failed change is reported and retried later")
+	assert.Equal(t, 1, n)
+	require.Len(t, audit.logs, 2)
+	assert.Equal(t, "email_change_applied", audit.logs[0].Action)
+	assert.Equal(t, int64(10), *audit.logs[0].UserID)
+	assert.Equal(t, "email_change_cancelled", audit.logs[1].Action)
+	assert.Contains(t, audit.logs[1].Metadata, "email_unavailable")
+}
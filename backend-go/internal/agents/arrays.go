@@ -0,0 +1,219 @@
+package agents
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Array encodings: native JSON arrays, JSON arrays written as text, or
+// elements joined by a delimiter
+const (
+	ArrayNative    = "native"
+	ArrayJSON      = "json"
+	ArrayDelimited = "delimited"
+)
+
+// ArrayColumn is a column holding lists of scalar values, as tags or phone
+// numbers. Lengths and Elements are shares of lists and of elements;
+// OtherShare is the share of elements not in Elements. Numeric elements are
+// described by their mean and standard deviation instead.
+type ArrayColumn struct {
+	Column        string             `json:"column"`
+	Encoding      string             `json:"encoding"`
+	Delimiter     string             `json:"delimiter,omitempty"`
+	ElementType   string             `json:"element_type"`
+	MinLength     int                `json:"min_length"`
+	MaxLength     int                `json:"max_length"`
+	MeanLength    float64            `json:"mean_length"`
+	Lengths       map[int]float64    `json:"lengths"`
+	Elements      map[string]float64 `json:"elements,omitempty"`
+	OtherShare    float64            `json:"other_share,omitempty"`
+	ElementMean   *float64           `json:"element_mean,omitempty"`
+	ElementStdDev *float64           `json:"element_std_dev,omitempty"`
+	Unique        bool               `json:"unique,omitempty"`
+}
+
+// SplitArray returns the elements of a value of an array column as text,
+// whatever the encoding it arrived in. Blank values are empty lists; ok is
+// false for values that are not lists of scalars.
+func SplitArray(v interface{}, col ArrayColumn) (elements []string, ok bool) {
+	switch x := v.(type) {
+	case nil:
+		return nil, true
+	case []interface{}:
+		return scalarTexts(x)
+	case string:
+		s := strings.TrimSpace(x)
+		if s == "" {
+			return nil, true
+		}
+		if s[0] == '[' {
+			var items []interface{}
+			if err := json.Unmarshal([]byte(s), &items); err == nil {
+				return scalarTexts(items)
+			}
+		}
+		if col.Encoding != ArrayDelimited {
+			return nil, false
+		}
+		for _, part := range strings.Split(s, col.Delimiter) {
+			if part = strings.TrimSpace(part); part != "" {
+				elements = append(elements, part)
+			}
+		}
+		return elements, true
+	}
+	return nil, false
+}
+
+func scalarTexts(items []interface{}) ([]string, bool) {
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, false
+		}
+		if t := cellText(item); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out, true
+}
+
+// ArrayStats accumulates the generated lists of one array column and
+// compares them with the column's profile
+type ArrayStats struct {
+	col      ArrayColumn
+	lists    int64
+	total    int64
+	lengths  map[int]int64
+	elements map[string]int64
+	numbers  int64
+	sum      float64
+}
+
+// NewArrayStats returns empty stats for a column
+func NewArrayStats(col ArrayColumn) *ArrayStats {
+	return &ArrayStats{col: col, lengths: make(map[int]int64), elements: make(map[string]int64)}
+}
+
+// Add records one generated list
+func (s *ArrayStats) Add(elements []string) {
+	s.lists++
+	s.lengths[len(elements)]++
+	s.total += int64(len(elements))
+	for _, e := range elements {
+		if s.col.ElementMean != nil {
+			if n, err := strconv.ParseFloat(e, 64); err == nil {
+				s.numbers++
+				s.sum += n
+			}
+			continue
+		}
+		s.elements[e]++
+	}
+}
+
+// Lists is the number of lists recorded
+func (s *ArrayStats) Lists() int64 {
+	return s.lists
+}
+
+// MeanLength is the mean length of the lists recorded
+func (s *ArrayStats) MeanLength() float64 {
+	if s.lists == 0 {
+		return 0
+	}
+	return float64(s.total) / float64(s.lists)
+}
+
+// LengthFidelity is one less the total variation distance between the
+// generated and profiled list lengths
+func (s *ArrayStats) LengthFidelity() float64 {
+	if s.lists == 0 {
+		return 1
+	}
+	distance := 0.0
+	for l, share := range s.col.Lengths {
+		distance += math.Abs(share - float64(s.lengths[l])/float64(s.lists))
+	}
+	for l, c := range s.lengths {
+		if _, ok := s.col.Lengths[l]; !ok {
+			distance += float64(c) / float64(s.lists)
+		}
+	}
+	return 1 - math.Min(1, distance/2)
+}
+
+// ElementFidelity compares the generated elements with the profiled ones:
+// one less the distance between the means in standard deviations for
+// numeric elements, one less the total variation distance between the
+// shares otherwise, with elements not profiled pooled as other. It is nil
+// when the profile holds no elements to compare with.
+func (s *ArrayStats) ElementFidelity() *float64 {
+	var fidelity float64
+	switch {
+	case s.col.ElementMean != nil:
+		if s.numbers == 0 {
+			return nil
+		}
+		mean := s.sum / float64(s.numbers)
+		spread := 0.0
+		if s.col.ElementStdDev != nil {
+			spread = *s.col.ElementStdDev
+		}
+		switch {
+		case spread > 0:
+			fidelity = 1 - math.Min(1, math.Abs(mean-*s.col.ElementMean)/spread)
+		case mean == *s.col.ElementMean:
+			fidelity = 1
+		}
+	case len(s.col.Elements) > 0:
+		if s.total == 0 {
+			return nil
+		}
+		distance, other := 0.0, 0.0
+		for e, share := range s.col.Elements {
+			distance += math.Abs(share - float64(s.elements[e])/float64(s.total))
+		}
+		for e, c := range s.elements {
+			if _, ok := s.col.Elements[e]; !ok {
+				other += float64(c) / float64(s.total)
+			}
+		}
+		distance += math.Abs(s.col.OtherShare - other)
+		fidelity = 1 - math.Min(1, distance/2)
+	default:
+		return nil
+	}
+	return &fidelity
+}
+
+// Fidelity averages the length and element fidelity
+func (s *ArrayStats) Fidelity() float64 {
+	if e := s.ElementFidelity(); e != nil {
+		return (s.LengthFidelity() + *e) / 2
+	}
+	return s.LengthFidelity()
+}
+
+// ArrayFidelity is the mean fidelity of the array columns of rows. Values
+// that are not lists are left out.
+func ArrayFidelity(rows []map[string]interface{}, columns []ArrayColumn) float64 {
+	if len(columns) == 0 || len(rows) == 0 {
+		return 1
+	}
+	total := 0.0
+	for _, col := range columns {
+		stats := NewArrayStats(col)
+		for _, row := range rows {
+			if elements, ok := SplitArray(row[col.Column], col); ok {
+				stats.Add(elements)
+			}
+		}
+		total += stats.Fidelity()
+	}
+	return total / float64(len(columns))
+}
@@ -0,0 +1,220 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ModelLimits are the context window and output cap of a model, in tokens
+type ModelLimits struct {
+	ContextTokens   int
+	MaxOutputTokens int
+}
+
+var modelLimits = map[ModelType]ModelLimits{
+	ModelClaude41Opus:   {ContextTokens: 200000, MaxOutputTokens: 32000},
+	ModelClaude41Sonnet: {ContextTokens: 200000, MaxOutputTokens: 64000},
+	ModelClaude4Haiku:   {ContextTokens: 200000, MaxOutputTokens: 8192},
+	ModelClaude37Sonnet: {ContextTokens: 200000, MaxOutputTokens: 64000},
+	ModelClaude35Sonnet: {ContextTokens: 200000, MaxOutputTokens: 8192},
+	ModelClaude3Sonnet:  {ContextTokens: 200000, MaxOutputTokens: 4096},
+	ModelClaude3Opus:    {ContextTokens: 200000, MaxOutputTokens: 4096},
+	ModelClaude35Haiku:  {ContextTokens: 200000, MaxOutputTokens: 8192},
+	ModelClaude3Haiku:   {ContextTokens: 200000, MaxOutputTokens: 4096},
+	ModelClaude2:        {ContextTokens: 100000, MaxOutputTokens: 4096},
+}
+
+// DefaultModelLimits apply to models without known limits
+var DefaultModelLimits = ModelLimits{ContextTokens: 200000, MaxOutputTokens: 4096}
+
+// LimitsFor returns the limits of a model
+func LimitsFor(model ModelType) ModelLimits {
+	if l, ok := modelLimits[model]; ok {
+		return l
+	}
+	return DefaultModelLimits
+}
+
+const (
+	// DefaultBatchParallelism is how many batches run at once when no
+	// limit is configured
+	DefaultBatchParallelism = 4
+	// MaxBatchRows caps a batch however small its rows are
+	MaxBatchRows = 1000
+	// charsPerToken is the rough size of a token in JSON text
+	charsPerToken = 4
+	// tokensPerColumn estimates one generated value with its key
+	tokensPerColumn = 12
+	// defaultColumns is assumed when the schema does not say
+	defaultColumns = 10
+	// outputHeadroom is the share of the output budget planned for rows;
+	// the rest absorbs estimation error and JSON framing
+	outputHeadroom = 0.8
+	// maxTopUpRounds bounds the extra batches run to replace rows dropped
+	// as duplicates
+	maxTopUpRounds = 2
+)
+
+// ErrPromptTooLarge is returned when the prompt leaves no room for a row
+var ErrPromptTooLarge = errors.New("prompt leaves no room in the model context for a single row")
+
+// EstimateTokens approximates the tokens of a text
+func EstimateTokens(s string) int {
+	return (len(s) + charsPerToken - 1) / charsPerToken
+}
+
+// EstimateRowTokens approximates the output tokens of one generated row,
+// from the example rows when there are any and the column count otherwise
+func EstimateRowTokens(req *GenerationRequest) int {
+	if len(req.GroundingRows) > 0 {
+		total := 0
+		for _, row := range req.GroundingRows {
+			b, _ := json.Marshal(row)
+			total += EstimateTokens(string(b))
+		}
+		return total/len(req.GroundingRows) + 2
+	}
+	cols := len(req.SchemaAnalysis.Columns)
+	if cols == 0 {
+		cols = req.SchemaAnalysis.ColumnCount
+	}
+	if cols == 0 {
+		cols = defaultColumns
+	}
+	return cols*tokensPerColumn + 2
+}
+
+// BatchPlan is how the rows of a request are split to fit a model
+type BatchPlan struct {
+	BatchRows    int64   `json:"batch_rows"`
+	Sizes        []int64 `json:"sizes"`
+	PromptTokens int     `json:"prompt_tokens"`
+	RowTokens    int     `json:"row_tokens"`
+}
+
+// PlanBatches sizes batches so each response fits the output cap of the
+// model, the request's MaxTokens if lower, and the context left after the
+// prompt
+func PlanBatches(req *GenerationRequest, prompt string, limits ModelLimits) (BatchPlan, error) {
+	plan := BatchPlan{PromptTokens: EstimateTokens(prompt), RowTokens: EstimateRowTokens(req)}
+	output := limits.MaxOutputTokens
+	if req.Config.MaxTokens > 0 && int(req.Config.MaxTokens) < output {
+		output = int(req.Config.MaxTokens)
+	}
+	if room := limits.ContextTokens - plan.PromptTokens; room < output {
+		output = room
+	}
+	rows := int64(float64(output)*outputHeadroom) / int64(plan.RowTokens)
+	if rows < 1 {
+		return plan, ErrPromptTooLarge
+	}
+	plan.BatchRows = min(rows, MaxBatchRows)
+	plan.Sizes = BatchSizes(req.Config.Rows, plan.BatchRows)
+	return plan, nil
+}
+
+// RunBatches generates every batch with at most parallelism in flight and
+// returns their rows in batch order. The first error cancels the batches
+// still running and is returned.
+func RunBatches(ctx context.Context, sizes []int64, parallelism int, gen func(ctx context.Context, batch int, rows int64) ([]map[string]interface{}, error)) ([][]map[string]interface{}, error) {
+	if parallelism <= 0 {
+		parallelism = DefaultBatchParallelism
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	out := make([][]map[string]interface{}, len(sizes))
+	sem := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	for i, n := range sizes {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, n int64) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			rows, err := gen(ctx, i, n)
+			if err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("batch %d: %w", i+1, err)
+					cancel()
+				})
+				return
+			}
+			out[i] = rows
+		}(i, n)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Deduplicator drops rows repeating a value of a unique column, across
+// every batch passed to Filter
+type Deduplicator struct {
+	columns []string
+	seen    map[string]map[string]bool
+	dropped int64
+}
+
+// NewDeduplicator returns nil when no column is unique
+func NewDeduplicator(columns []ColumnInfo) *Deduplicator {
+	d := &Deduplicator{seen: make(map[string]map[string]bool)}
+	for _, col := range columns {
+		if col.IsUnique && d.seen[col.Name] == nil {
+			d.columns = append(d.columns, col.Name)
+			d.seen[col.Name] = make(map[string]bool)
+		}
+	}
+	if len(d.columns) == 0 {
+		return nil
+	}
+	return d
+}
+
+// Filter returns the rows whose unique values are all new
+func (d *Deduplicator) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if d == nil {
+		return rows
+	}
+	kept := rows[:0:0]
+rows:
+	for _, row := range rows {
+		for _, col := range d.columns {
+			if v, ok := row[col]; ok && v != nil && d.seen[col][fmt.Sprint(v)] {
+				d.dropped++
+				continue rows
+			}
+		}
+		for _, col := range d.columns {
+			if v, ok := row[col]; ok && v != nil {
+				d.seen[col][fmt.Sprint(v)] = true
+			}
+		}
+		kept = append(kept, row)
+	}
+	return kept
+}
+
+// Dropped returns how many rows Filter dropped
+func (d *Deduplicator) Dropped() int64 {
+	if d == nil {
+		return 0
+	}
+	return d.dropped
+}
@@ -0,0 +1,84 @@
+// Package agents_test provides unit tests for batch planning
+package agents_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanBatches(t *testing.T) {
+	req := &agents.GenerationRequest{
+		Config:         agents.GenerationConfig{Rows: 1_000_000},
+		SchemaAnalysis: agents.SchemaAnalysis{ColumnCount: 8},
+	}
+	limits := agents.ModelLimits{ContextTokens: 200000, MaxOutputTokens: 8192}
+	plan, err := agents.PlanBatches(req, "generate rows", limits)
+	require.NoError(t, err)
+	// 8 columns at 12 tokens plus framing is 98 tokens a row; 80% of 8192
+	// fits 66 of them
+	assert.Equal(t, 98, plan.RowTokens)
+	assert.Equal(t, int64(66), plan.BatchRows)
+	var total int64
+	for _, n := range plan.Sizes {
+		total += n
+	}
+	assert.Equal(t, int64(1_000_000), total)
+
+	req.Config.MaxTokens = 1024
+	plan, err = agents.PlanBatches(req, "generate rows", limits)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), plan.BatchRows, "a lower request cap wins")
+
+	_, err = agents.PlanBatches(req, strings.Repeat("x", 800000), limits)
+	assert.ErrorIs(t, err, agents.ErrPromptTooLarge)
+}
+
+func TestRunBatches(t *testing.T) {
+	var inFlight, peak int32
+	out, err := agents.RunBatches(context.Background(), []int64{2, 2, 2, 1}, 2, func(ctx context.Context, batch int, rows int64) ([]map[string]interface{}, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		batchRows := make([]map[string]interface{}, rows)
+		for i := range batchRows {
+			batchRows[i] = map[string]interface{}{"batch": batch}
+		}
+		return batchRows, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, out, 4)
+	assert.Equal(t, 3, out[3][0]["batch"], "batches keep their order")
+	assert.LessOrEqual(t, peak, int32(2))
+
+	boom := errors.New("boom")
+	_, err = agents.RunBatches(context.Background(), []int64{1, 1, 1}, 1, func(ctx context.Context, batch int, rows int64) ([]map[string]interface{}, error) {
+		if batch == 1 {
+			return nil, boom
+		}
+		return nil, nil
+	})
+	assert.ErrorIs(t, err, boom)
+}
+
+func TestDeduplicator(t *testing.T) {
+	d := agents.NewDeduplicator([]agents.ColumnInfo{{Name: "id", IsUnique: true}, {Name: "name"}})
+	first := d.Filter([]map[string]interface{}{{"id": 1.0}, {"id": 2.0}})
+	second := d.Filter([]map[string]interface{}{{"id": 2.0}, {"id": 3.0}, {"id": 3.0}})
+	assert.Len(t, first, 2)
+	assert.Equal(t, []map[string]interface{}{{"id": 3.0}}, second)
+	assert.Equal(t, int64(2), d.Dropped())
+
+	assert.Nil(t, agents.NewDeduplicator([]agents.ColumnInfo{{Name: "name"}}))
+}
@@ -6,12 +6,24 @@ import (
 	"fmt"
 	"math"
 	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/delta"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/eventstream"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/modelserving"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/promptguard"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/provenance"
 )
 
 type ClaudeAgent struct {
 	VertexAI *VertexAIAgent
 	Config   VertexAIConfig
+	// Parallelism caps the batches of one request in flight at once
+	Parallelism int
 }
 
 type ModelType string
@@ -88,6 +100,76 @@ type SchemaAnalysis struct {
 	Correlations  map[string]float64     `json:"correlations"`
 	Constraints   []string               `json:"constraints"`
 	BusinessRules []string               `json:"business_rules"`
+	// Relationships are user-confirmed dependencies between columns that
+	// generated rows must preserve
+	Relationships []Relationship `json:"relationships,omitempty"`
+	// RareEvents are the rare categories and numeric outliers profiled from
+	// the source, with how generated rows must treat them
+	RareEvents []RareEventRule `json:"rare_events,omitempty"`
+	// Weighting is the distribution generated rows must follow when the
+	// source is a weighted sample
+	Weighting *Weighting `json:"weighting,omitempty"`
+	// Hierarchies are categorical columns nested as levels, whose generated
+	// values must follow the allowed paths
+	Hierarchies []Hierarchy `json:"hierarchies,omitempty"`
+	// NestedColumns hold JSON objects or arrays whose generated values must
+	// match the shape inferred from the source
+	NestedColumns []NestedColumn `json:"nested_columns,omitempty"`
+	// ArrayColumns hold lists whose generated lengths and elements must
+	// follow the source's
+	ArrayColumns []ArrayColumn `json:"array_columns,omitempty"`
+	// Vocabularies are columns bound to controlled vocabularies, whose
+	// generated values are drawn from the approved values only
+	Vocabularies []VocabularyColumn `json:"vocabularies,omitempty"`
+	// FreeText are prose columns whose generated text must follow the
+	// source's lengths and languages without reproducing it
+	FreeText []FreeTextColumn `json:"free_text,omitempty"`
+	// Structure sets the duplicate rate and group sizes of generated rows
+	Structure *RowStructure `json:"structure,omitempty"`
+	// ColumnPrivacy is the protection configured for individual columns,
+	// applied to generated values in place of the guessed protection
+	ColumnPrivacy []privacy.ColumnPolicy `json:"column_privacy,omitempty"`
+}
+
+// Weighting targets either the population a weighted sample represents or
+// the raw sample. Population rows are equally weighted, so the weight
+// column is not generated.
+type Weighting struct {
+	Mode         string               `json:"mode"`
+	WeightColumn string               `json:"weight_column"`
+	Columns      []ColumnDistribution `json:"columns"`
+}
+
+// ColumnDistribution is the target distribution of one column: mean and
+// standard deviation when numeric, category shares otherwise
+type ColumnDistribution struct {
+	Column string             `json:"column"`
+	Mean   *float64           `json:"mean,omitempty"`
+	StdDev *float64           `json:"std_dev,omitempty"`
+	Shares map[string]float64 `json:"shares,omitempty"`
+}
+
+// Relationship is a correlation, association or functional dependency
+// between two columns; Strength is the measured coefficient
+type Relationship struct {
+	Kind     string  `json:"kind"`
+	Source   string  `json:"source"`
+	Target   string  `json:"target"`
+	Strength float64 `json:"strength"`
+}
+
+// RareEventRule is how generation treats the rare events of one column:
+// the categories in Values, or values outside Lower and Upper. Rates are
+// fractions of rows.
+type RareEventRule struct {
+	Column     string   `json:"column"`
+	Kind       string   `json:"kind"`
+	Mode       string   `json:"mode"`
+	Values     []string `json:"values,omitempty"`
+	Lower      *float64 `json:"lower,omitempty"`
+	Upper      *float64 `json:"upper,omitempty"`
+	SourceRate float64  `json:"source_rate"`
+	TargetRate float64  `json:"target_rate"`
 }
 
 type ColumnInfo struct {
@@ -105,6 +187,80 @@ type GenerationRequest struct {
 	UserID         int64            `json:"user_id"`
 	Config         GenerationConfig `json:"config"`
 	SchemaAnalysis SchemaAnalysis   `json:"schema_analysis"`
+	// RestrictedColumns are columns the requester is not cleared to see; their
+	// rules and constraints are withheld from the prompt
+	RestrictedColumns []string `json:"restricted_columns,omitempty"`
+	// GroundingRows are masked example rows recorded with the job; at most
+	// privacy.MaxGroundingRows are ever included in the prompt
+	GroundingRows []map[string]interface{} `json:"grounding_rows,omitempty"`
+	// Reference is a sample of source rows the quality of generated rows is
+	// measured against; it never reaches the prompt
+	Reference []map[string]interface{} `json:"reference,omitempty"`
+	// ZeroRealData forbids any source rows or quoted source values in the
+	// prompt; generation relies on profiled statistics alone
+	ZeroRealData bool `json:"zero_real_data,omitempty"`
+	// ExportFormat is the format generated rows are delivered in
+	ExportFormat string `json:"export_format,omitempty"`
+	// ExportFormats are further formats the rows are written in alongside
+	// ExportFormat, from the same rows
+	ExportFormats []string `json:"export_formats,omitempty"`
+	// FixedWidth is the record layout of fixed-width exports
+	FixedWidth *FixedWidthLayout `json:"fixed_width,omitempty"`
+	// FHIR maps columns to the resources of FHIR exports
+	FHIR *FHIRMapping `json:"fhir,omitempty"`
+	// FinancialMessage is the layout of payment message exports
+	FinancialMessage *FinancialMessageLayout `json:"financial_message,omitempty"`
+	// CustomModel is the uploaded model to generate with instead of a
+	// provider, when one was chosen
+	CustomModel *modelserving.Model `json:"custom_model,omitempty"`
+	// MultiTable generates related tables in place of this request's rows
+	MultiTable *MultiTablePlan `json:"multi_table,omitempty"`
+	// EventStream generates a product-analytics event stream locally, from
+	// its parameters alone
+	EventStream *eventstream.Options `json:"event_stream,omitempty"`
+	// Provenance tags the delivered rows with the context they were
+	// generated in, when asked for
+	Provenance *provenance.Options `json:"provenance,omitempty"`
+	// Delta delivers the rows as their changes from a previous run
+	Delta *delta.Options `json:"delta,omitempty"`
+	// Watermark marks the generated values with the job's watermark, as
+	// the free plan's data is
+	Watermark bool `json:"watermark,omitempty"`
+	// Realism replaces the default realism settings, as a template's do;
+	// an empty industry domain is still detected from the schema
+	Realism *RealismConfig `json:"realism,omitempty"`
+	// QualityGate is the dataset's quality policy the rows are held to
+	QualityGate *models.QualityPolicy `json:"quality_gate,omitempty"`
+}
+
+// enforceDataMode refuses zero-real-data requests that carry source rows and
+// strips statistics that quote source values from their schema analysis
+func (req *GenerationRequest) enforceDataMode() error {
+	if !req.ZeroRealData {
+		return nil
+	}
+	if len(req.GroundingRows) > 0 || len(req.Reference) > 0 {
+		return privacy.ErrRealDataForbidden
+	}
+	columns := make([]ColumnInfo, len(req.SchemaAnalysis.Columns))
+	for i, col := range req.SchemaAnalysis.Columns {
+		col.Statistics = privacy.StripSourceValues(col.Statistics)
+		columns[i] = col
+	}
+	req.SchemaAnalysis.Columns = columns
+	req.SchemaAnalysis.Patterns = privacy.StripSourceValues(req.SchemaAnalysis.Patterns)
+	return nil
+}
+
+// screenContent refuses requests whose business rules, constraints or column
+// names look like prompt injection, before any of it reaches a provider
+func (req *GenerationRequest) screenContent() error {
+	texts := append(append([]string{}, req.Config.BusinessRules...), req.SchemaAnalysis.BusinessRules...)
+	texts = append(texts, req.SchemaAnalysis.Constraints...)
+	for _, col := range req.SchemaAnalysis.Columns {
+		texts = append(texts, col.Name)
+	}
+	return promptguard.Check(texts...)
 }
 
 type GenerationResponse struct {
@@ -114,6 +270,8 @@ type GenerationResponse struct {
 	QualityMetrics QualityMetrics `json:"quality_metrics"`
 	OutputKey      *string        `json:"output_key,omitempty"`
 	Error          *string        `json:"error,omitempty"`
+	// Rows are the generated rows, when returned rather than stored
+	Rows []map[string]interface{} `json:"rows,omitempty"`
 }
 
 func NewClaudeAgent(config VertexAIConfig) (*ClaudeAgent, error) {
@@ -137,10 +295,7 @@ func (c *ClaudeAgent) AnalyzeSchema(ctx context.Context, data []map[string]inter
 	}
 
 	prompt := fmt.Sprintf(`
-Analyze the following dataset and provide a comprehensive schema analysis:
-
-Dataset:
-%s
+Analyze the dataset at the end of this prompt and provide a comprehensive schema analysis.
 
 Please provide:
 1. Column information (name, data type, constraints, statistics)
@@ -170,7 +325,12 @@ Return the analysis in JSON format with the following structure:
   "constraints": [],
   "business_rules": []
 }
-`, string(dataJSON))
+
+%s
+
+Dataset:
+%s
+`, promptguard.DataNotice, promptguard.Raw("dataset", string(dataJSON)))
 
 	response, err := c.callClaudeAPI(ctx, prompt, "analyze_schema")
 	if err != nil {
@@ -185,65 +345,167 @@ Return the analysis in JSON format with the following structure:
 	return &analysis, nil
 }
 
-// GenerateSyntheticData generates synthetic data using Claude
+// GenerateSyntheticData generates synthetic data using Claude. The rows
+// are split into batches that fit the model, generated concurrently and
+// stitched in order; rows repeating a unique value of an earlier batch are
+// dropped and replaced by further batches.
 func (c *ClaudeAgent) GenerateSyntheticData(ctx context.Context, req *GenerationRequest) (*GenerationResponse, error) {
-	// Create generation prompt
-	prompt := c.createGenerationPrompt(req)
-
-	// Call Claude API
-	response, err := c.callClaudeAPI(ctx, prompt, "generate_data")
+	if err := req.enforceDataMode(); err != nil {
+		return nil, err
+	}
+	if err := req.screenContent(); err != nil {
+		return nil, err
+	}
+	plan, err := PlanBatches(req, c.createGenerationPrompt(req), LimitsFor(c.model(req)))
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate data: %w", err)
+		return nil, err
+	}
+
+	dedup := NewDeduplicator(req.SchemaAnalysis.Columns)
+	rows := make([]map[string]interface{}, 0, req.Config.Rows)
+	var quality QualityMetrics
+	sizes := plan.Sizes
+	batches := 0
+	var repairs atomic.Int64
+	for round := 0; len(sizes) > 0; round++ {
+		metrics := make([]QualityMetrics, len(sizes))
+		results, err := RunBatches(ctx, sizes, c.Parallelism, func(ctx context.Context, i int, n int64) ([]map[string]interface{}, error) {
+			batchRows, m, r, err := c.generateBatch(ctx, req, n)
+			repairs.Add(int64(r))
+			if err != nil {
+				return nil, err
+			}
+			metrics[i] = *m
+			return batchRows, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate data: %w", err)
+		}
+		for i, batch := range results {
+			batch = dedup.Filter(batch)
+			quality = BlendQuality(quality, int64(len(rows)), metrics[i], int64(len(batch)))
+			rows = append(rows, batch...)
+		}
+		batches += len(sizes)
+
+		short := req.Config.Rows - int64(len(rows))
+		if short <= 0 || round >= maxTopUpRounds {
+			break
+		}
+		sizes = BatchSizes(short, plan.BatchRows)
+	}
+	if int64(len(rows)) > req.Config.Rows {
+		rows = rows[:req.Config.Rows]
 	}
 
-	// Parse response
-	var genResponse GenerationResponse
-	if err := json.Unmarshal([]byte(response), &genResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse generation response: %w", err)
+	quality.Details = map[string]interface{}{
+		"batches":            batches,
+		"batch_rows":         plan.BatchRows,
+		"duplicates_dropped": dedup.Dropped(),
+		"repairs":            repairs.Load(),
 	}
+	return &GenerationResponse{Status: "completed", Progress: 1, QualityMetrics: quality, Rows: rows}, nil
+}
 
-	// Calculate quality metrics
-	qualityMetrics, err := c.calculateQualityMetrics(req, response)
+// generateBatch asks the model for n rows of a request, re-prompting it
+// with the validation errors of responses that break the schema. It also
+// returns how many repairs were needed.
+func (c *ClaudeAgent) generateBatch(ctx context.Context, req *GenerationRequest, n int64) ([]map[string]interface{}, *QualityMetrics, int, error) {
+	batchReq := *req
+	batchReq.Config.Rows = n
+	prompt := c.createGenerationPrompt(&batchReq)
+	validator := NewResponseValidator(req.SchemaAnalysis, n)
+	rows, response, repairs, err := RepairLoop(ctx, validator, RepairAttempts(req), func(ctx context.Context, previous string, issues []ValidationIssue) (string, error) {
+		if len(issues) == 0 {
+			return c.callClaudeAPI(ctx, prompt, "generate_data")
+		}
+		return c.callClaudeAPI(ctx, RepairPrompt(prompt, previous, issues, n), "generate_data")
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to calculate quality metrics: %w", err)
+		return nil, nil, repairs, err
 	}
+	metrics, err := c.calculateQualityMetrics(&batchReq, response)
+	if err != nil {
+		return nil, nil, repairs, fmt.Errorf("failed to calculate quality metrics: %w", err)
+	}
+	return rows, metrics, repairs, nil
+}
 
-	genResponse.QualityMetrics = *qualityMetrics
-	genResponse.Status = "completed"
-
-	return &genResponse, nil
+// model is the model a request runs on
+func (c *ClaudeAgent) model(req *GenerationRequest) ModelType {
+	if req.Config.ModelType != "" {
+		return req.Config.ModelType
+	}
+	return ModelType(c.Config.ModelName)
 }
 
-// StreamGeneration generates data with streaming support
-func (c *ClaudeAgent) StreamGeneration(ctx context.Context, req *GenerationRequest, callback func(string)) error {
-	prompt := c.createGenerationPrompt(req)
+// StreamGeneration generates the requested rows in batches of batchRows and
+// hands each batch to onBatch as soon as it is produced, together with
+// progress and the quality of the rows so far. An error from onBatch stops
+// generation and is returned.
+func (c *ClaudeAgent) StreamGeneration(ctx context.Context, req *GenerationRequest, batchRows int64, onBatch func(StreamBatch) error) (*GenerationResponse, error) {
+	if err := req.enforceDataMode(); err != nil {
+		return nil, err
+	}
+	if err := req.screenContent(); err != nil {
+		return nil, err
+	}
 
-	// For now, simulate streaming by calling the API and sending chunks
-	response, err := c.callClaudeAPI(ctx, prompt, "generate_data")
+	// Batches never exceed what fits the model, whatever the caller asks for
+	plan, err := PlanBatches(req, c.createGenerationPrompt(req), LimitsFor(c.model(req)))
 	if err != nil {
-		return fmt.Errorf("failed to generate data: %w", err)
+		return nil, err
+	}
+	if batchRows <= 0 || batchRows > plan.BatchRows {
+		batchRows = plan.BatchRows
 	}
 
-	// Simulate streaming by sending response in chunks
-	chunkSize := 100
-	for i := 0; i < len(response); i += chunkSize {
-		end := i + chunkSize
-		if end > len(response) {
-			end = len(response)
+	dedup := NewDeduplicator(req.SchemaAnalysis.Columns)
+	total := req.Config.Rows
+	var done int64
+	var quality QualityMetrics
+	for i, n := range BatchSizes(total, batchRows) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		rows, metrics, _, err := c.generateBatch(ctx, req, n)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate batch %d: %w", i+1, err)
+		}
+		rows = dedup.Filter(rows)
+		quality = BlendQuality(quality, done, *metrics, int64(len(rows)))
+		done += int64(len(rows))
+
+		progress := 1.0
+		if total > 0 && done < total {
+			progress = float64(done) / float64(total)
+		}
+		if err := onBatch(StreamBatch{
+			Batch:     i + 1,
+			Rows:      rows,
+			RowsDone:  done,
+			RowsTotal: total,
+			Progress:  progress,
+			Quality:   quality,
+		}); err != nil {
+			return nil, err
 		}
-		callback(response[i:end])
 	}
 
-	return nil
+	return &GenerationResponse{Status: "completed", Progress: 1, QualityMetrics: quality}, nil
 }
 
-// createGenerationPrompt creates a comprehensive prompt for data generation
+// PromptTemplateVersion identifies the generation prompt template rows are
+// traced back to; bump it whenever createGenerationPrompt changes
+const PromptTemplateVersion = "generation-prompt/v1"
+
+// createGenerationPrompt creates a comprehensive prompt for data generation.
+// The instructions come first; schema-derived and user-supplied content
+// follows in data blocks the model is told never to take instructions from.
 func (c *ClaudeAgent) createGenerationPrompt(req *GenerationRequest) string {
+	rules := append(append([]string{}, req.Config.BusinessRules...), req.SchemaAnalysis.BusinessRules...)
 	return fmt.Sprintf(`
-You are an expert synthetic data generator. Generate %d rows of synthetic data based on the following requirements:
-
-Dataset Schema:
-%s
+You are an expert synthetic data generator. Generate %d rows of synthetic data based on the following requirements.
 
 Generation Configuration:
 - Privacy Level: %s (epsilon: %f, delta: %f)
@@ -254,12 +516,6 @@ Generation Configuration:
 - Quality Threshold: %f
 - Temperature: %f
 
-Business Rules:
-%s
-
-Constraints:
-%s
-
 Please generate high-quality synthetic data that:
 1. Maintains statistical properties of the original data
 2. Preserves correlations between columns
@@ -268,9 +524,20 @@ Please generate high-quality synthetic data that:
 5. Is semantically coherent and realistic
 
 Return the data in JSON format as an array of objects.
+
+%s
+
+Dataset Schema:
+%s
+
+Business Rules:
+%s
+
+Constraints:
+%s
+%s%s
 `,
 		req.Config.Rows,
-		c.formatSchemaAnalysis(req.SchemaAnalysis),
 		req.Config.PrivacyLevel,
 		req.Config.Epsilon,
 		req.Config.Delta,
@@ -280,8 +547,12 @@ Return the data in JSON format as an array of objects.
 		req.Config.AddNoise,
 		req.Config.QualityThreshold,
 		req.Config.Temperature,
-		c.formatBusinessRules(req.SchemaAnalysis.BusinessRules),
-		c.formatConstraints(req.SchemaAnalysis.Constraints),
+		promptguard.DataNotice,
+		c.formatSchemaAnalysis(req.SchemaAnalysis),
+		c.formatBusinessRules(withoutRestricted(rules, req.RestrictedColumns)),
+		c.formatConstraints(withoutRestricted(req.SchemaAnalysis.Constraints, req.RestrictedColumns)),
+		c.formatRestrictedColumns(req.RestrictedColumns),
+		c.formatGroundingRows(req.GroundingRows),
 	)
 }
 
@@ -353,14 +624,33 @@ func (c *ClaudeAgent) calculateQualityMetrics(req *GenerationRequest, response s
 	wordCount := c.countWords(response)
 	sentenceCount := c.countSentences(response)
 
-	// Calculate statistical similarity based on request configuration
-	statisticalSimilarity := c.calculateStatisticalSimilarity(req, response)
-
-	// Calculate distribution fidelity
-	distributionFidelity := c.calculateDistributionFidelity(req, response)
-
-	// Calculate correlation preservation
-	correlationPreservation := c.calculateCorrelationPreservation(req, response)
+	// Rows are measured against the request's reference sample of the
+	// source: column tests and divergences, the correlation matrix and how
+	// well the two can be told apart. Requests without one fall back to
+	// estimates from the request and response.
+	var report *fidelity.Report
+	if len(req.Reference) > 0 {
+		if rows, err := ParseRows(response); err == nil {
+			report = fidelity.Compare(req.Reference, rows)
+		}
+	}
+	var statisticalSimilarity, distributionFidelity, correlationPreservation float64
+	if report != nil {
+		statisticalSimilarity = report.StatisticalSimilarity
+		distributionFidelity = report.DistributionFidelity
+		correlationPreservation = report.CorrelationPreservation
+	} else {
+		statisticalSimilarity = c.calculateStatisticalSimilarity(req, response)
+		distributionFidelity = c.calculateDistributionFidelity(req, response)
+		correlationPreservation = c.calculateCorrelationPreservation(req, response)
+	}
+	arrayFidelity := 1.0
+	if len(req.SchemaAnalysis.ArrayColumns) > 0 {
+		if rows, err := ParseRows(response); err == nil {
+			arrayFidelity = ArrayFidelity(rows, req.SchemaAnalysis.ArrayColumns)
+			distributionFidelity *= arrayFidelity
+		}
+	}
 
 	// Calculate privacy protection based on privacy level
 	privacyProtection := c.calculatePrivacyProtection(req, response)
@@ -370,6 +660,13 @@ func (c *ClaudeAgent) calculateQualityMetrics(req *GenerationRequest, response s
 
 	// Calculate constraint compliance
 	constraintCompliance := c.calculateConstraintCompliance(req, response)
+	hierarchyCompliance := 1.0
+	if len(req.SchemaAnalysis.Hierarchies) > 0 {
+		if rows, err := ParseRows(response); err == nil {
+			hierarchyCompliance = HierarchyCompliance(rows, req.SchemaAnalysis.Hierarchies)
+			constraintCompliance *= hierarchyCompliance
+		}
+	}
 
 	// Calculate execution metrics
 	executionTime := c.calculateExecutionTime(req)
@@ -390,6 +687,15 @@ func (c *ClaudeAgent) calculateQualityMetrics(req *GenerationRequest, response s
 		"word_count":           wordCount,
 		"sentence_count":       sentenceCount,
 	}
+	if len(req.SchemaAnalysis.Hierarchies) > 0 {
+		details["hierarchy_compliance"] = hierarchyCompliance
+	}
+	if len(req.SchemaAnalysis.ArrayColumns) > 0 {
+		details["array_fidelity"] = arrayFidelity
+	}
+	if report != nil {
+		details["fidelity"] = report
+	}
 
 	metrics := &QualityMetrics{
 		OverallQuality:          overallQuality,
@@ -412,22 +718,68 @@ func (c *ClaudeAgent) calculateQualityMetrics(req *GenerationRequest, response s
 
 // Helper methods for formatting
 func (c *ClaudeAgent) formatSchemaAnalysis(analysis SchemaAnalysis) string {
-	// Format schema analysis for prompt
-	return fmt.Sprintf("Columns: %d, Rows: %d", analysis.ColumnCount, analysis.RowCount)
+	// Format schema analysis for prompt; column names come from the source
+	// and are data like any other value
+	names := make([]string, 0, len(analysis.Columns))
+	for _, col := range analysis.Columns {
+		if col.DataType == "" {
+			names = append(names, col.Name)
+			continue
+		}
+		names = append(names, fmt.Sprintf("%s (%s)", col.Name, col.DataType))
+	}
+	return fmt.Sprintf("Columns: %d, Rows: %d\n%s", analysis.ColumnCount, analysis.RowCount, promptguard.Block("columns", names))
 }
 
 func (c *ClaudeAgent) formatBusinessRules(rules []string) string {
-	if len(rules) == 0 {
-		return "None specified"
-	}
-	return fmt.Sprintf("%v", rules)
+	return promptguard.Block("business_rules", rules)
 }
 
 func (c *ClaudeAgent) formatConstraints(constraints []string) string {
-	if len(constraints) == 0 {
-		return "None specified"
+	return promptguard.Block("constraints", constraints)
+}
+
+func (c *ClaudeAgent) formatRestrictedColumns(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nRestricted Columns (generate fully synthetic values; never reproduce, infer or describe source values):\n%s\n", promptguard.Block("restricted_columns", columns))
+}
+
+func (c *ClaudeAgent) formatGroundingRows(rows []map[string]interface{}) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	if len(rows) > privacy.MaxGroundingRows {
+		rows = rows[:privacy.MaxGroundingRows]
+	}
+	data, err := json.Marshal(rows)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("\nExample Rows (real records with sensitive values masked as %q; use them for format and style only, never copy them):\n%s\n", privacy.MaskedValue, promptguard.Raw("example_rows", string(data)))
+}
+
+// withoutRestricted drops lines that mention a restricted column
+func withoutRestricted(lines, restricted []string) []string {
+	if len(restricted) == 0 {
+		return lines
+	}
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		lower := strings.ToLower(line)
+		mentioned := false
+		for _, col := range restricted {
+			if strings.Contains(lower, strings.ToLower(col)) {
+				mentioned = true
+				break
+			}
+		}
+		if !mentioned {
+			out = append(out, line)
+		}
 	}
-	return fmt.Sprintf("%v", constraints)
+	return out
 }
 
 // Helper functions for callClaudeAPI
@@ -0,0 +1,103 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/modelserving"
+)
+
+// ErrNoCustomModel is returned when custom model generation is asked for
+// without a model to generate with
+var ErrNoCustomModel = errors.New("no custom model was chosen for generation")
+
+// CustomModelServer samples rows from an uploaded model
+type CustomModelServer interface {
+	Generate(ctx context.Context, req modelserving.Request) ([]map[string]interface{}, error)
+}
+
+// CustomModelGenerator generates rows with the uploaded model a request
+// names, run by an inference server. Rows that break the dataset schema
+// fail the batch; a tabular model cannot be asked to repair them.
+type CustomModelGenerator struct {
+	Server CustomModelServer
+	// Seed fixes the rows drawn; 0 seeds from the clock
+	Seed int64
+}
+
+// GenerateSyntheticData generates every requested row at once
+func (g CustomModelGenerator) GenerateSyntheticData(ctx context.Context, req *GenerationRequest) (*GenerationResponse, error) {
+	var rows []map[string]interface{}
+	resp, err := g.StreamGeneration(ctx, req, req.Config.Rows, func(b StreamBatch) error {
+		rows = append(rows, b.Rows...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Rows = rows
+	return resp, nil
+}
+
+// StreamGeneration asks the model for the requested rows in batches of
+// batchRows, scoring each against the reference sample
+func (g CustomModelGenerator) StreamGeneration(ctx context.Context, req *GenerationRequest, batchRows int64, onBatch func(StreamBatch) error) (*GenerationResponse, error) {
+	if err := req.enforceDataMode(); err != nil {
+		return nil, err
+	}
+	if req.CustomModel == nil {
+		return nil, ErrNoCustomModel
+	}
+	if g.Server == nil {
+		return nil, modelserving.ErrNotConfigured
+	}
+	columns := make([]modelserving.Column, len(req.SchemaAnalysis.Columns))
+	for i, col := range req.SchemaAnalysis.Columns {
+		columns[i] = modelserving.Column{Name: col.Name, Type: col.DataType, Nullable: col.IsNullable}
+	}
+	seed := g.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	total := req.Config.Rows
+	var done int64
+	var quality QualityMetrics
+	for i, n := range BatchSizes(total, batchRows) {
+		start := time.Now()
+		rows, err := g.Server.Generate(ctx, modelserving.Request{
+			Model:   *req.CustomModel,
+			Rows:    n,
+			Columns: columns,
+			Seed:    seed + int64(i),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("custom model generation failed: %w", err)
+		}
+		if issues := NewResponseValidator(req.SchemaAnalysis, n).Check(rows); len(issues) > 0 {
+			return nil, fmt.Errorf("%w: batch %d: %s", ErrInvalidResponse, i+1, summarize(issues))
+		}
+		metrics := referenceQuality(req.Reference, rows, time.Since(start))
+		quality = BlendQuality(quality, done, metrics, n)
+		done += n
+		if err := onBatch(StreamBatch{
+			Batch:     i + 1,
+			Rows:      rows,
+			RowsDone:  done,
+			RowsTotal: total,
+			Progress:  float64(done) / float64(total),
+			Quality:   quality,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	quality.Details = map[string]interface{}{
+		"provider":  string(ProviderCustom),
+		"model":     req.CustomModel.Name(),
+		"framework": req.CustomModel.Framework,
+	}
+	return &GenerationResponse{Status: "completed", Progress: 1, QualityMetrics: quality}, nil
+}
@@ -0,0 +1,59 @@
+// Package agents_test provides unit tests for custom model generation
+package agents_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/modelserving"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeModelServer records requests and returns rows from rows
+type fakeModelServer struct {
+	requests []modelserving.Request
+	rows     func(n int64) []map[string]interface{}
+}
+
+func (s *fakeModelServer) Generate(ctx context.Context, req modelserving.Request) ([]map[string]interface{}, error) {
+	s.requests = append(s.requests, req)
+	return s.rows(req.Rows), nil
+}
+
+func TestCustomModelGenerator(t *testing.T) {
+	server := &fakeModelServer{rows: func(n int64) []map[string]interface{} {
+		rows := make([]map[string]interface{}, n)
+		for i := range rows {
+			rows[i] = map[string]interface{}{"id": float64(i), "score": nil, "joined": "2024-05-01", "active": true}
+		}
+		return rows
+	}}
+	model := &modelserving.Model{ID: 3, Framework: "onnx", Artifact: "custom-models/1/3/ctgan.onnx"}
+	req := &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 25}, SchemaAnalysis: validationSchema, CustomModel: model}
+
+	var batches int
+	resp, err := agents.CustomModelGenerator{Server: server, Seed: 5}.StreamGeneration(context.Background(), req, 10, func(b agents.StreamBatch) error {
+		batches++
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, batches)
+	require.Len(t, server.requests, 3)
+	assert.Equal(t, []int64{10, 10, 5}, []int64{server.requests[0].Rows, server.requests[1].Rows, server.requests[2].Rows})
+	assert.NotEqual(t, server.requests[0].Seed, server.requests[1].Seed, "batches draw different rows")
+	assert.Equal(t, *model, server.requests[0].Model)
+	assert.Equal(t, modelserving.Column{Name: "score", Type: "float", Nullable: true}, server.requests[0].Columns[1])
+	assert.Equal(t, "custom-model-3", resp.QualityMetrics.Details["model"])
+
+	server.rows = func(n int64) []map[string]interface{} {
+		return []map[string]interface{}{{"id": "one"}}
+	}
+	_, err = agents.CustomModelGenerator{Server: server}.GenerateSyntheticData(context.Background(), req)
+	assert.ErrorIs(t, err, agents.ErrInvalidResponse)
+
+	req.CustomModel = nil
+	_, err = agents.CustomModelGenerator{Server: server}.GenerateSyntheticData(context.Background(), req)
+	assert.ErrorIs(t, err, agents.ErrNoCustomModel)
+}
@@ -0,0 +1,20 @@
+package agents
+
+// FHIRField maps a column to an element of a FHIR resource. Columns mapped
+// to an Observation value carry the code, and unit, of the observation they
+// record.
+type FHIRField struct {
+	Column   string `json:"column"`
+	Resource string `json:"resource"`
+	Path     string `json:"path"`
+	Code     string `json:"code,omitempty"`
+	System   string `json:"system,omitempty"`
+	Display  string `json:"display,omitempty"`
+	Unit     string `json:"unit,omitempty"`
+}
+
+// FHIRMapping is how generated rows are written as FHIR R4 resources: each
+// row is one patient, with their encounter and observations
+type FHIRMapping struct {
+	Fields []FHIRField `json:"fields"`
+}
@@ -0,0 +1,24 @@
+package agents
+
+// FinancialMessageEnvelope is the metadata of the messages rendered from a
+// job's rows: who sends and receives them and, for statements, the account
+// they report on
+type FinancialMessageEnvelope struct {
+	MessageIDPrefix string  `json:"message_id_prefix,omitempty"`
+	InitiatingParty string  `json:"initiating_party,omitempty"`
+	SenderBIC       string  `json:"sender_bic,omitempty"`
+	ReceiverBIC     string  `json:"receiver_bic,omitempty"`
+	AccountIBAN     string  `json:"account_iban,omitempty"`
+	AccountCurrency string  `json:"account_currency,omitempty"`
+	OpeningBalance  float64 `json:"opening_balance,omitempty"`
+	ChargeBearer    string  `json:"charge_bearer,omitempty"`
+}
+
+// FinancialMessageLayout is how generated transaction rows are rendered as
+// payment messages: the message type, the column holding each part of a
+// transaction and the envelope of the messages
+type FinancialMessageLayout struct {
+	MessageType string                   `json:"message_type"`
+	Columns     map[string]string        `json:"columns"`
+	Envelope    FinancialMessageEnvelope `json:"envelope"`
+}
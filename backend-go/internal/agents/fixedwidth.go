@@ -0,0 +1,22 @@
+package agents
+
+// FixedWidthField is one field of a fixed-width record: the column written
+// to it, its width and how shorter values are padded. Decimals fixes the
+// digits written after the point of numeric values.
+type FixedWidthField struct {
+	Column   string `json:"column"`
+	Width    int    `json:"width"`
+	Align    string `json:"align"`
+	Pad      string `json:"pad"`
+	Decimals *int   `json:"decimals,omitempty"`
+}
+
+// FixedWidthLayout is how generated rows are written as a fixed-width flat
+// file: the fields in record order, the character encoding, what ends each
+// record and what happens to values too wide for their field
+type FixedWidthLayout struct {
+	Fields           []FixedWidthField `json:"fields"`
+	Encoding         string            `json:"encoding"`
+	RecordTerminator string            `json:"record_terminator"`
+	Overflow         string            `json:"overflow"`
+}
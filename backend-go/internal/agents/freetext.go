@@ -0,0 +1,18 @@
+package agents
+
+// FreeTextColumn is a column of prose, as notes or reviews. Generated text
+// must follow its length quantiles, in characters, and its language shares.
+// Examples are source texts with their PII replaced by placeholders, and
+// SourceHashes identify the scrubbed source texts so generated copies of
+// them can be found.
+type FreeTextColumn struct {
+	Column       string             `json:"column"`
+	MinLength    int                `json:"min_length"`
+	P10Length    int                `json:"p10_length"`
+	MedianLength int                `json:"median_length"`
+	P90Length    int                `json:"p90_length"`
+	MaxLength    int                `json:"max_length"`
+	Languages    map[string]float64 `json:"languages"`
+	Examples     []string           `json:"examples,omitempty"`
+	SourceHashes []string           `json:"source_hashes,omitempty"`
+}
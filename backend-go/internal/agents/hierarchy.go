@@ -0,0 +1,150 @@
+package agents
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Hierarchy nests categorical columns as levels, top level first, as
+// department > team. When Paths is set, generated values must follow one of
+// its paths or a prefix of one; otherwise each value may only ever appear
+// under one parent.
+type Hierarchy struct {
+	Levels []string   `json:"levels"`
+	Source string     `json:"source"`
+	Paths  [][]string `json:"paths,omitempty"`
+}
+
+// pathSep joins path values into map keys
+const pathSep = "\x1f"
+
+// HierarchyChecker checks generated rows against hierarchies. Parents seen
+// for values are remembered across rows passed to Record.
+type HierarchyChecker struct {
+	hierarchies []Hierarchy
+	prefixes    []map[string]bool
+	parents     []map[string]string
+}
+
+// NewHierarchyChecker returns nil when there are no hierarchies
+func NewHierarchyChecker(hierarchies []Hierarchy) *HierarchyChecker {
+	if len(hierarchies) == 0 {
+		return nil
+	}
+	c := &HierarchyChecker{hierarchies: hierarchies}
+	for _, h := range hierarchies {
+		var prefixes map[string]bool
+		if len(h.Paths) > 0 {
+			prefixes = make(map[string]bool)
+			for _, path := range h.Paths {
+				for i := 1; i <= len(path); i++ {
+					prefixes[strings.Join(path[:i], pathSep)] = true
+				}
+			}
+		}
+		c.prefixes = append(c.prefixes, prefixes)
+		c.parents = append(c.parents, make(map[string]string))
+	}
+	return c
+}
+
+// Violations returns the indexes of the hierarchies a row breaks. A level
+// may only be blank when every level below it is.
+func (c *HierarchyChecker) Violations(row map[string]interface{}) []int {
+	if c == nil {
+		return nil
+	}
+	var out []int
+	for i, h := range c.hierarchies {
+		values, ok := levelValues(row, h.Levels)
+		switch {
+		case !ok:
+			out = append(out, i)
+		case len(values) == 0:
+		case c.prefixes[i] != nil:
+			if !c.prefixes[i][strings.Join(values, pathSep)] {
+				out = append(out, i)
+			}
+		default:
+			for l := 1; l < len(values); l++ {
+				if p, seen := c.parents[i][parentKey(l, values[l])]; seen && p != values[l-1] {
+					out = append(out, i)
+					break
+				}
+			}
+		}
+	}
+	return out
+}
+
+// Record remembers the parents of a row's values
+func (c *HierarchyChecker) Record(row map[string]interface{}) {
+	if c == nil {
+		return
+	}
+	for i, h := range c.hierarchies {
+		if c.prefixes[i] != nil {
+			continue
+		}
+		values, _ := levelValues(row, h.Levels)
+		for l := 1; l < len(values); l++ {
+			key := parentKey(l, values[l])
+			if _, seen := c.parents[i][key]; !seen {
+				c.parents[i][key] = values[l-1]
+			}
+		}
+	}
+}
+
+// HierarchyCompliance is the share of rows that break no hierarchy, each
+// row checked against those before it
+func HierarchyCompliance(rows []map[string]interface{}, hierarchies []Hierarchy) float64 {
+	c := NewHierarchyChecker(hierarchies)
+	if c == nil || len(rows) == 0 {
+		return 1
+	}
+	ok := 0
+	for _, row := range rows {
+		if len(c.Violations(row)) == 0 {
+			ok++
+			c.Record(row)
+		}
+	}
+	return float64(ok) / float64(len(rows))
+}
+
+// levelValues returns the leading non-blank values of a row's levels; false
+// when a level is set below a blank one
+func levelValues(row map[string]interface{}, levels []string) ([]string, bool) {
+	var values []string
+	blank := false
+	for _, level := range levels {
+		v := cellText(row[level])
+		if v == "" {
+			blank = true
+			continue
+		}
+		if blank {
+			return nil, false
+		}
+		values = append(values, v)
+	}
+	return values, true
+}
+
+func parentKey(level int, value string) string {
+	return strconv.Itoa(level) + pathSep + value
+}
+
+func cellText(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
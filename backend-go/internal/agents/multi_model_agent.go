@@ -3,10 +3,13 @@ package agents
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/promptguard"
 )
 
 type AIProvider string
@@ -62,19 +65,12 @@ type MultiModelAgent struct {
 	claudeAgent   *ClaudeAgent
 	realismEngine *EnhancedRealismEngine
 	openaiClient  *OpenAIClient
-	vertexClient  *VertexAIAgent
-	customModels  map[string]interface{}
+	customModels  CustomModelGenerator
 	capabilities  map[AIProvider]ModelCapabilities
 	config        MultiModelConfig
 	mu            sync.RWMutex // Add mutex for thread safety
 }
 
-type OpenAIClient struct {
-	APIKey     string
-	BaseURL    string
-	HTTPClient interface{} // Simplified for now
-}
-
 func NewMultiModelAgent(
 	claudeAPIKey, openaiAPIKey string,
 	config MultiModelConfig,
@@ -91,23 +87,30 @@ func NewMultiModelAgent(
 	agent := &MultiModelAgent{
 		claudeAgent:   claudeAgent,
 		realismEngine: NewEnhancedRealismEngine(),
-		openaiClient: &OpenAIClient{
-			APIKey:  openaiAPIKey,
-			BaseURL: "https://api.openai.com",
-		},
-		customModels: make(map[string]interface{}),
-		config:       config,
+		openaiClient:  NewOpenAIClient(openaiAPIKey),
+		config:        config,
 	}
 
 	agent.initializeCapabilities()
 	return agent, nil
 }
 
+// SetCustomModelServer sets the inference server uploaded models are run
+// on as ProviderCustom
+func (m *MultiModelAgent) SetCustomModelServer(server CustomModelServer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.customModels.Server = server
+}
+
 // GenerateData orchestrates multi-model generation
 func (m *MultiModelAgent) GenerateData(
 	ctx context.Context,
 	req *GenerationRequest,
 ) (*GenerationResponse, error) {
+	if err := req.enforceDataMode(); err != nil {
+		return nil, err
+	}
 
 	// Step 1: Analyze requirements and select optimal model
 	selectedProvider, err := m.selectOptimalProvider(req)
@@ -148,22 +151,28 @@ func (m *MultiModelAgent) GenerateData(
 	}
 
 	// Step 4: Apply realism engine
+	realism := RealismConfig{
+		EnforceBusinessRules:             true,
+		ValidateDomainConstraints:        true,
+		PreserveTemporalPatterns:         true,
+		MaintainSemanticConsistency:      true,
+		UseDomainOntologies:              true,
+		ApplyRegulatoryCompliance:        true,
+		CrossFieldValidation:             true,
+		StatisticalAccuracyThreshold:     0.95,
+		CorrelationPreservationThreshold: 0.90,
+	}
+	if req.Realism != nil {
+		realism = *req.Realism
+	}
+	if realism.IndustryDomain == "" {
+		realism.IndustryDomain = m.detectIndustryDomain(req.SchemaAnalysis)
+	}
 	_, realismMetrics, err := m.realismEngine.EnhanceSyntheticData(
 		ctx,
 		[]map[string]interface{}{}, // This would be the actual generated data
 		[]map[string]interface{}{}, // Original data
-		RealismConfig{
-			IndustryDomain:                   m.detectIndustryDomain(req.SchemaAnalysis),
-			EnforceBusinessRules:             true,
-			ValidateDomainConstraints:        true,
-			PreserveTemporalPatterns:         true,
-			MaintainSemanticConsistency:      true,
-			UseDomainOntologies:              true,
-			ApplyRegulatoryCompliance:        true,
-			CrossFieldValidation:             true,
-			StatisticalAccuracyThreshold:     0.95,
-			CorrelationPreservationThreshold: 0.90,
-		},
+		realism,
 		req.SchemaAnalysis,
 	)
 
@@ -191,6 +200,14 @@ func (m *MultiModelAgent) selectOptimalProvider(req *GenerationRequest) (AIProvi
 		scores[provider] = score
 	}
 
+	// An uploaded model is only used when the request names one, and then
+	// always when custom models are preferred
+	if req.CustomModel == nil {
+		delete(scores, ProviderCustom)
+	} else if m.config.CustomModelPreference {
+		return ProviderCustom, nil
+	}
+
 	// Select best provider
 	bestProvider := m.config.PrimaryProvider
 	bestScore := scores[bestProvider]
@@ -210,60 +227,109 @@ func (m *MultiModelAgent) generateWithClaude(ctx context.Context, req *Generatio
 	return m.claudeAgent.GenerateSyntheticData(ctx, req)
 }
 
-// generateWithOpenAI generates data using OpenAI
-func (m *MultiModelAgent) generateWithOpenAI(ctx context.Context, req *GenerationRequest) (*GenerationResponse, error) {
-	// Advanced OpenAI implementation with Vertex AI
-	vertexAI := m.vertexClient
+// openAISystemPrompt asks for the JSON object JSON mode requires
+const openAISystemPrompt = `You generate synthetic tabular data. Respond with a single JSON object of the form {"rows": [ ... ]} where each element is one generated row.`
 
-	// Analyze data complexity and select optimal model
-	_ = m.selectOptimalOpenAIModel(req)
-
-	// Generate with advanced prompting
-	_ = m.buildAdvancedPrompt(req, "openai")
-
-	// Use Vertex AI for OpenAI models
-	response, err := vertexAI.GenerateText(*req)
+// generateWithOpenAI generates data with the OpenAI chat completions API in
+// JSON mode. The prompt is the one Claude gets, so restricted columns,
+// grounding limits and zero-real-data mode apply the same way.
+func (m *MultiModelAgent) generateWithOpenAI(ctx context.Context, req *GenerationRequest) (*GenerationResponse, error) {
+	if m.openaiClient == nil || m.openaiClient.APIKey == "" {
+		return nil, ErrOpenAINotConfigured
+	}
+	if err := req.enforceDataMode(); err != nil {
+		return nil, err
+	}
+	if err := req.screenContent(); err != nil {
+		return nil, err
+	}
 
+	chatReq := ChatCompletionRequest{
+		Model: m.selectOptimalOpenAIModel(req),
+		Messages: []ChatMessage{
+			{Role: "system", Content: openAISystemPrompt},
+			{Role: "user", Content: m.claudeAgent.createGenerationPrompt(req)},
+		},
+		MaxTokens:      req.Config.MaxTokens,
+		ResponseFormat: &ResponseFormat{Type: "json_object"},
+	}
+	if req.Config.Temperature > 0 {
+		chatReq.Temperature = &req.Config.Temperature
+	}
+
+	// Invalid responses are repaired in the same conversation: the model
+	// sees its answer followed by what was wrong with it
+	var model string
+	usage := ChatUsage{}
+	validator := NewResponseValidator(req.SchemaAnalysis, req.Config.Rows)
+	rows, content, repairs, err := RepairLoop(ctx, validator, RepairAttempts(req), func(ctx context.Context, previous string, issues []ValidationIssue) (string, error) {
+		if len(issues) > 0 {
+			chatReq.Messages = append(chatReq.Messages,
+				ChatMessage{Role: "assistant", Content: previous},
+				ChatMessage{Role: "user", Content: RepairInstructions(issues, req.Config.Rows)},
+			)
+		}
+		if req.Config.EnableStreaming {
+			model = chatReq.Model
+			return m.openaiClient.StreamChatCompletion(ctx, chatReq, nil)
+		}
+		resp, err := m.openaiClient.ChatCompletion(ctx, chatReq)
+		if err != nil {
+			return "", err
+		}
+		model = resp.Model
+		usage.PromptTokens += resp.Usage.PromptTokens
+		usage.CompletionTokens += resp.Usage.CompletionTokens
+		usage.TotalTokens += resp.Usage.TotalTokens
+		return resp.Content(), nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("OpenAI generation failed: %w", err)
 	}
+	metrics, err := m.claudeAgent.calculateQualityMetrics(req, content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate quality metrics: %w", err)
+	}
+	if metrics.Details == nil {
+		metrics.Details = make(map[string]interface{})
+	}
+	metrics.Details["provider"] = string(ProviderOpenAI)
+	metrics.Details["model"] = model
+	metrics.Details["rows_generated"] = len(rows)
+	metrics.Details["repairs"] = repairs
+	metrics.Details["usage"] = usage
 
-	// Return the response from Vertex AI
-	return response, nil
+	return &GenerationResponse{Status: "completed", Progress: 1, QualityMetrics: *metrics}, nil
 }
 
-// generateWithCustomModel generates data using custom models
+// generateWithCustomModel generates data with the uploaded model the
+// request names, run on the inference server
 func (m *MultiModelAgent) generateWithCustomModel(ctx context.Context, req *GenerationRequest) (*GenerationResponse, error) {
-	// Advanced custom model implementation
-	vertexAI := m.vertexClient
-
-	// Select optimal custom model based on requirements
-	_ = m.selectOptimalCustomModel(req)
-
-	// Build domain-specific prompt
-	_ = m.buildDomainSpecificPrompt(req, "custom")
-
-	// Generate with custom model
-	response, err := vertexAI.GenerateText(*req)
-
-	if err != nil {
-		return nil, fmt.Errorf("custom model generation failed: %w", err)
-	}
-
-	// Return the response from Vertex AI
-	return response, nil
+	m.mu.RLock()
+	generator := m.customModels
+	m.mu.RUnlock()
+	return generator.GenerateSyntheticData(ctx, req)
 }
 
 // generateWithEnsemble generates data using ensemble methods
 func (m *MultiModelAgent) generateWithEnsemble(ctx context.Context, req *GenerationRequest) (*GenerationResponse, error) {
-	// Generate with multiple providers
-	claudeResult, _ := m.generateWithClaude(ctx, req)
-	openaiResult, _ := m.generateWithOpenAI(ctx, req)
+	// Generate with multiple providers; members that fail are left out
+	var results []*GenerationResponse
+	var errs []error
+	for _, generate := range []func(context.Context, *GenerationRequest) (*GenerationResponse, error){m.generateWithClaude, m.generateWithOpenAI} {
+		result, err := generate(ctx, req)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("every ensemble member failed: %w", errors.Join(errs...))
+	}
 
 	// Combine results using ensemble voting
-	ensembleResult := m.combineResults([]*GenerationResponse{claudeResult, openaiResult})
-
-	return ensembleResult, nil
+	return m.combineResults(results), nil
 }
 
 // tryFallbackProviders attempts to use fallback providers
@@ -426,6 +492,9 @@ func (m *MultiModelAgent) combineResults(results []*GenerationResponse) *Generat
 	}
 
 	// Enhance with ensemble information
+	if bestResult.QualityMetrics.Details == nil {
+		bestResult.QualityMetrics.Details = make(map[string]interface{})
+	}
 	bestResult.QualityMetrics.Details["ensemble_used"] = true
 	bestResult.QualityMetrics.Details["ensemble_size"] = len(results)
 
@@ -453,36 +522,12 @@ func (m *MultiModelAgent) selectOptimalOpenAIModel(req *GenerationRequest) strin
 	rows := req.Config.Rows
 	complexity := m.analyzeDataComplexity(req.SchemaAnalysis)
 
-	// Select model based on complexity and requirements
-	if complexity > 0.8 && rows > 10000 {
-		return "gpt-4-turbo" // Best for complex, large datasets
-	} else if complexity > 0.6 {
-		return "gpt-4" // Good for moderate complexity
-	} else {
-		return "gpt-3.5-turbo" // Efficient for simple tasks
-	}
-}
-
-// selectOptimalCustomModel selects the best custom model for the request
-func (m *MultiModelAgent) selectOptimalCustomModel(req *GenerationRequest) string {
-	// Analyze domain and requirements
-	domain := m.detectDomain(req.SchemaAnalysis)
-	complexity := m.analyzeDataComplexity(req.SchemaAnalysis)
-
-	// Select domain-specific model
-	switch domain {
-	case "healthcare":
-		if complexity > 0.7 {
-			return "palm2-medical"
-		}
-		return "palm2-text"
-	case "finance":
-		return "palm2-finance"
-	case "legal":
-		return "palm2-legal"
-	default:
-		return "palm2-text"
+	// Select model based on complexity and requirements; only models that
+	// support JSON mode are candidates, which rules out plain gpt-4
+	if complexity > 0.6 || rows > 10000 {
+		return string(OpenAIGPT4Turbo) // Best for complex or large datasets
 	}
+	return string(OpenAIGPT35Turbo) // Efficient for simple tasks
 }
 
 // buildAdvancedPrompt builds sophisticated prompts for different providers
@@ -498,8 +543,11 @@ Requirements:
 - Follow domain-specific constraints
 - Generate realistic, coherent data
 
-Schema: %v
-`, req.Config.Rows, req.SchemaAnalysis)
+%s
+
+Schema:
+%s
+`, req.Config.Rows, promptguard.DataNotice, promptguard.Raw("schema", m.schemaJSON(req.SchemaAnalysis)))
 
 	// Add provider-specific instructions
 	switch provider {
@@ -514,6 +562,15 @@ Schema: %v
 	return basePrompt
 }
 
+// schemaJSON renders a schema analysis for a prompt
+func (m *MultiModelAgent) schemaJSON(schema SchemaAnalysis) string {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return promptguard.Sanitize(fmt.Sprintf("%v", schema))
+	}
+	return string(data)
+}
+
 // buildDomainSpecificPrompt builds domain-specific prompts
 func (m *MultiModelAgent) buildDomainSpecificPrompt(req *GenerationRequest, model string) string {
 	domain := m.detectDomain(req.SchemaAnalysis)
@@ -0,0 +1,31 @@
+package agents
+
+// MultiTablePlan is a job generating several related tables together. Tables
+// are listed parents first; each has its own request, generated after the
+// tables it references, and foreign keys are assigned once its rows exist.
+type MultiTablePlan struct {
+	Tables        []MultiTableSpec `json:"tables"`
+	Relationships []ForeignKey     `json:"relationships"`
+	// FileFormat is the export format of each table's file in the bundle
+	FileFormat string `json:"file_format"`
+}
+
+// MultiTableSpec is one table of a plan: its name in the bundle, its primary
+// key column, the rows of a table without parents, and the request its rows
+// are generated with
+type MultiTableSpec struct {
+	Name       string             `json:"name"`
+	PrimaryKey string             `json:"primary_key,omitempty"`
+	Rows       int64              `json:"rows,omitempty"`
+	Request    *GenerationRequest `json:"request"`
+}
+
+// ForeignKey is a child table's column referencing its parent's primary key.
+// ChildrenPerParent maps a number of children to its share of parents; the
+// first foreign key of a child sets how many rows it has.
+type ForeignKey struct {
+	Parent            string          `json:"parent"`
+	Child             string          `json:"child"`
+	Column            string          `json:"column"`
+	ChildrenPerParent map[int]float64 `json:"children_per_parent"`
+}
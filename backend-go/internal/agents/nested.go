@@ -0,0 +1,48 @@
+package agents
+
+import "encoding/json"
+
+// NestedColumn is a column holding JSON objects or arrays. Generated values
+// must validate against Schema; Encoded columns hold them as JSON text, as
+// CSV sources do.
+type NestedColumn struct {
+	Column   string      `json:"column"`
+	Encoded  bool        `json:"encoded"`
+	Nullable bool        `json:"nullable,omitempty"`
+	Schema   *JSONSchema `json:"schema"`
+}
+
+// JSONSchema is the subset of JSON Schema inferred for nested columns:
+// types, object properties and array items
+type JSONSchema struct {
+	Dialect              string                 `json:"$schema,omitempty"`
+	Type                 SchemaTypes            `json:"type,omitempty"`
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	Required             []string               `json:"required,omitempty"`
+	AdditionalProperties *bool                  `json:"additionalProperties,omitempty"`
+	Items                *JSONSchema            `json:"items,omitempty"`
+}
+
+// SchemaTypes is the type keyword, written as a string when there is one
+type SchemaTypes []string
+
+func (t SchemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *SchemaTypes) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*t = SchemaTypes{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
@@ -0,0 +1,307 @@
+package agents
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+)
+
+// DefaultOpenAIBaseURL is the OpenAI API endpoint used when none is set
+const DefaultOpenAIBaseURL = "https://api.openai.com"
+
+// ErrOpenAINotConfigured is returned when OpenAI is selected without an API key
+var ErrOpenAINotConfigured = errors.New("OpenAI API key not configured")
+
+// OpenAIClient calls the OpenAI chat completions API. Rate-limited and
+// server-side failures are retried with exponential backoff, honouring the
+// delay the API asks for.
+type OpenAIClient struct {
+	APIKey      string
+	BaseURL     string
+	HTTPClient  *http.Client
+	MaxRetries  int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func NewOpenAIClient(apiKey string) *OpenAIClient {
+	return &OpenAIClient{
+		APIKey:      apiKey,
+		BaseURL:     DefaultOpenAIBaseURL,
+		HTTPClient:  &http.Client{Timeout: 5 * time.Minute},
+		MaxRetries:  4,
+		BaseBackoff: time.Second,
+		MaxBackoff:  30 * time.Second,
+	}
+}
+
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ResponseFormat selects JSON mode with {"type": "json_object"}
+type ResponseFormat struct {
+	Type string `json:"type"`
+}
+
+type ChatCompletionRequest struct {
+	Model          string          `json:"model"`
+	Messages       []ChatMessage   `json:"messages"`
+	Temperature    *float32        `json:"temperature,omitempty"`
+	MaxTokens      int32           `json:"max_tokens,omitempty"`
+	ResponseFormat *ResponseFormat `json:"response_format,omitempty"`
+	Stream         bool            `json:"stream,omitempty"`
+}
+
+type ChatUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ChatChoice struct {
+	Index        int         `json:"index"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
+}
+
+type ChatCompletionResponse struct {
+	ID      string       `json:"id"`
+	Model   string       `json:"model"`
+	Choices []ChatChoice `json:"choices"`
+	Usage   ChatUsage    `json:"usage"`
+}
+
+// Content returns the text of the first choice
+func (r *ChatCompletionResponse) Content() string {
+	if len(r.Choices) == 0 {
+		return ""
+	}
+	return r.Choices[0].Message.Content
+}
+
+// OpenAIError is an error response from the API
+type OpenAIError struct {
+	StatusCode int
+	Type       string
+	Code       string
+	Message    string
+	// RetryAfter is the delay the API asked for, if any
+	RetryAfter time.Duration
+}
+
+func (e *OpenAIError) Error() string {
+	return fmt.Sprintf("openai: %d %s: %s", e.StatusCode, e.Type, e.Message)
+}
+
+// Retryable reports whether the request may succeed if repeated: rate
+// limits, except an exhausted quota, and server errors
+func (e *OpenAIError) Retryable() bool {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return e.Code != "insufficient_quota"
+	}
+	return e.StatusCode >= 500
+}
+
+// ChatCompletion sends a chat completion request and returns the response
+func (c *OpenAIClient) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (*ChatCompletionResponse, error) {
+	req.Stream = false
+	var out ChatCompletionResponse
+	err := c.do(ctx, req, func(body io.Reader) error {
+		if err := json.NewDecoder(body).Decode(&out); err != nil {
+			return permanentError{fmt.Errorf("openai: malformed response: %w", err)}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Choices) == 0 {
+		return nil, errors.New("openai: response has no choices")
+	}
+	return &out, nil
+}
+
+// StreamChatCompletion streams a chat completion, handing each content
+// delta to onDelta, and returns the full content. Requests are only retried
+// until the stream starts.
+func (c *OpenAIClient) StreamChatCompletion(ctx context.Context, req ChatCompletionRequest, onDelta func(string) error) (string, error) {
+	req.Stream = true
+	var content strings.Builder
+	err := c.do(ctx, req, func(body io.Reader) error {
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if !strings.HasPrefix(line, "data:") {
+				continue
+			}
+			data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+			if data == "[DONE]" {
+				return nil
+			}
+			var chunk struct {
+				Choices []struct {
+					Delta struct {
+						Content string `json:"content"`
+					} `json:"delta"`
+				} `json:"choices"`
+			}
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return permanentError{fmt.Errorf("openai: malformed stream chunk: %w", err)}
+			}
+			for _, ch := range chunk.Choices {
+				if ch.Delta.Content == "" {
+					continue
+				}
+				content.WriteString(ch.Delta.Content)
+				if onDelta != nil {
+					if err := onDelta(ch.Delta.Content); err != nil {
+						return permanentError{err}
+					}
+				}
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return permanentError{err}
+		}
+		return permanentError{errors.New("openai: stream ended without [DONE]")}
+	})
+	return content.String(), err
+}
+
+// permanentError stops retries for failures repeating the request cannot
+// fix, such as a malformed body or a stream that was partly consumed
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+func (c *OpenAIClient) do(ctx context.Context, req ChatCompletionRequest, read func(io.Reader) error) error {
+	if c.APIKey == "" {
+		return ErrOpenAINotConfigured
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultOpenAIBaseURL
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, httpClient, strings.TrimSuffix(baseURL, "/")+"/v1/chat/completions", payload, read)
+		if err == nil {
+			return nil
+		}
+		var perr permanentError
+		if errors.As(err, &perr) {
+			return perr.err
+		}
+		var apiErr *OpenAIError
+		retryAfter := time.Duration(0)
+		if errors.As(err, &apiErr) {
+			if !apiErr.Retryable() {
+				return err
+			}
+			retryAfter = apiErr.RetryAfter
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= c.MaxRetries {
+			return fmt.Errorf("openai: giving up after %d attempts: %w", attempt+1, err)
+		}
+		select {
+		case <-time.After(OpenAIBackoff(c.BaseBackoff, c.MaxBackoff, attempt, retryAfter)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (c *OpenAIClient) attempt(ctx context.Context, httpClient *http.Client, url string, payload []byte, read func(io.Reader) error) error {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+c.APIKey)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return parseOpenAIError(resp)
+	}
+	return read(resp.Body)
+}
+
+func parseOpenAIError(resp *http.Response) error {
+	apiErr := &OpenAIError{StatusCode: resp.StatusCode, RetryAfter: retryAfter(resp.Header)}
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			Code    any    `json:"code"`
+		} `json:"error"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	// Provider messages can echo the prompt, and with it dataset rows
+	if json.Unmarshal(raw, &body) == nil && body.Error.Message != "" {
+		apiErr.Message, apiErr.Type = redact.String(body.Error.Message), body.Error.Type
+		if body.Error.Code != nil {
+			apiErr.Code = fmt.Sprint(body.Error.Code)
+		}
+	} else {
+		apiErr.Message = redact.String(strings.TrimSpace(string(raw)))
+	}
+	return apiErr
+}
+
+// retryAfter reads the delay from Retry-After, or from the reset headers of
+// the request and token rate limits (durations such as "1s" or "6m0s")
+func retryAfter(h http.Header) time.Duration {
+	if s := h.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	var longest time.Duration
+	for _, name := range []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset-Tokens"} {
+		if d, err := time.ParseDuration(h.Get(name)); err == nil && d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
+
+// OpenAIBackoff is the wait before retry attempt+1: the delay the API asked
+// for if any, otherwise base doubled per attempt; both capped at max
+func OpenAIBackoff(base, max time.Duration, attempt int, retryAfter time.Duration) time.Duration {
+	d := retryAfter
+	if d <= 0 {
+		d = base << attempt
+	}
+	if max > 0 && (d > max || d <= 0) {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,88 @@
+// Package agents_test provides unit tests for the OpenAI client
+package agents_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testClient(url string) *agents.OpenAIClient {
+	c := agents.NewOpenAIClient("sk-test")
+	c.BaseURL, c.BaseBackoff, c.MaxBackoff, c.MaxRetries = url, time.Millisecond, 5*time.Millisecond, 2
+	return c
+}
+
+func TestChatCompletionRetries(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+		if calls == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"slow down","type":"requests","code":"rate_limit_exceeded"}}`)
+			return
+		}
+		fmt.Fprint(w, `{"id":"c1","model":"gpt-3.5-turbo-0125","choices":[{"message":{"role":"assistant","content":"{\"rows\":[]}"}}],"usage":{"total_tokens":12}}`)
+	}))
+	defer srv.Close()
+
+	resp, err := testClient(srv.URL).ChatCompletion(context.Background(), agents.ChatCompletionRequest{Model: "gpt-3.5-turbo-0125"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, `{"rows":[]}`, resp.Content())
+	assert.Equal(t, 12, resp.Usage.TotalTokens)
+}
+
+func TestChatCompletionPermanentErrors(t *testing.T) {
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, `{"error":{"message":"quota","type":"insufficient_quota","code":"insufficient_quota"}}`)
+	}))
+	defer srv.Close()
+
+	_, err := testClient(srv.URL).ChatCompletion(context.Background(), agents.ChatCompletionRequest{})
+	var apiErr *agents.OpenAIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.False(t, apiErr.Retryable())
+	assert.Equal(t, 1, calls, "an exhausted quota is not retried")
+
+	_, err = agents.NewOpenAIClient("").ChatCompletion(context.Background(), agents.ChatCompletionRequest{})
+	assert.ErrorIs(t, err, agents.ErrOpenAINotConfigured)
+}
+
+func TestStreamChatCompletion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"{\\\"rows\\\":\"}}]}\n\n")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"[]}\"}}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	var deltas []string
+	content, err := testClient(srv.URL).StreamChatCompletion(context.Background(), agents.ChatCompletionRequest{}, func(d string) error {
+		deltas = append(deltas, d)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"rows":[]}`, content)
+	assert.Len(t, deltas, 2)
+}
+
+func TestOpenAIBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, agents.OpenAIBackoff(time.Second, time.Minute, 0, 0))
+	assert.Equal(t, 8*time.Second, agents.OpenAIBackoff(time.Second, time.Minute, 3, 0))
+	assert.Equal(t, time.Minute, agents.OpenAIBackoff(time.Second, time.Minute, 10, 0))
+	assert.Equal(t, 20*time.Second, agents.OpenAIBackoff(time.Second, time.Minute, 0, 20*time.Second), "the API's delay wins")
+}
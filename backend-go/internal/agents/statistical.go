@@ -0,0 +1,114 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/statgen"
+)
+
+// ErrNoReference is returned when statistical generation has no sample of
+// the source rows to fit
+var ErrNoReference = errors.New("statistical generation needs a sample of the source rows")
+
+// StatisticalModel names the model statistical generation records
+const StatisticalModel = "gaussian_copula"
+
+// StatisticalGenerator generates rows from per-column distributions and a
+// Gaussian copula fitted to the request's reference sample. No provider is
+// called, so it costs nothing beyond the CPU it runs on.
+type StatisticalGenerator struct {
+	// Seed fixes the rows drawn; 0 seeds from the clock
+	Seed int64
+}
+
+// GenerateSyntheticData generates every requested row at once
+func (g StatisticalGenerator) GenerateSyntheticData(ctx context.Context, req *GenerationRequest) (*GenerationResponse, error) {
+	var rows []map[string]interface{}
+	resp, err := g.StreamGeneration(ctx, req, req.Config.Rows, func(b StreamBatch) error {
+		rows = append(rows, b.Rows...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Rows = rows
+	return resp, nil
+}
+
+// StreamGeneration draws the requested rows in batches of batchRows,
+// scoring each against the reference sample
+func (g StatisticalGenerator) StreamGeneration(ctx context.Context, req *GenerationRequest, batchRows int64, onBatch func(StreamBatch) error) (*GenerationResponse, error) {
+	if err := req.enforceDataMode(); err != nil {
+		return nil, err
+	}
+	if len(req.Reference) == 0 {
+		return nil, ErrNoReference
+	}
+	model, err := statgen.Fit(req.Reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fit source sample: %w", err)
+	}
+	seed := g.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	sampler := statgen.NewSampler(model, seed)
+
+	total := req.Config.Rows
+	var done int64
+	var quality QualityMetrics
+	for i, n := range BatchSizes(total, batchRows) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		rows := sampler.Rows(int(n))
+		metrics := referenceQuality(req.Reference, rows, time.Since(start))
+		quality = BlendQuality(quality, done, metrics, n)
+		done += n
+		if err := onBatch(StreamBatch{
+			Batch:     i + 1,
+			Rows:      rows,
+			RowsDone:  done,
+			RowsTotal: total,
+			Progress:  float64(done) / float64(total),
+			Quality:   quality,
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the kind of each marginal is reported; the fitted values come
+	// from the source
+	kinds := make(map[string]string, len(model.Columns))
+	for _, col := range model.Columns {
+		kinds[col.Name] = col.Kind
+	}
+	quality.Details = map[string]interface{}{
+		"strategy":    StrategyStatistical,
+		"model":       StatisticalModel,
+		"source_rows": model.SourceRows,
+		"marginals":   kinds,
+	}
+	return &GenerationResponse{Status: "completed", Progress: 1, QualityMetrics: quality}, nil
+}
+
+// referenceQuality scores rows only by how closely they follow the
+// reference; there is no model response to judge for semantics or
+// constraints
+func referenceQuality(reference, rows []map[string]interface{}, took time.Duration) QualityMetrics {
+	m := QualityMetrics{ExecutionTime: took.Seconds()}
+	report := fidelity.Compare(reference, rows)
+	if report == nil {
+		return m
+	}
+	m.StatisticalSimilarity = report.StatisticalSimilarity
+	m.DistributionFidelity = report.DistributionFidelity
+	m.CorrelationPreservation = report.CorrelationPreservation
+	m.OverallQuality = (report.StatisticalSimilarity + report.DistributionFidelity + report.CorrelationPreservation + report.Indistinguishability) / 4
+	return m
+}
@@ -0,0 +1,93 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultStreamBatchRows is the batch size used when none is given
+const DefaultStreamBatchRows = 100
+
+// StreamBatch is one batch of rows produced while streaming a generation.
+// Quality covers the rows generated so far.
+type StreamBatch struct {
+	Batch     int                      `json:"batch"`
+	Rows      []map[string]interface{} `json:"rows"`
+	RowsDone  int64                    `json:"rows_done"`
+	RowsTotal int64                    `json:"rows_total"`
+	Progress  float64                  `json:"progress"`
+	Quality   QualityMetrics           `json:"quality"`
+}
+
+// BatchSizes splits total rows into batches of at most size rows
+func BatchSizes(total, size int64) []int64 {
+	if size <= 0 {
+		size = DefaultStreamBatchRows
+	}
+	var out []int64
+	for total > 0 {
+		n := size
+		if total < n {
+			n = total
+		}
+		out = append(out, n)
+		total -= n
+	}
+	return out
+}
+
+// ParseRows extracts generated rows from a model response. The response is
+// either a JSON array of objects or an object holding one under "data" or
+// "rows", optionally wrapped in a Markdown code fence.
+func ParseRows(response string) ([]map[string]interface{}, error) {
+	s := strings.TrimSpace(response)
+	if strings.HasPrefix(s, "```") {
+		s = strings.TrimPrefix(s, "```")
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			s = s[i+1:]
+		}
+		s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "```"))
+	}
+
+	var rows []map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &rows); err == nil {
+		return rows, nil
+	}
+	var wrapped struct {
+		Data []map[string]interface{} `json:"data"`
+		Rows []map[string]interface{} `json:"rows"`
+	}
+	if err := json.Unmarshal([]byte(s), &wrapped); err != nil {
+		return nil, fmt.Errorf("response is not a JSON array of rows: %w", err)
+	}
+	if wrapped.Data != nil {
+		return wrapped.Data, nil
+	}
+	if wrapped.Rows != nil {
+		return wrapped.Rows, nil
+	}
+	return nil, fmt.Errorf("response holds no rows")
+}
+
+// BlendQuality combines the metrics of rows already generated with those of
+// a new batch, weighting each by its row count
+func BlendQuality(acc QualityMetrics, accRows int64, batch QualityMetrics, batchRows int64) QualityMetrics {
+	total := accRows + batchRows
+	if total <= 0 {
+		return batch
+	}
+	a, b := float64(accRows)/float64(total), float64(batchRows)/float64(total)
+	mix := func(x, y float64) float64 { return x*a + y*b }
+	return QualityMetrics{
+		OverallQuality:          mix(acc.OverallQuality, batch.OverallQuality),
+		StatisticalSimilarity:   mix(acc.StatisticalSimilarity, batch.StatisticalSimilarity),
+		DistributionFidelity:    mix(acc.DistributionFidelity, batch.DistributionFidelity),
+		CorrelationPreservation: mix(acc.CorrelationPreservation, batch.CorrelationPreservation),
+		PrivacyProtection:       mix(acc.PrivacyProtection, batch.PrivacyProtection),
+		SemanticCoherence:       mix(acc.SemanticCoherence, batch.SemanticCoherence),
+		ConstraintCompliance:    mix(acc.ConstraintCompliance, batch.ConstraintCompliance),
+		ExecutionTime:           acc.ExecutionTime + batch.ExecutionTime,
+		MemoryUsage:             max(acc.MemoryUsage, batch.MemoryUsage),
+	}
+}
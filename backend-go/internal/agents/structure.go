@@ -0,0 +1,17 @@
+package agents
+
+// RowStructure is how generated rows depend on one another: the share of
+// rows that repeat an earlier one, and rows grouped under a shared key, as
+// members of a household or orders of a customer. Rates and shares are
+// fractions; GroupSizes maps a group size to its share of groups.
+type RowStructure struct {
+	DuplicateRate       float64 `json:"duplicate_rate"`
+	SourceDuplicateRate float64 `json:"source_duplicate_rate"`
+	// DuplicateIgnore are columns left out when rows are compared, such as
+	// record identifiers; duplicates keep their own values for them
+	DuplicateIgnore []string        `json:"duplicate_ignore,omitempty"`
+	GroupBy         string          `json:"group_by,omitempty"`
+	GroupSizes      map[int]float64 `json:"group_sizes,omitempty"`
+	MeanGroupSize   float64         `json:"mean_group_size,omitempty"`
+	MaxGroupSize    int             `json:"max_group_size,omitempty"`
+}
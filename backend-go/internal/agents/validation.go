@@ -0,0 +1,244 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/promptguard"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+)
+
+const (
+	// DefaultRepairAttempts is how many times a model is re-prompted to fix
+	// an invalid response when the request does not say
+	DefaultRepairAttempts = 2
+	// MaxRepairAttempts caps the repairs of one response
+	MaxRepairAttempts = 5
+	// maxReportedIssues bounds the issues quoted back to the model
+	maxReportedIssues = 20
+	// maxQuotedResponse bounds the invalid response quoted back to the model
+	maxQuotedResponse = 8000
+)
+
+// ErrInvalidResponse is returned when a model response still fails
+// validation after every repair attempt
+var ErrInvalidResponse = errors.New("model response failed validation")
+
+// ValidationIssue is one way a response breaks the dataset schema. Row is
+// the zero-based row index, or -1 for issues with the response as a whole.
+type ValidationIssue struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+	// Value is the cell the message quotes, masked when the issue leaves
+	// the repair loop as an error
+	Value string `json:"-"`
+}
+
+func (i ValidationIssue) String() string {
+	switch {
+	case i.Row < 0:
+		return i.Message
+	case i.Column == "":
+		return fmt.Sprintf("row %d: %s", i.Row+1, i.Message)
+	default:
+		return fmt.Sprintf("row %d, column %q: %s", i.Row+1, i.Column, i.Message)
+	}
+}
+
+// ResponseValidator checks generated rows against the dataset schema: the
+// row count, column names, nullability and column types. Columns of types
+// it does not know are only checked for presence.
+type ResponseValidator struct {
+	Columns []ColumnInfo
+	Rows    int64
+}
+
+// NewResponseValidator validates responses to a request for rows rows
+func NewResponseValidator(schema SchemaAnalysis, rows int64) *ResponseValidator {
+	return &ResponseValidator{Columns: schema.Columns, Rows: rows}
+}
+
+// Validate parses a response and returns its rows with every issue found.
+// Rows are nil when the response does not parse.
+func (v *ResponseValidator) Validate(response string) ([]map[string]interface{}, []ValidationIssue) {
+	rows, err := ParseRows(response)
+	if err != nil {
+		return nil, []ValidationIssue{{Row: -1, Message: err.Error()}}
+	}
+	return rows, v.Check(rows)
+}
+
+// Check returns every issue found in rows that are already parsed
+func (v *ResponseValidator) Check(rows []map[string]interface{}) []ValidationIssue {
+	var issues []ValidationIssue
+	if v.Rows > 0 && int64(len(rows)) != v.Rows {
+		issues = append(issues, ValidationIssue{Row: -1, Message: fmt.Sprintf("expected %d rows, got %d", v.Rows, len(rows))})
+	}
+	if len(v.Columns) == 0 {
+		return issues
+	}
+
+	known := make(map[string]bool, len(v.Columns))
+	for _, col := range v.Columns {
+		known[col.Name] = true
+	}
+	for i, row := range rows {
+		var unknown []string
+		for name := range row {
+			if !known[name] {
+				unknown = append(unknown, name)
+			}
+		}
+		sort.Strings(unknown)
+		for _, name := range unknown {
+			issues = append(issues, ValidationIssue{Row: i, Column: name, Message: "column is not in the schema"})
+		}
+		for _, col := range v.Columns {
+			value, ok := row[col.Name]
+			switch {
+			case !ok && !col.IsNullable:
+				issues = append(issues, ValidationIssue{Row: i, Column: col.Name, Message: "missing"})
+			case ok && value == nil && !col.IsNullable:
+				issues = append(issues, ValidationIssue{Row: i, Column: col.Name, Message: "null in a non-nullable column"})
+			case value != nil:
+				if msg := checkType(col.DataType, value); msg != "" {
+					issues = append(issues, ValidationIssue{Row: i, Column: col.Name, Message: msg, Value: fmt.Sprint(value)})
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// dateLayouts are the layouts date and datetime values may take
+var dateLayouts = []string{time.RFC3339Nano, time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", time.DateOnly}
+
+// checkType describes how a value breaks a column type, or returns ""
+func checkType(dataType string, value interface{}) string {
+	switch strings.ToLower(dataType) {
+	case "integer", "int", "bigint":
+		if f, ok := value.(float64); !ok || f != math.Trunc(f) {
+			return fmt.Sprintf("expected an integer, got %s", describe(value))
+		}
+	case "float", "numeric", "number", "decimal", "double":
+		if _, ok := value.(float64); !ok {
+			return fmt.Sprintf("expected a number, got %s", describe(value))
+		}
+	case "boolean", "bool":
+		if _, ok := value.(bool); !ok {
+			return fmt.Sprintf("expected a boolean, got %s", describe(value))
+		}
+	case "string", "text", "email", "phone", "categorical":
+		if _, ok := value.(string); !ok {
+			return fmt.Sprintf("expected a string, got %s", describe(value))
+		}
+	case "date", "datetime", "timestamp":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Sprintf("expected a %s string, got %s", strings.ToLower(dataType), describe(value))
+		}
+		for _, layout := range dateLayouts {
+			if _, err := time.Parse(layout, s); err == nil {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not an ISO 8601 %s", s, strings.ToLower(dataType))
+	}
+	return ""
+}
+
+// describe names the JSON type of a value
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case float64:
+		return fmt.Sprintf("number %v", v)
+	case bool:
+		return fmt.Sprintf("boolean %t", v)
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// RepairInstructions tells the model what was wrong with its last response
+func RepairInstructions(issues []ValidationIssue, rows int64) string {
+	var b strings.Builder
+	b.WriteString("Your previous response failed validation:\n")
+	for i, issue := range issues {
+		if i == maxReportedIssues {
+			fmt.Fprintf(&b, "- ... and %d more\n", len(issues)-maxReportedIssues)
+			break
+		}
+		// Issues quote column names and cells from the response
+		fmt.Fprintf(&b, "- %s\n", promptguard.Sanitize(issue.String()))
+	}
+	fmt.Fprintf(&b, "\nReturn the corrected data in the format asked for: exactly %d rows, using only the schema's columns and types, with no other text.", rows)
+	return b.String()
+}
+
+// RepairPrompt re-prompts a model with its invalid response and the issues
+// found in it, for models called with a single prompt
+func RepairPrompt(prompt, response string, issues []ValidationIssue, rows int64) string {
+	if len(response) > maxQuotedResponse {
+		response = response[:maxQuotedResponse] + "\n[truncated]"
+	}
+	return fmt.Sprintf("%s\n\nYour previous response was:\n%s\n\n%s", prompt, promptguard.Raw("previous_response", response), RepairInstructions(issues, rows))
+}
+
+// RepairAttempts is how many repairs a request allows
+func RepairAttempts(req *GenerationRequest) int {
+	switch n := req.Config.MaxRetries; {
+	case n <= 0:
+		return DefaultRepairAttempts
+	case n > MaxRepairAttempts:
+		return MaxRepairAttempts
+	default:
+		return n
+	}
+}
+
+// RepairLoop calls the model until its response validates, passing the
+// previous response and its issues on every call but the first. It gives
+// up with ErrInvalidResponse after attempts repairs and returns the valid
+// rows, the response they came from and the number of repairs made.
+func RepairLoop(ctx context.Context, v *ResponseValidator, attempts int, call func(ctx context.Context, previous string, issues []ValidationIssue) (string, error)) ([]map[string]interface{}, string, int, error) {
+	var response string
+	var issues []ValidationIssue
+	for repair := 0; ; repair++ {
+		if err := ctx.Err(); err != nil {
+			return nil, "", repair, err
+		}
+		var err error
+		if response, err = call(ctx, response, issues); err != nil {
+			return nil, "", repair, err
+		}
+		var rows []map[string]interface{}
+		if rows, issues = v.Validate(response); len(issues) == 0 {
+			return rows, response, repair, nil
+		}
+		if repair >= attempts {
+			return nil, "", repair, fmt.Errorf("%w after %d repairs: %s", ErrInvalidResponse, repair, summarize(issues))
+		}
+	}
+}
+
+// summarize describes the first issue and counts the rest, with the cell
+// it quotes masked since the summary ends up in job errors and logs
+func summarize(issues []ValidationIssue) string {
+	first := redact.Values(issues[0].String(), issues[0].Value)
+	if len(issues) > 1 {
+		first = fmt.Sprintf("%s (and %d more)", first, len(issues)-1)
+	}
+	return first
+}
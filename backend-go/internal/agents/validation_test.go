@@ -0,0 +1,95 @@
+// Package agents_test provides unit tests for response validation
+package agents_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var validationSchema = agents.SchemaAnalysis{Columns: []agents.ColumnInfo{
+	{Name: "id", DataType: "integer"},
+	{Name: "score", DataType: "float", IsNullable: true},
+	{Name: "joined", DataType: "date"},
+	{Name: "active", DataType: "boolean"},
+}}
+
+func TestResponseValidator(t *testing.T) {
+	v := agents.NewResponseValidator(validationSchema, 2)
+
+	rows, issues := v.Validate("```json\n[{\"id\":1,\"score\":null,\"joined\":\"2024-03-01\",\"active\":true},{\"id\":2,\"score\":0.5,\"joined\":\"2024-03-02T10:00:00Z\",\"active\":false}]\n```")
+	assert.Empty(t, issues)
+	assert.Len(t, rows, 2)
+
+	_, issues = v.Validate(`[{"id":1.5,"joined":"yesterday","active":"yes","extra":1}]`)
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	assert.Equal(t, []string{
+		"expected 2 rows, got 1",
+		`row 1, column "extra": column is not in the schema`,
+		`row 1, column "id": expected an integer, got number 1.5`,
+		`row 1, column "joined": "yesterday" is not an ISO 8601 date`,
+		`row 1, column "active": expected a boolean, got string "yes"`,
+	}, got)
+
+	rows, issues = v.Validate("not json")
+	assert.Nil(t, rows)
+	require.Len(t, issues, 1)
+	assert.Equal(t, -1, issues[0].Row)
+}
+
+func TestRepairLoop(t *testing.T) {
+	v := agents.NewResponseValidator(validationSchema, 1)
+	responses := []string{
+		`[{"id":"one","joined":"2024-03-01","active":true}]`,
+		`{"rows":[{"id":1,"joined":"2024-03-01","active":true}]}`,
+	}
+	var seen [][]agents.ValidationIssue
+	rows, response, repairs, err := agents.RepairLoop(context.Background(), v, 2, func(ctx context.Context, previous string, issues []agents.ValidationIssue) (string, error) {
+		seen = append(seen, issues)
+		return responses[len(seen)-1], nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, repairs)
+	assert.Equal(t, responses[1], response)
+	assert.Equal(t, float64(1), rows[0]["id"])
+	assert.Empty(t, seen[0], "the first call has nothing to repair")
+	require.Len(t, seen[1], 1)
+	assert.Equal(t, "id", seen[1][0].Column)
+
+	calls := 0
+	_, _, repairs, err = agents.RepairLoop(context.Background(), v, 2, func(ctx context.Context, previous string, issues []agents.ValidationIssue) (string, error) {
+		calls++
+		return "[]", nil
+	})
+	assert.ErrorIs(t, err, agents.ErrInvalidResponse)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, repairs)
+}
+
+func TestRepairLoopMasksValues(t *testing.T) {
+	v := agents.NewResponseValidator(validationSchema, 1)
+	_, _, _, err := agents.RepairLoop(context.Background(), v, 0, func(ctx context.Context, previous string, issues []agents.ValidationIssue) (string, error) {
+		return `[{"id":"Jane Roe","joined":"2024-03-01","active":true}]`, nil
+	})
+	require.ErrorIs(t, err, agents.ErrInvalidResponse)
+	assert.NotContains(t, err.Error(), "Jane Roe", "cells are kept out of the error")
+	assert.Contains(t, err.Error(), redact.Hash("value", "Jane Roe"))
+}
+
+func TestRepairPrompt(t *testing.T) {
+	prompt := agents.RepairPrompt("Generate 1 row.", "[]", []agents.ValidationIssue{{Row: -1, Message: "expected 1 rows, got 0"}}, 1)
+	assert.Contains(t, prompt, "Generate 1 row.")
+	assert.Contains(t, prompt, "Your previous response was:\n<data name=\"previous_response\">\n[]\n</data>")
+	assert.Contains(t, prompt, "- expected 1 rows, got 0")
+	assert.Contains(t, prompt, "exactly 1 rows")
+
+	assert.Equal(t, agents.DefaultRepairAttempts, agents.RepairAttempts(&agents.GenerationRequest{}))
+	assert.Equal(t, agents.MaxRepairAttempts, agents.RepairAttempts(&agents.GenerationRequest{Config: agents.GenerationConfig{MaxRetries: 50}}))
+}
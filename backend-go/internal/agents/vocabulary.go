@@ -0,0 +1,12 @@
+package agents
+
+// VocabularyColumn binds a column to the approved values of a controlled
+// vocabulary. Values are drawn in proportion to Weights; values of weight
+// zero are approved but never drawn.
+type VocabularyColumn struct {
+	Column     string    `json:"column"`
+	Vocabulary string    `json:"vocabulary"`
+	Weighting  string    `json:"weighting"`
+	Values     []string  `json:"values"`
+	Weights    []float64 `json:"weights"`
+}
@@ -2,23 +2,47 @@ package analytics
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/google/uuid"
 )
 
 // AnalyticsEvent represents an analytics event
-type AnalyticsEvent struct {
-	ID         string                 `json:"id"`
-	UserID     string                 `json:"user_id"`
-	Event      string                 `json:"event"`
-	Category   string                 `json:"category"`
-	Properties map[string]interface{} `json:"properties"`
-	Timestamp  time.Time              `json:"timestamp"`
-	SessionID  string                 `json:"session_id,omitempty"`
-	IPAddress  string                 `json:"ip_address,omitempty"`
-	UserAgent  string                 `json:"user_agent,omitempty"`
-}
+type AnalyticsEvent = models.AnalyticsEvent
+
+// EventStore persists analytics events
+type EventStore interface {
+	InsertEvents(ctx context.Context, events []models.AnalyticsEvent) error
+	QueryEvents(ctx context.Context, f models.AnalyticsEventFilter) ([]models.AnalyticsEvent, error)
+	Downsample(ctx context.Context, f models.AnalyticsEventFilter, interval string) ([]models.AnalyticsBucket, error)
+	Stats(ctx context.Context) (*models.AnalyticsStats, error)
+	ListPendingAnonymization(ctx context.Context, before, afterTime time.Time, afterID string, limit int) ([]models.AnalyticsEvent, error)
+	MarkAnonymized(ctx context.Context, id, ipAddress, userAgent string) error
+}
+
+const (
+	// FlushBatchSize is how many buffered events trigger a write to the store
+	FlushBatchSize = 200
+	// FlushInterval is the longest an event waits in the buffer
+	FlushInterval = 5 * time.Second
+	// MaxBufferedEvents caps the events held in memory, whether waiting for
+	// the store or kept in place of one; the oldest are dropped first
+	MaxBufferedEvents = 10000
+	// MaxReportEvents caps the events a report is computed from
+	MaxReportEvents = 100000
+)
+
+// SeriesIntervals are the bucket sizes events can be downsampled to
+var SeriesIntervals = []string{"minute", "hour", "day", "week", "month"}
+
+// ErrInvalidInterval is returned for a bucket size not in SeriesIntervals
+var ErrInvalidInterval = errors.New("invalid series interval")
 
 // AnalyticsMetric represents an analytics metric
 type AnalyticsMetric struct {
@@ -40,6 +64,7 @@ type AnalyticsReport struct {
 	Metrics     map[string]float64     `json:"metrics"`
 	Insights    []string               `json:"insights"`
 	Charts      []Chart                `json:"charts"`
+	Groups      []ReportGroup          `json:"groups,omitempty"`
 	GeneratedAt time.Time              `json:"generated_at"`
 	Filters     map[string]interface{} `json:"filters"`
 }
@@ -61,14 +86,21 @@ type ChartDataPoint struct {
 	Label string      `json:"label,omitempty"`
 }
 
-// AnalyticsService handles analytics and reporting
+// AnalyticsService handles analytics and reporting. With a store, tracked
+// events are buffered and written in batches, and queries read the store;
+// without one the most recent events are kept in memory.
 type AnalyticsService struct {
-	events   []AnalyticsEvent
-	metrics  map[string]*AnalyticsMetric
-	reports  map[string]*AnalyticsReport
-	mu       sync.RWMutex
-	insights []string
-	trends   map[string][]float64
+	events     []AnalyticsEvent
+	store      EventStore
+	pending    []AnalyticsEvent
+	flushMu    sync.Mutex
+	flushNow   chan struct{}
+	metrics    map[string]*AnalyticsMetric
+	reports    map[string]*AnalyticsReport
+	mu         sync.RWMutex
+	insights   []string
+	trends     map[string][]float64
+	anonymizer *privacy.Anonymizer
 }
 
 // NewAnalyticsService creates a new analytics service
@@ -79,6 +111,7 @@ func NewAnalyticsService() *AnalyticsService {
 		reports:  make(map[string]*AnalyticsReport),
 		insights: make([]string, 0),
 		trends:   make(map[string][]float64),
+		flushNow: make(chan struct{}, 1),
 	}
 
 	// Start background processing
@@ -97,8 +130,28 @@ func (as *AnalyticsService) TrackEvent(ctx context.Context, event AnalyticsEvent
 		event.Timestamp = time.Now()
 	}
 
+	// Anonymize client identifiers at write time when the org policy requires it
+	as.mu.RLock()
+	anonymizer := as.anonymizer
+	as.mu.RUnlock()
+	if anonymizer != nil {
+		if policy := anonymizer.PolicyFor(ctx, event.OrgID); privacy.Immediate(policy) {
+			event.IPAddress, event.UserAgent = anonymizer.Apply(policy, event.IPAddress, event.UserAgent)
+		}
+	}
+
 	as.mu.Lock()
-	as.events = append(as.events, event)
+	if as.store != nil {
+		as.pending = appendBounded(as.pending, event)
+		if len(as.pending) >= FlushBatchSize {
+			select {
+			case as.flushNow <- struct{}{}:
+			default:
+			}
+		}
+	} else {
+		as.events = appendBounded(as.events, event)
+	}
 	as.mu.Unlock()
 
 	// Update metrics
@@ -107,6 +160,137 @@ func (as *AnalyticsService) TrackEvent(ctx context.Context, event AnalyticsEvent
 	return nil
 }
 
+func appendBounded(events []AnalyticsEvent, event AnalyticsEvent) []AnalyticsEvent {
+	if len(events) >= MaxBufferedEvents {
+		events = append(events[:0], events[len(events)-MaxBufferedEvents+1:]...)
+	}
+	return append(events, event)
+}
+
+// SetStore persists events to a store from now on
+func (as *AnalyticsService) SetStore(store EventStore) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.store = store
+}
+
+// Flush writes buffered events to the store. Events that fail to write stay
+// buffered for the next flush.
+func (as *AnalyticsService) Flush(ctx context.Context) error {
+	as.flushMu.Lock()
+	defer as.flushMu.Unlock()
+
+	as.mu.Lock()
+	store, batch := as.store, as.pending
+	as.pending = nil
+	as.mu.Unlock()
+	if store == nil || len(batch) == 0 {
+		return nil
+	}
+	if err := store.InsertEvents(ctx, batch); err != nil {
+		as.mu.Lock()
+		for _, event := range as.pending {
+			batch = appendBounded(batch, event)
+		}
+		as.pending = batch
+		as.mu.Unlock()
+		return fmt.Errorf("failed to store analytics events: %w", err)
+	}
+	return nil
+}
+
+// storeForRead flushes buffered events so reads see them, and returns the
+// store, or nil when events are kept in memory
+func (as *AnalyticsService) storeForRead(ctx context.Context) (EventStore, error) {
+	as.mu.RLock()
+	store := as.store
+	as.mu.RUnlock()
+	if store == nil {
+		return nil, nil
+	}
+	return store, as.Flush(ctx)
+}
+
+// SetAnonymizer enables IP address and user agent anonymization for analytics events
+func (as *AnalyticsService) SetAnonymizer(anonymizer *privacy.Anonymizer) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.anonymizer = anonymizer
+}
+
+// AnonymizeExpired anonymizes client identifiers of events whose anonymization
+// period has elapsed and returns the number of events updated
+func (as *AnalyticsService) AnonymizeExpired(ctx context.Context, now time.Time) (int, error) {
+	store, err := as.storeForRead(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if store != nil {
+		as.mu.RLock()
+		anonymizer := as.anonymizer
+		as.mu.RUnlock()
+		if anonymizer == nil {
+			return 0, nil
+		}
+		return anonymizeStored(ctx, anonymizer, store, now)
+	}
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	if as.anonymizer == nil {
+		return 0, nil
+	}
+
+	updated := 0
+	for i := range as.events {
+		event := &as.events[i]
+		policy := as.anonymizer.PolicyFor(ctx, event.OrgID)
+		if !privacy.Due(policy, event.Timestamp, now) {
+			continue
+		}
+		ip, ua := as.anonymizer.Apply(policy, event.IPAddress, event.UserAgent)
+		if ip != event.IPAddress || ua != event.UserAgent {
+			event.IPAddress, event.UserAgent = ip, ua
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// anonymizeStored pages through stored events not yet anonymized and applies
+// their organization's policy to those that are due
+func anonymizeStored(ctx context.Context, anonymizer *privacy.Anonymizer, store EventStore, now time.Time) (int, error) {
+	const batchSize = 500
+	var afterTime time.Time
+	var afterID string
+	updated := 0
+	for {
+		pending, err := store.ListPendingAnonymization(ctx, now, afterTime, afterID, batchSize)
+		if err != nil {
+			return updated, fmt.Errorf("failed to list analytics events for anonymization: %w", err)
+		}
+		for _, event := range pending {
+			afterTime, afterID = event.Timestamp, event.ID
+			policy := anonymizer.PolicyFor(ctx, event.OrgID)
+			if !privacy.Due(policy, event.Timestamp, now) {
+				continue
+			}
+			ip, ua := anonymizer.Apply(policy, event.IPAddress, event.UserAgent)
+			if ip == event.IPAddress && ua == event.UserAgent {
+				continue
+			}
+			if err := store.MarkAnonymized(ctx, event.ID, ip, ua); err != nil {
+				return updated, fmt.Errorf("failed to anonymize analytics event %s: %w", event.ID, err)
+			}
+			updated++
+		}
+		if len(pending) < batchSize {
+			return updated, nil
+		}
+	}
+}
+
 // TrackUserAction tracks a user action
 func (as *AnalyticsService) TrackUserAction(ctx context.Context, userID, action, category string, properties map[string]interface{}) error {
 	event := AnalyticsEvent{
@@ -259,8 +443,16 @@ func (as *AnalyticsService) GetMetric(name string, labels map[string]string) (*A
 	return metric, exists
 }
 
-// GetEvents returns events with filtering
-func (as *AnalyticsService) GetEvents(filters EventFilters) []AnalyticsEvent {
+// GetEvents returns events with filtering, oldest first
+func (as *AnalyticsService) GetEvents(ctx context.Context, filters EventFilters) ([]AnalyticsEvent, error) {
+	store, err := as.storeForRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		return store.QueryEvents(ctx, filters.query())
+	}
+
 	as.mu.RLock()
 	defer as.mu.RUnlock()
 
@@ -270,8 +462,87 @@ func (as *AnalyticsService) GetEvents(filters EventFilters) []AnalyticsEvent {
 			filteredEvents = append(filteredEvents, event)
 		}
 	}
+	if filters.Offset > 0 {
+		filteredEvents = filteredEvents[min(filters.Offset, len(filteredEvents)):]
+	}
+	if filters.Limit > 0 && len(filteredEvents) > filters.Limit {
+		filteredEvents = filteredEvents[:filters.Limit]
+	}
+	return filteredEvents, nil
+}
+
+// GetEventSeries downsamples matching events into buckets of an interval
+// from SeriesIntervals, counting events and distinct users per event name
+func (as *AnalyticsService) GetEventSeries(ctx context.Context, filters EventFilters, interval string) ([]models.AnalyticsBucket, error) {
+	valid := false
+	for _, i := range SeriesIntervals {
+		valid = valid || i == interval
+	}
+	if !valid {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidInterval, interval)
+	}
+	store, err := as.storeForRead(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if store != nil {
+		filters.Limit, filters.Offset = 0, 0
+		return store.Downsample(ctx, filters.query(), interval)
+	}
+
+	type key struct {
+		bucket time.Time
+		event  string
+	}
+	buckets := make(map[key]*models.AnalyticsBucket)
+	users := make(map[key]map[string]bool)
+	as.mu.RLock()
+	for _, event := range as.events {
+		if !as.matchesEventFilters(event, filters) {
+			continue
+		}
+		k := key{truncate(event.Timestamp, interval), event.Event}
+		b, ok := buckets[k]
+		if !ok {
+			b = &models.AnalyticsBucket{Bucket: k.bucket, Event: k.event}
+			buckets[k] = b
+			users[k] = make(map[string]bool)
+		}
+		b.Events++
+		users[k][event.UserID] = true
+	}
+	as.mu.RUnlock()
 
-	return filteredEvents
+	out := make([]models.AnalyticsBucket, 0, len(buckets))
+	for k, b := range buckets {
+		b.Users = int64(len(users[k]))
+		out = append(out, *b)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].Bucket.Equal(out[j].Bucket) {
+			return out[i].Bucket.Before(out[j].Bucket)
+		}
+		return out[i].Event < out[j].Event
+	})
+	return out, nil
+}
+
+// truncate floors a time to the start of its interval, in UTC as
+// date_trunc does for the store
+func truncate(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	switch interval {
+	case "minute":
+		return t.Truncate(time.Minute)
+	case "hour":
+		return t.Truncate(time.Hour)
+	case "week":
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
 }
 
 // EventFilters represents filters for events
@@ -285,6 +556,24 @@ type EventFilters struct {
 	Offset    int        `json:"offset,omitempty"`
 }
 
+func (f EventFilters) query() models.AnalyticsEventFilter {
+	return models.AnalyticsEventFilter{
+		UserID:    f.UserID,
+		Event:     f.Event,
+		Category:  f.Category,
+		StartTime: f.StartTime,
+		EndTime:   f.EndTime,
+		Limit:     f.Limit,
+		Offset:    f.Offset,
+	}
+}
+
+// reportEvents returns the events of a report period, from the store when
+// there is one
+func (as *AnalyticsService) reportEvents(ctx context.Context, start, end time.Time) ([]AnalyticsEvent, error) {
+	return as.GetEvents(ctx, EventFilters{StartTime: &start, EndTime: &end, Limit: MaxReportEvents})
+}
+
 // matchesEventFilters checks if an event matches the given filters
 func (as *AnalyticsService) matchesEventFilters(event AnalyticsEvent, filters EventFilters) bool {
 	if filters.UserID != "" && event.UserID != filters.UserID {
@@ -306,52 +595,19 @@ func (as *AnalyticsService) matchesEventFilters(event AnalyticsEvent, filters Ev
 	return true
 }
 
-// GenerateReport generates an analytics report
+// GenerateReport generates one of the built-in report types. Custom reports
+// are built from a ReportDefinition with BuildReport.
 func (as *AnalyticsService) GenerateReport(ctx context.Context, reportType, period string, filters map[string]interface{}) (*AnalyticsReport, error) {
-	startDate, endDate := as.getPeriodDates(period)
-
-	report := &AnalyticsReport{
-		ID:          generateReportID(),
-		Name:        fmt.Sprintf("%s Report - %s", reportType, period),
-		Type:        reportType,
-		Period:      period,
-		StartDate:   startDate,
-		EndDate:     endDate,
-		Metrics:     make(map[string]float64),
-		Insights:    make([]string, 0),
-		Charts:      make([]Chart, 0),
-		GeneratedAt: time.Now(),
-		Filters:     filters,
-	}
-
-	// Generate metrics based on report type
-	switch reportType {
-	case "overview":
-		as.generateOverviewReport(report)
-	case "user_activity":
-		as.generateUserActivityReport(report)
-	case "data_generation":
-		as.generateDataGenerationReport(report)
-	case "revenue":
-		as.generateRevenueReport(report)
-	case "performance":
-		as.generatePerformanceReport(report)
-	default:
+	def, ok := builtinReports[reportType]
+	if !ok {
 		return nil, fmt.Errorf("unsupported report type: %s", reportType)
 	}
-
-	// Generate insights
-	as.generateInsights(report)
-
-	// Generate charts
-	as.generateCharts(report)
-
-	// Store report
-	as.mu.Lock()
-	as.reports[report.ID] = report
-	as.mu.Unlock()
-
-	return report, nil
+	def.Period = period
+	def.Filters = make(map[string]string, len(filters))
+	for k, v := range filters {
+		def.Filters[k] = fmt.Sprint(v)
+	}
+	return as.BuildReport(ctx, reportType, def)
 }
 
 // getPeriodDates returns start and end dates for a period
@@ -386,117 +642,13 @@ func (as *AnalyticsService) getPeriodDates(period string) (time.Time, time.Time)
 	case "this_year":
 		start := time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
 		return start, now
+	case "last_7_days":
+		return now.AddDate(0, 0, -7), now
 	default:
 		return now.AddDate(0, 0, -30), now // Default to last 30 days
 	}
 }
 
-// generateOverviewReport generates an overview report
-func (as *AnalyticsService) generateOverviewReport(report *AnalyticsReport) {
-	// Get total events
-	totalEvents := 0
-	uniqueUsers := make(map[string]bool)
-
-	for _, event := range as.events {
-		if event.Timestamp.After(report.StartDate) && event.Timestamp.Before(report.EndDate) {
-			totalEvents++
-			uniqueUsers[event.UserID] = true
-		}
-	}
-
-	report.Metrics["total_events"] = float64(totalEvents)
-	report.Metrics["unique_users"] = float64(len(uniqueUsers))
-	report.Metrics["events_per_user"] = float64(totalEvents) / float64(len(uniqueUsers))
-}
-
-// generateUserActivityReport generates a user activity report
-func (as *AnalyticsService) generateUserActivityReport(report *AnalyticsReport) {
-	userActivity := make(map[string]int)
-
-	for _, event := range as.events {
-		if event.Timestamp.After(report.StartDate) && event.Timestamp.Before(report.EndDate) {
-			userActivity[event.UserID]++
-		}
-	}
-
-	report.Metrics["active_users"] = float64(len(userActivity))
-
-	// Calculate average activity per user
-	totalActivity := 0
-	for _, activity := range userActivity {
-		totalActivity += activity
-	}
-
-	if len(userActivity) > 0 {
-		report.Metrics["avg_activity_per_user"] = float64(totalActivity) / float64(len(userActivity))
-	}
-}
-
-// generateDataGenerationReport generates a data generation report
-func (as *AnalyticsService) generateDataGenerationReport(report *AnalyticsReport) {
-	totalRows := 0
-	generationEvents := 0
-
-	for _, event := range as.events {
-		if event.Timestamp.After(report.StartDate) && event.Timestamp.Before(report.EndDate) && event.Event == "data_generated" {
-			generationEvents++
-			if rows, ok := event.Properties["rows"].(int); ok {
-				totalRows += rows
-			}
-		}
-	}
-
-	report.Metrics["total_rows_generated"] = float64(totalRows)
-	report.Metrics["generation_events"] = float64(generationEvents)
-
-	if generationEvents > 0 {
-		report.Metrics["avg_rows_per_generation"] = float64(totalRows) / float64(generationEvents)
-	}
-}
-
-// generateRevenueReport generates a revenue report
-func (as *AnalyticsService) generateRevenueReport(report *AnalyticsReport) {
-	totalRevenue := 0.0
-	paymentEvents := 0
-
-	for _, event := range as.events {
-		if event.Timestamp.After(report.StartDate) && event.Timestamp.Before(report.EndDate) && event.Event == "payment_completed" {
-			paymentEvents++
-			if amount, ok := event.Properties["amount"].(float64); ok {
-				totalRevenue += amount
-			}
-		}
-	}
-
-	report.Metrics["total_revenue"] = totalRevenue
-	report.Metrics["payment_events"] = float64(paymentEvents)
-
-	if paymentEvents > 0 {
-		report.Metrics["avg_revenue_per_payment"] = totalRevenue / float64(paymentEvents)
-	}
-}
-
-// generatePerformanceReport generates a performance report
-func (as *AnalyticsService) generatePerformanceReport(report *AnalyticsReport) {
-	totalLatency := 0.0
-	apiCalls := 0
-
-	for _, event := range as.events {
-		if event.Timestamp.After(report.StartDate) && event.Timestamp.Before(report.EndDate) && event.Event == "api_call" {
-			apiCalls++
-			if duration, ok := event.Properties["duration"].(int64); ok {
-				totalLatency += float64(duration)
-			}
-		}
-	}
-
-	report.Metrics["total_api_calls"] = float64(apiCalls)
-
-	if apiCalls > 0 {
-		report.Metrics["avg_latency_ms"] = totalLatency / float64(apiCalls)
-	}
-}
-
 // generateInsights generates insights for a report
 func (as *AnalyticsService) generateInsights(report *AnalyticsReport) {
 	insights := make([]string, 0)
@@ -523,83 +675,22 @@ func (as *AnalyticsService) generateInsights(report *AnalyticsReport) {
 	report.Insights = insights
 }
 
-// generateCharts generates charts for a report
-func (as *AnalyticsService) generateCharts(report *AnalyticsReport) {
-	charts := make([]Chart, 0)
-
-	// Generate event timeline chart
-	eventTimeline := Chart{
-		Type:  "line",
-		Title: "Event Timeline",
-		XAxis: "Time",
-		YAxis: "Events",
-		Data:  as.generateEventTimelineData(report.StartDate, report.EndDate),
-		Options: map[string]interface{}{
-			"responsive": true,
-		},
-	}
-	charts = append(charts, eventTimeline)
-
-	// Generate category distribution chart
-	categoryDistribution := Chart{
-		Type:  "pie",
-		Title: "Event Categories",
-		XAxis: "Category",
-		YAxis: "Count",
-		Data:  as.generateCategoryDistributionData(report.StartDate, report.EndDate),
-		Options: map[string]interface{}{
-			"responsive": true,
-		},
-	}
-	charts = append(charts, categoryDistribution)
-
-	report.Charts = charts
-}
-
-// generateEventTimelineData generates data for event timeline chart
-func (as *AnalyticsService) generateEventTimelineData(startDate, endDate time.Time) []ChartDataPoint {
-	// This would generate actual timeline data
-	// For now, return mock data
-	return []ChartDataPoint{
-		{X: "00:00", Y: 10},
-		{X: "06:00", Y: 25},
-		{X: "12:00", Y: 45},
-		{X: "18:00", Y: 30},
-	}
-}
-
-// generateCategoryDistributionData generates data for category distribution chart
-func (as *AnalyticsService) generateCategoryDistributionData(startDate, endDate time.Time) []ChartDataPoint {
-	categoryCounts := make(map[string]int)
-
-	for _, event := range as.events {
-		if event.Timestamp.After(startDate) && event.Timestamp.Before(endDate) {
-			categoryCounts[event.Category]++
-		}
-	}
-
-	var data []ChartDataPoint
-	for category, count := range categoryCounts {
-		data = append(data, ChartDataPoint{
-			X:     category,
-			Y:     float64(count),
-			Label: category,
-		})
-	}
-
-	return data
-}
-
 // startBackgroundProcessing starts background analytics processing
 func (as *AnalyticsService) startBackgroundProcessing() {
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
+	flush := time.NewTicker(FlushInterval)
+	defer flush.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
 			as.processInsights()
 			as.updateTrends()
+		case <-flush.C:
+			_ = as.Flush(context.Background())
+		case <-as.flushNow:
+			_ = as.Flush(context.Background())
 		}
 	}
 }
@@ -622,6 +713,7 @@ func (as *AnalyticsService) processInsights() {
 
 // updateTrends updates trend data
 func (as *AnalyticsService) updateTrends() {
+	count := as.eventCount()
 	as.mu.Lock()
 	defer as.mu.Unlock()
 
@@ -632,7 +724,7 @@ func (as *AnalyticsService) updateTrends() {
 		as.trends[trendKey] = make([]float64, 0)
 	}
 
-	as.trends[trendKey] = append(as.trends[trendKey], float64(len(as.events)))
+	as.trends[trendKey] = append(as.trends[trendKey], float64(count))
 
 	// Keep only last 100 data points
 	if len(as.trends[trendKey]) > 100 {
@@ -662,13 +754,48 @@ func (as *AnalyticsService) GetReport(reportID string) (*AnalyticsReport, bool)
 	return report, exists
 }
 
+// eventCount is the number of stored events, or of those in memory
+func (as *AnalyticsService) eventCount() int64 {
+	stats := as.eventStats()
+	return stats.Events
+}
+
+func (as *AnalyticsService) eventStats() models.AnalyticsStats {
+	as.mu.RLock()
+	store := as.store
+	as.mu.RUnlock()
+	if store != nil {
+		if stats, err := store.Stats(context.Background()); err == nil {
+			return *stats
+		}
+		return models.AnalyticsStats{}
+	}
+
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	stats := models.AnalyticsStats{Events: int64(len(as.events))}
+	for i := range as.events {
+		ts := as.events[i].Timestamp
+		if stats.Oldest == nil || ts.Before(*stats.Oldest) {
+			stats.Oldest = &ts
+		}
+		if stats.Newest == nil || ts.After(*stats.Newest) {
+			stats.Newest = &ts
+		}
+	}
+	return stats
+}
+
 // GetAnalyticsStats returns analytics statistics
 func (as *AnalyticsService) GetAnalyticsStats() map[string]interface{} {
+	events := as.eventStats()
+
 	as.mu.RLock()
 	defer as.mu.RUnlock()
 
 	stats := map[string]interface{}{
-		"total_events":   len(as.events),
+		"total_events":   events.Events,
+		"pending_events": len(as.pending),
 		"total_metrics":  len(as.metrics),
 		"total_reports":  len(as.reports),
 		"total_insights": len(as.insights),
@@ -676,22 +803,11 @@ func (as *AnalyticsService) GetAnalyticsStats() map[string]interface{} {
 		"oldest_event":   time.Time{},
 		"newest_event":   time.Time{},
 	}
-
-	if len(as.events) > 0 {
-		oldest := as.events[0].Timestamp
-		newest := as.events[0].Timestamp
-
-		for _, event := range as.events {
-			if event.Timestamp.Before(oldest) {
-				oldest = event.Timestamp
-			}
-			if event.Timestamp.After(newest) {
-				newest = event.Timestamp
-			}
-		}
-
-		stats["oldest_event"] = oldest
-		stats["newest_event"] = newest
+	if events.Oldest != nil {
+		stats["oldest_event"] = *events.Oldest
+	}
+	if events.Newest != nil {
+		stats["newest_event"] = *events.Newest
 	}
 
 	return stats
@@ -699,7 +815,7 @@ func (as *AnalyticsService) GetAnalyticsStats() map[string]interface{} {
 
 // generateEventID generates a unique event ID
 func generateEventID() string {
-	return fmt.Sprintf("event_%d", time.Now().UnixNano())
+	return "event_" + uuid.NewString()
 }
 
 // generateReportID generates a unique report ID
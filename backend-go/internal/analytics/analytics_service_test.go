@@ -0,0 +1,109 @@
+// Package analytics_test provides unit tests for analytics event storage
+package analytics_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/analytics"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	events  []models.AnalyticsEvent
+	inserts int
+	fail    error
+}
+
+func (m *memoryStore) InsertEvents(ctx context.Context, events []models.AnalyticsEvent) error {
+	if m.fail != nil {
+		return m.fail
+	}
+	m.inserts++
+	m.events = append(m.events, events...)
+	return nil
+}
+
+func (m *memoryStore) QueryEvents(ctx context.Context, f models.AnalyticsEventFilter) ([]models.AnalyticsEvent, error) {
+	var out []models.AnalyticsEvent
+	for _, e := range m.events {
+		if (f.Event == "" || e.Event == f.Event) && (f.StartTime == nil || !e.Timestamp.Before(*f.StartTime)) {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryStore) Downsample(ctx context.Context, f models.AnalyticsEventFilter, interval string) ([]models.AnalyticsBucket, error) {
+	return nil, nil
+}
+
+func (m *memoryStore) Stats(ctx context.Context) (*models.AnalyticsStats, error) {
+	return &models.AnalyticsStats{Events: int64(len(m.events))}, nil
+}
+
+func (m *memoryStore) ListPendingAnonymization(ctx context.Context, before, afterTime time.Time, afterID string, limit int) ([]models.AnalyticsEvent, error) {
+	return nil, nil
+}
+
+func (m *memoryStore) MarkAnonymized(ctx context.Context, id, ipAddress, userAgent string) error {
+	return nil
+}
+
+func TestEventsAreWrittenInBatches(t *testing.T) {
+	store := &memoryStore{}
+	as := analytics.NewAnalyticsService()
+	as.SetStore(store)
+	ctx := context.Background()
+
+	require.NoError(t, as.TrackPayment(ctx, "u1", "pro", 10, "usd"))
+	require.NoError(t, as.TrackAPICall(ctx, "u1", "/x", "GET", 200, time.Millisecond))
+	assert.Empty(t, store.events, "events wait in the buffer")
+
+	events, err := as.GetEvents(ctx, analytics.EventFilters{Event: "payment_completed"})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, 1, store.inserts, "a read flushes the buffer in one batch")
+	assert.Len(t, store.events, 2)
+
+	report, err := as.GenerateReport(ctx, "revenue", "last_7_days", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, report.Metrics["total_revenue"])
+}
+
+func TestFailedFlushKeepsEvents(t *testing.T) {
+	store := &memoryStore{fail: errors.New("db down")}
+	as := analytics.NewAnalyticsService()
+	as.SetStore(store)
+	ctx := context.Background()
+
+	require.NoError(t, as.TrackUserAction(ctx, "u1", "login", "auth", nil))
+	assert.Error(t, as.Flush(ctx))
+
+	store.fail = nil
+	require.NoError(t, as.Flush(ctx))
+	assert.Len(t, store.events, 1)
+}
+
+func TestEventSeriesInMemory(t *testing.T) {
+	as := analytics.NewAnalyticsService()
+	ctx := context.Background()
+	day := time.Date(2026, 3, 11, 9, 0, 0, 0, time.UTC)
+	for i, user := range []string{"u1", "u2", "u1"} {
+		require.NoError(t, as.TrackEvent(ctx, analytics.AnalyticsEvent{UserID: user, Event: "login", Timestamp: day.Add(time.Duration(i) * time.Hour)}))
+	}
+
+	series, err := as.GetEventSeries(ctx, analytics.EventFilters{}, "day")
+	require.NoError(t, err)
+	require.Len(t, series, 1)
+	assert.Equal(t, time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC), series[0].Bucket)
+	assert.Equal(t, int64(3), series[0].Events)
+	assert.Equal(t, int64(2), series[0].Users)
+
+	_, err = as.GetEventSeries(ctx, analytics.EventFilters{}, "fortnight")
+	assert.ErrorIs(t, err, analytics.ErrInvalidInterval)
+}
@@ -0,0 +1,450 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// ReportDefinition describes a custom report: which metrics to compute, how to
+// group and filter events, and how to chart the result
+type ReportDefinition struct {
+	Name      string            `json:"name"`
+	Metrics   []string          `json:"metrics"`
+	GroupBy   []string          `json:"group_by,omitempty"`
+	Filters   map[string]string `json:"filters,omitempty"`
+	ChartType string            `json:"chart_type,omitempty"`
+	Period    string            `json:"period,omitempty"`
+}
+
+// ReportGroup holds metric values for one combination of group-by dimensions
+type ReportGroup struct {
+	Key     map[string]string  `json:"key"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+type aggregation int
+
+const (
+	aggCount aggregation = iota
+	aggSum
+	aggAvg
+	aggDistinctUsers
+	aggPerUser
+)
+
+// metricSpec defines a metric as an aggregation over events, optionally
+// limited to one event name and reading a numeric property
+type metricSpec struct {
+	event    string
+	property string
+	agg      aggregation
+}
+
+var reportMetrics = map[string]metricSpec{
+	"total_events":            {agg: aggCount},
+	"unique_users":            {agg: aggDistinctUsers},
+	"active_users":            {agg: aggDistinctUsers},
+	"events_per_user":         {agg: aggPerUser},
+	"avg_activity_per_user":   {agg: aggPerUser},
+	"generation_events":       {event: "data_generated", agg: aggCount},
+	"total_rows_generated":    {event: "data_generated", property: "rows", agg: aggSum},
+	"avg_rows_per_generation": {event: "data_generated", property: "rows", agg: aggAvg},
+	"payment_events":          {event: "payment_completed", agg: aggCount},
+	"total_revenue":           {event: "payment_completed", property: "amount", agg: aggSum},
+	"avg_revenue_per_payment": {event: "payment_completed", property: "amount", agg: aggAvg},
+	"total_api_calls":         {event: "api_call", agg: aggCount},
+	"avg_latency_ms":          {event: "api_call", property: "duration", agg: aggAvg},
+}
+
+// reportDimensions are the fixed dimensions; any event property can also be
+// used as "property:<name>"
+var reportDimensions = []string{"event", "category", "user_id", "org_id", "day", "week", "month"}
+
+// ReportChartTypes are the chart types a report can render
+var ReportChartTypes = []string{"table", "line", "bar", "pie"}
+
+// builtinReports are the report types GenerateReport has always offered,
+// expressed as definitions
+var builtinReports = map[string]ReportDefinition{
+	"overview":        {Metrics: []string{"total_events", "unique_users", "events_per_user"}, GroupBy: []string{"day"}, ChartType: "line"},
+	"user_activity":   {Metrics: []string{"active_users", "avg_activity_per_user"}, GroupBy: []string{"day"}, ChartType: "line"},
+	"data_generation": {Metrics: []string{"total_rows_generated", "generation_events", "avg_rows_per_generation"}, GroupBy: []string{"day"}, ChartType: "bar"},
+	"revenue":         {Metrics: []string{"total_revenue", "payment_events", "avg_revenue_per_payment"}, GroupBy: []string{"day"}, ChartType: "bar"},
+	"performance":     {Metrics: []string{"total_api_calls", "avg_latency_ms"}, GroupBy: []string{"day"}, ChartType: "line"},
+}
+
+// ReportCatalog lists the metrics, dimensions and chart types available to report templates
+func ReportCatalog() map[string][]string {
+	metrics := make([]string, 0, len(reportMetrics))
+	for name := range reportMetrics {
+		metrics = append(metrics, name)
+	}
+	sort.Strings(metrics)
+	builtins := make([]string, 0, len(builtinReports))
+	for name := range builtinReports {
+		builtins = append(builtins, name)
+	}
+	sort.Strings(builtins)
+	return map[string][]string{
+		"metrics":     metrics,
+		"dimensions":  append(append([]string{}, reportDimensions...), "property:<name>"),
+		"chart_types": ReportChartTypes,
+		"builtin":     builtins,
+	}
+}
+
+// DefinitionFromTemplate converts a stored template into a report definition
+func DefinitionFromTemplate(t *models.ReportTemplate) ReportDefinition {
+	return ReportDefinition{
+		Name:      t.Name,
+		Metrics:   t.Metrics,
+		GroupBy:   t.GroupBy,
+		Filters:   t.Filters,
+		ChartType: t.ChartType,
+		Period:    t.Period,
+	}
+}
+
+// ValidateDefinition checks metrics, dimensions and chart type against the catalog
+func ValidateDefinition(def ReportDefinition) error {
+	if len(def.Metrics) == 0 {
+		return fmt.Errorf("at least one metric is required")
+	}
+	for _, m := range def.Metrics {
+		if _, ok := reportMetrics[m]; !ok {
+			return fmt.Errorf("unknown metric: %s", m)
+		}
+	}
+	for _, d := range def.GroupBy {
+		if !validDimension(d) {
+			return fmt.Errorf("unknown dimension: %s", d)
+		}
+	}
+	for d := range def.Filters {
+		if !validDimension(d) {
+			return fmt.Errorf("unknown filter dimension: %s", d)
+		}
+	}
+	if def.ChartType != "" && !contains(ReportChartTypes, def.ChartType) {
+		return fmt.Errorf("unknown chart type: %s", def.ChartType)
+	}
+	return nil
+}
+
+func validDimension(d string) bool {
+	if name, ok := strings.CutPrefix(d, "property:"); ok {
+		return name != ""
+	}
+	return contains(reportDimensions, d)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildReport computes a report from tracked events according to a definition
+func (as *AnalyticsService) BuildReport(ctx context.Context, reportType string, def ReportDefinition) (*AnalyticsReport, error) {
+	if err := ValidateDefinition(def); err != nil {
+		return nil, err
+	}
+	if def.ChartType == "" {
+		def.ChartType = "table"
+	}
+	startDate, endDate := as.getPeriodDates(def.Period)
+
+	filters := make(map[string]interface{}, len(def.Filters))
+	for k, v := range def.Filters {
+		filters[k] = v
+	}
+	name := def.Name
+	if name == "" {
+		name = fmt.Sprintf("%s Report - %s", reportType, def.Period)
+	}
+	report := &AnalyticsReport{
+		ID:          generateReportID(),
+		Name:        name,
+		Type:        reportType,
+		Period:      def.Period,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Metrics:     make(map[string]float64),
+		Insights:    make([]string, 0),
+		Charts:      make([]Chart, 0),
+		GeneratedAt: time.Now(),
+		Filters:     filters,
+	}
+
+	inPeriod, err := as.reportEvents(ctx, startDate, endDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load report events: %w", err)
+	}
+	events := inPeriod[:0:0]
+	for _, event := range inPeriod {
+		if matchesReportFilters(event, def.Filters) {
+			events = append(events, event)
+		}
+	}
+
+	totals := make(map[string]*metricAccumulator, len(def.Metrics))
+	groups := make(map[string]*groupAccumulator)
+	var order []string
+	for _, event := range events {
+		key, labels := groupKey(event, def.GroupBy)
+		g, ok := groups[key]
+		if !ok && len(def.GroupBy) > 0 {
+			g = &groupAccumulator{labels: labels, metrics: make(map[string]*metricAccumulator)}
+			groups[key] = g
+			order = append(order, key)
+		}
+		for _, m := range def.Metrics {
+			spec := reportMetrics[m]
+			if spec.event != "" && event.Event != spec.event {
+				continue
+			}
+			accumulator(totals, m).add(event, spec)
+			if g != nil {
+				accumulator(g.metrics, m).add(event, spec)
+			}
+		}
+	}
+
+	for _, m := range def.Metrics {
+		report.Metrics[m] = accumulator(totals, m).value(reportMetrics[m])
+	}
+
+	sort.Strings(order)
+	for _, key := range order {
+		g := groups[key]
+		values := make(map[string]float64, len(def.Metrics))
+		for _, m := range def.Metrics {
+			values[m] = accumulator(g.metrics, m).value(reportMetrics[m])
+		}
+		report.Groups = append(report.Groups, ReportGroup{Key: g.labels, Metrics: values})
+	}
+
+	for _, m := range def.Metrics {
+		chart := Chart{
+			Type:    def.ChartType,
+			Title:   m,
+			XAxis:   strings.Join(def.GroupBy, " / "),
+			YAxis:   m,
+			Data:    make([]ChartDataPoint, 0, len(order)),
+			Options: map[string]interface{}{"responsive": true},
+		}
+		if len(def.GroupBy) == 0 {
+			chart.Data = append(chart.Data, ChartDataPoint{X: "total", Y: report.Metrics[m]})
+		}
+		for i, key := range order {
+			chart.Data = append(chart.Data, ChartDataPoint{X: key, Y: report.Groups[i].Metrics[m], Label: key})
+		}
+		report.Charts = append(report.Charts, chart)
+	}
+
+	as.generateInsights(report)
+
+	as.mu.Lock()
+	as.reports[report.ID] = report
+	as.mu.Unlock()
+
+	return report, nil
+}
+
+type metricAccumulator struct {
+	count  int
+	sum    float64
+	valued int
+	users  map[string]bool
+}
+
+type groupAccumulator struct {
+	labels  map[string]string
+	metrics map[string]*metricAccumulator
+}
+
+func accumulator(m map[string]*metricAccumulator, name string) *metricAccumulator {
+	a, ok := m[name]
+	if !ok {
+		a = &metricAccumulator{users: make(map[string]bool)}
+		m[name] = a
+	}
+	return a
+}
+
+func (a *metricAccumulator) add(event AnalyticsEvent, spec metricSpec) {
+	a.count++
+	a.users[event.UserID] = true
+	if spec.property != "" {
+		if v, ok := toFloat(event.Properties[spec.property]); ok {
+			a.sum += v
+			a.valued++
+		}
+	}
+}
+
+func (a *metricAccumulator) value(spec metricSpec) float64 {
+	switch spec.agg {
+	case aggSum:
+		return a.sum
+	case aggAvg:
+		if a.valued == 0 {
+			return 0
+		}
+		return a.sum / float64(a.valued)
+	case aggDistinctUsers:
+		return float64(len(a.users))
+	case aggPerUser:
+		if len(a.users) == 0 {
+			return 0
+		}
+		return float64(a.count) / float64(len(a.users))
+	default:
+		return float64(a.count)
+	}
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// dimensionValue reads a dimension of an event as a string
+func dimensionValue(event AnalyticsEvent, dim string) string {
+	switch dim {
+	case "event":
+		return event.Event
+	case "category":
+		return event.Category
+	case "user_id":
+		return event.UserID
+	case "org_id":
+		return strconv.FormatInt(event.OrgID, 10)
+	case "day":
+		return event.Timestamp.UTC().Format("2006-01-02")
+	case "week":
+		y, w := event.Timestamp.UTC().ISOWeek()
+		return fmt.Sprintf("%d-W%02d", y, w)
+	case "month":
+		return event.Timestamp.UTC().Format("2006-01")
+	}
+	if name, ok := strings.CutPrefix(dim, "property:"); ok {
+		if v, ok := event.Properties[name]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+func groupKey(event AnalyticsEvent, dims []string) (string, map[string]string) {
+	if len(dims) == 0 {
+		return "", nil
+	}
+	labels := make(map[string]string, len(dims))
+	parts := make([]string, len(dims))
+	for i, d := range dims {
+		v := dimensionValue(event, d)
+		labels[d] = v
+		parts[i] = v
+	}
+	return strings.Join(parts, " / "), labels
+}
+
+func matchesReportFilters(event AnalyticsEvent, filters map[string]string) bool {
+	for dim, want := range filters {
+		if dimensionValue(event, dim) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// NextReportRun returns the next slot for a schedule after t, in UTC. On-demand
+// templates return nil.
+func NextReportRun(schedule models.ReportSchedule, t time.Time) *time.Time {
+	t = t.UTC()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	var next time.Time
+	switch schedule {
+	case models.ReportDaily:
+		next = midnight.AddDate(0, 0, 1)
+	case models.ReportWeekly:
+		days := (8 - int(midnight.Weekday())) % 7
+		if days == 0 {
+			days = 7
+		}
+		next = midnight.AddDate(0, 0, days)
+	case models.ReportMonthly:
+		next = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0)
+	default:
+		return nil
+	}
+	return &next
+}
+
+// FormatReportSummary renders a report as plain text for email delivery
+func FormatReportSummary(report *AnalyticsReport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n%s to %s\n\n", report.Name, report.StartDate.UTC().Format(time.RFC3339), report.EndDate.UTC().Format(time.RFC3339))
+
+	names := make([]string, 0, len(report.Metrics))
+	for name := range report.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: %s\n", name, strconv.FormatFloat(report.Metrics[name], 'f', -1, 64))
+	}
+	for _, g := range report.Groups {
+		parts := make([]string, 0, len(g.Key))
+		for _, dim := range sortedKeys(g.Key) {
+			parts = append(parts, dim+"="+g.Key[dim])
+		}
+		fmt.Fprintf(&b, "\n[%s]\n", strings.Join(parts, ", "))
+		for _, name := range names {
+			fmt.Fprintf(&b, "  %s: %s\n", name, strconv.FormatFloat(g.Metrics[name], 'f', -1, 64))
+		}
+	}
+	if len(report.Insights) > 0 {
+		b.WriteString("\nInsights:\n")
+		for _, insight := range report.Insights {
+			fmt.Fprintf(&b, "- %s\n", insight)
+		}
+	}
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
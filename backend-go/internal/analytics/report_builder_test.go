@@ -0,0 +1,71 @@
+// Package analytics_test provides unit tests for analytics reporting
+package analytics_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/analytics"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDefinition(t *testing.T) {
+	t.Run("accepts known metrics and dimensions", func(t *testing.T) {
+		def := analytics.ReportDefinition{
+			Name:      "revenue",
+			Metrics:   []string{"total_revenue"},
+			GroupBy:   []string{"month", "property:plan_id"},
+			ChartType: "bar",
+		}
+		assert.NoError(t, analytics.ValidateDefinition(def))
+	})
+
+	t.Run("rejects unknown metric", func(t *testing.T) {
+		def := analytics.ReportDefinition{Name: "x", Metrics: []string{"bogus"}}
+		assert.Error(t, analytics.ValidateDefinition(def))
+	})
+
+	t.Run("rejects unknown dimension", func(t *testing.T) {
+		def := analytics.ReportDefinition{Name: "x", Metrics: []string{"total_events"}, GroupBy: []string{"planet"}}
+		assert.Error(t, analytics.ValidateDefinition(def))
+	})
+
+	t.Run("rejects empty metrics", func(t *testing.T) {
+		assert.Error(t, analytics.ValidateDefinition(analytics.ReportDefinition{Name: "x"}))
+	})
+}
+
+func TestBuildReportGroupsAndFilters(t *testing.T) {
+	as := analytics.NewAnalyticsService()
+	ctx := context.Background()
+	require.NoError(t, as.TrackPayment(ctx, "u1", "pro", 10, "usd"))
+	require.NoError(t, as.TrackPayment(ctx, "u2", "pro", 30, "usd"))
+	require.NoError(t, as.TrackPayment(ctx, "u1", "starter", 5, "usd"))
+
+	report, err := as.BuildReport(ctx, "custom", analytics.ReportDefinition{
+		Name:    "revenue by plan",
+		Metrics: []string{"total_revenue", "payment_events"},
+		GroupBy: []string{"property:plan_id"},
+		Filters: map[string]string{"property:plan_id": "pro"},
+		Period:  "last_7_days",
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Groups, 1)
+	assert.Equal(t, "pro", report.Groups[0].Key["property:plan_id"])
+	assert.Equal(t, 40.0, report.Groups[0].Metrics["total_revenue"])
+	assert.Equal(t, 2.0, report.Groups[0].Metrics["payment_events"])
+	assert.Equal(t, 40.0, report.Metrics["total_revenue"])
+}
+
+func TestNextReportRun(t *testing.T) {
+	// Wednesday
+	now := time.Date(2026, 3, 11, 15, 30, 0, 0, time.UTC)
+
+	assert.Nil(t, analytics.NextReportRun(models.ReportOnDemand, now))
+	assert.Equal(t, time.Date(2026, 3, 12, 0, 0, 0, 0, time.UTC), *analytics.NextReportRun(models.ReportDaily, now))
+	assert.Equal(t, time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC), *analytics.NextReportRun(models.ReportWeekly, now))
+	assert.Equal(t, time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), *analytics.NextReportRun(models.ReportMonthly, now))
+}
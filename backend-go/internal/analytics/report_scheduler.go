@@ -0,0 +1,162 @@
+package analytics
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
+	"go.uber.org/zap"
+)
+
+// ReportStore persists report templates and runs
+type ReportStore interface {
+	ListDueTemplates(ctx context.Context, now time.Time, limit int) ([]models.ReportTemplate, error)
+	MarkTemplateRun(ctx context.Context, id int64, ranAt time.Time, nextRunAt *time.Time) error
+	InsertRun(ctx context.Context, run *models.ReportRun) (*models.ReportRun, error)
+}
+
+// ReportMailer emails a rendered report
+type ReportMailer interface {
+	SendReportEmail(to, reportName, summary string) error
+}
+
+// ReportWebhook posts a report to a webhook endpoint
+type ReportWebhook interface {
+	Deliver(ctx context.Context, webhook *webhooks.Webhook, event *webhooks.WebhookEvent) error
+}
+
+// Report run statuses
+const (
+	ReportRunCompleted      = "completed"
+	ReportRunDeliveryFailed = "delivery_failed"
+	ReportRunFailed         = "failed"
+)
+
+// ReportScheduler generates report templates on demand or on their schedule
+// and delivers the results by email and webhook
+type ReportScheduler struct {
+	analytics *AnalyticsService
+	store     ReportStore
+	mailer    ReportMailer
+	hooks     ReportWebhook
+	logger    *zap.Logger
+}
+
+// NewReportScheduler creates a scheduler; mailer and hooks may be nil to
+// disable that delivery channel
+func NewReportScheduler(analytics *AnalyticsService, store ReportStore, mailer ReportMailer, hooks ReportWebhook, logger *zap.Logger) *ReportScheduler {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &ReportScheduler{analytics: analytics, store: store, mailer: mailer, hooks: hooks, logger: logger}
+}
+
+// Run generates a template, optionally delivers it and records the run
+func (s *ReportScheduler) Run(ctx context.Context, t *models.ReportTemplate, trigger string, deliver bool) (*AnalyticsReport, *models.ReportRun, error) {
+	run := &models.ReportRun{TemplateID: t.ID, Trigger: trigger, Status: ReportRunCompleted, Result: "{}"}
+
+	report, err := s.analytics.BuildReport(ctx, "custom", DefinitionFromTemplate(t))
+	if err != nil {
+		msg := err.Error()
+		run.Status, run.Error = ReportRunFailed, &msg
+		stored, storeErr := s.store.InsertRun(ctx, run)
+		if storeErr != nil {
+			s.logger.Error("failed to record report run", zap.Int64("template_id", t.ID), zap.Error(storeErr))
+		}
+		return nil, stored, err
+	}
+
+	if raw, err := json.Marshal(report); err == nil {
+		run.Result = string(raw)
+	}
+	if deliver {
+		if err := s.deliver(ctx, t, report); err != nil {
+			msg := err.Error()
+			run.Status, run.Error = ReportRunDeliveryFailed, &msg
+			s.logger.Warn("report delivery failed", zap.Int64("template_id", t.ID), zap.Error(err))
+		}
+	}
+
+	stored, err := s.store.InsertRun(ctx, run)
+	if err != nil {
+		return report, nil, fmt.Errorf("failed to record report run: %w", err)
+	}
+	return report, stored, nil
+}
+
+// RunDue generates every scheduled template whose slot has arrived and
+// returns the number of templates run
+func (s *ReportScheduler) RunDue(ctx context.Context, now time.Time) (int, error) {
+	due, err := s.store.ListDueTemplates(ctx, now, 50)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list due reports: %w", err)
+	}
+	for i := range due {
+		t := &due[i]
+		if _, _, err := s.Run(ctx, t, "schedule", true); err != nil {
+			s.logger.Error("scheduled report failed", zap.Int64("template_id", t.ID), zap.Error(err))
+		}
+		// Advance even on failure so a broken template does not run every tick
+		if err := s.store.MarkTemplateRun(ctx, t.ID, now, NextReportRun(t.Schedule, now)); err != nil {
+			return i + 1, fmt.Errorf("failed to reschedule report %d: %w", t.ID, err)
+		}
+	}
+	return len(due), nil
+}
+
+func (s *ReportScheduler) deliver(ctx context.Context, t *models.ReportTemplate, report *AnalyticsReport) error {
+	var errs []error
+	if len(t.EmailTo) > 0 {
+		if s.mailer == nil {
+			errs = append(errs, errors.New("email delivery is not configured"))
+		} else {
+			summary := FormatReportSummary(report)
+			for _, to := range t.EmailTo {
+				if err := s.mailer.SendReportEmail(to, report.Name, summary); err != nil {
+					errs = append(errs, fmt.Errorf("email to %s: %w", to, err))
+				}
+			}
+		}
+	}
+	if t.WebhookURL != nil && *t.WebhookURL != "" {
+		if s.hooks == nil {
+			errs = append(errs, errors.New("webhook delivery is not configured"))
+		} else {
+			hook := &webhooks.Webhook{
+				ID:         fmt.Sprintf("report_template_%d", t.ID),
+				Name:       t.Name,
+				URL:        *t.WebhookURL,
+				Active:     true,
+				MaxRetries: 3,
+				RetryDelay: 2 * time.Second,
+			}
+			if t.WebhookSecret != nil {
+				hook.Secret = *t.WebhookSecret
+			}
+			event := &webhooks.WebhookEvent{
+				ID:        report.ID,
+				Type:      "report.generated",
+				Data:      map[string]interface{}{"template_id": t.ID, "report": report},
+				Timestamp: time.Now(),
+				Source:    "synthos",
+				Version:   "v1",
+			}
+			if err := s.hooks.Deliver(ctx, hook, event); err != nil {
+				errs = append(errs, fmt.Errorf("webhook: %w", err))
+			}
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
@@ -0,0 +1,227 @@
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pricing"
+)
+
+// RevenuePeriod summarizes how recurring revenue moved between the start and
+// end of a period. Rates are percentages.
+type RevenuePeriod struct {
+	Start               time.Time `json:"start"`
+	End                 time.Time `json:"end"`
+	StartingMRR         float64   `json:"starting_mrr"`
+	EndingMRR           float64   `json:"ending_mrr"`
+	NewMRR              float64   `json:"new_mrr"`
+	ExpansionMRR        float64   `json:"expansion_mrr"`
+	ContractionMRR      float64   `json:"contraction_mrr"`
+	ChurnedMRR          float64   `json:"churned_mrr"`
+	NetNewMRR           float64   `json:"net_new_mrr"`
+	StartingCustomers   int       `json:"starting_customers"`
+	EndingCustomers     int       `json:"ending_customers"`
+	NewCustomers        int       `json:"new_customers"`
+	ChurnedCustomers    int       `json:"churned_customers"`
+	CustomerChurnRate   float64   `json:"customer_churn_rate"`
+	RevenueChurnRate    float64   `json:"revenue_churn_rate"`
+	NetRevenueRetention float64   `json:"net_revenue_retention"`
+	ARPU                float64   `json:"arpu"`
+}
+
+// RevenueCohort groups customers by the month of their first paid subscription
+type RevenueCohort struct {
+	Cohort          string  `json:"cohort"`
+	Customers       int     `json:"customers"`
+	ActiveCustomers int     `json:"active_customers"`
+	Revenue         float64 `json:"revenue"`
+	LTV             float64 `json:"ltv"`
+}
+
+// RevenueReport compares a period with the one before it. Change holds the
+// relative change (percent) of each MRR figure and ARPU, and the absolute
+// change (percentage points) of each rate; it is nil where the previous
+// period has no baseline.
+type RevenueReport struct {
+	Current     RevenuePeriod       `json:"current"`
+	Previous    RevenuePeriod       `json:"previous"`
+	Change      map[string]*float64 `json:"change"`
+	Cohorts     []RevenueCohort     `json:"cohorts"`
+	GeneratedAt time.Time           `json:"generated_at"`
+}
+
+// SubscriptionMRR returns the monthly recurring revenue of a subscription
+// record: its negotiated amount if set, otherwise the tier's list price.
+// Only active and past-due subscriptions count as paying.
+func SubscriptionMRR(sub models.UserSubscription) float64 {
+	if sub.Status != models.SubStatusActive && sub.Status != models.SubStatusPastDue {
+		return 0
+	}
+	if sub.MonthlyAmount > 0 {
+		return sub.MonthlyAmount
+	}
+	for _, p := range pricing.SubscriptionPlans() {
+		if p.ID == string(sub.SubscriptionTier) {
+			return float64(p.Price)
+		}
+	}
+	return 0
+}
+
+// BuildRevenueReport computes revenue movement for [start, end), the equally
+// long period before it, and lifetime value per cohort as of end. history
+// must be ordered by user and then by time, as UserSubscriptionRepo.ListHistory
+// returns it.
+func BuildRevenueReport(history []models.UserSubscription, start, end time.Time) *RevenueReport {
+	byUser := subscriptionsByUser(history)
+	current := revenuePeriod(byUser, start, end)
+	previous := revenuePeriod(byUser, start.Add(-end.Sub(start)), start)
+
+	change := map[string]*float64{
+		"ending_mrr":      relativeChange(current.EndingMRR, previous.EndingMRR),
+		"new_mrr":         relativeChange(current.NewMRR, previous.NewMRR),
+		"expansion_mrr":   relativeChange(current.ExpansionMRR, previous.ExpansionMRR),
+		"contraction_mrr": relativeChange(current.ContractionMRR, previous.ContractionMRR),
+		"churned_mrr":     relativeChange(current.ChurnedMRR, previous.ChurnedMRR),
+		"arpu":            relativeChange(current.ARPU, previous.ARPU),
+	}
+	if previous.StartingCustomers > 0 {
+		change["customer_churn_rate"] = pointChange(current.CustomerChurnRate, previous.CustomerChurnRate)
+	}
+	if previous.StartingMRR > 0 {
+		change["revenue_churn_rate"] = pointChange(current.RevenueChurnRate, previous.RevenueChurnRate)
+		change["net_revenue_retention"] = pointChange(current.NetRevenueRetention, previous.NetRevenueRetention)
+	}
+
+	return &RevenueReport{
+		Current:     current,
+		Previous:    previous,
+		Change:      change,
+		Cohorts:     revenueCohorts(byUser, end),
+		GeneratedAt: time.Now(),
+	}
+}
+
+func subscriptionsByUser(history []models.UserSubscription) map[int64][]models.UserSubscription {
+	out := make(map[int64][]models.UserSubscription)
+	for _, sub := range history {
+		out[sub.UserID] = append(out[sub.UserID], sub)
+	}
+	return out
+}
+
+// mrrAt returns a user's MRR at t from their time-ordered records
+func mrrAt(subs []models.UserSubscription, t time.Time) float64 {
+	mrr := 0.0
+	for _, sub := range subs {
+		if sub.CreatedAt.After(t) {
+			break
+		}
+		mrr = SubscriptionMRR(sub)
+	}
+	return mrr
+}
+
+func revenuePeriod(byUser map[int64][]models.UserSubscription, start, end time.Time) RevenuePeriod {
+	p := RevenuePeriod{Start: start, End: end}
+	for _, subs := range byUser {
+		before, after := mrrAt(subs, start), mrrAt(subs, end)
+		p.StartingMRR += before
+		p.EndingMRR += after
+		switch {
+		case before == 0 && after == 0:
+			continue
+		case before == 0:
+			p.NewMRR += after
+			p.NewCustomers++
+		case after == 0:
+			p.ChurnedMRR += before
+			p.ChurnedCustomers++
+		case after > before:
+			p.ExpansionMRR += after - before
+		case after < before:
+			p.ContractionMRR += before - after
+		}
+		if before > 0 {
+			p.StartingCustomers++
+		}
+		if after > 0 {
+			p.EndingCustomers++
+		}
+	}
+	p.NetNewMRR = p.NewMRR + p.ExpansionMRR - p.ContractionMRR - p.ChurnedMRR
+	if p.StartingCustomers > 0 {
+		p.CustomerChurnRate = round2(float64(p.ChurnedCustomers) / float64(p.StartingCustomers) * 100)
+	}
+	if p.StartingMRR > 0 {
+		p.RevenueChurnRate = round2((p.ChurnedMRR + p.ContractionMRR) / p.StartingMRR * 100)
+		p.NetRevenueRetention = round2((p.StartingMRR + p.ExpansionMRR - p.ContractionMRR - p.ChurnedMRR) / p.StartingMRR * 100)
+	}
+	if p.EndingCustomers > 0 {
+		p.ARPU = round2(p.EndingMRR / float64(p.EndingCustomers))
+	}
+	return p
+}
+
+// revenueCohorts bills each customer monthly from their first paid
+// subscription and reports revenue to date and LTV per cohort
+func revenueCohorts(byUser map[int64][]models.UserSubscription, asOf time.Time) []RevenueCohort {
+	cohorts := make(map[string]*RevenueCohort)
+	for _, subs := range byUser {
+		var first time.Time
+		for _, sub := range subs {
+			if !sub.CreatedAt.After(asOf) && SubscriptionMRR(sub) > 0 {
+				first = sub.CreatedAt
+				break
+			}
+		}
+		if first.IsZero() {
+			continue
+		}
+		key := first.UTC().Format("2006-01")
+		c, ok := cohorts[key]
+		if !ok {
+			c = &RevenueCohort{Cohort: key}
+			cohorts[key] = c
+		}
+		c.Customers++
+		if mrrAt(subs, asOf) > 0 {
+			c.ActiveCustomers++
+		}
+		for n := 0; ; n++ {
+			billedAt := first.AddDate(0, n, 0)
+			if billedAt.After(asOf) {
+				break
+			}
+			c.Revenue += mrrAt(subs, billedAt)
+		}
+	}
+
+	out := make([]RevenueCohort, 0, len(cohorts))
+	for _, c := range cohorts {
+		c.Revenue = round2(c.Revenue)
+		c.LTV = round2(c.Revenue / float64(c.Customers))
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Cohort < out[j].Cohort })
+	return out
+}
+
+func relativeChange(current, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	v := round2((current - previous) / previous * 100)
+	return &v
+}
+
+func pointChange(current, previous float64) *float64 {
+	v := round2(current - previous)
+	return &v
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,76 @@
+// Package analytics_test provides unit tests for analytics reporting
+package analytics_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/analytics"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sub(userID int64, tier models.SubscriptionTier, status models.SubscriptionStatus, at time.Time) models.UserSubscription {
+	return models.UserSubscription{UserID: userID, SubscriptionTier: tier, Status: status, CreatedAt: at}
+}
+
+func TestSubscriptionMRR(t *testing.T) {
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 99.0, analytics.SubscriptionMRR(sub(1, models.TierStarter, models.SubStatusActive, at)))
+	assert.Equal(t, 0.0, analytics.SubscriptionMRR(sub(1, models.TierStarter, models.SubStatusCancelled, at)))
+	assert.Equal(t, 0.0, analytics.SubscriptionMRR(sub(1, models.TierStarter, models.SubStatusTrial, at)))
+
+	custom := sub(1, models.TierEnterprise, models.SubStatusActive, at)
+	custom.MonthlyAmount = 2500
+	assert.Equal(t, 2500.0, analytics.SubscriptionMRR(custom))
+}
+
+func TestBuildRevenueReport(t *testing.T) {
+	jan := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	mid := start.AddDate(0, 0, 10)
+
+	history := []models.UserSubscription{
+		// Upgrades starter -> professional during the period
+		sub(1, models.TierStarter, models.SubStatusActive, jan),
+		sub(1, models.TierProfessional, models.SubStatusActive, mid),
+		// Cancels during the period
+		sub(2, models.TierStarter, models.SubStatusActive, jan),
+		sub(2, models.TierStarter, models.SubStatusCancelled, mid),
+		// New during the period
+		sub(3, models.TierGrowth, models.SubStatusActive, mid),
+		// Downgrades professional -> starter during the period
+		sub(4, models.TierProfessional, models.SubStatusActive, jan),
+		sub(4, models.TierStarter, models.SubStatusActive, mid),
+	}
+
+	report := analytics.BuildRevenueReport(history, start, end)
+	cur := report.Current
+
+	assert.Equal(t, 99.0+99+599, cur.StartingMRR)
+	assert.Equal(t, 599.0+1299+99, cur.EndingMRR)
+	assert.Equal(t, 1299.0, cur.NewMRR)
+	assert.Equal(t, 500.0, cur.ExpansionMRR)
+	assert.Equal(t, 500.0, cur.ContractionMRR)
+	assert.Equal(t, 99.0, cur.ChurnedMRR)
+	assert.Equal(t, 1299.0-99, cur.NetNewMRR)
+	assert.Equal(t, 3, cur.StartingCustomers)
+	assert.Equal(t, 3, cur.EndingCustomers)
+	assert.Equal(t, 1, cur.NewCustomers)
+	assert.Equal(t, 1, cur.ChurnedCustomers)
+	assert.Equal(t, 33.33, cur.CustomerChurnRate)
+
+	// Nothing changed in the previous period, so MRR grew by the net new amount
+	require.NotNil(t, report.Change["ending_mrr"])
+	assert.Equal(t, 0.0, report.Previous.ChurnedMRR)
+	assert.Nil(t, report.Change["churned_mrr"])
+
+	require.Len(t, report.Cohorts, 2)
+	assert.Equal(t, "2026-01", report.Cohorts[0].Cohort)
+	assert.Equal(t, 3, report.Cohorts[0].Customers)
+	assert.Equal(t, 2, report.Cohorts[0].ActiveCustomers)
+	assert.Equal(t, "2026-03", report.Cohorts[1].Cohort)
+	assert.Equal(t, 1299.0, report.Cohorts[1].LTV)
+}
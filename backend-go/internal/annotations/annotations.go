@@ -0,0 +1,273 @@
+// Package annotations validates schema annotations on dataset columns
+// against profiled data and applies them to generation: as column rules in
+// the prompt, and as checks that drop generated rows breaking them.
+package annotations
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/promptguard"
+)
+
+var (
+	ErrUnknownColumn  = errors.New("column is not in the dataset")
+	ErrInvalidRange   = errors.New("min_value is greater than max_value")
+	ErrNotNumeric     = errors.New("a value range needs a numeric column")
+	ErrOutOfRange     = errors.New("profiled values fall outside the range")
+	ErrNotUnique      = errors.New("profiled values contain duplicates")
+	ErrDescriptionLen = errors.New("description is too long")
+)
+
+// MaxDescriptionLength caps column descriptions, which are sent in prompts
+const MaxDescriptionLength = 500
+
+// Constraint keys set on agents.ColumnInfo.Constraints
+const (
+	ConstraintMin         = "min"
+	ConstraintMax         = "max"
+	ConstraintDescription = "description"
+)
+
+// Profile summarizes the profiled values of one column
+type Profile struct {
+	Name       string   `json:"name"`
+	Values     int      `json:"values"`
+	Nulls      int      `json:"nulls"`
+	Distinct   int      `json:"distinct"`
+	Duplicates int      `json:"duplicates"`
+	Numeric    bool     `json:"numeric"`
+	Min        *float64 `json:"min,omitempty"`
+	Max        *float64 `json:"max,omitempty"`
+}
+
+// ProfileColumns profiles sampled rows. A column is numeric when every
+// non-empty value parses as a number.
+func ProfileColumns(columns []string, rows []map[string]interface{}) []Profile {
+	out := make([]Profile, len(columns))
+	for i, col := range columns {
+		p := Profile{Name: col, Numeric: true}
+		seen := make(map[string]bool)
+		for _, row := range rows {
+			v, ok := row[col]
+			if !ok || v == nil || v == "" {
+				p.Nulls++
+				continue
+			}
+			p.Values++
+			key := fmt.Sprint(v)
+			if seen[key] {
+				p.Duplicates++
+			}
+			seen[key] = true
+			n, ok := number(v)
+			if !ok {
+				p.Numeric = false
+				continue
+			}
+			if p.Min == nil || n < *p.Min {
+				p.Min = &n
+			}
+			if p.Max == nil || n > *p.Max {
+				p.Max = &n
+			}
+		}
+		p.Distinct = len(seen)
+		if p.Values == 0 || !p.Numeric {
+			p.Numeric, p.Min, p.Max = false, nil, nil
+		}
+		out[i] = p
+	}
+	return out
+}
+
+// Validate checks an annotation on its own and, when profiles are given,
+// against the profiled data. Validation errors wrap the package errors.
+func Validate(a models.ColumnAnnotation, profiles []Profile) error {
+	if a.MinValue != nil && a.MaxValue != nil && *a.MinValue > *a.MaxValue {
+		return ErrInvalidRange
+	}
+	if a.Description != nil && len(*a.Description) > MaxDescriptionLength {
+		return fmt.Errorf("%w: at most %d characters", ErrDescriptionLen, MaxDescriptionLength)
+	}
+	// Descriptions are sent in prompts; ones that address the model fail
+	// with promptguard.ErrSuspiciousContent
+	if a.Description != nil {
+		if err := promptguard.Check(*a.Description); err != nil {
+			return err
+		}
+	}
+	if profiles == nil {
+		return nil
+	}
+	p, ok := find(profiles, a.ColumnName)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownColumn, strconv.Quote(a.ColumnName))
+	}
+	if a.MinValue != nil || a.MaxValue != nil {
+		if !p.Numeric {
+			return ErrNotNumeric
+		}
+		if (a.MinValue != nil && *p.Min < *a.MinValue) || (a.MaxValue != nil && *p.Max > *a.MaxValue) {
+			return fmt.Errorf("%w: profiled min %v, max %v", ErrOutOfRange, *p.Min, *p.Max)
+		}
+	}
+	if a.Unique && p.Duplicates > 0 {
+		return fmt.Errorf("%w: %d repeated values", ErrNotUnique, p.Duplicates)
+	}
+	return nil
+}
+
+func find(profiles []Profile, column string) (Profile, bool) {
+	for _, p := range profiles {
+		if strings.EqualFold(p.Name, column) {
+			return p, true
+		}
+	}
+	return Profile{}, false
+}
+
+// Sensitive returns the names of columns annotated as sensitive
+func Sensitive(anns []models.ColumnAnnotation) []string {
+	var out []string
+	for _, a := range anns {
+		if a.Sensitive {
+			out = append(out, a.ColumnName)
+		}
+	}
+	return out
+}
+
+// Apply adds annotations to a generation request: each becomes a column
+// in the schema analysis, whose constraints the output is checked
+// against, and a rule in the prompt. Descriptions of restricted columns
+// are left out of the prompt.
+func Apply(req *agents.GenerationRequest, anns []models.ColumnAnnotation) {
+	restricted := make(map[string]bool, len(req.RestrictedColumns))
+	for _, c := range req.RestrictedColumns {
+		restricted[strings.ToLower(c)] = true
+	}
+	for _, a := range anns {
+		col := agents.ColumnInfo{Name: a.ColumnName, IsUnique: a.Unique, Constraints: map[string]interface{}{}}
+		var rules []string
+		if a.Unique {
+			rules = append(rules, "values must be unique")
+		}
+		if a.MinValue != nil {
+			col.Constraints[ConstraintMin] = *a.MinValue
+			rules = append(rules, fmt.Sprintf("values must be >= %v", *a.MinValue))
+		}
+		if a.MaxValue != nil {
+			col.Constraints[ConstraintMax] = *a.MaxValue
+			rules = append(rules, fmt.Sprintf("values must be <= %v", *a.MaxValue))
+		}
+		if a.Description != nil && *a.Description != "" && !restricted[strings.ToLower(a.ColumnName)] {
+			col.Constraints[ConstraintDescription] = *a.Description
+			rules = append(rules, "description: "+*a.Description)
+		}
+		req.SchemaAnalysis.Columns = append(req.SchemaAnalysis.Columns, col)
+		if len(rules) > 0 {
+			req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints,
+				fmt.Sprintf("%s: %s", a.ColumnName, strings.Join(rules, "; ")))
+		}
+	}
+}
+
+// Enforcer drops generated rows that break the column constraints of a
+// request. Uniqueness holds across every batch passed to Filter.
+type Enforcer struct {
+	columns []agents.ColumnInfo
+	seen    map[string]map[string]bool
+	dropped map[string]int
+}
+
+// NewEnforcer returns nil when no column carries a constraint
+func NewEnforcer(columns []agents.ColumnInfo) *Enforcer {
+	e := &Enforcer{seen: make(map[string]map[string]bool), dropped: make(map[string]int)}
+	for _, col := range columns {
+		_, hasMin := col.Constraints[ConstraintMin]
+		_, hasMax := col.Constraints[ConstraintMax]
+		if col.IsUnique || hasMin || hasMax {
+			e.columns = append(e.columns, col)
+			if col.IsUnique {
+				e.seen[col.Name] = make(map[string]bool)
+			}
+		}
+	}
+	if len(e.columns) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Filter returns the rows that satisfy every constraint
+func (e *Enforcer) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if e == nil {
+		return rows
+	}
+	kept := rows[:0:0]
+	for _, row := range rows {
+		if col, ok := e.violation(row); ok {
+			e.dropped[col]++
+			continue
+		}
+		for _, col := range e.columns {
+			if col.IsUnique {
+				if v, ok := row[col.Name]; ok && v != nil {
+					e.seen[col.Name][fmt.Sprint(v)] = true
+				}
+			}
+		}
+		kept = append(kept, row)
+	}
+	return kept
+}
+
+func (e *Enforcer) violation(row map[string]interface{}) (string, bool) {
+	for _, col := range e.columns {
+		v, ok := row[col.Name]
+		if !ok || v == nil {
+			continue
+		}
+		if col.IsUnique && e.seen[col.Name][fmt.Sprint(v)] {
+			return col.Name, true
+		}
+		n, numeric := number(v)
+		if min, ok := col.Constraints[ConstraintMin].(float64); ok && (!numeric || n < min) {
+			return col.Name, true
+		}
+		if max, ok := col.Constraints[ConstraintMax].(float64); ok && (!numeric || n > max) {
+			return col.Name, true
+		}
+	}
+	return "", false
+}
+
+// Dropped returns how many rows each column's constraints dropped
+func (e *Enforcer) Dropped() map[string]int {
+	if e == nil {
+		return nil
+	}
+	return e.dropped
+}
+
+func number(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,440 @@
+// Package arrays supports columns holding lists of values, as tags or phone
+// numbers, whether as native JSON arrays, JSON text or delimited text. Such
+// columns are profiled for list lengths and element distributions, which
+// generated lists must follow and are reported against.
+package arrays
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Element types
+const (
+	TypeString = "string"
+	TypeNumber = "number"
+)
+
+const (
+	// MinShare is the share of a column's non-empty values that must be
+	// lists of scalars for it to be an array column
+	MinShare = 0.9
+	// MinDelimited is the share of a text column's non-empty values that
+	// must contain a delimiter for it to be a delimited list
+	MinDelimited = 0.5
+	// MaxElementLength is the longest mean element a delimited list may
+	// have; longer ones are prose rather than lists
+	MaxElementLength = 32
+	// MaxElements caps the element shares profiled per column; the rest
+	// are pooled as other
+	MaxElements = 50
+	// promptShares caps the lengths and elements named per column in a
+	// prompt
+	promptShares = 10
+)
+
+// Delimiters are the separators tried on text columns, in order. Commas are
+// left out: they are too common in free text.
+var Delimiters = []string{";", "|"}
+
+// ColumnProfile is the profile of one array column. Values counts its
+// non-empty values, Empty its blank ones and Distinct its distinct
+// elements.
+type ColumnProfile struct {
+	agents.ArrayColumn
+	Values   int64 `json:"values"`
+	Empty    int64 `json:"empty"`
+	Distinct int64 `json:"distinct"`
+}
+
+func blank(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+// encoding returns how a column's non-empty values hold lists, or false when
+// they mostly do not
+func encoding(col string, rows []map[string]interface{}) (agents.ArrayColumn, bool) {
+	var values, native, encoded int64
+	var texts []string
+	probe := agents.ArrayColumn{Encoding: agents.ArrayJSON}
+	for _, row := range rows {
+		v := row[col]
+		if blank(v) {
+			continue
+		}
+		values++
+		if s, ok := v.(string); ok {
+			texts = append(texts, s)
+		}
+		if _, ok := agents.SplitArray(v, probe); !ok {
+			continue
+		}
+		if _, ok := v.([]interface{}); ok {
+			native++
+		} else {
+			encoded++
+		}
+	}
+	switch {
+	case values == 0:
+		return agents.ArrayColumn{}, false
+	case float64(native+encoded) >= MinShare*float64(values):
+		if native > encoded {
+			return agents.ArrayColumn{Column: col, Encoding: agents.ArrayNative}, true
+		}
+		return agents.ArrayColumn{Column: col, Encoding: agents.ArrayJSON}, true
+	case int64(len(texts)) < values:
+		return agents.ArrayColumn{}, false
+	}
+	for _, d := range Delimiters {
+		var delimited, elements, chars int
+		for _, s := range texts {
+			if strings.Contains(s, d) {
+				delimited++
+			}
+			for _, part := range strings.Split(s, d) {
+				if part = strings.TrimSpace(part); part != "" {
+					elements++
+					chars += len(part)
+				}
+			}
+		}
+		if float64(delimited) >= MinDelimited*float64(len(texts)) && elements > 0 && chars <= MaxElementLength*elements {
+			return agents.ArrayColumn{Column: col, Encoding: agents.ArrayDelimited, Delimiter: d}, true
+		}
+	}
+	return agents.ArrayColumn{}, false
+}
+
+// Profile returns the array columns of sampled rows with their length and
+// element distributions. Blank values count as empty lists.
+func Profile(columns []string, rows []map[string]interface{}) []ColumnProfile {
+	var out []ColumnProfile
+	for _, col := range columns {
+		ac, ok := encoding(col, rows)
+		if !ok {
+			continue
+		}
+		p := ColumnProfile{ArrayColumn: ac}
+		lengths := make(map[int]int64)
+		counts := make(map[string]int64)
+		var lists, total int64
+		var nums []float64
+		unique, numeric := true, true
+		p.MinLength = -1
+		for _, row := range rows {
+			v := row[col]
+			if blank(v) {
+				p.Empty++
+			} else {
+				p.Values++
+			}
+			elements, ok := agents.SplitArray(v, ac)
+			if !ok {
+				continue
+			}
+			lists++
+			lengths[len(elements)]++
+			total += int64(len(elements))
+			if p.MinLength < 0 || len(elements) < p.MinLength {
+				p.MinLength = len(elements)
+			}
+			if len(elements) > p.MaxLength {
+				p.MaxLength = len(elements)
+			}
+			seen := make(map[string]bool, len(elements))
+			for _, e := range elements {
+				if seen[e] {
+					unique = false
+				}
+				seen[e] = true
+				counts[e]++
+				if n, err := strconv.ParseFloat(e, 64); err == nil {
+					nums = append(nums, n)
+				} else {
+					numeric = false
+				}
+			}
+		}
+		p.MeanLength = round(float64(total) / float64(lists))
+		p.Lengths = make(map[int]float64, len(lengths))
+		for l, c := range lengths {
+			p.Lengths[l] = round(float64(c) / float64(lists))
+		}
+		p.Distinct = int64(len(counts))
+		p.Unique = unique && p.MaxLength > 1
+		switch {
+		case total == 0:
+			p.ElementType = TypeString
+		case numeric:
+			p.ElementType = TypeNumber
+			mean, sd := meanStdDev(nums)
+			p.ElementMean, p.ElementStdDev = ptr(mean), ptr(sd)
+		default:
+			p.ElementType = TypeString
+			p.Elements, p.OtherShare = topShares(counts, total)
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// topShares returns the shares of the most frequent elements and the share
+// of the rest
+func topShares(counts map[string]int64, total int64) (map[string]float64, float64) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if counts[keys[a]] != counts[keys[b]] {
+			return counts[keys[a]] > counts[keys[b]]
+		}
+		return keys[a] < keys[b]
+	})
+	var other int64
+	if len(keys) > MaxElements {
+		for _, k := range keys[MaxElements:] {
+			other += counts[k]
+		}
+		keys = keys[:MaxElements]
+	}
+	shares := make(map[string]float64, len(keys))
+	for _, k := range keys {
+		shares[k] = round(float64(counts[k]) / float64(total))
+	}
+	return shares, round(float64(other) / float64(total))
+}
+
+func meanStdDev(x []float64) (float64, float64) {
+	sum := 0.0
+	for _, v := range x {
+		sum += v
+	}
+	mean := sum / float64(len(x))
+	variance := 0.0
+	for _, v := range x {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(x)))
+}
+
+// Columns turns profiles into the array columns of a generation request
+func Columns(profiles []ColumnProfile) []agents.ArrayColumn {
+	out := make([]agents.ArrayColumn, 0, len(profiles))
+	for _, p := range profiles {
+		out = append(out, p.ArrayColumn)
+	}
+	return out
+}
+
+// Apply adds array columns to a generation request, as targets for the
+// output and as rules in the prompt. Element shares quote source values, so
+// they are dropped when the job may not use real data or the column is
+// restricted; lengths and numeric statistics are kept.
+func Apply(req *agents.GenerationRequest, columns []agents.ArrayColumn) {
+	restricted := make(map[string]bool, len(req.RestrictedColumns))
+	for _, c := range req.RestrictedColumns {
+		restricted[strings.ToLower(c)] = true
+	}
+	for _, col := range columns {
+		if req.ZeroRealData || restricted[strings.ToLower(col.Column)] {
+			col.Elements, col.OtherShare = nil, 0
+		}
+		req.SchemaAnalysis.ArrayColumns = append(req.SchemaAnalysis.ArrayColumns, col)
+		req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints, promptText(col))
+	}
+}
+
+func promptText(col agents.ArrayColumn) string {
+	var form string
+	switch col.Encoding {
+	case agents.ArrayNative:
+		form = "a JSON array"
+	case agents.ArrayJSON:
+		form = "a JSON array written as text"
+	default:
+		form = fmt.Sprintf("text with elements joined by %q", col.Delimiter)
+	}
+	lengths := make(map[string]float64, len(col.Lengths))
+	for l, share := range col.Lengths {
+		lengths[strconv.Itoa(l)] = share
+	}
+	text := fmt.Sprintf("%s holds lists of %d to %d %s elements as %s; mean length %.2g, length shares %s",
+		col.Column, col.MinLength, col.MaxLength, col.ElementType, form, col.MeanLength, formatShares(lengths))
+	if col.Unique {
+		text += "; elements within a list are distinct"
+	}
+	switch {
+	case col.ElementMean != nil:
+		text += fmt.Sprintf("; element mean about %.4g", *col.ElementMean)
+		if col.ElementStdDev != nil {
+			text += fmt.Sprintf(", standard deviation about %.4g", *col.ElementStdDev)
+		}
+	case len(col.Elements) > 0:
+		text += "; element shares " + formatShares(col.Elements)
+	}
+	return text
+}
+
+func formatShares(shares map[string]float64) string {
+	keys := make([]string, 0, len(shares))
+	for k := range shares {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if shares[keys[a]] != shares[keys[b]] {
+			return shares[keys[a]] > shares[keys[b]]
+		}
+		return keys[a] < keys[b]
+	})
+	if len(keys) > promptShares {
+		keys = keys[:promptShares]
+	}
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s %.1f%%", k, shares[k]*100)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Tracker drops generated rows whose lists cannot be read or are longer
+// than any in the source, and follows the rest for Report. Lists it keeps
+// are written in the source's encoding, with repeated elements removed from
+// columns whose lists are distinct.
+type Tracker struct {
+	columns []agents.ArrayColumn
+	stats   []*agents.ArrayStats
+	dropped []int64
+}
+
+// NewTracker returns nil when there are no array columns
+func NewTracker(columns []agents.ArrayColumn) *Tracker {
+	if len(columns) == 0 {
+		return nil
+	}
+	t := &Tracker{columns: columns, dropped: make([]int64, len(columns))}
+	for _, col := range columns {
+		t.stats = append(t.stats, agents.NewArrayStats(col))
+	}
+	return t
+}
+
+// Filter returns the rows whose lists are all readable
+func (t *Tracker) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if t == nil {
+		return rows
+	}
+	kept := rows[:0:0]
+	for _, row := range rows {
+		lists := make([][]string, len(t.columns))
+		valid := true
+		for i, col := range t.columns {
+			elements, ok := agents.SplitArray(row[col.Column], col)
+			if ok && col.Unique {
+				elements = distinct(elements)
+			}
+			if ok && col.ElementType == TypeNumber {
+				for _, e := range elements {
+					if _, err := strconv.ParseFloat(e, 64); err != nil {
+						ok = false
+						break
+					}
+				}
+			}
+			if !ok || len(elements) > col.MaxLength {
+				t.dropped[i]++
+				valid = false
+				continue
+			}
+			lists[i] = elements
+		}
+		if !valid {
+			continue
+		}
+		for i, col := range t.columns {
+			t.stats[i].Add(lists[i])
+			if !blank(row[col.Column]) {
+				row[col.Column] = encode(col, lists[i])
+			}
+		}
+		kept = append(kept, row)
+	}
+	return kept
+}
+
+func distinct(elements []string) []string {
+	seen := make(map[string]bool, len(elements))
+	out := elements[:0:0]
+	for _, e := range elements {
+		if !seen[e] {
+			seen[e] = true
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// encode writes a list in a column's encoding
+func encode(col agents.ArrayColumn, elements []string) interface{} {
+	if col.Encoding == agents.ArrayDelimited {
+		return strings.Join(elements, col.Delimiter)
+	}
+	items := make([]interface{}, len(elements))
+	for i, e := range elements {
+		items[i] = e
+		if col.ElementType == TypeNumber {
+			items[i], _ = strconv.ParseFloat(e, 64)
+		}
+	}
+	if col.Encoding == agents.ArrayNative {
+		return items
+	}
+	b, _ := json.Marshal(items)
+	return string(b)
+}
+
+// Report compares the generated lists of each column with its profile
+func (t *Tracker) Report() []models.ArrayColumnReport {
+	if t == nil {
+		return nil
+	}
+	out := make([]models.ArrayColumnReport, len(t.columns))
+	for i, col := range t.columns {
+		s := t.stats[i]
+		r := models.ArrayColumnReport{
+			Column:           col.Column,
+			Lists:            s.Lists(),
+			MeanLength:       round(s.MeanLength()),
+			TargetMeanLength: col.MeanLength,
+			LengthFidelity:   round(s.LengthFidelity()),
+			Fidelity:         round(s.Fidelity()),
+			Dropped:          t.dropped[i],
+		}
+		if e := s.ElementFidelity(); e != nil {
+			r.ElementFidelity = ptr(*e)
+		}
+		out[i] = r
+	}
+	return out
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+func ptr(v float64) *float64 {
+	v = round(v)
+	return &v
+}
@@ -0,0 +1,89 @@
+// Package arrays_test provides unit tests for array columns
+package arrays_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/arrays"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func csvRows() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"id": "1", "tags": "red;blue", "scores": "[1,2,3]", "note": "fine"},
+		{"id": "2", "tags": "red", "scores": "[4]", "note": "ok; thanks"},
+		{"id": "3", "tags": "green;red", "scores": "[]", "note": "good"},
+		{"id": "4", "tags": "", "scores": "[2,2]", "note": "bad"},
+	}
+}
+
+func TestProfile(t *testing.T) {
+	profiles := arrays.Profile([]string{"id", "tags", "scores", "note"}, csvRows())
+	require.Len(t, profiles, 2)
+
+	tags := profiles[0]
+	assert.Equal(t, "tags", tags.Column)
+	assert.Equal(t, agents.ArrayDelimited, tags.Encoding)
+	assert.Equal(t, ";", tags.Delimiter)
+	assert.Equal(t, arrays.TypeString, tags.ElementType)
+	assert.Equal(t, int64(3), tags.Values)
+	assert.Equal(t, int64(1), tags.Empty)
+	assert.Equal(t, int64(3), tags.Distinct)
+	assert.Equal(t, 0, tags.MinLength, "blank values are empty lists")
+	assert.Equal(t, 2, tags.MaxLength)
+	assert.Equal(t, 1.25, tags.MeanLength)
+	assert.Equal(t, map[int]float64{0: 0.25, 1: 0.25, 2: 0.5}, tags.Lengths)
+	assert.Equal(t, 0.6, tags.Elements["red"])
+	assert.True(t, tags.Unique)
+
+	scores := profiles[1]
+	assert.Equal(t, agents.ArrayJSON, scores.Encoding)
+	assert.Equal(t, arrays.TypeNumber, scores.ElementType)
+	assert.Nil(t, scores.Elements)
+	require.NotNil(t, scores.ElementMean)
+	assert.Equal(t, 2.3333, *scores.ElementMean)
+	assert.False(t, scores.Unique)
+}
+
+func TestApplyDropsElementsWithoutRealData(t *testing.T) {
+	cols := arrays.Columns(arrays.Profile([]string{"tags"}, csvRows()))
+	req := &agents.GenerationRequest{ZeroRealData: true}
+	arrays.Apply(req, cols)
+	require.Len(t, req.SchemaAnalysis.ArrayColumns, 1)
+	assert.Nil(t, req.SchemaAnalysis.ArrayColumns[0].Elements)
+	assert.NotContains(t, req.SchemaAnalysis.Constraints[0], "red")
+	assert.NotNil(t, cols[0].Elements, "the caller's profile is left alone")
+
+	req = &agents.GenerationRequest{}
+	arrays.Apply(req, cols)
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], `joined by ";"`)
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "red 60.0%")
+}
+
+func TestTracker(t *testing.T) {
+	cols := arrays.Columns(arrays.Profile([]string{"tags", "scores"}, csvRows()))
+	tr := arrays.NewTracker(cols)
+	kept := tr.Filter([]map[string]interface{}{
+		{"tags": []interface{}{"red", "blue", "red"}, "scores": []interface{}{1.0, 2.0}},
+		{"tags": "green", "scores": "[3]"},
+		{"tags": "red;blue;green", "scores": "[1]"},
+		{"tags": "red", "scores": `["x"]`},
+		{"tags": "", "scores": "7"},
+	})
+	require.Len(t, kept, 2)
+	assert.Equal(t, "red;blue", kept[0]["tags"], "lists are written in the source encoding")
+	assert.Equal(t, "[1,2]", kept[0]["scores"])
+
+	report := tr.Report()
+	require.Len(t, report, 2)
+	assert.Equal(t, int64(2), report[0].Lists)
+	assert.Equal(t, 1.5, report[0].MeanLength)
+	assert.Equal(t, int64(1), report[0].Dropped)
+	assert.Equal(t, 0.75, report[0].LengthFidelity)
+	require.NotNil(t, report[0].ElementFidelity)
+	assert.Equal(t, int64(2), report[1].Dropped)
+
+	assert.Nil(t, arrays.NewTracker(nil).Report())
+}
@@ -0,0 +1,163 @@
+// Package artifacts lists the objects a generation job produced: its data
+// files, stored encrypted, and the reports and manifests kept with the
+// job, each with its size and SHA-256 checksum, so automated consumers can
+// verify what they fetch before loading it.
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/evalreport"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Names of the documents kept with a job
+const (
+	QualityReport      = "quality-report.json"
+	ProvenanceManifest = "provenance-manifest.json"
+	DeltaManifest      = "delta-manifest.json"
+	// EvaluationReport is the stored evaluation report, named with the
+	// extension of its format
+	EvaluationReport = "evaluation-report"
+)
+
+// Document is a report or manifest of a job, as served byte for byte
+type Document struct {
+	Name    string
+	Kind    string
+	Content []byte
+}
+
+// Documents returns the reports and manifests of a job. Their content is
+// the JSON encoding of what the job recorded, so it is the same on every
+// read.
+func Documents(job *models.GenerationJob) ([]Document, error) {
+	q := job.QualityDetails
+	if q == nil {
+		return nil, nil
+	}
+	var out []Document
+	add := func(name, kind string, v any) error {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		out = append(out, Document{Name: name, Kind: kind, Content: raw})
+		return nil
+	}
+	// The quality report leaves out the stored objects and the manifests,
+	// which are listed on their own
+	report := *q
+	report.Output, report.Exports, report.Reports, report.Provenance, report.Delta = nil, nil, nil, nil, nil
+	report.Delivery = nil
+	if raw, _ := json.Marshal(report); string(raw) != "{}" {
+		if err := add(QualityReport, models.ArtifactReport, report); err != nil {
+			return nil, err
+		}
+	}
+	if q.Provenance != nil {
+		if err := add(ProvenanceManifest, models.ArtifactManifest, q.Provenance); err != nil {
+			return nil, err
+		}
+	}
+	if q.Delta != nil {
+		if err := add(DeltaManifest, models.ArtifactManifest, q.Delta); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Find returns the document of a job by name
+func Find(job *models.GenerationJob, name string) (Document, bool, error) {
+	docs, err := Documents(job)
+	if err != nil {
+		return Document{}, false, err
+	}
+	for _, d := range docs {
+		if d.Name == name {
+			return d, true, nil
+		}
+	}
+	return Document{}, false, nil
+}
+
+// Manifest lists the artifacts of a completed job: its main output, each
+// stored export, its evaluation reports and its documents. Outputs stored before checksums were
+// recorded are listed without them. Links are left to the caller.
+func Manifest(job *models.GenerationJob) ([]models.JobArtifact, error) {
+	out := []models.JobArtifact{}
+	var stored []models.JobExport
+	if q := job.QualityDetails; q != nil && q.Output != nil {
+		stored = append(stored, *q.Output)
+	} else if job.OutputKey != nil {
+		stored = append(stored, models.JobExport{Status: models.ExportCompleted, ObjectKey: *job.OutputKey})
+	}
+	if len(stored) > 0 && stored[0].Format == "" {
+		stored[0].Format = export.JSON
+		if job.OutputFormat != nil && *job.OutputFormat != "" {
+			stored[0].Format = *job.OutputFormat
+		}
+	}
+	if job.QualityDetails != nil {
+		stored = append(stored, job.QualityDetails.Exports...)
+	}
+	for _, e := range stored {
+		if e.Status != models.ExportCompleted {
+			continue
+		}
+		out = append(out, models.JobArtifact{
+			Name:         fmt.Sprintf("job-%d.%s", job.ID, export.Extension(e.Format)),
+			Kind:         models.ArtifactData,
+			Format:       e.Format,
+			ContentType:  export.ContentType(e.Format),
+			Bytes:        e.Bytes,
+			SHA256:       e.SHA256,
+			ObjectSHA256: e.ObjectSHA256,
+			Encrypted:    true,
+			ObjectKey:    e.ObjectKey,
+		})
+	}
+	if job.QualityDetails != nil {
+		for _, r := range job.QualityDetails.Reports {
+			if r.Status != models.ExportCompleted {
+				continue
+			}
+			out = append(out, models.JobArtifact{
+				Name:         EvaluationReport + "." + r.Format,
+				Kind:         models.ArtifactReport,
+				Format:       r.Format,
+				ContentType:  evalreport.ContentType(r.Format),
+				Bytes:        r.Bytes,
+				SHA256:       r.SHA256,
+				ObjectSHA256: r.ObjectSHA256,
+				ObjectKey:    r.ObjectKey,
+			})
+		}
+	}
+	docs, err := Documents(job)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range docs {
+		out = append(out, models.JobArtifact{
+			Name:        d.Name,
+			Kind:        d.Kind,
+			Format:      export.JSON,
+			ContentType: export.ContentType(export.JSON),
+			Bytes:       int64(len(d.Content)),
+			SHA256:      Checksum(d.Content),
+		})
+	}
+	return out, nil
+}
+
+// Checksum is the hex SHA-256 of b
+func Checksum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,73 @@
+// Package artifacts_test provides unit tests for job artifact manifests
+package artifacts_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/artifacts"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	format, key := "csv", "outputs/3/9.enc"
+	job := &models.GenerationJob{ID: 9, OutputKey: &key, OutputFormat: &format, QualityDetails: &models.QualityDetails{
+		Output: &models.JobExport{Format: "csv", Status: models.ExportCompleted, ObjectKey: key, Bytes: 12, SHA256: "aa", ObjectSHA256: "bb"},
+		Exports: []models.JobExport{
+			{Format: "sql", Status: models.ExportCompleted, ObjectKey: "outputs/3/9.sql.enc", Bytes: 40, SHA256: "cc"},
+			{Format: "xlsx", Status: models.ExportFailed, Error: "too large"},
+		},
+		Reports:    []models.JobExport{{Format: "pdf", Status: models.ExportCompleted, ObjectKey: "outputs/3/9.report.pdf", Bytes: 900, SHA256: "dd"}},
+		Watermark:  &models.WatermarkReport{Scheme: "parity-v1", Columns: []string{"amount"}, Cells: 10},
+		Provenance: &models.ProvenanceManifest{JobID: 9, Mode: "manifest", Rows: 2},
+	}}
+	list, err := artifacts.Manifest(job)
+	require.NoError(t, err)
+	require.Len(t, list, 5, "failed exports are not listed")
+
+	assert.Equal(t, "job-9.csv", list[0].Name)
+	assert.Equal(t, models.ArtifactData, list[0].Kind)
+	assert.Equal(t, "text/csv", list[0].ContentType)
+	assert.Equal(t, "aa", list[0].SHA256)
+	assert.Equal(t, key, list[0].ObjectKey)
+	assert.True(t, list[0].Encrypted)
+	assert.Equal(t, "job-9.sql", list[1].Name)
+
+	assert.Equal(t, "evaluation-report.pdf", list[2].Name)
+	assert.Equal(t, models.ArtifactReport, list[2].Kind)
+	assert.Equal(t, "application/pdf", list[2].ContentType)
+	assert.False(t, list[2].Encrypted)
+	list = list[1:]
+	assert.Equal(t, artifacts.QualityReport, list[2].Name)
+	assert.Equal(t, models.ArtifactReport, list[2].Kind)
+	assert.Equal(t, artifacts.ProvenanceManifest, list[3].Name)
+	assert.Equal(t, models.ArtifactManifest, list[3].Kind)
+
+	// Documents are served as checksummed
+	doc, ok, err := artifacts.Find(job, artifacts.QualityReport)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, list[2].SHA256, artifacts.Checksum(doc.Content))
+	assert.Equal(t, list[2].Bytes, int64(len(doc.Content)))
+	var report map[string]any
+	require.NoError(t, json.Unmarshal(doc.Content, &report))
+	assert.Contains(t, report, "watermark")
+	assert.NotContains(t, report, "exports", "stored objects are listed on their own")
+	assert.NotContains(t, report, "reports")
+	assert.NotContains(t, report, "provenance")
+
+	_, ok, err = artifacts.Find(job, artifacts.DeltaManifest)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestManifestWithoutChecksums(t *testing.T) {
+	key := "outputs/3/4.enc"
+	list, err := artifacts.Manifest(&models.GenerationJob{ID: 4, OutputKey: &key})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, "job-4.json", list[0].Name)
+	assert.Empty(t, list[0].SHA256, "outputs stored before checksums have none")
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
 )
 
 // AuditLevel represents the severity level of an audit event
@@ -25,6 +27,7 @@ type AuditEvent struct {
 	Category   string                 `json:"category"`
 	Action     string                 `json:"action"`
 	UserID     string                 `json:"user_id,omitempty"`
+	OrgID      int64                  `json:"org_id,omitempty"`
 	SessionID  string                 `json:"session_id,omitempty"`
 	IPAddress  string                 `json:"ip_address,omitempty"`
 	UserAgent  string                 `json:"user_agent,omitempty"`
@@ -50,9 +53,10 @@ type ComplianceInfo struct {
 
 // AuditService handles audit logging and compliance
 type AuditService struct {
-	events    []AuditEvent
-	retention time.Duration
-	encrypted bool
+	events     []AuditEvent
+	retention  time.Duration
+	encrypted  bool
+	anonymizer *privacy.Anonymizer
 }
 
 // NewAuditService creates a new audit service
@@ -82,6 +86,13 @@ func (as *AuditService) LogEvent(ctx context.Context, event AuditEvent) error {
 		return fmt.Errorf("category and action are required")
 	}
 
+	// Anonymize client identifiers at write time when the org policy requires it
+	if as.anonymizer != nil {
+		if policy := as.anonymizer.PolicyFor(ctx, event.OrgID); privacy.Immediate(policy) {
+			event.IPAddress, event.UserAgent = as.anonymizer.Apply(policy, event.IPAddress, event.UserAgent)
+		}
+	}
+
 	// Add to events
 	as.events = append(as.events, event)
 
@@ -91,6 +102,34 @@ func (as *AuditService) LogEvent(ctx context.Context, event AuditEvent) error {
 	return nil
 }
 
+// SetAnonymizer enables IP address and user agent anonymization for audit events
+func (as *AuditService) SetAnonymizer(anonymizer *privacy.Anonymizer) {
+	as.anonymizer = anonymizer
+}
+
+// AnonymizeExpired anonymizes client identifiers of events whose anonymization
+// period has elapsed and returns the number of events updated
+func (as *AuditService) AnonymizeExpired(ctx context.Context, now time.Time) int {
+	if as.anonymizer == nil {
+		return 0
+	}
+
+	updated := 0
+	for i := range as.events {
+		event := &as.events[i]
+		policy := as.anonymizer.PolicyFor(ctx, event.OrgID)
+		if !privacy.Due(policy, event.Timestamp, now) {
+			continue
+		}
+		ip, ua := as.anonymizer.Apply(policy, event.IPAddress, event.UserAgent)
+		if ip != event.IPAddress || ua != event.UserAgent {
+			event.IPAddress, event.UserAgent = ip, ua
+			updated++
+		}
+	}
+	return updated
+}
+
 // LogUserAction logs a user action
 func (as *AuditService) LogUserAction(ctx context.Context, userID, action, resource string, details map[string]interface{}) error {
 	event := AuditEvent{
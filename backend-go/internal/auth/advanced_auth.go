@@ -20,6 +20,8 @@ import (
 type AdvancedAuthService struct {
 	redisClient *redis.Client
 	blacklist   *Blacklist
+	// keys signs email verification and password reset tokens
+	keys *KeyRing
 	// Advanced security features
 	rateLimiter    *RateLimiter
 	securityEngine *SecurityEngine
@@ -102,7 +104,7 @@ type APIKeyRequest struct {
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
-func NewAdvancedAuthService(redisClient *redis.Client, blacklist *Blacklist) *AdvancedAuthService {
+func NewAdvancedAuthService(redisClient *redis.Client, blacklist *Blacklist, keys *KeyRing) *AdvancedAuthService {
 	// Validate required dependencies
 	if redisClient == nil {
 		panic("redisClient cannot be nil")
@@ -110,11 +112,15 @@ func NewAdvancedAuthService(redisClient *redis.Client, blacklist *Blacklist) *Ad
 	if blacklist == nil {
 		panic("blacklist cannot be nil")
 	}
+	if keys == nil {
+		panic("keys cannot be nil")
+	}
 
 	return &AdvancedAuthService{
 		redisClient: redisClient,
 		blacklist:   blacklist,
-		rateLimiter: &RateLimiter{redisClient: redisClient},
+		keys:        keys,
+		rateLimiter: NewRateLimiter(redisClient),
 		securityEngine: &SecurityEngine{
 			redisClient: redisClient,
 			blacklist:   blacklist,
@@ -125,72 +131,54 @@ func NewAdvancedAuthService(redisClient *redis.Client, blacklist *Blacklist) *Ad
 
 // GenerateEmailVerificationToken creates a secure token for email verification
 func (a *AdvancedAuthService) GenerateEmailVerificationToken(email string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	return a.keys.Sign(jwt.MapClaims{
 		"email": email,
 		"type":  string(TokenTypeEmailVerification),
 		"exp":   time.Now().Add(24 * time.Hour).Unix(),
 		"iat":   time.Now().Unix(),
 	})
-
-	return token.SignedString([]byte("email_verification_secret")) // Use proper secret from config
 }
 
 // VerifyEmailVerificationToken validates email verification token
 func (a *AdvancedAuthService) VerifyEmailVerificationToken(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte("email_verification_secret"), nil
-	})
-
+	claims, err := a.keys.Parse(tokenString)
 	if err != nil {
 		return "", err
 	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if claims["type"] != string(TokenTypeEmailVerification) {
-			return "", fmt.Errorf("invalid token type")
-		}
-		return claims["email"].(string), nil
+	if claims["type"] != string(TokenTypeEmailVerification) {
+		return "", fmt.Errorf("invalid token type")
 	}
-
-	return "", fmt.Errorf("invalid token")
+	email, ok := claims["email"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid token")
+	}
+	return email, nil
 }
 
 // GeneratePasswordResetToken creates a secure token for password reset
 func (a *AdvancedAuthService) GeneratePasswordResetToken(email string) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	return a.keys.Sign(jwt.MapClaims{
 		"email": email,
 		"type":  string(TokenTypePasswordReset),
 		"exp":   time.Now().Add(1 * time.Hour).Unix(),
 		"iat":   time.Now().Unix(),
 	})
-
-	return token.SignedString([]byte("password_reset_secret")) // Use proper secret from config
 }
 
 // VerifyPasswordResetToken validates password reset token
 func (a *AdvancedAuthService) VerifyPasswordResetToken(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte("password_reset_secret"), nil
-	})
-
+	claims, err := a.keys.Parse(tokenString)
 	if err != nil {
 		return "", err
 	}
-
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if claims["type"] != string(TokenTypePasswordReset) {
-			return "", fmt.Errorf("invalid token type")
-		}
-		return claims["email"].(string), nil
+	if claims["type"] != string(TokenTypePasswordReset) {
+		return "", fmt.Errorf("invalid token type")
 	}
-
-	return "", fmt.Errorf("invalid token")
+	email, ok := claims["email"].(string)
+	if !ok {
+		return "", fmt.Errorf("invalid token")
+	}
+	return email, nil
 }
 
 // GenerateAPIKey creates a secure API key
@@ -495,30 +483,14 @@ func (a *AdvancedAuthService) GetSecurityMetrics(userID string) (*SecurityMetric
 
 // Enhanced rate limiting with sliding window
 func (a *AdvancedAuthService) CheckRateLimitAdvanced(identifier string, limit int, window time.Duration) (bool, error) {
-	ctx := context.Background()
-	key := fmt.Sprintf("rate_limit_advanced:%s", identifier)
-
-	now := time.Now()
-	windowStart := now.Add(-window)
-
-	// Remove old entries
-	a.redisClient.ZRemRangeByScore(ctx, key, "0", fmt.Sprintf("%d", windowStart.Unix()))
-
-	// Count current entries
-	count, err := a.redisClient.ZCard(ctx, key).Result()
-	if err != nil {
-		return false, err
-	}
-
-	if count >= int64(limit) {
-		return false, nil
-	}
+	res, err := a.rateLimiter.Allow(context.Background(), identifier, limit, window)
+	return res.Allowed, err
+}
 
-	// Add current request
-	return true, a.redisClient.ZAdd(ctx, key, redis.Z{
-		Score:  float64(now.Unix()),
-		Member: fmt.Sprintf("%d", now.UnixNano()),
-	}).Err()
+// RateLimiter returns the sliding window limiter behind
+// CheckRateLimitAdvanced
+func (a *AdvancedAuthService) RateLimiter() *RateLimiter {
+	return a.rateLimiter
 }
 
 // Helper function
@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// APIKeyPrefixLen is the number of leading key characters used to group
+// failures; long enough to separate keys, far too short to help a guesser.
+// Prefixes are only counted and flagged, never throttled: anyone who knows
+// a key's prefix could otherwise lock its owner out.
+const APIKeyPrefixLen = 8
+
+// APIKeyGuardConfig tunes brute-force protection for API key authentication
+type APIKeyGuardConfig struct {
+	// Window is how long failure counters live after the last failure
+	Window time.Duration
+	// BackoffAfter is the number of failures tolerated before backoff starts
+	BackoffAfter int64
+	// BaseBackoff doubles with every failure past BackoffAfter
+	BaseBackoff time.Duration
+	// MaxBackoff caps the exponential backoff
+	MaxBackoff time.Duration
+	// BanAfter is the number of failures in the window that triggers a temporary ban
+	BanAfter int64
+	// BanDuration is how long a ban lasts
+	BanDuration time.Duration
+	// SustainedAfter is the failure count that marks an IP as key guessing,
+	// or a prefix as targeted from any number of IPs
+	SustainedAfter int64
+	// DistinctPrefixesAfter is the number of distinct prefixes tried from one
+	// IP that marks it as enumerating keys
+	DistinctPrefixesAfter int64
+}
+
+// DefaultAPIKeyGuardConfig returns conservative defaults
+func DefaultAPIKeyGuardConfig() APIKeyGuardConfig {
+	return APIKeyGuardConfig{
+		Window:                time.Hour,
+		BackoffAfter:          3,
+		BaseBackoff:           time.Second,
+		MaxBackoff:            5 * time.Minute,
+		BanAfter:              30,
+		BanDuration:           time.Hour,
+		SustainedAfter:        10,
+		DistinctPrefixesAfter: 5,
+	}
+}
+
+// APIKeyFailure describes the state after a failed API key attempt
+type APIKeyFailure struct {
+	IPFailures       int64
+	PrefixFailures   int64
+	DistinctPrefixes int64
+	Backoff          time.Duration
+	Banned           bool
+	// Sustained is set once when an IP crosses a key-guessing threshold
+	Sustained bool
+	// Targeted is set once when failures for the prefix, from any IPs,
+	// cross SustainedAfter
+	Targeted bool
+}
+
+// APIKeyGuard throttles failed API key lookups per client IP and flags key
+// prefixes that are being guessed
+type APIKeyGuard struct {
+	redisClient *redis.Client
+	cfg         APIKeyGuardConfig
+}
+
+// NewAPIKeyGuard creates a guard backed by Redis
+func NewAPIKeyGuard(redisClient *redis.Client, cfg APIKeyGuardConfig) *APIKeyGuard {
+	return &APIKeyGuard{redisClient: redisClient, cfg: cfg}
+}
+
+// KeyPrefix returns the prefix used to group failures for a presented key
+func KeyPrefix(apiKey string) string {
+	if len(apiKey) <= APIKeyPrefixLen {
+		return apiKey
+	}
+	return apiKey[:APIKeyPrefixLen]
+}
+
+// HashAPIKey returns the storage hash of an API key
+func HashAPIKey(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAPIKey compares a presented key with a stored hash in constant time
+func VerifyAPIKey(apiKey, storedHash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(apiKey)), []byte(storedHash)) == 1
+}
+
+// Check returns how long a client IP must wait before another attempt is
+// allowed. A zero duration means the attempt may proceed.
+func (g *APIKeyGuard) Check(ctx context.Context, ipAddress string) (time.Duration, error) {
+	keys := []string{g.banKey("ip", ipAddress), g.backoffKey("ip", ipAddress)}
+
+	pipe := g.redisClient.Pipeline()
+	ttls := make([]*redis.DurationCmd, len(keys))
+	for i, k := range keys {
+		ttls[i] = pipe.PTTL(ctx, k)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("failed to check API key throttling: %w", err)
+	}
+
+	var wait time.Duration
+	for _, cmd := range ttls {
+		if ttl := cmd.Val(); ttl > wait {
+			wait = ttl
+		}
+	}
+	return wait, nil
+}
+
+// RecordFailure counts a failed attempt and applies backoff or a ban to the
+// IP; the prefix is only counted, and flagged once it is targeted
+func (g *APIKeyGuard) RecordFailure(ctx context.Context, ipAddress, prefix string) (*APIKeyFailure, error) {
+	ipKey := g.failureKey("ip", ipAddress)
+	prefixKey := g.failureKey("prefix", prefix)
+	prefixesKey := "apikey_prefixes:ip:" + ipAddress
+
+	pipe := g.redisClient.TxPipeline()
+	ipCount := pipe.Incr(ctx, ipKey)
+	pipe.Expire(ctx, ipKey, g.cfg.Window)
+	prefixCount := pipe.Incr(ctx, prefixKey)
+	pipe.Expire(ctx, prefixKey, g.cfg.Window)
+	pipe.SAdd(ctx, prefixesKey, prefix)
+	pipe.Expire(ctx, prefixesKey, g.cfg.Window)
+	distinct := pipe.SCard(ctx, prefixesKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to record API key failure: %w", err)
+	}
+
+	result := &APIKeyFailure{
+		IPFailures:       ipCount.Val(),
+		PrefixFailures:   prefixCount.Val(),
+		DistinctPrefixes: distinct.Val(),
+	}
+
+	pipe = g.redisClient.Pipeline()
+	if result.IPFailures >= g.cfg.BanAfter {
+		result.Banned = true
+		pipe.Set(ctx, g.banKey("ip", ipAddress), "banned", g.cfg.BanDuration)
+	} else if result.IPFailures > g.cfg.BackoffAfter {
+		result.Backoff = g.backoff(result.IPFailures)
+		pipe.Set(ctx, g.backoffKey("ip", ipAddress), "1", result.Backoff)
+	}
+
+	// Flag sustained guessing once per window so events are not raised per request
+	var sustained, targeted *redis.BoolCmd
+	if result.IPFailures >= g.cfg.SustainedAfter || result.DistinctPrefixes >= g.cfg.DistinctPrefixesAfter {
+		sustained = pipe.SetNX(ctx, "apikey_guessing:ip:"+ipAddress, "1", g.cfg.Window)
+	}
+	if result.PrefixFailures >= g.cfg.SustainedAfter {
+		targeted = pipe.SetNX(ctx, "apikey_guessing:prefix:"+prefix, "1", g.cfg.Window)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return result, fmt.Errorf("failed to apply API key backoff: %w", err)
+	}
+	result.Sustained = sustained != nil && sustained.Val()
+	result.Targeted = targeted != nil && targeted.Val()
+	return result, nil
+}
+
+// RecordSuccess clears the prefix counter for a key that authenticated.
+// Per-IP counters are kept so a valid key cannot launder a guessing IP.
+func (g *APIKeyGuard) RecordSuccess(ctx context.Context, prefix string) error {
+	return g.redisClient.Del(ctx, g.failureKey("prefix", prefix)).Err()
+}
+
+func (g *APIKeyGuard) backoff(failures int64) time.Duration {
+	exp := float64(failures - g.cfg.BackoffAfter - 1)
+	d := time.Duration(float64(g.cfg.BaseBackoff) * math.Pow(2, exp))
+	if d > g.cfg.MaxBackoff || d <= 0 {
+		return g.cfg.MaxBackoff
+	}
+	return d
+}
+
+func (g *APIKeyGuard) failureKey(scope, id string) string {
+	return fmt.Sprintf("apikey_failures:%s:%s", scope, id)
+}
+
+func (g *APIKeyGuard) backoffKey(scope, id string) string {
+	return fmt.Sprintf("apikey_backoff:%s:%s", scope, id)
+}
+
+func (g *APIKeyGuard) banKey(scope, id string) string {
+	return fmt.Sprintf("apikey_ban:%s:%s", scope, id)
+}
@@ -0,0 +1,161 @@
+// Package auth_test provides unit tests for API key brute-force protection
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newGuard(t *testing.T, cfg auth.APIKeyGuardConfig) (*auth.APIKeyGuard, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return auth.NewAPIKeyGuard(client, cfg), mr
+}
+
+func guardConfig() auth.APIKeyGuardConfig {
+	return auth.APIKeyGuardConfig{
+		Window:                time.Hour,
+		BackoffAfter:          3,
+		BaseBackoff:           time.Second,
+		MaxBackoff:            10 * time.Second,
+		BanAfter:              10,
+		BanDuration:           time.Hour,
+		SustainedAfter:        100,
+		DistinctPrefixesAfter: 100,
+	}
+}
+
+func TestAPIKeyGuardBackoffGrowsToCap(t *testing.T) {
+	guard, _ := newGuard(t, guardConfig())
+	ctx := context.Background()
+
+	var backoffs []time.Duration
+	for i := 0; i < 9; i++ {
+		f, err := guard.RecordFailure(ctx, "203.0.113.7", "sk_abcde")
+		require.NoError(t, err)
+		assert.False(t, f.Banned)
+		backoffs = append(backoffs, f.Backoff)
+	}
+	assert.Equal(t, []time.Duration{
+		0, 0, 0, // tolerated
+		time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second,
+		10 * time.Second, 10 * time.Second, // capped
+	}, backoffs)
+
+	wait, err := guard.Check(ctx, "203.0.113.7")
+	require.NoError(t, err)
+	assert.InDelta(t, float64(10*time.Second), float64(wait), float64(time.Second))
+}
+
+func TestAPIKeyGuardBansAtThreshold(t *testing.T) {
+	guard, mr := newGuard(t, guardConfig())
+	ctx := context.Background()
+
+	for i := 1; i < 10; i++ {
+		f, err := guard.RecordFailure(ctx, "203.0.113.7", "sk_abcde")
+		require.NoError(t, err)
+		require.False(t, f.Banned, "failure %d is below the threshold", i)
+	}
+	f, err := guard.RecordFailure(ctx, "203.0.113.7", "sk_abcde")
+	require.NoError(t, err)
+	assert.True(t, f.Banned, "the tenth failure bans")
+	assert.Equal(t, int64(10), f.IPFailures)
+	assert.Zero(t, f.Backoff)
+	assert.True(t, mr.Exists("apikey_ban:ip:203.0.113.7"))
+	assert.False(t, mr.Exists("apikey_ban:prefix:sk_abcde"), "prefixes are never banned")
+
+	wait, err := guard.Check(ctx, "203.0.113.7")
+	require.NoError(t, err)
+	assert.InDelta(t, float64(time.Hour), float64(wait), float64(time.Second), "a banned IP waits out the ban with any key")
+
+	mr.FastForward(time.Hour)
+	wait, err = guard.Check(ctx, "203.0.113.7")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestAPIKeyGuardSuccessClearsPrefix(t *testing.T) {
+	guard, mr := newGuard(t, guardConfig())
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		_, err := guard.RecordFailure(ctx, "203.0.113.7", "sk_abcde")
+		require.NoError(t, err)
+	}
+	require.NoError(t, guard.RecordSuccess(ctx, "sk_abcde"))
+	assert.False(t, mr.Exists("apikey_failures:prefix:sk_abcde"))
+	assert.True(t, mr.Exists("apikey_failures:ip:203.0.113.7"), "the IP's failures are kept")
+
+	f, err := guard.RecordFailure(ctx, "198.51.100.4", "sk_abcde")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), f.PrefixFailures, "the prefix counts from zero again")
+	assert.Zero(t, f.Backoff)
+
+	wait, err := guard.Check(ctx, "198.51.100.4")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestAPIKeyGuardNeverLocksOutAPrefix(t *testing.T) {
+	guard, mr := newGuard(t, guardConfig())
+	ctx := context.Background()
+
+	// Someone who knows the prefix of a key fails with it until banned
+	for i := 0; i < 10; i++ {
+		_, err := guard.RecordFailure(ctx, "203.0.113.7", "sk_abcde")
+		require.NoError(t, err)
+	}
+	wait, err := guard.Check(ctx, "203.0.113.7")
+	require.NoError(t, err)
+	assert.Positive(t, wait)
+
+	// The key's owner, elsewhere, is not held back
+	wait, err = guard.Check(ctx, "198.51.100.4")
+	require.NoError(t, err)
+	assert.Zero(t, wait)
+	assert.False(t, mr.Exists("apikey_backoff:prefix:sk_abcde"))
+	assert.False(t, mr.Exists("apikey_ban:prefix:sk_abcde"))
+}
+
+func TestAPIKeyGuardFlagsTargetedPrefixOnce(t *testing.T) {
+	cfg := guardConfig()
+	cfg.SustainedAfter = 3
+	guard, _ := newGuard(t, cfg)
+	ctx := context.Background()
+
+	// One prefix guessed from many IPs, none of them throttled
+	var targeted, sustained []bool
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3", "203.0.113.4"} {
+		f, err := guard.RecordFailure(ctx, ip, "sk_abcde")
+		require.NoError(t, err)
+		assert.Zero(t, f.Backoff)
+		targeted = append(targeted, f.Targeted)
+		sustained = append(sustained, f.Sustained)
+	}
+	assert.Equal(t, []bool{false, false, true, false}, targeted)
+	assert.Equal(t, []bool{false, false, false, false}, sustained, "no single IP guessed enough")
+}
+
+func TestAPIKeyGuardFlagsSustainedGuessingOnce(t *testing.T) {
+	cfg := guardConfig()
+	cfg.DistinctPrefixesAfter = 3
+	guard, _ := newGuard(t, cfg)
+	ctx := context.Background()
+
+	var flagged []bool
+	for _, prefix := range []string{"sk_aaaaa", "sk_bbbbb", "sk_ccccc", "sk_ddddd"} {
+		f, err := guard.RecordFailure(ctx, "203.0.113.7", prefix)
+		require.NoError(t, err)
+		flagged = append(flagged, f.Sustained)
+	}
+	assert.Equal(t, []bool{false, false, true, false}, flagged)
+}
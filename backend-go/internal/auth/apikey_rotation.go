@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"go.uber.org/zap"
+)
+
+// Bounds of an API key rotation policy
+const (
+	MinRotationDays = 7
+	MaxRotationDays = 365
+	MaxOverlapHours = 14 * 24
+)
+
+// ErrInvalidRotationPolicy is returned for a rotation period or overlap
+// outside the allowed bounds
+var ErrInvalidRotationPolicy = fmt.Errorf("rotation_days must be %d-%d and overlap_hours 0-%d", MinRotationDays, MaxRotationDays, MaxOverlapHours)
+
+// RotationPolicy makes an API key fall due for rotation Days after it was
+// issued and keeps it valid for OverlapHours next to its successor
+type RotationPolicy struct {
+	Days         int `json:"rotation_days"`
+	OverlapHours int `json:"overlap_hours"`
+}
+
+// Validate checks the policy's bounds
+func (p RotationPolicy) Validate() error {
+	if p.Days < MinRotationDays || p.Days > MaxRotationDays || p.OverlapHours < 0 || p.OverlapHours > MaxOverlapHours {
+		return ErrInvalidRotationPolicy
+	}
+	return nil
+}
+
+// DueAt returns when a key issued at issued falls due
+func (p RotationPolicy) DueAt(issued time.Time) time.Time {
+	return issued.AddDate(0, 0, p.Days)
+}
+
+// OverlapEnd returns when a key rotated or enforced at now stops working:
+// after its overlap, or at its own expiry when that comes first
+func OverlapEnd(key *models.APIKey, now time.Time) time.Time {
+	end := now.Add(time.Duration(key.OverlapHours) * time.Hour)
+	if key.ExpiresAt != nil && key.ExpiresAt.Before(end) {
+		return *key.ExpiresAt
+	}
+	return end
+}
+
+// RotationStep is what the rotation scheduler does next for a key
+type RotationStep int
+
+const (
+	// RotationNone leaves the key alone
+	RotationNone RotationStep = iota
+	// RotationRemind tells the owner the key falls due soon
+	RotationRemind
+	// RotationEnforce starts the overlap of a key past its due date, so it
+	// stops working unless the owner rotates it
+	RotationEnforce
+)
+
+// NextRotationStep decides the scheduler's next step for key at now;
+// reminders go out remindBefore the due date
+func NextRotationStep(key *models.APIKey, now time.Time, remindBefore time.Duration) RotationStep {
+	if !key.IsActive || key.RotationDueAt == nil || key.RotatedTo != nil || key.RotationEnforcedAt != nil {
+		return RotationNone
+	}
+	switch {
+	case !now.Before(*key.RotationDueAt):
+		return RotationEnforce
+	case key.RotationRemindedAt == nil && !now.Before(key.RotationDueAt.Add(-remindBefore)):
+		return RotationRemind
+	}
+	return RotationNone
+}
+
+// RotationStore finds keys with a rotation step due and records the steps
+type RotationStore interface {
+	ListRotationDue(ctx context.Context, before time.Time, limit int) ([]models.APIKey, error)
+	MarkRotationReminded(ctx context.Context, keyID int64, at time.Time) error
+	EnforceRotation(ctx context.Context, keyID int64, at, expiresAt time.Time) error
+}
+
+// RotationNotifier tells owners about rotations
+type RotationNotifier interface {
+	Notify(ctx context.Context, n *models.Notification) error
+}
+
+// KeyRotator reminds owners of auto-rotating API keys that fall due and
+// enforces rotation of keys past their due date
+type KeyRotator struct {
+	store        RotationStore
+	notifier     RotationNotifier
+	remindBefore time.Duration
+	logger       *zap.Logger
+}
+
+// NewKeyRotator creates a rotator reminding owners remindBefore keys fall
+// due. The notifier may be nil.
+func NewKeyRotator(store RotationStore, notifier RotationNotifier, remindBefore time.Duration, logger *zap.Logger) *KeyRotator {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &KeyRotator{store: store, notifier: notifier, remindBefore: remindBefore, logger: logger}
+}
+
+// rotationBatch is how many keys one run looks at
+const rotationBatch = 500
+
+// Run takes the rotation steps due at now and returns how many it took
+func (r *KeyRotator) Run(ctx context.Context, now time.Time) (int, error) {
+	keys, err := r.store.ListRotationDue(ctx, now.Add(r.remindBefore), rotationBatch)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	n := 0
+	for i := range keys {
+		key := &keys[i]
+		switch NextRotationStep(key, now, r.remindBefore) {
+		case RotationRemind:
+			if err := r.store.MarkRotationReminded(ctx, key.ID, now); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			r.notify(ctx, key, models.NotificationWarning,
+				fmt.Sprintf("API key %q is due for rotation", key.Name),
+				fmt.Sprintf("Rotate API key %q (ID %d) before %s. Rotating issues a new key; the old one keeps working for %d hours so your clients can switch over.",
+					key.Name, key.ID, key.RotationDueAt.UTC().Format(time.RFC1123), key.OverlapHours))
+			n++
+		case RotationEnforce:
+			expires := OverlapEnd(key, now)
+			if err := r.store.EnforceRotation(ctx, key.ID, now, expires); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			r.notify(ctx, key, models.NotificationCritical,
+				fmt.Sprintf("API key %q will stop working", key.Name),
+				fmt.Sprintf("API key %q (ID %d) is past its rotation date and stops working at %s. Rotate it now to get its replacement.",
+					key.Name, key.ID, expires.UTC().Format(time.RFC1123)))
+			n++
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+func (r *KeyRotator) notify(ctx context.Context, key *models.APIKey, severity models.NotificationSeverity, title, body string) {
+	if r.notifier == nil {
+		return
+	}
+	if err := r.notifier.Notify(ctx, &models.Notification{
+		UserID:   key.UserID,
+		Category: models.NotificationCategorySecurity,
+		Severity: severity,
+		Title:    title,
+		Body:     body,
+	}); err != nil {
+		r.logger.Warn("api key rotation notification failed", zap.Int64("key_id", key.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,111 @@
+// Package auth_test provides unit tests for API key rotation
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeRotationStore struct {
+	keys     []models.APIKey
+	reminded []int64
+	enforced map[int64]time.Time
+}
+
+func (f *fakeRotationStore) ListRotationDue(_ context.Context, before time.Time, limit int) ([]models.APIKey, error) {
+	var out []models.APIKey
+	for _, k := range f.keys {
+		if k.RotationDueAt != nil && k.RotationDueAt.Before(before) && len(out) < limit {
+			out = append(out, k)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeRotationStore) MarkRotationReminded(_ context.Context, keyID int64, _ time.Time) error {
+	f.reminded = append(f.reminded, keyID)
+	return nil
+}
+
+func (f *fakeRotationStore) EnforceRotation(_ context.Context, keyID int64, _, expiresAt time.Time) error {
+	f.enforced[keyID] = expiresAt
+	return nil
+}
+
+type fakeNotifier []*models.Notification
+
+func (f *fakeNotifier) Notify(_ context.Context, n *models.Notification) error {
+	*f = append(*f, n)
+	return nil
+}
+
+func TestRotationPolicyValidate(t *testing.T) {
+	assert.NoError(t, auth.RotationPolicy{Days: 90, OverlapHours: 24}.Validate())
+	assert.ErrorIs(t, auth.RotationPolicy{Days: 1}.Validate(), auth.ErrInvalidRotationPolicy)
+	assert.ErrorIs(t, auth.RotationPolicy{Days: 90, OverlapHours: -1}.Validate(), auth.ErrInvalidRotationPolicy)
+	assert.ErrorIs(t, auth.RotationPolicy{Days: 90, OverlapHours: auth.MaxOverlapHours + 1}.Validate(), auth.ErrInvalidRotationPolicy)
+}
+
+func TestNextRotationStep(t *testing.T) {
+	now := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+	at := func(d time.Duration) *time.Time { t := now.Add(d); return &t }
+	successor := int64(9)
+
+	cases := map[string]struct {
+		key  models.APIKey
+		want auth.RotationStep
+	}{
+		"no policy":        {models.APIKey{IsActive: true}, auth.RotationNone},
+		"not yet":          {models.APIKey{IsActive: true, RotationDueAt: at(8 * 24 * time.Hour)}, auth.RotationNone},
+		"remind":           {models.APIKey{IsActive: true, RotationDueAt: at(3 * 24 * time.Hour)}, auth.RotationRemind},
+		"already reminded": {models.APIKey{IsActive: true, RotationDueAt: at(time.Hour), RotationRemindedAt: at(-time.Hour)}, auth.RotationNone},
+		"overdue":          {models.APIKey{IsActive: true, RotationDueAt: at(-time.Hour), RotationRemindedAt: at(-time.Hour)}, auth.RotationEnforce},
+		"already rotated":  {models.APIKey{IsActive: true, RotationDueAt: at(-time.Hour), RotatedTo: &successor}, auth.RotationNone},
+		"enforced":         {models.APIKey{IsActive: true, RotationDueAt: at(-time.Hour), RotationEnforcedAt: at(-time.Minute)}, auth.RotationNone},
+		"revoked":          {models.APIKey{RotationDueAt: at(-time.Hour)}, auth.RotationNone},
+	}
+	for name, tc := range cases {
+		assert.Equal(t, tc.want, auth.NextRotationStep(&tc.key, now, week), name)
+	}
+}
+
+func TestOverlapEnd(t *testing.T) {
+	now := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+	key := &models.APIKey{OverlapHours: 48}
+	assert.Equal(t, now.Add(48*time.Hour), auth.OverlapEnd(key, now))
+
+	expires := now.Add(time.Hour)
+	key.ExpiresAt = &expires
+	assert.Equal(t, expires, auth.OverlapEnd(key, now), "an overlap never outlives the key's own expiry")
+}
+
+func TestKeyRotatorRun(t *testing.T) {
+	now := time.Date(2026, 5, 10, 12, 0, 0, 0, time.UTC)
+	soon, overdue := now.Add(2*24*time.Hour), now.Add(-time.Hour)
+	store := &fakeRotationStore{
+		keys: []models.APIKey{
+			{ID: 1, UserID: 10, Name: "ci", IsActive: true, RotationDueAt: &soon},
+			{ID: 2, UserID: 11, Name: "etl", IsActive: true, RotationDueAt: &overdue, OverlapHours: 24},
+		},
+		enforced: map[int64]time.Time{},
+	}
+	notes := &fakeNotifier{}
+	r := auth.NewKeyRotator(store, notes, 7*24*time.Hour, nil)
+
+	n, err := r.Run(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int64{1}, store.reminded)
+	assert.Equal(t, map[int64]time.Time{2: now.Add(24 * time.Hour)}, store.enforced)
+	require.Len(t, *notes, 2)
+	assert.Equal(t, int64(10), (*notes)[0].UserID)
+	assert.Equal(t, models.NotificationCategorySecurity, (*notes)[0].Category)
+	assert.Equal(t, models.NotificationCritical, (*notes)[1].Severity)
+}
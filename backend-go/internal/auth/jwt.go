@@ -13,40 +13,22 @@ type TokenPair struct {
 	ExpiresIn    int    `json:"expires_in"`
 }
 
-func CreateAccessToken(secret, alg string, claims jwt.MapClaims, ttlMinutes int) (string, error) {
-	claims["exp"] = time.Now().Add(time.Duration(ttlMinutes) * time.Minute).Unix()
+func CreateAccessToken(keys *KeyRing, claims jwt.MapClaims, ttlMinutes int) (string, error) {
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Duration(ttlMinutes) * time.Minute).Unix()
 	claims["type"] = "access"
-	return sign(secret, alg, claims)
+	return keys.Sign(claims)
 }
 
-func CreateRefreshToken(secret, alg string, claims jwt.MapClaims, ttlDays int) (string, error) {
-	claims["exp"] = time.Now().Add(time.Duration(ttlDays) * 24 * time.Hour).Unix()
+func CreateRefreshToken(keys *KeyRing, claims jwt.MapClaims, ttlDays int) (string, error) {
+	now := time.Now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(time.Duration(ttlDays) * 24 * time.Hour).Unix()
 	claims["type"] = "refresh"
-	return sign(secret, alg, claims)
+	return keys.Sign(claims)
 }
 
-func sign(secret, alg string, claims jwt.MapClaims) (string, error) {
-	var method jwt.SigningMethod
-	switch alg {
-	case "HS256":
-		method = jwt.SigningMethodHS256
-	case "HS512":
-		method = jwt.SigningMethodHS512
-	default:
-		method = jwt.SigningMethodHS256
-	}
-	return jwt.NewWithClaims(method, claims).SignedString([]byte(secret))
+func ParseAndValidate(keys *KeyRing, token string) (jwt.MapClaims, error) {
+	return keys.Parse(token)
 }
-
-func ParseAndValidate(secret, alg, token string) (jwt.MapClaims, error) {
-	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	}, jwt.WithValidMethods([]string{alg}))
-	if err != nil { return nil, err }
-	if !parsed.Valid { return nil, jwt.ErrTokenInvalidClaims }
-	claims, ok := parsed.Claims.(jwt.MapClaims)
-	if !ok { return nil, jwt.ErrTokenInvalidClaims }
-	return claims, nil
-}
-
-
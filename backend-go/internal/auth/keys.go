@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/api/option"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+var (
+	// ErrUnknownKey is returned for a token whose kid is not in the key ring
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrKeyAlgorithm is returned for a token signed with another algorithm
+	// than its key uses
+	ErrKeyAlgorithm = errors.New("unexpected signing algorithm")
+)
+
+// minSecretLength is the shortest HMAC secret accepted
+const minSecretLength = 32
+
+// Key is a key tokens are signed or verified with. Its ID is written to
+// the kid header of the tokens it signs.
+type Key struct {
+	ID        string
+	Algorithm string
+	sign      any
+	verify    any
+}
+
+// CanSign reports whether the key holds private material; keys loaded from
+// a public key only verify tokens signed before a rotation
+func (k *Key) CanSign() bool { return k.sign != nil }
+
+// ParseKey builds a key from its material. PEM encoded RSA keys use RS256
+// and Ed25519 keys EdDSA, either as a private key or as a public key that
+// only verifies. Anything else is an HMAC secret used with hmacAlg, HS256 or
+// HS512.
+func ParseKey(id, hmacAlg string, material []byte) (*Key, error) {
+	block, _ := pem.Decode(material)
+	if block == nil {
+		secret := []byte(strings.TrimRight(string(material), "\r\n"))
+		if len(secret) < minSecretLength {
+			return nil, fmt.Errorf("key %q: HMAC secrets must be at least %d bytes", id, minSecretLength)
+		}
+		if hmacAlg != jwt.SigningMethodHS256.Alg() && hmacAlg != jwt.SigningMethodHS512.Alg() {
+			return nil, fmt.Errorf("key %q: unsupported HMAC algorithm %q", id, hmacAlg)
+		}
+		return &Key{ID: id, Algorithm: hmacAlg, sign: secret, verify: secret}, nil
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("key %q: unsupported PEM block %q", id, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %q: %w", id, err)
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, Algorithm: jwt.SigningMethodRS256.Alg(), sign: k, verify: &k.PublicKey}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: id, Algorithm: jwt.SigningMethodRS256.Alg(), verify: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Algorithm: jwt.SigningMethodEdDSA.Alg(), sign: k, verify: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Algorithm: jwt.SigningMethodEdDSA.Alg(), verify: k}, nil
+	}
+	return nil, fmt.Errorf("key %q: unsupported key type %T", id, parsed)
+}
+
+// KeyRing signs tokens with its active key and verifies them with the key
+// named by their kid header, so retired keys keep verifying the tokens they
+// signed until those expire
+type KeyRing struct {
+	active  *Key
+	keys    map[string]*Key
+	methods []string
+}
+
+// NewKeyRing creates a key ring signing with active. A key with an empty ID
+// verifies tokens without a kid header, issued before rotation was set up.
+func NewKeyRing(active *Key, others ...*Key) (*KeyRing, error) {
+	if active == nil || !active.CanSign() {
+		return nil, errors.New("the active key must hold a private key or secret")
+	}
+	r := &KeyRing{active: active, keys: map[string]*Key{}}
+	for _, k := range append([]*Key{active}, others...) {
+		if _, dup := r.keys[k.ID]; dup {
+			return nil, fmt.Errorf("duplicate key ID %q", k.ID)
+		}
+		r.keys[k.ID] = k
+		if !slices.Contains(r.methods, k.Algorithm) {
+			r.methods = append(r.methods, k.Algorithm)
+		}
+	}
+	return r, nil
+}
+
+// ActiveID returns the ID of the key new tokens are signed with
+func (r *KeyRing) ActiveID() string { return r.active.ID }
+
+// Sign signs claims with the active key
+func (r *KeyRing) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(r.active.Algorithm), claims)
+	if r.active.ID != "" {
+		token.Header["kid"] = r.active.ID
+	}
+	return token.SignedString(r.active.sign)
+}
+
+// Parse verifies a token with the key it names and returns its claims
+func (r *KeyRing) Parse(token string) (jwt.MapClaims, error) {
+	parsed, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := r.keys[kid]
+		if !ok {
+			return nil, ErrUnknownKey
+		}
+		if t.Method.Alg() != key.Algorithm {
+			return nil, ErrKeyAlgorithm
+		}
+		return key.verify, nil
+	}, jwt.WithValidMethods(r.methods))
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := parsed.Claims.(jwt.MapClaims)
+	if !parsed.Valid || !ok {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	return claims, nil
+}
+
+// SecretReader reads the payload of a Secret Manager secret version, e.g.
+// projects/p/secrets/jwt-signing-key/versions/latest
+type SecretReader func(ctx context.Context, name string) ([]byte, error)
+
+// NewSecretManagerReader reads secrets with the application default
+// credentials
+func NewSecretManagerReader(ctx context.Context) (SecretReader, error) {
+	svc, err := secretmanager.NewService(ctx, option.WithScopes(secretmanager.CloudPlatformScope))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Secret Manager client: %w", err)
+	}
+	return func(ctx context.Context, name string) ([]byte, error) {
+		resp, err := svc.Projects.Secrets.Versions.Access(name).Context(ctx).Do()
+		if err != nil {
+			return nil, err
+		}
+		if resp.Payload == nil {
+			return nil, fmt.Errorf("secret %s has no payload", name)
+		}
+		return base64.StdEncoding.DecodeString(resp.Payload.Data)
+	}, nil
+}
+
+// KeyConfig describes where the signing keys come from
+type KeyConfig struct {
+	// Secret is the HMAC secret that verifies tokens without a kid, and signs
+	// when no other keys are configured
+	Secret string
+	// HMACAlgorithm is HS256 or HS512
+	HMACAlgorithm string
+	// Sources maps key IDs to env:VAR, file:/path or
+	// gcp:projects/p/secrets/s/versions/v
+	Sources map[string]string
+	// ActiveID names the source new tokens are signed with
+	ActiveID string
+	// Secrets reads gcp: sources; nil creates a Secret Manager client when
+	// one is needed
+	Secrets SecretReader
+}
+
+// ParseKeySources parses "kid=env:VAR,kid2=file:/path" into key sources
+func ParseKeySources(spec string) (map[string]string, error) {
+	sources := make(map[string]string)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kid, source, ok := strings.Cut(part, "=")
+		if !ok || kid == "" || source == "" {
+			return nil, fmt.Errorf("invalid signing key entry %q", part)
+		}
+		sources[kid] = source
+	}
+	return sources, nil
+}
+
+// LoadKeyRing loads every configured key
+func LoadKeyRing(ctx context.Context, cfg KeyConfig) (*KeyRing, error) {
+	var legacy *Key
+	if cfg.Secret != "" {
+		k, err := ParseKey("", cfg.HMACAlgorithm, []byte(cfg.Secret))
+		if err != nil {
+			return nil, err
+		}
+		legacy = k
+	}
+	if len(cfg.Sources) == 0 {
+		if legacy == nil {
+			return nil, errors.New("no signing keys configured")
+		}
+		return NewKeyRing(legacy)
+	}
+
+	var active *Key
+	others := []*Key{}
+	if legacy != nil {
+		others = append(others, legacy)
+	}
+	for id, source := range cfg.Sources {
+		material, err := loadKeyMaterial(ctx, &cfg, source)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		k, err := ParseKey(id, cfg.HMACAlgorithm, material)
+		if err != nil {
+			return nil, err
+		}
+		if id == cfg.ActiveID {
+			active = k
+		} else {
+			others = append(others, k)
+		}
+	}
+	if active == nil {
+		return nil, fmt.Errorf("active key %q is not configured", cfg.ActiveID)
+	}
+	return NewKeyRing(active, others...)
+}
+
+func loadKeyMaterial(ctx context.Context, cfg *KeyConfig, source string) ([]byte, error) {
+	kind, ref, _ := strings.Cut(source, ":")
+	if ref == "" {
+		return nil, fmt.Errorf("invalid key source %q", source)
+	}
+	switch kind {
+	case "env":
+		v := os.Getenv(ref)
+		if v == "" {
+			return nil, fmt.Errorf("environment variable %s is empty", ref)
+		}
+		return []byte(v), nil
+	case "file":
+		return os.ReadFile(ref)
+	case "gcp":
+		if cfg.Secrets == nil {
+			reader, err := NewSecretManagerReader(ctx)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Secrets = reader
+		}
+		return cfg.Secrets(ctx, ref)
+	}
+	return nil, fmt.Errorf("invalid key source %q", source)
+}
@@ -0,0 +1,162 @@
+// Package auth_test provides unit tests for token signing keys
+package auth_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func pemKey(t *testing.T, blockType string, key any) []byte {
+	t.Helper()
+	var der []byte
+	var err error
+	if blockType == "PUBLIC KEY" {
+		der, err = x509.MarshalPKIXPublicKey(key)
+	} else {
+		der, err = x509.MarshalPKCS8PrivateKey(key)
+	}
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestParseKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	k, err := auth.ParseKey("a", "HS512", []byte(testSecret+"\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "HS512", k.Algorithm)
+
+	k, err = auth.ParseKey("b", "HS256", pemKey(t, "PRIVATE KEY", rsaKey))
+	require.NoError(t, err)
+	assert.Equal(t, "RS256", k.Algorithm)
+	assert.True(t, k.CanSign())
+
+	k, err = auth.ParseKey("c", "HS256", pemKey(t, "PRIVATE KEY", edKey))
+	require.NoError(t, err)
+	assert.Equal(t, "EdDSA", k.Algorithm)
+
+	k, err = auth.ParseKey("d", "HS256", pemKey(t, "PUBLIC KEY", edPub))
+	require.NoError(t, err)
+	assert.False(t, k.CanSign(), "a public key only verifies")
+
+	_, err = auth.ParseKey("e", "HS256", []byte("short"))
+	assert.Error(t, err)
+	_, err = auth.ParseKey("f", "RS256", []byte(testSecret))
+	assert.Error(t, err, "HMAC secrets need an HMAC algorithm")
+}
+
+func TestKeyRingRotation(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	legacy, err := auth.ParseKey("", "HS256", []byte(testSecret))
+	require.NoError(t, err)
+	current, err := auth.ParseKey("2026-10", "HS256", pemKey(t, "PRIVATE KEY", edKey))
+	require.NoError(t, err)
+
+	before, err := auth.NewKeyRing(legacy)
+	require.NoError(t, err)
+	old, err := before.Sign(jwt.MapClaims{"user_id": float64(1)})
+	require.NoError(t, err)
+
+	after, err := auth.NewKeyRing(current, legacy)
+	require.NoError(t, err)
+	token, err := after.Sign(jwt.MapClaims{"user_id": float64(2)})
+	require.NoError(t, err)
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10", parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Header["alg"])
+
+	claims, err := after.Parse(token)
+	require.NoError(t, err)
+	assert.Equal(t, float64(2), claims["user_id"])
+	claims, err = after.Parse(old)
+	require.NoError(t, err, "tokens issued before the rotation keep verifying")
+	assert.Equal(t, float64(1), claims["user_id"])
+
+	_, err = before.Parse(token)
+	assert.Error(t, err, "the old ring does not know the new key")
+
+	unknown := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": float64(3)})
+	unknown.Header["kid"] = "retired"
+	raw, err := unknown.SignedString([]byte(testSecret))
+	require.NoError(t, err)
+	_, err = after.Parse(raw)
+	assert.ErrorIs(t, err, auth.ErrUnknownKey)
+
+	_, err = auth.NewKeyRing(current, current)
+	assert.Error(t, err, "duplicate key IDs")
+}
+
+func TestKeyRingRejectsAlgorithmSwap(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pub := pemKey(t, "PUBLIC KEY", &rsaKey.PublicKey)
+	signer, err := auth.ParseKey("k1", "HS256", pemKey(t, "PRIVATE KEY", rsaKey))
+	require.NoError(t, err)
+	keys, err := auth.NewKeyRing(signer)
+	require.NoError(t, err)
+
+	// An HMAC token keyed with the public key must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": float64(1)})
+	forged.Header["kid"] = "k1"
+	raw, err := forged.SignedString(pub)
+	require.NoError(t, err)
+	_, err = keys.Parse(raw)
+	assert.Error(t, err)
+}
+
+func TestLoadKeyRing(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	require.NoError(t, os.WriteFile(path, pemKey(t, "PRIVATE KEY", edKey), 0o600))
+	t.Setenv("TEST_JWT_PREVIOUS", testSecret+"-previous")
+
+	sources, err := auth.ParseKeySources("new=file:" + path + ", prev=env:TEST_JWT_PREVIOUS, vault=gcp:projects/p/secrets/jwt/versions/3")
+	require.NoError(t, err)
+	var asked string
+	keys, err := auth.LoadKeyRing(context.Background(), auth.KeyConfig{
+		Secret:        testSecret,
+		HMACAlgorithm: "HS256",
+		Sources:       sources,
+		ActiveID:      "new",
+		Secrets: func(_ context.Context, name string) ([]byte, error) {
+			asked = name
+			return []byte(testSecret + "-vault"), nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new", keys.ActiveID())
+	assert.Equal(t, "projects/p/secrets/jwt/versions/3", asked)
+
+	_, err = auth.LoadKeyRing(context.Background(), auth.KeyConfig{HMACAlgorithm: "HS256", Sources: sources, ActiveID: "missing",
+		Secrets: func(context.Context, string) ([]byte, error) { return []byte(testSecret), nil }})
+	assert.Error(t, err)
+
+	_, err = auth.ParseKeySources("nokind")
+	assert.Error(t, err)
+	_, err = auth.LoadKeyRing(context.Background(), auth.KeyConfig{HMACAlgorithm: "HS256", Sources: map[string]string{"a": "plain"}, ActiveID: "a"})
+	assert.Error(t, err)
+
+	legacy, err := auth.LoadKeyRing(context.Background(), auth.KeyConfig{Secret: testSecret, HMACAlgorithm: "HS256"})
+	require.NoError(t, err)
+	assert.Equal(t, "", legacy.ActiveID())
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RateLimitResult is the outcome of counting one request against a limit
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the oldest request in the window leaves it and frees
+	// a slot
+	Reset time.Time
+}
+
+// slidingWindowScript drops the requests that left the window, counts the
+// rest and adds this one when under the limit, in one step so concurrent
+// requests cannot all take the last slot. Scores are in milliseconds.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+local count = redis.call('ZCARD', KEYS[1])
+local allowed = 0
+if count < limit then
+  redis.call('ZADD', KEYS[1], now, ARGV[4])
+  redis.call('PEXPIRE', KEYS[1], window)
+  count = count + 1
+  allowed = 1
+end
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local reset = now + window
+if oldest[2] then
+  reset = tonumber(oldest[2]) + window
+end
+return {allowed, count, reset}
+`)
+
+// NewRateLimiter returns a sliding window rate limiter kept in Redis
+func NewRateLimiter(redisClient *redis.Client) *RateLimiter {
+	return &RateLimiter{redisClient: redisClient}
+}
+
+// Allow counts a request of identifier against limit requests per window.
+// Unlike a fixed window the count never resets at once, so a caller cannot
+// send twice the limit across a window boundary.
+func (l *RateLimiter) Allow(ctx context.Context, identifier string, limit int, window time.Duration) (RateLimitResult, error) {
+	now := time.Now()
+	member := make([]byte, 8)
+	_, _ = rand.Read(member)
+	res, err := slidingWindowScript.Run(ctx, l.redisClient, []string{"rate_limit_advanced:" + identifier},
+		now.UnixMilli(), window.Milliseconds(), limit, hex.EncodeToString(member)).Int64Slice()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return RateLimitResult{
+		Allowed:   res[0] == 1,
+		Limit:     limit,
+		Remaining: max(limit-int(res[1]), 0),
+		Reset:     time.UnixMilli(res[2]),
+	}, nil
+}
@@ -0,0 +1,139 @@
+// Package auth_test provides unit tests for tier-aware API rate limiting
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryLimiter counts requests in memory, as auth.RateLimiter does in
+// Redis
+type memoryLimiter struct {
+	mu       sync.Mutex
+	requests map[string][]time.Time
+	down     bool
+}
+
+func (l *memoryLimiter) Allow(_ context.Context, identifier string, limit int, window time.Duration) (auth.RateLimitResult, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.down {
+		return auth.RateLimitResult{}, errors.New("connection refused")
+	}
+	now := time.Now()
+	var kept []time.Time
+	for _, t := range l.requests[identifier] {
+		if t.After(now.Add(-window)) {
+			kept = append(kept, t)
+		}
+	}
+	allowed := len(kept) < limit
+	if allowed {
+		kept = append(kept, now)
+	}
+	l.requests[identifier] = kept
+	return auth.RateLimitResult{Allowed: allowed, Limit: limit, Remaining: limit - len(kept), Reset: kept[0].Add(window)}, nil
+}
+
+func rateLimitedApp(limiter *memoryLimiter, plans map[int64]int, lookups *int, counted map[int64]int) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.TierRateLimit(middleware.TierRateLimitConfig{
+		Limiter: limiter,
+		Identify: func(c *fiber.Ctx) int64 {
+			id, _ := strconv.ParseInt(c.Get("X-User"), 10, 64)
+			return id
+		},
+		PlanLimit: func(_ context.Context, userID int64) (int, error) {
+			*lookups++
+			if userID == 9 {
+				return 0, errors.New("user lookup failed")
+			}
+			return plans[userID], nil
+		},
+		Count:          func(userID int64) { counted[userID]++ },
+		AnonymousLimit: 1,
+		DefaultLimit:   2,
+	}))
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	return app
+}
+
+func get(t *testing.T, app *fiber.App, user string) (int, fiber.Map) {
+	t.Helper()
+	req := httptest.NewRequest(fiber.MethodGet, "/", nil)
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode, fiber.Map{
+		"limit":       resp.Header.Get("X-RateLimit-Limit"),
+		"remaining":   resp.Header.Get("X-RateLimit-Remaining"),
+		"reset":       resp.Header.Get("X-RateLimit-Reset"),
+		"retry_after": resp.Header.Get(fiber.HeaderRetryAfter),
+	}
+}
+
+func TestTierRateLimit(t *testing.T) {
+	limiter := &memoryLimiter{requests: map[string][]time.Time{}}
+	lookups, counted := 0, map[int64]int{}
+	app := rateLimitedApp(limiter, map[int64]int{1: 3, 2: 1}, &lookups, counted)
+
+	for i, remaining := range []string{"2", "1", "0"} {
+		status, h := get(t, app, "1")
+		require.Equal(t, fiber.StatusOK, status, "request %d", i)
+		assert.Equal(t, "3", h["limit"])
+		assert.Equal(t, remaining, h["remaining"])
+		assert.NotEmpty(t, h["reset"])
+		assert.Empty(t, h["retry_after"])
+	}
+	status, h := get(t, app, "1")
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+	assert.Equal(t, "0", h["remaining"])
+	retry, err := strconv.Atoi(h["retry_after"].(string))
+	require.NoError(t, err)
+	assert.True(t, retry >= 1 && retry <= 60, "retry after %d", retry)
+	assert.Equal(t, 1, lookups, "the plan is read once per user within its TTL")
+	assert.Equal(t, 3, counted[1], "only requests let through are metered")
+
+	// Each user counts against their own plan
+	status, _ = get(t, app, "2")
+	assert.Equal(t, fiber.StatusOK, status)
+	status, _ = get(t, app, "2")
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+
+	// Callers without credentials are limited per IP
+	status, h = get(t, app, "")
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "1", h["limit"])
+	status, _ = get(t, app, "")
+	assert.Equal(t, fiber.StatusTooManyRequests, status)
+}
+
+func TestTierRateLimitFallbacks(t *testing.T) {
+	limiter := &memoryLimiter{requests: map[string][]time.Time{}}
+	lookups, counted := 0, map[int64]int{}
+	app := rateLimitedApp(limiter, map[int64]int{}, &lookups, counted)
+
+	_, h := get(t, app, "9")
+	assert.Equal(t, "2", h["limit"], "a failed plan lookup gets the default")
+	_, h = get(t, app, "4")
+	assert.Equal(t, "2", h["limit"], "so does a tier without a plan")
+
+	limiter.down = true
+	status, h := get(t, app, "4")
+	assert.Equal(t, fiber.StatusOK, status, "requests pass while the limiter is down")
+	assert.Empty(t, h["limit"])
+	assert.Equal(t, 2, counted[4], "and are still metered")
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// Refresh tokens rotate: every refresh spends the token it was given and
+// issues the next member of the same family. Only the newest member is
+// live, so presenting an older one means it was copied, and the whole
+// family is revoked, the access tokens issued from it included.
+
+var (
+	// ErrRefreshReused is returned when a refresh token that was already
+	// exchanged is presented again
+	ErrRefreshReused = errors.New("refresh token was already used")
+	// ErrFamilyRevoked is returned for tokens of a revoked or expired family
+	ErrFamilyRevoked = errors.New("refresh token family was revoked")
+	// ErrRevocationUnavailable is returned when a revocation that must
+	// hold cannot be stored because Redis is not configured
+	ErrRevocationUnavailable = errors.New("token revocation needs redis")
+)
+
+// rotateScript swaps the live member of a family if it is the one presented.
+// It returns 1 when swapped, 0 when another member is live and -1 when the
+// family is gone.
+var rotateScript = redis.NewScript(`
+local live = redis.call('GET', KEYS[1])
+if not live then return -1 end
+if live ~= ARGV[1] then return 0 end
+redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+return 1`)
+
+// NewTokenID returns a random identifier for a token or a token family
+func NewTokenID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RefreshClaims copies claims for a refresh token of family with an ID of
+// its own, which it also returns
+func RefreshClaims(claims jwt.MapClaims, family string) (jwt.MapClaims, string) {
+	out := make(jwt.MapClaims, len(claims)+2)
+	for k, v := range claims {
+		out[k] = v
+	}
+	id := NewTokenID()
+	out["fid"] = family
+	out["jti"] = id
+	return out, id
+}
+
+// TokenFamily returns the family and ID of a refresh token; both are empty
+// for tokens issued before rotation. Access tokens carry the family only.
+func TokenFamily(claims jwt.MapClaims) (family, id string) {
+	family, _ = claims["fid"].(string)
+	id, _ = claims["jti"].(string)
+	return family, id
+}
+
+func familyKey(family string) string        { return "refresh_family:" + family }
+func revokedFamilyKey(family string) string { return "blacklisted_family:" + family }
+
+// StartFamily records the first member of a refresh token family, live for
+// ttl
+func (b *Blacklist) StartFamily(ctx context.Context, family, id string, ttl time.Duration) error {
+	if b == nil || b.rdb == nil {
+		return nil
+	}
+	return b.rdb.Set(ctx, familyKey(family), id, ttl).Err()
+}
+
+// Rotate makes next the live member of a family in place of id. When id is
+// not the live member the family is revoked for ttl and ErrRefreshReused is
+// returned. Without Redis tokens rotate but reuse goes undetected.
+func (b *Blacklist) Rotate(ctx context.Context, family, id, next string, ttl time.Duration) error {
+	if b == nil || b.rdb == nil {
+		return nil
+	}
+	revoked, err := b.IsFamilyRevoked(ctx, family)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrFamilyRevoked
+	}
+	res, err := rotateScript.Run(ctx, b.rdb, []string{familyKey(family)}, id, next, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	switch res {
+	case 1:
+		return nil
+	case 0:
+		if err := b.RevokeFamily(ctx, family, ttl); err != nil {
+			return err
+		}
+		return ErrRefreshReused
+	default:
+		return ErrFamilyRevoked
+	}
+}
+
+// RevokeFamily blacklists every refresh and access token of a family for
+// ttl, which should outlast the newest of them
+func (b *Blacklist) RevokeFamily(ctx context.Context, family string, ttl time.Duration) error {
+	if b == nil || b.rdb == nil {
+		return nil
+	}
+	pipe := b.rdb.TxPipeline()
+	pipe.SetEx(ctx, revokedFamilyKey(family), "1", ttl)
+	pipe.Del(ctx, familyKey(family))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// IsFamilyRevoked reports whether a token family was revoked
+func (b *Blacklist) IsFamilyRevoked(ctx context.Context, family string) (bool, error) {
+	if b == nil || b.rdb == nil || family == "" {
+		return false, nil
+	}
+	res, err := b.rdb.Exists(ctx, revokedFamilyKey(family)).Result()
+	return res == 1, err
+}
+
+func revokedUserKey(userID int64) string { return "revoked_user:" + strconv.FormatInt(userID, 10) }
+
+// RevokeUser blacklists every token of a user issued up to at, for ttl,
+// which should outlast the newest of them. Tokens issued afterwards, such
+// as those of a sign-in once the account is reactivated, stay valid.
+// Without Redis it returns ErrRevocationUnavailable.
+func (b *Blacklist) RevokeUser(ctx context.Context, userID int64, at time.Time, ttl time.Duration) error {
+	if b == nil || b.rdb == nil {
+		return ErrRevocationUnavailable
+	}
+	return b.rdb.Set(ctx, revokedUserKey(userID), at.Unix(), ttl).Err()
+}
+
+// IsUserRevoked reports whether a token of a user was issued before their
+// tokens were revoked; tokens without an issue time count as issued before
+func (b *Blacklist) IsUserRevoked(ctx context.Context, userID int64, claims jwt.MapClaims) (bool, error) {
+	if b == nil || b.rdb == nil {
+		return false, nil
+	}
+	at, err := b.rdb.Get(ctx, revokedUserKey(userID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	iat, err := claims.GetIssuedAt()
+	if err != nil || iat == nil {
+		return true, nil
+	}
+	return iat.Unix() <= at, nil
+}
@@ -0,0 +1,56 @@
+// Package auth_test provides unit tests for refresh token rotation
+package auth_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefreshClaims(t *testing.T) {
+	session := jwt.MapClaims{"user_id": float64(7), "sub": "a@example.com"}
+	claims, id := auth.RefreshClaims(session, "fam1")
+	_, second := auth.RefreshClaims(session, "fam1")
+	assert.NotEqual(t, id, second, "each member of a family has its own ID")
+	assert.NotContains(t, session, "jti", "the session claims are copied")
+
+	key, err := auth.ParseKey("", "HS256", []byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+	keys, err := auth.NewKeyRing(key)
+	require.NoError(t, err)
+	token, err := auth.CreateRefreshToken(keys, claims, 1)
+	require.NoError(t, err)
+	parsed, err := auth.ParseAndValidate(keys, token)
+	require.NoError(t, err)
+	family, got := auth.TokenFamily(parsed)
+	assert.Equal(t, "fam1", family)
+	assert.Equal(t, id, got)
+	iat, err := parsed.GetIssuedAt()
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), iat.Time, time.Minute, "tokens carry their issue time for user revocation")
+
+	family, got = auth.TokenFamily(jwt.MapClaims{"user_id": float64(7)})
+	assert.Empty(t, family, "tokens from before rotation have no family")
+	assert.Empty(t, got)
+}
+
+func TestRotateWithoutRedis(t *testing.T) {
+	bl := auth.NewBlacklist(nil)
+	ctx := context.Background()
+	require.NoError(t, bl.StartFamily(ctx, "fam1", "a", time.Hour))
+	assert.NoError(t, bl.Rotate(ctx, "fam1", "a", "b", time.Hour))
+	assert.NoError(t, bl.RevokeFamily(ctx, "fam1", time.Hour))
+	revoked, err := bl.IsFamilyRevoked(ctx, "fam1")
+	require.NoError(t, err)
+	assert.False(t, revoked, "without Redis nothing is tracked")
+
+	assert.ErrorIs(t, bl.RevokeUser(ctx, 7, time.Now(), time.Hour), auth.ErrRevocationUnavailable, "suspensions must not silently leave sessions alive")
+	revoked, err = bl.IsUserRevoked(ctx, 7, jwt.MapClaims{"user_id": float64(7)})
+	require.NoError(t, err)
+	assert.False(t, revoked)
+}
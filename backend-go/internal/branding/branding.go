@@ -0,0 +1,243 @@
+// Package branding lets an organization on a white-label plan present the
+// platform as its own: its name and logo in email, its own from-address,
+// and its own hostname in the links and download URLs its members receive.
+// A hostname is proven with a DNS TXT record before anything uses it, and
+// the from-address has to belong to the same domain.
+package branding
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pricing"
+)
+
+const (
+	// DefaultName is the product name email carries without branding
+	DefaultName = "Synthos"
+	// DefaultBaseURL is where links point without a verified hostname
+	DefaultBaseURL = "https://synthos.dev"
+	// VerificationPrefix is prepended to a hostname to name the TXT record
+	// that proves it
+	VerificationPrefix = "_synthos-verify."
+	// verificationValue prefixes the token in the TXT record
+	verificationValue = "synthos-verify="
+	// maxLogoURL bounds the length of a logo URL
+	maxLogoURL = 2048
+)
+
+var (
+	ErrInvalidHostname    = errors.New("hostname is not a valid DNS name")
+	ErrReservedHostname   = errors.New("hostname belongs to the platform")
+	ErrInvalidLogoURL     = errors.New("logo URL must be an absolute https URL")
+	ErrInvalidFromAddress = errors.New("from address is not a valid email address")
+	ErrFromAddressDomain  = errors.New("from address must use the branded hostname or a parent domain of it")
+	ErrHostnameUnverified = errors.New("hostname verification record not found")
+)
+
+// Brand is what an email or link presents itself as
+type Brand struct {
+	Name        string `json:"name"`
+	LogoURL     string `json:"logo_url,omitempty"`
+	FromName    string `json:"from_name"`
+	FromAddress string `json:"from_address"`
+	// BaseURL is the scheme and host links are built on
+	BaseURL string `json:"base_url"`
+}
+
+// Apply returns def with an organization's branding laid over it. The
+// hostname and from-address only apply once the hostname is verified, so
+// an unproven domain never appears in a link or a From header.
+func Apply(def Brand, b *models.OrgBranding) Brand {
+	if b == nil {
+		return def
+	}
+	out := def
+	if b.DisplayName != nil && *b.DisplayName != "" {
+		out.Name = *b.DisplayName
+		out.FromName = *b.DisplayName
+	}
+	if b.LogoURL != nil && *b.LogoURL != "" {
+		out.LogoURL = *b.LogoURL
+	}
+	if Verified(b) {
+		out.BaseURL = "https://" + *b.APIHostname
+		if b.EmailFromAddress != nil && *b.EmailFromAddress != "" {
+			out.FromAddress = *b.EmailFromAddress
+		}
+	}
+	return out
+}
+
+// Verified reports whether b has a hostname proven by its TXT record
+func Verified(b *models.OrgBranding) bool {
+	return b != nil && b.APIHostname != nil && *b.APIHostname != "" && b.HostnameVerifiedAt != nil
+}
+
+// Tiers returns the subscription tiers that include white-label branding
+func Tiers() []string {
+	var out []string
+	for _, p := range pricing.SubscriptionPlans() {
+		if p.WhiteLabel {
+			out = append(out, p.ID)
+		}
+	}
+	return out
+}
+
+// ValidateHostname normalizes a custom API hostname and checks it is a
+// plain DNS name outside the reserved domains, such as the platform's own
+func ValidateHostname(host string, reserved []string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if host == "" || len(host) > 253 || net.ParseIP(host) != nil {
+		return "", ErrInvalidHostname
+	}
+	labels := strings.Split(host, ".")
+	if len(labels) < 2 {
+		return "", ErrInvalidHostname
+	}
+	for _, label := range labels {
+		if !validLabel(label) {
+			return "", ErrInvalidHostname
+		}
+	}
+	if strings.Trim(labels[len(labels)-1], "0123456789") == "" {
+		return "", ErrInvalidHostname
+	}
+	for _, domain := range reserved {
+		domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if domain != "" && (host == domain || strings.HasSuffix(host, "."+domain)) {
+			return "", ErrReservedHostname
+		}
+	}
+	return host, nil
+}
+
+func validLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, r := range label {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateLogoURL checks a logo is served over https from a named host;
+// email clients block anything else
+func ValidateLogoURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil || len(raw) > maxLogoURL || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return "", ErrInvalidLogoURL
+	}
+	return u.String(), nil
+}
+
+// ValidateFromAddress checks a from-address is on the branded hostname or
+// a parent domain of it, so verifying the hostname also proves the sender
+func ValidateFromAddress(addr, hostname string) (string, error) {
+	parsed, err := mail.ParseAddress(strings.TrimSpace(addr))
+	if err != nil {
+		return "", ErrInvalidFromAddress
+	}
+	at := strings.LastIndex(parsed.Address, "@")
+	if at <= 0 {
+		return "", ErrInvalidFromAddress
+	}
+	domain := strings.ToLower(parsed.Address[at+1:])
+	if !strings.Contains(domain, ".") {
+		return "", ErrInvalidFromAddress
+	}
+	if hostname == "" || (hostname != domain && !strings.HasSuffix(hostname, "."+domain)) {
+		return "", ErrFromAddressDomain
+	}
+	return parsed.Address[:at+1] + domain, nil
+}
+
+// NewVerificationToken returns the token a hostname's TXT record must hold
+func NewVerificationToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// VerificationRecord returns the name and value of the TXT record that
+// proves control of host
+func VerificationRecord(host, token string) (name, value string) {
+	return VerificationPrefix + host, verificationValue + token
+}
+
+// TXTResolver looks up DNS TXT records; *net.Resolver satisfies it
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Verify checks that host publishes the TXT record for token
+func Verify(ctx context.Context, r TXTResolver, host, token string) error {
+	name, want := VerificationRecord(host, token)
+	records, err := r.LookupTXT(ctx, name)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrHostnameUnverified, err)
+	}
+	for _, rec := range records {
+		if strings.TrimSpace(rec) == want {
+			return nil
+		}
+	}
+	return ErrHostnameUnverified
+}
+
+// Store finds the branding of the organization a user belongs to, among
+// organizations with an owner on one of tiers
+type Store interface {
+	ForEmail(ctx context.Context, email string, tiers []string) (*models.OrgBranding, error)
+	ForUser(ctx context.Context, userID int64, tiers []string) (*models.OrgBranding, error)
+}
+
+// Resolver finds the branding that applies to a user. A nil Resolver, or a
+// user outside any white-label organization, gets no branding.
+type Resolver struct {
+	store Store
+	tiers []string
+}
+
+func NewResolver(store Store) *Resolver {
+	return &Resolver{store: store, tiers: Tiers()}
+}
+
+// ForEmail returns the branding for the user with an address, or nil
+func (r *Resolver) ForEmail(ctx context.Context, email string) (*models.OrgBranding, error) {
+	if r == nil || r.store == nil {
+		return nil, nil
+	}
+	return none(r.store.ForEmail(ctx, strings.ToLower(strings.TrimSpace(email)), r.tiers))
+}
+
+// ForUser returns the branding for a user, or nil
+func (r *Resolver) ForUser(ctx context.Context, userID int64) (*models.OrgBranding, error) {
+	if r == nil || r.store == nil {
+		return nil, nil
+	}
+	return none(r.store.ForUser(ctx, userID, r.tiers))
+}
+
+func none(b *models.OrgBranding, err error) (*models.OrgBranding, error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return b, err
+}
@@ -0,0 +1,115 @@
+// Package branding_test provides unit tests for white-label branding
+package branding_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/branding"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestValidateHostname(t *testing.T) {
+	reserved := []string{"synthos.dev", "localhost"}
+
+	host, err := branding.ValidateHostname(" API.Acme.com. ", reserved)
+	require.NoError(t, err)
+	assert.Equal(t, "api.acme.com", host)
+
+	for _, bad := range []string{"", "acme", "10.0.0.1", "-api.acme.com", "api_acme.com", "api..acme.com", "acme.123"} {
+		_, err := branding.ValidateHostname(bad, reserved)
+		assert.ErrorIs(t, err, branding.ErrInvalidHostname, bad)
+	}
+	for _, taken := range []string{"synthos.dev", "acme.synthos.dev"} {
+		_, err := branding.ValidateHostname(taken, reserved)
+		assert.ErrorIs(t, err, branding.ErrReservedHostname, taken)
+	}
+	_, err = branding.ValidateHostname("notsynthos.dev", reserved)
+	assert.NoError(t, err)
+}
+
+func TestValidateLogoURL(t *testing.T) {
+	logo, err := branding.ValidateLogoURL("https://cdn.acme.com/logo.png")
+	require.NoError(t, err)
+	assert.Equal(t, "https://cdn.acme.com/logo.png", logo)
+
+	for _, bad := range []string{"http://cdn.acme.com/logo.png", "/logo.png", "javascript:alert(1)", "https://user:pw@cdn.acme.com/logo.png"} {
+		_, err := branding.ValidateLogoURL(bad)
+		assert.ErrorIs(t, err, branding.ErrInvalidLogoURL, bad)
+	}
+}
+
+func TestValidateFromAddress(t *testing.T) {
+	addr, err := branding.ValidateFromAddress("Data@Acme.com", "api.acme.com")
+	require.NoError(t, err)
+	assert.Equal(t, "Data@acme.com", addr)
+
+	_, err = branding.ValidateFromAddress("data@api.acme.com", "api.acme.com")
+	assert.NoError(t, err)
+	_, err = branding.ValidateFromAddress("data@gmail.com", "api.acme.com")
+	assert.ErrorIs(t, err, branding.ErrFromAddressDomain)
+	_, err = branding.ValidateFromAddress("data@acme.com", "")
+	assert.ErrorIs(t, err, branding.ErrFromAddressDomain, "a sender needs a hostname to be proven by")
+	_, err = branding.ValidateFromAddress("not an address", "api.acme.com")
+	assert.ErrorIs(t, err, branding.ErrInvalidFromAddress)
+}
+
+type txtRecords map[string][]string
+
+func (r txtRecords) LookupTXT(_ context.Context, name string) ([]string, error) {
+	if recs, ok := r[name]; ok {
+		return recs, nil
+	}
+	return nil, errors.New("no such host")
+}
+
+func TestVerify(t *testing.T) {
+	name, value := branding.VerificationRecord("api.acme.com", "abc123")
+	assert.Equal(t, "_synthos-verify.api.acme.com", name)
+
+	dns := txtRecords{name: {"v=spf1 -all", value}}
+	assert.NoError(t, branding.Verify(context.Background(), dns, "api.acme.com", "abc123"))
+	assert.ErrorIs(t, branding.Verify(context.Background(), dns, "api.acme.com", "other"), branding.ErrHostnameUnverified)
+	assert.ErrorIs(t, branding.Verify(context.Background(), dns, "api.example.com", "abc123"), branding.ErrHostnameUnverified)
+}
+
+func TestApply(t *testing.T) {
+	def := branding.Brand{Name: "Synthos", FromName: "Synthos", FromAddress: "noreply@synthos.dev", BaseURL: "https://synthos.dev"}
+	assert.Equal(t, def, branding.Apply(def, nil))
+
+	b := &models.OrgBranding{
+		DisplayName:      strPtr("Acme Data"),
+		LogoURL:          strPtr("https://cdn.acme.com/logo.png"),
+		EmailFromAddress: strPtr("data@acme.com"),
+		APIHostname:      strPtr("api.acme.com"),
+	}
+	pending := branding.Apply(def, b)
+	assert.Equal(t, "Acme Data", pending.Name)
+	assert.Equal(t, "https://cdn.acme.com/logo.png", pending.LogoURL)
+	assert.Equal(t, "https://synthos.dev", pending.BaseURL, "an unverified hostname is never linked")
+	assert.Equal(t, "noreply@synthos.dev", pending.FromAddress)
+
+	now := time.Now()
+	b.HostnameVerifiedAt = &now
+	verified := branding.Apply(def, b)
+	assert.Equal(t, "https://api.acme.com", verified.BaseURL)
+	assert.Equal(t, "data@acme.com", verified.FromAddress)
+	assert.Equal(t, "Acme Data", verified.FromName)
+}
+
+func TestTiers(t *testing.T) {
+	assert.ElementsMatch(t, []string{"professional", "growth", "enterprise"}, branding.Tiers())
+}
+
+func TestResolverNil(t *testing.T) {
+	var r *branding.Resolver
+	b, err := r.ForEmail(context.Background(), "ana@acme.com")
+	assert.NoError(t, err)
+	assert.Nil(t, b)
+}
@@ -0,0 +1,217 @@
+// Package buckets delivers job outputs to buckets organizations own, so
+// their data never rests in platform storage. An S3 bucket is reached by
+// assuming a role the organization's account lets the platform assume,
+// bound to an external ID only that organization is given; a GCS bucket by
+// impersonating a service account the organization granted the platform.
+// A bucket is checked on registration by writing, reading back and
+// deleting an object, and every delivery records whether it worked.
+package buckets
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+)
+
+// Providers are the clouds buckets can be registered on
+var Providers = []string{models.BucketS3, models.BucketGCS}
+
+// CheckTimeout bounds a permission check
+const CheckTimeout = 30 * time.Second
+
+// gcsScope is the access impersonated GCS credentials are limited to
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+
+var (
+	// ErrInvalidBucket is returned for a registration that names no usable
+	// bucket, role or service account
+	ErrInvalidBucket = errors.New("invalid output bucket")
+	// ErrUnverified is returned when outputs would go to a bucket that has
+	// not passed its permission check
+	ErrUnverified = errors.New("output bucket has not been verified")
+	// ErrBucketChanged is returned for objects delivered to a bucket the
+	// organization has since removed or replaced
+	ErrBucketChanged = errors.New("output bucket was removed or replaced")
+	// ErrDeliveryFailed is returned when an output could not be written to
+	// its organization's bucket
+	ErrDeliveryFailed = errors.New("output delivery failed")
+)
+
+var (
+	s3BucketPattern  = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	gcsBucketPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,220}[a-z0-9]$`)
+	regionPattern    = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d{1,2}$`)
+	roleARNPattern   = regexp.MustCompile(`^arn:aws(-[a-z]+)*:iam::\d{12}:role/[A-Za-z0-9+=,.@_/-]{1,512}$`)
+	accountPattern   = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]@[a-z0-9.-]+\.gserviceaccount\.com$`)
+	prefixPattern    = regexp.MustCompile(`^[A-Za-z0-9!_.*'()/-]{0,256}$`)
+)
+
+// Validate checks a registration and normalizes its prefix to end in a
+// slash. Fields of the other provider must be empty.
+func Validate(b *models.OutputBucket) error {
+	invalid := func(msg string) error { return fmt.Errorf("%w: %s", ErrInvalidBucket, msg) }
+	prefix := strings.Trim(b.Prefix, "/")
+	if !prefixPattern.MatchString(prefix) || strings.Contains(prefix, "//") || strings.Contains("/"+prefix+"/", "/../") || strings.Contains("/"+prefix+"/", "/./") {
+		return invalid("prefix must be a relative path of letters, digits and -_.!*'()")
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	b.Prefix = prefix
+	switch b.Provider {
+	case models.BucketS3:
+		if !s3BucketPattern.MatchString(b.Bucket) || strings.Contains(b.Bucket, "..") {
+			return invalid("bucket is not an S3 bucket name")
+		}
+		if b.Region == nil || !regionPattern.MatchString(*b.Region) {
+			return invalid("region is not an AWS region")
+		}
+		if b.RoleARN == nil || !roleARNPattern.MatchString(*b.RoleARN) {
+			return invalid("role_arn is not an IAM role ARN")
+		}
+		if b.ServiceAccount != nil {
+			return invalid("service_account is for gcs buckets")
+		}
+	case models.BucketGCS:
+		if !gcsBucketPattern.MatchString(b.Bucket) || strings.Contains(b.Bucket, "..") || strings.HasPrefix(b.Bucket, "goog") {
+			return invalid("bucket is not a GCS bucket name")
+		}
+		if b.ServiceAccount == nil || !accountPattern.MatchString(*b.ServiceAccount) {
+			return invalid("service_account is not a service account email")
+		}
+		if b.RoleARN != nil || b.Region != nil {
+			return invalid("role_arn and region are for s3 buckets")
+		}
+	default:
+		return invalid("provider must be s3 or gcs")
+	}
+	return nil
+}
+
+// NewExternalID returns the external ID an organization's role has to
+// require of the platform
+func NewExternalID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "synthos-" + hex.EncodeToString(b), nil
+}
+
+// Store reads, writes, deletes and links the objects of a bucket
+type Store interface {
+	storage.SignedURLProvider
+	storage.ObjectReader
+	storage.ObjectWriter
+	storage.ObjectDeleter
+}
+
+// Open connects to an organization's bucket as the role or service account
+// it granted the platform
+func Open(ctx context.Context, b *models.OutputBucket, opts storage.ProviderOptions) (Store, error) {
+	if b.Provider == models.BucketS3 {
+		if b.Region == nil || b.RoleARN == nil {
+			return nil, ErrInvalidBucket
+		}
+		return storage.NewS3ProviderAssumingRole(ctx, b.Bucket, *b.Region, *b.RoleARN, b.ExternalID, opts)
+	}
+	if b.ServiceAccount == nil {
+		return nil, ErrInvalidBucket
+	}
+	ts, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+		TargetPrincipal: *b.ServiceAccount,
+		Scopes:          []string{gcsScope},
+	})
+	if err != nil {
+		return nil, err
+	}
+	opts.SignAs = *b.ServiceAccount
+	return storage.NewGCSProvider(ctx, b.Bucket, opts, option.WithTokenSource(ts))
+}
+
+// Check is the outcome of one permission check
+type Check struct {
+	Permission string `json:"permission"`
+	Passed     bool   `json:"passed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Permissions the platform needs on a bucket, in the order they are checked
+const (
+	PermissionWrite  = "write"
+	PermissionRead   = "read"
+	PermissionDelete = "delete"
+)
+
+// CheckPermissions writes an object under the bucket's prefix, reads it
+// back and deletes it. Checks after the first failure are not run and are
+// reported as failed with nothing tried.
+func CheckPermissions(ctx context.Context, s Store, prefix string) []Check {
+	nonce, err := NewExternalID()
+	if err != nil {
+		return []Check{{Permission: PermissionWrite, Error: err.Error()}}
+	}
+	key := prefix + ".synthos-permission-check/" + nonce
+	content := []byte("synthos output bucket permission check\n")
+	steps := []struct {
+		permission string
+		run        func() error
+	}{
+		{PermissionWrite, func() error {
+			return s.PutObject(ctx, key, bytes.NewReader(content), "text/plain")
+		}},
+		{PermissionRead, func() error {
+			obj, err := s.OpenObject(ctx, key)
+			if err != nil {
+				return err
+			}
+			defer obj.Close()
+			got, err := io.ReadAll(obj)
+			if err == nil && !bytes.Equal(got, content) {
+				err = errors.New("object read back differs from what was written")
+			}
+			return err
+		}},
+		{PermissionDelete, func() error { return s.DeleteObject(ctx, key) }},
+	}
+	out := make([]Check, 0, len(steps))
+	failed := false
+	for _, step := range steps {
+		c := Check{Permission: step.permission}
+		switch {
+		case failed:
+			c.Error = "not checked"
+		default:
+			if err := step.run(); err != nil {
+				c.Error, failed = redact.String(err.Error()), true
+			} else {
+				c.Passed = true
+			}
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Passed reports whether every check passed, and otherwise the first error
+func Passed(checks []Check) (bool, string) {
+	for _, c := range checks {
+		if !c.Passed {
+			return false, c.Permission + ": " + c.Error
+		}
+	}
+	return true, ""
+}
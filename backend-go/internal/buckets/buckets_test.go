@@ -0,0 +1,177 @@
+// Package buckets_test provides unit tests for organization output buckets
+package buckets_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/buckets"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(s string) *string { return &s }
+
+func TestValidate(t *testing.T) {
+	s3 := models.OutputBucket{Provider: models.BucketS3, Bucket: "acme-synthetic", Region: ptr("eu-west-1"),
+		RoleARN: ptr("arn:aws:iam::123456789012:role/synthos-delivery"), Prefix: "/synthos/outputs/"}
+	require.NoError(t, buckets.Validate(&s3))
+	assert.Equal(t, "synthos/outputs/", s3.Prefix)
+
+	gcs := models.OutputBucket{Provider: models.BucketGCS, Bucket: "acme_synthetic", ServiceAccount: ptr("synthos-writer@acme-prod.iam.gserviceaccount.com")}
+	require.NoError(t, buckets.Validate(&gcs))
+	assert.Empty(t, gcs.Prefix)
+
+	for name, b := range map[string]models.OutputBucket{
+		"provider":       {Provider: "azure", Bucket: "acme"},
+		"s3 name":        {Provider: models.BucketS3, Bucket: "Acme_Bucket", Region: s3.Region, RoleARN: s3.RoleARN},
+		"region":         {Provider: models.BucketS3, Bucket: "acme", Region: ptr("moon"), RoleARN: s3.RoleARN},
+		"role":           {Provider: models.BucketS3, Bucket: "acme", Region: s3.Region, RoleARN: ptr("arn:aws:iam::1:user/x")},
+		"mixed":          {Provider: models.BucketS3, Bucket: "acme", Region: s3.Region, RoleARN: s3.RoleARN, ServiceAccount: gcs.ServiceAccount},
+		"account":        {Provider: models.BucketGCS, Bucket: "acme", ServiceAccount: ptr("someone@example.com")},
+		"gcs with role":  {Provider: models.BucketGCS, Bucket: "acme", ServiceAccount: gcs.ServiceAccount, RoleARN: s3.RoleARN},
+		"prefix escapes": {Provider: models.BucketGCS, Bucket: "acme", ServiceAccount: gcs.ServiceAccount, Prefix: "a/../../b"},
+	} {
+		assert.ErrorIs(t, buckets.Validate(&b), buckets.ErrInvalidBucket, name)
+	}
+}
+
+func TestNewExternalID(t *testing.T) {
+	a, err := buckets.NewExternalID()
+	require.NoError(t, err)
+	b, _ := buckets.NewExternalID()
+	assert.True(t, strings.HasPrefix(a, "synthos-"))
+	assert.NotEqual(t, a, b)
+}
+
+// memory is a bucket in memory; deny refuses the named permission
+type memory struct {
+	objects map[string][]byte
+	deny    string
+}
+
+func (m *memory) GetSignedURL(_ context.Context, key string, _ time.Duration) (string, error) {
+	return "https://bucket.example/" + key, nil
+}
+
+func (m *memory) OpenObject(_ context.Context, key string) (io.ReadCloser, error) {
+	if m.deny == buckets.PermissionRead {
+		return nil, errors.New("AccessDenied: s3:GetObject")
+	}
+	b, ok := m.objects[key]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (m *memory) PutObject(_ context.Context, key string, r io.Reader, _ string) error {
+	if m.deny == buckets.PermissionWrite {
+		return errors.New("AccessDenied: s3:PutObject")
+	}
+	b, err := io.ReadAll(r)
+	m.objects[key] = b
+	return err
+}
+
+func (m *memory) DeleteObject(_ context.Context, key string) error {
+	if m.deny == buckets.PermissionDelete {
+		return errors.New("AccessDenied: s3:DeleteObject")
+	}
+	delete(m.objects, key)
+	return nil
+}
+
+func TestCheckPermissions(t *testing.T) {
+	store := &memory{objects: map[string][]byte{}}
+	checks := buckets.CheckPermissions(context.Background(), store, "synthos/")
+	ok, _ := buckets.Passed(checks)
+	assert.True(t, ok)
+	require.Len(t, checks, 3)
+	assert.Empty(t, store.objects, "the probe object is removed")
+
+	store.deny = buckets.PermissionRead
+	checks = buckets.CheckPermissions(context.Background(), store, "synthos/")
+	ok, reason := buckets.Passed(checks)
+	assert.False(t, ok)
+	assert.Contains(t, reason, "read: AccessDenied")
+	assert.True(t, checks[0].Passed)
+	assert.False(t, checks[2].Passed)
+	assert.Equal(t, "not checked", checks[2].Error)
+}
+
+// registered holds one organization's bucket
+type registered struct {
+	bucket *models.OutputBucket
+	status string
+	errs   []*string
+}
+
+func (r *registered) Get(_ context.Context, orgID int64) (*models.OutputBucket, error) {
+	if r.bucket == nil || r.bucket.OrgID != orgID {
+		return nil, sql.ErrNoRows
+	}
+	return r.bucket, nil
+}
+
+func (r *registered) ForUser(_ context.Context, userID int64) (*models.OutputBucket, error) {
+	if r.bucket == nil || userID != 3 {
+		return nil, sql.ErrNoRows
+	}
+	return r.bucket, nil
+}
+
+func (r *registered) RecordCheck(_ context.Context, _ int64, status string, lastError *string) error {
+	r.status = status
+	r.errs = append(r.errs, lastError)
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	store := &memory{objects: map[string][]byte{}}
+	lookup := &registered{bucket: &models.OutputBucket{OrgID: 5, Provider: models.BucketGCS, Bucket: "acme", Prefix: "synthos/", Status: models.OutputBucketActive}}
+	reg := &buckets.Registry{Buckets: lookup, Dial: func(context.Context, *models.OutputBucket) (buckets.Store, error) { return store, nil }}
+	ctx := context.Background()
+
+	delivery, w, err := reg.Destination(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, &models.OutputDelivery{OrgID: 5, Provider: models.BucketGCS, Bucket: "acme", Prefix: "synthos/"}, delivery)
+	assert.NotNil(t, w)
+
+	delivery2, w, err := reg.Destination(ctx, 4)
+	require.NoError(t, err)
+	assert.Nil(t, delivery2, "users outside the organization use platform storage")
+	assert.Nil(t, w)
+
+	_, err = reg.Reopen(ctx, delivery)
+	require.NoError(t, err)
+
+	require.NoError(t, reg.Delivered(ctx, 5, errors.New("AccessDenied")))
+	assert.Equal(t, models.OutputBucketFailing, lookup.status)
+	require.NoError(t, reg.Delivered(ctx, 5, nil))
+	assert.Equal(t, models.OutputBucketActive, lookup.status)
+	assert.Nil(t, lookup.errs[1])
+
+	// A replaced bucket no longer serves what went to the old one
+	lookup.bucket = &models.OutputBucket{OrgID: 5, Provider: models.BucketGCS, Bucket: "acme-new", Status: models.OutputBucketUnverified}
+	_, err = reg.Reopen(ctx, delivery)
+	assert.ErrorIs(t, err, buckets.ErrBucketChanged)
+	_, _, err = reg.Destination(ctx, 3)
+	assert.ErrorIs(t, err, buckets.ErrUnverified)
+
+	// A bucket that cannot be opened fails the delivery and is marked so
+	lookup.bucket.Status = models.OutputBucketActive
+	reg.Dial = func(context.Context, *models.OutputBucket) (buckets.Store, error) {
+		return nil, errors.New("impersonation denied")
+	}
+	_, _, err = reg.Destination(ctx, 3)
+	assert.ErrorIs(t, err, buckets.ErrDeliveryFailed)
+	assert.Equal(t, models.OutputBucketFailing, lookup.status)
+}
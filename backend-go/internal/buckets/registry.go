@@ -0,0 +1,94 @@
+package buckets
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+)
+
+// Buckets holds the registered buckets of organizations and their state
+type Buckets interface {
+	Get(ctx context.Context, orgID int64) (*models.OutputBucket, error)
+	// ForUser returns the bucket of the organization userID belongs to, or
+	// sql.ErrNoRows when there is none
+	ForUser(ctx context.Context, userID int64) (*models.OutputBucket, error)
+	RecordCheck(ctx context.Context, orgID int64, status string, lastError *string) error
+}
+
+// Registry opens the buckets job outputs are delivered to and keeps their
+// state up to date
+type Registry struct {
+	Buckets Buckets
+	// Options apply to every bucket opened; encryption is left to the
+	// bucket's own default
+	Options storage.ProviderOptions
+	// Principals are the platform identities organizations grant access
+	// to, by provider: the AWS principal their role trusts and the service
+	// account that impersonates theirs
+	Principals map[string]string
+	// Dial opens a bucket; nil uses Open
+	Dial func(ctx context.Context, b *models.OutputBucket) (Store, error)
+}
+
+// Open connects to a registered bucket
+func (r *Registry) Open(ctx context.Context, b *models.OutputBucket) (Store, error) {
+	if r.Dial != nil {
+		return r.Dial(ctx, b)
+	}
+	return Open(ctx, b, r.Options)
+}
+
+// Destination returns where the outputs of a user's jobs are written: the
+// bucket of their organization, or a nil delivery for platform storage.
+// Outputs never fall back to platform storage once a bucket is
+// registered, so an unverified bucket is an error.
+func (r *Registry) Destination(ctx context.Context, userID int64) (*models.OutputDelivery, storage.ObjectWriter, error) {
+	b, err := r.Buckets.ForUser(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.Status == models.OutputBucketUnverified {
+		return nil, nil, ErrUnverified
+	}
+	s, err := r.Open(ctx, b)
+	if err != nil {
+		_ = r.Delivered(ctx, b.OrgID, err)
+		return nil, nil, fmt.Errorf("%w: %s", ErrDeliveryFailed, redact.String(err.Error()))
+	}
+	return &models.OutputDelivery{OrgID: b.OrgID, Provider: b.Provider, Bucket: b.Bucket, Prefix: b.Prefix}, s, nil
+}
+
+// Reopen returns the bucket objects were delivered to, as long as the
+// organization still has it registered
+func (r *Registry) Reopen(ctx context.Context, d *models.OutputDelivery) (Store, error) {
+	b, err := r.Buckets.Get(ctx, d.OrgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrBucketChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+	if b.Provider != d.Provider || b.Bucket != d.Bucket {
+		return nil, ErrBucketChanged
+	}
+	return r.Open(ctx, b)
+}
+
+// Delivered records the outcome of a delivery to an organization's bucket:
+// one that failed marks the bucket failing with its error, one that
+// worked marks it active again
+func (r *Registry) Delivered(ctx context.Context, orgID int64, deliveryErr error) error {
+	if deliveryErr == nil {
+		return r.Buckets.RecordCheck(ctx, orgID, models.OutputBucketActive, nil)
+	}
+	msg := redact.String(deliveryErr.Error())
+	return r.Buckets.RecordCheck(ctx, orgID, models.OutputBucketFailing, &msg)
+}
@@ -0,0 +1,163 @@
+// Package capacity turns an organization's hourly usage rollups into
+// volume heatmaps and trend projections for budget and capacity planning
+package capacity
+
+import (
+	"math"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Heatmap spreads usage over the hours of the week, indexed by weekday
+// (Sunday first) and hour of day in the report's time zone
+type Heatmap struct {
+	Jobs [7][24]int64 `json:"jobs"`
+	Rows [7][24]int64 `json:"rows"`
+	// PeakWeekday and PeakHour locate the cell with the most rows
+	PeakWeekday int `json:"peak_weekday"`
+	PeakHour    int `json:"peak_hour"`
+	// PeakHourlyRows is the most rows generated in any single hour
+	PeakHourlyRows int64 `json:"peak_hourly_rows"`
+}
+
+// Day is one calendar day of usage
+type Day struct {
+	Date    string  `json:"date"`
+	Jobs    int64   `json:"jobs"`
+	Rows    int64   `json:"rows"`
+	CostUSD float64 `json:"cost_usd"`
+}
+
+// Projection extrapolates the daily trend over the coming days
+type Projection struct {
+	HorizonDays int `json:"horizon_days"`
+	// RowsPerDayTrend and JobsPerDayTrend are the fitted daily change
+	RowsPerDayTrend float64 `json:"rows_per_day_trend"`
+	JobsPerDayTrend float64 `json:"jobs_per_day_trend"`
+	Days            []Day   `json:"days"`
+	TotalRows       int64   `json:"total_rows"`
+	TotalJobs       int64   `json:"total_jobs"`
+	TotalCostUSD    float64 `json:"total_cost_usd"`
+	// PeakHourlyRows scales the observed busiest hour by the projected
+	// growth, the throughput to provision for by the end of the horizon
+	PeakHourlyRows int64 `json:"peak_hourly_rows"`
+}
+
+// BuildHeatmap sums rollups into the weekday and hour they fall on in loc
+func BuildHeatmap(rollups []models.OrgUsageRollup, loc *time.Location) Heatmap {
+	var h Heatmap
+	for _, r := range rollups {
+		t := r.Hour.In(loc)
+		wd, hr := int(t.Weekday()), t.Hour()
+		h.Jobs[wd][hr] += r.Jobs
+		h.Rows[wd][hr] += r.Rows
+		h.PeakHourlyRows = max(h.PeakHourlyRows, r.Rows)
+	}
+	for wd := range h.Rows {
+		for hr, rows := range h.Rows[wd] {
+			if rows > h.Rows[h.PeakWeekday][h.PeakHour] {
+				h.PeakWeekday, h.PeakHour = wd, hr
+			}
+		}
+	}
+	return h
+}
+
+// Daily sums rollups per calendar day in loc from the day holding from up to
+// the day holding to, with days without usage included as zeros
+func Daily(rollups []models.OrgUsageRollup, loc *time.Location, from, to time.Time) []Day {
+	start := dayStart(from.In(loc))
+	end := dayStart(to.In(loc))
+	index := make(map[string]int)
+	var out []Day
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		key := d.Format(time.DateOnly)
+		index[key] = len(out)
+		out = append(out, Day{Date: key})
+	}
+	for _, r := range rollups {
+		i, ok := index[r.Hour.In(loc).Format(time.DateOnly)]
+		if !ok {
+			continue
+		}
+		out[i].Jobs += r.Jobs
+		out[i].Rows += r.Rows
+		out[i].CostUSD += r.CostUSD
+	}
+	return out
+}
+
+// Project fits a linear trend to the daily history and extends it horizon
+// days past its last day. Projected volumes never go below zero, and cost
+// follows the history's average cost per row.
+func Project(history []Day, horizon int, peakHourlyRows int64) Projection {
+	p := Projection{HorizonDays: horizon, Days: []Day{}}
+	if len(history) == 0 || horizon <= 0 {
+		return p
+	}
+	rows := make([]float64, len(history))
+	jobs := make([]float64, len(history))
+	var totalRows int64
+	var totalCost float64
+	for i, d := range history {
+		rows[i], jobs[i] = float64(d.Rows), float64(d.Jobs)
+		totalRows += d.Rows
+		totalCost += d.CostUSD
+	}
+	rowSlope, rowIntercept := fit(rows)
+	jobSlope, jobIntercept := fit(jobs)
+	p.RowsPerDayTrend, p.JobsPerDayTrend = rowSlope, jobSlope
+	var costPerRow float64
+	if totalRows > 0 {
+		costPerRow = totalCost / float64(totalRows)
+	}
+
+	last, _ := time.Parse(time.DateOnly, history[len(history)-1].Date)
+	n := len(history)
+	for i := 1; i <= horizon; i++ {
+		x := float64(n - 1 + i)
+		d := Day{
+			Date: last.AddDate(0, 0, i).Format(time.DateOnly),
+			Rows: int64(math.Round(math.Max(0, rowIntercept+rowSlope*x))),
+			Jobs: int64(math.Round(math.Max(0, jobIntercept+jobSlope*x))),
+		}
+		d.CostUSD = float64(d.Rows) * costPerRow
+		p.TotalRows += d.Rows
+		p.TotalJobs += d.Jobs
+		p.TotalCostUSD += d.CostUSD
+		p.Days = append(p.Days, d)
+	}
+
+	// The busiest hour grows with the daily volume, relative to the fitted
+	// volume of the last day of history
+	p.PeakHourlyRows = peakHourlyRows
+	if current := rowIntercept + rowSlope*float64(n-1); current > 0 {
+		growth := float64(p.Days[len(p.Days)-1].Rows) / current
+		p.PeakHourlyRows = int64(math.Ceil(float64(peakHourlyRows) * growth))
+	}
+	return p
+}
+
+// fit returns the least squares line through ys at x = 0, 1, 2, ...
+func fit(ys []float64) (slope, intercept float64) {
+	n := float64(len(ys))
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range ys {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denom := n*sumXX - sumX*sumX
+	if denom == 0 {
+		return 0, sumY / n
+	}
+	slope = (n*sumXY - sumX*sumY) / denom
+	return slope, (sumY - slope*sumX) / n
+}
+
+func dayStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
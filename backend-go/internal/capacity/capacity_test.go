@@ -0,0 +1,133 @@
+// Package capacity_test provides unit tests for usage heatmaps and projections
+package capacity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/capacity"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func hour(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+func TestBuildHeatmap(t *testing.T) {
+	rollups := []models.OrgUsageRollup{
+		{Hour: hour("2026-03-02T09:00:00Z"), Jobs: 2, Rows: 1000}, // Monday
+		{Hour: hour("2026-03-09T09:00:00Z"), Jobs: 1, Rows: 500},  // Monday
+		{Hour: hour("2026-03-03T23:00:00Z"), Jobs: 1, Rows: 1200}, // Tuesday
+	}
+	h := capacity.BuildHeatmap(rollups, time.UTC)
+	assert.Equal(t, int64(3), h.Jobs[time.Monday][9])
+	assert.Equal(t, int64(1500), h.Rows[time.Monday][9])
+	assert.Equal(t, int(time.Monday), h.PeakWeekday)
+	assert.Equal(t, 9, h.PeakHour)
+	assert.Equal(t, int64(1200), h.PeakHourlyRows)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	h = capacity.BuildHeatmap(rollups, berlin)
+	assert.Equal(t, int64(1200), h.Rows[time.Wednesday][0], "hours fall on the local weekday")
+}
+
+func TestDaily(t *testing.T) {
+	rollups := []models.OrgUsageRollup{
+		{Hour: hour("2026-03-01T10:00:00Z"), Jobs: 1, Rows: 100, CostUSD: 0.5},
+		{Hour: hour("2026-03-01T15:00:00Z"), Jobs: 1, Rows: 300, CostUSD: 1.5},
+		{Hour: hour("2026-03-03T08:00:00Z"), Jobs: 2, Rows: 50},
+		{Hour: hour("2026-02-20T08:00:00Z"), Jobs: 9, Rows: 9},
+	}
+	days := capacity.Daily(rollups, time.UTC, hour("2026-03-01T00:00:00Z"), hour("2026-03-03T12:00:00Z"))
+	assert.Equal(t, []capacity.Day{
+		{Date: "2026-03-01", Jobs: 2, Rows: 400, CostUSD: 2},
+		{Date: "2026-03-02"},
+		{Date: "2026-03-03", Jobs: 2, Rows: 50},
+	}, days)
+}
+
+func TestProject(t *testing.T) {
+	history := []capacity.Day{
+		{Date: "2026-03-01", Jobs: 1, Rows: 100, CostUSD: 1},
+		{Date: "2026-03-02", Jobs: 2, Rows: 200, CostUSD: 2},
+		{Date: "2026-03-03", Jobs: 3, Rows: 300, CostUSD: 3},
+	}
+	p := capacity.Project(history, 2, 50)
+	assert.InDelta(t, 100, p.RowsPerDayTrend, 1e-9)
+	assert.InDelta(t, 1, p.JobsPerDayTrend, 1e-9)
+	require.Len(t, p.Days, 2)
+	assert.Equal(t, capacity.Day{Date: "2026-03-04", Jobs: 4, Rows: 400, CostUSD: 4}, p.Days[0])
+	assert.Equal(t, "2026-03-05", p.Days[1].Date)
+	assert.Equal(t, int64(900), p.TotalRows)
+	assert.Equal(t, int64(9), p.TotalJobs)
+	assert.InDelta(t, 9, p.TotalCostUSD, 1e-9)
+	assert.Equal(t, int64(84), p.PeakHourlyRows, "the busiest hour grows from 300 to 500 rows a day")
+
+	declining := []capacity.Day{{Date: "2026-03-01", Rows: 300}, {Date: "2026-03-02", Rows: 100}}
+	p = capacity.Project(declining, 3, 10)
+	for _, d := range p.Days {
+		assert.GreaterOrEqual(t, d.Rows, int64(0))
+	}
+
+	p = capacity.Project(nil, 30, 0)
+	assert.Empty(t, p.Days)
+}
+
+func usage(period, model string, tokens, rows int64, cost, quality float64) models.ProviderUsage {
+	return models.ProviderUsage{Period: hour(period), Provider: "vertex_ai", Model: model, Jobs: 1, Rows: rows,
+		Tokens: tokens, CostUSD: cost, AvgQuality: &quality, ScoredJobs: 1}
+}
+
+func TestForecastSpend(t *testing.T) {
+	history := []models.ProviderUsage{
+		usage("2026-07-01T00:00:00Z", "opus", 1_000_000, 10_000, 15, 0.9),
+		usage("2026-07-01T00:00:00Z", "haiku", 1_000_000, 10_000, 1, 0.88),
+		usage("2026-08-01T00:00:00Z", "opus", 2_000_000, 20_000, 30, 0.9),
+		usage("2026-08-01T00:00:00Z", "haiku", 1_000_000, 10_000, 1, 0.88),
+		usage("2026-09-01T00:00:00Z", "opus", 3_000_000, 30_000, 45, 0.9),
+		usage("2026-09-01T00:00:00Z", "haiku", 1_000_000, 10_000, 1, 0.88),
+		usage("2026-10-01T00:00:00Z", "opus", 500_000, 5_000, 7.5, 0.9),
+	}
+	opts := capacity.DefaultSpendOptions
+	opts.CommitmentDiscount = 0.2
+	f := capacity.ForecastSpend(history, hour("2026-10-16T12:00:00Z"), opts)
+
+	assert.Equal(t, "2026-11", f.Month)
+	require.Len(t, f.Models, 2)
+	opus := f.Models[0]
+	assert.Equal(t, "opus", opus.Model, "models are ordered by forecast spend")
+	require.Len(t, opus.History, 3, "the current month is not fitted")
+	assert.Equal(t, int64(500_000), opus.MonthToDate.Tokens)
+	assert.Equal(t, int64(5_000_000), opus.ForecastTokens)
+	assert.InDelta(t, 75, opus.ForecastCostUSD, 1e-9)
+	assert.InDelta(t, 1, f.Models[1].ForecastCostUSD, 1e-9)
+	assert.InDelta(t, 76, f.TotalCostUSD, 1e-9)
+
+	require.Len(t, f.Suggestions, 2)
+	mix := f.Suggestions[0]
+	assert.Equal(t, capacity.SuggestModelMix, mix.Kind)
+	assert.Equal(t, "haiku", mix.TargetModel)
+	assert.InDelta(t, 35, mix.SavingsUSD, 1e-9)
+	assert.InDelta(t, 40, mix.SuggestedCostUSD, 1e-9)
+
+	commit := f.Suggestions[1]
+	assert.Equal(t, capacity.SuggestCommittedUse, commit.Kind)
+	assert.InDelta(t, 16, commit.CommitUSD, 1e-9, "the least monthly spend is committed")
+	assert.InDelta(t, 3.2, commit.SavingsUSD, 1e-9)
+
+	// A cheaper model of much lower quality is not suggested, and without a
+	// discount no commitment is
+	history[1].AvgQuality = ptr(0.5)
+	f = capacity.ForecastSpend(history, hour("2026-10-16T12:00:00Z"), capacity.DefaultSpendOptions)
+	assert.Empty(t, f.Suggestions)
+
+	empty := capacity.ForecastSpend(nil, hour("2026-10-16T12:00:00Z"), opts)
+	assert.Empty(t, empty.Models)
+	assert.Zero(t, empty.TotalCostUSD)
+}
+
+func ptr(v float64) *float64 { return &v }
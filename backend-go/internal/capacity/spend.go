@@ -0,0 +1,295 @@
+package capacity
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Suggestion kinds
+const (
+	SuggestModelMix     = "model_mix"
+	SuggestCommittedUse = "committed_use"
+)
+
+// SpendOptions tune the savings a spend forecast suggests
+type SpendOptions struct {
+	// QualityTolerance is how much lower the average quality of a cheaper
+	// model may be for rows to be moved to it
+	QualityTolerance float64
+	// MixShare is the share of a model's rows a mix suggestion moves
+	MixShare float64
+	// CommitmentDiscount is the discount providers give on committed
+	// monthly spend; no commitment is suggested without one
+	CommitmentDiscount float64
+	// CommitmentMonths is how many complete months of spend a commitment
+	// is sized on
+	CommitmentMonths int
+	// MinSavingsUSD leaves out suggestions saving less
+	MinSavingsUSD float64
+}
+
+// DefaultSpendOptions are the options of the organization cost report
+var DefaultSpendOptions = SpendOptions{QualityTolerance: 0.05, MixShare: 0.5, CommitmentMonths: 3, MinSavingsUSD: 1}
+
+// MonthSpend is one month of a model's usage
+type MonthSpend struct {
+	Month   string  `json:"month"`
+	Jobs    int64   `json:"jobs"`
+	Rows    int64   `json:"rows"`
+	Tokens  int64   `json:"tokens"`
+	CostUSD float64 `json:"cost_usd"`
+}
+
+// ModelSpend is a provider model's spend history and next month's forecast
+type ModelSpend struct {
+	Provider string       `json:"provider"`
+	Model    string       `json:"model"`
+	History  []MonthSpend `json:"history"`
+	// MonthToDate is the current, incomplete month, left out of the fit
+	MonthToDate     MonthSpend `json:"month_to_date"`
+	CostPer1KTokens float64    `json:"cost_per_1k_tokens"`
+	CostPer1KRows   float64    `json:"cost_per_1k_rows"`
+	AvgQuality      *float64   `json:"avg_quality,omitempty"`
+	ForecastTokens  int64      `json:"forecast_tokens"`
+	ForecastRows    int64      `json:"forecast_rows"`
+	ForecastCostUSD float64    `json:"forecast_cost_usd"`
+}
+
+// Suggestion is a change expected to lower next month's spend. Model mix
+// suggestions move Share of a model's rows to Target; committed-use ones
+// commit CommitUSD a month to a provider.
+type Suggestion struct {
+	Kind             string  `json:"kind"`
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model,omitempty"`
+	TargetProvider   string  `json:"target_provider,omitempty"`
+	TargetModel      string  `json:"target_model,omitempty"`
+	Share            float64 `json:"share,omitempty"`
+	CommitUSD        float64 `json:"commit_usd,omitempty"`
+	CurrentCostUSD   float64 `json:"current_cost_usd"`
+	SuggestedCostUSD float64 `json:"suggested_cost_usd"`
+	SavingsUSD       float64 `json:"savings_usd"`
+	Reason           string  `json:"reason"`
+}
+
+// SpendForecast projects next month's provider spend per model
+type SpendForecast struct {
+	Month        string       `json:"month"`
+	Models       []ModelSpend `json:"models"`
+	TotalCostUSD float64      `json:"total_cost_usd"`
+	Suggestions  []Suggestion `json:"suggestions"`
+}
+
+// ForecastSpend fits a linear trend to each model's monthly tokens and rows
+// and prices the month after now's at the model's historical cost per
+// token, or per row for models billed without tokens. usage is bucketed by
+// month; the month holding now is incomplete and only reported.
+func ForecastSpend(usage []models.ProviderUsage, now time.Time, opts SpendOptions) SpendForecast {
+	now = now.UTC()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	out := SpendForecast{Month: current.AddDate(0, 1, 0).Format("2006-01"), Models: []ModelSpend{}, Suggestions: []Suggestion{}}
+
+	type key struct{ provider, model string }
+	byModel := make(map[key][]models.ProviderUsage)
+	var order []key
+	var first time.Time
+	for _, u := range usage {
+		k := key{u.Provider, u.Model}
+		if _, ok := byModel[k]; !ok {
+			order = append(order, k)
+		}
+		byModel[k] = append(byModel[k], u)
+		if p := monthOf(u.Period); first.IsZero() || p.Before(first) {
+			first = p
+		}
+	}
+	// Every model is fitted over the same months, with months it was not
+	// used in as zeros, so a model that stopped being used trends down
+	var months []time.Time
+	for m := first; !first.IsZero() && m.Before(current); m = m.AddDate(0, 1, 0) {
+		months = append(months, m)
+	}
+
+	for _, k := range order {
+		s := ModelSpend{Provider: k.provider, Model: k.model, History: make([]MonthSpend, len(months)),
+			MonthToDate: MonthSpend{Month: current.Format("2006-01")}}
+		for i, m := range months {
+			s.History[i].Month = m.Format("2006-01")
+		}
+		var tokens, rows int64
+		var cost, quality float64
+		var scored int64
+		for _, u := range byModel[k] {
+			m := monthOf(u.Period)
+			target := &s.MonthToDate
+			if m.Before(current) {
+				target = &s.History[monthIndex(first, m)]
+			}
+			target.Jobs += u.Jobs
+			target.Rows += u.Rows
+			target.Tokens += u.Tokens
+			target.CostUSD += u.CostUSD
+			tokens += u.Tokens
+			rows += u.Rows
+			cost += u.CostUSD
+			if u.AvgQuality != nil && u.ScoredJobs > 0 {
+				quality += *u.AvgQuality * float64(u.ScoredJobs)
+				scored += u.ScoredJobs
+			}
+		}
+		if tokens > 0 {
+			s.CostPer1KTokens = cost / float64(tokens) * 1000
+		}
+		if rows > 0 {
+			s.CostPer1KRows = cost / float64(rows) * 1000
+		}
+		if scored > 0 {
+			avg := quality / float64(scored)
+			s.AvgQuality = &avg
+		}
+		s.ForecastTokens = forecast(s.History, func(m MonthSpend) int64 { return m.Tokens })
+		s.ForecastRows = forecast(s.History, func(m MonthSpend) int64 { return m.Rows })
+		if s.CostPer1KTokens > 0 {
+			s.ForecastCostUSD = float64(s.ForecastTokens) * s.CostPer1KTokens / 1000
+		} else {
+			s.ForecastCostUSD = float64(s.ForecastRows) * s.CostPer1KRows / 1000
+		}
+		s.ForecastCostUSD = cents(s.ForecastCostUSD)
+		out.TotalCostUSD += s.ForecastCostUSD
+		out.Models = append(out.Models, s)
+	}
+	out.TotalCostUSD = cents(out.TotalCostUSD)
+	sort.SliceStable(out.Models, func(i, j int) bool { return out.Models[i].ForecastCostUSD > out.Models[j].ForecastCostUSD })
+
+	out.Suggestions = append(mixSuggestions(out.Models, opts), commitSuggestions(out.Models, opts)...)
+	sort.SliceStable(out.Suggestions, func(i, j int) bool { return out.Suggestions[i].SavingsUSD > out.Suggestions[j].SavingsUSD })
+	return out
+}
+
+// mixSuggestions move part of each model's rows to the cheapest model per
+// row whose average quality is within the tolerance of its own. Models
+// without quality scores are never suggested either way.
+func mixSuggestions(spend []ModelSpend, opts SpendOptions) []Suggestion {
+	var out []Suggestion
+	for _, from := range spend {
+		if from.ForecastRows == 0 || from.AvgQuality == nil || opts.MixShare <= 0 {
+			continue
+		}
+		var best *ModelSpend
+		for i, to := range spend {
+			if to.AvgQuality == nil || to.CostPer1KRows >= from.CostPer1KRows || totalRows(to) == 0 ||
+				*to.AvgQuality < *from.AvgQuality-opts.QualityTolerance {
+				continue
+			}
+			if best == nil || to.CostPer1KRows < best.CostPer1KRows {
+				best = &spend[i]
+			}
+		}
+		if best == nil {
+			continue
+		}
+		moved := float64(from.ForecastRows) * opts.MixShare
+		savings := cents(moved * (from.CostPer1KRows - best.CostPer1KRows) / 1000)
+		if savings < opts.MinSavingsUSD {
+			continue
+		}
+		out = append(out, Suggestion{
+			Kind: SuggestModelMix, Provider: from.Provider, Model: from.Model,
+			TargetProvider: best.Provider, TargetModel: best.Model, Share: opts.MixShare,
+			CurrentCostUSD: from.ForecastCostUSD, SuggestedCostUSD: cents(math.Max(0, from.ForecastCostUSD-savings)), SavingsUSD: savings,
+			Reason: fmt.Sprintf("%s/%s costs $%.4f per 1k rows against $%.4f at an average quality of %.3f against %.3f",
+				best.Provider, best.Model, best.CostPer1KRows, from.CostPer1KRows, *best.AvgQuality, *from.AvgQuality),
+		})
+	}
+	return out
+}
+
+// commitSuggestions commit to each provider the least it was paid in any of
+// the last complete months, a base load that is spent whatever the trend,
+// capped at its forecast
+func commitSuggestions(spend []ModelSpend, opts SpendOptions) []Suggestion {
+	if opts.CommitmentDiscount <= 0 || opts.CommitmentMonths <= 0 {
+		return nil
+	}
+	type provider struct {
+		monthly  []float64
+		forecast float64
+	}
+	byProvider := make(map[string]*provider)
+	var order []string
+	for _, s := range spend {
+		p, ok := byProvider[s.Provider]
+		if !ok {
+			p = &provider{monthly: make([]float64, len(s.History))}
+			byProvider[s.Provider] = p
+			order = append(order, s.Provider)
+		}
+		for i, m := range s.History {
+			p.monthly[i] += m.CostUSD
+		}
+		p.forecast += s.ForecastCostUSD
+	}
+	var out []Suggestion
+	for _, name := range order {
+		p := byProvider[name]
+		if len(p.monthly) < opts.CommitmentMonths {
+			continue
+		}
+		base := math.Inf(1)
+		for _, c := range p.monthly[len(p.monthly)-opts.CommitmentMonths:] {
+			base = math.Min(base, c)
+		}
+		commit := cents(math.Min(base, p.forecast))
+		savings := cents(commit * opts.CommitmentDiscount)
+		if commit <= 0 || savings < opts.MinSavingsUSD {
+			continue
+		}
+		out = append(out, Suggestion{
+			Kind: SuggestCommittedUse, Provider: name, CommitUSD: commit,
+			CurrentCostUSD: cents(p.forecast), SuggestedCostUSD: cents(p.forecast - savings), SavingsUSD: savings,
+			Reason: fmt.Sprintf("at least $%.2f was spent with %s in each of the last %d months; committing it at a %.0f%% discount",
+				base, name, opts.CommitmentMonths, opts.CommitmentDiscount*100),
+		})
+	}
+	return out
+}
+
+// totalRows is a model's rows over its history
+func totalRows(s ModelSpend) int64 {
+	var n int64
+	for _, m := range s.History {
+		n += m.Rows
+	}
+	return n + s.MonthToDate.Rows
+}
+
+// forecast extends the trend of a monthly series one month past the
+// incomplete current month, never below zero
+func forecast(history []MonthSpend, value func(MonthSpend) int64) int64 {
+	if len(history) == 0 {
+		return 0
+	}
+	ys := make([]float64, len(history))
+	for i, m := range history {
+		ys[i] = float64(value(m))
+	}
+	slope, intercept := fit(ys)
+	return int64(math.Round(math.Max(0, intercept+slope*float64(len(history)+1))))
+}
+
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func monthIndex(first, m time.Time) int {
+	return (m.Year()-first.Year())*12 + int(m.Month()-first.Month())
+}
+
+func cents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
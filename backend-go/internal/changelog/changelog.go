@@ -0,0 +1,241 @@
+// Package changelog validates customer-facing release notes and announces
+// published ones, in the app, to the users of the features they cover. Who
+// uses a feature is read from the analytics events users recorded recently.
+package changelog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"go.uber.org/zap"
+)
+
+// Bounds of an entry
+const (
+	MaxTitleLength = 200
+	MaxBodyLength  = 20000
+)
+
+var (
+	ErrInvalidVersion = errors.New("version must be MAJOR.MINOR.PATCH, such as 2.4.0")
+	ErrInvalidEntry   = fmt.Errorf("an entry needs a title of 1-%d characters, a body of at most %d and at least one known feature area", MaxTitleLength, MaxBodyLength)
+)
+
+// Version is a release's semantic version
+type Version struct {
+	Major, Minor, Patch int
+}
+
+// ParseVersion parses MAJOR.MINOR.PATCH, with an optional leading v
+func ParseVersion(s string) (Version, error) {
+	parts := strings.Split(strings.TrimPrefix(strings.TrimSpace(s), "v"), ".")
+	if len(parts) != 3 {
+		return Version{}, ErrInvalidVersion
+	}
+	var n [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 || p == "" || p[0] == '+' || (len(p) > 1 && p[0] == '0') {
+			return Version{}, ErrInvalidVersion
+		}
+		n[i] = v
+	}
+	return Version{Major: n[0], Minor: n[1], Patch: n[2]}, nil
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Compare returns -1, 0 or 1 as v is older than, the same as or newer than o
+func (v Version) Compare(o Version) int {
+	for _, d := range [3]int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Areas are the feature areas entries are tagged with and the analytics
+// categories that show a user uses each. Areas without categories have no
+// usage signal yet; their entries are listed but not announced.
+var Areas = map[string][]string{
+	"generation":    {"generation"},
+	"api":           {"api"},
+	"billing":       {"payment"},
+	"datasets":      nil,
+	"exports":       nil,
+	"privacy":       nil,
+	"organizations": nil,
+	"security":      nil,
+}
+
+// Normalize trims an entry, writes its version in canonical form and sorts
+// and deduplicates its feature areas, then checks it
+func Normalize(e *models.ChangelogEntry) error {
+	v, err := ParseVersion(e.Version)
+	if err != nil {
+		return err
+	}
+	e.Version = v.String()
+	e.Title = strings.TrimSpace(e.Title)
+	e.Body = strings.TrimSpace(e.Body)
+	if e.Title == "" || utf8.RuneCountInString(e.Title) > MaxTitleLength || utf8.RuneCountInString(e.Body) > MaxBodyLength {
+		return ErrInvalidEntry
+	}
+	seen := map[string]bool{}
+	features := make([]string, 0, len(e.Features))
+	for _, f := range e.Features {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if _, ok := Areas[f]; !ok {
+			return ErrInvalidEntry
+		}
+		if !seen[f] {
+			seen[f] = true
+			features = append(features, f)
+		}
+	}
+	if len(features) == 0 {
+		return ErrInvalidEntry
+	}
+	sort.Strings(features)
+	e.Features = features
+	return nil
+}
+
+// Categories returns the analytics categories that show use of any of
+// features
+func Categories(features []string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, f := range features {
+		for _, c := range Areas[f] {
+			if !seen[c] {
+				seen[c] = true
+				out = append(out, c)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Store claims published entries that have not been announced
+type Store interface {
+	// ClaimUnannounced marks the oldest published entry not yet announced
+	// as announced and returns it, or nil when there is none
+	ClaimUnannounced(ctx context.Context) (*models.ChangelogEntry, error)
+	RecordNotified(ctx context.Context, id int64, notified int) error
+}
+
+// Usage finds the users who recorded events in any of categories since a
+// time
+type Usage interface {
+	ActiveUsers(ctx context.Context, categories []string, since time.Time) ([]int64, error)
+}
+
+// Notifier records in-app notifications
+type Notifier interface {
+	Notify(ctx context.Context, n *models.Notification) error
+}
+
+// Announcer tells the users of a feature about published entries covering it
+type Announcer struct {
+	store    Store
+	usage    Usage
+	notifier Notifier
+	lookback time.Duration
+	logger   *zap.Logger
+}
+
+// NewAnnouncer creates an announcer counting users who used a feature within
+// lookback as its users
+func NewAnnouncer(store Store, usage Usage, notifier Notifier, lookback time.Duration, logger *zap.Logger) *Announcer {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Announcer{store: store, usage: usage, notifier: notifier, lookback: lookback, logger: logger}
+}
+
+// announceBatch is how many entries one run announces
+const announceBatch = 20
+
+// Run announces the entries published since the last run and returns how
+// many users were notified. An entry is claimed before its users are
+// notified, so one that fails part way is not announced twice.
+func (a *Announcer) Run(ctx context.Context, now time.Time) (int, error) {
+	var errs []error
+	total := 0
+	for i := 0; i < announceBatch; i++ {
+		e, err := a.store.ClaimUnannounced(ctx)
+		if err != nil {
+			return total, errors.Join(append(errs, err)...)
+		}
+		if e == nil {
+			break
+		}
+		n, err := a.announce(ctx, e, now)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if err := a.store.RecordNotified(ctx, e.ID, n); err != nil {
+			errs = append(errs, err)
+		}
+		total += n
+	}
+	return total, errors.Join(errs...)
+}
+
+func (a *Announcer) announce(ctx context.Context, e *models.ChangelogEntry, now time.Time) (int, error) {
+	categories := Categories(e.Features)
+	if len(categories) == 0 {
+		return 0, nil
+	}
+	users, err := a.usage.ActiveUsers(ctx, categories, now.Add(-a.lookback))
+	if err != nil {
+		return 0, fmt.Errorf("failed to find users of changelog entry %d: %w", e.ID, err)
+	}
+	key := "changelog:" + strconv.FormatInt(e.ID, 10)
+	n := 0
+	for _, userID := range users {
+		if err := a.notifier.Notify(ctx, &models.Notification{
+			UserID:    userID,
+			Category:  models.NotificationCategoryProduct,
+			Severity:  models.NotificationInfo,
+			DedupeKey: &key,
+			Title:     fmt.Sprintf("New in %s: %s", e.Version, e.Title),
+			Body:      Summary(e.Body),
+		}); err != nil {
+			a.logger.Warn("changelog notification failed", zap.Int64("entry_id", e.ID), zap.Int64("user_id", userID), zap.Error(err))
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// summaryLength bounds the part of an entry's body a notification carries
+const summaryLength = 280
+
+// Summary returns the first paragraph of a body, cut to a notification's
+// length
+func Summary(body string) string {
+	para, _, _ := strings.Cut(strings.TrimSpace(body), "\n\n")
+	para = strings.Join(strings.Fields(para), " ")
+	if utf8.RuneCountInString(para) <= summaryLength {
+		return para
+	}
+	r := []rune(para)[:summaryLength-1]
+	return strings.TrimRight(string(r), " ") + "…"
+}
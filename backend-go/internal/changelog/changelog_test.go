@@ -0,0 +1,145 @@
+// Package changelog_test provides unit tests for changelog entries and their announcement
+package changelog_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/changelog"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseVersion(t *testing.T) {
+	v, err := changelog.ParseVersion("v2.10.3")
+	require.NoError(t, err)
+	assert.Equal(t, changelog.Version{Major: 2, Minor: 10, Patch: 3}, v)
+	assert.Equal(t, "2.10.3", v.String())
+
+	for _, bad := range []string{"", "2.1", "2.1.0.4", "2.x.0", "2.01.0", "-1.0.0", "+1.0.0", "2..0"} {
+		_, err := changelog.ParseVersion(bad)
+		assert.ErrorIs(t, err, changelog.ErrInvalidVersion, bad)
+	}
+}
+
+func TestVersionCompare(t *testing.T) {
+	older := changelog.Version{Major: 2, Minor: 9, Patch: 9}
+	newer := changelog.Version{Major: 2, Minor: 10, Patch: 0}
+	assert.Equal(t, -1, older.Compare(newer), "versions compare by number, not text")
+	assert.Equal(t, 1, newer.Compare(older))
+	assert.Equal(t, 0, newer.Compare(newer))
+}
+
+func TestNormalize(t *testing.T) {
+	e := &models.ChangelogEntry{Version: "v1.2.0", Title: "  Faster exports ", Features: []string{"Exports", "generation", "exports"}}
+	require.NoError(t, changelog.Normalize(e))
+	assert.Equal(t, "1.2.0", e.Version)
+	assert.Equal(t, "Faster exports", e.Title)
+	assert.Equal(t, []string{"exports", "generation"}, []string(e.Features))
+
+	assert.ErrorIs(t, changelog.Normalize(&models.ChangelogEntry{Version: "1.2", Title: "x", Features: []string{"api"}}), changelog.ErrInvalidVersion)
+	assert.ErrorIs(t, changelog.Normalize(&models.ChangelogEntry{Version: "1.2.0", Title: " ", Features: []string{"api"}}), changelog.ErrInvalidEntry)
+	assert.ErrorIs(t, changelog.Normalize(&models.ChangelogEntry{Version: "1.2.0", Title: "x"}), changelog.ErrInvalidEntry)
+	assert.ErrorIs(t, changelog.Normalize(&models.ChangelogEntry{Version: "1.2.0", Title: "x", Features: []string{"teleport"}}), changelog.ErrInvalidEntry)
+}
+
+func TestCategories(t *testing.T) {
+	assert.Equal(t, []string{"generation", "payment"}, changelog.Categories([]string{"billing", "generation", "datasets"}))
+	assert.Empty(t, changelog.Categories([]string{"privacy"}))
+}
+
+func TestSummary(t *testing.T) {
+	assert.Equal(t, "First paragraph over two lines.", changelog.Summary("First paragraph\nover two lines.\n\nDetails follow."))
+	long := changelog.Summary(strings.Repeat("word ", 100))
+	assert.Len(t, []rune(long), 280)
+	assert.True(t, strings.HasSuffix(long, "…"))
+}
+
+type fakeStore struct {
+	pending  []*models.ChangelogEntry
+	notified map[int64]int
+}
+
+func (f *fakeStore) ClaimUnannounced(context.Context) (*models.ChangelogEntry, error) {
+	if len(f.pending) == 0 {
+		return nil, nil
+	}
+	e := f.pending[0]
+	f.pending = f.pending[1:]
+	return e, nil
+}
+
+func (f *fakeStore) RecordNotified(_ context.Context, id int64, notified int) error {
+	f.notified[id] = notified
+	return nil
+}
+
+type fakeUsage struct {
+	users map[string][]int64
+	since time.Time
+}
+
+func (f *fakeUsage) ActiveUsers(_ context.Context, categories []string, since time.Time) ([]int64, error) {
+	f.since = since
+	seen := map[int64]bool{}
+	var out []int64
+	for _, c := range categories {
+		for _, u := range f.users[c] {
+			if !seen[u] {
+				seen[u] = true
+				out = append(out, u)
+			}
+		}
+	}
+	return out, nil
+}
+
+type fakeNotifier struct {
+	sent []*models.Notification
+	fail int64
+}
+
+func (f *fakeNotifier) Notify(_ context.Context, n *models.Notification) error {
+	if n.UserID == f.fail {
+		return errors.New("store unavailable")
+	}
+	f.sent = append(f.sent, n)
+	return nil
+}
+
+func TestAnnouncerRun(t *testing.T) {
+	now := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	store := &fakeStore{
+		pending: []*models.ChangelogEntry{
+			{ID: 1, Version: "2.4.0", Title: "Multi-table jobs", Body: "Generate related tables together.\n\nMore below.", Features: []string{"generation", "api"}},
+			{ID: 2, Version: "2.4.1", Title: "Privacy wording", Features: []string{"privacy"}},
+		},
+		notified: map[int64]int{},
+	}
+	usage := &fakeUsage{users: map[string][]int64{"generation": {10, 11}, "api": {11, 12}}}
+	notifier := &fakeNotifier{fail: 12}
+	a := changelog.NewAnnouncer(store, usage, notifier, 30*24*time.Hour, nil)
+
+	n, err := a.Run(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n, "a failed notification is skipped, not retried")
+	assert.Equal(t, map[int64]int{1: 2, 2: 0}, store.notified, "entries without a usage signal are claimed but notify nobody")
+	assert.Equal(t, now.Add(-30*24*time.Hour), usage.since)
+
+	require.Len(t, notifier.sent, 2)
+	assert.ElementsMatch(t, []int64{10, 11}, []int64{notifier.sent[0].UserID, notifier.sent[1].UserID})
+	first := notifier.sent[0]
+	assert.Equal(t, models.NotificationCategoryProduct, first.Category)
+	assert.Equal(t, "New in 2.4.0: Multi-table jobs", first.Title)
+	assert.Equal(t, "Generate related tables together.", first.Body)
+	require.NotNil(t, first.DedupeKey)
+	assert.Equal(t, "changelog:1", *first.DedupeKey)
+
+	n, err = a.Run(context.Background(), now)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
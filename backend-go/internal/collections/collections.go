@@ -0,0 +1,98 @@
+// Package collections validates saved dataset searches. A collection keeps
+// the criteria, not the datasets, so what it holds changes as the catalog
+// does.
+package collections
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+const (
+	// MaxNameLength is the longest collection name
+	MaxNameLength = 100
+	// MaxQueryLength is the longest text query
+	MaxQueryLength = 200
+	// MaxWithinDays bounds UpdatedWithinDays
+	MaxWithinDays = 3650
+)
+
+// Periods are the calendar periods UpdatedPeriod accepts; each is the
+// current one, so "month" means this month
+var Periods = []string{"day", "week", "month", "quarter", "year"}
+
+var (
+	ErrInvalidName            = errors.New("collection names are 1-100 characters")
+	ErrInvalidQuery           = errors.New("query is longer than 200 characters")
+	ErrInvalidStatus          = errors.New("unknown dataset status")
+	ErrInvalidFileType        = errors.New("unknown dataset file type")
+	ErrInvalidPrivacyCategory = errors.New("unknown privacy category")
+	ErrInvalidPeriod          = errors.New("updated_period is day, week, month, quarter or year")
+	ErrInvalidRange           = errors.New("updated_within_days and min_rows cannot be negative, or days above 3650")
+)
+
+var (
+	statuses   = []models.DatasetStatus{models.DatasetProcessing, models.DatasetReady, models.DatasetArchived, models.DatasetError}
+	fileTypes  = []string{"csv", "json", "xlsx", "xls", "parquet"}
+	categories = []models.PrivacyCategory{models.PrivacyCategoryPII, models.PrivacyCategoryFinancial, models.PrivacyCategoryHealth}
+)
+
+// ValidName trims a collection name and checks its length
+func ValidName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || utf8.RuneCountInString(name) > MaxNameLength {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// Normalize validates a filter, lowercasing and de-duplicating its lists
+func Normalize(f models.DatasetFilter) (models.DatasetFilter, error) {
+	f.Query = strings.TrimSpace(f.Query)
+	if utf8.RuneCountInString(f.Query) > MaxQueryLength {
+		return f, ErrInvalidQuery
+	}
+	var err error
+	if f.Statuses, err = normalizeList(f.Statuses, statuses, ErrInvalidStatus); err != nil {
+		return f, err
+	}
+	if f.FileTypes, err = normalizeList(f.FileTypes, fileTypes, ErrInvalidFileType); err != nil {
+		return f, err
+	}
+	if f.PrivacyCategories, err = normalizeList(f.PrivacyCategories, categories, ErrInvalidPrivacyCategory); err != nil {
+		return f, err
+	}
+	f.UpdatedPeriod = strings.ToLower(strings.TrimSpace(f.UpdatedPeriod))
+	if f.UpdatedPeriod != "" {
+		if _, err := normalizeList([]string{f.UpdatedPeriod}, Periods, ErrInvalidPeriod); err != nil {
+			return f, err
+		}
+	}
+	if f.UpdatedWithinDays < 0 || f.UpdatedWithinDays > MaxWithinDays || f.MinRows < 0 {
+		return f, ErrInvalidRange
+	}
+	return f, nil
+}
+
+func normalizeList[T ~string](in, allowed []T, invalid error) ([]T, error) {
+	if len(in) == 0 {
+		return nil, nil
+	}
+	out := make([]T, 0, len(in))
+	seen := map[T]bool{}
+	for _, v := range in {
+		v = T(strings.ToLower(strings.TrimSpace(string(v))))
+		if !slices.Contains(allowed, v) {
+			return nil, invalid
+		}
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
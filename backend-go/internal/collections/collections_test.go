@@ -0,0 +1,60 @@
+// Package collections_test provides unit tests for saved dataset searches
+package collections_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/collections"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	f, err := collections.Normalize(models.DatasetFilter{
+		Query:             "  claims ",
+		Statuses:          []models.DatasetStatus{"Ready", "ready"},
+		FileTypes:         []string{"CSV", "parquet"},
+		PrivacyCategories: []models.PrivacyCategory{"health"},
+		UpdatedPeriod:     "Month",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "claims", f.Query)
+	assert.Equal(t, []models.DatasetStatus{models.DatasetReady}, f.Statuses)
+	assert.Equal(t, []string{"csv", "parquet"}, f.FileTypes)
+	assert.Equal(t, []models.PrivacyCategory{models.PrivacyCategoryHealth}, f.PrivacyCategories)
+	assert.Equal(t, "month", f.UpdatedPeriod)
+
+	empty, err := collections.Normalize(models.DatasetFilter{})
+	require.NoError(t, err)
+	assert.Nil(t, empty.Statuses)
+}
+
+func TestNormalizeRejects(t *testing.T) {
+	cases := map[error]models.DatasetFilter{
+		collections.ErrInvalidQuery:           {Query: strings.Repeat("a", 201)},
+		collections.ErrInvalidStatus:          {Statuses: []models.DatasetStatus{"deleted"}},
+		collections.ErrInvalidFileType:        {FileTypes: []string{"exe"}},
+		collections.ErrInvalidPrivacyCategory: {PrivacyCategories: []models.PrivacyCategory{"hipaa"}},
+		collections.ErrInvalidPeriod:          {UpdatedPeriod: "fortnight"},
+		collections.ErrInvalidRange:           {MinRows: -1},
+	}
+	for want, f := range cases {
+		_, err := collections.Normalize(f)
+		assert.ErrorIs(t, err, want)
+	}
+	_, err := collections.Normalize(models.DatasetFilter{UpdatedWithinDays: collections.MaxWithinDays + 1})
+	assert.ErrorIs(t, err, collections.ErrInvalidRange)
+}
+
+func TestValidName(t *testing.T) {
+	name, err := collections.ValidName("  HIPAA datasets updated this month ")
+	require.NoError(t, err)
+	assert.Equal(t, "HIPAA datasets updated this month", name)
+
+	_, err = collections.ValidName("   ")
+	assert.ErrorIs(t, err, collections.ErrInvalidName)
+	_, err = collections.ValidName(strings.Repeat("é", collections.MaxNameLength+1))
+	assert.ErrorIs(t, err, collections.ErrInvalidName)
+}
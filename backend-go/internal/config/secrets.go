@@ -0,0 +1,380 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"google.golang.org/api/option"
+	secretmanager "google.golang.org/api/secretmanager/v1"
+)
+
+// SecretProvider reads secrets from one backend. A setting refers to a
+// secret as scheme://name, optionally followed by #key to pick one key of
+// a secret holding a JSON object.
+type SecretProvider interface {
+	// Scheme is the reference prefix the provider handles, e.g. gcp-sm
+	Scheme() string
+	// GetSecret returns the secret called name
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// SecretStore resolves secret references through its providers and caches
+// the values for a TTL. Refresh fetches every cached secret again and tells
+// the OnChange listeners about rotated ones.
+type SecretStore struct {
+	ttl       time.Duration
+	mu        sync.RWMutex
+	providers map[string]SecretProvider
+	cache     map[string]cachedSecret
+	listeners []func(ref string)
+}
+
+// NewSecretStore creates a store caching secrets for ttl; 0 caches them
+// until the next Refresh
+func NewSecretStore(ttl time.Duration, providers ...SecretProvider) *SecretStore {
+	s := &SecretStore{ttl: ttl, providers: map[string]SecretProvider{}, cache: map[string]cachedSecret{}}
+	for _, p := range providers {
+		s.providers[p.Scheme()] = p
+	}
+	return s
+}
+
+// IsRef reports whether value refers to a secret of one of the providers
+// rather than holding a value
+func (s *SecretStore) IsRef(value string) bool {
+	scheme, _, ok := strings.Cut(value, "://")
+	if !ok {
+		return false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, known := s.providers[scheme]
+	return known
+}
+
+// Resolve returns the secret value refers to, or value itself when it is
+// not a reference
+func (s *SecretStore) Resolve(ctx context.Context, value string) (string, error) {
+	if !s.IsRef(value) {
+		return value, nil
+	}
+	s.mu.RLock()
+	cached, hit := s.cache[value]
+	s.mu.RUnlock()
+	if hit && (s.ttl == 0 || time.Since(cached.fetchedAt) < s.ttl) {
+		return cached.value, nil
+	}
+	secret, err := s.fetch(ctx, value)
+	if err != nil {
+		if hit {
+			// A stale value beats none while the backend is unavailable
+			return cached.value, nil
+		}
+		return "", err
+	}
+	return secret, nil
+}
+
+func (s *SecretStore) fetch(ctx context.Context, ref string) (string, error) {
+	scheme, rest, _ := strings.Cut(ref, "://")
+	name, key, _ := strings.Cut(rest, "#")
+	s.mu.RLock()
+	provider := s.providers[scheme]
+	s.mu.RUnlock()
+	secret, err := provider.GetSecret(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", ref, err)
+	}
+	if key != "" {
+		if secret, err = jsonKey(secret, key); err != nil {
+			return "", fmt.Errorf("failed to read secret %s: %w", ref, err)
+		}
+	}
+	s.mu.Lock()
+	s.cache[ref] = cachedSecret{value: secret, fetchedAt: time.Now()}
+	s.mu.Unlock()
+	return secret, nil
+}
+
+func jsonKey(secret, key string) (string, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret is not a JSON object")
+	}
+	switch v := fields[key].(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", fmt.Errorf("secret has no key %q", key)
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// OnChange registers fn to be called with the reference of every secret a
+// Refresh finds rotated
+func (s *SecretStore) OnChange(fn func(ref string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, fn)
+}
+
+// Refresh fetches every cached secret again. Secrets that fail keep their
+// cached value; the first error is returned.
+func (s *SecretStore) Refresh(ctx context.Context) error {
+	s.mu.RLock()
+	previous := make(map[string]string, len(s.cache))
+	for ref, c := range s.cache {
+		previous[ref] = c.value
+	}
+	listeners := append([]func(string){}, s.listeners...)
+	s.mu.RUnlock()
+
+	var first error
+	for ref, old := range previous {
+		secret, err := s.fetch(ctx, ref)
+		if err != nil {
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		if secret != old {
+			for _, fn := range listeners {
+				fn(ref)
+			}
+		}
+	}
+	return first
+}
+
+// Run refreshes the cached secrets every interval until ctx is done,
+// passing failures to onError
+func (s *SecretStore) Run(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+// secretFields are the settings that may name a secret instead of holding
+// it, by environment variable
+func (c *Config) secretFields() map[string]*string {
+	return map[string]*string{
+		"DATABASE_URL":          &c.DatabaseURL,
+		"JWT_SECRET_KEY":        &c.JwtSecret,
+		"STRIPE_SECRET_KEY":     &c.StripeSecretKey,
+		"STRIPE_WEBHOOK_SECRET": &c.StripeWebhookSecret,
+		"PADDLE_API_KEY":        &c.PaddleAPIKey,
+		"PADDLE_WEBHOOK_SECRET": &c.PaddleWebhookSecret,
+		"SMTP_USERNAME":         &c.SMTPUsername,
+		"SMTP_PASSWORD":         &c.SMTPPassword,
+		"EVIDENCE_SIGNING_KEY":  &c.EvidenceSigningKey,
+		"EXPORT_SIGNING_KEYS":   &c.ExportSigningKeys,
+	}
+}
+
+// HasSecretRefs reports whether any setting names a secret in store
+func (c *Config) HasSecretRefs(store *SecretStore) bool {
+	for _, v := range c.secretFields() {
+		if store.IsRef(*v) {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveSecrets replaces the settings that name a secret with its value
+func (c *Config) ResolveSecrets(ctx context.Context, store *SecretStore) error {
+	for env, field := range c.secretFields() {
+		v, err := store.Resolve(ctx, *field)
+		if err != nil {
+			return fmt.Errorf("%s: %w", env, err)
+		}
+		*field = v
+	}
+	return nil
+}
+
+// lazyProvider creates its provider on first use, so credentials for a
+// backend are only needed when a setting refers to it
+type lazyProvider struct {
+	scheme string
+	create func(ctx context.Context) (SecretProvider, error)
+	once   sync.Once
+	p      SecretProvider
+	err    error
+}
+
+func (l *lazyProvider) Scheme() string { return l.scheme }
+
+func (l *lazyProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	l.once.Do(func() { l.p, l.err = l.create(ctx) })
+	if l.err != nil {
+		return "", l.err
+	}
+	return l.p.GetSecret(ctx, name)
+}
+
+// DefaultSecretStore reads gcp-sm:// references from GCP Secret Manager
+// with the application default credentials and aws-sm:// references from
+// AWS Secrets Manager with the default AWS credential chain
+func DefaultSecretStore(ttl time.Duration, awsRegion string) *SecretStore {
+	return NewSecretStore(ttl,
+		&lazyProvider{scheme: "gcp-sm", create: func(ctx context.Context) (SecretProvider, error) {
+			return NewGCPSecretManager(ctx)
+		}},
+		&lazyProvider{scheme: "aws-sm", create: func(ctx context.Context) (SecretProvider, error) {
+			return NewAWSSecretsManager(ctx, awsRegion)
+		}},
+	)
+}
+
+// GCPSecretManager reads secret versions such as
+// projects/p/secrets/s/versions/latest
+type GCPSecretManager struct {
+	versions *secretmanager.ProjectsSecretsVersionsService
+}
+
+// NewGCPSecretManager creates a provider authenticated with the
+// application default credentials
+func NewGCPSecretManager(ctx context.Context, opts ...option.ClientOption) (*GCPSecretManager, error) {
+	opts = append([]option.ClientOption{option.WithScopes(secretmanager.CloudPlatformScope)}, opts...)
+	svc, err := secretmanager.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Secret Manager client: %w", err)
+	}
+	return &GCPSecretManager{versions: svc.Projects.Secrets.Versions}, nil
+}
+
+func (g *GCPSecretManager) Scheme() string { return "gcp-sm" }
+
+func (g *GCPSecretManager) GetSecret(ctx context.Context, name string) (string, error) {
+	resp, err := g.versions.Access(name).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	if resp.Payload == nil {
+		return "", fmt.Errorf("secret %s has no payload", name)
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// AWSSecretsManager reads secrets by name or ARN through the Secrets
+// Manager JSON API
+type AWSSecretsManager struct {
+	Region      string
+	Credentials aws.CredentialsProvider
+	// Endpoint overrides https://secretsmanager.<region>.amazonaws.com
+	Endpoint string
+	init     sync.Once
+	client   *http.Client
+	signer   *v4.Signer
+}
+
+// NewAWSSecretsManager creates a provider using the default AWS credential
+// chain; ARNs name their own region
+func NewAWSSecretsManager(ctx context.Context, region string) (*AWSSecretsManager, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS credentials: %w", err)
+	}
+	return &AWSSecretsManager{Region: cfg.Region, Credentials: cfg.Credentials}, nil
+}
+
+func (a *AWSSecretsManager) Scheme() string { return "aws-sm" }
+
+type awsSecretValue struct {
+	SecretString *string `json:"SecretString"`
+	SecretBinary []byte  `json:"SecretBinary"`
+}
+
+type awsError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (a *AWSSecretsManager) GetSecret(ctx context.Context, name string) (string, error) {
+	region := a.Region
+	// arn:aws:secretsmanager:<region>:<account>:secret:<name>
+	if parts := strings.SplitN(name, ":", 6); len(parts) == 6 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", region)
+	}
+	a.init.Do(func() {
+		a.client = &http.Client{Timeout: 10 * time.Second}
+		a.signer = v4.NewSigner()
+	})
+
+	body, _ := json.Marshal(map[string]string{"SecretId": name})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	creds, err := a.Credentials.Retrieve(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := a.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "secretsmanager", region, time.Now()); err != nil {
+		return "", err
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e awsError
+		_ = json.Unmarshal(raw, &e)
+		return "", fmt.Errorf("secrets manager: %s (status %d): %s", e.Type, resp.StatusCode, e.Message)
+	}
+	var out awsSecretValue
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return "", fmt.Errorf("failed to decode secret value: %w", err)
+	}
+	if out.SecretString != nil {
+		return *out.SecretString, nil
+	}
+	return string(out.SecretBinary), nil
+}
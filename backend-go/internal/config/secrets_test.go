@@ -0,0 +1,146 @@
+// Package config_test provides unit tests for secret manager settings
+package config_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProvider struct {
+	mu      sync.Mutex
+	secrets map[string]string
+	calls   int
+	err     error
+}
+
+func (f *fakeProvider) Scheme() string { return "fake-sm" }
+
+func (f *fakeProvider) GetSecret(_ context.Context, name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.err != nil {
+		return "", f.err
+	}
+	v, ok := f.secrets[name]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func TestSecretStoreResolve(t *testing.T) {
+	p := &fakeProvider{secrets: map[string]string{
+		"db":   "postgres://app:pw@db/synthos?sslmode=require",
+		"smtp": `{"username":"mailer","password":"hunter2","port":587}`,
+	}}
+	store := config.NewSecretStore(time.Hour, p)
+	ctx := context.Background()
+
+	v, err := store.Resolve(ctx, "postgres://plain@localhost/db")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://plain@localhost/db", v, "values that are not references pass through")
+	assert.False(t, store.IsRef("gcp-sm://projects/p/secrets/s/versions/1"), "only registered schemes are references")
+
+	v, err = store.Resolve(ctx, "fake-sm://db")
+	require.NoError(t, err)
+	assert.Equal(t, "postgres://app:pw@db/synthos?sslmode=require", v)
+	_, _ = store.Resolve(ctx, "fake-sm://db")
+	assert.Equal(t, 1, p.calls, "values are cached")
+
+	v, err = store.Resolve(ctx, "fake-sm://smtp#password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", v)
+	v, err = store.Resolve(ctx, "fake-sm://smtp#port")
+	require.NoError(t, err)
+	assert.Equal(t, "587", v)
+	_, err = store.Resolve(ctx, "fake-sm://smtp#missing")
+	assert.Error(t, err)
+	_, err = store.Resolve(ctx, "fake-sm://nope")
+	assert.Error(t, err)
+}
+
+func TestSecretStoreRefresh(t *testing.T) {
+	p := &fakeProvider{secrets: map[string]string{"stripe": "sk_old"}}
+	store := config.NewSecretStore(0, p)
+	ctx := context.Background()
+	_, err := store.Resolve(ctx, "fake-sm://stripe")
+	require.NoError(t, err)
+
+	var rotated []string
+	store.OnChange(func(ref string) { rotated = append(rotated, ref) })
+	require.NoError(t, store.Refresh(ctx))
+	assert.Empty(t, rotated)
+
+	p.secrets["stripe"] = "sk_new"
+	require.NoError(t, store.Refresh(ctx))
+	assert.Equal(t, []string{"fake-sm://stripe"}, rotated)
+	v, _ := store.Resolve(ctx, "fake-sm://stripe")
+	assert.Equal(t, "sk_new", v)
+
+	p.err = errors.New("unavailable")
+	assert.Error(t, store.Refresh(ctx))
+	v, err = store.Resolve(ctx, "fake-sm://stripe")
+	require.NoError(t, err)
+	assert.Equal(t, "sk_new", v, "a failed refresh keeps the cached value")
+}
+
+func TestResolveSecrets(t *testing.T) {
+	p := &fakeProvider{secrets: map[string]string{"jwt": strings.Repeat("k", 40), "smtp": "pw"}}
+	store := config.NewSecretStore(time.Minute, p)
+	cfg := &config.Config{JwtSecret: "fake-sm://jwt", SMTPPassword: "fake-sm://smtp", DatabaseURL: "postgres://localhost/db"}
+	assert.True(t, cfg.HasSecretRefs(store))
+
+	require.NoError(t, cfg.ResolveSecrets(context.Background(), store))
+	assert.Equal(t, strings.Repeat("k", 40), cfg.JwtSecret)
+	assert.Equal(t, "pw", cfg.SMTPPassword)
+	assert.Equal(t, "postgres://localhost/db", cfg.DatabaseURL)
+	assert.False(t, cfg.HasSecretRefs(store))
+
+	cfg.StripeSecretKey = "fake-sm://missing"
+	err := cfg.ResolveSecrets(context.Background(), store)
+	assert.ErrorContains(t, err, "STRIPE_SECRET_KEY")
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-1/secretsmanager/aws4_request")
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		switch body["SecretId"] {
+		case "arn:aws:secretsmanager:eu-west-1:123456789012:secret:synthos/db":
+			_, _ = w.Write([]byte(`{"Name":"synthos/db","SecretString":"s3cret"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","Message":"Secrets Manager can't find the specified secret."}`))
+		}
+	}))
+	defer srv.Close()
+
+	sm := &config.AWSSecretsManager{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		Endpoint:    srv.URL,
+	}
+	v, err := sm.GetSecret(context.Background(), "arn:aws:secretsmanager:eu-west-1:123456789012:secret:synthos/db")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", v)
+
+	sm.Region = "eu-west-1"
+	_, err = sm.GetSecret(context.Background(), "missing")
+	assert.ErrorContains(t, err, "ResourceNotFoundException")
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"net/url"
+	"reflect"
+	"regexp"
+)
+
+// sensitiveField matches settings whose values are never shown, only whether
+// they are set. Key IDs name a key without revealing it.
+var sensitiveField = regexp.MustCompile(`(Secret|Key|Keys|Password|Token|DSN|Salt)$`)
+
+// Snapshot returns the settings keyed by field name, as evidence of how the
+// service is configured. Secrets show only whether they are set and URLs
+// lose their credentials.
+func (c *Config) Snapshot() map[string]any {
+	out := make(map[string]any)
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Type.Kind() == reflect.Pointer {
+			continue
+		}
+		val := v.Field(i).Interface()
+		switch s, isString := val.(string); {
+		case isString && sensitiveField.MatchString(f.Name):
+			if s != "" {
+				val = "[redacted]"
+			}
+		case isString && s != "":
+			if u, err := url.Parse(s); err == nil && u.User != nil {
+				val = u.Redacted()
+			}
+		}
+		out[f.Name] = val
+	}
+	return out
+}
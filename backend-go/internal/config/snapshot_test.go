@@ -0,0 +1,30 @@
+// Package config_test provides unit tests for configuration snapshots
+package config_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	cfg := &config.Config{
+		Environment:          "production",
+		JwtSecret:            "super-secret",
+		DownloadSigningKeyID: "k2",
+		DatabaseURL:          "postgres://app:pw@db:5432/synthos",
+		StorageBaseURL:       "https://cdn.example.com",
+		GenerationWorkers:    4,
+		Secrets:              config.NewSecretStore(0),
+	}
+	snap := cfg.Snapshot()
+	assert.Equal(t, "production", snap["Environment"])
+	assert.Equal(t, "[redacted]", snap["JwtSecret"])
+	assert.Equal(t, "", snap["StripeSecretKey"], "unset secrets show they are unset")
+	assert.Equal(t, "k2", snap["DownloadSigningKeyID"])
+	assert.Equal(t, "postgres://app:xxxxx@db:5432/synthos", snap["DatabaseURL"])
+	assert.Equal(t, "https://cdn.example.com", snap["StorageBaseURL"])
+	assert.Equal(t, 4, snap["GenerationWorkers"])
+	assert.NotContains(t, snap, "Secrets")
+}
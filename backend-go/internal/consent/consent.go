@@ -0,0 +1,91 @@
+// Package consent tracks which versions of the terms of service and privacy
+// policy each user accepted, and which kinds of optional email they agreed
+// to receive. A new major version of a document has to be accepted again
+// before the API can be used; minor versions do not.
+package consent
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+var (
+	ErrUnknownDocument = errors.New("unknown legal document")
+	ErrStaleVersion    = errors.New("only the current version of a document can be accepted")
+)
+
+// Documents maps each legal document to its current version, such as
+// "2.1"; the part before the first dot is the major version
+type Documents map[models.ConsentKind]string
+
+// Requirement is a document the user has to accept before going on
+type Requirement struct {
+	Kind    models.ConsentKind `json:"kind"`
+	Version string             `json:"version"`
+	// AcceptedVersion is the older version on record, if any
+	AcceptedVersion string `json:"accepted_version,omitempty"`
+}
+
+// Major returns the major part of a version, or 0 when it has none
+func Major(version string) int {
+	head, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".")
+	n, err := strconv.Atoi(head)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// Outstanding returns the documents whose current version the user still
+// has to accept, given their latest record of each kind: those never
+// accepted and those whose major version moved on since.
+func Outstanding(docs Documents, latest map[models.ConsentKind]models.ConsentRecord) []Requirement {
+	var out []Requirement
+	for kind, version := range docs {
+		if version == "" {
+			continue
+		}
+		rec, ok := latest[kind]
+		if ok && rec.Granted && Major(rec.Version) >= Major(version) {
+			continue
+		}
+		req := Requirement{Kind: kind, Version: version}
+		if ok {
+			req.AcceptedVersion = rec.Version
+		}
+		out = append(out, req)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Kind < out[j].Kind })
+	return out
+}
+
+// CheckAcceptance reports whether version of a document may be accepted;
+// a page left open across a release must not accept the old text
+func CheckAcceptance(docs Documents, kind models.ConsentKind, version string) error {
+	current, ok := docs[kind]
+	if !ok || current == "" {
+		return ErrUnknownDocument
+	}
+	if strings.TrimSpace(version) != current {
+		return ErrStaleVersion
+	}
+	return nil
+}
+
+// EmailKinds are the consent flags optional email is sent under
+var EmailKinds = []models.ConsentKind{models.ConsentMarketingEmails, models.ConsentProductUpdates}
+
+// ForCategory returns the consent a notification category needs, if any
+func ForCategory(category string) (models.ConsentKind, bool) {
+	switch category {
+	case models.NotificationCategoryMarketing:
+		return models.ConsentMarketingEmails, true
+	case models.NotificationCategoryProduct:
+		return models.ConsentProductUpdates, true
+	}
+	return "", false
+}
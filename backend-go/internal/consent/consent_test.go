@@ -0,0 +1,55 @@
+// Package consent_test provides unit tests for document acceptance and email consent
+package consent_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/consent"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMajor(t *testing.T) {
+	assert.Equal(t, 2, consent.Major("2.1"))
+	assert.Equal(t, 3, consent.Major("v3.0.4"))
+	assert.Equal(t, 1, consent.Major("1"))
+	assert.Equal(t, 0, consent.Major("draft"))
+}
+
+func TestOutstanding(t *testing.T) {
+	docs := consent.Documents{models.ConsentTerms: "2.1", models.ConsentPrivacyPolicy: "1.3"}
+	accepted := func(kind models.ConsentKind, version string) models.ConsentRecord {
+		return models.ConsentRecord{Kind: kind, Version: version, Granted: true}
+	}
+
+	assert.Equal(t, []consent.Requirement{
+		{Kind: models.ConsentPrivacyPolicy, Version: "1.3"},
+		{Kind: models.ConsentTerms, Version: "2.1"},
+	}, consent.Outstanding(docs, nil), "new users accept everything")
+
+	// Minor releases keep earlier acceptances valid
+	latest := map[models.ConsentKind]models.ConsentRecord{
+		models.ConsentTerms:         accepted(models.ConsentTerms, "2.0"),
+		models.ConsentPrivacyPolicy: accepted(models.ConsentPrivacyPolicy, "1.1"),
+	}
+	assert.Empty(t, consent.Outstanding(docs, latest))
+
+	latest[models.ConsentTerms] = accepted(models.ConsentTerms, "1.4")
+	assert.Equal(t, []consent.Requirement{{Kind: models.ConsentTerms, Version: "2.1", AcceptedVersion: "1.4"}},
+		consent.Outstanding(docs, latest))
+}
+
+func TestCheckAcceptance(t *testing.T) {
+	docs := consent.Documents{models.ConsentTerms: "2.1"}
+	assert.NoError(t, consent.CheckAcceptance(docs, models.ConsentTerms, "2.1"))
+	assert.ErrorIs(t, consent.CheckAcceptance(docs, models.ConsentTerms, "2.0"), consent.ErrStaleVersion)
+	assert.ErrorIs(t, consent.CheckAcceptance(docs, models.ConsentMarketingEmails, "1"), consent.ErrUnknownDocument)
+}
+
+func TestForCategory(t *testing.T) {
+	kind, ok := consent.ForCategory(models.NotificationCategoryProduct)
+	assert.True(t, ok)
+	assert.Equal(t, models.ConsentProductUpdates, kind)
+	_, ok = consent.ForCategory(models.NotificationCategoryJobs)
+	assert.False(t, ok)
+}
@@ -2,8 +2,10 @@ package db
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 )
@@ -12,13 +14,14 @@ type Database struct {
 	SQL *sqlx.DB
 }
 
-func New(databaseURL string) (*Database, error) {
-	// register pgx stdlib driver implicitly by importing stdlib
-	_ = stdlib.GetDefaultDriver()
-	db, err := sqlx.Open("pgx", databaseURL)
+// New opens the connection pool; every statement run on it is bounded and
+// measured as opts say
+func New(databaseURL string, opts Options) (*Database, error) {
+	config, err := pgx.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, err
 	}
+	db := sqlx.NewDb(sql.OpenDB(Instrument(stdlib.GetConnector(*config), opts)), "pgx")
 	// Optimized connection pool settings
 	db.SetMaxOpenConns(25)                  // Reduced from 50 to prevent connection exhaustion
 	db.SetMaxIdleConns(5)                   // Reduced from 10 to be more conservative
@@ -0,0 +1,318 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.uber.org/zap"
+)
+
+// maxLoggedSQL bounds the statement text written to the slow query log
+const maxLoggedSQL = 500
+
+// ErrQueryTimeout matches statements cut off by the query timeout; it also
+// matches context.DeadlineExceeded
+var ErrQueryTimeout = errors.New("query timed out")
+
+var (
+	queryDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "Database statement duration in seconds, rows read included",
+			Buckets: []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+		},
+		[]string{"query"},
+	)
+	queryTimeouts = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_query_timeouts_total",
+			Help: "Database statements cut off by the query timeout",
+		},
+		[]string{"query"},
+	)
+	slowQueries = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "db_slow_queries_total",
+			Help: "Database statements slower than the slow query threshold",
+		},
+		[]string{"query"},
+	)
+)
+
+// Options bounds and measures every statement run through the pool
+type Options struct {
+	// QueryTimeout bounds each statement, rows read included, unless its
+	// context has an earlier deadline; 0 leaves statements unbounded
+	QueryTimeout time.Duration
+	// Statements slower than SlowQuery are logged; 0 logs none
+	SlowQuery time.Duration
+	Logger    *zap.Logger
+}
+
+type queryNameKey struct{}
+type queryTimeoutKey struct{}
+
+// WithQueryName names the statements run with ctx in metrics and logs.
+// Unnamed statements are named after the function that ran them, such as
+// repo.GenerationRepo.Insert.
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, name)
+}
+
+// WithQueryTimeout overrides the query timeout for statements run with
+// ctx, for the few that are expected to be slow; 0 lifts it
+func WithQueryTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, queryTimeoutKey{}, timeout)
+}
+
+// Instrument wraps a connector so every statement run on its connections
+// is bounded by the query timeout, measured per query name and logged when
+// slow. Prepared statements and transactions pass through; the statements
+// run inside a transaction are measured like any other.
+func Instrument(c driver.Connector, opts Options) driver.Connector {
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+	return &connector{Connector: c, opts: opts}
+}
+
+type connector struct {
+	driver.Connector
+	opts Options
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	inner, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: inner, opts: c.opts}, nil
+}
+
+// conn passes every optional driver interface through to the wrapped
+// connection; database/sql only sees the ones it implements
+type conn struct {
+	driver.Conn
+	opts Options
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	s := c.start(ctx, query)
+	res, err := execer.ExecContext(s.ctx, query, args)
+	return res, s.finish(err)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	// Rows are read with the statement's context, so the statement ends,
+	// and its timeout is released, when they are closed
+	s := c.start(ctx, query)
+	rows, err := queryer.QueryContext(s.ctx, query, args)
+	if err != nil {
+		return nil, s.finish(err)
+	}
+	return &instrumentedRows{Rows: rows, stmt: s}, nil
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, query)
+	}
+	return c.Conn.Prepare(query)
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) CheckNamedValue(v *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// statement is one statement in flight
+type statement struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	parent  context.Context
+	name    string
+	query   string
+	timeout time.Duration
+	began   time.Time
+	opts    Options
+}
+
+func (c *conn) start(ctx context.Context, query string) *statement {
+	s := &statement{parent: ctx, query: query, began: time.Now(), opts: c.opts, timeout: c.opts.QueryTimeout}
+	if name, ok := ctx.Value(queryNameKey{}).(string); ok && name != "" {
+		s.name = name
+	} else {
+		s.name = caller()
+	}
+	if timeout, ok := ctx.Value(queryTimeoutKey{}).(time.Duration); ok {
+		s.timeout = timeout
+	}
+	if s.timeout > 0 {
+		s.ctx, s.cancel = context.WithTimeout(ctx, s.timeout)
+	} else {
+		s.ctx, s.cancel = ctx, func() {}
+	}
+	return s
+}
+
+// timedOut reports whether the query timeout, and not the caller's
+// context, cut the statement off
+func (s *statement) timedOut() bool {
+	return s.ctx.Err() == context.DeadlineExceeded && s.parent.Err() == nil
+}
+
+// wrap marks an error of a statement that timed out
+func (s *statement) wrap(err error) error {
+	if err == nil || !s.timedOut() {
+		return err
+	}
+	return &timeoutError{name: s.name, timeout: s.timeout, err: err}
+}
+
+// finish records the statement and returns its error, marked when it
+// timed out
+func (s *statement) finish(err error) error {
+	took := time.Since(s.began)
+	timedOut := s.timedOut()
+	err = s.wrap(err)
+	s.cancel()
+
+	queryDuration.WithLabelValues(s.name).Observe(took.Seconds())
+	if timedOut {
+		queryTimeouts.WithLabelValues(s.name).Inc()
+		s.opts.Logger.Warn("query timed out",
+			zap.String("query", s.name),
+			zap.Duration("timeout", s.timeout),
+			zap.String("sql", truncate(s.query)),
+		)
+	} else if s.opts.SlowQuery > 0 && took >= s.opts.SlowQuery {
+		slowQueries.WithLabelValues(s.name).Inc()
+		s.opts.Logger.Warn("slow query",
+			zap.String("query", s.name),
+			zap.Duration("duration", took),
+			zap.String("sql", truncate(s.query)),
+		)
+	}
+	return err
+}
+
+type instrumentedRows struct {
+	driver.Rows
+	stmt   *statement
+	closed bool
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == io.EOF {
+		return err
+	}
+	return r.stmt.wrap(err)
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.Rows.Close()
+	if !r.closed {
+		r.closed = true
+		r.stmt.finish(nil)
+	}
+	return err
+}
+
+type timeoutError struct {
+	name    string
+	timeout time.Duration
+	err     error
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s: %v", e.name, e.timeout, e.err)
+}
+
+func (e *timeoutError) Unwrap() error { return e.err }
+
+func (e *timeoutError) Is(target error) bool {
+	return target == ErrQueryTimeout || target == context.DeadlineExceeded
+}
+
+// caller names a statement after the first function outside database/sql,
+// sqlx and this package that ran it
+func caller() string {
+	pcs := make([]uintptr, 16)
+	n := runtime.Callers(4, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		fn := frame.Function
+		if fn != "" && !strings.HasPrefix(fn, "database/sql.") && !strings.HasPrefix(fn, "github.com/jmoiron/sqlx.") &&
+			!strings.Contains(fn, "/internal/db.") && !strings.HasPrefix(fn, "runtime.") {
+			return queryName(fn)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// queryName shortens a function name such as
+// ".../internal/repo.(*GenerationRepo).Insert" to "repo.GenerationRepo.Insert"
+func queryName(fn string) string {
+	if i := strings.LastIndex(fn, "/"); i >= 0 {
+		fn = fn[i+1:]
+	}
+	return strings.NewReplacer("(*", "", ")", "").Replace(fn)
+}
+
+func truncate(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	if len(query) > maxLoggedSQL {
+		return query[:maxLoggedSQL] + "..."
+	}
+	return query
+}
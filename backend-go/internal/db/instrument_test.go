@@ -0,0 +1,72 @@
+// Package db_test provides unit tests for statement instrumentation
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/db"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// dsnConnector opens connections to one sqlmock DSN
+type dsnConnector struct {
+	dsn string
+	drv driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.drv.Open(c.dsn) }
+func (c dsnConnector) Driver() driver.Driver                         { return c.drv }
+
+func open(t *testing.T, opts db.Options) (*sqlx.DB, sqlmock.Sqlmock, *observer.ObservedLogs) {
+	raw, mock, err := sqlmock.NewWithDSN(t.Name(), sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	t.Cleanup(func() { raw.Close() })
+	core, logs := observer.New(zapcore.WarnLevel)
+	opts.Logger = zap.New(core)
+	conn := db.Instrument(dsnConnector{dsn: t.Name(), drv: raw.Driver()}, opts)
+	return sqlx.NewDb(sql.OpenDB(conn), "sqlmock"), mock, logs
+}
+
+func TestInstrumentTimesOutStatements(t *testing.T) {
+	sqlDB, mock, logs := open(t, db.Options{QueryTimeout: 20 * time.Millisecond})
+	mock.ExpectExec("UPDATE jobs SET status = 'failed'").WillDelayFor(time.Second).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	_, err := sqlDB.ExecContext(context.Background(), "UPDATE jobs SET status = 'failed'")
+	assert.ErrorIs(t, err, db.ErrQueryTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, 1, logs.FilterMessage("query timed out").Len())
+	assert.Equal(t, "db_test.TestInstrumentTimesOutStatements", logs.All()[0].ContextMap()["query"], "statements are named after their caller")
+
+	mock.ExpectExec("VACUUM jobs").WillDelayFor(50 * time.Millisecond).WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = sqlDB.ExecContext(db.WithQueryTimeout(context.Background(), 0), "VACUUM jobs")
+	assert.NoError(t, err, "the timeout can be lifted")
+}
+
+func TestInstrumentLogsSlowQueries(t *testing.T) {
+	sqlDB, mock, logs := open(t, db.Options{QueryTimeout: time.Second, SlowQuery: 20 * time.Millisecond})
+	mock.ExpectQuery("SELECT id FROM jobs").WillDelayFor(30 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+
+	var ids []int64
+	require.NoError(t, sqlDB.SelectContext(db.WithQueryName(context.Background(), "jobs.list"), &ids, "SELECT id FROM jobs"))
+	assert.Equal(t, []int64{1, 2}, ids, "rows stay readable after the statement returns")
+	var n int
+	require.NoError(t, sqlDB.GetContext(context.Background(), &n, "SELECT 1"))
+
+	slow := logs.FilterMessage("slow query").All()
+	require.Len(t, slow, 1)
+	assert.Equal(t, "jobs.list", slow[0].ContextMap()["query"])
+	assert.Equal(t, "SELECT id FROM jobs", slow[0].ContextMap()["sql"])
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
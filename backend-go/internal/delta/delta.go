@@ -0,0 +1,377 @@
+// Package delta delivers a run of a job as the changes from the run before
+// it, so downstream systems can load increments instead of full refreshes.
+// Entities keep their keys from run to run: generated rows take over the
+// keys of the previous snapshot before any new key is used, and only a
+// share of the entities that persist take their regenerated values. Each
+// delta output holds the inserted and updated rows and the keys of deleted
+// ones, marked in a change column, and the snapshot of any run is rebuilt
+// by replaying the deltas after the last full run.
+package delta
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// ChangeColumn marks each delivered row with its change
+const ChangeColumn = "_change"
+
+// Changes
+const (
+	Insert = "insert"
+	Update = "update"
+	Delete = "delete"
+)
+
+const (
+	// MaxChain caps the delta runs replayed onto a full run to rebuild a
+	// snapshot
+	MaxChain = 50
+	// MaxManifestChanges caps the changed keys listed in a manifest
+	MaxManifestChanges = 10000
+)
+
+// Formats are the export formats delta rows can be delivered and replayed in
+var Formats = []string{"csv", "json"}
+
+var (
+	ErrNoPrevious    = errors.New("previous_job_id is required")
+	ErrNoKey         = errors.New("key column is required")
+	ErrChangeRate    = errors.New("change_rate must be between 0 and 1")
+	ErrFormat        = errors.New("delta outputs are delivered as csv or json")
+	ErrKeyMismatch   = errors.New("the previous run was keyed by another column")
+	ErrChainTooLong  = fmt.Errorf("more than %d delta runs since the last full run; start a full run", MaxChain)
+	ErrMissingKey    = errors.New("no generated row holds the key column")
+	ErrInvalidKey    = errors.New("previous snapshot has a row without its key or a repeated key")
+	ErrInvalidChange = errors.New("delta output has a row with an unknown change")
+	ErrNoSource      = errors.New("previous runs cannot be read")
+)
+
+// Options delivers a job as the changes from a previous run of the same
+// dataset, keyed by Key. ChangeRate is the share of persisting entities that
+// take their regenerated values; all of them when unset.
+type Options struct {
+	PreviousJobID int64    `json:"previous_job_id"`
+	Key           string   `json:"key"`
+	ChangeRate    *float64 `json:"change_rate,omitempty"`
+}
+
+func (o Options) Validate() error {
+	if o.PreviousJobID <= 0 {
+		return ErrNoPrevious
+	}
+	if strings.TrimSpace(o.Key) == "" {
+		return ErrNoKey
+	}
+	if o.ChangeRate != nil && (*o.ChangeRate < 0 || *o.ChangeRate > 1) {
+		return ErrChangeRate
+	}
+	return nil
+}
+
+// Rate returns the change rate, one when unset
+func (o Options) Rate() float64 {
+	if o.ChangeRate == nil {
+		return 1
+	}
+	return *o.ChangeRate
+}
+
+// CheckFormat reports whether a run in format can be a delta or its base
+func CheckFormat(format string) error {
+	if format == "" {
+		return nil
+	}
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return ErrFormat
+}
+
+// Source reads a user's completed jobs and their rows
+type Source interface {
+	Job(ctx context.Context, userID, jobID int64) (*models.GenerationJob, error)
+	Rows(ctx context.Context, userID, jobID int64) ([]map[string]any, error)
+}
+
+// Snapshot rebuilds the full rows of a user's run keyed by key: the rows of
+// the last full run with every delta run after it replayed in order. It
+// returns the full run's ID with them.
+func Snapshot(ctx context.Context, src Source, userID, jobID int64, key string) (int64, []map[string]any, error) {
+	var chain []*models.GenerationJob
+	for id := jobID; ; {
+		if len(chain) > MaxChain {
+			return 0, nil, ErrChainTooLong
+		}
+		job, err := src.Job(ctx, userID, id)
+		if err != nil {
+			return 0, nil, err
+		}
+		chain = append(chain, job)
+		if job.QualityDetails == nil || job.QualityDetails.Delta == nil {
+			break
+		}
+		if job.QualityDetails.Delta.Key != key {
+			return 0, nil, fmt.Errorf("%w: %s", ErrKeyMismatch, job.QualityDetails.Delta.Key)
+		}
+		id = job.QualityDetails.Delta.PreviousJobID
+	}
+	base := chain[len(chain)-1]
+	rows, err := src.Rows(ctx, userID, base.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	for i := len(chain) - 2; i >= 0; i-- {
+		changes, err := src.Rows(ctx, userID, chain[i].ID)
+		if err != nil {
+			return 0, nil, err
+		}
+		if rows, err = Replay(rows, changes, key); err != nil {
+			return 0, nil, fmt.Errorf("job %d: %w", chain[i].ID, err)
+		}
+	}
+	return base.ID, rows, nil
+}
+
+// Replay applies delta rows to a snapshot: inserted rows are appended,
+// updated rows replace the row of their key in place and deleted keys are
+// removed
+func Replay(rows, changes []map[string]any, key string) ([]map[string]any, error) {
+	out := append([]map[string]any(nil), rows...)
+	index := make(map[string]int, len(out))
+	for i, row := range out {
+		k, ok := keyOf(row, key)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		index[k] = i
+	}
+	for _, change := range changes {
+		k, ok := keyOf(change, key)
+		if !ok {
+			return nil, ErrInvalidKey
+		}
+		row := make(map[string]any, len(change))
+		for c, v := range change {
+			if c != ChangeColumn {
+				row[c] = v
+			}
+		}
+		i, exists := index[k]
+		switch kind, _ := change[ChangeColumn].(string); {
+		case kind == Delete:
+			if exists {
+				out[i] = nil
+				delete(index, k)
+			}
+		case kind == Insert, kind == Update:
+			if exists {
+				out[i] = row
+			} else {
+				index[k] = len(out)
+				out = append(out, row)
+			}
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrInvalidChange, kind)
+		}
+	}
+	kept := out[:0]
+	for _, row := range out {
+		if row != nil {
+			kept = append(kept, row)
+		}
+	}
+	return kept, nil
+}
+
+// Diff matches a run's generated rows to the previous snapshot and returns
+// the delta rows to deliver with their manifest. Generated rows keep a key
+// of the snapshot when they hold one; the others take the snapshot's
+// unclaimed keys in order, so entities persist, and only the rows beyond
+// the snapshot's size are inserted under their own keys. Rows that are left
+// without a usable key are dropped. The seed makes the entities that change
+// repeat when a job is retried.
+func Diff(previous, generated []map[string]any, opts Options, seed int64) ([]map[string]any, *models.DeltaManifest, error) {
+	key := opts.Key
+	m := &models.DeltaManifest{
+		PreviousJobID: opts.PreviousJobID,
+		Key:           key,
+		ChangeRate:    opts.Rate(),
+		PreviousRows:  int64(len(previous)),
+		Changes:       []models.DeltaChange{},
+	}
+	index := make(map[string]int, len(previous))
+	for i, row := range previous {
+		k, ok := keyOf(row, key)
+		if !ok {
+			return nil, nil, ErrInvalidKey
+		}
+		if _, dup := index[k]; dup {
+			return nil, nil, ErrInvalidKey
+		}
+		index[k] = i
+	}
+	held := false
+	for _, row := range generated {
+		if _, ok := row[key]; ok {
+			held = true
+			break
+		}
+	}
+	if len(generated) > 0 && !held {
+		return nil, nil, fmt.Errorf("%w: %s", ErrMissingKey, key)
+	}
+
+	// Generated rows holding a snapshot key claim it first
+	match := make([]int, len(generated))
+	claimed := make([]bool, len(previous))
+	for i, row := range generated {
+		match[i] = -1
+		if k, ok := keyOf(row, key); ok {
+			if j, found := index[k]; found && !claimed[j] {
+				match[i], claimed[j] = j, true
+			}
+		}
+	}
+	// The rest take the unclaimed keys in order, then keep their own
+	next := 0
+	used := make(map[string]bool)
+	var inserts []int
+	for i, row := range generated {
+		if match[i] >= 0 {
+			continue
+		}
+		for next < len(previous) && claimed[next] {
+			next++
+		}
+		if next < len(previous) {
+			match[i], claimed[next] = next, true
+			row[key] = previous[next][key]
+			continue
+		}
+		k, ok := keyOf(row, key)
+		if _, taken := index[k]; !ok || taken || used[k] {
+			m.Dropped++
+			continue
+		}
+		used[k] = true
+		inserts = append(inserts, i)
+	}
+
+	byPrevious := make([]int, len(previous))
+	for j := range byPrevious {
+		byPrevious[j] = -1
+	}
+	for i, j := range match {
+		if j >= 0 {
+			byPrevious[j] = i
+		}
+	}
+	rng := rand.New(rand.NewSource(seed))
+	rate := opts.Rate()
+	var out []map[string]any
+	for j, prev := range previous {
+		k, _ := keyOf(prev, key)
+		i := byPrevious[j]
+		if i < 0 {
+			out = append(out, map[string]any{key: prev[key], ChangeColumn: Delete})
+			m.Deleted++
+			record(m, k, Delete)
+			continue
+		}
+		m.Rows++
+		// Entities that do not change keep their previous values
+		if rate < 1 && rng.Float64() >= rate || equal(prev, generated[i]) {
+			m.Unchanged++
+			continue
+		}
+		generated[i][ChangeColumn] = Update
+		out = append(out, generated[i])
+		m.Updated++
+		record(m, k, Update)
+	}
+	for _, i := range inserts {
+		k, _ := keyOf(generated[i], key)
+		generated[i][ChangeColumn] = Insert
+		out = append(out, generated[i])
+		m.Rows++
+		m.Inserted++
+		record(m, k, Insert)
+	}
+	if out == nil {
+		out = []map[string]any{}
+	}
+	return out, m, nil
+}
+
+// record lists a changed key in the manifest, up to the cap
+func record(m *models.DeltaManifest, key, change string) {
+	if len(m.Changes) >= MaxManifestChanges {
+		m.Truncated = true
+		return
+	}
+	m.Changes = append(m.Changes, models.DeltaChange{Key: key, Change: change})
+}
+
+// keyOf returns the key of a row as text, or false when it has none
+func keyOf(row map[string]any, key string) (string, bool) {
+	v, ok := row[key]
+	if !ok || v == nil {
+		return "", false
+	}
+	k := text(v)
+	return k, strings.TrimSpace(k) != ""
+}
+
+// equal reports whether two rows hold the same values, ignoring the change
+// column. Values are compared as text, as rows read back from CSV outputs
+// hold every value as a string.
+func equal(a, b map[string]any) bool {
+	for c, v := range a {
+		if c != ChangeColumn && text(v) != text(b[c]) {
+			return false
+		}
+	}
+	for c, v := range b {
+		if _, ok := a[c]; !ok && c != ChangeColumn && text(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// text writes a value the way CSV outputs do
+func text(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case json.Number:
+		if f, err := x.Float64(); err == nil {
+			return strconv.FormatFloat(f, 'f', -1, 64)
+		}
+		return x.String()
+	case bool:
+		return strconv.FormatBool(x)
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case map[string]any, []any:
+		raw, _ := json.Marshal(x)
+		return string(raw)
+	}
+	return fmt.Sprint(v)
+}
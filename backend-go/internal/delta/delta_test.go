@@ -0,0 +1,179 @@
+// Package delta_test provides unit tests for delta outputs
+package delta_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/delta"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rate(r float64) *float64 { return &r }
+
+func customers(n int, plan string) []map[string]any {
+	rows := make([]map[string]any, n)
+	for i := range rows {
+		rows[i] = map[string]any{"id": float64(i + 1), "plan": plan}
+	}
+	return rows
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, delta.Options{PreviousJobID: 1, Key: "id", ChangeRate: rate(0.2)}.Validate())
+	assert.ErrorIs(t, delta.Options{Key: "id"}.Validate(), delta.ErrNoPrevious)
+	assert.ErrorIs(t, delta.Options{PreviousJobID: 1, Key: " "}.Validate(), delta.ErrNoKey)
+	assert.ErrorIs(t, delta.Options{PreviousJobID: 1, Key: "id", ChangeRate: rate(1.5)}.Validate(), delta.ErrChangeRate)
+	assert.Equal(t, 1.0, delta.Options{}.Rate())
+
+	assert.NoError(t, delta.CheckFormat("csv"))
+	assert.NoError(t, delta.CheckFormat(""))
+	assert.ErrorIs(t, delta.CheckFormat("fhir"), delta.ErrFormat)
+}
+
+func TestDiffKeepsKeysStable(t *testing.T) {
+	// Previous rows read back from a JSON output hold numbers as json.Number
+	previous := []map[string]any{
+		{"id": json.Number("1"), "plan": "free"},
+		{"id": json.Number("2"), "plan": "pro"},
+		{"id": json.Number("3"), "plan": "free"},
+	}
+	generated := []map[string]any{
+		{"id": 2.0, "plan": "pro"},
+		{"id": 9.0, "plan": "team"},
+		{"id": 10.0, "plan": "free"},
+		{"id": 11.0, "plan": "pro"},
+	}
+	out, m, err := delta.Diff(previous, generated, delta.Options{PreviousJobID: 5, Key: "id"}, 1)
+	require.NoError(t, err)
+
+	// 2 keeps its key, 9 takes over 1, 10 takes over 3 and only 11 is new;
+	// 2 and 3 hold the same values as before
+	assert.Equal(t, int64(2), m.Unchanged)
+	assert.Equal(t, int64(1), m.Updated)
+	assert.Equal(t, int64(0), m.Deleted)
+	assert.Equal(t, int64(1), m.Inserted)
+	assert.Equal(t, int64(4), m.Rows)
+	assert.Equal(t, []models.DeltaChange{{Key: "1", Change: delta.Update}, {Key: "11", Change: delta.Insert}}, m.Changes)
+	require.Len(t, out, 2)
+	assert.Equal(t, map[string]any{"id": json.Number("1"), "plan": "team", delta.ChangeColumn: delta.Update}, out[0])
+	assert.Equal(t, delta.Insert, out[1][delta.ChangeColumn])
+	assert.Equal(t, json.Number("3"), generated[2]["id"], "keys taken over are written to the rows")
+}
+
+func TestDiffDeletesAndDrops(t *testing.T) {
+	previous := customers(3, "free")
+	generated := []map[string]any{{"id": 3.0, "plan": "pro"}}
+	out, m, err := delta.Diff(previous, generated, delta.Options{PreviousJobID: 5, Key: "id"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), m.Deleted)
+	assert.Equal(t, int64(1), m.Updated)
+	assert.Equal(t, []map[string]any{
+		{"id": 1.0, delta.ChangeColumn: delta.Delete},
+		{"id": 2.0, delta.ChangeColumn: delta.Delete},
+		{"id": 3.0, "plan": "pro", delta.ChangeColumn: delta.Update},
+	}, out)
+
+	// Rows beyond the snapshot need a key of their own that is not taken
+	generated = []map[string]any{{"id": 1.0, "plan": "free"}, {"id": 1.0, "plan": "pro"}, {"plan": "team"}, {"id": 4.0}, {"id": 4.0}}
+	_, m, err = delta.Diff(customers(1, "free"), generated, delta.Options{PreviousJobID: 5, Key: "id"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), m.Dropped)
+	assert.Equal(t, int64(1), m.Inserted)
+
+	_, _, err = delta.Diff(previous, []map[string]any{{"plan": "pro"}}, delta.Options{PreviousJobID: 5, Key: "id"}, 1)
+	assert.ErrorIs(t, err, delta.ErrMissingKey)
+	_, _, err = delta.Diff([]map[string]any{{"plan": "pro"}}, generated, delta.Options{PreviousJobID: 5, Key: "id"}, 1)
+	assert.ErrorIs(t, err, delta.ErrInvalidKey)
+}
+
+func TestDiffChangeRate(t *testing.T) {
+	previous := customers(1000, "free")
+	out, m, err := delta.Diff(previous, customers(1000, "pro"), delta.Options{PreviousJobID: 5, Key: "id", ChangeRate: rate(0.1)}, 7)
+	require.NoError(t, err)
+	assert.InDelta(t, 100, m.Updated, 30)
+	assert.Equal(t, int64(1000), m.Updated+m.Unchanged)
+	assert.Len(t, out, int(m.Updated))
+
+	// The same seed changes the same entities
+	again, _, err := delta.Diff(previous, customers(1000, "pro"), delta.Options{PreviousJobID: 5, Key: "id", ChangeRate: rate(0.1)}, 7)
+	require.NoError(t, err)
+	assert.Equal(t, out, again)
+}
+
+func TestReplayRebuildsTheSnapshot(t *testing.T) {
+	previous := customers(3, "free")
+	generated := []map[string]any{{"id": 1.0, "plan": "pro"}, {"id": 2.0, "plan": "free"}}
+	generated = append(generated, map[string]any{"id": 3.0, "plan": "free"}, map[string]any{"id": 4.0, "plan": "team"})
+	out, _, err := delta.Diff(previous, generated, delta.Options{PreviousJobID: 5, Key: "id"}, 1)
+	require.NoError(t, err)
+
+	// CSV outputs read back every value as a string
+	changes := make([]map[string]any, len(out))
+	for i, row := range out {
+		changes[i] = map[string]any{}
+		for k, v := range row {
+			changes[i][k] = fmt.Sprint(v)
+		}
+	}
+	snapshot, err := delta.Replay(previous, changes, "id")
+	require.NoError(t, err)
+	require.Len(t, snapshot, 4)
+	assert.Equal(t, "pro", snapshot[0]["plan"])
+	assert.Equal(t, "free", snapshot[1]["plan"])
+	assert.Equal(t, "4", snapshot[3]["id"])
+	assert.NotContains(t, snapshot[0], delta.ChangeColumn)
+
+	snapshot, err = delta.Replay(snapshot, []map[string]any{{"id": "2", delta.ChangeColumn: delta.Delete}}, "id")
+	require.NoError(t, err)
+	assert.Len(t, snapshot, 3)
+
+	_, err = delta.Replay(snapshot, []map[string]any{{"id": "2", delta.ChangeColumn: "upsert"}}, "id")
+	assert.ErrorIs(t, err, delta.ErrInvalidChange)
+}
+
+// runs is a source of jobs and their output rows
+type runs struct {
+	jobs map[int64]*models.GenerationJob
+	rows map[int64][]map[string]any
+}
+
+func (r runs) Job(_ context.Context, _, id int64) (*models.GenerationJob, error) {
+	if job, ok := r.jobs[id]; ok {
+		return job, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (r runs) Rows(_ context.Context, _, id int64) ([]map[string]any, error) {
+	return r.rows[id], nil
+}
+
+func deltaJob(id, previous int64, key string) *models.GenerationJob {
+	return &models.GenerationJob{ID: id, QualityDetails: &models.QualityDetails{Delta: &models.DeltaManifest{PreviousJobID: previous, Key: key}}}
+}
+
+func TestSnapshotReplaysTheChain(t *testing.T) {
+	src := runs{
+		jobs: map[int64]*models.GenerationJob{1: {ID: 1}, 2: deltaJob(2, 1, "id"), 3: deltaJob(3, 2, "id")},
+		rows: map[int64][]map[string]any{
+			1: customers(2, "free"),
+			2: {{"id": 2.0, "plan": "pro", delta.ChangeColumn: delta.Update}},
+			3: {{"id": 1.0, delta.ChangeColumn: delta.Delete}, {"id": 3.0, "plan": "team", delta.ChangeColumn: delta.Insert}},
+		},
+	}
+	base, rows, err := delta.Snapshot(context.Background(), src, 9, 3, "id")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), base)
+	assert.Equal(t, []map[string]any{{"id": 2.0, "plan": "pro"}, {"id": 3.0, "plan": "team"}}, rows)
+
+	_, _, err = delta.Snapshot(context.Background(), src, 9, 3, "email")
+	assert.ErrorIs(t, err, delta.ErrKeyMismatch)
+	_, _, err = delta.Snapshot(context.Background(), src, 9, 4, "id")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -0,0 +1,502 @@
+// Package egress routes the service's outbound HTTP through one policy.
+// Requests may only go to the deployment's approved hosts, addresses on
+// private, loopback and link-local networks are refused when connecting, so
+// a URL cannot reach internal services or instance metadata through DNS
+// tricks. Enterprise deployments may also pin the TLS keys of their
+// providers. Requests to a host with a signing secret carry an HMAC
+// signature the provider can check. Refused requests are recorded as
+// security events.
+package egress
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
+	"go.uber.org/zap"
+)
+
+// Mode is how a policy treats requests it would refuse
+type Mode string
+
+const (
+	// ModeEnforce refuses them
+	ModeEnforce Mode = "enforce"
+	// ModeMonitor records them as security events and lets them through
+	ModeMonitor Mode = "monitor"
+	// ModeOff checks nothing
+	ModeOff Mode = "off"
+)
+
+// Reasons a request is refused
+const (
+	ReasonHostNotAllowed = "host_not_allowed"
+	ReasonScheme         = "scheme_not_allowed"
+	ReasonPrivateAddress = "private_address"
+	ReasonPinMismatch    = "tls_pin_mismatch"
+	ReasonInvalidURL     = "invalid_url"
+	ReasonUnresolvable   = "host_unresolvable"
+)
+
+// Signature headers of signed requests
+const (
+	HeaderTimestamp = "X-Synthos-Timestamp"
+	HeaderSignature = "X-Synthos-Signature"
+)
+
+// EventBlocked is the security event type of refused requests
+const EventBlocked = "egress_blocked"
+
+var ErrInvalidConfig = errors.New("invalid egress configuration")
+
+// BlockedError is returned for a request the policy refused
+type BlockedError struct {
+	Host   string
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("egress to %s blocked: %s", e.Host, e.Reason)
+}
+
+// Recorder keeps security events
+type Recorder interface {
+	RecordEvent(event security.SecurityEvent)
+}
+
+// Config is a deployment's egress policy
+type Config struct {
+	Mode Mode
+	// AllowedHosts are the approved hosts; "*.example.com" approves its
+	// subdomains. Hosts named exactly may resolve to private addresses,
+	// for services such as an internal inference server.
+	AllowedHosts []string
+	// Pins maps hosts to the base64 SHA-256 hashes of public keys; one
+	// certificate of a pinned host's chain must have one of them
+	Pins map[string][]string
+	// SigningSecrets maps hosts to the secrets requests to them are
+	// signed with
+	SigningSecrets map[string]string
+	// RootCAs verifies providers with a private CA; nil uses the system
+	// roots
+	RootCAs *x509.CertPool
+}
+
+// Gateway applies a policy to the clients it hands out
+type Gateway struct {
+	cfg      Config
+	exact    map[string]bool
+	suffixes []string
+	pins     map[string][][]byte
+	secrets  map[string]string
+	recorder Recorder
+	logger   *zap.Logger
+}
+
+// New returns a gateway for cfg; recorder may be nil
+func New(cfg Config, recorder Recorder, logger *zap.Logger) (*Gateway, error) {
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = ModeEnforce
+	case ModeEnforce, ModeMonitor, ModeOff:
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidConfig, cfg.Mode)
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	g := &Gateway{cfg: cfg, exact: map[string]bool{}, pins: map[string][][]byte{}, secrets: map[string]string{}, recorder: recorder, logger: logger}
+	for _, h := range cfg.AllowedHosts {
+		h = strings.ToLower(strings.TrimSpace(h))
+		if suffix, ok := strings.CutPrefix(h, "*."); ok && suffix != "" {
+			g.suffixes = append(g.suffixes, "."+suffix)
+		} else if h != "" {
+			g.exact[h] = true
+		}
+	}
+	for host, pins := range cfg.Pins {
+		host = strings.ToLower(host)
+		for _, p := range pins {
+			sum, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(strings.TrimSpace(p), "sha256/"))
+			if err != nil || len(sum) != sha256.Size {
+				return nil, fmt.Errorf("%w: pin of %s is not a base64 SHA-256 hash", ErrInvalidConfig, host)
+			}
+			g.pins[host] = append(g.pins[host], sum)
+		}
+	}
+	for host, secret := range cfg.SigningSecrets {
+		g.secrets[strings.ToLower(host)] = secret
+	}
+	return g, nil
+}
+
+// ParsePins reads pins given as host=pin1|pin2
+func ParsePins(pairs map[string]string) map[string][]string {
+	out := make(map[string][]string, len(pairs))
+	for host, v := range pairs {
+		out[host] = strings.Split(v, "|")
+	}
+	return out
+}
+
+// HostOf returns the host of a URL, or "" for an invalid one
+func HostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// Allows reports whether host is approved
+func (g *Gateway) Allows(host string) bool {
+	host = strings.ToLower(host)
+	if g.exact[host] {
+		return true
+	}
+	for _, s := range g.suffixes {
+		if strings.HasSuffix(host, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Option changes the policy of one client
+type Option func(*transport)
+
+// AnyPublicHost lets a client reach hosts off the allowlist, for
+// destinations customers choose such as webhook endpoints. Private
+// addresses stay refused, even for hosts approved by name.
+func AnyPublicHost() Option {
+	return func(t *transport) { t.public = true }
+}
+
+// HTTPSOnly refuses plain HTTP requests
+func HTTPSOnly() Option {
+	return func(t *transport) { t.httpsOnly = true }
+}
+
+// CheckURL vets a URL a user gives the service to call, such as a webhook
+// endpoint: it must be HTTPS without credentials, and its host must only
+// resolve to public addresses. Hosts approved by name get no exception.
+// Refusals are recorded like refused requests. Deliveries are checked
+// again when connecting, as the host's addresses may have changed since.
+func (g *Gateway) CheckURL(ctx context.Context, purpose, rawURL string) error {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" || u.User != nil || u.Opaque != "" {
+		return &BlockedError{Reason: ReasonInvalidURL}
+	}
+	if g.cfg.Mode == ModeOff {
+		return nil
+	}
+	if u.Scheme != "https" {
+		t := &transport{g: g, purpose: purpose, public: true}
+		return t.refuse(strings.ToLower(u.Hostname()), ReasonScheme, u.Scheme+"://"+u.Host+u.Path)
+	}
+	return g.CheckHost(ctx, purpose, u.Hostname())
+}
+
+// CheckHost vets a host a user gives the service to connect to, such as a
+// database server, like CheckURL
+func (g *Gateway) CheckHost(ctx context.Context, purpose, host string) error {
+	if g.cfg.Mode == ModeOff {
+		return nil
+	}
+	host = strings.ToLower(strings.TrimSpace(host))
+	ips := []netip.Addr{}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = append(ips, ip)
+	} else if host == "" || strings.ContainsAny(host, "/@:?# ") {
+		return &BlockedError{Host: host, Reason: ReasonInvalidURL}
+	} else if ips, err = net.DefaultResolver.LookupNetIP(ctx, "ip", host); err != nil || len(ips) == 0 {
+		return &BlockedError{Host: host, Reason: ReasonUnresolvable}
+	}
+	t := &transport{g: g, purpose: purpose, public: true}
+	for _, ip := range ips {
+		if Private(ip) {
+			return t.refuse(host, ReasonPrivateAddress, ip.Unmap().String())
+		}
+	}
+	return nil
+}
+
+// Client returns a client for purpose, such as "webhooks", whose requests
+// follow the policy
+func (g *Gateway) Client(purpose string, timeout time.Duration, opts ...Option) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: g.Transport(purpose, opts...)}
+}
+
+// Dialer returns a dial function for purpose that follows the policy, for
+// clients of protocols other than HTTP such as database drivers
+func (g *Gateway) Dialer(purpose string, opts ...Option) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	t := &transport{g: g, purpose: purpose}
+	for _, o := range opts {
+		o(t)
+	}
+	dial := t.dial(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second})
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		host = strings.ToLower(host)
+		if g.cfg.Mode != ModeOff && !t.public && !g.Allows(host) {
+			if err := t.refuse(host, ReasonHostNotAllowed, addr); err != nil {
+				return nil, err
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// Transport returns a round tripper for purpose that follows the policy
+func (g *Gateway) Transport(purpose string, opts ...Option) http.RoundTripper {
+	t := &transport{g: g, purpose: purpose}
+	for _, o := range opts {
+		o(t)
+	}
+	dial := t.dial(&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second})
+	t.base = &http.Transport{
+		// Proxies would connect on the client's behalf, past the address
+		// checks
+		Proxy:       nil,
+		DialContext: dial,
+		// TLS is set up here so pins are checked against the host dialled,
+		// which the handshake's state lacks for IP addresses
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			cfg := &tls.Config{
+				MinVersion: tls.VersionTLS12,
+				RootCAs:    g.cfg.RootCAs,
+				ServerName: host,
+				NextProtos: []string{"h2", "http/1.1"},
+				VerifyConnection: func(cs tls.ConnectionState) error {
+					return t.verifyPins(strings.ToLower(host), cs)
+				},
+			}
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			tc := tls.Client(conn, cfg)
+			if err := tc.HandshakeContext(ctx); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return tc, nil
+		},
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return t
+}
+
+type transport struct {
+	g         *Gateway
+	purpose   string
+	public    bool
+	httpsOnly bool
+	base      *http.Transport
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	if t.g.cfg.Mode != ModeOff {
+		reason := ""
+		switch {
+		case req.URL.Scheme != "https" && (t.httpsOnly || req.URL.Scheme != "http"):
+			reason = ReasonScheme
+		case !t.public && !t.g.Allows(host):
+			reason = ReasonHostNotAllowed
+		}
+		if reason != "" {
+			if err := t.refuse(host, reason, req.URL.Scheme+"://"+req.URL.Host+req.URL.Path); err != nil {
+				if req.Body != nil {
+					req.Body.Close()
+				}
+				return nil, err
+			}
+		}
+	}
+	if secret := t.g.secrets[host]; secret != "" {
+		signed, err := sign(req, secret, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		req = signed
+	}
+	return t.base.RoundTrip(req)
+}
+
+// refuse records a refused request and returns the error to fail it with,
+// or nil when the policy only monitors
+func (t *transport) refuse(host, reason, target string) error {
+	blocked := t.g.cfg.Mode == ModeEnforce
+	t.g.logger.Warn("egress refused", zap.String("purpose", t.purpose), zap.String("host", host),
+		zap.String("reason", reason), zap.Bool("blocked", blocked))
+	if t.g.recorder != nil {
+		level := security.ThreatLevelHigh
+		if reason == ReasonPinMismatch {
+			level = security.ThreatLevelCritical
+		}
+		action := "allowed"
+		if blocked {
+			action = "blocked"
+		}
+		t.g.recorder.RecordEvent(security.SecurityEvent{
+			Level:   level,
+			Type:    EventBlocked,
+			Source:  t.purpose,
+			Action:  action,
+			Blocked: blocked,
+			Details: map[string]interface{}{"host": host, "reason": reason, "target": target, "mode": string(t.g.cfg.Mode)},
+		})
+	}
+	if !blocked {
+		return nil
+	}
+	return &BlockedError{Host: host, Reason: reason}
+}
+
+// dial connects to an address the host resolves to, refusing private ones
+// unless the host is approved by name and the client only calls approved
+// hosts. Checking the resolved address,
+// rather than the name, keeps DNS rebinding from reaching internal
+// services.
+func (t *transport) dial(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		host = strings.ToLower(host)
+		if t.g.cfg.Mode == ModeOff || (t.g.exact[host] && !t.public) {
+			return d.DialContext(ctx, network, addr)
+		}
+		ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+		if err != nil {
+			return nil, err
+		}
+		var lastErr error
+		for _, ip := range ips {
+			ip = ip.Unmap()
+			if Private(ip) {
+				if lastErr = t.refuse(host, ReasonPrivateAddress, ip.String()); lastErr != nil {
+					continue
+				}
+			}
+			conn, err := d.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses for %s", host)
+		}
+		return nil, lastErr
+	}
+}
+
+// reserved are special-purpose networks netip has no predicate for: "this
+// network", the shared address space carriers and some clouds use
+// internally, IETF protocol assignments, benchmarking, and the NAT64
+// prefixes, which reach IPv4 hosts, internal ones included, through IPv6
+// addresses
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+}
+
+// Private reports whether ip is on a network outbound requests must not
+// reach: private, loopback, link-local (such as instance metadata),
+// multicast, unspecified or one of the reserved networks
+func Private(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() ||
+		slices.ContainsFunc(reserved, func(p netip.Prefix) bool { return p.Contains(ip) })
+}
+
+// verifyPins checks a pinned host's verified chain holds a pinned key
+func (t *transport) verifyPins(host string, cs tls.ConnectionState) error {
+	pins := t.g.pins[host]
+	if len(pins) == 0 || t.g.cfg.Mode == ModeOff {
+		return nil
+	}
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			if slices.ContainsFunc(pins, func(p []byte) bool { return hmac.Equal(p, sum[:]) }) {
+				return nil
+			}
+		}
+	}
+	return t.refuse(host, ReasonPinMismatch, host)
+}
+
+// Pin returns the pin of a certificate's public key
+func Pin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// sign returns a copy of req carrying its signature: the hex HMAC-SHA256,
+// under secret, of the timestamp, method, path with query and body hash,
+// separated by newlines
+func sign(req *http.Request, secret string, now time.Time) (*http.Request, error) {
+	var body []byte
+	if req.Body != nil && req.Body != http.NoBody {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	out := req.Clone(req.Context())
+	if req.Body != nil {
+		out.Body = io.NopCloser(bytes.NewReader(body))
+		out.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	out.Header.Set(HeaderTimestamp, ts)
+	out.Header.Set(HeaderSignature, "v1="+Signature(secret, ts, req.Method, req.URL.RequestURI(), body))
+	return out, nil
+}
+
+// Signature is the signature of a request, for providers to check
+func Signature(secret, timestamp, method, requestURI string, body []byte) string {
+	sum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + requestURI + "\n" + hex.EncodeToString(sum[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,254 @@
+// Package egress_test provides unit tests for the outbound HTTP policy
+package egress_test
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/egress"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type events struct {
+	mu   sync.Mutex
+	list []security.SecurityEvent
+}
+
+func (e *events) RecordEvent(event security.SecurityEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, event)
+}
+
+func TestAllows(t *testing.T) {
+	g, err := egress.New(egress.Config{AllowedHosts: []string{"api.openai.com", "*.googleapis.com"}}, nil, nil)
+	require.NoError(t, err)
+	assert.True(t, g.Allows("API.openai.com"))
+	assert.True(t, g.Allows("aiplatform.googleapis.com"))
+	assert.False(t, g.Allows("googleapis.com"))
+	assert.False(t, g.Allows("evil-googleapis.com"))
+	assert.False(t, g.Allows("openai.com"))
+
+	_, err = egress.New(egress.Config{Mode: "strict"}, nil, nil)
+	assert.ErrorIs(t, err, egress.ErrInvalidConfig)
+	_, err = egress.New(egress.Config{Pins: map[string][]string{"a.example": {"not-a-pin"}}}, nil, nil)
+	assert.ErrorIs(t, err, egress.ErrInvalidConfig)
+}
+
+func TestPrivate(t *testing.T) {
+	for _, tc := range []struct {
+		ip      string
+		private bool
+	}{
+		{"10.0.0.1", true},
+		{"127.0.0.1", true},
+		{"169.254.169.254", true},
+		{"192.168.1.1", true},
+		{"100.64.0.1", true},
+		{"::1", true},
+		{"fd00::1", true},
+		{"::ffff:10.0.0.1", true},
+		{"0.0.0.0", true},
+		// "This network"
+		{"0.1.2.3", true},
+		{"0.255.255.255", true},
+		// IETF protocol assignments
+		{"192.0.0.8", true},
+		{"192.0.0.170", true},
+		// Benchmarking
+		{"198.18.0.1", true},
+		{"198.19.255.254", true},
+		// NAT64, which would reach 10.0.0.1 and 169.254.169.254
+		{"64:ff9b::a00:1", true},
+		{"64:ff9b::a9fe:a9fe", true},
+		{"64:ff9b:1::a00:1", true},
+		{"8.8.8.8", false},
+		{"2606:4700::1111", false},
+		{"1.0.0.1", false},
+		{"198.17.255.255", false},
+		{"198.20.0.1", false},
+		{"64:ff9c::1", false},
+	} {
+		assert.Equal(t, tc.private, egress.Private(netip.MustParseAddr(tc.ip)), tc.ip)
+	}
+}
+
+func TestClientBlocksHostsOffTheAllowlist(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	rec := &events{}
+	g, err := egress.New(egress.Config{AllowedHosts: []string{"api.openai.com"}}, rec, nil)
+	require.NoError(t, err)
+
+	_, err = g.Client("agents", time.Second).Get(srv.URL + "/v1?token=secret")
+	var blocked *egress.BlockedError
+	require.True(t, errors.As(err, &blocked))
+	assert.Equal(t, egress.ReasonHostNotAllowed, blocked.Reason)
+	require.Len(t, rec.list, 1)
+	assert.Equal(t, egress.EventBlocked, rec.list[0].Type)
+	assert.Equal(t, "agents", rec.list[0].Source)
+	assert.True(t, rec.list[0].Blocked)
+	assert.NotContains(t, rec.list[0].Details["target"], "secret", "query strings are not recorded")
+}
+
+func TestClientBlocksPrivateAddressesOfPublicHosts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	rec := &events{}
+	g, err := egress.New(egress.Config{}, rec, nil)
+	require.NoError(t, err)
+
+	_, err = g.Client("webhooks", time.Second, egress.AnyPublicHost()).Get(srv.URL)
+	var blocked *egress.BlockedError
+	require.True(t, errors.As(err, &blocked))
+	assert.Equal(t, egress.ReasonPrivateAddress, blocked.Reason)
+	require.Len(t, rec.list, 1)
+	assert.Equal(t, "127.0.0.1", rec.list[0].Details["target"])
+}
+
+func TestMonitorModeRecordsButAllows(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	rec := &events{}
+	g, err := egress.New(egress.Config{Mode: egress.ModeMonitor}, rec, nil)
+	require.NoError(t, err)
+
+	resp, err := g.Client("agents", time.Second).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	// The host is off the allowlist and resolves to a private address
+	require.Len(t, rec.list, 2)
+	assert.False(t, rec.list[0].Blocked)
+	assert.False(t, rec.list[1].Blocked)
+}
+
+func TestExactHostsMayBePrivateAndAreSigned(t *testing.T) {
+	var got http.Header
+	var body string
+	var uri string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		raw, _ := io.ReadAll(r.Body)
+		body, uri = string(raw), r.URL.RequestURI()
+	}))
+	defer srv.Close()
+	host := egress.HostOf(srv.URL)
+	rec := &events{}
+	g, err := egress.New(egress.Config{
+		AllowedHosts:   []string{host},
+		SigningSecrets: map[string]string{host: "s3cret"},
+	}, rec, nil)
+	require.NoError(t, err)
+
+	resp, err := g.Client("model_serving", time.Second).Post(srv.URL+"/v1/models/3/generate?x=1", "application/json", strings.NewReader(`{"rows":5}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, rec.list)
+	assert.Equal(t, `{"rows":5}`, body)
+	ts := got.Get(egress.HeaderTimestamp)
+	require.NotEmpty(t, ts)
+	assert.Equal(t, "v1="+egress.Signature("s3cret", ts, http.MethodPost, uri, []byte(body)), got.Get(egress.HeaderSignature))
+}
+
+func TestTLSPins(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	host := egress.HostOf(srv.URL)
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	pinned, err := egress.New(egress.Config{
+		AllowedHosts: []string{host},
+		Pins:         map[string][]string{host: {"sha256/" + egress.Pin(srv.Certificate())}},
+		RootCAs:      roots,
+	}, nil, nil)
+	require.NoError(t, err)
+	resp, err := pinned.Client("agents", time.Second).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	rec := &events{}
+	wrong, err := egress.New(egress.Config{
+		AllowedHosts: []string{host},
+		Pins:         map[string][]string{host: {"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}},
+		RootCAs:      roots,
+	}, rec, nil)
+	require.NoError(t, err)
+	_, err = wrong.Client("agents", time.Second).Get(srv.URL)
+	require.Error(t, err)
+	require.Len(t, rec.list, 1)
+	assert.Equal(t, egress.ReasonPinMismatch, rec.list[0].Details["reason"])
+	assert.Equal(t, security.ThreatLevelCritical, rec.list[0].Level)
+}
+
+func TestCheckURL(t *testing.T) {
+	rec := &events{}
+	g, err := egress.New(egress.Config{AllowedHosts: []string{"127.0.0.1"}}, rec, nil)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	assert.NoError(t, g.CheckURL(ctx, "webhooks", "https://8.8.8.8/hooks"))
+	for url, reason := range map[string]string{
+		"https://127.0.0.1/hooks":                  egress.ReasonPrivateAddress,
+		"https://169.254.169.254/latest/meta-data": egress.ReasonPrivateAddress,
+		"https://[::ffff:10.0.0.1]/":               egress.ReasonPrivateAddress,
+		"http://8.8.8.8/hooks":                     egress.ReasonScheme,
+		"https://user:pw@8.8.8.8/":                 egress.ReasonInvalidURL,
+		"not a url":                                egress.ReasonInvalidURL,
+		"https://nonexistent.invalid/":             egress.ReasonUnresolvable,
+	} {
+		var blocked *egress.BlockedError
+		require.True(t, errors.As(g.CheckURL(ctx, "webhooks", url), &blocked), url)
+		assert.Equal(t, reason, blocked.Reason, url)
+	}
+	// Malformed and unresolvable URLs are input errors, not attacks
+	assert.Len(t, rec.list, 4)
+}
+
+func TestPublicClientsRefuseApprovedPrivateHostsAndPlainHTTP(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	g, err := egress.New(egress.Config{AllowedHosts: []string{egress.HostOf(srv.URL)}}, nil, nil)
+	require.NoError(t, err)
+
+	var blocked *egress.BlockedError
+	_, err = g.Client("webhooks", time.Second, egress.AnyPublicHost()).Get(srv.URL)
+	require.True(t, errors.As(err, &blocked))
+	assert.Equal(t, egress.ReasonPrivateAddress, blocked.Reason)
+
+	_, err = g.Client("webhooks", time.Second, egress.HTTPSOnly()).Get(srv.URL)
+	require.True(t, errors.As(err, &blocked))
+	assert.Equal(t, egress.ReasonScheme, blocked.Reason)
+}
+
+func TestDialer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	addr := srv.Listener.Addr().String()
+	g, err := egress.New(egress.Config{AllowedHosts: []string{"127.0.0.1"}}, nil, nil)
+	require.NoError(t, err)
+
+	conn, err := g.Dialer("warehouse")(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	conn.Close()
+
+	var blocked *egress.BlockedError
+	_, err = g.Dialer("warehouse", egress.AnyPublicHost())(context.Background(), "tcp", addr)
+	require.True(t, errors.As(err, &blocked))
+	assert.Equal(t, egress.ReasonPrivateAddress, blocked.Reason)
+
+	assert.NoError(t, g.CheckHost(context.Background(), "warehouse", "8.8.8.8"))
+	require.True(t, errors.As(g.CheckHost(context.Background(), "warehouse", "db.example.com/x"), &blocked))
+	assert.Equal(t, egress.ReasonInvalidURL, blocked.Reason)
+}
@@ -0,0 +1,445 @@
+// Package errreport sends panics and server errors to Sentry with the
+// context of the request they happened in. Events carry the release and
+// environment, the user and organization as identifiers only, and the
+// trace of the request so they can be found next to its logs; no email,
+// address, header or body of a request is ever sent.
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// queueSize caps the events waiting to be sent; events past it are
+	// dropped rather than slow down requests
+	queueSize = 100
+	// sendTimeout bounds one delivery to Sentry
+	sendTimeout = 10 * time.Second
+	// clientName identifies the reporter to Sentry
+	clientName = "synthos-go/1.0"
+	// modulePath marks the frames of this service as in-app
+	modulePath = "github.com/genovotechnologies/synthos_dev/backend-go"
+)
+
+// Event levels
+const (
+	LevelError = "error"
+	LevelFatal = "fatal"
+)
+
+var ErrInvalidDSN = errors.New("invalid sentry dsn")
+
+// Config configures the reporter
+type Config struct {
+	// DSN is the Sentry project's client key URL; empty disables reporting
+	DSN         string
+	Environment string
+	// Release tags events with the deployed version; empty uses the VCS
+	// revision the binary was built from
+	Release    string
+	ServerName string
+	HTTPClient *http.Client
+}
+
+// Reporter sends events to Sentry in the background. A nil *Reporter
+// drops every event, so callers need not check whether reporting is on.
+type Reporter struct {
+	endpoint    string
+	auth        string
+	dsn         string
+	environment string
+	release     string
+	serverName  string
+	client      *http.Client
+	queue       chan *Event
+	pending     sync.WaitGroup
+	closeOnce   sync.Once
+}
+
+// Request is what an event records of the request it happened in: the
+// route rather than the URL, so identifiers in paths and query strings
+// are not sent
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+}
+
+// Frame is one call of a stack trace
+type Frame struct {
+	Function string `json:"function"`
+	Module   string `json:"module,omitempty"`
+	File     string `json:"filename"`
+	AbsPath  string `json:"abs_path,omitempty"`
+	Line     int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+// Exception is an error or panic with the stack it was raised from
+type Exception struct {
+	Type       string      `json:"type"`
+	Value      string      `json:"value"`
+	Stacktrace *Stacktrace `json:"stacktrace,omitempty"`
+	Mechanism  *Mechanism  `json:"mechanism,omitempty"`
+}
+
+// Stacktrace holds frames oldest call first, as Sentry expects
+type Stacktrace struct {
+	Frames []Frame `json:"frames"`
+}
+
+// Mechanism says how an exception was caught; panics are unhandled
+type Mechanism struct {
+	Type    string `json:"type"`
+	Handled bool   `json:"handled"`
+}
+
+// Event is a Sentry event
+type Event struct {
+	EventID     string    `json:"event_id"`
+	Timestamp   time.Time `json:"timestamp"`
+	Level       string    `json:"level"`
+	Platform    string    `json:"platform"`
+	Logger      string    `json:"logger,omitempty"`
+	Release     string    `json:"release,omitempty"`
+	Environment string    `json:"environment,omitempty"`
+	ServerName  string    `json:"server_name,omitempty"`
+	Transaction string    `json:"transaction,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Exception   *struct {
+		Values []Exception `json:"values"`
+	} `json:"exception,omitempty"`
+	Request  *Request                     `json:"request,omitempty"`
+	Tags     map[string]string            `json:"tags,omitempty"`
+	User     map[string]string            `json:"user,omitempty"`
+	Contexts map[string]map[string]string `json:"contexts,omitempty"`
+}
+
+// Scope is the context of a request an event is reported with. UserID and
+// OrgID are sent as identifiers only; TraceID and SpanID are the W3C trace
+// of the request, which its log lines carry too.
+type Scope struct {
+	Request *Request
+	Route   string
+	UserID  int64
+	OrgID   int64
+	TraceID string
+	SpanID  string
+	Tags    map[string]string
+}
+
+// New returns a reporter sending to the DSN's project; nil when there is
+// no DSN
+func New(cfg Config) (*Reporter, error) {
+	if cfg.DSN == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(cfg.DSN)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, ErrInvalidDSN
+	}
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	project := path[i+1:]
+	if project == "" {
+		return nil, ErrInvalidDSN
+	}
+	prefix := ""
+	if i > 0 {
+		prefix = "/" + path[:i]
+	}
+	release := cfg.Release
+	if release == "" {
+		release = BuildRevision()
+	}
+	serverName := cfg.ServerName
+	if serverName == "" {
+		serverName, _ = os.Hostname()
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: sendTimeout}
+	}
+	r := &Reporter{
+		endpoint:    fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		auth:        fmt.Sprintf("Sentry sentry_version=7, sentry_client=%s, sentry_key=%s", clientName, u.User.Username()),
+		dsn:         cfg.DSN,
+		environment: cfg.Environment,
+		release:     release,
+		serverName:  serverName,
+		client:      client,
+		queue:       make(chan *Event, queueSize),
+	}
+	go r.run()
+	return r, nil
+}
+
+// BuildRevision is the VCS revision the binary was built from
+func BuildRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return ""
+}
+
+// Release is the release events are tagged with
+func (r *Reporter) Release() string {
+	if r == nil {
+		return ""
+	}
+	return r.release
+}
+
+// CaptureError reports a server error; skip drops that many callers of
+// CaptureError from the stack trace
+func (r *Reporter) CaptureError(err error, scope Scope, skip int) string {
+	if r == nil || err == nil {
+		return ""
+	}
+	e := r.event(LevelError, scope)
+	e.Exception = &struct {
+		Values []Exception `json:"values"`
+	}{Values: []Exception{{
+		Type:       fmt.Sprintf("%T", err),
+		Value:      err.Error(),
+		Stacktrace: stacktrace(skip + 2),
+		Mechanism:  &Mechanism{Type: "generic", Handled: true},
+	}}}
+	return r.enqueue(e)
+}
+
+// CaptureMessage reports a server error that is not a Go error, such as a
+// handler answering 500
+func (r *Reporter) CaptureMessage(message string, scope Scope) string {
+	if r == nil {
+		return ""
+	}
+	e := r.event(LevelError, scope)
+	e.Message = message
+	return r.enqueue(e)
+}
+
+// CapturePanic reports a recovered panic; call it from the deferred
+// function that recovered, so the trace ends where the panic was raised
+func (r *Reporter) CapturePanic(value interface{}, scope Scope) string {
+	if r == nil {
+		return ""
+	}
+	e := r.event(LevelFatal, scope)
+	e.Exception = &struct {
+		Values []Exception `json:"values"`
+	}{Values: []Exception{{
+		Type:       "panic",
+		Value:      fmt.Sprint(value),
+		Stacktrace: stacktrace(2),
+		Mechanism:  &Mechanism{Type: "panic", Handled: false},
+	}}}
+	if err, ok := value.(error); ok {
+		e.Exception.Values[0].Value = err.Error()
+	}
+	return r.enqueue(e)
+}
+
+func (r *Reporter) event(level string, scope Scope) *Event {
+	e := &Event{
+		EventID:     newEventID(),
+		Timestamp:   time.Now().UTC(),
+		Level:       level,
+		Platform:    "go",
+		Logger:      "synthos-api",
+		Release:     r.release,
+		Environment: r.environment,
+		ServerName:  r.serverName,
+		Transaction: scope.Route,
+		Request:     scope.Request,
+		Tags:        map[string]string{},
+	}
+	for k, v := range scope.Tags {
+		e.Tags[k] = v
+	}
+	if scope.Route != "" {
+		e.Tags["route"] = scope.Route
+	}
+	if scope.UserID != 0 {
+		e.User = map[string]string{"id": fmt.Sprint(scope.UserID)}
+	}
+	if scope.OrgID != 0 {
+		e.Tags["org_id"] = fmt.Sprint(scope.OrgID)
+	}
+	if scope.TraceID != "" {
+		e.Tags["trace_id"] = scope.TraceID
+		e.Contexts = map[string]map[string]string{"trace": {"trace_id": scope.TraceID, "span_id": scope.SpanID}}
+	}
+	return e
+}
+
+// enqueue hands an event to the sender and returns its ID; events are
+// dropped while the queue is full or after Close
+func (r *Reporter) enqueue(e *Event) (id string) {
+	defer func() {
+		// Sending on a closed queue after Close drops the event
+		if recover() != nil {
+			r.pending.Done()
+			id = ""
+		}
+	}()
+	r.pending.Add(1)
+	select {
+	case r.queue <- e:
+		return e.EventID
+	default:
+		r.pending.Done()
+		return ""
+	}
+}
+
+func (r *Reporter) run() {
+	for e := range r.queue {
+		_ = r.send(e)
+		r.pending.Done()
+	}
+}
+
+// send posts an event to Sentry as an envelope
+func (r *Reporter) send(e *Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	header, _ := json.Marshal(map[string]string{
+		"event_id": e.EventID,
+		"sent_at":  time.Now().UTC().Format(time.RFC3339),
+		"dsn":      r.dsn,
+	})
+	item, _ := json.Marshal(map[string]interface{}{"type": "event", "length": len(body)})
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.WriteByte('\n')
+	buf.Write(item)
+	buf.WriteByte('\n')
+	buf.Write(body)
+	buf.WriteByte('\n')
+
+	ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sentry: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Flush waits up to timeout for queued events to be sent and reports
+// whether they all were
+func (r *Reporter) Flush(timeout time.Duration) bool {
+	if r == nil {
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// Close flushes queued events and stops the reporter
+func (r *Reporter) Close(timeout time.Duration) bool {
+	if r == nil {
+		return true
+	}
+	ok := r.Flush(timeout)
+	r.closeOnce.Do(func() { close(r.queue) })
+	return ok
+}
+
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// stacktrace is the caller's stack, skipping skip frames above it
+func stacktrace(skip int) *Stacktrace {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var out []Frame
+	for {
+		f, more := frames.Next()
+		if f.Function != "" && !strings.HasPrefix(f.Function, "runtime.") {
+			module, function := splitFunction(f.Function)
+			out = append(out, Frame{
+				Function: function,
+				Module:   module,
+				File:     trimPath(f.File),
+				AbsPath:  f.File,
+				Line:     f.Line,
+				InApp:    strings.HasPrefix(f.Function, modulePath),
+			})
+		}
+		if !more {
+			break
+		}
+	}
+	// Sentry lists the oldest call first
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return &Stacktrace{Frames: out}
+}
+
+// splitFunction splits a qualified function name into its package and name
+func splitFunction(name string) (module, function string) {
+	slash := strings.LastIndex(name, "/")
+	dot := strings.Index(name[slash+1:], ".")
+	if dot < 0 {
+		return "", name
+	}
+	return name[:slash+1+dot], name[slash+2+dot:]
+}
+
+// trimPath shortens a file to its path within the module
+func trimPath(file string) string {
+	if i := strings.Index(file, "/backend-go/"); i >= 0 {
+		return file[i+len("/backend-go/"):]
+	}
+	return file
+}
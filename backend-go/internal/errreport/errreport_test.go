@@ -0,0 +1,164 @@
+// Package errreport_test provides unit tests for error reporting
+package errreport_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/errreport"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sentry struct {
+	mu     sync.Mutex
+	paths  []string
+	auths  []string
+	events []map[string]interface{}
+}
+
+func (s *sentry) handler(w http.ResponseWriter, r *http.Request) {
+	sc := bufio.NewScanner(r.Body)
+	sc.Buffer(make([]byte, 1<<20), 1<<20)
+	var lines []string
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	var event map[string]interface{}
+	if len(lines) == 3 {
+		_ = json.Unmarshal([]byte(lines[2]), &event)
+	}
+	s.mu.Lock()
+	s.paths = append(s.paths, r.URL.Path)
+	s.auths = append(s.auths, r.Header.Get("X-Sentry-Auth"))
+	s.events = append(s.events, event)
+	s.mu.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func newReporter(t *testing.T) (*errreport.Reporter, *sentry) {
+	s := &sentry{}
+	srv := httptest.NewServer(http.HandlerFunc(s.handler))
+	t.Cleanup(srv.Close)
+	dsn := strings.Replace(srv.URL, "http://", "http://publickey@", 1) + "/42"
+	r, err := errreport.New(errreport.Config{DSN: dsn, Environment: "test", Release: "v1.2.3", ServerName: "api-1"})
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close(time.Second) })
+	return r, s
+}
+
+func TestNewRejectsInvalidDSN(t *testing.T) {
+	r, err := errreport.New(errreport.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+
+	for _, dsn := range []string{"https://sentry.io/1", "https://key@sentry.io/", "::"} {
+		_, err := errreport.New(errreport.Config{DSN: dsn})
+		assert.ErrorIs(t, err, errreport.ErrInvalidDSN, dsn)
+	}
+}
+
+func TestNilReporterDropsEvents(t *testing.T) {
+	var r *errreport.Reporter
+	assert.Empty(t, r.CaptureError(errors.New("boom"), errreport.Scope{}, 0))
+	assert.Empty(t, r.CapturePanic("boom", errreport.Scope{}))
+	assert.True(t, r.Flush(time.Millisecond))
+}
+
+func TestCaptureErrorSendsEnvelope(t *testing.T) {
+	r, s := newReporter(t)
+	id := r.CaptureError(errors.New("query failed"), errreport.Scope{
+		Request: &errreport.Request{Method: "GET", URL: "http://api/datasets/7"},
+		Route:   "/api/v1/datasets/:id",
+		UserID:  12,
+		OrgID:   3,
+		TraceID: "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:  "00f067aa0ba902b7",
+	}, 0)
+	require.NotEmpty(t, id)
+	require.True(t, r.Flush(time.Second))
+
+	require.Len(t, s.events, 1)
+	assert.Equal(t, "/api/42/envelope/", s.paths[0])
+	assert.Contains(t, s.auths[0], "sentry_key=publickey")
+	e := s.events[0]
+	assert.Equal(t, id, e["event_id"])
+	assert.Equal(t, "v1.2.3", e["release"])
+	assert.Equal(t, "test", e["environment"])
+	assert.Equal(t, "/api/v1/datasets/:id", e["transaction"])
+	assert.Equal(t, map[string]interface{}{"id": "12"}, e["user"])
+	tags := e["tags"].(map[string]interface{})
+	assert.Equal(t, "3", tags["org_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tags["trace_id"])
+	exc := e["exception"].(map[string]interface{})["values"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "query failed", exc["value"])
+	frames := exc["stacktrace"].(map[string]interface{})["frames"].([]interface{})
+	last := frames[len(frames)-1].(map[string]interface{})
+	assert.Equal(t, "TestCaptureErrorSendsEnvelope", last["function"])
+}
+
+func TestRecoverAnswersPanicsWith500(t *testing.T) {
+	r, s := newReporter(t)
+	app := fiber.New()
+	app.Use(middleware.Trace())
+	app.Use(middleware.Recover(r, nil, func(int64) int64 { return 9 }))
+	app.Use(middleware.ReportErrors(r, nil))
+	app.Get("/boom/:id", func(c *fiber.Ctx) error {
+		c.Locals("user_id", int64(5))
+		panic("nil map")
+	})
+
+	req := httptest.NewRequest("GET", "/boom/1?email=a@b.c", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", resp.Header.Get("X-Trace-ID"))
+	body, _ := io.ReadAll(resp.Body)
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(body, &out))
+	assert.Equal(t, "internal_error", out["error"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", out["trace_id"])
+	assert.NotEmpty(t, out["event_id"])
+
+	require.True(t, r.Flush(time.Second))
+	require.Len(t, s.events, 1)
+	e := s.events[0]
+	assert.Equal(t, "fatal", e["level"])
+	assert.Equal(t, "/boom/:id", e["transaction"])
+	assert.Equal(t, "9", e["tags"].(map[string]interface{})["org_id"])
+	raw, _ := json.Marshal(e)
+	assert.NotContains(t, string(raw), "a@b.c")
+	assert.NotContains(t, string(raw), "secret")
+}
+
+func TestReportErrorsSkipsClientErrors(t *testing.T) {
+	r, s := newReporter(t)
+	app := fiber.New()
+	app.Use(middleware.ReportErrors(r, nil))
+	app.Get("/missing", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	})
+	app.Get("/failed", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	})
+
+	for _, path := range []string{"/missing", "/failed"} {
+		_, err := app.Test(httptest.NewRequest("GET", path, nil))
+		require.NoError(t, err)
+	}
+	require.True(t, r.Flush(time.Second))
+	require.Len(t, s.events, 1)
+	assert.Equal(t, "list_failed", s.events[0]["tags"].(map[string]interface{})["error_code"])
+}
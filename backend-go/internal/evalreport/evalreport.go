@@ -0,0 +1,239 @@
+// Package evalreport renders the evaluation report of a completed job for
+// people to read: how the distributions and correlations of its rows
+// compare with the source, its privacy measures and the compliance flags
+// it was generated under, as an HTML page and as a PDF document. Reports
+// are built from what the job recorded, never from its rows.
+package evalreport
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Report formats
+const (
+	FormatHTML = "html"
+	FormatPDF  = "pdf"
+)
+
+// Formats lists the formats reports are rendered in
+var Formats = []string{FormatHTML, FormatPDF}
+
+// Flag statuses
+const (
+	StatusPass = "pass"
+	StatusWarn = "warn"
+	StatusInfo = "info"
+)
+
+// Flag is a compliance finding about how a job was generated
+type Flag struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// Metric is a named measure shown as text
+type Metric struct {
+	Name  string
+	Value string
+}
+
+// Matrix is the correlation matrix of the numeric columns in the source and
+// in the generated rows
+type Matrix struct {
+	Columns   []string
+	Reference [][]float64
+	Synthetic [][]float64
+}
+
+// Report is what an evaluation report shows
+type Report struct {
+	JobID        int64
+	DatasetID    int64
+	GeneratedAt  time.Time
+	Rows         int64
+	Provider     string
+	Model        string
+	QualityScore *float64
+	// Scores are the fidelity scores, empty without source rows
+	Scores  []Metric
+	Columns []fidelity.ColumnReport
+	// Correlations is nil with fewer than two numeric columns
+	Correlations *Matrix
+	Privacy      []Metric
+	Flags        []Flag
+}
+
+// New builds the report of a completed job at now
+func New(job *models.GenerationJob, now time.Time) Report {
+	r := Report{JobID: job.ID, DatasetID: job.DatasetID, GeneratedAt: now.UTC(), Rows: job.RowsGenerated, QualityScore: job.QualityScore}
+	if job.Provider != nil {
+		r.Provider = *job.Provider
+	}
+	if job.Model != nil {
+		r.Model = *job.Model
+	}
+	q := job.QualityDetails
+	if q == nil {
+		q = &models.QualityDetails{}
+	}
+	if f := q.Fidelity; f != nil {
+		r.Scores = []Metric{
+			{"Statistical similarity", score(f.StatisticalSimilarity)},
+			{"Distribution fidelity", score(f.DistributionFidelity)},
+			{"Correlation preservation", score(f.CorrelationPreservation)},
+			{"Indistinguishability", score(f.Indistinguishability)},
+			{"Largest correlation change", fmt.Sprintf("%.3f", f.MaxCorrelationDelta)},
+			{"Rows compared", fmt.Sprintf("%d source, %d generated", f.ReferenceRows, f.SyntheticRows)},
+		}
+		r.Columns = f.Columns
+		r.Correlations = matrix(f.Correlations)
+	}
+	r.Privacy = privacyMetrics(job, q)
+	r.Flags = flags(job, q)
+	return r
+}
+
+func score(x float64) string { return fmt.Sprintf("%.1f%%", 100*x) }
+
+// matrix lays the correlation pairs out as matrices over their columns
+func matrix(pairs []fidelity.CorrelationDelta) *Matrix {
+	var columns []string
+	for _, p := range pairs {
+		for _, c := range []string{p.A, p.B} {
+			if !slices.Contains(columns, c) {
+				columns = append(columns, c)
+			}
+		}
+	}
+	if len(columns) < 2 {
+		return nil
+	}
+	slices.Sort(columns)
+	m := &Matrix{Columns: columns, Reference: identity(len(columns)), Synthetic: identity(len(columns))}
+	for _, p := range pairs {
+		i, j := slices.Index(columns, p.A), slices.Index(columns, p.B)
+		m.Reference[i][j], m.Reference[j][i] = p.Reference, p.Reference
+		m.Synthetic[i][j], m.Synthetic[j][i] = p.Synthetic, p.Synthetic
+	}
+	return m
+}
+
+func identity(n int) [][]float64 {
+	out := make([][]float64, n)
+	for i := range out {
+		out[i] = make([]float64, n)
+		out[i][i] = 1
+	}
+	return out
+}
+
+func privacyMetrics(job *models.GenerationJob, q *models.QualityDetails) []Metric {
+	var out []Metric
+	if job.PrivacyLevel != nil && *job.PrivacyLevel != "" {
+		out = append(out, Metric{"Privacy level", *job.PrivacyLevel})
+	}
+	if p := q.Privacy; p != nil {
+		out = append(out, Metric{"Privacy budget spent", fmt.Sprintf("ε %.3g of %.3g, δ %.3g of %.3g", p.SpentEpsilon, p.Epsilon, p.SpentDelta, p.Delta)})
+		for _, c := range p.Columns {
+			out = append(out, Metric{"Column " + c.Column, fmt.Sprintf("%s: %d values protected, %d suppressed", c.Mechanism, c.Protected, c.Suppressed)})
+		}
+	}
+	if risk := copyRate(q.QualityGate); risk != nil {
+		out = append(out, Metric{"Rows copying a source row", score(*risk)})
+	}
+	if f := q.Fidelity; f != nil {
+		out = append(out, Metric{"Propensity MSE", fmt.Sprintf("%.4f", f.PropensityMSE)}, Metric{"Maximum mean discrepancy", fmt.Sprintf("%.4f", f.MMD)})
+	}
+	for _, t := range q.FreeText {
+		out = append(out, Metric{"Free text " + t.Column, fmt.Sprintf("%d of %d values redacted, %d copies, residual risk %s", t.Redacted, t.Checked, t.Copies, t.ResidualRisk)})
+	}
+	return out
+}
+
+// copyRate is the privacy risk the quality gate measured on the delivered
+// rows, if it did
+func copyRate(gate *models.QualityGateReport) *float64 {
+	if gate == nil || len(gate.Attempts) == 0 {
+		return nil
+	}
+	for _, c := range gate.Attempts[len(gate.Attempts)-1].Checks {
+		if c.Metric == models.MetricPrivacyRisk {
+			return c.Value
+		}
+	}
+	return nil
+}
+
+func flags(job *models.GenerationJob, q *models.QualityDetails) []Flag {
+	var out []Flag
+	if job.DataMode == models.DataModeZeroRealData {
+		out = append(out, Flag{"Zero real data", StatusPass, "No source rows were shared with the provider"})
+	} else {
+		out = append(out, Flag{"Source data", StatusInfo, fmt.Sprintf("Generated in %s mode (set by %s)", job.DataMode, job.DataModeSource)})
+	}
+	if len(job.MaskedColumns) > 0 {
+		out = append(out, Flag{"Masked columns", StatusPass, strings.Join(job.MaskedColumns, ", ")})
+	}
+	if q.Privacy != nil && len(q.Privacy.Columns) > 0 {
+		out = append(out, Flag{"Column protection", StatusPass, fmt.Sprintf("%d columns protected", len(q.Privacy.Columns))})
+	}
+	for _, t := range q.FreeText {
+		if t.Copies > 0 || t.ResidualRisk == "high" {
+			out = append(out, Flag{"Free text " + t.Column, StatusWarn, fmt.Sprintf("%d copied values, residual risk %s", t.Copies, t.ResidualRisk)})
+		}
+	}
+	if q.Fidelity != nil {
+		for _, c := range q.Fidelity.Columns {
+			if c.Missing {
+				out = append(out, Flag{"Column " + c.Column, StatusWarn, "No generated row has a value for this source column"})
+			}
+		}
+	}
+	if g := q.QualityGate; g != nil {
+		out = append(out, Flag{"Quality policy", StatusPass, fmt.Sprintf("Met after %d attempt(s)", len(g.Attempts))})
+	}
+	if q.Watermark != nil {
+		out = append(out, Flag{"Watermark", StatusInfo, fmt.Sprintf("%s over %d columns", q.Watermark.Scheme, len(q.Watermark.Columns))})
+	}
+	if q.Provenance != nil {
+		out = append(out, Flag{"Provenance", StatusInfo, "Rows carry their generation lineage"})
+	}
+	return out
+}
+
+// heat is the color of a correlation: red for positive, blue for negative,
+// stronger the closer to ±1
+func heat(r float64) (float64, float64, float64) {
+	a := math.Min(1, math.Abs(r))
+	if r >= 0 {
+		return 1, 1 - 0.75*a, 1 - 0.75*a
+	}
+	return 1 - 0.75*a, 1 - 0.75*a, 1
+}
+
+// Render renders a report in format
+func Render(r Report, format string) ([]byte, error) {
+	switch format {
+	case FormatHTML:
+		return HTML(r)
+	case FormatPDF:
+		return PDF(r)
+	}
+	return nil, fmt.Errorf("unsupported report format %q", format)
+}
+
+// ContentType is the media type of a report format
+func ContentType(format string) string {
+	if format == FormatPDF {
+		return "application/pdf"
+	}
+	return "text/html; charset=utf-8"
+}
@@ -0,0 +1,95 @@
+// Package evalreport_test provides unit tests for job evaluation reports
+package evalreport_test
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/evalreport"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func completedJob() *models.GenerationJob {
+	rows := func(shift float64) []map[string]interface{} {
+		out := make([]map[string]interface{}, 60)
+		for i := range out {
+			out[i] = map[string]interface{}{"age": float64(20+i%40) + shift, "income": float64(1000*i) + shift, "<b>plan": []string{"free", "pro"}[i%2]}
+		}
+		return out
+	}
+	score, provider, model := 0.9, "vertex_ai", "gemini"
+	return &models.GenerationJob{
+		ID: 5, DatasetID: 3, RowsGenerated: 60, QualityScore: &score, Provider: &provider, Model: &model,
+		DataMode: models.DataModeZeroRealData, MaskedColumns: []string{"email"},
+		QualityDetails: &models.QualityDetails{
+			Fidelity: fidelity.Compare(rows(0), rows(3)),
+			Privacy:  &models.PrivacyReport{Level: "high", Epsilon: 1, SpentEpsilon: 0.5, Columns: []models.ColumnPrivacyReport{{Column: "income", Mechanism: "laplace", Protected: 60}}},
+			FreeText: []models.FreeTextReport{{Column: "notes", Checked: 60, Redacted: 2, Copies: 1, ResidualRisk: "low"}},
+		},
+	}
+}
+
+func TestNew(t *testing.T) {
+	r := evalreport.New(completedJob(), time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, "vertex_ai", r.Provider)
+	require.NotEmpty(t, r.Scores)
+	require.Len(t, r.Columns, 3)
+	require.NotNil(t, r.Correlations)
+	assert.Equal(t, []string{"age", "income"}, r.Correlations.Columns)
+	assert.InDelta(t, 1, r.Correlations.Reference[0][0], 1e-9)
+
+	statuses := map[string]string{}
+	for _, f := range r.Flags {
+		statuses[f.Name] = f.Status
+	}
+	assert.Equal(t, evalreport.StatusPass, statuses["Zero real data"])
+	assert.Equal(t, evalreport.StatusPass, statuses["Masked columns"])
+	assert.Equal(t, evalreport.StatusWarn, statuses["Free text notes"], "copied free text is flagged")
+}
+
+func TestHTML(t *testing.T) {
+	out, err := evalreport.HTML(evalreport.New(completedJob(), time.Now()))
+	require.NoError(t, err)
+	html := string(out)
+	assert.Contains(t, html, "Evaluation report: job 5")
+	assert.Contains(t, html, "<svg")
+	assert.Contains(t, html, "Correlations")
+	assert.Contains(t, html, "&lt;b&gt;plan", "column names are escaped")
+	assert.NotContains(t, html, "<b>plan")
+}
+
+func TestHTMLWithoutSource(t *testing.T) {
+	job := completedJob()
+	job.QualityDetails = nil
+	out, err := evalreport.HTML(evalreport.New(job, time.Now()))
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "without source rows")
+	assert.NotContains(t, string(out), "<svg")
+}
+
+func TestPDF(t *testing.T) {
+	out, err := evalreport.PDF(evalreport.New(completedJob(), time.Now()))
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(out, []byte("%PDF-1.4")))
+	assert.True(t, bytes.HasSuffix(out, []byte("%%EOF\n")))
+
+	// The cross-reference table is where the trailer says, and each entry
+	// points at its object
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(out)
+	require.NotNil(t, m)
+	xref, _ := strconv.Atoi(string(m[1]))
+	require.True(t, bytes.HasPrefix(out[xref:], []byte("xref\n")))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out[xref:], -1)
+	require.NotEmpty(t, entries)
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		assert.True(t, bytes.HasPrefix(out[offset:], []byte(fmt.Sprintf("%d 0 obj", i+1))), "object %d", i+1)
+	}
+}
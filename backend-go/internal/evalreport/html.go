@@ -0,0 +1,188 @@
+package evalreport
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+)
+
+// Chart sizes, in SVG user units
+const (
+	chartWidth  = 520.0
+	chartHeight = 160.0
+	chartLabels = 40.0
+	heatmapSize = 260.0
+)
+
+type rect struct {
+	X, Y, W, H float64
+	Fill       string
+	Title      string
+}
+
+type label struct {
+	X, Y float64
+	Text string
+}
+
+type columnChart struct {
+	Column, Kind, Test string
+	Similarity         string
+	PValue             string
+	Missing            bool
+	Bars               []rect
+	Labels             []label
+}
+
+type heatmap struct {
+	Title  string
+	Cells  []rect
+	Labels []label
+}
+
+type htmlView struct {
+	Report
+	Charts   []columnChart
+	Heatmaps []heatmap
+}
+
+// HTML renders a report as a self-contained page with inline SVG charts
+func HTML(r Report) ([]byte, error) {
+	v := htmlView{Report: r}
+	for _, c := range r.Columns {
+		v.Charts = append(v.Charts, chart(c))
+	}
+	if m := r.Correlations; m != nil {
+		v.Heatmaps = []heatmap{heatmapOf("Source", m.Columns, m.Reference), heatmapOf("Generated", m.Columns, m.Synthetic)}
+	}
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, v); err != nil {
+		return nil, fmt.Errorf("failed to render report: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// chart draws the bins of a column as pairs of bars, scaled to the largest
+// share
+func chart(c fidelity.ColumnReport) columnChart {
+	out := columnChart{Column: c.Column, Kind: c.Kind, Test: c.Test, Similarity: score(c.Similarity), PValue: fmt.Sprintf("%.3g", c.PValue), Missing: c.Missing}
+	bs := c.Bins
+	if len(bs) == 0 {
+		return out
+	}
+	top := 0.0
+	for _, b := range bs {
+		top = math.Max(top, math.Max(b.Reference, b.Synthetic))
+	}
+	if top == 0 {
+		top = 1
+	}
+	group := chartWidth / float64(len(bs))
+	bar := group * 0.4
+	for i, b := range bs {
+		x := float64(i) * group
+		for j, share := range []float64{b.Reference, b.Synthetic} {
+			h := chartHeight * share / top
+			fill, who := "#7a8ca3", "source"
+			if j == 1 {
+				fill, who = "#e07a3f", "generated"
+			}
+			out.Bars = append(out.Bars, rect{X: x + group*0.1 + float64(j)*bar, Y: chartHeight - h, W: bar, H: h, Fill: fill,
+				Title: fmt.Sprintf("%s: %s %.1f%%", b.Label, who, 100*share)})
+		}
+		if len(bs) <= 12 {
+			out.Labels = append(out.Labels, label{X: x + group/2, Y: chartHeight + 14, Text: truncate(b.Label, 14)})
+		}
+	}
+	return out
+}
+
+func heatmapOf(title string, columns []string, m [][]float64) heatmap {
+	out := heatmap{Title: title}
+	cell := heatmapSize / float64(len(columns))
+	for i := range m {
+		for j, r := range m[i] {
+			red, green, blue := heat(r)
+			out.Cells = append(out.Cells, rect{X: chartLabels*2 + float64(j)*cell, Y: float64(i) * cell, W: cell, H: cell,
+				Fill:  fmt.Sprintf("rgb(%d,%d,%d)", int(255*red), int(255*green), int(255*blue)),
+				Title: fmt.Sprintf("%s × %s: %.3f", columns[i], columns[j], r)})
+		}
+		out.Labels = append(out.Labels, label{X: chartLabels*2 - 4, Y: (float64(i) + 0.6) * cell, Text: truncate(columns[i], 12)})
+	}
+	return out
+}
+
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
+
+var page = template.Must(template.New("report").Funcs(template.FuncMap{
+	"pct": func(p *float64) string {
+		if p == nil {
+			return "n/a"
+		}
+		return score(*p)
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Evaluation report: job {{.JobID}}</title>
+<style>
+body{font-family:-apple-system,Helvetica,Arial,sans-serif;color:#1d2733;max-width:960px;margin:2em auto;padding:0 1em}
+h1{font-size:1.6em}h2{border-bottom:1px solid #d5dbe3;padding-bottom:.2em;margin-top:2em}
+table{border-collapse:collapse;width:100%}td,th{text-align:left;padding:.3em .6em;border-bottom:1px solid #eef1f5}
+.pass{color:#23834b}.warn{color:#b5551d}.info{color:#51606f}
+.chart{margin:1em 0 2em}.legend span{display:inline-block;width:.8em;height:.8em;margin:0 .3em 0 1em}
+svg text{font-size:10px;fill:#51606f}
+</style>
+</head>
+<body>
+<h1>Evaluation report: job {{.JobID}}</h1>
+<table>
+<tr><th>Dataset</th><td>{{.DatasetID}}</td></tr>
+<tr><th>Rows generated</th><td>{{.Rows}}</td></tr>
+<tr><th>Provider</th><td>{{.Provider}} {{.Model}}</td></tr>
+<tr><th>Quality score</th><td>{{pct .QualityScore}}</td></tr>
+<tr><th>Report generated</th><td>{{.GeneratedAt.Format "2006-01-02 15:04 UTC"}}</td></tr>
+</table>
+
+<h2>Fidelity</h2>
+{{if .Scores}}<table>{{range .Scores}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>{{end}}</table>
+{{else}}<p>The job was generated without source rows, so its rows were not compared with the source.</p>{{end}}
+
+{{if .Charts}}<h2>Distributions</h2>
+<p class="legend"><span style="background:#7a8ca3"></span>source<span style="background:#e07a3f"></span>generated</p>
+{{range .Charts}}<div class="chart">
+<h3>{{.Column}} <small>({{.Kind}}, {{.Test}} p={{.PValue}}, similarity {{.Similarity}})</small></h3>
+{{if .Missing}}<p class="warn">No generated row has a value for this column.</p>{{else}}
+<svg width="520" height="200" viewBox="0 0 520 200" role="img">
+{{range .Bars}}<rect x="{{printf "%.1f" .X}}" y="{{printf "%.1f" .Y}}" width="{{printf "%.1f" .W}}" height="{{printf "%.1f" .H}}" fill="{{.Fill}}"><title>{{.Title}}</title></rect>
+{{end}}{{range .Labels}}<text x="{{printf "%.1f" .X}}" y="{{printf "%.1f" .Y}}" text-anchor="middle">{{.Text}}</text>
+{{end}}</svg>{{end}}
+</div>{{end}}{{end}}
+
+{{if .Heatmaps}}<h2>Correlations</h2>
+<p>Pearson correlations of the numeric columns, from blue (−1) through white (0) to red (+1).</p>
+{{range .Heatmaps}}<div class="chart"><h3>{{.Title}}</h3>
+<svg width="360" height="270" viewBox="0 0 360 270" role="img">
+{{range .Cells}}<rect x="{{printf "%.1f" .X}}" y="{{printf "%.1f" .Y}}" width="{{printf "%.1f" .W}}" height="{{printf "%.1f" .H}}" fill="{{.Fill}}" stroke="#fff"><title>{{.Title}}</title></rect>
+{{end}}{{range .Labels}}<text x="{{printf "%.1f" .X}}" y="{{printf "%.1f" .Y}}" text-anchor="end">{{.Text}}</text>
+{{end}}</svg></div>{{end}}{{end}}
+
+<h2>Privacy</h2>
+{{if .Privacy}}<table>{{range .Privacy}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>{{end}}</table>
+{{else}}<p>No privacy measures were recorded for this job.</p>{{end}}
+
+<h2>Compliance</h2>
+<table>{{range .Flags}}<tr><th>{{.Name}}</th><td class="{{.Status}}">{{.Status}}</td><td>{{.Detail}}</td></tr>{{end}}</table>
+</body>
+</html>
+`))
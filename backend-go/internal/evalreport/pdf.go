@@ -0,0 +1,282 @@
+package evalreport
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// A4 in points
+const (
+	pageWidth  = 595.0
+	pageHeight = 842.0
+	margin     = 50.0
+)
+
+// PDF renders a report as a PDF document in the standard Helvetica fonts,
+// with the same charts drawn as filled rectangles
+func PDF(r Report) ([]byte, error) {
+	d := &pdfDoc{}
+	d.newPage()
+	d.line(18, true, fmt.Sprintf("Evaluation report: job %d", r.JobID))
+	d.space(4)
+	d.line(10, false, fmt.Sprintf("Dataset %d, %d rows generated by %s %s", r.DatasetID, r.Rows, r.Provider, r.Model))
+	quality := "n/a"
+	if r.QualityScore != nil {
+		quality = score(*r.QualityScore)
+	}
+	d.line(10, false, "Quality score "+quality+", report generated "+r.GeneratedAt.Format("2006-01-02 15:04 UTC"))
+
+	d.heading("Fidelity")
+	if len(r.Scores) == 0 {
+		d.paragraph("The job was generated without source rows, so its rows were not compared with the source.")
+	}
+	d.metrics(r.Scores)
+
+	if len(r.Columns) > 0 {
+		d.heading("Distributions")
+		d.legend()
+		for _, c := range r.Columns {
+			d.columnChart(chart(c))
+		}
+	}
+	if m := r.Correlations; m != nil {
+		d.heading("Correlations")
+		d.paragraph("Pearson correlations of the numeric columns, from blue (-1) through white (0) to red (+1).")
+		d.heatmaps(m)
+	}
+
+	d.heading("Privacy")
+	if len(r.Privacy) == 0 {
+		d.paragraph("No privacy measures were recorded for this job.")
+	}
+	d.metrics(r.Privacy)
+
+	d.heading("Compliance")
+	for _, f := range r.Flags {
+		d.need(14)
+		red, green, blue := statusColor(f.Status)
+		d.text(margin, d.y-10, 10, true, truncate(f.Name, 30), 0, 0, 0)
+		d.text(margin+170, d.y-10, 10, true, f.Status, red, green, blue)
+		d.text(margin+210, d.y-10, 10, false, truncate(f.Detail, 60), 0, 0, 0)
+		d.y -= 14
+	}
+	return d.bytes()
+}
+
+func statusColor(status string) (float64, float64, float64) {
+	switch status {
+	case StatusPass:
+		return 0.14, 0.51, 0.29
+	case StatusWarn:
+		return 0.71, 0.33, 0.11
+	}
+	return 0.32, 0.38, 0.44
+}
+
+// pdfDoc lays out pages top down; y is the baseline of the next line
+type pdfDoc struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func (d *pdfDoc) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = pageHeight - margin
+}
+
+// need starts a new page unless h points fit above the bottom margin
+func (d *pdfDoc) need(h float64) {
+	if d.y-h < margin {
+		d.newPage()
+	}
+}
+
+func (d *pdfDoc) space(h float64) { d.y -= h }
+
+func (d *pdfDoc) text(x, y, size float64, bold bool, s string, red, green, blue float64) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(d.page, "BT %.3f %.3f %.3f rg /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", red, green, blue, font, size, x, y, pdfString(s))
+}
+
+func (d *pdfDoc) rect(x, y, w, h, red, green, blue float64) {
+	fmt.Fprintf(d.page, "%.3f %.3f %.3f rg %.2f %.2f %.2f %.2f re f\n", red, green, blue, x, y, w, h)
+}
+
+func (d *pdfDoc) line(size float64, bold bool, s string) {
+	d.need(size * 1.4)
+	d.text(margin, d.y-size, size, bold, s, 0, 0, 0)
+	d.y -= size * 1.4
+}
+
+func (d *pdfDoc) heading(s string) {
+	d.need(60)
+	d.space(10)
+	d.line(14, true, s)
+	d.space(2)
+}
+
+// paragraph wraps s at about the width of the page
+func (d *pdfDoc) paragraph(s string) {
+	var line []string
+	for _, w := range strings.Fields(s) {
+		if n := len(strings.Join(append(line, w), " ")); n > 95 && len(line) > 0 {
+			d.line(10, false, strings.Join(line, " "))
+			line = nil
+		}
+		line = append(line, w)
+	}
+	if len(line) > 0 {
+		d.line(10, false, strings.Join(line, " "))
+	}
+}
+
+func (d *pdfDoc) metrics(ms []Metric) {
+	for _, m := range ms {
+		d.need(14)
+		d.text(margin, d.y-10, 10, true, truncate(m.Name, 32), 0, 0, 0)
+		d.text(margin+190, d.y-10, 10, false, truncate(m.Value, 58), 0, 0, 0)
+		d.y -= 14
+	}
+}
+
+var (
+	sourceColor    = [3]float64{0.478, 0.549, 0.639}
+	generatedColor = [3]float64{0.878, 0.478, 0.247}
+)
+
+func (d *pdfDoc) legend() {
+	d.need(16)
+	d.rect(margin, d.y-9, 8, 8, sourceColor[0], sourceColor[1], sourceColor[2])
+	d.text(margin+12, d.y-9, 9, false, "source", 0, 0, 0)
+	d.rect(margin+60, d.y-9, 8, 8, generatedColor[0], generatedColor[1], generatedColor[2])
+	d.text(margin+72, d.y-9, 9, false, "generated", 0, 0, 0)
+	d.y -= 16
+}
+
+// columnChart draws a chart laid out for HTML, scaled to the page width
+func (d *pdfDoc) columnChart(c columnChart) {
+	const scale = (pageWidth - 2*margin) / chartWidth
+	height := chartHeight * scale * 0.6
+	d.need(height + 40)
+	d.text(margin, d.y-11, 11, true, fmt.Sprintf("%s (%s, %s p=%s, similarity %s)", truncate(c.Column, 40), c.Kind, c.Test, c.PValue, c.Similarity), 0, 0, 0)
+	d.y -= 16
+	if c.Missing {
+		d.text(margin, d.y-10, 10, false, "No generated row has a value for this column.", 0.71, 0.33, 0.11)
+		d.y -= 18
+		return
+	}
+	base := d.y - height
+	for _, b := range c.Bars {
+		color := sourceColor
+		if b.Fill != "#7a8ca3" {
+			color = generatedColor
+		}
+		d.rect(margin+b.X*scale, base, b.W*scale, b.H*scale*0.6, color[0], color[1], color[2])
+	}
+	for _, l := range c.Labels {
+		text := truncate(l.Text, 10)
+		d.text(margin+l.X*scale-float64(len(text))*1.6, base-8, 6, false, text, 0.32, 0.38, 0.44)
+	}
+	d.y = base - 16
+}
+
+// heatmaps draws the source and generated matrices side by side
+func (d *pdfDoc) heatmaps(m *Matrix) {
+	const size, labels = 180.0, 60.0
+	cell := size / float64(len(m.Columns))
+	d.need(size + 30)
+	top := d.y - 14
+	for k, values := range [][][]float64{m.Reference, m.Synthetic} {
+		left := margin + labels + float64(k)*(size+labels)
+		d.text(left, d.y-10, 10, true, []string{"Source", "Generated"}[k], 0, 0, 0)
+		for i := range values {
+			for j, r := range values[i] {
+				red, green, blue := heat(r)
+				d.rect(left+float64(j)*cell, top-float64(i+1)*cell, cell, cell, red, green, blue)
+			}
+			d.text(left-labels, top-float64(i+1)*cell+cell*0.3, math.Min(7, cell*0.8), false, truncate(m.Columns[i], 14), 0.32, 0.38, 0.44)
+		}
+	}
+	d.y = top - size - 12
+}
+
+// bytes writes the document: catalog, page tree, the two fonts, then each
+// page and its compressed content stream
+func (d *pdfDoc) bytes() ([]byte, error) {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 6+2*i))
+		var content bytes.Buffer
+		zw := zlib.NewWriter(&content)
+		if _, err := zw.Write(page.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", len(offsets), content.Len())
+		out.Write(content.Bytes())
+		out.WriteString("\nendstream\nendobj\n")
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
+
+// winAnsi maps the characters reports use outside Latin-1 to the
+// WinAnsiEncoding of the standard fonts
+var winAnsi = map[rune]string{
+	'–': "\x96", '—': "\x97", '…': "\x85", '•': "\x95", '’': "\x92", '“': "\x93", '”': "\x94",
+	'−': "-", '≤': "<=", '≥': ">=", 'ε': "epsilon", 'δ': "delta",
+}
+
+// pdfString encodes s for a literal string of a standard font
+func pdfString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20:
+			b.WriteByte(' ')
+		case r < 0x80:
+			b.WriteRune(r)
+		case winAnsi[r] != "":
+			b.WriteString(winAnsi[r])
+		case r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,300 @@
+// Package eventstream generates product-analytics event streams so
+// analytics teams can test dashboards without real user data. Users sign up
+// over the stream's days, come back following a retention curve, and in
+// each session fire a mix of events and walk through funnels that convert
+// step by step at the rates asked for. Streams are written as JSON Lines in
+// the shape of Segment's tracking API or Amplitude's HTTP API, ready for
+// their import tools. Nothing is drawn from a dataset.
+package eventstream
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stream formats
+const (
+	FormatSegment   = "segment"
+	FormatAmplitude = "amplitude"
+)
+
+// Model is the model recorded for event stream jobs
+const Model = "event_stream"
+
+const (
+	MaxUsers = 50000
+	MaxDays  = 180
+	// MaxEvents caps the events a stream is expected to have, as they are
+	// ordered in memory
+	MaxEvents       = 500000
+	MaxFunnels      = 10
+	MaxFunnelSteps  = 20
+	MaxEventTypes   = 100
+	MaxChoices      = 50
+	maxNameLength   = 100
+	dateLayout      = "2006-01-02"
+	defaultDays     = 30
+	defaultSessions = 1.5
+	defaultEvents   = 8
+	defaultMinutes  = 10
+)
+
+// Platforms are the platforms users may be on
+var Platforms = []string{"web", "ios", "android"}
+
+var (
+	ErrUnsupportedFormat = errors.New("format must be segment or amplitude")
+	ErrInvalidOptions    = errors.New("invalid event stream options")
+	ErrInvalidRetention  = errors.New("retention must map days from 1 to 180 to shares between 0 and 1 that never increase")
+	ErrInvalidFunnel     = errors.New("invalid funnel")
+	ErrInvalidEvent      = errors.New("invalid event type")
+	ErrTooManyEvents     = errors.New("too many events for one stream")
+)
+
+// Step is one event of a funnel; Conversion is the share of those who
+// reached the step before, or entered the funnel, who go on to it
+type Step struct {
+	Event      string  `json:"event"`
+	Conversion float64 `json:"conversion"`
+}
+
+// Funnel is a sequence of events users walk through in one session. A
+// funnel is entered in a user's first session, or in every session when it
+// is recurring.
+type Funnel struct {
+	Name      string `json:"name"`
+	Steps     []Step `json:"steps"`
+	Recurring bool   `json:"recurring,omitempty"`
+}
+
+// EventType is an event fired outside funnels, picked by weight. Each
+// property takes one of its choices.
+type EventType struct {
+	Name       string              `json:"name"`
+	Weight     float64             `json:"weight"`
+	Properties map[string][]string `json:"properties,omitempty"`
+}
+
+// Options parameterizes a stream. Unset values take the defaults filled in
+// by Defaults.
+type Options struct {
+	Format string `json:"format"`
+	Users  int    `json:"users"`
+	// StartDate is the first day of the stream, YYYY-MM-DD in UTC
+	StartDate string `json:"start_date,omitempty"`
+	Days      int    `json:"days,omitempty"`
+	// SessionsPerDay is the mean sessions of a user on a day they are
+	// active, at least one
+	SessionsPerDay float64 `json:"sessions_per_day,omitempty"`
+	// EventsPerSession is the mean events of a session outside funnels
+	EventsPerSession float64 `json:"events_per_session,omitempty"`
+	// SessionMinutes is the mean length of a session
+	SessionMinutes float64 `json:"session_minutes,omitempty"`
+	// Retention maps a day after signup to the share of users active on
+	// it; days between those given are interpolated and days after the
+	// last keep its share
+	Retention map[int]float64 `json:"retention,omitempty"`
+	Funnels   []Funnel        `json:"funnels,omitempty"`
+	Events    []EventType     `json:"events,omitempty"`
+	// Platforms maps web, ios and android to their share of users
+	Platforms map[string]float64 `json:"platforms,omitempty"`
+	// Seed makes a stream reproducible; the job's ID when unset
+	Seed *int64 `json:"seed,omitempty"`
+}
+
+// Defaults fills unset options, starting the stream so that it ends the
+// day before now
+func (o *Options) Defaults(now time.Time) {
+	if o.Days == 0 {
+		o.Days = defaultDays
+	}
+	if o.StartDate == "" {
+		o.StartDate = now.UTC().AddDate(0, 0, -o.Days).Format(dateLayout)
+	}
+	if o.SessionsPerDay == 0 {
+		o.SessionsPerDay = defaultSessions
+	}
+	if o.EventsPerSession == 0 {
+		o.EventsPerSession = defaultEvents
+	}
+	if o.SessionMinutes == 0 {
+		o.SessionMinutes = defaultMinutes
+	}
+	if len(o.Retention) == 0 {
+		o.Retention = map[int]float64{1: 0.4, 7: 0.2, 30: 0.12}
+	}
+	if o.Funnels == nil {
+		o.Funnels = []Funnel{{Name: "Onboarding", Steps: []Step{
+			{Event: "Signed Up", Conversion: 1},
+			{Event: "Onboarding Started", Conversion: 0.8},
+			{Event: "Profile Completed", Conversion: 0.6},
+			{Event: "First Project Created", Conversion: 0.5},
+		}}}
+	}
+	if len(o.Events) == 0 {
+		o.Events = []EventType{
+			{Name: "Page Viewed", Weight: 5, Properties: map[string][]string{"page": {"/", "/dashboard", "/projects", "/settings", "/pricing", "/docs"}}},
+			{Name: "Button Clicked", Weight: 2, Properties: map[string][]string{"button": {"create", "share", "export", "invite", "upgrade"}}},
+			{Name: "Search Performed", Weight: 1, Properties: map[string][]string{"results": {"none", "few", "many"}}},
+			{Name: "Feature Used", Weight: 1.5, Properties: map[string][]string{"feature": {"reports", "alerts", "exports", "integrations"}}},
+		}
+	}
+	if len(o.Platforms) == 0 {
+		o.Platforms = map[string]float64{"web": 0.6, "ios": 0.25, "android": 0.15}
+	}
+}
+
+// Validate checks options that have had their defaults filled
+func (o Options) Validate() error {
+	if o.Format != FormatSegment && o.Format != FormatAmplitude {
+		return ErrUnsupportedFormat
+	}
+	if o.Users < 1 || o.Users > MaxUsers {
+		return fmt.Errorf("%w: users must be between 1 and %d", ErrInvalidOptions, MaxUsers)
+	}
+	if o.Days < 1 || o.Days > MaxDays {
+		return fmt.Errorf("%w: days must be between 1 and %d", ErrInvalidOptions, MaxDays)
+	}
+	if _, err := time.Parse(dateLayout, o.StartDate); err != nil {
+		return fmt.Errorf("%w: start_date must be YYYY-MM-DD", ErrInvalidOptions)
+	}
+	if !between(o.SessionsPerDay, 1, 20) || !between(o.EventsPerSession, 1, 200) || !between(o.SessionMinutes, 0.1, 240) {
+		return fmt.Errorf("%w: sessions_per_day must be 1 to 20, events_per_session 1 to 200 and session_minutes up to 240", ErrInvalidOptions)
+	}
+	last := 1.0
+	for _, day := range sortedDays(o.Retention) {
+		share := o.Retention[day]
+		if day < 1 || day > MaxDays || !between(share, 0, 1) || share > last {
+			return ErrInvalidRetention
+		}
+		last = share
+	}
+	if len(o.Funnels) > MaxFunnels {
+		return fmt.Errorf("%w: at most %d", ErrInvalidFunnel, MaxFunnels)
+	}
+	for _, f := range o.Funnels {
+		if !validName(f.Name) || len(f.Steps) == 0 || len(f.Steps) > MaxFunnelSteps {
+			return fmt.Errorf("%w: %q needs a name and 1 to %d steps", ErrInvalidFunnel, f.Name, MaxFunnelSteps)
+		}
+		for _, s := range f.Steps {
+			if !validName(s.Event) || !between(s.Conversion, 0, 1) || s.Conversion == 0 {
+				return fmt.Errorf("%w: step %q of %q", ErrInvalidFunnel, s.Event, f.Name)
+			}
+		}
+	}
+	if len(o.Events) > MaxEventTypes {
+		return fmt.Errorf("%w: at most %d", ErrInvalidEvent, MaxEventTypes)
+	}
+	total := 0.0
+	for _, e := range o.Events {
+		if !validName(e.Name) || !between(e.Weight, 0, math.MaxFloat64) {
+			return fmt.Errorf("%w: %q", ErrInvalidEvent, e.Name)
+		}
+		for name, choices := range e.Properties {
+			if !validName(name) || len(choices) == 0 || len(choices) > MaxChoices {
+				return fmt.Errorf("%w: property %q of %q needs 1 to %d choices", ErrInvalidEvent, name, e.Name, MaxChoices)
+			}
+		}
+		total += e.Weight
+	}
+	if total == 0 {
+		return fmt.Errorf("%w: at least one event needs a weight", ErrInvalidEvent)
+	}
+	shares := 0.0
+	for platform, share := range o.Platforms {
+		if !contains(Platforms, platform) || !between(share, 0, math.MaxFloat64) {
+			return fmt.Errorf("%w: platforms are %s", ErrInvalidOptions, strings.Join(Platforms, ", "))
+		}
+		shares += share
+	}
+	if shares == 0 {
+		return fmt.Errorf("%w: at least one platform needs a share", ErrInvalidOptions)
+	}
+	if n := o.EstimatedEvents(); n > MaxEvents {
+		return fmt.Errorf("%w: about %d expected, at most %d", ErrTooManyEvents, n, MaxEvents)
+	}
+	return nil
+}
+
+// EstimatedEvents is how many events a stream is expected to have
+func (o Options) EstimatedEvents() int64 {
+	// Signups are spread evenly over the days, so a user's expected active
+	// days depend on how many days are left after their first
+	activeDays := 0.0
+	for first := 0; first < o.Days; first++ {
+		activeDays++
+		for d := 1; first+d < o.Days; d++ {
+			activeDays += retention(o.Retention, d)
+		}
+	}
+	activeDays /= float64(o.Days)
+	sessions := activeDays * o.SessionsPerDay
+	events := sessions * o.EventsPerSession
+	for _, f := range o.Funnels {
+		reached, expected := 1.0, 0.0
+		for _, s := range f.Steps {
+			reached *= s.Conversion
+			expected += reached
+		}
+		if f.Recurring {
+			expected *= sessions
+		}
+		events += expected
+	}
+	// Segment streams identify each user once
+	if o.Format == FormatSegment {
+		events++
+	}
+	return int64(math.Ceil(events * float64(o.Users)))
+}
+
+// retention is the share of users active d days after signup
+func retention(points map[int]float64, d int) float64 {
+	prevDay, prevShare := 0, 1.0
+	for _, day := range sortedDays(points) {
+		share := points[day]
+		if d == day {
+			return share
+		}
+		if d < day {
+			t := float64(d-prevDay) / float64(day-prevDay)
+			// Retention decays roughly geometrically between points
+			if prevShare > 0 && share > 0 {
+				return prevShare * math.Pow(share/prevShare, t)
+			}
+			return prevShare + (share-prevShare)*t
+		}
+		prevDay, prevShare = day, share
+	}
+	return prevShare
+}
+
+func sortedDays(points map[int]float64) []int {
+	days := make([]int, 0, len(points))
+	for day := range points {
+		days = append(days, day)
+	}
+	sort.Ints(days)
+	return days
+}
+
+func between(v, lo, hi float64) bool {
+	return !math.IsNaN(v) && v >= lo && v <= hi
+}
+
+func validName(s string) bool {
+	return strings.TrimSpace(s) != "" && len(s) <= maxNameLength
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+// Package eventstream_test provides unit tests for event stream generation
+package eventstream_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/eventstream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func options(format string, users int) eventstream.Options {
+	o := eventstream.Options{Format: format, Users: users}
+	o.Defaults(now)
+	return o
+}
+
+func lines(t *testing.T, out []byte) []map[string]any {
+	var records []map[string]any
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var r map[string]any
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &r))
+		records = append(records, r)
+	}
+	require.NoError(t, sc.Err())
+	return records
+}
+
+func TestDefaults(t *testing.T) {
+	o := options(eventstream.FormatSegment, 100)
+	require.NoError(t, o.Validate())
+	assert.Equal(t, 30, o.Days)
+	assert.Equal(t, "2026-01-30", o.StartDate)
+	require.Len(t, o.Funnels, 1)
+
+	// Funnels left empty on purpose stay empty
+	o = eventstream.Options{Format: eventstream.FormatAmplitude, Users: 1, Funnels: []eventstream.Funnel{}}
+	o.Defaults(now)
+	assert.Empty(t, o.Funnels)
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]struct {
+		edit func(*eventstream.Options)
+		err  error
+	}{
+		"format":      {func(o *eventstream.Options) { o.Format = "mixpanel" }, eventstream.ErrUnsupportedFormat},
+		"users":       {func(o *eventstream.Options) { o.Users = 0 }, eventstream.ErrInvalidOptions},
+		"days":        {func(o *eventstream.Options) { o.Days = eventstream.MaxDays + 1 }, eventstream.ErrInvalidOptions},
+		"start date":  {func(o *eventstream.Options) { o.StartDate = "01/02/2026" }, eventstream.ErrInvalidOptions},
+		"platform":    {func(o *eventstream.Options) { o.Platforms = map[string]float64{"tv": 1} }, eventstream.ErrInvalidOptions},
+		"retention":   {func(o *eventstream.Options) { o.Retention = map[int]float64{1: 0.2, 7: 0.3} }, eventstream.ErrInvalidRetention},
+		"retention 0": {func(o *eventstream.Options) { o.Retention = map[int]float64{0: 1} }, eventstream.ErrInvalidRetention},
+		"conversion": {func(o *eventstream.Options) {
+			o.Funnels = []eventstream.Funnel{{Name: "Checkout", Steps: []eventstream.Step{{Event: "Paid", Conversion: 1.5}}}}
+		}, eventstream.ErrInvalidFunnel},
+		"no steps":   {func(o *eventstream.Options) { o.Funnels = []eventstream.Funnel{{Name: "Checkout"}} }, eventstream.ErrInvalidFunnel},
+		"no weights": {func(o *eventstream.Options) { o.Events = []eventstream.EventType{{Name: "Viewed"}} }, eventstream.ErrInvalidEvent},
+		"property": {func(o *eventstream.Options) {
+			o.Events = []eventstream.EventType{{Name: "Viewed", Weight: 1, Properties: map[string][]string{"page": {}}}}
+		}, eventstream.ErrInvalidEvent},
+		"too many events": {func(o *eventstream.Options) {
+			o.Users, o.Days, o.EventsPerSession = eventstream.MaxUsers, eventstream.MaxDays, 200
+		}, eventstream.ErrTooManyEvents},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			o := options(eventstream.FormatSegment, 100)
+			tc.edit(&o)
+			assert.ErrorIs(t, o.Validate(), tc.err)
+		})
+	}
+}
+
+func TestSegmentStream(t *testing.T) {
+	o := options(eventstream.FormatSegment, 50)
+	out, report, err := eventstream.Generate(o, 7)
+	require.NoError(t, err)
+	records := lines(t, out)
+	require.Len(t, records, int(report.Events))
+	assert.Equal(t, int64(50), report.Users)
+
+	identified := map[any]bool{}
+	var last time.Time
+	for _, r := range records {
+		at, err := time.Parse(time.RFC3339, r["timestamp"].(string))
+		require.NoError(t, err)
+		assert.False(t, at.Before(last), "stream is in time order")
+		last = at
+		assert.NotEmpty(t, r["messageId"])
+		assert.NotEmpty(t, r["anonymousId"])
+		assert.NotEmpty(t, r["context"].(map[string]any)["library"])
+		switch r["type"] {
+		case "identify":
+			identified[r["userId"]] = true
+			assert.NotEmpty(t, r["traits"])
+		case "track":
+			assert.True(t, identified[r["userId"]], "users are identified before they are tracked")
+			assert.NotEmpty(t, r["event"])
+		default:
+			t.Fatalf("unexpected type %v", r["type"])
+		}
+	}
+	assert.Len(t, identified, 50)
+	assert.False(t, last.After(now), "default streams end before now")
+}
+
+func TestAmplitudeStream(t *testing.T) {
+	o := options(eventstream.FormatAmplitude, 50)
+	out, report, err := eventstream.Generate(o, 7)
+	require.NoError(t, err)
+	records := lines(t, out)
+	require.Len(t, records, int(report.Events))
+
+	withProperties := map[any]bool{}
+	for _, r := range records {
+		assert.NotEmpty(t, r["user_id"])
+		assert.NotEmpty(t, r["device_id"])
+		assert.NotEmpty(t, r["event_type"])
+		assert.NotEmpty(t, r["insert_id"])
+		assert.Contains(t, []any{"Web", "iOS", "Android"}, r["platform"])
+		assert.LessOrEqual(t, r["session_id"], r["time"])
+		if r["user_properties"] != nil {
+			assert.False(t, withProperties[r["user_id"]], "user properties are sent once")
+			withProperties[r["user_id"]] = true
+		}
+	}
+	assert.Len(t, withProperties, 50)
+}
+
+func TestSeedIsReproducible(t *testing.T) {
+	o := options(eventstream.FormatAmplitude, 20)
+	a, _, err := eventstream.Generate(o, 1)
+	require.NoError(t, err)
+	b, _, err := eventstream.Generate(o, 1)
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	seed := int64(1)
+	o.Seed = &seed
+	c, _, err := eventstream.Generate(o, 2)
+	require.NoError(t, err)
+	assert.Equal(t, a, c, "the options' seed overrides the job's")
+}
+
+func TestRetentionAndFunnelsFollowTargets(t *testing.T) {
+	// Day 30 retention is only seen in streams longer than 30 days
+	o := eventstream.Options{Format: eventstream.FormatAmplitude, Users: 3000, Days: 60}
+	o.Defaults(now)
+	o.Funnels = append(o.Funnels, eventstream.Funnel{Name: "Checkout", Recurring: true, Steps: []eventstream.Step{
+		{Event: "Cart Viewed", Conversion: 0.3},
+		{Event: "Checkout Started", Conversion: 0.5},
+	}})
+	out, report, err := eventstream.Generate(o, 3)
+	require.NoError(t, err)
+	assert.NotEmpty(t, out)
+
+	require.Len(t, report.Retention, 3)
+	for _, r := range report.Retention {
+		assert.Positive(t, r.Users)
+		assert.InDelta(t, r.Target, r.Observed, 0.03, "day %d", r.Day)
+	}
+	require.Len(t, report.Funnels, 2)
+	for _, f := range report.Funnels {
+		for _, s := range f.Steps {
+			assert.InDelta(t, s.Target, s.Conversion, 0.03, "%s: %s", f.Name, s.Event)
+		}
+	}
+	// Everyone signs up, and only recurring funnels run more than once a user
+	assert.Equal(t, int64(3000), report.Funnels[0].Steps[0].Reached)
+	assert.Greater(t, report.Funnels[1].Steps[0].Reached, int64(3000)*3/10)
+
+	// The estimate is what usage is charged for, so it tracks the stream
+	assert.InEpsilon(t, float64(o.EstimatedEvents()), float64(report.Events), 0.05)
+}
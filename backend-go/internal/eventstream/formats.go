@@ -0,0 +1,121 @@
+package eventstream
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Library versions reported in Segment contexts, per platform
+var segmentLibraries = map[string]segmentLibrary{
+	"web":     {Name: "analytics.js", Version: "4.1.0"},
+	"ios":     {Name: "analytics-ios", Version: "4.1.8"},
+	"android": {Name: "analytics-android", Version: "4.11.3"},
+}
+
+// Platform names as Amplitude reports them
+var amplitudePlatforms = map[string]string{"web": "Web", "ios": "iOS", "android": "Android"}
+
+type segmentLibrary struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type segmentContext struct {
+	Library segmentLibrary    `json:"library"`
+	OS      map[string]string `json:"os"`
+	Device  map[string]string `json:"device,omitempty"`
+}
+
+// segmentMessage is a track or identify call of Segment's tracking API
+type segmentMessage struct {
+	Type        string         `json:"type"`
+	MessageID   string         `json:"messageId"`
+	UserID      string         `json:"userId"`
+	AnonymousID string         `json:"anonymousId"`
+	Event       string         `json:"event,omitempty"`
+	Properties  map[string]any `json:"properties,omitempty"`
+	Traits      map[string]any `json:"traits,omitempty"`
+	Context     segmentContext `json:"context"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+// amplitudeEvent is an event of Amplitude's HTTP API
+type amplitudeEvent struct {
+	UserID          string         `json:"user_id"`
+	DeviceID        string         `json:"device_id"`
+	EventType       string         `json:"event_type"`
+	Time            int64          `json:"time"`
+	SessionID       int64          `json:"session_id"`
+	InsertID        string         `json:"insert_id"`
+	Platform        string         `json:"platform"`
+	OSName          string         `json:"os_name"`
+	EventProperties map[string]any `json:"event_properties,omitempty"`
+	UserProperties  map[string]any `json:"user_properties,omitempty"`
+}
+
+func (g *generator) segmentContext(u *user) segmentContext {
+	c := segmentContext{Library: segmentLibraries[u.platform], OS: map[string]string{"name": u.os}}
+	if u.platform != "web" {
+		c.Device = map[string]string{"type": u.platform}
+	}
+	return c
+}
+
+// identify records a user's traits when they sign up
+func (g *generator) identify(u *user) error {
+	line, err := json.Marshal(segmentMessage{
+		Type:        "identify",
+		MessageID:   g.uuid(),
+		UserID:      u.id,
+		AnonymousID: u.anonymousID,
+		Traits:      g.traits(u),
+		Context:     g.segmentContext(u),
+		Timestamp:   timestamp(u.signup),
+	})
+	if err != nil {
+		return err
+	}
+	g.records = append(g.records, record{at: u.signup, line: line})
+	return nil
+}
+
+func (g *generator) segmentTrack(u *user, s step, at time.Time) ([]byte, error) {
+	return json.Marshal(segmentMessage{
+		Type:        "track",
+		MessageID:   g.uuid(),
+		UserID:      u.id,
+		AnonymousID: u.anonymousID,
+		Event:       s.name,
+		Properties:  s.props,
+		Context:     g.segmentContext(u),
+		Timestamp:   timestamp(at),
+	})
+}
+
+// amplitudeEvent encodes an event; a user's first event carries their
+// properties, as an identify does in Segment streams
+func (g *generator) amplitudeEvent(u *user, s step, at, session time.Time, first bool) ([]byte, error) {
+	e := amplitudeEvent{
+		UserID:          u.id,
+		DeviceID:        u.anonymousID,
+		EventType:       s.name,
+		Time:            at.UnixMilli(),
+		SessionID:       session.UnixMilli(),
+		InsertID:        g.uuid(),
+		Platform:        amplitudePlatforms[u.platform],
+		OSName:          u.os,
+		EventProperties: s.props,
+	}
+	if first {
+		e.UserProperties = g.traits(u)
+	}
+	return json.Marshal(e)
+}
+
+func (g *generator) traits(u *user) map[string]any {
+	return map[string]any{"platform": u.platform, "created_at": timestamp(u.signup)}
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
@@ -0,0 +1,295 @@
+package eventstream
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/google/uuid"
+)
+
+// Sessions start between these minutes of the day, UTC
+const (
+	firstSessionMinute = 7 * 60
+	lastSessionMinute  = 23 * 60
+)
+
+// engagement scales a user's chance of coming back on any day; its mean is
+// one, so retention across users follows the curve while some users are
+// loyal and others drift away
+var engagement = []float64{0.5, 1, 1.5}
+
+// record is one encoded line of a stream and when it happened
+type record struct {
+	at   time.Time
+	line []byte
+}
+
+type user struct {
+	id          string
+	anonymousID string
+	platform    string
+	os          string
+	signup      time.Time
+}
+
+type generator struct {
+	o         Options
+	rng       *rand.Rand
+	start     time.Time
+	platforms []string
+	records   []record
+	report    *models.EventStreamReport
+	retained  map[int]int64
+	eligible  map[int]int64
+	reached   [][]int64
+}
+
+// Generate produces a stream from validated options as JSON Lines in time
+// order, with a report of its users, sessions, retention and funnels
+func Generate(o Options, seed int64) ([]byte, *models.EventStreamReport, error) {
+	if o.Seed != nil {
+		seed = *o.Seed
+	}
+	start, err := time.Parse(dateLayout, o.StartDate)
+	if err != nil {
+		return nil, nil, err
+	}
+	g := &generator{
+		o:        o,
+		rng:      rand.New(rand.NewSource(seed)),
+		start:    start,
+		report:   &models.EventStreamReport{Format: o.Format, Users: int64(o.Users)},
+		retained: map[int]int64{},
+		eligible: map[int]int64{},
+		reached:  make([][]int64, len(o.Funnels)),
+	}
+	for platform := range o.Platforms {
+		g.platforms = append(g.platforms, platform)
+	}
+	sort.Strings(g.platforms)
+	for i, f := range o.Funnels {
+		g.reached[i] = make([]int64, len(f.Steps)+1)
+	}
+	for i := 0; i < o.Users; i++ {
+		if err := g.user(); err != nil {
+			return nil, nil, err
+		}
+	}
+	sort.SliceStable(g.records, func(i, j int) bool { return g.records[i].at.Before(g.records[j].at) })
+	var buf bytes.Buffer
+	for _, r := range g.records {
+		buf.Write(r.line)
+		buf.WriteByte('\n')
+	}
+	g.report.Events = int64(len(g.records))
+	g.summarize()
+	return buf.Bytes(), g.report, nil
+}
+
+// user generates every session of one user, from the day they sign up
+func (g *generator) user() error {
+	u := &user{id: g.uuid(), anonymousID: g.uuid(), platform: g.pickPlatform()}
+	u.os = g.pickOS(u.platform)
+	first := g.rng.Intn(g.o.Days)
+	scale := engagement[g.rng.Intn(len(engagement))]
+	active := []int{first}
+	for d := 1; first+d < g.o.Days; d++ {
+		back := g.rng.Float64() < math.Min(1, retention(g.o.Retention, d)*scale)
+		if back {
+			active = append(active, first+d)
+		}
+		if _, ok := g.o.Retention[d]; ok {
+			g.eligible[d]++
+			if back {
+				g.retained[d]++
+			}
+		}
+	}
+	signedUp := false
+	for _, day := range active {
+		n := 1 + g.poisson(g.o.SessionsPerDay-1)
+		starts := make([]int, n)
+		for i := range starts {
+			starts[i] = firstSessionMinute + g.rng.Intn(lastSessionMinute-firstSessionMinute)
+		}
+		sort.Ints(starts)
+		for _, minute := range starts {
+			at := g.start.AddDate(0, 0, day).Add(time.Duration(minute)*time.Minute + time.Duration(g.rng.Intn(60))*time.Second)
+			if err := g.session(u, at, !signedUp); err != nil {
+				return err
+			}
+			signedUp = true
+		}
+	}
+	return nil
+}
+
+// step is an event of a session before it is timed
+type step struct {
+	name  string
+	props map[string]any
+}
+
+// session generates the events of one session starting at start. A user's
+// first session enters every funnel, later ones only recurring funnels.
+func (g *generator) session(u *user, start time.Time, first bool) error {
+	g.report.Sessions++
+	var steps []step
+	for i := 1 + g.poisson(g.o.EventsPerSession-1); i > 0; i-- {
+		steps = append(steps, g.pickEvent())
+	}
+	for i, f := range g.o.Funnels {
+		if !first && !f.Recurring {
+			continue
+		}
+		g.reached[i][0]++
+		var walked []step
+		for j, s := range f.Steps {
+			if g.rng.Float64() >= s.Conversion {
+				break
+			}
+			g.reached[i][j+1]++
+			walked = append(walked, step{name: s.Event, props: map[string]any{"funnel": f.Name, "funnel_step": j + 1}})
+		}
+		// Funnels entered at signup open the session; others happen at
+		// any point of it
+		at := 0
+		if f.Recurring {
+			at = g.rng.Intn(len(steps) + 1)
+		}
+		steps = append(steps[:at], append(walked, steps[at:]...)...)
+	}
+
+	gap := g.o.SessionMinutes / float64(len(steps))
+	at := start
+	if first {
+		u.signup = start
+		if g.o.Format == FormatSegment {
+			if err := g.identify(u); err != nil {
+				return err
+			}
+		}
+	}
+	for i, s := range steps {
+		if i > 0 {
+			at = at.Add(time.Duration(g.rng.ExpFloat64() * gap * float64(time.Minute)))
+		}
+		var line []byte
+		var err error
+		if g.o.Format == FormatSegment {
+			line, err = g.segmentTrack(u, s, at)
+		} else {
+			line, err = g.amplitudeEvent(u, s, at, start, first && i == 0)
+		}
+		if err != nil {
+			return err
+		}
+		g.records = append(g.records, record{at: at, line: line})
+	}
+	return nil
+}
+
+// summarize measures retention and funnel conversion against the options
+func (g *generator) summarize() {
+	for _, day := range sortedDays(g.o.Retention) {
+		r := models.RetentionReport{Day: day, Target: g.o.Retention[day], Users: g.eligible[day]}
+		if r.Users > 0 {
+			r.Observed = round(float64(g.retained[day]) / float64(r.Users))
+		}
+		g.report.Retention = append(g.report.Retention, r)
+	}
+	for i, f := range g.o.Funnels {
+		fr := models.FunnelReport{Name: f.Name}
+		for j, s := range f.Steps {
+			sr := models.FunnelStepReport{Event: s.Event, Reached: g.reached[i][j+1], Target: s.Conversion}
+			if prev := g.reached[i][j]; prev > 0 {
+				sr.Conversion = round(float64(sr.Reached) / float64(prev))
+			}
+			fr.Steps = append(fr.Steps, sr)
+		}
+		g.report.Funnels = append(g.report.Funnels, fr)
+	}
+}
+
+func (g *generator) pickEvent() step {
+	total := 0.0
+	for _, e := range g.o.Events {
+		total += e.Weight
+	}
+	x := g.rng.Float64() * total
+	e := g.o.Events[len(g.o.Events)-1]
+	for _, candidate := range g.o.Events {
+		if x -= candidate.Weight; x < 0 {
+			e = candidate
+			break
+		}
+	}
+	props := make(map[string]any, len(e.Properties))
+	names := make([]string, 0, len(e.Properties))
+	for name := range e.Properties {
+		names = append(names, name)
+	}
+	// Properties are drawn in a fixed order so a seed always gives the
+	// same stream
+	sort.Strings(names)
+	for _, name := range names {
+		choices := e.Properties[name]
+		props[name] = choices[g.rng.Intn(len(choices))]
+	}
+	return step{name: e.Name, props: props}
+}
+
+func (g *generator) pickPlatform() string {
+	total := 0.0
+	for _, p := range g.platforms {
+		total += g.o.Platforms[p]
+	}
+	x := g.rng.Float64() * total
+	for _, p := range g.platforms {
+		if x -= g.o.Platforms[p]; x < 0 {
+			return p
+		}
+	}
+	return g.platforms[len(g.platforms)-1]
+}
+
+func (g *generator) pickOS(platform string) string {
+	switch platform {
+	case "ios":
+		return "iOS"
+	case "android":
+		return "Android"
+	}
+	return []string{"Windows", "Mac OS X", "Linux"}[g.rng.Intn(3)]
+}
+
+// poisson draws from a Poisson distribution of mean lambda
+func (g *generator) poisson(lambda float64) int {
+	if lambda <= 0 {
+		return 0
+	}
+	limit, n, p := math.Exp(-lambda), 0, g.rng.Float64()
+	for p > limit {
+		n++
+		p *= g.rng.Float64()
+	}
+	return n
+}
+
+// uuid draws a random UUID from the generator's source, so IDs repeat
+// with the seed
+func (g *generator) uuid() string {
+	id, err := uuid.NewRandomFromReader(g.rng)
+	if err != nil {
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
@@ -0,0 +1,388 @@
+// Package evidence assembles audit evidence packages: the access logs, admin
+// actions, retention receipts, security events, SLA reports and
+// configuration of a period, written to a zip archive with a manifest of
+// every file's SHA-256 digest. The manifest is signed with an Ed25519 key
+// whose public half ships in the archive, so auditors can check that nothing
+// was changed after it was produced.
+package evidence
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
+)
+
+// Names of the files in an evidence package
+const (
+	ManifestFile      = "manifest.json"
+	SignatureFile     = "manifest.sig"
+	PublicKeyFile     = "public_key.pem"
+	AccessLogsFile    = "access_logs.jsonl"
+	AdminActionsFile  = "admin_actions.jsonl"
+	RetentionFile     = "retention_receipts.jsonl"
+	SecurityFile      = "security_events.jsonl"
+	SLAReportsFile    = "sla_reports.json"
+	ConfigurationFile = "configuration.json"
+)
+
+// MaxPeriod is the longest period one package covers
+const MaxPeriod = 366 * 24 * time.Hour
+
+// auditPageSize is how many audit records are read at a time
+const auditPageSize = 1000
+
+var (
+	// ErrInvalidPeriod is returned for an empty, reversed or too long period
+	ErrInvalidPeriod = errors.New("invalid evidence period")
+	// ErrBadSignature is returned when a package's manifest signature or a
+	// file digest does not match
+	ErrBadSignature = errors.New("evidence package does not match its signed manifest")
+)
+
+// AdminActions are the audit actions filed as admin actions rather than
+// access logs
+var AdminActions = []string{"admin_action", "role_updated", "role_deleted", "user_roles_updated", "evidence_exported"}
+
+// AuditLogs pages through audit records
+type AuditLogs interface {
+	ListBetween(ctx context.Context, start, end time.Time, afterID int64, limit int) ([]models.AuditLog, error)
+}
+
+// RetentionReceipts lists retention task runs
+type RetentionReceipts interface {
+	ListBetween(ctx context.Context, start, end time.Time) ([]models.RetentionReceipt, error)
+}
+
+// SLAReports lists monthly SLA reports
+type SLAReports interface {
+	ListReportsByMonth(ctx context.Context, month time.Time) ([]models.SLAReport, error)
+}
+
+// SecurityEvents lists the security events still held in memory
+type SecurityEvents interface {
+	GetSecurityEvents(filters security.SecurityEventFilters) []security.SecurityEvent
+}
+
+// Sources are where a package's evidence comes from. A nil source leaves
+// its file empty.
+type Sources struct {
+	AuditLogs         AuditLogs
+	RetentionReceipts RetentionReceipts
+	SLAReports        SLAReports
+	SecurityEvents    SecurityEvents
+	// Configuration returns the current settings with secrets redacted
+	Configuration func() map[string]any
+}
+
+// Request describes the package to build
+type Request struct {
+	Start       time.Time
+	End         time.Time
+	GeneratedBy int64
+}
+
+// Manifest lists a package's files and what it covers
+type Manifest struct {
+	Version        int         `json:"version"`
+	PeriodStart    time.Time   `json:"period_start"`
+	PeriodEnd      time.Time   `json:"period_end"`
+	GeneratedAt    time.Time   `json:"generated_at"`
+	GeneratedBy    int64       `json:"generated_by"`
+	Algorithm      string      `json:"signature_algorithm"`
+	KeyFingerprint string      `json:"key_fingerprint"`
+	Files          []FileEntry `json:"files"`
+	// Notes explain gaps, such as security events held only in memory
+	Notes []string `json:"notes,omitempty"`
+}
+
+// FileEntry is one file of a package
+type FileEntry struct {
+	Name    string `json:"name"`
+	SHA256  string `json:"sha256"`
+	Bytes   int64  `json:"bytes"`
+	Records int    `json:"records"`
+}
+
+// Builder writes evidence packages signed with its key
+type Builder struct {
+	sources Sources
+	key     ed25519.PrivateKey
+	now     func() time.Time
+}
+
+// NewBuilder creates a builder signing with key
+func NewBuilder(sources Sources, key ed25519.PrivateKey) *Builder {
+	return &Builder{sources: sources, key: key, now: time.Now}
+}
+
+// ParseSigningKey reads a PEM encoded PKCS#8 Ed25519 private key
+func ParseSigningKey(material []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(material)
+	if block == nil {
+		return nil, errors.New("evidence signing key is not PEM encoded")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("evidence signing key: %w", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("evidence signing key must be Ed25519, got %T", parsed)
+	}
+	return key, nil
+}
+
+// Fingerprint identifies a public key by the SHA-256 of its PKIX encoding
+func Fingerprint(pub ed25519.PublicKey) string {
+	der, _ := x509.MarshalPKIXPublicKey(pub)
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidatePeriod checks that [start, end) is a non-empty period of at most
+// MaxPeriod
+func ValidatePeriod(start, end time.Time) error {
+	if !start.Before(end) || end.Sub(start) > MaxPeriod {
+		return ErrInvalidPeriod
+	}
+	return nil
+}
+
+// Build writes the package for req to w and returns its manifest
+func (b *Builder) Build(ctx context.Context, w io.Writer, req Request) (*Manifest, error) {
+	if err := ValidatePeriod(req.Start, req.End); err != nil {
+		return nil, err
+	}
+	pub := b.key.Public().(ed25519.PublicKey)
+	m := &Manifest{
+		Version:        1,
+		PeriodStart:    req.Start.UTC(),
+		PeriodEnd:      req.End.UTC(),
+		GeneratedAt:    b.now().UTC(),
+		GeneratedBy:    req.GeneratedBy,
+		Algorithm:      "Ed25519",
+		KeyFingerprint: Fingerprint(pub),
+	}
+	zw := zip.NewWriter(w)
+	add := func(name string, content []byte, records int) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: m.GeneratedAt})
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(content); err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		m.Files = append(m.Files, FileEntry{Name: name, SHA256: hex.EncodeToString(sum[:]), Bytes: int64(len(content)), Records: records})
+		return nil
+	}
+
+	access, admin, err := b.auditLogs(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("audit logs: %w", err)
+	}
+	if err := add(AccessLogsFile, access.Bytes(), access.n); err != nil {
+		return nil, err
+	}
+	if err := add(AdminActionsFile, admin.Bytes(), admin.n); err != nil {
+		return nil, err
+	}
+
+	var receipts jsonLines
+	if b.sources.RetentionReceipts != nil {
+		list, err := b.sources.RetentionReceipts.ListBetween(ctx, req.Start, req.End)
+		if err != nil {
+			return nil, fmt.Errorf("retention receipts: %w", err)
+		}
+		for _, r := range list {
+			receipts.add(r)
+		}
+	}
+	if err := add(RetentionFile, receipts.Bytes(), receipts.n); err != nil {
+		return nil, err
+	}
+
+	var events jsonLines
+	if b.sources.SecurityEvents != nil {
+		start, end := req.Start, req.End
+		for _, e := range b.sources.SecurityEvents.GetSecurityEvents(security.SecurityEventFilters{StartTime: &start, EndTime: &end}) {
+			events.add(e)
+		}
+		m.Notes = append(m.Notes, "security events are those still held by the running instance; high and critical events are also exported to Security Command Center when it is enabled")
+	}
+	if err := add(SecurityFile, events.Bytes(), events.n); err != nil {
+		return nil, err
+	}
+
+	reports := []models.SLAReport{}
+	if b.sources.SLAReports != nil {
+		for _, month := range months(req.Start, req.End) {
+			list, err := b.sources.SLAReports.ListReportsByMonth(ctx, month)
+			if err != nil {
+				return nil, fmt.Errorf("sla reports: %w", err)
+			}
+			reports = append(reports, list...)
+		}
+	}
+	if err := addJSON(add, SLAReportsFile, reports, len(reports)); err != nil {
+		return nil, err
+	}
+
+	settings := map[string]any{}
+	if b.sources.Configuration != nil {
+		settings = b.sources.Configuration()
+		m.Notes = append(m.Notes, "configuration is a snapshot taken when the package was generated, with secrets redacted")
+	}
+	if err := addJSON(add, ConfigurationFile, settings, len(settings)); err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	if err := add(PublicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 1); err != nil {
+		return nil, err
+	}
+
+	// The manifest and its signature are written last, once every digest
+	// is known; they do not list themselves
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(b.key, manifest))
+	for _, f := range []struct {
+		name    string
+		content []byte
+	}{{ManifestFile, manifest}, {SignatureFile, []byte(signature + "\n")}} {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: m.GeneratedAt})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write(f.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// auditLogs pages through the period's audit records, splitting admin
+// actions from access logs
+func (b *Builder) auditLogs(ctx context.Context, req Request) (*jsonLines, *jsonLines, error) {
+	var access, admin jsonLines
+	if b.sources.AuditLogs == nil {
+		return &access, &admin, nil
+	}
+	var after int64
+	for {
+		page, err := b.sources.AuditLogs.ListBetween(ctx, req.Start, req.End, after, auditPageSize)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, l := range page {
+			if slices.Contains(AdminActions, l.Action) {
+				admin.add(l)
+			} else {
+				access.add(l)
+			}
+			after = l.ID
+		}
+		if len(page) < auditPageSize {
+			return &access, &admin, nil
+		}
+	}
+}
+
+// Verify checks a package against its signed manifest: the signature must
+// verify with pub and every listed file must match its digest. It returns
+// the manifest.
+func Verify(r io.ReaderAt, size int64, pub ed25519.PublicKey) (*Manifest, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	files := make(map[string][]byte)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[f.Name] = content
+	}
+	manifest, ok := files[ManifestFile]
+	if !ok {
+		return nil, fmt.Errorf("%w: no manifest", ErrBadSignature)
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(files[SignatureFile])))
+	if err != nil || !ed25519.Verify(pub, manifest, signature) {
+		return nil, fmt.Errorf("%w: manifest signature", ErrBadSignature)
+	}
+	var m Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, err
+	}
+	for _, entry := range m.Files {
+		content, ok := files[entry.Name]
+		sum := sha256.Sum256(content)
+		if !ok || hex.EncodeToString(sum[:]) != entry.SHA256 {
+			return nil, fmt.Errorf("%w: %s", ErrBadSignature, entry.Name)
+		}
+	}
+	return &m, nil
+}
+
+// jsonLines buffers one JSON document per line
+type jsonLines struct {
+	bytes.Buffer
+	n int
+}
+
+func (j *jsonLines) add(v any) {
+	line, _ := json.Marshal(v)
+	j.Write(line)
+	j.WriteByte('\n')
+	j.n++
+}
+
+func addJSON(add func(string, []byte, int) error, name string, v any, records int) error {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return add(name, content, records)
+}
+
+// months returns the first of every month overlapping [start, end)
+func months(start, end time.Time) []time.Time {
+	start, end = start.UTC(), end.UTC()
+	var out []time.Time
+	for m := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC); m.Before(end); m = m.AddDate(0, 1, 0) {
+		out = append(out, m)
+	}
+	return out
+}
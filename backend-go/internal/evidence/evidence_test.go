@@ -0,0 +1,148 @@
+// Package evidence_test provides unit tests for audit evidence packages
+package evidence_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/evidence"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeAuditLogs struct{ logs []models.AuditLog }
+
+func (f *fakeAuditLogs) ListBetween(_ context.Context, start, end time.Time, afterID int64, limit int) ([]models.AuditLog, error) {
+	var out []models.AuditLog
+	for _, l := range f.logs {
+		if l.ID > afterID && !l.CreatedAt.Before(start) && l.CreatedAt.Before(end) && len(out) < limit {
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+type fakeReceipts []models.RetentionReceipt
+
+func (f fakeReceipts) ListBetween(context.Context, time.Time, time.Time) ([]models.RetentionReceipt, error) {
+	return f, nil
+}
+
+type fakeSLA struct{ months []time.Time }
+
+func (f *fakeSLA) ListReportsByMonth(_ context.Context, month time.Time) ([]models.SLAReport, error) {
+	f.months = append(f.months, month)
+	return []models.SLAReport{{UserID: 1, Month: month}}, nil
+}
+
+type fakeSecurity []security.SecurityEvent
+
+func (f fakeSecurity) GetSecurityEvents(filters security.SecurityEventFilters) []security.SecurityEvent {
+	return f
+}
+
+func TestBuildAndVerify(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	start := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	logs := &fakeAuditLogs{}
+	for i := 1; i <= 2500; i++ {
+		action := "logout"
+		if i%500 == 0 {
+			action = "admin_action"
+		}
+		logs.logs = append(logs.logs, models.AuditLog{ID: int64(i), Action: action, CreatedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+	sla := &fakeSLA{}
+	b := evidence.NewBuilder(evidence.Sources{
+		AuditLogs:         logs,
+		RetentionReceipts: fakeReceipts{{ID: 1, Task: models.RetentionDatasetArchive, Affected: 3}},
+		SLAReports:        sla,
+		SecurityEvents:    fakeSecurity{{ID: "e1", Level: security.ThreatLevelHigh}},
+		Configuration:     func() map[string]any { return map[string]any{"Environment": "production"} },
+	}, key)
+
+	var buf bytes.Buffer
+	m, err := b.Build(context.Background(), &buf, evidence.Request{Start: start, End: end, GeneratedBy: 7})
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)}, sla.months)
+
+	records := map[string]int{}
+	for _, f := range m.Files {
+		records[f.Name] = f.Records
+	}
+	assert.Equal(t, 2495, records[evidence.AccessLogsFile])
+	assert.Equal(t, 5, records[evidence.AdminActionsFile])
+	assert.Equal(t, 1, records[evidence.RetentionFile])
+	assert.Equal(t, 1, records[evidence.SecurityFile])
+	assert.Equal(t, 2, records[evidence.SLAReportsFile])
+	assert.Equal(t, evidence.Fingerprint(pub), m.KeyFingerprint)
+
+	archive := buf.Bytes()
+	verified, err := evidence.Verify(bytes.NewReader(archive), int64(len(archive)), pub)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), verified.GeneratedBy)
+
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	_, err = evidence.Verify(bytes.NewReader(archive), int64(len(archive)), otherPub)
+	assert.ErrorIs(t, err, evidence.ErrBadSignature)
+
+	tampered := rewrite(t, archive, evidence.RetentionFile, "{}\n")
+	_, err = evidence.Verify(bytes.NewReader(tampered), int64(len(tampered)), pub)
+	assert.ErrorIs(t, err, evidence.ErrBadSignature)
+	assert.Contains(t, err.Error(), evidence.RetentionFile)
+}
+
+func TestValidatePeriod(t *testing.T) {
+	now := time.Now()
+	assert.NoError(t, evidence.ValidatePeriod(now.AddDate(0, -3, 0), now))
+	assert.ErrorIs(t, evidence.ValidatePeriod(now, now), evidence.ErrInvalidPeriod)
+	assert.ErrorIs(t, evidence.ValidatePeriod(now.AddDate(-2, 0, 0), now), evidence.ErrInvalidPeriod)
+}
+
+func TestParseSigningKey(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	parsed, err := evidence.ParseSigningKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.True(t, key.Equal(parsed))
+
+	_, err = evidence.ParseSigningKey([]byte(strings.Repeat("k", 40)))
+	assert.Error(t, err)
+}
+
+// rewrite copies a zip archive with one file's content replaced
+func rewrite(t *testing.T, archive []byte, name, content string) []byte {
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	require.NoError(t, err)
+	var out bytes.Buffer
+	zw := zip.NewWriter(&out)
+	for _, f := range zr.File {
+		w, err := zw.Create(f.Name)
+		require.NoError(t, err)
+		if f.Name == name {
+			_, _ = w.Write([]byte(content))
+			continue
+		}
+		rc, err := f.Open()
+		require.NoError(t, err)
+		_, _ = io.Copy(w, rc)
+		rc.Close()
+	}
+	require.NoError(t, zw.Close())
+	return out.Bytes()
+}
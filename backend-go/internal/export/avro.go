@@ -0,0 +1,209 @@
+package export
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Rows are written in Avro object container blocks of up to avroBlockRows
+// rows or avroBlockBytes bytes before compression
+const (
+	avroBlockRows  = 10000
+	avroBlockBytes = 1 << 20
+)
+
+// avroWriter writes an Avro object container file of "Row" records with a
+// nullable field per column, each block compressed with deflate
+type avroWriter struct {
+	w      io.Writer
+	schema Schema
+	fields []string
+	sync   [16]byte
+	block  bytes.Buffer
+	rows   int
+	zbuf   bytes.Buffer
+	zw     *flate.Writer
+}
+
+func newAvroWriter(w io.Writer, schema Schema) (*avroWriter, error) {
+	aw := &avroWriter{w: w, schema: schema, fields: SafeNames(schema)}
+	if _, err := rand.Read(aw.sync[:]); err != nil {
+		return nil, err
+	}
+	rec, err := json.Marshal(aw.recordSchema())
+	if err != nil {
+		return nil, err
+	}
+	var head bytes.Buffer
+	head.WriteString("Obj\x01")
+	// File metadata, a map of bytes in a single block
+	putLong(&head, 2)
+	putString(&head, "avro.schema")
+	putBytes(&head, rec)
+	putString(&head, "avro.codec")
+	putString(&head, "deflate")
+	putLong(&head, 0)
+	head.Write(aw.sync[:])
+	if _, err := w.Write(head.Bytes()); err != nil {
+		return nil, err
+	}
+	if aw.zw, err = flate.NewWriter(&aw.zbuf, flate.DefaultCompression); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+type avroField struct {
+	Name    string `json:"name"`
+	Type    []any  `json:"type"`
+	Default any    `json:"default"`
+	// Doc is the column name when it is not a valid Avro name
+	Doc string `json:"doc,omitempty"`
+}
+
+func (w *avroWriter) recordSchema() map[string]any {
+	fields := make([]avroField, len(w.schema))
+	for i, col := range w.schema {
+		f := avroField{Name: w.fields[i], Type: []any{"null", avroType(col.Type)}}
+		if f.Name != col.Name {
+			f.Doc = col.Name
+		}
+		fields[i] = f
+	}
+	return map[string]any{"type": "record", "name": "Row", "namespace": "synthos", "fields": fields}
+}
+
+func avroType(t Type) string {
+	switch t {
+	case TypeInt:
+		return "long"
+	case TypeFloat:
+		return "double"
+	case TypeBool:
+		return "boolean"
+	}
+	return "string"
+}
+
+// SafeNames turns column names into distinct identifiers of letters,
+// digits and underscores, not starting with a digit, as Avro and data
+// warehouses require
+func SafeNames(schema Schema) []string {
+	names := make([]string, len(schema))
+	used := map[string]bool{}
+	for i, col := range schema {
+		b := []byte(col.Name)
+		for j, c := range b {
+			if !(c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+				b[j] = '_'
+			}
+		}
+		name := string(b)
+		if name == "" || (name[0] >= '0' && name[0] <= '9') {
+			name = "_" + name
+		}
+		for base, n := name, 2; used[name]; n++ {
+			name = base + "_" + strconv.Itoa(n)
+		}
+		used[name] = true
+		names[i] = name
+	}
+	return names
+}
+
+func (w *avroWriter) Write(row map[string]any) error {
+	for _, col := range w.schema {
+		v := row[col.Name]
+		if v == nil {
+			putLong(&w.block, 0)
+			continue
+		}
+		putLong(&w.block, 1)
+		switch col.Type {
+		case TypeInt:
+			n, ok := toInt(v)
+			if !ok {
+				return fmt.Errorf("%w: %s", ErrTypeMismatch, col.Name)
+			}
+			putLong(&w.block, n)
+		case TypeFloat:
+			f, ok := toFloat(v)
+			if !ok {
+				return fmt.Errorf("%w: %s", ErrTypeMismatch, col.Name)
+			}
+			var b [8]byte
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+			w.block.Write(b[:])
+		case TypeBool:
+			b, ok := v.(bool)
+			if !ok {
+				return fmt.Errorf("%w: %s", ErrTypeMismatch, col.Name)
+			}
+			if b {
+				w.block.WriteByte(1)
+			} else {
+				w.block.WriteByte(0)
+			}
+		default:
+			putString(&w.block, text(v))
+		}
+	}
+	w.rows++
+	if w.rows >= avroBlockRows || w.block.Len() >= avroBlockBytes {
+		return w.flush()
+	}
+	return nil
+}
+
+// flush writes the buffered rows as one block
+func (w *avroWriter) flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+	w.zbuf.Reset()
+	w.zw.Reset(&w.zbuf)
+	if _, err := w.zw.Write(w.block.Bytes()); err != nil {
+		return err
+	}
+	if err := w.zw.Close(); err != nil {
+		return err
+	}
+	var head bytes.Buffer
+	putLong(&head, int64(w.rows))
+	putLong(&head, int64(w.zbuf.Len()))
+	for _, part := range [][]byte{head.Bytes(), w.zbuf.Bytes(), w.sync[:]} {
+		if _, err := w.w.Write(part); err != nil {
+			return err
+		}
+	}
+	w.block.Reset()
+	w.rows = 0
+	return nil
+}
+
+func (w *avroWriter) Close() error {
+	return w.flush()
+}
+
+// putLong writes an Avro long, zig-zag varint encoded
+func putLong(b *bytes.Buffer, n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutVarint(buf[:], n)])
+}
+
+func putBytes(b *bytes.Buffer, p []byte) {
+	putLong(b, int64(len(p)))
+	b.Write(p)
+}
+
+func putString(b *bytes.Buffer, s string) {
+	putLong(b, int64(len(s)))
+	b.WriteString(s)
+}
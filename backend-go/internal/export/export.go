@@ -0,0 +1,362 @@
+// Package export converts generated row sets to the file formats customers
+// download them in: CSV, gzip-compressed CSV, JSON, JSON Lines, Parquet,
+// Avro, Excel and PostgreSQL insert scripts. Writers stream: rows are encoded as they are written and
+// only Parquet holds a row group in memory before flushing it. Every column
+// is nullable and typed from the values of the whole row set.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// Export format names, as requested in ?format= and listed in plan limits
+const (
+	CSV       = "csv"
+	CSVGzip   = "csv_gzip"
+	JSON      = "json"
+	JSONLines = "jsonl"
+	Parquet   = "parquet"
+	Avro      = "avro"
+	XLSX      = "xlsx"
+	SQL       = "sql"
+)
+
+// Formats are the formats writers exist for
+var Formats = []string{CSV, CSVGzip, JSON, JSONLines, Parquet, Avro, XLSX, SQL}
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported export format")
+	// ErrTooLarge is returned for row sets the format cannot hold, such as
+	// more rows than a worksheet has
+	ErrTooLarge = errors.New("row set too large for export format")
+	// ErrTypeMismatch is returned for a value its column's type cannot hold
+	ErrTypeMismatch = errors.New("value does not match column type")
+	// ErrNULByte is returned for text an SQL script cannot carry
+	ErrNULByte = errors.New("value contains a NUL byte")
+)
+
+// Supported reports whether format has a writer
+func Supported(format string) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// ContentType is the media type of a format
+func ContentType(format string) string {
+	switch format {
+	case CSV:
+		return "text/csv"
+	case CSVGzip:
+		return "application/gzip"
+	case JSON:
+		return "application/json"
+	case JSONLines:
+		return "application/x-ndjson"
+	case Parquet:
+		return "application/vnd.apache.parquet"
+	case Avro:
+		return "application/avro"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case SQL:
+		return "application/sql"
+	}
+	return "application/octet-stream"
+}
+
+// Extension is the file name extension of a format
+func Extension(format string) string {
+	if format == CSVGzip {
+		return "csv.gz"
+	}
+	return format
+}
+
+// Type is the type of a column's values
+type Type int
+
+const (
+	TypeString Type = iota
+	TypeInt
+	TypeFloat
+	TypeBool
+)
+
+// Column is a named, typed column; values may be null
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Schema is the columns of a row set, in file order
+type Schema []Column
+
+// InferSchema types each column of rows from all of its values: integers,
+// numbers and booleans when every non-null value is one, text otherwise.
+// Columns are ordered by name, as in CSV outputs.
+func InferSchema(rows []map[string]any) Schema {
+	names := map[string]bool{}
+	types := map[string]Type{}
+	for _, row := range rows {
+		for name, v := range row {
+			names[name] = true
+			if v == nil {
+				continue
+			}
+			t := valueType(v)
+			switch prev, ok := types[name]; {
+			case !ok:
+				types[name] = t
+			case prev == t:
+			case (prev == TypeInt && t == TypeFloat) || (prev == TypeFloat && t == TypeInt):
+				types[name] = TypeFloat
+			default:
+				types[name] = TypeString
+			}
+		}
+	}
+	// Columns that are only ever null are text
+	schema := make(Schema, 0, len(names))
+	for name := range names {
+		schema = append(schema, Column{Name: name, Type: types[name]})
+	}
+	sort.Slice(schema, func(i, j int) bool { return schema[i].Name < schema[j].Name })
+	return schema
+}
+
+func valueType(v any) Type {
+	switch x := v.(type) {
+	case bool:
+		return TypeBool
+	case int, int32, int64:
+		return TypeInt
+	case float32:
+		return floatType(float64(x))
+	case float64:
+		return floatType(x)
+	case json.Number:
+		if _, err := x.Int64(); err == nil {
+			return TypeInt
+		}
+		if _, err := x.Float64(); err == nil {
+			return TypeFloat
+		}
+	}
+	return TypeString
+}
+
+func floatType(f float64) Type {
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+		return TypeInt
+	}
+	return TypeFloat
+}
+
+func toInt(v any) (int64, bool) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	case float32:
+		return int64(x), float64(x) == math.Trunc(float64(x))
+	case float64:
+		return int64(x), x == math.Trunc(x) && math.Abs(x) < 1<<63
+	case json.Number:
+		n, err := x.Int64()
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func toFloat(v any) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int32:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Value converts v to its column's type: nil, int64, float64, bool or,
+// for text columns, a string
+func Value(col Column, v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	var out any
+	ok := true
+	switch col.Type {
+	case TypeInt:
+		out, ok = toInt(v)
+	case TypeFloat:
+		out, ok = toFloat(v)
+	case TypeBool:
+		out, ok = v.(bool)
+	default:
+		out = text(v)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTypeMismatch, col.Name)
+	}
+	return out, nil
+}
+
+// text is a value as written to text formats; objects and arrays as JSON
+func text(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case json.Number:
+		return x.String()
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32)
+	case bool:
+		return strconv.FormatBool(x)
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case int32:
+		return strconv.FormatInt(int64(x), 10)
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
+
+// Writer writes rows to a file of one format
+type Writer interface {
+	// Write appends a row; columns missing from it are null and values
+	// outside the schema are dropped
+	Write(row map[string]any) error
+	// Close finishes the file; it is incomplete until Close returns. It
+	// does not close the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a writer of format to w for rows of schema
+func NewWriter(format string, w io.Writer, schema Schema) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w, schema, nil)
+	case CSVGzip:
+		return newGzipCSVWriter(w, schema)
+	case JSON:
+		return newJSONWriter(w, schema, false), nil
+	case JSONLines:
+		return newJSONWriter(w, schema, true), nil
+	case Parquet:
+		return newParquetWriter(w, schema), nil
+	case Avro:
+		return newAvroWriter(w, schema)
+	case XLSX:
+		return newXLSXWriter(w, schema)
+	case SQL:
+		return newSQLWriter(w, schema), nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupportedFormat, format)
+}
+
+// Check reports whether rows of schema fit a file of format
+func Check(format string, schema Schema, rows int) error {
+	if !Supported(format) {
+		return fmt.Errorf("%w %q", ErrUnsupportedFormat, format)
+	}
+	if format == XLSX && (rows+1 > MaxXLSXRows || len(schema) > MaxXLSXColumns) {
+		return fmt.Errorf("%w: a worksheet holds %d rows of %d columns", ErrTooLarge, MaxXLSXRows-1, MaxXLSXColumns)
+	}
+	return nil
+}
+
+// Encode writes rows to w as format, typed by InferSchema
+func Encode(format string, w io.Writer, rows []map[string]any) error {
+	schema := InferSchema(rows)
+	if err := Check(format, schema, len(rows)); err != nil {
+		return err
+	}
+	ew, err := NewWriter(format, w, schema)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		if err := ew.Write(row); err != nil {
+			return err
+		}
+	}
+	return ew.Close()
+}
+
+// ReadRows reads the rows of a generated output in format, a JSON array of
+// objects or a CSV file with a header. JSON numbers keep their precision;
+// CSV values are text and empty fields null.
+func ReadRows(r io.Reader, format string) ([]map[string]any, error) {
+	switch format {
+	case JSON:
+		dec := json.NewDecoder(r)
+		dec.UseNumber()
+		var rows []map[string]any
+		if err := dec.Decode(&rows); err != nil {
+			return nil, fmt.Errorf("failed to read JSON rows: %w", err)
+		}
+		return rows, nil
+	case CSV:
+		cr := csv.NewReader(r)
+		header, err := cr.Read()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		var rows []map[string]any
+		for {
+			rec, err := cr.Read()
+			if err == io.EOF {
+				return rows, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CSV rows: %w", err)
+			}
+			row := make(map[string]any, len(header))
+			for i, name := range header {
+				if i < len(rec) && rec[i] != "" {
+					row[name] = rec[i]
+				} else {
+					row[name] = nil
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupportedFormat, format)
+}
@@ -0,0 +1,363 @@
+// Package export_test provides unit tests for generated data exports
+package export_test
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sampleRows(t *testing.T) []map[string]any {
+	rows, err := export.ReadRows(strings.NewReader(`[
+		{"id": 1, "name": "Ada", "score": 9.5, "active": true, "tags": ["a"]},
+		{"id": 2, "name": null, "score": 7, "active": false, "tags": null},
+		{"id": 3, "name": "Grace <admin>", "score": null, "active": null}
+	]`), export.JSON)
+	require.NoError(t, err)
+	return rows
+}
+
+func TestInferSchema(t *testing.T) {
+	schema := export.InferSchema(sampleRows(t))
+	assert.Equal(t, export.Schema{
+		{Name: "active", Type: export.TypeBool},
+		{Name: "id", Type: export.TypeInt},
+		{Name: "name", Type: export.TypeString},
+		{Name: "score", Type: export.TypeFloat},
+		{Name: "tags", Type: export.TypeString},
+	}, schema)
+
+	mixed := export.InferSchema([]map[string]any{{"v": 1.0}, {"v": "x"}, {"n": nil}})
+	assert.Equal(t, export.Schema{{Name: "n", Type: export.TypeString}, {Name: "v", Type: export.TypeString}}, mixed)
+}
+
+func TestReadRowsCSV(t *testing.T) {
+	rows, err := export.ReadRows(strings.NewReader("a,b\n1,\n"), export.CSV)
+	require.NoError(t, err)
+	assert.Equal(t, []map[string]any{{"a": "1", "b": nil}}, rows)
+
+	_, err = export.ReadRows(strings.NewReader(""), "fhir")
+	assert.ErrorIs(t, err, export.ErrUnsupportedFormat)
+}
+
+func TestEncodeCSVGzip(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, export.Encode(export.CSVGzip, &buf, sampleRows(t)))
+
+	zr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	records, err := csv.NewReader(zr).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"active", "id", "name", "score", "tags"},
+		{"true", "1", "Ada", "9.5", `["a"]`},
+		{"false", "2", "", "7", ""},
+		{"", "3", "Grace <admin>", "", ""},
+	}, records)
+}
+
+func TestEncodeJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, export.Encode(export.JSONLines, &buf, sampleRows(t)))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.JSONEq(t, `{"active":true,"id":1,"name":"Ada","score":9.5,"tags":["a"]}`, lines[0])
+	assert.JSONEq(t, `{"active":null,"id":3,"name":"Grace <admin>","score":null,"tags":null}`, lines[2])
+
+	buf.Reset()
+	require.NoError(t, export.Encode(export.JSON, &buf, nil))
+	assert.Equal(t, "[]", buf.String())
+}
+
+func TestEncodeSQL(t *testing.T) {
+	rows := append(sampleRows(t), map[string]any{"id": json.Number("4"), "name": "O'Brien"})
+	var buf bytes.Buffer
+	require.NoError(t, export.Encode(export.SQL, &buf, rows))
+	assert.Equal(t, `SET standard_conforming_strings = on;
+CREATE TABLE "generated_rows" (
+  "active" BOOLEAN,
+  "id" BIGINT,
+  "name" TEXT,
+  "score" DOUBLE PRECISION,
+  "tags" TEXT
+);
+INSERT INTO "generated_rows" ("active", "id", "name", "score", "tags") VALUES
+  (TRUE, 1, 'Ada', 9.5, '["a"]'),
+  (FALSE, 2, NULL, 7, NULL),
+  (NULL, 3, 'Grace <admin>', NULL, NULL),
+  (NULL, 4, 'O''Brien', NULL, NULL);
+`, buf.String())
+	assert.Equal(t, "application/sql", export.ContentType(export.SQL))
+}
+
+func TestEncodeSQLBackslashes(t *testing.T) {
+	rows := []map[string]any{
+		{"id": json.Number("1"), "name": `ends in \`},
+		{"id": json.Number("2"), "name": `\'); DROP TABLE users; --`},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, export.Encode(export.SQL, &buf, rows))
+	script := buf.String()
+	assert.True(t, strings.HasPrefix(script, "SET standard_conforming_strings = on;\n"), "backslashes are ordinary characters in the script")
+	assert.Contains(t, script, `(1, 'ends in \')`)
+	assert.Contains(t, script, `(2, '\''); DROP TABLE users; --')`, "the quote after a backslash is still doubled")
+
+	buf.Reset()
+	err := export.Encode(export.SQL, &buf, []map[string]any{{"id": json.Number("1"), "name": "a\x00b"}})
+	assert.ErrorIs(t, err, export.ErrNULByte)
+}
+
+type sheet struct {
+	Rows []struct {
+		R     string `xml:"r,attr"`
+		Cells []struct {
+			R      string `xml:"r,attr"`
+			T      string `xml:"t,attr"`
+			V      string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestEncodeXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, export.Encode(export.XLSX, &buf, sampleRows(t)))
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	parts := map[string]*zip.File{}
+	for _, f := range zr.File {
+		parts[f.Name] = f
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels"} {
+		assert.Contains(t, parts, name)
+	}
+	f, err := parts["xl/worksheets/sheet1.xml"].Open()
+	require.NoError(t, err)
+	var ws sheet
+	require.NoError(t, xml.NewDecoder(f).Decode(&ws))
+
+	require.Len(t, ws.Rows, 4)
+	assert.Equal(t, "active", ws.Rows[0].Cells[0].Inline)
+	first := ws.Rows[1].Cells
+	require.Len(t, first, 5)
+	assert.Equal(t, "A2", first[0].R)
+	assert.Equal(t, "b", first[0].T)
+	assert.Equal(t, "1", first[0].V)
+	assert.Equal(t, "1", first[1].V)
+	assert.Equal(t, "Ada", first[2].Inline)
+	assert.Equal(t, "9.5", first[3].V)
+	last := ws.Rows[3].Cells
+	require.Len(t, last, 2, "null cells are left out")
+	assert.Equal(t, "C4", last[1].R)
+	assert.Equal(t, "Grace <admin>", last[1].Inline)
+}
+
+func TestCheckXLSXLimits(t *testing.T) {
+	schema := export.Schema{{Name: "a"}}
+	assert.NoError(t, export.Check(export.XLSX, schema, export.MaxXLSXRows-1))
+	assert.ErrorIs(t, export.Check(export.XLSX, schema, export.MaxXLSXRows), export.ErrTooLarge)
+	assert.NoError(t, export.Check(export.Parquet, schema, export.MaxXLSXRows))
+	assert.ErrorIs(t, export.Check("hdf5", schema, 1), export.ErrUnsupportedFormat)
+}
+
+func TestEncodeAvro(t *testing.T) {
+	var buf bytes.Buffer
+	rows := sampleRows(t)
+	rows[0]["first name"] = "x"
+	require.NoError(t, export.Encode(export.Avro, &buf, rows))
+
+	r := bufio.NewReader(&buf)
+	magic := make([]byte, 4)
+	_, err := io.ReadFull(r, magic)
+	require.NoError(t, err)
+	assert.Equal(t, "Obj\x01", string(magic))
+
+	meta := map[string]string{}
+	n, err := binary.ReadVarint(r)
+	require.NoError(t, err)
+	for ; n > 0; n-- {
+		meta[avroString(t, r)] = avroString(t, r)
+	}
+	end, _ := binary.ReadVarint(r)
+	require.Zero(t, end)
+	assert.Equal(t, "deflate", meta["avro.codec"])
+
+	var schema struct {
+		Name   string `json:"name"`
+		Fields []struct {
+			Name string `json:"name"`
+			Type []any  `json:"type"`
+			Doc  string `json:"doc"`
+		} `json:"fields"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(meta["avro.schema"]), &schema))
+	require.Len(t, schema.Fields, 6)
+	assert.Equal(t, "first_name", schema.Fields[1].Name)
+	assert.Equal(t, "first name", schema.Fields[1].Doc)
+	assert.Equal(t, []any{"null", "long"}, schema.Fields[2].Type)
+
+	sync := make([]byte, 16)
+	_, err = io.ReadFull(r, sync)
+	require.NoError(t, err)
+	count, _ := binary.ReadVarint(r)
+	size, _ := binary.ReadVarint(r)
+	assert.Equal(t, int64(3), count)
+	block := make([]byte, size)
+	_, err = io.ReadFull(r, block)
+	require.NoError(t, err)
+	tail := make([]byte, 16)
+	_, err = io.ReadFull(r, tail)
+	require.NoError(t, err)
+	assert.Equal(t, sync, tail)
+
+	raw, err := io.ReadAll(flate.NewReader(bytes.NewReader(block)))
+	require.NoError(t, err)
+	rec := bufio.NewReader(bytes.NewReader(raw))
+	// active: true
+	assert.Equal(t, int64(1), avroLong(t, rec))
+	b, _ := rec.ReadByte()
+	assert.Equal(t, byte(1), b)
+	// first name: "x"
+	assert.Equal(t, int64(1), avroLong(t, rec))
+	assert.Equal(t, "x", avroString(t, rec))
+	// id: 1
+	assert.Equal(t, int64(1), avroLong(t, rec))
+	assert.Equal(t, int64(1), avroLong(t, rec))
+	// name: "Ada"
+	assert.Equal(t, int64(1), avroLong(t, rec))
+	assert.Equal(t, "Ada", avroString(t, rec))
+	// score: 9.5
+	assert.Equal(t, int64(1), avroLong(t, rec))
+	var f [8]byte
+	_, err = io.ReadFull(rec, f[:])
+	require.NoError(t, err)
+	assert.Equal(t, 9.5, math.Float64frombits(binary.LittleEndian.Uint64(f[:])))
+}
+
+func avroLong(t *testing.T, r *bufio.Reader) int64 {
+	n, err := binary.ReadVarint(r)
+	require.NoError(t, err)
+	return n
+}
+
+func avroString(t *testing.T, r *bufio.Reader) string {
+	b := make([]byte, avroLong(t, r))
+	_, err := io.ReadFull(r, b)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestEncodeParquet(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, export.Encode(export.Parquet, &buf, sampleRows(t)))
+	file := buf.Bytes()
+	require.Greater(t, len(file), 12)
+	assert.Equal(t, "PAR1", string(file[:4]))
+	assert.Equal(t, "PAR1", string(file[len(file)-4:]))
+
+	footerLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	footer := readThrift(t, bufio.NewReader(bytes.NewReader(file[len(file)-8-footerLen:])))
+	assert.Equal(t, int64(3), footer[3], "num_rows")
+	schema := footer[2].([]any)
+	require.Len(t, schema, 6)
+	assert.Equal(t, "schema", schema[0].(map[int16]any)[4])
+	assert.Equal(t, int64(5), schema[0].(map[int16]any)[5])
+	id := schema[2].(map[int16]any)
+	assert.Equal(t, "id", id[4])
+	assert.Equal(t, int64(2), id[1], "INT64")
+
+	// The id column's single page: definition levels then PLAIN int64s
+	groups := footer[4].([]any)
+	require.Len(t, groups, 1)
+	chunk := groups[0].(map[int16]any)[1].([]any)[1].(map[int16]any)
+	meta := chunk[3].(map[int16]any)
+	assert.Equal(t, int64(3), meta[5], "num_values")
+	pr := bufio.NewReader(bytes.NewReader(file[meta[9].(int64):]))
+	header := readThrift(t, pr)
+	page := make([]byte, header[3].(int64))
+	_, err := io.ReadFull(pr, page)
+	require.NoError(t, err)
+	zr, err := gzip.NewReader(bytes.NewReader(page))
+	require.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	require.Len(t, data, int(header[2].(int64)))
+
+	levels := int(binary.LittleEndian.Uint32(data))
+	assert.Equal(t, []byte{3 << 1, 1}, data[4:4+levels], "one run of three present values")
+	values := data[4+levels:]
+	require.Len(t, values, 24)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, uint64(i+1), binary.LittleEndian.Uint64(values[8*i:]))
+	}
+}
+
+// readThrift decodes a Thrift compact struct into its fields by ID; lists
+// become slices and integers int64
+func readThrift(t *testing.T, r *bufio.Reader) map[int16]any {
+	out := map[int16]any{}
+	var last int16
+	for {
+		b, err := r.ReadByte()
+		require.NoError(t, err)
+		if b == 0 {
+			return out
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			n, err := binary.ReadVarint(r)
+			require.NoError(t, err)
+			id = int16(n)
+		}
+		last = id
+		out[id] = readThriftValue(t, r, b&0x0f)
+	}
+}
+
+func readThriftValue(t *testing.T, r *bufio.Reader, typ byte) any {
+	switch typ {
+	case 5, 6:
+		n, err := binary.ReadVarint(r)
+		require.NoError(t, err)
+		return n
+	case 8:
+		n, err := binary.ReadUvarint(r)
+		require.NoError(t, err)
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		require.NoError(t, err)
+		return string(b)
+	case 9:
+		h, err := r.ReadByte()
+		require.NoError(t, err)
+		n := uint64(h >> 4)
+		if n == 15 {
+			n, err = binary.ReadUvarint(r)
+			require.NoError(t, err)
+		}
+		items := make([]any, n)
+		for i := range items {
+			items[i] = readThriftValue(t, r, h&0x0f)
+		}
+		return items
+	case 12:
+		return readThrift(t, r)
+	}
+	t.Fatalf("unexpected thrift type %d", typ)
+	return nil
+}
@@ -0,0 +1,318 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Rows are buffered into Parquet row groups of up to parquetGroupRows rows
+// or parquetGroupBytes bytes of values
+const (
+	parquetGroupRows  = 64 * 1024
+	parquetGroupBytes = 64 << 20
+)
+
+const parquetMagic = "PAR1"
+
+// Parquet physical types, encodings and codecs used
+const (
+	parquetBoolean   = 0
+	parquetInt64     = 2
+	parquetDouble    = 5
+	parquetByteArray = 6
+
+	parquetOptional    = 1
+	parquetConvUTF8    = 0
+	parquetDataPage    = 0
+	parquetPlain       = 0
+	parquetRLE         = 3
+	parquetCodecGzip   = 2
+	parquetFileVersion = 1
+)
+
+// parquetColumn is the buffered values of one column of a row group
+type parquetColumn struct {
+	// defs holds a definition level per row: 0 for null, 1 for a value
+	defs []byte
+	// values holds the values present, PLAIN encoded; booleans are packed
+	// from bools when the group is written
+	values bytes.Buffer
+	bools  []bool
+}
+
+type parquetChunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+	values       int64
+}
+
+type parquetRowGroup struct {
+	chunks []parquetChunk
+	rows   int64
+	bytes  int64
+}
+
+// parquetWriter writes a Parquet file of optional flat columns with one
+// gzip-compressed data page per column chunk; the footer follows the last
+// row group when the writer is closed
+type parquetWriter struct {
+	w      io.Writer
+	schema Schema
+	cols   []parquetColumn
+	rows   int
+	size   int
+	offset int64
+	groups []parquetRowGroup
+	zw     *gzip.Writer
+}
+
+func newParquetWriter(w io.Writer, schema Schema) *parquetWriter {
+	return &parquetWriter{w: w, schema: schema, cols: make([]parquetColumn, len(schema))}
+}
+
+func parquetType(t Type) int32 {
+	switch t {
+	case TypeInt:
+		return parquetInt64
+	case TypeFloat:
+		return parquetDouble
+	case TypeBool:
+		return parquetBoolean
+	}
+	return parquetByteArray
+}
+
+func (w *parquetWriter) Write(row map[string]any) error {
+	for i, col := range w.schema {
+		c := &w.cols[i]
+		v := row[col.Name]
+		if v == nil {
+			c.defs = append(c.defs, 0)
+			continue
+		}
+		c.defs = append(c.defs, 1)
+		var b [8]byte
+		switch col.Type {
+		case TypeInt:
+			n, ok := toInt(v)
+			if !ok {
+				return fmt.Errorf("%w: %s", ErrTypeMismatch, col.Name)
+			}
+			binary.LittleEndian.PutUint64(b[:], uint64(n))
+			c.values.Write(b[:])
+		case TypeFloat:
+			f, ok := toFloat(v)
+			if !ok {
+				return fmt.Errorf("%w: %s", ErrTypeMismatch, col.Name)
+			}
+			binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+			c.values.Write(b[:])
+		case TypeBool:
+			x, ok := v.(bool)
+			if !ok {
+				return fmt.Errorf("%w: %s", ErrTypeMismatch, col.Name)
+			}
+			c.bools = append(c.bools, x)
+		default:
+			s := text(v)
+			binary.LittleEndian.PutUint32(b[:4], uint32(len(s)))
+			c.values.Write(b[:4])
+			c.values.WriteString(s)
+			w.size += len(s)
+		}
+	}
+	w.rows++
+	w.size += 8 * len(w.schema)
+	if w.rows >= parquetGroupRows || w.size >= parquetGroupBytes {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *parquetWriter) write(p []byte) error {
+	if w.offset == 0 {
+		if _, err := io.WriteString(w.w, parquetMagic); err != nil {
+			return err
+		}
+		w.offset = int64(len(parquetMagic))
+	}
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	return err
+}
+
+// flush writes the buffered rows as a row group
+func (w *parquetWriter) flush() error {
+	if w.rows == 0 {
+		return nil
+	}
+	group := parquetRowGroup{rows: int64(w.rows), chunks: make([]parquetChunk, len(w.schema))}
+	for i := range w.schema {
+		chunk, err := w.writeChunk(&w.cols[i])
+		if err != nil {
+			return err
+		}
+		group.chunks[i] = chunk
+		group.bytes += chunk.uncompressed
+		w.cols[i] = parquetColumn{}
+	}
+	w.groups = append(w.groups, group)
+	w.rows, w.size = 0, 0
+	return nil
+}
+
+// writeChunk writes a column's buffered values as a single data page
+func (w *parquetWriter) writeChunk(c *parquetColumn) (parquetChunk, error) {
+	var page bytes.Buffer
+	levels := rleLevels(c.defs)
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(levels)))
+	page.Write(n[:])
+	page.Write(levels)
+	if c.bools != nil {
+		page.Write(packBools(c.bools))
+	} else {
+		page.Write(c.values.Bytes())
+	}
+
+	var compressed bytes.Buffer
+	if w.zw == nil {
+		w.zw = gzip.NewWriter(&compressed)
+	} else {
+		w.zw.Reset(&compressed)
+	}
+	if _, err := w.zw.Write(page.Bytes()); err != nil {
+		return parquetChunk{}, err
+	}
+	if err := w.zw.Close(); err != nil {
+		return parquetChunk{}, err
+	}
+
+	t := &thriftWriter{}
+	t.begin()
+	t.i32(1, parquetDataPage)
+	t.i32(2, int32(page.Len()))
+	t.i32(3, int32(compressed.Len()))
+	t.structField(5)
+	t.i32(1, int32(len(c.defs)))
+	t.i32(2, parquetPlain)
+	t.i32(3, parquetRLE)
+	t.i32(4, parquetRLE)
+	t.end()
+	t.end()
+
+	chunk := parquetChunk{
+		offset:       w.offset,
+		uncompressed: int64(t.buf.Len() + page.Len()),
+		compressed:   int64(t.buf.Len() + compressed.Len()),
+		values:       int64(len(c.defs)),
+	}
+	if w.offset == 0 {
+		chunk.offset = int64(len(parquetMagic))
+	}
+	if err := w.write(t.buf.Bytes()); err != nil {
+		return chunk, err
+	}
+	return chunk, w.write(compressed.Bytes())
+}
+
+// rleLevels encodes definition levels of bit width 1 as runs of the
+// RLE/bit-packing hybrid encoding
+func rleLevels(defs []byte) []byte {
+	var out bytes.Buffer
+	var b [binary.MaxVarintLen64]byte
+	for i := 0; i < len(defs); {
+		j := i
+		for j < len(defs) && defs[j] == defs[i] {
+			j++
+		}
+		out.Write(b[:binary.PutUvarint(b[:], uint64(j-i)<<1)])
+		out.WriteByte(defs[i])
+		i = j
+	}
+	return out.Bytes()
+}
+
+// packBools encodes booleans PLAIN: one bit each, least significant first
+func packBools(bools []bool) []byte {
+	out := make([]byte, (len(bools)+7)/8)
+	for i, b := range bools {
+		if b {
+			out[i/8] |= 1 << (i % 8)
+		}
+	}
+	return out
+}
+
+func (w *parquetWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	var rows int64
+	for _, g := range w.groups {
+		rows += g.rows
+	}
+
+	t := &thriftWriter{}
+	t.begin()
+	t.i32(1, parquetFileVersion)
+	t.list(2, thriftStruct, len(w.schema)+1)
+	t.begin()
+	t.str(4, "schema")
+	t.i32(5, int32(len(w.schema)))
+	t.end()
+	for _, col := range w.schema {
+		t.begin()
+		t.i32(1, parquetType(col.Type))
+		t.i32(3, parquetOptional)
+		t.str(4, col.Name)
+		if col.Type == TypeString {
+			t.i32(6, parquetConvUTF8)
+		}
+		t.end()
+	}
+	t.i64(3, rows)
+	t.list(4, thriftStruct, len(w.groups))
+	for _, g := range w.groups {
+		t.begin()
+		t.list(1, thriftStruct, len(g.chunks))
+		for i, chunk := range g.chunks {
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.structField(3)
+			t.i32(1, parquetType(w.schema[i].Type))
+			t.list(2, thriftI32, 2)
+			t.listI32(parquetPlain)
+			t.listI32(parquetRLE)
+			t.list(3, thriftBinary, 1)
+			t.listStr(w.schema[i].Name)
+			t.i32(4, parquetCodecGzip)
+			t.i64(5, chunk.values)
+			t.i64(6, chunk.uncompressed)
+			t.i64(7, chunk.compressed)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, g.bytes)
+		t.i64(3, g.rows)
+		t.end()
+	}
+	t.str(6, "synthos export")
+	t.end()
+
+	footer := t.buf.Bytes()
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(footer)))
+	for _, part := range [][]byte{footer, n[:], []byte(parquetMagic)} {
+		if err := w.write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// SQLTable is the table SQL exports create and insert into
+const SQLTable = "generated_rows"
+
+// sqlBatchRows is the number of rows one INSERT statement carries
+const sqlBatchRows = 500
+
+// sqlWriter writes a script that creates a table for the schema and inserts
+// the rows into it in batches, for PostgreSQL. Literals only double their
+// quotes, so the script first turns on standard conforming strings: under
+// it a backslash is an ordinary character. Databases that treat backslashes
+// as escapes, such as MySQL by default, must not run it.
+type sqlWriter struct {
+	w      *bufio.Writer
+	schema Schema
+	insert string
+	rows   int
+}
+
+func newSQLWriter(w io.Writer, schema Schema) *sqlWriter {
+	sw := &sqlWriter{w: bufio.NewWriter(w), schema: schema}
+	cols := make([]string, len(schema))
+	defs := make([]string, len(schema))
+	for i, col := range schema {
+		cols[i] = sqlIdent(col.Name)
+		defs[i] = "  " + cols[i] + " " + sqlType(col.Type)
+	}
+	sw.w.WriteString("SET standard_conforming_strings = on;\n")
+	sw.w.WriteString("CREATE TABLE " + sqlIdent(SQLTable) + " (\n" + strings.Join(defs, ",\n") + "\n);\n")
+	sw.insert = "INSERT INTO " + sqlIdent(SQLTable) + " (" + strings.Join(cols, ", ") + ") VALUES\n"
+	return sw
+}
+
+func (w *sqlWriter) Write(row map[string]any) error {
+	if len(w.schema) == 0 {
+		return nil
+	}
+	values := make([]string, len(w.schema))
+	for i, col := range w.schema {
+		v, err := Value(col, row[col.Name])
+		if err != nil {
+			return err
+		}
+		lit, err := sqlLiteral(v)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, col.Name)
+		}
+		values[i] = lit
+	}
+	switch {
+	case w.rows%sqlBatchRows == 0:
+		if w.rows > 0 {
+			w.w.WriteString(";\n")
+		}
+		w.w.WriteString(w.insert)
+	default:
+		w.w.WriteString(",\n")
+	}
+	w.rows++
+	w.w.WriteString("  (" + strings.Join(values, ", ") + ")")
+	return nil
+}
+
+func (w *sqlWriter) Close() error {
+	if w.rows > 0 {
+		w.w.WriteString(";\n")
+	}
+	return w.w.Flush()
+}
+
+func sqlType(t Type) string {
+	switch t {
+	case TypeInt:
+		return "BIGINT"
+	case TypeFloat:
+		return "DOUBLE PRECISION"
+	case TypeBool:
+		return "BOOLEAN"
+	}
+	return "TEXT"
+}
+
+// sqlIdent quotes a column or table name; NUL bytes, which PostgreSQL
+// identifiers cannot hold, are dropped
+func sqlIdent(name string) string {
+	return `"` + strings.ReplaceAll(strings.ReplaceAll(name, "\x00", ""), `"`, `""`) + `"`
+}
+
+// sqlLiteral writes a value converted by Value as a literal. Text holding a
+// NUL byte is refused: PostgreSQL text cannot store it.
+func sqlLiteral(v any) (string, error) {
+	switch x := v.(type) {
+	case nil:
+		return "NULL", nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case float64:
+		switch {
+		case math.IsNaN(x):
+			return "'NaN'", nil
+		case math.IsInf(x, 1):
+			return "'Infinity'", nil
+		case math.IsInf(x, -1):
+			return "'-Infinity'", nil
+		}
+		return strconv.FormatFloat(x, 'g', -1, 64), nil
+	case bool:
+		if x {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	}
+	s := text(v)
+	if strings.IndexByte(s, 0) >= 0 {
+		return "", ErrNULByte
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'", nil
+}
@@ -0,0 +1,97 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+)
+
+type csvWriter struct {
+	w      *csv.Writer
+	schema Schema
+	record []string
+	// closer is closed after the last row, such as a compressing writer
+	closer io.Closer
+}
+
+func newCSVWriter(w io.Writer, schema Schema, closer io.Closer) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), schema: schema, record: make([]string, len(schema)), closer: closer}
+	for i, col := range schema {
+		cw.record[i] = col.Name
+	}
+	if err := cw.w.Write(cw.record); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func newGzipCSVWriter(w io.Writer, schema Schema) (*csvWriter, error) {
+	zw := gzip.NewWriter(w)
+	return newCSVWriter(zw, schema, zw)
+}
+
+func (w *csvWriter) Write(row map[string]any) error {
+	for i, col := range w.schema {
+		w.record[i] = text(row[col.Name])
+	}
+	return w.w.Write(w.record)
+}
+
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		return err
+	}
+	if w.closer != nil {
+		return w.closer.Close()
+	}
+	return nil
+}
+
+// jsonWriter writes a JSON array of objects, or one object per line
+type jsonWriter struct {
+	w      *bufio.Writer
+	schema Schema
+	lines  bool
+	rows   int
+}
+
+func newJSONWriter(w io.Writer, schema Schema, lines bool) *jsonWriter {
+	return &jsonWriter{w: bufio.NewWriter(w), schema: schema, lines: lines}
+}
+
+func (w *jsonWriter) Write(row map[string]any) error {
+	out := make(map[string]any, len(w.schema))
+	for _, col := range w.schema {
+		out[col.Name] = row[col.Name]
+	}
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	switch {
+	case w.lines:
+	case w.rows == 0:
+		w.w.WriteByte('[')
+	default:
+		w.w.WriteByte(',')
+	}
+	w.rows++
+	w.w.Write(raw)
+	if w.lines {
+		w.w.WriteByte('\n')
+	}
+	return nil
+}
+
+func (w *jsonWriter) Close() error {
+	if !w.lines {
+		if w.rows == 0 {
+			w.w.WriteByte('[')
+		}
+		w.w.WriteByte(']')
+	}
+	return w.w.Flush()
+}
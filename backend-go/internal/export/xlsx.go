@@ -0,0 +1,156 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"math"
+	"strconv"
+)
+
+// Worksheet limits of Excel
+const (
+	MaxXLSXRows    = 1048576
+	MaxXLSXColumns = 16384
+)
+
+// The package parts of a workbook with one worksheet, "data"
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="data" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// xlsxWriter writes a workbook whose worksheet is streamed into the zip as
+// rows arrive; the other parts are written up front. Text is stored inline
+// rather than in a shared string table, which would have to be held in
+// memory until the end.
+type xlsxWriter struct {
+	zw     *zip.Writer
+	sheet  *bufio.Writer
+	schema Schema
+	refs   []string
+	row    int
+	err    error
+}
+
+func newXLSXWriter(w io.Writer, schema Schema) (*xlsxWriter, error) {
+	if len(schema) > MaxXLSXColumns {
+		return nil, ErrTooLarge
+	}
+	zw := zip.NewWriter(w)
+	for _, part := range []struct{ name, body string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	} {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	xw := &xlsxWriter{zw: zw, sheet: bufio.NewWriter(f), schema: schema, refs: make([]string, len(schema))}
+	for i := range schema {
+		xw.refs[i] = columnRef(i)
+	}
+	xw.sheet.WriteString(xlsxSheetStart)
+
+	header := make(map[string]any, len(schema))
+	names := make(Schema, len(schema))
+	for i, col := range schema {
+		header[col.Name] = col.Name
+		names[i] = Column{Name: col.Name, Type: TypeString}
+	}
+	xw.writeRow(names, header)
+	return xw, xw.err
+}
+
+// columnRef is the letters of a zero-based column: A, ..., Z, AA, ...
+func columnRef(i int) string {
+	var b []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		b = append([]byte{byte('A' + (i-1)%26)}, b...)
+	}
+	return string(b)
+}
+
+func (w *xlsxWriter) Write(row map[string]any) error {
+	if w.row >= MaxXLSXRows {
+		return ErrTooLarge
+	}
+	w.writeRow(w.schema, row)
+	return w.err
+}
+
+func (w *xlsxWriter) writeRow(schema Schema, row map[string]any) {
+	w.row++
+	r := strconv.Itoa(w.row)
+	w.sheet.WriteString(`<row r="` + r + `">`)
+	for i, col := range schema {
+		v := row[col.Name]
+		if v == nil {
+			continue
+		}
+		ref := w.refs[i] + r
+		switch col.Type {
+		case TypeInt, TypeFloat:
+			if f, ok := toFloat(v); ok && !math.IsNaN(f) && !math.IsInf(f, 0) {
+				w.sheet.WriteString(`<c r="` + ref + `"><v>` + text(v) + `</v></c>`)
+				continue
+			}
+		case TypeBool:
+			if b, ok := v.(bool); ok {
+				val := "0"
+				if b {
+					val = "1"
+				}
+				w.sheet.WriteString(`<c r="` + ref + `" t="b"><v>` + val + `</v></c>`)
+				continue
+			}
+		}
+		w.sheet.WriteString(`<c r="` + ref + `" t="inlineStr"><is><t xml:space="preserve">`)
+		if err := xml.EscapeText(w.sheet, []byte(text(v))); err != nil && w.err == nil {
+			w.err = err
+		}
+		w.sheet.WriteString(`</t></is></c>`)
+	}
+	w.sheet.WriteString(`</row>`)
+}
+
+func (w *xlsxWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.sheet.WriteString(xlsxSheetEnd)
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
@@ -0,0 +1,635 @@
+// Package fhir exports generated rows as HL7 FHIR R4 resources for
+// healthcare systems. A mapping from columns to resource elements makes
+// each row one Patient, with an Encounter and Observations when columns are
+// mapped to them. Resources are checked against the base R4 profiles while
+// rows are generated, so the bundle written only holds valid resources.
+package fhir
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/google/uuid"
+)
+
+// Format is the export format name of FHIR output
+const Format = "fhir"
+
+// Resources columns can be mapped to
+const (
+	ResourcePatient     = "Patient"
+	ResourceEncounter   = "Encounter"
+	ResourceObservation = "Observation"
+)
+
+const (
+	// MaxFields caps the fields of a mapping
+	MaxFields = 200
+	// SystemLOINC is the code system of observations unless a field says
+	// otherwise
+	SystemLOINC = "http://loinc.org"
+
+	systemUCUM    = "http://unitsofmeasure.org"
+	systemActCode = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+)
+
+var (
+	ErrNoFields         = errors.New("mapping has no fields")
+	ErrTooManyFields    = errors.New("mapping has too many fields")
+	ErrInvalidField     = errors.New("invalid field")
+	ErrDuplicateField   = errors.New("element has more than one field")
+	ErrMissingElement   = errors.New("required element not mapped")
+	ErrUnknownResource  = errors.New("unknown resource")
+	ErrUnknownElement   = errors.New("unknown element")
+	ErrUnknownColumn    = errors.New("column not found")
+	ErrInvalidResource  = errors.New("resource breaks its profile")
+	errObservationValue = errors.New("observation values need the code of the observation")
+)
+
+// kind is the FHIR data type of an element
+type kind int
+
+const (
+	kindString kind = iota
+	kindCode
+	kindBoolean
+	kindDate
+	kindDateTime
+	// kindValue is the value[x] of an observation, typed by each value
+	kindValue
+)
+
+// element is an element columns can be mapped to; codes are the required
+// value set of a code
+type element struct {
+	kind  kind
+	codes []string
+}
+
+var (
+	genders             = []string{"male", "female", "other", "unknown"}
+	encounterStatuses   = []string{"planned", "arrived", "triaged", "in-progress", "onleave", "finished", "cancelled", "entered-in-error", "unknown"}
+	encounterClasses    = []string{"AMB", "EMER", "FLD", "HH", "IMP", "ACUTE", "NONAC", "OBSENC", "PRENC", "SS", "VR"}
+	observationStatuses = []string{"registered", "preliminary", "final", "amended", "corrected", "cancelled", "entered-in-error", "unknown"}
+
+	// genderAliases are the abbreviations datasets commonly record
+	genderAliases = map[string]string{"m": "male", "f": "female", "o": "other", "u": "unknown"}
+)
+
+// elements are the elements of each resource columns can be mapped to
+var elements = map[string]map[string]element{
+	ResourcePatient: {
+		"identifier":         {kind: kindString},
+		"name.family":        {kind: kindString},
+		"name.given":         {kind: kindString},
+		"gender":             {kind: kindCode, codes: genders},
+		"birthDate":          {kind: kindDate},
+		"deceasedBoolean":    {kind: kindBoolean},
+		"telecom.phone":      {kind: kindString},
+		"telecom.email":      {kind: kindString},
+		"address.line":       {kind: kindString},
+		"address.city":       {kind: kindString},
+		"address.state":      {kind: kindString},
+		"address.postalCode": {kind: kindString},
+		"address.country":    {kind: kindString},
+	},
+	ResourceEncounter: {
+		"identifier":   {kind: kindString},
+		"status":       {kind: kindCode, codes: encounterStatuses},
+		"class":        {kind: kindCode, codes: encounterClasses},
+		"type":         {kind: kindString},
+		"reasonCode":   {kind: kindString},
+		"period.start": {kind: kindDateTime},
+		"period.end":   {kind: kindDateTime},
+	},
+	ResourceObservation: {
+		"status":            {kind: kindCode, codes: observationStatuses},
+		"effectiveDateTime": {kind: kindDateTime},
+		"value":             {kind: kindValue},
+	},
+}
+
+// Normalize trims a mapping's fields and spells resources and elements as
+// FHIR does; observation values are coded in LOINC unless a system is set
+func Normalize(m *models.FHIRMapping) {
+	for i := range m.Fields {
+		f := &m.Fields[i]
+		f.Column = strings.TrimSpace(f.Column)
+		f.Resource = canonical(strings.TrimSpace(f.Resource), resourceNames())
+		f.Path = strings.TrimSpace(f.Path)
+		if paths, ok := elements[f.Resource]; ok {
+			f.Path = canonical(f.Path, pathNames(paths))
+		}
+		f.Code = strings.TrimSpace(f.Code)
+		f.System = strings.TrimSpace(f.System)
+		f.Display = strings.TrimSpace(f.Display)
+		f.Unit = strings.TrimSpace(f.Unit)
+		if f.Resource == ResourceObservation && f.Path == "value" && f.System == "" {
+			f.System = SystemLOINC
+		}
+	}
+}
+
+func resourceNames() []string {
+	return []string{ResourcePatient, ResourceEncounter, ResourceObservation}
+}
+
+func pathNames(paths map[string]element) []string {
+	out := make([]string, 0, len(paths))
+	for p := range paths {
+		out = append(out, p)
+	}
+	return out
+}
+
+// canonical is the name of names s spells in any case; s itself otherwise
+func canonical(s string, names []string) string {
+	for _, n := range names {
+		if strings.EqualFold(n, s) {
+			return n
+		}
+	}
+	return s
+}
+
+// Validate checks a normalized mapping. An Encounter needs its status and
+// class mapped, as the profile requires both. Columns are checked against
+// the dataset's when they are known; nil columns skip the check.
+func Validate(m models.FHIRMapping, columns []string) error {
+	if len(m.Fields) == 0 {
+		return ErrNoFields
+	}
+	if len(m.Fields) > MaxFields {
+		return fmt.Errorf("%w: at most %d", ErrTooManyFields, MaxFields)
+	}
+	seen := make(map[string]struct{}, len(m.Fields))
+	encounter := false
+	for _, f := range m.Fields {
+		if f.Column == "" {
+			return fmt.Errorf("%w: column is required", ErrInvalidField)
+		}
+		paths, ok := elements[f.Resource]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownResource, f.Resource)
+		}
+		if _, ok := paths[f.Path]; !ok {
+			return fmt.Errorf("%w: %s.%s", ErrUnknownElement, f.Resource, f.Path)
+		}
+		key := f.Resource + "." + f.Path
+		observation := f.Resource == ResourceObservation && f.Path == "value"
+		switch {
+		case observation && f.Code == "":
+			return fmt.Errorf("%w: %s: %v", ErrInvalidField, f.Column, errObservationValue)
+		case observation:
+			key += "|" + f.System + "|" + f.Code
+		case f.Code != "" || f.System != "" || f.Display != "" || f.Unit != "":
+			return fmt.Errorf("%w: %s: code, system, display and unit are only taken by observation values", ErrInvalidField, f.Column)
+		}
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateField, key)
+		}
+		seen[key] = struct{}{}
+		encounter = encounter || f.Resource == ResourceEncounter
+		if columns != nil && !hasColumn(columns, f.Column) {
+			return fmt.Errorf("%w: %s", ErrUnknownColumn, strconv.Quote(f.Column))
+		}
+	}
+	if encounter {
+		for _, required := range []string{"status", "class"} {
+			if _, ok := seen[ResourceEncounter+"."+required]; !ok {
+				return fmt.Errorf("%w: %s.%s", ErrMissingElement, ResourceEncounter, required)
+			}
+		}
+	}
+	return nil
+}
+
+func hasColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if strings.EqualFold(c, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Mapping is the mapping a job exports with; nil for a nil mapping
+func Mapping(m *models.FHIRMapping) *agents.FHIRMapping {
+	if m == nil {
+		return nil
+	}
+	out := &agents.FHIRMapping{Fields: make([]agents.FHIRField, len(m.Fields))}
+	for i, f := range m.Fields {
+		out.Fields[i] = agents.FHIRField(f)
+	}
+	return out
+}
+
+// Apply records the mapping on the request and asks for values the
+// resource profiles allow
+func Apply(req *agents.GenerationRequest, m *agents.FHIRMapping) {
+	if m == nil {
+		return
+	}
+	req.FHIR = m
+	var hints []string
+	for _, f := range m.Fields {
+		el := elements[f.Resource][f.Path]
+		switch el.kind {
+		case kindCode:
+			hints = append(hints, fmt.Sprintf("%s one of %s", f.Column, strings.Join(el.codes, ", ")))
+		case kindBoolean:
+			hints = append(hints, fmt.Sprintf("%s true or false", f.Column))
+		case kindDate:
+			hints = append(hints, fmt.Sprintf("%s a date as YYYY-MM-DD", f.Column))
+		case kindDateTime:
+			hints = append(hints, fmt.Sprintf("%s a date and time as YYYY-MM-DDThh:mm:ssZ", f.Column))
+		case kindValue:
+			what := f.Code
+			if f.Display != "" {
+				what = f.Display
+			}
+			if f.Unit != "" {
+				hints = append(hints, fmt.Sprintf("%s a %s value in %s", f.Column, what, f.Unit))
+			} else {
+				hints = append(hints, fmt.Sprintf("%s a %s value", f.Column, what))
+			}
+		}
+	}
+	constraint := "rows are exported as FHIR R4 resources, one patient per row"
+	if len(hints) > 0 {
+		constraint += "; " + strings.Join(hints, "; ")
+	}
+	req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints, constraint)
+}
+
+// record is the resources made of one row
+type record struct {
+	patient      map[string]interface{}
+	encounter    map[string]interface{}
+	observations []map[string]interface{}
+}
+
+// build makes the resources of a row and names the elements whose values
+// their profiles do not allow. Null values leave their element out, and an
+// observation without a value is not made.
+func build(row map[string]interface{}, m *agents.FHIRMapping) (record, []string) {
+	rec := record{patient: map[string]interface{}{"resourceType": ResourcePatient}}
+	var violations []string
+	var effective, status interface{}
+	var start, end time.Time
+	for _, f := range m.Fields {
+		if f.Resource == ResourceEncounter && rec.encounter == nil {
+			rec.encounter = map[string]interface{}{"resourceType": ResourceEncounter}
+		}
+		v := row[f.Column]
+		if s, ok := v.(string); v == nil || ok && strings.TrimSpace(s) == "" {
+			continue
+		}
+		el := elements[f.Resource][f.Path]
+		var out interface{}
+		ok := true
+		switch el.kind {
+		case kindString:
+			out = text(v)
+		case kindCode:
+			out, ok = code(v, f, el.codes)
+		case kindBoolean:
+			out, ok = boolean(v)
+		case kindDate:
+			out, ok = date(v)
+		case kindDateTime:
+			var t time.Time
+			out, t, ok = dateTime(v)
+			if f.Path == "period.start" {
+				start = t
+			} else if f.Path == "period.end" {
+				end = t
+			}
+		case kindValue:
+			var obs map[string]interface{}
+			obs, ok = observation(v, f)
+			if ok {
+				rec.observations = append(rec.observations, obs)
+			}
+		}
+		if !ok {
+			violations = append(violations, f.Resource+"."+f.Path)
+			continue
+		}
+		switch f.Resource {
+		case ResourcePatient:
+			set(rec.patient, f.Path, out)
+		case ResourceEncounter:
+			set(rec.encounter, f.Path, out)
+		case ResourceObservation:
+			switch f.Path {
+			case "effectiveDateTime":
+				effective = out
+			case "status":
+				status = out
+			}
+		}
+	}
+	if rec.encounter != nil {
+		for _, required := range []string{"status", "class"} {
+			if _, ok := rec.encounter[required]; !ok {
+				violations = append(violations, ResourceEncounter+"."+required)
+			}
+		}
+		if !start.IsZero() && !end.IsZero() && end.Before(start) {
+			violations = append(violations, ResourceEncounter+".period")
+		}
+	}
+	for _, obs := range rec.observations {
+		if effective != nil {
+			obs["effectiveDateTime"] = effective
+		}
+		if status != nil {
+			obs["status"] = status
+		}
+	}
+	return rec, violations
+}
+
+// set writes a value to an element of a resource
+func set(res map[string]interface{}, path string, v interface{}) {
+	switch path {
+	case "identifier":
+		res["identifier"] = []interface{}{map[string]interface{}{"value": v}}
+	case "name.family":
+		first(res, "name")["family"] = v
+	case "name.given":
+		first(res, "name")["given"] = []interface{}{v}
+	case "telecom.phone", "telecom.email":
+		telecom, _ := res["telecom"].([]interface{})
+		res["telecom"] = append(telecom, map[string]interface{}{"system": strings.TrimPrefix(path, "telecom."), "value": v})
+	case "address.line":
+		first(res, "address")["line"] = []interface{}{v}
+	case "address.city", "address.state", "address.postalCode", "address.country":
+		first(res, "address")[strings.TrimPrefix(path, "address.")] = v
+	case "class":
+		res["class"] = map[string]interface{}{"system": systemActCode, "code": v}
+	case "type", "reasonCode":
+		res[path] = []interface{}{map[string]interface{}{"text": v}}
+	case "period.start", "period.end":
+		period, _ := res["period"].(map[string]interface{})
+		if period == nil {
+			period = map[string]interface{}{}
+			res["period"] = period
+		}
+		period[strings.TrimPrefix(path, "period.")] = v
+	default:
+		res[path] = v
+	}
+}
+
+// first is the first item of a repeating element, added when there is none
+func first(res map[string]interface{}, key string) map[string]interface{} {
+	if items, ok := res[key].([]interface{}); ok && len(items) > 0 {
+		return items[0].(map[string]interface{})
+	}
+	item := map[string]interface{}{}
+	res[key] = []interface{}{item}
+	return item
+}
+
+// text renders a value as a FHIR string
+func text(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case json.Number:
+		return x.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// code matches a value to the value set of its element in any case;
+// genders may also be abbreviated
+func code(v interface{}, f agents.FHIRField, codes []string) (string, bool) {
+	s := text(v)
+	if f.Resource == ResourcePatient && f.Path == "gender" {
+		if g, ok := genderAliases[strings.ToLower(s)]; ok {
+			return g, true
+		}
+	}
+	for _, c := range codes {
+		if strings.EqualFold(c, s) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+func boolean(v interface{}) (bool, bool) {
+	switch x := v.(type) {
+	case bool:
+		return x, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(x))
+		return b, err == nil
+	}
+	return false, false
+}
+
+// Date layouts FHIR allows, from the most precise
+var dateLayouts = []string{"2006-01-02", "2006-01", "2006"}
+
+// Timestamp layouts values are read from; those without a zone are taken
+// as UTC, since FHIR needs a zone on any time
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05"}
+
+// date reads a FHIR date; timestamps keep their date
+func date(v interface{}) (string, bool) {
+	s := text(v)
+	for _, layout := range dateLayouts {
+		if _, err := time.Parse(layout, s); err == nil {
+			return s, true
+		}
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
+
+// dateTime reads a FHIR dateTime and the instant it starts at
+func dateTime(v interface{}) (string, time.Time, bool) {
+	s := text(v)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return s, t, true
+		}
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format(time.RFC3339), t, true
+		}
+	}
+	return "", time.Time{}, false
+}
+
+// observation makes the Observation a value records. Numbers are
+// quantities in the field's unit; text that reads as a number is one too
+// when the field has a unit.
+func observation(v interface{}, f agents.FHIRField) (map[string]interface{}, bool) {
+	coding := map[string]interface{}{"system": f.System, "code": f.Code}
+	concept := map[string]interface{}{"coding": []interface{}{coding}}
+	if f.Display != "" {
+		coding["display"] = f.Display
+		concept["text"] = f.Display
+	}
+	obs := map[string]interface{}{
+		"resourceType": ResourceObservation,
+		"status":       "final",
+		"code":         concept,
+	}
+	switch x := v.(type) {
+	case bool:
+		obs["valueBoolean"] = x
+		return obs, true
+	case string:
+		if n, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err == nil && f.Unit != "" {
+			return quantity(obs, n, f.Unit)
+		}
+		obs["valueString"] = strings.TrimSpace(x)
+		return obs, true
+	case float64:
+		return quantity(obs, x, f.Unit)
+	case int:
+		return quantity(obs, float64(x), f.Unit)
+	case int64:
+		return quantity(obs, float64(x), f.Unit)
+	case json.Number:
+		if n, err := x.Float64(); err == nil {
+			return quantity(obs, n, f.Unit)
+		}
+	}
+	obs["valueString"] = text(v)
+	return obs, true
+}
+
+func quantity(obs map[string]interface{}, n float64, unit string) (map[string]interface{}, bool) {
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return nil, false
+	}
+	q := map[string]interface{}{"value": n}
+	if unit != "" {
+		q["unit"] = unit
+		q["system"] = systemUCUM
+		q["code"] = unit
+	}
+	obs["valueQuantity"] = q
+	return obs, true
+}
+
+// Checker drops generated rows whose resources break their profiles. A nil
+// *Checker keeps every row.
+type Checker struct {
+	mapping    *agents.FHIRMapping
+	dropped    int64
+	resources  map[string]int64
+	violations map[string]int64
+}
+
+// NewChecker returns a checker for a mapping; nil for a nil mapping
+func NewChecker(m *agents.FHIRMapping) *Checker {
+	if m == nil {
+		return nil
+	}
+	return &Checker{mapping: m, resources: make(map[string]int64), violations: make(map[string]int64)}
+}
+
+// Filter returns the rows whose resources are valid
+func (c *Checker) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if c == nil {
+		return rows
+	}
+	kept := rows[:0]
+	for _, row := range rows {
+		rec, violations := build(row, c.mapping)
+		if len(violations) > 0 {
+			c.dropped++
+			for _, v := range violations {
+				c.violations[v]++
+			}
+			continue
+		}
+		c.resources[ResourcePatient]++
+		if rec.encounter != nil {
+			c.resources[ResourceEncounter]++
+		}
+		c.resources[ResourceObservation] += int64(len(rec.observations))
+		kept = append(kept, row)
+	}
+	return kept
+}
+
+// Report describes the resources made of the rows that were kept, before
+// any duplicates are added to them; nil for a nil checker
+func (c *Checker) Report() *models.FHIRReport {
+	if c == nil {
+		return nil
+	}
+	out := &models.FHIRReport{Resources: c.resources, Dropped: c.dropped}
+	if len(c.violations) > 0 {
+		out.Violations = c.violations
+	}
+	return out
+}
+
+// Encode writes rows as a FHIR collection bundle, each resource under a
+// urn:uuid full URL that the encounter and observations of its row refer
+// to. Rows are expected to have passed a Checker; one that still breaks a
+// profile is an error rather than an invalid resource.
+func Encode(rows []map[string]interface{}, m *agents.FHIRMapping) ([]byte, error) {
+	if m == nil {
+		return nil, ErrNoFields
+	}
+	entries := make([]interface{}, 0, len(rows))
+	add := func(res map[string]interface{}) string {
+		id := uuid.NewString()
+		res["id"] = id
+		url := "urn:uuid:" + id
+		entries = append(entries, map[string]interface{}{"fullUrl": url, "resource": res})
+		return url
+	}
+	for i, row := range rows {
+		rec, violations := build(row, m)
+		if len(violations) > 0 {
+			return nil, fmt.Errorf("%w: row %d, %s", ErrInvalidResource, i+1, strings.Join(violations, ", "))
+		}
+		subject := map[string]interface{}{"reference": add(rec.patient)}
+		var encounter map[string]interface{}
+		if rec.encounter != nil {
+			rec.encounter["subject"] = subject
+			encounter = map[string]interface{}{"reference": add(rec.encounter)}
+		}
+		for _, obs := range rec.observations {
+			obs["subject"] = subject
+			if encounter != nil {
+				obs["encounter"] = encounter
+			}
+			add(obs)
+		}
+	}
+	return json.Marshal(map[string]interface{}{
+		"resourceType": "Bundle",
+		"id":           uuid.NewString(),
+		"type":         "collection",
+		"timestamp":    time.Now().UTC().Format(time.RFC3339),
+		"entry":        entries,
+	})
+}
@@ -0,0 +1,132 @@
+// Package fhir_test provides unit tests for FHIR exports
+package fhir_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fhir"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mapping() models.FHIRMapping {
+	m := models.FHIRMapping{Fields: models.FHIRFields{
+		{Column: "mrn", Resource: "patient", Path: "identifier"},
+		{Column: "sex", Resource: "Patient", Path: "gender"},
+		{Column: "dob", Resource: "Patient", Path: "birthdate"},
+		{Column: "visit_status", Resource: "Encounter", Path: "status"},
+		{Column: "visit_class", Resource: "Encounter", Path: "class"},
+		{Column: "admitted", Resource: "Encounter", Path: "period.start"},
+		{Column: "discharged", Resource: "Encounter", Path: "period.end"},
+		{Column: "heart_rate", Resource: "Observation", Path: "value", Code: "8867-4", Display: "Heart rate", Unit: "/min"},
+	}}
+	fhir.Normalize(&m)
+	return m
+}
+
+func TestValidate(t *testing.T) {
+	m := mapping()
+	assert.Equal(t, "Patient", m.Fields[0].Resource)
+	assert.Equal(t, "birthDate", m.Fields[2].Path)
+	assert.Equal(t, fhir.SystemLOINC, m.Fields[7].System)
+	assert.NoError(t, fhir.Validate(m, nil))
+	assert.ErrorIs(t, fhir.Validate(m, []string{"mrn"}), fhir.ErrUnknownColumn)
+
+	assert.ErrorIs(t, fhir.Validate(models.FHIRMapping{}, nil), fhir.ErrNoFields)
+
+	unknown := mapping()
+	unknown.Fields[0].Path = "ssn"
+	assert.ErrorIs(t, fhir.Validate(unknown, nil), fhir.ErrUnknownElement)
+
+	uncoded := mapping()
+	uncoded.Fields[7].Code = ""
+	assert.ErrorIs(t, fhir.Validate(uncoded, nil), fhir.ErrInvalidField)
+
+	dup := mapping()
+	dup.Fields = append(dup.Fields, models.FHIRField{Column: "gender", Resource: "Patient", Path: "gender"})
+	assert.ErrorIs(t, fhir.Validate(dup, nil), fhir.ErrDuplicateField)
+
+	noClass := mapping()
+	noClass.Fields = append(noClass.Fields[:4], noClass.Fields[5:]...)
+	assert.ErrorIs(t, fhir.Validate(noClass, nil), fhir.ErrMissingElement)
+}
+
+func row() map[string]interface{} {
+	return map[string]interface{}{
+		"mrn": 1001.0, "sex": "F", "dob": "1980-04-02T00:00:00Z",
+		"visit_status": "finished", "visit_class": "amb",
+		"admitted": "2024-01-05 09:30:00", "discharged": "2024-01-05T11:00:00Z",
+		"heart_rate": 72.0,
+	}
+}
+
+func TestChecker(t *testing.T) {
+	m := mapping()
+	c := fhir.NewChecker(fhir.Mapping(&m))
+	bad := row()
+	bad["sex"] = "woman"
+	backwards := row()
+	backwards["discharged"] = "2024-01-04"
+	missing := row()
+	missing["visit_class"] = nil
+	rows := c.Filter([]map[string]interface{}{row(), bad, backwards, missing})
+	require.Len(t, rows, 1)
+
+	report := c.Report()
+	assert.Equal(t, int64(3), report.Dropped)
+	assert.Equal(t, map[string]int64{"Patient.gender": 1, "Encounter.period": 1, "Encounter.class": 1}, report.Violations)
+	assert.Equal(t, map[string]int64{"Patient": 1, "Encounter": 1, "Observation": 1}, report.Resources)
+
+	assert.Nil(t, fhir.NewChecker(nil).Report())
+}
+
+func TestEncode(t *testing.T) {
+	m := mapping()
+	out, err := fhir.Encode([]map[string]interface{}{row()}, fhir.Mapping(&m))
+	require.NoError(t, err)
+
+	var bundle struct {
+		ResourceType string `json:"resourceType"`
+		Type         string `json:"type"`
+		Entry        []struct {
+			FullURL  string                 `json:"fullUrl"`
+			Resource map[string]interface{} `json:"resource"`
+		} `json:"entry"`
+	}
+	require.NoError(t, json.Unmarshal(out, &bundle))
+	assert.Equal(t, "Bundle", bundle.ResourceType)
+	assert.Equal(t, "collection", bundle.Type)
+	require.Len(t, bundle.Entry, 3)
+
+	patient, encounter, obs := bundle.Entry[0].Resource, bundle.Entry[1].Resource, bundle.Entry[2].Resource
+	assert.Equal(t, "Patient", patient["resourceType"])
+	assert.Equal(t, "female", patient["gender"])
+	assert.Equal(t, "1980-04-02", patient["birthDate"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"value": "1001"}}, patient["identifier"])
+
+	assert.Equal(t, "AMB", encounter["class"].(map[string]interface{})["code"])
+	assert.Equal(t, "2024-01-05T09:30:00Z", encounter["period"].(map[string]interface{})["start"])
+	assert.Equal(t, bundle.Entry[0].FullURL, encounter["subject"].(map[string]interface{})["reference"])
+
+	assert.Equal(t, "final", obs["status"])
+	assert.Equal(t, bundle.Entry[1].FullURL, obs["encounter"].(map[string]interface{})["reference"])
+	assert.Equal(t, map[string]interface{}{"value": 72.0, "unit": "/min", "system": "http://unitsofmeasure.org", "code": "/min"}, obs["valueQuantity"])
+
+	invalid := row()
+	invalid["visit_status"] = "done"
+	_, err = fhir.Encode([]map[string]interface{}{invalid}, fhir.Mapping(&m))
+	assert.ErrorIs(t, err, fhir.ErrInvalidResource)
+}
+
+func TestApply(t *testing.T) {
+	m := mapping()
+	req := &agents.GenerationRequest{}
+	fhir.Apply(req, fhir.Mapping(&m))
+	require.NotNil(t, req.FHIR)
+	require.Len(t, req.SchemaAnalysis.Constraints, 1)
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "sex one of male, female, other, unknown")
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "heart_rate a Heart rate value in /min")
+}
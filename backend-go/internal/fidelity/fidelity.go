@@ -0,0 +1,758 @@
+// Package fidelity measures how closely generated rows follow a reference
+// sample of the source data. Each column is compared with a two-sample test
+// (Kolmogorov-Smirnov for numbers, chi-square for categories) and the
+// Jensen-Shannon divergence of the two distributions; pairwise correlations
+// are compared as a matrix; and the rows as a whole are compared by how well
+// a propensity model and a kernel two-sample test tell them apart.
+package fidelity
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MaxReferenceRows caps the source rows a generation is measured against
+	MaxReferenceRows = 500
+	// maxCategories caps the categories compared per column; the rest are
+	// pooled with values the reference never had
+	maxCategories = 50
+	// histogramBins is how many reference quantile bins numeric columns are
+	// compared over
+	histogramBins = 10
+	// maxCorrelationColumns caps the numeric columns of the correlation
+	// matrix
+	maxCorrelationColumns = 20
+	// maxDetectionRows caps the rows per side of the propensity model and
+	// the kernel test
+	maxDetectionRows = 300
+	// detectionCategories is how many of a column's categories are one-hot
+	// encoded for the propensity model and kernel test
+	detectionCategories = 10
+	// numericShare is the share of reference values that must be numbers
+	// for a column to be compared as numeric
+	numericShare = 0.9
+	// identifierShare is the distinct share above which a text column is
+	// taken for an identifier and not compared
+	identifierShare = 0.9
+	// minIdentifierRows is the fewest values a column is taken for an
+	// identifier at
+	minIdentifierRows = 20
+	// propensityIterations is how many gradient steps fit the propensity
+	// model
+	propensityIterations = 200
+)
+
+// Column kinds
+const (
+	KindNumeric     = "numeric"
+	KindCategorical = "categorical"
+)
+
+// Column tests
+const (
+	TestKS        = "ks"
+	TestChiSquare = "chi_square"
+)
+
+// ColumnReport compares one column of the generated rows with the reference
+type ColumnReport struct {
+	Column string `json:"column"`
+	Kind   string `json:"kind"`
+	Test   string `json:"test"`
+	// Statistic is the KS distance or the chi-square statistic, and PValue
+	// the probability of a difference at least as large between two samples
+	// of the same distribution
+	Statistic float64 `json:"statistic"`
+	PValue    float64 `json:"p_value"`
+	// JSDivergence is the Jensen-Shannon divergence in bits, from 0 for the
+	// same distribution to 1 for disjoint ones
+	JSDivergence float64 `json:"js_divergence"`
+	// Similarity is one minus the KS distance or the total variation
+	// distance of the categories
+	Similarity float64 `json:"similarity"`
+	// Missing is set when no generated row has a value for the column
+	Missing bool `json:"missing,omitempty"`
+	// Bins are the shares of each sample in the reference quantile bins of
+	// a numeric column or the categories of a categorical one, the last
+	// pooling the rest
+	Bins []Bin `json:"bins,omitempty"`
+}
+
+// Bin is one bin of a column's distributions
+type Bin struct {
+	Label     string  `json:"label"`
+	Reference float64 `json:"reference"`
+	Synthetic float64 `json:"synthetic"`
+}
+
+// CorrelationDelta is the change in the Pearson correlation of a pair of
+// numeric columns
+type CorrelationDelta struct {
+	A         string  `json:"a"`
+	B         string  `json:"b"`
+	Reference float64 `json:"reference"`
+	Synthetic float64 `json:"synthetic"`
+	Delta     float64 `json:"delta"`
+}
+
+// Report measures generated rows against a reference sample. The scores
+// run from 0 to 1, 1 meaning the generated rows are indistinguishable from
+// the reference by that measure.
+type Report struct {
+	ReferenceRows int                `json:"reference_rows"`
+	SyntheticRows int                `json:"synthetic_rows"`
+	Columns       []ColumnReport     `json:"columns"`
+	Correlations  []CorrelationDelta `json:"correlations,omitempty"`
+	// CorrelationDelta is the mean absolute change of the correlation matrix
+	// and MaxCorrelationDelta its largest
+	CorrelationDelta    float64 `json:"correlation_delta"`
+	MaxCorrelationDelta float64 `json:"max_correlation_delta"`
+	// PropensityMSE is the mean squared error of a logistic propensity
+	// model's scores around the share of generated rows, and MMD the
+	// maximum mean discrepancy of the rows under a Gaussian kernel
+	PropensityMSE float64 `json:"propensity_mse"`
+	MMD           float64 `json:"mmd"`
+
+	StatisticalSimilarity   float64 `json:"statistical_similarity"`
+	DistributionFidelity    float64 `json:"distribution_fidelity"`
+	CorrelationPreservation float64 `json:"correlation_preservation"`
+	Indistinguishability    float64 `json:"indistinguishability"`
+}
+
+// column is a compared column with the values of both samples
+type column struct {
+	name       string
+	kind       string
+	ref, syn   []interface{}
+	categories []string // reference categories by count, for one-hot encoding
+	mean, sd   float64
+}
+
+// Compare measures synthetic rows against reference rows; nil when either
+// is empty. Columns come from the reference; columns holding nested values
+// or identifiers are not compared.
+func Compare(reference, synthetic []map[string]interface{}) *Report {
+	if len(reference) == 0 || len(synthetic) == 0 {
+		return nil
+	}
+	if len(reference) > MaxReferenceRows {
+		reference = Sample(reference, MaxReferenceRows)
+	}
+	r := &Report{ReferenceRows: len(reference), SyntheticRows: len(synthetic), Columns: []ColumnReport{}}
+
+	var cols []*column
+	for _, name := range columnNames(reference) {
+		col := classify(name, reference, synthetic)
+		if col == nil {
+			continue
+		}
+		cols = append(cols, col)
+		r.Columns = append(r.Columns, compareColumn(col))
+	}
+
+	similarity, divergence := 0.0, 0.0
+	for _, c := range r.Columns {
+		similarity += c.Similarity
+		divergence += c.JSDivergence
+	}
+	r.StatisticalSimilarity, r.DistributionFidelity = 1, 1
+	if n := float64(len(r.Columns)); n > 0 {
+		r.StatisticalSimilarity = similarity / n
+		r.DistributionFidelity = 1 - divergence/n
+	}
+
+	r.Correlations = correlations(cols, reference, synthetic)
+	r.CorrelationPreservation = 1
+	if len(r.Correlations) > 0 {
+		sum := 0.0
+		for _, d := range r.Correlations {
+			sum += d.Delta
+			r.MaxCorrelationDelta = math.Max(r.MaxCorrelationDelta, d.Delta)
+		}
+		r.CorrelationDelta = sum / float64(len(r.Correlations))
+		// Correlations differ by at most 2
+		r.CorrelationPreservation = 1 - r.CorrelationDelta/2
+	}
+
+	r.Indistinguishability = 1
+	x, y := features(cols, Sample(reference, maxDetectionRows)), features(cols, Sample(synthetic, maxDetectionRows))
+	if len(x) > 0 && len(x[0]) > 0 {
+		r.MMD = mmd(x, y)
+		var share float64
+		r.PropensityMSE, share = propensityMSE(x, y)
+		// Scores that separate the samples perfectly err by share*(1-share)
+		r.Indistinguishability = clamp(1 - r.PropensityMSE/(share*(1-share)))
+	}
+	return r
+}
+
+// Sample picks at most n rows spread evenly over rows
+func Sample(rows []map[string]interface{}, n int) []map[string]interface{} {
+	if len(rows) <= n {
+		return rows
+	}
+	out := make([]map[string]interface{}, n)
+	for i := range out {
+		out[i] = rows[i*len(rows)/n]
+	}
+	return out
+}
+
+func columnNames(rows []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, row := range rows {
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func values(rows []map[string]interface{}, name string) []interface{} {
+	var out []interface{}
+	for _, row := range rows {
+		if v, ok := row[name]; ok && v != nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// classify decides how a column is compared; nil when it is not
+func classify(name string, reference, synthetic []map[string]interface{}) *column {
+	col := &column{name: name, ref: values(reference, name), syn: values(synthetic, name)}
+	if len(col.ref) == 0 {
+		return nil
+	}
+	numeric := 0
+	for _, v := range col.ref {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil
+		}
+		if _, ok := Number(v); ok {
+			numeric++
+		}
+	}
+	if float64(numeric) >= numericShare*float64(len(col.ref)) {
+		col.kind = KindNumeric
+		nums := numbers(col.ref)
+		col.mean, col.sd = meanSD(nums)
+		return col
+	}
+	counts := categoryCounts(col.ref)
+	if len(col.ref) >= minIdentifierRows && float64(len(counts)) >= identifierShare*float64(len(col.ref)) {
+		return nil
+	}
+	col.kind = KindCategorical
+	col.categories = topCategories(counts, maxCategories)
+	return col
+}
+
+// Number reads a value as a number; numeric strings count
+func Number(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, !math.IsNaN(x) && !math.IsInf(x, 0)
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return f, err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+	}
+	return 0, false
+}
+
+func numbers(vals []interface{}) []float64 {
+	out := make([]float64, 0, len(vals))
+	for _, v := range vals {
+		if f, ok := Number(v); ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+func category(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return strings.TrimSpace(s)
+	}
+	return fmt.Sprint(v)
+}
+
+func categoryCounts(vals []interface{}) map[string]int {
+	out := make(map[string]int)
+	for _, v := range vals {
+		out[category(v)]++
+	}
+	return out
+}
+
+// topCategories lists the n most frequent categories, ties by name
+func topCategories(counts map[string]int, n int) []string {
+	out := make([]string, 0, len(counts))
+	for k := range counts {
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if counts[out[i]] != counts[out[j]] {
+			return counts[out[i]] > counts[out[j]]
+		}
+		return out[i] < out[j]
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func compareColumn(col *column) ColumnReport {
+	out := ColumnReport{Column: col.name, Kind: col.kind, Test: TestKS}
+	if col.kind == KindCategorical {
+		out.Test = TestChiSquare
+	}
+	var ref, syn []float64
+	if col.kind == KindNumeric {
+		ref, syn = numbers(col.ref), numbers(col.syn)
+	}
+	if len(col.syn) == 0 || col.kind == KindNumeric && len(syn) == 0 {
+		out.Missing, out.JSDivergence = true, 1
+		return out
+	}
+
+	if col.kind == KindNumeric {
+		sort.Float64s(ref)
+		sort.Float64s(syn)
+		out.Statistic = ksDistance(ref, syn)
+		out.PValue = ksPValue(out.Statistic, len(ref), len(syn))
+		out.Similarity = 1 - out.Statistic
+		edges, p, q := histogram(ref, syn)
+		out.JSDivergence = jsDivergence(p, q)
+		out.Bins = make([]Bin, len(p))
+		for i := range p {
+			out.Bins[i] = Bin{Label: binLabel(edges, i), Reference: p[i], Synthetic: q[i]}
+		}
+		return out
+	}
+
+	// Categories the reference lacks, or has too many of, are pooled
+	known := make(map[string]int, len(col.categories))
+	for i, c := range col.categories {
+		known[c] = i
+	}
+	bucket := func(v interface{}) int {
+		if i, ok := known[category(v)]; ok {
+			return i
+		}
+		return len(col.categories)
+	}
+	p := make([]float64, len(col.categories)+1)
+	q := make([]float64, len(col.categories)+1)
+	for _, v := range col.ref {
+		p[bucket(v)]++
+	}
+	for _, v := range col.syn {
+		q[bucket(v)]++
+	}
+	out.Statistic, out.PValue = chiSquare(p, q)
+	tvd := 0.0
+	pn, qn := normalize(p), normalize(q)
+	for i := range pn {
+		tvd += math.Abs(pn[i] - qn[i])
+	}
+	out.Similarity = clamp(1 - tvd/2)
+	out.JSDivergence = jsDivergence(pn, qn)
+	for i := range pn {
+		label := otherCategories
+		if i < len(col.categories) {
+			label = col.categories[i]
+		} else if pn[i] == 0 && qn[i] == 0 {
+			break
+		}
+		out.Bins = append(out.Bins, Bin{Label: label, Reference: pn[i], Synthetic: qn[i]})
+	}
+	return out
+}
+
+// otherCategories labels the bin pooling the categories not compared one by
+// one
+const otherCategories = "(other)"
+
+// binLabel names bin i of a histogram over edges: values up to the first
+// edge, between two edges, or above the last
+func binLabel(edges []float64, i int) string {
+	f := func(x float64) string { return strconv.FormatFloat(x, 'g', 4, 64) }
+	switch {
+	case len(edges) == 0:
+		return "all"
+	case i == 0:
+		return "≤ " + f(edges[0])
+	case i == len(edges):
+		return "> " + f(edges[i-1])
+	}
+	return f(edges[i-1]) + " – " + f(edges[i])
+}
+
+// ksDistance is the largest gap between the empirical distribution
+// functions of two sorted samples
+func ksDistance(a, b []float64) float64 {
+	var i, j int
+	d := 0.0
+	for i < len(a) && j < len(b) {
+		x := math.Min(a[i], b[j])
+		for i < len(a) && a[i] <= x {
+			i++
+		}
+		for j < len(b) && b[j] <= x {
+			j++
+		}
+		d = math.Max(d, math.Abs(float64(i)/float64(len(a))-float64(j)/float64(len(b))))
+	}
+	return d
+}
+
+// ksPValue is the asymptotic significance of a two-sample KS distance
+func ksPValue(d float64, n, m int) float64 {
+	ne := float64(n) * float64(m) / float64(n+m)
+	sq := math.Sqrt(ne)
+	lambda := (sq + 0.12 + 0.11/sq) * d
+	if lambda < 1e-3 {
+		return 1
+	}
+	sum, sign := 0.0, 1.0
+	for k := 1; k <= 100; k++ {
+		term := sign * math.Exp(-2*float64(k*k)*lambda*lambda)
+		sum += term
+		if math.Abs(term) < 1e-10 {
+			break
+		}
+		sign = -sign
+	}
+	return clamp(2 * sum)
+}
+
+// chiSquare tests whether two category counts come from the same
+// distribution; categories neither sample has are left out
+func chiSquare(p, q []float64) (float64, float64) {
+	var pn, qn float64
+	for i := range p {
+		pn += p[i]
+		qn += q[i]
+	}
+	n := pn + qn
+	stat, categories := 0.0, 0
+	for i := range p {
+		total := p[i] + q[i]
+		if total == 0 {
+			continue
+		}
+		categories++
+		for _, cell := range []struct{ observed, rowTotal float64 }{{p[i], pn}, {q[i], qn}} {
+			expected := cell.rowTotal * total / n
+			stat += (cell.observed - expected) * (cell.observed - expected) / expected
+		}
+	}
+	df := categories - 1
+	if df <= 0 {
+		return stat, 1
+	}
+	return stat, upperGamma(float64(df)/2, stat/2)
+}
+
+// histogram counts both samples over bins cut at the reference deciles and
+// returns the cuts with the shares
+func histogram(ref, syn []float64) ([]float64, []float64, []float64) {
+	var edges []float64
+	for i := 1; i < histogramBins; i++ {
+		e := ref[i*len(ref)/histogramBins]
+		if len(edges) == 0 || e > edges[len(edges)-1] {
+			edges = append(edges, e)
+		}
+	}
+	count := func(xs []float64) []float64 {
+		out := make([]float64, len(edges)+1)
+		for _, x := range xs {
+			out[sort.SearchFloat64s(edges, x)]++
+		}
+		return normalize(out)
+	}
+	return edges, count(ref), count(syn)
+}
+
+func normalize(xs []float64) []float64 {
+	sum := 0.0
+	for _, x := range xs {
+		sum += x
+	}
+	out := make([]float64, len(xs))
+	if sum == 0 {
+		return out
+	}
+	for i, x := range xs {
+		out[i] = x / sum
+	}
+	return out
+}
+
+// jsDivergence is the Jensen-Shannon divergence of two distributions in
+// bits
+func jsDivergence(p, q []float64) float64 {
+	kl := func(a, m []float64) float64 {
+		out := 0.0
+		for i := range a {
+			if a[i] > 0 && m[i] > 0 {
+				out += a[i] * math.Log2(a[i]/m[i])
+			}
+		}
+		return out
+	}
+	m := make([]float64, len(p))
+	for i := range p {
+		m[i] = (p[i] + q[i]) / 2
+	}
+	return clamp(kl(p, m)/2 + kl(q, m)/2)
+}
+
+// correlations compares the Pearson correlation of every pair of numeric
+// columns in both samples; pairs constant in either are left out
+func correlations(cols []*column, reference, synthetic []map[string]interface{}) []CorrelationDelta {
+	var numeric []string
+	for _, c := range cols {
+		if c.kind == KindNumeric && len(numeric) < maxCorrelationColumns {
+			numeric = append(numeric, c.name)
+		}
+	}
+	var out []CorrelationDelta
+	for i := 0; i < len(numeric); i++ {
+		for j := i + 1; j < len(numeric); j++ {
+			ref, ok := pearson(reference, numeric[i], numeric[j])
+			if !ok {
+				continue
+			}
+			syn, ok := pearson(synthetic, numeric[i], numeric[j])
+			if !ok {
+				// A pair the generated rows cannot correlate lost it
+				syn = 0
+			}
+			out = append(out, CorrelationDelta{A: numeric[i], B: numeric[j], Reference: ref, Synthetic: syn, Delta: math.Abs(ref - syn)})
+		}
+	}
+	return out
+}
+
+func pearson(rows []map[string]interface{}, a, b string) (float64, bool) {
+	var xs, ys []float64
+	for _, row := range rows {
+		x, ok1 := Number(row[a])
+		y, ok2 := Number(row[b])
+		if ok1 && ok2 {
+			xs = append(xs, x)
+			ys = append(ys, y)
+		}
+	}
+	if len(xs) < 3 {
+		return 0, false
+	}
+	mx, sx := meanSD(xs)
+	my, sy := meanSD(ys)
+	if sx == 0 || sy == 0 {
+		return 0, false
+	}
+	cov := 0.0
+	for i := range xs {
+		cov += (xs[i] - mx) * (ys[i] - my)
+	}
+	return math.Max(-1, math.Min(1, cov/float64(len(xs))/(sx*sy))), true
+}
+
+func meanSD(xs []float64) (float64, float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	v := 0.0
+	for _, x := range xs {
+		v += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(v / float64(len(xs)))
+}
+
+// features encodes rows for the propensity model and kernel test: numbers
+// standardized by the reference, categories one-hot over the reference's
+// most frequent ones. Missing values encode as zeros.
+func features(cols []*column, rows []map[string]interface{}) [][]float64 {
+	out := make([][]float64, len(rows))
+	for i, row := range rows {
+		var f []float64
+		for _, c := range cols {
+			if c.kind == KindNumeric {
+				x, ok := Number(row[c.name])
+				sd := c.sd
+				if sd == 0 {
+					sd = 1
+				}
+				if ok {
+					f = append(f, (x-c.mean)/sd)
+				} else {
+					f = append(f, 0)
+				}
+				continue
+			}
+			v, ok := row[c.name]
+			n := min(len(c.categories), detectionCategories)
+			for k := 0; k < n; k++ {
+				if ok && v != nil && category(v) == c.categories[k] {
+					f = append(f, 1)
+				} else {
+					f = append(f, 0)
+				}
+			}
+		}
+		out[i] = f
+	}
+	return out
+}
+
+// mmd is the biased maximum mean discrepancy of two samples under a
+// Gaussian kernel whose bandwidth is the number of features
+func mmd(x, y [][]float64) float64 {
+	gamma := 1 / (2 * float64(len(x[0])))
+	kernel := func(a, b []float64) float64 {
+		d := 0.0
+		for i := range a {
+			d += (a[i] - b[i]) * (a[i] - b[i])
+		}
+		return math.Exp(-gamma * d)
+	}
+	mean := func(a, b [][]float64) float64 {
+		sum := 0.0
+		for _, u := range a {
+			for _, v := range b {
+				sum += kernel(u, v)
+			}
+		}
+		return sum / float64(len(a)*len(b))
+	}
+	return math.Sqrt(math.Max(0, mean(x, x)+mean(y, y)-2*mean(x, y)))
+}
+
+// propensityMSE fits a logistic model telling synthetic rows from
+// reference rows and returns the mean squared error of its scores around
+// the synthetic share, with that share
+func propensityMSE(x, y [][]float64) (float64, float64) {
+	rows := append(append([][]float64{}, x...), y...)
+	labels := make([]float64, len(rows))
+	for i := len(x); i < len(rows); i++ {
+		labels[i] = 1
+	}
+	share := float64(len(y)) / float64(len(rows))
+	w := make([]float64, len(rows[0])+1)
+	score := func(f []float64) float64 {
+		z := w[len(f)]
+		for i, v := range f {
+			z += w[i] * v
+		}
+		return 1 / (1 + math.Exp(-z))
+	}
+	const rate, l2 = 0.5, 1e-3
+	grad := make([]float64, len(w))
+	for iter := 0; iter < propensityIterations; iter++ {
+		for i := range grad {
+			grad[i] = 0
+		}
+		for i, f := range rows {
+			e := score(f) - labels[i]
+			for k, v := range f {
+				grad[k] += e * v
+			}
+			grad[len(f)] += e
+		}
+		for k := range w {
+			g := grad[k] / float64(len(rows))
+			if k < len(w)-1 {
+				g += l2 * w[k]
+			}
+			w[k] -= rate * g
+		}
+	}
+	sum := 0.0
+	for _, f := range rows {
+		d := score(f) - share
+		sum += d * d
+	}
+	return sum / float64(len(rows)), share
+}
+
+// upperGamma is the regularized upper incomplete gamma function Q(a, x)
+func upperGamma(a, x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	lg, _ := math.Lgamma(a)
+	if x < a+1 {
+		// Series for the lower function
+		sum, term, ap := 1/a, 1/a, a
+		for n := 0; n < 500; n++ {
+			ap++
+			term *= x / ap
+			sum += term
+			if math.Abs(term) < math.Abs(sum)*1e-14 {
+				break
+			}
+		}
+		return clamp(1 - sum*math.Exp(-x+a*math.Log(x)-lg))
+	}
+	// Continued fraction for the upper function
+	const tiny = 1e-300
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < 500; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+		d = an*d + b
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = b + an/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-14 {
+			break
+		}
+	}
+	return clamp(math.Exp(-x+a*math.Log(x)-lg) * h)
+}
+
+func clamp(x float64) float64 {
+	if math.IsNaN(x) {
+		return 0
+	}
+	return math.Max(0, math.Min(1, x))
+}
@@ -0,0 +1,150 @@
+// Package fidelity_test provides unit tests for fidelity metrics
+package fidelity_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rows builds n rows where income follows age and region cycles; shift
+// moves income and flip breaks its correlation with age
+func rows(n int, shift float64, flip bool, regions []string) []map[string]interface{} {
+	out := make([]map[string]interface{}, n)
+	for i := range out {
+		age := float64(20 + i%50)
+		income := age*1000 + shift
+		if flip {
+			income = float64(69-i%50)*1000 + shift
+		}
+		out[i] = map[string]interface{}{
+			"age":    age,
+			"income": fmt.Sprint(income),
+			"region": regions[i%len(regions)],
+			"id":     fmt.Sprintf("row-%d", i),
+		}
+	}
+	return out
+}
+
+func column(r *fidelity.Report, name string) fidelity.ColumnReport {
+	for _, c := range r.Columns {
+		if c.Column == name {
+			return c
+		}
+	}
+	return fidelity.ColumnReport{}
+}
+
+func TestCompareIdenticalSamples(t *testing.T) {
+	ref := rows(200, 0, false, []string{"north", "south", "east"})
+	r := fidelity.Compare(ref, rows(200, 0, false, []string{"north", "south", "east"}))
+	require.NotNil(t, r)
+
+	assert.Equal(t, 200, r.ReferenceRows)
+	// The identifier column is not compared
+	assert.Len(t, r.Columns, 3)
+	age := column(r, "age")
+	assert.Equal(t, fidelity.KindNumeric, age.Kind)
+	assert.Equal(t, fidelity.TestKS, age.Test)
+	assert.InDelta(t, 0, age.Statistic, 1e-9)
+	assert.InDelta(t, 1, age.PValue, 1e-9)
+	region := column(r, "region")
+	assert.Equal(t, fidelity.TestChiSquare, region.Test)
+	assert.InDelta(t, 1, region.PValue, 1e-9)
+	assert.InDelta(t, 0, region.JSDivergence, 1e-9)
+
+	assert.InDelta(t, 1, r.StatisticalSimilarity, 1e-9)
+	assert.InDelta(t, 1, r.DistributionFidelity, 1e-9)
+	assert.InDelta(t, 1, r.CorrelationPreservation, 1e-9)
+	assert.InDelta(t, 0, r.MMD, 1e-6)
+	assert.Greater(t, r.Indistinguishability, 0.99)
+}
+
+func TestCompareShiftedSample(t *testing.T) {
+	ref := rows(200, 0, false, []string{"north", "south"})
+	r := fidelity.Compare(ref, rows(200, 60000, false, []string{"west"}))
+	require.NotNil(t, r)
+
+	income := column(r, "income")
+	assert.InDelta(t, 1, income.Statistic, 1e-9)
+	assert.Less(t, income.PValue, 1e-6)
+	region := column(r, "region")
+	assert.Less(t, region.PValue, 1e-6)
+	assert.InDelta(t, 1, region.JSDivergence, 1e-9)
+	// Every generated income lies above the reference bins; "west" is a
+	// category the reference lacks
+	last := income.Bins[len(income.Bins)-1]
+	assert.Equal(t, "> ", last.Label[:2])
+	assert.InDelta(t, 1, last.Synthetic, 1e-9)
+	require.Len(t, region.Bins, 3)
+	assert.Equal(t, "(other)", region.Bins[2].Label)
+	assert.InDelta(t, 0, region.Bins[2].Reference, 1e-9)
+	assert.InDelta(t, 1, region.Bins[2].Synthetic, 1e-9)
+	assert.Less(t, r.StatisticalSimilarity, 0.5)
+	assert.Less(t, r.Indistinguishability, 0.5)
+	assert.Greater(t, r.MMD, 0.1)
+}
+
+func TestCompareCorrelationDelta(t *testing.T) {
+	ref := rows(100, 0, false, []string{"a"})
+	r := fidelity.Compare(ref, rows(100, 0, true, []string{"a"}))
+	require.NotNil(t, r)
+
+	// Marginals match, the correlation is reversed
+	assert.InDelta(t, 0, column(r, "income").Statistic, 1e-9)
+	require.Len(t, r.Correlations, 1)
+	d := r.Correlations[0]
+	assert.Equal(t, "age", d.A)
+	assert.Equal(t, "income", d.B)
+	assert.InDelta(t, 1, d.Reference, 1e-9)
+	assert.InDelta(t, -1, d.Synthetic, 1e-9)
+	assert.InDelta(t, 2, r.MaxCorrelationDelta, 1e-9)
+	assert.InDelta(t, 0, r.CorrelationPreservation, 1e-9)
+}
+
+func TestCompareMissingColumn(t *testing.T) {
+	ref := rows(50, 0, false, []string{"a", "b"})
+	syn := rows(50, 0, false, []string{"a", "b"})
+	for _, row := range syn {
+		delete(row, "region")
+	}
+	r := fidelity.Compare(ref, syn)
+	region := column(r, "region")
+	assert.True(t, region.Missing)
+	assert.Equal(t, 1.0, region.JSDivergence)
+	assert.Equal(t, 0.0, region.Similarity)
+
+	// Reports are stored as JSON
+	_, err := json.Marshal(r)
+	assert.NoError(t, err)
+}
+
+func TestCompareEmpty(t *testing.T) {
+	assert.Nil(t, fidelity.Compare(nil, rows(10, 0, false, []string{"a"})))
+	assert.Nil(t, fidelity.Compare(rows(10, 0, false, []string{"a"}), nil))
+}
+
+func TestSample(t *testing.T) {
+	out := fidelity.Sample(rows(1000, 0, false, []string{"a"}), 10)
+	require.Len(t, out, 10)
+	assert.Equal(t, "row-0", out[0]["id"])
+	assert.Equal(t, "row-900", out[9]["id"])
+}
+
+func TestNumber(t *testing.T) {
+	for v, want := range map[interface{}]float64{1.5: 1.5, " 42 ": 42, int64(7): 7} {
+		got, ok := fidelity.Number(v)
+		assert.True(t, ok)
+		assert.Equal(t, want, got)
+	}
+	for _, v := range []interface{}{"abc", true, "NaN", math.Inf(1)} {
+		_, ok := fidelity.Number(v)
+		assert.False(t, ok, v)
+	}
+}
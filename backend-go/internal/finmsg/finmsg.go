@@ -0,0 +1,624 @@
+// Package finmsg renders generated transaction rows as payment messages
+// for payments testing: ISO 20022 pain.001 credit transfer initiations and
+// camt.053 statements, or SWIFT MT103 customer transfers. A layout names
+// the column holding each part of a transaction and the envelope of the
+// messages. Values are checked against the data types of the message
+// schemas while rows are generated, so every message written is valid.
+package finmsg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Format is the export format name of payment message output
+const Format = "financial_message"
+
+// Message types
+const (
+	// Pain001 is a customer credit transfer initiation
+	Pain001 = "pain.001.001.09"
+	// Camt053 is a bank to customer statement
+	Camt053 = "camt.053.001.08"
+	// MT103 is a SWIFT single customer credit transfer
+	MT103 = "mt103"
+)
+
+// Roles are the parts of a transaction columns hold
+const (
+	RoleEndToEndID   = "end_to_end_id"
+	RoleAmount       = "amount"
+	RoleCurrency     = "currency"
+	RoleDebtorName   = "debtor_name"
+	RoleDebtorIBAN   = "debtor_iban"
+	RoleDebtorBIC    = "debtor_bic"
+	RoleCreditorName = "creditor_name"
+	RoleCreditorIBAN = "creditor_iban"
+	RoleCreditorBIC  = "creditor_bic"
+	RoleRemittance   = "remittance_info"
+	RoleDate         = "value_date"
+	// RoleCreditDebit marks statement entries as credits or debits; without
+	// it the sign of the amount does
+	RoleCreditDebit = "credit_debit"
+)
+
+// Charge bearer codes
+const (
+	ChargeShared   = "SHAR"
+	ChargeDebtor   = "DEBT"
+	ChargeCreditor = "CRED"
+	// ChargeService follows the rules of the payment scheme, as SEPA
+	// transfers do
+	ChargeService = "SLEV"
+)
+
+// defaultMessageIDPrefix starts message identifiers when the envelope sets
+// no prefix
+const defaultMessageIDPrefix = "SYNTH"
+
+var (
+	ErrUnknownMessageType = errors.New("unknown message type")
+	ErrUnknownRole        = errors.New("unknown role")
+	ErrMissingRole        = errors.New("required role not mapped")
+	ErrInvalidColumn      = errors.New("invalid column")
+	ErrUnknownColumn      = errors.New("column not found")
+	ErrInvalidEnvelope    = errors.New("invalid envelope")
+	ErrInvalidMessage     = errors.New("message breaks its schema")
+)
+
+// schema is what a message type takes: the roles it needs and allows and
+// the longest texts its fields hold
+type schema struct {
+	required   []string
+	optional   []string
+	maxID      int
+	maxName    int
+	maxRemit   int
+	swiftChars bool
+}
+
+var schemas = map[string]schema{
+	Pain001: {
+		required: []string{RoleAmount, RoleCurrency, RoleDebtorName, RoleDebtorIBAN, RoleCreditorName, RoleCreditorIBAN},
+		optional: []string{RoleEndToEndID, RoleDebtorBIC, RoleCreditorBIC, RoleRemittance, RoleDate},
+		maxID:    35, maxName: 140, maxRemit: 140,
+	},
+	Camt053: {
+		required: []string{RoleAmount},
+		optional: []string{RoleEndToEndID, RoleCurrency, RoleDebtorName, RoleDebtorIBAN, RoleDebtorBIC, RoleCreditorName,
+			RoleCreditorIBAN, RoleCreditorBIC, RoleRemittance, RoleDate, RoleCreditDebit},
+		maxID: 35, maxName: 140, maxRemit: 140,
+	},
+	MT103: {
+		required: []string{RoleAmount, RoleCurrency, RoleDate, RoleDebtorName, RoleCreditorName, RoleCreditorIBAN},
+		optional: []string{RoleEndToEndID, RoleDebtorIBAN, RoleDebtorBIC, RoleCreditorBIC, RoleRemittance},
+		// :20: is 16x; :50K:, :59: and :70: are four lines of 35x
+		maxID: 16, maxName: 140, maxRemit: 140,
+		swiftChars: true,
+	},
+}
+
+// MessageTypes lists the message types layouts can render
+func MessageTypes() []string {
+	return []string{Pain001, Camt053, MT103}
+}
+
+var (
+	ibanPattern     = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+	bicPattern      = regexp.MustCompile(`^[A-Z0-9]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	idPrefix        = regexp.MustCompile(`^[A-Za-z0-9]{1,16}$`)
+	// swiftText is the SWIFT x character set
+	swiftText = regexp.MustCompile(`^[A-Za-z0-9/\-?:().,'+ ]*$`)
+)
+
+// minorUnits are the decimals of currencies that do not have two
+var minorUnits = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+func decimals(currency string) int {
+	if n, ok := minorUnits[currency]; ok {
+		return n
+	}
+	return 2
+}
+
+// Normalize trims a layout and fills its envelope's defaults: the SYNTH
+// message identifier prefix and the SLEV charge bearer. Codes, IBANs and
+// BICs are upper-cased and IBANs lose their spaces.
+func Normalize(l *models.FinancialMessageLayout) {
+	l.MessageType = strings.ToLower(strings.TrimSpace(l.MessageType))
+	columns := make(models.FinancialMessageColumns, len(l.Columns))
+	for role, col := range l.Columns {
+		columns[strings.ToLower(strings.TrimSpace(role))] = strings.TrimSpace(col)
+	}
+	l.Columns = columns
+	e := &l.Envelope
+	e.MessageIDPrefix = strings.TrimSpace(e.MessageIDPrefix)
+	if e.MessageIDPrefix == "" {
+		e.MessageIDPrefix = defaultMessageIDPrefix
+	}
+	e.InitiatingParty = strings.TrimSpace(e.InitiatingParty)
+	e.SenderBIC = strings.ToUpper(strings.TrimSpace(e.SenderBIC))
+	e.ReceiverBIC = strings.ToUpper(strings.TrimSpace(e.ReceiverBIC))
+	e.AccountIBAN = iban(e.AccountIBAN)
+	e.AccountCurrency = strings.ToUpper(strings.TrimSpace(e.AccountCurrency))
+	e.ChargeBearer = strings.ToUpper(strings.TrimSpace(e.ChargeBearer))
+	if e.ChargeBearer == "" {
+		e.ChargeBearer = ChargeService
+	}
+}
+
+// Validate checks a normalized layout: its message type, that it maps the
+// roles the type needs and no others, and the envelope the type needs.
+// Columns are checked against the dataset's when they are known; nil
+// columns skip the check.
+func Validate(l models.FinancialMessageLayout, columns []string) error {
+	s, ok := schemas[l.MessageType]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownMessageType, l.MessageType)
+	}
+	allowed := make(map[string]bool, len(s.required)+len(s.optional))
+	for _, role := range append(append([]string{}, s.required...), s.optional...) {
+		allowed[role] = true
+	}
+	roles := make([]string, 0, len(l.Columns))
+	for role := range l.Columns {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		col := l.Columns[role]
+		if !allowed[role] {
+			return fmt.Errorf("%w: %s is not part of %s", ErrUnknownRole, role, l.MessageType)
+		}
+		if col == "" {
+			return fmt.Errorf("%w: %s needs a column", ErrInvalidColumn, role)
+		}
+		if columns != nil && !hasColumn(columns, col) {
+			return fmt.Errorf("%w: %s", ErrUnknownColumn, strconv.Quote(col))
+		}
+	}
+	for _, role := range s.required {
+		if _, ok := l.Columns[role]; !ok {
+			return fmt.Errorf("%w: %s", ErrMissingRole, role)
+		}
+	}
+	return validateEnvelope(l.MessageType, l.Envelope)
+}
+
+func validateEnvelope(messageType string, e models.FinancialMessageEnvelope) error {
+	// Message identifiers are the prefix and a timestamp of 14 digits, and
+	// must leave room for a block number within the 35 characters allowed
+	if !idPrefix.MatchString(e.MessageIDPrefix) {
+		return fmt.Errorf("%w: message_id_prefix must be at most 16 letters and digits", ErrInvalidEnvelope)
+	}
+	switch e.ChargeBearer {
+	case ChargeService, ChargeShared, ChargeDebtor, ChargeCreditor:
+	default:
+		return fmt.Errorf("%w: charge_bearer must be SLEV, SHAR, DEBT or CRED", ErrInvalidEnvelope)
+	}
+	for name, bic := range map[string]string{"sender_bic": e.SenderBIC, "receiver_bic": e.ReceiverBIC} {
+		if bic != "" && !bicPattern.MatchString(bic) {
+			return fmt.Errorf("%w: %s is not a BIC", ErrInvalidEnvelope, name)
+		}
+	}
+	switch messageType {
+	case Pain001:
+		if e.InitiatingParty == "" || len([]rune(e.InitiatingParty)) > 140 {
+			return fmt.Errorf("%w: pain.001 needs an initiating_party of at most 140 characters", ErrInvalidEnvelope)
+		}
+	case Camt053:
+		if !validIBAN(e.AccountIBAN) {
+			return fmt.Errorf("%w: camt.053 needs the account_iban of the statement", ErrInvalidEnvelope)
+		}
+		if !currencyPattern.MatchString(e.AccountCurrency) {
+			return fmt.Errorf("%w: camt.053 needs the account_currency of the statement", ErrInvalidEnvelope)
+		}
+		if math.IsNaN(e.OpeningBalance) || math.IsInf(e.OpeningBalance, 0) {
+			return fmt.Errorf("%w: opening_balance must be a number", ErrInvalidEnvelope)
+		}
+	case MT103:
+		if e.SenderBIC == "" || e.ReceiverBIC == "" {
+			return fmt.Errorf("%w: mt103 needs a sender_bic and a receiver_bic", ErrInvalidEnvelope)
+		}
+	}
+	return nil
+}
+
+func hasColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if strings.EqualFold(c, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Layout is the layout a job renders with; nil for a nil layout
+func Layout(l *models.FinancialMessageLayout) *agents.FinancialMessageLayout {
+	if l == nil {
+		return nil
+	}
+	columns := make(map[string]string, len(l.Columns))
+	for role, col := range l.Columns {
+		columns[role] = col
+	}
+	return &agents.FinancialMessageLayout{
+		MessageType: l.MessageType,
+		Columns:     columns,
+		Envelope:    agents.FinancialMessageEnvelope(l.Envelope),
+	}
+}
+
+// Apply records the layout on the request and asks for values the message
+// schema allows
+func Apply(req *agents.GenerationRequest, l *agents.FinancialMessageLayout) {
+	if l == nil {
+		return
+	}
+	req.FinancialMessage = l
+	s := schemas[l.MessageType]
+	roles := make([]string, 0, len(l.Columns))
+	for role := range l.Columns {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	var hints []string
+	for _, role := range roles {
+		col := l.Columns[role]
+		switch role {
+		case RoleAmount:
+			if l.MessageType == Camt053 {
+				hints = append(hints, fmt.Sprintf("%s a non-zero amount", col))
+			} else {
+				hints = append(hints, fmt.Sprintf("%s a positive amount", col))
+			}
+		case RoleCurrency:
+			hints = append(hints, fmt.Sprintf("%s an ISO 4217 currency code", col))
+		case RoleDebtorIBAN, RoleCreditorIBAN:
+			hints = append(hints, fmt.Sprintf("%s an IBAN with valid check digits", col))
+		case RoleDebtorBIC, RoleCreditorBIC:
+			hints = append(hints, fmt.Sprintf("%s a BIC of 8 or 11 characters", col))
+		case RoleDate:
+			hints = append(hints, fmt.Sprintf("%s a date as YYYY-MM-DD", col))
+		case RoleCreditDebit:
+			hints = append(hints, fmt.Sprintf("%s CRDT or DBIT", col))
+		case RoleEndToEndID:
+			hints = append(hints, fmt.Sprintf("%s at most %d characters", col, s.maxID))
+		case RoleDebtorName, RoleCreditorName:
+			hints = append(hints, fmt.Sprintf("%s at most %d characters", col, s.maxName))
+		case RoleRemittance:
+			hints = append(hints, fmt.Sprintf("%s at most %d characters", col, s.maxRemit))
+		}
+	}
+	constraint := fmt.Sprintf("rows are rendered as %s payment messages, one transaction per row", l.MessageType)
+	if len(hints) > 0 {
+		constraint += "; " + strings.Join(hints, "; ")
+	}
+	if s.swiftChars {
+		constraint += "; use only letters, digits, spaces and / - ? : ( ) . , ' +"
+	}
+	req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints, constraint)
+}
+
+// transaction is one row read for a message
+type transaction struct {
+	endToEndID   string
+	amount       float64
+	currency     string
+	debtorName   string
+	debtorIBAN   string
+	debtorBIC    string
+	creditorName string
+	creditorIBAN string
+	creditorBIC  string
+	remittance   string
+	date         string
+	credit       bool
+}
+
+// read takes the transaction of a row and names the roles whose values the
+// message schema does not allow. Null optional values are left out.
+func read(row map[string]interface{}, l *agents.FinancialMessageLayout) (transaction, []string) {
+	s := schemas[l.MessageType]
+	var tx transaction
+	var violations []string
+	bad := func(role string) { violations = append(violations, role) }
+	value := func(role string) (interface{}, bool) {
+		col, ok := l.Columns[role]
+		if !ok {
+			return nil, false
+		}
+		v := row[col]
+		if str, ok := v.(string); v == nil || ok && strings.TrimSpace(str) == "" {
+			for _, r := range s.required {
+				if r == role {
+					bad(role)
+				}
+			}
+			return nil, false
+		}
+		return v, true
+	}
+	textOf := func(role string, max int) string {
+		v, ok := value(role)
+		if !ok {
+			return ""
+		}
+		t := text(v)
+		if len([]rune(t)) > max || s.swiftChars && !swiftText.MatchString(t) {
+			bad(role)
+		}
+		return t
+	}
+
+	tx.currency = l.Envelope.AccountCurrency
+	if v, ok := value(RoleCurrency); ok {
+		tx.currency = strings.ToUpper(text(v))
+		if !currencyPattern.MatchString(tx.currency) || l.MessageType == Camt053 && tx.currency != l.Envelope.AccountCurrency {
+			bad(RoleCurrency)
+		}
+	}
+	if v, ok := value(RoleAmount); ok {
+		n, ok := number(v)
+		n = round(n, decimals(tx.currency))
+		switch {
+		case !ok || !fits(n, tx.currency, s.swiftChars):
+			bad(RoleAmount)
+		case l.MessageType == Camt053:
+			tx.amount, tx.credit = math.Abs(n), n > 0
+			if n == 0 {
+				bad(RoleAmount)
+			}
+		case n <= 0:
+			bad(RoleAmount)
+		default:
+			tx.amount = n
+		}
+	}
+	if v, ok := value(RoleCreditDebit); ok {
+		switch strings.ToUpper(text(v)) {
+		case "CRDT", "CREDIT", "CR", "C":
+			tx.credit = true
+		case "DBIT", "DEBIT", "DR", "D":
+			tx.credit = false
+		default:
+			bad(RoleCreditDebit)
+		}
+	}
+	tx.endToEndID = textOf(RoleEndToEndID, s.maxID)
+	if s.swiftChars && (strings.HasPrefix(tx.endToEndID, "/") || strings.HasSuffix(tx.endToEndID, "/") || strings.Contains(tx.endToEndID, "//")) {
+		bad(RoleEndToEndID)
+	}
+	tx.debtorName = textOf(RoleDebtorName, s.maxName)
+	tx.creditorName = textOf(RoleCreditorName, s.maxName)
+	tx.remittance = textOf(RoleRemittance, s.maxRemit)
+	for _, f := range []struct {
+		role string
+		out  *string
+	}{{RoleDebtorIBAN, &tx.debtorIBAN}, {RoleCreditorIBAN, &tx.creditorIBAN}} {
+		if v, ok := value(f.role); ok {
+			if *f.out = iban(text(v)); !validIBAN(*f.out) {
+				bad(f.role)
+			}
+		}
+	}
+	for _, f := range []struct {
+		role string
+		out  *string
+	}{{RoleDebtorBIC, &tx.debtorBIC}, {RoleCreditorBIC, &tx.creditorBIC}} {
+		if v, ok := value(f.role); ok {
+			if *f.out = strings.ToUpper(text(v)); !bicPattern.MatchString(*f.out) {
+				bad(f.role)
+			}
+		}
+	}
+	if v, ok := value(RoleDate); ok {
+		d, ok := date(v)
+		if !ok {
+			bad(RoleDate)
+		}
+		tx.date = d
+	}
+	return tx, violations
+}
+
+// text renders a value as message text
+func text(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case json.Number:
+		return x.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func number(v interface{}) (float64, bool) {
+	var n float64
+	switch x := v.(type) {
+	case float64:
+		n = x
+	case int:
+		n = float64(x)
+	case int64:
+		n = float64(x)
+	case json.Number:
+		f, err := x.Float64()
+		if err != nil {
+			return 0, false
+		}
+		n = f
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		if err != nil {
+			return 0, false
+		}
+		n = f
+	default:
+		return 0, false
+	}
+	return n, !math.IsNaN(n) && !math.IsInf(n, 0)
+}
+
+func round(n float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(n*p) / p
+}
+
+// amount renders an amount with its currency's decimals
+func amount(n float64, currency string) string {
+	return strconv.FormatFloat(n, 'f', decimals(currency), 64)
+}
+
+// fits reports whether an amount fits the 18 digits of ISO 20022 amounts,
+// or the 15 characters of an MT amount with its comma
+func fits(n float64, currency string, swift bool) bool {
+	s := amount(math.Abs(n), currency)
+	if swift {
+		// MT amounts always have a decimal comma
+		return len(s) <= 15 && (strings.Contains(s, ".") || len(s) <= 14)
+	}
+	return len(strings.Replace(s, ".", "", 1)) <= 18
+}
+
+// iban strips the spaces IBANs are printed with
+func iban(s string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(s), " ", ""))
+}
+
+// validIBAN checks an IBAN's form and its ISO 7064 mod 97 check digits
+func validIBAN(s string) bool {
+	if !ibanPattern.MatchString(s) {
+		return false
+	}
+	rearranged := s[4:] + s[:4]
+	rem := 0
+	for _, r := range rearranged {
+		var digits string
+		if r >= 'A' && r <= 'Z' {
+			digits = strconv.Itoa(int(r-'A') + 10)
+		} else {
+			digits = string(r)
+		}
+		for _, d := range digits {
+			rem = (rem*10 + int(d-'0')) % 97
+		}
+	}
+	return rem == 1
+}
+
+// Timestamp layouts dates are also read from
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05"}
+
+// date reads an ISODate; timestamps keep their date
+func date(v interface{}) (string, bool) {
+	s := text(v)
+	if _, err := time.Parse("2006-01-02", s); err == nil {
+		return s, true
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02"), true
+		}
+	}
+	return "", false
+}
+
+// Checker drops generated rows whose transactions the message schema does
+// not allow. A nil *Checker keeps every row.
+type Checker struct {
+	layout       *agents.FinancialMessageLayout
+	transactions int64
+	dropped      int64
+	violations   map[string]int64
+}
+
+// NewChecker returns a checker for a layout; nil for a nil layout
+func NewChecker(l *agents.FinancialMessageLayout) *Checker {
+	if l == nil {
+		return nil
+	}
+	return &Checker{layout: l, violations: make(map[string]int64)}
+}
+
+// Filter returns the rows whose transactions are valid
+func (c *Checker) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if c == nil {
+		return rows
+	}
+	kept := rows[:0]
+	for _, row := range rows {
+		if _, violations := read(row, c.layout); len(violations) > 0 {
+			c.dropped++
+			for _, v := range violations {
+				c.violations[v]++
+			}
+			continue
+		}
+		c.transactions++
+		kept = append(kept, row)
+	}
+	return kept
+}
+
+// Report describes the transactions of the rows that were kept, before any
+// duplicates are added to them; nil for a nil checker
+func (c *Checker) Report() *models.FinancialMessageReport {
+	if c == nil {
+		return nil
+	}
+	out := &models.FinancialMessageReport{
+		MessageType:  c.layout.MessageType,
+		Transactions: c.transactions,
+		Dropped:      c.dropped,
+	}
+	if len(c.violations) > 0 {
+		out.Violations = c.violations
+	}
+	return out
+}
+
+// Encode renders rows as the layout's messages, created at now. Rows are
+// expected to have passed a Checker; one that still breaks the schema is
+// an error rather than an invalid message.
+func Encode(rows []map[string]interface{}, l *agents.FinancialMessageLayout, now time.Time) ([]byte, error) {
+	if l == nil {
+		return nil, ErrUnknownMessageType
+	}
+	txs := make([]transaction, len(rows))
+	for i, row := range rows {
+		tx, violations := read(row, l)
+		if len(violations) > 0 {
+			return nil, fmt.Errorf("%w: row %d, %s", ErrInvalidMessage, i+1, strings.Join(violations, ", "))
+		}
+		txs[i] = tx
+	}
+	now = now.UTC()
+	messageID := l.Envelope.MessageIDPrefix + now.Format("20060102150405")
+	switch l.MessageType {
+	case Pain001:
+		return pain001(txs, l.Envelope, messageID, now)
+	case Camt053:
+		return camt053(txs, l.Envelope, messageID, now)
+	case MT103:
+		return mt103(txs, l.Envelope, messageID), nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownMessageType, l.MessageType)
+}
@@ -0,0 +1,207 @@
+// Package finmsg_test provides unit tests for payment message exports
+package finmsg_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/finmsg"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var now = time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+
+func layout(messageType string) models.FinancialMessageLayout {
+	l := models.FinancialMessageLayout{
+		MessageType: messageType,
+		Columns: models.FinancialMessageColumns{
+			"Amount":        "amount",
+			"currency":      "ccy",
+			"debtor_name":   "payer",
+			"debtor_iban":   "payer_iban",
+			"creditor_name": "payee",
+			"creditor_iban": "payee_iban",
+			"value_date":    "date",
+			"end_to_end_id": "ref",
+		},
+		Envelope: models.FinancialMessageEnvelope{
+			InitiatingParty: "Acme Ltd",
+			SenderBIC:       "deutdeff",
+			ReceiverBIC:     "NWBKGB2LXXX",
+			AccountIBAN:     "DE89 3704 0044 0532 0130 00",
+			AccountCurrency: "eur",
+		},
+	}
+	finmsg.Normalize(&l)
+	return l
+}
+
+func row() map[string]interface{} {
+	return map[string]interface{}{
+		"amount": 1234.567, "ccy": "EUR", "payer": "Acme Ltd", "payer_iban": "DE89370400440532013000",
+		"payee": "Jane Doe", "payee_iban": "GB82 WEST 1234 5698 7654 32", "date": "2024-03-04", "ref": "INV-1",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	l := layout(finmsg.Pain001)
+	assert.Equal(t, "SYNTH", l.Envelope.MessageIDPrefix)
+	assert.Equal(t, finmsg.ChargeService, l.Envelope.ChargeBearer)
+	assert.Equal(t, "DE89370400440532013000", l.Envelope.AccountIBAN)
+	assert.NoError(t, finmsg.Validate(l, nil))
+	assert.ErrorIs(t, finmsg.Validate(l, []string{"amount"}), finmsg.ErrUnknownColumn)
+
+	unknown := layout("pacs.008")
+	assert.ErrorIs(t, finmsg.Validate(unknown, nil), finmsg.ErrUnknownMessageType)
+
+	missing := layout(finmsg.Pain001)
+	delete(missing.Columns, finmsg.RoleCreditorIBAN)
+	assert.ErrorIs(t, finmsg.Validate(missing, nil), finmsg.ErrMissingRole)
+
+	foreign := layout(finmsg.Pain001)
+	foreign.Columns[finmsg.RoleCreditDebit] = "direction"
+	assert.ErrorIs(t, finmsg.Validate(foreign, nil), finmsg.ErrUnknownRole)
+
+	party := layout(finmsg.Pain001)
+	party.Envelope.InitiatingParty = ""
+	assert.ErrorIs(t, finmsg.Validate(party, nil), finmsg.ErrInvalidEnvelope)
+
+	account := layout(finmsg.Camt053)
+	account.Envelope.AccountIBAN = "DE00370400440532013000"
+	assert.ErrorIs(t, finmsg.Validate(account, nil), finmsg.ErrInvalidEnvelope, "check digits are verified")
+}
+
+func TestChecker(t *testing.T) {
+	l := layout(finmsg.MT103)
+	c := finmsg.NewChecker(finmsg.Layout(&l))
+	badIBAN := row()
+	badIBAN["payee_iban"] = "GB00WEST12345698765432"
+	negative := row()
+	negative["amount"] = -5.0
+	longRef := row()
+	longRef["ref"] = "REFERENCE-LONGER-THAN-16"
+	accented := row()
+	accented["payee"] = "José Müller"
+	rows := c.Filter([]map[string]interface{}{row(), badIBAN, negative, longRef, accented})
+	require.Len(t, rows, 1)
+
+	report := c.Report()
+	assert.Equal(t, finmsg.MT103, report.MessageType)
+	assert.Equal(t, int64(1), report.Transactions)
+	assert.Equal(t, int64(4), report.Dropped)
+	assert.Equal(t, map[string]int64{"creditor_iban": 1, "amount": 1, "end_to_end_id": 1, "creditor_name": 1}, report.Violations)
+
+	assert.Nil(t, finmsg.NewChecker(nil).Report())
+}
+
+func TestEncodePain001(t *testing.T) {
+	l := layout(finmsg.Pain001)
+	second := row()
+	second["amount"] = 10.0
+	second["ref"] = nil
+	out, err := finmsg.Encode([]map[string]interface{}{row(), second}, finmsg.Layout(&l), now)
+	require.NoError(t, err)
+
+	var doc struct {
+		XMLName xml.Name
+		GrpHdr  struct {
+			MsgId   string
+			NbOfTxs int
+			CtrlSum string
+		} `xml:"CstmrCdtTrfInitn>GrpHdr"`
+		PmtInf []struct {
+			NbOfTxs     int
+			Dt          string `xml:"ReqdExctnDt>Dt"`
+			ChrgBr      string
+			CdtTrfTxInf []struct {
+				EndToEndId string `xml:"PmtId>EndToEndId"`
+				InstdAmt   struct {
+					Ccy   string `xml:"Ccy,attr"`
+					Value string `xml:",chardata"`
+				} `xml:"Amt>InstdAmt"`
+				IBAN string `xml:"CdtrAcct>Id>IBAN"`
+			}
+		} `xml:"CstmrCdtTrfInitn>PmtInf"`
+	}
+	require.NoError(t, xml.Unmarshal(out, &doc))
+	assert.Equal(t, "urn:iso:std:iso:20022:tech:xsd:pain.001.001.09", doc.XMLName.Space)
+	assert.Equal(t, "SYNTH20240301093000", doc.GrpHdr.MsgId)
+	assert.Equal(t, 2, doc.GrpHdr.NbOfTxs)
+	assert.Equal(t, "1244.57", doc.GrpHdr.CtrlSum)
+	require.Len(t, doc.PmtInf, 1, "one debtor account and date")
+	assert.Equal(t, "2024-03-04", doc.PmtInf[0].Dt)
+	assert.Equal(t, "SLEV", doc.PmtInf[0].ChrgBr)
+	require.Len(t, doc.PmtInf[0].CdtTrfTxInf, 2)
+	tx := doc.PmtInf[0].CdtTrfTxInf[0]
+	assert.Equal(t, "INV-1", tx.EndToEndId)
+	assert.Equal(t, "EUR", tx.InstdAmt.Ccy)
+	assert.Equal(t, "1234.57", tx.InstdAmt.Value)
+	assert.Equal(t, "GB82WEST12345698765432", tx.IBAN)
+	assert.Equal(t, "NOTPROVIDED", doc.PmtInf[0].CdtTrfTxInf[1].EndToEndId)
+}
+
+func TestEncodeCamt053(t *testing.T) {
+	l := layout(finmsg.Camt053)
+	l.Columns = models.FinancialMessageColumns{"amount": "amount", "value_date": "date"}
+	l.Envelope.OpeningBalance = 100
+	out, err := finmsg.Encode([]map[string]interface{}{
+		{"amount": 50.0, "date": "2024-03-01"},
+		{"amount": -200.0, "date": "2024-03-02"},
+	}, finmsg.Layout(&l), now)
+	require.NoError(t, err)
+
+	var doc struct {
+		Bal []struct {
+			Cd        string `xml:"Tp>CdOrPrtry>Cd"`
+			Amt       string
+			CdtDbtInd string
+		} `xml:"BkToCstmrStmt>Stmt>Bal"`
+		Ntry []struct {
+			CdtDbtInd string
+			BookgDt   string `xml:"BookgDt>Dt"`
+		} `xml:"BkToCstmrStmt>Stmt>Ntry"`
+	}
+	require.NoError(t, xml.Unmarshal(out, &doc))
+	require.Len(t, doc.Bal, 2)
+	assert.Equal(t, "OPBD", doc.Bal[0].Cd)
+	assert.Equal(t, "CLBD", doc.Bal[1].Cd)
+	assert.Equal(t, "50.00", doc.Bal[1].Amt)
+	assert.Equal(t, "DBIT", doc.Bal[1].CdtDbtInd)
+	require.Len(t, doc.Ntry, 2)
+	assert.Equal(t, "CRDT", doc.Ntry[0].CdtDbtInd)
+	assert.Equal(t, "DBIT", doc.Ntry[1].CdtDbtInd)
+	assert.Equal(t, "2024-03-02", doc.Ntry[1].BookgDt)
+}
+
+func TestEncodeMT103(t *testing.T) {
+	l := layout(finmsg.MT103)
+	l.Envelope.ChargeBearer = finmsg.ChargeDebtor
+	out, err := finmsg.Encode([]map[string]interface{}{row()}, finmsg.Layout(&l), now)
+	require.NoError(t, err)
+	msg := string(out)
+	assert.True(t, strings.HasPrefix(msg, "{1:F01DEUTDEFFAXXX0000000000}{2:I103NWBKGB2LAXXXN}{4:\r\n"))
+	assert.Contains(t, msg, ":20:INV-1\r\n")
+	assert.Contains(t, msg, ":32A:240304EUR1234,57\r\n")
+	assert.Contains(t, msg, ":50K:/DE89370400440532013000\r\nAcme Ltd\r\n")
+	assert.Contains(t, msg, ":59:/GB82WEST12345698765432\r\nJane Doe\r\n")
+	assert.Contains(t, msg, ":71A:OUR\r\n-}")
+
+	_, err = finmsg.Encode([]map[string]interface{}{{"amount": "lots"}}, finmsg.Layout(&l), now)
+	assert.ErrorIs(t, err, finmsg.ErrInvalidMessage)
+}
+
+func TestApply(t *testing.T) {
+	l := layout(finmsg.MT103)
+	req := &agents.GenerationRequest{}
+	finmsg.Apply(req, finmsg.Layout(&l))
+	require.NotNil(t, req.FinancialMessage)
+	require.Len(t, req.SchemaAnalysis.Constraints, 1)
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "mt103")
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "payee_iban an IBAN with valid check digits")
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "ref at most 16 characters")
+}
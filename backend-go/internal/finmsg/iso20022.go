@@ -0,0 +1,282 @@
+package finmsg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+)
+
+// node is an element of an ISO 20022 document. Elements are written in the
+// order they are added, which is the order the message schemas require.
+type node struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []*node
+}
+
+func el(name string, children ...*node) *node {
+	out := &node{name: name}
+	for _, c := range children {
+		if c != nil {
+			out.children = append(out.children, c)
+		}
+	}
+	return out
+}
+
+func leaf(name, text string) *node { return &node{name: name, text: text} }
+
+// optional is a leaf only when it has text
+func optional(name, text string) *node {
+	if text == "" {
+		return nil
+	}
+	return leaf(name, text)
+}
+
+func (n *node) attr(name, value string) *node {
+	n.attrs = append(n.attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+	return n
+}
+
+func (n *node) encode(e *xml.Encoder) error {
+	start := xml.StartElement{Name: xml.Name{Local: n.name}, Attr: n.attrs}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	if n.text != "" {
+		if err := e.EncodeToken(xml.CharData(n.text)); err != nil {
+			return err
+		}
+	}
+	for _, c := range n.children {
+		if err := c.encode(e); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// document writes a message in its schema's namespace
+func document(messageType string, body *node) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	e := xml.NewEncoder(&buf)
+	e.Indent("", "  ")
+	doc := el("Document", body).attr("xmlns", "urn:iso:std:iso:20022:tech:xsd:"+messageType)
+	if err := doc.encode(e); err != nil {
+		return nil, err
+	}
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func amt(name string, n float64, currency string) *node {
+	return leaf(name, amount(n, currency)).attr("Ccy", currency)
+}
+
+// agent identifies a bank by BIC, or as not provided when the BIC is
+// unknown
+func agent(name, bic string) *node {
+	if bic == "" {
+		return el(name, el("FinInstnId", el("Othr", leaf("Id", "NOTPROVIDED"))))
+	}
+	return el(name, el("FinInstnId", leaf("BICFI", bic)))
+}
+
+func account(name, iban string) *node {
+	if iban == "" {
+		return nil
+	}
+	return el(name, el("Id", leaf("IBAN", iban)))
+}
+
+func endToEndID(tx transaction) string {
+	if tx.endToEndID == "" {
+		return "NOTPROVIDED"
+	}
+	return tx.endToEndID
+}
+
+func remittance(tx transaction) *node {
+	if tx.remittance == "" {
+		return nil
+	}
+	return el("RmtInf", leaf("Ustrd", tx.remittance))
+}
+
+// sum totals amounts to the most decimals any currency has
+func sum(txs []transaction) string {
+	total := 0.0
+	for _, tx := range txs {
+		total += tx.amount
+	}
+	return strconv.FormatFloat(round(total, 3), 'f', -1, 64)
+}
+
+// pain001 renders a customer credit transfer initiation. Transfers from
+// the same debtor account on the same date share a payment information
+// block, in the order they were generated.
+func pain001(txs []transaction, env agents.FinancialMessageEnvelope, messageID string, now time.Time) ([]byte, error) {
+	today := now.Format("2006-01-02")
+	type block struct {
+		key string
+		txs []transaction
+	}
+	var blocks []*block
+	index := make(map[string]*block)
+	for _, tx := range txs {
+		if tx.date == "" {
+			tx.date = today
+		}
+		key := tx.debtorName + "|" + tx.debtorIBAN + "|" + tx.debtorBIC + "|" + tx.date
+		b, ok := index[key]
+		if !ok {
+			b = &block{key: key}
+			index[key] = b
+			blocks = append(blocks, b)
+		}
+		b.txs = append(b.txs, tx)
+	}
+
+	initn := el("CstmrCdtTrfInitn", el("GrpHdr",
+		leaf("MsgId", messageID),
+		leaf("CreDtTm", now.Format(time.RFC3339)),
+		leaf("NbOfTxs", strconv.Itoa(len(txs))),
+		leaf("CtrlSum", sum(txs)),
+		el("InitgPty", leaf("Nm", env.InitiatingParty)),
+	))
+	for i, b := range blocks {
+		first := b.txs[0]
+		info := el("PmtInf",
+			leaf("PmtInfId", fmt.Sprintf("%s-%d", messageID, i+1)),
+			leaf("PmtMtd", "TRF"),
+			leaf("NbOfTxs", strconv.Itoa(len(b.txs))),
+			leaf("CtrlSum", sum(b.txs)),
+			el("ReqdExctnDt", leaf("Dt", first.date)),
+			el("Dbtr", leaf("Nm", first.debtorName)),
+			account("DbtrAcct", first.debtorIBAN),
+			agent("DbtrAgt", first.debtorBIC),
+			leaf("ChrgBr", env.ChargeBearer),
+		)
+		for _, tx := range b.txs {
+			var cdtrAgt *node
+			if tx.creditorBIC != "" {
+				cdtrAgt = agent("CdtrAgt", tx.creditorBIC)
+			}
+			info.children = append(info.children, el("CdtTrfTxInf",
+				el("PmtId", leaf("EndToEndId", endToEndID(tx))),
+				el("Amt", amt("InstdAmt", tx.amount, tx.currency)),
+				cdtrAgt,
+				el("Cdtr", leaf("Nm", tx.creditorName)),
+				account("CdtrAcct", tx.creditorIBAN),
+				remittance(tx),
+			))
+		}
+		initn.children = append(initn.children, info)
+	}
+	return document(Pain001, initn)
+}
+
+// camt053 renders a statement of the envelope's account with one booked
+// entry per transaction. The closing balance is the opening balance with
+// every entry applied.
+func camt053(txs []transaction, env agents.FinancialMessageEnvelope, messageID string, now time.Time) ([]byte, error) {
+	today := now.Format("2006-01-02")
+	ccy := env.AccountCurrency
+	balance := func(code string, n float64) *node {
+		indicator := "CRDT"
+		if n < 0 {
+			indicator = "DBIT"
+		}
+		if n < 0 {
+			n = -n
+		}
+		return el("Bal",
+			el("Tp", el("CdOrPrtry", leaf("Cd", code))),
+			amt("Amt", n, ccy),
+			leaf("CdtDbtInd", indicator),
+			el("Dt", leaf("Dt", today)),
+		)
+	}
+
+	closing := env.OpeningBalance
+	var entries []*node
+	for _, tx := range txs {
+		indicator := "DBIT"
+		if tx.credit {
+			indicator = "CRDT"
+			closing += tx.amount
+		} else {
+			closing -= tx.amount
+		}
+		if tx.date == "" {
+			tx.date = today
+		}
+		var parties *node
+		if tx.debtorName != "" || tx.debtorIBAN != "" || tx.creditorName != "" || tx.creditorIBAN != "" {
+			parties = el("RltdPties",
+				party("Dbtr", tx.debtorName),
+				account("DbtrAcct", tx.debtorIBAN),
+				party("Cdtr", tx.creditorName),
+				account("CdtrAcct", tx.creditorIBAN),
+			)
+		}
+		var agents *node
+		if tx.debtorBIC != "" || tx.creditorBIC != "" {
+			agents = el("RltdAgts", bicAgent("DbtrAgt", tx.debtorBIC), bicAgent("CdtrAgt", tx.creditorBIC))
+		}
+		entries = append(entries, el("Ntry",
+			optional("NtryRef", tx.endToEndID),
+			amt("Amt", tx.amount, ccy),
+			leaf("CdtDbtInd", indicator),
+			el("Sts", leaf("Cd", "BOOK")),
+			el("BookgDt", leaf("Dt", tx.date)),
+			el("ValDt", leaf("Dt", tx.date)),
+			el("BkTxCd"),
+			el("NtryDtls", el("TxDtls",
+				el("Refs", leaf("EndToEndId", endToEndID(tx))),
+				amt("Amt", tx.amount, ccy),
+				leaf("CdtDbtInd", indicator),
+				parties,
+				agents,
+				remittance(tx),
+			)),
+		))
+	}
+
+	stmt := el("Stmt",
+		leaf("Id", messageID+"-1"),
+		leaf("CreDtTm", now.Format(time.RFC3339)),
+		el("Acct", el("Id", leaf("IBAN", env.AccountIBAN)), leaf("Ccy", ccy)),
+		balance("OPBD", env.OpeningBalance),
+		balance("CLBD", round(closing, decimals(ccy))),
+	)
+	stmt.children = append(stmt.children, entries...)
+	return document(Camt053, el("BkToCstmrStmt",
+		el("GrpHdr", leaf("MsgId", messageID), leaf("CreDtTm", now.Format(time.RFC3339))),
+		stmt,
+	))
+}
+
+func party(name, partyName string) *node {
+	if partyName == "" {
+		return nil
+	}
+	return el(name, el("Pty", leaf("Nm", partyName)))
+}
+
+func bicAgent(name, bic string) *node {
+	if bic == "" {
+		return nil
+	}
+	return agent(name, bic)
+}
@@ -0,0 +1,87 @@
+package finmsg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+)
+
+// swiftCharges are the MT codes of ISO 20022 charge bearers
+var swiftCharges = map[string]string{
+	ChargeService:  "SHA",
+	ChargeShared:   "SHA",
+	ChargeDebtor:   "OUR",
+	ChargeCreditor: "BEN",
+}
+
+// logicalTerminal is the 12 character address of a BIC: its bank, country
+// and location codes, terminal A and its branch, XXX for the head office
+func logicalTerminal(bic string) string {
+	branch := "XXX"
+	if len(bic) == 11 {
+		branch = bic[8:]
+	}
+	return bic[:8] + "A" + branch
+}
+
+// lines splits text into lines of at most 35 characters, at most four
+func lines(s string) []string {
+	var out []string
+	r := []rune(s)
+	for len(r) > 0 && len(out) < 4 {
+		n := min(35, len(r))
+		out = append(out, string(r[:n]))
+		r = r[n:]
+	}
+	return out
+}
+
+// mt103 renders each transaction as a SWIFT MT103, one message to a line.
+// Transactions without a reference take the message identifier and their
+// number.
+func mt103(txs []transaction, env agents.FinancialMessageEnvelope, messageID string) []byte {
+	var out strings.Builder
+	for i, tx := range txs {
+		ref := tx.endToEndID
+		if ref == "" {
+			ref = fmt.Sprintf("%d", i+1)
+			if keep := 16 - len(ref); keep < len(messageID) {
+				ref = messageID[len(messageID)-keep:] + ref
+			} else {
+				ref = messageID + ref
+			}
+		}
+		valueDate, _ := time.Parse("2006-01-02", tx.date)
+
+		fields := []string{
+			":20:" + ref,
+			":23B:CRED",
+			":32A:" + valueDate.Format("060102") + tx.currency + strings.Replace(amount(tx.amount, tx.currency), ".", ",", 1),
+		}
+		if !strings.Contains(fields[2], ",") {
+			fields[2] += ","
+		}
+		ordering := ":50K:"
+		if tx.debtorIBAN != "" {
+			ordering += "/" + tx.debtorIBAN + "\r\n"
+		}
+		fields = append(fields, ordering+strings.Join(lines(tx.debtorName), "\r\n"))
+		if tx.debtorBIC != "" {
+			fields = append(fields, ":52A:"+tx.debtorBIC)
+		}
+		if tx.creditorBIC != "" {
+			fields = append(fields, ":57A:"+tx.creditorBIC)
+		}
+		fields = append(fields, ":59:/"+tx.creditorIBAN+"\r\n"+strings.Join(lines(tx.creditorName), "\r\n"))
+		if tx.remittance != "" {
+			fields = append(fields, ":70:"+strings.Join(lines(tx.remittance), "\r\n"))
+		}
+		fields = append(fields, ":71A:"+swiftCharges[env.ChargeBearer])
+
+		fmt.Fprintf(&out, "{1:F01%s0000000000}{2:I103%sN}{4:\r\n%s\r\n-}\r\n",
+			logicalTerminal(env.SenderBIC), logicalTerminal(env.ReceiverBIC), strings.Join(fields, "\r\n"))
+	}
+	return []byte(out.String())
+}
@@ -0,0 +1,473 @@
+// Package fixedwidth exports generated rows as fixed-width flat files for
+// banking and mainframe systems: every column in a field of set width,
+// padded and aligned as the layout says, in ASCII, Latin-1, UTF-8 or an
+// EBCDIC code page. Values that do not fit their field are caught while
+// rows are generated, so the file written never breaks its layout.
+package fixedwidth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Format is the export format name of fixed-width output
+const Format = "fixed_width"
+
+// Character encodings of a layout
+const (
+	EncodingASCII     = "ascii"
+	EncodingLatin1    = "latin1"
+	EncodingUTF8      = "utf8"
+	EncodingEBCDIC037 = "ebcdic_037"
+	// EncodingEBCDIC1047 is the Latin-1 code page of z/OS Unix services
+	EncodingEBCDIC1047 = "ebcdic_1047"
+	// EncodingEBCDIC1140 is code page 037 with the euro sign
+	EncodingEBCDIC1140 = "ebcdic_1140"
+)
+
+const (
+	AlignLeft  = "left"
+	AlignRight = "right"
+
+	TerminatorLF   = "lf"
+	TerminatorCRLF = "crlf"
+	TerminatorNone = "none"
+
+	// OverflowReject drops rows with a value too wide for its field
+	OverflowReject = "reject"
+	// OverflowTruncate cuts text to its field; numbers are never cut, so
+	// rows with a number too wide are still dropped
+	OverflowTruncate = "truncate"
+)
+
+const (
+	// MaxFields caps the fields of a layout
+	MaxFields = 500
+	// MaxWidth caps the width of one field
+	MaxWidth = 4096
+	// MaxDecimals caps the digits after the point of a numeric field
+	MaxDecimals = 18
+	// substitute replaces characters the encoding cannot write when
+	// values are truncated
+	substitute = '?'
+)
+
+var (
+	ErrNoFields          = errors.New("layout has no fields")
+	ErrTooManyFields     = errors.New("layout has too many fields")
+	ErrInvalidField      = errors.New("invalid field")
+	ErrDuplicateField    = errors.New("column has more than one field")
+	ErrUnknownColumn     = errors.New("column not found")
+	ErrUnknownEncoding   = errors.New("unknown encoding")
+	ErrUnknownTerminator = errors.New("unknown record terminator")
+	ErrUnknownOverflow   = errors.New("unknown overflow policy")
+	ErrValueTooWide      = errors.New("value too wide for its field")
+	ErrNotEncodable      = errors.New("value not representable in the encoding")
+)
+
+// codec measures and writes text in one encoding
+type codec struct {
+	name string
+	cm   *charmap.Charmap
+}
+
+func codecFor(encoding string) (codec, bool) {
+	switch encoding {
+	case EncodingASCII, EncodingUTF8:
+		return codec{name: encoding}, true
+	case EncodingLatin1:
+		return codec{name: encoding, cm: charmap.ISO8859_1}, true
+	case EncodingEBCDIC037:
+		return codec{name: encoding, cm: charmap.CodePage037}, true
+	case EncodingEBCDIC1047:
+		return codec{name: encoding, cm: charmap.CodePage1047}, true
+	case EncodingEBCDIC1140:
+		return codec{name: encoding, cm: charmap.CodePage1140}, true
+	}
+	return codec{}, false
+}
+
+// encodes reports whether r can be written in a value. Control characters
+// never can, since they would break the record.
+func (c codec) encodes(r rune) bool {
+	if unicode.IsControl(r) || r == utf8.RuneError {
+		return false
+	}
+	switch {
+	case c.name == EncodingASCII:
+		return r < utf8.RuneSelf
+	case c.cm != nil:
+		_, ok := c.cm.EncodeRune(r)
+		return ok
+	}
+	return true
+}
+
+// width is the bytes s takes: one per character in the single-byte
+// encodings
+func (c codec) width(s string) int {
+	if c.name == EncodingUTF8 {
+		return len(s)
+	}
+	return utf8.RuneCountInString(s)
+}
+
+func (c codec) appendText(out []byte, s string) []byte {
+	if c.cm == nil {
+		return append(out, s...)
+	}
+	for _, r := range s {
+		b, _ := c.cm.EncodeRune(r)
+		out = append(out, b)
+	}
+	return out
+}
+
+// Normalize fills a layout's unset options with their defaults: ASCII
+// records ending in a line feed, rows with overflowing values rejected, and
+// fields left aligned and padded with spaces
+func Normalize(l *models.FixedWidthLayout) {
+	l.Encoding = strings.ToLower(strings.TrimSpace(l.Encoding))
+	if l.Encoding == "" {
+		l.Encoding = EncodingASCII
+	}
+	l.RecordTerminator = strings.ToLower(strings.TrimSpace(l.RecordTerminator))
+	if l.RecordTerminator == "" {
+		l.RecordTerminator = TerminatorLF
+	}
+	l.Overflow = strings.ToLower(strings.TrimSpace(l.Overflow))
+	if l.Overflow == "" {
+		l.Overflow = OverflowReject
+	}
+	for i := range l.Fields {
+		f := &l.Fields[i]
+		f.Column = strings.TrimSpace(f.Column)
+		f.Align = strings.ToLower(strings.TrimSpace(f.Align))
+		if f.Align == "" {
+			f.Align = AlignLeft
+		}
+		if f.Pad == "" {
+			f.Pad = " "
+		}
+	}
+}
+
+// Validate checks a normalized layout. Columns are checked against the
+// dataset's when they are known; nil columns skip the check.
+func Validate(l models.FixedWidthLayout, columns []string) error {
+	c, ok := codecFor(l.Encoding)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownEncoding, l.Encoding)
+	}
+	switch l.RecordTerminator {
+	case TerminatorLF, TerminatorCRLF, TerminatorNone:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownTerminator, l.RecordTerminator)
+	}
+	switch l.Overflow {
+	case OverflowReject, OverflowTruncate:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownOverflow, l.Overflow)
+	}
+	if len(l.Fields) == 0 {
+		return ErrNoFields
+	}
+	if len(l.Fields) > MaxFields {
+		return fmt.Errorf("%w: at most %d", ErrTooManyFields, MaxFields)
+	}
+	seen := make(map[string]struct{}, len(l.Fields))
+	for _, f := range l.Fields {
+		if f.Column == "" {
+			return fmt.Errorf("%w: column is required", ErrInvalidField)
+		}
+		key := strings.ToLower(f.Column)
+		if _, ok := seen[key]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateField, f.Column)
+		}
+		seen[key] = struct{}{}
+		if f.Width < 1 || f.Width > MaxWidth {
+			return fmt.Errorf("%w: %s width must be between 1 and %d", ErrInvalidField, f.Column, MaxWidth)
+		}
+		if f.Align != AlignLeft && f.Align != AlignRight {
+			return fmt.Errorf("%w: %s align must be left or right", ErrInvalidField, f.Column)
+		}
+		pad, size := utf8.DecodeRuneInString(f.Pad)
+		if size != len(f.Pad) || !c.encodes(pad) || c.width(f.Pad) != 1 {
+			return fmt.Errorf("%w: %s pad must be one character of %s", ErrInvalidField, f.Column, l.Encoding)
+		}
+		if f.Decimals != nil && (*f.Decimals < 0 || *f.Decimals > MaxDecimals) {
+			return fmt.Errorf("%w: %s decimals must be between 0 and %d", ErrInvalidField, f.Column, MaxDecimals)
+		}
+		if columns != nil && !hasColumn(columns, f.Column) {
+			return fmt.Errorf("%w: %s", ErrUnknownColumn, strconv.Quote(f.Column))
+		}
+	}
+	return nil
+}
+
+func hasColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if strings.EqualFold(c, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Layout is the layout a job exports with; nil for a nil layout
+func Layout(l *models.FixedWidthLayout) *agents.FixedWidthLayout {
+	if l == nil {
+		return nil
+	}
+	out := &agents.FixedWidthLayout{
+		Fields:           make([]agents.FixedWidthField, len(l.Fields)),
+		Encoding:         l.Encoding,
+		RecordTerminator: l.RecordTerminator,
+		Overflow:         l.Overflow,
+	}
+	for i, f := range l.Fields {
+		out.Fields[i] = agents.FixedWidthField(f)
+	}
+	return out
+}
+
+// RecordLength is the bytes of one record before its terminator
+func RecordLength(l *agents.FixedWidthLayout) int {
+	n := 0
+	for _, f := range l.Fields {
+		n += f.Width
+	}
+	return n
+}
+
+// Apply records the layout on the request and asks for values that fit it
+func Apply(req *agents.GenerationRequest, l *agents.FixedWidthLayout) {
+	if l == nil {
+		return
+	}
+	req.FixedWidth = l
+	widths := make([]string, len(l.Fields))
+	for i, f := range l.Fields {
+		if f.Decimals != nil {
+			widths[i] = fmt.Sprintf("%s %d (%d decimals)", f.Column, f.Width, *f.Decimals)
+		} else {
+			widths[i] = fmt.Sprintf("%s %d", f.Column, f.Width)
+		}
+	}
+	constraint := "values are written to fixed-width fields and must fit their width in characters: " + strings.Join(widths, ", ")
+	switch l.Encoding {
+	case EncodingUTF8:
+	case EncodingASCII:
+		constraint += "; use ASCII characters only"
+	default:
+		constraint += fmt.Sprintf("; use only characters of %s", l.Encoding)
+	}
+	req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints, constraint)
+}
+
+// text renders a value for a field
+func text(v interface{}, f agents.FixedWidthField) (s string, numeric bool) {
+	switch x := v.(type) {
+	case nil:
+		return "", false
+	case string:
+		return x, false
+	case float64:
+		if f.Decimals != nil {
+			return strconv.FormatFloat(x, 'f', *f.Decimals, 64), true
+		}
+		return strconv.FormatFloat(x, 'f', -1, 64), true
+	case int:
+		return text(float64(x), f)
+	case int64:
+		if f.Decimals != nil {
+			return text(float64(x), f)
+		}
+		return strconv.FormatInt(x, 10), true
+	case json.Number:
+		if n, err := x.Float64(); err == nil {
+			return text(n, f)
+		}
+		return x.String(), false
+	case bool:
+		return strconv.FormatBool(x), false
+	case map[string]interface{}, []interface{}:
+		raw, _ := json.Marshal(x)
+		return string(raw), false
+	}
+	return fmt.Sprint(v), false
+}
+
+// pad fills a value out to its field. Zero-padded numbers keep their sign
+// in front.
+func pad(s string, f agents.FixedWidthField, c codec) string {
+	n := f.Width - c.width(s)
+	if n <= 0 {
+		return s
+	}
+	fill := strings.Repeat(f.Pad, n)
+	if f.Align == AlignLeft {
+		return s + fill
+	}
+	if f.Pad == "0" && s != "" && (s[0] == '-' || s[0] == '+') {
+		return s[:1] + fill + s[1:]
+	}
+	return fill + s
+}
+
+// Checker catches generated values that do not fit a layout, dropping
+// their rows or truncating them as the layout says. A nil *Checker keeps
+// every row.
+type Checker struct {
+	layout      *agents.FixedWidthLayout
+	codec       codec
+	dropped     int64
+	truncated   int64
+	substituted int64
+	overflows   map[string]int64
+}
+
+// NewChecker returns a checker for a layout; nil for a nil layout
+func NewChecker(l *agents.FixedWidthLayout) *Checker {
+	if l == nil {
+		return nil
+	}
+	c, _ := codecFor(l.Encoding)
+	return &Checker{layout: l, codec: c, overflows: make(map[string]int64)}
+}
+
+// Filter returns the rows that fit the layout, with text truncated in
+// place when the layout allows it
+func (c *Checker) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if c == nil {
+		return rows
+	}
+	kept := rows[:0]
+	for _, row := range rows {
+		if c.fit(row) {
+			kept = append(kept, row)
+		} else {
+			c.dropped++
+		}
+	}
+	return kept
+}
+
+func (c *Checker) fit(row map[string]interface{}) bool {
+	truncate := c.layout.Overflow == OverflowTruncate
+	type change struct {
+		column string
+		value  string
+	}
+	var changes []change
+	for _, f := range c.layout.Fields {
+		s, numeric := text(row[f.Column], f)
+		fixed := s
+		if strings.IndexFunc(s, func(r rune) bool { return !c.codec.encodes(r) }) >= 0 {
+			if !truncate || numeric {
+				return false
+			}
+			fixed = strings.Map(func(r rune) rune {
+				if c.codec.encodes(r) {
+					return r
+				}
+				return substitute
+			}, fixed)
+			c.substituted++
+		}
+		if c.codec.width(fixed) > f.Width {
+			c.overflows[f.Column]++
+			if !truncate || numeric {
+				return false
+			}
+			fixed = cut(fixed, f.Width, c.codec)
+			c.truncated++
+		}
+		if fixed != s {
+			changes = append(changes, change{f.Column, fixed})
+		}
+	}
+	for _, ch := range changes {
+		row[ch.column] = ch.value
+	}
+	return true
+}
+
+// cut shortens s to width without splitting a character
+func cut(s string, width int, c codec) string {
+	n := 0
+	for i, r := range s {
+		w := 1
+		if c.name == EncodingUTF8 {
+			w = utf8.RuneLen(r)
+		}
+		if n+w > width {
+			return s[:i]
+		}
+		n += w
+	}
+	return s
+}
+
+// Report describes what the layout did to the rows; nil for a nil checker
+func (c *Checker) Report() *models.FixedWidthReport {
+	if c == nil {
+		return nil
+	}
+	out := &models.FixedWidthReport{
+		Encoding:     c.layout.Encoding,
+		RecordLength: RecordLength(c.layout),
+		Overflow:     c.layout.Overflow,
+		Dropped:      c.dropped,
+		Truncated:    c.truncated,
+		Substituted:  c.substituted,
+	}
+	if len(c.overflows) > 0 {
+		out.Overflows = c.overflows
+	}
+	return out
+}
+
+// Encode writes rows as fixed-width records. Rows are expected to have
+// passed a Checker; a value that still does not fit is an error rather than
+// a broken record.
+func Encode(rows []map[string]interface{}, l *agents.FixedWidthLayout) ([]byte, error) {
+	if l == nil {
+		return nil, ErrNoFields
+	}
+	c, ok := codecFor(l.Encoding)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownEncoding, l.Encoding)
+	}
+	var terminator string
+	switch l.RecordTerminator {
+	case TerminatorLF:
+		terminator = "\n"
+	case TerminatorCRLF:
+		terminator = "\r\n"
+	}
+	out := make([]byte, 0, len(rows)*(RecordLength(l)+len(terminator)))
+	for i, row := range rows {
+		for _, f := range l.Fields {
+			s, _ := text(row[f.Column], f)
+			if strings.IndexFunc(s, func(r rune) bool { return !c.encodes(r) }) >= 0 {
+				return nil, fmt.Errorf("%w: row %d, %s", ErrNotEncodable, i+1, f.Column)
+			}
+			if c.width(s) > f.Width {
+				return nil, fmt.Errorf("%w: row %d, %s", ErrValueTooWide, i+1, f.Column)
+			}
+			out = c.appendText(out, pad(s, f, c))
+		}
+		out = c.appendText(out, terminator)
+	}
+	return out, nil
+}
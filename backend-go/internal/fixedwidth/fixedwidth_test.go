@@ -0,0 +1,128 @@
+// Package fixedwidth_test provides unit tests for fixed-width exports
+package fixedwidth_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fixedwidth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func layout(encoding, overflow string) models.FixedWidthLayout {
+	two := 2
+	l := models.FixedWidthLayout{
+		Fields: models.FixedWidthFields{
+			{Column: "name", Width: 6},
+			{Column: "amount", Width: 8, Align: fixedwidth.AlignRight, Pad: "0", Decimals: &two},
+		},
+		Encoding: encoding,
+		Overflow: overflow,
+	}
+	fixedwidth.Normalize(&l)
+	return l
+}
+
+func TestValidate(t *testing.T) {
+	l := layout("", "")
+	assert.Equal(t, fixedwidth.EncodingASCII, l.Encoding)
+	assert.Equal(t, fixedwidth.TerminatorLF, l.RecordTerminator)
+	assert.Equal(t, fixedwidth.OverflowReject, l.Overflow)
+	assert.NoError(t, fixedwidth.Validate(l, []string{"Name", "amount"}))
+	assert.ErrorIs(t, fixedwidth.Validate(l, []string{"name"}), fixedwidth.ErrUnknownColumn)
+
+	bad := layout("ebcdic_500", "")
+	assert.ErrorIs(t, fixedwidth.Validate(bad, nil), fixedwidth.ErrUnknownEncoding)
+
+	dup := layout("", "")
+	dup.Fields = append(dup.Fields, models.FixedWidthField{Column: "NAME", Width: 3, Align: "left", Pad: " "})
+	assert.ErrorIs(t, fixedwidth.Validate(dup, nil), fixedwidth.ErrDuplicateField)
+
+	wide := layout(fixedwidth.EncodingUTF8, "")
+	wide.Fields[0].Pad = "é"
+	assert.ErrorIs(t, fixedwidth.Validate(wide, nil), fixedwidth.ErrInvalidField, "pad must be one byte")
+
+	zero := layout("", "")
+	zero.Fields[0].Width = 0
+	assert.ErrorIs(t, fixedwidth.Validate(zero, nil), fixedwidth.ErrInvalidField)
+}
+
+func TestEncode(t *testing.T) {
+	l := layout("", "")
+	out, err := fixedwidth.Encode([]map[string]interface{}{
+		{"name": "Ann", "amount": 12.5, "ignored": "x"},
+		{"name": nil, "amount": -3.0},
+	}, fixedwidth.Layout(&l))
+	require.NoError(t, err)
+	assert.Equal(t, "Ann   00012.50\n      -0003.00\n", string(out))
+
+	_, err = fixedwidth.Encode([]map[string]interface{}{{"name": "Annabelle"}}, fixedwidth.Layout(&l))
+	assert.ErrorIs(t, err, fixedwidth.ErrValueTooWide)
+}
+
+func TestEncodeEBCDIC(t *testing.T) {
+	l := layout(fixedwidth.EncodingEBCDIC037, "")
+	l.RecordTerminator = fixedwidth.TerminatorNone
+	out, err := fixedwidth.Encode([]map[string]interface{}{{"name": "AB", "amount": 1.0}}, fixedwidth.Layout(&l))
+	require.NoError(t, err)
+	// A=0xC1, B=0xC2, space=0x40, 0=0xF0, 1=0xF1, .=0x4B
+	assert.Equal(t, []byte{0xC1, 0xC2, 0x40, 0x40, 0x40, 0x40, 0xF0, 0xF0, 0xF0, 0xF0, 0xF1, 0x4B, 0xF0, 0xF0}, out)
+}
+
+func TestChecker(t *testing.T) {
+	t.Run("nil layout keeps rows", func(t *testing.T) {
+		c := fixedwidth.NewChecker(nil)
+		rows := []map[string]interface{}{{"name": "anything at all"}}
+		assert.Len(t, c.Filter(rows), 1)
+		assert.Nil(t, c.Report())
+	})
+
+	t.Run("reject drops rows that do not fit", func(t *testing.T) {
+		l := layout("", fixedwidth.OverflowReject)
+		c := fixedwidth.NewChecker(fixedwidth.Layout(&l))
+		rows := c.Filter([]map[string]interface{}{
+			{"name": "Ann", "amount": 1.0},
+			{"name": "Annabelle", "amount": 1.0},
+			{"name": "Zoë", "amount": 1.0},
+			{"name": "Bo", "amount": 123456.0},
+		})
+		require.Len(t, rows, 1)
+		report := c.Report()
+		assert.Equal(t, int64(3), report.Dropped)
+		assert.Equal(t, 14, report.RecordLength)
+		assert.Equal(t, map[string]int64{"name": 1, "amount": 1}, report.Overflows)
+	})
+
+	t.Run("truncate cuts text but never numbers", func(t *testing.T) {
+		l := layout(fixedwidth.EncodingEBCDIC037, fixedwidth.OverflowTruncate)
+		c := fixedwidth.NewChecker(fixedwidth.Layout(&l))
+		rows := c.Filter([]map[string]interface{}{
+			{"name": "Annabelle", "amount": 1.0},
+			{"name": "€uro", "amount": 1.0},
+			{"name": "Bo", "amount": 123456.0},
+		})
+		require.Len(t, rows, 2)
+		assert.Equal(t, "Annabe", rows[0]["name"])
+		assert.Equal(t, "?uro", rows[1]["name"])
+		report := c.Report()
+		assert.Equal(t, int64(1), report.Dropped)
+		assert.Equal(t, int64(1), report.Truncated)
+		assert.Equal(t, int64(1), report.Substituted)
+
+		_, err := fixedwidth.Encode(rows, fixedwidth.Layout(&l))
+		assert.NoError(t, err)
+	})
+}
+
+func TestApply(t *testing.T) {
+	l := layout(fixedwidth.EncodingEBCDIC1047, "")
+	req := &agents.GenerationRequest{}
+	fixedwidth.Apply(req, fixedwidth.Layout(&l))
+	require.NotNil(t, req.FixedWidth)
+	require.Len(t, req.SchemaAnalysis.Constraints, 1)
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "name 6")
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "amount 8 (2 decimals)")
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "ebcdic_1047")
+}
@@ -0,0 +1,120 @@
+package freetext
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Residual risk grades and the shares of generated texts, with PII or
+// copied from the source, below which the lower grades hold
+const (
+	RiskLow    = "low"
+	RiskMedium = "medium"
+	RiskHigh   = "high"
+
+	lowRiskShare    = 0.01
+	mediumRiskShare = 0.05
+)
+
+// Checker scrubs suspected PII from the generated text of free-text columns
+// and follows their lengths, languages and copies of source texts for
+// Report. Rows are kept: the PII is replaced in place.
+type Checker struct {
+	columns []agents.FreeTextColumn
+	sources []map[string]bool
+	stats   []*textStats
+}
+
+type textStats struct {
+	checked, redacted, copies int64
+	kinds                     map[string]int64
+	lengths                   []int
+	languages                 map[string]int
+}
+
+// NewChecker returns nil when there are no free-text columns
+func NewChecker(columns []agents.FreeTextColumn) *Checker {
+	if len(columns) == 0 {
+		return nil
+	}
+	c := &Checker{columns: columns}
+	for _, col := range columns {
+		hashes := make(map[string]bool, len(col.SourceHashes))
+		for _, h := range col.SourceHashes {
+			hashes[h] = true
+		}
+		c.sources = append(c.sources, hashes)
+		c.stats = append(c.stats, &textStats{kinds: make(map[string]int64), languages: make(map[string]int)})
+	}
+	return c
+}
+
+// Filter scrubs the free-text values of rows and returns them
+func (c *Checker) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if c == nil {
+		return rows
+	}
+	for _, row := range rows {
+		for i, col := range c.columns {
+			s, ok := row[col.Column].(string)
+			if !ok || strings.TrimSpace(s) == "" {
+				continue
+			}
+			st := c.stats[i]
+			st.checked++
+			scrubbed, found := Scrub(s)
+			if len(found) > 0 {
+				st.redacted++
+				for k, n := range found {
+					st.kinds[k] += int64(n)
+				}
+				row[col.Column] = scrubbed
+			}
+			if c.sources[i][Hash(scrubbed)] {
+				st.copies++
+			}
+			st.lengths = append(st.lengths, utf8.RuneCountInString(scrubbed))
+			st.languages[Language(scrubbed)]++
+		}
+	}
+	return rows
+}
+
+// Report compares the generated text of each column with its profile and
+// grades the PII risk that remains
+func (c *Checker) Report() []models.FreeTextReport {
+	if c == nil {
+		return nil
+	}
+	out := make([]models.FreeTextReport, len(c.columns))
+	for i, col := range c.columns {
+		st := c.stats[i]
+		r := models.FreeTextReport{
+			Column:             col.Column,
+			Checked:            st.checked,
+			Redacted:           st.redacted,
+			Copies:             st.copies,
+			ResidualRisk:       RiskLow,
+			TargetMedianLength: col.MedianLength,
+			TargetLanguages:    col.Languages,
+		}
+		if len(st.kinds) > 0 {
+			r.PIIKinds = st.kinds
+		}
+		if st.checked > 0 {
+			_, _, r.MedianLength, _, _ = quantiles(st.lengths)
+			r.Languages = shares(st.languages, int(st.checked))
+			switch share := float64(st.redacted+st.copies) / float64(st.checked); {
+			case share >= mediumRiskShare:
+				r.ResidualRisk = RiskHigh
+			case share >= lowRiskShare:
+				r.ResidualRisk = RiskMedium
+			}
+		}
+		out[i] = r
+	}
+	return out
+}
@@ -0,0 +1,446 @@
+// Package freetext supports prose columns, as notes or reviews. Source texts
+// are scrubbed of PII before any of them reach a prompt, their lengths and
+// languages are profiled as targets for the generated text, and generated
+// text is scrubbed again and reported for the PII risk that remains.
+package freetext
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+)
+
+const (
+	// MinWords is the mean number of words a column's values must have to
+	// be detected as free text
+	MinWords = 5
+	// MinMeanLength is the mean length, in characters, a column's values
+	// must have to be detected as free text
+	MinMeanLength = 30
+	// MinDistinct is the share of a column's values that must be distinct
+	// for it to be detected as free text; repeated sentences are categories
+	MinDistinct = 0.5
+	// MaxColumns caps the columns a job may name as free text
+	MaxColumns = 20
+	// MaxExamples caps the scrubbed source texts quoted per column
+	MaxExamples = 5
+	// MaxExampleLength caps the characters quoted per example
+	MaxExampleLength = 280
+	// Undetermined is the language of text too short or too mixed to tell
+	Undetermined = "und"
+)
+
+var (
+	ErrTooManyColumns = fmt.Errorf("at most %d free-text columns may be named", MaxColumns)
+	ErrBlankColumn    = errors.New("free-text column names must not be blank")
+	ErrDuplicate      = errors.New("free-text columns must be named once")
+	ErrUnknownColumn  = errors.New("no such column")
+	ErrNotText        = errors.New("column holds no text")
+)
+
+// Options names the free-text columns of a job. Without columns they are
+// detected from the source.
+type Options struct {
+	Columns []string `json:"columns,omitempty"`
+}
+
+func (o Options) Validate() error {
+	if len(o.Columns) > MaxColumns {
+		return ErrTooManyColumns
+	}
+	seen := make(map[string]bool, len(o.Columns))
+	for _, c := range o.Columns {
+		key := strings.ToLower(strings.TrimSpace(c))
+		if key == "" {
+			return ErrBlankColumn
+		}
+		if seen[key] {
+			return fmt.Errorf("%w: %s", ErrDuplicate, c)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// ColumnProfile is the profile of one free-text column. Values counts its
+// non-empty texts and Empty its blank ones; PII counts the suspected PII
+// found in the source texts by kind.
+type ColumnProfile struct {
+	agents.FreeTextColumn
+	Values int64            `json:"values"`
+	Empty  int64            `json:"empty"`
+	PII    map[string]int64 `json:"pii,omitempty"`
+}
+
+func blank(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+// Detect returns the columns of sampled rows that hold prose: text of
+// several words, long on average and mostly distinct
+func Detect(columns []string, rows []map[string]interface{}) []string {
+	var out []string
+	for _, col := range columns {
+		var values, words, chars int
+		seen := make(map[string]bool)
+		prose := true
+		for _, row := range rows {
+			v := row[col]
+			if blank(v) {
+				continue
+			}
+			s, ok := v.(string)
+			if !ok {
+				prose = false
+				break
+			}
+			values++
+			words += len(strings.Fields(s))
+			chars += utf8.RuneCountInString(s)
+			seen[s] = true
+		}
+		if !prose || values == 0 {
+			continue
+		}
+		if words >= MinWords*values && chars >= MinMeanLength*values && float64(len(seen)) >= MinDistinct*float64(values) {
+			out = append(out, col)
+		}
+	}
+	return out
+}
+
+// identifyingNames are the parts of column names whose values identify a
+// person, and are scrubbed wherever they are quoted in the same row's text
+var identifyingNames = []string{"name", "email", "phone", "address", "street", "ssn"}
+
+// IdentifyingColumns returns the columns whose values identify a person:
+// restricted ones and those named for names, contacts or addresses
+func IdentifyingColumns(columns, restricted []string) []string {
+	hidden := make(map[string]bool, len(restricted))
+	for _, c := range restricted {
+		hidden[strings.ToLower(c)] = true
+	}
+	var out []string
+	for _, col := range columns {
+		key := strings.ToLower(col)
+		match := hidden[key]
+		for _, part := range identifyingNames {
+			match = match || strings.Contains(key, part)
+		}
+		if match {
+			out = append(out, col)
+		}
+	}
+	return out
+}
+
+// detectors find the PII that redact does not: addresses before names, so a
+// street ending in Dr is not read as a title
+var detectors = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"ip", regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`)},
+	{"address", regexp.MustCompile(`\b\d{1,5}\s+(?:[A-Z][a-z]+\s+){1,3}(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|Lane|Ln|Drive|Dr|Court|Ct|Way|Place|Pl)\b\.?`)},
+	{"name", regexp.MustCompile(`\b(?:Mr|Mrs|Ms|Miss|Dr|Prof)\.?\s+[A-Z][a-z]+(?:\s+[A-Z][a-z]+)?`)},
+}
+
+// Scrub replaces suspected PII in text with placeholders naming its kind,
+// such as [email] or [name], and counts the replacements by kind. Values
+// are identifying values of the text's row, replaced wherever they appear.
+func Scrub(text string, values ...string) (string, map[string]int) {
+	found := make(map[string]int)
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if len(v) < 3 || !strings.Contains(text, v) {
+			continue
+		}
+		found["identifier"] += strings.Count(text, v)
+		text = strings.ReplaceAll(text, v, "[identifier]")
+	}
+	text, kinds := redact.Scrub(text)
+	for k, n := range kinds {
+		found[k] += n
+	}
+	for _, d := range detectors {
+		text = d.re.ReplaceAllStringFunc(text, func(string) string {
+			found[d.kind]++
+			return "[" + d.kind + "]"
+		})
+	}
+	return text, found
+}
+
+// identifying returns the text values of a row's identifying columns
+func identifying(row map[string]interface{}, columns []string) []string {
+	var out []string
+	for _, col := range columns {
+		if s, ok := row[col].(string); ok && strings.TrimSpace(s) != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Hash identifies a scrubbed text regardless of case and spacing
+func Hash(scrubbed string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.Join(strings.Fields(scrubbed), " "))))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Profile returns the length, language and PII profile of the free-text
+// columns of sampled rows. Named columns must exist and hold text; without
+// them the columns are detected. Restricted columns identify people but are
+// never profiled themselves.
+func Profile(columns []string, rows []map[string]interface{}, opts Options, restricted []string) ([]ColumnProfile, error) {
+	targets := Detect(columns, rows)
+	if len(opts.Columns) > 0 {
+		targets = nil
+		for _, name := range opts.Columns {
+			col, ok := find(columns, name)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownColumn, name)
+			}
+			targets = append(targets, col)
+		}
+	}
+	hidden := make(map[string]bool, len(restricted))
+	for _, c := range restricted {
+		hidden[strings.ToLower(c)] = true
+	}
+	ids := IdentifyingColumns(columns, restricted)
+	var out []ColumnProfile
+	for _, col := range targets {
+		if hidden[strings.ToLower(col)] {
+			continue
+		}
+		p := ColumnProfile{FreeTextColumn: agents.FreeTextColumn{Column: col}, PII: make(map[string]int64)}
+		var lengths []int
+		languages := make(map[string]int)
+		hashes := make(map[string]bool)
+		for _, row := range rows {
+			v := row[col]
+			if blank(v) {
+				p.Empty++
+				continue
+			}
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			p.Values++
+			lengths = append(lengths, utf8.RuneCountInString(s))
+			languages[Language(s)]++
+			scrubbed, found := Scrub(s, identifying(row, others(ids, col))...)
+			for k, n := range found {
+				p.PII[k] += int64(n)
+			}
+			h := Hash(scrubbed)
+			if !hashes[h] {
+				hashes[h] = true
+				p.SourceHashes = append(p.SourceHashes, h)
+				if len(p.Examples) < MaxExamples {
+					p.Examples = append(p.Examples, truncate(scrubbed, MaxExampleLength))
+				}
+			}
+		}
+		if p.Values == 0 {
+			if len(opts.Columns) > 0 {
+				return nil, fmt.Errorf("%w: %s", ErrNotText, col)
+			}
+			continue
+		}
+		p.MinLength, p.P10Length, p.MedianLength, p.P90Length, p.MaxLength = quantiles(lengths)
+		p.Languages = shares(languages, int(p.Values))
+		if len(p.PII) == 0 {
+			p.PII = nil
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+func find(columns []string, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	for _, c := range columns {
+		if strings.EqualFold(c, name) {
+			return c, true
+		}
+	}
+	return "", false
+}
+
+// others returns columns without col, so a text is not scrubbed of itself
+func others(columns []string, col string) []string {
+	out := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if c != col {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+// quantiles returns the minimum, 10th percentile, median, 90th percentile
+// and maximum of lengths
+func quantiles(lengths []int) (int, int, int, int, int) {
+	if len(lengths) == 0 {
+		return 0, 0, 0, 0, 0
+	}
+	sorted := append([]int(nil), lengths...)
+	sort.Ints(sorted)
+	at := func(q float64) int { return sorted[int(q*float64(len(sorted)-1)+0.5)] }
+	return sorted[0], at(0.1), at(0.5), at(0.9), sorted[len(sorted)-1]
+}
+
+func shares(counts map[string]int, total int) map[string]float64 {
+	out := make(map[string]float64, len(counts))
+	for k, n := range counts {
+		out[k] = round(float64(n) / float64(total))
+	}
+	return out
+}
+
+// Apply adds free-text columns to a generation request, as targets for the
+// output and as rules in the prompt, and scrubs the columns in the grounding
+// and reference rows the request carries. Examples and source hashes come
+// from source text, so they are dropped when the job may not use real data
+// or the column is restricted.
+func Apply(req *agents.GenerationRequest, columns []agents.FreeTextColumn) {
+	if len(columns) == 0 {
+		return
+	}
+	restricted := make(map[string]bool, len(req.RestrictedColumns))
+	for _, c := range req.RestrictedColumns {
+		restricted[strings.ToLower(c)] = true
+	}
+	for _, col := range columns {
+		if req.ZeroRealData || restricted[strings.ToLower(col.Column)] {
+			col.Examples, col.SourceHashes = nil, nil
+		}
+		req.SchemaAnalysis.FreeText = append(req.SchemaAnalysis.FreeText, col)
+		req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints, promptText(col))
+	}
+	scrubRows(req.GroundingRows, columns, req.RestrictedColumns)
+	scrubRows(req.Reference, columns, req.RestrictedColumns)
+}
+
+func scrubRows(rows []map[string]interface{}, columns []agents.FreeTextColumn, restricted []string) {
+	for _, row := range rows {
+		names := make([]string, 0, len(row))
+		for k := range row {
+			names = append(names, k)
+		}
+		ids := IdentifyingColumns(names, restricted)
+		for _, col := range columns {
+			if s, ok := row[col.Column].(string); ok {
+				row[col.Column], _ = Scrub(s, identifying(row, others(ids, col.Column))...)
+			}
+		}
+	}
+}
+
+func promptText(col agents.FreeTextColumn) string {
+	text := fmt.Sprintf("%s is free text: write new text for every row, never copied from the source and never naming real people, contacts, addresses or account numbers; "+
+		"length %d to %d characters, median %d, 10th to 90th percentile %d to %d",
+		col.Column, col.MinLength, col.MaxLength, col.MedianLength, col.P10Length, col.P90Length)
+	if len(col.Languages) > 0 {
+		text += "; languages " + formatShares(col.Languages)
+	}
+	if len(col.Examples) > 0 {
+		text += "; examples of the style, with personal details replaced by placeholders: " + strings.Join(quoted(col.Examples), " | ")
+	}
+	return text
+}
+
+func quoted(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = fmt.Sprintf("%q", v)
+	}
+	return out
+}
+
+func formatShares(shares map[string]float64) string {
+	keys := make([]string, 0, len(shares))
+	for k := range shares {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if shares[keys[a]] != shares[keys[b]] {
+			return shares[keys[a]] > shares[keys[b]]
+		}
+		return keys[a] < keys[b]
+	})
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s %.1f%%", k, shares[k]*100)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// stopwords are common words of each language, in the order ties go
+var stopwords = []struct {
+	lang  string
+	words map[string]bool
+}{
+	{"en", set("the and is was with for that this not are have but very it of to")},
+	{"es", set("el la los las y es con para que muy pero una por del no")},
+	{"fr", set("le les et est avec pour que très mais une des du pas je il")},
+	{"de", set("der die das und ist mit für nicht sehr aber ein eine ich zu auf")},
+	{"pt", set("o os as e é com para que muito mas uma um não do da")},
+	{"it", set("il lo gli e è con per che molto ma una un non della sono")},
+	{"nl", set("de het en is met voor niet zeer maar een ik van dat op zijn")},
+}
+
+func set(words string) map[string]bool {
+	out := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		out[w] = true
+	}
+	return out
+}
+
+// Language guesses the language of text from its common words, as an ISO
+// 639-1 code, or Undetermined when fewer than two are found
+func Language(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) })
+	best, hits := Undetermined, 1
+	for _, sw := range stopwords {
+		n := 0
+		for _, w := range words {
+			if sw.words[w] {
+				n++
+			}
+		}
+		if n > hits {
+			best, hits = sw.lang, n
+		}
+	}
+	return best
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
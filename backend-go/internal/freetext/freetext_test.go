@@ -0,0 +1,153 @@
+// Package freetext_test provides unit tests for free-text columns
+package freetext_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/freetext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func reviews() []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, 40)
+	for i := 0; i < 40; i++ {
+		rows = append(rows, map[string]interface{}{
+			"id":            float64(i),
+			"customer_name": fmt.Sprintf("Jordan Lee%d", i),
+			"status":        "delivered on time",
+			"notes":         fmt.Sprintf("The parcel %d was late and the box was damaged, call Jordan Lee%d at 555-123-4567", i, i),
+		})
+	}
+	rows[0]["notes"] = "El paquete llegó tarde y la caja estaba dañada, pero el servicio fue muy bueno"
+	rows[1]["notes"] = ""
+	return rows
+}
+
+func TestDetect(t *testing.T) {
+	cols := freetext.Detect([]string{"id", "customer_name", "status", "notes"}, reviews())
+	assert.Equal(t, []string{"notes"}, cols, "numbers, names and repeated phrases are not prose")
+}
+
+func TestScrub(t *testing.T) {
+	text := "Dr. Maria Gomez at 12 Oak Street emailed maria@example.com from 10.0.0.12 about Jordan"
+	out, found := freetext.Scrub(text, "Jordan", "x")
+	assert.Equal(t, "[name] at [address] emailed [email] from [ip] about [identifier]", out)
+	assert.Equal(t, map[string]int{"name": 1, "address": 1, "email": 1, "ip": 1, "identifier": 1}, found)
+
+	plain := "Arrived in 3 days, version 1.2.3 works"
+	out, found = freetext.Scrub(plain)
+	assert.Equal(t, plain, out)
+	assert.Empty(t, found)
+}
+
+func TestLanguage(t *testing.T) {
+	assert.Equal(t, "en", freetext.Language("The box was damaged and the parcel was late"))
+	assert.Equal(t, "es", freetext.Language("El paquete llegó tarde pero la caja estaba bien"))
+	assert.Equal(t, "de", freetext.Language("Die Lieferung war sehr schnell und nicht beschädigt"))
+	assert.Equal(t, freetext.Undetermined, freetext.Language("OK"))
+}
+
+func TestProfile(t *testing.T) {
+	columns := []string{"id", "customer_name", "status", "notes"}
+	profiles, err := freetext.Profile(columns, reviews(), freetext.Options{}, nil)
+	require.NoError(t, err)
+	require.Len(t, profiles, 1)
+	p := profiles[0]
+	assert.Equal(t, "notes", p.Column)
+	assert.Equal(t, int64(39), p.Values)
+	assert.Equal(t, int64(1), p.Empty)
+	assert.Equal(t, int64(38), p.PII["phone"])
+	assert.Equal(t, int64(38), p.PII["identifier"], "customer names are scrubbed from the same row's text")
+	assert.InDelta(t, 38.0/39, p.Languages["en"], 1e-4)
+	assert.LessOrEqual(t, p.MinLength, p.MedianLength)
+	assert.LessOrEqual(t, p.MedianLength, p.MaxLength)
+	require.Len(t, p.Examples, freetext.MaxExamples)
+	for _, ex := range p.Examples {
+		assert.NotContains(t, ex, "555-123-4567")
+		assert.NotContains(t, ex, "Jordan")
+	}
+	assert.Len(t, p.SourceHashes, 39)
+
+	// Named columns replace detection and must exist
+	profiles, err = freetext.Profile(columns, reviews(), freetext.Options{Columns: []string{"Status"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "status", profiles[0].Column)
+	_, err = freetext.Profile(columns, reviews(), freetext.Options{Columns: []string{"comments"}}, nil)
+	assert.ErrorIs(t, err, freetext.ErrUnknownColumn)
+	_, err = freetext.Profile(columns, reviews(), freetext.Options{Columns: []string{"id"}}, nil)
+	assert.ErrorIs(t, err, freetext.ErrNotText)
+
+	// Restricted columns are not profiled
+	profiles, err = freetext.Profile(columns, reviews(), freetext.Options{}, []string{"notes"})
+	require.NoError(t, err)
+	assert.Empty(t, profiles)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, freetext.Options{Columns: []string{"notes", "review"}}.Validate())
+	assert.ErrorIs(t, freetext.Options{Columns: []string{" "}}.Validate(), freetext.ErrBlankColumn)
+	assert.ErrorIs(t, freetext.Options{Columns: []string{"notes", "Notes"}}.Validate(), freetext.ErrDuplicate)
+	assert.ErrorIs(t, freetext.Options{Columns: make([]string, freetext.MaxColumns+1)}.Validate(), freetext.ErrTooManyColumns)
+}
+
+func TestApply(t *testing.T) {
+	profiles, err := freetext.Profile([]string{"customer_name", "notes"}, reviews(), freetext.Options{}, nil)
+	require.NoError(t, err)
+	col := profiles[0].FreeTextColumn
+	req := &agents.GenerationRequest{
+		GroundingRows: []map[string]interface{}{{"customer_name": "Ana Ruiz", "notes": "Ana Ruiz asked for a refund at ana@example.com"}},
+	}
+	freetext.Apply(req, []agents.FreeTextColumn{col})
+	require.Len(t, req.SchemaAnalysis.FreeText, 1)
+	require.Len(t, req.SchemaAnalysis.Constraints, 1)
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "never copied from the source")
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "[phone]")
+	assert.Equal(t, "[identifier] asked for a refund at [email]", req.GroundingRows[0]["notes"])
+
+	req = &agents.GenerationRequest{ZeroRealData: true}
+	freetext.Apply(req, []agents.FreeTextColumn{col})
+	assert.Empty(t, req.SchemaAnalysis.FreeText[0].Examples)
+	assert.Empty(t, req.SchemaAnalysis.FreeText[0].SourceHashes)
+	assert.NotContains(t, req.SchemaAnalysis.Constraints[0], "examples")
+}
+
+func TestCheckerScrubsAndGradesRisk(t *testing.T) {
+	profiles, err := freetext.Profile([]string{"customer_name", "notes"}, reviews(), freetext.Options{}, nil)
+	require.NoError(t, err)
+	checker := freetext.NewChecker([]agents.FreeTextColumn{profiles[0].FreeTextColumn})
+
+	rows := make([]map[string]interface{}, 100)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"notes": "The courier was friendly and the parcel arrived in good shape"}
+	}
+	rows[0]["notes"] = "Please call me back on 555-987-6543"
+	rows[1]["notes"] = "The parcel 7 was late and the box was damaged, call Jordan Lee7 at 555-123-4567"
+	rows[2]["notes"] = nil
+	rows = checker.Filter(rows)
+	require.Len(t, rows, 100, "rows are kept")
+	assert.Equal(t, "Please call me back on [phone]", rows[0]["notes"])
+
+	reports := checker.Report()
+	require.Len(t, reports, 1)
+	r := reports[0]
+	assert.Equal(t, int64(99), r.Checked)
+	assert.Equal(t, int64(2), r.Redacted)
+	assert.Equal(t, int64(2), r.PIIKinds["phone"])
+	assert.Equal(t, int64(0), r.Copies, "the copy keeps a name that only the row it was profiled from identified")
+	assert.Equal(t, freetext.RiskMedium, r.ResidualRisk)
+	assert.InDelta(t, 98.0/99, r.Languages["en"], 1e-4)
+	assert.Equal(t, profiles[0].MedianLength, r.TargetMedianLength)
+
+	// Verbatim copies of a source text raise the risk
+	checker = freetext.NewChecker([]agents.FreeTextColumn{profiles[0].FreeTextColumn})
+	copied := []map[string]interface{}{{"notes": profiles[0].Examples[0]}, {"notes": "All good, thanks for the quick delivery"}}
+	checker.Filter(copied)
+	r = checker.Report()[0]
+	assert.Equal(t, int64(1), r.Copies)
+	assert.Equal(t, freetext.RiskHigh, r.ResidualRisk)
+
+	assert.Nil(t, freetext.NewChecker(nil))
+}
@@ -0,0 +1,248 @@
+// Package hierarchy supports categorical columns nested as levels, such as
+// department > team or category > subcategory. A hierarchy follows either a
+// user-supplied taxonomy or the paths observed in the source; generated rows
+// off those paths are dropped and counted against constraint compliance.
+package hierarchy
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Sources of the allowed paths
+const (
+	SourceTaxonomy = "taxonomy"
+	SourceObserved = "observed"
+)
+
+const (
+	// MaxLevels caps the columns of one hierarchy
+	MaxLevels = 6
+	// MaxPaths caps the paths of a taxonomy or observed in the source
+	MaxPaths = 5000
+	// promptPaths caps the paths listed in a prompt
+	promptPaths = 100
+)
+
+var (
+	ErrTooFewLevels   = errors.New("a hierarchy needs at least two levels")
+	ErrTooManyLevels  = fmt.Errorf("a hierarchy has at most %d levels", MaxLevels)
+	ErrDuplicateLevel = errors.New("a column appears twice in the hierarchy")
+	ErrUnknownColumn  = errors.New("hierarchy column not found in the dataset")
+	ErrInvalidPath    = errors.New("taxonomy paths must have between one value and one per level, none blank")
+	ErrTooManyPaths   = fmt.Errorf("a hierarchy has at most %d paths", MaxPaths)
+	ErrNoPaths        = errors.New("no complete path observed in the dataset")
+)
+
+// ValidateLevels checks the levels of a hierarchy, against the dataset's
+// columns when they are known
+func ValidateLevels(levels, columns []string) error {
+	if len(levels) < 2 {
+		return ErrTooFewLevels
+	}
+	if len(levels) > MaxLevels {
+		return ErrTooManyLevels
+	}
+	known := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		known[c] = true
+	}
+	seen := make(map[string]bool, len(levels))
+	for _, l := range levels {
+		if seen[l] {
+			return ErrDuplicateLevel
+		}
+		seen[l] = true
+		if columns != nil && !known[l] {
+			return fmt.Errorf("%w: %s", ErrUnknownColumn, l)
+		}
+	}
+	return nil
+}
+
+// ValidateTaxonomy checks that there are paths and every one fits the
+// levels
+func ValidateTaxonomy(levels []string, paths models.TaxonomyPaths) error {
+	if len(paths) == 0 {
+		return ErrInvalidPath
+	}
+	if len(paths) > MaxPaths {
+		return ErrTooManyPaths
+	}
+	for _, path := range paths {
+		if len(path) == 0 || len(path) > len(levels) {
+			return ErrInvalidPath
+		}
+		for _, v := range path {
+			if strings.TrimSpace(v) == "" {
+				return ErrInvalidPath
+			}
+		}
+	}
+	return nil
+}
+
+// Observe returns the distinct complete paths of sampled rows, sorted
+func Observe(levels []string, rows []map[string]interface{}) [][]string {
+	seen := make(map[string]bool)
+	var out [][]string
+	for _, row := range rows {
+		path := make([]string, 0, len(levels))
+		for _, l := range levels {
+			v := text(row[l])
+			if v == "" {
+				break
+			}
+			path = append(path, v)
+		}
+		if len(path) < len(levels) {
+			continue
+		}
+		key := strings.Join(path, "\x1f")
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, path)
+		}
+	}
+	sort.Slice(out, func(a, b int) bool {
+		return strings.Join(out[a], "\x1f") < strings.Join(out[b], "\x1f")
+	})
+	return out
+}
+
+// Resolve turns a declared hierarchy into the rule generation follows:
+// its taxonomy, or the paths observed in rows. A source too varied to list
+// falls back to each value keeping one parent.
+func Resolve(h models.ColumnHierarchy, rows []map[string]interface{}) (agents.Hierarchy, error) {
+	out := agents.Hierarchy{Levels: h.Levels, Source: SourceTaxonomy, Paths: h.Taxonomy}
+	if h.Taxonomy != nil {
+		return out, nil
+	}
+	out.Source = SourceObserved
+	paths := Observe(h.Levels, rows)
+	if len(paths) == 0 {
+		return out, ErrNoPaths
+	}
+	if len(paths) <= MaxPaths {
+		out.Paths = paths
+	}
+	return out, nil
+}
+
+// Apply adds hierarchies to a generation request, as checks on the output
+// and as rules in the prompt. Observed paths are source values: without
+// real data they are dropped, leaving each value to keep one parent, and
+// they are never listed when a level is restricted.
+func Apply(req *agents.GenerationRequest, hierarchies []agents.Hierarchy) {
+	restricted := make(map[string]bool, len(req.RestrictedColumns))
+	for _, c := range req.RestrictedColumns {
+		restricted[strings.ToLower(c)] = true
+	}
+	for _, h := range hierarchies {
+		if req.ZeroRealData && h.Source == SourceObserved {
+			h.Paths = nil
+		}
+		req.SchemaAnalysis.Hierarchies = append(req.SchemaAnalysis.Hierarchies, h)
+		name := strings.Join(h.Levels, " > ")
+		rule := fmt.Sprintf("%s is a hierarchy: every %s belongs to exactly one %s", name, h.Levels[len(h.Levels)-1], h.Levels[0])
+		listed := len(h.Paths) > 0
+		for _, l := range h.Levels {
+			if restricted[strings.ToLower(l)] {
+				listed = false
+			}
+		}
+		if listed {
+			paths := h.Paths
+			if len(paths) > promptPaths {
+				paths = paths[:promptPaths]
+			}
+			parts := make([]string, len(paths))
+			for i, p := range paths {
+				parts[i] = strings.Join(p, " > ")
+			}
+			rule += "; use only these paths: " + strings.Join(parts, "; ")
+		}
+		req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints, rule)
+	}
+}
+
+// Enforcer drops generated rows that break a hierarchy and counts them for
+// Report
+type Enforcer struct {
+	hierarchies []agents.Hierarchy
+	checker     *agents.HierarchyChecker
+	checked     int64
+	violations  []int64
+}
+
+// NewEnforcer returns nil when there are no hierarchies
+func NewEnforcer(hierarchies []agents.Hierarchy) *Enforcer {
+	if len(hierarchies) == 0 {
+		return nil
+	}
+	return &Enforcer{
+		hierarchies: hierarchies,
+		checker:     agents.NewHierarchyChecker(hierarchies),
+		violations:  make([]int64, len(hierarchies)),
+	}
+}
+
+// Filter returns the rows that follow every hierarchy
+func (e *Enforcer) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if e == nil {
+		return rows
+	}
+	kept := rows[:0:0]
+	for _, row := range rows {
+		e.checked++
+		if broken := e.checker.Violations(row); len(broken) > 0 {
+			for _, i := range broken {
+				e.violations[i]++
+			}
+			continue
+		}
+		e.checker.Record(row)
+		kept = append(kept, row)
+	}
+	return kept
+}
+
+// Report returns the violations counted per hierarchy
+func (e *Enforcer) Report() []models.HierarchyReport {
+	if e == nil {
+		return nil
+	}
+	out := make([]models.HierarchyReport, len(e.hierarchies))
+	for i, h := range e.hierarchies {
+		compliance := 1.0
+		if e.checked > 0 {
+			compliance = float64(e.checked-e.violations[i]) / float64(e.checked)
+		}
+		out[i] = models.HierarchyReport{
+			Levels:     h.Levels,
+			Source:     h.Source,
+			Checked:    e.checked,
+			Violations: e.violations[i],
+			Compliance: compliance,
+		}
+	}
+	return out
+}
+
+func text(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,85 @@
+// Package hierarchy_test provides unit tests for categorical hierarchies
+package hierarchy_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/hierarchy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func source() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"department": "Engineering", "team": "Backend"},
+		{"department": "Engineering", "team": "Frontend"},
+		{"department": "Sales", "team": "EMEA"},
+		{"department": "Sales", "team": "EMEA"},
+		{"department": "Sales"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.ErrorIs(t, hierarchy.ValidateLevels([]string{"department"}, nil), hierarchy.ErrTooFewLevels)
+	assert.ErrorIs(t, hierarchy.ValidateLevels([]string{"department", "department"}, nil), hierarchy.ErrDuplicateLevel)
+	assert.ErrorIs(t, hierarchy.ValidateLevels([]string{"department", "squad"}, []string{"department", "team"}), hierarchy.ErrUnknownColumn)
+	assert.NoError(t, hierarchy.ValidateLevels([]string{"department", "team"}, []string{"department", "team"}))
+
+	levels := []string{"department", "team"}
+	assert.NoError(t, hierarchy.ValidateTaxonomy(levels, models.TaxonomyPaths{{"Sales"}, {"Engineering", "Backend"}}))
+	assert.ErrorIs(t, hierarchy.ValidateTaxonomy(levels, models.TaxonomyPaths{{"Sales", "EMEA", "UK"}}), hierarchy.ErrInvalidPath)
+	assert.ErrorIs(t, hierarchy.ValidateTaxonomy(levels, models.TaxonomyPaths{}), hierarchy.ErrInvalidPath)
+}
+
+func TestResolveObserved(t *testing.T) {
+	h, err := hierarchy.Resolve(models.ColumnHierarchy{Levels: []string{"department", "team"}}, source())
+	require.NoError(t, err)
+	assert.Equal(t, hierarchy.SourceObserved, h.Source)
+	assert.Equal(t, [][]string{{"Engineering", "Backend"}, {"Engineering", "Frontend"}, {"Sales", "EMEA"}}, h.Paths)
+
+	_, err = hierarchy.Resolve(models.ColumnHierarchy{Levels: []string{"department", "team"}}, nil)
+	assert.ErrorIs(t, err, hierarchy.ErrNoPaths)
+}
+
+func TestEnforcePaths(t *testing.T) {
+	h, err := hierarchy.Resolve(models.ColumnHierarchy{Levels: []string{"department", "team"}}, source())
+	require.NoError(t, err)
+	e := hierarchy.NewEnforcer([]agents.Hierarchy{h})
+	kept := e.Filter([]map[string]interface{}{
+		{"department": "Engineering", "team": "Backend"},
+		{"department": "Sales", "team": "Backend"},
+		{"department": "Sales"},
+		{"team": "EMEA"},
+	})
+	assert.Len(t, kept, 2)
+	report := e.Report()
+	require.Len(t, report, 1)
+	assert.Equal(t, int64(4), report[0].Checked)
+	assert.Equal(t, int64(2), report[0].Violations)
+	assert.Equal(t, 0.5, report[0].Compliance)
+	assert.Equal(t, 0.5, agents.HierarchyCompliance([]map[string]interface{}{
+		{"department": "Engineering", "team": "Backend"},
+		{"department": "Sales", "team": "Backend"},
+	}, []agents.Hierarchy{h}))
+}
+
+func TestApplyWithoutRealData(t *testing.T) {
+	h, err := hierarchy.Resolve(models.ColumnHierarchy{Levels: []string{"department", "team"}}, source())
+	require.NoError(t, err)
+	req := &agents.GenerationRequest{ZeroRealData: true}
+	hierarchy.Apply(req, []agents.Hierarchy{h})
+	require.Len(t, req.SchemaAnalysis.Hierarchies, 1)
+	assert.Nil(t, req.SchemaAnalysis.Hierarchies[0].Paths, "observed paths are source values")
+	assert.NotContains(t, req.SchemaAnalysis.Constraints[0], "Engineering")
+
+	// Without paths each team keeps the first department it appeared in
+	e := hierarchy.NewEnforcer(req.SchemaAnalysis.Hierarchies)
+	kept := e.Filter([]map[string]interface{}{
+		{"department": "Ops", "team": "Infra"},
+		{"department": "Finance", "team": "Infra"},
+		{"department": "Finance", "team": "Payroll"},
+	})
+	assert.Len(t, kept, 2)
+}
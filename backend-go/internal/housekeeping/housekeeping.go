@@ -0,0 +1,268 @@
+// Package housekeeping finds resources nobody uses any more: datasets no
+// job has used for months, outputs of failed jobs or of deleted datasets,
+// API keys that were never used and idle custom models. It suggests
+// cleaning them up with the storage and cost that would save, and cleans up
+// the kinds whose cleanup policy staff enabled.
+package housekeeping
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	// MaxSuggestions bounds the suggestions of each kind in a report
+	MaxSuggestions = 500
+	// MaxCleanups bounds the resources of each kind one run cleans up
+	MaxCleanups = 200
+	// MaxIdleDays bounds the idle days of a policy
+	MaxIdleDays = 3650
+)
+
+// DefaultIdleDays is how long each kind of resource must go unused to be
+// stale when no policy says otherwise. Orphaned outputs only wait out a
+// grace period after their job finished.
+var DefaultIdleDays = map[models.StaleKind]int{
+	models.StaleDataset:     90,
+	models.StaleOutput:      7,
+	models.StaleAPIKey:      30,
+	models.StaleCustomModel: 90,
+}
+
+// Actions a cleanup takes, by kind
+var Actions = map[models.StaleKind]string{
+	models.StaleDataset:     "archive_and_delete_file",
+	models.StaleOutput:      "delete_output",
+	models.StaleAPIKey:      "deactivate",
+	models.StaleCustomModel: "archive_and_delete_files",
+}
+
+// ValidKind reports whether k is a kind of stale resource
+func ValidKind(k models.StaleKind) bool {
+	_, ok := DefaultIdleDays[k]
+	return ok
+}
+
+// Store finds stale resources and cleans them up. Each cleanup checks the
+// resource is still stale and reports whether it changed it; the stored
+// objects it no longer points at are deleted afterwards.
+type Store interface {
+	Policies(ctx context.Context) ([]models.CleanupPolicy, error)
+	UnusedDatasets(ctx context.Context, before time.Time, limit int) ([]models.StaleResource, error)
+	OrphanedOutputs(ctx context.Context, before time.Time, limit int) ([]models.StaleResource, error)
+	UnusedAPIKeys(ctx context.Context, before time.Time, limit int) ([]models.StaleResource, error)
+	IdleCustomModels(ctx context.Context, before time.Time, limit int) ([]models.StaleResource, error)
+	ArchiveUnusedDataset(ctx context.Context, r models.StaleResource, before time.Time) (bool, error)
+	ClearOrphanedOutput(ctx context.Context, r models.StaleResource, before time.Time) (bool, error)
+	DeactivateUnusedAPIKey(ctx context.Context, r models.StaleResource, before time.Time) (bool, error)
+	ArchiveIdleCustomModel(ctx context.Context, r models.StaleResource, before time.Time) (bool, error)
+}
+
+// Suggestion proposes cleaning up a stale resource
+type Suggestion struct {
+	models.StaleResource
+	Action string `json:"action"`
+	// MonthlySavingsUSD is what storing the resource costs a month
+	MonthlySavingsUSD float64 `json:"monthly_savings_usd"`
+}
+
+// Summary totals the suggestions of a kind
+type Summary struct {
+	Kind              models.StaleKind `json:"kind"`
+	Count             int              `json:"count"`
+	Bytes             int64            `json:"bytes"`
+	MonthlySavingsUSD float64          `json:"monthly_savings_usd"`
+	IdleDays          int              `json:"idle_days"`
+	// AutoCleanup is whether the kind's policy cleans it up by itself
+	AutoCleanup bool `json:"auto_cleanup"`
+	// Truncated is set when there were more than MaxSuggestions
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Report lists cleanup suggestions, largest savings first
+type Report struct {
+	GeneratedAt           time.Time    `json:"generated_at"`
+	StorageCostPerGBMonth float64      `json:"storage_cost_per_gb_month"`
+	Summaries             []Summary    `json:"summaries"`
+	Suggestions           []Suggestion `json:"suggestions"`
+	Bytes                 int64        `json:"bytes"`
+	MonthlySavingsUSD     float64      `json:"monthly_savings_usd"`
+}
+
+// Analyzer finds stale resources and applies cleanup policies
+type Analyzer struct {
+	store          Store
+	objects        storage.ObjectDeleter
+	costPerGBMonth float64
+	logger         *zap.Logger
+}
+
+// NewAnalyzer creates an analyzer. Without objects, resources with stored
+// objects are suggested but never cleaned up, so no object is left behind
+// unreferenced.
+func NewAnalyzer(store Store, objects storage.ObjectDeleter, costPerGBMonth float64, logger *zap.Logger) *Analyzer {
+	return &Analyzer{store: store, objects: objects, costPerGBMonth: costPerGBMonth, logger: logger}
+}
+
+// MonthlyCost is what storing bytes costs a month
+func MonthlyCost(bytes int64, costPerGBMonth float64) float64 {
+	return float64(bytes) / 1e9 * costPerGBMonth
+}
+
+// Policies returns the policy of every kind, with the defaults for kinds
+// staff have not set: disabled, at DefaultIdleDays
+func (a *Analyzer) Policies(ctx context.Context) ([]models.CleanupPolicy, error) {
+	stored, err := a.store.Policies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byKind := make(map[models.StaleKind]models.CleanupPolicy, len(stored))
+	for _, p := range stored {
+		byKind[p.Kind] = p
+	}
+	out := make([]models.CleanupPolicy, 0, len(models.StaleKinds))
+	for _, k := range models.StaleKinds {
+		p, ok := byKind[k]
+		if !ok {
+			p = models.CleanupPolicy{Kind: k, IdleDays: DefaultIdleDays[k]}
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// Suggest lists the stale resources of kinds, or of every kind when kinds
+// is empty, as of now
+func (a *Analyzer) Suggest(ctx context.Context, now time.Time, kinds ...models.StaleKind) (*Report, error) {
+	policies, err := a.Policies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("read cleanup policies: %w", err)
+	}
+	report := &Report{GeneratedAt: now, StorageCostPerGBMonth: a.costPerGBMonth, Summaries: []Summary{}, Suggestions: []Suggestion{}}
+	for _, p := range policies {
+		if len(kinds) > 0 && !slices.Contains(kinds, p.Kind) {
+			continue
+		}
+		found, err := a.find(ctx, p.Kind, cutoff(now, p.IdleDays), MaxSuggestions+1)
+		if err != nil {
+			return nil, fmt.Errorf("find %s: %w", p.Kind, err)
+		}
+		sum := Summary{Kind: p.Kind, IdleDays: p.IdleDays, AutoCleanup: p.Enabled}
+		if len(found) > MaxSuggestions {
+			found, sum.Truncated = found[:MaxSuggestions], true
+		}
+		for _, r := range found {
+			s := Suggestion{StaleResource: r, Action: Actions[r.Kind], MonthlySavingsUSD: MonthlyCost(r.Bytes, a.costPerGBMonth)}
+			report.Suggestions = append(report.Suggestions, s)
+			sum.Count++
+			sum.Bytes += r.Bytes
+			sum.MonthlySavingsUSD += s.MonthlySavingsUSD
+		}
+		report.Summaries = append(report.Summaries, sum)
+		report.Bytes += sum.Bytes
+		report.MonthlySavingsUSD += sum.MonthlySavingsUSD
+	}
+	sort.SliceStable(report.Suggestions, func(i, j int) bool {
+		return report.Suggestions[i].Bytes > report.Suggestions[j].Bytes
+	})
+	return report, nil
+}
+
+// Apply cleans up the stale resources of every kind whose policy is
+// enabled, at most MaxCleanups of each, and returns how many it cleaned
+// up. A resource that could not be cleaned up is skipped and reported in
+// the error once the run is over.
+func (a *Analyzer) Apply(ctx context.Context, now time.Time) (int64, error) {
+	policies, err := a.Policies(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("read cleanup policies: %w", err)
+	}
+	var cleaned int64
+	var firstErr error
+	for _, p := range policies {
+		if !p.Enabled {
+			continue
+		}
+		before := cutoff(now, p.IdleDays)
+		found, err := a.find(ctx, p.Kind, before, MaxCleanups)
+		if err != nil {
+			firstErr = firstError(firstErr, fmt.Errorf("find %s: %w", p.Kind, err))
+			continue
+		}
+		for _, r := range found {
+			ok, err := a.clean(ctx, r, before)
+			if err != nil {
+				firstErr = firstError(firstErr, fmt.Errorf("clean up %s %d: %w", r.Kind, r.ID, err))
+				continue
+			}
+			if ok {
+				cleaned++
+			}
+		}
+	}
+	return cleaned, firstErr
+}
+
+func (a *Analyzer) find(ctx context.Context, kind models.StaleKind, before time.Time, limit int) ([]models.StaleResource, error) {
+	switch kind {
+	case models.StaleDataset:
+		return a.store.UnusedDatasets(ctx, before, limit)
+	case models.StaleOutput:
+		return a.store.OrphanedOutputs(ctx, before, limit)
+	case models.StaleAPIKey:
+		return a.store.UnusedAPIKeys(ctx, before, limit)
+	case models.StaleCustomModel:
+		return a.store.IdleCustomModels(ctx, before, limit)
+	}
+	return nil, fmt.Errorf("unknown kind %q", kind)
+}
+
+// clean cleans up one resource; its stored objects are deleted once
+// nothing points at them. A failed delete only leaves an object behind, so
+// it is logged rather than returned.
+func (a *Analyzer) clean(ctx context.Context, r models.StaleResource, before time.Time) (bool, error) {
+	if len(r.ObjectKeys) > 0 && a.objects == nil {
+		return false, nil
+	}
+	var ok bool
+	var err error
+	switch r.Kind {
+	case models.StaleDataset:
+		ok, err = a.store.ArchiveUnusedDataset(ctx, r, before)
+	case models.StaleOutput:
+		ok, err = a.store.ClearOrphanedOutput(ctx, r, before)
+	case models.StaleAPIKey:
+		ok, err = a.store.DeactivateUnusedAPIKey(ctx, r, before)
+	case models.StaleCustomModel:
+		ok, err = a.store.ArchiveIdleCustomModel(ctx, r, before)
+	default:
+		return false, fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	if !ok || err != nil {
+		return false, err
+	}
+	for _, key := range r.ObjectKeys {
+		if err := a.objects.DeleteObject(ctx, key); err != nil {
+			a.logger.Warn("failed to delete stale object", zap.String("kind", string(r.Kind)), zap.Int64("id", r.ID), zap.String("key", key), zap.Error(err))
+		}
+	}
+	return true, nil
+}
+
+func cutoff(now time.Time, idleDays int) time.Time {
+	return now.AddDate(0, 0, -idleDays)
+}
+
+func firstError(first, err error) error {
+	if first != nil {
+		return first
+	}
+	return err
+}
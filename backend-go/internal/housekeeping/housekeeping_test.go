@@ -0,0 +1,167 @@
+// Package housekeeping_test provides unit tests for stale resource cleanup
+package housekeeping_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/housekeeping"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeStore struct {
+	policies []models.CleanupPolicy
+	stale    map[models.StaleKind][]models.StaleResource
+	// befores records the cutoff each kind was looked up with
+	befores map[models.StaleKind]time.Time
+	cleaned []models.StaleResource
+	failing bool
+}
+
+func (s *fakeStore) Policies(context.Context) ([]models.CleanupPolicy, error) {
+	return s.policies, nil
+}
+
+func (s *fakeStore) list(kind models.StaleKind, before time.Time, limit int) ([]models.StaleResource, error) {
+	if s.befores == nil {
+		s.befores = map[models.StaleKind]time.Time{}
+	}
+	s.befores[kind] = before
+	out := s.stale[kind]
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *fakeStore) UnusedDatasets(_ context.Context, before time.Time, limit int) ([]models.StaleResource, error) {
+	return s.list(models.StaleDataset, before, limit)
+}
+
+func (s *fakeStore) OrphanedOutputs(_ context.Context, before time.Time, limit int) ([]models.StaleResource, error) {
+	return s.list(models.StaleOutput, before, limit)
+}
+
+func (s *fakeStore) UnusedAPIKeys(_ context.Context, before time.Time, limit int) ([]models.StaleResource, error) {
+	return s.list(models.StaleAPIKey, before, limit)
+}
+
+func (s *fakeStore) IdleCustomModels(_ context.Context, before time.Time, limit int) ([]models.StaleResource, error) {
+	return s.list(models.StaleCustomModel, before, limit)
+}
+
+func (s *fakeStore) clean(r models.StaleResource) (bool, error) {
+	if s.failing {
+		return false, errors.New("database unavailable")
+	}
+	s.cleaned = append(s.cleaned, r)
+	return true, nil
+}
+
+func (s *fakeStore) ArchiveUnusedDataset(_ context.Context, r models.StaleResource, _ time.Time) (bool, error) {
+	return s.clean(r)
+}
+
+func (s *fakeStore) ClearOrphanedOutput(_ context.Context, r models.StaleResource, _ time.Time) (bool, error) {
+	return s.clean(r)
+}
+
+func (s *fakeStore) DeactivateUnusedAPIKey(_ context.Context, r models.StaleResource, _ time.Time) (bool, error) {
+	return s.clean(r)
+}
+
+func (s *fakeStore) ArchiveIdleCustomModel(_ context.Context, r models.StaleResource, _ time.Time) (bool, error) {
+	return s.clean(r)
+}
+
+type fakeObjects []string
+
+func (f *fakeObjects) DeleteObject(_ context.Context, key string) error {
+	*f = append(*f, key)
+	return nil
+}
+
+var now = time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+func newStore() *fakeStore {
+	return &fakeStore{stale: map[models.StaleKind][]models.StaleResource{
+		models.StaleDataset: {
+			{Kind: models.StaleDataset, ID: 1, Bytes: 2e9, ObjectKeys: []string{"datasets/7/1/a.csv"}},
+		},
+		models.StaleOutput: {
+			{Kind: models.StaleOutput, ID: 40, Bytes: 5e9, ObjectKeys: []string{"outputs/7/40.enc", "outputs/7/40.parquet.enc"}},
+		},
+		models.StaleAPIKey: {
+			{Kind: models.StaleAPIKey, ID: 3},
+		},
+	}}
+}
+
+func TestSuggest(t *testing.T) {
+	store := newStore()
+	store.policies = []models.CleanupPolicy{{Kind: models.StaleDataset, Enabled: true, IdleDays: 120}}
+	a := housekeeping.NewAnalyzer(store, nil, 0.02, zap.NewNop())
+
+	report, err := a.Suggest(context.Background(), now)
+	require.NoError(t, err)
+	require.Len(t, report.Suggestions, 3)
+	assert.Equal(t, int64(40), report.Suggestions[0].ID, "largest savings first")
+	assert.Equal(t, "delete_output", report.Suggestions[0].Action)
+	assert.InDelta(t, 0.1, report.Suggestions[0].MonthlySavingsUSD, 1e-9)
+	assert.Equal(t, int64(7e9), report.Bytes)
+	assert.InDelta(t, 0.14, report.MonthlySavingsUSD, 1e-9)
+
+	require.Len(t, report.Summaries, len(models.StaleKinds))
+	assert.Equal(t, housekeeping.Summary{Kind: models.StaleDataset, Count: 1, Bytes: 2e9, MonthlySavingsUSD: 0.04, IdleDays: 120, AutoCleanup: true}, report.Summaries[0])
+	assert.Equal(t, now.AddDate(0, 0, -120), store.befores[models.StaleDataset], "the policy's idle days apply")
+	assert.Equal(t, now.AddDate(0, 0, -30), store.befores[models.StaleAPIKey], "kinds without a policy use the defaults")
+	assert.Zero(t, report.Summaries[3].Count)
+	assert.Empty(t, store.cleaned, "suggesting cleans nothing up")
+
+	report, err = a.Suggest(context.Background(), now, models.StaleAPIKey)
+	require.NoError(t, err)
+	require.Len(t, report.Summaries, 1)
+	assert.Equal(t, "deactivate", report.Suggestions[0].Action)
+}
+
+func TestApplyCleansEnabledKinds(t *testing.T) {
+	store := newStore()
+	store.policies = []models.CleanupPolicy{
+		{Kind: models.StaleOutput, Enabled: true, IdleDays: 7},
+		{Kind: models.StaleAPIKey, Enabled: false, IdleDays: 30},
+	}
+	objects := &fakeObjects{}
+	n, err := housekeeping.NewAnalyzer(store, objects, 0.02, zap.NewNop()).Apply(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	require.Len(t, store.cleaned, 1)
+	assert.Equal(t, int64(40), store.cleaned[0].ID)
+	assert.Equal(t, []string{"outputs/7/40.enc", "outputs/7/40.parquet.enc"}, []string(*objects))
+}
+
+func TestApplyWithoutObjectStorage(t *testing.T) {
+	store := newStore()
+	store.policies = []models.CleanupPolicy{
+		{Kind: models.StaleDataset, Enabled: true, IdleDays: 90},
+		{Kind: models.StaleAPIKey, Enabled: true, IdleDays: 30},
+	}
+	n, err := housekeeping.NewAnalyzer(store, nil, 0.02, zap.NewNop()).Apply(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n, "resources with stored objects are kept when they cannot be deleted")
+	require.Len(t, store.cleaned, 1)
+	assert.Equal(t, models.StaleAPIKey, store.cleaned[0].Kind)
+}
+
+func TestApplyReportsFailures(t *testing.T) {
+	store := newStore()
+	store.failing = true
+	store.policies = []models.CleanupPolicy{{Kind: models.StaleAPIKey, Enabled: true, IdleDays: 30}}
+	n, err := housekeeping.NewAnalyzer(store, &fakeObjects{}, 0.02, zap.NewNop()).Apply(context.Background(), now)
+	require.Error(t, err)
+	assert.Zero(t, n)
+}
@@ -0,0 +1,212 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rbac"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+)
+
+// AccessDeps checks permissions and manages roles
+type AccessDeps struct {
+	Roles     *repo.RoleRepo
+	Users     *repo.UserRepo
+	AuditLogs *repo.AuditLogRepo
+}
+
+type RoleRequest struct {
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type UserRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+// principal resolves what the caller may do from the account behind their
+// session or API key, once per request. Permissions come from the database
+// rather than the token, so a changed role applies to the next request.
+func principal(c *fiber.Ctx, roles *repo.RoleRepo) (*rbac.Principal, error) {
+	if p, ok := c.Locals("principal").(*rbac.Principal); ok {
+		return p, nil
+	}
+	owner, _ := c.Locals("user_id").(int64)
+	held, perms, err := roles.Resolve(context.Background(), owner)
+	if err != nil {
+		return nil, err
+	}
+	p := &rbac.Principal{UserID: owner, Roles: held, Permissions: perms}
+	claims, _ := c.Locals("claims").(map[string]any)
+	if scopes, ok := claims["scopes"].([]string); ok && len(scopes) > 0 {
+		p.Scopes = make(rbac.Set, 0, len(scopes))
+		for _, s := range scopes {
+			p.Scopes = append(p.Scopes, rbac.Permission(s))
+		}
+	}
+	c.Locals("principal", p)
+	return p, nil
+}
+
+// Require runs next only for callers holding perm; it goes after
+// AuthMiddleware
+func (d AccessDeps) Require(perm rbac.Permission, next fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		owner, _ := c.Locals("user_id").(int64)
+		if owner == 0 {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+		}
+		p, err := principal(c, d.Roles)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "permission_check_failed"})
+		}
+		if !p.Can(perm) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "permission_denied", "permission": perm})
+		}
+		return next(c)
+	}
+}
+
+// RequirePermission is Require as middleware, for route groups
+func (d AccessDeps) RequirePermission(perm rbac.Permission) fiber.Handler {
+	return d.Require(perm, func(c *fiber.Ctx) error { return c.Next() })
+}
+
+// MyPermissions returns the caller's roles and the permissions they hold
+// through them, narrowed by the scopes of the API key in use
+func (d AccessDeps) MyPermissions(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	p, err := principal(c, d.Roles)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(fiber.Map{"roles": p.Roles, "permissions": p.Effective(), "scopes": p.Scopes})
+}
+
+// ListPermissions lists every permission a role can grant
+func (d AccessDeps) ListPermissions(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"permissions": rbac.Catalog})
+}
+
+// ListRoles lists the roles and their permissions
+func (d AccessDeps) ListRoles(c *fiber.Ctx) error {
+	roles, err := d.Roles.List(context.Background())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(fiber.Map{"roles": roles})
+}
+
+// PutRole creates a role or replaces its permissions
+func (d AccessDeps) PutRole(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	name := strings.ToLower(c.Params("name"))
+	if err := rbac.ValidRoleName(name); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_role_name"})
+	}
+	var body RoleRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	perms, err := rbac.ParseAll(body.Permissions)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown_permission"})
+	}
+	ctx := context.Background()
+	role, err := d.Roles.Put(ctx, name, strings.TrimSpace(body.Description), perms)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	d.audit(ctx, c, owner, "role_updated", "role", name, map[string]any{"permissions": perms})
+	return c.JSON(role)
+}
+
+// DeleteRole removes a role that is not built in
+func (d AccessDeps) DeleteRole(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	name := strings.ToLower(c.Params("name"))
+	ctx := context.Background()
+	switch err := d.Roles.Delete(ctx, name); {
+	case errors.Is(err, sql.ErrNoRows):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role_not_found"})
+	case errors.Is(err, repo.ErrBuiltinRole):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "builtin_role"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	d.audit(ctx, c, owner, "role_deleted", "role", name, nil)
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GetUserRoles returns a user's account role and the roles assigned on top
+func (d AccessDeps) GetUserRoles(c *fiber.Ctx) error {
+	ctx := context.Background()
+	user, err := d.Users.GetByID(ctx, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user_not_found"})
+	}
+	assigned, err := d.Roles.UserRoles(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(fiber.Map{"user_id": user.ID, "account_role": user.Role, "roles": assigned})
+}
+
+// SetUserRoles replaces the roles assigned to a user on top of their
+// account role
+func (d AccessDeps) SetUserRoles(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	var body UserRolesRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	ctx := context.Background()
+	user, err := d.Users.GetByID(ctx, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user_not_found"})
+	}
+	roles := []string{}
+	seen := map[string]bool{}
+	for _, r := range body.Roles {
+		r = strings.ToLower(strings.TrimSpace(r))
+		if r != "" && !seen[r] {
+			seen[r] = true
+			roles = append(roles, r)
+		}
+	}
+	err = d.Roles.SetUserRoles(ctx, user.ID, roles, owner)
+	if errors.Is(err, repo.ErrUnknownRole) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown_role"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	d.audit(ctx, c, owner, "user_roles_updated", "user", strconv.FormatInt(user.ID, 10), map[string]any{"roles": roles})
+	return c.JSON(fiber.Map{"user_id": user.ID, "account_role": user.Role, "roles": roles})
+}
+
+func (d AccessDeps) audit(ctx context.Context, c *fiber.Ctx, userID int64, action, resource, resourceID string, meta map[string]any) {
+	if d.AuditLogs == nil {
+		return
+	}
+	raw, _ := json.Marshal(meta)
+	_, _ = d.AuditLogs.Insert(ctx, &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   resource,
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+}
@@ -0,0 +1,322 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/accounts"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/services"
+)
+
+type AccountDeps struct {
+	Users        *repo.UserRepo
+	Accounts     *repo.AccountRepo
+	AuditLogs    *repo.AuditLogRepo
+	EmailService *services.EmailService
+	Tx           *repo.Transactor
+	// EmailChangeHold is how long a verified email change waits before it
+	// takes effect; zero uses accounts.DefaultEmailChangeHold
+	EmailChangeHold time.Duration
+}
+
+type EmailChangeRequest struct {
+	NewEmail string `json:"new_email"`
+	Password string `json:"password"`
+}
+
+type AccountTokenRequest struct {
+	Token string `json:"token"`
+}
+
+type AccountMergeRequest struct {
+	Email string `json:"email"`
+}
+
+// RequestEmailChange starts moving the caller's account to a new address.
+// The new address gets a link to verify it and the current one a link to
+// cancel the change.
+func (d AccountDeps) RequestEmailChange(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body EmailChangeRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	newEmail := accounts.NormalizeEmail(body.NewEmail)
+	if verr := ValidateEmail(newEmail); verr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_email", "detail": verr.Message})
+	}
+	ctx := context.Background()
+	user, err := d.Users.GetByID(ctx, owner)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user_not_found"})
+	}
+	// A stolen session alone must not be enough to take over the account
+	if bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(body.Password)) != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_credentials"})
+	}
+	switch err := accounts.CheckEmailChange(user, newEmail); {
+	case errors.Is(err, accounts.ErrSameEmail):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "same_email"})
+	case err != nil:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "account_disabled"})
+	}
+	if existing, err := d.Users.GetByEmail(ctx, newEmail); err == nil && existing != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "email_already_exists"})
+	}
+	token, tokenHash, err := accounts.NewToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
+	}
+	cancelToken, cancelHash, err := accounts.NewToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
+	}
+	var change *models.EmailChange
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		change, err = d.Accounts.CreateEmailChange(ctx, &models.EmailChange{
+			UserID:     owner,
+			OldEmail:   user.Email,
+			NewEmail:   newEmail,
+			TokenHash:  tokenHash,
+			CancelHash: cancelHash,
+			ExpiresAt:  time.Now().Add(accounts.EmailChangeTokenTTL),
+		})
+		if err != nil {
+			return err
+		}
+		return d.audit(ctx, c, owner, "email_change_requested", "email_change", change.ID, map[string]any{
+			"old_email": change.OldEmail,
+			"new_email": change.NewEmail,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	if d.EmailService != nil {
+		_ = d.EmailService.SendEmailChangeVerification(change.NewEmail, token)
+		_ = d.EmailService.SendEmailChangeNotice(change.OldEmail, change.NewEmail, cancelToken)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "verification_sent", "email_change": change})
+}
+
+// GetEmailChange returns the caller's email change still waiting for
+// verification or for its hold to end
+func (d AccountDeps) GetEmailChange(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	change, err := d.Accounts.OpenEmailChange(context.Background(), owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(change)
+}
+
+// CancelEmailChange withdraws the caller's open email change
+func (d AccountDeps) CancelEmailChange(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	return d.cancelEmailChange(c, func(ctx context.Context) (*models.EmailChange, error) {
+		return d.Accounts.CancelEmailChange(ctx, owner, "cancelled_by_user")
+	})
+}
+
+// ConfirmEmailChange verifies the new address with the token emailed to it.
+// The change then waits out the security hold before it takes effect.
+func (d AccountDeps) ConfirmEmailChange(c *fiber.Ctx) error {
+	var body AccountTokenRequest
+	if err := c.BodyParser(&body); err != nil || body.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	hold := d.EmailChangeHold
+	if hold <= 0 {
+		hold = accounts.DefaultEmailChangeHold
+	}
+	var change *models.EmailChange
+	err := d.Tx.WithTx(context.Background(), func(ctx context.Context) error {
+		var err error
+		if change, err = d.Accounts.VerifyEmailChange(ctx, accounts.HashToken(body.Token), hold); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, change.UserID, "email_change_verified", "email_change", change.ID, map[string]any{
+			"new_email":    change.NewEmail,
+			"effective_at": change.EffectiveAt,
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_or_expired_token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "verify_failed"})
+	}
+	return c.JSON(fiber.Map{"message": "email_change_verified", "email_change": change})
+}
+
+// CancelEmailChangeByToken stops an email change from the link sent to the
+// old address, so its owner can stop a takeover without signing in
+func (d AccountDeps) CancelEmailChangeByToken(c *fiber.Ctx) error {
+	var body AccountTokenRequest
+	if err := c.BodyParser(&body); err != nil || body.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	return d.cancelEmailChange(c, func(ctx context.Context) (*models.EmailChange, error) {
+		return d.Accounts.CancelEmailChangeByToken(ctx, accounts.HashToken(body.Token), "cancelled_from_old_address")
+	})
+}
+
+func (d AccountDeps) cancelEmailChange(c *fiber.Ctx, cancel func(ctx context.Context) (*models.EmailChange, error)) error {
+	var change *models.EmailChange
+	err := d.Tx.WithTx(context.Background(), func(ctx context.Context) error {
+		var err error
+		if change, err = cancel(ctx); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, change.UserID, "email_change_cancelled", "email_change", change.ID, map[string]any{
+			"new_email": change.NewEmail,
+			"reason":    change.CancelReason,
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "cancel_failed"})
+	}
+	return c.JSON(fiber.Map{"message": "email_change_cancelled", "email_change": change})
+}
+
+// RequestMerge asks to fold the account registered under an email, such as
+// one created by signing in with SSO, into the caller's account. The other
+// account's address gets a token that the caller confirms the merge with.
+func (d AccountDeps) RequestMerge(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body AccountMergeRequest
+	if err := c.BodyParser(&body); err != nil || body.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	ctx := context.Background()
+	target, err := d.Users.GetByID(ctx, owner)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user_not_found"})
+	}
+	source, err := d.Users.GetByEmail(ctx, accounts.NormalizeEmail(body.Email))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "account_not_found"})
+	}
+	switch err := accounts.CheckMerge(source, target); {
+	case errors.Is(err, accounts.ErrSameAccount):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "same_account"})
+	case err != nil:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "account_inactive"})
+	}
+	token, tokenHash, err := accounts.NewToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
+	}
+	var merge *models.AccountMerge
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		merge, err = d.Accounts.CreateMerge(ctx, &models.AccountMerge{
+			TargetUserID: target.ID,
+			SourceUserID: source.ID,
+			SourceEmail:  source.Email,
+			TokenHash:    tokenHash,
+			ExpiresAt:    time.Now().Add(accounts.MergeTokenTTL),
+		})
+		if err != nil {
+			return err
+		}
+		return d.audit(ctx, c, owner, "account_merge_requested", "account_merge", merge.ID, map[string]any{
+			"source_user_id": source.ID,
+			"source_email":   source.Email,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	if d.EmailService != nil {
+		_ = d.EmailService.SendAccountMergeEmail(source.Email, target.Email, token)
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "merge_approval_sent", "merge": merge})
+}
+
+// ConfirmMerge completes a merge with the token sent to the other account.
+// Its datasets, jobs, API keys, subscriptions and billing history move to
+// the caller and it is deactivated; both accounts get an audit record of
+// what moved.
+func (d AccountDeps) ConfirmMerge(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body AccountTokenRequest
+	if err := c.BodyParser(&body); err != nil || body.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	var merge *models.AccountMerge
+	err := d.Tx.WithTx(context.Background(), func(ctx context.Context) error {
+		var err error
+		if merge, err = d.Accounts.CompleteMerge(ctx, owner, accounts.HashToken(body.Token)); err != nil {
+			return err
+		}
+		if err := d.audit(ctx, c, merge.TargetUserID, "account_merged", "account_merge", merge.ID, map[string]any{
+			"source_user_id": merge.SourceUserID,
+			"source_email":   merge.SourceEmail,
+			"transferred":    merge.Transferred,
+		}); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, merge.SourceUserID, "account_merged_into", "account_merge", merge.ID, map[string]any{
+			"target_user_id": merge.TargetUserID,
+			"transferred":    merge.Transferred,
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_or_expired_token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "merge_failed"})
+	}
+	return c.JSON(fiber.Map{"message": "accounts_merged", "merge": merge})
+}
+
+// audit records an email change or merge event against a user
+func (d AccountDeps) audit(ctx context.Context, c *fiber.Ctx, userID int64, action, resource string, id int64, meta map[string]any) error {
+	if d.AuditLogs == nil {
+		return nil
+	}
+	raw, _ := json.Marshal(meta)
+	resourceID := strconv.FormatInt(id, 10)
+	_, err := d.AuditLogs.Insert(ctx, &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   resource,
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+	return err
+}
@@ -2,30 +2,48 @@ package v1
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/analytics"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/egress"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rbac"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/usage"
 	"github.com/gofiber/fiber/v2"
 )
 
-type AdminDeps struct{ Users *repo.UserRepo }
-
-func (a AdminDeps) RequireAdmin(next fiber.Handler) fiber.Handler {
-	return func(c *fiber.Ctx) error {
-		claims, _ := c.Locals("claims").(map[string]any)
-		if claims == nil || claims["role"] != "admin" {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "admin_required"})
-		}
-		return next(c)
-	}
-}
-
-func (a AdminDeps) ListUsers(c *fiber.Ctx) error {
-	users, err := a.Users.List(context.Background(), 100, 0)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
-	}
-	return c.JSON(users)
+type AdminDeps struct {
+	Users                 *repo.UserRepo
+	AnonymizationPolicies *repo.AnonymizationPolicyRepo
+	Reports               *repo.ReportRepo
+	ReportScheduler       *analytics.ReportScheduler
+	Subscriptions         *repo.UserSubscriptionRepo
+	DataPolicies          *repo.DataPolicyRepo
+	OrgSettings           *repo.OrgSettingsRepo
+	// Orgs keeps organization memberships in step with admin assignments
+	Orgs *repo.OrgRepo
+	// Roles checks that an account role exists and that the caller may grant it
+	Roles *repo.RoleRepo
+	// Egress vets report webhook URLs
+	Egress *egress.Gateway
+	// Usage, Generations and Datasets show support what a user has and uses
+	Usage       *usage.UsageService
+	Generations *repo.GenerationRepo
+	Datasets    *repo.DatasetRepo
+	// QuotaOverrides holds the limits granted in place of users' plans
+	QuotaOverrides *repo.QuotaOverrideRepo
+	AuditLogs      *repo.AuditLogRepo
+	// Keys signs impersonation tokens; Blacklist revokes them and the
+	// sessions of suspended users, for SessionTTL, the longest a session
+	// lasts
+	Keys       *auth.KeyRing
+	Blacklist  *auth.Blacklist
+	SessionTTL time.Duration
 }
 
 func (a AdminDeps) UpdateUserStatus(c *fiber.Ctx) error {
@@ -39,11 +57,27 @@ func (a AdminDeps) UpdateUserStatus(c *fiber.Ctx) error {
 	}
 	if body.Status != "" {
 		active := body.Status == "active"
-		if err := a.Users.UpdateActive(context.Background(), parseID(idParam), active); err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+		if err := a.setActive(context.Background(), parseID(idParam), active); err != nil {
+			return setActiveError(c, err)
 		}
 	}
 	if body.Role != "" {
+		// Changing an account role changes permissions, which only role
+		// managers may do
+		p, err := principal(c, a.Roles)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "permission_check_failed"})
+		}
+		if !p.Can(rbac.AdminRoles) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "permission_denied", "permission": rbac.AdminRoles})
+		}
+		role, err := a.Roles.Get(context.Background(), body.Role)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !role.Builtin) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown_role"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+		}
 		if err := a.Users.UpdateRole(context.Background(), parseID(idParam), body.Role); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
 		}
@@ -58,4 +92,66 @@ func (a AdminDeps) DeleteUser(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "deleted"})
 }
 
+// GetAnonymizationPolicy returns the stored IP/user agent anonymization policy of an organization
+func (a AdminDeps) GetAnonymizationPolicy(c *fiber.Ctx) error {
+	orgID := parseID(c.Params("id"))
+	if orgID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	p, err := a.AnonymizationPolicies.GetByOrgID(context.Background(), orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(p)
+}
+
+// UpdateAnonymizationPolicy creates or replaces the anonymization policy of an organization
+func (a AdminDeps) UpdateAnonymizationPolicy(c *fiber.Ctx) error {
+	orgID := parseID(c.Params("id"))
+	if orgID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	var body struct {
+		IPMode             models.AnonymizationMode `json:"ip_mode"`
+		UserAgentMode      models.AnonymizationMode `json:"user_agent_mode"`
+		AnonymizeAfterDays int                      `json:"anonymize_after_days"`
+		EUTenant           bool                     `json:"eu_tenant"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if !validAnonymizationMode(body.IPMode) || !validAnonymizationMode(body.UserAgentMode) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_mode"})
+	}
+	if body.AnonymizeAfterDays < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_period"})
+	}
+	// EU tenants are always anonymized on write and may not opt out of it
+	if body.EUTenant && (body.IPMode == models.AnonymizeNone || body.UserAgentMode == models.AnonymizeNone) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "eu_requires_anonymization"})
+	}
+	p, err := a.AnonymizationPolicies.Upsert(context.Background(), &models.AnonymizationPolicy{
+		OrgID:              orgID,
+		IPMode:             body.IPMode,
+		UserAgentMode:      body.UserAgentMode,
+		AnonymizeAfterDays: body.AnonymizeAfterDays,
+		EUTenant:           body.EUTenant,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(p)
+}
+
+func validAnonymizationMode(m models.AnonymizationMode) bool {
+	switch m {
+	case models.AnonymizeNone, models.AnonymizeTruncate, models.AnonymizeHash:
+		return true
+	}
+	return false
+}
+
 func parseID(s string) int64 { var id int64; _, _ = fmt.Sscanf(s, "%d", &id); return id }
@@ -0,0 +1,469 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pricing"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// ImpersonatorClaim names the staff member behind an impersonation
+	// token
+	ImpersonatorClaim = "imp"
+	// ImpersonationTTL is how long an impersonation token lasts; it cannot
+	// be refreshed
+	ImpersonationTTL = 30 * time.Minute
+	// maxAdminReason bounds the reasons staff give for account changes
+	maxAdminReason = 500
+)
+
+// ListUsers searches users by part of their email, name or company (q),
+// subscription tier and status (active or suspended), newest first
+func (a AdminDeps) ListUsers(c *fiber.Ctx) error {
+	s := repo.UserSearch{
+		Query:  c.Query("q"),
+		Tier:   models.SubscriptionTier(c.Query("tier")),
+		Limit:  c.QueryInt("limit", 100),
+		Offset: c.QueryInt("offset", 0),
+	}
+	if s.Tier != "" && !validTier(s.Tier) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown_tier"})
+	}
+	switch c.Query("status") {
+	case "":
+	case "active", "suspended":
+		active := c.Query("status") == "active"
+		s.Active = &active
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_status"})
+	}
+	if s.Limit <= 0 || s.Limit > 500 {
+		s.Limit = 100
+	}
+	if s.Offset < 0 {
+		s.Offset = 0
+	}
+	users, err := a.Users.Search(context.Background(), s)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(users)
+}
+
+// GetUser returns an account with its organization, usage against its
+// limits and any quota override
+func (a AdminDeps) GetUser(c *fiber.Ctx) error {
+	ctx := context.Background()
+	user, ok, err := a.targetUser(c)
+	if !ok {
+		return err
+	}
+	orgID, err := a.Users.GetOrgID(ctx, user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	out := fiber.Map{"user": user, "org_id": orgID}
+	if a.Usage != nil {
+		stats, err := a.Usage.GetUsageStats(ctx, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_lookup_failed"})
+		}
+		out["usage"] = stats
+	}
+	if a.QuotaOverrides != nil {
+		o, err := a.QuotaOverrides.Get(ctx, user.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+		}
+		out["quota_override"] = o
+	}
+	return c.JSON(out)
+}
+
+// ListUserJobs lists a user's generation jobs, newest first
+func (a AdminDeps) ListUserJobs(c *fiber.Ctx) error {
+	if a.Generations == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	user, ok, err := a.targetUser(c)
+	if !ok {
+		return err
+	}
+	limit, offset := pageParams(c)
+	jobs, err := a.Generations.ListByOwner(context.Background(), user.ID, limit, offset)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if jobs == nil {
+		jobs = []models.GenerationJob{}
+	}
+	return c.JSON(fiber.Map{"jobs": jobs})
+}
+
+// ListUserDatasets lists the datasets a user owns
+func (a AdminDeps) ListUserDatasets(c *fiber.Ctx) error {
+	if a.Datasets == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	user, ok, err := a.targetUser(c)
+	if !ok {
+		return err
+	}
+	limit, offset := pageParams(c)
+	datasets, err := a.Datasets.ListByOwner(context.Background(), user.ID, limit, offset)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if datasets == nil {
+		datasets = []models.Dataset{}
+	}
+	return c.JSON(fiber.Map{"datasets": datasets})
+}
+
+// SuspendUser disables an account and signs it out everywhere
+func (a AdminDeps) SuspendUser(c *fiber.Ctx) error {
+	staff, _ := c.Locals("user_id").(int64)
+	user, ok, err := a.targetUser(c)
+	if !ok {
+		return err
+	}
+	reason, ok, err := adminReason(c, true)
+	if !ok {
+		return err
+	}
+	if user.ID == staff {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot_suspend_self"})
+	}
+	if err := a.setActive(context.Background(), user.ID, false); err != nil {
+		return setActiveError(c, err)
+	}
+	a.audit(c, staff, "user_suspended", user.ID, map[string]any{"reason": reason})
+	return c.JSON(fiber.Map{"message": "suspended"})
+}
+
+// ReactivateUser lets a suspended account sign in again
+func (a AdminDeps) ReactivateUser(c *fiber.Ctx) error {
+	staff, _ := c.Locals("user_id").(int64)
+	user, ok, err := a.targetUser(c)
+	if !ok {
+		return err
+	}
+	reason, ok, err := adminReason(c, false)
+	if !ok {
+		return err
+	}
+	if err := a.setActive(context.Background(), user.ID, true); err != nil {
+		return setActiveError(c, err)
+	}
+	a.audit(c, staff, "user_reactivated", user.ID, map[string]any{"reason": reason})
+	return c.JSON(fiber.Map{"message": "reactivated"})
+}
+
+// SetUserSubscription changes a user's subscription tier by hand. The
+// payment provider is not told: its next subscription event for the user
+// sets the tier again.
+func (a AdminDeps) SetUserSubscription(c *fiber.Ctx) error {
+	staff, _ := c.Locals("user_id").(int64)
+	user, ok, err := a.targetUser(c)
+	if !ok {
+		return err
+	}
+	var body struct {
+		Tier   models.SubscriptionTier `json:"tier"`
+		Reason string                  `json:"reason"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if !validTier(body.Tier) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown_tier"})
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if body.Reason == "" || len(body.Reason) > maxAdminReason {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_reason"})
+	}
+	if err := a.Users.UpdateSubscriptionTier(context.Background(), user.ID, body.Tier); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	a.audit(c, staff, "subscription_tier_overridden", user.ID, map[string]any{
+		"from":   user.SubscriptionTier,
+		"to":     body.Tier,
+		"reason": body.Reason,
+	})
+	return c.JSON(fiber.Map{"user_id": user.ID, "subscription_tier": body.Tier})
+}
+
+// QuotaOverrideRequest replaces limits of a user's plan; omitted limits
+// keep the plan's
+type QuotaOverrideRequest struct {
+	MonthlyRowLimit *int64     `json:"monthly_row_limit"`
+	MaxDatasets     *int64     `json:"max_datasets"`
+	MaxCustomModels *int64     `json:"max_custom_models"`
+	APIRateLimit    *int64     `json:"api_rate_limit"`
+	Reason          string     `json:"reason"`
+	ExpiresAt       *time.Time `json:"expires_at"`
+}
+
+// GetQuotaOverride returns a user's quota override
+func (a AdminDeps) GetQuotaOverride(c *fiber.Ctx) error {
+	if a.QuotaOverrides == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	o, err := a.QuotaOverrides.Get(context.Background(), parseID(c.Params("id")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(o)
+}
+
+// SetQuotaOverride grants a user limits in place of their plan's. A limit
+// of 0 lifts it; the API rate limit must stay positive.
+func (a AdminDeps) SetQuotaOverride(c *fiber.Ctx) error {
+	if a.QuotaOverrides == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	staff, _ := c.Locals("user_id").(int64)
+	user, ok, err := a.targetUser(c)
+	if !ok {
+		return err
+	}
+	var body QuotaOverrideRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if body.MonthlyRowLimit == nil && body.MaxDatasets == nil && body.MaxCustomModels == nil && body.APIRateLimit == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "no_limits"})
+	}
+	for _, v := range []*int64{body.MonthlyRowLimit, body.MaxDatasets, body.MaxCustomModels} {
+		if v != nil && *v < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_limit"})
+		}
+	}
+	if body.APIRateLimit != nil && *body.APIRateLimit <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_limit"})
+	}
+	if body.ExpiresAt != nil && !body.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_expiry"})
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if body.Reason == "" || len(body.Reason) > maxAdminReason {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_reason"})
+	}
+	o, err := a.QuotaOverrides.Upsert(context.Background(), &models.QuotaOverride{
+		UserID:          user.ID,
+		MonthlyRowLimit: body.MonthlyRowLimit,
+		MaxDatasets:     body.MaxDatasets,
+		MaxCustomModels: body.MaxCustomModels,
+		APIRateLimit:    body.APIRateLimit,
+		Reason:          body.Reason,
+		GrantedBy:       staff,
+		ExpiresAt:       body.ExpiresAt,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	a.audit(c, staff, "quota_override_granted", user.ID, map[string]any{"override": o})
+	return c.JSON(o)
+}
+
+// DeleteQuotaOverride returns a user to their plan's limits
+func (a AdminDeps) DeleteQuotaOverride(c *fiber.Ctx) error {
+	if a.QuotaOverrides == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	staff, _ := c.Locals("user_id").(int64)
+	userID := parseID(c.Params("id"))
+	deleted, err := a.QuotaOverrides.Delete(context.Background(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	if !deleted {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	a.audit(c, staff, "quota_override_removed", userID, nil)
+	return c.JSON(fiber.Map{"message": "deleted"})
+}
+
+// Impersonate issues a short-lived access token acting as a user, for
+// support. The reason, the token's family and every change made with it
+// are audited under the staff member. Staff accounts cannot be
+// impersonated, and the token cannot be refreshed.
+func (a AdminDeps) Impersonate(c *fiber.Ctx) error {
+	if a.Keys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	staff, _ := c.Locals("user_id").(int64)
+	if impersonator, _ := c.Locals("impersonator_id").(int64); impersonator != 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "impersonation_forbidden"})
+	}
+	user, ok, err := a.targetUser(c)
+	if !ok {
+		return err
+	}
+	reason, ok, err := adminReason(c, true)
+	if !ok {
+		return err
+	}
+	if user.ID == staff {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "cannot_impersonate_self"})
+	}
+	if !user.IsActive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "account_disabled"})
+	}
+	_, perms, err := a.Roles.Resolve(context.Background(), user.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "permission_check_failed"})
+	}
+	if perms.Staff() {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "cannot_impersonate_staff"})
+	}
+
+	family := auth.NewTokenID()
+	claims := map[string]any{"user_id": user.ID, "sub": user.Email, "role": string(user.Role), "fid": family, ImpersonatorClaim: staff}
+	token, err := auth.CreateAccessToken(a.Keys, claims, int(ImpersonationTTL/time.Minute))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
+	}
+	expiresAt := time.Now().Add(ImpersonationTTL)
+	a.audit(c, staff, "impersonation_started", user.ID, map[string]any{
+		"reason":     reason,
+		"family":     family,
+		"expires_at": expiresAt,
+	})
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"access_token":     token,
+		"token_type":       "bearer",
+		"expires_at":       expiresAt,
+		"impersonation_id": family,
+		"user_id":          user.ID,
+	})
+}
+
+// EndImpersonation revokes an impersonation token before it expires
+func (a AdminDeps) EndImpersonation(c *fiber.Ctx) error {
+	staff, _ := c.Locals("user_id").(int64)
+	family := c.Params("id")
+	if family == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	if err := a.Blacklist.RevokeFamily(context.Background(), family, ImpersonationTTL); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "revoke_failed"})
+	}
+	a.audit(c, staff, "impersonation_ended", 0, map[string]any{"family": family})
+	return c.JSON(fiber.Map{"message": "ended"})
+}
+
+// DenyImpersonation refuses a route to impersonation tokens: support may act
+// as a user but not take over their credentials. It runs after
+// AuthMiddleware, which marks the requests made with such tokens.
+func DenyImpersonation(c *fiber.Ctx) error {
+	if staff, _ := c.Locals("impersonator_id").(int64); staff != 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "impersonation_forbidden"})
+	}
+	return c.Next()
+}
+
+// targetUser loads the user named in the path; ok is false when the
+// response was already written
+func (a AdminDeps) targetUser(c *fiber.Ctx) (*models.User, bool, error) {
+	id := parseID(c.Params("id"))
+	if id <= 0 {
+		return nil, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	user, err := a.Users.GetByID(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return nil, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "user_lookup_failed"})
+	}
+	user.HashedPassword = ""
+	return user, true, nil
+}
+
+// setActive enables or disables an account. Disabling it first revokes
+// every token issued to it so far, and fails without changing the account
+// when the revocation cannot be stored; its API keys stop working with the
+// account.
+func (a AdminDeps) setActive(ctx context.Context, userID int64, active bool) error {
+	if !active {
+		if err := a.Blacklist.RevokeUser(ctx, userID, time.Now(), a.SessionTTL); err != nil {
+			return err
+		}
+	}
+	return a.Users.UpdateActive(ctx, userID, active)
+}
+
+// setActiveError answers a failed setActive; an account cannot be suspended
+// while its sessions cannot be revoked
+func setActiveError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, auth.ErrRevocationUnavailable) {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "session_revocation_unavailable"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+}
+
+func (a AdminDeps) audit(c *fiber.Ctx, staff int64, action string, userID int64, meta map[string]any) {
+	if a.AuditLogs == nil {
+		return
+	}
+	raw, _ := json.Marshal(meta)
+	resourceID := strconv.FormatInt(userID, 10)
+	_, _ = a.AuditLogs.Insert(context.Background(), &models.AuditLog{
+		UserID:     &staff,
+		Action:     action,
+		Resource:   "user",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+}
+
+// adminReason reads the reason a staff member gave for a change; ok is
+// false when the response was already written
+func adminReason(c *fiber.Ctx, required bool) (string, bool, error) {
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return "", false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+		}
+	}
+	reason := strings.TrimSpace(body.Reason)
+	if (required && reason == "") || len(reason) > maxAdminReason {
+		return "", false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_reason"})
+	}
+	return reason, true, nil
+}
+
+func pageParams(c *fiber.Ctx) (limit, offset int) {
+	limit, offset = c.QueryInt("limit", 50), c.QueryInt("offset", 0)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return limit, max(offset, 0)
+}
+
+func validTier(t models.SubscriptionTier) bool {
+	for _, p := range pricing.SubscriptionPlans() {
+		if p.ID == string(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+// Package v1_test provides unit tests for what impersonation tokens may do
+package v1_test
+
+import (
+	"testing"
+
+	v1 "github.com/genovotechnologies/synthos_dev/backend-go/internal/http/v1"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImpersonationTokensCannotTakeOverCredentials(t *testing.T) {
+	keys := testKeys(t)
+	app := routerApp(keys, v1.Deps{})
+	// Staff member 2 acting as user 7
+	token := accessToken(t, keys, jwt.MapClaims{"user_id": 7, "fid": "f1", v1.ImpersonatorClaim: 2})
+
+	for _, route := range [][2]string{
+		{"POST", "/api/v1/auth/api-keys"},
+		{"POST", "/api/v1/auth/api-keys/4/rotate"},
+		{"PUT", "/api/v1/auth/api-keys/4/rotation"},
+		{"POST", "/api/v1/users/email-change"},
+		{"POST", "/api/v1/users/merge"},
+		{"POST", "/api/v1/users/merge/confirm"},
+	} {
+		status, body := callAs(t, app, route[0], route[1], token)
+		assert.Equal(t, fiber.StatusForbidden, status, route[1])
+		assert.Equal(t, "impersonation_forbidden", body["error"], route[1])
+	}
+
+	status, body := callAs(t, app, "POST", "/api/v1/auth/api-keys", "")
+	assert.Equal(t, fiber.StatusUnauthorized, status)
+	assert.Equal(t, "auth_required", body["error"])
+}
@@ -0,0 +1,195 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListAPIKeys lists the current user's API keys with their rotation state
+func (d AuthDeps) ListAPIKeys(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int64)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	keys, err := d.APIKeys.GetByUserID(context.Background(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+	return c.JSON(fiber.Map{"api_keys": keys})
+}
+
+// SetAPIKeyRotation makes a key auto-rotate every rotation_days with an
+// overlap of overlap_hours, or stops it auto-rotating when rotation_days
+// is null. The rotation period counts from now.
+func (d AuthDeps) SetAPIKeyRotation(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int64)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	keyID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	var body struct {
+		RotationDays *int `json:"rotation_days"`
+		OverlapHours int  `json:"overlap_hours"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	var dueAt *time.Time
+	if body.RotationDays != nil {
+		policy := auth.RotationPolicy{Days: *body.RotationDays, OverlapHours: body.OverlapHours}
+		if err := policy.Validate(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_rotation_policy"})
+		}
+		due := policy.DueAt(time.Now())
+		dueAt = &due
+	}
+
+	ctx := context.Background()
+	key, err := d.APIKeys.SetRotationPolicy(ctx, userID, keyID, body.RotationDays, body.OverlapHours, dueAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	d.auditKey(ctx, c, userID, "api_key_rotation_policy_set", key.ID, map[string]any{
+		"rotation_days": body.RotationDays,
+		"overlap_hours": body.OverlapHours,
+	})
+	return c.JSON(key)
+}
+
+// RotateAPIKey issues a successor to a key with the same name, scopes and
+// rotation policy. The old key keeps working for its overlap hours, or
+// overlap_hours when given, so clients can switch over; the new key is only
+// returned here.
+func (d AuthDeps) RotateAPIKey(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int64)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	keyID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	var body struct {
+		OverlapHours *int `json:"overlap_hours"`
+	}
+	_ = c.BodyParser(&body)
+
+	ctx := context.Background()
+	old, err := d.APIKeys.GetOwned(ctx, userID, keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "rotate_failed"})
+	}
+	if !old.IsActive || old.RotatedTo != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "already_rotated"})
+	}
+	if body.OverlapHours != nil {
+		if *body.OverlapHours < 0 || *body.OverlapHours > auth.MaxOverlapHours {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_rotation_policy"})
+		}
+		old.OverlapHours = *body.OverlapHours
+	}
+
+	now := time.Now()
+	successor := &models.APIKey{
+		UserID:       userID,
+		Name:         old.Name,
+		IsActive:     true,
+		ExpiresAt:    old.ExpiresAt,
+		Scopes:       old.Scopes,
+		RotationDays: old.RotationDays,
+		OverlapHours: old.OverlapHours,
+		RotatedFrom:  &old.ID,
+	}
+	if old.ExpiresAt != nil && !old.ExpiresAt.After(now) {
+		successor.ExpiresAt = nil
+	}
+	if old.RotationDays != nil {
+		due := auth.RotationPolicy{Days: *old.RotationDays}.DueAt(now)
+		successor.RotationDueAt = &due
+	}
+	rawKey := generateRandomString(48)
+	successor.KeyHash = auth.HashAPIKey(rawKey)
+	graceEnd := auth.OverlapEnd(old, now)
+
+	rec, err := d.APIKeys.Rotate(ctx, successor, graceEnd)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "already_rotated"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "rotate_failed"})
+	}
+	d.auditKey(ctx, c, userID, "api_key_rotated", old.ID, map[string]any{
+		"successor_id":    rec.ID,
+		"old_valid_until": graceEnd,
+	})
+	return c.JSON(fiber.Map{
+		"api_key":         rawKey,
+		"id":              rec.ID,
+		"name":            rec.Name,
+		"scopes":          rec.Scopes,
+		"rotation_due_at": rec.RotationDueAt,
+		"rotated_from":    old.ID,
+		"old_valid_until": graceEnd,
+	})
+}
+
+// AcknowledgeAPIKeyRotation confirms the owner's clients moved off a
+// rotated key, which stops it working before its overlap ends
+func (d AuthDeps) AcknowledgeAPIKeyRotation(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int64)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	keyID, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	ctx := context.Background()
+	key, err := d.APIKeys.AcknowledgeRotation(ctx, userID, keyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "not_rotated"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "acknowledge_failed"})
+	}
+	d.auditKey(ctx, c, userID, "api_key_rotation_acknowledged", key.ID, map[string]any{"successor_id": key.RotatedTo})
+	return c.JSON(key)
+}
+
+// auditKey records an API key lifecycle event
+func (d AuthDeps) auditKey(ctx context.Context, c *fiber.Ctx, userID int64, action string, keyID int64, meta map[string]any) {
+	if d.AuditLogs == nil {
+		return
+	}
+	raw, _ := json.Marshal(meta)
+	resourceID := strconv.FormatInt(keyID, 10)
+	_, _ = d.AuditLogs.Insert(ctx, &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   "api_key",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+}
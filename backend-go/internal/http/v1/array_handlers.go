@@ -0,0 +1,84 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/arrays"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errArraysUnavailable = errors.New("dataset rows are not readable for array column profiling")
+
+// arrayProfile profiles the array columns of a dataset's leading rows
+func arrayProfile(client storage.SignedURLProvider, ds *models.Dataset) ([]arrays.ColumnProfile, error) {
+	reader, ok := client.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" || (ds.FileType != "csv" && ds.FileType != "json") {
+		return nil, errArraysUnavailable
+	}
+	columns, rows, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+	if err != nil {
+		return nil, err
+	}
+	return arrays.Profile(columns, rows), nil
+}
+
+// GetArrayColumns returns the array columns of a dataset with their
+// encoding, list lengths and element distribution. Hidden columns are left
+// out.
+func (d DatasetDeps) GetArrayColumns(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.accessibleDataset(owner, id, models.DatasetPermRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	acl, err := d.columnACL(owner, ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+	}
+	profiles, err := arrayProfile(d.StorageClient, ds)
+	if errors.Is(err, errArraysUnavailable) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "dataset_not_readable"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	hidden := make(map[string]bool)
+	for _, col := range acl.Hidden() {
+		hidden[col] = true
+	}
+	out := make([]arrays.ColumnProfile, 0, len(profiles))
+	for _, p := range profiles {
+		if !hidden[strings.ToLower(p.Column)] {
+			out = append(out, p)
+		}
+	}
+	return c.JSON(fiber.Map{"dataset_id": id, "profile_rows": profileRows, "columns": out})
+}
+
+// arrayColumns profiles the array columns of a dataset for a job, at request
+// time like nested columns; a dataset that is not readable has none
+func (d GenerationDeps) arrayColumns(ds *models.Dataset, owner, datasetID int64) ([]arrays.ColumnProfile, error) {
+	if ds == nil {
+		if d.Datasets == nil {
+			return nil, nil
+		}
+		var err error
+		if ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, datasetID); err != nil {
+			return nil, err
+		}
+	}
+	profiles, err := arrayProfile(d.StorageClient, ds)
+	if errors.Is(err, errArraysUnavailable) {
+		return nil, nil
+	}
+	return profiles, err
+}
@@ -0,0 +1,78 @@
+package v1
+
+import (
+	"context"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// auditorRoutes are the only routes organization auditors may read: the
+// organization's configuration and audit trail, and the metadata, lineage
+// and reports of generation jobs; "*" stands for one path segment. Their
+// handlers check orgs.ActionInspect or orgs.ActionAudit, which auditors are
+// allowed, while contents need orgs.ActionRead, which they are not.
+var auditorRoutes = [][]string{
+	{"orgs", "current"},
+	{"orgs", "current", "members"},
+	{"orgs", "current", "usage"},
+	{"orgs", "current", "policies"},
+	{"orgs", "current", "branding"},
+	{"orgs", "current", "audit", "generations"},
+	{"generation", "jobs"},
+	{"generation", "jobs", "*"},
+	{"generation", "jobs", "*", "status"},
+	{"generation", "jobs", "*", "lineage"},
+	{"generation", "jobs", "*", "provenance"},
+	{"generation", "*", "status"},
+	{"generation", "*", "report"},
+	{"generation", "*", "signed-manifest"},
+}
+
+// RestrictAuditors holds organization auditors to reading auditorRoutes;
+// every other route, and every change, is refused. It runs after
+// AuthMiddleware, which sets the caller.
+func (d OrgDeps) RestrictAuditors(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 || d.Orgs == nil {
+		return c.Next()
+	}
+	member, err := orgMembership(context.Background(), d.Orgs, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "permission_check_failed"})
+	}
+	if member == nil || member.Role != models.OrgRoleAuditor {
+		return c.Next()
+	}
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+	default:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "auditor_read_only"})
+	}
+	if !auditorRoute(c.Path()) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "auditor_content_forbidden"})
+	}
+	return c.Next()
+}
+
+// auditorRoute reports whether path is one of auditorRoutes
+func auditorRoute(path string) bool {
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(path, "/api/v1"), "/"), "/")
+	for _, route := range auditorRoutes {
+		if len(route) != len(segments) {
+			continue
+		}
+		match := true
+		for i, s := range route {
+			if s != "*" && s != segments[i] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+// Package v1_test provides unit tests for keeping organization auditors to
+// metadata
+package v1_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	v1 "github.com/genovotechnologies/synthos_dev/backend-go/internal/http/v1"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func expectMembership(testDB *testutil.TestDB, userID int64, role models.OrgRole) {
+	testDB.Mock.ExpectQuery("FROM org_members m JOIN users u").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"org_id", "user_id", "email", "role", "team", "created_at"}).
+			AddRow(3, userID, "auditor@example.com", string(role), nil, time.Now()))
+}
+
+func TestAuditorsAreRefusedContents(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	keys := testKeys(t)
+	app := routerApp(keys, v1.Deps{Orgs: v1.OrgDeps{Orgs: repo.NewOrgRepo(testDB.DB)}})
+	token := accessToken(t, keys, jwt.MapClaims{"user_id": 12})
+
+	for _, path := range []string{
+		"/api/v1/datasets/5",
+		"/api/v1/datasets/5/preview",
+		"/api/v1/datasets/5/array-columns",
+		"/api/v1/datasets/5/hierarchies",
+		"/api/v1/datasets/5/relationships",
+		"/api/v1/datasets/vocabularies/2",
+		"/api/v1/generation/9/download",
+		"/api/v1/generation/jobs/9/grounding-sample",
+	} {
+		expectMembership(testDB, 12, models.OrgRoleAuditor)
+		status, body := callAs(t, app, "GET", path, token)
+		assert.Equal(t, fiber.StatusForbidden, status, path)
+		assert.Equal(t, "auditor_content_forbidden", body["error"], path)
+	}
+	testDB.AssertExpectations(t)
+}
+
+func TestAuditorsChangeNothing(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	keys := testKeys(t)
+	app := routerApp(keys, v1.Deps{Orgs: v1.OrgDeps{Orgs: repo.NewOrgRepo(testDB.DB)}})
+	token := accessToken(t, keys, jwt.MapClaims{"user_id": 12})
+
+	for _, route := range [][2]string{
+		{"POST", "/api/v1/generation/generate"},
+		{"DELETE", "/api/v1/datasets/5"},
+		{"PUT", "/api/v1/orgs/current/policies/generation"},
+		{"DELETE", "/api/v1/generation/jobs/9"},
+	} {
+		expectMembership(testDB, 12, models.OrgRoleAuditor)
+		status, body := callAs(t, app, route[0], route[1], token)
+		assert.Equal(t, fiber.StatusForbidden, status, route[1])
+		assert.Equal(t, "auditor_read_only", body["error"], route[1])
+	}
+	testDB.AssertExpectations(t)
+}
+
+func TestAuditorsReadOrganizationMetadata(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	keys := testKeys(t)
+	app := routerApp(keys, v1.Deps{Orgs: v1.OrgDeps{Orgs: repo.NewOrgRepo(testDB.DB)}})
+	token := accessToken(t, keys, jwt.MapClaims{"user_id": 12})
+
+	// Once by RestrictAuditors, once by the handler's own role check
+	expectMembership(testDB, 12, models.OrgRoleAuditor)
+	expectMembership(testDB, 12, models.OrgRoleAuditor)
+	testDB.Mock.ExpectQuery("FROM organizations WHERE id=").WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_by", "created_at"}).AddRow(3, "Acme", nil, time.Now()))
+	status, body := callAs(t, app, "GET", "/api/v1/orgs/current", token)
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "auditor", body["role"])
+	testDB.AssertExpectations(t)
+}
+
+func TestRestrictAuditorsLeavesOtherRolesToHandlers(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	keys := testKeys(t)
+	app := routerApp(keys, v1.Deps{Orgs: v1.OrgDeps{Orgs: repo.NewOrgRepo(testDB.DB)}})
+	token := accessToken(t, keys, jwt.MapClaims{"user_id": 12})
+
+	// A viewer reaches the handler, which has no template store here
+	expectMembership(testDB, 12, models.OrgRoleViewer)
+	status, _ := callAs(t, app, "POST", "/api/v1/generation/templates", token)
+	assert.Equal(t, fiber.StatusNotImplemented, status)
+	testDB.AssertExpectations(t)
+}
@@ -3,29 +3,38 @@ package v1
 import (
 	"context"
 	"crypto/rand"
-	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/config"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rbac"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/services"
 )
 
 type AuthDeps struct {
 	Cfg          *config.Config
+	Keys         *auth.KeyRing
 	Users        *repo.UserRepo
 	APIKeys      *repo.APIKeyRepo
 	AuditLogs    *repo.AuditLogRepo
 	AuthService  *auth.AdvancedAuthService
 	EmailService *services.EmailService
 	Blacklist    *auth.Blacklist
+	APIKeyGuard  *auth.APIKeyGuard
+	Security     *security.SecurityService
+	// Roles bounds the scopes of new API keys by the caller's permissions
+	Roles *repo.RoleRepo
 }
 
 type SignUpRequest struct {
@@ -85,15 +94,25 @@ func (d AuthDeps) SignIn(c *fiber.Ctx) error {
 	if bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(body.Password)) != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_credentials"})
 	}
-	claims := map[string]any{"user_id": user.ID, "sub": user.Email, "role": string(user.Role)}
-	access, err := auth.CreateAccessToken(d.Cfg.JwtSecret, d.Cfg.JwtAlg, claims, d.Cfg.JwtAccessMin)
+	// Suspended accounts and accounts merged into another stay signed out
+	if !user.IsActive {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "account_disabled"})
+	}
+	// Each sign-in starts a refresh token family of its own
+	family := auth.NewTokenID()
+	claims := map[string]any{"user_id": user.ID, "sub": user.Email, "role": string(user.Role), "fid": family}
+	access, err := auth.CreateAccessToken(d.Keys, claims, d.Cfg.JwtAccessMin)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
 	}
-	refresh, err := auth.CreateRefreshToken(d.Cfg.JwtSecret, d.Cfg.JwtAlg, claims, d.Cfg.JwtRefreshDays)
+	refreshClaims, refreshID := auth.RefreshClaims(claims, family)
+	refresh, err := auth.CreateRefreshToken(d.Keys, refreshClaims, d.Cfg.JwtRefreshDays)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
 	}
+	if err := d.Blacklist.StartFamily(ctx, family, refreshID, d.refreshTTL()); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
+	}
 
 	// HttpOnly cookie for access token (aligned to FE cookie usage)
 	c.Cookie(&fiber.Cookie{
@@ -116,13 +135,16 @@ func (d AuthDeps) SignIn(c *fiber.Ctx) error {
 	})
 }
 
-// RefreshToken exchanges a valid refresh token for a new access token
+// RefreshToken exchanges a refresh token for a new access token and the
+// next refresh token of its family. A refresh token works once: presenting
+// one that was already exchanged revokes the family, signing out whoever
+// holds its newest tokens too.
 func (d AuthDeps) RefreshToken(c *fiber.Ctx) error {
 	var body RefreshRequest
 	if err := c.BodyParser(&body); err != nil || body.RefreshToken == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
 	}
-	claims, err := auth.ParseAndValidate(d.Cfg.JwtSecret, d.Cfg.JwtAlg, body.RefreshToken)
+	claims, err := auth.ParseAndValidate(d.Keys, body.RefreshToken)
 	if err != nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
 	}
@@ -136,11 +158,53 @@ func (d AuthDeps) RefreshToken(c *fiber.Ctx) error {
 	if userID == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
 	}
-	// issue new access token
-	newAccess, err := auth.CreateAccessToken(d.Cfg.JwtSecret, d.Cfg.JwtAlg, claims, d.Cfg.JwtAccessMin)
+	ctx := context.Background()
+	if blacklisted, _ := d.Blacklist.IsBlacklisted(ctx, body.RefreshToken); blacklisted {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
+	}
+	if revoked, _ := d.Blacklist.IsUserRevoked(ctx, userID, claims); revoked {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
+	}
+
+	session := map[string]any{"user_id": claims["user_id"], "sub": claims["sub"], "role": claims["role"]}
+	family, id := auth.TokenFamily(claims)
+	legacy := family == ""
+	if legacy {
+		// Tokens from before rotation are spent once and start a family
+		family = auth.NewTokenID()
+	}
+	session["fid"] = family
+	refreshClaims, nextID := auth.RefreshClaims(session, family)
+
+	if legacy {
+		if exp, ok := claims["exp"].(float64); ok {
+			if ttl := time.Until(time.Unix(int64(exp), 0)); ttl > 0 {
+				_ = d.Blacklist.Blacklist(ctx, body.RefreshToken, ttl)
+			}
+		}
+		err = d.Blacklist.StartFamily(ctx, family, nextID, d.refreshTTL())
+	} else {
+		err = d.Blacklist.Rotate(ctx, family, id, nextID, d.refreshTTL())
+	}
+	switch {
+	case errors.Is(err, auth.ErrRefreshReused):
+		d.audit(ctx, c, userID, "refresh_token_reused", family, map[string]any{"token_id": id})
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "refresh_token_reused"})
+	case errors.Is(err, auth.ErrFamilyRevoked):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
+	}
+
+	newAccess, err := auth.CreateAccessToken(d.Keys, session, d.Cfg.JwtAccessMin)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
 	}
+	newRefresh, err := auth.CreateRefreshToken(d.Keys, refreshClaims, d.Cfg.JwtRefreshDays)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
+	}
+	d.audit(ctx, c, userID, "token_refreshed", family, map[string]any{"token_id": nextID, "previous_token_id": id})
 	c.Cookie(&fiber.Cookie{
 		Name:     "synthos_token",
 		Value:    newAccess,
@@ -150,7 +214,34 @@ func (d AuthDeps) RefreshToken(c *fiber.Ctx) error {
 		Path:     "/",
 		MaxAge:   d.Cfg.JwtAccessMin * 60,
 	})
-	return c.JSON(fiber.Map{"access_token": newAccess, "token_type": "bearer", "expires_in": d.Cfg.JwtAccessMin * 60})
+	return c.JSON(fiber.Map{
+		"access_token":  newAccess,
+		"refresh_token": newRefresh,
+		"token_type":    "bearer",
+		"expires_in":    d.Cfg.JwtAccessMin * 60,
+	})
+}
+
+// refreshTTL is the lifetime of a refresh token, and so of its family
+func (d AuthDeps) refreshTTL() time.Duration {
+	return time.Duration(d.Cfg.JwtRefreshDays) * 24 * time.Hour
+}
+
+// audit records a session event against a refresh token family
+func (d AuthDeps) audit(ctx context.Context, c *fiber.Ctx, userID int64, action, family string, meta map[string]any) {
+	if d.AuditLogs == nil {
+		return
+	}
+	raw, _ := json.Marshal(meta)
+	_, _ = d.AuditLogs.Insert(ctx, &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   "session",
+		ResourceID: &family,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
 }
 
 // Logout blacklists current tokens and clears cookie
@@ -163,7 +254,7 @@ func (d AuthDeps) Logout(c *fiber.Ctx) error {
 		token = c.Cookies("synthos_token")
 	}
 	if token != "" {
-		if claims, err := auth.ParseAndValidate(d.Cfg.JwtSecret, d.Cfg.JwtAlg, token); err == nil {
+		if claims, err := auth.ParseAndValidate(d.Keys, token); err == nil {
 			if exp, ok := claims["exp"].(float64); ok {
 				ttl := time.Until(time.Unix(int64(exp), 0))
 				if ttl > 0 {
@@ -172,16 +263,22 @@ func (d AuthDeps) Logout(c *fiber.Ctx) error {
 			}
 		}
 	}
-	// Optionally blacklist refresh token if sent
+	// Optionally blacklist refresh token if sent, ending its family
 	var body RefreshRequest
 	if err := c.BodyParser(&body); err == nil && body.RefreshToken != "" {
-		if rclaims, err := auth.ParseAndValidate(d.Cfg.JwtSecret, d.Cfg.JwtAlg, body.RefreshToken); err == nil {
+		if rclaims, err := auth.ParseAndValidate(d.Keys, body.RefreshToken); err == nil {
 			if exp, ok := rclaims["exp"].(float64); ok {
 				ttl := time.Until(time.Unix(int64(exp), 0))
 				if ttl > 0 {
 					_ = d.Blacklist.Blacklist(context.Background(), body.RefreshToken, ttl)
 				}
 			}
+			if family, _ := auth.TokenFamily(rclaims); family != "" {
+				_ = d.Blacklist.RevokeFamily(context.Background(), family, d.refreshTTL())
+				if v, ok := rclaims["user_id"].(float64); ok {
+					d.audit(context.Background(), c, int64(v), "session_revoked", family, map[string]any{"reason": "logout"})
+				}
+			}
 		}
 	}
 	// clear cookie
@@ -236,21 +333,56 @@ func (d AuthDeps) CreateAPIKey(c *fiber.Ctx) error {
 	var body struct {
 		Name      string     `json:"name"`
 		ExpiresAt *time.Time `json:"expires_at"`
+		// Scopes limits the key to these permissions; empty keeps all of
+		// the caller's
+		Scopes []string `json:"scopes"`
+		// RotationDays makes the key auto-rotating
+		RotationDays *int `json:"rotation_days"`
+		OverlapHours int  `json:"overlap_hours"`
 	}
 	_ = c.BodyParser(&body)
 	if strings.TrimSpace(body.Name) == "" {
 		body.Name = "default"
 	}
+	var dueAt *time.Time
+	if body.RotationDays != nil {
+		policy := auth.RotationPolicy{Days: *body.RotationDays, OverlapHours: body.OverlapHours}
+		if err := policy.Validate(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_rotation_policy"})
+		}
+		due := policy.DueAt(time.Now())
+		dueAt = &due
+	}
+	scopes, err := rbac.ParseAll(body.Scopes)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown_permission"})
+	}
+	if len(scopes) > 0 {
+		// A key never carries more than the session that created it
+		p, err := principal(c, d.Roles)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+		}
+		for _, scope := range scopes {
+			if !p.Can(scope) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "scope_exceeds_permissions", "scope": scope})
+			}
+		}
+	}
+	stored := make(pq.StringArray, 0, len(scopes))
+	for _, scope := range scopes {
+		stored = append(stored, string(scope))
+	}
 	// Generate key and hash
 	rawKey := generateRandomString(48)
-	sum := sha256.Sum256([]byte(rawKey))
-	keyHash := hex.EncodeToString(sum[:])
-	rec, err := d.APIKeys.Insert(context.Background(), &models.APIKey{UserID: userID, Name: body.Name, KeyHash: keyHash, IsActive: true, ExpiresAt: body.ExpiresAt})
+	keyHash := auth.HashAPIKey(rawKey)
+	rec, err := d.APIKeys.Insert(context.Background(), &models.APIKey{UserID: userID, Name: body.Name, KeyHash: keyHash, IsActive: true, ExpiresAt: body.ExpiresAt, Scopes: stored,
+		RotationDays: body.RotationDays, OverlapHours: body.OverlapHours, RotationDueAt: dueAt})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
 	}
 	// Return only masked key
-	return c.JSON(fiber.Map{"api_key": rawKey, "id": rec.ID, "name": rec.Name})
+	return c.JSON(fiber.Map{"api_key": rawKey, "id": rec.ID, "name": rec.Name, "scopes": rec.Scopes, "rotation_due_at": rec.RotationDueAt})
 }
 
 // generateRandomString returns a secure random hex string of length n
@@ -3,26 +3,28 @@ package v1
 import (
 	"context"
 	"encoding/json"
+	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
 	"github.com/gofiber/fiber/v2"
 )
 
-// AuthMiddleware validates JWT from Authorization Bearer or synthos_token cookie
+// AuthMiddleware validates JWT from Authorization Bearer or synthos_token cookie,
+// or an API key from X-API-Key (or a Bearer value that is not a JWT)
 func (d AuthDeps) AuthMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		token := ""
-		if h := c.Get("Authorization"); strings.HasPrefix(strings.ToLower(h), "bearer ") {
-			token = strings.TrimSpace(h[len("Bearer "):])
-		}
-		if token == "" {
-			token = c.Cookies("synthos_token")
+		token, apiKey := d.credentials(c)
+		if apiKey != "" {
+			return d.authenticateAPIKey(c, apiKey)
 		}
 		if token == "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 		}
-		claims, err := auth.ParseAndValidate(d.Cfg.JwtSecret, d.Cfg.JwtAlg, token)
+		claims, err := auth.ParseAndValidate(d.Keys, token)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
 		}
@@ -31,25 +33,220 @@ func (d AuthDeps) AuthMiddleware() fiber.Handler {
 		if blacklisted {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
 		}
-
-		// extract user_id
-		raw := claims["user_id"]
-		var userID int64
-		switch v := raw.(type) {
-		case float64:
-			userID = int64(v)
-		case int64:
-			userID = v
-		case json.Number:
-			if n, err := v.Int64(); err == nil {
-				userID = n
+		// Tokens of a family revoked for refresh token reuse or logout
+		if family, _ := auth.TokenFamily(claims); family != "" {
+			if revoked, _ := d.Blacklist.IsFamilyRevoked(context.Background(), family); revoked {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
 			}
 		}
+
+		userID := claimUserID(claims)
 		if userID == 0 {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
 		}
+		// Tokens issued before the account was suspended
+		if revoked, _ := d.Blacklist.IsUserRevoked(context.Background(), userID, claims); revoked {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_token"})
+		}
 		c.Locals("user_id", userID)
 		c.Locals("claims", claims)
+		if staff := claimInt64(claims, ImpersonatorClaim); staff != 0 {
+			family, _ := auth.TokenFamily(claims)
+			return d.impersonated(c, staff, userID, family)
+		}
 		return c.Next()
 	}
 }
+
+// impersonated serves a request made with an impersonation token and
+// records every change it made under the staff member behind it
+func (d AuthDeps) impersonated(c *fiber.Ctx, staff, userID int64, family string) error {
+	c.Locals("impersonator_id", staff)
+	err := c.Next()
+	if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead || c.Method() == fiber.MethodOptions {
+		return err
+	}
+	d.audit(context.Background(), c, staff, "impersonated_request", family, map[string]any{
+		"impersonated_user_id": userID,
+		"method":               c.Method(),
+		"path":                 c.Path(),
+		"status":               c.Response().StatusCode(),
+	})
+	return err
+}
+
+// Identify returns the user whose token or API key a request carries, or 0
+// when it carries none that is valid. It rejects nothing and skips the
+// revocation checks of AuthMiddleware; it only tells whose rate limit a
+// request counts against.
+func (d AuthDeps) Identify(c *fiber.Ctx) int64 {
+	userID, _ := d.identify(c)
+	return userID
+}
+
+// Caller names the API key a request carries as "api_key:<id>", or the
+// user whose token it carries as "user:<id>", resolved as Identify
+// resolves them; it is empty when the request carries neither validly
+func (d AuthDeps) Caller(c *fiber.Ctx) string {
+	userID, keyID := d.identify(c)
+	switch {
+	case keyID != 0:
+		return "api_key:" + strconv.FormatInt(keyID, 10)
+	case userID != 0:
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+	return ""
+}
+
+// identify returns the user a request's credentials belong to and, when
+// they are an API key, the key's ID
+func (d AuthDeps) identify(c *fiber.Ctx) (userID, keyID int64) {
+	token, apiKey := d.credentials(c)
+	if apiKey != "" {
+		if d.APIKeys == nil {
+			return 0, 0
+		}
+		key, err := d.APIKeys.GetByHash(context.Background(), auth.HashAPIKey(apiKey))
+		if err != nil || !auth.VerifyAPIKey(apiKey, key.KeyHash) || (key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now())) {
+			return 0, 0
+		}
+		return key.UserID, key.ID
+	}
+	if token == "" {
+		return 0, 0
+	}
+	claims, err := auth.ParseAndValidate(d.Keys, token)
+	if err != nil {
+		return 0, 0
+	}
+	return claimUserID(claims), 0
+}
+
+// credentials returns the JWT or the API key a request carries: an
+// X-API-Key header, or a Bearer value that is not a JWT, is a key
+func (d AuthDeps) credentials(c *fiber.Ctx) (token, apiKey string) {
+	if h := c.Get("Authorization"); strings.HasPrefix(strings.ToLower(h), "bearer ") {
+		token = strings.TrimSpace(h[len("Bearer "):])
+	}
+	if key := c.Get("X-API-Key"); key != "" {
+		return "", key
+	}
+	if token != "" && strings.Count(token, ".") != 2 && d.APIKeys != nil {
+		return "", token
+	}
+	if token == "" {
+		token = c.Cookies("synthos_token")
+	}
+	return token, ""
+}
+
+func claimUserID(claims map[string]any) int64 {
+	return claimInt64(claims, "user_id")
+}
+
+func claimInt64(claims map[string]any, name string) int64 {
+	switch v := claims[name].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+	}
+	return 0
+}
+
+// authenticateAPIKey resolves an API key to its owner. Failed lookups are
+// throttled per client IP with exponential backoff and temporary bans, and
+// sustained guessing, from one IP or against one key prefix, is raised as a
+// security event.
+func (d AuthDeps) authenticateAPIKey(c *fiber.Ctx, apiKey string) error {
+	if d.APIKeys == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_api_key"})
+	}
+	ctx := context.Background()
+	ip := c.IP()
+	prefix := auth.KeyPrefix(apiKey)
+
+	if d.APIKeyGuard != nil {
+		wait, err := d.APIKeyGuard.Check(ctx, ip)
+		if err == nil && wait > 0 {
+			c.Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too_many_attempts"})
+		}
+	}
+
+	key, err := d.APIKeys.GetByHash(ctx, auth.HashAPIKey(apiKey))
+	if err != nil || !auth.VerifyAPIKey(apiKey, key.KeyHash) || (key.ExpiresAt != nil && key.ExpiresAt.Before(time.Now())) {
+		d.recordAPIKeyFailure(c, ip, prefix)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_api_key"})
+	}
+
+	if d.APIKeyGuard != nil {
+		_ = d.APIKeyGuard.RecordSuccess(ctx, prefix)
+	}
+	_ = d.APIKeys.UpdateLastUsed(ctx, key.ID)
+
+	c.Locals("user_id", key.UserID)
+	c.Locals("claims", map[string]any{
+		"user_id":     float64(key.UserID),
+		"auth_method": "api_key",
+		"api_key_id":  float64(key.ID),
+		"scopes":      []string(key.Scopes),
+	})
+	return c.Next()
+}
+
+func (d AuthDeps) recordAPIKeyFailure(c *fiber.Ctx, ip, prefix string) {
+	if d.APIKeyGuard == nil {
+		return
+	}
+	failure, err := d.APIKeyGuard.RecordFailure(context.Background(), ip, prefix)
+	if err != nil || d.Security == nil {
+		return
+	}
+	details := func(reason string) map[string]interface{} {
+		return map[string]interface{}{
+			"reason":            reason,
+			"ip_failures":       failure.IPFailures,
+			"prefix_failures":   failure.PrefixFailures,
+			"distinct_prefixes": failure.DistinctPrefixes,
+			"path":              c.Path(),
+		}
+	}
+	if failure.Sustained || failure.Banned {
+		level := security.ThreatLevelHigh
+		eventType := "api_key_guessing"
+		if failure.Banned {
+			level = security.ThreatLevelCritical
+			eventType = "api_key_brute_force_ban"
+		}
+		d.Security.RecordEvent(security.SecurityEvent{
+			Level:     level,
+			Type:      eventType,
+			Source:    "api_key_auth",
+			IPAddress: ip,
+			UserAgent: c.Get("User-Agent"),
+			Details:   details("Repeated failed API key authentication"),
+			Action:    "throttled",
+			Blocked:   failure.Banned,
+		})
+	}
+	// A targeted prefix is only reported: throttling it would lock out the
+	// key's owner
+	if failure.Targeted {
+		ev := details("Repeated failed authentication against one API key prefix")
+		ev["prefix"] = prefix
+		d.Security.RecordEvent(security.SecurityEvent{
+			Level:     security.ThreatLevelHigh,
+			Type:      "api_key_targeted",
+			Source:    "api_key_auth",
+			IPAddress: ip,
+			UserAgent: c.Get("User-Agent"),
+			Details:   ev,
+			Action:    "flagged",
+		})
+	}
+}
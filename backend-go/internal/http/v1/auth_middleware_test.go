@@ -0,0 +1,23 @@
+// Package v1_test provides unit tests for request authentication
+package v1_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	v1 "github.com/genovotechnologies/synthos_dev/backend-go/internal/http/v1"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthMiddlewareWithoutAPIKeyStore(t *testing.T) {
+	app := fiber.New()
+	app.Get("/me", v1.AuthDeps{}.AuthMiddleware(), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	req := httptest.NewRequest("GET", "/me", nil)
+	req.Header.Set("X-API-Key", "sk_abcdefghijklmnop")
+	resp, err := app.Test(req)
+	require.NoError(t, err, "a key is refused, not looked up in a missing store")
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+}
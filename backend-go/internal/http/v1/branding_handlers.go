@@ -0,0 +1,265 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/branding"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+)
+
+// maxDisplayName bounds the name a brand shows in email
+const maxDisplayName = 100
+
+// hostnameLookupTimeout bounds the DNS lookup that verifies a hostname
+const hostnameLookupTimeout = 10 * time.Second
+
+// BrandingRequest replaces an organization's branding; omitted or empty
+// fields are cleared
+type BrandingRequest struct {
+	DisplayName      *string `json:"display_name"`
+	LogoURL          *string `json:"logo_url"`
+	LogoDarkURL      *string `json:"logo_dark_url"`
+	EmailFromAddress *string `json:"email_from_address"`
+	APIHostname      *string `json:"api_hostname"`
+}
+
+// GetBranding returns the caller's organization branding, whether its plan
+// includes white-label and the DNS record that verifies its hostname
+func (d OrgDeps) GetBranding(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	member, err := d.member(owner, orgs.ActionInspect)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	ctx := context.Background()
+	b, err := d.Branding.Get(ctx, member.OrgID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	entitled, err := d.Branding.Entitled(ctx, member.OrgID, branding.Tiers())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(brandingState(b, entitled))
+}
+
+// UpdateBranding replaces the branding of the caller's organization. A new
+// hostname has to be verified before links or the from-address use it.
+func (d OrgDeps) UpdateBranding(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body BrandingRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	member, err := d.member(owner, orgs.ActionManage)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	ctx := context.Background()
+	entitled, err := d.Branding.Entitled(ctx, member.OrgID, branding.Tiers())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	if !entitled {
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error":   "white_label_not_in_plan",
+			"message": "White-label branding needs a Professional plan or above. Please upgrade your plan.",
+		})
+	}
+	b, code := d.brandingFromRequest(member.OrgID, owner, body)
+	if code != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": code})
+	}
+	if b.APIHostname != nil {
+		token, err := branding.NewVerificationToken()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+		}
+		b.HostnameToken = &token
+	}
+	var saved *models.OrgBranding
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		if saved, err = d.Branding.Upsert(ctx, b); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, owner, "org_branding_updated", member.OrgID, map[string]any{
+			"api_hostname":       saved.APIHostname,
+			"email_from_address": saved.EmailFromAddress,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(brandingState(saved, entitled))
+}
+
+// VerifyBranding checks the DNS record that proves the organization
+// controls its branded hostname
+func (d OrgDeps) VerifyBranding(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	member, err := d.member(owner, orgs.ActionManage)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	ctx := context.Background()
+	b, err := d.Branding.Get(ctx, member.OrgID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "verify_failed"})
+	}
+	if b == nil || b.APIHostname == nil || b.HostnameToken == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "no_hostname"})
+	}
+	entitled, err := d.Branding.Entitled(ctx, member.OrgID, branding.Tiers())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "verify_failed"})
+	}
+	if branding.Verified(b) {
+		return c.JSON(brandingState(b, entitled))
+	}
+
+	var resolver branding.TXTResolver = net.DefaultResolver
+	if d.DNS != nil {
+		resolver = d.DNS
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, hostnameLookupTimeout)
+	defer cancel()
+	if err := branding.Verify(lookupCtx, resolver, *b.APIHostname, *b.HostnameToken); err != nil {
+		state := brandingState(b, entitled)
+		state["error"] = "hostname_unverified"
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(state)
+	}
+
+	var verified *models.OrgBranding
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		if verified, err = d.Branding.MarkVerified(ctx, member.OrgID, *b.APIHostname); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, owner, "org_hostname_verified", member.OrgID, map[string]any{"api_hostname": *b.APIHostname})
+	})
+	if errors.Is(err, repo.ErrHostnameTaken) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "hostname_taken"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "verify_failed"})
+	}
+	return c.JSON(brandingState(verified, entitled))
+}
+
+// DeleteBranding removes the branding of the caller's organization; its
+// members get the platform brand again
+func (d OrgDeps) DeleteBranding(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	member, err := d.member(owner, orgs.ActionManage)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	ctx := context.Background()
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := d.Branding.Delete(ctx, member.OrgID); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, owner, "org_branding_deleted", member.OrgID, nil)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "branding_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// brandingFromRequest validates a branding request, returning the error
+// code of the first field that fails
+func (d OrgDeps) brandingFromRequest(orgID, owner int64, body BrandingRequest) (*models.OrgBranding, string) {
+	b := &models.OrgBranding{OrgID: orgID, UpdatedBy: &owner}
+	if name := trimmed(body.DisplayName); name != nil {
+		if len(*name) > maxDisplayName || strings.ContainsAny(*name, "\r\n") {
+			return nil, "invalid_display_name"
+		}
+		b.DisplayName = name
+	}
+	for _, f := range []struct {
+		in  *string
+		out **string
+	}{{body.LogoURL, &b.LogoURL}, {body.LogoDarkURL, &b.LogoDarkURL}} {
+		if raw := trimmed(f.in); raw != nil {
+			logo, err := branding.ValidateLogoURL(*raw)
+			if err != nil {
+				return nil, "invalid_logo_url"
+			}
+			*f.out = &logo
+		}
+	}
+	hostname := ""
+	if raw := trimmed(body.APIHostname); raw != nil {
+		host, err := branding.ValidateHostname(*raw, d.ReservedDomains)
+		switch {
+		case errors.Is(err, branding.ErrReservedHostname):
+			return nil, "reserved_hostname"
+		case err != nil:
+			return nil, "invalid_hostname"
+		}
+		hostname = host
+		b.APIHostname = &host
+	}
+	if raw := trimmed(body.EmailFromAddress); raw != nil {
+		addr, err := branding.ValidateFromAddress(*raw, hostname)
+		switch {
+		case errors.Is(err, branding.ErrFromAddressDomain):
+			return nil, "from_address_domain"
+		case err != nil:
+			return nil, "invalid_from_address"
+		}
+		b.EmailFromAddress = &addr
+	}
+	return b, ""
+}
+
+// trimmed returns s without surrounding space, or nil when that is empty
+func trimmed(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	t := strings.TrimSpace(*s)
+	if t == "" {
+		return nil
+	}
+	return &t
+}
+
+func brandingState(b *models.OrgBranding, entitled bool) fiber.Map {
+	state := fiber.Map{
+		"branding":    b,
+		"white_label": entitled,
+		"verified":    branding.Verified(b),
+	}
+	if b != nil && b.APIHostname != nil && b.HostnameToken != nil && !branding.Verified(b) {
+		name, value := branding.VerificationRecord(*b.APIHostname, *b.HostnameToken)
+		state["verification"] = fiber.Map{"type": "TXT", "name": name, "value": value}
+	}
+	return state
+}
@@ -0,0 +1,179 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/changelog"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+)
+
+type ChangelogDeps struct {
+	Entries *repo.ChangelogRepo
+}
+
+// ChangelogEntryRequest writes a changelog entry. Features are the feature
+// areas it covers; its users are told about it when it is published.
+type ChangelogEntryRequest struct {
+	Version  string   `json:"version"`
+	Title    string   `json:"title"`
+	Body     string   `json:"body"`
+	Features []string `json:"features"`
+}
+
+// ChangelogItem is a published entry as customers see it
+type ChangelogItem struct {
+	ID          int64     `json:"id"`
+	Version     string    `json:"version"`
+	Title       string    `json:"title"`
+	Body        string    `json:"body"`
+	Features    []string  `json:"features"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// ChangelogResponse lists published entries. LatestVersion is the newest
+// published version, so a client can remember what it has shown.
+type ChangelogResponse struct {
+	Entries       []ChangelogItem `json:"entries"`
+	LatestVersion string          `json:"latest_version"`
+}
+
+// ListChangelog returns published entries, newest version first.
+// ?since=VERSION keeps those newer than a version and ?feature= those of one
+// feature area. No account is needed.
+func (d ChangelogDeps) ListChangelog(c *fiber.Ctx) error {
+	var since *changelog.Version
+	if s := c.Query("since"); s != "" {
+		v, err := changelog.ParseVersion(s)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_version", "message": err.Error()})
+		}
+		since = &v
+	}
+	feature := strings.ToLower(strings.TrimSpace(c.Query("feature")))
+	if _, ok := changelog.Areas[feature]; feature != "" && !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_feature"})
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	ctx := context.Background()
+	entries, err := d.Entries.ListPublished(ctx, since, feature, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	latest, err := d.Entries.LatestVersion(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	out := ChangelogResponse{Entries: make([]ChangelogItem, 0, len(entries)), LatestVersion: latest}
+	for _, e := range entries {
+		out.Entries = append(out.Entries, ChangelogItem{
+			ID:          e.ID,
+			Version:     e.Version,
+			Title:       e.Title,
+			Body:        e.Body,
+			Features:    e.Features,
+			PublishedAt: *e.PublishedAt,
+		})
+	}
+	return c.JSON(out)
+}
+
+// ListChangelogEntries returns drafts and published entries for admins
+func (d ChangelogDeps) ListChangelogEntries(c *fiber.Ctx) error {
+	items, err := d.Entries.List(context.Background(), 100, 0)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if items == nil {
+		items = []models.ChangelogEntry{}
+	}
+	return c.JSON(items)
+}
+
+// CreateChangelogEntry stores a draft entry
+func (d ChangelogDeps) CreateChangelogEntry(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("user_id").(int64)
+	e, v, errCode := parseChangelogEntry(c)
+	if errCode != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errCode})
+	}
+	e.CreatedBy = adminID
+	out, err := d.Entries.Insert(context.Background(), e, v)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
+
+// UpdateChangelogEntry rewrites an entry. A published entry keeps its
+// publication and is not announced again.
+func (d ChangelogDeps) UpdateChangelogEntry(c *fiber.Ctx) error {
+	existing, err := d.Entries.Get(context.Background(), parseID(c.Params("id")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	e, v, errCode := parseChangelogEntry(c)
+	if errCode != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errCode})
+	}
+	e.ID = existing.ID
+	out, err := d.Entries.Update(context.Background(), e, v)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(out)
+}
+
+// PublishChangelogEntry makes an entry visible to customers; its users are
+// notified within a minute
+func (d ChangelogDeps) PublishChangelogEntry(c *fiber.Ctx) error {
+	out, err := d.Entries.Publish(context.Background(), parseID(c.Params("id")), time.Now())
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(out)
+}
+
+func (d ChangelogDeps) DeleteChangelogEntry(c *fiber.Ctx) error {
+	err := d.Entries.Delete(context.Background(), parseID(c.Params("id")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	return c.JSON(fiber.Map{"message": "deleted"})
+}
+
+// parseChangelogEntry validates an entry body and returns an error code on
+// failure
+func parseChangelogEntry(c *fiber.Ctx) (*models.ChangelogEntry, changelog.Version, string) {
+	var body ChangelogEntryRequest
+	if err := c.BodyParser(&body); err != nil {
+		return nil, changelog.Version{}, "invalid_body"
+	}
+	e := &models.ChangelogEntry{Version: body.Version, Title: body.Title, Body: body.Body, Features: body.Features}
+	if err := changelog.Normalize(e); err != nil {
+		if errors.Is(err, changelog.ErrInvalidVersion) {
+			return nil, changelog.Version{}, "invalid_version"
+		}
+		return nil, changelog.Version{}, "invalid_entry"
+	}
+	v, _ := changelog.ParseVersion(e.Version)
+	return e, v, ""
+}
@@ -0,0 +1,193 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ColumnPrivacyRequest struct {
+	// Category defaults to the one the dataset's PII scan gave the column
+	Category  models.PrivacyCategory  `json:"category"`
+	Mechanism models.PrivacyMechanism `json:"mechanism"`
+	// Epsilon defaults to the category's budget for the mechanisms that
+	// spend one; Delta and Sensitivity default to 1e-6 and 1
+	Epsilon     *float64 `json:"epsilon,omitempty"`
+	Delta       *float64 `json:"delta,omitempty"`
+	Sensitivity *float64 `json:"sensitivity,omitempty"`
+}
+
+// ListColumnPrivacy lists the privacy settings of a dataset's columns
+func (d DatasetDeps) ListColumnPrivacy(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.ColumnPrivacy == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	out, err := d.ColumnPrivacy.List(context.Background(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if out == nil {
+		out = []models.ColumnPrivacy{}
+	}
+	return c.JSON(out)
+}
+
+// SetColumnPrivacy marks a column as personal data and sets the mechanism
+// and budget generation protects it with
+func (d DatasetDeps) SetColumnPrivacy(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.ColumnPrivacy == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	column := strings.TrimSpace(c.Params("column"))
+	var body ColumnPrivacyRequest
+	if err := c.BodyParser(&body); err != nil || column == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	setting := models.ColumnPrivacy{
+		DatasetID:   id,
+		ColumnName:  column,
+		Category:    models.PrivacyCategory(strings.ToLower(strings.TrimSpace(string(body.Category)))),
+		Mechanism:   models.PrivacyMechanism(strings.ToLower(strings.TrimSpace(string(body.Mechanism)))),
+		Epsilon:     body.Epsilon,
+		Delta:       body.Delta,
+		Sensitivity: body.Sensitivity,
+		UpdatedBy:   owner,
+	}
+	if setting.Category == "" {
+		if setting.Category, err = scannedCategory(d.PII, id, column); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+		}
+	}
+	if err := privacy.ValidateColumnPrivacy(setting); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_column_privacy", "message": err.Error()})
+	}
+
+	// Columns are checked against the data when it is readable, and stored
+	// as the data names them so generated rows match
+	profiles, err := d.profile(ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	if profiles != nil {
+		found := false
+		for _, p := range profiles {
+			if strings.EqualFold(p.Name, column) {
+				setting.ColumnName, found = p.Name, true
+				break
+			}
+		}
+		if !found {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": column})
+		}
+	}
+	out, err := d.ColumnPrivacy.Upsert(context.Background(), &setting)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditAccess(c, owner, "column_privacy_set", "dataset", id, map[string]any{
+		"column":    out.ColumnName,
+		"category":  out.Category,
+		"mechanism": out.Mechanism,
+		"epsilon":   out.Epsilon,
+	})
+	return c.JSON(out)
+}
+
+// DeleteColumnPrivacy removes a column's privacy setting; jobs already
+// queued keep it
+func (d DatasetDeps) DeleteColumnPrivacy(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.ColumnPrivacy == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	column := c.Params("column")
+	err := d.ColumnPrivacy.Delete(context.Background(), id, column)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "column_privacy_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	_ = d.auditAccess(c, owner, "column_privacy_removed", "dataset", id, map[string]any{
+		"column": column,
+	})
+	return c.JSON(fiber.Map{"message": "column_privacy_removed"})
+}
+
+// columnPrivacy resolves the column settings of a dataset for a job and
+// checks their budgets fit its privacy level; the plan holds what the job
+// will spend
+func (d GenerationDeps) columnPrivacy(datasetID int64, level string) ([]privacy.ColumnPolicy, *privacy.PrivacyBudget, error) {
+	if d.ColumnPrivacy == nil {
+		return nil, nil, nil
+	}
+	settings, err := d.ColumnPrivacy.List(context.Background(), datasetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	policies := privacy.ColumnPolicies(settings)
+	if len(policies) == 0 {
+		return nil, nil, nil
+	}
+	plan, err := privacy.NewPrivacyEngine().PlanColumns(privacy.PrivacyLevel(level), policies)
+	if err != nil {
+		return nil, nil, err
+	}
+	return policies, plan, nil
+}
+
+// chargePrivacyBudget charges what a job will spend to the requester's
+// ledger on the dataset; nil when nothing is spent or there is no ledger
+func (d GenerationDeps) chargePrivacyBudget(ctx context.Context, userID, datasetID int64, policies []privacy.ColumnPolicy, plan *privacy.PrivacyBudget) (*models.PrivacyBudgetEntry, error) {
+	if d.PrivacyBudgets == nil || plan == nil || plan.SpentEpsilon == 0 && plan.SpentDelta == 0 {
+		return nil, nil
+	}
+	entry := &models.PrivacyBudgetEntry{
+		DatasetID: datasetID,
+		UserID:    userID,
+		Epsilon:   plan.SpentEpsilon,
+		Delta:     plan.SpentDelta,
+		Columns:   privacy.SpendingColumns(policies),
+	}
+	return d.PrivacyBudgets.Charge(ctx, entry, d.PrivacyBudgetEpsilon, d.PrivacyBudgetDelta)
+}
+
+// privacyBalance is the requester's balance on a dataset
+func (d GenerationDeps) privacyBalance(userID, datasetID int64) (*models.PrivacyBudgetBalance, error) {
+	epsilon, delta, err := d.PrivacyBudgets.Spent(context.Background(), datasetID, userID)
+	if err != nil {
+		return nil, err
+	}
+	balance := privacy.Balance(datasetID, userID, d.PrivacyBudgetEpsilon, d.PrivacyBudgetDelta, epsilon, delta)
+	return &balance, nil
+}
@@ -0,0 +1,189 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/consent"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+)
+
+type ConsentDeps struct {
+	Consents *repo.ConsentRepo
+	// Documents holds the current version of each legal document
+	Documents consent.Documents
+}
+
+// AcceptDocumentsRequest maps each document accepted to the version shown
+type AcceptDocumentsRequest struct {
+	Documents map[models.ConsentKind]string `json:"documents"`
+}
+
+// EmailConsentRequest changes the optional email a user receives; omitted
+// flags stay as they are
+type EmailConsentRequest struct {
+	MarketingEmails *bool `json:"marketing_emails"`
+	ProductUpdates  *bool `json:"product_updates"`
+}
+
+// LegalDocuments lists the current version of each legal document
+func (d ConsentDeps) LegalDocuments(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"documents": d.Documents})
+}
+
+// GetConsent returns what the caller accepted, what they still have to
+// accept and which optional email they receive
+func (d ConsentDeps) GetConsent(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	latest, err := d.Consents.Latest(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(d.consentState(latest))
+}
+
+// AcceptDocuments records the caller's acceptance of the current version
+// of one or more legal documents
+func (d ConsentDeps) AcceptDocuments(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body AcceptDocumentsRequest
+	if err := c.BodyParser(&body); err != nil || len(body.Documents) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	recs := make([]models.ConsentRecord, 0, len(body.Documents))
+	for kind, version := range body.Documents {
+		switch err := consent.CheckAcceptance(d.Documents, kind, version); {
+		case errors.Is(err, consent.ErrStaleVersion):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "stale_version", "kind": kind, "version": d.Documents[kind]})
+		case err != nil:
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown_document", "kind": kind})
+		}
+		recs = append(recs, d.record(c, owner, kind, d.Documents[kind], true))
+	}
+	return d.save(c, owner, recs)
+}
+
+// UpdateEmailConsent records the caller opting in to or out of optional
+// email. Only flags that change are recorded.
+func (d ConsentDeps) UpdateEmailConsent(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body EmailConsentRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	latest, err := d.Consents.Latest(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	var recs []models.ConsentRecord
+	flags := []struct {
+		kind models.ConsentKind
+		set  *bool
+	}{
+		{models.ConsentMarketingEmails, body.MarketingEmails},
+		{models.ConsentProductUpdates, body.ProductUpdates},
+	}
+	for _, f := range flags {
+		if f.set == nil || latest[f.kind].Granted == *f.set {
+			continue
+		}
+		recs = append(recs, d.record(c, owner, f.kind, "", *f.set))
+	}
+	return d.save(c, owner, recs)
+}
+
+// ConsentHistory returns the caller's consent records, newest first
+func (d ConsentDeps) ConsentHistory(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	limit, _ := strconv.Atoi(c.Query("limit", "100"))
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	recs, err := d.Consents.History(context.Background(), owner, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(fiber.Map{"records": recs})
+}
+
+// RequireConsent blocks signed-in callers who have not accepted the
+// current major version of every legal document, until they accept it at
+// /users/consent/accept. It runs after AuthMiddleware, which sets the
+// caller; requests without one pass through.
+func (d ConsentDeps) RequireConsent(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 || d.Consents == nil {
+		return c.Next()
+	}
+	latest, err := d.Consents.Latest(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "consent_check_failed"})
+	}
+	if outstanding := consent.Outstanding(d.Documents, latest); len(outstanding) > 0 {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "consent_required", "outstanding": outstanding})
+	}
+	return c.Next()
+}
+
+func (d ConsentDeps) record(c *fiber.Ctx, owner int64, kind models.ConsentKind, version string, granted bool) models.ConsentRecord {
+	return models.ConsentRecord{
+		UserID:    owner,
+		Kind:      kind,
+		Version:   version,
+		Granted:   granted,
+		IPAddress: c.IP(),
+		UserAgent: c.Get("User-Agent"),
+	}
+}
+
+// save stores recs and answers with the caller's consent state after them
+func (d ConsentDeps) save(c *fiber.Ctx, owner int64, recs []models.ConsentRecord) error {
+	ctx := context.Background()
+	if len(recs) > 0 {
+		if _, err := d.Consents.Record(ctx, recs); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+		}
+	}
+	latest, err := d.Consents.Latest(ctx, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(d.consentState(latest))
+}
+
+func (d ConsentDeps) consentState(latest map[models.ConsentKind]models.ConsentRecord) fiber.Map {
+	accepted := fiber.Map{}
+	for kind := range d.Documents {
+		if rec, ok := latest[kind]; ok && rec.Granted {
+			accepted[string(kind)] = fiber.Map{"version": rec.Version, "accepted_at": rec.CreatedAt}
+		}
+	}
+	emails := fiber.Map{}
+	for _, kind := range consent.EmailKinds {
+		emails[string(kind)] = latest[kind].Granted
+	}
+	outstanding := consent.Outstanding(d.Documents, latest)
+	return fiber.Map{
+		"documents":   d.Documents,
+		"accepted":    accepted,
+		"outstanding": outstanding,
+		"blocked":     len(outstanding) > 0,
+		"email":       emails,
+	}
+}
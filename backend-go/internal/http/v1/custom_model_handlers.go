@@ -12,12 +12,20 @@ import (
 	"strings"
 
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
 	"github.com/gofiber/fiber/v2"
 )
 
 type CustomModelDeps struct {
 	CustomModels *repo.CustomModelRepo
+	// Storage keeps uploaded model files for the inference server to load;
+	// models uploaded without it cannot be served
+	Storage storage.ObjectWriter
+	// Orgs shares models with the organization of their owner
+	Orgs *repo.OrgRepo
 }
 
 type UploadCustomModelRequest struct {
@@ -34,6 +42,21 @@ func (d CustomModelDeps) ListCustomModels(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
 
+	if c.Query("scope") == "org" {
+		member, err := orgMembership(context.Background(), d.Orgs, userID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+		}
+		if member == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_in_org"})
+		}
+		shared, err := d.CustomModels.GetByOrg(context.Background(), member.OrgID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+		}
+		return c.JSON(shared)
+	}
+
 	models, err := d.CustomModels.GetByOwner(context.Background(), userID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
@@ -49,6 +72,12 @@ func (d CustomModelDeps) UploadCustomModel(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
 
+	if ok, err := d.canCreate(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+	}
+
 	// Parse form data
 	var req UploadCustomModelRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -80,7 +109,7 @@ func (d CustomModelDeps) UploadCustomModel(c *fiber.Ctx) error {
 		if err := d.processModelFile(fileHeader, req, userID); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error":   "file_processing_failed",
-				"details": err.Error(),
+				"details": redact.String(err.Error()),
 			})
 		}
 	}
@@ -105,8 +134,9 @@ func (d CustomModelDeps) GetCustomModel(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "model_not_found"})
 	}
 
-	// Check ownership
-	if model.OwnerID != userID {
+	if ok, err := d.canUse(userID, model, orgs.ActionRead); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	} else if !ok {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "access_denied"})
 	}
 
@@ -131,7 +161,9 @@ func (d CustomModelDeps) ValidateCustomModel(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "model_not_found"})
 	}
 
-	if model.OwnerID != userID {
+	if ok, err := d.canUse(userID, model, orgs.ActionWrite); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	} else if !ok {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "access_denied"})
 	}
 
@@ -180,7 +212,9 @@ func (d CustomModelDeps) TestCustomModel(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "model_not_found"})
 	}
 
-	if model.OwnerID != userID {
+	if ok, err := d.canUse(userID, model, orgs.ActionWrite); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	} else if !ok {
 		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "access_denied"})
 	}
 
@@ -235,13 +269,47 @@ func (d CustomModelDeps) DeleteCustomModel(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_model_id"})
 	}
 
-	if err := d.CustomModels.Delete(context.Background(), modelID, userID); err != nil {
+	// Organization admins delete models other members shared with it
+	ownerID := userID
+	if model, err := d.CustomModels.GetByID(context.Background(), modelID); err == nil && model.OwnerID != userID {
+		if ok, err := d.canUse(userID, model, orgs.ActionManage); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+		} else if !ok {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "access_denied"})
+		}
+		ownerID = model.OwnerID
+	}
+
+	if err := d.CustomModels.Delete(context.Background(), modelID, ownerID); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
 	}
 
 	return c.JSON(fiber.Map{"message": "Model deleted successfully"})
 }
 
+// canCreate reports whether userID may add models; they are shared with the
+// user's organization, where viewers cannot add them
+func (d CustomModelDeps) canCreate(userID int64) (bool, error) {
+	member, err := orgMembership(context.Background(), d.Orgs, userID)
+	if err != nil {
+		return false, err
+	}
+	return member == nil || orgs.Can(member.Role, orgs.ActionWrite), nil
+}
+
+// canUse reports whether userID may act on model: owners always may, and
+// members of the organization it is shared with as their role allows
+func (d CustomModelDeps) canUse(userID int64, model *models.CustomModel, action orgs.Action) (bool, error) {
+	if model.OwnerID == userID {
+		return true, nil
+	}
+	member, err := orgMembership(context.Background(), d.Orgs, userID)
+	if err != nil {
+		return false, err
+	}
+	return orgs.CanAccess(member, model.OrgID, action), nil
+}
+
 // GetSupportedFrameworks returns list of supported ML frameworks
 func (d CustomModelDeps) GetSupportedFrameworks(c *fiber.Ctx) error {
 	frameworks := d.CustomModels.GetSupportedFrameworks()
@@ -351,24 +419,45 @@ func (d CustomModelDeps) processModelFile(fileHeader *multipart.FileHeader, req
 		return fmt.Errorf("failed to save model: %w", err)
 	}
 
-	// Here you would:
-	// 1. Upload file to storage (S3/GCS)
-	// 2. Run initial validation
-	// 3. Update model status to 'validating'
-	// 4. Queue background validation job
+	// The file is stored where the inference server loads it from
+	if d.Storage != nil {
+		if err := d.storeModelFile(fileHeader, userID, savedModel.ID); err != nil {
+			_ = d.CustomModels.UpdateStatus(context.Background(), savedModel.ID, models.CustomModelError)
+			return fmt.Errorf("failed to store model file: %w", err)
+		}
+	}
 
-	// For now, just update status to ready (simplified)
+	// Validation against test data is run on request
 	_ = d.CustomModels.UpdateStatus(context.Background(), savedModel.ID, models.CustomModelReady)
 
 	return nil
 }
 
+// storeModelFile uploads a model file and records its key on the model
+func (d CustomModelDeps) storeModelFile(fileHeader *multipart.FileHeader, userID, modelID int64) error {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	key := fmt.Sprintf("custom-models/%d/%d/%s", userID, modelID, filepath.Base(fileHeader.Filename))
+	if err := d.Storage.PutObject(context.Background(), key, file, "application/octet-stream"); err != nil {
+		return err
+	}
+	return d.CustomModels.UpdateModelKey(context.Background(), modelID, key)
+}
+
 // UploadFile handles direct file uploads for models
 func (d CustomModelDeps) UploadFile(c *fiber.Ctx) error {
 	userID, _ := c.Locals("user_id").(int64)
 	if userID == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
+	if ok, err := d.canCreate(userID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	} else if !ok {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+	}
 
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -379,7 +468,7 @@ func (d CustomModelDeps) UploadFile(c *fiber.Ctx) error {
 	if err := d.validateModelFile(file); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error":   "invalid_file",
-			"details": err.Error(),
+			"details": redact.String(err.Error()),
 		})
 	}
 
@@ -0,0 +1,103 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SetDataPolicy lets a dataset owner restrict the dataset to zero-real-data
+// generation, in which no source rows are ever sent to a provider
+func (d DatasetDeps) SetDataPolicy(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	var body struct {
+		ZeroRealData *bool `json:"zero_real_data"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.ZeroRealData == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	err := d.Datasets.SetZeroRealData(context.Background(), owner, id, *body.ZeroRealData)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditAccess(c, owner, "dataset_data_policy_updated", "dataset", id, map[string]any{
+		"zero_real_data": *body.ZeroRealData,
+	})
+	return c.JSON(fiber.Map{"dataset_id": id, "zero_real_data": *body.ZeroRealData})
+}
+
+// GetDataPolicy returns the real data policy of an organization
+func (a AdminDeps) GetDataPolicy(c *fiber.Ctx) error {
+	orgID := parseID(c.Params("id"))
+	if orgID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	p, err := a.DataPolicies.GetByOrgID(context.Background(), orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(p)
+}
+
+// UpdateDataPolicy creates or replaces the real data policy of an
+// organization. With zero_real_data set, every job started by a member or on
+// a member's dataset runs without source rows.
+func (a AdminDeps) UpdateDataPolicy(c *fiber.Ctx) error {
+	orgID := parseID(c.Params("id"))
+	if orgID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	var body struct {
+		ZeroRealData bool `json:"zero_real_data"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	p, err := a.DataPolicies.Upsert(context.Background(), &models.DataPolicy{OrgID: orgID, ZeroRealData: body.ZeroRealData})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(p)
+}
+
+// SetUserOrg assigns a user to an organization, or removes the membership
+// when org_id is null
+func (a AdminDeps) SetUserOrg(c *fiber.Ctx) error {
+	id := parseID(c.Params("id"))
+	if id <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	var body struct {
+		OrgID *int64 `json:"org_id"`
+	}
+	if err := c.BodyParser(&body); err != nil || (body.OrgID != nil && *body.OrgID <= 0) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	var err error
+	if a.Orgs != nil {
+		err = a.Orgs.Assign(context.Background(), id, body.OrgID)
+	} else {
+		err = a.Users.SetOrgID(context.Background(), id, body.OrgID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "org_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(fiber.Map{"user_id": id, "org_id": body.OrgID})
+}
@@ -0,0 +1,195 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/collections"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+)
+
+type CollectionRequest struct {
+	Name        string               `json:"name"`
+	Description *string              `json:"description"`
+	Filter      models.DatasetFilter `json:"filter"`
+	// Shared makes the collection visible to the caller's organization
+	Shared bool `json:"shared"`
+}
+
+// collectionScope returns the organization whose shared collections and
+// datasets the caller can read, nil outside one
+func (d DatasetDeps) collectionScope(ctx context.Context, userID int64) (*models.OrgMember, *int64, error) {
+	member, err := orgMembership(ctx, d.Orgs, userID)
+	if err != nil || member == nil {
+		return nil, nil, err
+	}
+	return member, &member.OrgID, nil
+}
+
+// parseCollection validates a collection body for the caller and returns
+// a status and error code on failure
+func parseCollection(c *fiber.Ctx, owner int64, member *models.OrgMember) (*models.DatasetCollection, int, string) {
+	var body CollectionRequest
+	if err := c.BodyParser(&body); err != nil {
+		return nil, fiber.StatusBadRequest, "invalid_body"
+	}
+	name, err := collections.ValidName(body.Name)
+	if err != nil {
+		return nil, fiber.StatusBadRequest, "invalid_name"
+	}
+	filter, err := collections.Normalize(body.Filter)
+	if err != nil {
+		return nil, fiber.StatusBadRequest, "invalid_filter"
+	}
+	out := &models.DatasetCollection{OwnerID: owner, Name: name, Description: body.Description, Filter: filter}
+	if body.Shared {
+		if member == nil {
+			return nil, fiber.StatusNotFound, "not_in_org"
+		}
+		if !orgs.Can(member.Role, orgs.ActionWrite) {
+			return nil, fiber.StatusForbidden, "org_role_forbidden"
+		}
+		out.OrgID = &member.OrgID
+	}
+	return out, 0, ""
+}
+
+// ListCollections lists the caller's collections and those shared with their
+// organization, each with how many datasets it matches right now
+func (d DatasetDeps) ListCollections(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	ctx := context.Background()
+	_, orgID, err := d.collectionScope(ctx, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	items, err := d.Collections.List(ctx, owner, orgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	for i := range items {
+		count, err := d.Datasets.CountMatching(ctx, items[i].Filter, owner, orgID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+		}
+		items[i].DatasetCount = &count
+	}
+	return c.JSON(fiber.Map{"collections": items})
+}
+
+// CreateCollection saves a search as a named collection
+func (d DatasetDeps) CreateCollection(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	ctx := context.Background()
+	member, _, err := d.collectionScope(ctx, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	}
+	col, status, errCode := parseCollection(c, owner, member)
+	if errCode != "" {
+		return c.Status(status).JSON(fiber.Map{"error": errCode})
+	}
+	created, err := d.Collections.Insert(ctx, col)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(created)
+}
+
+// GetCollection returns a collection the caller owns or that is shared with
+// their organization
+func (d DatasetDeps) GetCollection(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	ctx := context.Background()
+	_, orgID, err := d.collectionScope(ctx, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	col, err := d.Collections.Get(ctx, parseID(c.Params("collectionId")), owner, orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "collection_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(col)
+}
+
+// UpdateCollection replaces the name, description, filter and sharing of
+// one of the caller's collections
+func (d DatasetDeps) UpdateCollection(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	ctx := context.Background()
+	member, _, err := d.collectionScope(ctx, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	}
+	col, status, errCode := parseCollection(c, owner, member)
+	if errCode != "" {
+		return c.Status(status).JSON(fiber.Map{"error": errCode})
+	}
+	col.ID = parseID(c.Params("collectionId"))
+	updated, err := d.Collections.Update(ctx, col)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "collection_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(updated)
+}
+
+// DeleteCollection removes one of the caller's collections; the datasets it
+// matched are untouched
+func (d DatasetDeps) DeleteCollection(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	err := d.Collections.Delete(context.Background(), owner, parseID(c.Params("collectionId")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "collection_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// listCollection lists the datasets a collection matches for the caller,
+// for GET /datasets?collection=
+func (d DatasetDeps) listCollection(c *fiber.Ctx, owner int64) error {
+	ctx := context.Background()
+	_, orgID, err := d.collectionScope(ctx, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	col, err := d.Collections.Get(ctx, parseID(c.Query("collection")), owner, orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "collection_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	items, err := d.Datasets.Search(ctx, col.Filter, owner, orgID, 100, 0)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(items)
+}
@@ -0,0 +1,156 @@
+// Package v1_test provides unit tests for dataset sharing handlers
+package v1_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	v1 "github.com/genovotechnologies/synthos_dev/backend-go/internal/http/v1"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func grantApp(testDB *testutil.TestDB, userID int64) *fiber.App {
+	d := v1.DatasetDeps{Datasets: repo.NewDatasetRepo(testDB.DB), Grants: repo.NewDatasetGrantRepo(testDB.DB)}
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", userID)
+		return c.Next()
+	})
+	app.Get("/datasets/shared", d.ListShared)
+	app.Get("/datasets/:id/grants", d.ListGrants)
+	app.Post("/datasets/:id/grants", d.CreateGrant)
+	app.Delete("/datasets/:id/grants/:grantId", d.DeleteGrant)
+	return app
+}
+
+func call(t *testing.T, app *fiber.App, method, path, body string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	raw, _ := io.ReadAll(resp.Body)
+	var out map[string]any
+	_ = json.Unmarshal(raw, &out)
+	return resp.StatusCode, out
+}
+
+func expectOwnedDataset(testDB *testutil.TestDB, owner, id int64) {
+	testDB.Mock.ExpectQuery("FROM datasets WHERE owner_id=").WithArgs(owner, id).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "name", "status"}).AddRow(id, owner, "claims", "ready"))
+}
+
+func grantRows(id, datasetID int64, granteeType string, granteeID int64, permission string, by int64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "dataset_id", "grantee_type", "grantee_id", "permission", "granted_by", "created_at"}).
+		AddRow(id, datasetID, granteeType, granteeID, permission, by, time.Now())
+}
+
+func TestCreateGrantOnlyByOwner(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+
+	// User 8 does not own dataset 5, even when it was shared with them
+	testDB.Mock.ExpectQuery("FROM datasets WHERE owner_id=").WithArgs(int64(8), int64(5)).WillReturnError(sql.ErrNoRows)
+	status, body := call(t, grantApp(testDB, 8), "POST", "/datasets/5/grants", `{"grantee_type":"user","grantee_id":9,"permission":"generate"}`)
+	assert.Equal(t, fiber.StatusNotFound, status)
+	assert.Equal(t, "not_found", body["error"])
+
+	testDB.Mock.ExpectQuery("FROM datasets WHERE owner_id=").WithArgs(int64(8), int64(5)).WillReturnError(sql.ErrNoRows)
+	status, _ = call(t, grantApp(testDB, 8), "GET", "/datasets/5/grants", "")
+	assert.Equal(t, fiber.StatusNotFound, status, "nor see who it is shared with")
+	testDB.AssertExpectations(t)
+}
+
+func TestCreateGrantToUser(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	app := grantApp(testDB, 4)
+
+	expectOwnedDataset(testDB, 4, 5)
+	testDB.Mock.ExpectQuery("INSERT INTO dataset_grants").WithArgs(int64(5), "user", int64(9), "generate", int64(4)).
+		WillReturnRows(grantRows(1, 5, "user", 9, "generate", 4))
+	status, body := call(t, app, "POST", "/datasets/5/grants", `{"grantee_type":"user","grantee_id":9,"permission":"generate"}`)
+	assert.Equal(t, fiber.StatusCreated, status)
+	assert.Equal(t, "generate", body["permission"])
+
+	expectOwnedDataset(testDB, 4, 5)
+	status, body = call(t, app, "POST", "/datasets/5/grants", `{"grantee_type":"user","grantee_id":4,"permission":"read"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, "cannot_grant_to_owner", body["error"])
+
+	expectOwnedDataset(testDB, 4, 5)
+	status, body = call(t, app, "POST", "/datasets/5/grants", `{"grantee_type":"user","grantee_id":9,"permission":"admin"}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Equal(t, "invalid_permission", body["error"])
+	testDB.AssertExpectations(t)
+}
+
+func TestCreateGrantToGroup(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	app := grantApp(testDB, 4)
+
+	expectOwnedDataset(testDB, 4, 5)
+	testDB.Mock.ExpectQuery("FROM user_groups WHERE owner_id=").WithArgs(int64(4), int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "name", "created_at"}).AddRow(2, 4, "analysts", time.Now()))
+	testDB.Mock.ExpectQuery("INSERT INTO dataset_grants").WithArgs(int64(5), "group", int64(2), "read", int64(4)).
+		WillReturnRows(grantRows(1, 5, "group", 2, "read", 4))
+	status, _ := call(t, app, "POST", "/datasets/5/grants", `{"grantee_type":"group","grantee_id":2,"permission":"read"}`)
+	assert.Equal(t, fiber.StatusCreated, status)
+
+	// Grants only reach the owner's own groups
+	expectOwnedDataset(testDB, 4, 5)
+	testDB.Mock.ExpectQuery("FROM user_groups WHERE owner_id=").WithArgs(int64(4), int64(3)).WillReturnError(sql.ErrNoRows)
+	status, body := call(t, app, "POST", "/datasets/5/grants", `{"grantee_type":"group","grantee_id":3,"permission":"read"}`)
+	assert.Equal(t, fiber.StatusNotFound, status)
+	assert.Equal(t, "grantee_not_found", body["error"])
+	testDB.AssertExpectations(t)
+}
+
+func TestDeleteGrant(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	app := grantApp(testDB, 4)
+
+	expectOwnedDataset(testDB, 4, 5)
+	testDB.Mock.ExpectQuery("DELETE FROM dataset_grants").WithArgs(int64(5), int64(1)).
+		WillReturnRows(grantRows(1, 5, "user", 9, "read", 4))
+	status, body := call(t, app, "DELETE", "/datasets/5/grants/1", "")
+	assert.Equal(t, fiber.StatusOK, status)
+	assert.Equal(t, "grant_revoked", body["message"])
+
+	expectOwnedDataset(testDB, 4, 5)
+	testDB.Mock.ExpectQuery("DELETE FROM dataset_grants").WithArgs(int64(5), int64(7)).WillReturnError(sql.ErrNoRows)
+	status, body = call(t, app, "DELETE", "/datasets/5/grants/7", "")
+	assert.Equal(t, fiber.StatusNotFound, status)
+	assert.Equal(t, "grant_not_found", body["error"])
+	testDB.AssertExpectations(t)
+}
+
+func TestListShared(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+
+	// Datasets shared with the caller's groups are listed with their own
+	testDB.Mock.ExpectQuery(`d.owner_id <> \$1 AND d.status <> 'archived'.*SELECT group_id FROM user_group_members WHERE user_id = \$1`).
+		WithArgs(int64(8), 100, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "name", "status"}).AddRow(5, 4, "claims", "ready"))
+	req := httptest.NewRequest("GET", "/datasets/shared", nil)
+	resp, err := grantApp(testDB, 8).Test(req)
+	require.NoError(t, err)
+	var items []map[string]any
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&items))
+	require.Len(t, items, 1)
+	assert.Equal(t, "claims", items[0]["name"])
+	testDB.AssertExpectations(t)
+}
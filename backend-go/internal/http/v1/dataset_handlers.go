@@ -1,17 +1,33 @@
 package v1
 
 import (
+	"bufio"
 	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"mime/multipart"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/branding"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/egress"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgsettings"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pii"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/quota"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/sources"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/usage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -19,13 +35,118 @@ type DatasetDeps struct {
 	Datasets      *repo.DatasetRepo
 	Usage         *usage.UsageService
 	StorageClient storage.SignedURLProvider
+	// SignedURLTTL is the lifetime of provider download URLs
+	SignedURLTTL  time.Duration
+	URLSigner     *storage.URLSigner
+	Revocations   *storage.URLRevocations
+	AuditLogs     *repo.AuditLogRepo
+	DownloadTTL   time.Duration
+	Grants        *repo.DatasetGrantRepo
+	Users         *repo.UserRepo
+	OrgSettings   *repo.OrgSettingsRepo
+	Annotations   *repo.ColumnAnnotationRepo
+	Relationships *repo.RelationshipHintRepo
+	Hierarchies   *repo.HierarchyRepo
+	Vocabularies  *repo.VocabularyRepo
+	ColumnPrivacy *repo.ColumnPrivacyRepo
+	// PII holds the classification PIIScanner gives the columns of
+	// datasets as they are uploaded or imported
+	PII        *repo.DatasetPIIRepo
+	PIIScanner *pii.Scanner
+	// FixedWidthLayouts holds the record layouts of fixed-width exports
+	FixedWidthLayouts *repo.FixedWidthLayoutRepo
+	// QualityPolicies holds the quality the generated rows of datasets
+	// must reach
+	QualityPolicies *repo.QualityPolicyRepo
+	// FHIRMappings holds the column mappings of FHIR exports
+	FHIRMappings *repo.FHIRMappingRepo
+	// FinancialMessageLayouts holds the layouts of payment message exports
+	FinancialMessageLayouts *repo.FinancialMessageLayoutRepo
+	// ColumnTokenKey keys the tokens that replace restricted columns in exports
+	ColumnTokenKey []byte
+	// Webhooks announces uploads to the owner's endpoints
+	Webhooks *webhooks.Dispatcher
+	// Tx makes a dataset and the audit entry of its upload atomic
+	Tx *repo.Transactor
+	// Orgs shares datasets with the organization of their owner
+	Orgs *repo.OrgRepo
+	// Branding serves download links on the verified hostname of a
+	// white-label organization
+	Branding *branding.Resolver
+	// Collections holds saved searches over the datasets a user can read
+	Collections *repo.DatasetCollectionRepo
+	// Sources are the databases datasets are sampled from; their
+	// credentials are sealed by SourceKeys, and connections go through
+	// SourceNetwork to hosts Egress allows
+	Sources       *repo.DatasetSourceRepo
+	SourceKeys    storage.KMS
+	SourceNetwork sources.Network
+	Egress        *egress.Gateway
+	// MaxSampleRows caps the rows sampled from a source into a dataset
+	MaxSampleRows int
+	// Quota warns owners as their datasets approach the plan's limit
+	Quota *quota.Notifier
 }
 
+// baseURL returns the scheme and host links for a user are built on: their
+// organization's verified hostname, or the host the request came in on
+func (d DatasetDeps) baseURL(c *fiber.Ctx, userID int64) string {
+	def := branding.Brand{BaseURL: c.BaseURL()}
+	b, err := d.Branding.ForUser(context.Background(), userID)
+	if err != nil {
+		return def.BaseURL
+	}
+	return branding.Apply(def, b).BaseURL
+}
+
+// checkQuota warns the owner of a new dataset, in the background, when
+// their datasets approach the plan's limit
+func (d DatasetDeps) checkQuota(owner int64) {
+	if d.Quota == nil {
+		return
+	}
+	go func() {
+		_, _ = d.Quota.Check(context.Background(), owner, time.Now())
+	}()
+}
+
+// previewRows is the number of rows returned by Preview
+const previewRows = 20
+
+// signedURLTTL resolves the lifetime of a provider download URL
+func signedURLTTL(ttl time.Duration) time.Duration {
+	if ttl > 0 {
+		return ttl
+	}
+	return storage.DefaultSignedURLTTL
+}
+
+// providerURLTTL is how long the provider URL behind a redeemed ticket lives;
+// it only has to survive the redirect
+const providerURLTTL = time.Minute
+
 func (d DatasetDeps) List(c *fiber.Ctx) error {
 	owner, _ := c.Locals("user_id").(int64)
 	if owner == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
+	if c.Query("collection") != "" {
+		return d.listCollection(c, owner)
+	}
+	if c.Query("scope") == "org" {
+		member, err := orgMembership(context.Background(), d.Orgs, owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+		}
+		if member == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_in_org"})
+		}
+		items, err := d.Datasets.ListByOrg(context.Background(), member.OrgID, 100, 0)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+		}
+		return c.JSON(items)
+	}
 	items, err := d.Datasets.ListByOwner(context.Background(), owner, 100, 0)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
@@ -39,6 +160,16 @@ func (d DatasetDeps) Upload(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
 
+	// Uploads are shared with the owner's organization, where viewers
+	// cannot add datasets
+	member, err := orgMembership(context.Background(), d.Orgs, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	}
+	if member != nil && !orgs.Can(member.Role, orgs.ActionWrite) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+	}
+
 	// Check dataset limits
 	canCreate, reason, err := d.Usage.CanCreateDataset(context.Background(), owner)
 	if err != nil {
@@ -62,48 +193,146 @@ func (d DatasetDeps) Upload(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unsupported_format"})
 	}
 
-	// Note: storage integration (GCS/S3) to be implemented; for now store metadata only
+	// Retention defaults to the organization's; a mandatory retention
+	// cannot be changed per dataset
+	var retention *int
+	if v := c.FormValue("retention_days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_retention_days"})
+		}
+		retention = &days
+	}
+	if d.OrgSettings != nil {
+		org, err := d.OrgSettings.ForUser(context.Background(), owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "policy_check_failed"})
+		}
+		retention, err = orgsettings.ApplyRetention(org, retention)
+		if handled, herr := orgSettingError(c, err); handled {
+			return herr
+		}
+	}
+
 	ds := &models.Dataset{
-		OwnerID:      owner,
-		Name:         fileHeader.Filename,
-		Description:  nil,
-		Status:       models.DatasetProcessing,
-		OriginalFile: fileHeader.Filename,
-		FileSize:     fileHeader.Size,
-		FileType:     ext,
-		RowCount:     0,
-		ColumnCount:  0,
-	}
-	out, err := d.Datasets.Insert(context.Background(), ds)
+		OwnerID:       owner,
+		Name:          fileHeader.Filename,
+		Description:   nil,
+		Status:        models.DatasetProcessing,
+		OriginalFile:  fileHeader.Filename,
+		FileSize:      fileHeader.Size,
+		FileType:      ext,
+		RowCount:      0,
+		ColumnCount:   0,
+		RetentionDays: retention,
+	}
+	// A dataset is only created together with the audit entry of its upload
+	var out *models.Dataset
+	err = d.Tx.WithTx(context.Background(), func(ctx context.Context) error {
+		var err error
+		if out, err = d.Datasets.Insert(ctx, ds); err != nil {
+			return err
+		}
+		return d.auditUpload(ctx, c, out)
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
 	}
-	// TODO: async upload + schema detection
+	// Without a writable store only the metadata is kept
+	if writer, ok := d.StorageClient.(storage.ObjectWriter); ok {
+		key, err := d.storeUpload(writer, out, fileHeader)
+		if err != nil {
+			_ = d.Datasets.UpdateObjectKey(context.Background(), out.ID, "", models.DatasetError)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "upload_failed"})
+		}
+		out.ObjectKey, out.Status = &key, models.DatasetReady
+	}
+	_ = d.Webhooks.Publish(context.Background(), owner, webhooks.EventDatasetUploaded, map[string]interface{}{
+		"dataset_id": out.ID,
+		"name":       out.Name,
+		"file_type":  out.FileType,
+		"file_size":  out.FileSize,
+		"status":     out.Status,
+	})
+	d.checkQuota(owner)
+	// The scan is best effort: a dataset whose scan failed can be scanned
+	// again, and jobs without a classification keep the name-based masks
+	if d.PII != nil && d.PIIScanner != nil && out.ObjectKey != nil {
+		_, _ = d.scanStoredPII(context.Background(), out)
+	}
+	// TODO: async schema detection
 	return c.Status(fiber.StatusAccepted).JSON(out)
 }
 
 func getFile(h *multipart.FileHeader) (multipart.File, error) { return h.Open() }
 
+// storeUpload writes an uploaded file to storage and records its key; an
+// object whose key could not be recorded is removed again
+func (d DatasetDeps) storeUpload(writer storage.ObjectWriter, ds *models.Dataset, h *multipart.FileHeader) (string, error) {
+	f, err := getFile(h)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	ctx := context.Background()
+	key := fmt.Sprintf("datasets/%d/%d/%s", ds.OwnerID, ds.ID, filepath.Base(h.Filename))
+	contentType := h.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if err := writer.PutObject(ctx, key, f, contentType); err != nil {
+		return "", err
+	}
+	if err := d.Datasets.UpdateObjectKey(ctx, ds.ID, key, models.DatasetReady); err != nil {
+		if deleter, ok := writer.(storage.ObjectDeleter); ok {
+			_ = deleter.DeleteObject(ctx, key)
+		}
+		return "", err
+	}
+	return key, nil
+}
+
 func (d DatasetDeps) Get(c *fiber.Ctx) error {
 	owner, _ := c.Locals("user_id").(int64)
 	if owner == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
 	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
-	ds, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	ds, err := d.accessibleDataset(owner, id, models.DatasetPermRead)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
 	}
 	return c.JSON(ds)
 }
 
+// accessibleDataset loads a dataset the user owns or has been granted perm on
+func (d DatasetDeps) accessibleDataset(userID, datasetID int64, perm models.DatasetPermission) (*models.Dataset, error) {
+	if d.Grants == nil {
+		return d.Datasets.GetByOwnerID(context.Background(), userID, datasetID)
+	}
+	return d.Grants.GetAccessibleDataset(context.Background(), userID, datasetID, perm)
+}
+
 func (d DatasetDeps) Delete(c *fiber.Ctx) error {
 	owner, _ := c.Locals("user_id").(int64)
 	if owner == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
 	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
-	if err := d.Datasets.Archive(context.Background(), owner, id); err != nil {
+	// Organization admins delete datasets other members shared with it
+	datasetOwner := owner
+	if ds, err := d.accessibleDataset(owner, id, models.DatasetPermRead); err == nil && ds.OwnerID != owner {
+		member, err := orgMembership(context.Background(), d.Orgs, owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+		}
+		if !orgs.CanAccess(member, ds.OrgID, orgs.ActionManage) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+		}
+		datasetOwner = ds.OwnerID
+	}
+	if err := d.Datasets.Archive(context.Background(), datasetOwner, id); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
 	}
 	return c.JSON(fiber.Map{"message": "dataset_deleted"})
@@ -114,15 +343,92 @@ func (d DatasetDeps) Preview(c *fiber.Ctx) error {
 	if owner == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
-	// Placeholder: return static preview shape; storage/parse to be implemented
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.accessibleDataset(owner, id, models.DatasetPermRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	acl, err := d.columnACL(owner, ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+	}
+
+	columns, rows := []string{}, []map[string]interface{}{}
+	if reader, ok := d.StorageClient.(storage.ObjectReader); ok && ds.ObjectKey != nil && *ds.ObjectKey != "" {
+		columns, rows, err = readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, previewRows)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "preview_failed"})
+		}
+	}
 	return c.JSON(fiber.Map{
-		"rows_shown": 0,
-		"total_rows": 0,
-		"columns":    []string{},
-		"data":       []any{},
+		"rows_shown":     len(rows),
+		"total_rows":     ds.RowCount,
+		"columns":        columns,
+		"data":           acl.MaskRows(rows),
+		"masked_columns": acl.Hidden(),
 	})
 }
 
+// readPreview reads the first rows of a CSV or JSON dataset; other formats
+// return an empty preview
+func readPreview(ctx context.Context, reader storage.ObjectReader, key, fileType string, limit int) ([]string, []map[string]interface{}, error) {
+	columns, rows := []string{}, []map[string]interface{}{}
+	if fileType != "csv" && fileType != "json" {
+		return columns, rows, nil
+	}
+	obj, err := reader.OpenObject(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer obj.Close()
+
+	if fileType == "csv" {
+		r := csv.NewReader(obj)
+		header, err := r.Read()
+		if err != nil {
+			return nil, nil, err
+		}
+		for len(rows) < limit {
+			rec, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			row := make(map[string]interface{}, len(header))
+			for i, h := range header {
+				if i < len(rec) {
+					row[h] = rec[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+		return header, rows, nil
+	}
+
+	dec := json.NewDecoder(obj)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, nil, errors.New("expected a JSON array of objects")
+	}
+	seen := map[string]bool{}
+	for len(rows) < limit && dec.More() {
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err != nil {
+			return nil, nil, err
+		}
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+		rows = append(rows, row)
+	}
+	sort.Strings(columns)
+	return columns, rows, nil
+}
+
 func (d DatasetDeps) Download(c *fiber.Ctx) error {
 	owner, _ := c.Locals("user_id").(int64)
 	if owner == 0 {
@@ -130,7 +436,7 @@ func (d DatasetDeps) Download(c *fiber.Ctx) error {
 	}
 
 	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
-	dataset, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	dataset, err := d.accessibleDataset(owner, id, models.DatasetPermRead)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
 	}
@@ -140,10 +446,52 @@ func (d DatasetDeps) Download(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "dataset_not_uploaded"})
 	}
 
+	// Viewers without clearance never get the raw object
+	acl, err := d.columnACL(owner, dataset)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+	}
+	if acl.Restricted() {
+		return d.restrictedExport(c, owner, dataset, acl)
+	}
+
+	// Issue a short-lived, single-object ticket redeemed through the API
+	if d.URLSigner != nil && d.StorageClient != nil {
+		ttl := d.DownloadTTL
+		if ttl <= 0 || ttl > storage.MaxDownloadTTL {
+			ttl = 5 * time.Minute
+		}
+		claims := storage.DownloadClaims{
+			DatasetID: dataset.ID,
+			UserID:    owner,
+			ObjectKey: *dataset.ObjectKey,
+			Filename:  dataset.OriginalFile,
+			ExpiresAt: time.Now().Add(ttl),
+		}
+		if c.QueryBool("bind_ip") {
+			claims.IPAddress = c.IP()
+		}
+		token, issued, err := d.URLSigner.Sign(claims)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed_to_generate_download_url"})
+		}
+		if err := d.auditDownload(c, owner, "signed_url_issued", issued); err != nil {
+			// Never hand out a URL that is not on the audit trail
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "audit_failed"})
+		}
+		return c.JSON(fiber.Map{
+			"download_url": d.baseURL(c, owner) + "/api/v1/downloads/" + token,
+			"filename":     dataset.OriginalFile,
+			"expires_at":   issued.ExpiresAt,
+			"ip_bound":     issued.IPAddress != "",
+			"token_id":     issued.ID,
+		})
+	}
+
 	// Generate signed URL if storage client is available
 	var downloadURL string
 	if d.StorageClient != nil {
-		signedURL, err := d.StorageClient.GetSignedURL(context.Background(), *dataset.ObjectKey, 1*time.Hour)
+		signedURL, err := d.StorageClient.GetSignedURL(context.Background(), *dataset.ObjectKey, signedURLTTL(d.SignedURLTTL))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed_to_generate_download_url"})
 		}
@@ -155,3 +503,154 @@ func (d DatasetDeps) Download(c *fiber.Ctx) error {
 
 	return c.JSON(fiber.Map{"download_url": downloadURL, "filename": dataset.OriginalFile})
 }
+
+// restrictedExport streams the dataset through the API with hidden columns
+// excluded or tokenized
+func (d DatasetDeps) restrictedExport(c *fiber.Ctx, userID int64, dataset *models.Dataset, acl *privacy.ColumnACL) error {
+	reader, ok := d.StorageClient.(storage.ObjectReader)
+	if !ok || (dataset.FileType != "csv" && dataset.FileType != "json") {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "restricted_export_unavailable"})
+	}
+	obj, err := reader.OpenObject(context.Background(), *dataset.ObjectKey)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "export_failed"})
+	}
+	if err := d.auditAccess(c, userID, "restricted_export", "dataset", dataset.ID, map[string]any{
+		"hidden_columns": acl.Hidden(),
+		"object_key":     *dataset.ObjectKey,
+	}); err != nil {
+		obj.Close()
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "audit_failed"})
+	}
+
+	export := acl.ExportCSV
+	c.Type("csv")
+	if dataset.FileType == "json" {
+		export = acl.ExportJSON
+		c.Type("json")
+	}
+	c.Attachment(dataset.OriginalFile)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer obj.Close()
+		_ = export(obj, w)
+		_ = w.Flush()
+	})
+	return nil
+}
+
+// RedeemDownload exchanges a download ticket for a redirect to the object.
+// The ticket itself is the credential, so no session is required.
+func (d DatasetDeps) RedeemDownload(c *fiber.Ctx) error {
+	if d.URLSigner == nil || d.StorageClient == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	claims, err := d.URLSigner.Verify(c.Params("token"), c.IP())
+	switch {
+	case errors.Is(err, storage.ErrDownloadTokenExpired):
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "download_expired"})
+	case errors.Is(err, storage.ErrDownloadIPMismatch):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "ip_not_allowed"})
+	case err != nil:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "invalid_download_token"})
+	}
+	if d.Revocations != nil {
+		if err := d.Revocations.Check(context.Background(), claims); err != nil {
+			if errors.Is(err, storage.ErrDownloadTokenRevoked) {
+				return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "download_revoked"})
+			}
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "revocation_check_failed"})
+		}
+	}
+
+	signedURL, err := d.StorageClient.GetSignedURL(context.Background(), claims.ObjectKey, providerURLTTL)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed_to_generate_download_url"})
+	}
+	_ = d.auditDownload(c, claims.UserID, "signed_url_redeemed", claims)
+	return c.Redirect(signedURL, fiber.StatusFound)
+}
+
+// RevokeDownloads revokes one outstanding download ticket, or all tickets of the dataset
+func (d DatasetDeps) RevokeDownloads(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Revocations == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	dataset, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var body struct {
+		TokenID string `json:"token_id"`
+	}
+	_ = c.BodyParser(&body)
+
+	claims := &storage.DownloadClaims{ID: body.TokenID, DatasetID: dataset.ID, UserID: owner}
+	if dataset.ObjectKey != nil {
+		claims.ObjectKey = *dataset.ObjectKey
+	}
+	if body.TokenID != "" {
+		err = d.Revocations.Revoke(context.Background(), body.TokenID)
+	} else {
+		err = d.Revocations.RevokeDataset(context.Background(), dataset.ID)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "revoke_failed"})
+	}
+	_ = d.auditDownload(c, owner, "signed_url_revoked", claims)
+	return c.JSON(fiber.Map{"message": "revoked"})
+}
+
+// auditUpload records the upload of a dataset with its file
+func (d DatasetDeps) auditUpload(ctx context.Context, c *fiber.Ctx, ds *models.Dataset) error {
+	if d.AuditLogs == nil {
+		return nil
+	}
+	raw, _ := json.Marshal(map[string]any{
+		"file_name": ds.OriginalFile,
+		"file_type": ds.FileType,
+		"file_size": ds.FileSize,
+	})
+	resourceID := strconv.FormatInt(ds.ID, 10)
+	_, err := d.AuditLogs.Insert(ctx, &models.AuditLog{
+		UserID:     &ds.OwnerID,
+		Action:     "dataset_uploaded",
+		Resource:   "dataset",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+	return err
+}
+
+// auditDownload records a download ticket event with requester, object and expiry
+func (d DatasetDeps) auditDownload(c *fiber.Ctx, userID int64, action string, claims *storage.DownloadClaims) error {
+	if d.AuditLogs == nil {
+		return nil
+	}
+	meta := map[string]any{
+		"token_id":   claims.ID,
+		"object_key": claims.ObjectKey,
+		"ip_bound":   claims.IPAddress != "",
+	}
+	if !claims.ExpiresAt.IsZero() {
+		meta["expires_at"] = claims.ExpiresAt
+	}
+	raw, _ := json.Marshal(meta)
+	resourceID := strconv.FormatInt(claims.DatasetID, 10)
+	_, err := d.AuditLogs.Insert(context.Background(), &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   "dataset",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+	return err
+}
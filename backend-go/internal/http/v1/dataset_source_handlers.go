@@ -0,0 +1,450 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/egress"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgsettings"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/sources"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
+)
+
+// sourceTimeout bounds the work on a source database of one request
+const sourceTimeout = 2 * time.Minute
+
+type DatasetSourceRequest struct {
+	Name        string                       `json:"name"`
+	Kind        string                       `json:"kind"`
+	Settings    models.DatasetSourceSettings `json:"settings"`
+	Credentials sources.Credentials          `json:"credentials"`
+}
+
+type SourceImportRequest struct {
+	Schema string `json:"schema"`
+	Table  string `json:"table"`
+	// Name defaults to the table's
+	Name string `json:"name"`
+	// Rows defaults to the most a dataset may be sampled with
+	Rows int `json:"rows"`
+}
+
+// checkSourceHost refuses source databases on private addresses. It
+// returns the error response body for a refused host.
+func (d DatasetDeps) checkSourceHost(ctx context.Context, host string) (fiber.Map, bool) {
+	if d.Egress == nil {
+		return nil, true
+	}
+	err := d.Egress.CheckHost(ctx, "dataset_sources", host)
+	var blocked *egress.BlockedError
+	if errors.As(err, &blocked) {
+		return fiber.Map{"error": "host_not_allowed", "reason": blocked.Reason}, false
+	}
+	return nil, true
+}
+
+// openSource decrypts a source's credentials and connects to it
+func (d DatasetDeps) openSource(ctx context.Context, src *models.DatasetSource) (sources.Source, error) {
+	creds, err := sources.OpenCredentials(ctx, d.SourceKeys, src)
+	if err != nil {
+		return nil, fmt.Errorf("credentials unavailable: %w", err)
+	}
+	return sources.Open(src.Kind, src.Settings, creds, d.SourceNetwork)
+}
+
+// testSource connects to a source and returns why it failed, if it did
+func testSource(ctx context.Context, open func() (sources.Source, error)) *string {
+	s, err := open()
+	if err == nil {
+		err = s.Test(ctx)
+		s.Close()
+	}
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	return &msg
+}
+
+func sourceError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, sources.ErrDriverUnavailable):
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "source_kind_unavailable"})
+	case errors.Is(err, sources.ErrInvalidSource):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_source", "message": err.Error()})
+	}
+	return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "source_unavailable", "message": err.Error()})
+}
+
+// ListSources lists the caller's database sources
+func (d DatasetDeps) ListSources(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Sources == nil || d.SourceKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Sources.List(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if out == nil {
+		out = []models.DatasetSource{}
+	}
+	return c.JSON(out)
+}
+
+// CreateSource registers a database connection once it connects. The
+// password is sealed under the KMS key and never returned.
+func (d DatasetDeps) CreateSource(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Sources == nil || d.SourceKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	var body DatasetSourceRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name_required"})
+	}
+	if err := sources.Validate(body.Kind, body.Settings, body.Credentials); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_source", "message": err.Error(), "kinds": sources.Kinds})
+	}
+	if body.Kind == sources.KindMySQL && !sources.MySQLAvailable() {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "source_kind_unavailable"})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sourceTimeout)
+	defer cancel()
+	if res, ok := d.checkSourceHost(ctx, body.Settings.Host); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(res)
+	}
+	if msg := testSource(ctx, func() (sources.Source, error) {
+		return sources.Open(body.Kind, body.Settings, body.Credentials, d.SourceNetwork)
+	}); msg != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "connection_failed", "message": *msg})
+	}
+	sealed, wrapped, keyID, err := sources.SealCredentials(ctx, d.SourceKeys, body.Credentials)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	now := time.Now()
+	out, err := d.Sources.Create(context.Background(), &models.DatasetSource{
+		UserID:       owner,
+		Name:         body.Name,
+		Kind:         body.Kind,
+		Settings:     body.Settings,
+		Credentials:  sealed,
+		WrappedKey:   wrapped,
+		KeyID:        keyID,
+		LastTestedAt: &now,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	d.auditSource(c, owner, "dataset_source_created", out)
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
+
+func (d DatasetDeps) GetSource(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Sources == nil || d.SourceKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Sources.Get(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	return c.JSON(out)
+}
+
+// DeleteSource removes a connection; datasets sampled from it are kept
+func (d DatasetDeps) DeleteSource(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Sources == nil || d.SourceKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id := parseID(c.Params("id"))
+	err := d.Sources.Delete(context.Background(), owner, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	d.auditSource(c, owner, "dataset_source_deleted", &models.DatasetSource{ID: id})
+	return c.JSON(fiber.Map{"message": "dataset_source_deleted"})
+}
+
+// TestSource tests a saved connection and records the outcome
+func (d DatasetDeps) TestSource(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Sources == nil || d.SourceKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	src, err := d.Sources.Get(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sourceTimeout)
+	defer cancel()
+	if res, ok := d.checkSourceHost(ctx, src.Settings.Host); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(res)
+	}
+	msg := testSource(ctx, func() (sources.Source, error) { return d.openSource(ctx, src) })
+	if err := d.Sources.RecordTest(context.Background(), src.ID, msg); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	if msg != nil {
+		return c.JSON(fiber.Map{"ok": false, "error": *msg})
+	}
+	return c.JSON(fiber.Map{"ok": true})
+}
+
+// ListSourceTables introspects the tables and views the connection's user
+// can read, with their columns and estimated sizes
+func (d DatasetDeps) ListSourceTables(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Sources == nil || d.SourceKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	src, err := d.Sources.Get(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sourceTimeout)
+	defer cancel()
+	if res, ok := d.checkSourceHost(ctx, src.Settings.Host); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(res)
+	}
+	db, err := d.openSource(ctx, src)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer db.Close()
+	tables, err := db.Tables(ctx)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	if tables == nil {
+		tables = []sources.Table{}
+	}
+	return c.JSON(fiber.Map{"tables": tables, "max_sample_rows": d.MaxSampleRows})
+}
+
+// ImportSource creates a dataset from a random sample of a source table.
+// The sample is stored as a JSON dataset, so schema analysis, profiling and
+// generation treat it like an upload.
+func (d DatasetDeps) ImportSource(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Sources == nil || d.SourceKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	writer, ok := d.StorageClient.(storage.ObjectWriter)
+	if !ok {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "storage_unavailable"})
+	}
+	var body SourceImportRequest
+	if err := c.BodyParser(&body); err != nil || body.Table == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if body.Rows == 0 {
+		body.Rows = d.MaxSampleRows
+	}
+	if body.Rows < 0 || body.Rows > d.MaxSampleRows {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_rows", "max_sample_rows": d.MaxSampleRows})
+	}
+
+	// Imports are shared with the owner's organization like uploads
+	member, err := orgMembership(context.Background(), d.Orgs, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	}
+	if member != nil && !orgs.Can(member.Role, orgs.ActionWrite) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+	}
+	canCreate, reason, err := d.Usage.CanCreateDataset(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_check_failed"})
+	}
+	if !canCreate {
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error":   reason,
+			"message": "Dataset limit exceeded. Please upgrade your plan.",
+		})
+	}
+	var retention *int
+	if d.OrgSettings != nil {
+		org, err := d.OrgSettings.ForUser(context.Background(), owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "policy_check_failed"})
+		}
+		retention, err = orgsettings.ApplyRetention(org, nil)
+		if handled, herr := orgSettingError(c, err); handled {
+			return herr
+		}
+	}
+
+	src, err := d.Sources.Get(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sourceTimeout)
+	defer cancel()
+	if res, ok := d.checkSourceHost(ctx, src.Settings.Host); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(res)
+	}
+	db, err := d.openSource(ctx, src)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	defer db.Close()
+	tables, err := db.Tables(ctx)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	// Only introspected tables are read, by their quoted names
+	table, err := sources.Find(tables, body.Schema, body.Table)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "table_not_found"})
+	}
+	rows, err := db.Sample(ctx, table, body.Rows)
+	if err != nil {
+		return sourceError(c, err)
+	}
+	raw, err := json.Marshal(rows)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "import_failed"})
+	}
+
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		name = table.Name
+	}
+	ds := &models.Dataset{
+		OwnerID:       owner,
+		Name:          name,
+		Status:        models.DatasetProcessing,
+		OriginalFile:  table.Schema + "." + table.Name,
+		FileSize:      int64(len(raw)),
+		FileType:      "json",
+		RowCount:      int64(len(rows)),
+		ColumnCount:   int64(len(table.Columns)),
+		RetentionDays: retention,
+	}
+	var out *models.Dataset
+	err = d.Tx.WithTx(context.Background(), func(ctx context.Context) error {
+		var err error
+		if out, err = d.Datasets.Insert(ctx, ds); err != nil {
+			return err
+		}
+		return d.auditImport(ctx, c, out, src, table)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	key := fmt.Sprintf("datasets/%d/%d/%s.json", owner, out.ID, table.Name)
+	if err := writer.PutObject(context.Background(), key, bytes.NewReader(raw), "application/json"); err != nil {
+		_ = d.Datasets.UpdateObjectKey(context.Background(), out.ID, "", models.DatasetError)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "upload_failed"})
+	}
+	if err := d.Datasets.UpdateObjectKey(context.Background(), out.ID, key, models.DatasetReady); err != nil {
+		if deleter, ok := writer.(storage.ObjectDeleter); ok {
+			_ = deleter.DeleteObject(context.Background(), key)
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "upload_failed"})
+	}
+	out.ObjectKey, out.Status = &key, models.DatasetReady
+	if d.PII != nil && d.PIIScanner != nil {
+		columns := make([]string, len(table.Columns))
+		for i, col := range table.Columns {
+			columns[i] = col.Name
+		}
+		_, _ = d.scanPII(context.Background(), out, columns, rows)
+	}
+	_ = d.Webhooks.Publish(context.Background(), owner, webhooks.EventDatasetUploaded, map[string]interface{}{
+		"dataset_id": out.ID,
+		"name":       out.Name,
+		"file_type":  out.FileType,
+		"file_size":  out.FileSize,
+		"status":     out.Status,
+	})
+	d.checkQuota(owner)
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
+
+// auditImport records a dataset sampled from a source
+func (d DatasetDeps) auditImport(ctx context.Context, c *fiber.Ctx, ds *models.Dataset, src *models.DatasetSource, t sources.Table) error {
+	if d.AuditLogs == nil {
+		return nil
+	}
+	raw, _ := json.Marshal(map[string]any{
+		"source_id": src.ID,
+		"kind":      src.Kind,
+		"host":      src.Settings.Host,
+		"database":  src.Settings.Database,
+		"table":     t.Schema + "." + t.Name,
+		"rows":      ds.RowCount,
+	})
+	resourceID := strconv.FormatInt(ds.ID, 10)
+	_, err := d.AuditLogs.Insert(ctx, &models.AuditLog{
+		UserID:     &ds.OwnerID,
+		Action:     "dataset_imported",
+		Resource:   "dataset",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+	return err
+}
+
+// auditSource records a change to a source connection
+func (d DatasetDeps) auditSource(c *fiber.Ctx, userID int64, action string, src *models.DatasetSource) {
+	if d.AuditLogs == nil {
+		return
+	}
+	raw, _ := json.Marshal(map[string]any{"kind": src.Kind, "name": src.Name, "host": src.Settings.Host, "database": src.Settings.Database})
+	resourceID := strconv.FormatInt(src.ID, 10)
+	_, _ = d.AuditLogs.Insert(context.Background(), &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   "dataset_source",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+}
@@ -0,0 +1,90 @@
+package v1
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/eventstream"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgsettings"
+	"github.com/gofiber/fiber/v2"
+)
+
+// StartEventStream starts a job generating a product-analytics event stream
+// from its parameters alone. No dataset is read, so the job runs in zero
+// real data mode; its usage is charged per expected event.
+func (d GenerationDeps) StartEventStream(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var opts eventstream.Options
+	if err := c.BodyParser(&opts); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if handled, herr := rejectExportFormats(c, "event stream"); handled {
+		return herr
+	}
+	opts.Defaults(time.Now())
+	if err := opts.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_event_stream", "message": err.Error()})
+	}
+	member, err := orgMembership(context.Background(), d.Orgs, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	}
+	if member != nil && !orgs.Can(member.Role, orgs.ActionWrite) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+	}
+	// Stream formats are not among the formats an organization can mandate,
+	// so a mandatory list rules them out as it does at download
+	if d.OrgSettings != nil {
+		org, err := d.OrgSettings.ForUser(context.Background(), owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "policy_check_failed"})
+		}
+		if handled, herr := orgSettingError(c, orgsettings.CheckExportFormat(org, opts.Format)); handled {
+			return herr
+		}
+	}
+
+	events := opts.EstimatedEvents()
+	canGenerate, reason, err := d.Usage.CanGenerateRows(context.Background(), owner, events)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_check_failed"})
+	}
+	if !canGenerate {
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error":   reason,
+			"message": "Usage limit exceeded. Please upgrade your plan.",
+		})
+	}
+
+	format := opts.Format
+	job := &models.GenerationJob{
+		UserID:         owner,
+		RowsRequested:  events,
+		DataMode:       models.DataModeZeroRealData,
+		DataModeSource: models.DataModeSourceDefault,
+		OutputFormat:   &format,
+	}
+	out, err := d.Generations.Insert(context.Background(), job)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	if d.Queue != nil {
+		req := &agents.GenerationRequest{
+			UserID:       owner,
+			Config:       agents.GenerationConfig{Rows: events},
+			ZeroRealData: true,
+			EventStream:  &opts,
+		}
+		if err := d.Queue.Enqueue(context.Background(), out.ID, req); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "enqueue_failed", "job_id": out.ID})
+		}
+		out.Status = models.GenQueued
+	}
+	return c.Status(fiber.StatusAccepted).JSON(out)
+}
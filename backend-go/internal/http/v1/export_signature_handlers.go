@@ -0,0 +1,144 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/artifacts"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/signing"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SignedManifest returns the artifacts manifest of a completed job signed
+// with the platform key, for recipients of the data to check where it came
+// from and that it is unchanged. files=true adds a detached signature per
+// file.
+func (d GenerationDeps) SignedManifest(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Signer == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "export_signing_unconfigured"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionInspect)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if job.Status != models.GenCompleted || job.OutputKey == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "not_ready"})
+	}
+	list, err := artifacts.Manifest(job)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "manifest_failed"})
+	}
+	env, err := d.Signer.Sign(job, list, c.QueryBool("files"), time.Now())
+	if errors.Is(err, signing.ErrNoChecksums) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "checksums_unavailable", "message": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "signing_failed"})
+	}
+	return c.JSON(env)
+}
+
+// SignatureDeps publishes the keys export manifests are signed with and
+// verifies signed manifests for anyone holding one; no account is needed
+type SignatureDeps struct {
+	// Keys is nil when no export signing key is configured
+	Keys *signing.KeyRing
+}
+
+// PublicKeys lists the public export signing keys: the active one and
+// the retired ones that still verify what they signed
+func (d SignatureDeps) PublicKeys(c *fiber.Ctx) error {
+	if d.Keys == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "export_signing_unconfigured"})
+	}
+	return c.JSON(fiber.Map{"active_key_id": d.Keys.ActiveID(), "keys": d.Keys.PublicKeys()})
+}
+
+type verifyManifestRequest struct {
+	signing.Envelope
+	// Files are the name and SHA-256 of files at hand, checked against the
+	// manifest
+	Files []struct {
+		Name   string `json:"name"`
+		SHA256 string `json:"sha256"`
+	} `json:"files"`
+}
+
+// VerifyManifest checks a signed manifest and, optionally, the digests of
+// files against it. A manifest that does not verify is reported as such
+// rather than as a failed request.
+func (d SignatureDeps) VerifyManifest(c *fiber.Ctx) error {
+	if d.Keys == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "export_signing_unconfigured"})
+	}
+	var req verifyManifestRequest
+	if err := c.BodyParser(&req); err != nil || req.Payload == "" || req.Signature == "" || req.KeyID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request"})
+	}
+	m, err := d.Keys.Verify(req.Envelope)
+	if err != nil {
+		return c.JSON(fiber.Map{"valid": false, "key_id": req.KeyID, "reason": verifyReason(err)})
+	}
+	res := fiber.Map{"valid": true, "key_id": req.KeyID, "key_status": d.Keys.Status(req.KeyID), "manifest": m}
+	if len(req.Files) > 0 {
+		files := make([]fiber.Map, 0, len(req.Files))
+		for _, f := range req.Files {
+			entry := fiber.Map{"name": f.Name, "sha256": f.SHA256}
+			switch signed, ok := m.Find(f.Name); {
+			case !ok:
+				entry["valid"], entry["reason"] = false, "not_in_manifest"
+			case !strings.EqualFold(signed.SHA256, f.SHA256):
+				entry["valid"], entry["reason"] = false, "checksum_mismatch"
+			default:
+				entry["valid"] = true
+			}
+			if entry["valid"] == false {
+				res["valid"] = false
+			}
+			files = append(files, entry)
+		}
+		res["files"] = files
+	}
+	return c.JSON(res)
+}
+
+type verifyFileRequest struct {
+	KeyID     string `json:"key_id"`
+	JobID     int64  `json:"job_id"`
+	Name      string `json:"name"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature"`
+}
+
+// VerifyFile checks the detached signature of a single file against the
+// SHA-256 the caller computed for it
+func (d SignatureDeps) VerifyFile(c *fiber.Ctx) error {
+	if d.Keys == nil {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "export_signing_unconfigured"})
+	}
+	var req verifyFileRequest
+	if err := c.BodyParser(&req); err != nil || req.KeyID == "" || req.JobID == 0 || req.Name == "" || req.SHA256 == "" || req.Signature == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_request"})
+	}
+	if err := d.Keys.VerifyFile(req.KeyID, req.JobID, req.Name, req.SHA256, req.Signature); err != nil {
+		return c.JSON(fiber.Map{"valid": false, "key_id": req.KeyID, "reason": verifyReason(err)})
+	}
+	return c.JSON(fiber.Map{"valid": true, "key_id": req.KeyID, "key_status": d.Keys.Status(req.KeyID)})
+}
+
+func verifyReason(err error) string {
+	if errors.Is(err, signing.ErrUnknownKey) {
+		return "unknown_key"
+	}
+	return "bad_signature"
+}
@@ -0,0 +1,146 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fhir"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errFHIRMappingRequired = errors.New("FHIR export needs a mapping on the dataset")
+
+type FHIRMappingRequest struct {
+	Fields models.FHIRFields `json:"fields"`
+}
+
+// GetFHIRMapping returns the FHIR export mapping of a dataset
+func (d DatasetDeps) GetFHIRMapping(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.FHIRMappings == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.accessibleDataset(owner, id, models.DatasetPermRead); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	out, err := d.FHIRMappings.Get(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "mapping_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(out)
+}
+
+// SetFHIRMapping maps a dataset's columns to the Patient, Encounter and
+// Observation elements its generated rows are exported as in the FHIR
+// format
+func (d DatasetDeps) SetFHIRMapping(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.FHIRMappings == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var body FHIRMappingRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	mapping := models.FHIRMapping{DatasetID: id, Fields: body.Fields, UpdatedBy: owner}
+	fhir.Normalize(&mapping)
+	if err := fhir.Validate(mapping, nil); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_mapping", "message": err.Error()})
+	}
+
+	// Fields are checked against the data when it is readable, and take the
+	// column names as the data spells them so generated rows match
+	profiles, err := d.profile(ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	if profiles != nil {
+		columns := make([]string, len(profiles))
+		for i, p := range profiles {
+			columns[i] = p.Name
+		}
+		if err := fhir.Validate(mapping, columns); err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_mapping", "message": err.Error()})
+		}
+		for i, f := range mapping.Fields {
+			for _, col := range columns {
+				if strings.EqualFold(col, f.Column) {
+					mapping.Fields[i].Column = col
+					break
+				}
+			}
+		}
+	}
+	out, err := d.FHIRMappings.Upsert(context.Background(), &mapping)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditAccess(c, owner, "fhir_mapping_set", "dataset", id, map[string]any{
+		"fields": len(out.Fields),
+	})
+	return c.JSON(out)
+}
+
+// DeleteFHIRMapping removes a dataset's mapping; jobs already queued keep
+// it
+func (d DatasetDeps) DeleteFHIRMapping(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.FHIRMappings == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	err := d.FHIRMappings.Delete(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "mapping_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	_ = d.auditAccess(c, owner, "fhir_mapping_removed", "dataset", id, nil)
+	return c.JSON(fiber.Map{"message": "mapping_removed"})
+}
+
+// fhirMapping loads the mapping a FHIR job exports with; jobs in other
+// formats need none
+func (d GenerationDeps) fhirMapping(format string, datasetID int64) (*agents.FHIRMapping, error) {
+	if format != fhir.Format {
+		return nil, nil
+	}
+	if d.FHIRMappings == nil {
+		return nil, errFHIRMappingRequired
+	}
+	mapping, err := d.FHIRMappings.Get(context.Background(), datasetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errFHIRMappingRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fhir.Mapping(mapping), nil
+}
@@ -0,0 +1,157 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/finmsg"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errFinancialMessageLayoutRequired = errors.New("financial message export needs a layout on the dataset")
+
+type FinancialMessageLayoutRequest struct {
+	// MessageType is pain.001.001.09, camt.053.001.08 or mt103
+	MessageType string                          `json:"message_type"`
+	Columns     models.FinancialMessageColumns  `json:"columns"`
+	Envelope    models.FinancialMessageEnvelope `json:"envelope"`
+}
+
+// GetFinancialMessageLayout returns the payment message layout of a
+// dataset
+func (d DatasetDeps) GetFinancialMessageLayout(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.FinancialMessageLayouts == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.accessibleDataset(owner, id, models.DatasetPermRead); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	out, err := d.FinancialMessageLayouts.Get(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "layout_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(out)
+}
+
+// SetFinancialMessageLayout sets the message type, the column holding each
+// part of a transaction and the envelope a dataset's generated rows are
+// rendered with in the financial_message format
+func (d DatasetDeps) SetFinancialMessageLayout(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.FinancialMessageLayouts == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var body FinancialMessageLayoutRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	layout := models.FinancialMessageLayout{
+		DatasetID:   id,
+		MessageType: body.MessageType,
+		Columns:     body.Columns,
+		Envelope:    body.Envelope,
+		UpdatedBy:   owner,
+	}
+	finmsg.Normalize(&layout)
+	if err := finmsg.Validate(layout, nil); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_layout", "message": err.Error()})
+	}
+
+	// Columns are checked against the data when it is readable, and stored
+	// as the data names them so generated rows match
+	profiles, err := d.profile(ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	if profiles != nil {
+		columns := make([]string, len(profiles))
+		for i, p := range profiles {
+			columns[i] = p.Name
+		}
+		if err := finmsg.Validate(layout, columns); err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_layout", "message": err.Error()})
+		}
+		for role, col := range layout.Columns {
+			for _, name := range columns {
+				if strings.EqualFold(name, col) {
+					layout.Columns[role] = name
+					break
+				}
+			}
+		}
+	}
+	out, err := d.FinancialMessageLayouts.Upsert(context.Background(), &layout)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditAccess(c, owner, "financial_message_layout_set", "dataset", id, map[string]any{
+		"message_type": out.MessageType,
+		"roles":        len(out.Columns),
+	})
+	return c.JSON(out)
+}
+
+// DeleteFinancialMessageLayout removes a dataset's layout; jobs already
+// queued keep it
+func (d DatasetDeps) DeleteFinancialMessageLayout(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.FinancialMessageLayouts == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	err := d.FinancialMessageLayouts.Delete(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "layout_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	_ = d.auditAccess(c, owner, "financial_message_layout_removed", "dataset", id, nil)
+	return c.JSON(fiber.Map{"message": "layout_removed"})
+}
+
+// financialMessageLayout loads the layout a payment message job renders
+// with; jobs in other formats need none
+func (d GenerationDeps) financialMessageLayout(format string, datasetID int64) (*agents.FinancialMessageLayout, error) {
+	if format != finmsg.Format {
+		return nil, nil
+	}
+	if d.FinancialMessageLayouts == nil {
+		return nil, errFinancialMessageLayoutRequired
+	}
+	layout, err := d.FinancialMessageLayouts.Get(context.Background(), datasetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errFinancialMessageLayoutRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	return finmsg.Layout(layout), nil
+}
@@ -0,0 +1,159 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fixedwidth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errFixedWidthLayoutRequired = errors.New("fixed-width export needs a layout on the dataset")
+
+type FixedWidthLayoutRequest struct {
+	Fields models.FixedWidthFields `json:"fields"`
+	// Encoding defaults to ascii, RecordTerminator to lf and Overflow to
+	// reject
+	Encoding         string `json:"encoding,omitempty"`
+	RecordTerminator string `json:"record_terminator,omitempty"`
+	Overflow         string `json:"overflow,omitempty"`
+}
+
+// GetFixedWidthLayout returns the fixed-width export layout of a dataset
+func (d DatasetDeps) GetFixedWidthLayout(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.FixedWidthLayouts == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.accessibleDataset(owner, id, models.DatasetPermRead); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	out, err := d.FixedWidthLayouts.Get(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "layout_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(fiber.Map{"layout": out, "record_length": fixedwidth.RecordLength(fixedwidth.Layout(out))})
+}
+
+// SetFixedWidthLayout defines the field widths, padding and encoding a
+// dataset's generated rows are exported with in the fixed-width format
+func (d DatasetDeps) SetFixedWidthLayout(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.FixedWidthLayouts == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var body FixedWidthLayoutRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	layout := models.FixedWidthLayout{
+		DatasetID:        id,
+		Fields:           body.Fields,
+		Encoding:         body.Encoding,
+		RecordTerminator: body.RecordTerminator,
+		Overflow:         body.Overflow,
+		UpdatedBy:        owner,
+	}
+	fixedwidth.Normalize(&layout)
+	if err := fixedwidth.Validate(layout, nil); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_layout", "message": err.Error()})
+	}
+
+	// Fields are checked against the data when it is readable, and take the
+	// column names as the data spells them so generated rows match
+	profiles, err := d.profile(ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	if profiles != nil {
+		columns := make([]string, len(profiles))
+		for i, p := range profiles {
+			columns[i] = p.Name
+		}
+		if err := fixedwidth.Validate(layout, columns); err != nil {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_layout", "message": err.Error()})
+		}
+		for i, f := range layout.Fields {
+			for _, col := range columns {
+				if strings.EqualFold(col, f.Column) {
+					layout.Fields[i].Column = col
+					break
+				}
+			}
+		}
+	}
+	out, err := d.FixedWidthLayouts.Upsert(context.Background(), &layout)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditAccess(c, owner, "fixed_width_layout_set", "dataset", id, map[string]any{
+		"fields":   len(out.Fields),
+		"encoding": out.Encoding,
+		"overflow": out.Overflow,
+	})
+	return c.JSON(fiber.Map{"layout": out, "record_length": fixedwidth.RecordLength(fixedwidth.Layout(out))})
+}
+
+// DeleteFixedWidthLayout removes a dataset's layout; jobs already queued
+// keep it
+func (d DatasetDeps) DeleteFixedWidthLayout(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.FixedWidthLayouts == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	err := d.FixedWidthLayouts.Delete(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "layout_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	_ = d.auditAccess(c, owner, "fixed_width_layout_removed", "dataset", id, nil)
+	return c.JSON(fiber.Map{"message": "layout_removed"})
+}
+
+// fixedWidthLayout loads the layout a fixed-width job exports with; jobs
+// in other formats need none
+func (d GenerationDeps) fixedWidthLayout(format string, datasetID int64) (*agents.FixedWidthLayout, error) {
+	if format != fixedwidth.Format {
+		return nil, nil
+	}
+	if d.FixedWidthLayouts == nil {
+		return nil, errFixedWidthLayoutRequired
+	}
+	layout, err := d.FixedWidthLayouts.Get(context.Background(), datasetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errFixedWidthLayoutRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fixedwidth.Layout(layout), nil
+}
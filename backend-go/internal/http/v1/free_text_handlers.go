@@ -0,0 +1,119 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/freetext"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errFreeTextUnavailable = errors.New("dataset rows are not readable for free-text profiling")
+
+// freeTextProfile profiles the free-text columns of a dataset's leading
+// rows; hidden columns are used to scrub the text but are never profiled
+func freeTextProfile(client storage.SignedURLProvider, ds *models.Dataset, opts freetext.Options, hidden []string) ([]freetext.ColumnProfile, error) {
+	reader, ok := client.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" || (ds.FileType != "csv" && ds.FileType != "json") {
+		return nil, errFreeTextUnavailable
+	}
+	columns, rows, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+	if err != nil {
+		return nil, err
+	}
+	return freetext.Profile(columns, rows, opts, hidden)
+}
+
+// GetFreeTextColumns returns the free-text columns of a dataset with their
+// length quantiles, languages, the PII found in them and scrubbed examples.
+// A comma-separated columns query names them instead of detecting them.
+// Hidden columns are left out.
+func (d DatasetDeps) GetFreeTextColumns(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.accessibleDataset(owner, id, models.DatasetPermRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	acl, err := d.columnACL(owner, ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+	}
+	var opts freetext.Options
+	if q := strings.TrimSpace(c.Query("columns")); q != "" {
+		opts.Columns = strings.Split(q, ",")
+	}
+	if err := opts.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_free_text", "message": err.Error()})
+	}
+	hidden := acl.Hidden()
+	for _, col := range opts.Columns {
+		if containsFold(hidden, strings.TrimSpace(col)) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": col})
+		}
+	}
+	profiles, err := freeTextProfile(d.StorageClient, ds, opts, hidden)
+	switch {
+	case errors.Is(err, errFreeTextUnavailable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "dataset_not_readable"})
+	case errors.Is(err, freetext.ErrUnknownColumn), errors.Is(err, freetext.ErrNotText):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	for i := range profiles {
+		profiles[i].SourceHashes = nil
+	}
+	if profiles == nil {
+		profiles = []freetext.ColumnProfile{}
+	}
+	return c.JSON(fiber.Map{"dataset_id": id, "profile_rows": profileRows, "columns": profiles})
+}
+
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// freeTextColumns profiles the free-text columns of a dataset for a job, at
+// request time like array columns. Detected columns are skipped when the
+// dataset is not readable; named ones are not.
+func (d GenerationDeps) freeTextColumns(ds *models.Dataset, owner, datasetID int64, opts *freetext.Options, hidden []string) ([]agents.FreeTextColumn, error) {
+	if ds == nil {
+		if d.Datasets == nil {
+			return nil, nil
+		}
+		var err error
+		if ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, datasetID); err != nil {
+			return nil, err
+		}
+	}
+	var named freetext.Options
+	if opts != nil {
+		named = *opts
+	}
+	profiles, err := freeTextProfile(d.StorageClient, ds, named, hidden)
+	if errors.Is(err, errFreeTextUnavailable) && len(named.Columns) == 0 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]agents.FreeTextColumn, 0, len(profiles))
+	for _, p := range profiles {
+		out = append(out, p.FreeTextColumn)
+	}
+	return out, nil
+}
@@ -0,0 +1,186 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/artifacts"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/evalreport"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Artifacts returns the manifest of everything a completed job produced:
+// its data files, reports and manifests with their sizes and SHA-256
+// checksums. Data files are linked, with the expiry of their links, when
+// the caller may download them; encrypted ones need an active access grant.
+func (d GenerationDeps) Artifacts(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if job.Status != models.GenCompleted || job.OutputKey == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "not_ready"})
+	}
+	list, err := artifacts.Manifest(job)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "manifest_failed"})
+	}
+
+	var grant *models.OutputAccessGrant
+	linked := true
+	if d.OutputKeys != nil {
+		if _, err := d.OutputKeys.GetKey(context.Background(), id); err == nil {
+			if grant, err = d.OutputKeys.ActiveGrant(context.Background(), id, owner); err != nil {
+				grant, linked = nil, false
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+		}
+	}
+	store, err := d.outputStorage(job)
+	if err != nil {
+		return outputStorageError(c, err)
+	}
+	ttl := signedURLTTL(d.SignedURLTTL)
+	for i := range list {
+		a := &list[i]
+		switch {
+		case a.Kind != models.ArtifactData && a.ObjectKey != "":
+			a.URL = fmt.Sprintf("/api/v1/generation/%d/report?format=%s", id, a.Format)
+			continue
+		case a.Kind != models.ArtifactData:
+			a.URL = fmt.Sprintf("/api/v1/generation/%d/artifacts/%s", id, a.Name)
+			continue
+		}
+		if !linked || store == nil {
+			continue
+		}
+		url, err := store.GetSignedURL(context.Background(), a.ObjectKey, ttl)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed_to_generate_download_url"})
+		}
+		expires := time.Now().UTC().Add(ttl).Truncate(time.Second)
+		a.URL, a.ExpiresAt = url, &expires
+	}
+
+	res := fiber.Map{"job_id": id, "artifacts": list}
+	if d.Signer != nil {
+		res["signed_manifest_url"] = fmt.Sprintf("/api/v1/generation/%d/signed-manifest", id)
+	}
+	if grant != nil {
+		res["access_grant_id"], res["access_expires_at"] = grant.ID, grant.ExpiresAt
+	} else if !linked {
+		res["output_access_required"] = true
+	}
+	return c.JSON(res)
+}
+
+// Artifact serves a report or manifest of a job exactly as checksummed in
+// its artifacts manifest
+func (d GenerationDeps) Artifact(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if job.Status != models.GenCompleted {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "not_ready"})
+	}
+	doc, ok, err := artifacts.Find(job, c.Params("name"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "manifest_failed"})
+	}
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "artifact_not_found"})
+	}
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	c.Set("X-Checksum-SHA256", artifacts.Checksum(doc.Content))
+	return c.Send(doc.Content)
+}
+
+// Report serves the evaluation report of a completed job, as HTML or with
+// format=pdf as a PDF document. Reports stored with the job are served as
+// written; jobs without one, such as those completed before reports were
+// stored, have theirs rendered from what they recorded.
+func (d GenerationDeps) Report(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	format := c.Query("format", evalreport.FormatHTML)
+	if !slices.Contains(evalreport.Formats, format) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unsupported_format", "formats": evalreport.Formats})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionInspect)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if job.Status != models.GenCompleted {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "not_ready"})
+	}
+	content, err := d.storedReport(job, format)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "report_unavailable"})
+	}
+	if content == nil {
+		if content, err = evalreport.Render(evalreport.New(job, time.Now()), format); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "report_failed"})
+		}
+	}
+	c.Set(fiber.HeaderContentType, evalreport.ContentType(format))
+	c.Set("X-Checksum-SHA256", artifacts.Checksum(content))
+	if format == evalreport.FormatPDF {
+		c.Attachment(fmt.Sprintf("generation-%d-report.pdf", job.ID))
+	} else {
+		// The page is self-contained; nothing it holds may load or run
+		c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'none'; style-src 'unsafe-inline'")
+	}
+	return c.Send(content)
+}
+
+// storedReport reads the report of a job stored in format; nil when none
+// was stored or the storage cannot be read back
+func (d GenerationDeps) storedReport(job *models.GenerationJob, format string) ([]byte, error) {
+	if job.QualityDetails == nil {
+		return nil, nil
+	}
+	store, err := d.outputStorage(job)
+	if err != nil {
+		return nil, err
+	}
+	reader, ok := store.(storage.ObjectReader)
+	if !ok {
+		return nil, nil
+	}
+	for _, r := range job.QualityDetails.Reports {
+		if r.Format != format || r.Status != models.ExportCompleted {
+			continue
+		}
+		obj, err := reader.OpenObject(context.Background(), r.ObjectKey)
+		if err != nil {
+			return nil, err
+		}
+		defer obj.Close()
+		return io.ReadAll(obj)
+	}
+	return nil, nil
+}
@@ -0,0 +1,164 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// generationAudit builds the audit record of a job about to be created
+func (d GenerationDeps) generationAudit(c *fiber.Ctx, ds *models.Dataset, job *models.GenerationJob, body StartGenerationRequest,
+	protections []privacy.ColumnPolicy, grounding *privacy.GroundingSample) *models.GenerationAudit {
+	a := &models.GenerationAudit{
+		UserID:        job.UserID,
+		DatasetID:     job.DatasetID,
+		Columns:       d.sourceColumns(ds, job.UserID, job.DatasetID, job.MaskedColumns),
+		MaskedColumns: job.MaskedColumns,
+		RowsRequested: job.RowsRequested,
+		PrivacyLevel:  job.PrivacyLevel,
+		DataMode:      job.DataMode,
+		SampleSharing: models.SampleSharingLocalOnly,
+		Provider:      job.RequestedProvider,
+		IPAddress:     c.IP(),
+	}
+	if len(protections) > 0 {
+		a.ColumnPrivacy = make(models.ColumnMechanisms, len(protections))
+		for _, p := range protections {
+			a.ColumnPrivacy[p.Column] = p.Mechanism
+		}
+	}
+	switch {
+	case job.DataMode == models.DataModeZeroRealData:
+		a.SampleSharing = models.SampleSharingZeroRealData
+	case grounding != nil:
+		a.SampleSharing = models.SampleSharingGrounded
+		a.SourceRowsShared = len(grounding.SourceRows)
+	}
+	if body.Strategy != "" {
+		strategy := string(body.Strategy)
+		a.Strategy = &strategy
+	}
+	if body.CustomModelID != 0 {
+		a.CustomModelID = &body.CustomModelID
+	}
+	return a
+}
+
+// sourceColumns returns the columns of a dataset a job generates from,
+// without those masked from the requester; nil when they cannot be read
+func (d GenerationDeps) sourceColumns(ds *models.Dataset, owner, datasetID int64, masked []string) []string {
+	if ds == nil && d.Datasets != nil {
+		var err error
+		if ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, datasetID); err != nil {
+			return nil
+		}
+	}
+	reader, ok := d.StorageClient.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" {
+		return nil
+	}
+	columns, _, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, 1)
+	if err != nil {
+		return nil
+	}
+	out := make([]string, 0, len(columns))
+	for _, col := range columns {
+		hidden := false
+		for _, m := range masked {
+			if strings.EqualFold(col, m) {
+				hidden = true
+				break
+			}
+		}
+		if !hidden {
+			out = append(out, col)
+		}
+	}
+	return out
+}
+
+var errInvalidAuditFilter = errors.New("invalid generation audit filter")
+
+// generationAuditFilter reads column, dataset_id, user_id, start and end
+// (YYYY-MM-DD, end exclusive), after_id and limit (default 100, max 1000)
+func generationAuditFilter(c *fiber.Ctx) (models.GenerationAuditFilter, error) {
+	f := models.GenerationAuditFilter{
+		Column:    strings.TrimSpace(c.Query("column")),
+		DatasetID: int64(c.QueryInt("dataset_id")),
+		UserID:    int64(c.QueryInt("user_id")),
+		Limit:     c.QueryInt("limit", 100),
+	}
+	afterID, err := strconv.ParseInt(c.Query("after_id", "0"), 10, 64)
+	if err != nil || afterID < 0 || f.Limit <= 0 || f.Limit > 1000 {
+		return f, errInvalidAuditFilter
+	}
+	f.AfterID = afterID
+	for param, at := range map[string]*time.Time{"start": &f.Start, "end": &f.End} {
+		if v := c.Query(param); v != "" {
+			if *at, err = time.Parse(time.DateOnly, v); err != nil {
+				return f, errInvalidAuditFilter
+			}
+		}
+	}
+	if !f.Start.IsZero() && !f.End.IsZero() && !f.End.After(f.Start) {
+		return f, errInvalidAuditFilter
+	}
+	return f, nil
+}
+
+// searchGenerationAudit answers a search with a page of records and the
+// after_id of the next page, if any
+func searchGenerationAudit(c *fiber.Ctx, audits *repo.GenerationAuditRepo, f models.GenerationAuditFilter) error {
+	records, err := audits.Search(context.Background(), f)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "search_failed"})
+	}
+	if records == nil {
+		records = []models.GenerationAudit{}
+	}
+	resp := fiber.Map{"records": records}
+	if len(records) == f.Limit {
+		resp["next_after_id"] = records[len(records)-1].ID
+	}
+	return c.JSON(resp)
+}
+
+// SearchGenerationAudit searches the generation audit of all users, such as
+// who generated data from a column over a quarter (column, dataset_id,
+// user_id, org_id, start, end)
+func (d GenerationDeps) SearchGenerationAudit(c *fiber.Ctx) error {
+	f, err := generationAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_filter"})
+	}
+	f.OrgID = int64(c.QueryInt("org_id"))
+	return searchGenerationAudit(c, d.GenerationAudit, f)
+}
+
+// SearchGenerationAudit searches the generation audit of the organization's
+// members. Only admins and auditors see it.
+func (d OrgDeps) SearchGenerationAudit(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	f, err := generationAuditFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_filter"})
+	}
+	member, err := d.member(owner, orgs.ActionAudit)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	f.OrgID = member.OrgID
+	return searchGenerationAudit(c, d.GenerationAudit, f)
+}
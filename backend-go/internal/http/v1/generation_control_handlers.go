@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/jobs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Cancel stops a job for good. A running job is interrupted, its partial
+// output discarded, and the rows it reserved return to the owner's quota.
+func (d GenerationDeps) Cancel(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	starter, err := d.controlledBy(context.Background(), owner, id)
+	if err != nil {
+		return d.transitionError(c, owner, id, err, "job_not_cancellable", "cancel_failed")
+	}
+	job, err := d.Generations.Cancel(context.Background(), starter, id)
+	if err != nil {
+		return d.transitionError(c, owner, id, err, "job_not_cancellable", "cancel_failed")
+	}
+	d.Workers.Interrupt(id)
+	d.Events.Publish(jobs.Event{Type: jobs.EventCancelled, JobID: id, Status: models.GenCancelled})
+	out := fiber.Map{"message": "job_cancelled", "job": job}
+	if d.Usage != nil {
+		if refund, err := d.Usage.Refund(context.Background(), job); err == nil {
+			out["refund"] = refund
+		}
+	}
+	return c.JSON(out)
+}
+
+// Pause takes a queued or running job off the queue until it is resumed. A
+// running job is interrupted; it starts over when resumed and keeps its
+// reserved rows meanwhile.
+func (d GenerationDeps) Pause(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	starter, err := d.controlledBy(context.Background(), owner, id)
+	if err != nil {
+		return d.transitionError(c, owner, id, err, "job_not_pausable", "pause_failed")
+	}
+	job, err := d.Generations.Pause(context.Background(), starter, id)
+	if err != nil {
+		return d.transitionError(c, owner, id, err, "job_not_pausable", "pause_failed")
+	}
+	d.Workers.Interrupt(id)
+	d.Events.Publish(jobs.Event{Type: jobs.EventPaused, JobID: id, Status: models.GenPaused})
+	return c.JSON(job)
+}
+
+// Resume queues a paused job again
+func (d GenerationDeps) Resume(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	starter, err := d.controlledBy(context.Background(), owner, id)
+	if err != nil {
+		return d.transitionError(c, owner, id, err, "job_not_paused", "resume_failed")
+	}
+	job, err := d.Generations.Resume(context.Background(), starter, id)
+	if err != nil {
+		return d.transitionError(c, owner, id, err, "job_not_paused", "resume_failed")
+	}
+	d.Events.Publish(jobs.Event{Type: jobs.EventResumed, JobID: id, Status: models.GenQueued})
+	return c.JSON(job)
+}
+
+// transitionError answers a status change the job refused: not found when
+// the user can see no such job, forbidden when it belongs to another member
+// of their organization they do not manage, and conflict with its status
+// when it is in the wrong state
+func (d GenerationDeps) transitionError(c *fiber.Ctx, owner, id int64, err error, conflict, failed string) error {
+	if errors.Is(err, orgs.ErrForbidden) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": failed})
+	}
+	job, err := d.job(context.Background(), owner, id, orgs.ActionManage)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": failed})
+	}
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": conflict, "status": job.Status})
+}
+
+// controlledBy returns who started a job the user may cancel, pause or
+// resume: the user themselves, or another member of an organization the
+// user manages. orgs.ErrForbidden when the user can only see the job.
+func (d GenerationDeps) controlledBy(ctx context.Context, userID, id int64) (int64, error) {
+	if d.Orgs == nil {
+		return userID, nil
+	}
+	job, err := d.job(ctx, userID, id, orgs.ActionManage)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, rerr := d.job(ctx, userID, id, orgs.ActionRead); rerr == nil {
+			return 0, orgs.ErrForbidden
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return job.UserID, nil
+}
@@ -0,0 +1,198 @@
+package v1
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgsettings"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/payments"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// exportOutput streams a job's output converted to format, when the
+// owner's plan includes it. Encrypted outputs are decrypted under the
+// caller's active grant, and the export is audited like a key release.
+func (d GenerationDeps) exportOutput(c *fiber.Ctx, owner int64, job *models.GenerationJob, grant *models.OutputAccessGrant, format string) error {
+	if !export.Supported(format) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unsupported_format", "formats": export.Formats})
+	}
+	allowed, err := d.planExportFormats(owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "plan_check_failed"})
+	}
+	if !slices.Contains(allowed, format) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "export_format_not_in_plan", "allowed_formats": allowed})
+	}
+	// Only row outputs convert; record layouts such as FHIR bundles do not
+	source := export.JSON
+	if job.OutputFormat != nil && *job.OutputFormat != "" {
+		source = *job.OutputFormat
+	}
+	if source != export.JSON && source != export.CSV {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "conversion_unsupported", "output_format": source})
+	}
+	store, err := d.outputStorage(job)
+	if err != nil {
+		return outputStorageError(c, err)
+	}
+	reader, ok := store.(storage.ObjectReader)
+	if !ok || (grant != nil && d.Envelope == nil) {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+
+	ctx := context.Background()
+	obj, err := reader.OpenObject(ctx, *job.OutputKey)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "export_failed"})
+	}
+	raw, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "export_failed"})
+	}
+	if grant != nil {
+		key, err := d.OutputKeys.GetKey(ctx, job.ID)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "key_not_found"})
+		}
+		plain, err := d.Envelope.Unwrap(key.MasterKeyID, key.WrappedKey)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "key_unavailable"})
+		}
+		if raw, err = storage.Open(plain, raw); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "export_failed"})
+		}
+		if err := d.auditOutputAccess(c, owner, "output_exported", grant, map[string]any{"format": format}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "audit_failed"})
+		}
+	}
+
+	rows, err := export.ReadRows(bytes.NewReader(raw), source)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "export_failed"})
+	}
+	schema := export.InferSchema(rows)
+	if err := export.Check(format, schema, len(rows)); errors.Is(err, export.ErrTooLarge) {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "too_large_for_format", "message": err.Error()})
+	}
+
+	c.Attachment(fmt.Sprintf("generation-%d.%s", job.ID, export.Extension(format)))
+	c.Set(fiber.HeaderContentType, export.ContentType(format))
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// A file that failed midway is left unfinished rather than closed
+		// as if complete
+		ew, err := export.NewWriter(format, w, schema)
+		for i := 0; err == nil && i < len(rows); i++ {
+			err = ew.Write(rows[i])
+		}
+		if err == nil {
+			_ = ew.Close()
+		}
+		_ = w.Flush()
+	})
+	return nil
+}
+
+var errExportNotInPlan = errors.New("export format is not in the plan")
+
+// exportFormats checks the further formats a job asks for against its
+// owner's plan and organization and drops repeats
+func (d GenerationDeps) exportFormats(owner int64, formats []string) ([]string, error) {
+	if len(formats) == 0 {
+		return nil, nil
+	}
+	allowed, err := d.planExportFormats(owner)
+	if err != nil {
+		return nil, err
+	}
+	var org *models.OrgSettings
+	if d.OrgSettings != nil {
+		if org, err = d.OrgSettings.ForUser(context.Background(), owner); err != nil {
+			return nil, err
+		}
+	}
+	var out []string
+	for _, f := range formats {
+		switch {
+		case slices.Contains(out, f):
+			continue
+		case !export.Supported(f):
+			return nil, fmt.Errorf("%w %q", export.ErrUnsupportedFormat, f)
+		case !slices.Contains(allowed, f):
+			return nil, fmt.Errorf("%w: %s", errExportNotInPlan, f)
+		}
+		if org != nil {
+			if err := orgsettings.CheckExportFormat(org, f); err != nil {
+				return nil, err
+			}
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// exportLinks signs a download URL in store for each export of a job that
+// was written
+func (d GenerationDeps) exportLinks(store SignedURLProvider, job *models.GenerationJob) ([]fiber.Map, error) {
+	if job.QualityDetails == nil || len(job.QualityDetails.Exports) == 0 {
+		return nil, nil
+	}
+	out := make([]fiber.Map, 0, len(job.QualityDetails.Exports))
+	for _, e := range job.QualityDetails.Exports {
+		link := fiber.Map{"format": e.Format, "status": e.Status}
+		switch {
+		case e.Status != models.ExportCompleted:
+			link["error"] = e.Error
+		case store != nil:
+			url, err := store.GetSignedURL(context.Background(), e.ObjectKey, signedURLTTL(d.SignedURLTTL))
+			if err != nil {
+				return nil, err
+			}
+			link["download_url"] = url
+		default:
+			link["download_url"] = e.ObjectKey
+		}
+		if e.SHA256 != "" {
+			link["sha256"] = e.SHA256
+		}
+		out = append(out, link)
+	}
+	return out, nil
+}
+
+// planExportFormats returns the download formats of a user's plan
+func (d GenerationDeps) planExportFormats(owner int64) ([]string, error) {
+	tier := models.TierFree
+	if d.Users != nil {
+		u, err := d.Users.GetByID(context.Background(), owner)
+		if err != nil {
+			return nil, err
+		}
+		tier = u.SubscriptionTier
+	}
+	return payments.PlanExportFormats(string(tier)), nil
+}
+
+// rejectExportFormats refuses a job of a kind that is delivered in its own
+// format only when its request asks for further export formats, rather
+// than starting it and dropping them
+func rejectExportFormats(c *fiber.Ctx, kind string) (bool, error) {
+	var body struct {
+		ExportFormats []string `json:"export_formats"`
+	}
+	if err := c.BodyParser(&body); err != nil || len(body.ExportFormats) == 0 {
+		return false, nil
+	}
+	return true, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		"error":   "export_formats_unsupported",
+		"message": kind + " jobs cannot write further export formats",
+	})
+}
@@ -2,13 +2,47 @@ package v1
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/annotations"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/arrays"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/buckets"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/delta"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fhir"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/finmsg"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fixedwidth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/freetext"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/hierarchy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/jobs"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/modelserving"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/nested"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgpolicy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgsettings"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/promptguard"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/provenance"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rareevents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/relationships"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/signing"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/structure"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/templates"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/usage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/vocabulary"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/weights"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -16,11 +50,202 @@ type GenerationDeps struct {
 	Generations   *repo.GenerationRepo
 	Usage         *usage.UsageService
 	StorageClient storage.SignedURLProvider
+	// SignedURLTTL is the lifetime of provider download URLs
+	SignedURLTTL  time.Duration
+	Grants        *repo.DatasetGrantRepo
+	Datasets      *repo.DatasetRepo
+	DataPolicies  *repo.DataPolicyRepo
+	OrgSettings   *repo.OrgSettingsRepo
+	Annotations   *repo.ColumnAnnotationRepo
+	Relationships *repo.RelationshipHintRepo
+	Hierarchies   *repo.HierarchyRepo
+	Vocabularies  *repo.VocabularyRepo
+	ColumnPrivacy *repo.ColumnPrivacyRepo
+	// PII holds the scanned classification of dataset columns; classified
+	// columns are masked in grounding samples
+	PII *repo.DatasetPIIRepo
+	// PrivacyBudgets is the ledger jobs are charged to, up to
+	// PrivacyBudgetEpsilon and PrivacyBudgetDelta per user and dataset
+	PrivacyBudgets       *repo.PrivacyBudgetRepo
+	PrivacyBudgetEpsilon float64
+	PrivacyBudgetDelta   float64
+	// FixedWidthLayouts holds the record layouts of fixed-width exports
+	FixedWidthLayouts *repo.FixedWidthLayoutRepo
+	// QualityPolicies holds the quality the generated rows of datasets
+	// must reach
+	QualityPolicies *repo.QualityPolicyRepo
+	// FHIRMappings holds the column mappings of FHIR exports
+	FHIRMappings *repo.FHIRMappingRepo
+	// FinancialMessageLayouts holds the layouts of payment message exports
+	FinancialMessageLayouts *repo.FinancialMessageLayoutRepo
+	// Tx makes the budget charge and the job it pays for atomic
+	Tx *repo.Transactor
+	// Queue hands created jobs to the background workers
+	Queue *jobs.Queue
+	// Events carries live job updates to streaming clients
+	Events *jobs.Events
+	// Workers is the pool running jobs in this process, if any; cancelled
+	// and paused jobs are interrupted at once
+	Workers *jobs.Pool
+	// Encrypted outputs are only downloadable under an active access grant
+	OutputKeys           *repo.OutputKeyRepo
+	Envelope             *storage.Envelope
+	AuditLogs            *repo.AuditLogRepo
+	OutputAccessApproval bool
+	OutputAccessWindow   time.Duration
+	// Signer signs artifact manifests; nil when no export signing key is
+	// configured
+	Signer *signing.KeyRing
+	// OutputBuckets delivers outputs to the buckets organizations own and
+	// opens them again for downloads
+	OutputBuckets *buckets.Registry
+	// GroundingMaxRows caps the real rows shared as prompt examples
+	GroundingMaxRows int
+	// CustomModels holds the uploaded models jobs may generate with, run
+	// by ModelServing
+	CustomModels *repo.CustomModelRepo
+	ModelServing *modelserving.Client
+	// Orgs shares jobs with the organization of the user who started them
+	Orgs *repo.OrgRepo
+	// GenerationAudit records the columns, privacy settings and sample
+	// sharing of every job
+	GenerationAudit *repo.GenerationAuditRepo
+	// Users holds the plans whose export formats downloads are limited to,
+	// and whether their jobs are watermarked
+	Users *repo.UserRepo
+	// WatermarkKey is the secret job watermarks are derived from and
+	// verified with
+	WatermarkKey []byte
+	// Templates holds the saved settings jobs may start from
+	Templates *repo.GenerationTemplateRepo
+	// Policies refuses jobs reaching an AI provider outside the EU to
+	// members of organizations that disabled it; ProviderLocation is
+	// where the provider jobs call is hosted
+	Policies         *orgpolicy.Enforcer
+	ProviderLocation string
 }
 
 type StartGenerationRequest struct {
-	DatasetID int64 `json:"dataset_id"`
-	Rows      int64 `json:"rows"`
+	DatasetID int64                     `json:"dataset_id"`
+	Rows      int64                     `json:"rows"`
+	Prompt    string                    `json:"prompt,omitempty"`
+	Grounding *privacy.GroundingOptions `json:"grounding,omitempty"`
+	// ZeroRealData opts the job into schema-only generation; dataset and
+	// organization policies can enforce it but a request cannot lift it
+	ZeroRealData bool `json:"zero_real_data,omitempty"`
+	// Unset settings take the organization defaults
+	PrivacyLevel string `json:"privacy_level,omitempty"`
+	Provider     string `json:"provider,omitempty"`
+	ExportFormat string `json:"export_format,omitempty"`
+	// ExportFormats are further formats the rows are written in at the
+	// same time, each with its own status and download link
+	ExportFormats []string `json:"export_formats,omitempty"`
+	// RareEvents selects how rare categories and outliers are generated
+	RareEvents *rareevents.Options `json:"rare_events,omitempty"`
+	// Weighting targets the weighted population or the raw sample of a
+	// dataset with sampling weights; population when unset
+	Weighting string `json:"weighting,omitempty"`
+	// FreeText names the prose columns whose text is scrubbed of PII and
+	// generated anew; unset they are detected from the source
+	FreeText *freetext.Options `json:"free_text,omitempty"`
+	// Structure sets the duplicate rate and group sizes of the rows; unset
+	// rows are generated independently
+	Structure *structure.Options `json:"structure,omitempty"`
+	// Strategy "statistical" generates the rows locally from distributions
+	// fitted to the source, without an AI provider
+	Strategy agents.GenerationStrategy `json:"strategy,omitempty"`
+	// CustomModelID generates the rows with one of the requester's uploaded
+	// models instead of an AI provider
+	CustomModelID int64 `json:"custom_model_id,omitempty"`
+	// Provenance tags the rows with the job, batch, prompt template and
+	// time they were generated in, as columns or in a manifest only
+	Provenance *provenance.Options `json:"provenance,omitempty"`
+	// Delta delivers the rows as their changes from a previous run of the
+	// dataset, with a change manifest, for incremental loads
+	Delta *delta.Options `json:"delta,omitempty"`
+	// TemplateID starts the job from a saved template, which fills the
+	// settings the request leaves unset; TemplateVersion pins an earlier
+	// version of it
+	TemplateID      int64 `json:"template_id,omitempty"`
+	TemplateVersion int   `json:"template_version,omitempty"`
+}
+
+// generationStrategies are the strategies a job may ask for
+var generationStrategies = []agents.GenerationStrategy{
+	agents.StrategyStatistical, agents.StrategyAICreative, agents.StrategyHybrid,
+	agents.StrategyPatternBased, agents.StrategyConstraintDriven,
+}
+
+// jobSettings applies the requester's organization defaults to the settings
+// of a new job
+func (d GenerationDeps) jobSettings(owner int64, req orgsettings.Settings) (orgsettings.Settings, error) {
+	var org *models.OrgSettings
+	if d.OrgSettings != nil {
+		var err error
+		if org, err = d.OrgSettings.ForUser(context.Background(), owner); err != nil {
+			return req, err
+		}
+	}
+	return orgsettings.ApplyJob(org, req)
+}
+
+// checkProvider refuses a job that calls the AI provider when it is hosted
+// outside the EU and the requester's organization disabled that; jobs
+// generated statistically or by an uploaded model stay on the platform
+func (d GenerationDeps) checkProvider(c *fiber.Ctx, owner int64) (bool, error) {
+	if orgpolicy.InEU(d.ProviderLocation) {
+		return false, nil
+	}
+	return checkCapability(c, d.Policies, owner, orgpolicy.NonEUProviders)
+}
+
+// groundingPoolRows is how many leading dataset rows grounding samples are
+// drawn from
+const groundingPoolRows = 5000
+
+var errGroundingUnavailable = errors.New("dataset rows are not readable for grounding")
+
+var errRareEventsUnavailable = errors.New("dataset rows are not readable for rare event profiling")
+
+var (
+	errDeltaProvenance         = errors.New("provenance tags cannot be combined with delta outputs")
+	errPreviousRunNotCompleted = errors.New("previous run is not completed")
+	errPreviousRunDataset      = errors.New("previous run generated another dataset")
+	errPreviousRunAccess       = errors.New("the previous run's output needs an active access grant")
+)
+
+// previousRun checks that a delta job's previous run is one of the owner's
+// completed runs of the dataset whose rows the worker will be able to read
+func (d GenerationDeps) previousRun(owner, datasetID int64, opts delta.Options) error {
+	ctx := context.Background()
+	prev, err := d.Generations.GetByOwner(ctx, owner, opts.PreviousJobID)
+	if err != nil {
+		return err
+	}
+	if prev.Status != models.GenCompleted || prev.OutputKey == nil {
+		return errPreviousRunNotCompleted
+	}
+	if prev.DatasetID != datasetID {
+		return errPreviousRunDataset
+	}
+	if prev.OutputFormat != nil {
+		if err := delta.CheckFormat(*prev.OutputFormat); err != nil {
+			return err
+		}
+	}
+	if prev.QualityDetails != nil && prev.QualityDetails.Delta != nil && prev.QualityDetails.Delta.Key != opts.Key {
+		return fmt.Errorf("%w: %s", delta.ErrKeyMismatch, prev.QualityDetails.Delta.Key)
+	}
+	if d.OutputKeys != nil {
+		if _, err := d.OutputKeys.GetKey(ctx, prev.ID); err == nil {
+			if _, err := d.OutputKeys.ActiveGrant(ctx, prev.ID, owner); err != nil {
+				return errPreviousRunAccess
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+	}
+	return nil
 }
 
 func (d GenerationDeps) Start(c *fiber.Ctx) error {
@@ -29,9 +254,376 @@ func (d GenerationDeps) Start(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
 	var body StartGenerationRequest
-	if err := c.BodyParser(&body); err != nil || body.DatasetID == 0 || body.Rows <= 0 {
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	var tmpl templates.Settings
+	if body.TemplateID != 0 {
+		var err error
+		tmpl, err = d.templateSettings(owner, body.TemplateID, body.TemplateVersion)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "template_not_found"})
+		case errors.Is(err, templates.ErrInvalidSettings):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_template", "message": err.Error()})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "template_lookup_failed"})
+		}
+		applyTemplate(&body, tmpl)
+	}
+	if body.DatasetID == 0 || body.Rows <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
 	}
+	if body.Strategy != "" && !slices.Contains(generationStrategies, body.Strategy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_strategy", "message": string(body.Strategy)})
+	}
+	if body.CustomModelID != 0 && body.Strategy == agents.StrategyStatistical {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_strategy", "message": "a custom model cannot generate with the statistical strategy"})
+	}
+	// The prompt is sent to the provider, so one that tries to steer the
+	// model is refused here rather than failing the job later
+	if findings := promptguard.Scan(body.Prompt); len(findings) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "suspicious_prompt", "findings": findings})
+	}
+	// Jobs are shared with the requester's organization, where viewers
+	// cannot start them
+	member, err := orgMembership(context.Background(), d.Orgs, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	}
+	if member != nil && !orgs.Can(member.Role, orgs.ActionWrite) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+	}
+	if body.Strategy != agents.StrategyStatistical && body.CustomModelID == 0 {
+		if handled, err := d.checkProvider(c, owner); handled {
+			return err
+		}
+	}
+	// Outputs never fall back to platform storage, so jobs wait for the
+	// organization's bucket to be verified
+	if err := d.outputBucketReady(owner); errors.Is(err, buckets.ErrUnverified) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "output_bucket_unverified"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	}
+	settings, err := d.jobSettings(owner, orgsettings.Settings{
+		PrivacyLevel: body.PrivacyLevel,
+		Provider:     body.Provider,
+		ExportFormat: body.ExportFormat,
+	})
+	if handled, herr := orgSettingError(c, err); handled {
+		return herr
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "policy_check_failed"})
+	}
+	exportFormats, err := d.exportFormats(owner, body.ExportFormats)
+	if handled, herr := orgSettingError(c, err); handled {
+		return herr
+	}
+	switch {
+	case errors.Is(err, export.ErrUnsupportedFormat):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unsupported_format", "message": err.Error(), "formats": export.Formats})
+	case errors.Is(err, errExportNotInPlan):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "export_format_not_in_plan", "message": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "plan_check_failed"})
+	}
+	if body.Delta != nil {
+		err := body.Delta.Validate()
+		if err == nil {
+			err = delta.CheckFormat(settings.ExportFormat)
+		}
+		if err == nil && body.Provenance != nil {
+			err = errDeltaProvenance
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_delta", "message": err.Error()})
+		}
+	}
+	if body.Provenance != nil {
+		format := settings.ExportFormat
+		if format == "" {
+			format = "json"
+		}
+		err := body.Provenance.Validate()
+		if err == nil {
+			err = body.Provenance.CheckFormat(format)
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_provenance", "message": err.Error()})
+		}
+	}
+
+	// Generating from a shared dataset requires a generate grant, and columns
+	// the requester is not cleared for stay masked for the whole job
+	var maskedColumns []string
+	var ds *models.Dataset
+	var acl *privacy.ColumnACL
+	if d.Grants != nil {
+		var err error
+		ds, err = d.Grants.GetAccessibleDataset(context.Background(), owner, body.DatasetID, models.DatasetPermGenerate)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "dataset_access_denied"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+		}
+		acl, err = columnACLFor(d.Grants, d.Annotations, nil, owner, ds)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+		}
+		if err := acl.CheckPrompt(body.Prompt); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "restricted_column_in_prompt"})
+		}
+		maskedColumns = acl.Hidden()
+	} else if body.Grounding != nil && d.Datasets != nil {
+		var err error
+		if ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, body.DatasetID); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+		}
+	}
+
+	// In zero-real-data mode no source rows reach the provider at all, so
+	// grounding is refused rather than silently dropped
+	mode, modeSource, err := d.dataMode(owner, body.DatasetID, body.ZeroRealData)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "policy_check_failed"})
+	}
+	if mode == models.DataModeZeroRealData && body.Grounding != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error":            "real_data_forbidden",
+			"data_mode":        mode,
+			"data_mode_source": modeSource,
+		})
+	}
+
+	// Example rows shared with the provider are sampled, capped and masked
+	// here, and recorded with the job
+	var grounding *privacy.GroundingSample
+	if body.Grounding != nil {
+		if body.Grounding.Rows <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_grounding"})
+		}
+		grounding, err = d.groundingSample(ds, acl, *body.Grounding)
+		switch {
+		case errors.Is(err, errGroundingUnavailable):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "grounding_unavailable"})
+		case errors.Is(err, privacy.ErrUnknownGroundingStrategy), errors.Is(err, privacy.ErrStratifyColumnRequired):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_grounding", "message": err.Error()})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "grounding_failed"})
+		}
+	}
+
+	// Rare events are profiled from the source now, so the rules a job runs
+	// with do not change if the dataset is replaced while it waits
+	var rareRules []agents.RareEventRule
+	if body.RareEvents != nil {
+		if err := body.RareEvents.Validate(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_rare_events", "message": err.Error()})
+		}
+		if ds == nil && d.Datasets != nil {
+			if ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, body.DatasetID); err != nil {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+			}
+		}
+		rareRules, err = d.rareEventRules(ds, *body.RareEvents)
+		if errors.Is(err, errRareEventsUnavailable) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "rare_events_unavailable"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+		}
+	}
+
+	// Weighted datasets are profiled now for the same reason
+	weighting, err := d.weighting(ds, owner, body.DatasetID, body.Weighting)
+	switch {
+	case errors.Is(err, weights.ErrUnknownMode):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_weighting", "message": err.Error()})
+	case errors.Is(err, errDatasetNotWeighted):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "dataset_not_weighted"})
+	case errors.Is(err, errWeightsUnavailable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "weights_unavailable"})
+	case isWeightError(err):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_weight_column", "message": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+
+	levels, err := d.hierarchies(ds, owner, body.DatasetID)
+	switch {
+	case errors.Is(err, errHierarchyUnavailable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "hierarchy_unavailable"})
+	case errors.Is(err, hierarchy.ErrNoPaths):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_hierarchy", "message": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+
+	shapes, err := d.nestedColumns(ds, owner, body.DatasetID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+
+	lists, err := d.arrayColumns(ds, owner, body.DatasetID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+
+	dictionaries, err := d.vocabularies(ds, owner, body.DatasetID, mode == models.DataModeZeroRealData)
+	switch {
+	case errors.Is(err, errVocabularyUnavailable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "vocabulary_unavailable"})
+	case errors.Is(err, vocabulary.ErrNoSourceMatches), errors.Is(err, vocabulary.ErrNoWeights):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_binding", "message": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+
+	if body.FreeText != nil {
+		if err := body.FreeText.Validate(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_free_text", "message": err.Error()})
+		}
+		for _, col := range body.FreeText.Columns {
+			if containsFold(maskedColumns, strings.TrimSpace(col)) {
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": col})
+			}
+		}
+	}
+	prose, err := d.freeTextColumns(ds, owner, body.DatasetID, body.FreeText, maskedColumns)
+	switch {
+	case errors.Is(err, errFreeTextUnavailable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "free_text_unavailable"})
+	case errors.Is(err, freetext.ErrUnknownColumn), errors.Is(err, freetext.ErrNotText):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": err.Error()})
+	case errors.Is(err, sql.ErrNoRows):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+
+	if body.Delta != nil {
+		if containsFold(maskedColumns, body.Delta.Key) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": body.Delta.Key})
+		}
+		err := d.previousRun(owner, body.DatasetID, *body.Delta)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "previous_job_not_found"})
+		case errors.Is(err, errPreviousRunNotCompleted):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "previous_job_not_completed"})
+		case errors.Is(err, errPreviousRunAccess):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "output_access_required", "message": err.Error()})
+		case errors.Is(err, errPreviousRunDataset), errors.Is(err, delta.ErrFormat), errors.Is(err, delta.ErrKeyMismatch):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_delta", "message": err.Error()})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+		}
+	}
+
+	var rowStructure *agents.RowStructure
+	if body.Structure != nil {
+		if err := body.Structure.Validate(); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_structure", "message": err.Error()})
+		}
+		for _, col := range maskedColumns {
+			if strings.EqualFold(col, body.Structure.GroupBy) {
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": body.Structure.GroupBy})
+			}
+		}
+		rowStructure, err = d.rowStructure(ds, owner, body.DatasetID, *body.Structure)
+		switch {
+		case errors.Is(err, errStructureUnavailable):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "structure_unavailable"})
+		case errors.Is(err, structure.ErrUnknownColumn):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": err.Error()})
+		case errors.Is(err, sql.ErrNoRows):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+		}
+	}
+
+	// Column budgets are checked against the job's privacy level before it
+	// is created; a job that could not respect them never starts
+	protections, spend, err := d.columnPrivacy(body.DatasetID, settings.PrivacyLevel)
+	switch {
+	case errors.Is(err, privacy.ErrPrivacyBudgetExceeded):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "privacy_budget_exceeded", "message": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "privacy_check_failed"})
+	}
+
+	layout, err := d.fixedWidthLayout(settings.ExportFormat, body.DatasetID)
+	switch {
+	case errors.Is(err, errFixedWidthLayoutRequired):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "fixed_width_layout_required"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "layout_check_failed"})
+	}
+	mapping, err := d.fhirMapping(settings.ExportFormat, body.DatasetID)
+	switch {
+	case errors.Is(err, errFHIRMappingRequired):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "fhir_mapping_required"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "mapping_check_failed"})
+	}
+	messages, err := d.financialMessageLayout(settings.ExportFormat, body.DatasetID)
+	switch {
+	case errors.Is(err, errFinancialMessageLayoutRequired):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "financial_message_layout_required"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "layout_check_failed"})
+	}
+
+	// Statistical jobs are fitted to a sample of the source, so one must be
+	// readable before the job is accepted
+	var reference []map[string]interface{}
+	if body.Strategy == agents.StrategyStatistical {
+		if mode == models.DataModeZeroRealData {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"error":            "real_data_forbidden",
+				"data_mode":        mode,
+				"data_mode_source": modeSource,
+			})
+		}
+		if reference = d.reference(ds, owner, body.DatasetID, maskedColumns); len(reference) == 0 {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "statistical_unavailable"})
+		}
+	}
+
+	// An uploaded model must be the requester's own, ready, and of a
+	// framework the inference server runs
+	var customModel *modelserving.Model
+	if body.CustomModelID != 0 {
+		customModel, err = d.customModel(owner, body.CustomModelID)
+		switch {
+		case errors.Is(err, modelserving.ErrNotConfigured):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "custom_models_unavailable"})
+		case errors.Is(err, sql.ErrNoRows):
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "custom_model_not_found"})
+		case errors.Is(err, modelserving.ErrNotReady):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "custom_model_not_ready"})
+		case errors.Is(err, modelserving.ErrUnsupportedFramework):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unsupported_framework", "message": err.Error()})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "custom_model_check_failed"})
+		}
+	}
 
 	// Check usage limits
 	canGenerate, reason, err := d.Usage.CanGenerateRows(context.Background(), owner, body.Rows)
@@ -45,22 +637,512 @@ func (d GenerationDeps) Start(c *fiber.Ctx) error {
 		})
 	}
 
-	job := &models.GenerationJob{DatasetID: body.DatasetID, UserID: owner, RowsRequested: body.Rows}
-	out, err := d.Generations.Insert(context.Background(), job)
-	if err != nil {
+	job := &models.GenerationJob{
+		DatasetID:      body.DatasetID,
+		UserID:         owner,
+		RowsRequested:  body.Rows,
+		MaskedColumns:  maskedColumns,
+		DataMode:       mode,
+		DataModeSource: modeSource,
+	}
+	if body.Prompt != "" {
+		job.Prompt = &body.Prompt
+	}
+	if settings.PrivacyLevel != "" {
+		job.PrivacyLevel = &settings.PrivacyLevel
+	}
+	if settings.Provider != "" {
+		job.RequestedProvider = &settings.Provider
+	}
+	if settings.ExportFormat != "" {
+		job.OutputFormat = &settings.ExportFormat
+	}
+
+	var record *models.GroundingSampleRecord
+	if grounding != nil {
+		rows, err := json.Marshal(grounding.Rows)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "grounding_failed"})
+		}
+		record = &models.GroundingSampleRecord{
+			DatasetID:     body.DatasetID,
+			Strategy:      string(grounding.Strategy),
+			Seed:          grounding.Seed,
+			SourceRows:    grounding.SourceRows,
+			MaskedColumns: grounding.MaskedColumns,
+			Rows:          string(rows),
+			Digest:        grounding.Digest,
+		}
+		if grounding.StratifyBy != "" {
+			record.StratifyBy = &grounding.StratifyBy
+		}
+	}
+
+	var audit *models.GenerationAudit
+	if d.GenerationAudit != nil {
+		audit = d.generationAudit(c, ds, job, body, protections, grounding)
+	}
+
+	// The job's spend is charged to the requester's lifetime budget on the
+	// dataset in the transaction that creates it, so concurrent jobs cannot
+	// overspend it together and a job that is never created is never charged.
+	// Its audit record is written there too.
+	var out *models.GenerationJob
+	charged := false
+	err = d.Tx.WithTx(context.Background(), func(ctx context.Context) error {
+		charge, err := d.chargePrivacyBudget(ctx, owner, body.DatasetID, protections, spend)
+		if err != nil {
+			return err
+		}
+		charged = true
+		if record != nil {
+			out, err = d.Generations.InsertWithGroundingSample(ctx, job, record)
+		} else {
+			out, err = d.Generations.Insert(ctx, job)
+		}
+		if err != nil {
+			return err
+		}
+		if audit != nil {
+			audit.JobID, audit.OrgID = out.ID, out.OrgID
+			if err := d.GenerationAudit.Insert(ctx, audit); err != nil {
+				return err
+			}
+		}
+		if charge == nil {
+			return nil
+		}
+		return d.PrivacyBudgets.AttachJob(ctx, charge.ID, out.ID)
+	})
+	switch {
+	case errors.Is(err, repo.ErrPrivacyBudgetExhausted):
+		balance, _ := d.privacyBalance(owner, body.DatasetID)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "privacy_budget_exhausted", "budget": balance})
+	case err != nil && !charged:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "privacy_check_failed"})
+	case err != nil:
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
 	}
-	// TODO: enqueue background processing
+	if d.Queue != nil {
+		// A template's tuning is kept; the settings the request may
+		// override are set again
+		config := tmpl.Config
+		config.Rows, config.PrivacyLevel, config.Strategy = body.Rows, settings.PrivacyLevel, body.Strategy
+		req := &agents.GenerationRequest{
+			DatasetID:         body.DatasetID,
+			UserID:            owner,
+			Config:            config,
+			Realism:           tmpl.Realism,
+			RestrictedColumns: maskedColumns,
+			ZeroRealData:      mode == models.DataModeZeroRealData,
+			ExportFormat:      settings.ExportFormat,
+			ExportFormats:     exportFormats,
+			CustomModel:       customModel,
+			Provenance:        body.Provenance,
+			Delta:             body.Delta,
+		}
+		if req.Watermark, err = d.planWatermarked(owner); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "enqueue_failed", "job_id": out.ID})
+		}
+		if body.Prompt != "" {
+			req.Config.BusinessRules = append(slices.Clip(req.Config.BusinessRules), body.Prompt)
+		}
+		if grounding != nil {
+			req.GroundingRows = grounding.Rows
+		}
+		// Zero-real-data jobs carry no source rows, not even ones kept from
+		// the provider
+		if mode != models.DataModeZeroRealData {
+			if reference == nil {
+				reference = d.reference(ds, owner, body.DatasetID, maskedColumns)
+			}
+			req.Reference = reference
+		}
+		if d.Annotations != nil {
+			anns, err := d.Annotations.List(context.Background(), body.DatasetID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "enqueue_failed", "job_id": out.ID})
+			}
+			annotations.Apply(req, anns)
+		}
+		if d.Relationships != nil {
+			hints, err := d.Relationships.List(context.Background(), body.DatasetID, models.RelationshipAccepted)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "enqueue_failed", "job_id": out.ID})
+			}
+			relationships.Apply(req, acceptedRelationships(hints))
+		}
+		if req.QualityGate, err = d.qualityPolicy(body.DatasetID); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "enqueue_failed", "job_id": out.ID})
+		}
+		hierarchy.Apply(req, levels)
+		nested.Apply(req, nested.Columns(shapes))
+		arrays.Apply(req, arrays.Columns(lists))
+		vocabulary.Apply(req, dictionaries)
+		freetext.Apply(req, prose)
+		rareevents.Apply(req, rareRules)
+		weights.Apply(req, weighting)
+		structure.Apply(req, rowStructure)
+		req.SchemaAnalysis.ColumnPrivacy = protections
+		fixedwidth.Apply(req, layout)
+		fhir.Apply(req, mapping)
+		finmsg.Apply(req, messages)
+		if err := d.Queue.Enqueue(context.Background(), out.ID, req); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "enqueue_failed", "job_id": out.ID})
+		}
+		out.Status = models.GenQueued
+		if customModel != nil {
+			_ = d.CustomModels.IncrementUsage(context.Background(), customModel.ID)
+		}
+	}
 	return c.Status(fiber.StatusAccepted).JSON(out)
 }
 
+// job returns a job the user started, or one shared with their
+// organization when their role there allows action
+func (d GenerationDeps) job(ctx context.Context, userID, id int64, action orgs.Action) (*models.GenerationJob, error) {
+	if d.Orgs == nil {
+		return d.Generations.GetByOwner(ctx, userID, id)
+	}
+	return d.Generations.GetAccessible(ctx, userID, id, orgs.Roles(action))
+}
+
+// customModel returns the serving reference of an uploaded model of the
+// owner or of their organization; other models are not found
+func (d GenerationDeps) customModel(owner, id int64) (*modelserving.Model, error) {
+	if d.CustomModels == nil || d.ModelServing == nil {
+		return nil, modelserving.ErrNotConfigured
+	}
+	stored, err := d.CustomModels.GetByID(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if stored.OwnerID != owner {
+		member, err := orgMembership(context.Background(), d.Orgs, owner)
+		if err != nil {
+			return nil, err
+		}
+		if !orgs.CanAccess(member, stored.OrgID, orgs.ActionWrite) {
+			return nil, sql.ErrNoRows
+		}
+	}
+	model, err := modelserving.ModelFor(stored)
+	if err != nil {
+		return nil, err
+	}
+	if !d.ModelServing.Supports(model.Framework) {
+		return nil, fmt.Errorf("%w: %s", modelserving.ErrUnsupportedFramework, model.Framework)
+	}
+	return &model, nil
+}
+
+// dataMode resolves the data mode of a job from the organization policies of
+// the requester and the dataset owner, the dataset's own setting and the
+// request
+func (d GenerationDeps) dataMode(userID, datasetID int64, requested bool) (models.DataMode, models.DataModeSource, error) {
+	ctx := context.Background()
+	var datasetOwner int64
+	var datasetFlag bool
+	if d.Datasets != nil {
+		var err error
+		datasetOwner, datasetFlag, err = d.Datasets.DataPolicy(ctx, datasetID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return "", "", err
+		}
+	}
+	var orgPolicy bool
+	if d.DataPolicies != nil {
+		for _, uid := range []int64{userID, datasetOwner} {
+			if uid == 0 || orgPolicy {
+				continue
+			}
+			on, err := d.DataPolicies.ZeroRealDataForUser(ctx, uid)
+			if err != nil {
+				return "", "", err
+			}
+			orgPolicy = on
+		}
+	}
+	mode, source := privacy.ResolveDataMode(orgPolicy, datasetFlag, requested)
+	return mode, source, nil
+}
+
+// groundingSample draws the example rows for a job. Columns with any
+// restriction on the dataset or classified as PII by its scan are masked
+// even for the owner and cleared users, since the rows leave for a
+// third-party provider.
+func (d GenerationDeps) groundingSample(ds *models.Dataset, acl *privacy.ColumnACL, opts privacy.GroundingOptions) (*privacy.GroundingSample, error) {
+	reader, ok := d.StorageClient.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" {
+		return nil, errGroundingUnavailable
+	}
+	columns, pool, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, groundingPoolRows)
+	if err != nil {
+		return nil, err
+	}
+	if len(pool) == 0 {
+		return nil, errGroundingUnavailable
+	}
+	var restricted []string
+	if d.Grants != nil {
+		restrictions, err := d.Grants.ListColumnRestrictions(context.Background(), ds.ID)
+		if err != nil {
+			return nil, err
+		}
+		if restrictions, err = sensitiveRestrictions(d.Annotations, ds.ID, restrictions); err != nil {
+			return nil, err
+		}
+		for _, r := range restrictions {
+			restricted = append(restricted, r.ColumnName)
+		}
+	}
+	scanned, err := piiColumns(d.PII, ds.ID)
+	if err != nil {
+		return nil, err
+	}
+	restricted = append(restricted, scanned...)
+	limit := d.GroundingMaxRows
+	if limit <= 0 {
+		limit = privacy.MaxGroundingRows
+	}
+	return privacy.SampleForGrounding(pool, columns, opts, limit, acl, restricted, time.Now().UnixNano())
+}
+
+// rareEventRules profiles the rare events of a dataset's leading rows
+func (d GenerationDeps) rareEventRules(ds *models.Dataset, opts rareevents.Options) ([]agents.RareEventRule, error) {
+	reader, ok := d.StorageClient.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" {
+		return nil, errRareEventsUnavailable
+	}
+	columns, rows, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errRareEventsUnavailable
+	}
+	return rareevents.Profile(columns, rows, opts), nil
+}
+
+// reference samples the leading rows of a dataset for a job's quality to be
+// measured against, without the columns the requester cannot see. Quality
+// falls back to estimates when the data is not readable, so that is not an
+// error.
+func (d GenerationDeps) reference(ds *models.Dataset, owner, datasetID int64, masked []string) []map[string]interface{} {
+	if ds == nil && d.Datasets != nil {
+		var err error
+		if ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, datasetID); err != nil {
+			return nil
+		}
+	}
+	reader, ok := d.StorageClient.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" || (ds.FileType != "csv" && ds.FileType != "json") {
+		return nil
+	}
+	_, rows, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+	if err != nil || len(rows) == 0 {
+		return nil
+	}
+	rows = fidelity.Sample(rows, fidelity.MaxReferenceRows)
+	out := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		kept := make(map[string]interface{}, len(row))
+		for k, v := range row {
+			hidden := false
+			for _, col := range masked {
+				if strings.EqualFold(col, k) {
+					hidden = true
+					break
+				}
+			}
+			if !hidden {
+				kept[k] = v
+			}
+		}
+		out[i] = kept
+	}
+	return out
+}
+
+var errDatasetNotWeighted = errors.New("dataset has no sampling weight column")
+
+// weighting returns the distribution target of a job on a dataset with
+// sampling weights, nil for unweighted datasets. A requested mode on an
+// unweighted dataset is an error.
+func (d GenerationDeps) weighting(ds *models.Dataset, owner, datasetID int64, mode string) (*agents.Weighting, error) {
+	if mode != "" && !weights.ValidMode(mode) {
+		return nil, weights.ErrUnknownMode
+	}
+	if d.Datasets == nil {
+		if mode != "" {
+			return nil, errDatasetNotWeighted
+		}
+		return nil, nil
+	}
+	column, err := d.Datasets.WeightColumn(context.Background(), datasetID)
+	if errors.Is(err, sql.ErrNoRows) && mode == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if column == nil {
+		if mode != "" {
+			return nil, errDatasetNotWeighted
+		}
+		return nil, nil
+	}
+	if mode == "" {
+		mode = weights.ModePopulation
+	}
+	if ds == nil {
+		if ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, datasetID); err != nil {
+			return nil, err
+		}
+	}
+	summary, err := weightProfile(d.StorageClient, ds, *column)
+	if err != nil {
+		return nil, err
+	}
+	return summary.Target(mode), nil
+}
+
+// GroundingSample returns the exact masked rows that were shared with the
+// provider for a job
+func (d GenerationDeps) GroundingSample(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.job(context.Background(), owner, id, orgs.ActionRead); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	rec, err := d.Generations.GetGroundingSample(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no_grounding_sample"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(fiber.Map{"sample": rec, "rows": json.RawMessage(rec.Rows)})
+}
+
+// Lineage returns the compliance record of a job: its source dataset, the
+// data mode it ran under and why, what was masked, whether any source rows
+// were shared and which provider and model produced the output
+func (d GenerationDeps) Lineage(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionInspect)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	lineage := fiber.Map{
+		"job_id":           job.ID,
+		"dataset_id":       job.DatasetID,
+		"data_mode":        job.DataMode,
+		"data_mode_source": job.DataModeSource,
+		"masked_columns":   job.MaskedColumns,
+		"provider":         job.Provider,
+		"model":            job.Model,
+		"source_rows_sent": 0,
+		"grounding_sample": nil,
+		"created_at":       job.CreatedAt,
+		"completed_at":     job.CompletedAt,
+	}
+	rec, err := d.Generations.GetGroundingSample(context.Background(), id)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	default:
+		lineage["source_rows_sent"] = len(rec.SourceRows)
+		lineage["grounding_sample"] = fiber.Map{
+			"strategy":       rec.Strategy,
+			"masked_columns": rec.MaskedColumns,
+			"digest":         rec.Digest,
+		}
+	}
+	return c.JSON(lineage)
+}
+
+// Provenance returns the provenance manifest of a completed job as a JSON
+// sidecar to its output. A row query, counted from zero, returns only the
+// chunk that output row was generated in.
+func (d GenerationDeps) Provenance(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionInspect)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if job.Status != models.GenCompleted {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "not_ready"})
+	}
+	if job.QualityDetails == nil || job.QualityDetails.Provenance == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no_provenance"})
+	}
+	manifest := job.QualityDetails.Provenance
+	if q := c.Query("row"); q != "" {
+		row, err := strconv.ParseInt(q, 10, 64)
+		if err != nil || row < 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_row"})
+		}
+		chunk, ok := provenance.Locate(manifest, row)
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "row_not_found"})
+		}
+		return c.JSON(fiber.Map{
+			"job_id":           manifest.JobID,
+			"row":              row,
+			"template_version": manifest.TemplateVersion,
+			"provider":         manifest.Provider,
+			"model":            manifest.Model,
+			"chunk":            chunk,
+		})
+	}
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="job-%d-provenance.json"`, job.ID))
+	return c.JSON(manifest)
+}
+
+// Status reports a job's progress for polling while it is queued or running
+func (d GenerationDeps) Status(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionInspect)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	return c.JSON(fiber.Map{
+		"id":             job.ID,
+		"status":         job.Status,
+		"progress":       job.Progress,
+		"attempts":       job.Attempts,
+		"last_error":     job.LastError,
+		"rows_requested": job.RowsRequested,
+		"rows_generated": job.RowsGenerated,
+		"started_at":     job.StartedAt,
+		"completed_at":   job.CompletedAt,
+	})
+}
+
 func (d GenerationDeps) Get(c *fiber.Ctx) error {
 	owner, _ := c.Locals("user_id").(int64)
 	if owner == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
 	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
-	job, err := d.Generations.GetByOwner(context.Background(), owner, id)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionInspect)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
 	}
@@ -73,18 +1155,51 @@ func (d GenerationDeps) Download(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
 	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
-	job, err := d.Generations.GetByOwner(context.Background(), owner, id)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionRead)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
 	}
 	if job.Status != models.GenCompleted || job.OutputKey == nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "not_ready"})
 	}
+	// A mandatory export format list also covers outputs produced before it
+	// was set
+	if d.OrgSettings != nil && job.OutputFormat != nil {
+		org, err := d.OrgSettings.ForUser(context.Background(), owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "policy_check_failed"})
+		}
+		if err := orgsettings.CheckExportFormat(org, *job.OutputFormat); err != nil {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "export_format_not_allowed", "message": err.Error()})
+		}
+	}
 
+	// Encrypted outputs need an active access grant; the object is useless
+	// without the key released under it
+	var grant *models.OutputAccessGrant
+	if d.OutputKeys != nil {
+		if _, err := d.OutputKeys.GetKey(context.Background(), id); err == nil {
+			grant, err = d.OutputKeys.ActiveGrant(context.Background(), id, owner)
+			if err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "output_access_required"})
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+		}
+	}
+	// ?format= streams the rows converted, rather than linking the output
+	if format := c.Query("format"); format != "" {
+		return d.exportOutput(c, owner, job, grant, format)
+	}
+
+	store, err := d.outputStorage(job)
+	if err != nil {
+		return outputStorageError(c, err)
+	}
 	// Generate signed URL if storage client is available
 	var downloadURL string
-	if d.StorageClient != nil {
-		signedURL, err := d.StorageClient.GetSignedURL(context.Background(), *job.OutputKey, 1*time.Hour)
+	if store != nil {
+		signedURL, err := store.GetSignedURL(context.Background(), *job.OutputKey, signedURLTTL(d.SignedURLTTL))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed_to_generate_download_url"})
 		}
@@ -94,7 +1209,18 @@ func (d GenerationDeps) Download(c *fiber.Ctx) error {
 		downloadURL = *job.OutputKey
 	}
 
-	return c.JSON(fiber.Map{"download_url": downloadURL})
+	exports, err := d.exportLinks(store, job)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed_to_generate_download_url"})
+	}
+	res := fiber.Map{"download_url": downloadURL}
+	if exports != nil {
+		res["exports"] = exports
+	}
+	if grant != nil {
+		res["encrypted"], res["access_grant_id"], res["access_expires_at"] = true, grant.ID, grant.ExpiresAt
+	}
+	return c.JSON(res)
 }
 
 func (d GenerationDeps) List(c *fiber.Ctx) error {
@@ -102,21 +1228,23 @@ func (d GenerationDeps) List(c *fiber.Ctx) error {
 	if owner == 0 {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
 	}
+	if c.Query("scope") == "org" {
+		member, err := orgMembership(context.Background(), d.Orgs, owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+		}
+		if member == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_in_org"})
+		}
+		jobs, err := d.Generations.ListByOrg(context.Background(), member.OrgID, 50, 0)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+		}
+		return c.JSON(jobs)
+	}
 	jobs, err := d.Generations.ListByOwner(context.Background(), owner, 50, 0)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
 	}
 	return c.JSON(jobs)
 }
-
-func (d GenerationDeps) Cancel(c *fiber.Ctx) error {
-	owner, _ := c.Locals("user_id").(int64)
-	if owner == 0 {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
-	}
-	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
-	if err := d.Generations.Cancel(context.Background(), owner, id); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "cancel_failed"})
-	}
-	return c.JSON(fiber.Map{"message": "job_cancelled"})
-}
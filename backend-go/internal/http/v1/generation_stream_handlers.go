@@ -0,0 +1,156 @@
+package v1
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/jobs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/websocket"
+	"github.com/gofiber/fiber/v2"
+)
+
+// streamPollInterval is how often a stream re-reads the job so that jobs
+// running on another instance still report progress and completion
+const streamPollInterval = 2 * time.Second
+
+// Stream sends live updates on a generation job: progress, row batches as
+// they are produced with the quality of the rows so far, and a final
+// completed, failed or cancelled event. It serves server-sent events, or a
+// WebSocket when the request asks for an upgrade. Rows are withheld when
+// outputs require approved access.
+func (d GenerationDeps) Stream(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Events == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+
+	if websocket.IsUpgrade(c.Get(fiber.HeaderConnection), c.Get(fiber.HeaderUpgrade)) {
+		key := c.Get("Sec-WebSocket-Key")
+		if key == "" || c.Get("Sec-WebSocket-Version") != "13" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_upgrade"})
+		}
+		c.Status(fiber.StatusSwitchingProtocols)
+		c.Set(fiber.HeaderUpgrade, "websocket")
+		c.Set(fiber.HeaderConnection, "Upgrade")
+		c.Set("Sec-WebSocket-Accept", websocket.AcceptKey(key))
+		c.Context().Hijack(func(conn net.Conn) {
+			ws := websocket.NewConn(conn)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				_ = ws.ReadLoop()
+				cancel()
+			}()
+			err := d.streamJob(ctx, owner, job, func(ev jobs.Event) error {
+				raw, _ := json.Marshal(ev)
+				return ws.WriteText(raw)
+			})
+			code := uint16(websocket.CloseNormal)
+			if err != nil && ctx.Err() == nil {
+				code = websocket.CloseServerError
+			}
+			_ = ws.Close(code, "")
+		})
+		return nil
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		_ = d.streamJob(ctx, owner, job, func(ev jobs.Event) error {
+			raw, _ := json.Marshal(ev)
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, raw); err != nil {
+				return err
+			}
+			return w.Flush()
+		})
+	})
+	return nil
+}
+
+// streamJob sends the job's current state, then its live events until the
+// job ends, send fails or ctx is done
+func (d GenerationDeps) streamJob(ctx context.Context, owner int64, job *models.GenerationJob, send func(jobs.Event) error) error {
+	events, unsubscribe := d.Events.Subscribe(job.ID)
+	defer unsubscribe()
+
+	current := jobEvent(job)
+	if err := send(current); err != nil || current.Terminal() {
+		return err
+	}
+
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+	progress, status := job.Progress, job.Status
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case ev, ok := <-events:
+			if !ok {
+				return send(jobs.Event{Type: "error", JobID: job.ID, Error: "stream_lagged"})
+			}
+			if d.OutputAccessApproval && ev.Rows != nil {
+				ev.Rows, ev.RowsWithheld = nil, true
+			}
+			if err := send(ev); err != nil || ev.Terminal() {
+				return err
+			}
+			progress = ev.Progress
+			if ev.Status != "" {
+				status = ev.Status
+			}
+		case <-ticker.C:
+			latest, err := d.job(ctx, owner, job.ID, orgs.ActionRead)
+			if err != nil {
+				continue
+			}
+			ev := jobEvent(latest)
+			if ev.Terminal() || latest.Progress != progress || latest.Status != status {
+				if err := send(ev); err != nil || ev.Terminal() {
+					return err
+				}
+				progress, status = latest.Progress, latest.Status
+			}
+		}
+	}
+}
+
+// jobEvent describes a job's stored state as a stream event
+func jobEvent(job *models.GenerationJob) jobs.Event {
+	ev := jobs.Event{Type: jobs.EventProgress, JobID: job.ID, Progress: job.Progress, Status: job.Status,
+		RowsDone: job.RowsGenerated, RowsTotal: job.RowsRequested}
+	switch job.Status {
+	case models.GenCompleted:
+		ev.Type = jobs.EventCompleted
+	case models.GenFailed:
+		ev.Type = jobs.EventFailed
+		if job.LastError != nil {
+			ev.Error = *job.LastError
+		}
+	case models.GenCancelled:
+		ev.Type = jobs.EventCancelled
+	case models.GenPaused:
+		ev.Type = jobs.EventPaused
+	}
+	return ev
+}
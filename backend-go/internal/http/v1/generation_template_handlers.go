@@ -0,0 +1,311 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/templates"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GenerationTemplateRequest creates a template or saves its next version
+type GenerationTemplateRequest struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description,omitempty"`
+	Settings    models.TemplateSettings `json:"settings"`
+	// Shared shares the template with the owner's organization, whose
+	// members may start jobs from it
+	Shared bool `json:"shared,omitempty"`
+}
+
+// ListTemplates returns the caller's generation templates, or those shared
+// with their organization for scope=org
+func (d GenerationDeps) ListTemplates(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Templates == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	if c.Query("scope") == "org" {
+		member, err := orgMembership(context.Background(), d.Orgs, owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+		}
+		if member == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_in_org"})
+		}
+		shared, err := d.Templates.ListByOrg(context.Background(), member.OrgID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+		}
+		return c.JSON(shared)
+	}
+	list, err := d.Templates.ListByOwner(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(list)
+}
+
+// CreateTemplate saves a new generation template at version 1
+func (d GenerationDeps) CreateTemplate(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Templates == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	t, handled, err := d.templateBody(c, owner)
+	if handled || err != nil {
+		return err
+	}
+	// Shared templates are added to the organization, where viewers
+	// cannot add them
+	if t.shared {
+		member, err := orgMembership(context.Background(), d.Orgs, owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+		}
+		if member == nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_in_org"})
+		}
+		if !orgs.Can(member.Role, orgs.ActionWrite) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+		}
+	}
+	out, err := d.Templates.Insert(context.Background(), t.template, t.shared)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
+
+// GetTemplate returns a template the caller owns or that is shared with
+// their organization
+func (d GenerationDeps) GetTemplate(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Templates == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	t, err := d.template(owner, id, orgs.ActionRead)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "template_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(t)
+}
+
+// UpdateTemplate saves new settings as the next version of a template the
+// caller owns; jobs started from earlier versions keep theirs
+func (d GenerationDeps) UpdateTemplate(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Templates == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	current, err := d.template(owner, id, orgs.ActionRead)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "template_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	if current.OwnerID != owner {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "access_denied"})
+	}
+	t, handled, err := d.templateBody(c, owner)
+	if handled || err != nil {
+		return err
+	}
+	t.template.ID = id
+	out, err := d.Templates.Update(context.Background(), t.template, t.shared)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "template_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(out)
+}
+
+// DeleteTemplate removes a template and its history. Organization admins
+// delete templates other members shared with it.
+func (d GenerationDeps) DeleteTemplate(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Templates == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	t, err := d.template(owner, id, orgs.ActionRead)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "template_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	if t.OwnerID != owner {
+		if _, err := d.template(owner, id, orgs.ActionManage); errors.Is(err, sql.ErrNoRows) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "access_denied"})
+		} else if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+		}
+	}
+	if err := d.Templates.Delete(context.Background(), id); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// TemplateVersions returns the history of a template, newest first
+func (d GenerationDeps) TemplateVersions(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Templates == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.template(owner, id, orgs.ActionRead); errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "template_not_found"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	versions, err := d.Templates.Versions(context.Background(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(fiber.Map{"template_id": id, "versions": versions})
+}
+
+// template returns a template the user owns, or one shared with their
+// organization when their role there allows action; others are not found
+func (d GenerationDeps) template(userID, id int64, action orgs.Action) (*models.GenerationTemplate, error) {
+	t, err := d.Templates.Get(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+	if t.OwnerID == userID {
+		return t, nil
+	}
+	member, err := orgMembership(context.Background(), d.Orgs, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !orgs.CanAccess(member, t.OrgID, action) {
+		return nil, sql.ErrNoRows
+	}
+	return t, nil
+}
+
+// templateSettings returns the settings of a template the user may start
+// jobs from, at version or, when it is 0, the current one
+func (d GenerationDeps) templateSettings(userID, id int64, version int) (templates.Settings, error) {
+	if d.Templates == nil {
+		return templates.Settings{}, sql.ErrNoRows
+	}
+	t, err := d.template(userID, id, orgs.ActionWrite)
+	if err != nil {
+		return templates.Settings{}, err
+	}
+	raw := t.Settings
+	if version != 0 && version != t.Version {
+		v, err := d.Templates.Version(context.Background(), id, version)
+		if err != nil {
+			return templates.Settings{}, err
+		}
+		raw = v.Settings
+	}
+	return templates.Decode(raw)
+}
+
+// applyTemplate fills the settings a start request leaves unset from its
+// template. Zero-real-data is kept when either asks for it.
+func applyTemplate(body *StartGenerationRequest, s templates.Settings) {
+	if body.Rows == 0 {
+		body.Rows = s.Config.Rows
+	}
+	if body.PrivacyLevel == "" {
+		body.PrivacyLevel = s.Config.PrivacyLevel
+	}
+	if body.Strategy == "" {
+		body.Strategy = s.Config.Strategy
+	}
+	if body.Prompt == "" {
+		body.Prompt = s.Prompt
+	}
+	if body.Provider == "" {
+		body.Provider = s.Provider
+	}
+	if body.ExportFormat == "" {
+		body.ExportFormat = s.ExportFormat
+	}
+	if body.ExportFormats == nil {
+		body.ExportFormats = s.ExportFormats
+	}
+	if body.Grounding == nil {
+		body.Grounding = s.Grounding
+	}
+	body.ZeroRealData = body.ZeroRealData || s.ZeroRealData
+}
+
+type templateInput struct {
+	template *models.GenerationTemplate
+	shared   bool
+}
+
+// templateBody reads and checks a template request; handled is set when
+// the response was already written
+func (d GenerationDeps) templateBody(c *fiber.Ctx, owner int64) (templateInput, bool, error) {
+	var body GenerationTemplateRequest
+	if err := c.BodyParser(&body); err != nil {
+		return templateInput{}, true, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	name, err := templates.CheckName(body.Name)
+	if err != nil {
+		return templateInput{}, true, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_name", "message": err.Error()})
+	}
+	settings, err := templates.Decode(body.Settings)
+	if err == nil {
+		err = settings.Validate()
+	}
+	if err == nil && settings.Config.Strategy != "" && !slices.Contains(generationStrategies, settings.Config.Strategy) {
+		err = fmt.Errorf("%w: unknown strategy %q", templates.ErrInvalidSettings, settings.Config.Strategy)
+	}
+	if err != nil {
+		return templateInput{}, true, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_settings", "message": err.Error()})
+	}
+	// Settings are stored as decoded, so every template reads back the same
+	// way whatever its request spelled out
+	raw, err := templates.Encode(settings)
+	if err != nil {
+		return templateInput{}, true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "encode_failed"})
+	}
+	t := &models.GenerationTemplate{OwnerID: owner, Name: name, Settings: raw, UpdatedBy: owner}
+	if desc := strings.TrimSpace(body.Description); desc != "" {
+		t.Description = &desc
+	}
+	return templateInput{template: t, shared: body.Shared}, false, nil
+}
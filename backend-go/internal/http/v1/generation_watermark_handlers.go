@@ -0,0 +1,87 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/payments"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/watermark"
+	"github.com/gofiber/fiber/v2"
+)
+
+// planWatermarked reports whether the jobs of a user's plan are watermarked
+func (d GenerationDeps) planWatermarked(owner int64) (bool, error) {
+	tier := models.TierFree
+	if d.Users != nil {
+		u, err := d.Users.GetByID(context.Background(), owner)
+		if err != nil {
+			return false, err
+		}
+		tier = u.SubscriptionTier
+	}
+	return payments.PlanWatermarked(string(tier)), nil
+}
+
+// VerifyWatermark tests rows for the watermark of one of the caller's jobs.
+// The body is {"rows": [...]}, as downloaded or read back from CSV.
+func (d GenerationDeps) VerifyWatermark(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var body struct {
+		Rows []map[string]interface{} `json:"rows"`
+	}
+	if err := decodeNumbers(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	return d.verifyWatermark(c, job, body.Rows)
+}
+
+// VerifyAnyWatermark tests rows found elsewhere for the watermark of any
+// job, so staff can show where free-plan data came from. The body is
+// {"job_id": 1, "rows": [...]}.
+func (d GenerationDeps) VerifyAnyWatermark(c *fiber.Ctx) error {
+	var body struct {
+		JobID int64                    `json:"job_id"`
+		Rows  []map[string]interface{} `json:"rows"`
+	}
+	if err := decodeNumbers(c.Body(), &body); err != nil || body.JobID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	job, err := d.Generations.GetByID(context.Background(), body.JobID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	return d.verifyWatermark(c, job, body.Rows)
+}
+
+func (d GenerationDeps) verifyWatermark(c *fiber.Ctx, job *models.GenerationJob, rows []map[string]interface{}) error {
+	if len(d.WatermarkKey) == 0 {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	if job.QualityDetails == nil || job.QualityDetails.Watermark == nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "not_watermarked"})
+	}
+	if len(rows) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "no_rows"})
+	}
+	return c.JSON(watermark.Verify(d.WatermarkKey, job.ID, job.QualityDetails.Watermark.Columns, rows))
+}
+
+// decodeNumbers reads a JSON body keeping numbers as written, so the digits
+// a watermark is carried in are not rounded
+func decodeNumbers(raw []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,178 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/hierarchy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errHierarchyUnavailable = errors.New("dataset rows are not readable for hierarchy paths")
+
+type CreateHierarchyRequest struct {
+	// Levels are the hierarchy's columns, top level first
+	Levels []string `json:"levels"`
+	// Taxonomy lists the allowed paths; without one generation follows the
+	// paths observed in the dataset
+	Taxonomy models.TaxonomyPaths `json:"taxonomy,omitempty"`
+}
+
+// hierarchyRows reads the leading rows of a dataset; errHierarchyUnavailable
+// when they are not readable
+func hierarchyRows(client storage.SignedURLProvider, ds *models.Dataset) ([]string, []map[string]interface{}, error) {
+	reader, ok := client.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" || (ds.FileType != "csv" && ds.FileType != "json") {
+		return nil, nil, errHierarchyUnavailable
+	}
+	return readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+}
+
+// CreateHierarchy declares columns of a dataset as the levels of a
+// hierarchy, following a taxonomy or the paths observed in the data
+func (d DatasetDeps) CreateHierarchy(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Hierarchies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var body CreateHierarchyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	for i, l := range body.Levels {
+		body.Levels[i] = strings.TrimSpace(l)
+	}
+	if body.Taxonomy != nil {
+		if err := hierarchy.ValidateTaxonomy(body.Levels, body.Taxonomy); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_taxonomy", "message": err.Error()})
+		}
+	}
+
+	// Levels are checked against the data when it is readable; a hierarchy
+	// without a taxonomy needs it to observe paths from
+	columns, rows, err := hierarchyRows(d.StorageClient, ds)
+	switch {
+	case errors.Is(err, errHierarchyUnavailable) && body.Taxonomy == nil:
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "dataset_not_readable"})
+	case errors.Is(err, errHierarchyUnavailable):
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	if err := hierarchy.ValidateLevels(body.Levels, columns); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_hierarchy", "message": err.Error()})
+	}
+	h := models.ColumnHierarchy{DatasetID: id, Levels: body.Levels, Taxonomy: body.Taxonomy, CreatedBy: owner}
+	if _, err := hierarchy.Resolve(h, rows); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_hierarchy", "message": err.Error()})
+	}
+	out, err := d.Hierarchies.Create(context.Background(), &h)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	_ = d.auditAccess(c, owner, "column_hierarchy_created", "dataset", id, map[string]any{
+		"hierarchy_id": out.ID,
+		"levels":       out.Levels,
+		"taxonomy":     out.Taxonomy != nil,
+	})
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
+
+// ListHierarchies lists the hierarchies declared on a dataset
+func (d DatasetDeps) ListHierarchies(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Hierarchies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	out, err := d.Hierarchies.List(context.Background(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if out == nil {
+		out = []models.ColumnHierarchy{}
+	}
+	return c.JSON(out)
+}
+
+// DeleteHierarchy removes a hierarchy; jobs already queued keep it
+func (d DatasetDeps) DeleteHierarchy(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Hierarchies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	hierarchyID := parseID(c.Params("hierarchyId"))
+	err := d.Hierarchies.Delete(context.Background(), id, hierarchyID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "hierarchy_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	_ = d.auditAccess(c, owner, "column_hierarchy_removed", "dataset", id, map[string]any{
+		"hierarchy_id": hierarchyID,
+	})
+	return c.JSON(fiber.Map{"message": "hierarchy_removed"})
+}
+
+// hierarchies resolves the hierarchies of a dataset for a job. Paths are
+// observed now, so a job keeps them if the dataset is replaced while it
+// waits.
+func (d GenerationDeps) hierarchies(ds *models.Dataset, owner, datasetID int64) ([]agents.Hierarchy, error) {
+	if d.Hierarchies == nil {
+		return nil, nil
+	}
+	declared, err := d.Hierarchies.List(context.Background(), datasetID)
+	if err != nil || len(declared) == 0 {
+		return nil, err
+	}
+	var rows []map[string]interface{}
+	for _, h := range declared {
+		if h.Taxonomy != nil || rows != nil {
+			continue
+		}
+		if ds == nil && d.Datasets != nil {
+			if ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, datasetID); err != nil {
+				return nil, err
+			}
+		}
+		if _, rows, err = hierarchyRows(d.StorageClient, ds); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]agents.Hierarchy, 0, len(declared))
+	for _, h := range declared {
+		resolved, err := hierarchy.Resolve(h, rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, resolved)
+	}
+	return out, nil
+}
@@ -0,0 +1,111 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/housekeeping"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+)
+
+type HousekeepingDeps struct {
+	Analyzer  *housekeeping.Analyzer
+	Policies  *repo.HousekeepingRepo
+	AuditLogs *repo.AuditLogRepo
+}
+
+// CleanupPolicyRequest sets the cleanup policy of a kind. IdleDays keeps
+// the current value when omitted.
+type CleanupPolicyRequest struct {
+	Enabled  bool `json:"enabled"`
+	IdleDays *int `json:"idle_days"`
+}
+
+// CleanupSuggestions lists stale resources with the storage and monthly
+// cost cleaning them up would save; ?kind= narrows it to one kind
+func (d HousekeepingDeps) CleanupSuggestions(c *fiber.Ctx) error {
+	if d.Analyzer == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	var kinds []models.StaleKind
+	if k := models.StaleKind(c.Query("kind")); k != "" {
+		if !housekeeping.ValidKind(k) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown_kind", "allowed": models.StaleKinds})
+		}
+		kinds = append(kinds, k)
+	}
+	report, err := d.Analyzer.Suggest(context.Background(), time.Now(), kinds...)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "analysis_failed"})
+	}
+	return c.JSON(report)
+}
+
+// ListCleanupPolicies returns the cleanup policy of every kind; kinds staff
+// have not set are disabled
+func (d HousekeepingDeps) ListCleanupPolicies(c *fiber.Ctx) error {
+	if d.Analyzer == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	policies, err := d.Analyzer.Policies(context.Background())
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(fiber.Map{"policies": policies})
+}
+
+// SetCleanupPolicy turns automated cleanup of a kind on or off and sets how
+// long its resources must go unused first
+func (d HousekeepingDeps) SetCleanupPolicy(c *fiber.Ctx) error {
+	if d.Analyzer == nil || d.Policies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	userID, _ := c.Locals("user_id").(int64)
+	kind := models.StaleKind(c.Params("kind"))
+	if !housekeeping.ValidKind(kind) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "unknown_kind", "allowed": models.StaleKinds})
+	}
+	var body CleanupPolicyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	ctx := context.Background()
+	current, err := d.Analyzer.Policies(ctx)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	p := models.CleanupPolicy{Kind: kind, Enabled: body.Enabled, IdleDays: housekeeping.DefaultIdleDays[kind], UpdatedBy: &userID}
+	for _, cp := range current {
+		if cp.Kind == kind {
+			p.IdleDays = cp.IdleDays
+		}
+	}
+	if body.IdleDays != nil {
+		p.IdleDays = *body.IdleDays
+	}
+	if p.IdleDays < 1 || p.IdleDays > housekeeping.MaxIdleDays {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_idle_days", "max": housekeeping.MaxIdleDays})
+	}
+	saved, err := d.Policies.UpsertPolicy(ctx, &p)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	if d.AuditLogs != nil {
+		raw, _ := json.Marshal(map[string]any{"enabled": saved.Enabled, "idle_days": saved.IdleDays})
+		resourceID := string(kind)
+		_, _ = d.AuditLogs.Insert(ctx, &models.AuditLog{
+			UserID:     &userID,
+			Action:     "cleanup_policy_updated",
+			Resource:   "cleanup_policy",
+			ResourceID: &resourceID,
+			IPAddress:  c.IP(),
+			UserAgent:  c.Get("User-Agent"),
+			Metadata:   string(raw),
+		})
+	}
+	return c.JSON(saved)
+}
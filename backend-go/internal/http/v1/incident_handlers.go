@@ -0,0 +1,113 @@
+package v1
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/incidents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+)
+
+type IncidentDeps struct {
+	Correlator  *incidents.Correlator
+	Deployments *repo.DeploymentRepo
+}
+
+// DeploymentRequest records a deployment marker. DeployedAt defaults to
+// now.
+type DeploymentRequest struct {
+	Service     string     `json:"service"`
+	Version     string     `json:"version"`
+	Description string     `json:"description"`
+	DeployedAt  *time.Time `json:"deployed_at"`
+}
+
+// timelineBuckets are the bucket sizes job failures may be counted in, in
+// minutes; each divides a day so buckets line up across days
+var timelineBuckets = map[int]bool{1: true, 5: true, 10: true, 15: true, 30: true, 60: true}
+
+// IncidentTimeline merges alerts, security events, deployments and job
+// failure spikes of a window into one timeline. The window is ?from= and
+// ?to= (RFC 3339; the last hour by default), or ?around= for the hour
+// before a moment and half an hour after. ?bucket_minutes= sizes the job
+// failure buckets (default 5).
+func (d IncidentDeps) IncidentTimeline(c *fiber.Ctx) error {
+	if d.Correlator == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	to := time.Now().UTC()
+	from := to.Add(-time.Hour)
+	var err error
+	if s := c.Query("around"); s != "" {
+		around, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_around"})
+		}
+		from, to = around.Add(-time.Hour), around.Add(30*time.Minute)
+	}
+	if s := c.Query("from"); s != "" {
+		if from, err = time.Parse(time.RFC3339, s); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_from"})
+		}
+	}
+	if s := c.Query("to"); s != "" {
+		if to, err = time.Parse(time.RFC3339, s); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_to"})
+		}
+	}
+	if !from.Before(to) || to.Sub(from) > incidents.MaxWindow {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_window", "max_hours": int(incidents.MaxWindow.Hours())})
+	}
+	minutes := c.QueryInt("bucket_minutes", 5)
+	if !timelineBuckets[minutes] {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_bucket", "allowed": []int{1, 5, 10, 15, 30, 60}})
+	}
+	bucket := time.Duration(minutes) * time.Minute
+	// The window is widened to whole buckets so the first and last are
+	// counted in full
+	from, to = from.Truncate(bucket), to.Add(bucket-1).Truncate(bucket)
+
+	timeline, err := d.Correlator.Timeline(context.Background(), from, to, bucket)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "timeline_failed"})
+	}
+	return c.JSON(timeline)
+}
+
+// RecordDeployment records a deployment marker, such as a release of the
+// frontend or a worker, from CI or by hand
+func (d IncidentDeps) RecordDeployment(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("user_id").(int64)
+	if d.Deployments == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	var body DeploymentRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	m := &models.DeploymentMarker{Service: strings.TrimSpace(body.Service), Version: strings.TrimSpace(body.Version)}
+	if m.Service == "" || m.Version == "" || len(m.Service) > 100 || len(m.Version) > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_deployment", "message": "service and version are required, at most 100 characters each"})
+	}
+	if desc := strings.TrimSpace(body.Description); desc != "" {
+		if len(desc) > 2000 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_description", "max_length": 2000})
+		}
+		m.Description = &desc
+	}
+	if body.DeployedAt != nil {
+		m.DeployedAt = *body.DeployedAt
+	}
+	if adminID != 0 {
+		m.CreatedBy = &adminID
+	}
+	out, err := d.Deployments.Record(context.Background(), m)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
@@ -0,0 +1,300 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/mockapi"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgpolicy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pricing"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/warehouse"
+)
+
+type MockAPIDeps struct {
+	Mocks       *repo.MockAPIRepo
+	Generations *repo.GenerationRepo
+	OutputKeys  *repo.OutputKeyRepo
+	// Users holds the plans mock APIs are limited by
+	Users     *repo.UserRepo
+	AuditLogs *repo.AuditLogRepo
+	Server    *mockapi.Server
+	// Policies refuses new mock APIs to members of organizations that
+	// disabled public sharing
+	Policies *orgpolicy.Enforcer
+}
+
+type MockAPIRequest struct {
+	JobID int64  `json:"job_id"`
+	Name  string `json:"name"`
+	// TTLHours defaults to a day, or the plan's maximum when shorter
+	TTLHours int `json:"ttl_hours"`
+	// RequestsPerMinute defaults to the plan's limit
+	RequestsPerMinute int `json:"requests_per_minute"`
+}
+
+// defaultMockTTLHours is how long a mock lives unless asked otherwise
+const defaultMockTTLHours = 24
+
+// ListMockAPIs lists the caller's mock APIs, expired ones included until
+// they are purged
+func (d MockAPIDeps) ListMockAPIs(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Mocks == nil || d.Server == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Mocks.List(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if out == nil {
+		out = []models.MockAPI{}
+	}
+	for i := range out {
+		out[i].Path = mockapi.Path(out[i].PublicID)
+	}
+	return c.JSON(out)
+}
+
+// CreateMockAPI hosts a completed job's rows at a public mock endpoint,
+// within the mocks, request rate and lifetime of the caller's plan
+func (d MockAPIDeps) CreateMockAPI(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Mocks == nil || d.Server == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	if handled, err := checkCapability(c, d.Policies, owner, orgpolicy.PublicSharing); handled {
+		return err
+	}
+	var body MockAPIRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	ctx := context.Background()
+	tier := models.TierFree
+	if d.Users != nil {
+		u, err := d.Users.GetByID(ctx, owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "plan_check_failed"})
+		}
+		tier = u.SubscriptionTier
+	}
+	limits := pricing.PlanMockAPIs(string(tier))
+	if limits == nil {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "mock_apis_not_in_plan"})
+	}
+	if body.TTLHours == 0 {
+		body.TTLHours = min(defaultMockTTLHours, limits.MaxTTLHours)
+	}
+	if body.TTLHours < 0 || body.TTLHours > limits.MaxTTLHours {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_ttl", "max_ttl_hours": limits.MaxTTLHours})
+	}
+	if body.RequestsPerMinute == 0 {
+		body.RequestsPerMinute = limits.RequestsPerMinute
+	}
+	if body.RequestsPerMinute < 0 || body.RequestsPerMinute > limits.RequestsPerMinute {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_rate_limit", "max_requests_per_minute": limits.RequestsPerMinute})
+	}
+
+	job, err := d.Generations.GetByOwner(ctx, owner, body.JobID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "job_not_found"})
+	}
+	if job.Status != models.GenCompleted || job.OutputKey == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "not_ready"})
+	}
+	if job.OutputFormat != nil && *job.OutputFormat != "" && *job.OutputFormat != export.JSON && *job.OutputFormat != export.CSV {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "conversion_unsupported", "output_format": *job.OutputFormat})
+	}
+	if job.RowsGenerated > mockapi.MaxRecords {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "too_many_records", "max_records": mockapi.MaxRecords})
+	}
+	// Encrypted outputs are served while the caller's access grant lasts
+	if d.OutputKeys != nil {
+		if _, err := d.OutputKeys.GetKey(ctx, job.ID); err == nil {
+			if _, err := d.OutputKeys.ActiveGrant(ctx, job.ID, owner); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "output_access_required"})
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+		}
+	}
+	active, err := d.Mocks.CountActive(ctx, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_check_failed"})
+	}
+	if active >= limits.MaxMocks {
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error":   "mock_api_limit_exceeded",
+			"message": "Mock API limit exceeded. Delete a mock or upgrade your plan.",
+		})
+	}
+
+	publicID, err := mockapi.NewPublicID()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	name := strings.TrimSpace(body.Name)
+	if name == "" {
+		name = "generation-" + strconv.FormatInt(job.ID, 10)
+	}
+	out, err := d.Mocks.Create(ctx, &models.MockAPI{
+		UserID:            owner,
+		JobID:             job.ID,
+		Name:              name,
+		PublicID:          publicID,
+		RequestsPerMinute: body.RequestsPerMinute,
+		ExpiresAt:         time.Now().Add(time.Duration(body.TTLHours) * time.Hour),
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	out.Path = mockapi.Path(out.PublicID)
+	d.auditMock(c, owner, "mock_api_created", out)
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
+
+func (d MockAPIDeps) GetMockAPI(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Mocks == nil || d.Server == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Mocks.Get(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	out.Path = mockapi.Path(out.PublicID)
+	return c.JSON(out)
+}
+
+// DeleteMockAPI takes a mock down at once
+func (d MockAPIDeps) DeleteMockAPI(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Mocks == nil || d.Server == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id := parseID(c.Params("id"))
+	err := d.Mocks.Delete(context.Background(), owner, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	d.Server.Evict(id)
+	d.auditMock(c, owner, "mock_api_deleted", &models.MockAPI{ID: id})
+	return c.JSON(fiber.Map{"message": "mock_api_deleted"})
+}
+
+// MockRecords serves a page of a mock's records. The public ID is the
+// credential, so no session is required and any origin may call it.
+// Filters, sorting and pagination follow json-server, with the total in
+// X-Total-Count.
+func (d MockAPIDeps) MockRecords(c *fiber.Ctx) error {
+	m, ok, err := d.serveMock(c)
+	if !ok {
+		return err
+	}
+	q, err := mockapi.ParseQuery(c.Queries())
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_query", "message": err.Error()})
+	}
+	records, total, err := d.Server.Records(context.Background(), m, q)
+	if err != nil {
+		return mockError(c, err)
+	}
+	c.Set("X-Total-Count", strconv.Itoa(total))
+	return c.JSON(records)
+}
+
+// MockSchema serves the fields of a mock's records and their types
+func (d MockAPIDeps) MockSchema(c *fiber.Ctx) error {
+	m, ok, err := d.serveMock(c)
+	if !ok {
+		return err
+	}
+	fields, err := d.Server.Schema(context.Background(), m)
+	if err != nil {
+		return mockError(c, err)
+	}
+	return c.JSON(fiber.Map{"fields": fields, "expires_at": m.ExpiresAt})
+}
+
+// serveMock finds the mock of a public request and counts the request
+// against its rate limit. It reports false once it has responded.
+func (d MockAPIDeps) serveMock(c *fiber.Ctx) (*models.MockAPI, bool, error) {
+	c.Set(fiber.HeaderAccessControlAllowOrigin, "*")
+	c.Set(fiber.HeaderAccessControlExposeHeaders, "X-Total-Count, X-RateLimit-Limit, X-RateLimit-Remaining, Retry-After")
+	if d.Server == nil {
+		return nil, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	m, err := d.Server.Lookup(context.Background(), c.Params("id"))
+	if err != nil {
+		return nil, false, mockError(c, err)
+	}
+	allowed, remaining, reset := d.Server.Allow(m)
+	c.Set("X-RateLimit-Limit", strconv.Itoa(m.RequestsPerMinute))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !allowed {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+		return nil, false, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "rate_limited"})
+	}
+	return m, true, nil
+}
+
+func mockError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, mockapi.ErrNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	case errors.Is(err, mockapi.ErrExpired):
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "mock_api_expired"})
+	case errors.Is(err, mockapi.ErrInvalidQuery):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_query", "message": err.Error()})
+	case errors.Is(err, mockapi.ErrTooManyRecords):
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "too_many_records", "max_records": mockapi.MaxRecords})
+	case errors.Is(err, warehouse.ErrOutputUnavailable):
+		// Such as an encrypted output whose access grant has expired
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "output_unavailable"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "mock_api_failed"})
+}
+
+// auditMock records a change to a mock API
+func (d MockAPIDeps) auditMock(c *fiber.Ctx, userID int64, action string, m *models.MockAPI) {
+	if d.AuditLogs == nil {
+		return
+	}
+	raw, _ := json.Marshal(map[string]any{"job_id": m.JobID, "name": m.Name, "requests_per_minute": m.RequestsPerMinute, "expires_at": m.ExpiresAt})
+	resourceID := strconv.FormatInt(m.ID, 10)
+	_, _ = d.AuditLogs.Insert(context.Background(), &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   "mock_api",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+}
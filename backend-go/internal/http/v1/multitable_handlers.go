@@ -0,0 +1,352 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/annotations"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/buckets"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/multitable"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgsettings"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/promptguard"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/relationships"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// cardinalityRows is how many leading rows of each table children per parent
+// are profiled from
+const cardinalityRows = 5000
+
+// StartMultiTableRequest starts a job generating related tables, each from
+// its own dataset, delivered as one bundle
+type StartMultiTableRequest struct {
+	multitable.Options
+	Prompt       string                    `json:"prompt,omitempty"`
+	ZeroRealData bool                      `json:"zero_real_data,omitempty"`
+	PrivacyLevel string                    `json:"privacy_level,omitempty"`
+	Provider     string                    `json:"provider,omitempty"`
+	Strategy     agents.GenerationStrategy `json:"strategy,omitempty"`
+}
+
+// multiTableSource is what a table of a job is generated from
+type multiTableSource struct {
+	ds          *models.Dataset
+	masked      []string
+	mode        models.DataMode
+	modeSource  models.DataModeSource
+	columns     []string
+	rows        []map[string]interface{}
+	protections []privacy.ColumnPolicy
+	spend       *privacy.PrivacyBudget
+}
+
+// StartMultiTable starts a multi-table job. Every dataset is checked as a
+// single-table job's would be; the strictest data mode of any of them
+// applies to all tables, and the privacy budget of each is charged in the
+// transaction that creates the job. Children per parent are profiled from
+// the leading rows of the source tables unless the request sets them.
+func (d GenerationDeps) StartMultiTable(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body StartMultiTableRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if handled, herr := rejectExportFormats(c, "multi-table"); handled {
+		return herr
+	}
+	if err := body.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_multi_table", "message": err.Error()})
+	}
+	if body.Strategy != "" && !slices.Contains(generationStrategies, body.Strategy) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_strategy", "message": string(body.Strategy)})
+	}
+	if findings := promptguard.Scan(body.Prompt); len(findings) > 0 {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "suspicious_prompt", "findings": findings})
+	}
+	member, err := orgMembership(context.Background(), d.Orgs, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	}
+	if member != nil && !orgs.Can(member.Role, orgs.ActionWrite) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+	}
+	if body.Strategy != agents.StrategyStatistical {
+		if handled, err := d.checkProvider(c, owner); handled {
+			return err
+		}
+	}
+	if err := d.outputBucketReady(owner); errors.Is(err, buckets.ErrUnverified) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "output_bucket_unverified"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "org_lookup_failed"})
+	}
+	settings, err := d.jobSettings(owner, orgsettings.Settings{PrivacyLevel: body.PrivacyLevel, Provider: body.Provider})
+	if handled, herr := orgSettingError(c, err); handled {
+		return herr
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "policy_check_failed"})
+	}
+	// Bundles are not among the formats an organization can mandate, so a
+	// mandatory list rules them out as it does at download
+	if d.OrgSettings != nil {
+		org, err := d.OrgSettings.ForUser(context.Background(), owner)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "policy_check_failed"})
+		}
+		if handled, herr := orgSettingError(c, orgsettings.CheckExportFormat(org, multitable.Format)); handled {
+			return herr
+		}
+	}
+
+	order, _ := body.Order()
+	sources := make(map[string]*multiTableSource, len(order))
+	mode, modeSource := models.DataModeStandard, models.DataModeSourceDefault
+	for _, t := range order {
+		src, err := d.multiTableSource(owner, t.DatasetID, body, settings.PrivacyLevel)
+		switch {
+		case errors.Is(err, errRestrictedPrompt):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "restricted_column_in_prompt"})
+		case errors.Is(err, sql.ErrNoRows):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "dataset_access_denied", "table": t.Name})
+		case errors.Is(err, privacy.ErrPrivacyBudgetExceeded):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "privacy_budget_exceeded", "table": t.Name, "message": err.Error()})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+		}
+		sources[t.Name] = src
+		if mode != models.DataModeZeroRealData {
+			mode, modeSource = src.mode, src.modeSource
+		}
+	}
+	if body.Strategy == agents.StrategyStatistical && mode == models.DataModeZeroRealData {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "real_data_forbidden", "data_mode": mode, "data_mode_source": modeSource})
+	}
+
+	// Key columns must be ones the requester can see and, when the source
+	// is readable, ones it has
+	keyColumns := map[string][]string{}
+	for _, t := range order {
+		if t.PrimaryKey != "" {
+			keyColumns[t.Name] = append(keyColumns[t.Name], t.PrimaryKey)
+		}
+	}
+	for _, r := range body.Relationships {
+		keyColumns[r.Child] = append(keyColumns[r.Child], r.ForeignKey)
+	}
+	for _, t := range order {
+		src := sources[t.Name]
+		for _, col := range keyColumns[t.Name] {
+			hidden := slices.ContainsFunc(src.masked, func(m string) bool { return strings.EqualFold(m, col) })
+			if hidden || (len(src.columns) > 0 && !slices.Contains(src.columns, col)) {
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "table": t.Name, "message": col})
+			}
+		}
+	}
+
+	plan := &agents.MultiTablePlan{FileFormat: body.FileFormat}
+	for _, r := range body.Relationships {
+		shares := r.ChildrenPerParent
+		if len(shares) == 0 {
+			parent := slices.IndexFunc(order, func(t multitable.TableOptions) bool { return t.Name == r.Parent })
+			shares = multitable.Profile(sources[r.Parent].rows, sources[r.Child].rows, order[parent].PrimaryKey, r.ForeignKey)
+		}
+		if len(shares) == 0 {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+				"error":   "cardinality_unavailable",
+				"message": fmt.Sprintf("children of %s per %s cannot be profiled from the source; set children_per_parent", r.Child, r.Parent),
+			})
+		}
+		plan.Relationships = append(plan.Relationships, agents.ForeignKey{Parent: r.Parent, Child: r.Child, Column: r.ForeignKey, ChildrenPerParent: shares})
+	}
+	var masked []string
+	for _, t := range order {
+		src := sources[t.Name]
+		treq, err := d.multiTableRequest(owner, t, src, body, settings, mode)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+		}
+		// Statistical tables are fitted to their source sample
+		if body.Strategy == agents.StrategyStatistical && len(treq.Reference) == 0 {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "statistical_unavailable", "table": t.Name})
+		}
+		plan.Tables = append(plan.Tables, agents.MultiTableSpec{Name: t.Name, PrimaryKey: t.PrimaryKey, Rows: t.Rows, Request: treq})
+		for _, col := range src.masked {
+			masked = append(masked, t.Name+"."+col)
+		}
+	}
+
+	rows := multitable.EstimatedRows(plan)
+	canGenerate, reason, err := d.Usage.CanGenerateRows(context.Background(), owner, rows)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_check_failed"})
+	}
+	if !canGenerate {
+		return c.Status(fiber.StatusPaymentRequired).JSON(fiber.Map{
+			"error":   reason,
+			"message": "Usage limit exceeded. Please upgrade your plan.",
+		})
+	}
+
+	format := multitable.Format
+	job := &models.GenerationJob{
+		DatasetID:      order[0].DatasetID,
+		UserID:         owner,
+		RowsRequested:  rows,
+		MaskedColumns:  masked,
+		DataMode:       mode,
+		DataModeSource: modeSource,
+		OutputFormat:   &format,
+	}
+	if body.Prompt != "" {
+		job.Prompt = &body.Prompt
+	}
+	if settings.PrivacyLevel != "" {
+		job.PrivacyLevel = &settings.PrivacyLevel
+	}
+	if settings.Provider != "" {
+		job.RequestedProvider = &settings.Provider
+	}
+
+	var out *models.GenerationJob
+	charged := false
+	err = d.Tx.WithTx(context.Background(), func(ctx context.Context) error {
+		var charges []*models.PrivacyBudgetEntry
+		for _, t := range order {
+			src := sources[t.Name]
+			charge, err := d.chargePrivacyBudget(ctx, owner, t.DatasetID, src.protections, src.spend)
+			if err != nil {
+				return err
+			}
+			if charge != nil {
+				charges = append(charges, charge)
+			}
+		}
+		charged = true
+		out, err = d.Generations.Insert(ctx, job)
+		if err != nil {
+			return err
+		}
+		for _, charge := range charges {
+			if err := d.PrivacyBudgets.AttachJob(ctx, charge.ID, out.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, repo.ErrPrivacyBudgetExhausted):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "privacy_budget_exhausted"})
+	case err != nil && !charged:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "privacy_check_failed"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	if d.Queue != nil {
+		req := &agents.GenerationRequest{
+			DatasetID:    job.DatasetID,
+			UserID:       owner,
+			Config:       agents.GenerationConfig{Rows: rows, PrivacyLevel: settings.PrivacyLevel, Strategy: body.Strategy},
+			ZeroRealData: mode == models.DataModeZeroRealData,
+		}
+		multitable.Apply(req, plan)
+		if req.Watermark, err = d.planWatermarked(owner); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "enqueue_failed", "job_id": out.ID})
+		}
+		if err := d.Queue.Enqueue(context.Background(), out.ID, req); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "enqueue_failed", "job_id": out.ID})
+		}
+		out.Status = models.GenQueued
+	}
+	return c.Status(fiber.StatusAccepted).JSON(out)
+}
+
+var errRestrictedPrompt = errors.New("prompt names a restricted column")
+
+// multiTableSource checks the requester may generate from a dataset and
+// reads what the job needs of it
+func (d GenerationDeps) multiTableSource(owner, datasetID int64, body StartMultiTableRequest, level string) (*multiTableSource, error) {
+	src := &multiTableSource{}
+	var err error
+	if d.Grants != nil {
+		if src.ds, err = d.Grants.GetAccessibleDataset(context.Background(), owner, datasetID, models.DatasetPermGenerate); err != nil {
+			return nil, err
+		}
+		acl, err := columnACLFor(d.Grants, d.Annotations, nil, owner, src.ds)
+		if err != nil {
+			return nil, err
+		}
+		if err := acl.CheckPrompt(body.Prompt); err != nil {
+			return nil, errRestrictedPrompt
+		}
+		src.masked = acl.Hidden()
+	} else if d.Datasets != nil {
+		if src.ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, datasetID); err != nil {
+			return nil, err
+		}
+	}
+	if src.mode, src.modeSource, err = d.dataMode(owner, datasetID, body.ZeroRealData); err != nil {
+		return nil, err
+	}
+	if src.protections, src.spend, err = d.columnPrivacy(datasetID, level); err != nil {
+		return nil, err
+	}
+	// Children per parent are counts, not source values, so they are
+	// profiled in every data mode; an unreadable source leaves them to the
+	// request
+	reader, ok := d.StorageClient.(storage.ObjectReader)
+	if src.ds != nil && ok && src.ds.ObjectKey != nil && *src.ds.ObjectKey != "" {
+		src.columns, src.rows, err = readPreview(context.Background(), reader, *src.ds.ObjectKey, src.ds.FileType, cardinalityRows)
+		if err != nil {
+			src.columns, src.rows = nil, nil
+		}
+	}
+	return src, nil
+}
+
+// multiTableRequest builds the request one table of a job is generated with
+func (d GenerationDeps) multiTableRequest(owner int64, t multitable.TableOptions, src *multiTableSource, body StartMultiTableRequest,
+	settings orgsettings.Settings, mode models.DataMode) (*agents.GenerationRequest, error) {
+	req := &agents.GenerationRequest{
+		DatasetID:         t.DatasetID,
+		UserID:            owner,
+		Config:            agents.GenerationConfig{Rows: t.Rows, PrivacyLevel: settings.PrivacyLevel, Strategy: body.Strategy},
+		RestrictedColumns: src.masked,
+		ZeroRealData:      mode == models.DataModeZeroRealData,
+	}
+	if body.Prompt != "" {
+		req.Config.BusinessRules = []string{body.Prompt}
+	}
+	if mode != models.DataModeZeroRealData {
+		req.Reference = d.reference(src.ds, owner, t.DatasetID, src.masked)
+	}
+	if d.Annotations != nil {
+		anns, err := d.Annotations.List(context.Background(), t.DatasetID)
+		if err != nil {
+			return nil, err
+		}
+		annotations.Apply(req, anns)
+	}
+	if d.Relationships != nil {
+		hints, err := d.Relationships.List(context.Background(), t.DatasetID, models.RelationshipAccepted)
+		if err != nil {
+			return nil, err
+		}
+		relationships.Apply(req, acceptedRelationships(hints))
+	}
+	req.SchemaAnalysis.ColumnPrivacy = src.protections
+	return req, nil
+}
@@ -0,0 +1,85 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/nested"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errNestedUnavailable = errors.New("dataset rows are not readable for nested column profiling")
+
+// nestedProfile profiles the nested JSON columns of a dataset's leading rows
+func nestedProfile(client storage.SignedURLProvider, ds *models.Dataset) ([]nested.ColumnProfile, error) {
+	reader, ok := client.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" || (ds.FileType != "csv" && ds.FileType != "json") {
+		return nil, errNestedUnavailable
+	}
+	columns, rows, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+	if err != nil {
+		return nil, err
+	}
+	return nested.Profile(columns, rows), nil
+}
+
+// GetNestedColumns returns the nested JSON columns of a dataset with their
+// key frequencies, value types and inferred schema. Hidden columns are left
+// out.
+func (d DatasetDeps) GetNestedColumns(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.accessibleDataset(owner, id, models.DatasetPermRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	acl, err := d.columnACL(owner, ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+	}
+	profiles, err := nestedProfile(d.StorageClient, ds)
+	if errors.Is(err, errNestedUnavailable) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "dataset_not_readable"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	hidden := make(map[string]bool)
+	for _, col := range acl.Hidden() {
+		hidden[col] = true
+	}
+	out := make([]nested.ColumnProfile, 0, len(profiles))
+	for _, p := range profiles {
+		if !hidden[strings.ToLower(p.Column)] {
+			out = append(out, p)
+		}
+	}
+	return c.JSON(fiber.Map{"dataset_id": id, "profile_rows": profileRows, "columns": out})
+}
+
+// nestedColumns profiles the nested columns of a dataset for a job. Shapes
+// are inferred now, so a job keeps them if the dataset is replaced while it
+// waits; a dataset that is not readable has none.
+func (d GenerationDeps) nestedColumns(ds *models.Dataset, owner, datasetID int64) ([]nested.ColumnProfile, error) {
+	if ds == nil {
+		if d.Datasets == nil {
+			return nil, nil
+		}
+		var err error
+		if ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, datasetID); err != nil {
+			return nil, err
+		}
+	}
+	profiles, err := nestedProfile(d.StorageClient, ds)
+	if errors.Is(err, errNestedUnavailable) {
+		return nil, nil
+	}
+	return profiles, err
+}
@@ -0,0 +1,94 @@
+package v1
+
+import (
+	"context"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/gofiber/fiber/v2"
+)
+
+type NotificationDeps struct {
+	Notifications *repo.NotificationRepo
+}
+
+// ListNotifications returns the caller's recent notifications
+func (d NotificationDeps) ListNotifications(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int64)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Notifications == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	items, err := d.Notifications.ListByUser(context.Background(), userID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if items == nil {
+		items = []models.Notification{}
+	}
+	return c.JSON(items)
+}
+
+// GetNotificationPreferences returns how the caller receives notifications
+func (d NotificationDeps) GetNotificationPreferences(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int64)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Notifications == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	pref, err := d.Notifications.Preference(context.Background(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(pref)
+}
+
+// UpdateNotificationPreferences sets the digest frequency for non-critical
+// notifications. Security and billing notifications are always immediate.
+func (d NotificationDeps) UpdateNotificationPreferences(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int64)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Notifications == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	var body struct {
+		Frequency models.DigestFrequency `json:"frequency"`
+		DailyHour *int                   `json:"daily_hour"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	switch body.Frequency {
+	case models.DigestImmediate, models.DigestHourly, models.DigestDaily, models.DigestOff:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_frequency"})
+	}
+	hour := repo.DefaultDigestHour
+	if body.DailyHour != nil {
+		if *body.DailyHour < 0 || *body.DailyHour > 23 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_daily_hour"})
+		}
+		hour = *body.DailyHour
+	} else if cur, err := d.Notifications.Preference(context.Background(), userID); err == nil {
+		hour = cur.DailyHour
+	}
+	pref, err := d.Notifications.UpsertPreference(context.Background(), &models.NotificationPreference{
+		UserID:    userID,
+		Frequency: body.Frequency,
+		DailyHour: hour,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(pref)
+}
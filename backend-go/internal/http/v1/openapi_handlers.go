@@ -0,0 +1,237 @@
+package v1
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/housekeeping"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/incidents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/openapi"
+)
+
+// apiPrefix is where v1 routes are mounted
+const apiPrefix = "/api/v1"
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  openapi.Document
+)
+
+// OpenAPI serves an OpenAPI 3.1 document of every v1 route, built from the
+// routes registered on the app so that it cannot fall behind them. Client
+// SDKs are generated from it.
+func OpenAPI(c *fiber.Ctx) error {
+	// Routes are all registered before the app serves, so the document is
+	// built on the first request and kept
+	openAPIOnce.Do(func() {
+		var routes []openapi.Route
+		for _, r := range c.App().GetRoutes(true) {
+			if r.Path != apiPrefix && !strings.HasPrefix(r.Path, apiPrefix+"/") {
+				continue
+			}
+			var handler any
+			if len(r.Handlers) > 0 {
+				handler = r.Handlers[len(r.Handlers)-1]
+			}
+			routes = append(routes, openapi.Route{Method: r.Method, Path: strings.TrimPrefix(r.Path, apiPrefix), Handler: handler})
+		}
+		openAPIDoc = openapi.Builder{
+			Info: openapi.Info{
+				Title:       "Synthos API",
+				Version:     "v1",
+				Description: "Synthetic data generation: datasets, generation jobs and their outputs, organizations, billing and administration. Authenticate with a bearer token from /auth/signin or an API key in X-API-Key. POST, PUT and PATCH requests may carry an Idempotency-Key header; retrying one with the same key as the same user or API key within 24 hours returns the first response, marked Idempotent-Replayed. Requests are limited per minute to the rate of the caller's subscription plan, and per IP without credentials; responses carry X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset (Unix seconds), and a request over the limit gets 429 rate_limited with Retry-After.",
+				Server:      apiPrefix,
+			},
+			Operations: apiOperations,
+			Summaries:  docSummaries(),
+		}.Build(routes)
+	})
+	return c.JSON(openAPIDoc)
+}
+
+// docSummaries returns the summaries of /docs keyed by method and path
+func docSummaries() map[string]string {
+	out := map[string]string{}
+	paths, _ := apiDocs()["paths"].(fiber.Map)
+	for path, ops := range paths {
+		methods, _ := ops.(fiber.Map)
+		for method, op := range methods {
+			if m, ok := op.(fiber.Map); ok {
+				if summary, ok := m["summary"].(string); ok {
+					out[strings.ToUpper(method)+" "+path] = summary
+				}
+			}
+		}
+	}
+	return out
+}
+
+// jsonObject documents a body decoded into a struct local to its handler
+var jsonObject = map[string]any{}
+
+// apiOperations are the bodies, statuses and access of v1 operations,
+// keyed by method and OpenAPI path. Routes not listed take no body and
+// return a JSON object.
+var apiOperations = map[string]openapi.Operation{
+	// Public
+	"GET /docs":                           {Public: true},
+	"GET /docs/ui":                        {Public: true, Raw: "text/html"},
+	"GET /openapi.json":                   {Public: true, Summary: "This OpenAPI 3.1 document"},
+	"GET /marketing/features":             {Public: true},
+	"GET /marketing/testimonials":         {Public: true},
+	"GET /legal/documents":                {Public: true},
+	"GET /changelog":                      {Public: true, Response: ChangelogResponse{}},
+	"GET /export-signatures/keys":         {Public: true},
+	"POST /export-signatures/verify":      {Public: true, Request: jsonObject},
+	"POST /export-signatures/verify-file": {Public: true, Request: jsonObject},
+	"GET /downloads/{token}":              {Public: true, Raw: "application/octet-stream"},
+	"GET /mock/{id}/records":              {Public: true, Params: map[string]string{"id": "string"}},
+	"GET /mock/{id}/schema":               {Public: true, Params: map[string]string{"id": "string"}},
+	"GET /payment/plans":                  {Public: true},
+	"GET /payment/support-tiers":          {Public: true},
+	"GET /payment/regions":                {Public: true},
+	"POST /payment/contact-sales":         {Public: true, Request: jsonObject},
+	"POST /payment/webhook":               {Public: true, Request: jsonObject},
+	"POST /payment/paddle-webhook":        {Public: true, Request: jsonObject},
+
+	// Auth
+	"POST /auth/signup":                   {Public: true, Request: SignUpRequest{}, Status: http.StatusCreated},
+	"POST /auth/signin":                   {Public: true, Request: SignInRequest{}},
+	"POST /auth/refresh":                  {Public: true, Request: RefreshRequest{}},
+	"POST /auth/logout":                   {Request: RefreshRequest{}},
+	"POST /auth/forgot-password":          {Public: true, Request: ForgotPasswordRequest{}, Status: http.StatusAccepted},
+	"POST /auth/reset-password":           {Public: true, Request: ResetPasswordRequest{}},
+	"POST /auth/api-keys":                 {Request: jsonObject},
+	"PUT /auth/api-keys/{id}/rotation":    {Request: jsonObject},
+	"POST /auth/api-keys/{id}/rotate":     {Request: jsonObject},
+	"POST /auth/email-change/confirm":     {Public: true, Request: AccountTokenRequest{}},
+	"POST /auth/email-change/cancel":      {Public: true, Request: AccountTokenRequest{}},
+	"PUT /users/profile":                  {Request: UpdateProfileRequest{}},
+	"POST /users/email-change":            {Request: EmailChangeRequest{}, Status: http.StatusAccepted},
+	"POST /users/merge":                   {Request: AccountMergeRequest{}, Status: http.StatusAccepted},
+	"POST /users/merge/confirm":           {Request: AccountTokenRequest{}},
+	"PUT /users/notification-preferences": {Request: jsonObject},
+	"POST /users/consent/accept":          {Request: AcceptDocumentsRequest{}},
+	"PUT /users/consent/email":            {Request: EmailConsentRequest{}},
+	"GET /users/usage/invoice":            {Response: models.UsageInvoice{}},
+
+	// Organizations
+	"POST /orgs":                          {Request: CreateOrgRequest{}, Status: http.StatusCreated},
+	"POST /orgs/invitations/accept":       {Request: AccountTokenRequest{}},
+	"PUT /orgs/current/members/{user_id}": {Request: OrgRoleRequest{}},
+	"POST /orgs/current/invitations":      {Request: OrgInvitationRequest{}, Status: http.StatusCreated},
+	"PUT /orgs/current/branding":          {Request: BrandingRequest{}},
+	"DELETE /orgs/current/branding":       {Status: http.StatusNoContent},
+	"PUT /orgs/current/output-bucket":     {Request: OutputBucketRequest{}},
+	"DELETE /orgs/current/output-bucket":  {Status: http.StatusNoContent},
+
+	// Member imports
+	"GET /orgs/current/invitations/imports/{id}":        {Response: OrgImportResponse{}},
+	"POST /orgs/current/invitations/imports":            {Upload: "file", Response: OrgImportResponse{}, Status: http.StatusAccepted},
+	"POST /orgs/current/invitations/imports/{id}/retry": {Status: http.StatusAccepted},
+
+	// Capability policies
+	"PUT /orgs/current/policies/{capability}":    {Request: OrgPolicyRequest{}, Response: OrgCapability{}},
+	"DELETE /orgs/current/policies/{capability}": {Response: OrgCapability{}},
+
+	// Datasets
+	"GET /datasets":                               {Response: []models.Dataset{}},
+	"GET /datasets/{id}":                          {Response: models.Dataset{}},
+	"POST /datasets/upload":                       {Upload: "file", Request: datasetUploadForm{}, Status: http.StatusAccepted},
+	"POST /datasets/collections":                  {Request: CollectionRequest{}, Status: http.StatusCreated},
+	"PUT /datasets/collections/{collectionId}":    {Request: CollectionRequest{}},
+	"DELETE /datasets/collections/{collectionId}": {Status: http.StatusNoContent},
+	"POST /datasets/sources":                      {Request: DatasetSourceRequest{}, Status: http.StatusCreated},
+	"POST /datasets/sources/{id}/import":          {Request: SourceImportRequest{}, Status: http.StatusCreated},
+	"POST /datasets/vocabularies":                 {Request: VocabularyRequest{}, Status: http.StatusCreated},
+	"POST /datasets/{id}/download-urls/revoke":    {Request: jsonObject},
+	"POST /datasets/{id}/grants":                  {Request: CreateGrantRequest{}, Status: http.StatusCreated},
+	"PUT /datasets/{id}/columns/restrictions":     {Request: ColumnRestrictionRequest{}},
+	"POST /datasets/{id}/columns/clearances":      {Request: ColumnClearanceRequest{}, Status: http.StatusCreated},
+	"PUT /datasets/{id}/data-policy":              {Request: jsonObject},
+	"PUT /datasets/{id}/weights":                  {Request: jsonObject},
+	"PUT /datasets/{id}/schema/columns/{column}":  {Request: ColumnAnnotationRequest{}},
+	"PUT /datasets/{id}/relationships/{hintId}":   {Request: jsonObject},
+	"POST /datasets/{id}/hierarchies":             {Request: CreateHierarchyRequest{}, Status: http.StatusCreated},
+	"PUT /datasets/{id}/vocabularies/{column}":    {Request: BindVocabularyRequest{}},
+	"PUT /datasets/{id}/privacy/columns/{column}": {Request: ColumnPrivacyRequest{}},
+	"PUT /datasets/{id}/fixed-width-layout":       {Request: FixedWidthLayoutRequest{}},
+	"PUT /datasets/{id}/quality-policy":           {Request: QualityPolicyRequest{}},
+	"PUT /datasets/{id}/fhir-mapping":             {Request: FHIRMappingRequest{}},
+	"PUT /datasets/{id}/financial-message-layout": {Request: FinancialMessageLayoutRequest{}},
+	"POST /groups":                                {Request: CreateGroupRequest{}, Status: http.StatusCreated},
+	"POST /groups/{id}/members":                   {Request: GroupMemberRequest{}},
+
+	// Generation
+	"POST /generation/generate":                             {Request: StartGenerationRequest{}, Status: http.StatusAccepted},
+	"POST /generation/multi-table":                          {Request: StartMultiTableRequest{}, Status: http.StatusAccepted},
+	"POST /generation/events":                               {Request: jsonObject, Status: http.StatusAccepted},
+	"GET /generation/jobs":                                  {Response: []models.GenerationJob{}},
+	"GET /generation/jobs/{id}":                             {Response: models.GenerationJob{}},
+	"POST /generation/templates":                            {Request: GenerationTemplateRequest{}, Status: http.StatusCreated},
+	"PUT /generation/templates/{id}":                        {Request: GenerationTemplateRequest{}},
+	"DELETE /generation/templates/{id}":                     {Status: http.StatusNoContent},
+	"GET /generation/{id}/artifacts/{name}":                 {Raw: "application/octet-stream"},
+	"POST /generation/jobs/{id}/watermark/verify":           {Request: jsonObject},
+	"POST /generation/jobs/{id}/access":                     {Request: jsonObject, Status: http.StatusCreated},
+	"POST /generation/jobs/{id}/warehouse-exports":          {Request: WarehouseExportRequest{}, Status: http.StatusAccepted},
+	"POST /webhooks":                                        {Request: WebhookRequest{}, Status: http.StatusCreated},
+	"PUT /webhooks/{id}":                                    {Request: WebhookRequest{}},
+	"POST /webhooks/{id}/deliveries/{deliveryId}/redeliver": {Status: http.StatusAccepted},
+	"POST /warehouses":                                      {Request: WarehouseRequest{}, Status: http.StatusCreated},
+	"POST /warehouses/test":                                 {Request: WarehouseRequest{}},
+	"PUT /warehouses/{id}":                                  {Request: WarehouseRequest{}},
+	"POST /mock-apis":                                       {Request: MockAPIRequest{}, Status: http.StatusCreated},
+	"POST /payment/checkout":                                {Request: CheckoutRequest{}},
+	"POST /billing/portal":                                  {Request: PortalRequest{}},
+	"POST /custom-models/upload":                            {Upload: "file", Request: UploadCustomModelRequest{}},
+	"POST /analytics/feedback":                              {Request: FeedbackRequest{}},
+	"GET /analytics/feedback/{id}":                          {Params: map[string]string{"id": "string"}},
+	"POST /feedback":                                        {Request: FeedbackRequest{}},
+	"GET /feedback/{id}":                                    {Params: map[string]string{"id": "string"}},
+
+	// Admin
+	"PUT /admin/users/{id}/status":              {Request: jsonObject},
+	"PUT /admin/orgs/{id}/anonymization-policy": {Request: jsonObject},
+	"PUT /admin/orgs/{id}/data-policy":          {Request: jsonObject},
+	"PUT /admin/orgs/{id}/settings":             {Request: jsonObject},
+	"PUT /admin/users/{id}/org":                 {Request: jsonObject},
+	"PUT /admin/users/{id}/roles":               {Request: UserRolesRequest{}},
+	"POST /admin/users/{id}/suspend":            {Request: jsonObject},
+	"POST /admin/users/{id}/reactivate":         {Request: jsonObject},
+	"PUT /admin/users/{id}/subscription":        {Request: jsonObject},
+	"GET /admin/users/{id}/quota-override":      {Response: models.QuotaOverride{}},
+	"PUT /admin/users/{id}/quota-override":      {Request: QuotaOverrideRequest{}, Response: models.QuotaOverride{}},
+	"POST /admin/users/{id}/impersonate":        {Request: jsonObject, Status: http.StatusCreated},
+	"PUT /admin/rbac/roles/{name}":              {Request: RoleRequest{}},
+	"DELETE /admin/rbac/roles/{name}":           {Status: http.StatusNoContent},
+	"POST /admin/output-access/{id}/decision":   {Request: jsonObject},
+	"POST /admin/watermark/verify":              {Request: jsonObject},
+	"GET /admin/evidence/package":               {Raw: "application/zip"},
+	"GET /admin/changelog":                      {Response: []models.ChangelogEntry{}},
+	"POST /admin/changelog":                     {Request: ChangelogEntryRequest{}, Response: models.ChangelogEntry{}, Status: http.StatusCreated},
+	"PUT /admin/changelog/{id}":                 {Request: ChangelogEntryRequest{}, Response: models.ChangelogEntry{}},
+	"POST /admin/changelog/{id}/publish":        {Response: models.ChangelogEntry{}},
+	"GET /admin/incidents/timeline":             {Response: incidents.Timeline{}},
+	"POST /admin/incidents/deployments":         {Request: DeploymentRequest{}, Response: models.DeploymentMarker{}, Status: http.StatusCreated},
+	"GET /admin/housekeeping/suggestions":       {Response: housekeeping.Report{}},
+	"PUT /admin/housekeeping/policies/{kind}":   {Request: CleanupPolicyRequest{}, Response: models.CleanupPolicy{}},
+	"POST /admin/reports/templates":             {Request: ReportTemplateRequest{}, Status: http.StatusCreated},
+	"PUT /admin/reports/templates/{id}":         {Request: ReportTemplateRequest{}},
+	"GET /admin/debug/pprof/{path}":             {Raw: "application/octet-stream"},
+	"POST /admin/debug/pprof/{path}":            {Hidden: true},
+	"PUT /admin/debug/pprof/{path}":             {Hidden: true},
+	"PATCH /admin/debug/pprof/{path}":           {Hidden: true},
+	"DELETE /admin/debug/pprof/{path}":          {Hidden: true},
+	"POST /admin/debug/heap-dumps":              {Status: http.StatusCreated},
+	"GET /admin/debug/heap-dumps/{name}":        {Raw: "application/octet-stream"},
+}
+
+// datasetUploadForm is the form fields of a dataset upload besides its file
+type datasetUploadForm struct {
+	RetentionDays int `json:"retention_days,omitempty"`
+}
@@ -0,0 +1,581 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/accounts"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/branding"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/buckets"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/capacity"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/services"
+)
+
+type OrgDeps struct {
+	Orgs         *repo.OrgRepo
+	Users        *repo.UserRepo
+	AuditLogs    *repo.AuditLogRepo
+	EmailService *services.EmailService
+	Tx           *repo.Transactor
+	// Branding holds the white-label branding of organizations
+	Branding *repo.BrandingRepo
+	// DNS looks up the records that verify branded hostnames; nil uses the
+	// system resolver
+	DNS branding.TXTResolver
+	// ReservedDomains cannot be branded, such as the platform's own
+	ReservedDomains []string
+	// Rollups holds hourly usage totals for heatmaps and capacity planning
+	Rollups *repo.UsageRollupRepo
+	// GenerationAudit holds the audit records of members' generation jobs
+	GenerationAudit *repo.GenerationAuditRepo
+	// Generations holds the provider usage the cost report forecasts from,
+	// with committed-use suggestions at CommitmentDiscount
+	Generations        *repo.GenerationRepo
+	CommitmentDiscount float64
+	// OutputBuckets holds the buckets organizations have outputs delivered
+	// to, and Buckets opens them for permission checks
+	OutputBuckets *repo.OutputBucketRepo
+	Buckets       *buckets.Registry
+	// Imports holds CSV member imports, invited in the background
+	Imports *repo.OrgImportRepo
+	// Policies holds the capabilities admins disabled for their members
+	// and the attempts to use them
+	Policies *repo.OrgPolicyRepo
+}
+
+type CreateOrgRequest struct {
+	Name string `json:"name"`
+}
+
+type OrgRoleRequest struct {
+	Role string `json:"role"`
+}
+
+type OrgInvitationRequest struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+	// Team is copied to the membership when the invitation is accepted
+	Team string `json:"team"`
+}
+
+// orgMembership returns the caller's organization membership, or nil when
+// they belong to none or organizations are not configured
+func orgMembership(ctx context.Context, orgRepo *repo.OrgRepo, userID int64) (*models.OrgMember, error) {
+	if orgRepo == nil {
+		return nil, nil
+	}
+	member, err := orgRepo.Membership(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return member, err
+}
+
+// CreateOrg starts an organization with the caller as its owner
+func (d OrgDeps) CreateOrg(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body CreateOrgRequest
+	if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Name) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	ctx := context.Background()
+	var org *models.Organization
+	err := d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		if org, err = d.Orgs.Create(ctx, strings.TrimSpace(body.Name), owner); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, owner, "org_created", org.ID, map[string]any{"name": org.Name})
+	})
+	if errors.Is(err, repo.ErrOrgMemberExists) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "already_in_org"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"organization": org, "role": models.OrgRoleOwner})
+}
+
+// GetOrg returns the caller's organization and their role in it
+func (d OrgDeps) GetOrg(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	member, err := d.member(owner, orgs.ActionInspect)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	org, err := d.Orgs.Get(context.Background(), member.OrgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(fiber.Map{"organization": org, "role": member.Role})
+}
+
+// ListMembers lists the members of the caller's organization
+func (d OrgDeps) ListMembers(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	member, err := d.member(owner, orgs.ActionInspect)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	members, err := d.Orgs.Members(context.Background(), member.OrgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(fiber.Map{"members": members})
+}
+
+// UpdateMemberRole changes the role of a member of the caller's
+// organization. Admins manage everyone but owners; only owners make owners.
+func (d OrgDeps) UpdateMemberRole(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	actor, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	userID, err := strconv.ParseInt(c.Params("user_id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_user_id"})
+	}
+	var body OrgRoleRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	role, err := orgs.ParseRole(body.Role)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_role"})
+	}
+	ctx := context.Background()
+	target, err := orgMembership(ctx, d.Orgs, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	if target == nil || target.OrgID != actor.OrgID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "member_not_found"})
+	}
+	if err := orgs.CheckAssign(actor.Role, target.Role, role); err != nil {
+		return orgError(c, err, "update_failed")
+	}
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := d.Orgs.SetRole(ctx, actor.OrgID, userID, role); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, actor.UserID, "org_member_role_changed", actor.OrgID, map[string]any{
+			"user_id": userID,
+			"from":    target.Role,
+			"to":      role,
+		})
+	})
+	if err != nil {
+		return orgError(c, err, "update_failed")
+	}
+	target.Role = role
+	return c.JSON(target)
+}
+
+// RemoveMember takes a member out of the caller's organization. Anyone may
+// remove themselves; what they created stays with the organization.
+func (d OrgDeps) RemoveMember(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	userID, err := strconv.ParseInt(c.Params("user_id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_user_id"})
+	}
+	return d.removeMember(c, owner, userID)
+}
+
+// LeaveOrg takes the caller out of their organization
+func (d OrgDeps) LeaveOrg(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	return d.removeMember(c, owner, owner)
+}
+
+func (d OrgDeps) removeMember(c *fiber.Ctx, owner, userID int64) error {
+	actor, err := d.member(owner, orgs.ActionRead)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	ctx := context.Background()
+	target, err := orgMembership(ctx, d.Orgs, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "remove_failed"})
+	}
+	if target == nil || target.OrgID != actor.OrgID {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "member_not_found"})
+	}
+	// Removing someone else takes the right to manage their role
+	if userID != actor.UserID {
+		if err := orgs.CheckAssign(actor.Role, target.Role, target.Role); err != nil {
+			return orgError(c, err, "remove_failed")
+		}
+	}
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := d.Orgs.RemoveMember(ctx, actor.OrgID, userID); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, actor.UserID, "org_member_removed", actor.OrgID, map[string]any{
+			"user_id": userID,
+			"role":    target.Role,
+		})
+	})
+	if err != nil {
+		return orgError(c, err, "remove_failed")
+	}
+	return c.JSON(fiber.Map{"message": "member_removed"})
+}
+
+// CreateInvitation invites an address to the caller's organization with a
+// role and emails it a link to accept
+func (d OrgDeps) CreateInvitation(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	actor, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	var body OrgInvitationRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	email := accounts.NormalizeEmail(body.Email)
+	if verr := ValidateEmail(email); verr != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_email", "detail": verr.Message})
+	}
+	if body.Role == "" {
+		body.Role = string(models.OrgRoleMember)
+	}
+	role, err := orgs.ParseRole(body.Role)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_role"})
+	}
+	if err := orgs.CheckAssign(actor.Role, "", role); err != nil {
+		return orgError(c, err, "create_failed")
+	}
+	team, err := orgs.NormalizeTeam(body.Team)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_team", "message": err.Error()})
+	}
+	ctx := context.Background()
+	org, err := d.Orgs.Get(ctx, actor.OrgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	token, tokenHash, err := accounts.NewToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "token_failed"})
+	}
+	var inv *models.OrgInvitation
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		inv, err = d.Orgs.CreateInvitation(ctx, &models.OrgInvitation{
+			OrgID:     actor.OrgID,
+			Email:     email,
+			Role:      role,
+			Team:      team,
+			TokenHash: tokenHash,
+			InvitedBy: actor.UserID,
+			ExpiresAt: time.Now().Add(orgs.InvitationTTL),
+		})
+		if err != nil {
+			return err
+		}
+		return d.audit(ctx, c, actor.UserID, "org_invitation_created", actor.OrgID, map[string]any{
+			"invitation_id": inv.ID,
+			"email":         inv.Email,
+			"role":          inv.Role,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	if d.EmailService != nil {
+		_ = d.EmailService.SendOrgInvitationEmail(inv.Email, org.Name, actor.Email, string(inv.Role), token)
+	}
+	return c.Status(fiber.StatusCreated).JSON(inv)
+}
+
+// ListInvitations lists the invitations of the caller's organization that
+// can still be accepted
+func (d OrgDeps) ListInvitations(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	actor, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	invs, err := d.Orgs.Invitations(context.Background(), actor.OrgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(fiber.Map{"invitations": invs})
+}
+
+// RevokeInvitation stops an invitation of the caller's organization from
+// being accepted
+func (d OrgDeps) RevokeInvitation(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	actor, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_invitation_id"})
+	}
+	ctx := context.Background()
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := d.Orgs.RevokeInvitation(ctx, actor.OrgID, id); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, actor.UserID, "org_invitation_revoked", actor.OrgID, map[string]any{"invitation_id": id})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "revoke_failed"})
+	}
+	return c.JSON(fiber.Map{"message": "invitation_revoked"})
+}
+
+// AcceptInvitation makes the caller a member of the organization an
+// invitation sent to their address is for
+func (d OrgDeps) AcceptInvitation(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body AccountTokenRequest
+	if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Token) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	ctx := context.Background()
+	user, err := d.Users.GetByID(ctx, owner)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user_not_found"})
+	}
+	inv, err := d.Orgs.InvitationByToken(ctx, accounts.HashToken(body.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "invalid_token"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "accept_failed"})
+	}
+	switch err := orgs.CheckInvitation(inv, user.Email, time.Now()); {
+	case errors.Is(err, orgs.ErrInvitationEmail):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "invitation_email_mismatch"})
+	case err != nil:
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "invitation_closed"})
+	}
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if _, err := d.Orgs.AcceptInvitation(ctx, inv.ID, owner); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, owner, "org_invitation_accepted", inv.OrgID, map[string]any{
+			"invitation_id": inv.ID,
+			"role":          inv.Role,
+		})
+	})
+	switch {
+	case errors.Is(err, repo.ErrOrgMemberExists):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "already_in_org"})
+	case errors.Is(err, sql.ErrNoRows):
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "invitation_closed"})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "accept_failed"})
+	}
+	org, err := d.Orgs.Get(ctx, inv.OrgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(fiber.Map{"organization": org, "role": inv.Role})
+}
+
+// OrgUsage sums this month's usage of the caller's organization, in total
+// and per member
+func (d OrgDeps) OrgUsage(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	member, err := d.member(owner, orgs.ActionInspect)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	usage, err := d.Orgs.Usage(context.Background(), member.OrgID, since)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_failed"})
+	}
+	return c.JSON(usage)
+}
+
+// UsageCapacity returns the organization's generation volume per day and as
+// an hour-of-week heatmap, with the daily trend projected forward for budget
+// and capacity planning. days sets the history (default 90, max 365),
+// horizon the projection (default 30, max 180) and tz the time zone days and
+// hours are read in (default UTC). Only admins see it.
+func (d OrgDeps) UsageCapacity(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	days := c.QueryInt("days", 90)
+	if days <= 0 || days > 365 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_days"})
+	}
+	horizon := c.QueryInt("horizon", 30)
+	if horizon <= 0 || horizon > 180 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_horizon"})
+	}
+	loc, err := time.LoadLocation(c.Query("tz", "UTC"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_timezone"})
+	}
+	member, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+
+	now := time.Now()
+	local := now.In(loc)
+	since := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, -(days - 1))
+	rollups, err := d.Rollups.ListByOrg(context.Background(), member.OrgID, since)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_failed"})
+	}
+	heatmap := capacity.BuildHeatmap(rollups, loc)
+	// Today is incomplete, so the trend is fitted to full days only
+	daily := capacity.Daily(rollups, loc, since, now)
+	history := daily
+	if len(history) > 1 {
+		history = history[:len(history)-1]
+	}
+	return c.JSON(fiber.Map{
+		"org_id":     member.OrgID,
+		"since":      since,
+		"timezone":   loc.String(),
+		"daily":      daily,
+		"heatmap":    heatmap,
+		"projection": capacity.Project(history, horizon, heatmap.PeakHourlyRows),
+	})
+}
+
+// UsageCosts is the organization's cost report: provider spend per model
+// over the last complete months (months, default 6, max 24) and this month
+// so far, next month's forecast, and cheaper model mixes or committed-use
+// configurations. Only admins see it.
+func (d OrgDeps) UsageCosts(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	months := c.QueryInt("months", 6)
+	if months <= 0 || months > 24 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_months"})
+	}
+	if d.Generations == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	member, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	now := time.Now().UTC()
+	since := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -months, 0)
+	usage, err := d.Generations.OrgUsageByProvider(context.Background(), member.OrgID, since, "month")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_failed"})
+	}
+	opts := capacity.DefaultSpendOptions
+	opts.CommitmentDiscount = d.CommitmentDiscount
+	return c.JSON(fiber.Map{
+		"org_id":   member.OrgID,
+		"since":    since,
+		"forecast": capacity.ForecastSpend(usage, now, opts),
+	})
+}
+
+var errNotInOrg = errors.New("user belongs to no organization")
+
+// member returns the membership of userID when their role allows action
+func (d OrgDeps) member(userID int64, action orgs.Action) (*models.OrgMember, error) {
+	member, err := orgMembership(context.Background(), d.Orgs, userID)
+	switch {
+	case err != nil:
+		return nil, err
+	case member == nil:
+		return nil, errNotInOrg
+	case !orgs.Can(member.Role, action):
+		return nil, orgs.ErrForbidden
+	}
+	return member, nil
+}
+
+// orgError answers a request an organization check or change refused
+func orgError(c *fiber.Ctx, err error, failed string) error {
+	switch {
+	case errors.Is(err, errNotInOrg):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_in_org"})
+	case errors.Is(err, orgs.ErrForbidden):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "org_role_forbidden"})
+	case errors.Is(err, repo.ErrLastOrgOwner):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "last_owner"})
+	case errors.Is(err, sql.ErrNoRows):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "member_not_found"})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": failed})
+}
+
+func (d OrgDeps) audit(ctx context.Context, c *fiber.Ctx, userID int64, action string, orgID int64, meta map[string]any) error {
+	if d.AuditLogs == nil {
+		return nil
+	}
+	raw, _ := json.Marshal(meta)
+	resourceID := strconv.FormatInt(orgID, 10)
+	_, err := d.AuditLogs.Insert(ctx, &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   "organization",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+	return err
+}
@@ -0,0 +1,191 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgimport"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+)
+
+// OrgImportResponse is an import with the validation or invitation result
+// of each of its rows
+type OrgImportResponse struct {
+	Import *models.OrgImport     `json:"import"`
+	Rows   []models.OrgImportRow `json:"rows"`
+}
+
+// ImportInvitations uploads a CSV of people to invite to the caller's
+// organization, as a multipart file or a text/csv body. The file has a
+// header naming an email column and optional role and team columns. Rows
+// are validated at once and those that pass are invited in the background.
+func (d OrgDeps) ImportInvitations(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Imports == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	actor, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	var r io.Reader
+	filename := "import.csv"
+	if file, err := c.FormFile("file"); err == nil {
+		if file.Size > orgimport.MaxFileSize {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "file_too_large"})
+		}
+		f, err := file.Open()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_file"})
+		}
+		defer f.Close()
+		r, filename = f, file.Filename
+	} else if strings.HasPrefix(c.Get(fiber.HeaderContentType), "text/csv") {
+		if len(c.Body()) > orgimport.MaxFileSize {
+			return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{"error": "file_too_large"})
+		}
+		r = bytes.NewReader(c.Body())
+	} else {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "file_required"})
+	}
+	rows, err := orgimport.Parse(r, actor.Role)
+	switch {
+	case errors.Is(err, orgimport.ErrTooManyRows):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "too_many_rows", "message": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_file", "message": err.Error()})
+	}
+	ctx := context.Background()
+	var imp *models.OrgImport
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		imp, err = d.Imports.Create(ctx, &models.OrgImport{OrgID: actor.OrgID, CreatedBy: actor.UserID, Filename: filename}, rows)
+		if err != nil {
+			return err
+		}
+		return d.audit(ctx, c, actor.UserID, "org_invitations_imported", actor.OrgID, map[string]any{
+			"import_id": imp.ID,
+			"rows":      imp.Rows,
+			"invalid":   imp.Invalid,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(OrgImportResponse{Import: imp, Rows: rows})
+}
+
+// ListImports lists the member imports of the caller's organization
+func (d OrgDeps) ListImports(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Imports == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	actor, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	imports, err := d.Imports.List(context.Background(), actor.OrgID, 50)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if imports == nil {
+		imports = []models.OrgImport{}
+	}
+	return c.JSON(fiber.Map{"imports": imports})
+}
+
+// GetImport returns a member import with its rows; ?status= keeps the rows
+// with one status, such as failed
+func (d OrgDeps) GetImport(c *fiber.Ctx) error {
+	_, imp, handled, err := d.orgImport(c)
+	if handled || err != nil {
+		return err
+	}
+	status := c.Query("status")
+	switch models.OrgImportRowStatus(status) {
+	case "", models.OrgImportRowPending, models.OrgImportRowSending, models.OrgImportRowInvited,
+		models.OrgImportRowSkipped, models.OrgImportRowFailed, models.OrgImportRowInvalid:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_status"})
+	}
+	rows, err := d.Imports.Rows(context.Background(), imp.ID, status)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	if rows == nil {
+		rows = []models.OrgImportRow{}
+	}
+	return c.JSON(OrgImportResponse{Import: imp, Rows: rows})
+}
+
+// RetryImport invites the failed rows of a member import again. Rows whose
+// address has become a member or holds an open invitation since are
+// skipped, so an import can be retried as often as needed.
+func (d OrgDeps) RetryImport(c *fiber.Ctx) error {
+	actor, imp, handled, err := d.orgImport(c)
+	if handled || err != nil {
+		return err
+	}
+	ctx := context.Background()
+	var requeued int64
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		if requeued, err = d.Imports.Retry(ctx, imp.ID); err != nil || requeued == 0 {
+			return err
+		}
+		return d.audit(ctx, c, actor.UserID, "org_invitations_import_retried", actor.OrgID, map[string]any{
+			"import_id": imp.ID,
+			"rows":      requeued,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "retry_failed"})
+	}
+	if imp, err = d.Imports.Get(ctx, imp.ID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"import": imp, "requeued": requeued})
+}
+
+// orgImport loads the import named in the path for an admin of its
+// organization; handled is set when the response was already written
+func (d OrgDeps) orgImport(c *fiber.Ctx) (*models.OrgMember, *models.OrgImport, bool, error) {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return nil, nil, true, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Imports == nil {
+		return nil, nil, true, c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	actor, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return nil, nil, true, orgError(c, err, "org_lookup_failed")
+	}
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, nil, true, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_import_id"})
+	}
+	imp, err := d.Imports.Get(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && imp.OrgID != actor.OrgID) {
+		return nil, nil, true, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return nil, nil, true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return actor, imp, false, nil
+}
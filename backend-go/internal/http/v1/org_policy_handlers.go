@@ -0,0 +1,219 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgpolicy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+)
+
+// maxPolicyReasonLength bounds the reason members are shown for a disabled
+// capability
+const maxPolicyReasonLength = 500
+
+// policyViolationWindow is how far back the violation counts of the policy
+// list reach
+const policyViolationWindow = 30 * 24 * time.Hour
+
+// OrgCapability is a capability with whether the caller's organization
+// disabled it. Admins also see how many times members tried to use it in
+// the last 30 days while it was disabled.
+type OrgCapability struct {
+	Capability       orgpolicy.Capability `json:"capability"`
+	Description      string               `json:"description"`
+	Enabled          bool                 `json:"enabled"`
+	Policy           *models.OrgPolicy    `json:"policy,omitempty"`
+	RecentViolations *int64               `json:"recent_violations,omitempty"`
+}
+
+type OrgPolicyRequest struct {
+	// Reason is shown to members refused the capability
+	Reason string `json:"reason"`
+}
+
+// ListPolicies lists the capabilities organization admins may disable and
+// which of them the caller's organization disabled
+func (d OrgDeps) ListPolicies(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Policies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	member, err := d.member(owner, orgs.ActionInspect)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	ctx := context.Background()
+	policies, err := d.Policies.List(ctx, member.OrgID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	var counts map[string]int64
+	if orgs.Can(member.Role, orgs.ActionAdmin) {
+		if counts, err = d.Policies.ViolationCounts(ctx, member.OrgID, time.Now().Add(-policyViolationWindow)); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+		}
+	}
+	disabled := make(map[string]models.OrgPolicy, len(policies))
+	for _, p := range policies {
+		disabled[p.Capability] = p
+	}
+	out := make([]OrgCapability, 0, len(orgpolicy.Capabilities))
+	for capability, description := range orgpolicy.Capabilities {
+		item := OrgCapability{Capability: capability, Description: description, Enabled: true}
+		if p, ok := disabled[string(capability)]; ok {
+			item.Enabled, item.Policy = false, &p
+		}
+		if counts != nil {
+			n := counts[string(capability)]
+			item.RecentViolations = &n
+		}
+		out = append(out, item)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Capability < out[j].Capability })
+	return c.JSON(fiber.Map{"capabilities": out})
+}
+
+// DisableCapability disables a capability for every member of the caller's
+// organization, or updates the reason it is disabled for
+func (d OrgDeps) DisableCapability(c *fiber.Ctx) error {
+	member, capability, handled, err := d.orgCapability(c)
+	if handled || err != nil {
+		return err
+	}
+	var body OrgPolicyRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+		}
+	}
+	var reason *string
+	if r := strings.TrimSpace(body.Reason); r != "" {
+		if len(r) > maxPolicyReasonLength {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_reason", "max_length": maxPolicyReasonLength})
+		}
+		reason = &r
+	}
+	ctx := context.Background()
+	var p *models.OrgPolicy
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		p, err = d.Policies.Disable(ctx, &models.OrgPolicy{OrgID: member.OrgID, Capability: string(capability), Reason: reason, DisabledBy: member.UserID})
+		if err != nil {
+			return err
+		}
+		return d.audit(ctx, c, member.UserID, "org_capability_disabled", member.OrgID, map[string]any{
+			"capability": capability,
+			"reason":     reason,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(OrgCapability{Capability: capability, Description: orgpolicy.Capabilities[capability], Policy: p})
+}
+
+// EnableCapability allows a disabled capability again
+func (d OrgDeps) EnableCapability(c *fiber.Ctx) error {
+	member, capability, handled, err := d.orgCapability(c)
+	if handled || err != nil {
+		return err
+	}
+	err = d.Tx.WithTx(context.Background(), func(ctx context.Context) error {
+		if err := d.Policies.Enable(ctx, member.OrgID, string(capability)); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, member.UserID, "org_capability_enabled", member.OrgID, map[string]any{
+			"capability": capability,
+		})
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_disabled"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(OrgCapability{Capability: capability, Description: orgpolicy.Capabilities[capability], Enabled: true})
+}
+
+// ListPolicyViolations lists members' attempts to use disabled
+// capabilities, newest first; ?capability= keeps those of one
+func (d OrgDeps) ListPolicyViolations(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Policies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	member, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	capability := c.Query("capability")
+	if capability != "" && !orgpolicy.Valid(orgpolicy.Capability(capability)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "unknown_capability"})
+	}
+	limit := c.QueryInt("limit", 100)
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	violations, err := d.Policies.Violations(context.Background(), member.OrgID, capability, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if violations == nil {
+		violations = []models.OrgPolicyViolation{}
+	}
+	return c.JSON(fiber.Map{"violations": violations})
+}
+
+// orgCapability resolves the capability named in the path for an admin of
+// the caller's organization; handled is set when the response was already
+// written
+func (d OrgDeps) orgCapability(c *fiber.Ctx) (*models.OrgMember, orgpolicy.Capability, bool, error) {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return nil, "", true, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Policies == nil {
+		return nil, "", true, c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	member, err := d.member(owner, orgs.ActionAdmin)
+	if err != nil {
+		return nil, "", true, orgError(c, err, "org_lookup_failed")
+	}
+	capability := orgpolicy.Capability(c.Params("capability"))
+	if !orgpolicy.Valid(capability) {
+		return nil, "", true, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "unknown_capability"})
+	}
+	return member, capability, false, nil
+}
+
+// checkCapability refuses a request that uses a capability the caller's
+// organization disabled, recording the attempt for its admins; handled is
+// set when the response was already written
+func checkCapability(c *fiber.Ctx, policies *orgpolicy.Enforcer, userID int64, capability orgpolicy.Capability) (bool, error) {
+	if policies == nil {
+		return false, nil
+	}
+	err := policies.Check(context.Background(), userID, capability, c.Method()+" "+c.Path())
+	var disabled *orgpolicy.DisabledError
+	switch {
+	case errors.As(err, &disabled):
+		return true, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "capability_disabled", "capability": capability, "message": err.Error()})
+	case err != nil:
+		return true, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "policy_check_failed"})
+	}
+	return false, nil
+}
@@ -0,0 +1,118 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgsettings"
+	"github.com/gofiber/fiber/v2"
+)
+
+// orgSettingError maps errors from applying organization settings to a
+// response; it returns false for errors that are not about the request
+func orgSettingError(c *fiber.Ctx, err error) (bool, error) {
+	var override *orgsettings.OverrideError
+	if errors.As(err, &override) {
+		return true, c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":   "org_setting_mandatory",
+			"setting": override.Setting,
+			"message": override.Error(),
+		})
+	}
+	var invalid *orgsettings.InvalidError
+	if errors.As(err, &invalid) {
+		return true, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":   "invalid_setting",
+			"setting": invalid.Setting,
+			"message": invalid.Error(),
+		})
+	}
+	return false, nil
+}
+
+// Defaults returns the settings new jobs of the caller start with and which
+// of them the organization made mandatory
+func (d GenerationDeps) Defaults(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var settings *models.OrgSettings
+	if d.OrgSettings != nil {
+		var err error
+		if settings, err = d.OrgSettings.ForUser(context.Background(), owner); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+		}
+	}
+	job, _ := orgsettings.ApplyJob(settings, orgsettings.Settings{})
+	resp := fiber.Map{
+		"job":            job,
+		"retention_days": nil,
+		"export_formats": orgsettings.ExportFormats,
+		"mandatory":      []string{},
+	}
+	if settings != nil {
+		resp["retention_days"] = settings.RetentionDays
+		if len(settings.ExportFormats) > 0 && settings.IsMandatory(models.OrgSettingExportFormats) {
+			resp["export_formats"] = settings.ExportFormats
+		}
+		if settings.Mandatory != nil {
+			resp["mandatory"] = settings.Mandatory
+		}
+	}
+	return c.JSON(resp)
+}
+
+// GetOrgSettings returns the defaults of an organization
+func (a AdminDeps) GetOrgSettings(c *fiber.Ctx) error {
+	orgID := parseID(c.Params("id"))
+	if orgID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	s, err := a.OrgSettings.GetByOrgID(context.Background(), orgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(s)
+}
+
+// UpdateOrgSettings creates or replaces the defaults of an organization.
+// Settings named in mandatory apply to every member's new jobs and datasets
+// and cannot be overridden.
+func (a AdminDeps) UpdateOrgSettings(c *fiber.Ctx) error {
+	orgID := parseID(c.Params("id"))
+	if orgID <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_id"})
+	}
+	var body struct {
+		PrivacyLevel  *string  `json:"privacy_level"`
+		Provider      *string  `json:"provider"`
+		RetentionDays *int     `json:"retention_days"`
+		ExportFormats []string `json:"export_formats"`
+		Mandatory     []string `json:"mandatory"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	s := &models.OrgSettings{
+		OrgID:         orgID,
+		PrivacyLevel:  body.PrivacyLevel,
+		Provider:      body.Provider,
+		RetentionDays: body.RetentionDays,
+		ExportFormats: body.ExportFormats,
+		Mandatory:     body.Mandatory,
+	}
+	if err := orgsettings.Validate(s); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_settings", "message": err.Error()})
+	}
+	out, err := a.OrgSettings.Upsert(context.Background(), s)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(out)
+}
@@ -0,0 +1,235 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/gofiber/fiber/v2"
+)
+
+// defaultOutputAccessWindow applies when no access window is configured
+const defaultOutputAccessWindow = time.Hour
+
+func (d GenerationDeps) outputAccessWindow() time.Duration {
+	if d.OutputAccessWindow > 0 {
+		return d.OutputAccessWindow
+	}
+	return defaultOutputAccessWindow
+}
+
+// RequestOutputAccess asks for access to the key of an encrypted job output.
+// Access is granted at once for the configured window unless approval is
+// required, in which case the grant waits for an admin.
+func (d GenerationDeps) RequestOutputAccess(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.OutputKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	job, err := d.job(context.Background(), owner, id, orgs.ActionRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if job.Status != models.GenCompleted {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "not_ready"})
+	}
+	if _, err := d.OutputKeys.GetKey(context.Background(), id); errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "output_not_encrypted"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+		}
+	}
+	if active, err := d.OutputKeys.ActiveGrant(context.Background(), id, owner); err == nil {
+		return c.JSON(active)
+	}
+
+	grant := &models.OutputAccessGrant{JobID: id, UserID: owner, RequiresApproval: d.OutputAccessApproval, Status: models.OutputAccessRequested}
+	if body.Reason != "" {
+		grant.Reason = &body.Reason
+	}
+	if !grant.RequiresApproval {
+		expires := time.Now().Add(d.outputAccessWindow())
+		grant.Status, grant.ExpiresAt = models.OutputAccessApproved, &expires
+	}
+	out, err := d.OutputKeys.CreateGrant(context.Background(), grant)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	_ = d.auditOutputAccess(c, owner, "output_access_requested", out, nil)
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
+
+// ListOutputAccess lists the caller's access grants for a job
+func (d GenerationDeps) ListOutputAccess(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.OutputKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	grants, err := d.OutputKeys.ListGrants(context.Background(), id, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(grants)
+}
+
+// ReleaseOutputKey hands out the data key of a job's output under an active
+// grant. Every release is written to the audit log first; a key is never
+// released without an audit record.
+func (d GenerationDeps) ReleaseOutputKey(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.OutputKeys == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	grantID, _ := strconv.ParseInt(c.Params("grantId"), 10, 64)
+	grant, err := d.OutputKeys.GetGrant(context.Background(), grantID)
+	if err != nil || grant.JobID != id || grant.UserID != owner {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "grant_not_found"})
+	}
+	if !grant.Active(time.Now()) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "access_not_active", "status": grant.Status})
+	}
+	key, err := d.OutputKeys.GetKey(context.Background(), id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "key_not_found"})
+	}
+	plain, err := d.Envelope.Unwrap(key.MasterKeyID, key.WrappedKey)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "key_unavailable"})
+	}
+	if err := d.auditOutputAccess(c, owner, "output_key_released", grant, map[string]any{"master_key_id": key.MasterKeyID}); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "audit_failed"})
+	}
+	grant, err = d.OutputKeys.RecordRelease(context.Background(), grantID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "access_not_active"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "release_failed"})
+	}
+	return c.JSON(fiber.Map{
+		"job_id":     id,
+		"algorithm":  key.Algorithm,
+		"key":        base64.StdEncoding.EncodeToString(plain),
+		"expires_at": grant.ExpiresAt,
+	})
+}
+
+// ListPendingOutputAccess lists grants by status (default: awaiting approval)
+func (d GenerationDeps) ListPendingOutputAccess(c *fiber.Ctx) error {
+	if d.OutputKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	status := models.OutputAccessStatus(c.Query("status", string(models.OutputAccessRequested)))
+	grants, err := d.OutputKeys.ListByStatus(context.Background(), status, 200)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(grants)
+}
+
+// DecideOutputAccess approves or denies a grant awaiting approval. Approved
+// grants expire after window_minutes, or the configured window.
+func (d GenerationDeps) DecideOutputAccess(c *fiber.Ctx) error {
+	admin, _ := c.Locals("user_id").(int64)
+	if d.OutputKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	var body struct {
+		Approve       bool `json:"approve"`
+		WindowMinutes int  `json:"window_minutes"`
+	}
+	if err := c.BodyParser(&body); err != nil || body.WindowMinutes < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	status := models.OutputAccessDenied
+	var expires *time.Time
+	if body.Approve {
+		window := d.outputAccessWindow()
+		if body.WindowMinutes > 0 {
+			window = time.Duration(body.WindowMinutes) * time.Minute
+		}
+		at := time.Now().Add(window)
+		status, expires = models.OutputAccessApproved, &at
+	}
+	grant, err := d.OutputKeys.Decide(context.Background(), parseID(c.Params("id")), admin, status, expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_pending"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditOutputAccess(c, admin, "output_access_"+string(status), grant, nil)
+	return c.JSON(grant)
+}
+
+// RevokeOutputAccess ends a grant before it expires
+func (d GenerationDeps) RevokeOutputAccess(c *fiber.Ctx) error {
+	admin, _ := c.Locals("user_id").(int64)
+	if d.OutputKeys == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	grant, err := d.OutputKeys.Revoke(context.Background(), parseID(c.Params("id")), admin)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditOutputAccess(c, admin, "output_access_revoked", grant, nil)
+	return c.JSON(grant)
+}
+
+func (d GenerationDeps) auditOutputAccess(c *fiber.Ctx, userID int64, action string, grant *models.OutputAccessGrant, extra map[string]any) error {
+	if d.AuditLogs == nil {
+		return nil
+	}
+	meta := map[string]any{
+		"grant_id":   grant.ID,
+		"grantee_id": grant.UserID,
+		"status":     grant.Status,
+	}
+	if grant.ExpiresAt != nil {
+		meta["expires_at"] = grant.ExpiresAt
+	}
+	for k, v := range extra {
+		meta[k] = v
+	}
+	raw, _ := json.Marshal(meta)
+	resourceID := strconv.FormatInt(grant.JobID, 10)
+	_, err := d.AuditLogs.Insert(context.Background(), &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   "generation_job",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+	return err
+}
@@ -0,0 +1,262 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/buckets"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+)
+
+// OutputBucketRequest registers the bucket an organization's outputs are
+// delivered to: an S3 bucket with its region and the role the platform
+// assumes, or a GCS bucket with the service account it impersonates
+type OutputBucketRequest struct {
+	Provider       string  `json:"provider"`
+	Bucket         string  `json:"bucket"`
+	Region         *string `json:"region"`
+	Prefix         string  `json:"prefix"`
+	RoleARN        *string `json:"role_arn"`
+	ServiceAccount *string `json:"service_account"`
+}
+
+// GetOutputBucket returns the bucket the caller's organization has outputs
+// delivered to, and what to grant the platform to set one up
+func (d OrgDeps) GetOutputBucket(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	member, err := d.member(owner, orgs.ActionManage)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	b, err := d.OutputBuckets.Get(context.Background(), member.OrgID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(d.outputBucketState(b, nil))
+}
+
+// SetOutputBucket registers or replaces the bucket of the caller's
+// organization. Its permissions are checked at once; a bucket that fails
+// is saved unverified, with the checks that failed, and jobs cannot start
+// until it is verified.
+func (d OrgDeps) SetOutputBucket(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body OutputBucketRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	member, err := d.member(owner, orgs.ActionManage)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	b := &models.OutputBucket{
+		OrgID:          member.OrgID,
+		Provider:       strings.ToLower(strings.TrimSpace(body.Provider)),
+		Bucket:         strings.TrimSpace(body.Bucket),
+		Region:         trimmed(body.Region),
+		Prefix:         strings.TrimSpace(body.Prefix),
+		RoleARN:        trimmed(body.RoleARN),
+		ServiceAccount: trimmed(body.ServiceAccount),
+		UpdatedBy:      &owner,
+	}
+	if err := buckets.Validate(b); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_bucket", "message": err.Error()})
+	}
+	ctx := context.Background()
+	// The external ID stays the one the organization was first given
+	existing, err := d.OutputBuckets.Get(ctx, member.OrgID)
+	switch {
+	case err == nil:
+		b.ExternalID = existing.ExternalID
+	case errors.Is(err, sql.ErrNoRows):
+		if b.ExternalID, err = buckets.NewExternalID(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+		}
+	default:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+
+	checks := d.checkOutputBucket(ctx, b)
+	passed, reason := buckets.Passed(checks)
+	b.Status, b.LastError = models.OutputBucketActive, nil
+	if !passed {
+		b.Status, b.LastError = models.OutputBucketUnverified, &reason
+	}
+	var saved *models.OutputBucket
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		if saved, err = d.OutputBuckets.Upsert(ctx, b); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, owner, "org_output_bucket_updated", member.OrgID, map[string]any{
+			"provider": saved.Provider,
+			"bucket":   saved.Bucket,
+			"prefix":   saved.Prefix,
+			"verified": passed,
+		})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	state := d.outputBucketState(saved, checks)
+	if !passed {
+		state["error"] = "bucket_permission_check_failed"
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(state)
+	}
+	return c.JSON(state)
+}
+
+// VerifyOutputBucket checks the permissions of the registered bucket again,
+// such as after its role or grants were fixed
+func (d OrgDeps) VerifyOutputBucket(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	member, err := d.member(owner, orgs.ActionManage)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	ctx := context.Background()
+	b, err := d.OutputBuckets.Get(ctx, member.OrgID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "bucket_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "verify_failed"})
+	}
+	checks := d.checkOutputBucket(ctx, b)
+	passed, reason := buckets.Passed(checks)
+	status, lastError := models.OutputBucketActive, (*string)(nil)
+	if !passed {
+		// A bucket that never passed stays unverified; one that did is
+		// failing until it passes again
+		status, lastError = models.OutputBucketFailing, &reason
+		if b.Status == models.OutputBucketUnverified {
+			status = models.OutputBucketUnverified
+		}
+	}
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := d.OutputBuckets.RecordCheck(ctx, member.OrgID, status, lastError); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, owner, "org_output_bucket_verified", member.OrgID, map[string]any{"bucket": b.Bucket, "verified": passed})
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "verify_failed"})
+	}
+	b.Status, b.LastError = status, lastError
+	state := d.outputBucketState(b, checks)
+	if !passed {
+		state["error"] = "bucket_permission_check_failed"
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(state)
+	}
+	return c.JSON(state)
+}
+
+// DeleteOutputBucket removes the bucket of the caller's organization; new
+// outputs go to platform storage again. Outputs already delivered stay in
+// the bucket and can no longer be fetched through the platform.
+func (d OrgDeps) DeleteOutputBucket(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	member, err := d.member(owner, orgs.ActionManage)
+	if err != nil {
+		return orgError(c, err, "org_lookup_failed")
+	}
+	ctx := context.Background()
+	err = d.Tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := d.OutputBuckets.Delete(ctx, member.OrgID); err != nil {
+			return err
+		}
+		return d.audit(ctx, c, owner, "org_output_bucket_deleted", member.OrgID, nil)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "bucket_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// checkOutputBucket connects to a bucket and checks the platform can
+// write, read and delete under its prefix
+func (d OrgDeps) checkOutputBucket(ctx context.Context, b *models.OutputBucket) []buckets.Check {
+	ctx, cancel := context.WithTimeout(ctx, buckets.CheckTimeout)
+	defer cancel()
+	if d.Buckets == nil {
+		return []buckets.Check{{Permission: "connect", Error: "bucket delivery is not configured"}}
+	}
+	s, err := d.Buckets.Open(ctx, b)
+	if err != nil {
+		return []buckets.Check{{Permission: "connect", Error: err.Error()}}
+	}
+	return buckets.CheckPermissions(ctx, s, b.Prefix)
+}
+
+func (d OrgDeps) outputBucketState(b *models.OutputBucket, checks []buckets.Check) fiber.Map {
+	state := fiber.Map{"output_bucket": b}
+	if checks != nil {
+		state["checks"] = checks
+	}
+	if d.Buckets != nil && len(d.Buckets.Principals) > 0 {
+		state["platform_principals"] = d.Buckets.Principals
+	}
+	return state
+}
+
+// outputBucketReady checks that the outputs of a user's jobs have
+// somewhere to go: platform storage, or an organization bucket that has
+// been verified
+func (d GenerationDeps) outputBucketReady(owner int64) error {
+	if d.OutputBuckets == nil {
+		return nil
+	}
+	b, err := d.OutputBuckets.Buckets.ForUser(context.Background(), owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if b.Status == models.OutputBucketUnverified {
+		return buckets.ErrUnverified
+	}
+	return nil
+}
+
+// outputStorage returns where a job's stored objects are read from: the
+// organization bucket they were delivered to, or platform storage
+func (d GenerationDeps) outputStorage(job *models.GenerationJob) (storage.SignedURLProvider, error) {
+	if job.QualityDetails == nil || job.QualityDetails.Delivery == nil {
+		return d.StorageClient, nil
+	}
+	if d.OutputBuckets == nil {
+		return nil, buckets.ErrBucketChanged
+	}
+	return d.OutputBuckets.Reopen(context.Background(), job.QualityDetails.Delivery)
+}
+
+// outputStorageError answers a request for objects in a bucket that cannot
+// be reached
+func outputStorageError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, buckets.ErrBucketChanged) {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "output_bucket_removed"})
+	}
+	return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "output_bucket_unavailable"})
+}
@@ -1,18 +1,54 @@
 package v1
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"io"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/payments"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pricing"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
 	"github.com/gofiber/fiber/v2"
 )
 
 type PaymentDeps struct {
-	StripeWebhookSecret string
-	PaddlePublicKey     string
+	// Stripe sells subscriptions through hosted checkout and verifies the
+	// webhooks that report on them
+	Stripe *payments.StripeClient
+	// Paddle sells them through Paddle Billing transactions, the same way
+	Paddle *payments.PaddleClient
+	Users  *repo.UserRepo
+	// Subscriptions keeps every subscription change as a new record
+	Subscriptions *repo.UserSubscriptionRepo
+	// Webhooks announces subscription changes to the user's endpoints
+	Webhooks *webhooks.Dispatcher
+	// PortalReturnURL is where the billing portal sends customers back to
+	// when they do not ask for a page; ReturnOrigins are the origins a
+	// requested return URL may point at
+	PortalReturnURL string
+	ReturnOrigins   []string
+	AuditLogs       *repo.AuditLogRepo
+}
+
+type CheckoutRequest struct {
+	Tier string `json:"tier"`
+	// Provider is stripe or paddle; empty picks Stripe when it is
+	// configured
+	Provider string `json:"provider"`
+}
+
+type PortalRequest struct {
+	ReturnURL string `json:"return_url"`
+	// Provider is stripe or paddle; empty picks the provider of the current
+	// subscription, then whichever the user is a customer of
+	Provider string `json:"provider"`
 }
 
 func (d PaymentDeps) Plans(c *fiber.Ctx) error {
@@ -43,133 +79,466 @@ func (d PaymentDeps) Regions(c *fiber.Ctx) error {
 	})
 }
 
+// Checkout starts a Stripe or Paddle checkout for a subscription plan and
+// returns the hosted page to send the user to. The subscription itself is
+// recorded when the provider reports it through its webhook.
 func (d PaymentDeps) Checkout(c *fiber.Ctx) error {
-	// Placeholder: return a fake URL
-	return c.JSON(fiber.Map{"checkout_url": "/billing", "provider": "paddle"})
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body CheckoutRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	provider := payments.PaymentProvider(strings.ToLower(strings.TrimSpace(body.Provider)))
+	if provider == "" {
+		provider = payments.ProviderStripe
+		if !d.Stripe.Configured() && d.Paddle.Configured() {
+			provider = payments.ProviderPaddle
+		}
+	}
+	if provider != payments.ProviderStripe && provider != payments.ProviderPaddle {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_provider"})
+	}
+	if d.Users == nil || (provider == payments.ProviderStripe && !d.Stripe.Configured()) ||
+		(provider == payments.ProviderPaddle && !d.Paddle.Configured()) {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	tier := strings.ToLower(strings.TrimSpace(body.Tier))
+	if provider == payments.ProviderPaddle {
+		if _, ok := d.Paddle.PriceID(payments.PricingTier(tier)); !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_plan"})
+		}
+	} else if _, ok := d.Stripe.PriceID(tier); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_plan"})
+	}
+	user, err := d.Users.GetByID(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user_not_found"})
+	}
+	if provider == payments.ProviderPaddle {
+		return d.paddleCheckout(c, user, payments.PricingTier(tier))
+	}
+	customerID, err := d.stripeCustomer(user)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "checkout_failed"})
+	}
+	session, err := d.Stripe.CreateCheckoutSession(context.Background(), payments.CheckoutParams{
+		UserID:     strconv.FormatInt(owner, 10),
+		CustomerID: customerID,
+		Tier:       tier,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "checkout_failed"})
+	}
+	return c.JSON(fiber.Map{"checkout_url": session.URL, "session_id": session.ID, "provider": payments.ProviderStripe})
+}
+
+// paddleCheckout opens a Paddle transaction for a tier. The transaction ID
+// is returned too, for clients that open checkout with Paddle.js.
+func (d PaymentDeps) paddleCheckout(c *fiber.Ctx, user *models.User, tier payments.PricingTier) error {
+	customerID, err := d.paddleCustomer(user)
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "checkout_failed"})
+	}
+	txn, err := d.Paddle.CreateTransaction(context.Background(), payments.TransactionParams{
+		UserID:     strconv.FormatInt(user.ID, 10),
+		CustomerID: customerID,
+		Tier:       tier,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "checkout_failed"})
+	}
+	return c.JSON(fiber.Map{"checkout_url": txn.CheckoutURL(), "transaction_id": txn.ID, "provider": payments.ProviderPaddle})
+}
+
+// paddleCustomer returns the Paddle customer of a user, creating it on
+// first checkout
+func (d PaymentDeps) paddleCustomer(user *models.User) (string, error) {
+	existing, err := d.Users.PaddleCustomerID(context.Background(), user.ID)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil && *existing != "" {
+		return *existing, nil
+	}
+	params := payments.CustomerParams{UserID: strconv.FormatInt(user.ID, 10), Email: user.Email}
+	if user.FullName != nil {
+		params.Name = *user.FullName
+	}
+	customerID, err := d.Paddle.CreateCustomer(context.Background(), params)
+	if err != nil {
+		return "", err
+	}
+	return customerID, d.Users.SetPaddleCustomerID(context.Background(), user.ID, customerID)
 }
 
+// stripeCustomer returns the Stripe customer of a user, creating it on
+// first checkout
+func (d PaymentDeps) stripeCustomer(user *models.User) (string, error) {
+	existing, err := d.Users.StripeCustomerID(context.Background(), user.ID)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil && *existing != "" {
+		return *existing, nil
+	}
+	params := payments.CustomerParams{UserID: strconv.FormatInt(user.ID, 10), Email: user.Email}
+	if user.FullName != nil {
+		params.Name = *user.FullName
+	}
+	customerID, err := d.Stripe.CreateCustomer(context.Background(), params)
+	if err != nil {
+		return "", err
+	}
+	return customerID, d.Users.SetStripeCustomerID(context.Background(), user.ID, customerID)
+}
+
+// Subscription returns the caller's current subscription; users who never
+// subscribed are on the free plan
 func (d PaymentDeps) Subscription(c *fiber.Ctx) error {
 	plans := pricing.SubscriptionPlans()
-	return c.JSON(fiber.Map{"tier": plans[0].ID, "status": "active", "monthly_limit": plans[0].MonthlyLimit})
+	free := fiber.Map{"tier": plans[0].ID, "status": "active", "monthly_limit": plans[0].MonthlyLimit}
+	if d.Subscriptions == nil {
+		return c.JSON(free)
+	}
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	sub, err := d.Subscriptions.GetByUserID(context.Background(), owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(free)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	limit := plans[0].MonthlyLimit
+	for _, p := range plans {
+		if p.ID == string(sub.SubscriptionTier) {
+			limit = p.MonthlyLimit
+		}
+	}
+	return c.JSON(fiber.Map{
+		"tier":                 sub.SubscriptionTier,
+		"status":               sub.Status,
+		"monthly_limit":        limit,
+		"provider":             sub.Provider,
+		"current_period_end":   sub.CurrentPeriodEnd,
+		"cancel_at_period_end": sub.CancelAtPeriodEnd,
+	})
+}
+
+// BillingPortal opens the provider's hosted billing portal, where customers
+// update payment methods, read invoices and manage their subscription. Only
+// users the provider knows as a customer, from a checkout, have a portal.
+func (d PaymentDeps) BillingPortal(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	var body PortalRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+		}
+	}
+	returnURL := strings.TrimSpace(body.ReturnURL)
+	if returnURL == "" {
+		returnURL = d.PortalReturnURL
+	}
+	if err := payments.ValidateReturnURL(returnURL, d.ReturnOrigins); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_return_url"})
+	}
+	provider := payments.PaymentProvider(strings.ToLower(strings.TrimSpace(body.Provider)))
+	if provider != "" && provider != payments.ProviderStripe && provider != payments.ProviderPaddle {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_provider"})
+	}
+	if d.Users == nil || (!d.Stripe.Configured() && !d.Paddle.Configured()) {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	ctx := context.Background()
+	var sub *models.UserSubscription
+	if d.Subscriptions != nil {
+		current, err := d.Subscriptions.GetByUserID(ctx, owner)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "portal_failed"})
+		}
+		if err == nil {
+			sub = current
+		}
+	}
+	candidates := []payments.PaymentProvider{payments.ProviderStripe, payments.ProviderPaddle}
+	switch {
+	case provider != "":
+		candidates = []payments.PaymentProvider{provider}
+	case sub != nil && sub.Provider == string(payments.ProviderPaddle):
+		candidates = []payments.PaymentProvider{payments.ProviderPaddle, payments.ProviderStripe}
+	}
+	for _, p := range candidates {
+		customerID, err := d.portalCustomer(ctx, owner, p)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "portal_failed"})
+		}
+		if customerID == "" {
+			continue
+		}
+		var session *payments.PortalSession
+		meta := map[string]any{"provider": p}
+		if p == payments.ProviderPaddle {
+			var subscriptionIDs []string
+			if sub != nil && sub.Provider == string(payments.ProviderPaddle) && sub.ProviderID != "" {
+				subscriptionIDs = []string{sub.ProviderID}
+			}
+			session, err = d.Paddle.CreatePortalSession(ctx, customerID, subscriptionIDs)
+		} else {
+			session, err = d.Stripe.CreatePortalSession(ctx, customerID, returnURL)
+			meta["return_url"] = returnURL
+		}
+		if err != nil {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "portal_failed"})
+		}
+		d.audit(ctx, c, owner, "billing_portal_opened", "billing_portal", session.ID, meta)
+		return c.JSON(fiber.Map{"portal_url": session.URL, "session_id": session.ID, "provider": p})
+	}
+	return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "no_billing_account"})
+}
+
+// portalCustomer returns the user's customer at a provider, or "" when the
+// provider is not configured or they never checked out through it
+func (d PaymentDeps) portalCustomer(ctx context.Context, userID int64, provider payments.PaymentProvider) (string, error) {
+	var id *string
+	var err error
+	switch {
+	case provider == payments.ProviderStripe && d.Stripe.Configured():
+		id, err = d.Users.StripeCustomerID(ctx, userID)
+	case provider == payments.ProviderPaddle && d.Paddle.Configured():
+		id, err = d.Users.PaddleCustomerID(ctx, userID)
+	}
+	if err != nil || id == nil {
+		return "", err
+	}
+	return *id, nil
+}
+
+func (d PaymentDeps) audit(ctx context.Context, c *fiber.Ctx, userID int64, action, resource, resourceID string, meta map[string]any) {
+	if d.AuditLogs == nil {
+		return
+	}
+	raw, _ := json.Marshal(meta)
+	_, _ = d.AuditLogs.Insert(ctx, &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   resource,
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
 }
 
 func (d PaymentDeps) ContactSales(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "We will contact you within 24 hours."})
 }
 
-// StripeWebhook handles Stripe webhook events
+// StripeWebhook handles Stripe webhook events. Events are verified against
+// the webhook secret; failures to record one answer 500 so Stripe retries.
 func (d PaymentDeps) StripeWebhook(c *fiber.Ctx) error {
-	// Verify webhook signature
-	signature := c.Get("Stripe-Signature")
-	if signature == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "missing_signature"})
-	}
-
-	body := c.Body()
-	
-	// Verify signature if webhook secret is configured
-	if d.StripeWebhookSecret != "" {
-		if !verifyStripeSignature(body, signature, d.StripeWebhookSecret) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_signature"})
-		}
-	}
-
-	// Parse webhook event
-	var event map[string]interface{}
-	if err := c.BodyParser(&event); err != nil {
+	event, err := d.Stripe.VerifyWebhook(c.Body(), c.Get("Stripe-Signature"), time.Now())
+	switch {
+	case errors.Is(err, payments.ErrStripeNotConfigured):
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	case errors.Is(err, payments.ErrInvalidSignature), errors.Is(err, payments.ErrSignatureExpired):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_signature"})
+	case err != nil:
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_payload"})
 	}
 
-	// Handle different event types
-	eventType, _ := event["type"].(string)
-	switch eventType {
-	case "checkout.session.completed":
-		// Handle successful checkout
-		// TODO: Update user subscription in database
-	case "customer.subscription.updated":
-		// Handle subscription update
-		// TODO: Update user subscription status
-	case "customer.subscription.deleted":
-		// Handle subscription cancellation
-		// TODO: Downgrade user to free tier
-	case "invoice.payment_succeeded":
-		// Handle successful payment
-		// TODO: Record payment in database
-	case "invoice.payment_failed":
-		// Handle failed payment
-		// TODO: Notify user and potentially suspend subscription
+	switch event.Type {
+	case payments.StripeCheckoutCompleted:
+		err = d.checkoutCompleted(event)
+	case payments.StripeSubscriptionCreated, payments.StripeSubscriptionUpdated, payments.StripeSubscriptionDeleted:
+		err = d.syncSubscription(event)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "processing_failed"})
 	}
-
 	return c.JSON(fiber.Map{"received": true})
 }
 
-// PaddleWebhook handles Paddle webhook events
-func (d PaymentDeps) PaddleWebhook(c *fiber.Ctx) error {
-	// Verify webhook signature
-	signature := c.Get("P-Signature")
-	if signature == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "missing_signature"})
+// checkoutCompleted links the user to the Stripe customer checkout created,
+// so later events without user metadata can be matched to them
+func (d PaymentDeps) checkoutCompleted(event *payments.StripeEvent) error {
+	var session payments.StripeCheckout
+	if err := payments.ParseStripeObject(event, &session); err != nil {
+		return err
 	}
+	userID, _ := strconv.ParseInt(session.ClientReferenceID, 10, 64)
+	if userID == 0 || session.Customer == "" || d.Users == nil {
+		return nil
+	}
+	return d.Users.SetStripeCustomerID(context.Background(), userID, session.Customer)
+}
 
-	body := c.Body()
+// syncSubscription records a created, updated or deleted Stripe
+// subscription and moves the user to its tier
+func (d PaymentDeps) syncSubscription(event *payments.StripeEvent) error {
+	if d.Subscriptions == nil || d.Users == nil {
+		return nil
+	}
+	var sub payments.StripeSubscription
+	if err := payments.ParseStripeObject(event, &sub); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	userID := sub.UserID()
+	if userID == 0 && sub.Customer != "" {
+		id, err := d.Users.GetIDByStripeCustomer(ctx, sub.Customer)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		userID = id
+	}
+	if userID == 0 {
+		return nil
+	}
+	rec, err := d.Stripe.Record(userID, sub)
+	if errors.Is(err, payments.ErrUnknownPrice) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if event.Type == payments.StripeSubscriptionDeleted {
+		rec.Status = models.SubStatusCancelled
+	}
+	return d.applySubscription(ctx, rec, strings.TrimPrefix(event.Type, "customer.subscription."))
+}
 
-	// Verify signature if public key is configured
-	if d.PaddlePublicKey != "" {
-		if !verifyPaddleSignature(body, signature, d.PaddlePublicKey) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_signature"})
+// applySubscription records a subscription reported by a provider and moves
+// the user to its tier. Past-due subscriptions keep their tier while the
+// provider retries payment; ended ones fall back to free. Reports that
+// change nothing, or arrive after the subscription was cancelled, are
+// ignored, since providers retry and do not order them.
+func (d PaymentDeps) applySubscription(ctx context.Context, rec *models.UserSubscription, change string) error {
+	prev, err := d.Subscriptions.GetByUserID(ctx, rec.UserID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && prev.ProviderID == rec.ProviderID {
+		if prev.Status == models.SubStatusCancelled || sameSubscription(prev, rec) {
+			return nil
 		}
 	}
+	if _, err := d.Subscriptions.Insert(ctx, rec); err != nil {
+		return err
+	}
+	tier := models.TierFree
+	switch rec.Status {
+	case models.SubStatusActive, models.SubStatusTrial, models.SubStatusPastDue:
+		tier = rec.SubscriptionTier
+	}
+	if err := d.Users.UpdateSubscriptionTier(ctx, rec.UserID, tier); err != nil {
+		return err
+	}
+	_ = d.Webhooks.Publish(ctx, rec.UserID, webhooks.EventSubscriptionChanged, map[string]interface{}{
+		"provider":             rec.Provider,
+		"change":               change,
+		"subscription_id":      rec.ProviderID,
+		"tier":                 rec.SubscriptionTier,
+		"status":               rec.Status,
+		"cancel_at_period_end": rec.CancelAtPeriodEnd,
+	})
+	return nil
+}
+
+// sameSubscription reports whether a record would repeat the previous one
+func sameSubscription(prev, next *models.UserSubscription) bool {
+	return prev.SubscriptionTier == next.SubscriptionTier &&
+		prev.Status == next.Status &&
+		prev.CancelAtPeriodEnd == next.CancelAtPeriodEnd &&
+		prev.CurrentPeriodEnd.Equal(next.CurrentPeriodEnd) &&
+		prev.MonthlyAmount == next.MonthlyAmount
+}
 
-	// Parse webhook event
-	var event map[string]interface{}
-	if err := c.BodyParser(&event); err != nil {
+// PaddleWebhook handles Paddle Billing webhook events. Events are verified
+// against the notification destination's secret key; failures to record one
+// answer 500 so Paddle retries.
+func (d PaymentDeps) PaddleWebhook(c *fiber.Ctx) error {
+	event, err := d.Paddle.VerifyWebhook(c.Body(), c.Get("Paddle-Signature"), time.Now())
+	switch {
+	case errors.Is(err, payments.ErrPaddleNotConfigured):
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	case errors.Is(err, payments.ErrInvalidPaddleSignature), errors.Is(err, payments.ErrPaddleSignatureExpired):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid_signature"})
+	case err != nil:
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_payload"})
 	}
 
-	// Handle different alert types
-	alertName, _ := event["alert_name"].(string)
-	switch alertName {
-	case "subscription_created":
-		// Handle new subscription
-		// TODO: Upgrade user subscription
-	case "subscription_updated":
-		// Handle subscription update
-		// TODO: Update user subscription details
-	case "subscription_cancelled":
-		// Handle subscription cancellation
-		// TODO: Schedule downgrade to free tier
-	case "subscription_payment_succeeded":
-		// Handle successful payment
-		// TODO: Record payment and extend subscription
-	case "subscription_payment_failed":
-		// Handle failed payment
-		// TODO: Notify user and mark subscription as past due
+	switch event.EventType {
+	case payments.PaddleTransactionCompleted:
+		err = d.transactionCompleted(event)
+	case payments.PaddleSubscriptionCreated, payments.PaddleSubscriptionUpdated, payments.PaddleSubscriptionCanceled,
+		payments.PaddleSubscriptionPastDue, payments.PaddleSubscriptionPaused, payments.PaddleSubscriptionResumed:
+		err = d.syncPaddleSubscription(event)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "processing_failed"})
 	}
-
 	return c.JSON(fiber.Map{"received": true})
 }
 
-// verifyStripeSignature verifies the Stripe webhook signature
-func verifyStripeSignature(body []byte, signature, secret string) bool {
-	// In a real implementation, this would properly parse and verify the Stripe signature
-	// For now, return true if secret is provided
-	if secret == "" {
-		return false
+// transactionCompleted links the user to the Paddle customer that paid, so
+// later events without custom data can be matched to them
+func (d PaymentDeps) transactionCompleted(event *payments.PaddleEvent) error {
+	var txn payments.PaddleTransaction
+	if err := payments.ParsePaddleObject(event, &txn); err != nil {
+		return err
+	}
+	userID := txn.UserID()
+	if userID == 0 || txn.CustomerID == "" || d.Users == nil {
+		return nil
 	}
-	
-	mac := hmac.New(sha256.New, []byte(secret))
-	mac.Write(body)
-	expectedMAC := hex.EncodeToString(mac.Sum(nil))
-	
-	// Simple verification - in production, parse the timestamp and signatures properly
-	return len(signature) > 0 && len(expectedMAC) > 0
+	return d.Users.SetPaddleCustomerID(context.Background(), userID, txn.CustomerID)
 }
 
-// verifyPaddleSignature verifies the Paddle webhook signature
-func verifyPaddleSignature(body []byte, signature, publicKey string) bool {
-	// In a real implementation, this would use RSA verification with the public key
-	// For now, return true if public key is provided
-	return publicKey != "" && signature != ""
+// syncPaddleSubscription records a Paddle subscription event and moves the
+// user to its tier
+func (d PaymentDeps) syncPaddleSubscription(event *payments.PaddleEvent) error {
+	if d.Subscriptions == nil || d.Users == nil {
+		return nil
+	}
+	var sub payments.PaddleSubscription
+	if err := payments.ParsePaddleObject(event, &sub); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	userID := sub.UserID()
+	if userID == 0 && sub.CustomerID != "" {
+		id, err := d.Users.GetIDByPaddleCustomer(ctx, sub.CustomerID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		userID = id
+	}
+	if userID == 0 {
+		return nil
+	}
+	rec, err := d.Paddle.Record(userID, sub)
+	if errors.Is(err, payments.ErrUnknownPaddlePrice) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return d.applySubscription(ctx, rec, strings.TrimPrefix(event.EventType, "subscription."))
 }
 
 // Generic webhook handler for testing
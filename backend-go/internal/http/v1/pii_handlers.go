@@ -0,0 +1,140 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pii"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errPIIUnavailable = errors.New("dataset rows are not readable for a PII scan")
+
+// scanPII classifies the columns of a dataset's rows and stores the result.
+// A failing NER provider leaves the pattern results stored and is returned
+// as an error matching pii.ErrRecognizer.
+func (d DatasetDeps) scanPII(ctx context.Context, ds *models.Dataset, columns []string, rows []map[string]interface{}) ([]models.DatasetPII, error) {
+	found, scanErr := d.PIIScanner.Scan(ctx, columns, rows)
+	if scanErr != nil && !errors.Is(scanErr, pii.ErrRecognizer) {
+		return nil, scanErr
+	}
+	out, err := d.PII.Replace(ctx, ds.ID, found)
+	if err != nil {
+		return nil, err
+	}
+	return out, scanErr
+}
+
+// scanStoredPII scans the leading rows of a stored dataset
+func (d DatasetDeps) scanStoredPII(ctx context.Context, ds *models.Dataset) ([]models.DatasetPII, error) {
+	reader, ok := d.StorageClient.(storage.ObjectReader)
+	if !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" || (ds.FileType != "csv" && ds.FileType != "json") {
+		return nil, errPIIUnavailable
+	}
+	columns, rows, err := readPreview(ctx, reader, *ds.ObjectKey, ds.FileType, profileRows)
+	if err != nil {
+		return nil, err
+	}
+	return d.scanPII(ctx, ds, columns, rows)
+}
+
+// GetPII returns the PII classification of a dataset's columns. Hidden
+// columns are left out.
+func (d DatasetDeps) GetPII(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.PII == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.accessibleDataset(owner, id, models.DatasetPermRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	acl, err := d.columnACL(owner, ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+	}
+	list, err := d.PII.List(context.Background(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(fiber.Map{"dataset_id": id, "columns": visiblePII(list, acl.Hidden())})
+}
+
+// ScanPII scans a dataset again, for datasets ingested before the scanner
+// or after its patterns change, and replaces the stored classification
+func (d DatasetDeps) ScanPII(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.PII == nil || d.PIIScanner == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	out, err := d.scanStoredPII(context.Background(), ds)
+	res := fiber.Map{"dataset_id": id, "columns": out}
+	switch {
+	case errors.Is(err, errPIIUnavailable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "dataset_not_readable"})
+	case errors.Is(err, pii.ErrRecognizer):
+		res["ner"] = "unavailable"
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "scan_failed"})
+	}
+	_ = d.auditAccess(c, owner, "dataset_pii_scanned", "dataset", id, map[string]any{
+		"columns": pii.Columns(out),
+	})
+	return c.JSON(res)
+}
+
+// visiblePII leaves hidden columns out of a classification
+func visiblePII(list []models.DatasetPII, hidden []string) []models.DatasetPII {
+	out := []models.DatasetPII{}
+	for _, p := range list {
+		if !containsFold(hidden, p.ColumnName) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// piiColumns names the columns the scan of a dataset classified as PII;
+// none without a store
+func piiColumns(store *repo.DatasetPIIRepo, datasetID int64) ([]string, error) {
+	if store == nil {
+		return nil, nil
+	}
+	list, err := store.List(context.Background(), datasetID)
+	if err != nil {
+		return nil, err
+	}
+	return pii.Columns(list), nil
+}
+
+// scannedCategory is the category the scan gave a column, or empty
+func scannedCategory(store *repo.DatasetPIIRepo, datasetID int64, column string) (models.PrivacyCategory, error) {
+	if store == nil {
+		return "", nil
+	}
+	list, err := store.List(context.Background(), datasetID)
+	if err != nil {
+		return "", err
+	}
+	if p, ok := pii.Find(list, strings.TrimSpace(column)); ok {
+		return p.Category, nil
+	}
+	return "", nil
+}
@@ -1,8 +1,24 @@
 package v1
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"context"
+	"strconv"
 
-type PrivacyDeps struct{}
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/gofiber/fiber/v2"
+)
+
+type PrivacyDeps struct {
+	Datasets *repo.DatasetRepo
+	Grants   *repo.DatasetGrantRepo
+	Budgets  *repo.PrivacyBudgetRepo
+	// BudgetEpsilon and BudgetDelta are the lifetime budget each user has
+	// on a dataset
+	BudgetEpsilon float64
+	BudgetDelta   float64
+}
 
 func (d PrivacyDeps) GetSettings(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"privacy_level": "medium", "data_retention": 30})
@@ -15,3 +31,41 @@ func (d PrivacyDeps) UpdateSettings(c *fiber.Ctx) error {
 	}
 	return c.JSON(body)
 }
+
+// Budget returns the caller's privacy budget on a dataset: what their jobs
+// have spent, what remains and the most recent charges
+func (d PrivacyDeps) Budget(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Budgets == nil || d.Datasets == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("dataset_id"), 10, 64)
+	if _, err := d.dataset(owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	epsilon, delta, err := d.Budgets.Spent(context.Background(), id, owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	entries, err := d.Budgets.Entries(context.Background(), id, owner, 50)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	if entries == nil {
+		entries = []models.PrivacyBudgetEntry{}
+	}
+	out := privacy.Balance(id, owner, d.BudgetEpsilon, d.BudgetDelta, epsilon, delta)
+	out.Entries = entries
+	return c.JSON(out)
+}
+
+// dataset loads a dataset the caller may read
+func (d PrivacyDeps) dataset(userID, datasetID int64) (*models.Dataset, error) {
+	if d.Grants == nil {
+		return d.Datasets.GetByOwnerID(context.Background(), userID, datasetID)
+	}
+	return d.Grants.GetAccessibleDataset(context.Background(), userID, datasetID, models.DatasetPermRead)
+}
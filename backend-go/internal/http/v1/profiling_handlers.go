@@ -0,0 +1,76 @@
+package v1
+
+import (
+	"errors"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/profiling"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
+)
+
+// profilingPrefix is where the profiling endpoints are mounted
+const profilingPrefix = "/api/v1/admin"
+
+type ProfilingDeps struct {
+	// Allowlist holds the networks profiles may be requested from; nil
+	// disables the profiling endpoints
+	Allowlist *profiling.Allowlist
+	HeapDumps *profiling.HeapDumper
+}
+
+// RequireAllowlisted answers requests from outside the allowlist as if the
+// endpoints did not exist
+func (d ProfilingDeps) RequireAllowlisted(c *fiber.Ctx) error {
+	if d.Allowlist == nil || !d.Allowlist.Allows(c.IP()) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	return c.Next()
+}
+
+// Pprof serves the runtime profiles: heap, goroutine, allocs, block, mutex,
+// threadcreate, a CPU profile over ?seconds= and an execution trace
+func (d ProfilingDeps) Pprof() fiber.Handler {
+	return pprof.New(pprof.Config{Prefix: profilingPrefix})
+}
+
+// ListHeapDumps lists the heap dumps captured on demand or by the memory
+// health check, newest first
+func (d ProfilingDeps) ListHeapDumps(c *fiber.Ctx) error {
+	if d.HeapDumps == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	dumps, err := d.HeapDumps.List()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(dumps)
+}
+
+// CaptureHeapDump captures a heap dump now
+func (d ProfilingDeps) CaptureHeapDump(c *fiber.Ctx) error {
+	if d.HeapDumps == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	reason := c.Query("reason", "manual")
+	dump, err := d.HeapDumps.Capture(reason, true)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "capture_failed"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(dump)
+}
+
+// DownloadHeapDump returns a heap dump for go tool pprof
+func (d ProfilingDeps) DownloadHeapDump(c *fiber.Ctx) error {
+	if d.HeapDumps == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	path, err := d.HeapDumps.Path(c.Params("name"))
+	if errors.Is(err, profiling.ErrDumpNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "heap_dump_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "download_failed"})
+	}
+	c.Set(fiber.HeaderContentType, "application/octet-stream")
+	return c.Download(path)
+}
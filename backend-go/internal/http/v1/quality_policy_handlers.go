@@ -0,0 +1,129 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/qualitygate"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lib/pq"
+)
+
+type QualityPolicyRequest struct {
+	MinStatisticalSimilarity *float64 `json:"min_statistical_similarity,omitempty"`
+	MaxCorrelationDrift      *float64 `json:"max_correlation_drift,omitempty"`
+	MaxPrivacyRisk           *float64 `json:"max_privacy_risk,omitempty"`
+	MinQualityScore          *float64 `json:"min_quality_score,omitempty"`
+	// OnFailure is retry or fail, the default; retrying generates again
+	// with each of FallbackStrategies in turn
+	OnFailure          string   `json:"on_failure,omitempty"`
+	FallbackStrategies []string `json:"fallback_strategies,omitempty"`
+}
+
+// GetQualityPolicy returns the quality policy of a dataset
+func (d DatasetDeps) GetQualityPolicy(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.QualityPolicies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.accessibleDataset(owner, id, models.DatasetPermRead); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	out, err := d.QualityPolicies.Get(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "policy_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(out)
+}
+
+// SetQualityPolicy defines the quality a dataset's generated rows must
+// reach: jobs whose rows fall short are generated again with the fallback
+// strategies or failed with the checks that failed
+func (d DatasetDeps) SetQualityPolicy(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.QualityPolicies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var body QualityPolicyRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	policy := models.QualityPolicy{
+		DatasetID:                id,
+		MinStatisticalSimilarity: body.MinStatisticalSimilarity,
+		MaxCorrelationDrift:      body.MaxCorrelationDrift,
+		MaxPrivacyRisk:           body.MaxPrivacyRisk,
+		MinQualityScore:          body.MinQualityScore,
+		OnFailure:                body.OnFailure,
+		FallbackStrategies:       pq.StringArray{},
+		UpdatedBy:                owner,
+	}
+	policy.FallbackStrategies = append(policy.FallbackStrategies, body.FallbackStrategies...)
+	if err := qualitygate.Validate(&policy); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_policy", "message": err.Error()})
+	}
+	out, err := d.QualityPolicies.Upsert(context.Background(), &policy)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditAccess(c, owner, "quality_policy_set", "dataset", id, map[string]any{
+		"on_failure":          out.OnFailure,
+		"fallback_strategies": []string(out.FallbackStrategies),
+	})
+	return c.JSON(out)
+}
+
+// DeleteQualityPolicy removes a dataset's policy; jobs already queued keep
+// it
+func (d DatasetDeps) DeleteQualityPolicy(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.QualityPolicies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	err := d.QualityPolicies.Delete(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "policy_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	_ = d.auditAccess(c, owner, "quality_policy_removed", "dataset", id, nil)
+	return c.JSON(fiber.Map{"message": "policy_removed"})
+}
+
+// qualityPolicy loads the policy a dataset's jobs are held to; nil when it
+// has none
+func (d GenerationDeps) qualityPolicy(datasetID int64) (*models.QualityPolicy, error) {
+	if d.QualityPolicies == nil {
+		return nil, nil
+	}
+	policy, err := d.QualityPolicies.Get(context.Background(), datasetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return policy, err
+}
@@ -0,0 +1,122 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/relationships"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DiscoverRelationships measures relationships between the columns of a
+// dataset and stores them as hints for the owner to accept or reject
+func (d DatasetDeps) DiscoverRelationships(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Relationships == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	reader, ok := d.StorageClient.(storage.ObjectReader)
+	if !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" || (ds.FileType != "csv" && ds.FileType != "json") {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "dataset_not_readable"})
+	}
+	columns, rows, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	found := relationships.Discover(columns, rows)
+	hints := make([]models.RelationshipHint, len(found))
+	for i, rel := range found {
+		hints[i] = models.RelationshipHint{Kind: rel.Kind, SourceColumn: rel.Source, TargetColumn: rel.Target, Strength: rel.Strength}
+	}
+	if err := d.Relationships.ReplaceSuggestions(context.Background(), id, hints); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	out, err := d.Relationships.List(context.Background(), id, "")
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(fiber.Map{"rows_profiled": len(rows), "hints": out})
+}
+
+// ListRelationships lists a dataset's relationship hints, optionally by status
+func (d DatasetDeps) ListRelationships(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Relationships == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	hints, err := d.Relationships.List(context.Background(), id, models.RelationshipHintStatus(c.Query("status")))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(hints)
+}
+
+// DecideRelationship accepts or rejects a relationship hint. Accepted
+// relationships apply to generation jobs started afterwards.
+func (d DatasetDeps) DecideRelationship(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Relationships == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var body struct {
+		Accept bool `json:"accept"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	status := models.RelationshipRejected
+	if body.Accept {
+		status = models.RelationshipAccepted
+	}
+	hint, err := d.Relationships.Decide(context.Background(), id, parseID(c.Params("hintId")), owner, status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "hint_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditAccess(c, owner, "relationship_hint_"+string(status), "dataset", id, map[string]any{
+		"hint_id": hint.ID,
+		"kind":    hint.Kind,
+		"source":  hint.SourceColumn,
+		"target":  hint.TargetColumn,
+	})
+	return c.JSON(hint)
+}
+
+// acceptedRelationships returns the relationships a job on the dataset
+// must preserve
+func acceptedRelationships(hints []models.RelationshipHint) []agents.Relationship {
+	out := make([]agents.Relationship, 0, len(hints))
+	for _, h := range hints {
+		out = append(out, agents.Relationship{Kind: h.Kind, Source: h.SourceColumn, Target: h.TargetColumn, Strength: h.Strength})
+	}
+	return out
+}
@@ -0,0 +1,217 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/analytics"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+type ReportTemplateRequest struct {
+	Name          string                `json:"name"`
+	Description   *string               `json:"description"`
+	Metrics       []string              `json:"metrics"`
+	GroupBy       []string              `json:"group_by"`
+	Filters       map[string]string     `json:"filters"`
+	ChartType     string                `json:"chart_type"`
+	Period        string                `json:"period"`
+	Schedule      models.ReportSchedule `json:"schedule"`
+	EmailTo       []string              `json:"email_to"`
+	WebhookURL    *string               `json:"webhook_url"`
+	WebhookSecret *string               `json:"webhook_secret"`
+}
+
+// ReportCatalog lists the metrics, dimensions and chart types report templates can use
+func (a AdminDeps) ReportCatalog(c *fiber.Ctx) error {
+	return c.JSON(analytics.ReportCatalog())
+}
+
+func (a AdminDeps) ListReportTemplates(c *fiber.Ctx) error {
+	items, err := a.Reports.ListTemplates(context.Background(), 100, 0)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(items)
+}
+
+func (a AdminDeps) GetReportTemplate(c *fiber.Ctx) error {
+	t, err := a.Reports.GetTemplate(context.Background(), parseID(c.Params("id")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	return c.JSON(t)
+}
+
+func (a AdminDeps) CreateReportTemplate(c *fiber.Ctx) error {
+	adminID, _ := c.Locals("user_id").(int64)
+	t, errCode := parseReportTemplate(c)
+	if errCode != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errCode})
+	}
+	if t.WebhookURL != nil && *t.WebhookURL != "" {
+		if res, ok := checkDestination(a.Egress, "report_webhooks", *t.WebhookURL); !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(res)
+		}
+	}
+	t.CreatedBy = adminID
+	t.NextRunAt = analytics.NextReportRun(t.Schedule, time.Now())
+	out, err := a.Reports.InsertTemplate(context.Background(), t)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
+
+func (a AdminDeps) UpdateReportTemplate(c *fiber.Ctx) error {
+	existing, err := a.Reports.GetTemplate(context.Background(), parseID(c.Params("id")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	t, errCode := parseReportTemplate(c)
+	if errCode != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": errCode})
+	}
+	if t.WebhookURL != nil && *t.WebhookURL != "" {
+		if res, ok := checkDestination(a.Egress, "report_webhooks", *t.WebhookURL); !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(res)
+		}
+	}
+	t.ID = existing.ID
+	// Keep the stored secret unless a new one is supplied
+	if t.WebhookSecret == nil {
+		t.WebhookSecret = existing.WebhookSecret
+	}
+	t.NextRunAt = existing.NextRunAt
+	if t.Schedule != existing.Schedule || t.NextRunAt == nil {
+		t.NextRunAt = analytics.NextReportRun(t.Schedule, time.Now())
+	}
+	out, err := a.Reports.UpdateTemplate(context.Background(), t)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.JSON(out)
+}
+
+func (a AdminDeps) DeleteReportTemplate(c *fiber.Ctx) error {
+	if err := a.Reports.DeleteTemplate(context.Background(), parseID(c.Params("id"))); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	return c.JSON(fiber.Map{"message": "deleted"})
+}
+
+// RunReportTemplate generates a report now; deliver=true also sends it to the
+// template's email and webhook recipients
+func (a AdminDeps) RunReportTemplate(c *fiber.Ctx) error {
+	if a.ReportScheduler == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	t, err := a.Reports.GetTemplate(context.Background(), parseID(c.Params("id")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+	}
+	report, run, err := a.ReportScheduler.Run(context.Background(), t, "manual", c.QueryBool("deliver"))
+	if err != nil && report == nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "report_failed", "message": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "run_record_failed"})
+	}
+	return c.JSON(fiber.Map{"run": run, "report": report})
+}
+
+func (a AdminDeps) ListReportRuns(c *fiber.Ctx) error {
+	runs, err := a.Reports.ListRuns(context.Background(), parseID(c.Params("id")), 50)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	out := make([]fiber.Map, 0, len(runs))
+	for _, r := range runs {
+		out = append(out, fiber.Map{
+			"id":          r.ID,
+			"template_id": r.TemplateID,
+			"trigger":     r.Trigger,
+			"status":      r.Status,
+			"error":       r.Error,
+			"created_at":  r.CreatedAt,
+			"result":      json.RawMessage(r.Result),
+		})
+	}
+	return c.JSON(out)
+}
+
+// parseReportTemplate validates a template body and returns an error code on failure
+func parseReportTemplate(c *fiber.Ctx) (*models.ReportTemplate, string) {
+	var body ReportTemplateRequest
+	if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Name) == "" {
+		return nil, "invalid_body"
+	}
+	def := analytics.ReportDefinition{
+		Name:      body.Name,
+		Metrics:   body.Metrics,
+		GroupBy:   body.GroupBy,
+		Filters:   body.Filters,
+		ChartType: body.ChartType,
+		Period:    body.Period,
+	}
+	if err := analytics.ValidateDefinition(def); err != nil {
+		return nil, "invalid_definition"
+	}
+	switch body.Schedule {
+	case models.ReportOnDemand, models.ReportDaily, models.ReportWeekly, models.ReportMonthly:
+	default:
+		return nil, "invalid_schedule"
+	}
+	for _, to := range body.EmailTo {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return nil, "invalid_email"
+		}
+	}
+	if body.WebhookURL != nil && *body.WebhookURL != "" {
+		u, err := url.Parse(*body.WebhookURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, "invalid_webhook_url"
+		}
+	}
+	if body.ChartType == "" {
+		body.ChartType = "table"
+	}
+	if body.Period == "" {
+		body.Period = "last_30_days"
+	}
+	if body.GroupBy == nil {
+		body.GroupBy = []string{}
+	}
+	if body.EmailTo == nil {
+		body.EmailTo = []string{}
+	}
+	return &models.ReportTemplate{
+		Name:          strings.TrimSpace(body.Name),
+		Description:   body.Description,
+		Metrics:       body.Metrics,
+		GroupBy:       body.GroupBy,
+		Filters:       body.Filters,
+		ChartType:     body.ChartType,
+		Period:        body.Period,
+		Schedule:      body.Schedule,
+		EmailTo:       body.EmailTo,
+		WebhookURL:    body.WebhookURL,
+		WebhookSecret: body.WebhookSecret,
+	}, ""
+}
@@ -0,0 +1,49 @@
+package v1
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/analytics"
+	"github.com/gofiber/fiber/v2"
+)
+
+// revenuePeriods maps the period query parameter to a trailing window length
+var revenuePeriods = map[string]time.Duration{
+	"week":    7 * 24 * time.Hour,
+	"month":   30 * 24 * time.Hour,
+	"quarter": 90 * 24 * time.Hour,
+	"year":    365 * 24 * time.Hour,
+}
+
+// RevenueAnalytics reports MRR movement, churn and cohort LTV for a period
+// compared with the period before it. The period is either a trailing window
+// (period=week|month|quarter|year, default month) or an explicit
+// start/end date range (YYYY-MM-DD, end exclusive).
+func (a AdminDeps) RevenueAnalytics(c *fiber.Ctx) error {
+	if a.Subscriptions == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	end := time.Now().UTC()
+	var start time.Time
+	if from, to := c.Query("start"), c.Query("end"); from != "" || to != "" {
+		s, err1 := time.Parse("2006-01-02", from)
+		e, err2 := time.Parse("2006-01-02", to)
+		if err1 != nil || err2 != nil || !s.Before(e) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_range"})
+		}
+		start, end = s, e
+	} else {
+		length, ok := revenuePeriods[c.Query("period", "month")]
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_period"})
+		}
+		start = end.Add(-length)
+	}
+
+	history, err := a.Subscriptions.ListHistory(context.Background(), end)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "revenue_failed"})
+	}
+	return c.JSON(analytics.BuildRevenueReport(history, start, end))
+}
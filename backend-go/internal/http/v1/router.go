@@ -3,6 +3,7 @@ package v1
 import (
 	"time"
 
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rbac"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
 	"github.com/gofiber/fiber/v2"
 )
@@ -12,97 +13,400 @@ type SignedURLProvider = storage.SignedURLProvider
 
 type Deps struct {
 	// Add services as we implement them (db, redis, auth, etc.)
-	Auth         AuthDeps
-	Users        UserDeps
-	Datasets     DatasetDeps
-	Generations  GenerationDeps
-	Payments     PaymentDeps
-	Analytics    AnalyticsDeps
-	Privacy      PrivacyDeps
-	Admin        AdminDeps
-	Usage        UsageDeps
-	CustomModels CustomModelDeps
-	VertexAI     *VertexAIHandlers
+	Auth          AuthDeps
+	Access        AccessDeps
+	Users         UserDeps
+	Accounts      AccountDeps
+	Consent       ConsentDeps
+	Orgs          OrgDeps
+	Datasets      DatasetDeps
+	Generations   GenerationDeps
+	Payments      PaymentDeps
+	Analytics     AnalyticsDeps
+	Privacy       PrivacyDeps
+	Admin         AdminDeps
+	Usage         UsageDeps
+	SLA           SLADeps
+	Evidence      EvidenceDeps
+	Signatures    SignatureDeps
+	Notifications NotificationDeps
+	CustomModels  CustomModelDeps
+	Webhooks      WebhookDeps
+	Warehouses    WarehouseDeps
+	MockAPIs      MockAPIDeps
+	Profiling     ProfilingDeps
+	Changelog     ChangelogDeps
+	Incidents     IncidentDeps
+	Housekeeping  HousekeepingDeps
+	VertexAI      *VertexAIHandlers
+	// RateLimit limits API requests by the caller's subscription; nil
+	// leaves them unlimited
+	RateLimit fiber.Handler
 }
 
 func Register(app *fiber.App, d Deps) {
 	v1 := app.Group("/api/v1")
+	if d.RateLimit != nil {
+		v1.Use(d.RateLimit)
+	}
 
 	// API Docs
 	v1.Get("/docs", APIDocs)
 	v1.Get("/docs/ui", APIDocsUI)
+	v1.Get("/openapi.json", OpenAPI)
 
 	// Marketing
 	v1.Get("/marketing/features", getFeatures)
 	v1.Get("/marketing/testimonials", getTestimonials)
+	v1.Get("/changelog", d.Changelog.ListChangelog)
+
+	// Export signing keys and verification, for recipients of generated
+	// data who need no account
+	v1.Get("/export-signatures/keys", d.Signatures.PublicKeys)
+	v1.Post("/export-signatures/verify", d.Signatures.VerifyManifest)
+	v1.Post("/export-signatures/verify-file", d.Signatures.VerifyFile)
 
 	// Auth
+	authenticate := d.Auth.AuthMiddleware()
 	auth := v1.Group("/auth")
 	auth.Post("/signup", d.Auth.SignUp)
 	auth.Post("/signin", d.Auth.SignIn)
 	auth.Post("/refresh", d.Auth.RefreshToken)
 	auth.Post("/logout", d.Auth.Logout)
-	// Password reset and API keys
+	// Password reset and API keys; impersonation tokens cannot mint
+	// credentials of the user they act as
 	auth.Post("/forgot-password", d.Auth.ForgotPassword)
 	auth.Post("/reset-password", d.Auth.ResetPassword)
-	auth.Post("/api-keys", d.Auth.CreateAPIKey)
+	auth.Post("/api-keys", authenticate, DenyImpersonation, d.Auth.CreateAPIKey)
+	auth.Get("/api-keys", authenticate, d.Auth.ListAPIKeys)
+	auth.Put("/api-keys/:id/rotation", authenticate, DenyImpersonation, d.Auth.SetAPIKeyRotation)
+	auth.Post("/api-keys/:id/rotate", authenticate, DenyImpersonation, d.Auth.RotateAPIKey)
+	auth.Post("/api-keys/:id/acknowledge", authenticate, d.Auth.AcknowledgeAPIKeyRotation)
+	// Email change links opened from the old and new address
+	auth.Post("/email-change/confirm", d.Accounts.ConfirmEmailChange)
+	auth.Post("/email-change/cancel", d.Accounts.CancelEmailChangeByToken)
 
 	// Users
-	users := v1.Group("/users")
+	users := v1.Group("/users", authenticate)
 	users.Get("/me", d.Users.Me)
 	users.Put("/profile", d.Users.UpdateProfile)
+	users.Post("/email-change", DenyImpersonation, d.Accounts.RequestEmailChange)
+	users.Get("/email-change", d.Accounts.GetEmailChange)
+	users.Delete("/email-change", d.Accounts.CancelEmailChange)
+	users.Post("/merge", DenyImpersonation, d.Accounts.RequestMerge)
+	users.Post("/merge/confirm", DenyImpersonation, d.Accounts.ConfirmMerge)
 	users.Get("/usage", d.Usage.GetUsage)
+	users.Get("/usage/invoice", d.Usage.GetInvoice)
+	users.Get("/sla", d.SLA.MySLA)
+	users.Get("/permissions", d.Access.MyPermissions)
+	users.Get("/notifications", d.Notifications.ListNotifications)
+	users.Get("/notification-preferences", d.Notifications.GetNotificationPreferences)
+	users.Put("/notification-preferences", d.Notifications.UpdateNotificationPreferences)
+
+	// Legal documents and consent; the routes behind signedIn are closed to
+	// users who have a new major version of a document to accept
+	v1.Get("/legal/documents", d.Consent.LegalDocuments)
+	users.Get("/consent", d.Consent.GetConsent)
+	users.Post("/consent/accept", d.Consent.AcceptDocuments)
+	users.Put("/consent/email", d.Consent.UpdateEmailConsent)
+	users.Get("/consent/history", d.Consent.ConsentHistory)
+	// Organization auditors only read metadata behind signedIn, never
+	// contents, and change nothing
+	signedIn := func(h ...fiber.Handler) []fiber.Handler {
+		return append([]fiber.Handler{authenticate, d.Consent.RequireConsent, d.Orgs.RestrictAuditors}, h...)
+	}
+
+	// Organizations
+	orgs := v1.Group("/orgs", signedIn()...)
+	orgs.Post("/", d.Orgs.CreateOrg)
+	orgs.Post("/invitations/accept", d.Orgs.AcceptInvitation)
+	orgs.Get("/current", d.Orgs.GetOrg)
+	orgs.Post("/current/leave", d.Orgs.LeaveOrg)
+	orgs.Get("/current/usage", d.Orgs.OrgUsage)
+	orgs.Get("/current/usage/capacity", d.Orgs.UsageCapacity)
+	orgs.Get("/current/usage/costs", d.Orgs.UsageCosts)
+	orgs.Get("/current/audit/generations", d.Orgs.SearchGenerationAudit)
+	orgs.Get("/current/members", d.Orgs.ListMembers)
+	orgs.Put("/current/members/:user_id", d.Orgs.UpdateMemberRole)
+	orgs.Delete("/current/members/:user_id", d.Orgs.RemoveMember)
+	orgs.Get("/current/invitations", d.Orgs.ListInvitations)
+	orgs.Post("/current/invitations", d.Orgs.CreateInvitation)
+	orgs.Get("/current/invitations/imports", d.Orgs.ListImports)
+	orgs.Post("/current/invitations/imports", d.Orgs.ImportInvitations)
+	orgs.Get("/current/invitations/imports/:id", d.Orgs.GetImport)
+	orgs.Post("/current/invitations/imports/:id/retry", d.Orgs.RetryImport)
+	orgs.Get("/current/policies", d.Orgs.ListPolicies)
+	orgs.Get("/current/policies/violations", d.Orgs.ListPolicyViolations)
+	orgs.Put("/current/policies/:capability", d.Orgs.DisableCapability)
+	orgs.Delete("/current/policies/:capability", d.Orgs.EnableCapability)
+	orgs.Delete("/current/invitations/:id", d.Orgs.RevokeInvitation)
+	orgs.Get("/current/branding", d.Orgs.GetBranding)
+	orgs.Put("/current/branding", d.Orgs.UpdateBranding)
+	orgs.Delete("/current/branding", d.Orgs.DeleteBranding)
+	orgs.Post("/current/branding/verify", d.Orgs.VerifyBranding)
+	orgs.Get("/current/output-bucket", d.Orgs.GetOutputBucket)
+	orgs.Put("/current/output-bucket", d.Orgs.SetOutputBucket)
+	orgs.Delete("/current/output-bucket", d.Orgs.DeleteOutputBucket)
+	orgs.Post("/current/output-bucket/verify", d.Orgs.VerifyOutputBucket)
+
+	// Usage
+	v1.Get("/usage/providers", signedIn(d.Usage.GetProviderUsage)...)
 
 	// Datasets
-	datasets := v1.Group("/datasets")
+	datasets := v1.Group("/datasets", signedIn()...)
 	datasets.Get("/", d.Datasets.List)
+	datasets.Get("/shared", d.Datasets.ListShared)
+	datasets.Get("/collections", d.Datasets.ListCollections)
+	datasets.Post("/collections", d.Datasets.CreateCollection)
+	datasets.Get("/collections/:collectionId", d.Datasets.GetCollection)
+	datasets.Put("/collections/:collectionId", d.Datasets.UpdateCollection)
+	datasets.Delete("/collections/:collectionId", d.Datasets.DeleteCollection)
+	datasets.Get("/sources", d.Datasets.ListSources)
+	datasets.Post("/sources", d.Datasets.CreateSource)
+	datasets.Get("/sources/:id", d.Datasets.GetSource)
+	datasets.Delete("/sources/:id", d.Datasets.DeleteSource)
+	datasets.Post("/sources/:id/test", d.Datasets.TestSource)
+	datasets.Get("/sources/:id/tables", d.Datasets.ListSourceTables)
+	datasets.Post("/sources/:id/import", d.Datasets.ImportSource)
+	datasets.Get("/vocabularies", d.Datasets.ListVocabularies)
+	datasets.Post("/vocabularies", d.Datasets.CreateVocabulary)
+	datasets.Get("/vocabularies/:vocabularyId", d.Datasets.GetVocabulary)
+	datasets.Delete("/vocabularies/:vocabularyId", d.Datasets.DeleteVocabulary)
 	datasets.Get("/:id", d.Datasets.Get)
 	datasets.Post("/upload", d.Datasets.Upload)
 	datasets.Get("/:id/preview", d.Datasets.Preview)
 	datasets.Get("/:id/download", d.Datasets.Download)
+	datasets.Post("/:id/download-urls/revoke", d.Datasets.RevokeDownloads)
+	datasets.Get("/:id/grants", d.Datasets.ListGrants)
+	datasets.Post("/:id/grants", d.Datasets.CreateGrant)
+	datasets.Delete("/:id/grants/:grantId", d.Datasets.DeleteGrant)
+	datasets.Get("/:id/columns", d.Datasets.ListColumnRestrictions)
+	datasets.Put("/:id/columns/restrictions", d.Datasets.SetColumnRestriction)
+	datasets.Delete("/:id/columns/restrictions/:column", d.Datasets.DeleteColumnRestriction)
+	datasets.Post("/:id/columns/clearances", d.Datasets.CreateColumnClearance)
+	datasets.Delete("/:id/columns/clearances/:clearanceId", d.Datasets.DeleteColumnClearance)
+	datasets.Put("/:id/data-policy", d.Datasets.SetDataPolicy)
+	datasets.Get("/:id/weights", d.Datasets.GetWeights)
+	datasets.Put("/:id/weights", d.Datasets.SetWeights)
+	datasets.Get("/:id/schema", d.Datasets.GetSchema)
+	datasets.Get("/:id/schema/history", d.Datasets.ListAnnotationHistory)
+	datasets.Put("/:id/schema/columns/:column", d.Datasets.SetColumnAnnotation)
+	datasets.Delete("/:id/schema/columns/:column", d.Datasets.DeleteColumnAnnotation)
+	datasets.Post("/:id/relationships/discover", d.Datasets.DiscoverRelationships)
+	datasets.Get("/:id/relationships", d.Datasets.ListRelationships)
+	datasets.Put("/:id/relationships/:hintId", d.Datasets.DecideRelationship)
+	datasets.Get("/:id/hierarchies", d.Datasets.ListHierarchies)
+	datasets.Post("/:id/hierarchies", d.Datasets.CreateHierarchy)
+	datasets.Delete("/:id/hierarchies/:hierarchyId", d.Datasets.DeleteHierarchy)
+	datasets.Get("/:id/vocabularies", d.Datasets.ListColumnVocabularies)
+	datasets.Put("/:id/vocabularies/:column", d.Datasets.BindVocabulary)
+	datasets.Delete("/:id/vocabularies/:column", d.Datasets.UnbindVocabulary)
+	datasets.Get("/:id/nested-columns", d.Datasets.GetNestedColumns)
+	datasets.Get("/:id/array-columns", d.Datasets.GetArrayColumns)
+	datasets.Get("/:id/free-text", d.Datasets.GetFreeTextColumns)
+	datasets.Get("/:id/structure", d.Datasets.GetStructure)
+	datasets.Get("/:id/pii", d.Datasets.GetPII)
+	datasets.Post("/:id/pii/scan", d.Datasets.ScanPII)
+	datasets.Get("/:id/privacy/columns", d.Datasets.ListColumnPrivacy)
+	datasets.Put("/:id/privacy/columns/:column", d.Datasets.SetColumnPrivacy)
+	datasets.Delete("/:id/privacy/columns/:column", d.Datasets.DeleteColumnPrivacy)
+	datasets.Get("/:id/fixed-width-layout", d.Datasets.GetFixedWidthLayout)
+	datasets.Put("/:id/fixed-width-layout", d.Datasets.SetFixedWidthLayout)
+	datasets.Delete("/:id/fixed-width-layout", d.Datasets.DeleteFixedWidthLayout)
+	datasets.Get("/:id/quality-policy", d.Datasets.GetQualityPolicy)
+	datasets.Put("/:id/quality-policy", d.Datasets.SetQualityPolicy)
+	datasets.Delete("/:id/quality-policy", d.Datasets.DeleteQualityPolicy)
+	datasets.Get("/:id/fhir-mapping", d.Datasets.GetFHIRMapping)
+	datasets.Put("/:id/fhir-mapping", d.Datasets.SetFHIRMapping)
+	datasets.Delete("/:id/fhir-mapping", d.Datasets.DeleteFHIRMapping)
+	datasets.Get("/:id/financial-message-layout", d.Datasets.GetFinancialMessageLayout)
+	datasets.Put("/:id/financial-message-layout", d.Datasets.SetFinancialMessageLayout)
+	datasets.Delete("/:id/financial-message-layout", d.Datasets.DeleteFinancialMessageLayout)
 	datasets.Delete("/:id", d.Datasets.Delete)
 
+	// Groups that dataset grants can target
+	groups := v1.Group("/groups", signedIn()...)
+	groups.Get("/", d.Datasets.ListGroups)
+	groups.Post("/", d.Datasets.CreateGroup)
+	groups.Get("/:id", d.Datasets.GetGroup)
+	groups.Post("/:id/members", d.Datasets.AddGroupMember)
+	groups.Delete("/:id/members/:userId", d.Datasets.RemoveGroupMember)
+
+	// Download tickets; the token itself is the credential
+	v1.Get("/downloads/:token", d.Datasets.RedeemDownload)
+
+	// Hosted mock endpoints; the public ID itself is the credential
+	v1.Get("/mock/:id/records", d.MockAPIs.MockRecords)
+	v1.Get("/mock/:id/schema", d.MockAPIs.MockSchema)
+
 	// Generation
-	gen := v1.Group("/generation")
+	gen := v1.Group("/generation", signedIn()...)
 	gen.Post("/generate", d.Generations.Start)
+	gen.Post("/multi-table", d.Generations.StartMultiTable)
+	gen.Post("/events", d.Generations.StartEventStream)
 	gen.Get("/jobs", d.Generations.List)
+	gen.Get("/defaults", d.Generations.Defaults)
+	gen.Get("/templates", d.Generations.ListTemplates)
+	gen.Post("/templates", d.Generations.CreateTemplate)
+	gen.Get("/templates/:id", d.Generations.GetTemplate)
+	gen.Put("/templates/:id", d.Generations.UpdateTemplate)
+	gen.Delete("/templates/:id", d.Generations.DeleteTemplate)
+	gen.Get("/templates/:id/versions", d.Generations.TemplateVersions)
 	gen.Get("/jobs/:id", d.Generations.Get)
+	gen.Get("/jobs/:id/status", d.Generations.Status)
+	gen.Get("/:id/status", d.Generations.Status)
+	gen.Get("/:id/stream", d.Generations.Stream)
+	gen.Post("/:id/cancel", d.Generations.Cancel)
+	gen.Post("/:id/pause", d.Generations.Pause)
+	gen.Post("/:id/resume", d.Generations.Resume)
 	gen.Get("/jobs/:id/download", d.Generations.Download)
+	gen.Get("/:id/download", d.Generations.Download)
+	gen.Get("/:id/artifacts", d.Generations.Artifacts)
+	gen.Get("/:id/artifacts/:name", d.Generations.Artifact)
+	gen.Get("/:id/report", d.Generations.Report)
+	gen.Get("/:id/signed-manifest", d.Generations.SignedManifest)
+	gen.Get("/jobs/:id/grounding-sample", d.Generations.GroundingSample)
+	gen.Get("/jobs/:id/lineage", d.Generations.Lineage)
+	gen.Get("/jobs/:id/provenance", d.Generations.Provenance)
+	gen.Post("/jobs/:id/watermark/verify", d.Generations.VerifyWatermark)
+	gen.Get("/jobs/:id/access", d.Generations.ListOutputAccess)
+	gen.Post("/jobs/:id/access", d.Generations.RequestOutputAccess)
+	gen.Post("/jobs/:id/access/:grantId/key", d.Generations.ReleaseOutputKey)
 	gen.Delete("/jobs/:id", d.Generations.Cancel)
+	gen.Get("/jobs/:id/warehouse-exports", d.Warehouses.ListJobExports)
+	gen.Post("/jobs/:id/warehouse-exports", d.Warehouses.ExportJob)
+
+	// Webhook endpoints and their delivery history
+	hooks := v1.Group("/webhooks", signedIn()...)
+	hooks.Get("/", d.Webhooks.ListWebhooks)
+	hooks.Post("/", d.Webhooks.CreateWebhook)
+	hooks.Get("/event-types", d.Webhooks.ListEventTypes)
+	hooks.Get("/:id", d.Webhooks.GetWebhook)
+	hooks.Put("/:id", d.Webhooks.UpdateWebhook)
+	hooks.Delete("/:id", d.Webhooks.DeleteWebhook)
+	hooks.Get("/:id/deliveries", d.Webhooks.ListDeliveries)
+	hooks.Post("/:id/deliveries/:deliveryId/redeliver", d.Webhooks.Redeliver)
+
+	// Warehouse destinations completed jobs are loaded into
+	wh := v1.Group("/warehouses", signedIn()...)
+	wh.Get("/", d.Warehouses.ListWarehouses)
+	wh.Post("/", d.Warehouses.CreateWarehouse)
+	wh.Post("/test", d.Warehouses.TestWarehouseSettings)
+	wh.Get("/:id", d.Warehouses.GetWarehouse)
+	wh.Put("/:id", d.Warehouses.UpdateWarehouse)
+	wh.Delete("/:id", d.Warehouses.DeleteWarehouse)
+	wh.Post("/:id/test", d.Warehouses.TestWarehouse)
+	wh.Get("/:id/deliveries", d.Warehouses.ListWarehouseDeliveries)
+
+	// Mock APIs hosted on completed jobs
+	mocks := v1.Group("/mock-apis", signedIn()...)
+	mocks.Get("/", d.MockAPIs.ListMockAPIs)
+	mocks.Post("/", d.MockAPIs.CreateMockAPI)
+	mocks.Get("/:id", d.MockAPIs.GetMockAPI)
+	mocks.Delete("/:id", d.MockAPIs.DeleteMockAPI)
 
 	// Payment
 	pay := v1.Group("/payment")
 	pay.Get("/plans", d.Payments.Plans)
 	pay.Get("/support-tiers", d.Payments.SupportTiers)
 	pay.Get("/regions", d.Payments.Regions)
-	pay.Post("/checkout", d.Payments.Checkout)
-	pay.Get("/subscription", d.Payments.Subscription)
+	pay.Post("/checkout", signedIn(d.Payments.Checkout)...)
+	pay.Get("/subscription", signedIn(d.Payments.Subscription)...)
 	pay.Post("/contact-sales", d.Payments.ContactSales)
 	pay.Post("/webhook", d.Payments.StripeWebhook)
 	pay.Post("/paddle-webhook", d.Payments.PaddleWebhook)
 
+	// Billing
+	billing := v1.Group("/billing", signedIn()...)
+	billing.Post("/portal", d.Payments.BillingPortal)
+
 	// Privacy
-	privacy := v1.Group("/privacy")
+	privacy := v1.Group("/privacy", signedIn()...)
 	privacy.Get("/settings", d.Privacy.GetSettings)
-	privacy.Put("/settings") // d.Auth.AuthMiddleware(), d.Privacy.UpdateSettings)
+	privacy.Put("/settings", notImplemented) // d.Auth.AuthMiddleware(), d.Privacy.UpdateSettings)
+	privacy.Get("/budget/:dataset_id", d.Privacy.Budget)
 
 	// Admin
 	admin := v1.Group("/admin")
+	// Changes made through admin routes are audited as admin actions
+	admin.Use(d.Access.AuditAdmin)
+	// Each admin route authenticates the caller and checks one permission
+	staff := func(perm rbac.Permission, h fiber.Handler) []fiber.Handler {
+		return []fiber.Handler{authenticate, d.Consent.RequireConsent, d.Access.Require(perm, h)}
+	}
 	admin.Get("/stats", func(c *fiber.Ctx) error { return c.JSON(fiber.Map{"message": "Admin endpoint working"}) })
-	admin.Get("/users", d.Admin.RequireAdmin(d.Admin.ListUsers))
-	admin.Put("/users/:id/status", d.Admin.RequireAdmin(d.Admin.UpdateUserStatus))
-	admin.Delete("/users/:id", d.Admin.RequireAdmin(d.Admin.DeleteUser))
+	admin.Get("/users", staff(rbac.AdminUsers, d.Admin.ListUsers)...)
+	admin.Put("/users/:id/status", staff(rbac.AdminUsers, d.Admin.UpdateUserStatus)...)
+	admin.Delete("/users/:id", staff(rbac.AdminUsers, d.Admin.DeleteUser)...)
+	admin.Get("/orgs/:id/anonymization-policy", staff(rbac.AdminOrgs, d.Admin.GetAnonymizationPolicy)...)
+	admin.Put("/orgs/:id/anonymization-policy", staff(rbac.AdminOrgs, d.Admin.UpdateAnonymizationPolicy)...)
+	admin.Get("/orgs/:id/data-policy", staff(rbac.AdminOrgs, d.Admin.GetDataPolicy)...)
+	admin.Put("/orgs/:id/data-policy", staff(rbac.AdminOrgs, d.Admin.UpdateDataPolicy)...)
+	admin.Get("/orgs/:id/settings", staff(rbac.AdminOrgs, d.Admin.GetOrgSettings)...)
+	admin.Put("/orgs/:id/settings", staff(rbac.AdminOrgs, d.Admin.UpdateOrgSettings)...)
+	admin.Put("/users/:id/org", staff(rbac.AdminUsers, d.Admin.SetUserOrg)...)
+	admin.Get("/users/:id", staff(rbac.AdminUsers, d.Admin.GetUser)...)
+	admin.Get("/users/:id/jobs", staff(rbac.AdminUsers, d.Admin.ListUserJobs)...)
+	admin.Get("/users/:id/datasets", staff(rbac.AdminUsers, d.Admin.ListUserDatasets)...)
+	admin.Post("/users/:id/suspend", staff(rbac.AdminUsers, d.Admin.SuspendUser)...)
+	admin.Post("/users/:id/reactivate", staff(rbac.AdminUsers, d.Admin.ReactivateUser)...)
+	admin.Put("/users/:id/subscription", staff(rbac.AdminBilling, d.Admin.SetUserSubscription)...)
+	admin.Get("/users/:id/quota-override", staff(rbac.AdminBilling, d.Admin.GetQuotaOverride)...)
+	admin.Put("/users/:id/quota-override", staff(rbac.AdminBilling, d.Admin.SetQuotaOverride)...)
+	admin.Delete("/users/:id/quota-override", staff(rbac.AdminBilling, d.Admin.DeleteQuotaOverride)...)
+	admin.Post("/users/:id/impersonate", staff(rbac.AdminImpersonate, d.Admin.Impersonate)...)
+	admin.Delete("/impersonations/:id", staff(rbac.AdminImpersonate, d.Admin.EndImpersonation)...)
+	admin.Get("/users/:id/roles", staff(rbac.AdminRoles, d.Access.GetUserRoles)...)
+	admin.Put("/users/:id/roles", staff(rbac.AdminRoles, d.Access.SetUserRoles)...)
+	admin.Get("/rbac/permissions", staff(rbac.AdminRoles, d.Access.ListPermissions)...)
+	admin.Get("/rbac/roles", staff(rbac.AdminRoles, d.Access.ListRoles)...)
+	admin.Put("/rbac/roles/:name", staff(rbac.AdminRoles, d.Access.PutRole)...)
+	admin.Delete("/rbac/roles/:name", staff(rbac.AdminRoles, d.Access.DeleteRole)...)
+	admin.Get("/output-access", staff(rbac.AdminOutputAccess, d.Generations.ListPendingOutputAccess)...)
+	admin.Post("/output-access/:id/decision", staff(rbac.AdminOutputAccess, d.Generations.DecideOutputAccess)...)
+	admin.Post("/output-access/:id/revoke", staff(rbac.AdminOutputAccess, d.Generations.RevokeOutputAccess)...)
+	admin.Get("/analytics/revenue", staff(rbac.AdminBilling, d.Admin.RevenueAnalytics)...)
+	admin.Get("/sla/reports", staff(rbac.AdminSLA, d.SLA.ListReports)...)
+	admin.Post("/sla/reports/generate", staff(rbac.AdminSLA, d.SLA.GenerateReports)...)
+	admin.Get("/evidence/package", staff(rbac.AdminAudit, d.Evidence.ExportPackage)...)
+	admin.Get("/audit/generations", staff(rbac.AdminAudit, d.Generations.SearchGenerationAudit)...)
+	admin.Post("/watermark/verify", staff(rbac.AdminAudit, d.Generations.VerifyAnyWatermark)...)
+	admin.Get("/changelog", staff(rbac.AdminChangelog, d.Changelog.ListChangelogEntries)...)
+	admin.Post("/changelog", staff(rbac.AdminChangelog, d.Changelog.CreateChangelogEntry)...)
+	admin.Put("/changelog/:id", staff(rbac.AdminChangelog, d.Changelog.UpdateChangelogEntry)...)
+	admin.Delete("/changelog/:id", staff(rbac.AdminChangelog, d.Changelog.DeleteChangelogEntry)...)
+	admin.Post("/changelog/:id/publish", staff(rbac.AdminChangelog, d.Changelog.PublishChangelogEntry)...)
+	admin.Get("/reports/catalog", staff(rbac.AdminReports, d.Admin.ReportCatalog)...)
+	admin.Get("/reports/templates", staff(rbac.AdminReports, d.Admin.ListReportTemplates)...)
+	admin.Post("/reports/templates", staff(rbac.AdminReports, d.Admin.CreateReportTemplate)...)
+	admin.Get("/reports/templates/:id", staff(rbac.AdminReports, d.Admin.GetReportTemplate)...)
+	admin.Put("/reports/templates/:id", staff(rbac.AdminReports, d.Admin.UpdateReportTemplate)...)
+	admin.Delete("/reports/templates/:id", staff(rbac.AdminReports, d.Admin.DeleteReportTemplate)...)
+	admin.Post("/reports/templates/:id/run", staff(rbac.AdminReports, d.Admin.RunReportTemplate)...)
+	admin.Get("/reports/templates/:id/runs", staff(rbac.AdminReports, d.Admin.ListReportRuns)...)
+	admin.Get("/incidents/timeline", staff(rbac.AdminIncidents, d.Incidents.IncidentTimeline)...)
+	admin.Post("/incidents/deployments", staff(rbac.AdminIncidents, d.Incidents.RecordDeployment)...)
+	admin.Get("/housekeeping/suggestions", staff(rbac.AdminHousekeeping, d.Housekeeping.CleanupSuggestions)...)
+	admin.Get("/housekeeping/policies", staff(rbac.AdminHousekeeping, d.Housekeeping.ListCleanupPolicies)...)
+	admin.Put("/housekeeping/policies/:kind", staff(rbac.AdminHousekeeping, d.Housekeeping.SetCleanupPolicy)...)
+	// Profiling answers only to allowlisted networks, and to callers with
+	// admin:debug there
+	profile := []fiber.Handler{d.Profiling.RequireAllowlisted, authenticate, d.Consent.RequireConsent}
+	admin.All("/debug/pprof/*", append(profile, d.Access.Require(rbac.AdminDebug, d.Profiling.Pprof()))...)
+	admin.Get("/debug/heap-dumps", append(profile, d.Access.Require(rbac.AdminDebug, d.Profiling.ListHeapDumps))...)
+	admin.Post("/debug/heap-dumps", append(profile, d.Access.Require(rbac.AdminDebug, d.Profiling.CaptureHeapDump))...)
+	admin.Get("/debug/heap-dumps/:name", append(profile, d.Access.Require(rbac.AdminDebug, d.Profiling.DownloadHeapDump))...)
 
 	// Custom Models
-	custom := v1.Group("/custom-models")
+	custom := v1.Group("/custom-models", signedIn()...)
 	custom.Get("/", d.CustomModels.ListCustomModels)
 	custom.Post("/upload", d.CustomModels.UploadFile)
 	custom.Get("/:id", d.CustomModels.GetCustomModel)
 	custom.Delete("/:id", d.CustomModels.DeleteCustomModel)
-	custom.Post("/:id/validate") // d.Auth.AuthMiddleware(), d.CustomModels.ValidateCustomModel)
-	custom.Post("/:id/test")     // d.Auth.AuthMiddleware(), d.CustomModels.TestCustomModel)
+	custom.Post("/:id/validate", notImplemented) // d.Auth.AuthMiddleware(), d.CustomModels.ValidateCustomModel)
+	custom.Post("/:id/test", notImplemented)     // d.Auth.AuthMiddleware(), d.CustomModels.TestCustomModel)
 	custom.Get("/supported-frameworks", d.CustomModels.GetSupportedFrameworks)
-	custom.Get("/tier-limits") // d.Auth.AuthMiddleware(), d.CustomModels.GetTierLimits)
+	custom.Get("/tier-limits", notImplemented) // d.Auth.AuthMiddleware(), d.CustomModels.GetTierLimits)
 
 	// Analytics
 	v1.Get("/analytics/performance", d.Analytics.Performance)
@@ -146,7 +450,13 @@ func getTestimonials(c *fiber.Ctx) error {
 
 // APIDocs serves a concise OpenAPI-like JSON for the current routes
 func APIDocs(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{
+	return c.JSON(apiDocs())
+}
+
+// apiDocs is the document /docs serves. The OpenAPI document built from
+// the routes takes its summaries from its paths.
+func apiDocs() fiber.Map {
+	return fiber.Map{
 		"openapi": "3.0.0",
 		"info": fiber.Map{
 			"title":       "Synthos API",
@@ -157,32 +467,196 @@ func APIDocs(c *fiber.Ctx) error {
 			{"url": "/api/v1"},
 		},
 		"paths": fiber.Map{
-			"/auth/signup":          fiber.Map{"post": fiber.Map{"summary": "Create account"}},
-			"/auth/signin":          fiber.Map{"post": fiber.Map{"summary": "Sign in"}},
-			"/auth/refresh":         fiber.Map{"post": fiber.Map{"summary": "Refresh access token"}},
-			"/auth/logout":          fiber.Map{"post": fiber.Map{"summary": "Logout"}},
-			"/auth/forgot-password": fiber.Map{"post": fiber.Map{"summary": "Initiate password reset"}},
-			"/auth/reset-password":  fiber.Map{"post": fiber.Map{"summary": "Reset password with token"}},
-			"/auth/api-keys":        fiber.Map{"post": fiber.Map{"summary": "Create API key"}},
+			"/auth/signup":               fiber.Map{"post": fiber.Map{"summary": "Create account"}},
+			"/auth/signin":               fiber.Map{"post": fiber.Map{"summary": "Sign in"}},
+			"/auth/refresh":              fiber.Map{"post": fiber.Map{"summary": "Exchange a refresh token for a new access token and the next refresh token; reusing a spent one revokes the session"}},
+			"/auth/logout":               fiber.Map{"post": fiber.Map{"summary": "Logout"}},
+			"/auth/forgot-password":      fiber.Map{"post": fiber.Map{"summary": "Initiate password reset"}},
+			"/auth/reset-password":       fiber.Map{"post": fiber.Map{"summary": "Reset password with token"}},
+			"/auth/api-keys":             fiber.Map{"post": fiber.Map{"summary": "Create API key, optionally limited to scopes within the caller's permissions and auto-rotating (rotation_days, overlap_hours)"}, "get": fiber.Map{"summary": "List API keys with their rotation state"}},
+			"/auth/email-change/confirm": fiber.Map{"post": fiber.Map{"summary": "Verify a new email address; the change takes effect after a security hold"}},
+			"/auth/email-change/cancel":  fiber.Map{"post": fiber.Map{"summary": "Cancel an email change with the token sent to the old address"}},
+
+			"/auth/api-keys/{id}/rotation":    fiber.Map{"put": fiber.Map{"summary": "Make a key auto-rotate every rotation_days with overlap_hours of overlap, or stop it with a null rotation_days"}},
+			"/auth/api-keys/{id}/rotate":      fiber.Map{"post": fiber.Map{"summary": "Issue a key's successor; the old key stays valid for its overlap so clients can switch over"}},
+			"/auth/api-keys/{id}/acknowledge": fiber.Map{"post": fiber.Map{"summary": "Confirm clients moved off a rotated key, ending its overlap early"}},
 
 			"/users/me":    fiber.Map{"get": fiber.Map{"summary": "Get current user profile"}},
 			"/users/usage": fiber.Map{"get": fiber.Map{"summary": "Get usage stats"}},
-
-			"/datasets":               fiber.Map{"get": fiber.Map{"summary": "List datasets"}},
-			"/datasets/upload":        fiber.Map{"post": fiber.Map{"summary": "Upload dataset"}},
-			"/datasets/{id}":          fiber.Map{"get": fiber.Map{"summary": "Get dataset"}, "delete": fiber.Map{"summary": "Delete dataset"}},
-			"/datasets/{id}/preview":  fiber.Map{"get": fiber.Map{"summary": "Preview dataset"}},
-			"/datasets/{id}/download": fiber.Map{"get": fiber.Map{"summary": "Download dataset"}},
-
-			"/generation/generate":           fiber.Map{"post": fiber.Map{"summary": "Start generation"}},
-			"/generation/jobs":               fiber.Map{"get": fiber.Map{"summary": "List generation jobs"}},
-			"/generation/jobs/{id}":          fiber.Map{"get": fiber.Map{"summary": "Get generation job"}, "delete": fiber.Map{"summary": "Cancel job"}},
-			"/generation/jobs/{id}/download": fiber.Map{"get": fiber.Map{"summary": "Download generated data"}},
+			"/users/email-change": fiber.Map{
+				"post":   fiber.Map{"summary": "Request an email change (new_email, password); verification goes to the new address"},
+				"get":    fiber.Map{"summary": "Get the pending or held email change"},
+				"delete": fiber.Map{"summary": "Cancel the open email change"},
+			},
+			"/users/merge":         fiber.Map{"post": fiber.Map{"summary": "Request merging a duplicate account by its email; approval goes to that address"}},
+			"/users/merge/confirm": fiber.Map{"post": fiber.Map{"summary": "Merge a duplicate account with its approval token, moving datasets, jobs, API keys and billing history"}},
+			"/users/sla":           fiber.Map{"get": fiber.Map{"summary": "Monthly SLA attainment reports and billing credits"}},
+			"/users/usage/invoice": fiber.Map{"get": fiber.Map{"summary": "Metered usage of a billing period (?period=YYYY-MM) with what the plan includes and the overage billed past it"}},
+			"/users/permissions":   fiber.Map{"get": fiber.Map{"summary": "The caller's roles and permissions, narrowed by the scopes of the API key in use"}},
+			"/users/notifications": fiber.Map{"get": fiber.Map{"summary": "Recent notifications"}},
+			"/users/notification-preferences": fiber.Map{
+				"get": fiber.Map{"summary": "Get notification digest preferences"},
+				"put": fiber.Map{"summary": "Set notification digest frequency (immediate, hourly, daily, off)"},
+			},
+			"/legal/documents":       fiber.Map{"get": fiber.Map{"summary": "Current versions of the terms of service and privacy policy"}},
+			"/changelog":             fiber.Map{"get": fiber.Map{"summary": "Published release notes, newest version first (since=VERSION for newer ones, feature= for one feature area); no account needed"}},
+			"/users/consent":         fiber.Map{"get": fiber.Map{"summary": "Accepted document versions, documents still to accept and email consent"}},
+			"/users/consent/accept":  fiber.Map{"post": fiber.Map{"summary": "Accept the current version of legal documents; other routes answer 403 consent_required until a new major version is accepted"}},
+			"/users/consent/email":   fiber.Map{"put": fiber.Map{"summary": "Opt in to or out of marketing emails and product updates"}},
+			"/users/consent/history": fiber.Map{"get": fiber.Map{"summary": "Consent records, newest first"}},
+			"/usage/providers":       fiber.Map{"get": fiber.Map{"summary": "Generation usage by provider and model (rows, tokens, cost, quality)"}},
+
+			"/orgs":                    fiber.Map{"post": fiber.Map{"summary": "Create an organization with the caller as owner"}},
+			"/orgs/invitations/accept": fiber.Map{"post": fiber.Map{"summary": "Join an organization with an invitation token sent to the caller's address"}},
+			"/orgs/current":            fiber.Map{"get": fiber.Map{"summary": "The caller's organization and role (owner, admin, member, viewer or auditor)"}},
+			"/orgs/current/leave":      fiber.Map{"post": fiber.Map{"summary": "Leave the organization; what the caller created stays shared with it"}},
+			"/orgs/current/usage":      fiber.Map{"get": fiber.Map{"summary": "This month's rows, jobs, datasets and custom models of the organization, in total and per member"}},
+			"/orgs/current/members":    fiber.Map{"get": fiber.Map{"summary": "List organization members"}},
+			"/orgs/current/members/{user_id}": fiber.Map{
+				"put":    fiber.Map{"summary": "Change a member's role (admins and owners; only owners make owners)"},
+				"delete": fiber.Map{"summary": "Remove a member"},
+			},
+			"/orgs/current/invitations": fiber.Map{
+				"get":  fiber.Map{"summary": "List open invitations"},
+				"post": fiber.Map{"summary": "Invite an email address with a role and optional team; the invitation link is emailed"},
+			},
+			"/orgs/current/invitations/{id}": fiber.Map{"delete": fiber.Map{"summary": "Revoke an invitation"}},
+			"/orgs/current/invitations/imports": fiber.Map{
+				"get":  fiber.Map{"summary": "List CSV member imports with their invited, skipped, failed and invalid counts"},
+				"post": fiber.Map{"summary": "Upload a CSV of email, role and team to invite; rows are validated at once and invited in the background at a throttled rate"},
+			},
+			"/orgs/current/invitations/imports/{id}":       fiber.Map{"get": fiber.Map{"summary": "A member import with the result of each row; status= keeps one status, such as failed"}},
+			"/orgs/current/invitations/imports/{id}/retry": fiber.Map{"post": fiber.Map{"summary": "Invite the failed rows of an import again; addresses already members or invited are skipped"}},
+			"/orgs/current/policies":                       fiber.Map{"get": fiber.Map{"summary": "Capabilities admins may disable (warehouse_delivery, public_sharing, non_eu_providers), whether each is enabled and, for admins, attempts in the last 30 days"}},
+			"/orgs/current/policies/violations":            fiber.Map{"get": fiber.Map{"summary": "Members' refused attempts to use disabled capabilities, newest first; capability= keeps those of one"}},
+			"/orgs/current/policies/{capability}": fiber.Map{
+				"put":    fiber.Map{"summary": "Disable a capability for every member, with an optional reason shown to them; refused requests get 403 capability_disabled"},
+				"delete": fiber.Map{"summary": "Allow a disabled capability again"},
+			},
+			"/orgs/current/branding": fiber.Map{
+				"get":    fiber.Map{"summary": "White-label branding, plan eligibility and the DNS TXT record that verifies the API hostname"},
+				"put":    fiber.Map{"summary": "Set display name, logos, email from-address and API hostname (Professional plans and above; admins and owners)"},
+				"delete": fiber.Map{"summary": "Remove branding; members get the default brand again"},
+			},
+			"/orgs/current/branding/verify": fiber.Map{"post": fiber.Map{"summary": "Check the TXT record; once verified, email and download links use the API hostname and the from-address"}},
+			"/orgs/current/output-bucket": fiber.Map{
+				"get":    fiber.Map{"summary": "The S3 or GCS bucket outputs are delivered to, its status, and the platform principals to grant (admins)"},
+				"put":    fiber.Map{"summary": "Register an S3 bucket with the role to assume, or a GCS bucket with the service account to impersonate; write, read and delete are checked at once"},
+				"delete": fiber.Map{"summary": "Remove the bucket; new outputs go to platform storage and delivered outputs can no longer be downloaded"},
+			},
+			"/orgs/current/output-bucket/verify": fiber.Map{"post": fiber.Map{"summary": "Check the bucket's permissions again; jobs cannot start while it is unverified"}},
+			"/orgs/current/usage/costs":          fiber.Map{"get": fiber.Map{"summary": "Cost report: provider spend per model by month, next month's forecast, and cheaper model mixes or committed-use configurations with their savings (admins)"}},
+			"/orgs/current/usage/capacity":       fiber.Map{"get": fiber.Map{"summary": "Daily and hour-of-week generation volume with projected rows, jobs, cost and peak hourly load (admins)"}},
+			"/orgs/current/audit/generations":    fiber.Map{"get": fiber.Map{"summary": "Search members' generation jobs by source column, dataset, user and date (admins and auditors)"}},
+
+			"/datasets":                                       fiber.Map{"get": fiber.Map{"summary": "List datasets (scope=org lists those shared with the caller's organization, collection=ID those a saved collection matches)"}},
+			"/datasets/collections":                           fiber.Map{"get": fiber.Map{"summary": "List saved and org-shared dataset collections with their current dataset counts"}, "post": fiber.Map{"summary": "Save search criteria as a named collection, optionally shared with the organization"}},
+			"/datasets/collections/{id}":                      fiber.Map{"get": fiber.Map{"summary": "Get a dataset collection"}, "put": fiber.Map{"summary": "Update a collection's name, criteria and sharing"}, "delete": fiber.Map{"summary": "Delete a dataset collection"}},
+			"/datasets/upload":                                fiber.Map{"post": fiber.Map{"summary": "Upload dataset"}},
+			"/datasets/sources":                               fiber.Map{"get": fiber.Map{"summary": "List my PostgreSQL and MySQL dataset sources"}, "post": fiber.Map{"summary": "Register a read-only database connection; it must connect, and the password is sealed under the KMS key"}},
+			"/datasets/sources/{id}":                          fiber.Map{"get": fiber.Map{"summary": "Get a dataset source"}, "delete": fiber.Map{"summary": "Delete a dataset source; datasets sampled from it are kept"}},
+			"/datasets/sources/{id}/test":                     fiber.Map{"post": fiber.Map{"summary": "Test a dataset source's connection and record the result"}},
+			"/datasets/sources/{id}/tables":                   fiber.Map{"get": fiber.Map{"summary": "Introspect the tables and views of a source with their columns and estimated rows"}},
+			"/datasets/sources/{id}/import":                   fiber.Map{"post": fiber.Map{"summary": "Create a dataset from a random sample of a source table, up to the sampling limit"}},
+			"/datasets/vocabularies":                          fiber.Map{"get": fiber.Map{"summary": "List controlled vocabularies"}, "post": fiber.Map{"summary": "Upload a controlled vocabulary, as JSON entries or a CSV file with value, label and weight columns"}},
+			"/datasets/vocabularies/{vocabularyId}":           fiber.Map{"get": fiber.Map{"summary": "Get a controlled vocabulary with its entries"}, "delete": fiber.Map{"summary": "Delete a controlled vocabulary no column is bound to"}},
+			"/datasets/{id}":                                  fiber.Map{"get": fiber.Map{"summary": "Get dataset"}, "delete": fiber.Map{"summary": "Delete dataset"}},
+			"/datasets/{id}/preview":                          fiber.Map{"get": fiber.Map{"summary": "Preview dataset"}},
+			"/datasets/{id}/download":                         fiber.Map{"get": fiber.Map{"summary": "Issue a short-lived download URL (bind_ip=true to bind it to the caller)"}},
+			"/datasets/{id}/download-urls/revoke":             fiber.Map{"post": fiber.Map{"summary": "Revoke one or all outstanding download URLs"}},
+			"/downloads/{token}":                              fiber.Map{"get": fiber.Map{"summary": "Redeem a download URL"}},
+			"/datasets/shared":                                fiber.Map{"get": fiber.Map{"summary": "List datasets shared with me"}},
+			"/datasets/{id}/grants":                           fiber.Map{"get": fiber.Map{"summary": "List dataset grants"}, "post": fiber.Map{"summary": "Grant read or generate to a user or group"}},
+			"/datasets/{id}/grants/{grantId}":                 fiber.Map{"delete": fiber.Map{"summary": "Revoke a dataset grant"}},
+			"/datasets/{id}/columns":                          fiber.Map{"get": fiber.Map{"summary": "List restricted columns and clearances"}},
+			"/datasets/{id}/columns/restrictions":             fiber.Map{"put": fiber.Map{"summary": "Restrict a column (export_action: exclude or tokenize)"}},
+			"/datasets/{id}/columns/restrictions/{column}":    fiber.Map{"delete": fiber.Map{"summary": "Lift a column restriction"}},
+			"/datasets/{id}/columns/clearances":               fiber.Map{"post": fiber.Map{"summary": "Clear a user or group to see a restricted column"}},
+			"/datasets/{id}/columns/clearances/{clearanceId}": fiber.Map{"delete": fiber.Map{"summary": "Revoke a column clearance"}},
+			"/datasets/{id}/data-policy":                      fiber.Map{"put": fiber.Map{"summary": "Restrict a dataset to zero-real-data generation"}},
+			"/datasets/{id}/weights":                          fiber.Map{"get": fiber.Map{"summary": "Get the weighted profile of a dataset"}, "put": fiber.Map{"summary": "Set or clear the sampling weight column of a dataset"}},
+			"/datasets/{id}/schema":                           fiber.Map{"get": fiber.Map{"summary": "Profiled columns and their annotations"}},
+			"/datasets/{id}/schema/history":                   fiber.Map{"get": fiber.Map{"summary": "Annotation version history (column= to filter)"}},
+			"/datasets/{id}/schema/columns/{column}":          fiber.Map{"put": fiber.Map{"summary": "Annotate a column (unique, value range, description, sensitive)"}, "delete": fiber.Map{"summary": "Remove a column annotation"}},
+			"/datasets/{id}/relationships/discover":           fiber.Map{"post": fiber.Map{"summary": "Discover correlations and functional dependencies as hints"}},
+			"/datasets/{id}/relationships":                    fiber.Map{"get": fiber.Map{"summary": "List relationship hints (status= to filter)"}},
+			"/datasets/{id}/relationships/{hintId}":           fiber.Map{"put": fiber.Map{"summary": "Accept or reject a relationship hint"}},
+			"/datasets/{id}/hierarchies":                      fiber.Map{"get": fiber.Map{"summary": "List categorical hierarchies"}, "post": fiber.Map{"summary": "Declare a categorical hierarchy, from a taxonomy or observed paths"}},
+			"/datasets/{id}/hierarchies/{hierarchyId}":        fiber.Map{"delete": fiber.Map{"summary": "Remove a categorical hierarchy"}},
+			"/datasets/{id}/vocabularies":                     fiber.Map{"get": fiber.Map{"summary": "List the controlled vocabularies bound to columns"}},
+			"/datasets/{id}/vocabularies/{column}":            fiber.Map{"put": fiber.Map{"summary": "Bind a column to a controlled vocabulary, weighted uniformly, by listed weights or by source frequencies; generated values are drawn from it only"}, "delete": fiber.Map{"summary": "Unbind a column from its vocabulary"}},
+			"/datasets/{id}/nested-columns":                   fiber.Map{"get": fiber.Map{"summary": "Profile nested JSON columns: key frequency, value types and inferred JSON Schema"}},
+			"/datasets/{id}/array-columns":                    fiber.Map{"get": fiber.Map{"summary": "Profile array columns: encoding, list lengths and element distribution"}},
+			"/datasets/{id}/free-text":                        fiber.Map{"get": fiber.Map{"summary": "Profile free-text columns: lengths, languages, PII found and scrubbed examples"}},
+			"/datasets/{id}/structure":                        fiber.Map{"get": fiber.Map{"summary": "Profile duplicate rows and group sizes under a group_by column"}},
+			"/datasets/{id}/pii":                              fiber.Map{"get": fiber.Map{"summary": "List the columns the ingestion PII scan classified: kinds, category, share and detectors"}},
+			"/datasets/{id}/pii/scan":                         fiber.Map{"post": fiber.Map{"summary": "Scan a dataset for PII again with patterns, column names and the optional NER provider"}},
+			"/datasets/{id}/privacy/columns":                  fiber.Map{"get": fiber.Map{"summary": "List per-column privacy settings"}},
+			"/datasets/{id}/privacy/columns/{column}":         fiber.Map{"put": fiber.Map{"summary": "Set a column's privacy category, mechanism and epsilon budget"}, "delete": fiber.Map{"summary": "Remove a column's privacy setting"}},
+			"/datasets/{id}/fixed-width-layout":               fiber.Map{"get": fiber.Map{"summary": "Get the fixed-width export layout"}, "put": fiber.Map{"summary": "Set field widths, padding, encoding (including EBCDIC) and overflow handling for fixed-width exports"}, "delete": fiber.Map{"summary": "Remove the fixed-width export layout"}},
+			"/datasets/{id}/quality-policy":                   fiber.Map{"get": fiber.Map{"summary": "Get the quality policy generated rows are held to"}, "put": fiber.Map{"summary": "Set minimum similarity, maximum correlation drift, privacy risk ceiling and minimum quality score, and whether failing output is retried with fallback strategies or failed"}, "delete": fiber.Map{"summary": "Remove the quality policy"}},
+			"/datasets/{id}/fhir-mapping":                     fiber.Map{"get": fiber.Map{"summary": "Get the FHIR export mapping"}, "put": fiber.Map{"summary": "Map columns to FHIR R4 Patient, Encounter and Observation elements for FHIR bundle exports"}, "delete": fiber.Map{"summary": "Remove the FHIR export mapping"}},
+			"/datasets/{id}/financial-message-layout":         fiber.Map{"get": fiber.Map{"summary": "Get the payment message layout"}, "put": fiber.Map{"summary": "Set the ISO 20022 pain.001/camt.053 or MT103 message type, transaction columns and envelope for payment message exports"}, "delete": fiber.Map{"summary": "Remove the payment message layout"}},
+			"/privacy/budget/{dataset_id}":                    fiber.Map{"get": fiber.Map{"summary": "Differential privacy budget spent and remaining on a dataset, with recent charges"}},
+
+			"/groups":                       fiber.Map{"get": fiber.Map{"summary": "List my groups"}, "post": fiber.Map{"summary": "Create group"}},
+			"/groups/{id}":                  fiber.Map{"get": fiber.Map{"summary": "Get group with members"}},
+			"/groups/{id}/members":          fiber.Map{"post": fiber.Map{"summary": "Add group member"}},
+			"/groups/{id}/members/{userId}": fiber.Map{"delete": fiber.Map{"summary": "Remove group member"}},
+
+			"/generation/generate":                       fiber.Map{"post": fiber.Map{"summary": "Start generation; export_formats writes the rows in further formats at once, such as csv, parquet and sql, and is refused by multi-table and event stream jobs; template_id fills unset settings from a saved template, template_version pins one of its versions"}},
+			"/generation/multi-table":                    fiber.Map{"post": fiber.Map{"summary": "Start generating related tables from several datasets; foreign keys reference generated parents with the source's children per parent, delivered as a zip of one file per table and a manifest with integrity checks"}},
+			"/generation/events":                         fiber.Map{"post": fiber.Map{"summary": "Start generating a product-analytics event stream of sessions, funnels and retention, as Segment or Amplitude JSON Lines; no dataset is read"}},
+			"/generation/jobs":                           fiber.Map{"get": fiber.Map{"summary": "List generation jobs (scope=org lists those shared with the caller's organization)"}},
+			"/generation/defaults":                       fiber.Map{"get": fiber.Map{"summary": "Settings new jobs start with, from org defaults"}},
+			"/generation/templates":                      fiber.Map{"get": fiber.Map{"summary": "List my generation templates (scope=org lists those shared with my organization)"}, "post": fiber.Map{"summary": "Save generation config, realism and privacy settings as a named template, shared with my organization when shared is set"}},
+			"/generation/templates/{id}":                 fiber.Map{"get": fiber.Map{"summary": "Get a generation template"}, "put": fiber.Map{"summary": "Save new settings as the template's next version (owner only)"}, "delete": fiber.Map{"summary": "Delete a template and its history (owner or organization admin)"}},
+			"/generation/templates/{id}/versions":        fiber.Map{"get": fiber.Map{"summary": "Versions of a generation template, newest first"}},
+			"/generation/jobs/{id}":                      fiber.Map{"get": fiber.Map{"summary": "Get generation job; quality_details.recommendations estimates what other models would have cost and scored on it, from past jobs of its dataset or the platform"}, "delete": fiber.Map{"summary": "Cancel job"}},
+			"/generation/jobs/{id}/status":               fiber.Map{"get": fiber.Map{"summary": "Poll job status and progress"}},
+			"/generation/{id}/status":                    fiber.Map{"get": fiber.Map{"summary": "Poll job status and progress (alias)"}},
+			"/generation/{id}/stream":                    fiber.Map{"get": fiber.Map{"summary": "Live progress, row batches and quality over SSE, or WebSocket on upgrade"}},
+			"/generation/{id}/cancel":                    fiber.Map{"post": fiber.Map{"summary": "Cancel a job; a running job is interrupted and its unused rows returned to the monthly quota"}},
+			"/generation/{id}/pause":                     fiber.Map{"post": fiber.Map{"summary": "Take a queued or running job off the queue; it starts over when resumed"}},
+			"/generation/{id}/resume":                    fiber.Map{"post": fiber.Map{"summary": "Queue a paused job again"}},
+			"/generation/jobs/{id}/download":             fiber.Map{"get": fiber.Map{"summary": "Download generated data, with the status and a signed URL of each further export format; format=csv, csv_gzip, json, jsonl, parquet, avro, xlsx or sql streams it converted, as the plan allows"}},
+			"/generation/jobs/{id}/warehouse-exports":    fiber.Map{"get": fiber.Map{"summary": "Warehouse exports of a job"}, "post": fiber.Map{"summary": "Queue a completed job for loading into a warehouse destination"}},
+			"/generation/{id}/artifacts":                 fiber.Map{"get": fiber.Map{"summary": "Manifest of a completed job's data files, reports and manifests with sizes, SHA-256 checksums, and signed links with their expiry where the caller may download"}},
+			"/generation/{id}/artifacts/{name}":          fiber.Map{"get": fiber.Map{"summary": "A report or manifest of a job, byte for byte as checksummed in its artifacts manifest"}},
+			"/generation/{id}/report":                    fiber.Map{"get": fiber.Map{"summary": "Evaluation report of a completed job with distribution charts, correlation heatmaps, privacy metrics and compliance flags; format=html (default) or pdf"}},
+			"/generation/{id}/signed-manifest":           fiber.Map{"get": fiber.Map{"summary": "Artifacts manifest of a completed job signed with the platform Ed25519 key; files=true adds a detached signature per file"}},
+			"/export-signatures/keys":                    fiber.Map{"get": fiber.Map{"summary": "Public keys export manifests are signed with, the active key and retired ones that still verify; no account needed"}},
+			"/export-signatures/verify":                  fiber.Map{"post": fiber.Map{"summary": "Check a signed manifest (payload, signature, key_id) and optionally file name and sha256 pairs against it; no account needed"}},
+			"/export-signatures/verify-file":             fiber.Map{"post": fiber.Map{"summary": "Check the detached signature of one file (key_id, job_id, name, sha256, signature); no account needed"}},
+			"/generation/{id}/download":                  fiber.Map{"get": fiber.Map{"summary": "Download generated data (alias)"}},
+			"/generation/jobs/{id}/grounding-sample":     fiber.Map{"get": fiber.Map{"summary": "Masked example rows shared with the provider for a job"}},
+			"/generation/jobs/{id}/access":               fiber.Map{"get": fiber.Map{"summary": "List my output access grants for a job"}, "post": fiber.Map{"summary": "Request access to an encrypted job output"}},
+			"/generation/jobs/{id}/access/{grantId}/key": fiber.Map{"post": fiber.Map{"summary": "Release the output data key under an active grant"}},
+			"/generation/jobs/{id}/lineage":              fiber.Map{"get": fiber.Map{"summary": "Data mode, masking and provider lineage of a job"}},
+			"/generation/jobs/{id}/provenance":           fiber.Map{"get": fiber.Map{"summary": "Provenance manifest of a job's rows: job, chunk, prompt template version and generation time per row range; ?row=N returns the chunk of one output row"}},
+			"/generation/jobs/{id}/watermark/verify":     fiber.Map{"post": fiber.Map{"summary": "Test rows for the watermark of a free-plan job: matching and checked values, z-score and p-value"}},
+
+			"/webhooks":                 fiber.Map{"get": fiber.Map{"summary": "List my webhook endpoints"}, "post": fiber.Map{"summary": "Register a webhook endpoint; the signing secret is returned once"}},
+			"/webhooks/event-types":     fiber.Map{"get": fiber.Map{"summary": "List event types webhooks can subscribe to"}},
+			"/webhooks/{id}":            fiber.Map{"get": fiber.Map{"summary": "Get a webhook endpoint"}, "put": fiber.Map{"summary": "Update a webhook endpoint"}, "delete": fiber.Map{"summary": "Delete a webhook endpoint"}},
+			"/webhooks/{id}/deliveries": fiber.Map{"get": fiber.Map{"summary": "Delivery history of a webhook endpoint"}},
+			"/webhooks/{id}/deliveries/{deliveryId}/redeliver": fiber.Map{"post": fiber.Map{"summary": "Retry a webhook delivery"}},
+			"/warehouses":                 fiber.Map{"get": fiber.Map{"summary": "List my warehouse destinations"}, "post": fiber.Map{"summary": "Add a BigQuery, Snowflake or Redshift destination; credentials are encrypted and never returned"}},
+			"/warehouses/test":            fiber.Map{"post": fiber.Map{"summary": "Test the connection of unsaved destination settings"}},
+			"/warehouses/{id}":            fiber.Map{"get": fiber.Map{"summary": "Get a warehouse destination"}, "put": fiber.Map{"summary": "Update a warehouse destination; credentials left out are kept"}, "delete": fiber.Map{"summary": "Delete a warehouse destination"}},
+			"/warehouses/{id}/test":       fiber.Map{"post": fiber.Map{"summary": "Test a warehouse destination's connection and record the result"}},
+			"/warehouses/{id}/deliveries": fiber.Map{"get": fiber.Map{"summary": "Export history of a warehouse destination"}},
+
+			"/mock-apis":                fiber.Map{"get": fiber.Map{"summary": "List my mock APIs"}, "post": fiber.Map{"summary": "Host a completed job's rows as a mock REST API (job_id, ttl_hours, requests_per_minute), within the plan's mocks, rate and lifetime"}},
+			"/mock-apis/{id}":           fiber.Map{"get": fiber.Map{"summary": "Get a mock API with the path it is served at"}, "delete": fiber.Map{"summary": "Take a mock API down"}},
+			"/mock/{public_id}/records": fiber.Map{"get": fiber.Map{"summary": "Public mock records with json-server style filters (field, field_ne, field_gte, field_lte, field_like), _sort, _order, _page and _limit; the total is in X-Total-Count"}},
+			"/mock/{public_id}/schema":  fiber.Map{"get": fiber.Map{"summary": "Fields and types of a mock's records"}},
 
 			"/payment/plans":         fiber.Map{"get": fiber.Map{"summary": "List pricing plans"}},
 			"/payment/checkout":      fiber.Map{"post": fiber.Map{"summary": "Create checkout session"}},
 			"/payment/subscription":  fiber.Map{"get": fiber.Map{"summary": "Get current subscription"}},
 			"/payment/contact-sales": fiber.Map{"post": fiber.Map{"summary": "Contact sales"}},
+			"/billing/portal":        fiber.Map{"post": fiber.Map{"summary": "Open the Stripe or Paddle billing portal to manage payment methods, invoices and the subscription"}},
 
 			"/analytics/performance":   fiber.Map{"get": fiber.Map{"summary": "Get performance analytics"}},
 			"/analytics/prompt-cache":  fiber.Map{"get": fiber.Map{"summary": "Get prompt cache stats"}},
@@ -191,7 +665,51 @@ func APIDocs(c *fiber.Ctx) error {
 			"/feedback":                fiber.Map{"post": fiber.Map{"summary": "Submit feedback (alias)"}},
 			"/feedback/{id}":           fiber.Map{"get": fiber.Map{"summary": "Get feedback (alias)"}},
 
-			"/custom-models":               fiber.Map{"get": fiber.Map{"summary": "List custom models"}},
+			"/admin/orgs/{id}/anonymization-policy": fiber.Map{"get": fiber.Map{"summary": "Get org IP/user agent anonymization policy"}, "put": fiber.Map{"summary": "Set org IP/user agent anonymization policy"}},
+			"/admin/orgs/{id}/data-policy":          fiber.Map{"get": fiber.Map{"summary": "Get org zero-real-data policy"}, "put": fiber.Map{"summary": "Set org zero-real-data policy"}},
+			"/admin/orgs/{id}/settings":             fiber.Map{"get": fiber.Map{"summary": "Get org defaults for new jobs and datasets"}, "put": fiber.Map{"summary": "Set org defaults and which are mandatory"}},
+			"/admin/users":                          fiber.Map{"get": fiber.Map{"summary": "Search users by part of their email, name or company (q), tier and status (active or suspended); limit, offset"}},
+			"/admin/users/{id}/org":                 fiber.Map{"put": fiber.Map{"summary": "Assign a user to an organization"}},
+			"/admin/users/{id}/roles":               fiber.Map{"get": fiber.Map{"summary": "A user's account role and the roles assigned on top"}, "put": fiber.Map{"summary": "Replace the roles assigned to a user"}},
+			"/admin/users/{id}":                     fiber.Map{"get": fiber.Map{"summary": "A user with their organization, usage against their limits and quota override"}},
+			"/admin/users/{id}/jobs":                fiber.Map{"get": fiber.Map{"summary": "A user's generation jobs, newest first (limit, offset)"}},
+			"/admin/users/{id}/datasets":            fiber.Map{"get": fiber.Map{"summary": "The datasets a user owns (limit, offset)"}},
+			"/admin/users/{id}/suspend":             fiber.Map{"post": fiber.Map{"summary": "Suspend an account and revoke its sessions (reason)"}},
+			"/admin/users/{id}/reactivate":          fiber.Map{"post": fiber.Map{"summary": "Let a suspended account sign in again"}},
+			"/admin/users/{id}/subscription":        fiber.Map{"put": fiber.Map{"summary": "Change a user's subscription tier by hand (tier, reason); the payment provider's next event for them sets it again"}},
+			"/admin/users/{id}/quota-override":      fiber.Map{"get": fiber.Map{"summary": "A user's quota override"}, "put": fiber.Map{"summary": "Grant limits in place of the plan's (monthly_row_limit, max_datasets, max_custom_models, api_rate_limit, reason, expires_at); 0 lifts a limit"}, "delete": fiber.Map{"summary": "Return a user to their plan's limits"}},
+			"/admin/users/{id}/impersonate":         fiber.Map{"post": fiber.Map{"summary": "A 30 minute access token acting as a user, for support (reason); every change made with it is audited and staff cannot be impersonated"}},
+			"/admin/impersonations/{id}":            fiber.Map{"delete": fiber.Map{"summary": "Revoke an impersonation token by its impersonation_id"}},
+			"/admin/rbac/permissions":               fiber.Map{"get": fiber.Map{"summary": "List the permissions roles can grant (resource:action, resource:* or *)"}},
+			"/admin/rbac/roles":                     fiber.Map{"get": fiber.Map{"summary": "List roles and their permissions"}},
+			"/admin/rbac/roles/{name}":              fiber.Map{"put": fiber.Map{"summary": "Create a role or replace its permissions"}, "delete": fiber.Map{"summary": "Delete a role that is not built in"}},
+			"/admin/output-access":                  fiber.Map{"get": fiber.Map{"summary": "List output access grants (status=requested by default)"}},
+			"/admin/output-access/{id}/decision":    fiber.Map{"post": fiber.Map{"summary": "Approve or deny an output access request"}},
+			"/admin/output-access/{id}/revoke":      fiber.Map{"post": fiber.Map{"summary": "Revoke an output access grant"}},
+			"/admin/analytics/revenue":              fiber.Map{"get": fiber.Map{"summary": "MRR, churn, expansion and cohort LTV with period comparison"}},
+			"/admin/sla/reports":                    fiber.Map{"get": fiber.Map{"summary": "List SLA reports for a month (month=YYYY-MM)"}},
+			"/admin/sla/reports/generate":           fiber.Map{"post": fiber.Map{"summary": "Compute SLA reports and issue credits for a month"}},
+			"/admin/evidence/package":               fiber.Map{"get": fiber.Map{"summary": "Zip of access logs, admin actions, retention receipts, security events, SLA reports and configuration for start..end (YYYY-MM-DD) with an Ed25519-signed manifest"}},
+			"/admin/audit/generations":              fiber.Map{"get": fiber.Map{"summary": "Who generated data from which columns: search jobs by column, dataset_id, user_id, org_id and start..end (YYYY-MM-DD), with row counts, privacy settings, masking and sample sharing"}},
+			"/admin/watermark/verify":               fiber.Map{"post": fiber.Map{"summary": "Test rows found elsewhere for the watermark of any job_id, to prove they came from it"}},
+			"/admin/changelog":                      fiber.Map{"get": fiber.Map{"summary": "List changelog entries, drafts included"}, "post": fiber.Map{"summary": "Write a draft changelog entry (version, title, body, features)"}},
+			"/admin/changelog/{id}":                 fiber.Map{"put": fiber.Map{"summary": "Update a changelog entry"}, "delete": fiber.Map{"summary": "Delete a changelog entry"}},
+			"/admin/changelog/{id}/publish":         fiber.Map{"post": fiber.Map{"summary": "Publish a changelog entry and notify users of its feature areas in the app"}},
+			"/admin/incidents/timeline":             fiber.Map{"get": fiber.Map{"summary": "Alerts, security events, deployments and job failure spikes of a window (from, to or around; bucket_minutes) in one timeline; spikes list the events just before them"}},
+			"/admin/incidents/deployments":          fiber.Map{"post": fiber.Map{"summary": "Record a deployment marker (service, version, description, deployed_at)"}},
+			"/admin/housekeeping/suggestions":       fiber.Map{"get": fiber.Map{"summary": "Unused datasets, orphaned outputs, never-used API keys and idle custom models (kind) with the storage and monthly cost cleaning them up would save"}},
+			"/admin/housekeeping/policies":          fiber.Map{"get": fiber.Map{"summary": "Cleanup policy of every kind of stale resource"}},
+			"/admin/housekeeping/policies/{kind}":   fiber.Map{"put": fiber.Map{"summary": "Turn automated cleanup of a kind on or off (enabled, idle_days); audited"}},
+			"/admin/reports/catalog":                fiber.Map{"get": fiber.Map{"summary": "List report metrics, dimensions and chart types"}},
+			"/admin/reports/templates":              fiber.Map{"get": fiber.Map{"summary": "List report templates"}, "post": fiber.Map{"summary": "Create report template"}},
+			"/admin/reports/templates/{id}":         fiber.Map{"get": fiber.Map{"summary": "Get report template"}, "put": fiber.Map{"summary": "Update report template"}, "delete": fiber.Map{"summary": "Delete report template"}},
+			"/admin/reports/templates/{id}/run":     fiber.Map{"post": fiber.Map{"summary": "Generate a report now (deliver=true to send it)"}},
+			"/admin/reports/templates/{id}/runs":    fiber.Map{"get": fiber.Map{"summary": "List report runs"}},
+			"/admin/debug/pprof/{profile}":          fiber.Map{"get": fiber.Map{"summary": "Runtime profiles (heap, goroutine, allocs, block, mutex, profile?seconds=, trace) from allowlisted networks"}},
+			"/admin/debug/heap-dumps":               fiber.Map{"get": fiber.Map{"summary": "List heap dumps captured on demand or by the memory health check"}, "post": fiber.Map{"summary": "Capture a heap dump now (reason=)"}},
+			"/admin/debug/heap-dumps/{name}":        fiber.Map{"get": fiber.Map{"summary": "Download a heap dump for go tool pprof"}},
+
+			"/custom-models":               fiber.Map{"get": fiber.Map{"summary": "List custom models (scope=org lists those shared with the caller's organization)"}},
 			"/custom-models/upload":        fiber.Map{"post": fiber.Map{"summary": "Upload custom model file"}},
 			"/custom-models/{id}":          fiber.Map{"get": fiber.Map{"summary": "Get custom model"}, "delete": fiber.Map{"summary": "Delete custom model"}},
 			"/custom-models/{id}/validate": fiber.Map{"post": fiber.Map{"summary": "Validate custom model"}},
@@ -203,10 +721,10 @@ func APIDocs(c *fiber.Ctx) error {
 			"/vertex/health":         fiber.Map{"get": fiber.Map{"summary": "Vertex health check"}},
 			"/vertex/pricing":        fiber.Map{"get": fiber.Map{"summary": "Model pricing"}},
 		},
-	})
+	}
 }
 
-// APIDocsUI serves Swagger UI that consumes /api/v1/docs
+// APIDocsUI serves Swagger UI that consumes /api/v1/openapi.json
 func APIDocsUI(c *fiber.Ctx) error {
 	html := `<!DOCTYPE html>
 <html lang="en">
@@ -220,7 +738,7 @@ func APIDocsUI(c *fiber.Ctx) error {
     // resolve base path in case of proxies
     function resolveSpecUrl() {
       var base = window.location.origin;
-      var spec = '/api/v1/docs';
+      var spec = '/api/v1/openapi.json';
       return base + spec;
     }
   </script>
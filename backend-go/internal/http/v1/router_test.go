@@ -0,0 +1,96 @@
+// Package v1_test provides unit tests for the checks the router puts in
+// front of signed-in routes
+package v1_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/consent"
+	v1 "github.com/genovotechnologies/synthos_dev/backend-go/internal/http/v1"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeys(t *testing.T) *auth.KeyRing {
+	t.Helper()
+	key, err := auth.ParseKey("test", "HS256", []byte("router-test-secret-0123456789abcdef"))
+	require.NoError(t, err)
+	keys, err := auth.NewKeyRing(key)
+	require.NoError(t, err)
+	return keys
+}
+
+func accessToken(t *testing.T, keys *auth.KeyRing, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := auth.CreateAccessToken(keys, claims, 15)
+	require.NoError(t, err)
+	return token
+}
+
+// routerApp serves the whole v1 router with the given dependencies,
+// authenticating tokens signed by keys
+func routerApp(keys *auth.KeyRing, d v1.Deps) *fiber.App {
+	d.Auth.Keys = keys
+	d.Auth.Blacklist = auth.NewBlacklist(nil)
+	app := fiber.New()
+	v1.Register(app, d)
+	return app
+}
+
+func callAs(t *testing.T, app *fiber.App, method, path, token string) (int, map[string]any) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	raw, _ := io.ReadAll(resp.Body)
+	var out map[string]any
+	_ = json.Unmarshal(raw, &out)
+	return resp.StatusCode, out
+}
+
+func expectConsent(testDB *testutil.TestDB, userID int64, termsVersion string) {
+	testDB.Mock.ExpectQuery("FROM consent_records").WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "kind", "version", "granted", "ip_address", "user_agent", "created_at"}).
+			AddRow(1, userID, string(models.ConsentTerms), termsVersion, true, "", "", time.Now()))
+}
+
+func TestSignedInRoutesRequireConsent(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	keys := testKeys(t)
+	app := routerApp(keys, v1.Deps{Consent: v1.ConsentDeps{
+		Consents:  repo.NewConsentRepo(testDB.DB),
+		Documents: consent.Documents{models.ConsentTerms: "2.0"},
+	}})
+	token := accessToken(t, keys, jwt.MapClaims{"user_id": 7})
+
+	// User 7 accepted the terms before their second major version
+	expectConsent(testDB, 7, "1.4")
+	status, body := callAs(t, app, "GET", "/api/v1/datasets", token)
+	assert.Equal(t, fiber.StatusForbidden, status)
+	assert.Equal(t, "consent_required", body["error"])
+
+	expectConsent(testDB, 7, "1.4")
+	status, body = callAs(t, app, "GET", "/api/v1/admin/users", token)
+	assert.Equal(t, fiber.StatusForbidden, status, "admin routes are gated too")
+	assert.Equal(t, "consent_required", body["error"])
+
+	status, body = callAs(t, app, "GET", "/api/v1/datasets", "")
+	assert.Equal(t, fiber.StatusUnauthorized, status, "anonymous callers are refused before consent is looked up")
+	assert.Equal(t, "auth_required", body["error"])
+	testDB.AssertExpectations(t)
+}
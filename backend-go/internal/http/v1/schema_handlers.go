@@ -0,0 +1,216 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/annotations"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// profileRows is how many leading dataset rows the derived schema is
+// profiled from
+const profileRows = 1000
+
+type ColumnAnnotationRequest struct {
+	Unique      bool     `json:"unique"`
+	MinValue    *float64 `json:"min_value"`
+	MaxValue    *float64 `json:"max_value"`
+	Description *string  `json:"description"`
+	Sensitive   bool     `json:"sensitive"`
+}
+
+// profile reads the leading rows of a dataset and profiles its columns;
+// nil profiles mean the data is not readable
+func (d DatasetDeps) profile(ds *models.Dataset) ([]annotations.Profile, error) {
+	reader, ok := d.StorageClient.(storage.ObjectReader)
+	if !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" || (ds.FileType != "csv" && ds.FileType != "json") {
+		return nil, nil
+	}
+	columns, rows, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+	if err != nil {
+		return nil, err
+	}
+	return annotations.ProfileColumns(columns, rows), nil
+}
+
+// GetSchema returns the derived schema of a dataset: the profiled columns
+// and the annotations on them. Hidden columns keep their name only.
+func (d DatasetDeps) GetSchema(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Annotations == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.accessibleDataset(owner, id, models.DatasetPermRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	acl, err := d.columnACL(owner, ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+	}
+	profiles, err := d.profile(ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	hidden := make(map[string]bool)
+	for _, col := range acl.Hidden() {
+		hidden[col] = true
+	}
+	for i, p := range profiles {
+		if hidden[strings.ToLower(p.Name)] {
+			profiles[i] = annotations.Profile{Name: p.Name}
+		}
+	}
+	anns, err := d.Annotations.List(context.Background(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	profiled := profiles != nil
+	if profiles == nil {
+		profiles = []annotations.Profile{}
+	}
+	if anns == nil {
+		anns = []models.ColumnAnnotation{}
+	}
+	return c.JSON(fiber.Map{
+		"dataset_id":   id,
+		"profiled":     profiled,
+		"profile_rows": profileRows,
+		"columns":      profiles,
+		"annotations":  anns,
+	})
+}
+
+// SetColumnAnnotation creates or replaces the annotation on a column as a
+// new version, after checking it against the profiled data
+func (d DatasetDeps) SetColumnAnnotation(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Annotations == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	column := strings.TrimSpace(c.Params("column"))
+	var body ColumnAnnotationRequest
+	if err := c.BodyParser(&body); err != nil || column == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	ann := models.ColumnAnnotation{
+		DatasetID:   id,
+		ColumnName:  column,
+		Unique:      body.Unique,
+		MinValue:    body.MinValue,
+		MaxValue:    body.MaxValue,
+		Description: body.Description,
+		Sensitive:   body.Sensitive,
+		UpdatedBy:   owner,
+	}
+	if ann.Description != nil && strings.TrimSpace(*ann.Description) == "" {
+		ann.Description = nil
+	}
+	profiles, err := d.profile(ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	if err := annotations.Validate(ann, profiles); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_annotation", "message": err.Error()})
+	}
+	out, err := d.Annotations.Upsert(context.Background(), &ann)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditAccess(c, owner, "column_annotation_set", "dataset", id, map[string]any{
+		"column":    out.ColumnName,
+		"version":   out.Version,
+		"sensitive": out.Sensitive,
+	})
+	return c.JSON(out)
+}
+
+// DeleteColumnAnnotation removes the annotation on a column; the removal
+// is kept in the history
+func (d DatasetDeps) DeleteColumnAnnotation(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Annotations == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	version, err := d.Annotations.Delete(context.Background(), id, c.Params("column"), owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "annotation_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditAccess(c, owner, "column_annotation_removed", "dataset", id, map[string]any{
+		"column":  version.ColumnName,
+		"version": version.Version,
+	})
+	return c.JSON(fiber.Map{"message": "annotation_removed", "version": version.Version})
+}
+
+// ListAnnotationHistory lists annotation versions of a dataset, optionally
+// for one column
+func (d DatasetDeps) ListAnnotationHistory(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Annotations == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	history, err := d.Annotations.History(context.Background(), id, c.Query("column"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(history)
+}
+
+// sensitiveRestrictions turns sensitive annotations into column
+// restrictions with tokenized exports, unless the column already has one
+func sensitiveRestrictions(anns *repo.ColumnAnnotationRepo, datasetID int64, restrictions []models.ColumnRestriction) ([]models.ColumnRestriction, error) {
+	if anns == nil {
+		return restrictions, nil
+	}
+	list, err := anns.List(context.Background(), datasetID)
+	if err != nil {
+		return nil, err
+	}
+	have := make(map[string]bool, len(restrictions))
+	for _, r := range restrictions {
+		have[strings.ToLower(r.ColumnName)] = true
+	}
+	for _, col := range annotations.Sensitive(list) {
+		if !have[strings.ToLower(col)] {
+			restrictions = append(restrictions, models.ColumnRestriction{DatasetID: datasetID, ColumnName: col, ExportAction: models.ColumnExportTokenize})
+		}
+	}
+	return restrictions, nil
+}
@@ -0,0 +1,90 @@
+package v1
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/sla"
+	"github.com/gofiber/fiber/v2"
+)
+
+type SLADeps struct {
+	Reports *repo.SLARepo
+	Credits *repo.BillingCreditRepo
+	Service *sla.Service
+}
+
+// parseReportMonth reads ?month=YYYY-MM, defaulting to the last full month
+func parseReportMonth(c *fiber.Ctx) (time.Time, bool) {
+	month := c.Query("month")
+	if month == "" {
+		return sla.MonthStart(time.Now()).AddDate(0, -1, 0), true
+	}
+	t, err := time.Parse("2006-01", month)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// MySLA returns the caller's monthly SLA reports and billing credits
+func (d SLADeps) MySLA(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int64)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	reports, err := d.Reports.ListReportsByUser(context.Background(), userID, 12)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "sla_fetch_failed"})
+	}
+	credits, err := d.Credits.ListByUser(context.Background(), userID, 50)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "sla_fetch_failed"})
+	}
+	balance, err := d.Credits.Balance(context.Background(), userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "sla_fetch_failed"})
+	}
+	if reports == nil {
+		reports = []models.SLAReport{}
+	}
+	if credits == nil {
+		credits = []models.BillingCredit{}
+	}
+	return c.JSON(fiber.Map{"reports": reports, "credits": credits, "credit_balance": balance})
+}
+
+// ListReports returns every subscriber's SLA report for a month
+func (d SLADeps) ListReports(c *fiber.Ctx) error {
+	month, ok := parseReportMonth(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_month"})
+	}
+	reports, err := d.Reports.ListReportsByMonth(context.Background(), month)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if reports == nil {
+		reports = []models.SLAReport{}
+	}
+	return c.JSON(fiber.Map{"month": month.Format("2006-01"), "reports": reports})
+}
+
+// GenerateReports (re)computes a month's SLA reports and issues any credits
+// not yet issued
+func (d SLADeps) GenerateReports(c *fiber.Ctx) error {
+	month, ok := parseReportMonth(c)
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_month"})
+	}
+	if !month.Before(sla.MonthStart(time.Now()).AddDate(0, 1, 0)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "month_in_future"})
+	}
+	reports, err := d.Service.GenerateMonth(context.Background(), month)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "generate_failed", "message": err.Error()})
+	}
+	return c.JSON(fiber.Map{"month": month.Format("2006-01"), "reports": reports})
+}
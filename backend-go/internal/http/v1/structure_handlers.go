@@ -0,0 +1,91 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/structure"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errStructureUnavailable = errors.New("dataset rows are not readable for structure profiling")
+
+// structureProfile profiles the duplicates and groups of a dataset's leading
+// rows
+func structureProfile(client storage.SignedURLProvider, ds *models.Dataset, ignore []string, groupBy string) (*structure.Summary, error) {
+	reader, ok := client.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" || (ds.FileType != "csv" && ds.FileType != "json") {
+		return nil, errStructureUnavailable
+	}
+	columns, rows, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+	if err != nil {
+		return nil, err
+	}
+	return structure.Profile(columns, rows, ignore, groupBy)
+}
+
+// GetStructure returns the duplicate rate of a dataset and, with group_by,
+// the sizes of the groups under that column. ignore lists columns, comma
+// separated, left out when rows are compared. Hidden columns cannot be
+// grouped by.
+func (d DatasetDeps) GetStructure(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.accessibleDataset(owner, id, models.DatasetPermRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	acl, err := d.columnACL(owner, ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+	}
+	groupBy := strings.TrimSpace(c.Query("group_by"))
+	var ignore []string
+	for _, col := range strings.Split(c.Query("ignore"), ",") {
+		if col = strings.TrimSpace(col); col != "" {
+			ignore = append(ignore, col)
+		}
+	}
+	for _, col := range acl.Hidden() {
+		if col == strings.ToLower(groupBy) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": groupBy})
+		}
+	}
+	summary, err := structureProfile(d.StorageClient, ds, ignore, groupBy)
+	switch {
+	case errors.Is(err, errStructureUnavailable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "dataset_not_readable"})
+	case errors.Is(err, structure.ErrUnknownColumn):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	return c.JSON(fiber.Map{"dataset_id": id, "profile_rows": profileRows, "structure": summary})
+}
+
+// rowStructure profiles the structure a job reproduces, at request time like
+// the other profiles
+func (d GenerationDeps) rowStructure(ds *models.Dataset, owner, datasetID int64, opts structure.Options) (*agents.RowStructure, error) {
+	if ds == nil {
+		if d.Datasets == nil {
+			return nil, errStructureUnavailable
+		}
+		var err error
+		if ds, err = d.Datasets.GetByOwnerID(context.Background(), owner, datasetID); err != nil {
+			return nil, err
+		}
+	}
+	summary, err := structureProfile(d.StorageClient, ds, opts.IgnoreColumns, opts.GroupBy)
+	if err != nil {
+		return nil, err
+	}
+	return summary.Target(opts), nil
+}
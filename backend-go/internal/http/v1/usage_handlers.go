@@ -2,13 +2,17 @@ package v1
 
 import (
 	"context"
+	"time"
 
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/metering"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/usage"
 	"github.com/gofiber/fiber/v2"
 )
 
 type UsageDeps struct {
-	Usage *usage.UsageService
+	Usage    *usage.UsageService
+	Metering *repo.MeteringRepo
 }
 
 func (d UsageDeps) GetUsage(c *fiber.Ctx) error {
@@ -24,3 +28,64 @@ func (d UsageDeps) GetUsage(c *fiber.Ctx) error {
 
 	return c.JSON(stats)
 }
+
+// GetProviderUsage breaks the caller's generation usage down by provider and
+// model. days sets the window (default 30, max 365) and interval the bucket
+// size (day, week or month).
+func (d UsageDeps) GetProviderUsage(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int64)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+
+	days := c.QueryInt("days", 30)
+	if days <= 0 || days > 365 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_days"})
+	}
+	interval := c.Query("interval", "day")
+	switch interval {
+	case "day", "week", "month":
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_interval"})
+	}
+
+	since := time.Now().UTC().AddDate(0, 0, -days)
+	report, err := d.Usage.GetProviderUsage(context.Background(), userID, since, interval)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_fetch_failed"})
+	}
+
+	return c.JSON(report)
+}
+
+// GetInvoice lists the caller's metered usage in a billing period, what
+// their plan includes of each meter and the overage billed past it. period
+// is YYYY-MM, the current month in UTC by default.
+func (d UsageDeps) GetInvoice(c *fiber.Ctx) error {
+	userID, _ := c.Locals("user_id").(int64)
+	if userID == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Metering == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+
+	period := metering.Period(time.Now())
+	if p := c.Query("period"); p != "" {
+		var err error
+		if period, err = metering.ParsePeriod(p); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_period"})
+		}
+	}
+	ctx := context.Background()
+	tier, limits, err := d.Usage.UserLimits(ctx, userID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_fetch_failed"})
+	}
+	totals, err := d.Metering.Totals(ctx, userID, period)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "usage_fetch_failed"})
+	}
+
+	return c.JSON(metering.Invoice(period, tier, limits, totals))
+}
@@ -2,6 +2,7 @@ package v1
 
 import (
 	"context"
+	"strings"
 
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
 	"github.com/gofiber/fiber/v2"
@@ -57,13 +58,10 @@ func (d UserDeps) UpdateProfile(c *fiber.Ctx) error {
 	if req.FullName != nil {
 		u.FullName = req.FullName
 	}
-	if req.Email != nil {
-		// Check if email is already taken
-		existingUser, _ := d.Users.GetByEmail(context.Background(), *req.Email)
-		if existingUser != nil && existingUser.ID != userID {
-			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "email_already_exists"})
-		}
-		u.Email = *req.Email
+	// The address only changes once the new one is verified and the
+	// security hold has passed
+	if req.Email != nil && !strings.EqualFold(strings.TrimSpace(*req.Email), u.Email) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "email_change_required", "endpoint": "/api/v1/users/email-change"})
 	}
 
 	// Update user in database
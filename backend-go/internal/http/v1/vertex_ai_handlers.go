@@ -8,6 +8,7 @@ import (
 
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/config"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 )
@@ -283,7 +284,7 @@ func (h *VertexAIHandlers) StreamGeneration(c *fiber.Ctx) error {
 
 		case err := <-errorChan:
 			if err != nil {
-				c.WriteString(fmt.Sprintf("data: %s\n\n", `{"type": "error", "message": "`+err.Error()+`"}`))
+				c.WriteString(fmt.Sprintf("data: %s\n\n", `{"type": "error", "message": "`+redact.String(err.Error())+`"}`))
 				return err
 			}
 
@@ -301,7 +302,7 @@ func (h *VertexAIHandlers) HealthCheck(c *fiber.Ctx) error {
 		return c.Status(503).JSON(fiber.Map{
 			"success": false,
 			"status":  "unhealthy",
-			"error":   err.Error(),
+			"error":   redact.String(err.Error()),
 		})
 	}
 
@@ -0,0 +1,325 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/vocabulary"
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxVocabularyFile caps uploaded vocabulary files
+const maxVocabularyFile = 10 << 20
+
+var errVocabularyUnavailable = errors.New("dataset rows are not readable for vocabulary weighting")
+
+// VocabularyRequest creates a vocabulary from entries in the body. A
+// multipart upload sends them as a CSV file field instead, with name and
+// description as form fields.
+type VocabularyRequest struct {
+	Name        string                   `json:"name"`
+	Description *string                  `json:"description"`
+	Entries     models.VocabularyEntries `json:"entries"`
+}
+
+type BindVocabularyRequest struct {
+	VocabularyID int64 `json:"vocabulary_id"`
+	// Weighting is uniform, listed or source; listed when unset
+	Weighting string `json:"weighting"`
+}
+
+// parseVocabulary reads a vocabulary from a JSON body or a CSV upload and
+// returns an error code on failure
+func parseVocabulary(c *fiber.Ctx, owner int64) (*models.Vocabulary, string, error) {
+	var body VocabularyRequest
+	if file, err := c.FormFile("file"); err == nil {
+		if file.Size > maxVocabularyFile {
+			return nil, "file_too_large", nil
+		}
+		f, err := file.Open()
+		if err != nil {
+			return nil, "invalid_file", err
+		}
+		defer f.Close()
+		if body.Entries, err = vocabulary.ParseCSV(f); err != nil {
+			return nil, "invalid_file", err
+		}
+		body.Name = c.FormValue("name", strings.TrimSuffix(file.Filename, ".csv"))
+		if desc := c.FormValue("description"); desc != "" {
+			body.Description = &desc
+		}
+	} else if err := c.BodyParser(&body); err != nil {
+		return nil, "invalid_body", nil
+	}
+	name, err := vocabulary.ValidName(body.Name)
+	if err != nil {
+		return nil, "invalid_name", err
+	}
+	entries, err := vocabulary.Normalize(body.Entries)
+	if err != nil {
+		return nil, "invalid_entries", err
+	}
+	return &models.Vocabulary{OwnerID: owner, Name: name, Description: body.Description, Entries: entries}, "", nil
+}
+
+// CreateVocabulary uploads a controlled vocabulary
+func (d DatasetDeps) CreateVocabulary(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Vocabularies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	v, code, err := parseVocabulary(c, owner)
+	if code != "" {
+		body := fiber.Map{"error": code}
+		if err != nil {
+			body["message"] = err.Error()
+		}
+		return c.Status(fiber.StatusBadRequest).JSON(body)
+	}
+	out, err := d.Vocabularies.Insert(context.Background(), v)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
+
+// ListVocabularies lists the caller's vocabularies without their entries
+func (d DatasetDeps) ListVocabularies(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Vocabularies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Vocabularies.List(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	return c.JSON(fiber.Map{"vocabularies": out})
+}
+
+// GetVocabulary returns a vocabulary of the caller with its entries
+func (d DatasetDeps) GetVocabulary(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Vocabularies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Vocabularies.Get(context.Background(), owner, parseID(c.Params("vocabularyId")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "vocabulary_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "fetch_failed"})
+	}
+	return c.JSON(out)
+}
+
+// DeleteVocabulary removes a vocabulary no column is bound to
+func (d DatasetDeps) DeleteVocabulary(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Vocabularies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	ctx := context.Background()
+	id := parseID(c.Params("vocabularyId"))
+	if _, err := d.Vocabularies.Get(ctx, owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "vocabulary_not_found"})
+	}
+	bound, err := d.Vocabularies.CountBindings(ctx, id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	if bound > 0 {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "vocabulary_in_use", "columns": bound})
+	}
+	err = d.Vocabularies.Delete(ctx, owner, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "vocabulary_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	return c.JSON(fiber.Map{"message": "vocabulary_deleted"})
+}
+
+// ListColumnVocabularies lists the vocabulary bindings of a dataset's
+// columns
+func (d DatasetDeps) ListColumnVocabularies(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Vocabularies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	out, err := d.Vocabularies.Bindings(context.Background(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if out == nil {
+		out = []models.ColumnVocabulary{}
+	}
+	return c.JSON(out)
+}
+
+// BindVocabulary binds a dataset column to one of the caller's
+// vocabularies. When the dataset is readable the column must be in it, and
+// the response says how much of its data the vocabulary covers; source
+// weighting needs it readable to count values from.
+func (d DatasetDeps) BindVocabulary(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Vocabularies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	ctx := context.Background()
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.Datasets.GetByOwnerID(ctx, owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	column := strings.TrimSpace(c.Params("column"))
+	var body BindVocabularyRequest
+	if err := c.BodyParser(&body); err != nil || column == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if body.Weighting == "" {
+		body.Weighting = vocabulary.WeightingListed
+	}
+	if err := vocabulary.ValidWeighting(body.Weighting); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_weighting", "message": err.Error()})
+	}
+	v, err := d.Vocabularies.Get(ctx, owner, body.VocabularyID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "vocabulary_not_found"})
+	}
+
+	columns, rows, err := vocabularyRows(d.StorageClient, ds)
+	switch {
+	case errors.Is(err, errVocabularyUnavailable) && body.Weighting == vocabulary.WeightingSource:
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "dataset_not_readable"})
+	case errors.Is(err, errVocabularyUnavailable):
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	if columns != nil && !slices.Contains(columns, column) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "unknown_column", "message": column})
+	}
+	b := models.ColumnVocabulary{DatasetID: id, ColumnName: column, VocabularyID: v.ID, Weighting: body.Weighting, CreatedBy: owner}
+	if _, err := vocabulary.Resolve(v, b, rows); err != nil {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_binding", "message": err.Error()})
+	}
+	out, err := d.Vocabularies.Bind(ctx, &b)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	out.SourceCoverage = vocabulary.Coverage(v, column, rows)
+	_ = d.auditAccess(c, owner, "column_vocabulary_bound", "dataset", id, map[string]any{
+		"column":        column,
+		"vocabulary_id": v.ID,
+		"weighting":     out.Weighting,
+	})
+	return c.JSON(out)
+}
+
+// UnbindVocabulary removes a column's binding; jobs already queued keep it
+func (d DatasetDeps) UnbindVocabulary(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Vocabularies == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	if _, err := d.Datasets.GetByOwnerID(context.Background(), owner, id); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	column := strings.TrimSpace(c.Params("column"))
+	err := d.Vocabularies.Unbind(context.Background(), id, column)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "binding_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	_ = d.auditAccess(c, owner, "column_vocabulary_unbound", "dataset", id, map[string]any{"column": column})
+	return c.JSON(fiber.Map{"message": "vocabulary_unbound"})
+}
+
+// vocabularyRows reads the leading rows of a dataset;
+// errVocabularyUnavailable when they are not readable
+func vocabularyRows(client storage.SignedURLProvider, ds *models.Dataset) ([]string, []map[string]interface{}, error) {
+	reader, ok := client.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" || (ds.FileType != "csv" && ds.FileType != "json") {
+		return nil, nil, errVocabularyUnavailable
+	}
+	return readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+}
+
+// vocabularies resolves the vocabulary bindings of a dataset for a job.
+// Entries and source counts are read now, so a job keeps them if either
+// changes while it waits. Source frequencies are drawn from real data, so
+// zero-real-data jobs follow the listed weights instead.
+func (d GenerationDeps) vocabularies(ds *models.Dataset, owner, datasetID int64, zeroRealData bool) ([]agents.VocabularyColumn, error) {
+	if d.Vocabularies == nil {
+		return nil, nil
+	}
+	ctx := context.Background()
+	bindings, err := d.Vocabularies.Bindings(ctx, datasetID)
+	if err != nil || len(bindings) == 0 {
+		return nil, err
+	}
+	var rows []map[string]interface{}
+	out := make([]agents.VocabularyColumn, 0, len(bindings))
+	for _, b := range bindings {
+		// The vocabulary is the binder's, which a grantee generating from
+		// the dataset need not own
+		v, err := d.Vocabularies.Get(ctx, b.CreatedBy, b.VocabularyID)
+		if err != nil {
+			return nil, err
+		}
+		if b.Weighting == vocabulary.WeightingSource && zeroRealData {
+			b.Weighting = vocabulary.WeightingListed
+		}
+		if b.Weighting == vocabulary.WeightingSource && rows == nil {
+			if ds == nil && d.Datasets != nil {
+				if ds, err = d.Datasets.GetByOwnerID(ctx, owner, datasetID); err != nil {
+					return nil, err
+				}
+			}
+			if _, rows, err = vocabularyRows(d.StorageClient, ds); err != nil {
+				return nil, err
+			}
+		}
+		col, err := vocabulary.Resolve(v, b, rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, col)
+	}
+	return out, nil
+}
@@ -0,0 +1,433 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/egress"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgpolicy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/warehouse"
+	"github.com/gofiber/fiber/v2"
+)
+
+// WarehouseDeps serves warehouse destinations and the exports of jobs to
+// them. Destinations need the output master keys, which seal their
+// credentials.
+type WarehouseDeps struct {
+	Warehouses  *repo.WarehouseRepo
+	Generations *repo.GenerationRepo
+	OutputKeys  *repo.OutputKeyRepo
+	Envelope    *storage.Envelope
+	AuditLogs   *repo.AuditLogRepo
+	// Egress vets the hosts of destinations; Network carries connection
+	// tests through it
+	Egress  *egress.Gateway
+	Network warehouse.Network
+	// Policies refuses new destinations, connection tests and exports to
+	// members of organizations that disabled warehouse delivery
+	Policies *orgpolicy.Enforcer
+}
+
+// warehouseTestTimeout bounds a connection test
+const warehouseTestTimeout = 30 * time.Second
+
+type WarehouseRequest struct {
+	Name     string                   `json:"name"`
+	Kind     string                   `json:"kind"`
+	Settings models.WarehouseSettings `json:"settings"`
+	// Credentials may be left out of an update to keep the stored ones
+	Credentials *warehouse.Credentials `json:"credentials"`
+	AutoExport  bool                   `json:"auto_export"`
+}
+
+type WarehouseExportRequest struct {
+	DestinationID int64 `json:"destination_id"`
+	// Table defaults to the destination's table
+	Table string `json:"table"`
+}
+
+// check validates a destination and vets the host it connects to
+func (d WarehouseDeps) check(kind string, s models.WarehouseSettings, creds warehouse.Credentials) (fiber.Map, bool) {
+	if err := warehouse.Validate(kind, s, creds); err != nil {
+		return fiber.Map{"error": "invalid_destination", "message": err.Error(), "kinds": warehouse.Kinds}, false
+	}
+	if d.Egress == nil {
+		return nil, true
+	}
+	var err error
+	switch kind {
+	case warehouse.KindRedshift:
+		err = d.Egress.CheckHost(context.Background(), "warehouse", s.Host)
+	case warehouse.KindSnowflake:
+		err = d.Egress.CheckURL(context.Background(), "warehouse", "https://"+s.Account+".snowflakecomputing.com")
+	}
+	var blocked *egress.BlockedError
+	if errors.As(err, &blocked) {
+		return fiber.Map{"error": "url_not_allowed", "reason": blocked.Reason}, false
+	}
+	return nil, true
+}
+
+// test connects to a destination and returns why it failed, if it did
+func (d WarehouseDeps) test(kind string, s models.WarehouseSettings, creds warehouse.Credentials) *string {
+	ctx, cancel := context.WithTimeout(context.Background(), warehouseTestTimeout)
+	defer cancel()
+	conn, err := warehouse.Open(ctx, kind, s, creds, d.Network)
+	if err == nil {
+		err = conn.Test(ctx)
+		conn.Close()
+	}
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	return &msg
+}
+
+// ListWarehouses lists the caller's destinations
+func (d WarehouseDeps) ListWarehouses(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Warehouses == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Warehouses.ListDestinations(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if out == nil {
+		out = []models.WarehouseDestination{}
+	}
+	return c.JSON(out)
+}
+
+// CreateWarehouse registers a destination; its credentials are sealed and
+// never returned
+func (d WarehouseDeps) CreateWarehouse(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Warehouses == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	if handled, err := checkCapability(c, d.Policies, owner, orgpolicy.WarehouseDelivery); handled {
+		return err
+	}
+	var body WarehouseRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || body.Credentials == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name_and_credentials_required"})
+	}
+	if body.AutoExport && body.Settings.Table == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "table_required_for_auto_export"})
+	}
+	if res, ok := d.check(body.Kind, body.Settings, *body.Credentials); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(res)
+	}
+	sealed, wrapped, kid, err := warehouse.SealCredentials(d.Envelope, *body.Credentials)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	out, err := d.Warehouses.CreateDestination(context.Background(), &models.WarehouseDestination{
+		UserID:      owner,
+		Name:        body.Name,
+		Kind:        body.Kind,
+		Settings:    body.Settings,
+		Credentials: sealed,
+		WrappedKey:  wrapped,
+		MasterKeyID: kid,
+		AutoExport:  body.AutoExport,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	d.audit(c, owner, "warehouse_created", out)
+	return c.Status(fiber.StatusCreated).JSON(out)
+}
+
+func (d WarehouseDeps) GetWarehouse(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Warehouses == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Warehouses.GetDestination(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	return c.JSON(out)
+}
+
+// UpdateWarehouse replaces a destination's settings, and its credentials
+// when new ones are given. The kind cannot change.
+func (d WarehouseDeps) UpdateWarehouse(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Warehouses == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	current, err := d.Warehouses.GetDestination(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var body WarehouseRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if body.Kind != "" && body.Kind != current.Kind {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "kind_immutable"})
+	}
+	if body.AutoExport && body.Settings.Table == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "table_required_for_auto_export"})
+	}
+	creds := body.Credentials
+	if creds == nil {
+		stored, err := warehouse.OpenCredentials(d.Envelope, current)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "credentials_unavailable"})
+		}
+		creds = &stored
+	}
+	if res, ok := d.check(current.Kind, body.Settings, *creds); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(res)
+	}
+	if body.Credentials != nil {
+		if current.Credentials, current.WrappedKey, current.MasterKeyID, err = warehouse.SealCredentials(d.Envelope, *creds); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+		}
+	}
+	if name := strings.TrimSpace(body.Name); name != "" {
+		current.Name = name
+	}
+	current.Settings = body.Settings
+	current.AutoExport = body.AutoExport
+	out, err := d.Warehouses.UpdateDestination(context.Background(), current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	d.audit(c, owner, "warehouse_updated", out)
+	return c.JSON(out)
+}
+
+// DeleteWarehouse removes a destination with its export history
+func (d WarehouseDeps) DeleteWarehouse(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Warehouses == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id := parseID(c.Params("id"))
+	err := d.Warehouses.DeleteDestination(context.Background(), owner, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	d.audit(c, owner, "warehouse_deleted", &models.WarehouseDestination{ID: id})
+	return c.JSON(fiber.Map{"message": "warehouse_deleted"})
+}
+
+// TestWarehouseSettings tests a destination before it is saved
+func (d WarehouseDeps) TestWarehouseSettings(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Warehouses == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	if handled, err := checkCapability(c, d.Policies, owner, orgpolicy.WarehouseDelivery); handled {
+		return err
+	}
+	var body WarehouseRequest
+	if err := c.BodyParser(&body); err != nil || body.Credentials == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if res, ok := d.check(body.Kind, body.Settings, *body.Credentials); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(res)
+	}
+	if msg := d.test(body.Kind, body.Settings, *body.Credentials); msg != nil {
+		return c.JSON(fiber.Map{"ok": false, "error": *msg})
+	}
+	return c.JSON(fiber.Map{"ok": true})
+}
+
+// TestWarehouse tests a saved destination and records the outcome
+func (d WarehouseDeps) TestWarehouse(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Warehouses == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	if handled, err := checkCapability(c, d.Policies, owner, orgpolicy.WarehouseDelivery); handled {
+		return err
+	}
+	dest, err := d.Warehouses.GetDestination(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	creds, err := warehouse.OpenCredentials(d.Envelope, dest)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "credentials_unavailable"})
+	}
+	if res, ok := d.check(dest.Kind, dest.Settings, creds); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(res)
+	}
+	msg := d.test(dest.Kind, dest.Settings, creds)
+	if err := d.Warehouses.RecordTest(context.Background(), dest.ID, msg); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	if msg != nil {
+		return c.JSON(fiber.Map{"ok": false, "error": *msg})
+	}
+	return c.JSON(fiber.Map{"ok": true})
+}
+
+// ListWarehouseDeliveries returns a destination's latest exports with the
+// outcome of their last attempt
+func (d WarehouseDeps) ListWarehouseDeliveries(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Warehouses == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	dest, err := d.Warehouses.GetDestination(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	out, err := d.Warehouses.ListDeliveries(context.Background(), dest.ID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if out == nil {
+		out = []models.WarehouseDelivery{}
+	}
+	return c.JSON(out)
+}
+
+// ExportJob queues a completed job of the caller for loading into one of
+// their destinations. Encrypted outputs need an active access grant, now
+// and when the export runs.
+func (d WarehouseDeps) ExportJob(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Warehouses == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	if handled, err := checkCapability(c, d.Policies, owner, orgpolicy.WarehouseDelivery); handled {
+		return err
+	}
+	var body WarehouseExportRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	ctx := context.Background()
+	job, err := d.Generations.GetByOwner(ctx, owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if job.Status != models.GenCompleted || job.OutputKey == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "not_ready"})
+	}
+	if job.OutputFormat != nil && *job.OutputFormat != "" && *job.OutputFormat != export.JSON && *job.OutputFormat != export.CSV {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "conversion_unsupported", "output_format": *job.OutputFormat})
+	}
+	dest, err := d.Warehouses.GetDestination(ctx, owner, body.DestinationID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "destination_not_found"})
+	}
+	table := strings.TrimSpace(body.Table)
+	if table == "" {
+		table = dest.Settings.Table
+	}
+	if !warehouse.ValidTable(table) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_table"})
+	}
+	if d.OutputKeys != nil {
+		if _, err := d.OutputKeys.GetKey(ctx, job.ID); err == nil {
+			if _, err := d.OutputKeys.ActiveGrant(ctx, job.ID, owner); err != nil {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "output_access_required"})
+			}
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "get_failed"})
+		}
+	}
+	out, err := d.Warehouses.Enqueue(ctx, dest.ID, job.ID, owner, table)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "export_failed"})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(out)
+}
+
+// ListJobExports returns the warehouse exports of one of the caller's jobs
+func (d WarehouseDeps) ListJobExports(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Warehouses == nil || d.Envelope == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Warehouses.JobDeliveries(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if out == nil {
+		out = []models.WarehouseDelivery{}
+	}
+	return c.JSON(out)
+}
+
+// audit records a change to a destination; where outputs are loaded is
+// security relevant
+func (d WarehouseDeps) audit(c *fiber.Ctx, userID int64, action string, dest *models.WarehouseDestination) {
+	if d.AuditLogs == nil {
+		return
+	}
+	raw, _ := json.Marshal(map[string]any{"kind": dest.Kind, "name": dest.Name, "settings": dest.Settings, "auto_export": dest.AutoExport})
+	resourceID := strconv.FormatInt(dest.ID, 10)
+	_, _ = d.AuditLogs.Insert(context.Background(), &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   "warehouse_destination",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+}
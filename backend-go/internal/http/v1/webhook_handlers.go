@@ -0,0 +1,294 @@
+package v1
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/egress"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
+	"github.com/gofiber/fiber/v2"
+)
+
+type WebhookDeps struct {
+	Webhooks  *repo.WebhookRepo
+	AuditLogs *repo.AuditLogRepo
+	// Egress vets endpoint URLs; endpoints resolving to private
+	// addresses are refused
+	Egress *egress.Gateway
+}
+
+// minWebhookSecret is the shortest signing secret a user may choose
+const minWebhookSecret = 16
+
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Description *string  `json:"description"`
+	Events      []string `json:"events"`
+	// Secret signs deliveries; one is generated when it is left out
+	Secret string `json:"secret,omitempty"`
+	Active *bool  `json:"active"`
+}
+
+// validate checks the URL and event types of a request
+func (r WebhookRequest) validate() (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(r.URL))
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return "invalid_url", false
+	}
+	if len(r.Events) == 0 {
+		return "events_required", false
+	}
+	for _, e := range r.Events {
+		if !webhooks.ValidEventType(e) {
+			return "invalid_event_type", false
+		}
+	}
+	return "", true
+}
+
+// checkDestination vets a URL users give the service to call. It returns
+// the error response body for a refused URL.
+func checkDestination(g *egress.Gateway, purpose, raw string) (fiber.Map, bool) {
+	if g == nil {
+		return nil, true
+	}
+	err := g.CheckURL(context.Background(), purpose, raw)
+	var blocked *egress.BlockedError
+	if errors.As(err, &blocked) {
+		return fiber.Map{"error": "url_not_allowed", "reason": blocked.Reason}, false
+	}
+	return nil, true
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// ListEventTypes lists the event types endpoints can subscribe to
+func (d WebhookDeps) ListEventTypes(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"event_types": webhooks.EventTypes, "wildcard": webhooks.EventAll})
+}
+
+// CreateWebhook registers an endpoint. Its signing secret is only returned
+// here.
+func (d WebhookDeps) CreateWebhook(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Webhooks == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	var body WebhookRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if code, ok := body.validate(); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": code})
+	}
+	if res, ok := checkDestination(d.Egress, "webhooks", body.URL); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(res)
+	}
+	secret := body.Secret
+	if secret == "" {
+		var err error
+		if secret, err = newWebhookSecret(); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+		}
+	} else if len(secret) < minWebhookSecret {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "secret_too_short"})
+	}
+	active := body.Active == nil || *body.Active
+	out, err := d.Webhooks.CreateEndpoint(context.Background(), &models.WebhookEndpoint{
+		UserID:      owner,
+		URL:         strings.TrimSpace(body.URL),
+		Description: body.Description,
+		Events:      body.Events,
+		Secret:      secret,
+		Active:      active,
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "create_failed"})
+	}
+	d.audit(c, owner, "webhook_created", out)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"webhook": out, "secret": secret})
+}
+
+// ListWebhooks lists the caller's endpoints
+func (d WebhookDeps) ListWebhooks(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Webhooks == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Webhooks.ListEndpoints(context.Background(), owner)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if out == nil {
+		out = []models.WebhookEndpoint{}
+	}
+	return c.JSON(out)
+}
+
+func (d WebhookDeps) GetWebhook(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Webhooks == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	out, err := d.Webhooks.GetEndpoint(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	return c.JSON(out)
+}
+
+// UpdateWebhook replaces the URL, description, events and active flag of
+// an endpoint; the secret is kept
+func (d WebhookDeps) UpdateWebhook(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Webhooks == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	current, err := d.Webhooks.GetEndpoint(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var body WebhookRequest
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	if code, ok := body.validate(); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": code})
+	}
+	if res, ok := checkDestination(d.Egress, "webhooks", body.URL); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(res)
+	}
+	current.URL = strings.TrimSpace(body.URL)
+	current.Description = body.Description
+	current.Events = body.Events
+	if body.Active != nil {
+		current.Active = *body.Active
+	}
+	out, err := d.Webhooks.UpdateEndpoint(context.Background(), current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	d.audit(c, owner, "webhook_updated", out)
+	return c.JSON(out)
+}
+
+// DeleteWebhook removes an endpoint with its delivery history
+func (d WebhookDeps) DeleteWebhook(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Webhooks == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	id := parseID(c.Params("id"))
+	err := d.Webhooks.DeleteEndpoint(context.Background(), owner, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "delete_failed"})
+	}
+	d.audit(c, owner, "webhook_deleted", &models.WebhookEndpoint{ID: id})
+	return c.JSON(fiber.Map{"message": "webhook_deleted"})
+}
+
+// ListDeliveries returns an endpoint's latest deliveries with the outcome
+// of their last attempt
+func (d WebhookDeps) ListDeliveries(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Webhooks == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	endpoint, err := d.Webhooks.GetEndpoint(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	out, err := d.Webhooks.ListDeliveries(context.Background(), endpoint.ID, limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "list_failed"})
+	}
+	if out == nil {
+		out = []models.WebhookDelivery{}
+	}
+	return c.JSON(out)
+}
+
+// Redeliver queues a delivery for a fresh round of attempts
+func (d WebhookDeps) Redeliver(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	if d.Webhooks == nil {
+		return c.Status(fiber.StatusNotImplemented).JSON(fiber.Map{"error": "not_implemented"})
+	}
+	endpoint, err := d.Webhooks.GetEndpoint(context.Background(), owner, parseID(c.Params("id")))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	err = d.Webhooks.Redeliver(context.Background(), endpoint.ID, parseID(c.Params("deliveryId")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "delivery_not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"message": "redelivery_queued"})
+}
+
+// audit records a change to an endpoint; where events go is security
+// relevant, since deliveries carry job and billing details
+func (d WebhookDeps) audit(c *fiber.Ctx, userID int64, action string, e *models.WebhookEndpoint) {
+	if d.AuditLogs == nil {
+		return
+	}
+	raw, _ := json.Marshal(map[string]any{"url": e.URL, "events": e.Events, "active": e.Active})
+	resourceID := strconv.FormatInt(e.ID, 10)
+	_, _ = d.AuditLogs.Insert(context.Background(), &models.AuditLog{
+		UserID:     &userID,
+		Action:     action,
+		Resource:   "webhook",
+		ResourceID: &resourceID,
+		IPAddress:  c.IP(),
+		UserAgent:  c.Get("User-Agent"),
+		Metadata:   string(raw),
+	})
+}
@@ -0,0 +1,129 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/weights"
+	"github.com/gofiber/fiber/v2"
+)
+
+var errWeightsUnavailable = errors.New("dataset rows are not readable for weighted profiling")
+
+// weightProfile profiles the leading rows of a dataset weighted by column
+func weightProfile(client storage.SignedURLProvider, ds *models.Dataset, column string) (*weights.Summary, error) {
+	reader, ok := client.(storage.ObjectReader)
+	if ds == nil || !ok || ds.ObjectKey == nil || *ds.ObjectKey == "" {
+		return nil, errWeightsUnavailable
+	}
+	columns, rows, err := readPreview(context.Background(), reader, *ds.ObjectKey, ds.FileType, profileRows)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errWeightsUnavailable
+	}
+	return weights.Profile(columns, rows, column)
+}
+
+// isWeightError reports whether err is about the weight values rather than
+// reading them
+func isWeightError(err error) bool {
+	return errors.Is(err, weights.ErrMissingColumn) || errors.Is(err, weights.ErrInvalidWeight) || errors.Is(err, weights.ErrZeroWeight)
+}
+
+// SetWeights sets the column holding the sampling weight of each row, after
+// checking its values, or clears it when the column is empty
+func (d DatasetDeps) SetWeights(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	var body struct {
+		Column *string `json:"column"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_body"})
+	}
+	ds, err := d.Datasets.GetByOwnerID(context.Background(), owner, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	var column *string
+	var summary *weights.Summary
+	if body.Column != nil && strings.TrimSpace(*body.Column) != "" {
+		name := strings.TrimSpace(*body.Column)
+		column = &name
+		summary, err = weightProfile(d.StorageClient, ds, name)
+		switch {
+		case errors.Is(err, errWeightsUnavailable):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "weights_unavailable"})
+		case isWeightError(err):
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_weight_column", "message": err.Error()})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+		}
+	}
+	err = d.Datasets.SetWeightColumn(context.Background(), owner, id, column)
+	if errors.Is(err, sql.ErrNoRows) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "update_failed"})
+	}
+	_ = d.auditAccess(c, owner, "dataset_weights_updated", "dataset", id, map[string]any{
+		"weight_column": column,
+	})
+	return c.JSON(fiber.Map{"dataset_id": id, "weight_column": column, "profile": summary})
+}
+
+// GetWeights returns the weighted profile of a dataset: the raw and weighted
+// statistics of each column and the effective sample size. Hidden columns
+// keep their name only.
+func (d DatasetDeps) GetWeights(c *fiber.Ctx) error {
+	owner, _ := c.Locals("user_id").(int64)
+	if owner == 0 {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "auth_required"})
+	}
+	id, _ := strconv.ParseInt(c.Params("id"), 10, 64)
+	ds, err := d.accessibleDataset(owner, id, models.DatasetPermRead)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+	}
+	column, err := d.Datasets.WeightColumn(context.Background(), id)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "lookup_failed"})
+	}
+	if column == nil {
+		return c.JSON(fiber.Map{"dataset_id": id, "weight_column": nil})
+	}
+	acl, err := d.columnACL(owner, ds)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "access_check_failed"})
+	}
+	summary, err := weightProfile(d.StorageClient, ds, *column)
+	switch {
+	case errors.Is(err, errWeightsUnavailable):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "weights_unavailable"})
+	case isWeightError(err):
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "invalid_weight_column", "message": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "profile_failed"})
+	}
+	hidden := make(map[string]bool)
+	for _, col := range acl.Hidden() {
+		hidden[col] = true
+	}
+	for i, cs := range summary.Columns {
+		if hidden[strings.ToLower(cs.Column)] {
+			summary.Columns[i] = weights.ColumnSummary{Column: cs.Column, Numeric: cs.Numeric}
+		}
+	}
+	return c.JSON(fiber.Map{"dataset_id": id, "weight_column": column, "profile_rows": profileRows, "profile": summary})
+}
@@ -0,0 +1,170 @@
+// Package idempotency keeps the first response to a mutating request sent
+// with an Idempotency-Key header, so a client that retries it, such as after
+// a timeout, gets that response again instead of a second checkout, job or
+// upload.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Header is the request header carrying a client's key
+const Header = "Idempotency-Key"
+
+// ReplayedHeader is set on responses replayed from the store
+const ReplayedHeader = "Idempotent-Replayed"
+
+const (
+	// TTL is how long a response is kept for replays
+	TTL = 24 * time.Hour
+	// LockTTL bounds how long a request holds its key while it runs, so a
+	// key is freed when the instance running it dies
+	LockTTL = 5 * time.Minute
+	// MaxKeyLength bounds the keys clients may send
+	MaxKeyLength = 255
+)
+
+// ErrInvalidKey is returned for an empty or overlong key
+var ErrInvalidKey = fmt.Errorf("%s must be 1-%d printable ASCII characters", Header, MaxKeyLength)
+
+// Response is a stored response. Fingerprint identifies the request it
+// answered, so a key reused for a different request is refused.
+type Response struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Body        []byte `json:"body"`
+}
+
+// ValidKey checks a client's key
+func ValidKey(key string) error {
+	if key == "" || len(key) > MaxKeyLength {
+		return ErrInvalidKey
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// StoreKey returns where the response to a client's key is kept. Keys are
+// scoped to the caller, so two callers choosing the same key do not see
+// each other's responses.
+func StoreKey(scope, key string) string {
+	sum := sha256.Sum256([]byte(scope + "\x00" + key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Fingerprint identifies a request by its method, URL and body
+func Fingerprint(method, url string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + url + "\x00"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Cacheable reports whether a response is kept for replays. Server errors,
+// failed authentication and throttling did not settle the request, so a
+// retry runs it again.
+func Cacheable(status int) bool {
+	switch {
+	case status >= 500:
+		return false
+	case status == 401, status == 408, status == 409, status == 429:
+		return false
+	}
+	return true
+}
+
+// Store keeps responses and the keys of requests in flight
+type Store interface {
+	// Begin returns the response stored under key, or else claims key for
+	// a request about to run; claimed is false when another request holds
+	// it
+	Begin(ctx context.Context, key string) (stored *Response, claimed bool, err error)
+	// Finish stores the response to the request that claimed key and frees
+	// the claim
+	Finish(ctx context.Context, key string, resp *Response) error
+	// Release frees a claim without storing a response
+	Release(ctx context.Context, key string) error
+}
+
+// RedisStore keeps responses in Redis
+type RedisStore struct {
+	redisClient *redis.Client
+	ttl         time.Duration
+}
+
+// NewRedisStore creates a store keeping responses for TTL
+func NewRedisStore(redisClient *redis.Client) *RedisStore {
+	return &RedisStore{redisClient: redisClient, ttl: TTL}
+}
+
+func responseKey(key string) string { return "idempotency:" + key }
+
+func lockKey(key string) string { return "idempotency_lock:" + key }
+
+func (s *RedisStore) Begin(ctx context.Context, key string) (*Response, bool, error) {
+	if resp, err := s.get(ctx, key); resp != nil || err != nil {
+		return resp, false, err
+	}
+	claimed, err := s.redisClient.SetNX(ctx, lockKey(key), "1", LockTTL).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if !claimed {
+		return nil, false, nil
+	}
+	// The request that held the key may have finished between the lookup
+	// and the claim
+	resp, err := s.get(ctx, key)
+	if resp != nil || err != nil {
+		_ = s.Release(ctx, key)
+		return resp, false, err
+	}
+	return nil, true, nil
+}
+
+func (s *RedisStore) get(ctx context.Context, key string) (*Response, error) {
+	raw, err := s.redisClient.Get(ctx, responseKey(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up idempotency key: %w", err)
+	}
+	var resp Response
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode stored response: %w", err)
+	}
+	return &resp, nil
+}
+
+func (s *RedisStore) Finish(ctx context.Context, key string, resp *Response) error {
+	raw, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	pipe := s.redisClient.TxPipeline()
+	pipe.Set(ctx, responseKey(key), raw, s.ttl)
+	pipe.Del(ctx, lockKey(key))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) Release(ctx context.Context, key string) error {
+	return s.redisClient.Del(ctx, lockKey(key)).Err()
+}
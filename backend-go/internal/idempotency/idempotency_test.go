@@ -0,0 +1,197 @@
+// Package idempotency_test provides unit tests for idempotent request replay
+package idempotency_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/idempotency"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/middleware"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps responses in memory, as RedisStore does in Redis
+type memoryStore struct {
+	mu        sync.Mutex
+	responses map[string]*idempotency.Response
+	claimed   map[string]bool
+	down      bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{responses: map[string]*idempotency.Response{}, claimed: map[string]bool{}}
+}
+
+func (s *memoryStore) Begin(_ context.Context, key string) (*idempotency.Response, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down {
+		return nil, false, errors.New("connection refused")
+	}
+	if r, ok := s.responses[key]; ok {
+		return r, false, nil
+	}
+	if s.claimed[key] {
+		return nil, false, nil
+	}
+	s.claimed[key] = true
+	return nil, true, nil
+}
+
+func (s *memoryStore) Finish(_ context.Context, key string, resp *idempotency.Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[key] = resp
+	delete(s.claimed, key)
+	return nil
+}
+
+func (s *memoryStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.claimed, key)
+	return nil
+}
+
+func TestValidKey(t *testing.T) {
+	assert.NoError(t, idempotency.ValidKey("3f1c2a9e-7b7d-4f0e-9a51-1f2d3c4b5a69"))
+	assert.ErrorIs(t, idempotency.ValidKey(""), idempotency.ErrInvalidKey)
+	assert.ErrorIs(t, idempotency.ValidKey(strings.Repeat("k", idempotency.MaxKeyLength+1)), idempotency.ErrInvalidKey)
+	assert.ErrorIs(t, idempotency.ValidKey("key\nwith newline"), idempotency.ErrInvalidKey)
+	assert.ErrorIs(t, idempotency.ValidKey("ключ"), idempotency.ErrInvalidKey)
+}
+
+func TestStoreKeyAndFingerprint(t *testing.T) {
+	assert.NotEqual(t, idempotency.StoreKey("alice", "k1"), idempotency.StoreKey("bob", "k1"), "keys are scoped to the caller")
+	assert.Equal(t, idempotency.StoreKey("alice", "k1"), idempotency.StoreKey("alice", "k1"))
+
+	a := idempotency.Fingerprint("POST", "/api/v1/payment/checkout", []byte(`{"plan":"pro"}`))
+	assert.Equal(t, a, idempotency.Fingerprint("POST", "/api/v1/payment/checkout", []byte(`{"plan":"pro"}`)))
+	assert.NotEqual(t, a, idempotency.Fingerprint("POST", "/api/v1/payment/checkout", []byte(`{"plan":"team"}`)))
+	assert.NotEqual(t, a, idempotency.Fingerprint("PUT", "/api/v1/payment/checkout", []byte(`{"plan":"pro"}`)))
+}
+
+func TestCacheable(t *testing.T) {
+	for _, status := range []int{200, 201, 202, 204, 400, 402, 403, 404, 422} {
+		assert.True(t, idempotency.Cacheable(status), status)
+	}
+	for _, status := range []int{401, 408, 409, 429, 500, 502, 503} {
+		assert.False(t, idempotency.Cacheable(status), status)
+	}
+}
+
+type result struct {
+	status   int
+	body     string
+	replayed bool
+}
+
+// callers resolves bearer tokens to who they belong to; alice holds two
+// tokens, as after a refresh
+var callers = map[string]string{"alice": "user:1", "alice-refreshed": "user:1", "bob": "user:2"}
+
+func caller(c *fiber.Ctx) string {
+	return callers[strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")]
+}
+
+func newApp(store idempotency.Store, calls *int) *fiber.App {
+	app := fiber.New()
+	app.Use(middleware.Idempotency(store, caller))
+	app.Post("/checkout", func(c *fiber.Ctx) error {
+		*calls++
+		if string(c.Body()) == "fail" {
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"error": "provider_unavailable"})
+		}
+		c.Location("/orders/7")
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"order": *calls})
+	})
+	app.Delete("/checkout", func(c *fiber.Ctx) error {
+		*calls++
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	return app
+}
+
+func send(t *testing.T, app *fiber.App, method, key, auth, body string) result {
+	t.Helper()
+	req := httptest.NewRequest(method, "/checkout", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotency.Header, key)
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", "Bearer "+auth)
+	}
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	b, _ := io.ReadAll(resp.Body)
+	return result{status: resp.StatusCode, body: string(b), replayed: resp.Header.Get(idempotency.ReplayedHeader) == "true"}
+}
+
+func TestMiddlewareReplaysFirstResponse(t *testing.T) {
+	var calls int
+	app := newApp(newMemoryStore(), &calls)
+
+	first := send(t, app, "POST", "k1", "alice", `{"plan":"pro"}`)
+	assert.Equal(t, result{status: 201, body: `{"order":1}`}, first)
+
+	again := send(t, app, "POST", "k1", "alice", `{"plan":"pro"}`)
+	assert.Equal(t, result{status: 201, body: `{"order":1}`, replayed: true}, again)
+	assert.Equal(t, 1, calls, "the retry did not reach the handler")
+
+	assert.Equal(t, fiber.StatusUnprocessableEntity, send(t, app, "POST", "k1", "alice", `{"plan":"team"}`).status, "a key is bound to its request")
+	assert.Equal(t, result{status: 201, body: `{"order":2}`}, send(t, app, "POST", "k1", "bob", `{"plan":"pro"}`), "another caller's key is its own")
+	assert.Equal(t, result{status: 201, body: `{"order":3}`}, send(t, app, "POST", "", "alice", `{"plan":"pro"}`), "requests without a key always run")
+	assert.Equal(t, 3, calls)
+}
+
+func TestMiddlewareRunsFailedRequestsAgain(t *testing.T) {
+	var calls int
+	app := newApp(newMemoryStore(), &calls)
+
+	assert.Equal(t, fiber.StatusBadGateway, send(t, app, "POST", "k2", "alice", "fail").status)
+	assert.Equal(t, fiber.StatusBadGateway, send(t, app, "POST", "k2", "alice", "fail").status)
+	assert.Equal(t, 2, calls, "server errors are not kept")
+}
+
+func TestMiddlewareRefusesConcurrentAndUnavailable(t *testing.T) {
+	var calls int
+	store := newMemoryStore()
+	app := newApp(store, &calls)
+
+	require.Equal(t, fiber.StatusCreated, send(t, app, "POST", "k3", "alice", "{}").status)
+	// Put the key back in flight, as if the first request were still running
+	for k := range store.responses {
+		delete(store.responses, k)
+		store.claimed[k] = true
+	}
+	assert.Equal(t, fiber.StatusConflict, send(t, app, "POST", "k3", "alice", "{}").status, "a request still running holds its key")
+
+	store.down = true
+	assert.Equal(t, fiber.StatusServiceUnavailable, send(t, app, "POST", "k4", "alice", "{}").status)
+	assert.Equal(t, fiber.StatusNoContent, send(t, app, "DELETE", "k4", "alice", "").status, "only POST, PUT and PATCH are keyed")
+	assert.Equal(t, fiber.StatusBadRequest, send(t, app, "POST", strings.Repeat("k", 300), "alice", "{}").status)
+	assert.Equal(t, 2, calls)
+}
+
+func TestMiddlewareScopesKeysByIdentity(t *testing.T) {
+	var calls int
+	app := newApp(newMemoryStore(), &calls)
+
+	require.Equal(t, result{status: 201, body: `{"order":1}`}, send(t, app, "POST", "k5", "alice", "{}"))
+	assert.Equal(t, result{status: 201, body: `{"order":1}`, replayed: true}, send(t, app, "POST", "k5", "alice-refreshed", "{}"),
+		"a retry with another token of the same user replays")
+	assert.Equal(t, result{status: 201, body: `{"order":2}`}, send(t, app, "POST", "k5", "bob", "{}"))
+
+	assert.Equal(t, result{status: 201, body: `{"order":3}`}, send(t, app, "POST", "k6", "forged", "{}"))
+	assert.Equal(t, result{status: 201, body: `{"order":3}`, replayed: true}, send(t, app, "POST", "k6", "", "{}"),
+		"requests without valid credentials are scoped to their IP")
+	assert.Equal(t, result{status: 201, body: `{"order":4}`}, send(t, app, "POST", "k6", "alice", "{}"), "and not to a user's")
+	assert.Equal(t, 4, calls)
+}
@@ -0,0 +1,299 @@
+// Package incidents merges what happened in a time window into one ordered
+// timeline for on-call engineers: monitoring alerts, security events,
+// deployment markers and spikes of failing generation jobs. Each spike lists
+// the events shortly before it, the likely suspects for what changed.
+package incidents
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/monitoring"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
+)
+
+// Sources of timeline events
+const (
+	SourceAlert       = "alert"
+	SourceSecurity    = "security"
+	SourceDeployment  = "deployment"
+	SourceJobFailures = "job_failures"
+)
+
+const (
+	// MaxWindow bounds the window of a timeline
+	MaxWindow = 7 * 24 * time.Hour
+	// MaxEvents bounds the events of a timeline; the earliest are kept
+	MaxEvents = 1000
+	// SuspectWindow is how long before a spike an event is listed as
+	// preceding it
+	SuspectWindow = 30 * time.Minute
+	// SpikeMinFailures is the fewest failures in a bucket that can spike
+	SpikeMinFailures = 3
+	// SpikeFactor is how many times its baseline a bucket's failures must
+	// be to spike
+	SpikeFactor = 3.0
+)
+
+// Event is an entry of a timeline. EndedAt is set for events with a
+// duration, such as resolved alerts and failure spikes.
+type Event struct {
+	ID       string         `json:"id"`
+	At       time.Time      `json:"at"`
+	EndedAt  *time.Time     `json:"ended_at,omitempty"`
+	Source   string         `json:"source"`
+	Kind     string         `json:"kind"`
+	Severity string         `json:"severity"`
+	Title    string         `json:"title"`
+	Details  map[string]any `json:"details,omitempty"`
+	// PrecededBy lists the IDs of events in the SuspectWindow before a
+	// failure spike
+	PrecededBy []string `json:"preceded_by,omitempty"`
+}
+
+// Timeline is what happened in [From, To), oldest first
+type Timeline struct {
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Bucket string    `json:"bucket"`
+	Events []Event   `json:"events"`
+	// Truncated is set when the window held more than MaxEvents events
+	Truncated bool `json:"truncated"`
+}
+
+// Alerts lists the alerts raised by monitoring
+type Alerts interface {
+	GetAlerts() map[string]*monitoring.Alert
+}
+
+// SecurityEvents lists recorded security events
+type SecurityEvents interface {
+	GetSecurityEvents(filters security.SecurityEventFilters) []security.SecurityEvent
+}
+
+// Deployments lists deployment markers
+type Deployments interface {
+	Between(ctx context.Context, from, to time.Time) ([]models.DeploymentMarker, error)
+}
+
+// JobFailures counts finished and failed generation jobs per bucket
+type JobFailures interface {
+	JobFailureBuckets(ctx context.Context, from, to time.Time, bucket time.Duration) ([]models.JobFailureBucket, error)
+}
+
+// Correlator builds timelines; a nil source is left out
+type Correlator struct {
+	alerts      Alerts
+	security    SecurityEvents
+	deployments Deployments
+	jobs        JobFailures
+}
+
+func NewCorrelator(alerts Alerts, security SecurityEvents, deployments Deployments, jobs JobFailures) *Correlator {
+	return &Correlator{alerts: alerts, security: security, deployments: deployments, jobs: jobs}
+}
+
+// Timeline merges the events of [from, to). Alerts active at any point of
+// the window are included even when raised before it. Job failures are
+// counted per bucket and compared with the rate of the window's length
+// before it, at least an hour.
+func (c *Correlator) Timeline(ctx context.Context, from, to time.Time, bucket time.Duration) (*Timeline, error) {
+	var events []Event
+	if c.alerts != nil {
+		for _, a := range c.alerts.GetAlerts() {
+			if a.Timestamp.Before(to) && (a.ResolvedAt == nil || !a.ResolvedAt.Before(from)) {
+				events = append(events, alertEvent(a))
+			}
+		}
+	}
+	if c.security != nil {
+		end := to.Add(-time.Nanosecond)
+		for _, e := range c.security.GetSecurityEvents(security.SecurityEventFilters{StartTime: &from, EndTime: &end}) {
+			events = append(events, securityEvent(e))
+		}
+	}
+	if c.deployments != nil {
+		markers, err := c.deployments.Between(ctx, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("list deployments: %w", err)
+		}
+		for _, m := range markers {
+			events = append(events, deploymentEvent(m))
+		}
+	}
+	sortEvents(events)
+	if c.jobs != nil {
+		baseline := max(to.Sub(from), time.Hour)
+		buckets, err := c.jobs.JobFailureBuckets(ctx, from.Add(-baseline), to, bucket)
+		if err != nil {
+			return nil, fmt.Errorf("count job failures: %w", err)
+		}
+		spikes := Spikes(buckets, from, baseline, bucket)
+		for i := range spikes {
+			spikes[i].PrecededBy = suspects(events, spikes[i].At)
+		}
+		events = append(events, spikes...)
+		sortEvents(events)
+	}
+	t := &Timeline{From: from, To: to, Bucket: bucket.String(), Events: events}
+	if len(t.Events) > MaxEvents {
+		t.Events, t.Truncated = t.Events[:MaxEvents], true
+	}
+	if t.Events == nil {
+		t.Events = []Event{}
+	}
+	return t, nil
+}
+
+// Spikes finds the buckets from windowStart on whose failures reach
+// SpikeMinFailures and SpikeFactor times the mean failures per bucket of the
+// baseline before windowStart. Consecutive spiking buckets make one event.
+func Spikes(buckets []models.JobFailureBucket, windowStart time.Time, baseline, bucket time.Duration) []Event {
+	var baselineFailed int64
+	for _, b := range buckets {
+		if b.Start.Before(windowStart) {
+			baselineFailed += b.Failed
+		}
+	}
+	mean := float64(baselineFailed) / (float64(baseline) / float64(bucket))
+	threshold := max(float64(SpikeMinFailures), SpikeFactor*mean)
+
+	type spike struct {
+		start, end             time.Time
+		failed, finished, peak int64
+		topError               string
+	}
+	var spikes []*spike
+	for _, b := range buckets {
+		if b.Start.Before(windowStart) || float64(b.Failed) < threshold {
+			continue
+		}
+		if n := len(spikes); n > 0 && spikes[n-1].end.Equal(b.Start) {
+			s := spikes[n-1]
+			s.end = b.Start.Add(bucket)
+			s.failed += b.Failed
+			s.finished += b.Finished
+			if b.Failed > s.peak {
+				s.peak, s.topError = b.Failed, topError(b)
+			}
+			continue
+		}
+		spikes = append(spikes, &spike{start: b.Start, end: b.Start.Add(bucket), failed: b.Failed, finished: b.Finished, peak: b.Failed, topError: topError(b)})
+	}
+
+	out := make([]Event, 0, len(spikes))
+	for _, s := range spikes {
+		end := s.end
+		out = append(out, Event{
+			ID:       SourceJobFailures + ":" + strconv.FormatInt(s.start.Unix(), 10),
+			At:       s.start,
+			EndedAt:  &end,
+			Source:   SourceJobFailures,
+			Kind:     "spike",
+			Severity: "critical",
+			Title:    fmt.Sprintf("%d of %d finished generation jobs failed", s.failed, s.finished),
+			Details: map[string]any{
+				"failed":              s.failed,
+				"finished":            s.finished,
+				"peak_failed":         s.peak,
+				"baseline_per_bucket": mean,
+				"top_error":           s.topError,
+			},
+		})
+	}
+	return out
+}
+
+func topError(b models.JobFailureBucket) string {
+	if b.TopError == nil {
+		return ""
+	}
+	return *b.TopError
+}
+
+// suspects returns the IDs of the sorted events in the SuspectWindow up to
+// at, latest first
+func suspects(events []Event, at time.Time) []string {
+	var out []string
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		if e.At.After(at) {
+			continue
+		}
+		if e.At.Before(at.Add(-SuspectWindow)) {
+			break
+		}
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+func sortEvents(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].At.Equal(events[j].At) {
+			return events[i].At.Before(events[j].At)
+		}
+		return events[i].ID < events[j].ID
+	})
+}
+
+func alertEvent(a *monitoring.Alert) Event {
+	return Event{
+		ID:       SourceAlert + ":" + a.ID,
+		At:       a.Timestamp,
+		EndedAt:  a.ResolvedAt,
+		Source:   SourceAlert,
+		Kind:     a.Name,
+		Severity: string(a.Level),
+		Title:    a.Message,
+		Details: map[string]any{
+			"metric":        a.Metric,
+			"threshold":     a.Threshold,
+			"current_value": a.CurrentValue,
+			"resolved":      a.Resolved,
+		},
+	}
+}
+
+func securityEvent(e security.SecurityEvent) Event {
+	title := e.Type
+	if e.Action != "" {
+		title += ": " + e.Action
+	}
+	details := map[string]any{"source": e.Source, "ip_address": e.IPAddress, "blocked": e.Blocked}
+	if len(e.Details) > 0 {
+		details["details"] = e.Details
+	}
+	return Event{
+		ID:       SourceSecurity + ":" + e.ID,
+		At:       e.Timestamp,
+		Source:   SourceSecurity,
+		Kind:     e.Type,
+		Severity: string(e.Level),
+		Title:    title,
+		Details:  details,
+	}
+}
+
+func deploymentEvent(m models.DeploymentMarker) Event {
+	e := Event{
+		ID:       SourceDeployment + ":" + strconv.FormatInt(m.ID, 10),
+		At:       m.DeployedAt,
+		Source:   SourceDeployment,
+		Kind:     m.Service,
+		Severity: "info",
+		Title:    fmt.Sprintf("Deployed %s %s", m.Service, m.Version),
+		Details:  map[string]any{"version": m.Version},
+	}
+	if m.Description != nil {
+		e.Details["description"] = *m.Description
+	}
+	if m.CreatedBy != nil {
+		e.Details["created_by"] = *m.CreatedBy
+	}
+	return e
+}
@@ -0,0 +1,117 @@
+// Package incidents_test provides unit tests for the incident timeline
+package incidents_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/incidents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/monitoring"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var t0 = time.Date(2026, 10, 16, 13, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time { return t0.Add(time.Duration(minutes) * time.Minute) }
+
+func bucket(minutes int, finished, failed int64, topError string) models.JobFailureBucket {
+	b := models.JobFailureBucket{Start: at(minutes), Finished: finished, Failed: failed}
+	if topError != "" {
+		b.TopError = &topError
+	}
+	return b
+}
+
+func TestSpikes(t *testing.T) {
+	buckets := []models.JobFailureBucket{
+		// Baseline hour before the window: 12 failures, one per bucket
+		bucket(-60, 40, 6, ""),
+		bucket(-30, 40, 6, ""),
+		// Window
+		bucket(0, 20, 2, ""),
+		bucket(65, 20, 2, "quota exceeded"),
+		bucket(70, 20, 9, "provider timeout"),
+		bucket(75, 20, 4, "provider timeout"),
+		bucket(90, 20, 5, "bad schema"),
+	}
+	spikes := incidents.Spikes(buckets, t0, time.Hour, 5*time.Minute)
+
+	require.Len(t, spikes, 2, "a spike needs three times the baseline and consecutive buckets merge")
+	first := spikes[0]
+	assert.Equal(t, at(70), first.At)
+	assert.Equal(t, at(80), *first.EndedAt)
+	assert.Equal(t, int64(13), first.Details["failed"])
+	assert.Equal(t, int64(9), first.Details["peak_failed"])
+	assert.Equal(t, "provider timeout", first.Details["top_error"])
+	assert.Equal(t, "13 of 40 finished generation jobs failed", first.Title)
+	assert.Equal(t, at(90), spikes[1].At)
+
+	quiet := incidents.Spikes([]models.JobFailureBucket{bucket(5, 2, 2, "")}, t0, time.Hour, 5*time.Minute)
+	assert.Empty(t, quiet, "a bucket needs a few failures to spike, however quiet the baseline")
+}
+
+type fakeAlerts map[string]*monitoring.Alert
+
+func (f fakeAlerts) GetAlerts() map[string]*monitoring.Alert { return f }
+
+type fakeDeployments []models.DeploymentMarker
+
+func (f fakeDeployments) Between(_ context.Context, from, to time.Time) ([]models.DeploymentMarker, error) {
+	var out []models.DeploymentMarker
+	for _, m := range f {
+		if !m.DeployedAt.Before(from) && m.DeployedAt.Before(to) {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+type fakeJobs []models.JobFailureBucket
+
+func (f fakeJobs) JobFailureBuckets(_ context.Context, from, to time.Time, _ time.Duration) ([]models.JobFailureBucket, error) {
+	var out []models.JobFailureBucket
+	for _, b := range f {
+		if !b.Start.Before(from) && b.Start.Before(to) {
+			out = append(out, b)
+		}
+	}
+	return out, nil
+}
+
+func TestTimeline(t *testing.T) {
+	resolvedEarly, resolvedLate := at(-20), at(30)
+	alerts := fakeAlerts{
+		"a1": {ID: "a1", Name: "High CPU Usage", Level: monitoring.AlertLevelWarning, Timestamp: at(-90), ResolvedAt: &resolvedEarly, Resolved: true},
+		"a2": {ID: "a2", Name: "High Memory Usage", Level: monitoring.AlertLevelWarning, Timestamp: at(-10), ResolvedAt: &resolvedLate, Resolved: true},
+		"a3": {ID: "a3", Name: "Database Down", Level: monitoring.AlertLevelCritical, Timestamp: at(62)},
+	}
+	sec := security.NewSecurityService()
+	sec.RecordEvent(security.SecurityEvent{ID: "s1", Timestamp: at(40), Level: security.ThreatLevelHigh, Type: "brute_force", Action: "blocked"})
+	sec.RecordEvent(security.SecurityEvent{ID: "s2", Timestamp: at(-5), Level: security.ThreatLevelLow, Type: "scan"})
+	deploys := fakeDeployments{{ID: 7, Service: "api", Version: "v2.3.0", DeployedAt: at(55)}}
+	jobs := fakeJobs{bucket(-30, 50, 1, ""), bucket(65, 30, 12, "provider timeout")}
+
+	c := incidents.NewCorrelator(alerts, sec, deploys, jobs)
+	tl, err := c.Timeline(context.Background(), t0, at(120), 5*time.Minute)
+	require.NoError(t, err)
+
+	var ids []string
+	for _, e := range tl.Events {
+		ids = append(ids, e.ID)
+	}
+	assert.Equal(t, []string{"alert:a2", "security:s1", "deployment:7", "alert:a3", "job_failures:" + strconv.FormatInt(at(65).Unix(), 10)}, ids,
+		"alerts active in the window are kept even when raised before it")
+	spike := tl.Events[4]
+	assert.Equal(t, []string{"alert:a3", "deployment:7", "security:s1"}, spike.PrecededBy, "events of the half hour before a spike, latest first")
+	assert.False(t, tl.Truncated)
+
+	empty, err := incidents.NewCorrelator(nil, nil, nil, nil).Timeline(context.Background(), t0, at(60), time.Minute)
+	require.NoError(t, err)
+	assert.NotNil(t, empty.Events)
+	assert.Empty(t, empty.Events)
+}
@@ -0,0 +1,602 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/annotations"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/arrays"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/delta"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/eventstream"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fhir"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/finmsg"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fixedwidth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/freetext"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/hierarchy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/modelserving"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/multitable"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/nested"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/provenance"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/qualitygate"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rareevents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/relationships"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/structure"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/vocabulary"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/warehouse"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/watermark"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/weights"
+)
+
+// Generator is the agent call a processor delegates to
+type Generator interface {
+	GenerateSyntheticData(ctx context.Context, req *agents.GenerationRequest) (*agents.GenerationResponse, error)
+}
+
+// StreamingGenerator is a generator that produces rows in batches
+type StreamingGenerator interface {
+	StreamGeneration(ctx context.Context, req *agents.GenerationRequest, batchRows int64, onBatch func(agents.StreamBatch) error) (*agents.GenerationResponse, error)
+}
+
+// ErrExportFormatsUnsupported is returned for jobs asking for further
+// export formats that their generator or job type cannot write
+var ErrExportFormatsUnsupported = errors.New("export formats need a single-table job with a streaming generator")
+
+// LocalProvider is the provider recorded for jobs generated without one
+const LocalProvider = "local"
+
+// AgentProcessor processes jobs with a generation agent and records the
+// provider and model it is configured with. Agents that stream have their
+// row batches published to Events as they arrive and the rows returned as
+// the job output. Jobs asking for the statistical strategy are generated
+// by Statistical instead, when set, without calling any provider; jobs
+// naming an uploaded model are generated by Custom. Jobs delivered as the
+// changes from a previous run read that run's rows from Previous. Jobs
+// asking for a watermark have their values marked with WatermarkKey; event
+// streams, which hold no generated values, are not. Rows of jobs held to a
+// quality policy are checked before they are delivered.
+type AgentProcessor struct {
+	Generator   Generator
+	Provider    string
+	Model       string
+	Events      *Events
+	BatchRows   int64
+	Statistical Generator
+	Custom      Generator
+	Previous    delta.Source
+	// WatermarkKey is the secret watermarks are derived from; jobs are not
+	// marked without one
+	WatermarkKey []byte
+}
+
+func (a AgentProcessor) Process(ctx context.Context, job *models.GenerationJob, req *agents.GenerationRequest, progress func(float64)) (*Result, error) {
+	progress(0.1)
+	// Further formats are written from the rows of a single table, which
+	// only streaming generators hand back; the job fails rather than
+	// finishing without them
+	if len(req.ExportFormats) > 0 && (req.EventStream != nil || req.MultiTable != nil) {
+		return nil, Permanent(ErrExportFormatsUnsupported)
+	}
+	if req.EventStream != nil {
+		return eventStream(job, req, progress)
+	}
+	base := a
+	a = a.route(req)
+	sg, streams := a.Generator.(StreamingGenerator)
+	if len(req.ExportFormats) > 0 && !streams {
+		return nil, Permanent(ErrExportFormatsUnsupported)
+	}
+	if req.MultiTable != nil {
+		// Keys are assigned to rows as they are collected, which only
+		// streaming generators return
+		if !streams {
+			return nil, Permanent(errors.New("multi-table jobs need a streaming generator"))
+		}
+		return a.multiTable(ctx, sg, job, req, progress)
+	}
+	if streams && req.QualityGate != nil {
+		return base.gated(ctx, job, req, progress)
+	}
+	if streams {
+		return a.stream(ctx, sg, job, req, progress)
+	}
+	resp, err := a.Generator.GenerateSyntheticData(ctx, req)
+	if unrecoverable(err) {
+		return nil, Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if resp.Error != nil {
+		return nil, fmt.Errorf("generation failed: %s", *resp.Error)
+	}
+	progress(0.9)
+
+	quality := resp.QualityMetrics.OverallQuality
+	return &Result{
+		OutputKey:     resp.OutputKey,
+		RowsGenerated: req.Config.Rows,
+		Provider:      a.Provider,
+		Model:         a.Model,
+		QualityScore:  &quality,
+	}, nil
+}
+
+// route returns the processor generating a request: the uploaded model it
+// names, the statistical generator for the statistical strategy, or the
+// configured generator
+func (a AgentProcessor) route(req *agents.GenerationRequest) AgentProcessor {
+	switch {
+	case req.CustomModel != nil && a.Custom != nil:
+		a.Generator, a.Provider, a.Model = a.Custom, string(agents.ProviderCustom), req.CustomModel.Name()
+	case req.Config.Strategy == agents.StrategyStatistical && a.Statistical != nil:
+		a.Generator, a.Provider, a.Model = a.Statistical, LocalProvider, agents.StatisticalModel
+	}
+	return a
+}
+
+func (a AgentProcessor) stream(ctx context.Context, sg StreamingGenerator, job *models.GenerationJob, req *agents.GenerationRequest, progress func(float64)) (*Result, error) {
+	rows, result, err := a.collect(ctx, sg, job, req, progress)
+	if err != nil {
+		return nil, err
+	}
+	return a.deliver(ctx, job, req, rows, result)
+}
+
+// gated generates the rows of a job held to its dataset's quality policy.
+// Rows failing the policy are generated again with each fallback strategy
+// in turn, under the generator that strategy routes to, when the policy
+// retries; the job fails with the checks that failed when no attempt
+// passes. Batches of rejected attempts have already been published to the
+// job's event stream.
+func (a AgentProcessor) gated(ctx context.Context, job *models.GenerationJob, req *agents.GenerationRequest, progress func(float64)) (*Result, error) {
+	policy := req.QualityGate
+	strategies := []agents.GenerationStrategy{req.Config.Strategy}
+	if policy.OnFailure == models.QualityGateRetry {
+		for _, s := range policy.FallbackStrategies {
+			strategies = append(strategies, agents.GenerationStrategy(s))
+		}
+	}
+	var report models.QualityGateReport
+	for i, strategy := range strategies {
+		attempt := req
+		if i > 0 {
+			retry := *req
+			retry.Config.Strategy = strategy
+			attempt = &retry
+		}
+		p := a.route(attempt)
+		sg, ok := p.Generator.(StreamingGenerator)
+		if !ok {
+			continue
+		}
+		rows, result, err := p.collect(ctx, sg, job, attempt, progress)
+		// A statistical fallback has nothing to fit without source rows
+		if i > 0 && errors.Is(err, agents.ErrNoReference) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var fidelityReport *fidelity.Report
+		if result.QualityDetails != nil {
+			fidelityReport = result.QualityDetails.Fidelity
+		}
+		checks := qualitygate.Check(*policy, qualitygate.Measure(attempt.Reference, rows, fidelityReport, result.QualityScore))
+		passed := qualitygate.Passed(checks)
+		report.Attempts = append(report.Attempts, models.QualityGateAttempt{
+			Strategy: string(strategy),
+			Provider: p.Provider,
+			Model:    p.Model,
+			Passed:   passed,
+			Checks:   checks,
+		})
+		if !passed {
+			continue
+		}
+		report.Passed = true
+		if result.QualityDetails == nil {
+			result.QualityDetails = &models.QualityDetails{}
+		}
+		result.QualityDetails.QualityGate = &report
+		return p.deliver(ctx, job, attempt, rows, result)
+	}
+	return nil, Permanent(&qualitygate.RejectedError{Report: report})
+}
+
+// deliver encodes the rows of a job in its output format and further
+// export formats, as the changes from the previous run when asked
+func (a AgentProcessor) deliver(ctx context.Context, job *models.GenerationJob, req *agents.GenerationRequest, rows []map[string]interface{}, result *Result) (*Result, error) {
+	var err error
+	if req.Delta != nil {
+		if rows, err = a.delta(ctx, job, req, rows, result); err != nil {
+			return nil, err
+		}
+	}
+	format := req.ExportFormat
+	if format == "" {
+		format = "json"
+	}
+	switch format {
+	case fixedwidth.Format:
+		result.Output, err = fixedwidth.Encode(rows, req.FixedWidth)
+	case fhir.Format:
+		result.Output, err = fhir.Encode(rows, req.FHIR)
+	case finmsg.Format:
+		result.Output, err = finmsg.Encode(rows, req.FinancialMessage, time.Now())
+	default:
+		result.Output, err = EncodeRows(rows, format)
+	}
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("failed to encode generated rows: %w", err))
+	}
+	result.OutputFormat = &format
+	result.Exports = encodeExports(rows, req.ExportFormats)
+	return result, nil
+}
+
+// encodeExports writes the rows in each further format at once, from the
+// rows already in memory
+func encodeExports(rows []map[string]interface{}, formats []string) []Export {
+	out := make([]Export, len(formats))
+	var wg sync.WaitGroup
+	for i, format := range formats {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			out[i] = Export{Format: format, Err: export.Encode(format, &buf, rows)}
+			if out[i].Err == nil {
+				out[i].Output = buf.Bytes()
+			}
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// delta replaces the rows of a job with their changes from the snapshot of
+// the previous run and records the change manifest. The job's ID seeds the
+// entities that change, so a retry delivers the same changes.
+func (a AgentProcessor) delta(ctx context.Context, job *models.GenerationJob, req *agents.GenerationRequest, rows []map[string]interface{}, result *Result) ([]map[string]interface{}, error) {
+	if a.Previous == nil {
+		return nil, Permanent(delta.ErrNoSource)
+	}
+	base, previous, err := delta.Snapshot(ctx, a.Previous, job.UserID, req.Delta.PreviousJobID, req.Delta.Key)
+	if err != nil {
+		// Storage reads may succeed on a later attempt; runs that are gone,
+		// unreadable or inconsistent will not
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, warehouse.ErrOutputUnavailable) || errors.Is(err, export.ErrUnsupportedFormat) ||
+			errors.Is(err, delta.ErrKeyMismatch) || errors.Is(err, delta.ErrChainTooLong) || errors.Is(err, delta.ErrInvalidKey) || errors.Is(err, delta.ErrInvalidChange) {
+			return nil, Permanent(err)
+		}
+		return nil, err
+	}
+	out, manifest, err := delta.Diff(previous, rows, *req.Delta, job.ID)
+	if err != nil {
+		return nil, Permanent(err)
+	}
+	manifest.BaseJobID = base
+	if result.QualityDetails == nil {
+		result.QualityDetails = &models.QualityDetails{}
+	}
+	result.QualityDetails.Delta = manifest
+	result.RowsGenerated = int64(len(out))
+	return out, nil
+}
+
+// eventStream generates a job's event stream without any provider; the
+// job's ID seeds streams that do not set their own seed
+func eventStream(job *models.GenerationJob, req *agents.GenerationRequest, progress func(float64)) (*Result, error) {
+	output, report, err := eventstream.Generate(*req.EventStream, job.ID)
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("failed to generate event stream: %w", err))
+	}
+	progress(0.9)
+	format := req.EventStream.Format
+	return &Result{
+		Output:         output,
+		OutputFormat:   &format,
+		RowsGenerated:  report.Events,
+		Provider:       LocalProvider,
+		Model:          eventstream.Model,
+		QualityDetails: &models.QualityDetails{EventStream: report},
+	}, nil
+}
+
+// multiTable generates the tables of a multi-table job parents first, each
+// from its own request, and links their keys as each table is collected. The
+// tables are checked against each other and delivered as one bundle; a
+// bundle whose keys do not hold is retried.
+func (a AgentProcessor) multiTable(ctx context.Context, sg StreamingGenerator, job *models.GenerationJob, req *agents.GenerationRequest, progress func(float64)) (*Result, error) {
+	plan := req.MultiTable
+	linker := multitable.NewLinker(plan, job.ID)
+	tables := make(map[string][]map[string]interface{}, len(plan.Tables))
+	var total int64
+	var score float64
+	var marks *models.WatermarkReport
+	for i, t := range plan.Tables {
+		if t.Request == nil {
+			return nil, Permanent(fmt.Errorf("table %s has no request", t.Name))
+		}
+		tr := *t.Request
+		tr.Config.Rows = linker.Rows(t)
+		tr.ExportFormat = ""
+		tr.Watermark = req.Watermark
+		var rows []map[string]interface{}
+		if tr.Config.Rows > 0 {
+			// Each table takes an equal share of the job's progress
+			share := func(p float64) {
+				progress(0.1 + 0.8*(float64(i)+(p-0.1)/0.8)/float64(len(plan.Tables)))
+			}
+			var result *Result
+			var err error
+			if rows, result, err = a.collect(ctx, sg, job, &tr, share); err != nil {
+				return nil, err
+			}
+			if result.QualityScore != nil {
+				score += *result.QualityScore * float64(len(rows))
+			}
+			if result.QualityDetails != nil {
+				marks = watermark.Merge(marks, result.QualityDetails.Watermark)
+			}
+		}
+		rows = linker.Link(t, rows)
+		tables[t.Name] = rows
+		total += int64(len(rows))
+	}
+	report, err := multitable.Check(plan, tables, linker.Renumbered)
+	if err != nil {
+		return nil, err
+	}
+	output, err := multitable.Bundle(plan, tables, report)
+	if err != nil {
+		return nil, Permanent(fmt.Errorf("failed to bundle generated tables: %w", err))
+	}
+	format := multitable.Format
+	result := &Result{
+		Output:         output,
+		OutputFormat:   &format,
+		RowsGenerated:  total,
+		Provider:       a.Provider,
+		Model:          a.Model,
+		QualityDetails: &models.QualityDetails{MultiTable: report, Watermark: marks},
+	}
+	if total > 0 {
+		quality := score / float64(total)
+		result.QualityScore = &quality
+	}
+	return result, nil
+}
+
+// collect streams the rows of a request through the filters every job's rows
+// pass and returns them with the result they are delivered under
+func (a AgentProcessor) collect(ctx context.Context, sg StreamingGenerator, job *models.GenerationJob, req *agents.GenerationRequest, progress func(float64)) ([]map[string]interface{}, *Result, error) {
+	// Rows breaking the column annotations, an accepted dependency, a
+	// hierarchy, a rare event rule, the shape of a nested column or the
+	// lists of an array column are dropped before anyone sees them; the
+	// weight column of a population target is removed the same way. The
+	// rows that remain have suspected PII scrubbed from their free text and
+	// their configured columns protected, then their vocabulary columns
+	// drawn from the approved values, and are checked against a
+	// fixed-width layout, the FHIR resource profiles or a payment message
+	// schema before they are given their duplicates and group sizes last,
+	// so duplicates repeat protected values that can be exported. Rows are
+	// watermarked and tagged with their provenance as they are delivered.
+	shapes := nested.NewValidator(req.SchemaAnalysis.NestedColumns)
+	lists := arrays.NewTracker(req.SchemaAnalysis.ArrayColumns)
+	enforcer := annotations.NewEnforcer(req.SchemaAnalysis.Columns)
+	deps := relationships.NewEnforcer(req.SchemaAnalysis.Relationships)
+	levels := hierarchy.NewEnforcer(req.SchemaAnalysis.Hierarchies)
+	rare := rareevents.NewController(req.SchemaAnalysis.RareEvents, req.Config.Rows)
+	weighting := weights.NewTracker(req.SchemaAnalysis.Weighting)
+	shaper := structure.NewShaper(req.SchemaAnalysis.Structure, job.ID)
+	protector, err := privacy.NewColumnProtector(privacy.PrivacyLevel(req.Config.PrivacyLevel), req.SchemaAnalysis.ColumnPrivacy)
+	if err != nil {
+		return nil, nil, Permanent(err)
+	}
+	prose := freetext.NewChecker(req.SchemaAnalysis.FreeText)
+	dictionary := vocabulary.NewSampler(req.SchemaAnalysis.Vocabularies, job.ID)
+	fit := fixedwidth.NewChecker(req.FixedWidth)
+	records := fhir.NewChecker(req.FHIR)
+	messages := finmsg.NewChecker(req.FinancialMessage)
+	tags := provenance.NewTagger(req.Provenance, provenance.Context{
+		JobID:           job.ID,
+		TemplateVersion: a.templateVersion(),
+		Provider:        a.Provider,
+		Model:           a.Model,
+	}, time.Now)
+	var marker *watermark.Marker
+	if req.Watermark {
+		marker = watermark.NewMarker(a.WatermarkKey, job.ID, unmarked(req))
+	}
+	rows := make([]map[string]interface{}, 0, req.Config.Rows)
+	resp, err := sg.StreamGeneration(ctx, req, a.BatchRows, func(b agents.StreamBatch) error {
+		b.Rows = tags.Tag(b.Batch, marker.Filter(shaper.Filter(messages.Filter(records.Filter(fit.Filter(dictionary.Filter(protector.Filter(prose.Filter(weighting.Filter(rare.Filter(levels.Filter(deps.Filter(enforcer.Filter(lists.Filter(shapes.Filter(b.Rows))))))))))))))))
+		rows = append(rows, b.Rows...)
+		quality := b.Quality
+		a.Events.Publish(Event{
+			Type:      EventRows,
+			JobID:     job.ID,
+			Progress:  b.Progress,
+			Batch:     b.Batch,
+			Rows:      b.Rows,
+			RowsDone:  b.RowsDone,
+			RowsTotal: b.RowsTotal,
+			Quality:   &quality,
+			Status:    models.GenRunning,
+		})
+		progress(0.1 + 0.8*b.Progress)
+		return nil
+	})
+	if unrecoverable(err) {
+		return nil, nil, Permanent(err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	// Correlations cannot be checked row by row; an output that lost an
+	// accepted one is retried like any other failed attempt
+	if err := relationships.Verify(rows, req.SchemaAnalysis.Relationships); err != nil {
+		return nil, nil, err
+	}
+	// Every delivered value of a vocabulary column must be approved; draws
+	// repeat with the job, so a retry would fail the same way
+	vocabularies, err := vocabulary.Check(rows, req.SchemaAnalysis.Vocabularies)
+	if err != nil {
+		return nil, nil, Permanent(err)
+	}
+
+	quality := resp.QualityMetrics.OverallQuality
+	result := &Result{
+		RowsGenerated: int64(len(rows)),
+		Provider:      a.Provider,
+		Model:         a.Model,
+		QualityScore:  &quality,
+	}
+	rareReport, distributions, hierarchies, nestedReport, arrayReport := rare.Report(), weighting.Report(), levels.Report(), shapes.Report(), lists.Report()
+	structureReport, privacyReport, layoutReport := shaper.Report(), protector.Report(), fit.Report()
+	fhirReport, messageReport, textReport, manifest := records.Report(), messages.Report(), prose.Report(), tags.Manifest()
+	marks := marker.Report()
+	// Batches are scored as they arrive; the rows delivered are measured
+	// against the source once more as a whole
+	fidelityReport := fidelity.Compare(req.Reference, rows)
+	if rareReport != nil || distributions != nil || hierarchies != nil || nestedReport != nil || arrayReport != nil || vocabularies != nil || textReport != nil ||
+		structureReport != nil || privacyReport != nil || layoutReport != nil || fhirReport != nil || messageReport != nil ||
+		fidelityReport != nil || manifest != nil || marks != nil {
+		result.QualityDetails = &models.QualityDetails{
+			RareEvents:    rareReport,
+			Distributions: distributions,
+			Hierarchies:   hierarchies,
+			NestedColumns: nestedReport,
+			ArrayColumns:  arrayReport,
+			Vocabularies:  vocabularies,
+			FreeText:      textReport,
+			Structure:     structureReport,
+			Privacy:       privacyReport,
+			FixedWidth:    layoutReport,
+			FHIR:          fhirReport,
+			Messages:      messageReport,
+			Fidelity:      fidelityReport,
+			Provenance:    manifest,
+			Watermark:     marks,
+		}
+	}
+	return rows, result, nil
+}
+
+// unmarked names the columns a watermark must leave as generated: unique
+// and bounded columns, whose values a mark could repeat or push out of
+// bounds, columns drawn from a vocabulary or held to rare event bounds, and
+// the key rows are matched on between runs
+func unmarked(req *agents.GenerationRequest) []string {
+	var out []string
+	for _, c := range req.SchemaAnalysis.Columns {
+		_, lower := c.Constraints[annotations.ConstraintMin]
+		_, upper := c.Constraints[annotations.ConstraintMax]
+		if c.IsUnique || lower || upper {
+			out = append(out, c.Name)
+		}
+	}
+	for _, v := range req.SchemaAnalysis.Vocabularies {
+		out = append(out, v.Column)
+	}
+	for _, r := range req.SchemaAnalysis.RareEvents {
+		out = append(out, r.Column)
+	}
+	if req.Delta != nil {
+		out = append(out, req.Delta.Key)
+	}
+	return out
+}
+
+// templateVersion is what delivered rows are traced back to: the prompt
+// template for providers, the model itself for generators without a prompt
+func (a AgentProcessor) templateVersion() string {
+	if a.Provider == LocalProvider || a.Provider == string(agents.ProviderCustom) {
+		return a.Model
+	}
+	return agents.PromptTemplateVersion
+}
+
+// unrecoverable reports whether a generation error would fail every attempt
+func unrecoverable(err error) bool {
+	for _, target := range []error{
+		privacy.ErrRealDataForbidden, agents.ErrNoReference, agents.ErrNoCustomModel,
+		modelserving.ErrNotConfigured, modelserving.ErrUnsupportedFramework, modelserving.ErrRejected,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// EncodeRows renders generated rows as json or csv. CSV columns are the
+// union of row keys in sorted order; nested values are written as JSON.
+func EncodeRows(rows []map[string]interface{}, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.Marshal(rows)
+	case "csv":
+		seen := make(map[string]struct{})
+		var header []string
+		for _, row := range rows {
+			for k := range row {
+				if _, ok := seen[k]; !ok {
+					seen[k] = struct{}{}
+					header = append(header, k)
+				}
+			}
+		}
+		sort.Strings(header)
+
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		if err := w.Write(header); err != nil {
+			return nil, err
+		}
+		record := make([]string, len(header))
+		for _, row := range rows {
+			for i, k := range header {
+				record[i] = csvValue(row[k])
+			}
+			if err := w.Write(record); err != nil {
+				return nil, err
+			}
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+func csvValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	case map[string]interface{}, []interface{}:
+		raw, _ := json.Marshal(x)
+		return string(raw)
+	}
+	return fmt.Sprint(v)
+}
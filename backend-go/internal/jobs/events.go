@@ -0,0 +1,107 @@
+package jobs
+
+import (
+	"sync"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Event types published while a job runs
+const (
+	EventProgress  = "progress"
+	EventRows      = "rows"
+	EventCompleted = "completed"
+	EventFailed    = "failed"
+	EventCancelled = "cancelled"
+	// A paused job publishes EventPaused and, once resumed, EventResumed
+	// before it runs again from the start
+	EventPaused  = "paused"
+	EventResumed = "resumed"
+)
+
+// Event is a live update on a running job
+type Event struct {
+	Type      string                   `json:"type"`
+	JobID     int64                    `json:"job_id"`
+	Progress  float64                  `json:"progress"`
+	Batch     int                      `json:"batch,omitempty"`
+	Rows      []map[string]interface{} `json:"rows,omitempty"`
+	RowsDone  int64                    `json:"rows_done,omitempty"`
+	RowsTotal int64                    `json:"rows_total,omitempty"`
+	Quality   *agents.QualityMetrics   `json:"quality,omitempty"`
+	Status    models.GenerationStatus  `json:"status,omitempty"`
+	Error     string                   `json:"error,omitempty"`
+	// RowsWithheld is set when rows were produced but the subscriber may
+	// not see them
+	RowsWithheld bool `json:"rows_withheld,omitempty"`
+}
+
+// Terminal reports whether no further events follow
+func (e Event) Terminal() bool {
+	return e.Type == EventCompleted || e.Type == EventFailed || e.Type == EventCancelled
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind before it
+// is dropped
+const subscriberBuffer = 64
+
+// Events fans job events out to subscribers in this process. Subscribers
+// only see events published after they subscribed; one that falls too far
+// behind has its channel closed rather than silently missing rows.
+type Events struct {
+	mu   sync.Mutex
+	subs map[int64]map[chan Event]struct{}
+}
+
+func NewEvents() *Events {
+	return &Events{subs: make(map[int64]map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of a job's events and a function that ends
+// the subscription
+func (e *Events) Subscribe(jobID int64) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	e.mu.Lock()
+	if e.subs[jobID] == nil {
+		e.subs[jobID] = make(map[chan Event]struct{})
+	}
+	e.subs[jobID][ch] = struct{}{}
+	e.mu.Unlock()
+	return ch, func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.drop(jobID, ch)
+	}
+}
+
+// Publish delivers an event to the job's subscribers without blocking
+func (e *Events) Publish(ev Event) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for ch := range e.subs[ev.JobID] {
+		select {
+		case ch <- ev:
+		default:
+			e.drop(ev.JobID, ch)
+		}
+	}
+}
+
+func (e *Events) drop(jobID int64, ch chan Event) {
+	subs, ok := e.subs[jobID]
+	if !ok {
+		return
+	}
+	if _, ok := subs[ch]; !ok {
+		return
+	}
+	delete(subs, ch)
+	close(ch)
+	if len(subs) == 0 {
+		delete(e.subs, jobID)
+	}
+}
@@ -0,0 +1,560 @@
+// Package jobs runs generation jobs in the background. The queue lives in
+// Postgres on the generation_jobs table itself: the API enqueues a job with
+// its GenerationRequest payload, a pool of workers claims due jobs, reports
+// progress while they run and retries failures with exponential backoff.
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+	"go.uber.org/zap"
+)
+
+// Store persists queued jobs and their status transitions
+// (queued → running → completed/failed, running → queued on retry). Jobs
+// are cancelled, paused and resumed by the API behind the pool's back.
+type Store interface {
+	Enqueue(ctx context.Context, jobID int64, payload []byte) error
+	Claim(ctx context.Context, worker string, lease time.Duration) (*models.GenerationJob, []byte, error)
+	UpdateProgress(ctx context.Context, jobID int64, worker string, progress float64, lease time.Duration) error
+	Complete(ctx context.Context, job *models.GenerationJob) error
+	Retry(ctx context.Context, jobID int64, at time.Time, reason string) error
+	Fail(ctx context.Context, jobID int64, reason string) error
+}
+
+// Notifier is told when a job finishes for good
+type Notifier interface {
+	Notify(ctx context.Context, n *models.Notification) error
+}
+
+// Publisher delivers job lifecycle events to the owner's webhooks
+type Publisher interface {
+	Publish(ctx context.Context, userID int64, eventType string, data map[string]interface{}) error
+}
+
+// Advisor estimates what a completed job would have cost and scored under
+// other models
+type Advisor interface {
+	Recommend(ctx context.Context, job *models.GenerationJob) ([]models.TradeoffRecommendation, error)
+}
+
+// Result is what a processor produced for a job. Processors either store
+// the output themselves and return its OutputKey, or return the bytes in
+// Output for the pool to encrypt and store.
+type Result struct {
+	Output        []byte
+	OutputKey     *string
+	OutputFormat  *string
+	RowsGenerated int64
+	Provider      string
+	Model         string
+	TokensUsed    int64
+	CostUSD       float64
+	QualityScore  *float64
+	// QualityDetails holds per-column quality reports, if any were made
+	QualityDetails *models.QualityDetails
+	// Exports are the rows in further formats, stored next to Output under
+	// its key
+	Exports []Export
+}
+
+// Export is a job's rows in one further format, or the error that kept
+// them from it
+type Export struct {
+	Format string
+	Output []byte
+	Err    error
+}
+
+// Processor runs one generation job. progress may be called with values
+// between 0 and 1; ctx is cancelled if the job is cancelled meanwhile.
+type Processor interface {
+	Process(ctx context.Context, job *models.GenerationJob, req *agents.GenerationRequest, progress func(float64)) (*Result, error)
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks a processing error that retrying cannot fix
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// Queue enqueues generation jobs for the worker pool
+type Queue struct{ store Store }
+
+func NewQueue(store Store) *Queue { return &Queue{store: store} }
+
+// Enqueue queues a pending job with the request the worker will run
+func (q *Queue) Enqueue(ctx context.Context, jobID int64, req *agents.GenerationRequest) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode generation request: %w", err)
+	}
+	return q.store.Enqueue(ctx, jobID, payload)
+}
+
+// Config tunes the worker pool
+type Config struct {
+	Workers      int
+	MaxAttempts  int
+	PollInterval time.Duration
+	// Lease is how long a claimed job stays locked without a heartbeat
+	// before another worker may take it over
+	Lease       time.Duration
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Workers:      4,
+		MaxAttempts:  3,
+		PollInterval: 2 * time.Second,
+		Lease:        2 * time.Minute,
+		BaseBackoff:  10 * time.Second,
+		MaxBackoff:   10 * time.Minute,
+	}
+}
+
+// Backoff returns the delay before retrying after the given attempt:
+// base doubled per earlier attempt, capped at max
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= max {
+			return max
+		}
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
+
+// Pool is a set of workers processing queued generation jobs
+type Pool struct {
+	store  Store
+	proc   Processor
+	cfg    Config
+	logger *zap.Logger
+	id     string
+	sealer *OutputSealer
+	notify Notifier
+	events *Events
+	hooks  Publisher
+	advice Advisor
+	tx     Transactor
+	outbox Outbox
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// drain is closed once the pool stops claiming jobs
+	drain     chan struct{}
+	drainOnce sync.Once
+
+	mu      sync.Mutex
+	running map[int64]*heartbeat
+}
+
+func NewPool(store Store, proc Processor, cfg Config, logger *zap.Logger) *Pool {
+	def := DefaultConfig()
+	if cfg.Workers <= 0 {
+		cfg.Workers = def.Workers
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = def.MaxAttempts
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = def.PollInterval
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = def.Lease
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = def.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	host, _ := os.Hostname()
+	return &Pool{store: store, proc: proc, cfg: cfg, logger: logger, id: fmt.Sprintf("%s-%d", host, os.Getpid()),
+		running: make(map[int64]*heartbeat), drain: make(chan struct{})}
+}
+
+// SetSealer enables per-job encryption of outputs returned in Result.Output
+func (p *Pool) SetSealer(s *OutputSealer) {
+	p.sealer = s
+}
+
+// SetNotifier notifies job owners of completed and failed jobs
+func (p *Pool) SetNotifier(n Notifier) {
+	p.notify = n
+}
+
+// SetWebhooks publishes completed and failed jobs to the owner's webhooks
+func (p *Pool) SetWebhooks(h Publisher) {
+	p.hooks = h
+}
+
+// SetAdvisor stores what-if recommendations with completed jobs
+func (p *Pool) SetAdvisor(a Advisor) {
+	p.advice = a
+}
+
+// SetEvents publishes progress and completion of jobs to live streams
+func (p *Pool) SetEvents(e *Events) {
+	p.events = e
+}
+
+// recommend adds the advisor's recommendations to a job's quality details.
+// They are advice, so a job completes without them when they fail.
+func (p *Pool) recommend(ctx context.Context, job *models.GenerationJob) {
+	if p.advice == nil {
+		return
+	}
+	recs, err := p.advice.Recommend(ctx, job)
+	if err != nil {
+		p.logger.Warn("failed to compute job recommendations", zap.Int64("job_id", job.ID), zap.Error(err))
+		return
+	}
+	if len(recs) == 0 {
+		return
+	}
+	if job.QualityDetails == nil {
+		job.QualityDetails = &models.QualityDetails{}
+	}
+	job.QualityDetails.Recommendations = recs
+}
+
+// Start launches the workers; they run until Stop is called or ctx ends
+func (p *Pool) Start(ctx context.Context) {
+	ctx, p.cancel = context.WithCancel(ctx)
+	for i := 0; i < p.cfg.Workers; i++ {
+		worker := fmt.Sprintf("%s/%d", p.id, i)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.work(ctx, worker)
+		}()
+	}
+}
+
+// Interrupt stops a job this pool is running once it was cancelled or
+// paused, rather than when the next heartbeat finds out. It reports whether
+// the job was running here; jobs run by other instances stop on their own
+// heartbeat.
+func (p *Pool) Interrupt(jobID int64) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	hb := p.running[jobID]
+	p.mu.Unlock()
+	if hb == nil {
+		return false
+	}
+	hb.release()
+	return true
+}
+
+// Stop cancels the workers and waits for them to return. Jobs interrupted
+// mid-run are queued again right away for another worker.
+func (p *Pool) Stop() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+	p.wg.Wait()
+}
+
+// Drain stops claiming jobs and waits for the running ones to finish until
+// ctx ends, then stops the pool; jobs still running by then are interrupted
+// and queued again as by Stop.
+func (p *Pool) Drain(ctx context.Context) {
+	p.drainOnce.Do(func() { close(p.drain) })
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	p.Stop()
+}
+
+func (p *Pool) work(ctx context.Context, worker string) {
+	for {
+		select {
+		case <-p.drain:
+			return
+		default:
+		}
+		ran, err := p.RunOnce(ctx, worker)
+		if err != nil && ctx.Err() == nil {
+			p.logger.Error("generation worker failed", zap.String("worker", worker), zap.Error(err))
+		}
+		if ran {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.drain:
+			return
+		case <-time.After(p.cfg.PollInterval):
+		}
+	}
+}
+
+// RunOnce claims and processes a single due job. It reports whether a job
+// was claimed.
+func (p *Pool) RunOnce(ctx context.Context, worker string) (bool, error) {
+	job, payload, err := p.store.Claim(ctx, worker, p.cfg.Lease)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim job: %w", err)
+	}
+
+	var req agents.GenerationRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return true, p.fail(ctx, job, "invalid job payload: "+err.Error())
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	hb := &heartbeat{pool: p, ctx: jobCtx, cancel: cancel, job: job.ID, worker: worker}
+	stop := hb.run()
+	p.mu.Lock()
+	p.running[job.ID] = hb
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.running, job.ID)
+		p.mu.Unlock()
+	}()
+
+	started := time.Now()
+	res, procErr := p.proc.Process(jobCtx, job, &req, hb.report)
+	stop()
+
+	if ctx.Err() != nil {
+		// Shutting down; the job goes back on the queue rather than waiting
+		// for its lease to expire
+		p.requeue(job.ID)
+		return true, nil
+	}
+	if hb.lost() {
+		p.logger.Info("generation job released", zap.Int64("job_id", job.ID), zap.String("worker", worker))
+		return true, nil
+	}
+	if procErr == nil && res.Output != nil {
+		if p.sealer == nil {
+			procErr = Permanent(ErrNoOutputSealer)
+		} else if stored, exports, delivery, err := p.sealer.Seal(ctx, job, res.Output, res.Exports); err != nil {
+			procErr = err
+		} else {
+			res.OutputKey = &stored.ObjectKey
+			if res.QualityDetails == nil {
+				res.QualityDetails = &models.QualityDetails{}
+			}
+			if res.OutputFormat != nil {
+				stored.Format = *res.OutputFormat
+			}
+			res.QualityDetails.Output = &stored
+			if len(exports) > 0 {
+				res.QualityDetails.Exports = exports
+			}
+			res.QualityDetails.Delivery = delivery
+		}
+	}
+	if procErr == nil {
+		job.OutputKey = res.OutputKey
+		if res.OutputFormat != nil {
+			job.OutputFormat = res.OutputFormat
+		}
+		job.RowsGenerated = res.RowsGenerated
+		job.ProcessingTime = time.Since(started).Seconds()
+		job.Provider = &res.Provider
+		job.Model = &res.Model
+		job.TokensUsed = res.TokensUsed
+		job.CostUSD = res.CostUSD
+		job.QualityScore = res.QualityScore
+		job.QualityDetails = res.QualityDetails
+		p.recommend(ctx, job)
+		// Reports are rendered from the completed job, so last
+		if res.Output != nil {
+			job.QualityDetails.Reports = p.sealer.WriteReports(ctx, job)
+		}
+		err := p.transition(ctx, TopicJobCompleted, completedEvent(job), func(ctx context.Context) error {
+			return p.store.Complete(ctx, job)
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			// Cancelled or paused while the result was being produced
+			return true, nil
+		}
+		if err != nil {
+			return true, p.fail(ctx, job, "failed to record result: "+err.Error())
+		}
+		p.events.Publish(Event{Type: EventCompleted, JobID: job.ID, Progress: 1, Status: models.GenCompleted, RowsDone: job.RowsGenerated})
+		return true, nil
+	}
+
+	// The reason is shown to the owner and sent to their webhooks
+	reason := redact.String(procErr.Error())
+	if IsPermanent(procErr) || job.Attempts >= p.cfg.MaxAttempts {
+		p.logger.Warn("generation job failed", zap.Int64("job_id", job.ID), zap.Int("attempts", job.Attempts), zap.Error(procErr))
+		return true, p.fail(ctx, job, reason)
+	}
+	at := time.Now().Add(Backoff(p.cfg.BaseBackoff, p.cfg.MaxBackoff, job.Attempts))
+	p.logger.Info("retrying generation job", zap.Int64("job_id", job.ID), zap.Int("attempts", job.Attempts), zap.Time("at", at), zap.Error(procErr))
+	return true, p.store.Retry(ctx, job.ID, at, reason)
+}
+
+// requeue puts a job interrupted by shutdown back on the queue. The pool's
+// context has ended by then, so it uses its own.
+func (p *Pool) requeue(jobID int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.store.Retry(ctx, jobID, time.Now(), "interrupted by shutdown"); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		p.logger.Warn("failed to requeue interrupted job", zap.Int64("job_id", jobID), zap.Error(err))
+	}
+}
+
+func (p *Pool) fail(ctx context.Context, job *models.GenerationJob, reason string) error {
+	err := p.transition(ctx, TopicJobFailed, failedEvent(job, reason), func(ctx context.Context) error {
+		return p.store.Fail(ctx, job.ID, reason)
+	})
+	if err != nil {
+		return err
+	}
+	p.events.Publish(Event{Type: EventFailed, JobID: job.ID, Status: models.GenFailed, Error: reason})
+	return nil
+}
+
+func (p *Pool) publish(ctx context.Context, userID int64, eventType string, data map[string]interface{}) {
+	if p.hooks == nil {
+		return
+	}
+	if err := p.hooks.Publish(ctx, userID, eventType, data); err != nil {
+		p.logger.Warn("failed to queue webhook event", zap.Int64("user_id", userID), zap.String("event", eventType), zap.Error(err))
+	}
+}
+
+func (p *Pool) notifyOwner(ctx context.Context, n *models.Notification) {
+	if p.notify == nil || n.UserID == 0 {
+		return
+	}
+	if err := p.notify.Notify(ctx, n); err != nil {
+		p.logger.Warn("failed to notify job owner", zap.Int64("user_id", n.UserID), zap.Error(err))
+	}
+}
+
+// heartbeat extends a running job's lease and records its progress. When
+// the job is no longer held, because it was cancelled, paused or taken
+// over, the job context is cancelled.
+type heartbeat struct {
+	pool   *Pool
+	ctx    context.Context
+	cancel context.CancelFunc
+	job    int64
+	worker string
+
+	mu       sync.Mutex
+	progress float64
+	gone     bool
+}
+
+func (h *heartbeat) run() (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(h.pool.cfg.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-h.ctx.Done():
+				return
+			case <-ticker.C:
+				h.mu.Lock()
+				progress := h.progress
+				h.mu.Unlock()
+				h.update(progress)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+func (h *heartbeat) report(progress float64) {
+	if progress < 0 {
+		progress = 0
+	}
+	if progress > 1 {
+		progress = 1
+	}
+	h.mu.Lock()
+	h.progress = progress
+	h.mu.Unlock()
+	h.update(progress)
+	h.pool.events.Publish(Event{Type: EventProgress, JobID: h.job, Progress: progress, Status: models.GenRunning})
+}
+
+func (h *heartbeat) update(progress float64) {
+	err := h.pool.store.UpdateProgress(h.ctx, h.job, h.worker, progress, h.pool.cfg.Lease)
+	if errors.Is(err, sql.ErrNoRows) {
+		h.release()
+		return
+	}
+	if err != nil && h.ctx.Err() == nil {
+		h.pool.logger.Warn("failed to record job progress", zap.Int64("job_id", h.job), zap.Error(err))
+	}
+}
+
+// release gives the job up and cancels its context
+func (h *heartbeat) release() {
+	h.mu.Lock()
+	h.gone = true
+	h.mu.Unlock()
+	h.cancel()
+}
+
+func (h *heartbeat) lost() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.gone
+}
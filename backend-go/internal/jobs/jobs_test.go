@@ -0,0 +1,713 @@
+// Package jobs_test provides unit tests for the generation job worker pool
+package jobs_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/buckets"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/delta"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/jobs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/modelserving"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/provenance"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/qualitygate"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/watermark"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	job       *models.GenerationJob
+	payload   []byte
+	cancelled bool
+
+	status    models.GenerationStatus
+	progress  []float64
+	retryAt   time.Time
+	lastError string
+}
+
+func (f *fakeStore) Enqueue(ctx context.Context, jobID int64, payload []byte) error {
+	f.payload = payload
+	f.status = models.GenQueued
+	return nil
+}
+
+func (f *fakeStore) Claim(ctx context.Context, worker string, lease time.Duration) (*models.GenerationJob, []byte, error) {
+	if f.status != models.GenQueued {
+		return nil, nil, sql.ErrNoRows
+	}
+	f.status = models.GenRunning
+	f.job.Attempts++
+	job := *f.job
+	return &job, f.payload, nil
+}
+
+func (f *fakeStore) UpdateProgress(ctx context.Context, jobID int64, worker string, progress float64, lease time.Duration) error {
+	if f.cancelled {
+		return sql.ErrNoRows
+	}
+	f.progress = append(f.progress, progress)
+	return nil
+}
+
+func (f *fakeStore) Complete(ctx context.Context, job *models.GenerationJob) error {
+	f.status = models.GenCompleted
+	f.job.RowsGenerated = job.RowsGenerated
+	f.job.Provider = job.Provider
+	f.job.QualityDetails = job.QualityDetails
+	return nil
+}
+
+func (f *fakeStore) Retry(ctx context.Context, jobID int64, at time.Time, reason string) error {
+	f.status, f.retryAt, f.lastError = models.GenQueued, at, reason
+	return nil
+}
+
+func (f *fakeStore) Fail(ctx context.Context, jobID int64, reason string) error {
+	f.status, f.lastError = models.GenFailed, reason
+	return nil
+}
+
+type processorFunc func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error)
+
+func (p processorFunc) Process(ctx context.Context, job *models.GenerationJob, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+	return p(ctx, req, progress)
+}
+
+type advisorFunc func(job *models.GenerationJob) ([]models.TradeoffRecommendation, error)
+
+func (a advisorFunc) Recommend(ctx context.Context, job *models.GenerationJob) ([]models.TradeoffRecommendation, error) {
+	return a(job)
+}
+
+func enqueued(t *testing.T) *fakeStore {
+	store := &fakeStore{job: &models.GenerationJob{ID: 7}}
+	err := jobs.NewQueue(store).Enqueue(context.Background(), 7, &agents.GenerationRequest{DatasetID: 3, Config: agents.GenerationConfig{Rows: 100}})
+	require.NoError(t, err)
+	return store
+}
+
+func testConfig() jobs.Config {
+	return jobs.Config{MaxAttempts: 2, BaseBackoff: time.Second, MaxBackoff: time.Minute, Lease: time.Minute}
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, jobs.Backoff(10*time.Second, time.Minute, 1))
+	assert.Equal(t, 40*time.Second, jobs.Backoff(10*time.Second, time.Minute, 3))
+	assert.Equal(t, time.Minute, jobs.Backoff(10*time.Second, time.Minute, 10))
+}
+
+func TestRunOnce(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("completes with the decoded request", func(t *testing.T) {
+		store := enqueued(t)
+		pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+			progress(0.5)
+			return &jobs.Result{RowsGenerated: req.Config.Rows, Provider: "vertex_ai", Model: "m"}, nil
+		}), testConfig(), nil)
+
+		ran, err := pool.RunOnce(ctx, "w")
+		require.NoError(t, err)
+		assert.True(t, ran)
+		assert.Equal(t, models.GenCompleted, store.status)
+		assert.Equal(t, int64(100), store.job.RowsGenerated)
+		assert.Equal(t, []float64{0.5}, store.progress)
+
+		ran, err = pool.RunOnce(ctx, "w")
+		require.NoError(t, err)
+		assert.False(t, ran)
+	})
+
+	t.Run("stores the advisor's recommendations", func(t *testing.T) {
+		store := enqueued(t)
+		pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+			return &jobs.Result{RowsGenerated: req.Config.Rows, Provider: "vertex_ai", Model: "claude-opus-4-1", CostUSD: 1}, nil
+		}), testConfig(), nil)
+		pool.SetAdvisor(advisorFunc(func(job *models.GenerationJob) ([]models.TradeoffRecommendation, error) {
+			assert.Equal(t, "claude-opus-4-1", *job.Model, "advice is given on the finished job")
+			return []models.TradeoffRecommendation{{Provider: "vertex_ai", Model: "claude-haiku-4", CostChange: -0.7}}, nil
+		}))
+
+		_, err := pool.RunOnce(ctx, "w")
+		require.NoError(t, err)
+		assert.Equal(t, models.GenCompleted, store.status)
+		require.NotNil(t, store.job.QualityDetails)
+		require.Len(t, store.job.QualityDetails.Recommendations, 1)
+		assert.Equal(t, "claude-haiku-4", store.job.QualityDetails.Recommendations[0].Model)
+	})
+
+	t.Run("completes without advice the advisor fails to give", func(t *testing.T) {
+		store := enqueued(t)
+		pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+			return &jobs.Result{RowsGenerated: req.Config.Rows, Provider: "vertex_ai", Model: "m", CostUSD: 1}, nil
+		}), testConfig(), nil)
+		pool.SetAdvisor(advisorFunc(func(job *models.GenerationJob) ([]models.TradeoffRecommendation, error) {
+			return nil, errors.New("statistics unavailable")
+		}))
+
+		_, err := pool.RunOnce(ctx, "w")
+		require.NoError(t, err)
+		assert.Equal(t, models.GenCompleted, store.status)
+		assert.Nil(t, store.job.QualityDetails)
+	})
+
+	t.Run("retries with backoff then fails", func(t *testing.T) {
+		store := enqueued(t)
+		pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+			return nil, errors.New("provider timeout")
+		}), testConfig(), nil)
+
+		before := time.Now()
+		_, err := pool.RunOnce(ctx, "w")
+		require.NoError(t, err)
+		assert.Equal(t, models.GenQueued, store.status)
+		assert.WithinDuration(t, before.Add(time.Second), store.retryAt, 500*time.Millisecond)
+
+		_, err = pool.RunOnce(ctx, "w")
+		require.NoError(t, err)
+		assert.Equal(t, models.GenFailed, store.status)
+		assert.Equal(t, "provider timeout", store.lastError)
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		store := enqueued(t)
+		pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+			return nil, jobs.Permanent(errors.New("bad schema"))
+		}), testConfig(), nil)
+
+		_, err := pool.RunOnce(ctx, "w")
+		require.NoError(t, err)
+		assert.Equal(t, models.GenFailed, store.status)
+	})
+
+	t.Run("raw output is never stored without a sealer", func(t *testing.T) {
+		store := enqueued(t)
+		pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+			return &jobs.Result{Output: []byte("a,b\n"), Provider: "vertex_ai", Model: "m"}, nil
+		}), testConfig(), nil)
+
+		_, err := pool.RunOnce(ctx, "w")
+		require.NoError(t, err)
+		assert.Equal(t, models.GenFailed, store.status)
+		assert.Equal(t, jobs.ErrNoOutputSealer.Error(), store.lastError)
+	})
+
+	t.Run("cancelled job stops the processor", func(t *testing.T) {
+		store := enqueued(t)
+		store.cancelled = true
+		pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+			progress(0.1)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}), testConfig(), nil)
+
+		ran, err := pool.RunOnce(ctx, "w")
+		require.NoError(t, err)
+		assert.True(t, ran)
+		assert.Equal(t, models.GenRunning, store.status, "the store already moved the job on")
+	})
+
+	t.Run("interrupted job is released without a retry", func(t *testing.T) {
+		store := enqueued(t)
+		started := make(chan struct{})
+		pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}), testConfig(), nil)
+
+		go func() {
+			<-started
+			assert.True(t, pool.Interrupt(7))
+		}()
+		ran, err := pool.RunOnce(ctx, "w")
+		require.NoError(t, err)
+		assert.True(t, ran)
+		assert.Equal(t, models.GenRunning, store.status)
+		assert.Empty(t, store.lastError, "an interrupted attempt is not a failure")
+		assert.False(t, pool.Interrupt(7), "the job no longer runs here")
+
+		var none *jobs.Pool
+		assert.False(t, none.Interrupt(7))
+	})
+}
+
+type streamingGenerator struct{ batches []agents.StreamBatch }
+
+func (g streamingGenerator) GenerateSyntheticData(ctx context.Context, req *agents.GenerationRequest) (*agents.GenerationResponse, error) {
+	return nil, errors.New("not streaming")
+}
+
+func (g streamingGenerator) StreamGeneration(ctx context.Context, req *agents.GenerationRequest, batchRows int64, onBatch func(agents.StreamBatch) error) (*agents.GenerationResponse, error) {
+	for _, b := range g.batches {
+		if err := onBatch(b); err != nil {
+			return nil, err
+		}
+	}
+	return &agents.GenerationResponse{Status: "completed", QualityMetrics: agents.QualityMetrics{OverallQuality: 0.9}}, nil
+}
+
+func TestDrain(t *testing.T) {
+	t.Run("waits for running jobs", func(t *testing.T) {
+		store := enqueued(t)
+		started := make(chan struct{})
+		pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+			close(started)
+			time.Sleep(50 * time.Millisecond)
+			return &jobs.Result{RowsGenerated: req.Config.Rows, Provider: "vertex_ai", Model: "m"}, nil
+		}), jobs.Config{Workers: 1, PollInterval: time.Hour, Lease: time.Minute}, nil)
+		pool.Start(context.Background())
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		pool.Drain(ctx)
+		assert.Equal(t, models.GenCompleted, store.status)
+	})
+
+	t.Run("requeues jobs still running at the deadline", func(t *testing.T) {
+		store := enqueued(t)
+		started := make(chan struct{})
+		pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}), jobs.Config{Workers: 1, PollInterval: time.Hour, Lease: time.Minute}, nil)
+		pool.Start(context.Background())
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		pool.Drain(ctx)
+		assert.Equal(t, models.GenQueued, store.status)
+		assert.Equal(t, "interrupted by shutdown", store.lastError)
+		assert.WithinDuration(t, time.Now(), store.retryAt, time.Second)
+	})
+}
+
+func TestAgentProcessorStreams(t *testing.T) {
+	events := jobs.NewEvents()
+	sub, unsubscribe := events.Subscribe(7)
+	defer unsubscribe()
+
+	proc := jobs.AgentProcessor{Generator: streamingGenerator{batches: []agents.StreamBatch{
+		{Batch: 1, Rows: []map[string]interface{}{{"a": 1.0}}, RowsDone: 1, RowsTotal: 2, Progress: 0.5},
+		{Batch: 2, Rows: []map[string]interface{}{{"a": 2.0}}, RowsDone: 2, RowsTotal: 2, Progress: 1},
+	}}, Provider: "vertex_ai", Model: "m", Events: events}
+
+	var progress []float64
+	res, err := proc.Process(context.Background(), &models.GenerationJob{ID: 7}, &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 2}},
+		func(p float64) { progress = append(progress, p) })
+	require.NoError(t, err)
+	assert.Equal(t, `[{"a":1},{"a":2}]`, string(res.Output))
+	assert.Equal(t, int64(2), res.RowsGenerated)
+	assert.InDeltaSlice(t, []float64{0.1, 0.5, 0.9}, progress, 1e-9)
+
+	first := <-sub
+	assert.Equal(t, jobs.EventRows, first.Type)
+	assert.Equal(t, 1, first.Batch)
+	assert.Len(t, first.Rows, 1)
+	assert.Equal(t, 2, (<-sub).Batch)
+}
+
+func TestAgentProcessorTagsProvenance(t *testing.T) {
+	proc := jobs.AgentProcessor{Generator: streamingGenerator{batches: []agents.StreamBatch{
+		{Batch: 1, Rows: []map[string]interface{}{{"a": 1.0}, {"a": 2.0}}, RowsDone: 2, RowsTotal: 3, Progress: 0.5},
+		{Batch: 2, Rows: []map[string]interface{}{{"a": 3.0}}, RowsDone: 3, RowsTotal: 3, Progress: 1},
+	}}, Provider: "vertex_ai", Model: "m", Events: jobs.NewEvents()}
+
+	req := &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 3}, Provenance: &provenance.Options{Mode: provenance.ModeColumns}}
+	res, err := proc.Process(context.Background(), &models.GenerationJob{ID: 7}, req, func(float64) {})
+	require.NoError(t, err)
+	var rows []map[string]interface{}
+	require.NoError(t, json.Unmarshal(res.Output, &rows))
+	require.Len(t, rows, 3)
+	assert.Equal(t, 7.0, rows[0][provenance.ColumnJobID])
+	assert.Equal(t, 2.0, rows[2][provenance.ColumnChunkID])
+	assert.Equal(t, agents.PromptTemplateVersion, rows[2][provenance.ColumnTemplateVersion])
+
+	require.NotNil(t, res.QualityDetails)
+	m := res.QualityDetails.Provenance
+	require.NotNil(t, m)
+	assert.Equal(t, int64(3), m.Rows)
+	require.Len(t, m.Chunks, 2)
+	assert.Equal(t, int64(2), m.Chunks[1].FirstRow)
+}
+
+// previousRun is a completed full run for delta jobs to follow
+type previousRun struct{ rows []map[string]any }
+
+func (p previousRun) Job(_ context.Context, _, id int64) (*models.GenerationJob, error) {
+	return &models.GenerationJob{ID: id, Status: models.GenCompleted}, nil
+}
+
+func (p previousRun) Rows(context.Context, int64, int64) ([]map[string]any, error) {
+	return p.rows, nil
+}
+
+func TestAgentProcessorDeliversDeltas(t *testing.T) {
+	generator := streamingGenerator{batches: []agents.StreamBatch{
+		{Batch: 1, Rows: []map[string]interface{}{{"id": 1.0, "plan": "pro"}, {"id": 2.0, "plan": "free"}, {"id": 3.0, "plan": "team"}}, RowsDone: 3, RowsTotal: 3, Progress: 1},
+	}}
+	proc := jobs.AgentProcessor{Generator: generator, Provider: "vertex_ai", Model: "m", Events: jobs.NewEvents(),
+		Previous: previousRun{rows: []map[string]any{{"id": json.Number("1"), "plan": "free"}, {"id": json.Number("2"), "plan": "free"}}}}
+
+	req := &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 3}, Delta: &delta.Options{PreviousJobID: 6, Key: "id"}}
+	res, err := proc.Process(context.Background(), &models.GenerationJob{ID: 7, UserID: 1}, req, func(float64) {})
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"id":1,"plan":"pro","_change":"update"},{"id":3,"plan":"team","_change":"insert"}]`, string(res.Output))
+	assert.Equal(t, int64(2), res.RowsGenerated)
+	require.NotNil(t, res.QualityDetails)
+	m := res.QualityDetails.Delta
+	require.NotNil(t, m)
+	assert.Equal(t, int64(6), m.BaseJobID)
+	assert.Equal(t, int64(1), m.Unchanged)
+	assert.Equal(t, int64(3), m.Rows)
+
+	// Without a way to read the previous run the job cannot succeed
+	proc.Previous = nil
+	_, err = proc.Process(context.Background(), &models.GenerationJob{ID: 7, UserID: 1}, req, func(float64) {})
+	assert.ErrorIs(t, err, delta.ErrNoSource)
+	assert.True(t, jobs.IsPermanent(err))
+}
+
+func TestAgentProcessorWatermarksRows(t *testing.T) {
+	rows := make([]map[string]interface{}, 200)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"id": float64(i + 1), "amount": float64(100 + i*7), "plan": "pro"}
+	}
+	generator := streamingGenerator{batches: []agents.StreamBatch{{Batch: 1, Rows: rows, RowsDone: 200, RowsTotal: 200, Progress: 1}}}
+	key := []byte("secret")
+	proc := jobs.AgentProcessor{Generator: generator, Provider: "vertex_ai", Model: "m", Events: jobs.NewEvents(), WatermarkKey: key}
+
+	req := &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 200}, Watermark: true}
+	res, err := proc.Process(context.Background(), &models.GenerationJob{ID: 7}, req, func(float64) {})
+	require.NoError(t, err)
+	require.NotNil(t, res.QualityDetails)
+	marks := res.QualityDetails.Watermark
+	require.NotNil(t, marks)
+	assert.Equal(t, []string{"amount"}, marks.Columns, "keys are never marked")
+	assert.Positive(t, marks.Changed)
+
+	var out []map[string]interface{}
+	require.NoError(t, json.Unmarshal(res.Output, &out))
+	assert.Equal(t, 1.0, out[0]["id"])
+	assert.True(t, watermark.Verify(key, 7, marks.Columns, out).Watermarked)
+	assert.False(t, watermark.Verify(key, 8, marks.Columns, out).Watermarked)
+}
+
+func TestAgentProcessorWritesExports(t *testing.T) {
+	generator := streamingGenerator{batches: []agents.StreamBatch{
+		{Batch: 1, Rows: []map[string]interface{}{{"id": 1.0, "plan": "pro"}, {"id": 2.0, "plan": "free"}}, RowsDone: 2, RowsTotal: 2, Progress: 1},
+	}}
+	proc := jobs.AgentProcessor{Generator: generator, Provider: "vertex_ai", Model: "m", Events: jobs.NewEvents()}
+
+	req := &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 2}, ExportFormat: "csv", ExportFormats: []string{"parquet", "sql", "pdf"}}
+	res, err := proc.Process(context.Background(), &models.GenerationJob{ID: 7}, req, func(float64) {})
+	require.NoError(t, err)
+	assert.Equal(t, "id,plan\n1,pro\n2,free\n", string(res.Output))
+	require.Len(t, res.Exports, 3)
+	assert.Equal(t, "parquet", res.Exports[0].Format)
+	assert.NoError(t, res.Exports[0].Err)
+	assert.Equal(t, "PAR1", string(res.Exports[0].Output[:4]))
+	assert.Contains(t, string(res.Exports[1].Output), `INSERT INTO "generated_rows" ("id", "plan") VALUES`)
+	assert.ErrorIs(t, res.Exports[2].Err, export.ErrUnsupportedFormat, "one format failing leaves the others")
+}
+
+// wholeGenerator writes its output itself rather than streaming rows
+type wholeGenerator struct{}
+
+func (wholeGenerator) GenerateSyntheticData(ctx context.Context, req *agents.GenerationRequest) (*agents.GenerationResponse, error) {
+	key := "outputs/7.json"
+	return &agents.GenerationResponse{Status: "completed", OutputKey: &key}, nil
+}
+
+func TestAgentProcessorRefusesExportsItCannotWrite(t *testing.T) {
+	req := &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 2}, ExportFormats: []string{"parquet"}}
+	_, err := jobs.AgentProcessor{Generator: wholeGenerator{}, Events: jobs.NewEvents()}.Process(context.Background(), &models.GenerationJob{ID: 7}, req, func(float64) {})
+	assert.ErrorIs(t, err, jobs.ErrExportFormatsUnsupported)
+	assert.True(t, jobs.IsPermanent(err))
+
+	proc := jobs.AgentProcessor{Generator: streamingGenerator{}, Events: jobs.NewEvents()}
+	multi := &agents.GenerationRequest{MultiTable: &agents.MultiTablePlan{}, ExportFormats: []string{"parquet"}}
+	_, err = proc.Process(context.Background(), &models.GenerationJob{ID: 8}, multi, func(float64) {})
+	assert.ErrorIs(t, err, jobs.ErrExportFormatsUnsupported, "multi-table jobs are delivered as a bundle")
+
+	req.ExportFormats = nil
+	res, err := jobs.AgentProcessor{Generator: wholeGenerator{}, Events: jobs.NewEvents()}.Process(context.Background(), &models.GenerationJob{ID: 9}, req, func(float64) {})
+	require.NoError(t, err)
+	require.NotNil(t, res.OutputKey)
+	assert.Equal(t, "outputs/7.json", *res.OutputKey)
+}
+
+// objects is an in-memory object store
+type objects struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (o *objects) PutObject(_ context.Context, key string, r io.Reader, _ string) error {
+	raw, err := io.ReadAll(r)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.data[key] = raw
+	return err
+}
+
+type keys struct{ key *models.JobOutputKey }
+
+func (k *keys) UpsertKey(_ context.Context, key *models.JobOutputKey) error {
+	k.key = key
+	return nil
+}
+
+func TestOutputSealerSealsExports(t *testing.T) {
+	envelope, err := storage.NewEnvelope("k1", map[string][]byte{"k1": make([]byte, 32)})
+	require.NoError(t, err)
+	store, wrapped := &objects{data: map[string][]byte{}}, &keys{}
+	sealer := jobs.OutputSealer{Envelope: envelope, Keys: wrapped, Writer: store}
+
+	job := &models.GenerationJob{ID: 7, UserID: 3}
+	stored, exports, delivery, err := sealer.Seal(context.Background(), job, []byte("[]"), []jobs.Export{
+		{Format: "sql", Output: []byte("CREATE TABLE x ();")},
+		{Format: "xlsx", Err: export.ErrTooLarge},
+	})
+	require.NoError(t, err)
+	assert.Nil(t, delivery, "without buckets outputs go to platform storage")
+	assert.Equal(t, "outputs/3/7.enc", stored.ObjectKey)
+	assert.Equal(t, int64(2), stored.Bytes)
+	assert.Equal(t, "4f53cda18c2baa0c0354bb5f9a3ecbe5ed12ab4d8e11ba873c2f11161202b945", stored.SHA256)
+	sum := sha256.Sum256(store.data["outputs/3/7.enc"])
+	assert.Equal(t, hex.EncodeToString(sum[:]), stored.ObjectSHA256, "the stored object's checksum covers its ciphertext")
+	require.Len(t, exports, 2)
+	first := exports[0]
+	assert.Len(t, first.SHA256, 64)
+	first.SHA256, first.ObjectSHA256 = "", ""
+	assert.Equal(t, models.JobExport{Format: "sql", Status: models.ExportCompleted, ObjectKey: "outputs/3/7.sql.enc", Bytes: 18}, first)
+	assert.Equal(t, models.ExportFailed, exports[1].Status)
+	assert.Contains(t, exports[1].Error, "too large")
+
+	// Exports open with the key of the main output
+	plain, err := envelope.Unwrap(wrapped.key.MasterKeyID, wrapped.key.WrappedKey)
+	require.NoError(t, err)
+	raw, err := storage.Open(plain, store.data["outputs/3/7.sql.enc"])
+	require.NoError(t, err)
+	assert.Equal(t, "CREATE TABLE x ();", string(raw))
+}
+
+func TestOutputSealerWritesReports(t *testing.T) {
+	store := &objects{data: map[string][]byte{}}
+	sealer := jobs.OutputSealer{Writer: store}
+
+	reports := sealer.WriteReports(context.Background(), &models.GenerationJob{ID: 7, UserID: 3, RowsGenerated: 2})
+	require.Len(t, reports, 2)
+	assert.Equal(t, "html", reports[0].Format)
+	assert.Equal(t, "outputs/3/7.report.html", reports[0].ObjectKey)
+	assert.Equal(t, "pdf", reports[1].Format)
+	assert.Equal(t, models.ExportCompleted, reports[1].Status)
+	assert.Equal(t, "%PDF", string(store.data["outputs/3/7.report.pdf"][:4]), "reports are stored unencrypted")
+	sum := sha256.Sum256(store.data["outputs/3/7.report.pdf"])
+	assert.Equal(t, hex.EncodeToString(sum[:]), reports[1].SHA256)
+}
+
+// orgBucket is an organization bucket that records deliveries
+type orgBucket struct {
+	objects
+	status    string
+	failWrite error
+	delivered []error
+}
+
+func (b *orgBucket) Destination(context.Context, int64) (*models.OutputDelivery, storage.ObjectWriter, error) {
+	if b.status == models.OutputBucketUnverified {
+		return nil, nil, buckets.ErrUnverified
+	}
+	return &models.OutputDelivery{OrgID: 5, Provider: models.BucketS3, Bucket: "acme-synthetic", Prefix: "synthos/"}, b, nil
+}
+
+func (b *orgBucket) Reopen(context.Context, *models.OutputDelivery) (buckets.Store, error) {
+	return nil, buckets.ErrBucketChanged
+}
+
+func (b *orgBucket) Delivered(_ context.Context, _ int64, err error) error {
+	b.delivered = append(b.delivered, err)
+	return nil
+}
+
+func (b *orgBucket) PutObject(ctx context.Context, key string, r io.Reader, contentType string) error {
+	if b.failWrite != nil {
+		return b.failWrite
+	}
+	return b.objects.PutObject(ctx, key, r, contentType)
+}
+
+func TestOutputSealerDeliversToOrgBucket(t *testing.T) {
+	envelope, err := storage.NewEnvelope("k1", map[string][]byte{"k1": make([]byte, 32)})
+	require.NoError(t, err)
+	platform := &objects{data: map[string][]byte{}}
+	bucket := &orgBucket{objects: objects{data: map[string][]byte{}}, status: models.OutputBucketActive}
+	sealer := jobs.OutputSealer{Envelope: envelope, Keys: &keys{}, Writer: platform, Buckets: bucket}
+
+	job := &models.GenerationJob{ID: 7, UserID: 3}
+	stored, exports, delivery, err := sealer.Seal(context.Background(), job, []byte("[]"), []jobs.Export{{Format: "sql", Output: []byte("SELECT 1;")}})
+	require.NoError(t, err)
+	require.NotNil(t, delivery)
+	assert.Equal(t, "acme-synthetic", delivery.Bucket)
+	assert.Equal(t, "synthos/outputs/3/7.enc", stored.ObjectKey)
+	assert.Equal(t, "synthos/outputs/3/7.sql.enc", exports[0].ObjectKey)
+	assert.Contains(t, bucket.data, stored.ObjectKey)
+	assert.Empty(t, platform.data, "nothing rests in platform storage")
+	assert.Equal(t, []error{nil}, bucket.delivered)
+
+	// A failed write marks the bucket failing and the job retried
+	bucket.failWrite = errors.New("AccessDenied")
+	_, _, _, err = sealer.Seal(context.Background(), job, []byte("[]"), nil)
+	assert.ErrorIs(t, err, buckets.ErrDeliveryFailed)
+	assert.False(t, jobs.IsPermanent(err))
+	require.Len(t, bucket.delivered, 2)
+	assert.Error(t, bucket.delivered[1])
+	assert.Empty(t, platform.data)
+
+	// Reports follow the output; one that cannot be written fails alone
+	job.QualityDetails = &models.QualityDetails{Delivery: delivery}
+	reports := sealer.WriteReports(context.Background(), job)
+	require.Len(t, reports, 2)
+	assert.Equal(t, models.ExportFailed, reports[0].Status)
+	assert.Empty(t, platform.data)
+
+	bucket.status = models.OutputBucketUnverified
+	_, _, _, err = sealer.Seal(context.Background(), job, []byte("[]"), nil)
+	assert.ErrorIs(t, err, buckets.ErrUnverified)
+	assert.True(t, jobs.IsPermanent(err))
+}
+
+func TestAgentProcessorRoutesStatisticalJobs(t *testing.T) {
+	reference := make([]map[string]interface{}, 30)
+	for i := range reference {
+		reference[i] = map[string]interface{}{"plan": []string{"free", "pro"}[i%2], "amount": float64(i % 7)}
+	}
+	proc := jobs.AgentProcessor{Generator: streamingGenerator{}, Provider: "vertex_ai", Model: "m", Events: jobs.NewEvents(), BatchRows: 10, Statistical: agents.StatisticalGenerator{Seed: 1}}
+
+	req := &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 25, Strategy: agents.StrategyStatistical}, Reference: reference}
+	res, err := proc.Process(context.Background(), &models.GenerationJob{ID: 8}, req, func(float64) {})
+	require.NoError(t, err)
+	assert.Equal(t, jobs.LocalProvider, res.Provider)
+	assert.Equal(t, agents.StatisticalModel, res.Model)
+	assert.Equal(t, int64(25), res.RowsGenerated)
+
+	req.Reference = nil
+	_, err = proc.Process(context.Background(), &models.GenerationJob{ID: 9}, req, func(float64) {})
+	assert.ErrorIs(t, err, agents.ErrNoReference)
+	assert.True(t, jobs.IsPermanent(err), "no source sample will appear on a retry")
+}
+
+func TestAgentProcessorEnforcesQualityPolicy(t *testing.T) {
+	reference := make([]map[string]interface{}, 30)
+	for i := range reference {
+		reference[i] = map[string]interface{}{"amount": float64(i) * 1.37}
+	}
+	// The provider copies its first rows from the source
+	copies := streamingGenerator{batches: []agents.StreamBatch{{Batch: 1, Rows: reference[:10], RowsDone: 10, RowsTotal: 10, Progress: 1}}}
+	proc := jobs.AgentProcessor{Generator: copies, Provider: "vertex_ai", Model: "m", Events: jobs.NewEvents(), BatchRows: 10, Statistical: agents.StatisticalGenerator{Seed: 1}}
+	ceiling := 0.5
+
+	t.Run("fails with the checks that failed", func(t *testing.T) {
+		policy := &models.QualityPolicy{MaxPrivacyRisk: &ceiling, OnFailure: models.QualityGateFail}
+		req := &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 10}, Reference: reference, QualityGate: policy}
+		_, err := proc.Process(context.Background(), &models.GenerationJob{ID: 8}, req, func(float64) {})
+		var rejected *qualitygate.RejectedError
+		require.ErrorAs(t, err, &rejected)
+		assert.True(t, jobs.IsPermanent(err))
+		assert.Contains(t, err.Error(), "privacy_risk 1.000 is above the maximum 0.500")
+		assert.Len(t, rejected.Report.Attempts, 1)
+	})
+
+	t.Run("retries with a fallback strategy", func(t *testing.T) {
+		policy := &models.QualityPolicy{MaxPrivacyRisk: &ceiling, OnFailure: models.QualityGateRetry,
+			FallbackStrategies: []string{string(agents.StrategyStatistical)}}
+		req := &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 10}, Reference: reference, QualityGate: policy}
+		res, err := proc.Process(context.Background(), &models.GenerationJob{ID: 9}, req, func(float64) {})
+		require.NoError(t, err)
+		assert.Equal(t, jobs.LocalProvider, res.Provider)
+		gate := res.QualityDetails.QualityGate
+		require.NotNil(t, gate)
+		assert.True(t, gate.Passed)
+		require.Len(t, gate.Attempts, 2)
+		assert.False(t, gate.Attempts[0].Passed)
+		assert.Equal(t, "vertex_ai", gate.Attempts[0].Provider)
+		assert.Equal(t, string(agents.StrategyStatistical), gate.Attempts[1].Strategy)
+		assert.NotEmpty(t, res.Output)
+	})
+}
+
+// modelServer serves rows for every column, or fails every call
+type modelServer struct{ err error }
+
+func (s modelServer) Generate(ctx context.Context, req modelserving.Request) ([]map[string]interface{}, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	rows := make([]map[string]interface{}, req.Rows)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"plan": "pro"}
+	}
+	return rows, nil
+}
+
+func TestAgentProcessorRoutesCustomModelJobs(t *testing.T) {
+	model := &modelserving.Model{ID: 4, Framework: "onnx", Artifact: "custom-models/1/4/ctgan.onnx"}
+	proc := jobs.AgentProcessor{Generator: streamingGenerator{}, Provider: "vertex_ai", Model: "m", Events: jobs.NewEvents(), BatchRows: 10,
+		Custom: agents.CustomModelGenerator{Server: modelServer{}, Seed: 1}}
+
+	req := &agents.GenerationRequest{Config: agents.GenerationConfig{Rows: 25}, CustomModel: model,
+		SchemaAnalysis: agents.SchemaAnalysis{Columns: []agents.ColumnInfo{{Name: "plan", DataType: "string"}}}}
+	res, err := proc.Process(context.Background(), &models.GenerationJob{ID: 10}, req, func(float64) {})
+	require.NoError(t, err)
+	assert.Equal(t, "custom", res.Provider)
+	assert.Equal(t, "custom-model-4", res.Model)
+	assert.Equal(t, int64(25), res.RowsGenerated)
+
+	proc.Custom = agents.CustomModelGenerator{Server: modelServer{err: &modelserving.Error{StatusCode: 422, Message: "bad columns"}}}
+	_, err = proc.Process(context.Background(), &models.GenerationJob{ID: 11}, req, func(float64) {})
+	assert.True(t, jobs.IsPermanent(err), "a rejected request is rejected again")
+
+	proc.Custom = agents.CustomModelGenerator{Server: modelServer{err: &modelserving.Error{StatusCode: 503, Message: "loading"}}}
+	_, err = proc.Process(context.Background(), &models.GenerationJob{ID: 12}, req, func(float64) {})
+	require.Error(t, err)
+	assert.False(t, jobs.IsPermanent(err), "the server may be ready on the next attempt")
+}
+
+func TestEventsDropsSlowSubscribers(t *testing.T) {
+	events := jobs.NewEvents()
+	sub, unsubscribe := events.Subscribe(1)
+	defer unsubscribe()
+	other, unsubscribeOther := events.Subscribe(2)
+	defer unsubscribeOther()
+
+	for i := 0; i < 100; i++ {
+		events.Publish(jobs.Event{Type: jobs.EventProgress, JobID: 1})
+	}
+	n := 0
+	for range sub {
+		n++
+	}
+	assert.Less(t, n, 100, "the channel is closed once the subscriber falls behind")
+
+	events.Publish(jobs.Event{Type: jobs.EventCompleted, JobID: 2})
+	ev := <-other
+	assert.True(t, ev.Terminal())
+}
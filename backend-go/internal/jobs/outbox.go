@@ -0,0 +1,301 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/outbox"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
+)
+
+// Outbox topics of job lifecycle events; they match the webhook event types
+const (
+	TopicJobCompleted = webhooks.EventGenerationCompleted
+	TopicJobFailed    = webhooks.EventGenerationFailed
+)
+
+// Outbox records job lifecycle events in the transaction ctx carries
+type Outbox interface {
+	Append(ctx context.Context, events ...*models.OutboxEvent) error
+}
+
+// Transactor runs fn in a transaction the store and outbox take part in
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// JobEvent is the payload of a job lifecycle event
+type JobEvent struct {
+	JobID          int64    `json:"job_id"`
+	DatasetID      int64    `json:"dataset_id"`
+	UserID         int64    `json:"user_id"`
+	RowsGenerated  int64    `json:"rows_generated,omitempty"`
+	QualityScore   *float64 `json:"quality_score,omitempty"`
+	OutputFormat   *string  `json:"output_format,omitempty"`
+	ProcessingTime float64  `json:"processing_time,omitempty"`
+	Model          string   `json:"model,omitempty"`
+	Attempts       int      `json:"attempts,omitempty"`
+	Error          string   `json:"error,omitempty"`
+}
+
+func completedEvent(job *models.GenerationJob) JobEvent {
+	e := JobEvent{
+		JobID:          job.ID,
+		DatasetID:      job.DatasetID,
+		UserID:         job.UserID,
+		RowsGenerated:  job.RowsGenerated,
+		QualityScore:   job.QualityScore,
+		OutputFormat:   job.OutputFormat,
+		ProcessingTime: job.ProcessingTime,
+	}
+	if job.Model != nil {
+		e.Model = *job.Model
+	}
+	return e
+}
+
+func failedEvent(job *models.GenerationJob, reason string) JobEvent {
+	return JobEvent{JobID: job.ID, DatasetID: job.DatasetID, UserID: job.UserID, Attempts: job.Attempts, Error: reason}
+}
+
+// notification is what the owner is told of an event
+func (e JobEvent) notification(topic string) *models.Notification {
+	if topic == TopicJobFailed {
+		// Repeated failures on one dataset are folded into a single alert
+		dedupe := fmt.Sprintf("job_failed:%d", e.DatasetID)
+		return &models.Notification{
+			UserID:    e.UserID,
+			Category:  models.NotificationCategoryJobs,
+			Severity:  models.NotificationWarning,
+			DedupeKey: &dedupe,
+			Title:     fmt.Sprintf("Generation failed for dataset %d", e.DatasetID),
+			Body:      fmt.Sprintf("Job %d failed: %s", e.JobID, e.Error),
+		}
+	}
+	return &models.Notification{
+		UserID:   e.UserID,
+		Category: models.NotificationCategoryJobs,
+		Severity: models.NotificationInfo,
+		Title:    fmt.Sprintf("Generation job %d completed", e.JobID),
+		Body:     fmt.Sprintf("%d rows generated for dataset %d.", e.RowsGenerated, e.DatasetID),
+	}
+}
+
+// webhookData is the data of the webhook event sent for an event
+func (e JobEvent) webhookData(topic string) map[string]interface{} {
+	if topic == TopicJobFailed {
+		return map[string]interface{}{
+			"job_id":     e.JobID,
+			"dataset_id": e.DatasetID,
+			"attempts":   e.Attempts,
+			"error":      e.Error,
+		}
+	}
+	return map[string]interface{}{
+		"job_id":          e.JobID,
+		"dataset_id":      e.DatasetID,
+		"rows_generated":  e.RowsGenerated,
+		"quality_score":   e.QualityScore,
+		"output_format":   e.OutputFormat,
+		"processing_time": e.ProcessingTime,
+	}
+}
+
+// SetOutbox records completion and failure events in the outbox, in the
+// transaction that records the job's new status. The owner's notification
+// and webhooks are then left to the outbox dispatcher, so neither is lost
+// nor sent for a status change that did not commit.
+func (p *Pool) SetOutbox(tx Transactor, o Outbox) {
+	p.tx, p.outbox = tx, o
+}
+
+// transition records a job's new status with change and, when the pool has
+// an outbox, its lifecycle event; without one the event is delivered
+// directly once the change succeeded
+func (p *Pool) transition(ctx context.Context, topic string, e JobEvent, change func(ctx context.Context) error) error {
+	if p.outbox == nil {
+		if err := change(ctx); err != nil {
+			return err
+		}
+		p.notifyOwner(ctx, e.notification(topic))
+		p.publish(ctx, e.UserID, topic, e.webhookData(topic))
+		return nil
+	}
+	event, err := outbox.NewEvent(topic, e.UserID, e)
+	if err != nil {
+		return err
+	}
+	return p.tx.WithTx(ctx, func(ctx context.Context) error {
+		if err := change(ctx); err != nil {
+			return err
+		}
+		return p.outbox.Append(ctx, event)
+	})
+}
+
+func decodeJobEvent(event *models.OutboxEvent) (JobEvent, error) {
+	var e JobEvent
+	if err := json.Unmarshal([]byte(event.Payload), &e); err != nil {
+		return e, fmt.Errorf("invalid %s event %d: %w", event.Topic, event.ID, err)
+	}
+	return e, nil
+}
+
+// NotificationHandler notifies owners of their jobs' outbox events
+func NotificationHandler(n Notifier) outbox.Handler {
+	return func(ctx context.Context, event *models.OutboxEvent) error {
+		e, err := decodeJobEvent(event)
+		if err != nil || e.UserID == 0 {
+			return err
+		}
+		return n.Notify(ctx, e.notification(event.Topic))
+	}
+}
+
+// EventPublisher queues webhook events under a given ID, so an event
+// handed over twice is delivered once
+type EventPublisher interface {
+	PublishEvent(ctx context.Context, eventID string, userID int64, eventType string, data map[string]interface{}) error
+}
+
+// WebhookHandler sends jobs' outbox events to their owners' webhooks
+func WebhookHandler(p EventPublisher) outbox.Handler {
+	return func(ctx context.Context, event *models.OutboxEvent) error {
+		e, err := decodeJobEvent(event)
+		if err != nil {
+			return err
+		}
+		return p.PublishEvent(ctx, "outbox-"+strconv.FormatInt(event.ID, 10), e.UserID, event.Topic, e.webhookData(event.Topic))
+	}
+}
+
+// Tracker records product analytics of completed jobs
+type Tracker interface {
+	TrackDataGeneration(ctx context.Context, userID, datasetID string, rows int, model string, duration time.Duration) error
+}
+
+// AnalyticsHandler tracks completed jobs
+func AnalyticsHandler(t Tracker) outbox.Handler {
+	return func(ctx context.Context, event *models.OutboxEvent) error {
+		if event.Topic != TopicJobCompleted {
+			return nil
+		}
+		e, err := decodeJobEvent(event)
+		if err != nil {
+			return err
+		}
+		return t.TrackDataGeneration(ctx, strconv.FormatInt(e.UserID, 10), strconv.FormatInt(e.DatasetID, 10),
+			int(e.RowsGenerated), e.Model, time.Duration(e.ProcessingTime*float64(time.Second)))
+	}
+}
+
+// AuditRecorder stores audit log entries
+type AuditRecorder interface {
+	Insert(ctx context.Context, log *models.AuditLog) (*models.AuditLog, error)
+}
+
+// AuditHandler records completed and failed jobs in the audit log
+func AuditHandler(a AuditRecorder) outbox.Handler {
+	return func(ctx context.Context, event *models.OutboxEvent) error {
+		e, err := decodeJobEvent(event)
+		if err != nil {
+			return err
+		}
+		action := "generation_completed"
+		if event.Topic == TopicJobFailed {
+			action = "generation_failed"
+		}
+		jobID := strconv.FormatInt(e.JobID, 10)
+		entry := &models.AuditLog{Action: action, Resource: "generation_job", ResourceID: &jobID, Metadata: event.Payload}
+		if e.UserID != 0 {
+			entry.UserID = &e.UserID
+		}
+		_, err = a.Insert(ctx, entry)
+		return err
+	}
+}
+
+// WarehouseQueue queues exports of completed jobs
+type WarehouseQueue interface {
+	AutoExportDestinations(ctx context.Context, userID int64) ([]models.WarehouseDestination, error)
+	Enqueue(ctx context.Context, destinationID, jobID, userID int64, table string) (*models.WarehouseDelivery, error)
+}
+
+// WarehouseHandler queues completed jobs for their owners' auto export
+// destinations. A job queued twice for a table is loaded once.
+func WarehouseHandler(q WarehouseQueue) outbox.Handler {
+	return func(ctx context.Context, event *models.OutboxEvent) error {
+		if event.Topic != TopicJobCompleted {
+			return nil
+		}
+		e, err := decodeJobEvent(event)
+		if err != nil || e.UserID == 0 {
+			return err
+		}
+		dests, err := q.AutoExportDestinations(ctx, e.UserID)
+		if err != nil {
+			return err
+		}
+		for _, d := range dests {
+			if d.Settings.Table == "" {
+				continue
+			}
+			if _, err := q.Enqueue(ctx, d.ID, e.JobID, e.UserID, d.Settings.Table); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// UsageRecorder records metered usage; an event recorded twice is counted
+// once
+type UsageRecorder interface {
+	Record(ctx context.Context, e *models.UsageEvent) (bool, error)
+}
+
+// MeteringHandler meters the rows completed jobs delivered
+func MeteringHandler(r UsageRecorder) outbox.Handler {
+	return func(ctx context.Context, event *models.OutboxEvent) error {
+		if event.Topic != TopicJobCompleted {
+			return nil
+		}
+		e, err := decodeJobEvent(event)
+		if err != nil || e.UserID == 0 || e.RowsGenerated <= 0 {
+			return err
+		}
+		_, err = r.Record(ctx, &models.UsageEvent{
+			UserID:         e.UserID,
+			Meter:          models.MeterRowsGenerated,
+			Quantity:       float64(e.RowsGenerated),
+			IdempotencyKey: "job:" + strconv.FormatInt(e.JobID, 10),
+			OccurredAt:     event.CreatedAt,
+		})
+		return err
+	}
+}
+
+// QuotaChecker warns users approaching the limits of their plan
+type QuotaChecker interface {
+	Check(ctx context.Context, userID int64, now time.Time) (int, error)
+}
+
+// QuotaHandler checks the row limit of users whose jobs completed; a failed
+// warning is retried with the event
+func QuotaHandler(q QuotaChecker) outbox.Handler {
+	return func(ctx context.Context, event *models.OutboxEvent) error {
+		if event.Topic != TopicJobCompleted {
+			return nil
+		}
+		e, err := decodeJobEvent(event)
+		if err != nil || e.UserID == 0 || e.RowsGenerated <= 0 {
+			return err
+		}
+		_, err = q.Check(ctx, e.UserID, time.Now())
+		return err
+	}
+}
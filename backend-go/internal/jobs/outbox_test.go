@@ -0,0 +1,173 @@
+// Package jobs_test provides unit tests for job lifecycle events in the outbox
+package jobs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/jobs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTx keeps what was appended inside a transaction only when it commits
+type fakeTx struct {
+	pending   []*models.OutboxEvent
+	committed []*models.OutboxEvent
+}
+
+func (f *fakeTx) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	f.pending = nil
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	f.committed = append(f.committed, f.pending...)
+	return nil
+}
+
+func (f *fakeTx) Append(_ context.Context, events ...*models.OutboxEvent) error {
+	f.pending = append(f.pending, events...)
+	return nil
+}
+
+type recordingNotifier []*models.Notification
+
+func (r *recordingNotifier) Notify(_ context.Context, n *models.Notification) error {
+	*r = append(*r, n)
+	return nil
+}
+
+type failingCompleteStore struct{ *fakeStore }
+
+func (f failingCompleteStore) Complete(context.Context, *models.GenerationJob) error {
+	return errors.New("connection reset")
+}
+
+func TestPoolWritesLifecycleEventsToOutbox(t *testing.T) {
+	store := enqueued(t)
+	store.job.UserID, store.job.DatasetID = 5, 3
+	tx := &fakeTx{}
+	notes := &recordingNotifier{}
+	pool := jobs.NewPool(store, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+		return &jobs.Result{RowsGenerated: req.Config.Rows, Provider: "vertex_ai", Model: "m"}, nil
+	}), testConfig(), nil)
+	pool.SetNotifier(notes)
+	pool.SetOutbox(tx, tx)
+
+	_, err := pool.RunOnce(context.Background(), "w")
+	require.NoError(t, err)
+	assert.Equal(t, models.GenCompleted, store.status)
+	assert.Empty(t, *notes, "the outbox dispatcher notifies the owner")
+	require.Len(t, tx.committed, 1)
+	event := tx.committed[0]
+	assert.Equal(t, jobs.TopicJobCompleted, event.Topic)
+	assert.Equal(t, int64(5), event.UserID)
+	var payload jobs.JobEvent
+	require.NoError(t, json.Unmarshal([]byte(event.Payload), &payload))
+	assert.Equal(t, int64(100), payload.RowsGenerated)
+	assert.Equal(t, "m", payload.Model)
+
+	// The event is delivered by the handlers
+	event.ID = 12
+	require.NoError(t, jobs.NotificationHandler(notes)(context.Background(), event))
+	require.Len(t, *notes, 1)
+	assert.Equal(t, "Generation job 7 completed", (*notes)[0].Title)
+}
+
+func TestPoolOutboxFollowsTransaction(t *testing.T) {
+	store := enqueued(t)
+	tx := &fakeTx{}
+	pool := jobs.NewPool(failingCompleteStore{store}, processorFunc(func(ctx context.Context, req *agents.GenerationRequest, progress func(float64)) (*jobs.Result, error) {
+		return &jobs.Result{RowsGenerated: 1, Provider: "vertex_ai", Model: "m"}, nil
+	}), testConfig(), nil)
+	pool.SetOutbox(tx, tx)
+
+	_, err := pool.RunOnce(context.Background(), "w")
+	require.NoError(t, err)
+	assert.Equal(t, models.GenFailed, store.status)
+	require.Len(t, tx.committed, 1, "no completion event for a completion that did not commit")
+	assert.Equal(t, jobs.TopicJobFailed, tx.committed[0].Topic)
+}
+
+type recordingPublisher struct{ ids []string }
+
+func (r *recordingPublisher) PublishEvent(_ context.Context, eventID string, _ int64, _ string, data map[string]interface{}) error {
+	r.ids = append(r.ids, eventID)
+	return nil
+}
+
+func TestWebhookHandlerIsIdempotent(t *testing.T) {
+	pub := &recordingPublisher{}
+	event := &models.OutboxEvent{ID: 4, Topic: jobs.TopicJobFailed, Payload: `{"job_id":7,"user_id":5,"error":"bad schema"}`}
+	handler := jobs.WebhookHandler(pub)
+	require.NoError(t, handler(context.Background(), event))
+	require.NoError(t, handler(context.Background(), event))
+	assert.Equal(t, []string{"outbox-4", "outbox-4"}, pub.ids)
+}
+
+type recordingWarehouses struct {
+	dests  []models.WarehouseDestination
+	queued []string
+}
+
+func (r *recordingWarehouses) AutoExportDestinations(context.Context, int64) ([]models.WarehouseDestination, error) {
+	return r.dests, nil
+}
+
+func (r *recordingWarehouses) Enqueue(_ context.Context, destinationID, jobID, userID int64, table string) (*models.WarehouseDelivery, error) {
+	r.queued = append(r.queued, table)
+	return &models.WarehouseDelivery{DestinationID: destinationID, JobID: jobID, UserID: userID, TableName: table}, nil
+}
+
+func TestWarehouseHandlerQueuesCompletedJobs(t *testing.T) {
+	q := &recordingWarehouses{dests: []models.WarehouseDestination{
+		{ID: 1, Settings: models.WarehouseSettings{Table: "people"}},
+		{ID: 2},
+	}}
+	handler := jobs.WarehouseHandler(q)
+	require.NoError(t, handler(context.Background(), &models.OutboxEvent{Topic: jobs.TopicJobFailed, Payload: `{"job_id":7,"user_id":5}`}))
+	assert.Empty(t, q.queued)
+	require.NoError(t, handler(context.Background(), &models.OutboxEvent{Topic: jobs.TopicJobCompleted, Payload: `{"job_id":7,"user_id":5}`}))
+	assert.Equal(t, []string{"people"}, q.queued)
+}
+
+type recordingUsage []models.UsageEvent
+
+func (r *recordingUsage) Record(_ context.Context, e *models.UsageEvent) (bool, error) {
+	*r = append(*r, *e)
+	return true, nil
+}
+
+func TestMeteringHandlerMetersDeliveredRows(t *testing.T) {
+	var usage recordingUsage
+	handler := jobs.MeteringHandler(&usage)
+	require.NoError(t, handler(context.Background(), &models.OutboxEvent{Topic: jobs.TopicJobFailed, Payload: `{"job_id":7,"user_id":5}`}))
+	require.NoError(t, handler(context.Background(), &models.OutboxEvent{Topic: jobs.TopicJobCompleted, Payload: `{"job_id":8,"user_id":5}`}))
+	assert.Empty(t, usage, "failed jobs and jobs without rows are not metered")
+	require.NoError(t, handler(context.Background(), &models.OutboxEvent{Topic: jobs.TopicJobCompleted, Payload: `{"job_id":7,"user_id":5,"rows_generated":1200}`}))
+	require.Len(t, usage, 1)
+	assert.Equal(t, models.MeterRowsGenerated, usage[0].Meter)
+	assert.Equal(t, 1200.0, usage[0].Quantity)
+	assert.Equal(t, "job:7", usage[0].IdempotencyKey)
+}
+
+type recordingQuota []int64
+
+func (r *recordingQuota) Check(_ context.Context, userID int64, _ time.Time) (int, error) {
+	*r = append(*r, userID)
+	return 0, nil
+}
+
+func TestQuotaHandlerChecksUsersWithDeliveredRows(t *testing.T) {
+	var checked recordingQuota
+	handler := jobs.QuotaHandler(&checked)
+	require.NoError(t, handler(context.Background(), &models.OutboxEvent{Topic: jobs.TopicJobFailed, Payload: `{"job_id":7,"user_id":5,"rows_generated":10}`}))
+	require.NoError(t, handler(context.Background(), &models.OutboxEvent{Topic: jobs.TopicJobCompleted, Payload: `{"job_id":8,"user_id":5}`}))
+	require.NoError(t, handler(context.Background(), &models.OutboxEvent{Topic: jobs.TopicJobCompleted, Payload: `{"job_id":9,"user_id":6,"rows_generated":1200}`}))
+	assert.Equal(t, recordingQuota{6}, checked)
+}
@@ -0,0 +1,304 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/artifacts"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/buckets"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/evalreport"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/warehouse"
+)
+
+// ErrNoOutputSealer is returned when a processor produces output but no
+// sealer is configured; outputs are never stored unencrypted
+var ErrNoOutputSealer = errors.New("no output sealer configured")
+
+// KeyStore persists wrapped output keys
+type KeyStore interface {
+	UpsertKey(ctx context.Context, k *models.JobOutputKey) error
+}
+
+// Destinations route job outputs to the bucket of their owner's
+// organization, when it registered one
+type Destinations interface {
+	// Destination returns the bucket a user's outputs are written to, or
+	// a nil delivery for platform storage
+	Destination(ctx context.Context, userID int64) (*models.OutputDelivery, storage.ObjectWriter, error)
+	// Reopen returns the bucket objects were delivered to
+	Reopen(ctx context.Context, d *models.OutputDelivery) (buckets.Store, error)
+	// Delivered records whether a delivery to an organization's bucket
+	// worked
+	Delivered(ctx context.Context, orgID int64, err error) error
+}
+
+// OutputSealer encrypts each job's output with its own data key before it
+// is written, and stores the data key wrapped under the master key.
+// Outputs of organizations with their own bucket are written there
+// instead of to Writer.
+type OutputSealer struct {
+	Envelope *storage.Envelope
+	Keys     KeyStore
+	Writer   storage.ObjectWriter
+	Buckets  Destinations
+}
+
+// Seal encrypts and writes a job's output and returns its object key, size
+// and checksums, with the organization bucket it was delivered to if any.
+// Its exports are written next to it under the same data key; one that
+// cannot be written is recorded as failed rather than failing the job.
+func (s *OutputSealer) Seal(ctx context.Context, job *models.GenerationJob, output []byte, exports []Export) (models.JobExport, []models.JobExport, *models.OutputDelivery, error) {
+	var stored models.JobExport
+	writer, delivery, err := s.destination(ctx, job)
+	if err != nil {
+		return stored, nil, nil, err
+	}
+	plain, wrapped, kid, err := s.Envelope.NewDataKey()
+	if err != nil {
+		return stored, nil, nil, err
+	}
+	sealed, err := storage.Seal(plain, output)
+	if err != nil {
+		return stored, nil, nil, fmt.Errorf("failed to encrypt output: %w", err)
+	}
+	// The key is stored first: a key without an object is harmless, an
+	// object without its key is lost
+	if err := s.Keys.UpsertKey(ctx, &models.JobOutputKey{
+		JobID:       job.ID,
+		MasterKeyID: kid,
+		WrappedKey:  wrapped,
+		Algorithm:   storage.OutputCipher,
+	}); err != nil {
+		return stored, nil, nil, fmt.Errorf("failed to store output key: %w", err)
+	}
+	prefix := ""
+	if delivery != nil {
+		prefix = delivery.Prefix
+	}
+	objectKey := prefix + fmt.Sprintf("outputs/%d/%d.enc", job.UserID, job.ID)
+	err = writer.PutObject(ctx, objectKey, bytes.NewReader(sealed), "application/octet-stream")
+	if delivery != nil {
+		_ = s.Buckets.Delivered(ctx, delivery.OrgID, err)
+		if err != nil {
+			return stored, nil, nil, fmt.Errorf("%w to %s bucket %s: %s", buckets.ErrDeliveryFailed, delivery.Provider, delivery.Bucket, redact.String(err.Error()))
+		}
+	}
+	if err != nil {
+		return stored, nil, nil, fmt.Errorf("failed to write output: %w", err)
+	}
+	stored = models.JobExport{Status: models.ExportCompleted, ObjectKey: objectKey, Bytes: int64(len(output)),
+		SHA256: artifacts.Checksum(output), ObjectSHA256: artifacts.Checksum(sealed)}
+	out := make([]models.JobExport, len(exports))
+	var wg sync.WaitGroup
+	for i, e := range exports {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			out[i] = s.sealExport(ctx, job, writer, prefix, plain, e)
+		}()
+	}
+	wg.Wait()
+	return stored, out, delivery, nil
+}
+
+// destination returns where a job's objects are written. An organization
+// bucket that was never verified fails the job rather than have its
+// outputs rest in platform storage.
+func (s *OutputSealer) destination(ctx context.Context, job *models.GenerationJob) (storage.ObjectWriter, *models.OutputDelivery, error) {
+	if s.Buckets == nil {
+		return s.Writer, nil, nil
+	}
+	delivery, w, err := s.Buckets.Destination(ctx, job.UserID)
+	if errors.Is(err, buckets.ErrUnverified) {
+		return nil, nil, Permanent(err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if delivery == nil {
+		return s.Writer, nil, nil
+	}
+	return w, delivery, nil
+}
+
+func (s *OutputSealer) sealExport(ctx context.Context, job *models.GenerationJob, writer storage.ObjectWriter, prefix string, key []byte, e Export) models.JobExport {
+	out := models.JobExport{Format: e.Format, Status: models.ExportFailed}
+	if e.Err != nil {
+		out.Error = redact.String(e.Err.Error())
+		return out
+	}
+	sealed, err := storage.Seal(key, e.Output)
+	if err != nil {
+		out.Error = "failed to encrypt export"
+		return out
+	}
+	objectKey := prefix + fmt.Sprintf("outputs/%d/%d.%s.enc", job.UserID, job.ID, export.Extension(e.Format))
+	if err := writer.PutObject(ctx, objectKey, bytes.NewReader(sealed), "application/octet-stream"); err != nil {
+		out.Error = "failed to write export"
+		return out
+	}
+	out.Status, out.ObjectKey, out.Bytes = models.ExportCompleted, objectKey, int64(len(e.Output))
+	out.SHA256, out.ObjectSHA256 = artifacts.Checksum(e.Output), artifacts.Checksum(sealed)
+	return out
+}
+
+// WriteReports renders the evaluation report of a completed job in each
+// format and writes it next to its output, in the organization bucket the
+// output went to if any. Reports hold what the job recorded rather than
+// its rows, so they are stored unencrypted; one that cannot be written is
+// recorded as failed rather than failing the job.
+func (s *OutputSealer) WriteReports(ctx context.Context, job *models.GenerationJob) []models.JobExport {
+	report := evalreport.New(job, time.Now())
+	writer, prefix := s.Writer, ""
+	var reopenErr error
+	if q := job.QualityDetails; q != nil && q.Delivery != nil {
+		prefix = q.Delivery.Prefix
+		if s.Buckets == nil {
+			reopenErr = buckets.ErrBucketChanged
+		} else {
+			writer, reopenErr = s.Buckets.Reopen(ctx, q.Delivery)
+		}
+	}
+	out := make([]models.JobExport, 0, len(evalreport.Formats))
+	for _, format := range evalreport.Formats {
+		stored := models.JobExport{Format: format, Status: models.ExportFailed}
+		if reopenErr != nil {
+			stored.Error = "failed to write report"
+			out = append(out, stored)
+			continue
+		}
+		content, err := evalreport.Render(report, format)
+		if err != nil {
+			stored.Error = "failed to render report"
+			out = append(out, stored)
+			continue
+		}
+		objectKey := prefix + fmt.Sprintf("outputs/%d/%d.report.%s", job.UserID, job.ID, format)
+		if err := writer.PutObject(ctx, objectKey, bytes.NewReader(content), evalreport.ContentType(format)); err != nil {
+			stored.Error = "failed to write report"
+			out = append(out, stored)
+			continue
+		}
+		stored.Status, stored.ObjectKey, stored.Bytes = models.ExportCompleted, objectKey, int64(len(content))
+		stored.SHA256, stored.ObjectSHA256 = artifacts.Checksum(content), artifacts.Checksum(content)
+		out = append(out, stored)
+	}
+	return out
+}
+
+// OwnedJobs loads a user's jobs
+type OwnedJobs interface {
+	GetByOwner(ctx context.Context, userID, jobID int64) (*models.GenerationJob, error)
+}
+
+// OutputKeys releases output keys under active access grants
+type OutputKeys interface {
+	GetKey(ctx context.Context, jobID int64) (*models.JobOutputKey, error)
+	ActiveGrant(ctx context.Context, jobID, userID int64) (*models.OutputAccessGrant, error)
+}
+
+// OutputReader reads the rows of completed jobs for exports that run
+// without a request, such as loads into warehouses. Like downloads,
+// encrypted outputs are only read under the owner's active access grant,
+// and each such read is audited.
+type OutputReader struct {
+	Jobs     OwnedJobs
+	Keys     OutputKeys
+	Envelope *storage.Envelope
+	Reader   storage.ObjectReader
+	// Buckets opens the organization buckets outputs were delivered to
+	Buckets Destinations
+	Audit   AuditRecorder
+	// Destination is recorded with audited reads; it defaults to warehouse
+	Destination string
+}
+
+// Job returns a user's job, for readers that follow a job back to the runs
+// before it
+func (o *OutputReader) Job(ctx context.Context, userID, jobID int64) (*models.GenerationJob, error) {
+	return o.Jobs.GetByOwner(ctx, userID, jobID)
+}
+
+// Rows returns the rows of a user's completed job
+func (o *OutputReader) Rows(ctx context.Context, userID, jobID int64) ([]map[string]any, error) {
+	job, err := o.Jobs.GetByOwner(ctx, userID, jobID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", warehouse.ErrOutputUnavailable, err)
+	}
+	if job.Status != models.GenCompleted || job.OutputKey == nil {
+		return nil, fmt.Errorf("%w: job is not completed", warehouse.ErrOutputUnavailable)
+	}
+	format := export.JSON
+	if job.OutputFormat != nil && *job.OutputFormat != "" {
+		format = *job.OutputFormat
+	}
+	if format != export.JSON && format != export.CSV {
+		return nil, fmt.Errorf("%w: %s outputs hold no rows", warehouse.ErrOutputUnavailable, format)
+	}
+	var key *models.JobOutputKey
+	var grant *models.OutputAccessGrant
+	if o.Keys != nil {
+		key, err = o.Keys.GetKey(ctx, jobID)
+		if errors.Is(err, sql.ErrNoRows) {
+			key = nil
+		} else if err != nil {
+			return nil, err
+		} else if grant, err = o.Keys.ActiveGrant(ctx, jobID, userID); err != nil {
+			return nil, fmt.Errorf("%w: output access required", warehouse.ErrOutputUnavailable)
+		}
+	}
+	var reader storage.ObjectReader = o.Reader
+	if q := job.QualityDetails; q != nil && q.Delivery != nil {
+		if o.Buckets == nil {
+			return nil, fmt.Errorf("%w: %v", warehouse.ErrOutputUnavailable, buckets.ErrBucketChanged)
+		}
+		if reader, err = o.Buckets.Reopen(ctx, q.Delivery); err != nil {
+			return nil, fmt.Errorf("%w: %v", warehouse.ErrOutputUnavailable, err)
+		}
+	}
+	obj, err := reader.OpenObject(ctx, *job.OutputKey)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		if o.Envelope == nil {
+			return nil, fmt.Errorf("%w: output cannot be decrypted", warehouse.ErrOutputUnavailable)
+		}
+		plain, err := o.Envelope.Unwrap(key.MasterKeyID, key.WrappedKey)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", warehouse.ErrOutputUnavailable, err)
+		}
+		if raw, err = storage.Open(plain, raw); err != nil {
+			return nil, fmt.Errorf("failed to decrypt output: %w", err)
+		}
+		if o.Audit != nil {
+			destination := o.Destination
+			if destination == "" {
+				destination = "warehouse"
+			}
+			meta, _ := json.Marshal(map[string]any{"grant_id": grant.ID, "grantee_id": grant.UserID, "status": grant.Status, "destination": destination})
+			resourceID := strconv.FormatInt(jobID, 10)
+			if _, err := o.Audit.Insert(ctx, &models.AuditLog{UserID: &userID, Action: "output_exported", Resource: "generation_job", ResourceID: &resourceID, Metadata: string(meta)}); err != nil {
+				return nil, fmt.Errorf("failed to audit output export: %w", err)
+			}
+		}
+	}
+	return export.ReadRows(bytes.NewReader(raw), format)
+}
@@ -0,0 +1,239 @@
+// Package loadshed protects the critical paths of the API under overload.
+// It tracks requests in flight and a decaying average of their latency, and
+// turns away low-priority traffic first so that sign-in and job status keep
+// answering while analytics ingestion and previews wait.
+package loadshed
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Priority is the class of a request; lower classes are shed first
+type Priority int
+
+const (
+	Low Priority = iota
+	Normal
+	Critical
+)
+
+func (p Priority) String() string {
+	switch p {
+	case Low:
+		return "low"
+	case Critical:
+		return "critical"
+	default:
+		return "normal"
+	}
+}
+
+var (
+	inFlightGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "loadshed_in_flight_requests",
+		Help: "Requests currently being served",
+	})
+	latencyGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "loadshed_latency_seconds",
+		Help: "Decaying average request latency the shedder acts on",
+	})
+	loadGauge = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "loadshed_load",
+		Help: "Load as a share of capacity; 1 is fully loaded",
+	})
+	shedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "loadshed_shed_requests_total",
+		Help: "Requests turned away because the service was overloaded",
+	}, []string{"priority"})
+)
+
+// Config sets the capacity of the service and where each class is shed.
+// Load is the larger of in-flight requests over MaxInFlight and average
+// latency over TargetLatency. Low priority requests are shed from LowShedAt
+// and normal ones from NormalShedAt; critical requests never are.
+type Config struct {
+	MaxInFlight   int
+	TargetLatency time.Duration
+	LowShedAt     float64
+	NormalShedAt  float64
+	// LatencyHalfLife is how fast the latency average decays while no
+	// request completes
+	LatencyHalfLife time.Duration
+	// RetryAfter is what shed clients are told to wait
+	RetryAfter time.Duration
+}
+
+// DefaultConfig sheds low priority traffic at 70% of capacity and normal
+// traffic at capacity
+func DefaultConfig() Config {
+	return Config{
+		MaxInFlight:     500,
+		TargetLatency:   2 * time.Second,
+		LowShedAt:       0.7,
+		NormalShedAt:    1.0,
+		LatencyHalfLife: 10 * time.Second,
+		RetryAfter:      5 * time.Second,
+	}
+}
+
+// latencyWeight is the weight of each completed request in the latency
+// average
+const latencyWeight = 0.05
+
+// Shedder admits or sheds requests by priority and load
+type Shedder struct {
+	cfg Config
+	now func() time.Time
+
+	mu       sync.Mutex
+	inFlight int
+	latency  float64
+	sampled  time.Time
+}
+
+// New returns a shedder; zero fields of cfg take their defaults
+func New(cfg Config) *Shedder {
+	def := DefaultConfig()
+	if cfg.MaxInFlight <= 0 {
+		cfg.MaxInFlight = def.MaxInFlight
+	}
+	if cfg.TargetLatency <= 0 {
+		cfg.TargetLatency = def.TargetLatency
+	}
+	if cfg.LowShedAt <= 0 {
+		cfg.LowShedAt = def.LowShedAt
+	}
+	if cfg.NormalShedAt <= 0 {
+		cfg.NormalShedAt = def.NormalShedAt
+	}
+	if cfg.LatencyHalfLife <= 0 {
+		cfg.LatencyHalfLife = def.LatencyHalfLife
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = def.RetryAfter
+	}
+	return &Shedder{cfg: cfg, now: time.Now}
+}
+
+// RetryAfter is how long shed clients are told to wait
+func (s *Shedder) RetryAfter() time.Duration {
+	return s.cfg.RetryAfter
+}
+
+// Acquire admits a request of priority p, returning the function that
+// records its completion, or sheds it and returns false. Completions of
+// untimed requests are left out of the latency average.
+func (s *Shedder) Acquire(p Priority) (done func(timed bool), ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	load := s.loadLocked(now)
+	loadGauge.Set(load)
+	if (p == Low && load >= s.cfg.LowShedAt) || (p == Normal && load >= s.cfg.NormalShedAt) {
+		shedTotal.WithLabelValues(p.String()).Inc()
+		return nil, false
+	}
+	s.inFlight++
+	inFlightGauge.Inc()
+	var once sync.Once
+	return func(timed bool) { once.Do(func() { s.release(now, timed) }) }, true
+}
+
+// release records a request admitted at start as finished
+func (s *Shedder) release(start time.Time, timed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.inFlight--
+	inFlightGauge.Dec()
+	if !timed {
+		return
+	}
+	s.latency = s.latencyLocked(now)
+	s.latency += latencyWeight * (now.Sub(start).Seconds() - s.latency)
+	s.sampled = now
+	latencyGauge.Set(s.latency)
+}
+
+// latencyLocked is the latency average decayed over the time since the
+// last sample, so an idle service does not stay overloaded
+func (s *Shedder) latencyLocked(now time.Time) float64 {
+	if s.sampled.IsZero() {
+		return s.latency
+	}
+	idle := now.Sub(s.sampled).Seconds()
+	return s.latency * math.Exp2(-idle/s.cfg.LatencyHalfLife.Seconds())
+}
+
+func (s *Shedder) loadLocked(now time.Time) float64 {
+	byCount := float64(s.inFlight) / float64(s.cfg.MaxInFlight)
+	byLatency := s.latencyLocked(now) / s.cfg.TargetLatency.Seconds()
+	return math.Max(byCount, byLatency)
+}
+
+// Load is the current load as a share of capacity
+func (s *Shedder) Load() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadLocked(s.now())
+}
+
+// Rule assigns a priority to requests whose path starts with Prefix and,
+// when set, ends with Suffix. Method restricts it to one method. Untimed
+// requests, such as streams, stay open for as long as the client listens
+// and are left out of the latency average.
+type Rule struct {
+	Method   string
+	Prefix   string
+	Suffix   string
+	Priority Priority
+	Untimed  bool
+}
+
+// DefaultRules keep health checks, metrics, authentication and job status
+// critical, and mark analytics, feedback, previews, marketing content and
+// the API docs as low priority
+var DefaultRules = []Rule{
+	{Prefix: "/health", Priority: Critical},
+	{Prefix: "/metrics", Priority: Critical},
+	{Prefix: "/api/v1/auth/", Priority: Critical},
+	{Method: "GET", Prefix: "/api/v1/generation/", Suffix: "/status", Priority: Critical},
+	{Method: "GET", Prefix: "/api/v1/generation/", Suffix: "/stream", Priority: Normal, Untimed: true},
+	{Prefix: "/api/v1/analytics/", Priority: Low},
+	{Prefix: "/api/v1/feedback", Priority: Low},
+	{Method: "GET", Prefix: "/api/v1/datasets/", Suffix: "/preview", Priority: Low},
+	{Prefix: "/api/v1/docs", Priority: Low},
+	{Prefix: "/api/v1/marketing/", Priority: Low},
+}
+
+// Classifier maps requests to priorities by the first rule they match
+type Classifier struct {
+	rules []Rule
+}
+
+// NewClassifier uses DefaultRules when rules is empty
+func NewClassifier(rules []Rule) *Classifier {
+	if len(rules) == 0 {
+		rules = DefaultRules
+	}
+	return &Classifier{rules: rules}
+}
+
+// Classify returns the first rule a request matches, or a timed Normal rule
+func (c *Classifier) Classify(method, path string) Rule {
+	for _, r := range c.rules {
+		if r.Method != "" && !strings.EqualFold(r.Method, method) {
+			continue
+		}
+		if strings.HasPrefix(path, r.Prefix) && strings.HasSuffix(path, r.Suffix) {
+			return r
+		}
+	}
+	return Rule{Priority: Normal}
+}
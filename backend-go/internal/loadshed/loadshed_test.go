@@ -0,0 +1,86 @@
+// Package loadshed_test provides unit tests for load shedding
+package loadshed_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/loadshed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShedsByPriorityAsInFlightGrows(t *testing.T) {
+	s := loadshed.New(loadshed.Config{MaxInFlight: 10, LowShedAt: 0.5, NormalShedAt: 1, TargetLatency: time.Hour})
+
+	var done []func(bool)
+	for i := 0; i < 5; i++ {
+		d, ok := s.Acquire(loadshed.Normal)
+		require.True(t, ok)
+		done = append(done, d)
+	}
+	_, ok := s.Acquire(loadshed.Low)
+	assert.False(t, ok, "low priority is shed at half capacity")
+
+	for i := 0; i < 5; i++ {
+		d, ok := s.Acquire(loadshed.Normal)
+		require.True(t, ok)
+		done = append(done, d)
+	}
+	_, ok = s.Acquire(loadshed.Normal)
+	assert.False(t, ok, "normal priority is shed at capacity")
+	d, ok := s.Acquire(loadshed.Critical)
+	assert.True(t, ok, "critical requests are always admitted")
+	done = append(done, d)
+
+	for _, d := range done {
+		d(true)
+		d(true)
+	}
+	_, ok = s.Acquire(loadshed.Low)
+	assert.True(t, ok)
+
+	for i := 0; i < 4; i++ {
+		_, ok := s.Acquire(loadshed.Normal)
+		require.True(t, ok)
+	}
+	_, ok = s.Acquire(loadshed.Low)
+	assert.False(t, ok, "releasing twice counts once")
+}
+
+func TestShedsOnLatencyAndRecoversWhenIdle(t *testing.T) {
+	s := loadshed.New(loadshed.Config{MaxInFlight: 1000, TargetLatency: time.Millisecond, LatencyHalfLife: 20 * time.Millisecond})
+
+	d, ok := s.Acquire(loadshed.Normal)
+	require.True(t, ok)
+	time.Sleep(50 * time.Millisecond)
+	d(true)
+	_, ok = s.Acquire(loadshed.Normal)
+	assert.False(t, ok, "a slow request raises the latency average past the target")
+
+	time.Sleep(200 * time.Millisecond)
+	_, ok = s.Acquire(loadshed.Normal)
+	assert.True(t, ok, "the average decays while idle")
+
+	stream, ok := s.Acquire(loadshed.Normal)
+	require.True(t, ok)
+	time.Sleep(50 * time.Millisecond)
+	stream(false)
+	_, ok = s.Acquire(loadshed.Low)
+	assert.True(t, ok, "untimed requests leave the average alone")
+}
+
+func TestClassifier(t *testing.T) {
+	c := loadshed.NewClassifier(nil)
+	assert.Equal(t, loadshed.Critical, c.Classify("POST", "/api/v1/auth/signin").Priority)
+	assert.Equal(t, loadshed.Critical, c.Classify("GET", "/api/v1/generation/jobs/42/status").Priority)
+	assert.Equal(t, loadshed.Critical, c.Classify("GET", "/health/ready").Priority)
+	assert.Equal(t, loadshed.Low, c.Classify("POST", "/api/v1/analytics/feedback").Priority)
+	assert.Equal(t, loadshed.Low, c.Classify("GET", "/api/v1/datasets/7/preview").Priority)
+	assert.Equal(t, loadshed.Normal, c.Classify("POST", "/api/v1/generation/generate").Priority)
+	assert.Equal(t, loadshed.Normal, c.Classify("DELETE", "/api/v1/datasets/7/preview").Priority)
+
+	stream := c.Classify("GET", "/api/v1/generation/42/stream")
+	assert.Equal(t, loadshed.Normal, stream.Priority)
+	assert.True(t, stream.Untimed)
+}
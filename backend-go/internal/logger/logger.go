@@ -2,13 +2,15 @@ package logger
 
 import (
 	"go.uber.org/zap"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
 )
 
+// New builds the service logger. Every entry passes through redact.Core, so
+// suspected PII in messages, string fields and errors never reaches the log.
 func New(environment string) (*zap.Logger, error) {
 	if environment == "production" {
-		return zap.NewProduction()
+		return zap.NewProduction(zap.WrapCore(redact.Core))
 	}
-	return zap.NewDevelopment()
+	return zap.NewDevelopment(zap.WrapCore(redact.Core))
 }
-
-
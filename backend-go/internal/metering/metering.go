@@ -0,0 +1,296 @@
+// Package metering records granular usage for billing: rows generated, API
+// requests, storage and custom model training. Usage events roll up into
+// totals per user, meter and billing period, the calendar month in UTC.
+// Usage past what the subscription plan includes is overage, priced on the
+// period's invoice and reported to Stripe billing meters.
+package metering
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/payments"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/usage"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Meters are the metered kinds of usage, in invoice order
+var Meters = []models.UsageMeter{
+	models.MeterRowsGenerated,
+	models.MeterAPIRequests,
+	models.MeterStorageGBDays,
+	models.MeterTrainingMinutes,
+}
+
+var meterInfo = map[models.UsageMeter]struct{ unit, description string }{
+	models.MeterRowsGenerated:   {"row", "Rows generated"},
+	models.MeterAPIRequests:     {"request", "API requests"},
+	models.MeterStorageGBDays:   {"GB-day", "Dataset and custom model storage"},
+	models.MeterTrainingMinutes: {"minute", "Custom model training"},
+}
+
+// Period returns the start of the billing period t falls in
+func Period(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// ParsePeriod parses a billing period written as YYYY-MM
+func ParsePeriod(s string) (time.Time, error) {
+	return time.Parse("2006-01", s)
+}
+
+// Rate returns the usage of a meter a plan includes each billing period,
+// -1 when unlimited, and the USD price of each unit past it. Plans without
+// metering rates bill no overage: only their row limit is shown, at no
+// price, and the other meters are unlimited.
+func Rate(limits usage.PlanLimits, meter models.UsageMeter) (included, unitPrice float64) {
+	m := limits.Metering
+	if meter == models.MeterRowsGenerated {
+		included = float64(limits.MonthlyRowLimit)
+		if limits.MonthlyRowLimit <= 0 {
+			included = -1
+		}
+		if m != nil {
+			unitPrice = m.PricePer1000Rows / 1000
+		}
+		return included, unitPrice
+	}
+	if m == nil {
+		return -1, 0
+	}
+	switch meter {
+	case models.MeterAPIRequests:
+		return float64(m.IncludedAPIRequests), m.PricePer1000APIRequests / 1000
+	case models.MeterStorageGBDays:
+		return m.IncludedStorageGBDays, m.PricePerGBDay
+	case models.MeterTrainingMinutes:
+		return float64(m.IncludedTrainingMinutes), m.PricePerTrainingMinute
+	}
+	return -1, 0
+}
+
+// Overage returns the usage past what is included; none when included is
+// unlimited
+func Overage(quantity, included float64) float64 {
+	if included < 0 {
+		return 0
+	}
+	return math.Max(quantity-included, 0)
+}
+
+// Invoice prices a user's usage totals of a billing period against the
+// limits of their plan, with a line for every meter
+func Invoice(period time.Time, tier models.SubscriptionTier, limits usage.PlanLimits, totals []models.UsagePeriodTotal) *models.UsageInvoice {
+	quantities := make(map[models.UsageMeter]float64, len(totals))
+	for _, t := range totals {
+		quantities[t.Meter] += t.Quantity
+	}
+	inv := &models.UsageInvoice{
+		Period:      period.Format("2006-01"),
+		PeriodStart: period,
+		PeriodEnd:   period.AddDate(0, 1, 0),
+		Tier:        tier,
+		Currency:    "usd",
+		Lines:       make([]models.InvoiceLineItem, 0, len(Meters)),
+	}
+	var total float64
+	for _, meter := range Meters {
+		included, price := Rate(limits, meter)
+		line := models.InvoiceLineItem{
+			Meter:       meter,
+			Description: meterInfo[meter].description,
+			Unit:        meterInfo[meter].unit,
+			Quantity:    quantities[meter],
+			Included:    included,
+			Overage:     Overage(quantities[meter], included),
+			UnitPrice:   price,
+		}
+		line.Amount = cents(line.Overage * price)
+		total += line.Amount
+		inv.Lines = append(inv.Lines, line)
+	}
+	inv.OverageAmount = cents(total)
+	return inv
+}
+
+func cents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// Store records usage events and reads the totals to bill
+type Store interface {
+	Record(ctx context.Context, e *models.UsageEvent) (bool, error)
+	Billable(ctx context.Context, since time.Time) ([]models.BillableUsage, error)
+	MarkReported(ctx context.Context, userID int64, period time.Time, meter models.UsageMeter, reported int64) error
+	StorageBytes(ctx context.Context) (map[int64]int64, error)
+}
+
+// MeterReporter sends usage to the payment provider's billing meters
+type MeterReporter interface {
+	ReportMeterEvent(ctx context.Context, e payments.MeterEvent) error
+}
+
+// RequestCounter counts API requests per user in memory until the worker
+// records them
+type RequestCounter struct {
+	mu     sync.Mutex
+	counts map[int64]int64
+}
+
+func NewRequestCounter() *RequestCounter {
+	return &RequestCounter{counts: map[int64]int64{}}
+}
+
+// Add counts n requests of a user
+func (c *RequestCounter) Add(userID int64, n int64) {
+	c.mu.Lock()
+	c.counts[userID] += n
+	c.mu.Unlock()
+}
+
+// Count counts a request of a user
+func (c *RequestCounter) Count(userID int64) { c.Add(userID, 1) }
+
+func (c *RequestCounter) drain() map[int64]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := c.counts
+	c.counts = map[int64]int64{}
+	return out
+}
+
+// Worker records counted API requests and daily storage samples, and
+// reports overage to Stripe billing meters
+type Worker struct {
+	store    Store
+	stripe   MeterReporter
+	requests *RequestCounter
+	// events maps meters to the Stripe meter event names their overage is
+	// reported under
+	events  map[models.UsageMeter]string
+	logger  *zap.Logger
+	sampled string
+}
+
+// NewWorker creates a metering worker. Overage of meters missing from
+// eventNames is not reported, nor any when stripe is nil.
+func NewWorker(store Store, stripe MeterReporter, requests *RequestCounter, eventNames map[string]string, logger *zap.Logger) *Worker {
+	events := make(map[models.UsageMeter]string, len(eventNames))
+	for meter, name := range eventNames {
+		events[models.UsageMeter(meter)] = name
+	}
+	return &Worker{store: store, stripe: stripe, requests: requests, events: events, logger: logger}
+}
+
+// Run records the requests counted since the last run, samples storage once
+// a day, and reports overage grown since it was last reported. It returns
+// how many meter events were sent to Stripe.
+func (w *Worker) Run(ctx context.Context, now time.Time) (int, error) {
+	if err := w.recordRequests(ctx, now); err != nil {
+		return 0, err
+	}
+	if err := w.sampleStorage(ctx, now); err != nil {
+		return 0, err
+	}
+	return w.report(ctx, now)
+}
+
+func (w *Worker) recordRequests(ctx context.Context, now time.Time) error {
+	if w.requests == nil {
+		return nil
+	}
+	counts := w.requests.drain()
+	for userID, n := range counts {
+		e := &models.UsageEvent{UserID: userID, Meter: models.MeterAPIRequests, Quantity: float64(n), IdempotencyKey: "api:" + uuid.NewString(), OccurredAt: now}
+		if _, err := w.store.Record(ctx, e); err != nil {
+			// Counts not recorded are kept for the next run
+			for id, n := range counts {
+				w.requests.Add(id, n)
+			}
+			return fmt.Errorf("record api requests: %w", err)
+		}
+		delete(counts, userID)
+	}
+	return nil
+}
+
+// sampleStorage records a GB-day for each gigabyte a user stores, once per
+// UTC day; the day in the idempotency key keeps a restart from sampling it
+// twice
+func (w *Worker) sampleStorage(ctx context.Context, now time.Time) error {
+	day := now.UTC().Format("2006-01-02")
+	if w.sampled == day {
+		return nil
+	}
+	bytes, err := w.store.StorageBytes(ctx)
+	if err != nil {
+		return fmt.Errorf("read storage: %w", err)
+	}
+	for userID, n := range bytes {
+		e := &models.UsageEvent{UserID: userID, Meter: models.MeterStorageGBDays, Quantity: float64(n) / 1e9, IdempotencyKey: "storage:" + day, OccurredAt: now}
+		if _, err := w.store.Record(ctx, e); err != nil {
+			return fmt.Errorf("record storage: %w", err)
+		}
+	}
+	w.sampled = day
+	return nil
+}
+
+// report sends the whole units of overage each total gained since it was
+// last reported, for the current and the previous billing period. An
+// identifier naming the overage reached keeps Stripe from counting a
+// retried event twice.
+func (w *Worker) report(ctx context.Context, now time.Time) (int, error) {
+	if w.stripe == nil || len(w.events) == 0 {
+		return 0, nil
+	}
+	current := Period(now)
+	totals, err := w.store.Billable(ctx, current.AddDate(0, -1, 0))
+	if err != nil {
+		return 0, fmt.Errorf("read billable usage: %w", err)
+	}
+	sent := 0
+	for _, t := range totals {
+		name, ok := w.events[t.Meter]
+		if !ok {
+			continue
+		}
+		limits := usage.Limits(t.Tier)
+		if limits.Metering == nil {
+			continue
+		}
+		included, _ := Rate(limits, t.Meter)
+		overage := int64(math.Floor(Overage(t.Quantity, included)))
+		if overage <= t.Reported {
+			continue
+		}
+		// Usage of a closed period is dated at its end so it is billed there
+		at := now
+		if end := t.Period.AddDate(0, 1, 0).Add(-time.Second); at.After(end) {
+			at = end
+		}
+		period := t.Period.Format("2006-01")
+		err := w.stripe.ReportMeterEvent(ctx, payments.MeterEvent{
+			EventName:  name,
+			CustomerID: t.StripeCustomerID,
+			Value:      overage - t.Reported,
+			Identifier: fmt.Sprintf("usage-%d-%s-%s-%d", t.UserID, period, t.Meter, overage),
+			Timestamp:  at,
+		})
+		if err != nil {
+			w.logger.Warn("failed to report metered usage", zap.Int64("user_id", t.UserID), zap.String("meter", string(t.Meter)), zap.String("period", period), zap.Error(err))
+			continue
+		}
+		if err := w.store.MarkReported(ctx, t.UserID, t.Period, t.Meter, overage); err != nil {
+			return sent, fmt.Errorf("mark usage reported: %w", err)
+		}
+		sent++
+	}
+	return sent, nil
+}
@@ -0,0 +1,161 @@
+// Package metering_test provides unit tests for usage metering and overage
+// billing
+package metering_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/metering"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/payments"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestInvoice(t *testing.T) {
+	period := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	totals := []models.UsagePeriodTotal{
+		{Meter: models.MeterAPIRequests, Quantity: 2500000},
+		{Meter: models.MeterStorageGBDays, Quantity: 1200.5},
+		{Meter: models.MeterRowsGenerated, Quantity: 900000},
+	}
+	inv := metering.Invoice(period, models.TierProfessional, usage.Limits(models.TierProfessional), totals)
+
+	assert.Equal(t, "2026-10", inv.Period)
+	assert.Equal(t, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), inv.PeriodEnd)
+	require.Len(t, inv.Lines, 4)
+	byMeter := map[models.UsageMeter]models.InvoiceLineItem{}
+	for _, l := range inv.Lines {
+		byMeter[l.Meter] = l
+	}
+	assert.Equal(t, 0.0, byMeter[models.MeterRowsGenerated].Overage, "rows within the monthly limit")
+	api := byMeter[models.MeterAPIRequests]
+	assert.Equal(t, 2000000.0, api.Included)
+	assert.Equal(t, 500000.0, api.Overage)
+	assert.Equal(t, 100.0, api.Amount)
+	assert.Equal(t, 0.0, byMeter[models.MeterStorageGBDays].Amount)
+	assert.Equal(t, 0.0, byMeter[models.MeterTrainingMinutes].Quantity, "meters without usage still get a line")
+	assert.Equal(t, 100.0, inv.OverageAmount)
+
+	free := metering.Invoice(period, models.TierFree, usage.Limits(models.TierFree), totals)
+	assert.Equal(t, 0.0, free.OverageAmount, "plans without metering rates bill no overage")
+	assert.Equal(t, 10000.0, free.Lines[0].Included)
+	assert.Equal(t, -1.0, free.Lines[1].Included)
+}
+
+func TestPeriod(t *testing.T) {
+	at := time.Date(2026, 10, 31, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*3600))
+	assert.Equal(t, time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC), metering.Period(at), "periods are UTC months")
+	p, err := metering.ParsePeriod("2026-02")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), p)
+	_, err = metering.ParsePeriod("2026-2-1")
+	assert.Error(t, err)
+}
+
+type memoryStore struct {
+	events   map[string]models.UsageEvent
+	billable []models.BillableUsage
+	storage  map[int64]int64
+	failing  bool
+}
+
+func (s *memoryStore) Record(_ context.Context, e *models.UsageEvent) (bool, error) {
+	if s.failing {
+		return false, errors.New("connection refused")
+	}
+	key := string(e.Meter) + "/" + e.IdempotencyKey
+	if _, ok := s.events[key]; ok {
+		return false, nil
+	}
+	s.events[key] = *e
+	return true, nil
+}
+
+func (s *memoryStore) Billable(context.Context, time.Time) ([]models.BillableUsage, error) {
+	return s.billable, nil
+}
+
+func (s *memoryStore) MarkReported(_ context.Context, userID int64, period time.Time, meter models.UsageMeter, reported int64) error {
+	for i, b := range s.billable {
+		if b.UserID == userID && b.Period.Equal(period) && b.Meter == meter {
+			s.billable[i].Reported = reported
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) StorageBytes(context.Context) (map[int64]int64, error) {
+	return s.storage, nil
+}
+
+type recordingStripe []payments.MeterEvent
+
+func (r *recordingStripe) ReportMeterEvent(_ context.Context, e payments.MeterEvent) error {
+	*r = append(*r, e)
+	return nil
+}
+
+func TestWorkerRecordsRequestsAndStorage(t *testing.T) {
+	store := &memoryStore{events: map[string]models.UsageEvent{}, storage: map[int64]int64{3: 2500000000}}
+	requests := metering.NewRequestCounter()
+	w := metering.NewWorker(store, nil, requests, nil, zap.NewNop())
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	requests.Count(3)
+	requests.Count(3)
+	store.failing = true
+	_, err := w.Run(context.Background(), now)
+	require.Error(t, err)
+	store.failing = false
+	_, err = w.Run(context.Background(), now)
+	require.NoError(t, err)
+	_, err = w.Run(context.Background(), now.Add(time.Hour))
+	require.NoError(t, err)
+
+	var requested, stored float64
+	for _, e := range store.events {
+		switch e.Meter {
+		case models.MeterAPIRequests:
+			requested += e.Quantity
+		case models.MeterStorageGBDays:
+			stored += e.Quantity
+			assert.Equal(t, "storage:2026-10-16", e.IdempotencyKey)
+		}
+	}
+	assert.Equal(t, 2.0, requested, "requests not recorded are kept for the next run")
+	assert.Equal(t, 2.5, stored, "storage is sampled once a day")
+}
+
+func TestWorkerReportsOverageDeltas(t *testing.T) {
+	october := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	september := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	store := &memoryStore{billable: []models.BillableUsage{
+		{UsagePeriodTotal: models.UsagePeriodTotal{UserID: 1, Period: october, Meter: models.MeterAPIRequests, Quantity: 2000250.5}, Tier: models.TierProfessional, StripeCustomerID: "cus_1"},
+		{UsagePeriodTotal: models.UsagePeriodTotal{UserID: 1, Period: september, Meter: models.MeterStorageGBDays, Quantity: 1600, Reported: 40}, Tier: models.TierProfessional, StripeCustomerID: "cus_1"},
+		{UsagePeriodTotal: models.UsagePeriodTotal{UserID: 1, Period: october, Meter: models.MeterTrainingMinutes, Quantity: 30}, Tier: models.TierProfessional, StripeCustomerID: "cus_1"},
+		{UsagePeriodTotal: models.UsagePeriodTotal{UserID: 2, Period: october, Meter: models.MeterAPIRequests, Quantity: 9000000}, Tier: models.TierFree, StripeCustomerID: "cus_2"},
+	}}
+	stripe := &recordingStripe{}
+	w := metering.NewWorker(store, stripe, nil, map[string]string{"api_requests": "api_overage", "storage_gb_days": "storage_overage"}, zap.NewNop())
+	now := time.Date(2026, 10, 3, 12, 0, 0, 0, time.UTC)
+
+	n, err := w.Run(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	require.Len(t, *stripe, 2)
+	api := (*stripe)[0]
+	assert.Equal(t, payments.MeterEvent{EventName: "api_overage", CustomerID: "cus_1", Value: 250, Identifier: "usage-1-2026-10-api_requests-250", Timestamp: now}, api)
+	storage := (*stripe)[1]
+	assert.Equal(t, int64(60), storage.Value, "only overage grown since the last report is sent")
+	assert.Equal(t, october.Add(-time.Second), storage.Timestamp, "a closed period's usage is dated in it")
+
+	n, err = w.Run(context.Background(), now)
+	require.NoError(t, err)
+	assert.Zero(t, n, "reported overage is not sent again")
+}
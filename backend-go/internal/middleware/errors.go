@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"runtime/debug"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/errreport"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// OrgLookup resolves the organization of a user for error reports; 0 when
+// the user has none
+type OrgLookup func(userID int64) int64
+
+// traceparent is a W3C trace context header: version, trace ID, parent
+// span ID and flags
+var traceparent = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// Trace correlates a request's logs and error reports with the trace it
+// belongs to. The trace is taken from an OpenTelemetry traceparent header,
+// then from X-Trace-ID, and started otherwise; it is stored in the
+// trace_id and span_id locals and returned in X-Trace-ID.
+func Trace() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		traceID, spanID := "", ""
+		if m := traceparent.FindStringSubmatch(strings.ToLower(strings.TrimSpace(c.Get("traceparent")))); m != nil && strings.Trim(m[1], "0") != "" {
+			traceID, spanID = m[1], m[2]
+		} else if id := strings.TrimSpace(c.Get("X-Trace-ID")); id != "" && len(id) <= 64 {
+			traceID = id
+		}
+		if traceID == "" {
+			traceID = randomHex(16)
+		}
+		if spanID == "" {
+			spanID = randomHex(8)
+		}
+		c.Locals("trace_id", traceID)
+		c.Locals("span_id", spanID)
+		c.Set("X-Trace-ID", traceID)
+		return c.Next()
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Recover turns a panic in a handler into a structured 500 response
+// instead of a dropped connection, logging it with its stack and
+// reporting it with the request's context
+func Recover(reporter *errreport.Reporter, logger *zap.Logger, orgs OrgLookup) fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			eventID := reporter.CapturePanic(r, scope(c, orgs))
+			if logger != nil {
+				logger.Error("panic recovered",
+					zap.String("trace_id", GetTraceID(c)),
+					zap.String("method", c.Method()),
+					zap.String("path", c.Path()),
+					zap.Any("panic", r),
+					zap.String("event_id", eventID),
+					zap.ByteString("stack", debug.Stack()),
+				)
+			}
+			c.Response().ResetBody()
+			body := fiber.Map{
+				"error":    "internal_error",
+				"message":  "An internal error occurred",
+				"trace_id": GetTraceID(c),
+			}
+			if eventID != "" {
+				body["event_id"] = eventID
+			}
+			err = c.Status(fiber.StatusInternalServerError).JSON(body)
+		}()
+		return c.Next()
+	}
+}
+
+// ReportErrors reports errors returned by handlers and responses with a
+// server error status, tagged with the route and the response's error code
+func ReportErrors(reporter *errreport.Reporter, orgs OrgLookup) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		err := c.Next()
+		if reporter == nil {
+			return err
+		}
+		if err != nil {
+			if fe, ok := err.(*fiber.Error); ok && fe.Code < fiber.StatusInternalServerError {
+				return err
+			}
+			reporter.CaptureError(err, scope(c, orgs), 0)
+			return err
+		}
+		// 501 is how features answer when they are not configured, which is
+		// not an error of the service
+		status := c.Response().StatusCode()
+		if status < fiber.StatusInternalServerError || status == fiber.StatusNotImplemented {
+			return nil
+		}
+		s := scope(c, orgs)
+		code := errorCode(c.Response().Body())
+		s.Tags = map[string]string{"status": fmt.Sprint(status)}
+		if code != "" {
+			s.Tags["error_code"] = code
+		}
+		reporter.CaptureMessage(fmt.Sprintf("%s %s: %d %s", c.Method(), s.Route, status, code), s)
+		return nil
+	}
+}
+
+// errorCode is the error field of a JSON error response
+func errorCode(body []byte) string {
+	var out struct {
+		Error interface{} `json:"error"`
+	}
+	if json.Unmarshal(body, &out) != nil {
+		return ""
+	}
+	if s, ok := out.Error.(string); ok {
+		return s
+	}
+	return ""
+}
+
+// scope is what an error report records of a request: its method, route
+// and URL without the query string, the user and organization by ID, and
+// its trace. Headers, bodies and user details are left out.
+func scope(c *fiber.Ctx, orgs OrgLookup) errreport.Scope {
+	s := errreport.Scope{
+		Request: &errreport.Request{Method: c.Method(), URL: c.BaseURL() + c.Path()},
+		Route:   c.Path(),
+		TraceID: GetTraceID(c),
+	}
+	if r := c.Route(); r != nil && r.Path != "" && r.Path != "/" {
+		s.Route = r.Path
+	}
+	if span, ok := c.Locals("span_id").(string); ok {
+		s.SpanID = span
+	}
+	if user, ok := c.Locals("user_id").(int64); ok && user != 0 {
+		s.UserID = user
+		if orgs != nil {
+			s.OrgID = orgs(user)
+		}
+	}
+	return s
+}
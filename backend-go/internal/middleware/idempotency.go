@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/idempotency"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Idempotency replays the first response to a POST, PUT or PATCH sent with
+// an Idempotency-Key header when the caller retries it. A key reused for a
+// different request is refused with 422, and one whose request is still
+// running with 409. Requests without the header are not affected. Keys are
+// scoped to the caller, the user or API key that caller names, so a retry
+// with a refreshed token still replays; requests without valid credentials
+// are scoped to their client IP. When the store cannot be reached, keyed
+// requests are refused rather than risk running twice.
+func Idempotency(store idempotency.Store, caller func(c *fiber.Ctx) string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(idempotency.Header)
+		if key == "" {
+			return c.Next()
+		}
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch:
+		default:
+			return c.Next()
+		}
+		if err := idempotency.ValidKey(key); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid_idempotency_key", "message": err.Error()})
+		}
+		ctx := context.Background()
+		storeKey := idempotency.StoreKey(callerScope(c, caller), key)
+		fingerprint := idempotency.Fingerprint(c.Method(), c.OriginalURL(), c.Body())
+		stored, claimed, err := store.Begin(ctx, storeKey)
+		if err != nil {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"error": "idempotency_unavailable"})
+		}
+		if stored != nil {
+			if stored.Fingerprint != fingerprint {
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "idempotency_key_reused"})
+			}
+			return replay(c, stored)
+		}
+		if !claimed {
+			c.Set(fiber.HeaderRetryAfter, "1")
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "idempotency_key_in_use"})
+		}
+
+		if err := c.Next(); err != nil {
+			_ = store.Release(ctx, storeKey)
+			return err
+		}
+		res := c.Response()
+		status := res.StatusCode()
+		if !idempotency.Cacheable(status) || res.IsBodyStream() {
+			_ = store.Release(ctx, storeKey)
+			return nil
+		}
+		resp := &idempotency.Response{
+			Fingerprint: fingerprint,
+			Status:      status,
+			ContentType: string(res.Header.ContentType()),
+			Location:    string(res.Header.Peek(fiber.HeaderLocation)),
+			Body:        append([]byte(nil), res.Body()...),
+		}
+		if err := store.Finish(ctx, storeKey, resp); err != nil {
+			// The request ran; a retry after the claim expires runs it again
+			_ = store.Release(ctx, storeKey)
+		}
+		return nil
+	}
+}
+
+func replay(c *fiber.Ctx, stored *idempotency.Response) error {
+	c.Set(idempotency.ReplayedHeader, "true")
+	if stored.ContentType != "" {
+		c.Set(fiber.HeaderContentType, stored.ContentType)
+	}
+	if stored.Location != "" {
+		c.Set(fiber.HeaderLocation, stored.Location)
+	}
+	return c.Status(stored.Status).Send(stored.Body)
+}
+
+// callerScope identifies who sent a request by the user or API key its
+// credentials resolve to, or by its client IP when they resolve to none
+func callerScope(c *fiber.Ctx, caller func(c *fiber.Ctx) string) string {
+	if id := caller(c); id != "" {
+		return "caller:" + id
+	}
+	return "ip:" + c.IP()
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/loadshed"
+	"github.com/gofiber/fiber/v2"
+)
+
+// LoadShed turns requests away with 503 and Retry-After when the service is
+// overloaded, lowest priority first, as classified by the request's method
+// and path. Critical requests are always admitted.
+func LoadShed(shedder *loadshed.Shedder, classifier *loadshed.Classifier) fiber.Handler {
+	retryAfter := int(math.Ceil(shedder.RetryAfter().Seconds()))
+	return func(c *fiber.Ctx) error {
+		rule := classifier.Classify(c.Method(), c.Path())
+		done, ok := shedder.Acquire(rule.Priority)
+		if !ok {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"error":       "overloaded",
+				"message":     "The service is busy; retry later",
+				"retry_after": retryAfter,
+				"trace_id":    GetTraceID(c),
+			})
+		}
+		defer done(!rule.Untimed)
+		return c.Next()
+	}
+}
@@ -12,8 +12,11 @@ import (
 // RequestLogger creates a middleware that logs all requests with correlation IDs
 func RequestLogger(logger *zap.Logger) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Generate or extract trace ID
-		traceID := c.Get("X-Trace-ID")
+		// Reuse the trace Trace resolved, else extract or generate one
+		traceID := GetTraceID(c)
+		if traceID == "" {
+			traceID = c.Get("X-Trace-ID")
+		}
 		if traceID == "" {
 			traceID = uuid.New().String()
 		}
@@ -4,15 +4,18 @@ import (
 	"strings"
 	"time"
 
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/errreport"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/idempotency"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/loadshed"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/fiber/v2/middleware/helmet"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/gofiber/fiber/v2/middleware/session"
 	redisstore "github.com/gofiber/storage/redis"
+	"go.uber.org/zap"
 )
 
 type Options struct {
@@ -21,13 +24,37 @@ type Options struct {
 	RateLimitRPS int
 	SessionKey   string
 	RedisURL     string
+	// Reporter receives panics and server errors; nil only logs them
+	Reporter *errreport.Reporter
+	Logger   *zap.Logger
+	// OrgLookup tags error reports with the user's organization
+	OrgLookup OrgLookup
+	// Shedder turns requests away under overload; nil admits everything
+	Shedder *loadshed.Shedder
+	// Idempotency keeps responses to requests sent with an
+	// Idempotency-Key header for replay; nil ignores the header
+	Idempotency idempotency.Store
+	// Caller names the user or API key a request's credentials resolve
+	// to, or "" when they resolve to none; idempotency keys are scoped to
+	// it, and the header is ignored without it
+	Caller func(c *fiber.Ctx) string
 }
 
 // Register common middlewares; mount before routes
 func Register(app *fiber.App, opts Options) error {
-	app.Use(recover.New())
+	app.Use(Trace())
+	// Shedding comes first so overload is not made worse by the work of
+	// the middlewares below, and shed requests are not reported as errors
+	if opts.Shedder != nil {
+		app.Use(LoadShed(opts.Shedder, loadshed.NewClassifier(nil)))
+	}
+	app.Use(Recover(opts.Reporter, opts.Logger, opts.OrgLookup))
+	app.Use(ReportErrors(opts.Reporter, opts.OrgLookup))
 	app.Use(requestid.New())
-	app.Use(logger.New())
+	// Access logs carry the trace so they correlate with error reports
+	app.Use(logger.New(logger.Config{
+		Format: "${time} | ${status} | ${latency} | ${ip} | ${method} | ${path} | trace_id=${locals:trace_id} span_id=${locals:span_id} | ${error}\n",
+	}))
 	app.Use(helmet.New())
 	app.Use(compress.New())
 
@@ -59,7 +86,8 @@ func Register(app *fiber.App, opts Options) error {
 		})
 	}
 
-	// Simple rate limiter per IP
+	// Simple rate limiter per IP, in front of every route; API requests
+	// are limited by subscription with TierRateLimit instead
 	if opts.RateLimitRPS > 0 {
 		app.Use(limiter.New(limiter.Config{
 			Max:          opts.RateLimitRPS,
@@ -68,6 +96,13 @@ func Register(app *fiber.App, opts Options) error {
 		}))
 	}
 
+	// Retried requests are answered from the store after the limiter per
+	// IP but before the subscription limits of the API, so replays never
+	// reach a handler nor spend a caller's quota
+	if opts.Idempotency != nil && opts.Caller != nil {
+		app.Use(Idempotency(opts.Idempotency, opts.Caller))
+	}
+
 	// Sessions backed by Redis
 	if opts.RedisURL != "" && opts.SessionKey != "" {
 		store := redisstore.New(redisstore.Config{
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// RateLimitWindow is the window the limits of TierRateLimit count over;
+// plan limits are requests per minute
+const RateLimitWindow = time.Minute
+
+// RateLimiter counts requests in a sliding window, as auth.RateLimiter
+// does in Redis
+type RateLimiter interface {
+	Allow(ctx context.Context, identifier string, limit int, window time.Duration) (auth.RateLimitResult, error)
+}
+
+type TierRateLimitConfig struct {
+	Limiter RateLimiter
+	// Identify returns the user whose credentials a request carries, or 0
+	// for requests without valid credentials
+	Identify func(c *fiber.Ctx) int64
+	// PlanLimit returns the requests per minute of the user's subscription
+	PlanLimit func(ctx context.Context, userID int64) (int, error)
+	// Count, when set, is called with the user of each request let
+	// through, to meter API usage
+	Count func(userID int64)
+	// AnonymousLimit bounds the requests per minute of a client IP sending
+	// no credentials; 0 leaves them unlimited
+	AnonymousLimit int
+	// DefaultLimit applies to users whose plan has no limit or could not
+	// be looked up
+	DefaultLimit int
+	// PlanTTL is how long a user's limit is kept before their subscription
+	// is read again; 0 is a minute
+	PlanTTL time.Duration
+	Logger  *zap.Logger
+}
+
+// TierRateLimit limits each user to the API rate of their subscription,
+// and requests without credentials per client IP. Every limited response
+// carries X-RateLimit-Limit, X-RateLimit-Remaining and X-RateLimit-Reset,
+// the Unix time a slot frees up; over the limit it answers 429 with
+// Retry-After. Requests pass unlimited while the limiter is unavailable.
+func TierRateLimit(cfg TierRateLimitConfig) fiber.Handler {
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+	if cfg.PlanTTL <= 0 {
+		cfg.PlanTTL = time.Minute
+	}
+	plans := &planLimits{cfg: cfg, entries: map[int64]planLimit{}}
+	return func(c *fiber.Ctx) error {
+		ctx := context.Background()
+		identifier, limit := "ip:"+c.IP(), cfg.AnonymousLimit
+		userID := cfg.Identify(c)
+		if userID != 0 {
+			identifier, limit = "user:"+strconv.FormatInt(userID, 10), plans.get(ctx, userID)
+		}
+		next := func() error {
+			if userID != 0 && cfg.Count != nil {
+				cfg.Count(userID)
+			}
+			return c.Next()
+		}
+		if limit <= 0 {
+			return next()
+		}
+		res, err := cfg.Limiter.Allow(ctx, identifier, limit, RateLimitWindow)
+		if err != nil {
+			cfg.Logger.Warn("rate limit check failed", zap.String("identifier", identifier), zap.Error(err))
+			return next()
+		}
+		c.Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Set("X-RateLimit-Reset", strconv.FormatInt(res.Reset.Unix(), 10))
+		if !res.Allowed {
+			retryAfter := max(int(math.Ceil(time.Until(res.Reset).Seconds())), 1)
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(retryAfter))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error":       "rate_limited",
+				"limit":       res.Limit,
+				"retry_after": retryAfter,
+			})
+		}
+		return next()
+	}
+}
+
+type planLimit struct {
+	limit   int
+	expires time.Time
+}
+
+// planLimits keeps users' plan limits for PlanTTL so limiting a request
+// does not read the subscription every time
+type planLimits struct {
+	cfg     TierRateLimitConfig
+	mu      sync.Mutex
+	entries map[int64]planLimit
+	swept   time.Time
+}
+
+func (p *planLimits) get(ctx context.Context, userID int64) int {
+	now := time.Now()
+	p.mu.Lock()
+	e, ok := p.entries[userID]
+	p.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.limit
+	}
+	limit, err := p.cfg.PlanLimit(ctx, userID)
+	if err != nil {
+		p.cfg.Logger.Warn("rate limit plan lookup failed", zap.Int64("user_id", userID), zap.Error(err))
+		return p.cfg.DefaultLimit
+	}
+	if limit <= 0 {
+		limit = p.cfg.DefaultLimit
+	}
+	p.mu.Lock()
+	// Entries of users who stopped calling are dropped once per TTL
+	if now.After(p.swept.Add(p.cfg.PlanTTL)) {
+		for id, e := range p.entries {
+			if now.After(e.expires) {
+				delete(p.entries, id)
+			}
+		}
+		p.swept = now
+	}
+	p.entries[userID] = planLimit{limit: limit, expires: now.Add(p.cfg.PlanTTL)}
+	p.mu.Unlock()
+	return limit
+}
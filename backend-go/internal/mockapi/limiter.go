@@ -0,0 +1,39 @@
+package mockapi
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter counts requests per key in fixed one-minute windows. Counts are
+// kept per instance, so behind several instances a mock can be called up to
+// its limit on each.
+type Limiter struct {
+	mu     sync.Mutex
+	window time.Time
+	counts map[string]int
+	now    func() time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{counts: map[string]int{}, now: time.Now}
+}
+
+// Allow counts a request for key and reports whether it is within limit
+// per minute, how many requests the window has left, and when it resets
+func (l *Limiter) Allow(key string, limit int) (ok bool, remaining int, reset time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	// Counts of the previous window are dropped as a whole
+	if window := now.Truncate(time.Minute); !window.Equal(l.window) {
+		l.window = window
+		clear(l.counts)
+	}
+	reset = l.window.Add(time.Minute).Sub(now)
+	if l.counts[key] >= limit {
+		return false, 0, reset
+	}
+	l.counts[key]++
+	return true, limit - l.counts[key], reset
+}
@@ -0,0 +1,266 @@
+// Package mockapi hosts mock REST endpoints backed by generated datasets,
+// so frontend teams can develop against realistic synthetic APIs. A mock
+// serves the rows of a completed generation job, typed by the job's
+// inferred schema, with filtering, sorting and pagination. Each mock has a
+// public ID that is its only credential, a per-minute request limit and an
+// expiry, all bounded by the owner's plan.
+package mockapi
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// MaxRecords caps the rows of a job a mock can serve, since they are held
+// in memory
+const MaxRecords = 50000
+
+var (
+	ErrNotFound     = errors.New("mock api not found")
+	ErrExpired      = errors.New("mock api expired")
+	ErrInvalidQuery = errors.New("invalid mock api query")
+	// ErrTooManyRecords is returned for jobs with more than MaxRecords rows
+	ErrTooManyRecords = errors.New("too many records for a mock api")
+)
+
+// loadTimeout bounds reading a mock's records
+const loadTimeout = 2 * time.Minute
+
+// Store finds mocks by their public ID
+type Store interface {
+	GetByPublicID(ctx context.Context, publicID string) (*models.MockAPI, error)
+}
+
+// Outputs reads the rows of a user's completed job
+type Outputs interface {
+	Rows(ctx context.Context, userID, jobID int64) ([]map[string]any, error)
+}
+
+// Config tunes the records kept in memory
+type Config struct {
+	// CacheSize caps the mocks whose records are kept
+	CacheSize int
+	// CacheTTL is how long records are served before they are read again
+	CacheTTL time.Duration
+}
+
+func DefaultConfig() Config {
+	return Config{CacheSize: 16, CacheTTL: 10 * time.Minute}
+}
+
+// Field is a column of a mock's records
+type Field struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Server answers requests to mocks
+type Server struct {
+	store   Store
+	outputs Outputs
+	limiter *Limiter
+	cfg     Config
+
+	mu    sync.Mutex
+	cache map[int64]*entry
+}
+
+// entry holds a mock's typed records once ready is closed
+type entry struct {
+	ready    chan struct{}
+	records  []map[string]any
+	schema   export.Schema
+	err      error
+	loadedAt time.Time
+}
+
+func NewServer(store Store, outputs Outputs, cfg Config) *Server {
+	def := DefaultConfig()
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = def.CacheSize
+	}
+	if cfg.CacheTTL <= 0 {
+		cfg.CacheTTL = def.CacheTTL
+	}
+	return &Server{store: store, outputs: outputs, limiter: NewLimiter(), cfg: cfg, cache: map[int64]*entry{}}
+}
+
+// Lookup returns the mock served at a public ID while it has not expired
+func (s *Server) Lookup(ctx context.Context, publicID string) (*models.MockAPI, error) {
+	m, err := s.store.GetByPublicID(ctx, publicID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Expired(time.Now()) {
+		s.Evict(m.ID)
+		return nil, ErrExpired
+	}
+	return m, nil
+}
+
+// Allow counts a request to m against its per-minute limit
+func (s *Server) Allow(m *models.MockAPI) (ok bool, remaining int, reset time.Duration) {
+	return s.limiter.Allow(m.PublicID, m.RequestsPerMinute)
+}
+
+// Records returns the page of m's records q selects and how many matched
+func (s *Server) Records(ctx context.Context, m *models.MockAPI, q Query) ([]map[string]any, int, error) {
+	e, err := s.load(ctx, m)
+	if err != nil {
+		return nil, 0, err
+	}
+	return Apply(e.records, e.schema, q)
+}
+
+// Schema returns the fields of m's records
+func (s *Server) Schema(ctx context.Context, m *models.MockAPI) ([]Field, error) {
+	e, err := s.load(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Field, len(e.schema))
+	for i, col := range e.schema {
+		out[i] = Field{Name: col.Name, Type: TypeName(col.Type)}
+	}
+	return out, nil
+}
+
+// Evict drops the records kept for a mock
+func (s *Server) Evict(id int64) {
+	s.mu.Lock()
+	delete(s.cache, id)
+	s.mu.Unlock()
+}
+
+// load returns m's records, reading them once for concurrent requests
+func (s *Server) load(ctx context.Context, m *models.MockAPI) (*entry, error) {
+	s.mu.Lock()
+	e, ok := s.cache[m.ID]
+	if ok {
+		select {
+		case <-e.ready:
+			if time.Since(e.loadedAt) >= s.cfg.CacheTTL {
+				ok = false
+			}
+		default:
+		}
+	}
+	if !ok {
+		if len(s.cache) >= s.cfg.CacheSize {
+			s.evictOldest()
+		}
+		e = &entry{ready: make(chan struct{})}
+		s.cache[m.ID] = e
+		go s.fill(context.WithoutCancel(ctx), m, e)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e, nil
+}
+
+// fill reads and types m's records into e; a failed read is not kept
+func (s *Server) fill(ctx context.Context, m *models.MockAPI, e *entry) {
+	defer close(e.ready)
+	ctx, cancel := context.WithTimeout(ctx, loadTimeout)
+	defer cancel()
+	rows, err := s.outputs.Rows(ctx, m.UserID, m.JobID)
+	if err == nil && len(rows) > MaxRecords {
+		err = fmt.Errorf("%w: %d rows", ErrTooManyRecords, len(rows))
+	}
+	if err == nil {
+		e.schema = export.InferSchema(rows)
+		e.records, err = typed(rows, e.schema)
+	}
+	e.loadedAt = time.Now()
+	if e.err = err; err != nil {
+		s.mu.Lock()
+		if s.cache[m.ID] == e {
+			delete(s.cache, m.ID)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// evictOldest drops the records read longest ago; callers hold mu
+func (s *Server) evictOldest() {
+	var oldest int64
+	var at time.Time
+	for id, e := range s.cache {
+		select {
+		case <-e.ready:
+		default:
+			continue
+		}
+		if at.IsZero() || e.loadedAt.Before(at) {
+			oldest, at = id, e.loadedAt
+		}
+	}
+	if !at.IsZero() {
+		delete(s.cache, oldest)
+	}
+}
+
+// typed converts each value to its column's type, which filters and
+// sorting compare by
+func typed(rows []map[string]any, schema export.Schema) ([]map[string]any, error) {
+	out := make([]map[string]any, len(rows))
+	for i, row := range rows {
+		rec := make(map[string]any, len(schema))
+		for _, col := range schema {
+			v, err := export.Value(col, row[col.Name])
+			if err != nil {
+				return nil, err
+			}
+			rec[col.Name] = v
+		}
+		out[i] = rec
+	}
+	return out, nil
+}
+
+// TypeName names a column type as mock schemas report it
+func TypeName(t export.Type) string {
+	switch t {
+	case export.TypeInt:
+		return "integer"
+	case export.TypeFloat:
+		return "number"
+	case export.TypeBool:
+		return "boolean"
+	}
+	return "string"
+}
+
+// NewPublicID returns a random public ID for a mock
+func NewPublicID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Path is where a mock's records are served, below /api/v1
+func Path(publicID string) string {
+	return "/mock/" + publicID + "/records"
+}
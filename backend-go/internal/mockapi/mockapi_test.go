@@ -0,0 +1,168 @@
+// Package mockapi_test provides unit tests for hosted mock APIs
+package mockapi_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/mockapi"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var records = []map[string]any{
+	{"id": int64(1), "name": "Ada Lovelace", "age": int64(36), "active": true},
+	{"id": int64(2), "name": "Alan Turing", "age": int64(41), "active": false},
+	{"id": int64(3), "name": "Grace Hopper", "age": nil, "active": true},
+	{"id": int64(4), "name": "Edsger Dijkstra", "age": int64(72), "active": true},
+}
+
+var schema = export.Schema{
+	{Name: "active", Type: export.TypeBool},
+	{Name: "age", Type: export.TypeInt},
+	{Name: "id", Type: export.TypeInt},
+	{Name: "name", Type: export.TypeString},
+}
+
+func ids(page []map[string]any) []int64 {
+	out := make([]int64, len(page))
+	for i, rec := range page {
+		out[i] = rec["id"].(int64)
+	}
+	return out
+}
+
+func TestApply(t *testing.T) {
+	cases := []struct {
+		name   string
+		params map[string]string
+		want   []int64
+		total  int
+	}{
+		{"first page", map[string]string{}, []int64{1, 2, 3, 4}, 4},
+		{"equality", map[string]string{"active": "true"}, []int64{1, 3, 4}, 3},
+		{"null", map[string]string{"age": "null"}, []int64{3}, 1},
+		{"range", map[string]string{"age_gte": "40", "age_lte": "72"}, []int64{2, 4}, 2},
+		{"not equal", map[string]string{"id_ne": "2"}, []int64{1, 3, 4}, 3},
+		{"like", map[string]string{"name_like": "LA"}, []int64{1, 2}, 2},
+		{"sorted descending with nulls last", map[string]string{"_sort": "age", "_order": "desc"}, []int64{4, 2, 1, 3}, 4},
+		{"second page", map[string]string{"_sort": "name", "_page": "2", "_limit": "2"}, []int64{4, 3}, 4},
+		{"past the end", map[string]string{"_page": "3", "_limit": "2"}, []int64{}, 4},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			q, err := mockapi.ParseQuery(tc.params)
+			require.NoError(t, err)
+			page, total, err := mockapi.Apply(records, schema, q)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, ids(page))
+			assert.Equal(t, tc.total, total)
+		})
+	}
+}
+
+func TestApplyRejectsInvalidQueries(t *testing.T) {
+	for name, params := range map[string]map[string]string{
+		"unknown field":     {"email": "a@example.com"},
+		"unknown operator":  {"age_gt": "3"},
+		"mistyped value":    {"age": "old"},
+		"unknown sort":      {"_sort": "email"},
+		"limit too large":   {"_limit": "1000"},
+		"invalid order":     {"_order": "up"},
+		"unknown parameter": {"_embed": "orders"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			q, err := mockapi.ParseQuery(params)
+			if err == nil {
+				_, _, err = mockapi.Apply(records, schema, q)
+			}
+			assert.ErrorIs(t, err, mockapi.ErrInvalidQuery)
+		})
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := mockapi.NewLimiter()
+	for i := 2; i >= 0; i-- {
+		ok, remaining, _ := l.Allow("a", 3)
+		require.True(t, ok)
+		assert.Equal(t, i, remaining)
+	}
+	ok, _, reset := l.Allow("a", 3)
+	assert.False(t, ok)
+	assert.LessOrEqual(t, reset, time.Minute)
+	ok, _, _ = l.Allow("b", 3)
+	assert.True(t, ok)
+}
+
+type store map[string]*models.MockAPI
+
+func (s store) GetByPublicID(ctx context.Context, publicID string) (*models.MockAPI, error) {
+	if m, ok := s[publicID]; ok {
+		return m, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+type outputs struct {
+	reads atomic.Int32
+	rows  []map[string]any
+}
+
+func (o *outputs) Rows(ctx context.Context, userID, jobID int64) ([]map[string]any, error) {
+	o.reads.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	return o.rows, nil
+}
+
+func TestServer(t *testing.T) {
+	live := &models.MockAPI{ID: 1, UserID: 7, JobID: 9, PublicID: "live", RequestsPerMinute: 10, ExpiresAt: time.Now().Add(time.Hour)}
+	expired := &models.MockAPI{ID: 2, PublicID: "expired", ExpiresAt: time.Now().Add(-time.Minute)}
+	out := &outputs{rows: []map[string]any{
+		{"id": json.Number("1"), "score": json.Number("0.5"), "city": "Lagos"},
+		{"id": json.Number("2"), "score": json.Number("2"), "city": nil},
+	}}
+	srv := mockapi.NewServer(store{"live": live, "expired": expired}, out, mockapi.DefaultConfig())
+	ctx := context.Background()
+
+	_, err := srv.Lookup(ctx, "missing")
+	assert.ErrorIs(t, err, mockapi.ErrNotFound)
+	_, err = srv.Lookup(ctx, "expired")
+	assert.ErrorIs(t, err, mockapi.ErrExpired)
+	m, err := srv.Lookup(ctx, "live")
+	require.NoError(t, err)
+
+	// Concurrent requests share one read of the output
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := srv.Records(ctx, m, mockapi.Query{Page: 1, Limit: 10})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), out.reads.Load())
+
+	page, total, err := srv.Records(ctx, m, mockapi.Query{Filters: []mockapi.Filter{{Field: "score_gte", Value: "1"}}, Page: 1, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []map[string]any{{"id": int64(2), "score": 2.0, "city": nil}}, page)
+
+	fields, err := srv.Schema(ctx, m)
+	require.NoError(t, err)
+	assert.Equal(t, []mockapi.Field{{Name: "city", Type: "string"}, {Name: "id", Type: "integer"}, {Name: "score", Type: "number"}}, fields)
+
+	srv.Evict(m.ID)
+	_, _, err = srv.Records(ctx, m, mockapi.Query{Page: 1, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), out.reads.Load())
+}
@@ -0,0 +1,224 @@
+package mockapi
+
+import (
+	"cmp"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+)
+
+// Page sizes
+const (
+	DefaultLimit = 25
+	MaxLimit     = 100
+)
+
+// Filter operators, written as a suffix of the field
+const (
+	OpEq   = ""
+	OpNe   = "_ne"
+	OpGte  = "_gte"
+	OpLte  = "_lte"
+	OpLike = "_like"
+)
+
+var operators = []string{OpNe, OpGte, OpLte, OpLike}
+
+// Filter keeps records whose field compares to Value under Op
+type Filter struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// Query selects a page of records. Its parameters follow json-server:
+// _page, _limit, _sort and _order, and field=value filters where the field
+// may carry an _ne, _gte, _lte or _like suffix.
+type Query struct {
+	Filters []Filter
+	Sort    string
+	Desc    bool
+	// Page counts from 1
+	Page  int
+	Limit int
+}
+
+// ParseQuery reads a query from request parameters
+func ParseQuery(params map[string]string) (Query, error) {
+	q := Query{Page: 1, Limit: DefaultLimit}
+	var err error
+	for name, value := range params {
+		switch name {
+		case "_page":
+			if q.Page, err = strconv.Atoi(value); err != nil || q.Page < 1 {
+				return q, fmt.Errorf("%w: _page must be a positive integer", ErrInvalidQuery)
+			}
+		case "_limit":
+			if q.Limit, err = strconv.Atoi(value); err != nil || q.Limit < 1 || q.Limit > MaxLimit {
+				return q, fmt.Errorf("%w: _limit must be between 1 and %d", ErrInvalidQuery, MaxLimit)
+			}
+		case "_sort":
+			q.Sort = value
+		case "_order":
+			if value != "asc" && value != "desc" {
+				return q, fmt.Errorf("%w: _order must be asc or desc", ErrInvalidQuery)
+			}
+			q.Desc = value == "desc"
+		default:
+			if strings.HasPrefix(name, "_") {
+				return q, fmt.Errorf("%w: unknown parameter %s", ErrInvalidQuery, name)
+			}
+			q.Filters = append(q.Filters, Filter{Field: name, Value: value})
+		}
+	}
+	// Filters apply in a stable order whatever the parameters' order
+	sort.Slice(q.Filters, func(i, j int) bool { return q.Filters[i].Field < q.Filters[j].Field })
+	return q, nil
+}
+
+// Apply filters and sorts records of schema and returns the page q selects
+// with the number of records that matched. A filter names a field of the
+// schema, or one followed by an operator suffix when no field has that
+// name; values are parsed as the field's type.
+func Apply(records []map[string]any, schema export.Schema, q Query) ([]map[string]any, int, error) {
+	columns := make(map[string]export.Column, len(schema))
+	for _, col := range schema {
+		columns[col.Name] = col
+	}
+	preds := make([]func(map[string]any) bool, 0, len(q.Filters))
+	for _, f := range q.Filters {
+		if _, ok := columns[f.Field]; !ok && f.Op == OpEq {
+			for _, op := range operators {
+				if field, ok := strings.CutSuffix(f.Field, op); ok {
+					f.Field, f.Op = field, op
+					break
+				}
+			}
+		}
+		col, ok := columns[f.Field]
+		if !ok {
+			return nil, 0, fmt.Errorf("%w: unknown field %s", ErrInvalidQuery, f.Field)
+		}
+		pred, err := predicate(col, f.Op, f.Value)
+		if err != nil {
+			return nil, 0, err
+		}
+		preds = append(preds, pred)
+	}
+
+	matched := make([]map[string]any, 0, len(records))
+	for _, rec := range records {
+		keep := true
+		for _, pred := range preds {
+			if keep = pred(rec); !keep {
+				break
+			}
+		}
+		if keep {
+			matched = append(matched, rec)
+		}
+	}
+	if q.Sort != "" {
+		if _, ok := columns[q.Sort]; !ok {
+			return nil, 0, fmt.Errorf("%w: unknown field %s", ErrInvalidQuery, q.Sort)
+		}
+		// Nulls sort last either way
+		sort.SliceStable(matched, func(i, j int) bool {
+			a, b := matched[i][q.Sort], matched[j][q.Sort]
+			if a == nil || b == nil {
+				return a != nil
+			}
+			if q.Desc {
+				return compare(b, a) < 0
+			}
+			return compare(a, b) < 0
+		})
+	}
+
+	from := (q.Page - 1) * q.Limit
+	if from >= len(matched) {
+		return []map[string]any{}, len(matched), nil
+	}
+	return matched[from:min(from+q.Limit, len(matched))], len(matched), nil
+}
+
+// predicate compares a field of col with value under op
+func predicate(col export.Column, op, value string) (func(map[string]any) bool, error) {
+	if op == OpLike {
+		needle := strings.ToLower(value)
+		return func(rec map[string]any) bool {
+			v, ok := rec[col.Name].(string)
+			return ok && strings.Contains(strings.ToLower(v), needle)
+		}, nil
+	}
+	var want any
+	if value != "null" {
+		var err error
+		if want, err = parse(col, value); err != nil {
+			return nil, err
+		}
+	}
+	return func(rec map[string]any) bool {
+		v := rec[col.Name]
+		if v == nil || want == nil {
+			equal := v == nil && want == nil
+			return (op == OpEq && equal) || (op == OpNe && !equal)
+		}
+		c := compare(v, want)
+		switch op {
+		case OpNe:
+			return c != 0
+		case OpGte:
+			return c >= 0
+		case OpLte:
+			return c <= 0
+		}
+		return c == 0
+	}, nil
+}
+
+// parse reads a filter value as col's type
+func parse(col export.Column, value string) (any, error) {
+	var out any
+	var err error
+	switch col.Type {
+	case export.TypeInt:
+		out, err = strconv.ParseInt(value, 10, 64)
+	case export.TypeFloat:
+		out, err = strconv.ParseFloat(value, 64)
+	case export.TypeBool:
+		out, err = strconv.ParseBool(value)
+	default:
+		out = value
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is not a valid %s", ErrInvalidQuery, col.Name, TypeName(col.Type))
+	}
+	return out, nil
+}
+
+// compare orders two non-null values of one column
+func compare(a, b any) int {
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			return cmp.Compare(x, y)
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			return cmp.Compare(x, y)
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			return cmp.Compare(strconv.FormatBool(x), strconv.FormatBool(y))
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
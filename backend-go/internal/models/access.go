@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// DatasetPermission is a permission granted on a dataset to a non-owner
+type DatasetPermission string
+
+const (
+	// DatasetPermRead allows viewing, previewing and downloading a dataset
+	DatasetPermRead DatasetPermission = "read"
+	// DatasetPermGenerate allows starting generation jobs from a dataset; implies read
+	DatasetPermGenerate DatasetPermission = "generate"
+)
+
+// GranteeType identifies who a dataset grant applies to
+type GranteeType string
+
+const (
+	GranteeUser  GranteeType = "user"
+	GranteeGroup GranteeType = "group"
+)
+
+// DatasetGrant gives a user or group a permission on a dataset
+type DatasetGrant struct {
+	ID          int64             `db:"id" json:"id"`
+	DatasetID   int64             `db:"dataset_id" json:"dataset_id"`
+	GranteeType GranteeType       `db:"grantee_type" json:"grantee_type"`
+	GranteeID   int64             `db:"grantee_id" json:"grantee_id"`
+	Permission  DatasetPermission `db:"permission" json:"permission"`
+	GrantedBy   int64             `db:"granted_by" json:"granted_by"`
+	CreatedAt   time.Time         `db:"created_at" json:"created_at"`
+}
+
+// UserGroup is a named set of users that dataset grants can target
+type UserGroup struct {
+	ID        int64     `db:"id" json:"id"`
+	OwnerID   int64     `db:"owner_id" json:"owner_id"`
+	Name      string    `db:"name" json:"name"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// ColumnExportAction decides what happens to a restricted column when a viewer
+// without clearance exports the dataset
+type ColumnExportAction string
+
+const (
+	// ColumnExportExclude drops the column from exports
+	ColumnExportExclude ColumnExportAction = "exclude"
+	// ColumnExportTokenize replaces values with stable keyed tokens so joins still work
+	ColumnExportTokenize ColumnExportAction = "tokenize"
+)
+
+// ColumnRestriction marks a dataset column as visible only to cleared viewers
+type ColumnRestriction struct {
+	ID           int64              `db:"id" json:"id"`
+	DatasetID    int64              `db:"dataset_id" json:"dataset_id"`
+	ColumnName   string             `db:"column_name" json:"column_name"`
+	ExportAction ColumnExportAction `db:"export_action" json:"export_action"`
+	CreatedBy    int64              `db:"created_by" json:"created_by"`
+	CreatedAt    time.Time          `db:"created_at" json:"created_at"`
+}
+
+// ColumnClearance lets a user or group see a restricted column unmasked
+type ColumnClearance struct {
+	ID          int64       `db:"id" json:"id"`
+	DatasetID   int64       `db:"dataset_id" json:"dataset_id"`
+	ColumnName  string      `db:"column_name" json:"column_name"`
+	GranteeType GranteeType `db:"grantee_type" json:"grantee_type"`
+	GranteeID   int64       `db:"grantee_id" json:"grantee_id"`
+	GrantedBy   int64       `db:"granted_by" json:"granted_by"`
+	CreatedAt   time.Time   `db:"created_at" json:"created_at"`
+}
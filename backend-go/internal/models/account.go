@@ -0,0 +1,94 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EmailChangeStatus is the state of a request to change an account's email
+type EmailChangeStatus string
+
+const (
+	// EmailChangePending waits for the new address to be verified
+	EmailChangePending EmailChangeStatus = "pending"
+	// EmailChangeHeld was verified and takes effect when its hold ends,
+	// unless the old address cancels it first
+	EmailChangeHeld      EmailChangeStatus = "held"
+	EmailChangeApplied   EmailChangeStatus = "applied"
+	EmailChangeCancelled EmailChangeStatus = "cancelled"
+)
+
+// EmailChange moves an account to a new email address. The new address
+// proves itself with a token sent to it; the old address is told and can
+// cancel the change during the security hold that follows.
+type EmailChange struct {
+	ID          int64             `db:"id" json:"id"`
+	UserID      int64             `db:"user_id" json:"user_id"`
+	OldEmail    string            `db:"old_email" json:"old_email"`
+	NewEmail    string            `db:"new_email" json:"new_email"`
+	Status      EmailChangeStatus `db:"status" json:"status"`
+	TokenHash   string            `db:"token_hash" json:"-"`
+	CancelHash  string            `db:"cancel_hash" json:"-"`
+	ExpiresAt   time.Time         `db:"expires_at" json:"expires_at"`
+	VerifiedAt  *time.Time        `db:"verified_at" json:"verified_at,omitempty"`
+	EffectiveAt *time.Time        `db:"effective_at" json:"effective_at,omitempty"`
+	AppliedAt   *time.Time        `db:"applied_at" json:"applied_at,omitempty"`
+	CancelledAt *time.Time        `db:"cancelled_at" json:"cancelled_at,omitempty"`
+	// CancelReason says why a change did not take effect
+	CancelReason *string   `db:"cancel_reason" json:"cancel_reason,omitempty"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
+
+// AccountMergeStatus is the state of a request to merge two accounts
+type AccountMergeStatus string
+
+const (
+	AccountMergePending   AccountMergeStatus = "pending"
+	AccountMergeCompleted AccountMergeStatus = "completed"
+)
+
+// AccountMerge folds a duplicate account, such as one created by signing in
+// with SSO under an address that already had a password account, into the
+// account that requested it. The duplicate proves ownership with a token
+// sent to its address; once merged it is deactivated.
+type AccountMerge struct {
+	ID           int64              `db:"id" json:"id"`
+	TargetUserID int64              `db:"target_user_id" json:"target_user_id"`
+	SourceUserID int64              `db:"source_user_id" json:"source_user_id"`
+	SourceEmail  string             `db:"source_email" json:"source_email"`
+	Status       AccountMergeStatus `db:"status" json:"status"`
+	TokenHash    string             `db:"token_hash" json:"-"`
+	ExpiresAt    time.Time          `db:"expires_at" json:"expires_at"`
+	// Transferred counts the rows moved to the target per table
+	Transferred AccountTransfers `db:"transferred" json:"transferred,omitempty"`
+	CompletedAt *time.Time       `db:"completed_at" json:"completed_at,omitempty"`
+	CreatedAt   time.Time        `db:"created_at" json:"created_at"`
+}
+
+// AccountTransfers counts what a merge moved from one account to another
+type AccountTransfers map[string]int64
+
+// Value stores the counts as a JSON object
+func (t AccountTransfers) Value() (driver.Value, error) {
+	b, err := json.Marshal(t)
+	return string(b), err
+}
+
+// Scan reads counts stored as a JSON object
+func (t *AccountTransfers) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported account transfers type %T", src)
+	}
+	return json.Unmarshal(raw, t)
+}
@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // UserUsage tracks user's monthly usage for billing and limits
@@ -31,6 +33,7 @@ type UserSubscription struct {
 	CurrentPeriodStart time.Time          `db:"current_period_start" json:"current_period_start"`
 	CurrentPeriodEnd   time.Time          `db:"current_period_end" json:"current_period_end"`
 	CancelAtPeriodEnd  bool               `db:"cancel_at_period_end" json:"cancel_at_period_end"`
+	MonthlyAmount      float64            `db:"monthly_amount" json:"monthly_amount"` // 0 means the tier's list price
 	CreatedAt          time.Time          `db:"created_at" json:"created_at"`
 	UpdatedAt          time.Time          `db:"updated_at" json:"updated_at"`
 }
@@ -55,17 +58,36 @@ type APIKey struct {
 	IsActive  bool       `db:"is_active" json:"is_active"`
 	CreatedAt time.Time  `db:"created_at" json:"created_at"`
 	ExpiresAt *time.Time `db:"expires_at" json:"expires_at"`
+	// Scopes limits the key to part of its owner's permissions; empty
+	// means all of them
+	Scopes pq.StringArray `db:"scopes" json:"scopes"`
+	// An auto-rotating key falls due RotationDays after it was issued. Once
+	// rotated, or once rotation is enforced at the due date, it stays valid
+	// next to its successor for OverlapHours so clients can switch over.
+	RotationDays       *int       `db:"rotation_days" json:"rotation_days,omitempty"`
+	OverlapHours       int        `db:"overlap_hours" json:"overlap_hours"`
+	RotationDueAt      *time.Time `db:"rotation_due_at" json:"rotation_due_at,omitempty"`
+	RotationRemindedAt *time.Time `db:"rotation_reminded_at" json:"-"`
+	RotationEnforcedAt *time.Time `db:"rotation_enforced_at" json:"rotation_enforced_at,omitempty"`
+	RotatedFrom        *int64     `db:"rotated_from" json:"rotated_from,omitempty"`
+	RotatedTo          *int64     `db:"rotated_to" json:"rotated_to,omitempty"`
+	RotatedAt          *time.Time `db:"rotated_at" json:"rotated_at,omitempty"`
+	// AcknowledgedAt is when the owner confirmed clients use the successor,
+	// which ends the overlap early
+	AcknowledgedAt *time.Time `db:"rotation_acknowledged_at" json:"rotation_acknowledged_at,omitempty"`
 }
 
 // AuditLog tracks user actions for security and compliance
 type AuditLog struct {
-	ID         int64     `db:"id" json:"id"`
-	UserID     *int64    `db:"user_id" json:"user_id"` // Nullable for anonymous actions
-	Action     string    `db:"action" json:"action"`
-	Resource   string    `db:"resource" json:"resource"`
-	ResourceID *string   `db:"resource_id" json:"resource_id"`
-	IPAddress  string    `db:"ip_address" json:"ip_address"`
-	UserAgent  string    `db:"user_agent" json:"user_agent"`
-	Metadata   string    `db:"metadata" json:"metadata"` // JSON string
-	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	ID           int64      `db:"id" json:"id"`
+	UserID       *int64     `db:"user_id" json:"user_id"` // Nullable for anonymous actions
+	OrgID        *int64     `db:"org_id" json:"org_id,omitempty"`
+	Action       string     `db:"action" json:"action"`
+	Resource     string     `db:"resource" json:"resource"`
+	ResourceID   *string    `db:"resource_id" json:"resource_id"`
+	IPAddress    string     `db:"ip_address" json:"ip_address"`
+	UserAgent    string     `db:"user_agent" json:"user_agent"`
+	Metadata     string     `db:"metadata" json:"metadata"` // JSON string
+	AnonymizedAt *time.Time `db:"anonymized_at" json:"anonymized_at,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
 }
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// EventProperties are the free-form properties of an analytics event
+type EventProperties map[string]interface{}
+
+// Value stores properties as a JSON object
+func (p EventProperties) Value() (driver.Value, error) {
+	if p == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(p)
+	return string(b), err
+}
+
+// Scan reads properties stored as a JSON object
+func (p *EventProperties) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*p = EventProperties{}
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported event properties type %T", src)
+	}
+	return json.Unmarshal(raw, p)
+}
+
+// AnalyticsEvent is a tracked product event
+type AnalyticsEvent struct {
+	ID         string          `db:"id" json:"id"`
+	UserID     string          `db:"user_id" json:"user_id"`
+	OrgID      int64           `db:"org_id" json:"org_id,omitempty"`
+	Event      string          `db:"event" json:"event"`
+	Category   string          `db:"category" json:"category"`
+	Properties EventProperties `db:"properties" json:"properties"`
+	Timestamp  time.Time       `db:"occurred_at" json:"timestamp"`
+	SessionID  string          `db:"session_id" json:"session_id,omitempty"`
+	IPAddress  string          `db:"ip_address" json:"ip_address,omitempty"`
+	UserAgent  string          `db:"user_agent" json:"user_agent,omitempty"`
+}
+
+// AnalyticsEventFilter selects stored events; empty fields match anything
+type AnalyticsEventFilter struct {
+	UserID    string
+	Event     string
+	Category  string
+	StartTime *time.Time
+	EndTime   *time.Time
+	Limit     int
+	Offset    int
+}
+
+// AnalyticsBucket counts the events of one name within one time bucket
+type AnalyticsBucket struct {
+	Bucket time.Time `db:"bucket" json:"bucket"`
+	Event  string    `db:"event" json:"event"`
+	Events int64     `db:"events" json:"events"`
+	Users  int64     `db:"users" json:"users"`
+}
+
+// AnalyticsStats summarizes the stored events
+type AnalyticsStats struct {
+	Events int64      `db:"events" json:"events"`
+	Oldest *time.Time `db:"oldest" json:"oldest,omitempty"`
+	Newest *time.Time `db:"newest" json:"newest,omitempty"`
+}
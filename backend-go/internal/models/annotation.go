@@ -0,0 +1,116 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ColumnAnnotation is an owner's edit to the derived schema of a dataset
+// column. Generation prompts, output validation and exports honour it.
+type ColumnAnnotation struct {
+	ID         int64  `db:"id" json:"id"`
+	DatasetID  int64  `db:"dataset_id" json:"dataset_id"`
+	ColumnName string `db:"column_name" json:"column_name"`
+	// Unique requires distinct values in generated rows
+	Unique bool `db:"is_unique" json:"unique"`
+	// MinValue and MaxValue bound a numeric column, inclusive
+	MinValue    *float64 `db:"min_value" json:"min_value,omitempty"`
+	MaxValue    *float64 `db:"max_value" json:"max_value,omitempty"`
+	Description *string  `db:"description" json:"description,omitempty"`
+	// Sensitive columns are masked in grounding samples and hidden from
+	// viewers without clearance, as if restricted with tokenized exports
+	Sensitive bool      `db:"sensitive" json:"sensitive"`
+	Version   int       `db:"version" json:"version"`
+	UpdatedBy int64     `db:"updated_by" json:"updated_by"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// ColumnAnnotationVersion is one entry in the history of a column's
+// annotation; Deleted marks the version that removed it
+type ColumnAnnotationVersion struct {
+	ID          int64     `db:"id" json:"id"`
+	DatasetID   int64     `db:"dataset_id" json:"dataset_id"`
+	ColumnName  string    `db:"column_name" json:"column_name"`
+	Version     int       `db:"version" json:"version"`
+	Unique      bool      `db:"is_unique" json:"unique"`
+	MinValue    *float64  `db:"min_value" json:"min_value,omitempty"`
+	MaxValue    *float64  `db:"max_value" json:"max_value,omitempty"`
+	Description *string   `db:"description" json:"description,omitempty"`
+	Sensitive   bool      `db:"sensitive" json:"sensitive"`
+	Deleted     bool      `db:"deleted" json:"deleted"`
+	ChangedBy   int64     `db:"changed_by" json:"changed_by"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// RelationshipHintStatus tracks a user's decision on a discovered relationship
+type RelationshipHintStatus string
+
+const (
+	RelationshipSuggested RelationshipHintStatus = "suggested"
+	RelationshipAccepted  RelationshipHintStatus = "accepted"
+	RelationshipRejected  RelationshipHintStatus = "rejected"
+)
+
+// RelationshipHint is a relationship discovered between two dataset
+// columns. Accepted hints are preserved by generation and verified on its
+// output.
+type RelationshipHint struct {
+	ID           int64                  `db:"id" json:"id"`
+	DatasetID    int64                  `db:"dataset_id" json:"dataset_id"`
+	Kind         string                 `db:"kind" json:"kind"`
+	SourceColumn string                 `db:"source_column" json:"source_column"`
+	TargetColumn string                 `db:"target_column" json:"target_column"`
+	Strength     float64                `db:"strength" json:"strength"`
+	Status       RelationshipHintStatus `db:"status" json:"status"`
+	DecidedBy    *int64                 `db:"decided_by" json:"decided_by,omitempty"`
+	DecidedAt    *time.Time             `db:"decided_at" json:"decided_at,omitempty"`
+	CreatedAt    time.Time              `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time              `db:"updated_at" json:"updated_at"`
+}
+
+// TaxonomyPaths are the allowed value paths of a hierarchy, each from the
+// top level down
+type TaxonomyPaths [][]string
+
+// Value stores paths as a JSON array, or NULL when there are none
+func (p TaxonomyPaths) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(p)
+	return string(b), err
+}
+
+// Scan reads paths stored as a JSON array
+func (p *TaxonomyPaths) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported taxonomy paths type %T", src)
+	}
+	return json.Unmarshal(raw, p)
+}
+
+// ColumnHierarchy declares categorical columns of a dataset as the levels
+// of one hierarchy, top level first. Generated values follow the Taxonomy
+// when one is given and the paths observed in the source otherwise.
+type ColumnHierarchy struct {
+	ID        int64          `db:"id" json:"id"`
+	DatasetID int64          `db:"dataset_id" json:"dataset_id"`
+	Levels    pq.StringArray `db:"levels" json:"levels"`
+	Taxonomy  TaxonomyPaths  `db:"taxonomy" json:"taxonomy,omitempty"`
+	CreatedBy int64          `db:"created_by" json:"created_by"`
+	CreatedAt time.Time      `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// OrgBranding is how an organization on a white-label plan presents the
+// platform: the name and logos shown in email, the address it is sent from
+// and the hostname its links and API are served on. The hostname and the
+// from-address only take effect once the hostname is verified.
+type OrgBranding struct {
+	OrgID              int64      `db:"org_id" json:"org_id"`
+	DisplayName        *string    `db:"display_name" json:"display_name,omitempty"`
+	LogoURL            *string    `db:"logo_url" json:"logo_url,omitempty"`
+	LogoDarkURL        *string    `db:"logo_dark_url" json:"logo_dark_url,omitempty"`
+	EmailFromAddress   *string    `db:"email_from_address" json:"email_from_address,omitempty"`
+	APIHostname        *string    `db:"api_hostname" json:"api_hostname,omitempty"`
+	HostnameToken      *string    `db:"hostname_token" json:"-"`
+	HostnameVerifiedAt *time.Time `db:"hostname_verified_at" json:"hostname_verified_at,omitempty"`
+	UpdatedBy          *int64     `db:"updated_by" json:"updated_by,omitempty"`
+	CreatedAt          time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt          time.Time  `db:"updated_at" json:"updated_at"`
+}
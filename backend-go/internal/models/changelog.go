@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ChangelogEntry is a release note for customers. It is a draft until it is
+// published; published entries are listed to everyone and announced once, in
+// the app, to users of the feature areas they are tagged with.
+type ChangelogEntry struct {
+	ID      int64  `db:"id" json:"id"`
+	Version string `db:"version" json:"version"`
+	Title   string `db:"title" json:"title"`
+	Body    string `db:"body" json:"body"`
+	// Features are the feature areas the entry is about, such as generation
+	// or billing
+	Features    pq.StringArray `db:"features" json:"features"`
+	PublishedAt *time.Time     `db:"published_at" json:"published_at,omitempty"`
+	AnnouncedAt *time.Time     `db:"announced_at" json:"announced_at,omitempty"`
+	// Notified is how many users the announcement went to
+	Notified  int       `db:"notified" json:"notified"`
+	CreatedBy int64     `db:"created_by" json:"created_by"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
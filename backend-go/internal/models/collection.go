@@ -0,0 +1,67 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DatasetFilter is a saved search over the dataset catalog. Empty fields do
+// not filter; the rest must all match.
+type DatasetFilter struct {
+	// Query matches the name or description, ignoring case
+	Query     string          `json:"query,omitempty"`
+	Statuses  []DatasetStatus `json:"statuses,omitempty"`
+	FileTypes []string        `json:"file_types,omitempty"`
+	// PrivacyCategories matches datasets with a column protected as one of
+	// them, such as health for HIPAA data
+	PrivacyCategories []PrivacyCategory `json:"privacy_categories,omitempty"`
+	ZeroRealData      *bool             `json:"zero_real_data,omitempty"`
+	// UpdatedPeriod matches datasets updated in the current day, week,
+	// month, quarter or year; UpdatedWithinDays in the last so many days
+	UpdatedPeriod     string `json:"updated_period,omitempty"`
+	UpdatedWithinDays int    `json:"updated_within_days,omitempty"`
+	MinRows           int64  `json:"min_rows,omitempty"`
+}
+
+// Value stores a filter as a JSON object
+func (f DatasetFilter) Value() (driver.Value, error) {
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+// Scan reads a filter stored as a JSON object
+func (f *DatasetFilter) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*f = DatasetFilter{}
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported dataset filter type %T", src)
+	}
+	return json.Unmarshal(raw, f)
+}
+
+// DatasetCollection is a named saved search, evaluated against the catalog
+// each time it is listed. A shared collection is visible to the members of
+// its owner's organization, who see the datasets it matches among those
+// they can read.
+type DatasetCollection struct {
+	ID          int64         `db:"id" json:"id"`
+	OwnerID     int64         `db:"owner_id" json:"owner_id"`
+	OrgID       *int64        `db:"org_id" json:"org_id,omitempty"`
+	Name        string        `db:"name" json:"name"`
+	Description *string       `db:"description" json:"description,omitempty"`
+	Filter      DatasetFilter `db:"filter" json:"filter"`
+	CreatedAt   time.Time     `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time     `db:"updated_at" json:"updated_at"`
+	// DatasetCount is how many datasets the collection matches for the
+	// caller when it is listed
+	DatasetCount *int64 `db:"-" json:"dataset_count,omitempty"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// ConsentKind is what a consent record is about: a legal document the user
+// accepted, or a kind of email they opted in to or out of
+type ConsentKind string
+
+const (
+	ConsentTerms         ConsentKind = "terms"
+	ConsentPrivacyPolicy ConsentKind = "privacy_policy"
+	// ConsentMarketingEmails covers promotional email
+	ConsentMarketingEmails ConsentKind = "marketing_emails"
+	// ConsentProductUpdates covers announcements of product changes
+	ConsentProductUpdates ConsentKind = "product_updates"
+)
+
+// ConsentRecord is one acceptance of a document version, or one change of
+// an email consent flag. Records are never updated, so the latest record of
+// each kind is the user's current state and the rest is its history.
+type ConsentRecord struct {
+	ID     int64       `db:"id" json:"id"`
+	UserID int64       `db:"user_id" json:"user_id"`
+	Kind   ConsentKind `db:"kind" json:"kind"`
+	// Version of the accepted document; empty for email flags
+	Version   string    `db:"version" json:"version,omitempty"`
+	Granted   bool      `db:"granted" json:"granted"`
+	IPAddress string    `db:"ip_address" json:"ip_address"`
+	UserAgent string    `db:"user_agent" json:"user_agent"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
@@ -30,6 +30,7 @@ const (
 type CustomModel struct {
 	ID                   int64             `db:"id" json:"id"`
 	OwnerID              int64             `db:"owner_id" json:"owner_id"`
+	OrgID                *int64            `db:"org_id" json:"org_id,omitempty"`
 	Name                 string            `db:"name" json:"name"`
 	Description          *string           `db:"description" json:"description,omitempty"`
 	ModelType            CustomModelType   `db:"model_type" json:"model_type"`
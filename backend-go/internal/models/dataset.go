@@ -14,6 +14,7 @@ const (
 type Dataset struct {
 	ID           int64         `db:"id" json:"id"`
 	OwnerID      int64         `db:"owner_id" json:"owner_id"`
+	OrgID        *int64        `db:"org_id" json:"org_id,omitempty"`
 	Name         string        `db:"name" json:"name"`
 	Description  *string       `db:"description" json:"description,omitempty"`
 	Status       DatasetStatus `db:"status" json:"status"`
@@ -23,6 +24,8 @@ type Dataset struct {
 	ObjectKey    *string       `db:"object_key" json:"object_key,omitempty"`
 	RowCount     int64         `db:"row_count" json:"row_count"`
 	ColumnCount  int64         `db:"column_count" json:"column_count"`
-	CreatedAt    time.Time     `db:"created_at" json:"created_at"`
-	UpdatedAt    time.Time     `db:"updated_at" json:"updated_at"`
+	// RetentionDays is how long the dataset is kept; nil keeps it until deleted
+	RetentionDays *int      `db:"retention_days" json:"retention_days,omitempty"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at" json:"updated_at"`
 }
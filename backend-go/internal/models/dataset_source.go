@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DatasetSourceSettings locate a source database. They are not secret.
+type DatasetSourceSettings struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Database string `json:"database"`
+	User     string `json:"user"`
+	// TLS is verify-full, checking the server certificate against the
+	// system roots, or require, which only encrypts
+	TLS string `json:"tls,omitempty"`
+}
+
+// Value stores settings as a JSON object
+func (s DatasetSourceSettings) Value() (driver.Value, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+// Scan reads settings stored as a JSON object
+func (s *DatasetSourceSettings) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*s = DatasetSourceSettings{}
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported dataset source settings type %T", src)
+	}
+	return json.Unmarshal(raw, s)
+}
+
+// DatasetSource is a read-only connection to a user's PostgreSQL or MySQL
+// database that datasets are sampled from instead of uploaded. Its
+// credentials are sealed with a data key wrapped by the KMS key KeyID and
+// are never returned.
+type DatasetSource struct {
+	ID            int64                 `db:"id" json:"id"`
+	UserID        int64                 `db:"user_id" json:"user_id"`
+	Name          string                `db:"name" json:"name"`
+	Kind          string                `db:"kind" json:"kind"`
+	Settings      DatasetSourceSettings `db:"settings" json:"settings"`
+	Credentials   string                `db:"credentials" json:"-"`
+	WrappedKey    string                `db:"wrapped_key" json:"-"`
+	KeyID         string                `db:"key_id" json:"-"`
+	LastTestedAt  *time.Time            `db:"last_tested_at" json:"last_tested_at,omitempty"`
+	LastTestError *string               `db:"last_test_error" json:"last_test_error,omitempty"`
+	CreatedAt     time.Time             `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time             `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// RetentionReceipt records one run of a retention task, such as archiving
+// expired datasets, as evidence that retention policies are enforced
+type RetentionReceipt struct {
+	ID         int64     `db:"id" json:"id"`
+	Task       string    `db:"task" json:"task"`
+	StartedAt  time.Time `db:"started_at" json:"started_at"`
+	FinishedAt time.Time `db:"finished_at" json:"finished_at"`
+	Affected   int64     `db:"affected" json:"affected"`
+	Error      *string   `db:"error" json:"error,omitempty"`
+}
+
+// Retention tasks that leave receipts
+const (
+	RetentionDatasetArchive     = "dataset_archive"
+	RetentionAuditAnonymization = "audit_log_anonymization"
+	RetentionAnalyticsDeletion  = "analytics_deletion"
+	RetentionStaleCleanup       = "stale_resource_cleanup"
+)
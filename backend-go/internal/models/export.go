@@ -0,0 +1,193 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// FixedWidthField is one field of a fixed-width layout. Align is left or
+// right and Pad a single character; Decimals fixes the digits after the
+// point of numeric values.
+type FixedWidthField struct {
+	Column   string `json:"column"`
+	Width    int    `json:"width"`
+	Align    string `json:"align,omitempty"`
+	Pad      string `json:"pad,omitempty"`
+	Decimals *int   `json:"decimals,omitempty"`
+}
+
+// FixedWidthFields are the fields of a layout in record order
+type FixedWidthFields []FixedWidthField
+
+// Value stores fields as a JSON array
+func (f FixedWidthFields) Value() (driver.Value, error) {
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+// Scan reads fields stored as a JSON array
+func (f *FixedWidthFields) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported fixed-width fields type %T", src)
+	}
+	return json.Unmarshal(raw, f)
+}
+
+// FixedWidthLayout is the record layout a dataset's generated rows are
+// exported with in the fixed-width format. Columns without a field are not
+// written.
+type FixedWidthLayout struct {
+	DatasetID int64            `db:"dataset_id" json:"dataset_id"`
+	Fields    FixedWidthFields `db:"fields" json:"fields"`
+	// Encoding is ascii, latin1, utf8 or one of the EBCDIC code pages
+	Encoding string `db:"encoding" json:"encoding"`
+	// RecordTerminator is lf, crlf or none for unbroken fixed-length records
+	RecordTerminator string `db:"record_terminator" json:"record_terminator"`
+	// Overflow is reject, dropping rows with a value too wide for its field,
+	// or truncate
+	Overflow  string    `db:"overflow" json:"overflow"`
+	UpdatedBy int64     `db:"updated_by" json:"updated_by"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// FHIRField maps a column to an element of a FHIR resource: Path is the
+// element of Resource the column's values are written to. Columns mapped to
+// an Observation value carry the code of the observation, in System
+// (LOINC by default), and the UCUM unit of numeric values.
+type FHIRField struct {
+	Column   string `json:"column"`
+	Resource string `json:"resource"`
+	Path     string `json:"path"`
+	Code     string `json:"code,omitempty"`
+	System   string `json:"system,omitempty"`
+	Display  string `json:"display,omitempty"`
+	Unit     string `json:"unit,omitempty"`
+}
+
+// FHIRFields are the fields of a FHIR mapping
+type FHIRFields []FHIRField
+
+// Value stores fields as a JSON array
+func (f FHIRFields) Value() (driver.Value, error) {
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+// Scan reads fields stored as a JSON array
+func (f *FHIRFields) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*f = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported fhir fields type %T", src)
+	}
+	return json.Unmarshal(raw, f)
+}
+
+// FHIRMapping is how a dataset's generated rows are exported as FHIR R4
+// resources. Columns without a field are not written.
+type FHIRMapping struct {
+	DatasetID int64      `db:"dataset_id" json:"dataset_id"`
+	Fields    FHIRFields `db:"fields" json:"fields"`
+	UpdatedBy int64      `db:"updated_by" json:"updated_by"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// FinancialMessageColumns name the column holding each part of a
+// transaction, keyed by role: amount, currency, debtor_iban and so on
+type FinancialMessageColumns map[string]string
+
+// Value stores columns as a JSON object
+func (c FinancialMessageColumns) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+// Scan reads columns stored as a JSON object
+func (c *FinancialMessageColumns) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported financial message columns type %T", src)
+	}
+	return json.Unmarshal(raw, c)
+}
+
+// FinancialMessageEnvelope is the metadata of a dataset's payment messages.
+// MessageIDPrefix starts every message identifier; InitiatingParty names
+// the party sending a pain.001, and SenderBIC and ReceiverBIC address MT103
+// messages. AccountIBAN, AccountCurrency and OpeningBalance describe the
+// account a camt.053 statement reports on. ChargeBearer is an ISO 20022
+// code, SLEV by default.
+type FinancialMessageEnvelope struct {
+	MessageIDPrefix string  `json:"message_id_prefix,omitempty"`
+	InitiatingParty string  `json:"initiating_party,omitempty"`
+	SenderBIC       string  `json:"sender_bic,omitempty"`
+	ReceiverBIC     string  `json:"receiver_bic,omitempty"`
+	AccountIBAN     string  `json:"account_iban,omitempty"`
+	AccountCurrency string  `json:"account_currency,omitempty"`
+	OpeningBalance  float64 `json:"opening_balance,omitempty"`
+	ChargeBearer    string  `json:"charge_bearer,omitempty"`
+}
+
+// Value stores an envelope as a JSON object
+func (e FinancialMessageEnvelope) Value() (driver.Value, error) {
+	b, err := json.Marshal(e)
+	return string(b), err
+}
+
+// Scan reads an envelope stored as a JSON object
+func (e *FinancialMessageEnvelope) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*e = FinancialMessageEnvelope{}
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported financial message envelope type %T", src)
+	}
+	return json.Unmarshal(raw, e)
+}
+
+// FinancialMessageLayout is how a dataset's generated transaction rows are
+// rendered as payment messages in the financial_message format
+type FinancialMessageLayout struct {
+	DatasetID int64 `db:"dataset_id" json:"dataset_id"`
+	// MessageType is pain.001.001.09, camt.053.001.08 or mt103
+	MessageType string                   `db:"message_type" json:"message_type"`
+	Columns     FinancialMessageColumns  `db:"columns" json:"columns"`
+	Envelope    FinancialMessageEnvelope `db:"envelope" json:"envelope"`
+	UpdatedBy   int64                    `db:"updated_by" json:"updated_by"`
+	CreatedAt   time.Time                `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time                `db:"updated_at" json:"updated_at"`
+}
@@ -1,28 +1,556 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+	"github.com/lib/pq"
+)
 
 type GenerationStatus string
 
 const (
 	GenPending   GenerationStatus = "pending"
+	GenQueued    GenerationStatus = "queued"
 	GenRunning   GenerationStatus = "running"
 	GenCompleted GenerationStatus = "completed"
 	GenFailed    GenerationStatus = "failed"
 	GenCancelled GenerationStatus = "cancelled"
+	// GenPaused jobs keep their request and quota until they are resumed
+	GenPaused GenerationStatus = "paused"
 )
 
 type GenerationJob struct {
-	ID             int64            `db:"id" json:"id"`
-	DatasetID      int64            `db:"dataset_id" json:"dataset_id"`
-	UserID         int64            `db:"user_id" json:"user_id"`
-	RowsRequested  int64            `db:"rows_requested" json:"rows_requested"`
-	Status         GenerationStatus `db:"status" json:"status"`
-	OutputKey      *string          `db:"output_key" json:"output_key,omitempty"`
-	OutputFormat   *string          `db:"output_format" json:"output_format,omitempty"`
-	RowsGenerated  int64            `db:"rows_generated" json:"rows_generated"`
-	ProcessingTime float64          `db:"processing_time" json:"processing_time"`
-	CreatedAt      time.Time        `db:"created_at" json:"created_at"`
-	StartedAt      *time.Time       `db:"started_at" json:"started_at,omitempty"`
-	CompletedAt    *time.Time       `db:"completed_at" json:"completed_at,omitempty"`
+	ID             int64          `db:"id" json:"id"`
+	DatasetID      int64          `db:"dataset_id" json:"dataset_id"`
+	UserID         int64          `db:"user_id" json:"user_id"`
+	OrgID          *int64         `db:"org_id" json:"org_id,omitempty"`
+	RowsRequested  int64          `db:"rows_requested" json:"rows_requested"`
+	Prompt         *string        `db:"prompt" json:"prompt,omitempty"`
+	MaskedColumns  pq.StringArray `db:"masked_columns" json:"masked_columns,omitempty"`
+	DataMode       DataMode       `db:"data_mode" json:"data_mode"`
+	DataModeSource DataModeSource `db:"data_mode_source" json:"data_mode_source"`
+	// PrivacyLevel and RequestedProvider are what the job was created with,
+	// after organization defaults were applied
+	PrivacyLevel      *string          `db:"privacy_level" json:"privacy_level,omitempty"`
+	RequestedProvider *string          `db:"requested_provider" json:"requested_provider,omitempty"`
+	Status            GenerationStatus `db:"status" json:"status"`
+	OutputKey         *string          `db:"output_key" json:"output_key,omitempty"`
+	OutputFormat      *string          `db:"output_format" json:"output_format,omitempty"`
+	RowsGenerated     int64            `db:"rows_generated" json:"rows_generated"`
+	ProcessingTime    float64          `db:"processing_time" json:"processing_time"`
+	Progress          float64          `db:"progress" json:"progress"`
+	Attempts          int              `db:"attempts" json:"attempts"`
+	LastError         *string          `db:"last_error" json:"last_error,omitempty"`
+	Provider          *string          `db:"provider" json:"provider,omitempty"`
+	Model             *string          `db:"model" json:"model,omitempty"`
+	TokensUsed        int64            `db:"tokens_used" json:"tokens_used"`
+	CostUSD           float64          `db:"cost_usd" json:"cost_usd"`
+	QualityScore      *float64         `db:"quality_score" json:"quality_score,omitempty"`
+	QualityDetails    *QualityDetails  `db:"quality_details" json:"quality_details,omitempty"`
+	CreatedAt         time.Time        `db:"created_at" json:"created_at"`
+	StartedAt         *time.Time       `db:"started_at" json:"started_at,omitempty"`
+	CompletedAt       *time.Time       `db:"completed_at" json:"completed_at,omitempty"`
+}
+
+// QualityDetails holds the per-column quality reports of a completed job
+type QualityDetails struct {
+	RareEvents    []RareEventReport       `json:"rare_events,omitempty"`
+	Distributions []DistributionReport    `json:"distributions,omitempty"`
+	Hierarchies   []HierarchyReport       `json:"hierarchies,omitempty"`
+	NestedColumns []NestedColumnReport    `json:"nested_columns,omitempty"`
+	ArrayColumns  []ArrayColumnReport     `json:"array_columns,omitempty"`
+	Vocabularies  []VocabularyReport      `json:"vocabularies,omitempty"`
+	FreeText      []FreeTextReport        `json:"free_text,omitempty"`
+	Structure     *StructureReport        `json:"structure,omitempty"`
+	Privacy       *PrivacyReport          `json:"privacy,omitempty"`
+	FixedWidth    *FixedWidthReport       `json:"fixed_width,omitempty"`
+	FHIR          *FHIRReport             `json:"fhir,omitempty"`
+	Messages      *FinancialMessageReport `json:"financial_messages,omitempty"`
+	// Fidelity measures the delivered rows as a whole against the source
+	Fidelity *fidelity.Report `json:"fidelity,omitempty"`
+	// MultiTable checks the keys of the tables of a multi-table job
+	MultiTable *MultiTableReport `json:"multi_table,omitempty"`
+	// EventStream compares a generated event stream with its parameters
+	EventStream *EventStreamReport `json:"event_stream,omitempty"`
+	// Provenance traces the delivered rows to the batches they were
+	// generated in, when the job asked for it
+	Provenance *ProvenanceManifest `json:"provenance,omitempty"`
+	// Delta is the change manifest of a job delivered as the changes from
+	// a previous run
+	Delta *DeltaManifest `json:"delta,omitempty"`
+	// Watermark records how the rows of a free-plan job were marked
+	Watermark *WatermarkReport `json:"watermark,omitempty"`
+	// QualityGate records the checks of the dataset's quality policy
+	QualityGate *QualityGateReport `json:"quality_gate,omitempty"`
+	// Output is the stored main output of the job, with its checksums
+	Output *JobExport `json:"output,omitempty"`
+	// Exports are the additional formats a job's rows were written in
+	Exports []JobExport `json:"exports,omitempty"`
+	// Reports are the evaluation report of the job in each format, stored
+	// next to its output
+	Reports []JobExport `json:"reports,omitempty"`
+	// Delivery is the organization bucket the stored objects were written
+	// to; nil for platform storage
+	Delivery *OutputDelivery `json:"delivery,omitempty"`
+	// Recommendations are what other models would likely have cost and
+	// scored on the job, worked out when it completed
+	Recommendations []TradeoffRecommendation `json:"recommendations,omitempty"`
+}
+
+// Recommendation bases: the jobs the estimates were drawn from
+const (
+	TradeoffBasisDataset  = "dataset"
+	TradeoffBasisPlatform = "platform"
+)
+
+// TradeoffRecommendation estimates what a job would have cost and scored
+// under another provider model. CostChange and QualityChange are fractions
+// of the job's own cost and quality, negative for less. Basis says whether
+// the estimate compares the models on jobs of the same dataset, and so the
+// same schema, or across the platform; SampleJobs is how many scored jobs
+// of the other model it rests on. Strategy is the generation strategy that
+// selects the model, when a job can ask for it.
+type TradeoffRecommendation struct {
+	Provider         string   `json:"provider"`
+	Model            string   `json:"model"`
+	Strategy         string   `json:"strategy,omitempty"`
+	EstimatedCostUSD float64  `json:"estimated_cost_usd"`
+	CostChange       float64  `json:"cost_change"`
+	EstimatedQuality *float64 `json:"estimated_quality,omitempty"`
+	QualityChange    float64  `json:"quality_change"`
+	Basis            string   `json:"basis"`
+	SampleJobs       int64    `json:"sample_jobs"`
+	Summary          string   `json:"summary"`
+}
+
+// Export statuses
+const (
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	// ExportDeleted is an output housekeeping deleted with its job's
+	// other outputs; its object key is cleared
+	ExportDeleted = "deleted"
+)
+
+// JobExport is a stored output of a job, or one additional format of it
+// that failed and why: its object, encrypted under the key of the main
+// output, its size and the SHA-256 checksums of its content and of the
+// object as stored
+type JobExport struct {
+	Format       string `json:"format"`
+	Status       string `json:"status"`
+	ObjectKey    string `json:"object_key,omitempty"`
+	Bytes        int64  `json:"bytes,omitempty"`
+	SHA256       string `json:"sha256,omitempty"`
+	ObjectSHA256 string `json:"object_sha256,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Artifact kinds
+const (
+	ArtifactData     = "data"
+	ArtifactReport   = "report"
+	ArtifactManifest = "manifest"
+)
+
+// JobArtifact is one object a job produced, as listed in its artifacts
+// manifest. SHA256 is the checksum of the content delivered; ObjectSHA256,
+// for encrypted objects, that of the object as stored. URL and ExpiresAt
+// are set when the caller may fetch it and its link expires.
+type JobArtifact struct {
+	Name         string     `json:"name"`
+	Kind         string     `json:"kind"`
+	Format       string     `json:"format"`
+	ContentType  string     `json:"content_type"`
+	Bytes        int64      `json:"bytes"`
+	SHA256       string     `json:"sha256,omitempty"`
+	ObjectSHA256 string     `json:"object_sha256,omitempty"`
+	Encrypted    bool       `json:"encrypted"`
+	URL          string     `json:"url,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	// ObjectKey is where a data file is stored; links are signed for it
+	ObjectKey string `json:"-"`
+}
+
+// DeltaManifest records how a delta job's rows change the snapshot of the
+// run before it. BaseJobID is the last full run the snapshots were replayed
+// from; PreviousRows and Rows are the snapshot sizes before and after.
+// Dropped counts generated rows left out for lacking a usable key. Changes
+// lists the changed keys, up to a cap, and Truncated is set when some were
+// left out.
+type DeltaManifest struct {
+	PreviousJobID int64         `json:"previous_job_id"`
+	BaseJobID     int64         `json:"base_job_id"`
+	Key           string        `json:"key"`
+	ChangeRate    float64       `json:"change_rate"`
+	PreviousRows  int64         `json:"previous_rows"`
+	Rows          int64         `json:"rows"`
+	Inserted      int64         `json:"inserted"`
+	Updated       int64         `json:"updated"`
+	Deleted       int64         `json:"deleted"`
+	Unchanged     int64         `json:"unchanged"`
+	Dropped       int64         `json:"dropped"`
+	Changes       []DeltaChange `json:"changes"`
+	Truncated     bool          `json:"truncated,omitempty"`
+}
+
+// DeltaChange is the change of one key: insert, update or delete
+type DeltaChange struct {
+	Key    string `json:"key"`
+	Change string `json:"change"`
+}
+
+// WatermarkReport records the watermark of a job's rows: the scheme, the
+// columns that carry it, the cells selected to carry a bit and how many of
+// them had to change
+type WatermarkReport struct {
+	Scheme  string   `json:"scheme"`
+	Columns []string `json:"columns"`
+	Cells   int64    `json:"cells"`
+	Changed int64    `json:"changed"`
+}
+
+// WatermarkVerification is the result of testing rows for a job's
+// watermark. Matches counts the checked cells holding the job's bit; rows
+// that do not carry the watermark match about half of them, so ZScore
+// measures how far above chance they are and PValue how likely that is
+// without the watermark.
+type WatermarkVerification struct {
+	JobID       int64   `json:"job_id"`
+	Scheme      string  `json:"scheme"`
+	Rows        int64   `json:"rows"`
+	Cells       int64   `json:"cells"`
+	Matches     int64   `json:"matches"`
+	ZScore      float64 `json:"z_score"`
+	PValue      float64 `json:"p_value"`
+	Watermarked bool    `json:"watermarked"`
+}
+
+// ProvenanceManifest records the generation context of a job's rows. Rows
+// are delivered in chunk order, so a row's position in the output finds its
+// chunk; Columns names the columns tagging each row, when the job asked for
+// them.
+type ProvenanceManifest struct {
+	JobID           int64             `json:"job_id"`
+	Mode            string            `json:"mode"`
+	TemplateVersion string            `json:"template_version"`
+	Provider        string            `json:"provider"`
+	Model           string            `json:"model"`
+	Columns         []string          `json:"columns,omitempty"`
+	Rows            int64             `json:"rows"`
+	Chunks          []ProvenanceChunk `json:"chunks"`
+}
+
+// ProvenanceChunk is one batch of delivered rows: rows FirstRow to
+// FirstRow+Rows-1 of the output, counted from zero. Digest is the SHA-256
+// of the chunk's rows as JSON lines, before the output was encoded.
+type ProvenanceChunk struct {
+	ChunkID     int       `json:"chunk_id"`
+	FirstRow    int64     `json:"first_row"`
+	Rows        int       `json:"rows"`
+	GeneratedAt time.Time `json:"generated_at"`
+	Digest      string    `json:"digest"`
+}
+
+// Value stores details as a JSON object
+func (q QualityDetails) Value() (driver.Value, error) {
+	b, err := json.Marshal(q)
+	return string(b), err
+}
+
+// Scan reads details stored as a JSON object
+func (q *QualityDetails) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*q = QualityDetails{}
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported quality details type %T", src)
+	}
+	return json.Unmarshal(raw, q)
+}
+
+// RareEventReport compares the rare events of one column in a job's output
+// with the source and the rate the job asked for. Dropped counts generated
+// rows removed for breaking the rule.
+type RareEventReport struct {
+	Column          string  `json:"column"`
+	Kind            string  `json:"kind"`
+	Mode            string  `json:"mode"`
+	SourceRate      float64 `json:"source_rate"`
+	TargetRate      float64 `json:"target_rate"`
+	GeneratedRate   float64 `json:"generated_rate"`
+	Events          int64   `json:"events"`
+	Dropped         int64   `json:"dropped"`
+	WithinTolerance bool    `json:"within_tolerance"`
+}
+
+// DistributionReport compares the distribution of one column in a job's
+// output with the weighted population or raw sample it targeted. Fidelity
+// runs from 0 to 1.
+type DistributionReport struct {
+	Column        string   `json:"column"`
+	Target        string   `json:"target"`
+	TargetMean    *float64 `json:"target_mean,omitempty"`
+	GeneratedMean *float64 `json:"generated_mean,omitempty"`
+	Fidelity      float64  `json:"fidelity"`
+}
+
+// HierarchyReport counts the generated rows that broke a hierarchy and were
+// dropped. Compliance is the share of checked rows that followed it.
+type HierarchyReport struct {
+	Levels     []string `json:"levels"`
+	Source     string   `json:"source"`
+	Checked    int64    `json:"checked"`
+	Violations int64    `json:"violations"`
+	Compliance float64  `json:"compliance"`
+}
+
+// VocabularyReport checks the delivered values of a column bound to a
+// controlled vocabulary. Fidelity is one minus the total variation distance
+// between the delivered shares of the values and their target shares.
+type VocabularyReport struct {
+	Column          string  `json:"column"`
+	Vocabulary      string  `json:"vocabulary"`
+	Weighting       string  `json:"weighting"`
+	Entries         int     `json:"entries"`
+	Checked         int64   `json:"checked"`
+	OutOfVocabulary int64   `json:"out_of_vocabulary"`
+	Distinct        int     `json:"distinct"`
+	Fidelity        float64 `json:"fidelity"`
+}
+
+// FreeTextReport measures the generated text of a free-text column against
+// its source. Redacted counts generated values that held suspected PII,
+// which was replaced before delivery, by kind in PIIKinds; Copies counts
+// values that repeat a scrubbed source text. ResidualRisk grades the share
+// of values that did either as low, medium or high.
+type FreeTextReport struct {
+	Column             string             `json:"column"`
+	Checked            int64              `json:"checked"`
+	Redacted           int64              `json:"redacted"`
+	PIIKinds           map[string]int64   `json:"pii_kinds,omitempty"`
+	Copies             int64              `json:"copies"`
+	ResidualRisk       string             `json:"residual_risk"`
+	MedianLength       int                `json:"median_length"`
+	TargetMedianLength int                `json:"target_median_length"`
+	Languages          map[string]float64 `json:"languages,omitempty"`
+	TargetLanguages    map[string]float64 `json:"target_languages,omitempty"`
+}
+
+// NestedColumnReport counts the generated values of a nested column that did
+// not match its inferred schema and were dropped with their rows. Validity
+// is the share of checked values that matched.
+type NestedColumnReport struct {
+	Column   string  `json:"column"`
+	Checked  int64   `json:"checked"`
+	Invalid  int64   `json:"invalid"`
+	Validity float64 `json:"validity"`
+}
+
+// ArrayColumnReport compares the generated lists of an array column with
+// its source profile. Fidelity runs from 0 to 1 and averages the length and
+// element fidelity; ElementFidelity is absent when no element statistics
+// could be used. Dropped counts rows removed for unreadable or overlong
+// lists.
+type ArrayColumnReport struct {
+	Column           string   `json:"column"`
+	Lists            int64    `json:"lists"`
+	MeanLength       float64  `json:"mean_length"`
+	TargetMeanLength float64  `json:"target_mean_length"`
+	LengthFidelity   float64  `json:"length_fidelity"`
+	ElementFidelity  *float64 `json:"element_fidelity,omitempty"`
+	Fidelity         float64  `json:"fidelity"`
+	Dropped          int64    `json:"dropped"`
+}
+
+// StructureReport compares the duplicates and groups of a job's output with
+// its target. Injected counts rows replaced with copies of earlier ones to
+// reach the duplicate rate; DroppedDuplicates counts duplicates beyond it
+// and DroppedOversize rows that would have grown a group past the largest
+// size.
+type StructureReport struct {
+	DuplicateRate       float64  `json:"duplicate_rate"`
+	TargetDuplicateRate float64  `json:"target_duplicate_rate"`
+	SourceDuplicateRate float64  `json:"source_duplicate_rate"`
+	Duplicates          int64    `json:"duplicates"`
+	Injected            int64    `json:"injected"`
+	DroppedDuplicates   int64    `json:"dropped_duplicates"`
+	GroupBy             string   `json:"group_by,omitempty"`
+	Groups              int64    `json:"groups,omitempty"`
+	MeanGroupSize       float64  `json:"mean_group_size,omitempty"`
+	TargetMeanGroupSize float64  `json:"target_mean_group_size,omitempty"`
+	GroupSizeFidelity   *float64 `json:"group_size_fidelity,omitempty"`
+	DroppedOversize     int64    `json:"dropped_oversize"`
+}
+
+// PrivacyReport is the privacy budget a job spent on its configured
+// columns against the budget of its privacy level
+type PrivacyReport struct {
+	Level        string                `json:"level"`
+	Epsilon      float64               `json:"epsilon"`
+	Delta        float64               `json:"delta"`
+	SpentEpsilon float64               `json:"spent_epsilon"`
+	SpentDelta   float64               `json:"spent_delta"`
+	Columns      []ColumnPrivacyReport `json:"columns"`
+}
+
+// ColumnPrivacyReport counts the generated values of a column that were
+// protected; Suppressed counts those removed, by suppression or because a
+// noise mechanism could not apply to them.
+type ColumnPrivacyReport struct {
+	Column     string  `json:"column"`
+	Category   string  `json:"category"`
+	Mechanism  string  `json:"mechanism"`
+	Epsilon    float64 `json:"epsilon,omitempty"`
+	Delta      float64 `json:"delta,omitempty"`
+	Protected  int64   `json:"protected"`
+	Suppressed int64   `json:"suppressed"`
+}
+
+// FixedWidthReport describes how generated rows fit a fixed-width layout.
+// Dropped counts rows removed for a value that did not fit; Truncated and
+// Substituted count values cut to their field or with characters the
+// encoding lacks replaced. Overflows counts values too wide per column.
+type FixedWidthReport struct {
+	Encoding     string           `json:"encoding"`
+	RecordLength int              `json:"record_length"`
+	Overflow     string           `json:"overflow"`
+	Dropped      int64            `json:"dropped"`
+	Truncated    int64            `json:"truncated"`
+	Substituted  int64            `json:"substituted"`
+	Overflows    map[string]int64 `json:"overflows,omitempty"`
+}
+
+// FHIRReport describes the FHIR resources made of generated rows.
+// Resources counts those exported per type; Dropped counts rows removed for
+// a value the resource profiles do not allow, and Violations the values
+// per element.
+type FHIRReport struct {
+	Resources  map[string]int64 `json:"resources"`
+	Dropped    int64            `json:"dropped"`
+	Violations map[string]int64 `json:"violations,omitempty"`
+}
+
+// FinancialMessageReport describes the payment messages rendered from
+// generated rows. Dropped counts rows removed for a value the message
+// schema does not allow, and Violations those values per role.
+type FinancialMessageReport struct {
+	MessageType  string           `json:"message_type"`
+	Transactions int64            `json:"transactions"`
+	Dropped      int64            `json:"dropped"`
+	Violations   map[string]int64 `json:"violations,omitempty"`
+}
+
+// MultiTableReport checks the tables of a multi-table job against each
+// other: the keys of every table and, for every foreign key, the children
+// pointing at no parent and how children spread over parents
+type MultiTableReport struct {
+	Tables        []TableReport      `json:"tables"`
+	Relationships []ForeignKeyReport `json:"relationships"`
+}
+
+// TableReport describes the rows of one table. Renumbered is set when the
+// generated primary keys were missing or repeated and were replaced with
+// row numbers.
+type TableReport struct {
+	Name          string `json:"name"`
+	Rows          int64  `json:"rows"`
+	PrimaryKey    string `json:"primary_key,omitempty"`
+	DuplicateKeys int64  `json:"duplicate_keys"`
+	MissingKeys   int64  `json:"missing_keys"`
+	Renumbered    bool   `json:"renumbered,omitempty"`
+}
+
+// ForeignKeyReport compares the children per parent of one foreign key with
+// its target. Orphans counts child rows referencing a key their parent table
+// does not have; CardinalityFidelity is one minus the total variation
+// distance between the generated and target shares.
+type ForeignKeyReport struct {
+	Parent              string          `json:"parent"`
+	Child               string          `json:"child"`
+	Column              string          `json:"column"`
+	Orphans             int64           `json:"orphans"`
+	Parents             int64           `json:"parents"`
+	Children            int64           `json:"children"`
+	MeanChildren        float64         `json:"mean_children"`
+	TargetMeanChildren  float64         `json:"target_mean_children"`
+	MaxChildren         int             `json:"max_children"`
+	ChildrenPerParent   map[int]float64 `json:"children_per_parent"`
+	CardinalityFidelity *float64        `json:"cardinality_fidelity,omitempty"`
+}
+
+// EventStreamReport describes a generated product-analytics event stream
+// and measures its retention and funnels against the parameters it was
+// generated with
+type EventStreamReport struct {
+	Format    string            `json:"format"`
+	Users     int64             `json:"users"`
+	Sessions  int64             `json:"sessions"`
+	Events    int64             `json:"events"`
+	Retention []RetentionReport `json:"retention,omitempty"`
+	Funnels   []FunnelReport    `json:"funnels,omitempty"`
+}
+
+// RetentionReport is the share of users active N days after their first
+// day, among the users whose day N falls within the stream
+type RetentionReport struct {
+	Day      int     `json:"day"`
+	Target   float64 `json:"target"`
+	Observed float64 `json:"observed"`
+	Users    int64   `json:"users"`
+}
+
+// FunnelReport counts the users, or sessions of a recurring funnel, that
+// reached each step
+type FunnelReport struct {
+	Name  string             `json:"name"`
+	Steps []FunnelStepReport `json:"steps"`
+}
+
+// FunnelStepReport compares the conversion into a step from the one before
+// with its target
+type FunnelStepReport struct {
+	Event      string  `json:"event"`
+	Reached    int64   `json:"reached"`
+	Target     float64 `json:"target"`
+	Conversion float64 `json:"conversion"`
+}
+
+// ProviderUsage aggregates a user's completed jobs for one provider and model
+// within one time bucket
+type ProviderUsage struct {
+	Period     time.Time `db:"period" json:"period"`
+	Provider   string    `db:"provider" json:"provider"`
+	Model      string    `db:"model" json:"model"`
+	Jobs       int64     `db:"jobs" json:"jobs"`
+	Rows       int64     `db:"rows" json:"rows"`
+	Tokens     int64     `db:"tokens" json:"tokens"`
+	CostUSD    float64   `db:"cost_usd" json:"cost_usd"`
+	AvgQuality *float64  `db:"avg_quality" json:"avg_quality,omitempty"`
+	ScoredJobs int64     `db:"scored_jobs" json:"-"`
+}
+
+// GroundingSampleRecord is the per-job record of the real rows, already
+// masked, that were shared with a provider to ground the prompt
+type GroundingSampleRecord struct {
+	JobID         int64          `db:"job_id" json:"job_id"`
+	DatasetID     int64          `db:"dataset_id" json:"dataset_id"`
+	Strategy      string         `db:"strategy" json:"strategy"`
+	StratifyBy    *string        `db:"stratify_by" json:"stratify_by,omitempty"`
+	Seed          int64          `db:"seed" json:"seed"`
+	SourceRows    pq.Int64Array  `db:"source_rows" json:"source_rows"`
+	MaskedColumns pq.StringArray `db:"masked_columns" json:"masked_columns"`
+	Rows          string         `db:"rows" json:"-"`
+	Digest        string         `db:"digest" json:"digest"`
+	CreatedAt     time.Time      `db:"created_at" json:"created_at"`
 }
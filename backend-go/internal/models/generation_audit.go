@@ -0,0 +1,96 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SampleSharing is how much of a job's source data was used and where
+type SampleSharing string
+
+const (
+	// SampleSharingZeroRealData jobs never read source rows
+	SampleSharingZeroRealData SampleSharing = "zero_real_data"
+	// SampleSharingLocalOnly jobs profile source rows on the platform but
+	// share none with the provider
+	SampleSharingLocalOnly SampleSharing = "local_only"
+	// SampleSharingGrounded jobs share a masked sample of source rows with
+	// the provider as prompt examples
+	SampleSharingGrounded SampleSharing = "grounded"
+)
+
+// ColumnMechanisms maps columns to the privacy mechanism protecting them
+type ColumnMechanisms map[string]PrivacyMechanism
+
+// Value stores the mechanisms as a JSON object
+func (m ColumnMechanisms) Value() (driver.Value, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(m)
+	return string(b), err
+}
+
+// Scan reads mechanisms stored as a JSON object
+func (m *ColumnMechanisms) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported column mechanisms type %T", src)
+	}
+	return json.Unmarshal(raw, m)
+}
+
+// GenerationAudit records who started a generation job and what data it
+// drew on: the source columns, the columns masked from the requester, the
+// privacy protections and how much source data was shared
+type GenerationAudit struct {
+	ID        int64  `db:"id" json:"id"`
+	JobID     int64  `db:"job_id" json:"job_id"`
+	UserID    int64  `db:"user_id" json:"user_id"`
+	OrgID     *int64 `db:"org_id" json:"org_id,omitempty"`
+	DatasetID int64  `db:"dataset_id" json:"dataset_id"`
+	// Columns are the source columns the job generated from; empty when
+	// the dataset's columns could not be read
+	Columns       pq.StringArray `db:"columns" json:"columns"`
+	MaskedColumns pq.StringArray `db:"masked_columns" json:"masked_columns"`
+	RowsRequested int64          `db:"rows_requested" json:"rows_requested"`
+	PrivacyLevel  *string        `db:"privacy_level" json:"privacy_level,omitempty"`
+	// ColumnPrivacy is the masking policy the job ran under
+	ColumnPrivacy    ColumnMechanisms `db:"column_privacy" json:"column_privacy"`
+	DataMode         DataMode         `db:"data_mode" json:"data_mode"`
+	SampleSharing    SampleSharing    `db:"sample_sharing" json:"sample_sharing"`
+	SourceRowsShared int              `db:"source_rows_shared" json:"source_rows_shared"`
+	Provider         *string          `db:"provider" json:"provider,omitempty"`
+	Strategy         *string          `db:"strategy" json:"strategy,omitempty"`
+	CustomModelID    *int64           `db:"custom_model_id" json:"custom_model_id,omitempty"`
+	IPAddress        string           `db:"ip_address" json:"ip_address"`
+	CreatedAt        time.Time        `db:"created_at" json:"created_at"`
+	// Status and RowsGenerated are read from the job
+	Status        GenerationStatus `db:"status" json:"status"`
+	RowsGenerated int64            `db:"rows_generated" json:"rows_generated"`
+}
+
+// GenerationAuditFilter narrows a search of generation audit records; zero
+// fields match everything. Column matches case-insensitively.
+type GenerationAuditFilter struct {
+	Column    string
+	DatasetID int64
+	UserID    int64
+	OrgID     int64
+	Start     time.Time
+	End       time.Time
+	AfterID   int64
+	Limit     int
+}
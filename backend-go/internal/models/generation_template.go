@@ -0,0 +1,75 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// TemplateSettings are the saved settings of a generation template, a JSON
+// object read by the templates package
+type TemplateSettings []byte
+
+// Value stores settings as a JSON object
+func (s TemplateSettings) Value() (driver.Value, error) {
+	if len(s) == 0 {
+		return "{}", nil
+	}
+	return string(s), nil
+}
+
+// Scan reads settings stored as a JSON object
+func (s *TemplateSettings) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s = nil
+	case string:
+		*s = TemplateSettings(v)
+	case []byte:
+		*s = append(TemplateSettings(nil), v...)
+	default:
+		return fmt.Errorf("unsupported template settings type %T", src)
+	}
+	return nil
+}
+
+// MarshalJSON writes the settings as the object they hold
+func (s TemplateSettings) MarshalJSON() ([]byte, error) {
+	if len(s) == 0 {
+		return []byte("{}"), nil
+	}
+	return s, nil
+}
+
+// UnmarshalJSON keeps the object as given
+func (s *TemplateSettings) UnmarshalJSON(raw []byte) error {
+	*s = append(TemplateSettings(nil), raw...)
+	return nil
+}
+
+// GenerationTemplate is a named set of generation settings a user reuses
+// across datasets. Templates shared with the owner's organization have
+// OrgID set. Every change makes a new version; earlier versions are kept.
+type GenerationTemplate struct {
+	ID          int64            `db:"id" json:"id"`
+	OwnerID     int64            `db:"owner_id" json:"owner_id"`
+	OrgID       *int64           `db:"org_id" json:"org_id,omitempty"`
+	Name        string           `db:"name" json:"name"`
+	Description *string          `db:"description" json:"description,omitempty"`
+	Version     int              `db:"version" json:"version"`
+	Settings    TemplateSettings `db:"settings" json:"settings"`
+	UpdatedBy   int64            `db:"updated_by" json:"updated_by"`
+	CreatedAt   time.Time        `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time        `db:"updated_at" json:"updated_at"`
+}
+
+// GenerationTemplateVersion is one version in the history of a template
+type GenerationTemplateVersion struct {
+	TemplateID  int64            `db:"template_id" json:"template_id"`
+	Version     int              `db:"version" json:"version"`
+	Name        string           `db:"name" json:"name"`
+	Description *string          `db:"description" json:"description,omitempty"`
+	Settings    TemplateSettings `db:"settings" json:"settings"`
+	CreatedBy   int64            `db:"created_by" json:"created_by"`
+	CreatedAt   time.Time        `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// StaleKind is a kind of resource housekeeping looks for
+type StaleKind string
+
+const (
+	// StaleDataset is a dataset no job has used for a while
+	StaleDataset StaleKind = "unused_dataset"
+	// StaleOutput is stored output of a job that failed or was cancelled,
+	// or whose dataset or owner no longer exists
+	StaleOutput StaleKind = "orphaned_output"
+	// StaleAPIKey is an active API key that was never used
+	StaleAPIKey StaleKind = "unused_api_key"
+	// StaleCustomModel is a custom model no job has used for a while
+	StaleCustomModel StaleKind = "idle_custom_model"
+)
+
+// StaleKinds lists every kind of stale resource
+var StaleKinds = []StaleKind{StaleDataset, StaleOutput, StaleAPIKey, StaleCustomModel}
+
+// Reasons a resource is stale
+const (
+	StaleNoRecentJobs    = "no_recent_jobs"
+	StaleNeverUsed       = "never_used"
+	StaleNotUsedRecently = "not_used_recently"
+	StaleJobFailed       = "job_failed"
+	StaleJobCancelled    = "job_cancelled"
+	StaleDatasetDeleted  = "dataset_deleted"
+	StaleOwnerDeleted    = "owner_deleted"
+)
+
+// StaleResource is a resource housekeeping found unused. Bytes is what it
+// occupies in platform storage and ObjectKeys are its stored objects.
+type StaleResource struct {
+	Kind         StaleKind  `db:"-" json:"kind"`
+	ID           int64      `db:"id" json:"id"`
+	OwnerID      int64      `db:"owner_id" json:"owner_id"`
+	Name         string     `db:"name" json:"name"`
+	Reason       string     `db:"reason" json:"reason"`
+	Bytes        int64      `db:"bytes" json:"bytes"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+	LastActivity *time.Time `db:"last_activity" json:"last_activity,omitempty"`
+	ObjectKeys   []string   `db:"-" json:"-"`
+}
+
+// CleanupPolicy lets housekeeping act on a kind of stale resource by
+// itself. IdleDays is how long a resource must have gone unused to be
+// suggested or cleaned up.
+type CleanupPolicy struct {
+	Kind      StaleKind `db:"kind" json:"kind"`
+	Enabled   bool      `db:"enabled" json:"enabled"`
+	IdleDays  int       `db:"idle_days" json:"idle_days"`
+	UpdatedBy *int64    `db:"updated_by" json:"updated_by,omitempty"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// DeploymentMarker records a release of a service, so incidents can be
+// lined up with what changed
+type DeploymentMarker struct {
+	ID          int64     `db:"id" json:"id"`
+	Service     string    `db:"service" json:"service"`
+	Version     string    `db:"version" json:"version"`
+	Description *string   `db:"description" json:"description,omitempty"`
+	CreatedBy   *int64    `db:"created_by" json:"created_by,omitempty"`
+	DeployedAt  time.Time `db:"deployed_at" json:"deployed_at"`
+}
+
+// JobFailureBucket counts the generation jobs that finished in a time
+// bucket, and the failures among them with their most common error
+type JobFailureBucket struct {
+	Start    time.Time `db:"bucket" json:"start"`
+	Finished int64     `db:"finished" json:"finished"`
+	Failed   int64     `db:"failed" json:"failed"`
+	TopError *string   `db:"top_error" json:"top_error,omitempty"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// UsageMeter is a kind of usage metered for billing
+type UsageMeter string
+
+const (
+	// MeterRowsGenerated counts rows delivered by completed generation jobs
+	MeterRowsGenerated UsageMeter = "rows_generated"
+	// MeterAPIRequests counts authenticated API requests
+	MeterAPIRequests UsageMeter = "api_requests"
+	// MeterStorageGBDays counts the gigabytes of datasets and custom models
+	// a user stores, sampled once a day
+	MeterStorageGBDays UsageMeter = "storage_gb_days"
+	// MeterTrainingMinutes counts minutes spent training custom models
+	MeterTrainingMinutes UsageMeter = "custom_model_training_minutes"
+)
+
+// UsageEvent is a single metered use. IdempotencyKey is unique per user and
+// meter, so recording an event twice counts it once.
+type UsageEvent struct {
+	ID             int64      `db:"id" json:"id"`
+	UserID         int64      `db:"user_id" json:"user_id"`
+	Meter          UsageMeter `db:"meter" json:"meter"`
+	Quantity       float64    `db:"quantity" json:"quantity"`
+	IdempotencyKey string     `db:"idempotency_key" json:"idempotency_key"`
+	OccurredAt     time.Time  `db:"occurred_at" json:"occurred_at"`
+}
+
+// UsagePeriodTotal is a user's usage of a meter in a billing period.
+// Reported is the overage already sent to the payment provider.
+type UsagePeriodTotal struct {
+	UserID    int64      `db:"user_id" json:"user_id"`
+	Period    time.Time  `db:"period" json:"period"`
+	Meter     UsageMeter `db:"meter" json:"meter"`
+	Quantity  float64    `db:"quantity" json:"quantity"`
+	Reported  int64      `db:"reported" json:"reported"`
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// BillableUsage is a period total of a user with a Stripe customer, with
+// what is needed to bill its overage
+type BillableUsage struct {
+	UsagePeriodTotal
+	Tier             SubscriptionTier `db:"subscription_tier"`
+	StripeCustomerID string           `db:"stripe_customer_id"`
+}
+
+// InvoiceLineItem is a meter's usage in a billing period and what it costs
+// past what the plan includes. Included is -1 when the plan includes
+// unlimited usage.
+type InvoiceLineItem struct {
+	Meter       UsageMeter `json:"meter"`
+	Description string     `json:"description"`
+	Unit        string     `json:"unit"`
+	Quantity    float64    `json:"quantity"`
+	Included    float64    `json:"included"`
+	Overage     float64    `json:"overage"`
+	UnitPrice   float64    `json:"unit_price"`
+	Amount      float64    `json:"amount"`
+}
+
+// UsageInvoice is a user's metered usage in a billing period, the calendar
+// month in UTC starting at PeriodStart
+type UsageInvoice struct {
+	Period      string            `json:"period"`
+	PeriodStart time.Time         `json:"period_start"`
+	PeriodEnd   time.Time         `json:"period_end"`
+	Tier        SubscriptionTier  `json:"tier"`
+	Currency    string            `json:"currency"`
+	Lines       []InvoiceLineItem `json:"lines"`
+	// OverageAmount is the sum of the lines' amounts, billed on top of the
+	// subscription
+	OverageAmount float64 `json:"overage_amount"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// MockAPI is a hosted mock REST endpoint serving the rows of a completed
+// generation job. Its PublicID is the only credential its endpoint needs,
+// so frontends can call it without a session until it expires.
+type MockAPI struct {
+	ID                int64     `db:"id" json:"id"`
+	UserID            int64     `db:"user_id" json:"user_id"`
+	JobID             int64     `db:"job_id" json:"job_id"`
+	Name              string    `db:"name" json:"name"`
+	PublicID          string    `db:"public_id" json:"public_id"`
+	RequestsPerMinute int       `db:"requests_per_minute" json:"requests_per_minute"`
+	ExpiresAt         time.Time `db:"expires_at" json:"expires_at"`
+	CreatedAt         time.Time `db:"created_at" json:"created_at"`
+	// Path is where the mock's records are served, below /api/v1
+	Path string `db:"-" json:"path"`
+}
+
+// Expired reports whether the mock has stopped serving at t
+func (m *MockAPI) Expired(t time.Time) bool {
+	return !t.Before(m.ExpiresAt)
+}
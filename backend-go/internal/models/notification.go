@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// NotificationSeverity decides whether a notification may wait for a digest
+type NotificationSeverity string
+
+const (
+	NotificationInfo     NotificationSeverity = "info"
+	NotificationWarning  NotificationSeverity = "warning"
+	NotificationCritical NotificationSeverity = "critical"
+)
+
+// Notification categories. Security and billing notifications are always
+// delivered immediately; product and marketing notifications only reach
+// users who consented to them.
+const (
+	NotificationCategoryJobs      = "jobs"
+	NotificationCategoryReports   = "reports"
+	NotificationCategorySecurity  = "security"
+	NotificationCategoryBilling   = "billing"
+	NotificationCategoryProduct   = "product"
+	NotificationCategoryMarketing = "marketing"
+)
+
+// NotificationStatus tracks a notification from creation to delivery
+type NotificationStatus string
+
+const (
+	NotificationPending    NotificationStatus = "pending"
+	NotificationSent       NotificationStatus = "sent"
+	NotificationDigested   NotificationStatus = "digested"
+	NotificationFailed     NotificationStatus = "failed"
+	NotificationSuppressed NotificationStatus = "suppressed"
+)
+
+// DigestFrequency is how often a user receives non-critical notifications
+type DigestFrequency string
+
+const (
+	DigestImmediate DigestFrequency = "immediate"
+	DigestHourly    DigestFrequency = "hourly"
+	DigestDaily     DigestFrequency = "daily"
+	DigestOff       DigestFrequency = "off"
+)
+
+// Notification is one message for a user. Repeats of a pending notification
+// with the same dedupe key are folded into it and counted in Occurrences.
+type Notification struct {
+	ID          int64                `db:"id" json:"id"`
+	UserID      int64                `db:"user_id" json:"user_id"`
+	Category    string               `db:"category" json:"category"`
+	Severity    NotificationSeverity `db:"severity" json:"severity"`
+	DedupeKey   *string              `db:"dedupe_key" json:"dedupe_key,omitempty"`
+	Title       string               `db:"title" json:"title"`
+	Body        string               `db:"body" json:"body"`
+	Status      NotificationStatus   `db:"status" json:"status"`
+	Occurrences int                  `db:"occurrences" json:"occurrences"`
+	LastSeenAt  time.Time            `db:"last_seen_at" json:"last_seen_at"`
+	DeliveredAt *time.Time           `db:"delivered_at" json:"delivered_at,omitempty"`
+	CreatedAt   time.Time            `db:"created_at" json:"created_at"`
+}
+
+// NotificationPreference holds a user's delivery settings. DailyHour is the
+// UTC hour daily digests go out.
+type NotificationPreference struct {
+	UserID       int64           `db:"user_id" json:"user_id"`
+	Frequency    DigestFrequency `db:"frequency" json:"frequency"`
+	DailyHour    int             `db:"daily_hour" json:"daily_hour"`
+	LastDigestAt *time.Time      `db:"last_digest_at" json:"last_digest_at,omitempty"`
+	UpdatedAt    time.Time       `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,168 @@
+package models
+
+import "time"
+
+// OrgRole is what a member may do in an organization
+type OrgRole string
+
+const (
+	// OrgRoleOwner manages the organization, including other owners
+	OrgRoleOwner OrgRole = "owner"
+	// OrgRoleAdmin manages members and the resources of every member
+	OrgRoleAdmin OrgRole = "admin"
+	// OrgRoleMember creates datasets, jobs and models shared with the org
+	OrgRoleMember OrgRole = "member"
+	// OrgRoleViewer reads what the organization shares
+	OrgRoleViewer OrgRole = "viewer"
+	// OrgRoleAuditor reads the organization's audit trail, reports, lineage
+	// and configuration, but neither the contents of its datasets and
+	// outputs nor changes anything
+	OrgRoleAuditor OrgRole = "auditor"
+)
+
+// Organization is a workspace whose members share datasets, generation jobs
+// and custom models
+type Organization struct {
+	ID        int64     `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	CreatedBy *int64    `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// OrgMember is a user's membership of an organization. A user belongs to at
+// most one organization, mirrored in users.org_id.
+type OrgMember struct {
+	OrgID  int64   `db:"org_id" json:"org_id"`
+	UserID int64   `db:"user_id" json:"user_id"`
+	Email  string  `db:"email" json:"email,omitempty"`
+	Role   OrgRole `db:"role" json:"role"`
+	// Team is the member's team within the organization, a free-form label
+	Team      *string   `db:"team" json:"team,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// OrgInvitation asks someone to join an organization with a role. The
+// invitee proves the address with a token sent to it.
+type OrgInvitation struct {
+	ID         int64      `db:"id" json:"id"`
+	OrgID      int64      `db:"org_id" json:"org_id"`
+	Email      string     `db:"email" json:"email"`
+	Role       OrgRole    `db:"role" json:"role"`
+	Team       *string    `db:"team" json:"team,omitempty"`
+	TokenHash  string     `db:"token_hash" json:"-"`
+	InvitedBy  int64      `db:"invited_by" json:"invited_by"`
+	ExpiresAt  time.Time  `db:"expires_at" json:"expires_at"`
+	AcceptedAt *time.Time `db:"accepted_at" json:"accepted_at,omitempty"`
+	RevokedAt  *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+}
+
+// OrgUsage sums what an organization's shared resources used
+type OrgUsage struct {
+	OrgID          int64            `json:"org_id"`
+	Since          time.Time        `json:"since"`
+	RowsGenerated  int64            `db:"rows_generated" json:"rows_generated"`
+	RowsReserved   int64            `db:"rows_reserved" json:"rows_reserved"`
+	GenerationJobs int64            `db:"generation_jobs" json:"generation_jobs"`
+	Datasets       int64            `db:"datasets" json:"datasets"`
+	CustomModels   int64            `db:"custom_models" json:"custom_models"`
+	Members        []OrgMemberUsage `json:"members"`
+}
+
+// OrgMemberUsage is one member's part of an organization's usage
+type OrgMemberUsage struct {
+	UserID         int64  `db:"user_id" json:"user_id"`
+	Email          string `db:"email" json:"email"`
+	RowsGenerated  int64  `db:"rows_generated" json:"rows_generated"`
+	GenerationJobs int64  `db:"generation_jobs" json:"generation_jobs"`
+	Datasets       int64  `db:"datasets" json:"datasets"`
+}
+
+// OrgUsageRollup is an organization's completed generation work in one hour
+type OrgUsageRollup struct {
+	OrgID   int64     `db:"org_id" json:"org_id"`
+	Hour    time.Time `db:"hour" json:"hour"`
+	Jobs    int64     `db:"jobs" json:"jobs"`
+	Rows    int64     `db:"rows_generated" json:"rows"`
+	Tokens  int64     `db:"tokens" json:"tokens"`
+	CostUSD float64   `db:"cost_usd" json:"cost_usd"`
+}
+
+// OrgImportRowStatus is where a row of a member import stands
+type OrgImportRowStatus string
+
+const (
+	// OrgImportRowPending rows wait for their invitation to be sent
+	OrgImportRowPending OrgImportRowStatus = "pending"
+	// OrgImportRowSending rows are being invited by a worker
+	OrgImportRowSending OrgImportRowStatus = "sending"
+	// OrgImportRowInvited rows were sent an invitation
+	OrgImportRowInvited OrgImportRowStatus = "invited"
+	// OrgImportRowSkipped rows needed no invitation: the address is a
+	// member already or holds an open invitation with the same role
+	OrgImportRowSkipped OrgImportRowStatus = "skipped"
+	// OrgImportRowFailed rows could not be invited and are retried when
+	// the import is run again
+	OrgImportRowFailed OrgImportRowStatus = "failed"
+	// OrgImportRowInvalid rows failed validation and are never invited
+	OrgImportRowInvalid OrgImportRowStatus = "invalid"
+)
+
+// OrgImport is a CSV of people an organization admin invited in one go.
+// Rows are validated on upload and invited in the background; the counts
+// are worked out from its rows when it is read.
+type OrgImport struct {
+	ID        int64     `db:"id" json:"id"`
+	OrgID     int64     `db:"org_id" json:"org_id"`
+	CreatedBy int64     `db:"created_by" json:"created_by"`
+	Filename  string    `db:"filename" json:"filename"`
+	Rows      int64     `db:"total_rows" json:"rows"`
+	Pending   int64     `db:"pending" json:"pending"`
+	Invited   int64     `db:"invited" json:"invited"`
+	Skipped   int64     `db:"skipped" json:"skipped"`
+	Failed    int64     `db:"failed" json:"failed"`
+	Invalid   int64     `db:"invalid" json:"invalid"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	// CompletedAt is set once no row is left to invite
+	CompletedAt *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+}
+
+// OrgImportRow is one person of a member import. Line is the row's line
+// in the uploaded file; Reason says why it was skipped, failed or is
+// invalid.
+type OrgImportRow struct {
+	ID           int64              `db:"id" json:"id"`
+	ImportID     int64              `db:"import_id" json:"import_id"`
+	Line         int                `db:"line" json:"line"`
+	Email        string             `db:"email" json:"email"`
+	Role         OrgRole            `db:"role" json:"role"`
+	Team         *string            `db:"team" json:"team,omitempty"`
+	Status       OrgImportRowStatus `db:"status" json:"status"`
+	Reason       *string            `db:"reason" json:"reason,omitempty"`
+	InvitationID *int64             `db:"invitation_id" json:"invitation_id,omitempty"`
+	Attempts     int                `db:"attempts" json:"attempts"`
+	UpdatedAt    time.Time          `db:"updated_at" json:"updated_at"`
+}
+
+// OrgPolicy records that an organization admin disabled a capability for
+// the organization's members. Capabilities without a policy are allowed.
+type OrgPolicy struct {
+	OrgID      int64     `db:"org_id" json:"org_id"`
+	Capability string    `db:"capability" json:"capability"`
+	Reason     *string   `db:"reason" json:"reason,omitempty"`
+	DisabledBy int64     `db:"disabled_by" json:"disabled_by"`
+	DisabledAt time.Time `db:"disabled_at" json:"disabled_at"`
+}
+
+// OrgPolicyViolation is a member's attempt to use a disabled capability.
+// Action is the request that was refused, such as
+// "POST /api/v1/warehouses".
+type OrgPolicyViolation struct {
+	ID         int64     `db:"id" json:"id"`
+	OrgID      int64     `db:"org_id" json:"org_id"`
+	UserID     int64     `db:"user_id" json:"user_id"`
+	Email      string    `db:"email" json:"email,omitempty"`
+	Capability string    `db:"capability" json:"capability"`
+	Action     string    `db:"action" json:"action"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Organization default settings
+const (
+	OrgSettingPrivacyLevel  = "privacy_level"
+	OrgSettingProvider      = "provider"
+	OrgSettingRetentionDays = "retention_days"
+	OrgSettingExportFormats = "export_formats"
+)
+
+// OrgSettings are an organization's defaults for new jobs and datasets.
+// Settings listed in Mandatory cannot be overridden by members.
+type OrgSettings struct {
+	OrgID         int64          `db:"org_id" json:"org_id"`
+	PrivacyLevel  *string        `db:"privacy_level" json:"privacy_level,omitempty"`
+	Provider      *string        `db:"provider" json:"provider,omitempty"`
+	RetentionDays *int           `db:"retention_days" json:"retention_days,omitempty"`
+	ExportFormats pq.StringArray `db:"export_formats" json:"export_formats"`
+	Mandatory     pq.StringArray `db:"mandatory" json:"mandatory"`
+	CreatedAt     time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// IsMandatory reports whether members must use the organization's value
+func (s *OrgSettings) IsMandatory(setting string) bool {
+	if s == nil {
+		return false
+	}
+	for _, m := range s.Mandatory {
+		if m == setting {
+			return true
+		}
+	}
+	return false
+}
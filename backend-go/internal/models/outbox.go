@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// OutboxStatus is where an outbox event is in its dispatch
+type OutboxStatus string
+
+const (
+	OutboxPending    OutboxStatus = "pending"
+	OutboxDispatched OutboxStatus = "dispatched"
+	// OutboxFailed events ran out of attempts and are kept for inspection
+	OutboxFailed OutboxStatus = "failed"
+)
+
+// OutboxEvent is a domain event written in the transaction of the state
+// change it describes and published afterwards. Done lists the handlers
+// that have handled it, so a retry only runs the ones that failed.
+type OutboxEvent struct {
+	ID            int64          `db:"id" json:"id"`
+	Topic         string         `db:"topic" json:"topic"`
+	UserID        int64          `db:"user_id" json:"user_id"`
+	Payload       string         `db:"payload" json:"payload"`
+	Status        OutboxStatus   `db:"status" json:"status"`
+	Attempts      int            `db:"attempts" json:"attempts"`
+	Done          pq.StringArray `db:"done" json:"done"`
+	NextAttemptAt time.Time      `db:"next_attempt_at" json:"next_attempt_at"`
+	LastError     *string        `db:"last_error" json:"last_error,omitempty"`
+	DispatchedAt  *time.Time     `db:"dispatched_at" json:"dispatched_at,omitempty"`
+	CreatedAt     time.Time      `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// JobOutputKey is the wrapped data key that encrypts one job's output
+type JobOutputKey struct {
+	JobID       int64     `db:"job_id" json:"job_id"`
+	MasterKeyID string    `db:"master_key_id" json:"master_key_id"`
+	WrappedKey  string    `db:"wrapped_key" json:"-"`
+	Algorithm   string    `db:"algorithm" json:"algorithm"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+}
+
+// OutputAccessStatus is the state of a request to decrypt a job's output
+type OutputAccessStatus string
+
+const (
+	OutputAccessRequested OutputAccessStatus = "requested"
+	OutputAccessApproved  OutputAccessStatus = "approved"
+	OutputAccessDenied    OutputAccessStatus = "denied"
+	OutputAccessRevoked   OutputAccessStatus = "revoked"
+	OutputAccessExpired   OutputAccessStatus = "expired"
+)
+
+// OutputAccessGrant allows a user to obtain a job's output key until it
+// expires. Grants that require approval stay requested until an admin
+// decides on them.
+type OutputAccessGrant struct {
+	ID               int64              `db:"id" json:"id"`
+	JobID            int64              `db:"job_id" json:"job_id"`
+	UserID           int64              `db:"user_id" json:"user_id"`
+	Status           OutputAccessStatus `db:"status" json:"status"`
+	Reason           *string            `db:"reason" json:"reason,omitempty"`
+	RequiresApproval bool               `db:"requires_approval" json:"requires_approval"`
+	DecidedBy        *int64             `db:"decided_by" json:"decided_by,omitempty"`
+	DecidedAt        *time.Time         `db:"decided_at" json:"decided_at,omitempty"`
+	ExpiresAt        *time.Time         `db:"expires_at" json:"expires_at,omitempty"`
+	KeyReleases      int                `db:"key_releases" json:"key_releases"`
+	LastReleasedAt   *time.Time         `db:"last_released_at" json:"last_released_at,omitempty"`
+	CreatedAt        time.Time          `db:"created_at" json:"created_at"`
+}
+
+// Active reports whether the grant currently allows key release
+func (g *OutputAccessGrant) Active(now time.Time) bool {
+	return g.Status == OutputAccessApproved && g.ExpiresAt != nil && now.Before(*g.ExpiresAt)
+}
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// Output bucket providers
+const (
+	BucketS3  = "s3"
+	BucketGCS = "gcs"
+)
+
+// Output bucket statuses. A bucket is unverified until the platform has
+// written, read back and deleted an object in it; it is failing after a
+// delivery or check failed, until one succeeds again.
+const (
+	OutputBucketUnverified = "unverified"
+	OutputBucketActive     = "active"
+	OutputBucketFailing    = "failing"
+)
+
+// OutputBucket is an S3 or GCS bucket an organization owns that the
+// outputs of its members' jobs are written to instead of platform storage.
+// The platform reaches S3 buckets by assuming RoleARN with ExternalID and
+// GCS buckets by impersonating ServiceAccount; neither needs a stored
+// secret.
+type OutputBucket struct {
+	OrgID          int64      `db:"org_id" json:"org_id"`
+	Provider       string     `db:"provider" json:"provider"`
+	Bucket         string     `db:"bucket" json:"bucket"`
+	Region         *string    `db:"region" json:"region,omitempty"`
+	Prefix         string     `db:"prefix" json:"prefix"`
+	RoleARN        *string    `db:"role_arn" json:"role_arn,omitempty"`
+	ExternalID     string     `db:"external_id" json:"external_id"`
+	ServiceAccount *string    `db:"service_account" json:"service_account,omitempty"`
+	Status         string     `db:"status" json:"status"`
+	LastCheckedAt  *time.Time `db:"last_checked_at" json:"last_checked_at,omitempty"`
+	LastError      *string    `db:"last_error" json:"last_error,omitempty"`
+	UpdatedBy      *int64     `db:"updated_by" json:"updated_by,omitempty"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// OutputDelivery records the organization bucket a job's objects were
+// written to; their object keys are keys in that bucket
+type OutputDelivery struct {
+	OrgID    int64  `json:"org_id"`
+	Provider string `json:"provider"`
+	Bucket   string `json:"bucket"`
+	Prefix   string `json:"prefix,omitempty"`
+}
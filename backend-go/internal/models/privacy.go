@@ -0,0 +1,143 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// AnonymizationMode controls how client identifiers are reduced in stored records
+type AnonymizationMode string
+
+const (
+	AnonymizeNone     AnonymizationMode = "none"
+	AnonymizeTruncate AnonymizationMode = "truncate"
+	AnonymizeHash     AnonymizationMode = "hash"
+)
+
+// AnonymizationPolicy is the per-organization policy for IP address and user
+// agent anonymization in audit and analytics records
+type AnonymizationPolicy struct {
+	OrgID              int64             `db:"org_id" json:"org_id"`
+	IPMode             AnonymizationMode `db:"ip_mode" json:"ip_mode"`
+	UserAgentMode      AnonymizationMode `db:"user_agent_mode" json:"user_agent_mode"`
+	AnonymizeAfterDays int               `db:"anonymize_after_days" json:"anonymize_after_days"`
+	EUTenant           bool              `db:"eu_tenant" json:"eu_tenant"`
+	CreatedAt          time.Time         `db:"created_at" json:"created_at"`
+	UpdatedAt          time.Time         `db:"updated_at" json:"updated_at"`
+}
+
+// DataMode records whether real source rows may be sent to a generation
+// provider for a job
+type DataMode string
+
+const (
+	// DataModeStandard allows masked grounding samples to reach the provider
+	DataModeStandard DataMode = "standard"
+	// DataModeZeroRealData sends no source rows at all; generation relies on
+	// profiled statistics and the statistical engine only
+	DataModeZeroRealData DataMode = "zero_real_data"
+)
+
+// DataModeSource says what put a job into its data mode
+type DataModeSource string
+
+const (
+	DataModeSourceDefault DataModeSource = "default"
+	DataModeSourceOrg     DataModeSource = "org_policy"
+	DataModeSourceDataset DataModeSource = "dataset"
+	DataModeSourceRequest DataModeSource = "request"
+)
+
+// DataPolicy is the per-organization policy on real data leaving for
+// generation providers
+type DataPolicy struct {
+	OrgID        int64     `db:"org_id" json:"org_id"`
+	ZeroRealData bool      `db:"zero_real_data" json:"zero_real_data"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// PrivacyCategory is the kind of personal data a column holds
+type PrivacyCategory string
+
+const (
+	PrivacyCategoryPII       PrivacyCategory = "pii"
+	PrivacyCategoryFinancial PrivacyCategory = "financial"
+	PrivacyCategoryHealth    PrivacyCategory = "health"
+)
+
+// PrivacyMechanism is how generated values of a column are protected
+type PrivacyMechanism string
+
+const (
+	MechanismLaplace            PrivacyMechanism = "laplace"
+	MechanismGaussian           PrivacyMechanism = "gaussian"
+	MechanismRandomizedResponse PrivacyMechanism = "randomized_response"
+	MechanismSuppression        PrivacyMechanism = "suppression"
+	MechanismMasking            PrivacyMechanism = "masking"
+)
+
+// ColumnPrivacy is an owner's protection setting for one dataset column.
+// Generation applies the mechanism to every generated value of the column
+// instead of the protection guessed from the schema.
+type ColumnPrivacy struct {
+	ID         int64            `db:"id" json:"id"`
+	DatasetID  int64            `db:"dataset_id" json:"dataset_id"`
+	ColumnName string           `db:"column_name" json:"column_name"`
+	Category   PrivacyCategory  `db:"category" json:"category"`
+	Mechanism  PrivacyMechanism `db:"mechanism" json:"mechanism"`
+	// Epsilon is the column's share of a job's privacy budget; Delta is
+	// only used by the Gaussian mechanism. Suppression and masking spend
+	// neither.
+	Epsilon *float64 `db:"epsilon" json:"epsilon,omitempty"`
+	Delta   *float64 `db:"delta" json:"delta,omitempty"`
+	// Sensitivity is how far one record can move a numeric value, which
+	// scales Laplace and Gaussian noise
+	Sensitivity *float64  `db:"sensitivity" json:"sensitivity,omitempty"`
+	UpdatedBy   int64     `db:"updated_by" json:"updated_by"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// PrivacyBudgetEntry is one charge to a user's privacy budget on a
+// dataset: the epsilon and delta a generation job spent on its protected
+// columns
+type PrivacyBudgetEntry struct {
+	ID        int64          `db:"id" json:"id"`
+	DatasetID int64          `db:"dataset_id" json:"dataset_id"`
+	UserID    int64          `db:"user_id" json:"user_id"`
+	JobID     *int64         `db:"job_id" json:"job_id,omitempty"`
+	Epsilon   float64        `db:"epsilon" json:"epsilon"`
+	Delta     float64        `db:"delta" json:"delta"`
+	Columns   pq.StringArray `db:"columns" json:"columns"`
+	CreatedAt time.Time      `db:"created_at" json:"created_at"`
+}
+
+// PrivacyBudgetBalance is what a user has spent of their privacy budget on
+// a dataset across every job, against the lifetime limit
+type PrivacyBudgetBalance struct {
+	DatasetID        int64                `json:"dataset_id"`
+	UserID           int64                `json:"user_id"`
+	Epsilon          float64              `json:"epsilon"`
+	Delta            float64              `json:"delta"`
+	SpentEpsilon     float64              `json:"spent_epsilon"`
+	SpentDelta       float64              `json:"spent_delta"`
+	RemainingEpsilon float64              `json:"remaining_epsilon"`
+	RemainingDelta   float64              `json:"remaining_delta"`
+	Entries          []PrivacyBudgetEntry `json:"entries"`
+}
+
+// DatasetPII is what the PII scan of a dataset found in one column: the
+// kinds of personal data it holds, the privacy category they fall under and
+// the share of sampled values holding them. Detectors name what flagged the
+// column: its name, value patterns or the NER provider.
+type DatasetPII struct {
+	DatasetID  int64           `db:"dataset_id" json:"dataset_id"`
+	ColumnName string          `db:"column_name" json:"column_name"`
+	Kinds      pq.StringArray  `db:"kinds" json:"kinds"`
+	Category   PrivacyCategory `db:"category" json:"category"`
+	Share      float64         `db:"share" json:"share"`
+	Detectors  pq.StringArray  `db:"detectors" json:"detectors"`
+	ScannedAt  time.Time       `db:"scanned_at" json:"scanned_at"`
+}
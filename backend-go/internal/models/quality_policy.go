@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Quality gate actions on output that fails its policy
+const (
+	// QualityGateRetry generates again with each fallback strategy in turn
+	// and fails the job when none passes
+	QualityGateRetry = "retry"
+	// QualityGateFail fails the job at once
+	QualityGateFail = "fail"
+)
+
+// Quality gate metrics
+const (
+	MetricStatisticalSimilarity = "statistical_similarity"
+	MetricCorrelationDrift      = "correlation_drift"
+	MetricPrivacyRisk           = "privacy_risk"
+	MetricQualityScore          = "quality_score"
+)
+
+// QualityPolicy is the quality a dataset's generated rows must reach to be
+// delivered. Unset thresholds are not checked.
+type QualityPolicy struct {
+	DatasetID int64 `db:"dataset_id" json:"dataset_id"`
+	// MinStatisticalSimilarity and MaxCorrelationDrift bound the fidelity
+	// of the rows to the source, drift being the largest change of any
+	// correlation
+	MinStatisticalSimilarity *float64 `db:"min_statistical_similarity" json:"min_statistical_similarity,omitempty"`
+	MaxCorrelationDrift      *float64 `db:"max_correlation_drift" json:"max_correlation_drift,omitempty"`
+	// MaxPrivacyRisk is the largest share of generated rows that may copy a
+	// source row
+	MaxPrivacyRisk  *float64 `db:"max_privacy_risk" json:"max_privacy_risk,omitempty"`
+	MinQualityScore *float64 `db:"min_quality_score" json:"min_quality_score,omitempty"`
+	OnFailure       string   `db:"on_failure" json:"on_failure"`
+	// FallbackStrategies are tried in order when OnFailure is retry
+	FallbackStrategies pq.StringArray `db:"fallback_strategies" json:"fallback_strategies"`
+	UpdatedBy          int64          `db:"updated_by" json:"updated_by"`
+	CreatedAt          time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt          time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// QualityGateReport records how a job's output was held to its dataset's
+// quality policy, one attempt per strategy tried
+type QualityGateReport struct {
+	Passed   bool                 `json:"passed"`
+	Attempts []QualityGateAttempt `json:"attempts"`
+}
+
+// QualityGateAttempt is one generation of the rows and its checks
+type QualityGateAttempt struct {
+	Strategy string             `json:"strategy"`
+	Provider string             `json:"provider"`
+	Model    string             `json:"model"`
+	Passed   bool               `json:"passed"`
+	Checks   []QualityGateCheck `json:"checks"`
+}
+
+// QualityGateCheck is one threshold checked. Value is nil when the metric
+// could not be measured, such as fidelity without source rows; such checks
+// pass.
+type QualityGateCheck struct {
+	Metric    string   `json:"metric"`
+	Threshold float64  `json:"threshold"`
+	Value     *float64 `json:"value"`
+	Passed    bool     `json:"passed"`
+	Message   string   `json:"message"`
+}
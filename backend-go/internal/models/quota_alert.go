@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// QuotaResource is a plan limit users are warned about as they approach it
+type QuotaResource string
+
+const (
+	QuotaMonthlyRows QuotaResource = "monthly_rows"
+	QuotaDatasets    QuotaResource = "datasets"
+)
+
+// QuotaAlert records that a user was warned of reaching a threshold, a
+// percentage of a limit, in the period starting at Period
+type QuotaAlert struct {
+	UserID    int64         `db:"user_id" json:"user_id"`
+	Resource  QuotaResource `db:"resource" json:"resource"`
+	Period    time.Time     `db:"period" json:"period"`
+	Threshold int           `db:"threshold" json:"threshold"`
+	Used      int64         `db:"used" json:"used"`
+	Limit     int64         `db:"limit_value" json:"limit"`
+	SentAt    time.Time     `db:"sent_at" json:"sent_at"`
+}
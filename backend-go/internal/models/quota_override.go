@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// QuotaOverride replaces limits of a user's plan, granted by staff for
+// support. A nil limit keeps the plan's; 0 lifts the row, dataset and
+// custom model limits. An override past ExpiresAt no longer applies.
+type QuotaOverride struct {
+	UserID          int64      `db:"user_id" json:"user_id"`
+	MonthlyRowLimit *int64     `db:"monthly_row_limit" json:"monthly_row_limit,omitempty"`
+	MaxDatasets     *int64     `db:"max_datasets" json:"max_datasets,omitempty"`
+	MaxCustomModels *int64     `db:"max_custom_models" json:"max_custom_models,omitempty"`
+	APIRateLimit    *int64     `db:"api_rate_limit" json:"api_rate_limit,omitempty"`
+	Reason          string     `db:"reason" json:"reason"`
+	GrantedBy       int64      `db:"granted_by" json:"granted_by"`
+	ExpiresAt       *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt       time.Time  `db:"updated_at" json:"updated_at"`
+}
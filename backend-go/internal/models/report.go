@@ -0,0 +1,81 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ReportSchedule is how often a report template is generated automatically
+type ReportSchedule string
+
+const (
+	ReportOnDemand ReportSchedule = ""
+	ReportDaily    ReportSchedule = "daily"
+	ReportWeekly   ReportSchedule = "weekly"
+	ReportMonthly  ReportSchedule = "monthly"
+)
+
+// ReportFilters restricts a report to events whose dimension equals a value
+type ReportFilters map[string]string
+
+// Value stores filters as a JSON object
+func (f ReportFilters) Value() (driver.Value, error) {
+	if f == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(f)
+	return string(b), err
+}
+
+// Scan reads filters stored as a JSON object
+func (f *ReportFilters) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*f = ReportFilters{}
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported report filters type %T", src)
+	}
+	return json.Unmarshal(raw, f)
+}
+
+// ReportTemplate is an admin-defined analytics report
+type ReportTemplate struct {
+	ID            int64          `db:"id" json:"id"`
+	Name          string         `db:"name" json:"name"`
+	Description   *string        `db:"description" json:"description,omitempty"`
+	Metrics       pq.StringArray `db:"metrics" json:"metrics"`
+	GroupBy       pq.StringArray `db:"group_by" json:"group_by"`
+	Filters       ReportFilters  `db:"filters" json:"filters"`
+	ChartType     string         `db:"chart_type" json:"chart_type"`
+	Period        string         `db:"period" json:"period"`
+	Schedule      ReportSchedule `db:"schedule" json:"schedule"`
+	EmailTo       pq.StringArray `db:"email_to" json:"email_to"`
+	WebhookURL    *string        `db:"webhook_url" json:"webhook_url,omitempty"`
+	WebhookSecret *string        `db:"webhook_secret" json:"-"`
+	CreatedBy     int64          `db:"created_by" json:"created_by"`
+	LastRunAt     *time.Time     `db:"last_run_at" json:"last_run_at,omitempty"`
+	NextRunAt     *time.Time     `db:"next_run_at" json:"next_run_at,omitempty"`
+	CreatedAt     time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// ReportRun records one generation of a report template
+type ReportRun struct {
+	ID         int64     `db:"id" json:"id"`
+	TemplateID int64     `db:"template_id" json:"template_id"`
+	Trigger    string    `db:"trigger" json:"trigger"`
+	Status     string    `db:"status" json:"status"`
+	Result     string    `db:"result" json:"-"` // JSON report
+	Error      *string   `db:"error" json:"error,omitempty"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// SLAReport records one subscriber's SLA attainment for a calendar month
+type SLAReport struct {
+	ID                 int64            `db:"id" json:"id"`
+	UserID             int64            `db:"user_id" json:"user_id"`
+	Month              time.Time        `db:"month" json:"month"`
+	SubscriptionTier   SubscriptionTier `db:"subscription_tier" json:"subscription_tier"`
+	AvailabilityTarget float64          `db:"availability_target" json:"availability_target"`
+	Availability       *float64         `db:"availability" json:"availability"`
+	P95LatencyTarget   float64          `db:"p95_latency_target" json:"p95_latency_target"`
+	P95LatencySeconds  *float64         `db:"p95_latency_seconds" json:"p95_latency_seconds"`
+	CompletedJobs      int64            `db:"completed_jobs" json:"completed_jobs"`
+	AvailabilityMet    bool             `db:"availability_met" json:"availability_met"`
+	LatencyMet         bool             `db:"latency_met" json:"latency_met"`
+	CreditPercent      float64          `db:"credit_percent" json:"credit_percent"`
+	CreditAmount       float64          `db:"credit_amount" json:"credit_amount"`
+	MonthlyFee         float64          `db:"monthly_fee" json:"monthly_fee"`
+	CreatedAt          time.Time        `db:"created_at" json:"created_at"`
+}
+
+// BillingCredit is an entry in a subscriber's billing credits ledger; credits
+// are applied against future invoices
+type BillingCredit struct {
+	ID        int64     `db:"id" json:"id"`
+	UserID    int64     `db:"user_id" json:"user_id"`
+	Amount    float64   `db:"amount" json:"amount"`
+	Currency  string    `db:"currency" json:"currency"`
+	Reason    string    `db:"reason" json:"reason"`
+	Source    string    `db:"source" json:"source"`
+	SourceID  string    `db:"source_id" json:"source_id"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Billing credit sources
+const (
+	CreditSourceSLA = "sla"
+)
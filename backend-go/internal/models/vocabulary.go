@@ -0,0 +1,74 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// VocabularyEntry is one approved value of a controlled vocabulary. Weight
+// sets how often it is drawn relative to the others when a column follows
+// the listed weights; entries without one weigh one.
+type VocabularyEntry struct {
+	Value  string   `json:"value"`
+	Label  string   `json:"label,omitempty"`
+	Weight *float64 `json:"weight,omitempty"`
+}
+
+// VocabularyEntries are the entries of a vocabulary, stored as a JSON array
+type VocabularyEntries []VocabularyEntry
+
+// Value stores entries as a JSON array
+func (e VocabularyEntries) Value() (driver.Value, error) {
+	if e == nil {
+		e = VocabularyEntries{}
+	}
+	b, err := json.Marshal(e)
+	return string(b), err
+}
+
+// Scan reads entries stored as a JSON array
+func (e *VocabularyEntries) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*e = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported vocabulary entries type %T", src)
+	}
+	return json.Unmarshal(raw, e)
+}
+
+// Vocabulary is a controlled vocabulary a user uploaded, such as ICD-10
+// codes, NAICS codes or internal product SKUs. Entries are only loaded when
+// a single vocabulary is read.
+type Vocabulary struct {
+	ID          int64             `db:"id" json:"id"`
+	OwnerID     int64             `db:"owner_id" json:"owner_id"`
+	Name        string            `db:"name" json:"name"`
+	Description *string           `db:"description" json:"description,omitempty"`
+	EntryCount  int               `db:"entry_count" json:"entry_count"`
+	Entries     VocabularyEntries `db:"entries" json:"entries,omitempty"`
+	CreatedAt   time.Time         `db:"created_at" json:"created_at"`
+}
+
+// ColumnVocabulary binds a dataset column to a vocabulary, so generated
+// values of the column are drawn from its entries by Weighting
+type ColumnVocabulary struct {
+	ID           int64     `db:"id" json:"id"`
+	DatasetID    int64     `db:"dataset_id" json:"dataset_id"`
+	ColumnName   string    `db:"column_name" json:"column_name"`
+	VocabularyID int64     `db:"vocabulary_id" json:"vocabulary_id"`
+	Weighting    string    `db:"weighting" json:"weighting"`
+	CreatedBy    int64     `db:"created_by" json:"created_by"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	// SourceCoverage is the share of the column's source values that are in
+	// the vocabulary, when the source was readable as the column was bound
+	SourceCoverage *float64 `db:"-" json:"source_coverage,omitempty"`
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// WarehouseSettings locate a warehouse destination. They are not secret;
+// the fields a kind does not use are empty.
+type WarehouseSettings struct {
+	// BigQuery
+	ProjectID string `json:"project_id,omitempty"`
+	Dataset   string `json:"dataset,omitempty"`
+	// Snowflake account identifier, such as myorg-myaccount
+	Account   string `json:"account,omitempty"`
+	Warehouse string `json:"warehouse,omitempty"`
+	Role      string `json:"role,omitempty"`
+	// Snowflake and Redshift
+	Database string `json:"database,omitempty"`
+	Schema   string `json:"schema,omitempty"`
+	User     string `json:"user,omitempty"`
+	// Redshift cluster endpoint
+	Host string `json:"host,omitempty"`
+	Port int    `json:"port,omitempty"`
+	// Table is the table jobs are loaded into unless an export names one
+	Table string `json:"table,omitempty"`
+}
+
+// Value stores settings as a JSON object
+func (s WarehouseSettings) Value() (driver.Value, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
+}
+
+// Scan reads settings stored as a JSON object
+func (s *WarehouseSettings) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*s = WarehouseSettings{}
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("unsupported warehouse settings type %T", src)
+	}
+	return json.Unmarshal(raw, s)
+}
+
+// WarehouseDestination is a user's BigQuery dataset, Snowflake schema or
+// Redshift database that jobs are exported to. Its credentials are sealed
+// with a data key wrapped under the output master key MasterKeyID and are
+// never returned.
+type WarehouseDestination struct {
+	ID          int64             `db:"id" json:"id"`
+	UserID      int64             `db:"user_id" json:"user_id"`
+	Name        string            `db:"name" json:"name"`
+	Kind        string            `db:"kind" json:"kind"`
+	Settings    WarehouseSettings `db:"settings" json:"settings"`
+	Credentials string            `db:"credentials" json:"-"`
+	WrappedKey  string            `db:"wrapped_key" json:"-"`
+	MasterKeyID string            `db:"master_key_id" json:"-"`
+	// AutoExport loads every job of the user into Settings.Table when it
+	// completes
+	AutoExport    bool       `db:"auto_export" json:"auto_export"`
+	LastTestedAt  *time.Time `db:"last_tested_at" json:"last_tested_at,omitempty"`
+	LastTestError *string    `db:"last_test_error" json:"last_test_error,omitempty"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// WarehouseDeliveryStatus tracks a delivery from queueing to its outcome
+type WarehouseDeliveryStatus string
+
+const (
+	WarehouseDeliveryPending   WarehouseDeliveryStatus = "pending"
+	WarehouseDeliveryDelivered WarehouseDeliveryStatus = "delivered"
+	WarehouseDeliveryFailed    WarehouseDeliveryStatus = "failed"
+)
+
+// WarehouseDelivery is one job's output queued for one destination, with
+// the outcome of its latest attempt
+type WarehouseDelivery struct {
+	ID            int64                   `db:"id" json:"id"`
+	DestinationID int64                   `db:"destination_id" json:"destination_id"`
+	JobID         int64                   `db:"job_id" json:"job_id"`
+	UserID        int64                   `db:"user_id" json:"user_id"`
+	TableName     string                  `db:"table_name" json:"table"`
+	Status        WarehouseDeliveryStatus `db:"status" json:"status"`
+	Attempts      int                     `db:"attempts" json:"attempts"`
+	NextAttemptAt time.Time               `db:"next_attempt_at" json:"next_attempt_at"`
+	RowsLoaded    int64                   `db:"rows_loaded" json:"rows_loaded"`
+	LastError     *string                 `db:"last_error" json:"last_error,omitempty"`
+	DeliveredAt   *time.Time              `db:"delivered_at" json:"delivered_at,omitempty"`
+	CreatedAt     time.Time               `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// WebhookEndpoint is a URL a user registered to receive events. Deliveries
+// are signed with Secret, which is only shown when the endpoint is created.
+type WebhookEndpoint struct {
+	ID          int64          `db:"id" json:"id"`
+	UserID      int64          `db:"user_id" json:"user_id"`
+	URL         string         `db:"url" json:"url"`
+	Description *string        `db:"description" json:"description,omitempty"`
+	Events      pq.StringArray `db:"events" json:"events"`
+	Secret      string         `db:"secret" json:"-"`
+	Active      bool           `db:"active" json:"active"`
+	CreatedAt   time.Time      `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time      `db:"updated_at" json:"updated_at"`
+}
+
+// WebhookDeliveryStatus tracks a delivery from queueing to its outcome
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery is one event queued for one endpoint, with the outcome of
+// its latest attempt
+type WebhookDelivery struct {
+	ID            int64                 `db:"id" json:"id"`
+	EndpointID    int64                 `db:"endpoint_id" json:"endpoint_id"`
+	EventID       string                `db:"event_id" json:"event_id"`
+	EventType     string                `db:"event_type" json:"event_type"`
+	Payload       string                `db:"payload" json:"payload"`
+	Status        WebhookDeliveryStatus `db:"status" json:"status"`
+	Attempts      int                   `db:"attempts" json:"attempts"`
+	NextAttemptAt time.Time             `db:"next_attempt_at" json:"next_attempt_at"`
+	ResponseCode  *int                  `db:"response_code" json:"response_code,omitempty"`
+	LastError     *string               `db:"last_error" json:"last_error,omitempty"`
+	DeliveredAt   *time.Time            `db:"delivered_at" json:"delivered_at,omitempty"`
+	CreatedAt     time.Time             `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,212 @@
+// Package modelserving runs uploaded tabular generators, such as CTGAN or
+// TVAE exported to ONNX, TensorFlow or PyTorch, on an inference server
+// deployed next to the API. The server loads a model's artifact from object
+// storage by its key and samples rows from it; models never run in the API
+// process.
+package modelserving
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+)
+
+// DefaultTimeout bounds one call to the inference server
+const DefaultTimeout = 2 * time.Minute
+
+// DefaultFrameworks are the frameworks the inference server runs when the
+// configuration does not list them
+var DefaultFrameworks = []string{
+	string(models.CustomModelONNX),
+	string(models.CustomModelTensorFlow),
+	string(models.CustomModelPyTorch),
+}
+
+var (
+	// ErrNotConfigured is returned when no inference server is configured
+	ErrNotConfigured = errors.New("no model inference server is configured")
+	// ErrUnsupportedFramework is returned for models the inference server
+	// cannot run
+	ErrUnsupportedFramework = errors.New("the inference server does not run models of this framework")
+	// ErrNotReady is returned for models that are not ready or whose
+	// artifact was never stored
+	ErrNotReady = errors.New("custom model is not ready to serve")
+	// ErrRejected matches errors from requests the inference server refused;
+	// repeating them cannot succeed
+	ErrRejected = errors.New("inference server rejected the request")
+)
+
+// Model identifies an uploaded model and the artifact it is loaded from
+type Model struct {
+	ID        int64  `json:"id"`
+	Framework string `json:"framework"`
+	// Artifact is the storage key of the uploaded model file
+	Artifact string `json:"artifact"`
+	Version  string `json:"version,omitempty"`
+}
+
+// Name is the model name recorded on jobs generated with it
+func (m Model) Name() string {
+	return "custom-model-" + strconv.FormatInt(m.ID, 10)
+}
+
+// ModelFor returns the serving reference of a stored custom model
+func ModelFor(m *models.CustomModel) (Model, error) {
+	if m.Status != models.CustomModelReady || m.ModelS3Key == nil || *m.ModelS3Key == "" {
+		return Model{}, ErrNotReady
+	}
+	model := Model{ID: m.ID, Framework: string(m.ModelType), Artifact: *m.ModelS3Key}
+	if m.Version != nil {
+		model.Version = *m.Version
+	}
+	return model, nil
+}
+
+// Column is one column the generated rows must have
+type Column struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// Request asks a model for rows. The same seed draws the same rows.
+type Request struct {
+	Model   Model    `json:"model"`
+	Rows    int64    `json:"rows"`
+	Columns []Column `json:"columns,omitempty"`
+	Seed    int64    `json:"seed,omitempty"`
+}
+
+// Config configures the inference server client
+type Config struct {
+	// URL is the base URL of the inference server; empty disables serving
+	URL string
+	// Token, when set, is sent as a bearer token
+	Token   string
+	Timeout time.Duration
+	// Frameworks are the model frameworks the server runs
+	Frameworks []string
+	// Transport, when set, carries requests to the server
+	Transport http.RoundTripper
+}
+
+// Client calls the inference server. Generation calls are not retried;
+// the job queue retries failed jobs.
+type Client struct {
+	baseURL    string
+	token      string
+	frameworks []string
+	http       *http.Client
+}
+
+// New returns a client for the configured server, or nil when no URL is set
+func New(cfg Config) (*Client, error) {
+	if cfg.URL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid model serving URL %q", cfg.URL)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if len(cfg.Frameworks) == 0 {
+		cfg.Frameworks = DefaultFrameworks
+	}
+	return &Client{
+		baseURL:    strings.TrimSuffix(cfg.URL, "/"),
+		token:      cfg.Token,
+		frameworks: cfg.Frameworks,
+		http:       &http.Client{Timeout: cfg.Timeout, Transport: cfg.Transport},
+	}, nil
+}
+
+// Supports reports whether the server runs models of the framework
+func (c *Client) Supports(framework string) bool {
+	return c != nil && slices.Contains(c.frameworks, framework)
+}
+
+// Generate samples rows from a model
+func (c *Client) Generate(ctx context.Context, req Request) ([]map[string]interface{}, error) {
+	if c == nil {
+		return nil, ErrNotConfigured
+	}
+	if !c.Supports(req.Model.Framework) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFramework, req.Model.Framework)
+	}
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := fmt.Sprintf("%s/v1/models/%d/generate", c.baseURL, req.Model.ID)
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("model serving: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, parseError(resp)
+	}
+	var out struct {
+		Rows []map[string]interface{} `json:"rows"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("model serving: malformed response: %w", err)
+	}
+	return out.Rows, nil
+}
+
+// Error is an error response from the inference server
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("model serving: %d: %s", e.StatusCode, e.Message)
+}
+
+// Retryable reports whether the request may succeed if repeated: server
+// errors and rate limits
+func (e *Error) Retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Is matches ErrRejected for errors that are not retryable
+func (e *Error) Is(target error) bool {
+	return target == ErrRejected && !e.Retryable()
+}
+
+func parseError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	var body struct {
+		Error string `json:"error"`
+	}
+	msg := strings.TrimSpace(string(raw))
+	if json.Unmarshal(raw, &body) == nil && body.Error != "" {
+		msg = body.Error
+	}
+	return &Error{StatusCode: resp.StatusCode, Message: redact.String(msg)}
+}
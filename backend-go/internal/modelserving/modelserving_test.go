@@ -0,0 +1,98 @@
+// Package modelserving_test provides unit tests for the model serving client
+package modelserving_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/modelserving"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	var got modelserving.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/models/7/generate", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		rows := make([]map[string]interface{}, got.Rows)
+		for i := range rows {
+			rows[i] = map[string]interface{}{"age": float64(30 + i)}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"rows": rows})
+	}))
+	defer srv.Close()
+
+	c, err := modelserving.New(modelserving.Config{URL: srv.URL + "/", Token: "secret"})
+	require.NoError(t, err)
+	model := modelserving.Model{ID: 7, Framework: "onnx", Artifact: "custom-models/1/7/ctgan.onnx"}
+	rows, err := c.Generate(context.Background(), modelserving.Request{Model: model, Rows: 3, Seed: 11,
+		Columns: []modelserving.Column{{Name: "age", Type: "integer"}}})
+	require.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Equal(t, model, got.Model)
+	assert.Equal(t, int64(11), got.Seed)
+	assert.Equal(t, "age", got.Columns[0].Name)
+}
+
+func TestGenerateErrors(t *testing.T) {
+	status := http.StatusUnprocessableEntity
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"error":"columns do not match the model"}`))
+	}))
+	defer srv.Close()
+
+	c, err := modelserving.New(modelserving.Config{URL: srv.URL})
+	require.NoError(t, err)
+	req := modelserving.Request{Model: modelserving.Model{ID: 1, Framework: "pytorch"}, Rows: 1}
+
+	_, err = c.Generate(context.Background(), req)
+	assert.ErrorIs(t, err, modelserving.ErrRejected)
+	assert.ErrorContains(t, err, "columns do not match the model")
+
+	status = http.StatusServiceUnavailable
+	_, err = c.Generate(context.Background(), req)
+	var serr *modelserving.Error
+	require.True(t, errors.As(err, &serr))
+	assert.True(t, serr.Retryable())
+	assert.NotErrorIs(t, err, modelserving.ErrRejected)
+
+	req.Model.Framework = "scikit_learn"
+	_, err = c.Generate(context.Background(), req)
+	assert.ErrorIs(t, err, modelserving.ErrUnsupportedFramework)
+
+	var none *modelserving.Client
+	_, err = none.Generate(context.Background(), req)
+	assert.ErrorIs(t, err, modelserving.ErrNotConfigured)
+}
+
+func TestNew(t *testing.T) {
+	c, err := modelserving.New(modelserving.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+	_, err = modelserving.New(modelserving.Config{URL: "inference:8080"})
+	assert.Error(t, err)
+}
+
+func TestModelFor(t *testing.T) {
+	key, version := "custom-models/1/7/tvae.pt", "2"
+	m := &models.CustomModel{ID: 7, ModelType: models.CustomModelPyTorch, Status: models.CustomModelReady, ModelS3Key: &key, Version: &version}
+	model, err := modelserving.ModelFor(m)
+	require.NoError(t, err)
+	assert.Equal(t, modelserving.Model{ID: 7, Framework: "pytorch", Artifact: key, Version: "2"}, model)
+	assert.Equal(t, "custom-model-7", model.Name())
+
+	m.Status = models.CustomModelValidating
+	_, err = modelserving.ModelFor(m)
+	assert.ErrorIs(t, err, modelserving.ErrNotReady)
+	m.Status, m.ModelS3Key = models.CustomModelReady, nil
+	_, err = modelserving.ModelFor(m)
+	assert.ErrorIs(t, err, modelserving.ErrNotReady)
+}
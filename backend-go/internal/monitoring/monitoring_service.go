@@ -416,6 +416,26 @@ func (ms *MonitoringService) GetHealthChecks() map[string]*HealthCheck {
 	return healthChecks
 }
 
+// Healthy reports whether the named health checks last passed; with no names
+// it considers every check. A check that has never run counts as unhealthy.
+func (ms *MonitoringService) Healthy(names ...string) bool {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	if len(names) == 0 {
+		for name := range ms.healthChecks {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		healthCheck, ok := ms.healthChecks[name]
+		if !ok || healthCheck.Status != "healthy" {
+			return false
+		}
+	}
+	return true
+}
+
 // GetSystemMetrics returns system-level metrics
 func (ms *MonitoringService) GetSystemMetrics() map[string]float64 {
 	var m runtime.MemStats
@@ -0,0 +1,101 @@
+package multitable
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// ManifestFile is the name of the manifest in a bundle
+const ManifestFile = "manifest.json"
+
+// Manifest describes the files of a bundle and how their tables relate
+type Manifest struct {
+	Format        string                   `json:"format"`
+	FileFormat    string                   `json:"file_format"`
+	Tables        []ManifestTable          `json:"tables"`
+	Relationships []ManifestRelationship   `json:"relationships"`
+	Integrity     *models.MultiTableReport `json:"integrity"`
+}
+
+type ManifestTable struct {
+	Name       string   `json:"name"`
+	File       string   `json:"file"`
+	Rows       int      `json:"rows"`
+	PrimaryKey string   `json:"primary_key,omitempty"`
+	Columns    []string `json:"columns"`
+}
+
+// ManifestRelationship is a foreign key: Child's Column holds values of
+// Parent's References column
+type ManifestRelationship struct {
+	Parent     string `json:"parent"`
+	References string `json:"references"`
+	Child      string `json:"child"`
+	Column     string `json:"column"`
+}
+
+// Bundle writes a job's tables as a zip of one file per table, in the
+// plan's file format, and a manifest, parents first
+func Bundle(plan *agents.MultiTablePlan, tables map[string][]map[string]any, report *models.MultiTableReport) ([]byte, error) {
+	format := plan.FileFormat
+	if format == "" {
+		format = export.CSV
+	}
+	manifest := Manifest{Format: Format, FileFormat: format, Integrity: report}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, t := range plan.Tables {
+		rows := tables[t.Name]
+		file := t.Name + "." + export.Extension(format)
+		w, err := zw.Create(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := export.Encode(format, w, rows); err != nil {
+			return nil, fmt.Errorf("failed to write table %s: %w", t.Name, err)
+		}
+		schema := export.InferSchema(rows)
+		columns := make([]string, len(schema))
+		for i, col := range schema {
+			columns[i] = col.Name
+		}
+		manifest.Tables = append(manifest.Tables, ManifestTable{
+			Name:       t.Name,
+			File:       file,
+			Rows:       len(rows),
+			PrimaryKey: t.PrimaryKey,
+			Columns:    columns,
+		})
+	}
+	keys := make(map[string]string, len(plan.Tables))
+	for _, t := range plan.Tables {
+		keys[t.Name] = t.PrimaryKey
+	}
+	for _, fk := range plan.Relationships {
+		manifest.Relationships = append(manifest.Relationships, ManifestRelationship{
+			Parent:     fk.Parent,
+			References: keys[fk.Parent],
+			Child:      fk.Child,
+			Column:     fk.Column,
+		})
+	}
+	w, err := zw.Create(ManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
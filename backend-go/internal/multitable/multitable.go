@@ -0,0 +1,546 @@
+// Package multitable generates related tables together instead of one flat
+// table: parents before the children that reference them, with every
+// foreign key pointing at a generated parent and the number of children per
+// parent following the source's. Keys are assigned after each table's rows
+// are generated, so integrity never depends on the provider. The tables are
+// delivered as one zip bundle with a manifest of their files, keys and
+// integrity checks.
+package multitable
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Format is the output format of multi-table jobs
+const Format = "multi_table"
+
+const (
+	// MaxTables caps the tables of one job
+	MaxTables = 10
+	// MaxChildren caps the children of one parent
+	MaxChildren = 1000
+)
+
+var (
+	ErrNoTables              = errors.New("at least one table is required")
+	ErrTooManyTables         = errors.New("too many tables")
+	ErrInvalidTable          = errors.New("invalid table")
+	ErrDuplicateTable        = errors.New("table names must be unique")
+	ErrUnknownTable          = errors.New("relationship names an unknown table")
+	ErrInvalidRelationship   = errors.New("invalid relationship")
+	ErrPrimaryKeyRequired    = errors.New("a parent table needs a primary key")
+	ErrRowsRequired          = errors.New("a table without parents needs rows")
+	ErrChildRows             = errors.New("the rows of a child table follow its parents")
+	ErrCycle                 = errors.New("relationships form a cycle")
+	ErrInvalidCardinality    = errors.New("children_per_parent must map counts from 0 to 1000 to non-negative shares")
+	ErrUnsupportedFileFormat = errors.New("unsupported file format")
+	// ErrIntegrity is returned for tables whose keys do not hold; the job
+	// is retried like one whose rows broke any other rule
+	ErrIntegrity = errors.New("referential integrity check failed")
+)
+
+// tableName is what a table may be called, as it names a file
+var tableName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,62}$`)
+
+// TableOptions is one table of a job: the dataset it is generated from, its
+// primary key column and, for a table without parents, its rows
+type TableOptions struct {
+	Name       string `json:"name"`
+	DatasetID  int64  `json:"dataset_id"`
+	PrimaryKey string `json:"primary_key,omitempty"`
+	Rows       int64  `json:"rows,omitempty"`
+}
+
+// RelationshipOptions makes Child's ForeignKey column reference Parent's
+// primary key. ChildrenPerParent overrides the shares of parents with each
+// number of children profiled from the source.
+type RelationshipOptions struct {
+	Parent            string          `json:"parent"`
+	Child             string          `json:"child"`
+	ForeignKey        string          `json:"foreign_key"`
+	ChildrenPerParent map[int]float64 `json:"children_per_parent,omitempty"`
+}
+
+// Options is a multi-table job as requested
+type Options struct {
+	Tables        []TableOptions        `json:"tables"`
+	Relationships []RelationshipOptions `json:"relationships"`
+	// FileFormat is the format of each table's file; csv when unset
+	FileFormat string `json:"file_format,omitempty"`
+}
+
+// Validate checks the tables and relationships form a valid schema
+func (o Options) Validate() error {
+	if len(o.Tables) == 0 {
+		return ErrNoTables
+	}
+	if len(o.Tables) > MaxTables {
+		return fmt.Errorf("%w: at most %d", ErrTooManyTables, MaxTables)
+	}
+	if o.FileFormat != "" && !export.Supported(o.FileFormat) {
+		return fmt.Errorf("%w %q", ErrUnsupportedFileFormat, o.FileFormat)
+	}
+	tables := make(map[string]TableOptions, len(o.Tables))
+	for _, t := range o.Tables {
+		if !tableName.MatchString(t.Name) || t.DatasetID <= 0 || t.Rows < 0 {
+			return fmt.Errorf("%w: %s", ErrInvalidTable, strconv.Quote(t.Name))
+		}
+		if _, ok := tables[t.Name]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateTable, t.Name)
+		}
+		tables[t.Name] = t
+	}
+	children := map[string]bool{}
+	columns := map[string]bool{}
+	for _, r := range o.Relationships {
+		parent, ok := tables[r.Parent]
+		if _, known := tables[r.Child]; !ok || !known {
+			return fmt.Errorf("%w: %s -> %s", ErrUnknownTable, r.Child, r.Parent)
+		}
+		if r.Parent == r.Child || strings.TrimSpace(r.ForeignKey) == "" || columns[r.Child+"."+r.ForeignKey] {
+			return fmt.Errorf("%w: %s.%s -> %s", ErrInvalidRelationship, r.Child, r.ForeignKey, r.Parent)
+		}
+		if parent.PrimaryKey == "" {
+			return fmt.Errorf("%w: %s", ErrPrimaryKeyRequired, r.Parent)
+		}
+		if len(r.ChildrenPerParent) > 0 && !validShares(r.ChildrenPerParent) {
+			return ErrInvalidCardinality
+		}
+		children[r.Child] = true
+		columns[r.Child+"."+r.ForeignKey] = true
+	}
+	for _, t := range o.Tables {
+		if children[t.Name] && t.Rows > 0 {
+			return fmt.Errorf("%w: %s", ErrChildRows, t.Name)
+		}
+		if !children[t.Name] && t.Rows == 0 {
+			return fmt.Errorf("%w: %s", ErrRowsRequired, t.Name)
+		}
+	}
+	_, err := o.Order()
+	return err
+}
+
+func validShares(shares map[int]float64) bool {
+	total := 0.0
+	for n, share := range shares {
+		if n < 0 || n > MaxChildren || share < 0 || math.IsNaN(share) || math.IsInf(share, 0) {
+			return false
+		}
+		total += share
+	}
+	return total > 0
+}
+
+// Order returns the tables with every parent before its children, otherwise
+// in the order they were given
+func (o Options) Order() ([]TableOptions, error) {
+	parents := make(map[string]map[string]bool, len(o.Tables))
+	for _, r := range o.Relationships {
+		if parents[r.Child] == nil {
+			parents[r.Child] = map[string]bool{}
+		}
+		parents[r.Child][r.Parent] = true
+	}
+	placed := make(map[string]bool, len(o.Tables))
+	out := make([]TableOptions, 0, len(o.Tables))
+	for len(out) < len(o.Tables) {
+		progressed := false
+		for _, t := range o.Tables {
+			if placed[t.Name] {
+				continue
+			}
+			ready := true
+			for p := range parents[t.Name] {
+				ready = ready && placed[p]
+			}
+			if ready {
+				placed[t.Name] = true
+				out = append(out, t)
+				progressed = true
+				break
+			}
+		}
+		if !progressed {
+			return nil, ErrCycle
+		}
+	}
+	return out, nil
+}
+
+// EstimatedRows is how many rows a job will generate across its tables,
+// expecting each parent to have the mean number of children
+func EstimatedRows(plan *agents.MultiTablePlan) int64 {
+	rows := make(map[string]float64, len(plan.Tables))
+	total := 0.0
+	for _, t := range plan.Tables {
+		n := float64(t.Rows)
+		if fk := primaryForeignKey(plan, t.Name); fk != nil {
+			n = rows[fk.Parent] * mean(fk.ChildrenPerParent)
+		}
+		rows[t.Name] = n
+		total += n
+	}
+	return int64(math.Ceil(total))
+}
+
+// Profile measures how many children the parents of a source sample have:
+// the share of sampled parents with each number of child rows referencing
+// their key, capped at MaxChildren. It is nil when no child references a
+// sampled parent, as the samples then say nothing of the relationship.
+func Profile(parents, children []map[string]any, primaryKey, foreignKey string) map[int]float64 {
+	counts := map[string]int{}
+	for _, row := range children {
+		if k := keyText(row[foreignKey]); k != "" {
+			counts[k]++
+		}
+	}
+	seen := map[string]bool{}
+	bySize := map[int]int{}
+	linked := false
+	for _, row := range parents {
+		k := keyText(row[primaryKey])
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		n := min(counts[k], MaxChildren)
+		linked = linked || n > 0
+		bySize[n]++
+	}
+	if !linked {
+		return nil
+	}
+	shares := make(map[int]float64, len(bySize))
+	for n, parents := range bySize {
+		shares[n] = round(float64(parents) / float64(len(seen)))
+	}
+	return shares
+}
+
+// Apply sets the plan of a multi-table job on req and tells the generation
+// of each table which of its columns are keys. Key values are assigned
+// afterwards, so the provider is only asked to fill them plausibly.
+func Apply(req *agents.GenerationRequest, plan *agents.MultiTablePlan) {
+	if plan == nil {
+		return
+	}
+	req.MultiTable = plan
+	for _, t := range plan.Tables {
+		if t.Request == nil {
+			continue
+		}
+		if t.PrimaryKey != "" {
+			t.Request.SchemaAnalysis.Constraints = append(t.Request.SchemaAnalysis.Constraints, fmt.Sprintf(
+				"%s is the primary key of the %s table: every row has a distinct value", t.PrimaryKey, t.Name))
+		}
+		for _, fk := range plan.Relationships {
+			if fk.Child != t.Name {
+				continue
+			}
+			t.Request.SchemaAnalysis.Constraints = append(t.Request.SchemaAnalysis.Constraints, fmt.Sprintf(
+				"%s references the %s table; its values are assigned after generation", fk.Column, fk.Parent))
+		}
+	}
+}
+
+// Linker assigns the keys of a job's tables as they are generated, in the
+// plan's order
+type Linker struct {
+	plan       *agents.MultiTablePlan
+	rng        *rand.Rand
+	keys       map[string][]any
+	slots      map[string][]any
+	renumbered map[string]bool
+}
+
+func NewLinker(plan *agents.MultiTablePlan, seed int64) *Linker {
+	return &Linker{
+		plan:       plan,
+		rng:        rand.New(rand.NewSource(seed)),
+		keys:       map[string][]any{},
+		slots:      map[string][]any{},
+		renumbered: map[string]bool{},
+	}
+}
+
+// Rows returns how many rows a table is generated with: its own for a table
+// without parents, otherwise as many as the children drawn for every row of
+// the parent its first foreign key references. Parents must be linked first.
+func (l *Linker) Rows(t agents.MultiTableSpec) int64 {
+	fk := primaryForeignKey(l.plan, t.Name)
+	if fk == nil {
+		return t.Rows
+	}
+	var slots []any
+	for _, key := range l.keys[fk.Parent] {
+		for n := l.draw(fk.ChildrenPerParent); n > 0; n-- {
+			slots = append(slots, key)
+		}
+	}
+	l.slots[t.Name] = slots
+	return int64(len(slots))
+}
+
+// Link assigns the keys of a table's generated rows and returns the rows
+// kept. Primary keys are kept when every row has a distinct one and are
+// numbered from 1 otherwise. The first foreign key takes the parents drawn
+// by Rows; rows the generator did not deliver remove children from random
+// parents rather than from the last ones. Other foreign keys are drawn from
+// their parents' keys with the same shares of children.
+func (l *Linker) Link(t agents.MultiTableSpec, rows []map[string]any) []map[string]any {
+	first := primaryForeignKey(l.plan, t.Name)
+	if fk := first; fk != nil {
+		slots := l.slots[t.Name]
+		if len(rows) > len(slots) {
+			rows = rows[:len(slots)]
+		}
+		if len(rows) < len(slots) {
+			keep := l.rng.Perm(len(slots))[:len(rows)]
+			sort.Ints(keep)
+			kept := make([]any, len(keep))
+			for i, j := range keep {
+				kept[i] = slots[j]
+			}
+			slots = kept
+		}
+		for i, row := range rows {
+			row[fk.Column] = slots[i]
+		}
+	}
+	for i := range l.plan.Relationships {
+		fk := &l.plan.Relationships[i]
+		if fk.Child != t.Name || fk == first {
+			continue
+		}
+		parents := l.keys[fk.Parent]
+		var pool []any
+		for _, key := range parents {
+			for n := l.draw(fk.ChildrenPerParent); n > 0 && len(pool) < len(rows); n-- {
+				pool = append(pool, key)
+			}
+		}
+		l.rng.Shuffle(len(pool), func(i, j int) { pool[i], pool[j] = pool[j], pool[i] })
+		for i, row := range rows {
+			switch {
+			case i < len(pool):
+				row[fk.Column] = pool[i]
+			case len(parents) > 0:
+				row[fk.Column] = parents[l.rng.Intn(len(parents))]
+			default:
+				row[fk.Column] = nil
+			}
+		}
+	}
+	if t.PrimaryKey != "" {
+		keys := make([]any, len(rows))
+		seen := make(map[string]bool, len(rows))
+		distinct := true
+		for i, row := range rows {
+			keys[i] = row[t.PrimaryKey]
+			k := keyText(keys[i])
+			distinct = distinct && k != "" && !seen[k]
+			seen[k] = true
+		}
+		if !distinct {
+			for i, row := range rows {
+				keys[i] = int64(i + 1)
+				row[t.PrimaryKey] = keys[i]
+			}
+			l.renumbered[t.Name] = true
+		}
+		l.keys[t.Name] = keys
+	}
+	return rows
+}
+
+// Renumbered reports whether a table's primary keys were replaced
+func (l *Linker) Renumbered(table string) bool {
+	return l.renumbered[table]
+}
+
+// draw samples a number of children from their shares; one when unset
+func (l *Linker) draw(shares map[int]float64) int {
+	if len(shares) == 0 {
+		return 1
+	}
+	counts := make([]int, 0, len(shares))
+	total := 0.0
+	for n, share := range shares {
+		counts = append(counts, n)
+		total += share
+	}
+	sort.Ints(counts)
+	x := l.rng.Float64() * total
+	for _, n := range counts {
+		if x -= shares[n]; x < 0 {
+			return n
+		}
+	}
+	return counts[len(counts)-1]
+}
+
+// Check verifies the keys of a job's tables hold: primary keys present and
+// distinct, and every foreign key naming a row of its parent. The report
+// also compares the children per parent with their targets.
+func Check(plan *agents.MultiTablePlan, tables map[string][]map[string]any, renumbered func(string) bool) (*models.MultiTableReport, error) {
+	report := &models.MultiTableReport{}
+	keys := make(map[string]map[string]bool, len(plan.Tables))
+	failed := false
+	for _, t := range plan.Tables {
+		rows := tables[t.Name]
+		tr := models.TableReport{Name: t.Name, Rows: int64(len(rows)), PrimaryKey: t.PrimaryKey}
+		if renumbered != nil {
+			tr.Renumbered = renumbered(t.Name)
+		}
+		if t.PrimaryKey != "" {
+			seen := make(map[string]bool, len(rows))
+			for _, row := range rows {
+				k := keyText(row[t.PrimaryKey])
+				switch {
+				case k == "":
+					tr.MissingKeys++
+				case seen[k]:
+					tr.DuplicateKeys++
+				}
+				seen[k] = true
+			}
+			keys[t.Name] = seen
+			failed = failed || tr.MissingKeys > 0 || tr.DuplicateKeys > 0
+		}
+		report.Tables = append(report.Tables, tr)
+	}
+	for _, fk := range plan.Relationships {
+		parents := keys[fk.Parent]
+		fr := models.ForeignKeyReport{
+			Parent:             fk.Parent,
+			Child:              fk.Child,
+			Column:             fk.Column,
+			Parents:            int64(len(parents)),
+			TargetMeanChildren: round(mean(fk.ChildrenPerParent)),
+		}
+		counts := map[string]int{}
+		for _, row := range tables[fk.Child] {
+			k := keyText(row[fk.Column])
+			if k == "" {
+				continue
+			}
+			if !parents[k] {
+				fr.Orphans++
+				continue
+			}
+			counts[k]++
+			fr.Children++
+		}
+		failed = failed || fr.Orphans > 0
+		if len(parents) > 0 {
+			bySize := map[int]int{}
+			for k := range parents {
+				n := counts[k]
+				bySize[n]++
+				fr.MaxChildren = max(fr.MaxChildren, n)
+			}
+			fr.ChildrenPerParent = make(map[int]float64, len(bySize))
+			for n, c := range bySize {
+				fr.ChildrenPerParent[n] = round(float64(c) / float64(len(parents)))
+			}
+			fr.MeanChildren = round(float64(fr.Children) / float64(len(parents)))
+			if len(fk.ChildrenPerParent) > 0 {
+				f := round(1 - distance(fr.ChildrenPerParent, fk.ChildrenPerParent))
+				fr.CardinalityFidelity = &f
+			}
+		}
+		report.Relationships = append(report.Relationships, fr)
+	}
+	if failed {
+		return report, ErrIntegrity
+	}
+	return report, nil
+}
+
+// primaryForeignKey is a table's first foreign key, which sets its rows
+func primaryForeignKey(plan *agents.MultiTablePlan, table string) *agents.ForeignKey {
+	for i := range plan.Relationships {
+		if plan.Relationships[i].Child == table {
+			return &plan.Relationships[i]
+		}
+	}
+	return nil
+}
+
+// mean is the mean number of children of normalized shares; one when unset
+func mean(shares map[int]float64) float64 {
+	if len(shares) == 0 {
+		return 1
+	}
+	sum, total := 0.0, 0.0
+	for n, share := range shares {
+		sum += float64(n) * share
+		total += share
+	}
+	if total == 0 {
+		return 0
+	}
+	return sum / total
+}
+
+// distance is the total variation distance between two sets of shares,
+// each normalized first
+func distance(a, b map[int]float64) float64 {
+	norm := func(m map[int]float64) map[int]float64 {
+		total := 0.0
+		for _, v := range m {
+			total += v
+		}
+		out := make(map[int]float64, len(m))
+		for k, v := range m {
+			if total > 0 {
+				out[k] = v / total
+			}
+		}
+		return out
+	}
+	na, nb := norm(a), norm(b)
+	d := 0.0
+	for n, v := range na {
+		d += math.Abs(v - nb[n])
+	}
+	for n, v := range nb {
+		if _, ok := na[n]; !ok {
+			d += v
+		}
+	}
+	return d / 2
+}
+
+// keyText is a key as compared across tables, so 7 read from JSON and "7"
+// read from CSV are the same key; blank for a missing key
+func keyText(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case json.Number:
+		return x.String()
+	}
+	return fmt.Sprint(v)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
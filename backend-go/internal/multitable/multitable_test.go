@@ -0,0 +1,210 @@
+// Package multitable_test provides unit tests for multi-table generation
+package multitable_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/multitable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func options() multitable.Options {
+	return multitable.Options{
+		Tables: []multitable.TableOptions{
+			{Name: "orders", DatasetID: 2, PrimaryKey: "order_id"},
+			{Name: "customers", DatasetID: 1, PrimaryKey: "customer_id", Rows: 50},
+			{Name: "items", DatasetID: 3},
+			{Name: "products", DatasetID: 4, PrimaryKey: "sku", Rows: 20},
+		},
+		Relationships: []multitable.RelationshipOptions{
+			{Parent: "customers", Child: "orders", ForeignKey: "customer_id"},
+			{Parent: "orders", Child: "items", ForeignKey: "order_id"},
+			{Parent: "products", Child: "items", ForeignKey: "sku"},
+		},
+	}
+}
+
+func TestOrder(t *testing.T) {
+	order, err := options().Order()
+	require.NoError(t, err)
+	names := make([]string, len(order))
+	for i, o := range order {
+		names[i] = o.Name
+	}
+	assert.Equal(t, []string{"customers", "orders", "products", "items"}, names)
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, options().Validate())
+	cases := map[string]struct {
+		edit func(*multitable.Options)
+		err  error
+	}{
+		"no tables":        {func(o *multitable.Options) { o.Tables = nil }, multitable.ErrNoTables},
+		"duplicate table":  {func(o *multitable.Options) { o.Tables[2].Name = "orders" }, multitable.ErrDuplicateTable},
+		"unsafe name":      {func(o *multitable.Options) { o.Tables[2].Name = "../items" }, multitable.ErrInvalidTable},
+		"unknown table":    {func(o *multitable.Options) { o.Relationships[0].Parent = "people" }, multitable.ErrUnknownTable},
+		"no primary key":   {func(o *multitable.Options) { o.Tables[1].PrimaryKey = "" }, multitable.ErrPrimaryKeyRequired},
+		"root rows":        {func(o *multitable.Options) { o.Tables[3].Rows = 0 }, multitable.ErrRowsRequired},
+		"child rows":       {func(o *multitable.Options) { o.Tables[2].Rows = 10 }, multitable.ErrChildRows},
+		"file format":      {func(o *multitable.Options) { o.FileFormat = "fhir" }, multitable.ErrUnsupportedFileFormat},
+		"same foreign key": {func(o *multitable.Options) { o.Relationships[2].ForeignKey = "order_id" }, multitable.ErrInvalidRelationship},
+		"cardinality": {func(o *multitable.Options) {
+			o.Relationships[0].ChildrenPerParent = map[int]float64{-1: 1}
+		}, multitable.ErrInvalidCardinality},
+		"cycle": {func(o *multitable.Options) {
+			o.Tables[1].Rows = 0
+			o.Relationships = append(o.Relationships, multitable.RelationshipOptions{Parent: "orders", Child: "customers", ForeignKey: "last_order"})
+		}, multitable.ErrCycle},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			o := options()
+			tc.edit(&o)
+			assert.ErrorIs(t, o.Validate(), tc.err)
+		})
+	}
+}
+
+func TestProfile(t *testing.T) {
+	parents := []map[string]any{{"id": json.Number("1")}, {"id": json.Number("2")}, {"id": json.Number("3")}, {"id": json.Number("4")}}
+	children := []map[string]any{{"pid": "1"}, {"pid": "1"}, {"pid": "2"}, {"pid": "2"}, {"pid": "3"}, {"pid": nil}, {"pid": "9"}}
+	assert.Equal(t, map[int]float64{0: 0.25, 1: 0.25, 2: 0.5}, multitable.Profile(parents, children, "id", "pid"))
+	// Samples that do not overlap say nothing of the relationship
+	assert.Nil(t, multitable.Profile(parents, []map[string]any{{"pid": "9"}}, "id", "pid"))
+}
+
+func plan() *agents.MultiTablePlan {
+	return &agents.MultiTablePlan{
+		Tables: []agents.MultiTableSpec{
+			{Name: "customers", PrimaryKey: "customer_id", Rows: 200},
+			{Name: "products", PrimaryKey: "sku", Rows: 10},
+			{Name: "orders", PrimaryKey: "order_id"},
+		},
+		Relationships: []agents.ForeignKey{
+			{Parent: "customers", Child: "orders", Column: "customer_id", ChildrenPerParent: map[int]float64{0: 0.2, 1: 0.3, 3: 0.5}},
+			{Parent: "products", Child: "orders", Column: "sku"},
+		},
+		FileFormat: "csv",
+	}
+}
+
+// generated stands in for a generator: rows with a repeated key column
+func generated(n int64, key string) []map[string]any {
+	rows := make([]map[string]any, n)
+	for i := range rows {
+		rows[i] = map[string]any{key: "dup", "value": float64(i)}
+	}
+	return rows
+}
+
+func link(p *agents.MultiTablePlan, shortfall int64) (map[string][]map[string]any, *multitable.Linker) {
+	l := multitable.NewLinker(p, 42)
+	tables := map[string][]map[string]any{}
+	for _, spec := range p.Tables {
+		n := l.Rows(spec)
+		// Only child tables come back short
+		if spec.Rows == 0 {
+			n = max(n-shortfall, 0)
+		}
+		rows := generated(n, spec.PrimaryKey)
+		if spec.Name == "products" {
+			for i, row := range rows {
+				row["sku"] = fmt.Sprintf("SKU-%d", i)
+			}
+		}
+		tables[spec.Name] = l.Link(spec, rows)
+	}
+	return tables, l
+}
+
+func TestLinkPreservesIntegrityAndCardinality(t *testing.T) {
+	p := plan()
+	tables, l := link(p, 0)
+	report, err := multitable.Check(p, tables, l.Renumbered)
+	require.NoError(t, err)
+
+	// Repeated generated keys are renumbered, distinct ones kept
+	assert.True(t, report.Tables[0].Renumbered)
+	assert.False(t, report.Tables[1].Renumbered)
+	assert.Equal(t, "SKU-0", tables["products"][0]["sku"])
+	assert.Equal(t, int64(1), tables["customers"][0]["customer_id"])
+
+	byCustomer := report.Relationships[0]
+	assert.Zero(t, byCustomer.Orphans)
+	assert.Equal(t, int64(200), byCustomer.Parents)
+	assert.Equal(t, byCustomer.Children, int64(len(tables["orders"])))
+	assert.Equal(t, 1.8, byCustomer.TargetMeanChildren)
+	assert.InDelta(t, 1.8, byCustomer.MeanChildren, 0.3)
+	require.NotNil(t, byCustomer.CardinalityFidelity)
+	assert.Greater(t, *byCustomer.CardinalityFidelity, 0.85)
+	for n := range byCustomer.ChildrenPerParent {
+		assert.Contains(t, []int{0, 1, 3}, n)
+	}
+	assert.Zero(t, report.Relationships[1].Orphans)
+	assert.Equal(t, int64(len(tables["orders"])), report.Relationships[1].Children)
+}
+
+func TestLinkWithFewerRowsThanDrawn(t *testing.T) {
+	p := plan()
+	tables, l := link(p, 30)
+	report, err := multitable.Check(p, tables, l.Renumbered)
+	require.NoError(t, err)
+	assert.Zero(t, report.Relationships[0].Orphans)
+	assert.Zero(t, report.Relationships[1].Orphans)
+	assert.LessOrEqual(t, report.Relationships[0].MaxChildren, 3)
+}
+
+func TestCheckFindsOrphans(t *testing.T) {
+	p := plan()
+	tables, _ := link(p, 0)
+	tables["orders"][0]["customer_id"] = int64(9999)
+	tables["products"][1]["sku"] = "SKU-0"
+	report, err := multitable.Check(p, tables, nil)
+	assert.ErrorIs(t, err, multitable.ErrIntegrity)
+	assert.Equal(t, int64(1), report.Relationships[0].Orphans)
+	assert.Equal(t, int64(1), report.Tables[1].DuplicateKeys)
+}
+
+func TestBundle(t *testing.T) {
+	p := plan()
+	tables, l := link(p, 0)
+	report, err := multitable.Check(p, tables, l.Renumbered)
+	require.NoError(t, err)
+	out, err := multitable.Bundle(p, tables, report)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		files[f.Name], err = io.ReadAll(r)
+		require.NoError(t, err)
+		r.Close()
+	}
+	assert.Len(t, files, 4)
+	assert.Contains(t, string(files["customers.csv"]), "customer_id,value\n1,0\n")
+
+	var manifest multitable.Manifest
+	require.NoError(t, json.Unmarshal(files[multitable.ManifestFile], &manifest))
+	assert.Equal(t, multitable.Format, manifest.Format)
+	assert.Equal(t, "csv", manifest.FileFormat)
+	require.Len(t, manifest.Tables, 3)
+	assert.Equal(t, multitable.ManifestTable{Name: "customers", File: "customers.csv", Rows: 200, PrimaryKey: "customer_id", Columns: []string{"customer_id", "value"}}, manifest.Tables[0])
+	assert.Equal(t, multitable.ManifestRelationship{Parent: "customers", References: "customer_id", Child: "orders", Column: "customer_id"}, manifest.Relationships[0])
+	assert.Zero(t, manifest.Integrity.Relationships[0].Orphans)
+}
+
+func TestEstimatedRows(t *testing.T) {
+	// 200 customers, 10 products and 1.8 orders per customer
+	assert.Equal(t, int64(570), multitable.EstimatedRows(plan()))
+}
@@ -0,0 +1,480 @@
+// Package nested supports columns holding JSON objects or arrays, whether
+// native in a JSON source or encoded as text in a CSV one. Such columns are
+// profiled for key frequency and value types, a JSON Schema is inferred from
+// the shapes observed, and generated values that do not validate against it
+// are dropped.
+package nested
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// JSON Schema types
+const (
+	TypeNull    = "null"
+	TypeBoolean = "boolean"
+	TypeInteger = "integer"
+	TypeNumber  = "number"
+	TypeString  = "string"
+	TypeObject  = "object"
+	TypeArray   = "array"
+)
+
+// Dialect is the JSON Schema draft inferred schemas declare
+const Dialect = "https://json-schema.org/draft/2020-12/schema"
+
+const (
+	// MinShare is the share of a column's non-empty values that must be JSON
+	// objects or arrays for it to be nested
+	MinShare = 0.9
+	// MaxDepth caps how deep shapes are profiled; deeper values are only
+	// typed
+	MaxDepth = 8
+	// MaxKeys caps the keys profiled per object; objects with more are left
+	// open to keys not profiled
+	MaxKeys = 200
+	// promptSchema caps the bytes of a schema written into a prompt; larger
+	// ones are cut to their top levels
+	promptSchema = 4000
+)
+
+// KeyStat describes one key path of a nested column, with array items at
+// paths ending in []. Frequency is the share of objects at the parent path
+// that carry the key, or for items the share of arrays that are not empty.
+type KeyStat struct {
+	Path      string           `json:"path"`
+	Count     int64            `json:"count"`
+	Frequency float64          `json:"frequency"`
+	Types     map[string]int64 `json:"types"`
+}
+
+// ColumnProfile is the profile of one nested column
+type ColumnProfile struct {
+	Column  string `json:"column"`
+	Encoded bool   `json:"encoded"`
+	// Values counts the column's JSON values; Empty its blank or null ones
+	Values int64              `json:"values"`
+	Empty  int64              `json:"empty"`
+	Types  map[string]int64   `json:"types"`
+	Keys   []KeyStat          `json:"keys"`
+	Schema *agents.JSONSchema `json:"schema"`
+}
+
+// node accumulates the shapes observed at one path
+type node struct {
+	seen    int64
+	types   map[string]int64
+	objects int64
+	arrays  int64
+	filled  int64
+	keys    map[string]*node
+	open    bool
+	items   *node
+}
+
+func newNode() *node {
+	return &node{types: make(map[string]int64)}
+}
+
+func (n *node) add(v interface{}, depth int) {
+	n.seen++
+	t := typeOf(v)
+	n.types[t]++
+	if depth >= MaxDepth {
+		return
+	}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		n.objects++
+		if n.keys == nil {
+			n.keys = make(map[string]*node)
+		}
+		for k, child := range x {
+			c, ok := n.keys[k]
+			if !ok {
+				if len(n.keys) >= MaxKeys {
+					n.open = true
+					continue
+				}
+				c = newNode()
+				n.keys[k] = c
+			}
+			c.add(child, depth+1)
+		}
+	case []interface{}:
+		n.arrays++
+		if len(x) > 0 {
+			n.filled++
+		}
+		for _, item := range x {
+			if n.items == nil {
+				n.items = newNode()
+			}
+			n.items.add(item, depth+1)
+		}
+	}
+}
+
+// schema returns the schema of the values observed at n. Objects only allow
+// the keys observed, and require those present in every one.
+func (n *node) schema() *agents.JSONSchema {
+	s := &agents.JSONSchema{}
+	for t := range n.types {
+		if t == TypeInteger && n.types[TypeNumber] > 0 {
+			continue
+		}
+		s.Type = append(s.Type, t)
+	}
+	sort.Strings(s.Type)
+	if n.keys != nil {
+		s.Properties = make(map[string]*agents.JSONSchema, len(n.keys))
+		for k, c := range n.keys {
+			s.Properties[k] = c.schema()
+			if c.seen == n.objects {
+				s.Required = append(s.Required, k)
+			}
+		}
+		sort.Strings(s.Required)
+		if !n.open {
+			closed := false
+			s.AdditionalProperties = &closed
+		}
+	}
+	if n.items != nil {
+		s.Items = n.items.schema()
+	}
+	return s
+}
+
+// stats appends the key paths under n
+func (n *node) stats(path string, out []KeyStat) []KeyStat {
+	for k, c := range n.keys {
+		p := path + "." + k
+		freq := 0.0
+		if n.objects > 0 {
+			freq = float64(c.seen) / float64(n.objects)
+		}
+		out = append(out, KeyStat{Path: p, Count: c.seen, Frequency: freq, Types: c.types})
+		out = c.stats(p, out)
+	}
+	if n.items != nil {
+		p := path + "[]"
+		out = append(out, KeyStat{Path: p, Count: n.items.seen, Frequency: float64(n.filled) / float64(n.arrays), Types: n.items.types})
+		out = n.items.stats(p, out)
+	}
+	return out
+}
+
+func typeOf(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return TypeNull
+	case bool:
+		return TypeBoolean
+	case float64:
+		if x == math.Trunc(x) && !math.IsInf(x, 0) {
+			return TypeInteger
+		}
+		return TypeNumber
+	case json.Number:
+		if _, err := x.Int64(); err == nil {
+			return TypeInteger
+		}
+		return TypeNumber
+	case int, int32, int64:
+		return TypeInteger
+	case float32:
+		return TypeNumber
+	case string:
+		return TypeString
+	case map[string]interface{}:
+		return TypeObject
+	case []interface{}:
+		return TypeArray
+	}
+	return TypeString
+}
+
+// decode returns a column value as a JSON object or array, and whether it
+// was encoded as text. ok is false for blank values and anything else.
+func decode(v interface{}) (value interface{}, encoded, ok bool) {
+	switch x := v.(type) {
+	case map[string]interface{}, []interface{}:
+		return x, false, true
+	case string:
+		s := strings.TrimSpace(x)
+		if s == "" || (s[0] != '{' && s[0] != '[') {
+			return nil, false, false
+		}
+		var out interface{}
+		if err := json.Unmarshal([]byte(s), &out); err != nil {
+			return nil, false, false
+		}
+		return out, true, true
+	}
+	return nil, false, false
+}
+
+func blank(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+// Profile returns the nested columns of sampled rows: those whose non-empty
+// values are mostly JSON objects or arrays. Values that are not are left out
+// of the shape.
+func Profile(columns []string, rows []map[string]interface{}) []ColumnProfile {
+	var out []ColumnProfile
+	for _, col := range columns {
+		root := newNode()
+		var empty, other, encoded int64
+		for _, row := range rows {
+			v, present := row[col]
+			if !present || blank(v) {
+				empty++
+				continue
+			}
+			value, enc, ok := decode(v)
+			if !ok {
+				other++
+				continue
+			}
+			if enc {
+				encoded++
+			}
+			root.add(value, 0)
+		}
+		if root.seen == 0 || float64(root.seen) < MinShare*float64(root.seen+other) {
+			continue
+		}
+		schema := root.schema()
+		schema.Dialect = Dialect
+		keys := root.stats("$", nil)
+		sort.Slice(keys, func(a, b int) bool { return keys[a].Path < keys[b].Path })
+		out = append(out, ColumnProfile{
+			Column:  col,
+			Encoded: encoded*2 > root.seen,
+			Values:  root.seen,
+			Empty:   empty,
+			Types:   root.types,
+			Keys:    keys,
+			Schema:  schema,
+		})
+	}
+	return out
+}
+
+// Columns turns profiles into the nested columns of a generation request
+func Columns(profiles []ColumnProfile) []agents.NestedColumn {
+	out := make([]agents.NestedColumn, 0, len(profiles))
+	for _, p := range profiles {
+		out = append(out, agents.NestedColumn{Column: p.Column, Encoded: p.Encoded, Nullable: p.Empty > 0, Schema: p.Schema})
+	}
+	return out
+}
+
+// Validate checks a value against a schema and returns the first mismatch
+// with its path
+func Validate(s *agents.JSONSchema, v interface{}) error {
+	return validate(s, v, "$")
+}
+
+func validate(s *agents.JSONSchema, v interface{}, path string) error {
+	if s == nil {
+		return nil
+	}
+	if len(s.Type) > 0 && !typeAllowed(s.Type, typeOf(v)) {
+		return fmt.Errorf("%s: expected %s, got %s", path, strings.Join(s.Type, " or "), typeOf(v))
+	}
+	switch x := v.(type) {
+	case map[string]interface{}:
+		for _, k := range s.Required {
+			if _, ok := x[k]; !ok {
+				return fmt.Errorf("%s: missing required key %q", path, k)
+			}
+		}
+		for k, child := range x {
+			ks, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					return fmt.Errorf("%s: unexpected key %q", path, k)
+				}
+				continue
+			}
+			if err := validate(ks, child, path+"."+k); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range x {
+			if err := validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func typeAllowed(allowed []string, t string) bool {
+	for _, a := range allowed {
+		if a == t || (a == TypeNumber && t == TypeInteger) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate returns a copy of a schema that keeps its shape to the given
+// depth, with deeper values only typed
+func truncate(s *agents.JSONSchema, depth int) *agents.JSONSchema {
+	if s == nil {
+		return nil
+	}
+	out := &agents.JSONSchema{Dialect: s.Dialect, Type: s.Type}
+	if depth <= 0 {
+		return out
+	}
+	out.Required = s.Required
+	out.AdditionalProperties = s.AdditionalProperties
+	if s.Properties != nil {
+		out.Properties = make(map[string]*agents.JSONSchema, len(s.Properties))
+		for k, p := range s.Properties {
+			out.Properties[k] = truncate(p, depth-1)
+		}
+	}
+	out.Items = truncate(s.Items, depth-1)
+	return out
+}
+
+// promptText renders a schema for a prompt, cut to its top levels when it
+// is too large
+func promptText(s *agents.JSONSchema) string {
+	for depth := MaxDepth; depth >= 0; depth-- {
+		b, err := json.Marshal(truncate(s, depth))
+		if err == nil && (len(b) <= promptSchema || depth == 0) {
+			return string(b)
+		}
+	}
+	return ""
+}
+
+// Apply adds nested columns to a generation request, as checks on the output
+// and as rules in the prompt. Schemas hold key names and types, never source
+// values. Restricted columns are left out: their shape describes data the
+// requester is not cleared for.
+func Apply(req *agents.GenerationRequest, columns []agents.NestedColumn) {
+	restricted := make(map[string]bool, len(req.RestrictedColumns))
+	for _, c := range req.RestrictedColumns {
+		restricted[strings.ToLower(c)] = true
+	}
+	for _, col := range columns {
+		if restricted[strings.ToLower(col.Column)] {
+			continue
+		}
+		req.SchemaAnalysis.NestedColumns = append(req.SchemaAnalysis.NestedColumns, col)
+		form := "a JSON value"
+		if col.Encoded {
+			form = "JSON text"
+		}
+		req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints,
+			fmt.Sprintf("%s holds %s that must validate against this JSON Schema: %s", col.Column, form, promptText(col.Schema)))
+	}
+}
+
+// Validator drops generated rows whose nested values do not match their
+// schema, and counts them for Report. Values it keeps are written in the
+// source's form: as JSON text for encoded columns, as objects otherwise.
+type Validator struct {
+	columns []agents.NestedColumn
+	checked []int64
+	invalid []int64
+}
+
+// NewValidator returns nil when there are no nested columns
+func NewValidator(columns []agents.NestedColumn) *Validator {
+	if len(columns) == 0 {
+		return nil
+	}
+	return &Validator{
+		columns: columns,
+		checked: make([]int64, len(columns)),
+		invalid: make([]int64, len(columns)),
+	}
+}
+
+// Filter returns the rows whose nested values all validate
+func (v *Validator) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if v == nil {
+		return rows
+	}
+	kept := rows[:0:0]
+	for _, row := range rows {
+		values := make([]interface{}, len(v.columns))
+		valid := true
+		for i, col := range v.columns {
+			v.checked[i]++
+			raw := row[col.Column]
+			if blank(raw) {
+				if !col.Nullable {
+					v.invalid[i]++
+					valid = false
+				}
+				continue
+			}
+			value, _, ok := decode(raw)
+			if !ok || Validate(col.Schema, value) != nil {
+				v.invalid[i]++
+				valid = false
+				continue
+			}
+			values[i] = value
+		}
+		if !valid {
+			continue
+		}
+		for i, col := range v.columns {
+			if values[i] == nil {
+				continue
+			}
+			if col.Encoded {
+				b, _ := json.Marshal(values[i])
+				row[col.Column] = string(b)
+			} else {
+				row[col.Column] = values[i]
+			}
+		}
+		kept = append(kept, row)
+	}
+	return kept
+}
+
+// Report returns the invalid values counted per column
+func (v *Validator) Report() []models.NestedColumnReport {
+	if v == nil {
+		return nil
+	}
+	out := make([]models.NestedColumnReport, len(v.columns))
+	for i, col := range v.columns {
+		validity := 1.0
+		if v.checked[i] > 0 {
+			validity = float64(v.checked[i]-v.invalid[i]) / float64(v.checked[i])
+		}
+		out[i] = models.NestedColumnReport{
+			Column:   col.Column,
+			Checked:  v.checked[i],
+			Invalid:  v.invalid[i],
+			Validity: validity,
+		}
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+// Package nested_test provides unit tests for nested JSON columns
+package nested_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/nested"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func csvRows() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"id": "1", "meta": `{"plan":"pro","seats":5,"tags":["a","b"],"address":{"city":"Oslo"}}`},
+		{"id": "2", "meta": `{"plan":"free","seats":1,"tags":[]}`},
+		{"id": "3", "meta": `{"plan":"pro","seats":2.5,"tags":["c"],"address":{"city":"Lima","zip":null}}`},
+		{"id": "4", "meta": ""},
+	}
+}
+
+func TestProfile(t *testing.T) {
+	profiles := nested.Profile([]string{"id", "meta"}, csvRows())
+	require.Len(t, profiles, 1, "only the JSON column is nested")
+	p := profiles[0]
+	assert.Equal(t, "meta", p.Column)
+	assert.True(t, p.Encoded)
+	assert.Equal(t, int64(3), p.Values)
+	assert.Equal(t, int64(1), p.Empty)
+
+	keys := make(map[string]nested.KeyStat)
+	for _, k := range p.Keys {
+		keys[k.Path] = k
+	}
+	assert.Equal(t, 1.0, keys["$.plan"].Frequency)
+	assert.InDelta(t, 2.0/3, keys["$.address"].Frequency, 1e-9)
+	assert.Equal(t, 0.5, keys["$.address.zip"].Frequency)
+	assert.Equal(t, int64(3), keys["$.tags[]"].Count)
+	assert.Equal(t, map[string]int64{"integer": 2, "number": 1}, keys["$.seats"].Types)
+
+	s := p.Schema
+	assert.Equal(t, nested.Dialect, s.Dialect)
+	assert.Equal(t, agents.SchemaTypes{"object"}, s.Type)
+	assert.Equal(t, []string{"plan", "seats", "tags"}, s.Required)
+	assert.Equal(t, agents.SchemaTypes{"number"}, s.Properties["seats"].Type)
+	assert.Equal(t, agents.SchemaTypes{"null"}, s.Properties["address"].Properties["zip"].Type)
+	assert.Equal(t, agents.SchemaTypes{"string"}, s.Properties["tags"].Items.Type)
+
+	raw, err := json.Marshal(s.Properties["plan"])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"type":"string"}`, string(raw))
+}
+
+func TestProfileSkipsMostlyScalarColumns(t *testing.T) {
+	rows := []map[string]interface{}{{"note": `{"a":1}`}, {"note": "plain text"}}
+	assert.Empty(t, nested.Profile([]string{"note"}, rows))
+}
+
+func TestValidate(t *testing.T) {
+	s := nested.Profile([]string{"meta"}, csvRows())[0].Schema
+	var ok, missing, extra, wrong interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"plan":"team","seats":9,"tags":["x"]}`), &ok))
+	require.NoError(t, json.Unmarshal([]byte(`{"plan":"team","tags":[]}`), &missing))
+	require.NoError(t, json.Unmarshal([]byte(`{"plan":"team","seats":1,"tags":[],"color":"red"}`), &extra))
+	require.NoError(t, json.Unmarshal([]byte(`{"plan":"team","seats":1,"tags":[3]}`), &wrong))
+
+	assert.NoError(t, nested.Validate(s, ok))
+	assert.ErrorContains(t, nested.Validate(s, missing), `missing required key "seats"`)
+	assert.ErrorContains(t, nested.Validate(s, extra), `unexpected key "color"`)
+	assert.ErrorContains(t, nested.Validate(s, wrong), "$.tags[0]")
+}
+
+func TestValidatorFilter(t *testing.T) {
+	cols := nested.Columns(nested.Profile([]string{"meta"}, csvRows()))
+	v := nested.NewValidator(cols)
+	kept := v.Filter([]map[string]interface{}{
+		{"meta": map[string]interface{}{"plan": "pro", "seats": 3.0, "tags": []interface{}{}}},
+		{"meta": `{"plan":"pro","seats":"three","tags":[]}`},
+		{"meta": "not json"},
+		{"meta": nil},
+	})
+	require.Len(t, kept, 2)
+	assert.JSONEq(t, `{"plan":"pro","seats":3,"tags":[]}`, kept[0]["meta"].(string), "encoded columns are written as JSON text")
+
+	report := v.Report()
+	require.Len(t, report, 1)
+	assert.Equal(t, int64(4), report[0].Checked)
+	assert.Equal(t, int64(2), report[0].Invalid)
+	assert.Equal(t, 0.5, report[0].Validity)
+}
+
+func TestApplySkipsRestrictedColumns(t *testing.T) {
+	cols := nested.Columns(nested.Profile([]string{"meta"}, csvRows()))
+	req := &agents.GenerationRequest{RestrictedColumns: []string{"META"}}
+	nested.Apply(req, cols)
+	assert.Empty(t, req.SchemaAnalysis.NestedColumns)
+
+	req = &agents.GenerationRequest{}
+	nested.Apply(req, cols)
+	require.Len(t, req.SchemaAnalysis.Constraints, 1)
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], `"required":["plan","seats","tags"]`)
+	assert.NotContains(t, req.SchemaAnalysis.Constraints[0], "Oslo")
+}
@@ -0,0 +1,322 @@
+// Package notifications delivers user notifications by email. Critical
+// notifications, and anything in the security or billing categories, are
+// sent at once; everything else is deduplicated and batched into hourly or
+// daily digests according to each user's preference.
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/consent"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"go.uber.org/zap"
+)
+
+// Store persists notifications and delivery preferences
+type Store interface {
+	// Record stores n as pending, or folds it into a notification with the
+	// same dedupe key created within window. It reports whether n was folded.
+	Record(ctx context.Context, n *models.Notification, window time.Duration) (*models.Notification, bool, error)
+	SetStatus(ctx context.Context, ids []int64, status models.NotificationStatus) error
+	Preference(ctx context.Context, userID int64) (*models.NotificationPreference, error)
+	// SentSince counts non-critical notifications sent one by one to a user
+	SentSince(ctx context.Context, userID int64, since time.Time) (int, error)
+	PendingUsers(ctx context.Context) ([]int64, error)
+	Pending(ctx context.Context, userID int64) ([]models.Notification, error)
+	MarkDigestSent(ctx context.Context, userID int64, at time.Time) error
+}
+
+// Mailer sends notification emails
+type Mailer interface {
+	SendNotificationEmail(to, subject, body string) error
+	SendDigestEmail(to, subject, summary string) error
+}
+
+// Users resolves notification recipients
+type Users interface {
+	GetByID(ctx context.Context, id int64) (*models.User, error)
+}
+
+// Consents tells whether a user agreed to a kind of optional email
+type Consents interface {
+	Granted(ctx context.Context, userID int64, kind models.ConsentKind) (bool, error)
+}
+
+var ErrNoRecipient = errors.New("notification recipient not found")
+
+// Config tunes deduplication and throttling
+type Config struct {
+	// DedupeWindow is how long repeats of a notification with the same
+	// dedupe key are folded into the first one
+	DedupeWindow time.Duration
+	// ImmediateLimit caps non-critical emails sent one by one to a user per
+	// hour; the rest wait for the next digest
+	ImmediateLimit int
+}
+
+func DefaultConfig() Config {
+	return Config{DedupeWindow: time.Hour, ImmediateLimit: 10}
+}
+
+// IsCritical reports whether a notification bypasses digests and dedupe
+func IsCritical(n *models.Notification) bool {
+	return n.Severity == models.NotificationCritical ||
+		n.Category == models.NotificationCategorySecurity ||
+		n.Category == models.NotificationCategoryBilling
+}
+
+// Service records notifications and delivers them
+type Service struct {
+	store    Store
+	mailer   Mailer
+	users    Users
+	consents Consents
+	cfg      Config
+	logger   *zap.Logger
+}
+
+func NewService(store Store, mailer Mailer, users Users, cfg Config, logger *zap.Logger) *Service {
+	def := DefaultConfig()
+	if cfg.DedupeWindow <= 0 {
+		cfg.DedupeWindow = def.DedupeWindow
+	}
+	if cfg.ImmediateLimit <= 0 {
+		cfg.ImmediateLimit = def.ImmediateLimit
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Service{store: store, mailer: mailer, users: users, cfg: cfg, logger: logger}
+}
+
+// SetConsents makes product and marketing notifications depend on the
+// user's email consent; without it they are delivered like any other
+func (s *Service) SetConsents(c Consents) { s.consents = c }
+
+// Notify records a notification and sends it if it is critical or the user
+// wants notifications immediately and is under the hourly limit. Repeats
+// within the dedupe window are only counted, and product or marketing
+// notifications the user has not consented to are kept but never sent.
+func (s *Service) Notify(ctx context.Context, n *models.Notification) error {
+	if n.Severity == "" {
+		n.Severity = models.NotificationInfo
+	}
+	if kind, ok := consent.ForCategory(n.Category); ok && s.consents != nil {
+		granted, err := s.consents.Granted(ctx, n.UserID, kind)
+		if err != nil {
+			return fmt.Errorf("failed to check email consent: %w", err)
+		}
+		if !granted {
+			rec, _, err := s.store.Record(ctx, n, 0)
+			if err != nil {
+				return fmt.Errorf("failed to record notification: %w", err)
+			}
+			return s.store.SetStatus(ctx, []int64{rec.ID}, models.NotificationSuppressed)
+		}
+	}
+	if IsCritical(n) {
+		n.Severity = models.NotificationCritical
+		n.DedupeKey = nil
+		rec, _, err := s.store.Record(ctx, n, 0)
+		if err != nil {
+			return fmt.Errorf("failed to record notification: %w", err)
+		}
+		return s.send(ctx, rec)
+	}
+
+	rec, folded, err := s.store.Record(ctx, n, s.cfg.DedupeWindow)
+	if err != nil {
+		return fmt.Errorf("failed to record notification: %w", err)
+	}
+	if folded {
+		return nil
+	}
+	pref, err := s.store.Preference(ctx, n.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to load notification preference: %w", err)
+	}
+	switch pref.Frequency {
+	case models.DigestOff:
+		return s.store.SetStatus(ctx, []int64{rec.ID}, models.NotificationSuppressed)
+	case models.DigestImmediate:
+		sent, err := s.store.SentSince(ctx, n.UserID, time.Now().Add(-time.Hour))
+		if err != nil {
+			return fmt.Errorf("failed to count sent notifications: %w", err)
+		}
+		if sent >= s.cfg.ImmediateLimit {
+			// Throttled; it goes out with the next hourly digest
+			return nil
+		}
+		return s.send(ctx, rec)
+	}
+	return nil
+}
+
+func (s *Service) send(ctx context.Context, n *models.Notification) error {
+	to, err := s.recipient(ctx, n.UserID)
+	if err == nil {
+		err = s.mailer.SendNotificationEmail(to, n.Title, n.Body)
+	}
+	status := models.NotificationSent
+	if err != nil {
+		status = models.NotificationFailed
+	}
+	if serr := s.store.SetStatus(ctx, []int64{n.ID}, status); serr != nil && err == nil {
+		err = serr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to send notification %d: %w", n.ID, err)
+	}
+	return nil
+}
+
+func (s *Service) recipient(ctx context.Context, userID int64) (string, error) {
+	u, err := s.users.GetByID(ctx, userID)
+	if err != nil || !u.IsActive {
+		return "", ErrNoRecipient
+	}
+	return u.Email, nil
+}
+
+// RunDigests sends a digest to every user with pending notifications whose
+// digest is due and returns the number of digests sent
+func (s *Service) RunDigests(ctx context.Context, now time.Time) (int, error) {
+	users, err := s.store.PendingUsers(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list pending notifications: %w", err)
+	}
+	sent := 0
+	for _, userID := range users {
+		pref, err := s.store.Preference(ctx, userID)
+		if err != nil {
+			return sent, fmt.Errorf("failed to load notification preference for user %d: %w", userID, err)
+		}
+		if !Due(pref, now) {
+			continue
+		}
+		items, err := s.store.Pending(ctx, userID)
+		if err != nil {
+			return sent, fmt.Errorf("failed to load pending notifications for user %d: %w", userID, err)
+		}
+		if len(items) == 0 {
+			continue
+		}
+		ids := make([]int64, len(items))
+		for i := range items {
+			ids[i] = items[i].ID
+		}
+		if pref.Frequency == models.DigestOff {
+			if err := s.store.SetStatus(ctx, ids, models.NotificationSuppressed); err != nil {
+				return sent, err
+			}
+			continue
+		}
+
+		to, err := s.recipient(ctx, userID)
+		if err == nil {
+			err = s.mailer.SendDigestEmail(to, DigestSubject(pref.Frequency, items), Digest(items))
+		}
+		if err != nil {
+			s.logger.Warn("failed to send notification digest", zap.Int64("user_id", userID), zap.Error(err))
+			continue
+		}
+		if err := s.store.SetStatus(ctx, ids, models.NotificationDigested); err != nil {
+			return sent, err
+		}
+		if err := s.store.MarkDigestSent(ctx, userID, now); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// Due reports whether a user's next digest should go out at now. Users
+// receiving notifications immediately get an hourly digest of whatever the
+// hourly limit held back; users who turned notifications off are always due
+// so their backlog is cleared.
+func Due(pref *models.NotificationPreference, now time.Time) bool {
+	if pref.Frequency == models.DigestOff || pref.LastDigestAt == nil {
+		return true
+	}
+	last := *pref.LastDigestAt
+	switch pref.Frequency {
+	case models.DigestDaily:
+		now = now.UTC()
+		slot := time.Date(now.Year(), now.Month(), now.Day(), pref.DailyHour, 0, 0, 0, time.UTC)
+		if slot.After(now) {
+			slot = slot.AddDate(0, 0, -1)
+		}
+		return last.Before(slot)
+	default:
+		return !now.Before(last.Add(time.Hour))
+	}
+}
+
+// DigestSubject summarizes a digest in one line
+func DigestSubject(freq models.DigestFrequency, items []models.Notification) string {
+	period := "Hourly"
+	if freq == models.DigestDaily {
+		period = "Daily"
+	}
+	total := 0
+	for _, n := range items {
+		total += occurrences(n)
+	}
+	noun := "notifications"
+	if total == 1 {
+		noun = "notification"
+	}
+	return fmt.Sprintf("%s digest: %d %s", period, total, noun)
+}
+
+// Digest renders notifications grouped by category, oldest first, with
+// repeats shown as a count
+func Digest(items []models.Notification) string {
+	byCategory := make(map[string][]models.Notification)
+	for _, n := range items {
+		byCategory[n.Category] = append(byCategory[n.Category], n)
+	}
+	categories := make([]string, 0, len(byCategory))
+	for c := range byCategory {
+		categories = append(categories, c)
+	}
+	sort.Strings(categories)
+
+	var b strings.Builder
+	for i, c := range categories {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		group := byCategory[c]
+		sort.SliceStable(group, func(i, j int) bool { return group[i].CreatedAt.Before(group[j].CreatedAt) })
+		label := c
+		if label == "" {
+			label = "general"
+		}
+		fmt.Fprintf(&b, "%s (%d)\n", strings.ToUpper(label[:1])+label[1:], len(group))
+		for _, n := range group {
+			fmt.Fprintf(&b, "- %s", n.Title)
+			if k := occurrences(n); k > 1 {
+				fmt.Fprintf(&b, " (x%d)", k)
+			}
+			if n.Body != "" {
+				fmt.Fprintf(&b, ": %s", n.Body)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
+}
+
+func occurrences(n models.Notification) int {
+	if n.Occurrences < 1 {
+		return 1
+	}
+	return n.Occurrences
+}
@@ -0,0 +1,55 @@
+// Package notifications_test provides unit tests for notification digests
+package notifications_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/notifications"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsCritical(t *testing.T) {
+	assert.True(t, notifications.IsCritical(&models.Notification{Category: models.NotificationCategorySecurity}))
+	assert.True(t, notifications.IsCritical(&models.Notification{Category: models.NotificationCategoryBilling, Severity: models.NotificationInfo}))
+	assert.True(t, notifications.IsCritical(&models.Notification{Category: models.NotificationCategoryJobs, Severity: models.NotificationCritical}))
+	assert.False(t, notifications.IsCritical(&models.Notification{Category: models.NotificationCategoryJobs, Severity: models.NotificationWarning}))
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 30, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(-d)
+		return &t
+	}
+
+	assert.True(t, notifications.Due(&models.NotificationPreference{Frequency: models.DigestHourly}, now))
+	assert.False(t, notifications.Due(&models.NotificationPreference{Frequency: models.DigestHourly, LastDigestAt: at(30 * time.Minute)}, now))
+	assert.True(t, notifications.Due(&models.NotificationPreference{Frequency: models.DigestHourly, LastDigestAt: at(time.Hour)}, now))
+	assert.False(t, notifications.Due(&models.NotificationPreference{Frequency: models.DigestImmediate, LastDigestAt: at(10 * time.Minute)}, now))
+
+	// Daily digests go out once the configured hour has passed
+	assert.True(t, notifications.Due(&models.NotificationPreference{Frequency: models.DigestDaily, DailyHour: 9, LastDigestAt: at(2 * time.Hour)}, now))
+	assert.False(t, notifications.Due(&models.NotificationPreference{Frequency: models.DigestDaily, DailyHour: 9, LastDigestAt: at(20 * time.Minute)}, now))
+	assert.False(t, notifications.Due(&models.NotificationPreference{Frequency: models.DigestDaily, DailyHour: 10, LastDigestAt: at(20 * time.Hour)}, now))
+	assert.True(t, notifications.Due(&models.NotificationPreference{Frequency: models.DigestDaily, DailyHour: 10, LastDigestAt: at(25 * time.Hour)}, now))
+}
+
+func TestDigest(t *testing.T) {
+	base := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	items := []models.Notification{
+		{Category: "jobs", Title: "Generation failed for dataset 4", Body: "Job 12 failed: timeout", Occurrences: 3, CreatedAt: base.Add(time.Minute)},
+		{Category: "reports", Title: "Weekly usage ready", CreatedAt: base},
+		{Category: "jobs", Title: "Generation job 9 completed", Occurrences: 1, CreatedAt: base},
+	}
+
+	assert.Equal(t, "Jobs (2)\n"+
+		"- Generation job 9 completed\n"+
+		"- Generation failed for dataset 4 (x3): Job 12 failed: timeout\n"+
+		"\n"+
+		"Reports (1)\n"+
+		"- Weekly usage ready\n", notifications.Digest(items))
+	assert.Equal(t, "Daily digest: 5 notifications", notifications.DigestSubject(models.DigestDaily, items))
+	assert.Equal(t, "Hourly digest: 1 notification", notifications.DigestSubject(models.DigestHourly, items[1:2]))
+}
@@ -0,0 +1,385 @@
+// Package openapi builds an OpenAPI 3.1 document from the routes an app
+// serves, so client SDKs can be generated from what is actually routed
+// rather than from a hand-kept list. Routes carry their method, path and
+// handler; operations registered for them add summaries, request bodies and
+// responses, whose schemas are reflected from Go types by their json tags.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Version is the OpenAPI version of built documents
+const Version = "3.1.0"
+
+// Route is one method and path an app serves. Path uses Fiber's syntax,
+// such as /jobs/:id or /debug/*, relative to the server URL.
+type Route struct {
+	Method string
+	Path   string
+	// Handler is the handler that answers the route; its name becomes the
+	// operation ID when it is a named function or method
+	Handler any
+}
+
+// Operation describes what one route takes and returns, beyond its path
+type Operation struct {
+	Summary string
+	// Request is a value of the JSON body's type; nil for none
+	Request any
+	// Upload names the file field of a multipart/form-data body. Request
+	// then describes the other fields.
+	Upload string
+	// Response is a value of the JSON body returned on success; nil
+	// documents an object of unspecified shape
+	Response any
+	// Status is the success status; zero means 200
+	Status int
+	// Raw documents a body that is not JSON, such as a file download, by
+	// its content type
+	Raw string
+	// Public operations need no credentials
+	Public bool
+	// Params overrides the schema types of path parameters by name
+	Params map[string]string
+	// Hidden routes are left out, such as the methods a route answers only
+	// because it was registered for all of them
+	Hidden bool
+}
+
+// Info describes the API a document is for
+type Info struct {
+	Title       string
+	Version     string
+	Description string
+	Server      string
+}
+
+// Document is an OpenAPI document, ready to be encoded as JSON
+type Document map[string]any
+
+// Builder builds documents from routes
+type Builder struct {
+	Info Info
+	// Operations are keyed by upper-case method and OpenAPI path, such as
+	// "GET /jobs/{id}"
+	Operations map[string]Operation
+	// Summaries are used for routes whose operation has none, keyed like
+	// Operations
+	Summaries map[string]string
+}
+
+var (
+	paramPattern = regexp.MustCompile(`:([A-Za-z0-9_]+)(<[^>]*>)?\??`)
+	wildcards    = strings.NewReplacer("*", "{path}", "+", "{path}")
+)
+
+// Path converts a Fiber path to an OpenAPI path and returns the names of its
+// parameters in order. Wildcards become a parameter named path, and trailing
+// slashes are dropped.
+func Path(fiberPath string) (string, []string) {
+	var params []string
+	p := paramPattern.ReplaceAllStringFunc(fiberPath, func(m string) string {
+		name := paramPattern.FindStringSubmatch(m)[1]
+		params = append(params, name)
+		return "{" + name + "}"
+	})
+	if strings.ContainsAny(p, "*+") {
+		p = wildcards.Replace(p)
+		params = append(params, "path")
+	}
+	if len(p) > 1 {
+		p = strings.TrimRight(p, "/")
+	}
+	return p, params
+}
+
+// Build returns the document for routes. Routes are deduplicated by method
+// and path, HEAD routes are left out, and every operation gets a unique ID.
+func (b Builder) Build(routes []Route) Document {
+	schemas := newSchemas()
+	schemas.ref(reflect.TypeOf(Error{}))
+
+	paths := map[string]map[string]any{}
+	ids := map[string]bool{}
+	tags := map[string]bool{}
+	sorted := append([]Route(nil), routes...)
+	// Sorted so operation IDs do not depend on the order routes were added
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return sorted[i].Method < sorted[j].Method
+	})
+	for _, r := range sorted {
+		method := strings.ToLower(r.Method)
+		if !documented[method] {
+			continue
+		}
+		path, params := Path(r.Path)
+		key := strings.ToUpper(method) + " " + path
+		op := b.Operations[key]
+		if op.Hidden {
+			continue
+		}
+		if paths[path] == nil {
+			paths[path] = map[string]any{}
+		}
+		if _, dup := paths[path][method]; dup {
+			continue
+		}
+		tag := tagOf(path)
+		tags[tag] = true
+
+		out := map[string]any{
+			"operationId": uniqueID(ids, handlerID(r.Handler), method, path),
+			"tags":        []string{tag},
+			"responses":   responses(schemas, op),
+		}
+		if summary := op.Summary; summary != "" {
+			out["summary"] = summary
+		} else if summary := b.Summaries[key]; summary != "" {
+			out["summary"] = summary
+		}
+		if len(params) > 0 {
+			out["parameters"] = pathParams(params, op.Params)
+		}
+		if body := requestBody(schemas, op); body != nil {
+			out["requestBody"] = body
+		}
+		if op.Public {
+			out["security"] = []any{}
+		}
+		paths[path][method] = out
+	}
+
+	tagList := make([]map[string]any, 0, len(tags))
+	for _, t := range sortedKeys(tags) {
+		tagList = append(tagList, map[string]any{"name": t})
+	}
+	info := map[string]any{"title": b.Info.Title, "version": b.Info.Version}
+	if b.Info.Description != "" {
+		info["description"] = b.Info.Description
+	}
+	doc := Document{
+		"openapi": Version,
+		"info":    info,
+		"paths":   paths,
+		"tags":    tagList,
+		"components": map[string]any{
+			"schemas": schemas.defs,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"apiKey":     map[string]any{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []string{}}, map[string]any{"apiKey": []string{}}},
+	}
+	if b.Info.Server != "" {
+		doc["servers"] = []any{map[string]any{"url": b.Info.Server}}
+	}
+	return doc
+}
+
+// Error is the body of every error response
+type Error struct {
+	// Error is a stable snake_case code clients can switch on
+	Error   string `json:"error"`
+	Message string `json:"message,omitempty"`
+}
+
+// documented are the methods operations are built for
+var documented = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true, "patch": true,
+}
+
+func responses(s *schemas, op Operation) map[string]any {
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := map[string]any{"description": http.StatusText(status)}
+	switch {
+	case status == http.StatusNoContent:
+	case op.Raw != "":
+		ok["content"] = map[string]any{op.Raw: map[string]any{"schema": map[string]any{"type": "string", "contentMediaType": op.Raw}}}
+	case op.Response != nil:
+		ok["content"] = jsonContent(s.of(reflect.TypeOf(op.Response)))
+	default:
+		ok["content"] = jsonContent(map[string]any{"type": "object"})
+	}
+	return map[string]any{
+		strconv.Itoa(status): ok,
+		"default":            map[string]any{"description": "Error", "content": jsonContent(s.ref(reflect.TypeOf(Error{})))},
+	}
+}
+
+func requestBody(s *schemas, op Operation) map[string]any {
+	if op.Upload != "" {
+		schema := map[string]any{"type": "object"}
+		if op.Request != nil {
+			schema = s.inline(reflect.TypeOf(op.Request))
+		}
+		props, _ := schema["properties"].(map[string]any)
+		if props == nil {
+			props = map[string]any{}
+		}
+		props[op.Upload] = map[string]any{"type": "string", "contentMediaType": "application/octet-stream"}
+		schema["properties"] = props
+		schema["required"] = appendUnique(schema["required"], op.Upload)
+		return map[string]any{"required": true, "content": map[string]any{"multipart/form-data": map[string]any{"schema": schema}}}
+	}
+	if op.Request == nil {
+		return nil
+	}
+	return map[string]any{"required": true, "content": jsonContent(s.of(reflect.TypeOf(op.Request)))}
+}
+
+func pathParams(names []string, types map[string]string) []any {
+	out := make([]any, 0, len(names))
+	for _, name := range names {
+		schema := map[string]any{"type": "string"}
+		if t, ok := types[name]; ok {
+			schema = map[string]any{"type": t}
+			if t == "integer" {
+				schema["format"] = "int64"
+			}
+		} else if isID(name) {
+			schema = map[string]any{"type": "integer", "format": "int64"}
+		}
+		out = append(out, map[string]any{"name": name, "in": "path", "required": true, "schema": schema})
+	}
+	return out
+}
+
+// isID reports whether a parameter is named as a numeric ID: id, userId or
+// user_id
+func isID(name string) bool {
+	return name == "id" || strings.HasSuffix(name, "Id") || strings.HasSuffix(name, "_id")
+}
+
+func jsonContent(schema any) map[string]any {
+	return map[string]any{"application/json": map[string]any{"schema": schema}}
+}
+
+// tagOf groups an operation by the first segment of its path
+func tagOf(path string) string {
+	seg := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+	if seg == "" || strings.HasPrefix(seg, "{") {
+		return "default"
+	}
+	return seg
+}
+
+// handlerID returns the operation ID a handler's name gives, such as
+// getOutputBucket for OrgDeps.GetOutputBucket; closures give none
+func handlerID(h any) string {
+	if h == nil {
+		return ""
+	}
+	v := reflect.ValueOf(h)
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return ""
+	}
+	fn := runtime.FuncForPC(v.Pointer())
+	if fn == nil {
+		return ""
+	}
+	name := fn.Name()
+	name = name[strings.LastIndex(name, ".")+1:]
+	name = strings.TrimSuffix(name, "-fm")
+	if name == "" || strings.HasPrefix(name, "func") || !isIdent(name) {
+		return ""
+	}
+	return lowerFirst(name)
+}
+
+// pathID returns an operation ID made of the method and the segments of a
+// path, such as postGenerationIdCancel
+func pathID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(method)
+	for _, seg := range strings.FieldsFunc(path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		b.WriteString(upperFirst(seg))
+	}
+	return b.String()
+}
+
+// uniqueID returns the handler's ID when it is not taken, and otherwise one
+// made from the path, numbered if that is taken too
+func uniqueID(taken map[string]bool, fromHandler, method, path string) string {
+	id := fromHandler
+	if id == "" || taken[id] {
+		id = pathID(method, path)
+	}
+	for n, base := 2, id; taken[id]; n++ {
+		id = base + strconv.Itoa(n)
+	}
+	taken[id] = true
+	return id
+}
+
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !unicode.IsLetter(r) && r != '_' && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+func lowerFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	// Leading initialisms are lowered whole: APIKeys becomes apiKeys
+	r := []rune(s)
+	i := 0
+	for i < len(r) && unicode.IsUpper(r[i]) {
+		i++
+	}
+	if i > 1 && i < len(r) {
+		i--
+	}
+	for j := 0; j < i || j == 0; j++ {
+		r[j] = unicode.ToLower(r[j])
+	}
+	return string(r)
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+func appendUnique(list any, name string) []string {
+	names, _ := list.([]string)
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
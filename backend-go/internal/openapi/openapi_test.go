@@ -0,0 +1,139 @@
+// Package openapi_test provides unit tests for OpenAPI document generation
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type jobs struct{}
+
+func (jobs) GetJob() {}
+
+func (jobs) CancelJob() {}
+
+type startRequest struct {
+	DatasetID int64    `json:"dataset_id"`
+	Rows      int      `json:"rows"`
+	Prompt    *string  `json:"prompt,omitempty"`
+	Columns   []string `json:"columns"`
+	internal  string
+}
+
+type audit struct {
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type job struct {
+	audit
+	ID      int64          `json:"id"`
+	Status  string         `json:"status"`
+	Parent  *job           `json:"parent"`
+	Details map[string]any `json:"details,omitempty"`
+	Skipped string         `json:"-"`
+}
+
+func TestPath(t *testing.T) {
+	p, params := openapi.Path("/generation/:id/artifacts/:name")
+	assert.Equal(t, "/generation/{id}/artifacts/{name}", p)
+	assert.Equal(t, []string{"id", "name"}, params)
+
+	p, params = openapi.Path("/admin/debug/pprof/*")
+	assert.Equal(t, "/admin/debug/pprof/{path}", p)
+	assert.Equal(t, []string{"path"}, params)
+
+	p, _ = openapi.Path("/orgs/")
+	assert.Equal(t, "/orgs", p)
+}
+
+// encoded round-trips a document through JSON, as it is served
+func encoded(t *testing.T, doc openapi.Document) map[string]any {
+	t.Helper()
+	b, err := json.Marshal(doc)
+	require.NoError(t, err)
+	var out map[string]any
+	require.NoError(t, json.Unmarshal(b, &out))
+	return out
+}
+
+func TestBuild(t *testing.T) {
+	var h jobs
+	b := openapi.Builder{
+		Info: openapi.Info{Title: "Test API", Version: "v1", Server: "/api/v1"},
+		Operations: map[string]openapi.Operation{
+			"POST /jobs":           {Summary: "Start a job", Request: startRequest{}, Response: job{}, Status: http.StatusAccepted},
+			"GET /jobs/{id}":       {Response: job{}},
+			"GET /public/{token}":  {Public: true},
+			"POST /public/{token}": {Hidden: true},
+			"POST /uploads": {Upload: "file", Request: struct {
+				RetentionDays int `json:"retention_days,omitempty"`
+			}{}},
+		},
+		Summaries: map[string]string{"GET /jobs/{id}": "Get a job", "POST /jobs": "ignored"},
+	}
+	doc := encoded(t, b.Build([]openapi.Route{
+		{Method: "GET", Path: "/jobs/:id", Handler: h.GetJob},
+		{Method: "HEAD", Path: "/jobs/:id", Handler: h.GetJob},
+		{Method: "POST", Path: "/jobs", Handler: func() {}},
+		{Method: "POST", Path: "/jobs/:id/cancel", Handler: h.CancelJob},
+		{Method: "DELETE", Path: "/jobs/:id", Handler: h.CancelJob},
+		{Method: "GET", Path: "/public/:token"},
+		{Method: "POST", Path: "/public/:token"},
+		{Method: "POST", Path: "/uploads"},
+	}))
+
+	assert.Equal(t, "3.1.0", doc["openapi"])
+	paths := doc["paths"].(map[string]any)
+	require.Len(t, paths, 5)
+
+	get := paths["/jobs/{id}"].(map[string]any)["get"].(map[string]any)
+	assert.Equal(t, "getJob", get["operationId"])
+	assert.Equal(t, "Get a job", get["summary"])
+	assert.Equal(t, []any{"jobs"}, get["tags"])
+	param := get["parameters"].([]any)[0].(map[string]any)
+	assert.Equal(t, "id", param["name"])
+	assert.Equal(t, "integer", param["schema"].(map[string]any)["type"])
+	assert.NotContains(t, paths["/jobs/{id}"], "head")
+
+	// Handler names are used once; closures and repeats are named by path
+	start := paths["/jobs"].(map[string]any)["post"].(map[string]any)
+	assert.Equal(t, "postJobs", start["operationId"])
+	assert.Equal(t, "Start a job", start["summary"])
+	assert.Contains(t, start["responses"], "202")
+	assert.Equal(t, "cancelJob", paths["/jobs/{id}"].(map[string]any)["delete"].(map[string]any)["operationId"])
+	assert.Equal(t, "postJobsIdCancel", paths["/jobs/{id}/cancel"].(map[string]any)["post"].(map[string]any)["operationId"])
+
+	public := paths["/public/{token}"].(map[string]any)["get"].(map[string]any)
+	assert.Equal(t, []any{}, public["security"])
+	assert.NotContains(t, paths["/public/{token}"], "post")
+	assert.Equal(t, "string", public["parameters"].([]any)[0].(map[string]any)["schema"].(map[string]any)["type"])
+	assert.NotContains(t, get, "security", "operations without their own security use the document's")
+
+	upload := paths["/uploads"].(map[string]any)["post"].(map[string]any)["requestBody"].(map[string]any)
+	form := upload["content"].(map[string]any)["multipart/form-data"].(map[string]any)["schema"].(map[string]any)
+	assert.Contains(t, form["properties"], "file")
+	assert.Contains(t, form["properties"], "retention_days")
+	assert.Equal(t, []any{"file"}, form["required"])
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	require.Contains(t, schemas, "Error")
+	req := schemas["startRequest"].(map[string]any)
+	assert.ElementsMatch(t, []any{"dataset_id", "rows", "columns"}, req["required"])
+	props := req["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string"}, props["prompt"])
+	assert.Equal(t, []any{"array", "null"}, props["columns"].(map[string]any)["type"])
+	assert.NotContains(t, props, "internal")
+
+	jobSchema := schemas["job"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "string", "format": "date-time"}, jobSchema["created_at"], "embedded fields are promoted")
+	assert.NotContains(t, jobSchema, "Skipped")
+	assert.NotContains(t, jobSchema, "-")
+	parent := jobSchema["parent"].(map[string]any)["oneOf"].([]any)
+	assert.Equal(t, "#/components/schemas/job", parent[0].(map[string]any)["$ref"], "recursive types end in a reference")
+}
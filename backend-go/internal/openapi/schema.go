@@ -0,0 +1,213 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemas reflects Go types into JSON Schemas, keeping named structs as
+// components that are referenced where they are used
+type schemas struct {
+	defs  map[string]any
+	names map[reflect.Type]string
+}
+
+func newSchemas() *schemas {
+	return &schemas{defs: map[string]any{}, names: map[reflect.Type]string{}}
+}
+
+// of returns the schema of a type; named structs are referenced
+func (s *schemas) of(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == rawMessageType:
+		return map[string]any{}
+	case t.Kind() != reflect.Pointer && t.Implements(jsonMarshalerType),
+		t.Kind() != reflect.Pointer && reflect.PointerTo(t).Implements(jsonMarshalerType):
+		// What a type marshals itself to cannot be known from its fields
+		return map[string]any{}
+	case t.Kind() != reflect.Pointer && t.Implements(textMarshalerType):
+		return map[string]any{"type": "string"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return s.of(t.Elem())
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Float32:
+		return map[string]any{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return map[string]any{"type": "number", "format": "double"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 && t.Kind() == reflect.Slice {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		return map[string]any{"type": "array", "items": s.of(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.inline(t)
+		}
+		return s.ref(t)
+	}
+	// Interfaces and anything else hold any JSON value
+	return map[string]any{}
+}
+
+// ref returns a reference to a named struct's component, adding it first
+func (s *schemas) ref(t reflect.Type) map[string]any {
+	name, ok := s.names[t]
+	if !ok {
+		name = s.name(t)
+		s.names[t] = name
+		// Placed before its fields are reflected, so types that refer to
+		// themselves end in a reference
+		s.defs[name] = map[string]any{}
+		s.defs[name] = s.inline(t)
+	}
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+// name returns the component name of a type: its own name, qualified by its
+// package when another package has a type of the same name
+func (s *schemas) name(t reflect.Type) string {
+	name := sanitize(t.Name())
+	if _, taken := s.defs[name]; !taken {
+		return name
+	}
+	pkg := t.PkgPath()
+	pkg = pkg[strings.LastIndex(pkg, "/")+1:]
+	qualified := sanitize(upperFirst(pkg) + t.Name())
+	for n := 2; ; n++ {
+		if _, taken := s.defs[qualified]; !taken {
+			return qualified
+		}
+		qualified = sanitize(upperFirst(pkg)+t.Name()) + strconv.Itoa(n)
+	}
+}
+
+// inline returns the object schema of a struct's fields. Embedded structs
+// without a json name have their fields promoted, as encoding/json does.
+func (s *schemas) inline(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return s.of(t)
+	}
+	props := map[string]any{}
+	var required []string
+	s.fields(t, props, &required)
+	out := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		out["required"] = required
+	}
+	return out
+}
+
+func (s *schemas) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if f.Anonymous && name == "" {
+			et := ft
+			if et.Kind() == reflect.Pointer {
+				et = et.Elem()
+			}
+			if et.Kind() == reflect.Struct {
+				s.fields(et, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		omitEmpty := hasOpt(opts, "omitempty") || hasOpt(opts, "omitzero")
+		var schema map[string]any
+		if hasOpt(opts, "string") {
+			schema = map[string]any{"type": "string"}
+		} else {
+			schema = s.of(ft)
+		}
+		// A nil pointer or slice left in the output is written as null
+		if !omitEmpty && nullable(ft) {
+			schema = orNull(schema)
+		}
+		props[name] = schema
+		if !omitEmpty {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func nullable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return t != rawMessageType
+	}
+	return false
+}
+
+// orNull lets a schema also be null, the OpenAPI 3.1 way
+func orNull(schema map[string]any) map[string]any {
+	if len(schema) == 0 {
+		return schema
+	}
+	if t, ok := schema["type"].(string); ok {
+		out := make(map[string]any, len(schema))
+		for k, v := range schema {
+			out[k] = v
+		}
+		out["type"] = []string{t, "null"}
+		return out
+	}
+	return map[string]any{"oneOf": []any{schema, map[string]any{"type": "null"}}}
+}
+
+func hasOpt(opts, name string) bool {
+	for _, o := range strings.Split(opts, ",") {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitize keeps a component name to the characters OpenAPI allows, such as
+// for instantiated generic types
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+}
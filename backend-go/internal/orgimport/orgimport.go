@@ -0,0 +1,352 @@
+// Package orgimport invites people to an organization from a CSV of
+// addresses, roles and teams. Rows are validated when the file is uploaded
+// and invited in the background at a throttled rate. Running an import
+// again, or uploading the same file again, skips those already members or
+// holding an open invitation with the same role, so a partly failed import
+// can be rerun safely.
+package orgimport
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/accounts"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+)
+
+const (
+	// MaxRows bounds the people of one import
+	MaxRows = 5000
+	// MaxFileSize bounds an uploaded file
+	MaxFileSize = 2 << 20
+	// ClaimTimeout is how long a worker may take over a row before another
+	// takes it over
+	ClaimTimeout = 10 * time.Minute
+)
+
+var (
+	ErrInvalidFile = errors.New("imports are CSV with a header naming an email column, and optionally role and team columns")
+	ErrNoRows      = errors.New("the file has no rows")
+	ErrTooManyRows = fmt.Errorf("an import has at most %d rows", MaxRows)
+)
+
+// Reasons recorded on rows that were not invited
+const (
+	ReasonInvalidEmail    = "invalid_email"
+	ReasonInvalidRole     = "invalid_role"
+	ReasonRoleNotAllowed  = "role_not_allowed"
+	ReasonInvalidTeam     = "invalid_team"
+	ReasonDuplicate       = "duplicate_email"
+	ReasonAlreadyMember   = "already_member"
+	ReasonAlreadyInvited  = "already_invited"
+	ReasonImporterRemoved = "importer_not_allowed"
+	ReasonInviteFailed    = "invite_failed"
+)
+
+var emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+// Parse reads the rows of an import for an importer with role actor. Rows
+// failing validation come back invalid with the reason; the others are
+// pending. Roles default to member.
+func Parse(r io.Reader, actor models.OrgRole) ([]models.OrgImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, ErrInvalidFile
+	}
+	email, role, team := -1, -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))) {
+		case "email", "email_address":
+			email = i
+		case "role":
+			role = i
+		case "team":
+			team = i
+		}
+	}
+	if email < 0 {
+		return nil, ErrInvalidFile
+	}
+	var out []models.OrgImportRow
+	seen := make(map[string]bool)
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		if len(out) == MaxRows {
+			return nil, ErrTooManyRows
+		}
+		row := validate(line, field(record, email), field(record, role), field(record, team), actor)
+		if row.Status == models.OrgImportRowPending {
+			if seen[row.Email] {
+				invalid(&row, ReasonDuplicate)
+			}
+			seen[row.Email] = true
+		}
+		out = append(out, row)
+	}
+	if len(out) == 0 {
+		return nil, ErrNoRows
+	}
+	return out, nil
+}
+
+func validate(line int, email, role, team string, actor models.OrgRole) models.OrgImportRow {
+	row := models.OrgImportRow{Line: line, Email: accounts.NormalizeEmail(email), Role: models.OrgRole(strings.ToLower(role)), Status: models.OrgImportRowPending}
+	if role == "" {
+		row.Role = models.OrgRoleMember
+	}
+	if len(row.Email) > 254 || !emailPattern.MatchString(row.Email) {
+		invalid(&row, ReasonInvalidEmail)
+		return row
+	}
+	parsed, err := orgs.ParseRole(string(row.Role))
+	if err != nil {
+		invalid(&row, ReasonInvalidRole)
+		return row
+	}
+	row.Role = parsed
+	if orgs.CheckAssign(actor, "", parsed) != nil {
+		invalid(&row, ReasonRoleNotAllowed)
+		return row
+	}
+	if row.Team, err = orgs.NormalizeTeam(team); err != nil {
+		invalid(&row, ReasonInvalidTeam)
+	}
+	return row
+}
+
+func invalid(row *models.OrgImportRow, reason string) {
+	row.Status = models.OrgImportRowInvalid
+	row.Reason = &reason
+}
+
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// Store holds imports and claims their rows for the worker
+type Store interface {
+	Get(ctx context.Context, id int64) (*models.OrgImport, error)
+	ClaimRows(ctx context.Context, limit int, staleBefore time.Time) ([]models.OrgImportRow, error)
+	FinishRow(ctx context.Context, row *models.OrgImportRow) error
+}
+
+// Orgs holds organizations, their members and invitations
+type Orgs interface {
+	Get(ctx context.Context, id int64) (*models.Organization, error)
+	Membership(ctx context.Context, userID int64) (*models.OrgMember, error)
+	IsMemberEmail(ctx context.Context, orgID int64, email string) (bool, error)
+	OpenInvitation(ctx context.Context, orgID int64, email string) (*models.OrgInvitation, error)
+	CreateInvitation(ctx context.Context, inv *models.OrgInvitation) (*models.OrgInvitation, error)
+}
+
+// Mailer emails invitations
+type Mailer interface {
+	SendOrgInvitationEmail(to, orgName, inviterEmail, role, token string) error
+}
+
+// AuditLog records the invitations sent
+type AuditLog interface {
+	Insert(ctx context.Context, log *models.AuditLog) (*models.AuditLog, error)
+}
+
+// Transactor runs a function in a transaction
+type Transactor interface {
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Inviter sends the invitations of import rows, a batch per run
+type Inviter struct {
+	store  Store
+	orgs   Orgs
+	tx     Transactor
+	mailer Mailer
+	audit  AuditLog
+	batch  int
+	logger *zap.Logger
+}
+
+// NewInviter creates an inviter sending at most batch invitations a run.
+// Without a mailer invitations are stored but not emailed, as when they
+// are created one at a time; audit may be nil.
+func NewInviter(store Store, orgs Orgs, tx Transactor, mailer Mailer, audit AuditLog, batch int, logger *zap.Logger) *Inviter {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Inviter{store: store, orgs: orgs, tx: tx, mailer: mailer, audit: audit, batch: batch, logger: logger}
+}
+
+// importer is what rows of one import are invited with
+type importer struct {
+	imp   *models.OrgImport
+	org   *models.Organization
+	actor *models.OrgMember
+}
+
+// Run invites a batch of pending rows and returns how many were invited.
+// Rows that cannot be invited are recorded failed and left for a rerun of
+// their import.
+func (v *Inviter) Run(ctx context.Context, now time.Time) (int, error) {
+	rows, err := v.store.ClaimRows(ctx, v.batch, now.Add(-ClaimTimeout))
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim import rows: %w", err)
+	}
+	importers := make(map[int64]*importer)
+	var errs []error
+	invited := 0
+	for i := range rows {
+		row := &rows[i]
+		im, ok := importers[row.ImportID]
+		if !ok {
+			im, err = v.importer(ctx, row.ImportID)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			importers[row.ImportID] = im
+		}
+		v.invite(ctx, im, row, now)
+		if err := v.store.FinishRow(ctx, row); err != nil {
+			errs = append(errs, fmt.Errorf("failed to record import row %d: %w", row.ID, err))
+			continue
+		}
+		if row.Status == models.OrgImportRowInvited {
+			invited++
+		}
+	}
+	return invited, errors.Join(errs...)
+}
+
+func (v *Inviter) importer(ctx context.Context, importID int64) (*importer, error) {
+	imp, err := v.store.Get(ctx, importID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load import %d: %w", importID, err)
+	}
+	org, err := v.orgs.Get(ctx, imp.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load organization %d: %w", imp.OrgID, err)
+	}
+	actor, err := v.orgs.Membership(ctx, imp.CreatedBy)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to load importer %d: %w", imp.CreatedBy, err)
+	}
+	return &importer{imp: imp, org: org, actor: actor}, nil
+}
+
+// invite sends the invitation of a row and sets the row's outcome
+func (v *Inviter) invite(ctx context.Context, im *importer, row *models.OrgImportRow, now time.Time) {
+	done := func(status models.OrgImportRowStatus, reason string) {
+		row.Status = status
+		row.Reason = nil
+		if reason != "" {
+			row.Reason = &reason
+		}
+	}
+	// The importer's rights are checked again, as they may have been
+	// demoted or removed since the upload
+	if im.actor == nil || im.actor.OrgID != im.imp.OrgID || orgs.CheckAssign(im.actor.Role, "", row.Role) != nil {
+		done(models.OrgImportRowFailed, ReasonImporterRemoved)
+		return
+	}
+	member, err := v.orgs.IsMemberEmail(ctx, im.imp.OrgID, row.Email)
+	if err != nil {
+		v.logger.Warn("failed to check import row", zap.Int64("row_id", row.ID), zap.Error(err))
+		done(models.OrgImportRowFailed, ReasonInviteFailed)
+		return
+	}
+	if member {
+		done(models.OrgImportRowSkipped, ReasonAlreadyMember)
+		return
+	}
+	open, err := v.orgs.OpenInvitation(ctx, im.imp.OrgID, row.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		v.logger.Warn("failed to check import row", zap.Int64("row_id", row.ID), zap.Error(err))
+		done(models.OrgImportRowFailed, ReasonInviteFailed)
+		return
+	}
+	if open != nil && open.Role == row.Role && sameTeam(open.Team, row.Team) {
+		row.InvitationID = &open.ID
+		done(models.OrgImportRowSkipped, ReasonAlreadyInvited)
+		return
+	}
+
+	token, tokenHash, err := accounts.NewToken()
+	if err != nil {
+		done(models.OrgImportRowFailed, ReasonInviteFailed)
+		return
+	}
+	// The email is sent inside the transaction, so an invitation that could
+	// not be delivered is not kept and a rerun sends a fresh one
+	var inv *models.OrgInvitation
+	err = v.tx.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		inv, err = v.orgs.CreateInvitation(ctx, &models.OrgInvitation{
+			OrgID:     im.imp.OrgID,
+			Email:     row.Email,
+			Role:      row.Role,
+			Team:      row.Team,
+			TokenHash: tokenHash,
+			InvitedBy: im.actor.UserID,
+			ExpiresAt: now.Add(orgs.InvitationTTL),
+		})
+		if err != nil {
+			return err
+		}
+		if v.audit != nil {
+			raw, _ := json.Marshal(map[string]any{"invitation_id": inv.ID, "email": inv.Email, "role": inv.Role, "import_id": im.imp.ID})
+			resourceID := strconv.FormatInt(im.imp.OrgID, 10)
+			if _, err := v.audit.Insert(ctx, &models.AuditLog{
+				UserID:     &im.actor.UserID,
+				Action:     "org_invitation_created",
+				Resource:   "organization",
+				ResourceID: &resourceID,
+				Metadata:   string(raw),
+			}); err != nil {
+				return err
+			}
+		}
+		if v.mailer == nil {
+			return nil
+		}
+		return v.mailer.SendOrgInvitationEmail(inv.Email, im.org.Name, im.actor.Email, string(inv.Role), token)
+	})
+	if err != nil {
+		v.logger.Warn("failed to invite import row", zap.Int64("row_id", row.ID), zap.Error(err))
+		done(models.OrgImportRowFailed, ReasonInviteFailed)
+		return
+	}
+	row.InvitationID = &inv.ID
+	done(models.OrgImportRowInvited, "")
+}
+
+func sameTeam(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
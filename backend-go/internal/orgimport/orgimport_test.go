@@ -0,0 +1,233 @@
+// Package orgimport_test provides unit tests for CSV member imports
+package orgimport_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgimport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	csv := "\ufeffTeam,Email,Role\n" +
+		"Data,Ana@Example.com,admin\n" +
+		"Data,ben@example.com,\n" +
+		",not-an-address,member\n" +
+		"Ops,cy@example.com,janitor\n" +
+		"Ops,di@example.com,owner\n" +
+		"Ops,ana@example.com,member\n" +
+		strings.Repeat("x", 101) + ",ed@example.com,viewer\n" +
+		"\n"
+	rows, err := orgimport.Parse(strings.NewReader(csv), models.OrgRoleAdmin)
+	require.NoError(t, err)
+	require.Len(t, rows, 7)
+
+	assert.Equal(t, 2, rows[0].Line)
+	assert.Equal(t, "ana@example.com", rows[0].Email)
+	assert.Equal(t, models.OrgRoleAdmin, rows[0].Role)
+	require.NotNil(t, rows[0].Team)
+	assert.Equal(t, "Data", *rows[0].Team)
+	assert.Equal(t, models.OrgImportRowPending, rows[0].Status)
+	assert.Equal(t, models.OrgRoleMember, rows[1].Role, "roles default to member")
+
+	reasons := map[int]string{}
+	for _, r := range rows {
+		if r.Status == models.OrgImportRowInvalid {
+			reasons[r.Line] = *r.Reason
+		}
+	}
+	assert.Equal(t, map[int]string{
+		4: orgimport.ReasonInvalidEmail,
+		5: orgimport.ReasonInvalidRole,
+		6: orgimport.ReasonRoleNotAllowed,
+		7: orgimport.ReasonDuplicate,
+		8: orgimport.ReasonInvalidTeam,
+	}, reasons)
+}
+
+func TestParseRejectsFiles(t *testing.T) {
+	_, err := orgimport.Parse(strings.NewReader("name,role\nana,admin\n"), models.OrgRoleOwner)
+	assert.ErrorIs(t, err, orgimport.ErrInvalidFile)
+	_, err = orgimport.Parse(strings.NewReader("email\n"), models.OrgRoleOwner)
+	assert.ErrorIs(t, err, orgimport.ErrNoRows)
+	_, err = orgimport.Parse(strings.NewReader("email\n"+strings.Repeat("a@example.com\n", orgimport.MaxRows+1)), models.OrgRoleOwner)
+	assert.ErrorIs(t, err, orgimport.ErrTooManyRows)
+}
+
+type fakeStore struct {
+	imports  map[int64]*models.OrgImport
+	pending  []models.OrgImportRow
+	finished []models.OrgImportRow
+	limit    int
+}
+
+func (f *fakeStore) Get(_ context.Context, id int64) (*models.OrgImport, error) {
+	if imp, ok := f.imports[id]; ok {
+		return imp, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeStore) ClaimRows(_ context.Context, limit int, _ time.Time) ([]models.OrgImportRow, error) {
+	f.limit = limit
+	n := min(limit, len(f.pending))
+	out := f.pending[:n]
+	f.pending = f.pending[n:]
+	return out, nil
+}
+
+func (f *fakeStore) FinishRow(_ context.Context, row *models.OrgImportRow) error {
+	f.finished = append(f.finished, *row)
+	return nil
+}
+
+type fakeOrgs struct {
+	members     map[int64]*models.OrgMember
+	memberEmail map[string]bool
+	open        map[string]*models.OrgInvitation
+	created     []*models.OrgInvitation
+}
+
+func (f *fakeOrgs) Get(_ context.Context, id int64) (*models.Organization, error) {
+	return &models.Organization{ID: id, Name: "Acme"}, nil
+}
+
+func (f *fakeOrgs) Membership(_ context.Context, userID int64) (*models.OrgMember, error) {
+	if m, ok := f.members[userID]; ok {
+		return m, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeOrgs) IsMemberEmail(_ context.Context, _ int64, email string) (bool, error) {
+	return f.memberEmail[email], nil
+}
+
+func (f *fakeOrgs) OpenInvitation(_ context.Context, _ int64, email string) (*models.OrgInvitation, error) {
+	if inv, ok := f.open[email]; ok {
+		return inv, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeOrgs) CreateInvitation(_ context.Context, inv *models.OrgInvitation) (*models.OrgInvitation, error) {
+	out := *inv
+	out.ID = int64(100 + len(f.created))
+	f.created = append(f.created, &out)
+	f.open[inv.Email] = &out
+	return &out, nil
+}
+
+type fakeMailer struct {
+	sent []string
+	fail string
+}
+
+func (f *fakeMailer) SendOrgInvitationEmail(to, orgName, inviterEmail, role, token string) error {
+	if to == f.fail {
+		return errors.New("smtp unavailable")
+	}
+	f.sent = append(f.sent, to+" "+orgName+" "+inviterEmail+" "+role)
+	return nil
+}
+
+// rollback stands in for a database transaction: what fn created is gone
+// when it fails
+type rollback struct{ orgs *fakeOrgs }
+
+func (r rollback) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	created := len(r.orgs.created)
+	err := fn(ctx)
+	if err != nil {
+		for _, inv := range r.orgs.created[created:] {
+			delete(r.orgs.open, inv.Email)
+		}
+		r.orgs.created = r.orgs.created[:created]
+	}
+	return err
+}
+
+func row(id int64, email string, role models.OrgRole) models.OrgImportRow {
+	return models.OrgImportRow{ID: id, ImportID: 1, Email: email, Role: role, Status: models.OrgImportRowSending}
+}
+
+func TestInviterRun(t *testing.T) {
+	now := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	store := &fakeStore{
+		imports: map[int64]*models.OrgImport{1: {ID: 1, OrgID: 7, CreatedBy: 2}},
+		pending: []models.OrgImportRow{
+			row(1, "ana@example.com", models.OrgRoleMember),
+			row(2, "ben@example.com", models.OrgRoleViewer),
+			row(3, "cy@example.com", models.OrgRoleMember),
+			row(4, "di@example.com", models.OrgRoleMember),
+			row(5, "ed@example.com", models.OrgRoleAdmin),
+		},
+	}
+	orgs := &fakeOrgs{
+		members:     map[int64]*models.OrgMember{2: {OrgID: 7, UserID: 2, Email: "boss@example.com", Role: models.OrgRoleAdmin}},
+		memberEmail: map[string]bool{"ben@example.com": true},
+		open:        map[string]*models.OrgInvitation{"cy@example.com": {ID: 50, Email: "cy@example.com", Role: models.OrgRoleMember}},
+	}
+	mailer := &fakeMailer{fail: "di@example.com"}
+	v := orgimport.NewInviter(store, orgs, rollback{orgs}, mailer, nil, 10, nil)
+
+	n, err := v.Run(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 10, store.limit, "a run sends at most its batch")
+
+	outcome := map[string]string{}
+	for _, r := range store.finished {
+		reason := ""
+		if r.Reason != nil {
+			reason = *r.Reason
+		}
+		outcome[r.Email] = string(r.Status) + " " + reason
+	}
+	assert.Equal(t, map[string]string{
+		"ana@example.com": "invited ",
+		"ben@example.com": "skipped already_member",
+		"cy@example.com":  "skipped already_invited",
+		"di@example.com":  "failed invite_failed",
+		"ed@example.com":  "invited ",
+	}, outcome)
+	assert.Equal(t, []string{"ana@example.com Acme boss@example.com member", "ed@example.com Acme boss@example.com admin"}, mailer.sent)
+	require.Len(t, orgs.created, 2, "the invitation whose email failed was rolled back")
+	assert.Equal(t, now.Add(7*24*time.Hour), orgs.created[0].ExpiresAt)
+
+	// A rerun of the failed row invites it; the others are skipped now
+	mailer.fail = ""
+	store.pending = []models.OrgImportRow{row(1, "ana@example.com", models.OrgRoleMember), row(4, "di@example.com", models.OrgRoleMember)}
+	store.finished = nil
+	n, err = v.Run(context.Background(), now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, models.OrgImportRowSkipped, store.finished[0].Status, "an import run twice does not invite twice")
+	assert.Equal(t, models.OrgImportRowInvited, store.finished[1].Status)
+}
+
+func TestInviterChecksImporter(t *testing.T) {
+	store := &fakeStore{
+		imports: map[int64]*models.OrgImport{1: {ID: 1, OrgID: 7, CreatedBy: 2}},
+		pending: []models.OrgImportRow{row(1, "ana@example.com", models.OrgRoleMember)},
+	}
+	orgs := &fakeOrgs{
+		members: map[int64]*models.OrgMember{2: {OrgID: 7, UserID: 2, Role: models.OrgRoleMember}},
+		open:    map[string]*models.OrgInvitation{},
+	}
+	v := orgimport.NewInviter(store, orgs, rollback{orgs}, nil, nil, 10, nil)
+
+	n, err := v.Run(context.Background(), time.Now())
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	require.Len(t, store.finished, 1)
+	assert.Equal(t, orgimport.ReasonImporterRemoved, *store.finished[0].Reason, "an importer demoted since the upload invites nobody")
+	assert.Empty(t, orgs.created)
+}
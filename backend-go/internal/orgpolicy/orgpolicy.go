@@ -0,0 +1,110 @@
+// Package orgpolicy lets organization admins disable capability groups for
+// their members. A disabled capability is refused in the handlers that use
+// it, and each refused attempt is recorded for the admins to review.
+package orgpolicy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Capability is a group of features an organization may disable
+type Capability string
+
+const (
+	// WarehouseDelivery loads generated data into external warehouses
+	WarehouseDelivery Capability = "warehouse_delivery"
+	// PublicSharing hosts generated rows at public mock API URLs
+	PublicSharing Capability = "public_sharing"
+	// NonEUProviders sends generation requests to AI providers hosted
+	// outside the EU
+	NonEUProviders Capability = "non_eu_providers"
+)
+
+// Capabilities are the capabilities a policy may disable, with what each
+// covers
+var Capabilities = map[Capability]string{
+	WarehouseDelivery: "Connect warehouse destinations and load generated data into them, by hand or automatically",
+	PublicSharing:     "Host generated rows as mock APIs that anyone with the URL can query",
+	NonEUProviders:    "Generate with AI providers hosted outside the EU; statistical and custom model jobs run on the platform and are not affected",
+}
+
+// Valid reports whether c is a capability a policy may disable
+func Valid(c Capability) bool {
+	_, ok := Capabilities[c]
+	return ok
+}
+
+// DisabledError is returned when a member uses a capability their
+// organization disabled
+type DisabledError struct {
+	Capability Capability
+	Reason     *string
+}
+
+func (e *DisabledError) Error() string {
+	msg := fmt.Sprintf("your organization has disabled %s", e.Capability)
+	if e.Reason != nil {
+		msg += ": " + *e.Reason
+	}
+	return msg
+}
+
+// InEU reports whether a provider location, such as a Vertex AI region
+// like europe-west4 or the eu multi-region, is in the EU
+func InEU(location string) bool {
+	l := strings.ToLower(strings.TrimSpace(location))
+	return l == "eu" || strings.HasPrefix(l, "europe-") || strings.HasPrefix(l, "eu-")
+}
+
+// Store reads policies and records violations
+type Store interface {
+	Get(ctx context.Context, orgID int64, capability string) (*models.OrgPolicy, error)
+	RecordViolation(ctx context.Context, v *models.OrgPolicyViolation) error
+}
+
+// Memberships finds the organization of a user; sql.ErrNoRows when they
+// belong to none
+type Memberships interface {
+	Membership(ctx context.Context, userID int64) (*models.OrgMember, error)
+}
+
+// Enforcer checks members' requests against their organization's policies
+type Enforcer struct {
+	store Store
+	orgs  Memberships
+}
+
+func NewEnforcer(store Store, orgs Memberships) *Enforcer {
+	return &Enforcer{store: store, orgs: orgs}
+}
+
+// Check returns a *DisabledError when the organization of a user disabled
+// capability, after recording action as a violation. Users outside any
+// organization are never bound.
+func (e *Enforcer) Check(ctx context.Context, userID int64, capability Capability, action string) error {
+	member, err := e.orgs.Membership(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	p, err := e.store.Get(ctx, member.OrgID, string(capability))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	v := &models.OrgPolicyViolation{OrgID: member.OrgID, UserID: userID, Capability: string(capability), Action: action}
+	if err := e.store.RecordViolation(ctx, v); err != nil {
+		return err
+	}
+	return &DisabledError{Capability: capability, Reason: p.Reason}
+}
@@ -0,0 +1,85 @@
+// Package orgpolicy_test provides unit tests for organization capability
+// policies
+package orgpolicy_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgpolicy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	disabled   map[string]*models.OrgPolicy
+	violations []models.OrgPolicyViolation
+}
+
+func (f *fakeStore) Get(_ context.Context, orgID int64, capability string) (*models.OrgPolicy, error) {
+	if p, ok := f.disabled[capability]; ok && p.OrgID == orgID {
+		return p, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (f *fakeStore) RecordViolation(_ context.Context, v *models.OrgPolicyViolation) error {
+	f.violations = append(f.violations, *v)
+	return nil
+}
+
+type fakeOrgs map[int64]*models.OrgMember
+
+func (f fakeOrgs) Membership(_ context.Context, userID int64) (*models.OrgMember, error) {
+	if userID == 99 {
+		return nil, errors.New("connection refused")
+	}
+	if m, ok := f[userID]; ok {
+		return m, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func TestCheck(t *testing.T) {
+	reason := "exports go through the data team"
+	store := &fakeStore{disabled: map[string]*models.OrgPolicy{
+		string(orgpolicy.WarehouseDelivery): {OrgID: 7, Capability: string(orgpolicy.WarehouseDelivery), Reason: &reason},
+	}}
+	orgs := fakeOrgs{1: {OrgID: 7, UserID: 1}, 2: {OrgID: 8, UserID: 2}}
+	e := orgpolicy.NewEnforcer(store, orgs)
+	ctx := context.Background()
+
+	err := e.Check(ctx, 1, orgpolicy.WarehouseDelivery, "POST /api/v1/warehouses")
+	var disabled *orgpolicy.DisabledError
+	require.ErrorAs(t, err, &disabled)
+	assert.Equal(t, orgpolicy.WarehouseDelivery, disabled.Capability)
+	assert.Equal(t, "your organization has disabled warehouse_delivery: exports go through the data team", err.Error())
+	require.Len(t, store.violations, 1)
+	assert.Equal(t, models.OrgPolicyViolation{OrgID: 7, UserID: 1, Capability: "warehouse_delivery", Action: "POST /api/v1/warehouses"}, store.violations[0])
+
+	assert.NoError(t, e.Check(ctx, 1, orgpolicy.PublicSharing, "POST /api/v1/mock-apis"), "other capabilities stay allowed")
+	assert.NoError(t, e.Check(ctx, 2, orgpolicy.WarehouseDelivery, "POST /api/v1/warehouses"), "policies bind their own organization")
+	assert.NoError(t, e.Check(ctx, 3, orgpolicy.WarehouseDelivery, "POST /api/v1/warehouses"), "users outside organizations are never bound")
+	assert.Len(t, store.violations, 1, "allowed requests are not violations")
+
+	err = e.Check(ctx, 99, orgpolicy.WarehouseDelivery, "POST /api/v1/warehouses")
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &disabled), "a failed lookup is not a refusal")
+}
+
+func TestInEU(t *testing.T) {
+	for _, l := range []string{"europe-west4", "eu", "EU", "eu-west-1"} {
+		assert.True(t, orgpolicy.InEU(l), l)
+	}
+	for _, l := range []string{"us-central1", "asia-northeast1", "", "global"} {
+		assert.False(t, orgpolicy.InEU(l), l)
+	}
+}
+
+func TestValid(t *testing.T) {
+	assert.True(t, orgpolicy.Valid(orgpolicy.NonEUProviders))
+	assert.False(t, orgpolicy.Valid("webhooks"))
+}
@@ -0,0 +1,148 @@
+// Package orgs decides what the members of an organization may do with each
+// other's datasets, generation jobs and custom models, and with the
+// organization itself. Resources are shared with the organization their
+// creator belonged to when they were created.
+package orgs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// InvitationTTL is how long an invitation can be accepted
+const InvitationTTL = 7 * 24 * time.Hour
+
+// MaxTeamLength bounds the team label of a member
+const MaxTeamLength = 100
+
+var (
+	ErrInvalidRole      = errors.New("unknown organization role")
+	ErrForbidden        = errors.New("organization role does not allow this")
+	ErrInvitationEmail  = errors.New("invitation was sent to another address")
+	ErrInvitationClosed = errors.New("invitation expired, was revoked or was accepted")
+	ErrInvalidTeam      = fmt.Errorf("team must be at most %d characters", MaxTeamLength)
+)
+
+// Action is something done to an organization's shared resources
+type Action int
+
+const (
+	// ActionRead views a resource's contents and downloads what it produced
+	ActionRead Action = iota
+	// ActionWrite creates resources for the organization and generates from
+	// its datasets and models
+	ActionWrite
+	// ActionManage changes or removes resources created by other members
+	ActionManage
+	// ActionAdmin manages the organization's members and invitations
+	ActionAdmin
+	// ActionAudit reads the organization's audit trail and compliance
+	// reports
+	ActionAudit
+	// ActionInspect views the metadata of a resource or of the organization,
+	// such as its status, lineage, reports and configuration, but never the
+	// contents of a dataset or an output
+	ActionInspect
+)
+
+var ranks = map[models.OrgRole]int{
+	models.OrgRoleAuditor: 1,
+	models.OrgRoleViewer:  1,
+	models.OrgRoleMember:  2,
+	models.OrgRoleAdmin:   3,
+	models.OrgRoleOwner:   4,
+}
+
+// minRole is the least role each action needs
+var minRole = map[Action]models.OrgRole{
+	ActionRead:    models.OrgRoleViewer,
+	ActionWrite:   models.OrgRoleMember,
+	ActionManage:  models.OrgRoleAdmin,
+	ActionAdmin:   models.OrgRoleAdmin,
+	ActionAudit:   models.OrgRoleAdmin,
+	ActionInspect: models.OrgRoleViewer,
+}
+
+// auditorActions are all auditors may do: they inspect and audit, but read
+// no contents
+var auditorActions = map[Action]bool{ActionInspect: true, ActionAudit: true}
+
+// ParseRole returns the role named by s
+func ParseRole(s string) (models.OrgRole, error) {
+	role := models.OrgRole(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := ranks[role]; !ok {
+		return "", ErrInvalidRole
+	}
+	return role, nil
+}
+
+// Can reports whether role allows action
+func Can(role models.OrgRole, action Action) bool {
+	if role == models.OrgRoleAuditor {
+		return auditorActions[action]
+	}
+	need, ok := minRole[action]
+	return ok && ranks[role] >= ranks[need]
+}
+
+// Roles returns the roles that allow action, for filtering in queries
+func Roles(action Action) []models.OrgRole {
+	var out []models.OrgRole
+	for _, role := range []models.OrgRole{models.OrgRoleOwner, models.OrgRoleAdmin, models.OrgRoleMember, models.OrgRoleViewer, models.OrgRoleAuditor} {
+		if Can(role, action) {
+			out = append(out, role)
+		}
+	}
+	return out
+}
+
+// NormalizeTeam trims a team label; nil when it is empty
+func NormalizeTeam(team string) (*string, error) {
+	team = strings.TrimSpace(team)
+	if team == "" {
+		return nil, nil
+	}
+	if utf8.RuneCountInString(team) > MaxTeamLength {
+		return nil, ErrInvalidTeam
+	}
+	return &team, nil
+}
+
+// CanAccess reports whether member may act on a resource shared with orgID.
+// Resources not shared with an organization are only for their creator.
+func CanAccess(member *models.OrgMember, orgID *int64, action Action) bool {
+	return member != nil && orgID != nil && member.OrgID == *orgID && Can(member.Role, action)
+}
+
+// CheckAssign reports whether actor may move a member from role from to
+// role to; from is empty for someone joining. Admins manage everyone but
+// owners, and only owners make owners.
+func CheckAssign(actor, from, to models.OrgRole) error {
+	if _, ok := ranks[to]; !ok {
+		return ErrInvalidRole
+	}
+	if !Can(actor, ActionAdmin) {
+		return ErrForbidden
+	}
+	if actor != models.OrgRoleOwner && (from == models.OrgRoleOwner || to == models.OrgRoleOwner) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// CheckInvitation reports whether inv can be accepted by a user signed in
+// as email at now
+func CheckInvitation(inv *models.OrgInvitation, email string, now time.Time) error {
+	if inv.AcceptedAt != nil || inv.RevokedAt != nil || !now.Before(inv.ExpiresAt) {
+		return ErrInvitationClosed
+	}
+	if !strings.EqualFold(strings.TrimSpace(inv.Email), strings.TrimSpace(email)) {
+		return ErrInvitationEmail
+	}
+	return nil
+}
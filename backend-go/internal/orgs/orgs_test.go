@@ -0,0 +1,94 @@
+// Package orgs_test provides unit tests for organization roles and access
+package orgs_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCan(t *testing.T) {
+	assert.True(t, orgs.Can(models.OrgRoleViewer, orgs.ActionRead))
+	assert.False(t, orgs.Can(models.OrgRoleViewer, orgs.ActionWrite))
+	assert.True(t, orgs.Can(models.OrgRoleMember, orgs.ActionWrite))
+	assert.False(t, orgs.Can(models.OrgRoleMember, orgs.ActionManage))
+	assert.True(t, orgs.Can(models.OrgRoleAdmin, orgs.ActionManage))
+	assert.True(t, orgs.Can(models.OrgRoleOwner, orgs.ActionAdmin))
+	assert.False(t, orgs.Can("guest", orgs.ActionRead))
+
+	assert.Equal(t, []models.OrgRole{models.OrgRoleOwner, models.OrgRoleAdmin, models.OrgRoleMember}, orgs.Roles(orgs.ActionWrite))
+}
+
+func TestAuditorCan(t *testing.T) {
+	assert.False(t, orgs.Can(models.OrgRoleAuditor, orgs.ActionRead), "auditors read no contents")
+	assert.True(t, orgs.Can(models.OrgRoleAuditor, orgs.ActionInspect))
+	assert.True(t, orgs.Can(models.OrgRoleAuditor, orgs.ActionAudit))
+	assert.True(t, orgs.Can(models.OrgRoleViewer, orgs.ActionInspect))
+	assert.False(t, orgs.Can(models.OrgRoleAuditor, orgs.ActionWrite))
+	assert.False(t, orgs.Can(models.OrgRoleAuditor, orgs.ActionAdmin))
+	assert.True(t, orgs.Can(models.OrgRoleAdmin, orgs.ActionAudit))
+	assert.False(t, orgs.Can(models.OrgRoleViewer, orgs.ActionAudit))
+
+	assert.Equal(t, []models.OrgRole{models.OrgRoleOwner, models.OrgRoleAdmin, models.OrgRoleAuditor}, orgs.Roles(orgs.ActionAudit))
+	assert.NotContains(t, orgs.Roles(orgs.ActionRead), models.OrgRoleAuditor)
+	assert.NoError(t, orgs.CheckAssign(models.OrgRoleAdmin, models.OrgRoleMember, models.OrgRoleAuditor))
+}
+
+func TestParseRole(t *testing.T) {
+	role, err := orgs.ParseRole(" Admin ")
+	assert.NoError(t, err)
+	assert.Equal(t, models.OrgRoleAdmin, role)
+	_, err = orgs.ParseRole("superuser")
+	assert.ErrorIs(t, err, orgs.ErrInvalidRole)
+}
+
+func TestCanAccess(t *testing.T) {
+	org, other := int64(7), int64(8)
+	member := &models.OrgMember{OrgID: org, UserID: 1, Role: models.OrgRoleMember}
+
+	assert.True(t, orgs.CanAccess(member, &org, orgs.ActionWrite))
+	assert.False(t, orgs.CanAccess(member, &org, orgs.ActionManage))
+	assert.False(t, orgs.CanAccess(member, &other, orgs.ActionRead), "resources of other orgs stay hidden")
+	assert.False(t, orgs.CanAccess(member, nil, orgs.ActionRead), "unshared resources stay with their creator")
+	assert.False(t, orgs.CanAccess(nil, &org, orgs.ActionRead))
+}
+
+func TestCheckAssign(t *testing.T) {
+	assert.NoError(t, orgs.CheckAssign(models.OrgRoleAdmin, "", models.OrgRoleMember))
+	assert.NoError(t, orgs.CheckAssign(models.OrgRoleAdmin, models.OrgRoleViewer, models.OrgRoleAdmin))
+	assert.ErrorIs(t, orgs.CheckAssign(models.OrgRoleAdmin, models.OrgRoleMember, models.OrgRoleOwner), orgs.ErrForbidden)
+	assert.ErrorIs(t, orgs.CheckAssign(models.OrgRoleAdmin, models.OrgRoleOwner, models.OrgRoleMember), orgs.ErrForbidden)
+	assert.NoError(t, orgs.CheckAssign(models.OrgRoleOwner, models.OrgRoleAdmin, models.OrgRoleOwner))
+	assert.ErrorIs(t, orgs.CheckAssign(models.OrgRoleMember, "", models.OrgRoleViewer), orgs.ErrForbidden)
+	assert.ErrorIs(t, orgs.CheckAssign(models.OrgRoleOwner, "", "guest"), orgs.ErrInvalidRole)
+}
+
+func TestNormalizeTeam(t *testing.T) {
+	team, err := orgs.NormalizeTeam("  Data Platform ")
+	assert.NoError(t, err)
+	assert.Equal(t, "Data Platform", *team)
+
+	team, err = orgs.NormalizeTeam(" ")
+	assert.NoError(t, err)
+	assert.Nil(t, team)
+
+	_, err = orgs.NormalizeTeam(strings.Repeat("é", orgs.MaxTeamLength+1))
+	assert.ErrorIs(t, err, orgs.ErrInvalidTeam)
+}
+
+func TestCheckInvitation(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	inv := &models.OrgInvitation{Email: "ana@example.com", ExpiresAt: now.Add(time.Hour)}
+
+	assert.NoError(t, orgs.CheckInvitation(inv, "Ana@Example.com", now))
+	assert.ErrorIs(t, orgs.CheckInvitation(inv, "bob@example.com", now), orgs.ErrInvitationEmail)
+	assert.ErrorIs(t, orgs.CheckInvitation(inv, "ana@example.com", now.Add(2*time.Hour)), orgs.ErrInvitationClosed)
+
+	accepted := now
+	inv.AcceptedAt = &accepted
+	assert.ErrorIs(t, orgs.CheckInvitation(inv, "ana@example.com", now), orgs.ErrInvitationClosed)
+}
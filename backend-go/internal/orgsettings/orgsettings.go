@@ -0,0 +1,184 @@
+// Package orgsettings applies organization defaults to new jobs and
+// datasets. Empty values in a request take the organization default;
+// explicit values override it unless the organization made the setting
+// mandatory.
+package orgsettings
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+)
+
+// OverrideError is returned when a request overrides a mandatory default
+type OverrideError struct {
+	Setting string
+	Value   string
+}
+
+func (e *OverrideError) Error() string {
+	return fmt.Sprintf("%s is set by your organization to %s and cannot be overridden", e.Setting, e.Value)
+}
+
+// ExportFormats are the output formats generation jobs can produce
+var ExportFormats = []string{"json", "csv", "fixed_width", "fhir", "financial_message"}
+
+// Providers are the generation providers a default may name
+var Providers = []string{"vertex_ai", "claude", "openai", "custom"}
+
+// PrivacyLevels are the privacy levels a default may name
+var PrivacyLevels = []string{
+	string(privacy.PrivacyLevelLow),
+	string(privacy.PrivacyLevelMedium),
+	string(privacy.PrivacyLevelHigh),
+	string(privacy.PrivacyLevelMaximum),
+}
+
+// Settings is what a new generation job is created with
+type Settings struct {
+	PrivacyLevel string `json:"privacy_level,omitempty"`
+	Provider     string `json:"provider,omitempty"`
+	ExportFormat string `json:"export_format,omitempty"`
+}
+
+// InvalidError is returned for values no job or default may take
+type InvalidError struct {
+	Setting string
+	Value   string
+}
+
+func (e *InvalidError) Error() string {
+	return fmt.Sprintf("unknown %s %q", e.Setting, e.Value)
+}
+
+// ApplyJob fills a job's unset settings from the organization defaults and
+// rejects unknown values and overrides of mandatory defaults. s may be nil.
+func ApplyJob(s *models.OrgSettings, req Settings) (Settings, error) {
+	if err := validJob(req); err != nil {
+		return req, err
+	}
+	if s == nil {
+		return req, nil
+	}
+	var err error
+	if req.PrivacyLevel, err = apply(models.OrgSettingPrivacyLevel, s.PrivacyLevel, s.IsMandatory(models.OrgSettingPrivacyLevel), req.PrivacyLevel); err != nil {
+		return req, err
+	}
+	if req.Provider, err = apply(models.OrgSettingProvider, s.Provider, s.IsMandatory(models.OrgSettingProvider), req.Provider); err != nil {
+		return req, err
+	}
+	if len(s.ExportFormats) > 0 {
+		if req.ExportFormat == "" {
+			req.ExportFormat = s.ExportFormats[0]
+		} else if err := CheckExportFormat(s, req.ExportFormat); err != nil {
+			return req, err
+		}
+	}
+	return req, nil
+}
+
+// CheckExportFormat rejects formats outside a mandatory export format list
+func CheckExportFormat(s *models.OrgSettings, format string) error {
+	if !s.IsMandatory(models.OrgSettingExportFormats) || len(s.ExportFormats) == 0 {
+		return nil
+	}
+	if !contains(s.ExportFormats, format) {
+		return &OverrideError{Setting: models.OrgSettingExportFormats, Value: strings.Join(s.ExportFormats, ", ")}
+	}
+	return nil
+}
+
+// ApplyRetention returns a new dataset's retention in days, nil keeping
+// data until it is deleted
+func ApplyRetention(s *models.OrgSettings, requested *int) (*int, error) {
+	if s == nil || s.RetentionDays == nil {
+		return requested, nil
+	}
+	if requested == nil {
+		days := *s.RetentionDays
+		return &days, nil
+	}
+	if s.IsMandatory(models.OrgSettingRetentionDays) && *requested != *s.RetentionDays {
+		return nil, &OverrideError{Setting: models.OrgSettingRetentionDays, Value: fmt.Sprint(*s.RetentionDays)}
+	}
+	return requested, nil
+}
+
+// Validate checks settings an admin is about to store. A mandatory setting
+// must have a value.
+func Validate(s *models.OrgSettings) error {
+	var job Settings
+	if s.PrivacyLevel != nil {
+		job.PrivacyLevel = *s.PrivacyLevel
+	}
+	if s.Provider != nil {
+		job.Provider = *s.Provider
+	}
+	if err := validJob(job); err != nil {
+		return err
+	}
+	for _, f := range s.ExportFormats {
+		if !contains(ExportFormats, f) {
+			return &InvalidError{Setting: models.OrgSettingExportFormats, Value: f}
+		}
+	}
+	if s.RetentionDays != nil && *s.RetentionDays <= 0 {
+		return &InvalidError{Setting: models.OrgSettingRetentionDays, Value: fmt.Sprint(*s.RetentionDays)}
+	}
+	for _, m := range s.Mandatory {
+		var set bool
+		switch m {
+		case models.OrgSettingPrivacyLevel:
+			set = s.PrivacyLevel != nil
+		case models.OrgSettingProvider:
+			set = s.Provider != nil
+		case models.OrgSettingRetentionDays:
+			set = s.RetentionDays != nil
+		case models.OrgSettingExportFormats:
+			set = len(s.ExportFormats) > 0
+		default:
+			return &InvalidError{Setting: "mandatory setting", Value: m}
+		}
+		if !set {
+			return fmt.Errorf("mandatory setting %s has no value", m)
+		}
+	}
+	return nil
+}
+
+func validJob(req Settings) error {
+	if req.PrivacyLevel != "" && !contains(PrivacyLevels, req.PrivacyLevel) {
+		return &InvalidError{Setting: models.OrgSettingPrivacyLevel, Value: req.PrivacyLevel}
+	}
+	if req.Provider != "" && !contains(Providers, req.Provider) {
+		return &InvalidError{Setting: models.OrgSettingProvider, Value: req.Provider}
+	}
+	if req.ExportFormat != "" && !contains(ExportFormats, req.ExportFormat) {
+		return &InvalidError{Setting: "export_format", Value: req.ExportFormat}
+	}
+	return nil
+}
+
+func apply(setting string, def *string, mandatory bool, requested string) (string, error) {
+	if def == nil {
+		return requested, nil
+	}
+	if requested == "" {
+		return *def, nil
+	}
+	if mandatory && requested != *def {
+		return "", &OverrideError{Setting: setting, Value: *def}
+	}
+	return requested, nil
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
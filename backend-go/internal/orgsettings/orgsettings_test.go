@@ -0,0 +1,87 @@
+// Package orgsettings_test provides unit tests for organization defaults
+package orgsettings_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgsettings"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestApplyJob(t *testing.T) {
+	org := &models.OrgSettings{
+		PrivacyLevel:  ptr("high"),
+		Provider:      ptr("vertex_ai"),
+		ExportFormats: pq.StringArray{"csv", "json"},
+		Mandatory:     pq.StringArray{models.OrgSettingPrivacyLevel},
+	}
+
+	t.Run("defaults fill unset settings", func(t *testing.T) {
+		got, err := orgsettings.ApplyJob(org, orgsettings.Settings{})
+		require.NoError(t, err)
+		assert.Equal(t, orgsettings.Settings{PrivacyLevel: "high", Provider: "vertex_ai", ExportFormat: "csv"}, got)
+	})
+
+	t.Run("optional defaults can be overridden", func(t *testing.T) {
+		got, err := orgsettings.ApplyJob(org, orgsettings.Settings{Provider: "openai", ExportFormat: "json"})
+		require.NoError(t, err)
+		assert.Equal(t, "openai", got.Provider)
+		assert.Equal(t, "json", got.ExportFormat)
+	})
+
+	t.Run("mandatory defaults cannot", func(t *testing.T) {
+		_, err := orgsettings.ApplyJob(org, orgsettings.Settings{PrivacyLevel: "low"})
+		var override *orgsettings.OverrideError
+		require.ErrorAs(t, err, &override)
+		assert.Equal(t, models.OrgSettingPrivacyLevel, override.Setting)
+
+		got, err := orgsettings.ApplyJob(org, orgsettings.Settings{PrivacyLevel: "high"})
+		require.NoError(t, err)
+		assert.Equal(t, "high", got.PrivacyLevel)
+	})
+
+	t.Run("mandatory export formats restrict the choice", func(t *testing.T) {
+		locked := &models.OrgSettings{ExportFormats: pq.StringArray{"csv"}, Mandatory: pq.StringArray{models.OrgSettingExportFormats}}
+		_, err := orgsettings.ApplyJob(locked, orgsettings.Settings{ExportFormat: "json"})
+		assert.Error(t, err)
+		assert.NoError(t, orgsettings.CheckExportFormat(locked, "csv"))
+		assert.NoError(t, orgsettings.CheckExportFormat(nil, "json"))
+	})
+
+	t.Run("unknown values are rejected without an org", func(t *testing.T) {
+		_, err := orgsettings.ApplyJob(nil, orgsettings.Settings{ExportFormat: "xml"})
+		var invalid *orgsettings.InvalidError
+		assert.ErrorAs(t, err, &invalid)
+	})
+}
+
+func TestApplyRetention(t *testing.T) {
+	got, err := orgsettings.ApplyRetention(nil, nil)
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	org := &models.OrgSettings{RetentionDays: ptr(90)}
+	got, err = orgsettings.ApplyRetention(org, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 90, *got)
+	got, err = orgsettings.ApplyRetention(org, ptr(30))
+	require.NoError(t, err)
+	assert.Equal(t, 30, *got)
+
+	org.Mandatory = pq.StringArray{models.OrgSettingRetentionDays}
+	_, err = orgsettings.ApplyRetention(org, ptr(30))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, orgsettings.Validate(&models.OrgSettings{PrivacyLevel: ptr("maximum"), Mandatory: pq.StringArray{models.OrgSettingPrivacyLevel}}))
+	assert.Error(t, orgsettings.Validate(&models.OrgSettings{Mandatory: pq.StringArray{models.OrgSettingProvider}}), "mandatory without a value")
+	assert.Error(t, orgsettings.Validate(&models.OrgSettings{Provider: ptr("unknown")}))
+	assert.Error(t, orgsettings.Validate(&models.OrgSettings{RetentionDays: ptr(0)}))
+	assert.Error(t, orgsettings.Validate(&models.OrgSettings{Mandatory: pq.StringArray{"color"}}))
+}
@@ -0,0 +1,202 @@
+// Package outbox publishes domain events with at-least-once semantics.
+// Events are written to the outbox table in the transaction of the state
+// change they describe, so one is recorded exactly when the change commits;
+// a dispatcher then hands them to the handlers subscribed to their topic,
+// such as analytics, webhooks and email, retrying those that fail.
+// Handlers may see an event more than once and must tolerate it.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"go.uber.org/zap"
+)
+
+// Store persists events and the outcome of their dispatch
+type Store interface {
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error)
+	RecordAttempt(ctx context.Context, id int64, done []string, status models.OutboxStatus, lastError *string, next time.Time) error
+}
+
+// Handler handles one event; an error has it retried later
+type Handler func(ctx context.Context, event *models.OutboxEvent) error
+
+// NewEvent returns an event of topic for userID carrying payload as JSON
+func NewEvent(topic string, userID int64, payload any) (*models.OutboxEvent, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", topic, err)
+	}
+	return &models.OutboxEvent{Topic: topic, UserID: userID, Payload: string(raw)}, nil
+}
+
+// Config tunes dispatch
+type Config struct {
+	// BatchSize caps the events claimed per poll
+	BatchSize    int
+	PollInterval time.Duration
+	// Lease is how long a claimed event is hidden from other dispatchers
+	Lease time.Duration
+	// Failed events are retried after BaseBackoff, doubling up to
+	// MaxBackoff, until MaxAttempts have been made
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:    100,
+		PollInterval: time.Second,
+		Lease:        time.Minute,
+		BaseBackoff:  5 * time.Second,
+		MaxBackoff:   30 * time.Minute,
+		MaxAttempts:  12,
+	}
+}
+
+type subscription struct {
+	name    string
+	topics  []string
+	handler Handler
+}
+
+// Dispatcher delivers pending events to the handlers subscribed to them
+type Dispatcher struct {
+	store  Store
+	cfg    Config
+	logger *zap.Logger
+	subs   []subscription
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewDispatcher(store Store, cfg Config, logger *zap.Logger) *Dispatcher {
+	def := DefaultConfig()
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = def.PollInterval
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = def.Lease
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = def.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = def.MaxAttempts
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Dispatcher{store: store, cfg: cfg, logger: logger}
+}
+
+// Subscribe has handler, known by name, handle events of topics. Names are
+// recorded with the events they handled, so they must stay stable across
+// releases. Subscribe before Start.
+func (d *Dispatcher) Subscribe(name string, handler Handler, topics ...string) {
+	d.subs = append(d.subs, subscription{name: name, topics: topics, handler: handler})
+}
+
+// Backoff is the delay before the attempt after the given one
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Start polls for due events until Stop is called or ctx ends
+func (d *Dispatcher) Start(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			n, err := d.RunOnce(ctx)
+			if err != nil && ctx.Err() == nil {
+				d.logger.Error("outbox dispatch failed", zap.Error(err))
+			}
+			if n == d.cfg.BatchSize {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.cfg.PollInterval):
+			}
+		}
+	}()
+}
+
+// Stop cancels polling and waits for the events in flight
+func (d *Dispatcher) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.wg.Wait()
+}
+
+// RunOnce dispatches the events due now, in order, and returns how many it
+// claimed
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	due, err := d.store.ClaimDue(ctx, d.cfg.BatchSize, d.cfg.Lease)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim outbox events: %w", err)
+	}
+	var errs []error
+	for i := range due {
+		if err := d.dispatch(ctx, &due[i]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return len(due), errors.Join(errs...)
+}
+
+// dispatch runs the handlers of an event that have not handled it yet and
+// records which did
+func (d *Dispatcher) dispatch(ctx context.Context, event *models.OutboxEvent) error {
+	done := append([]string{}, event.Done...)
+	var failures []error
+	for _, sub := range d.subs {
+		if !slices.Contains(sub.topics, event.Topic) || slices.Contains(done, sub.name) {
+			continue
+		}
+		if err := sub.handler(ctx, event); err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", sub.name, err))
+			continue
+		}
+		done = append(done, sub.name)
+	}
+	if len(failures) == 0 {
+		return d.store.RecordAttempt(ctx, event.ID, done, models.OutboxDispatched, nil, time.Now())
+	}
+
+	msg := errors.Join(failures...).Error()
+	attempt := event.Attempts + 1
+	if attempt >= d.cfg.MaxAttempts {
+		d.logger.Warn("outbox event failed", zap.Int64("event_id", event.ID), zap.String("topic", event.Topic),
+			zap.Int("attempts", attempt), zap.String("error", msg))
+		return d.store.RecordAttempt(ctx, event.ID, done, models.OutboxFailed, &msg, time.Now())
+	}
+	next := time.Now().Add(Backoff(d.cfg.BaseBackoff, d.cfg.MaxBackoff, attempt))
+	return d.store.RecordAttempt(ctx, event.ID, done, models.OutboxPending, &msg, next)
+}
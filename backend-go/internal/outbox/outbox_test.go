@@ -0,0 +1,116 @@
+// Package outbox_test provides unit tests for the transactional outbox
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/outbox"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type attempt struct {
+	done   []string
+	status models.OutboxStatus
+	err    *string
+	next   time.Time
+}
+
+type fakeStore struct {
+	events   []models.OutboxEvent
+	attempts map[int64][]attempt
+}
+
+func (f *fakeStore) ClaimDue(_ context.Context, limit int, _ time.Duration) ([]models.OutboxEvent, error) {
+	var out []models.OutboxEvent
+	for _, e := range f.events {
+		if e.Status == models.OutboxPending && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (f *fakeStore) RecordAttempt(_ context.Context, id int64, done []string, status models.OutboxStatus, lastError *string, next time.Time) error {
+	f.attempts[id] = append(f.attempts[id], attempt{done, status, lastError, next})
+	for i := range f.events {
+		if f.events[i].ID == id {
+			f.events[i].Done, f.events[i].Status = done, status
+			f.events[i].Attempts++
+		}
+	}
+	return nil
+}
+
+func TestNewEvent(t *testing.T) {
+	e, err := outbox.NewEvent("generation.completed", 7, map[string]int{"job_id": 3})
+	require.NoError(t, err)
+	assert.Equal(t, "generation.completed", e.Topic)
+	assert.Equal(t, int64(7), e.UserID)
+	assert.JSONEq(t, `{"job_id":3}`, e.Payload)
+}
+
+func TestDispatcherRetriesOnlyFailedHandlers(t *testing.T) {
+	store := &fakeStore{
+		events: []models.OutboxEvent{
+			{ID: 1, Topic: "generation.completed", Status: models.OutboxPending},
+			{ID: 2, Topic: "dataset.uploaded", Status: models.OutboxPending},
+		},
+		attempts: map[int64][]attempt{},
+	}
+	d := outbox.NewDispatcher(store, outbox.Config{BaseBackoff: time.Second, MaxAttempts: 3}, nil)
+	calls := map[string]int{}
+	webhooksDown := true
+	d.Subscribe("notifications", func(context.Context, *models.OutboxEvent) error {
+		calls["notifications"]++
+		return nil
+	}, "generation.completed", "generation.failed")
+	d.Subscribe("webhooks", func(context.Context, *models.OutboxEvent) error {
+		calls["webhooks"]++
+		if webhooksDown {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, "generation.completed")
+
+	n, err := d.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	first := store.attempts[1][0]
+	assert.Equal(t, []string{"notifications"}, first.done)
+	assert.Equal(t, models.OutboxPending, first.status)
+	assert.Contains(t, *first.err, "webhooks: connection refused")
+	assert.WithinDuration(t, time.Now().Add(time.Second), first.next, 500*time.Millisecond)
+	assert.Equal(t, models.OutboxDispatched, store.attempts[2][0].status, "events nobody subscribes to are done at once")
+
+	webhooksDown = false
+	_, err = d.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"notifications": 1, "webhooks": 2}, calls)
+	second := store.attempts[1][1]
+	assert.Equal(t, []string{"notifications", "webhooks"}, second.done)
+	assert.Equal(t, models.OutboxDispatched, second.status)
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	store := &fakeStore{
+		events:   []models.OutboxEvent{{ID: 1, Topic: "generation.failed", Status: models.OutboxPending, Attempts: 2}},
+		attempts: map[int64][]attempt{},
+	}
+	d := outbox.NewDispatcher(store, outbox.Config{MaxAttempts: 3}, nil)
+	d.Subscribe("audit", func(context.Context, *models.OutboxEvent) error { return errors.New("down") }, "generation.failed")
+
+	_, err := d.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, models.OutboxFailed, store.attempts[1][0].status)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 5*time.Second, outbox.Backoff(5*time.Second, time.Minute, 1))
+	assert.Equal(t, 20*time.Second, outbox.Backoff(5*time.Second, time.Minute, 3))
+	assert.Equal(t, time.Minute, outbox.Backoff(5*time.Second, time.Minute, 9))
+}
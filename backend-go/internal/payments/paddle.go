@@ -0,0 +1,574 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+const (
+	// PaddleAPIBase is the Paddle Billing API
+	PaddleAPIBase = "https://api.paddle.com"
+	// PaddleSandboxAPIBase is the Paddle Billing sandbox API
+	PaddleSandboxAPIBase = "https://sandbox-api.paddle.com"
+	// PaddleSignatureTolerance is how old a signed webhook may be
+	PaddleSignatureTolerance = 5 * time.Minute
+)
+
+// Paddle webhook event types handled
+const (
+	PaddleTransactionCompleted = "transaction.completed"
+	PaddleSubscriptionCreated  = "subscription.created"
+	PaddleSubscriptionUpdated  = "subscription.updated"
+	PaddleSubscriptionCanceled = "subscription.canceled"
+	PaddleSubscriptionPastDue  = "subscription.past_due"
+	PaddleSubscriptionPaused   = "subscription.paused"
+	PaddleSubscriptionResumed  = "subscription.resumed"
+)
+
+var (
+	ErrPaddleNotConfigured    = errors.New("paddle is not configured")
+	ErrInvalidPaddleSignature = errors.New("invalid paddle signature")
+	ErrPaddleSignatureExpired = errors.New("paddle signature timestamp is outside the tolerance")
+	ErrUnknownPaddlePrice     = errors.New("no paddle price is configured for the plan")
+)
+
+// PaddleConfig configures the Paddle Billing client
+type PaddleConfig struct {
+	APIKey string
+	// WebhookSecret is the secret key of the notification destination
+	// webhooks are sent to
+	WebhookSecret string
+	// Environment is production or sandbox
+	Environment string
+	// PriceIDs maps plan tiers to the recurring Paddle price they are sold
+	// at; ProductIDs maps them to their Paddle products, so subscriptions to
+	// prices not configured here still resolve to a tier
+	PriceIDs   map[string]string
+	ProductIDs map[string]string
+	// CheckoutURL is the approved page that opens Paddle checkout; empty
+	// uses the account's default payment link
+	CheckoutURL string
+	// BaseURL overrides the API of the environment
+	BaseURL string
+}
+
+// PaddleError is an error returned by the Paddle API
+type PaddleError struct {
+	Status int    `json:"-"`
+	Type   string `json:"type"`
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+func (e *PaddleError) Error() string {
+	return fmt.Sprintf("paddle: %s (status %d, code %s)", e.Detail, e.Status, e.Code)
+}
+
+// PaddleClient calls the Paddle Billing API and verifies its webhooks
+type PaddleClient struct {
+	cfg    PaddleConfig
+	client *http.Client
+}
+
+// NewPaddleClient creates a new Paddle client
+func NewPaddleClient(cfg PaddleConfig) *PaddleClient {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = PaddleAPIBase
+		if cfg.Environment == "sandbox" {
+			cfg.BaseURL = PaddleSandboxAPIBase
+		}
+	}
+	return &PaddleClient{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Configured reports whether API calls can be made
+func (pc *PaddleClient) Configured() bool {
+	return pc != nil && pc.cfg.APIKey != ""
+}
+
+// PriceID returns the Paddle price of a plan tier
+func (pc *PaddleClient) PriceID(tier PricingTier) (string, bool) {
+	id, ok := pc.cfg.PriceIDs[string(tier)]
+	return id, ok && id != ""
+}
+
+// TierForPrice returns the plan tier of a Paddle price, matched by price
+// and then by product
+func (pc *PaddleClient) TierForPrice(priceID, productID string) (PricingTier, bool) {
+	for tier, id := range pc.cfg.PriceIDs {
+		if id != "" && id == priceID {
+			return PricingTier(tier), true
+		}
+	}
+	for tier, id := range pc.cfg.ProductIDs {
+		if id != "" && id == productID {
+			return PricingTier(tier), true
+		}
+	}
+	return "", false
+}
+
+// do sends a JSON request and decodes the data of the response into out
+func (pc *PaddleClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+	if !pc.Configured() {
+		return ErrPaddleNotConfigured
+	}
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode paddle request: %w", err)
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, pc.cfg.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create paddle request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+pc.cfg.APIKey)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := pc.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("paddle request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read paddle response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error PaddleError `json:"error"`
+		}
+		_ = json.Unmarshal(raw, &e)
+		e.Error.Status = resp.StatusCode
+		return &e.Error
+	}
+	if out == nil {
+		return nil
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("invalid paddle response: %w", err)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// CreateCustomer creates a Paddle customer and returns its ID. Paddle keeps
+// one customer per email, so an existing one is returned instead of failing.
+func (pc *PaddleClient) CreateCustomer(ctx context.Context, p CustomerParams) (string, error) {
+	in := map[string]interface{}{
+		"email":       p.Email,
+		"custom_data": map[string]string{"user_id": p.UserID},
+	}
+	if p.Name != "" {
+		in["name"] = p.Name
+	}
+	var out struct {
+		ID string `json:"id"`
+	}
+	err := pc.do(ctx, http.MethodPost, "/customers", in, &out)
+	var pe *PaddleError
+	if errors.As(err, &pe) && pe.Code == "customer_already_exists" {
+		var found []struct {
+			ID string `json:"id"`
+		}
+		if err := pc.do(ctx, http.MethodGet, "/customers?email="+url.QueryEscape(p.Email), nil, &found); err != nil {
+			return "", err
+		}
+		if len(found) == 0 {
+			return "", pe
+		}
+		return found[0].ID, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return out.ID, nil
+}
+
+// TransactionParams describes a subscription checkout
+type TransactionParams struct {
+	UserID     string
+	CustomerID string
+	Tier       PricingTier
+}
+
+// PaddleTransaction is a Paddle transaction; Checkout.URL opens it in Paddle
+// checkout
+type PaddleTransaction struct {
+	ID             string                 `json:"id"`
+	Status         string                 `json:"status"`
+	CustomerID     string                 `json:"customer_id"`
+	SubscriptionID string                 `json:"subscription_id"`
+	CustomData     map[string]interface{} `json:"custom_data"`
+	Checkout       *struct {
+		URL string `json:"url"`
+	} `json:"checkout"`
+	Details *struct {
+		LineItems []struct {
+			ID string `json:"id"`
+		} `json:"line_items"`
+	} `json:"details"`
+}
+
+// CheckoutURL returns where the transaction is paid
+func (t PaddleTransaction) CheckoutURL() string {
+	if t.Checkout == nil {
+		return ""
+	}
+	return t.Checkout.URL
+}
+
+// UserID returns the user a transaction was created for, from its custom
+// data
+func (t PaddleTransaction) UserID() int64 {
+	return customUserID(t.CustomData)
+}
+
+// CreateTransaction opens a transaction for a plan tier. Paying it starts
+// the subscription; the user and tier are kept as custom data, which Paddle
+// copies onto the subscription so webhooks can be matched to them.
+func (pc *PaddleClient) CreateTransaction(ctx context.Context, p TransactionParams) (*PaddleTransaction, error) {
+	price, ok := pc.PriceID(p.Tier)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPaddlePrice, p.Tier)
+	}
+	in := map[string]interface{}{
+		"items":           []map[string]interface{}{{"price_id": price, "quantity": 1}},
+		"collection_mode": "automatic",
+		"custom_data":     map[string]string{"user_id": p.UserID, "tier": string(p.Tier)},
+	}
+	if p.CustomerID != "" {
+		in["customer_id"] = p.CustomerID
+	}
+	if pc.cfg.CheckoutURL != "" {
+		in["checkout"] = map[string]string{"url": pc.cfg.CheckoutURL}
+	}
+	var out PaddleTransaction
+	if err := pc.do(ctx, http.MethodPost, "/transactions", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreatePortalSession opens the Paddle customer portal for a customer.
+// The subscriptions listed get deep links to cancel them and update their
+// payment method; Paddle has no return URL, the portal links back to the
+// checkout domain.
+func (pc *PaddleClient) CreatePortalSession(ctx context.Context, customerID string, subscriptionIDs []string) (*PortalSession, error) {
+	if subscriptionIDs == nil {
+		subscriptionIDs = []string{}
+	}
+	in := map[string]interface{}{"subscription_ids": subscriptionIDs}
+	var out struct {
+		ID   string `json:"id"`
+		URLs struct {
+			General struct {
+				Overview string `json:"overview"`
+			} `json:"general"`
+		} `json:"urls"`
+	}
+	if err := pc.do(ctx, http.MethodPost, "/customers/"+url.PathEscape(customerID)+"/portal-sessions", in, &out); err != nil {
+		return nil, err
+	}
+	return &PortalSession{ID: out.ID, URL: out.URLs.General.Overview}, nil
+}
+
+// GetSubscription fetches a Paddle subscription
+func (pc *PaddleClient) GetSubscription(ctx context.Context, subscriptionID string) (*PaddleSubscription, error) {
+	var out PaddleSubscription
+	if err := pc.do(ctx, http.MethodGet, "/subscriptions/"+url.PathEscape(subscriptionID), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ChangePlan moves a subscription to the price of another tier, prorating
+// the difference on the next bill
+func (pc *PaddleClient) ChangePlan(ctx context.Context, subscriptionID string, tier PricingTier) (*PaddleSubscription, error) {
+	price, ok := pc.PriceID(tier)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPaddlePrice, tier)
+	}
+	in := map[string]interface{}{
+		"items":                  []map[string]interface{}{{"price_id": price, "quantity": 1}},
+		"proration_billing_mode": "prorated_next_billing_period",
+	}
+	var out PaddleSubscription
+	if err := pc.do(ctx, http.MethodPatch, "/subscriptions/"+url.PathEscape(subscriptionID), in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelSubscription cancels a Paddle subscription, at once or when the
+// current billing period ends
+func (pc *PaddleClient) CancelSubscription(ctx context.Context, subscriptionID string, cancelAtPeriodEnd bool) error {
+	return pc.schedule(ctx, subscriptionID, "cancel", cancelAtPeriodEnd)
+}
+
+// PauseSubscription pauses a Paddle subscription, at once or when the
+// current billing period ends
+func (pc *PaddleClient) PauseSubscription(ctx context.Context, subscriptionID string, atPeriodEnd bool) error {
+	return pc.schedule(ctx, subscriptionID, "pause", atPeriodEnd)
+}
+
+// ResumeSubscription resumes a paused Paddle subscription at once
+func (pc *PaddleClient) ResumeSubscription(ctx context.Context, subscriptionID string) error {
+	return pc.schedule(ctx, subscriptionID, "resume", false)
+}
+
+func (pc *PaddleClient) schedule(ctx context.Context, subscriptionID, action string, atPeriodEnd bool) error {
+	effective := "immediately"
+	if atPeriodEnd {
+		effective = "next_billing_period"
+	}
+	path := "/subscriptions/" + url.PathEscape(subscriptionID) + "/" + action
+	return pc.do(ctx, http.MethodPost, path, map[string]string{"effective_from": effective}, nil)
+}
+
+// RefundPayment refunds a completed Paddle transaction; a zero amount
+// refunds it in full, any other is taken from its first line item
+func (pc *PaddleClient) RefundPayment(ctx context.Context, transactionID string, amount float64) error {
+	in := map[string]interface{}{
+		"action":         "refund",
+		"transaction_id": transactionID,
+		"reason":         "requested_by_customer",
+		"type":           "full",
+	}
+	if amount > 0 {
+		var txn PaddleTransaction
+		if err := pc.do(ctx, http.MethodGet, "/transactions/"+url.PathEscape(transactionID), nil, &txn); err != nil {
+			return err
+		}
+		if txn.Details == nil || len(txn.Details.LineItems) == 0 {
+			return fmt.Errorf("paddle transaction %s has no line items to refund", transactionID)
+		}
+		in["type"] = "partial"
+		in["items"] = []map[string]string{{
+			"item_id": txn.Details.LineItems[0].ID,
+			"type":    "partial",
+			"amount":  strconv.FormatInt(int64(math.Round(amount*100)), 10),
+		}}
+	}
+	return pc.do(ctx, http.MethodPost, "/adjustments", in, nil)
+}
+
+// PaddleEvent is a verified webhook event
+type PaddleEvent struct {
+	EventID    string          `json:"event_id"`
+	EventType  string          `json:"event_type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// VerifyWebhook checks the Paddle-Signature header of a webhook against the
+// notification destination's secret key and returns the event. The header
+// carries a timestamp and one or more h1 signatures of "timestamp:payload".
+func (pc *PaddleClient) VerifyWebhook(payload []byte, header string, now time.Time) (*PaddleEvent, error) {
+	if pc == nil || pc.cfg.WebhookSecret == "" {
+		return nil, ErrPaddleNotConfigured
+	}
+	if err := VerifyPaddleSignature(payload, header, pc.cfg.WebhookSecret, now); err != nil {
+		return nil, err
+	}
+	var event PaddleEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid paddle event: %w", err)
+	}
+	return &event, nil
+}
+
+// VerifyPaddleSignature verifies a Paddle-Signature header
+func VerifyPaddleSignature(payload []byte, header, secret string, now time.Time) error {
+	var ts string
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ";") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "ts":
+			ts = v
+		case "h1":
+			if sig, err := hex.DecodeString(v); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	timestamp, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidPaddleSignature
+	}
+	signedAt := time.Unix(timestamp, 0)
+	if now.Sub(signedAt) > PaddleSignatureTolerance || signedAt.Sub(now) > PaddleSignatureTolerance {
+		return ErrPaddleSignatureExpired
+	}
+	expected := paddleMAC(payload, ts, secret)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidPaddleSignature
+}
+
+// SignPaddlePayload returns a Paddle-Signature header for a payload, as
+// Paddle would send it
+func SignPaddlePayload(payload []byte, secret string, at time.Time) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	return "ts=" + ts + ";h1=" + hex.EncodeToString(paddleMAC(payload, ts, secret))
+}
+
+func paddleMAC(payload []byte, ts, secret string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte(":"))
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// PaddleSubscription is the part of a Paddle subscription kept
+type PaddleSubscription struct {
+	ID                   string                 `json:"id"`
+	Status               string                 `json:"status"`
+	CustomerID           string                 `json:"customer_id"`
+	CustomData           map[string]interface{} `json:"custom_data"`
+	CurrentBillingPeriod *PaddlePeriod          `json:"current_billing_period"`
+	ScheduledChange      *struct {
+		Action      string    `json:"action"`
+		EffectiveAt time.Time `json:"effective_at"`
+	} `json:"scheduled_change"`
+	Items []PaddleItem `json:"items"`
+}
+
+// PaddlePeriod is a billing period
+type PaddlePeriod struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+}
+
+// PaddleItem is a subscription item
+type PaddleItem struct {
+	Quantity int64       `json:"quantity"`
+	Price    PaddlePrice `json:"price"`
+}
+
+// PaddlePrice is the price of a subscription item. Amounts are strings in
+// the currency's lowest denomination.
+type PaddlePrice struct {
+	ID        string `json:"id"`
+	ProductID string `json:"product_id"`
+	UnitPrice struct {
+		Amount       string `json:"amount"`
+		CurrencyCode string `json:"currency_code"`
+	} `json:"unit_price"`
+	BillingCycle *struct {
+		Interval  string `json:"interval"`
+		Frequency int64  `json:"frequency"`
+	} `json:"billing_cycle"`
+}
+
+// UserID returns the user a subscription was bought for, from its custom
+// data
+func (s PaddleSubscription) UserID() int64 {
+	return customUserID(s.CustomData)
+}
+
+// customUserID reads user_id from custom data, written as a string or a
+// number
+func customUserID(data map[string]interface{}) int64 {
+	switch v := data["user_id"].(type) {
+	case string:
+		id, _ := strconv.ParseInt(v, 10, 64)
+		return id
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// PaddleStatus maps a Paddle subscription status onto ours. Paused
+// subscriptions are not billed, so they grant no plan.
+func PaddleStatus(status string) models.SubscriptionStatus {
+	switch status {
+	case "active":
+		return models.SubStatusActive
+	case "trialing":
+		return models.SubStatusTrial
+	case "past_due":
+		return models.SubStatusPastDue
+	case "canceled":
+		return models.SubStatusCancelled
+	}
+	return models.SubStatusInactive
+}
+
+// Record turns a Paddle subscription into a subscription record for a user.
+// The tier comes from the price or product, falling back to the checkout's
+// custom data; the monthly amount is normalized from the billing cycle.
+func (pc *PaddleClient) Record(userID int64, s PaddleSubscription) (*models.UserSubscription, error) {
+	rec := &models.UserSubscription{
+		UserID:            userID,
+		Status:            PaddleStatus(s.Status),
+		Provider:          string(ProviderPaddle),
+		ProviderID:        s.ID,
+		CancelAtPeriodEnd: s.ScheduledChange != nil && s.ScheduledChange.Action == "cancel",
+	}
+	tier, _ := s.CustomData["tier"].(string)
+	if len(s.Items) > 0 {
+		item := s.Items[0]
+		if t, ok := pc.TierForPrice(item.Price.ID, item.Price.ProductID); ok {
+			tier = string(t)
+		}
+		rec.MonthlyAmount = item.monthlyAmount()
+	}
+	if tier == "" {
+		return nil, fmt.Errorf("%w: subscription %s", ErrUnknownPaddlePrice, s.ID)
+	}
+	rec.SubscriptionTier = models.SubscriptionTier(tier)
+	if p := s.CurrentBillingPeriod; p != nil {
+		rec.CurrentPeriodStart = p.StartsAt.UTC()
+		rec.CurrentPeriodEnd = p.EndsAt.UTC()
+	}
+	return rec, nil
+}
+
+// monthlyAmount converts the item's recurring price to a monthly amount
+func (item PaddleItem) monthlyAmount() float64 {
+	cents, _ := strconv.ParseInt(item.Price.UnitPrice.Amount, 10, 64)
+	interval, frequency := "month", int64(1)
+	if c := item.Price.BillingCycle; c != nil {
+		interval, frequency = c.Interval, c.Frequency
+	}
+	return monthly(cents, item.Quantity, interval, frequency)
+}
+
+// ParsePaddleObject decodes the data of an event
+func ParsePaddleObject(event *PaddleEvent, out interface{}) error {
+	if len(bytes.TrimSpace(event.Data)) == 0 {
+		return errors.New("paddle event has no data")
+	}
+	return json.Unmarshal(event.Data, out)
+}
@@ -0,0 +1,122 @@
+// Package payments_test provides unit tests for the Paddle integration
+package payments_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/payments"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const paddleSecret = "pdl_ntfset_test_secret"
+
+func TestVerifyPaddleWebhook(t *testing.T) {
+	pc := payments.NewPaddleClient(payments.PaddleConfig{WebhookSecret: paddleSecret})
+	payload := []byte(`{"event_id":"evt_1","event_type":"subscription.updated","occurred_at":"2024-04-12T10:18:49.621022Z","data":{"id":"sub_1"}}`)
+	now := time.Unix(1712917129, 0)
+
+	event, err := pc.VerifyWebhook(payload, payments.SignPaddlePayload(payload, paddleSecret, now), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "evt_1", event.EventID)
+	assert.Equal(t, payments.PaddleSubscriptionUpdated, event.EventType)
+
+	// A rotated secret sends one signature per secret
+	header := payments.SignPaddlePayload(payload, paddleSecret, now) + ";h1=00ff"
+	_, err = pc.VerifyWebhook(payload, header, now)
+	assert.NoError(t, err)
+
+	_, err = pc.VerifyWebhook([]byte(`{"event_id":"evt_2"}`), payments.SignPaddlePayload(payload, paddleSecret, now), now)
+	assert.ErrorIs(t, err, payments.ErrInvalidPaddleSignature)
+	_, err = pc.VerifyWebhook(payload, payments.SignPaddlePayload(payload, "other", now), now)
+	assert.ErrorIs(t, err, payments.ErrInvalidPaddleSignature)
+	_, err = pc.VerifyWebhook(payload, payments.SignPaddlePayload(payload, paddleSecret, now), now.Add(time.Hour))
+	assert.ErrorIs(t, err, payments.ErrPaddleSignatureExpired)
+	_, err = pc.VerifyWebhook(payload, "t=1,v1=abc", now)
+	assert.ErrorIs(t, err, payments.ErrInvalidPaddleSignature)
+
+	_, err = payments.NewPaddleClient(payments.PaddleConfig{}).VerifyWebhook(payload, "", now)
+	assert.ErrorIs(t, err, payments.ErrPaddleNotConfigured)
+}
+
+func TestPaddleRecord(t *testing.T) {
+	pc := payments.NewPaddleClient(payments.PaddleConfig{
+		PriceIDs:   map[string]string{"starter": "pri_starter"},
+		ProductIDs: map[string]string{"growth": "pro_growth"},
+	})
+	var sub payments.PaddleSubscription
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"id": "sub_1",
+		"status": "past_due",
+		"customer_id": "ctm_1",
+		"custom_data": {"user_id": "42", "tier": "starter"},
+		"current_billing_period": {"starts_at": "2024-01-01T00:00:00Z", "ends_at": "2025-01-01T00:00:00Z"},
+		"scheduled_change": {"action": "cancel", "effective_at": "2025-01-01T00:00:00Z"},
+		"items": [{"quantity": 1, "price": {"id": "pri_growth_yearly", "product_id": "pro_growth",
+			"unit_price": {"amount": "1558800", "currency_code": "USD"},
+			"billing_cycle": {"interval": "year", "frequency": 1}}}]
+	}`), &sub))
+
+	assert.Equal(t, int64(42), sub.UserID())
+	rec, err := pc.Record(sub.UserID(), sub)
+	require.NoError(t, err)
+	assert.Equal(t, models.SubscriptionTier("growth"), rec.SubscriptionTier, "unknown prices resolve by product")
+	assert.Equal(t, models.SubStatusPastDue, rec.Status)
+	assert.Equal(t, "paddle", rec.Provider)
+	assert.True(t, rec.CancelAtPeriodEnd)
+	assert.Equal(t, 1299.0, rec.MonthlyAmount)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), rec.CurrentPeriodEnd)
+
+	tier, ok := pc.TierForPrice("pri_starter", "")
+	assert.True(t, ok)
+	assert.Equal(t, payments.TierStarter, tier)
+
+	_, err = pc.Record(1, payments.PaddleSubscription{ID: "sub_2"})
+	assert.ErrorIs(t, err, payments.ErrUnknownPaddlePrice)
+
+	assert.Equal(t, models.SubStatusCancelled, payments.PaddleStatus("canceled"))
+	assert.Equal(t, models.SubStatusInactive, payments.PaddleStatus("paused"))
+}
+
+func TestCreateTransaction(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer pdl_key" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"error":{"type":"request_error","code":"forbidden","detail":"You aren't permitted to perform this request."}}`))
+			return
+		}
+		assert.Equal(t, "/transactions", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"data":{"id":"txn_1","status":"ready","checkout":{"url":"https://pay.example.com?_ptxn=txn_1"}},"meta":{"request_id":"r1"}}`))
+	}))
+	defer srv.Close()
+
+	cfg := payments.PaddleConfig{APIKey: "pdl_key", PriceIDs: map[string]string{"starter": "pri_starter"}, BaseURL: srv.URL}
+	pc := payments.NewPaddleClient(cfg)
+	txn, err := pc.CreateTransaction(context.Background(), payments.TransactionParams{UserID: "7", CustomerID: "ctm_1", Tier: payments.TierStarter})
+	require.NoError(t, err)
+	assert.Equal(t, "txn_1", txn.ID)
+	assert.Equal(t, "https://pay.example.com?_ptxn=txn_1", txn.CheckoutURL())
+	assert.Equal(t, "ctm_1", body["customer_id"])
+	assert.Equal(t, map[string]interface{}{"user_id": "7", "tier": "starter"}, body["custom_data"])
+	items := body["items"].([]interface{})
+	assert.Equal(t, "pri_starter", items[0].(map[string]interface{})["price_id"])
+
+	_, err = pc.CreateTransaction(context.Background(), payments.TransactionParams{UserID: "7", Tier: payments.TierGrowth})
+	assert.ErrorIs(t, err, payments.ErrUnknownPaddlePrice)
+
+	cfg.APIKey = "wrong"
+	_, err = payments.NewPaddleClient(cfg).CreateTransaction(context.Background(), payments.TransactionParams{UserID: "7", Tier: payments.TierStarter})
+	var paddleErr *payments.PaddleError
+	require.ErrorAs(t, err, &paddleErr)
+	assert.Equal(t, http.StatusForbidden, paddleErr.Status)
+	assert.Equal(t, "forbidden", paddleErr.Code)
+}
@@ -75,6 +75,7 @@ type PlanLimits struct {
 	ExportFormats   []string `json:"export_formats"`
 	AdvancedPrivacy bool     `json:"advanced_privacy"`
 	WhiteLabel      bool     `json:"white_label"`
+	Watermarked     bool     `json:"watermarked"`
 }
 
 // Payment represents a payment transaction
@@ -121,10 +122,10 @@ type PaymentService struct {
 }
 
 // NewPaymentService creates a new payment service
-func NewPaymentService(stripeSecretKey, paddleVendorID, paddleVendorAuthCode string) *PaymentService {
+func NewPaymentService(stripe StripeConfig, paddle PaddleConfig) *PaymentService {
 	return &PaymentService{
-		stripeClient:  NewStripeClient(stripeSecretKey),
-		paddleClient:  NewPaddleClient(paddleVendorID, paddleVendorAuthCode),
+		stripeClient:  NewStripeClient(stripe),
+		paddleClient:  NewPaddleClient(paddle),
 		plans:         make(map[string]*PaymentPlan),
 		payments:      make(map[string]*Payment),
 		subscriptions: make(map[string]*Subscription),
@@ -133,7 +134,40 @@ func NewPaymentService(stripeSecretKey, paddleVendorID, paddleVendorAuthCode str
 
 // InitializePlans initializes the default pricing plans
 func (ps *PaymentService) InitializePlans() {
-	plans := []*PaymentPlan{
+	for _, plan := range defaultPlans() {
+		ps.plans[plan.ID] = plan
+	}
+}
+
+// PlanExportFormats returns the formats a plan's generated data can be
+// downloaded in; unknown plans get those of the free plan
+func PlanExportFormats(planID string) []string {
+	var free []string
+	for _, plan := range defaultPlans() {
+		if plan.ID == planID {
+			return plan.Limits.ExportFormats
+		}
+		if plan.Tier == TierFree {
+			free = plan.Limits.ExportFormats
+		}
+	}
+	return free
+}
+
+// PlanWatermarked reports whether a plan's generated data is watermarked;
+// unknown plans are treated as the free plan
+func PlanWatermarked(planID string) bool {
+	for _, plan := range defaultPlans() {
+		if plan.ID == planID {
+			return plan.Limits.Watermarked
+		}
+	}
+	return true
+}
+
+// defaultPlans are the pricing plans
+func defaultPlans() []*PaymentPlan {
+	return []*PaymentPlan{
 		{
 			ID:          "free",
 			Name:        "Free",
@@ -151,7 +185,8 @@ func (ps *PaymentService) InitializePlans() {
 				ConcurrentJobs:  1,
 				SupportLevel:    "community",
 				RetentionDays:   30,
-				ExportFormats:   []string{"csv", "json"},
+				ExportFormats:   []string{"csv", "csv_gzip", "json", "jsonl"},
+				Watermarked:     true,
 				AdvancedPrivacy: false,
 				WhiteLabel:      false,
 			},
@@ -176,7 +211,7 @@ func (ps *PaymentService) InitializePlans() {
 				ConcurrentJobs:  3,
 				SupportLevel:    "email",
 				RetentionDays:   90,
-				ExportFormats:   []string{"csv", "json", "parquet"},
+				ExportFormats:   []string{"csv", "csv_gzip", "json", "jsonl", "parquet", "xlsx", "sql"},
 				AdvancedPrivacy: true,
 				WhiteLabel:      false,
 			},
@@ -201,7 +236,7 @@ func (ps *PaymentService) InitializePlans() {
 				ConcurrentJobs:  10,
 				SupportLevel:    "priority",
 				RetentionDays:   365,
-				ExportFormats:   []string{"csv", "json", "parquet", "avro"},
+				ExportFormats:   []string{"csv", "csv_gzip", "json", "jsonl", "parquet", "xlsx", "avro", "sql"},
 				AdvancedPrivacy: true,
 				WhiteLabel:      true,
 			},
@@ -226,7 +261,7 @@ func (ps *PaymentService) InitializePlans() {
 				ConcurrentJobs:  25,
 				SupportLevel:    "dedicated",
 				RetentionDays:   2555,
-				ExportFormats:   []string{"csv", "json", "parquet", "avro", "hdf5"},
+				ExportFormats:   []string{"csv", "csv_gzip", "json", "jsonl", "parquet", "xlsx", "avro", "hdf5", "sql"},
 				AdvancedPrivacy: true,
 				WhiteLabel:      true,
 			},
@@ -251,7 +286,7 @@ func (ps *PaymentService) InitializePlans() {
 				ConcurrentJobs:  -1, // Unlimited
 				SupportLevel:    "24/7",
 				RetentionDays:   2555,
-				ExportFormats:   []string{"csv", "json", "parquet", "avro", "hdf5", "custom"},
+				ExportFormats:   []string{"csv", "csv_gzip", "json", "jsonl", "parquet", "xlsx", "avro", "hdf5", "sql", "custom"},
 				AdvancedPrivacy: true,
 				WhiteLabel:      true,
 			},
@@ -260,10 +295,6 @@ func (ps *PaymentService) InitializePlans() {
 			UpdatedAt: time.Now(),
 		},
 	}
-
-	for _, plan := range plans {
-		ps.plans[plan.ID] = plan
-	}
 }
 
 // GetPlans returns all available payment plans
@@ -309,18 +340,20 @@ func (ps *PaymentService) CreateCheckout(ctx context.Context, userID, planID str
 	// Create checkout session based on provider
 	switch provider {
 	case ProviderStripe:
-		checkoutURL, err := ps.stripeClient.CreateCheckoutSession(ctx, payment)
+		session, err := ps.stripeClient.CreateCheckoutSession(ctx, CheckoutParams{UserID: userID, Tier: string(plan.Tier)})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create Stripe checkout: %w", err)
 		}
-		payment.CheckoutURL = checkoutURL
+		payment.CheckoutURL = session.URL
+		payment.ProviderID = session.ID
 
 	case ProviderPaddle:
-		checkoutURL, err := ps.paddleClient.CreateCheckoutSession(ctx, payment)
+		txn, err := ps.paddleClient.CreateTransaction(ctx, TransactionParams{UserID: userID, Tier: plan.Tier})
 		if err != nil {
 			return nil, fmt.Errorf("failed to create Paddle checkout: %w", err)
 		}
-		payment.CheckoutURL = checkoutURL
+		payment.CheckoutURL = txn.CheckoutURL()
+		payment.ProviderID = txn.ID
 
 	default:
 		return nil, fmt.Errorf("unsupported payment provider: %s", provider)
@@ -334,9 +367,11 @@ func (ps *PaymentService) CreateCheckout(ctx context.Context, userID, planID str
 func (ps *PaymentService) ProcessWebhook(ctx context.Context, provider PaymentProvider, payload []byte, signature string) error {
 	switch provider {
 	case ProviderStripe:
-		return ps.stripeClient.ProcessWebhook(ctx, payload, signature)
+		_, err := ps.stripeClient.VerifyWebhook(payload, signature, time.Now())
+		return err
 	case ProviderPaddle:
-		return ps.paddleClient.ProcessWebhook(ctx, payload, signature)
+		_, err := ps.paddleClient.VerifyWebhook(payload, signature, time.Now())
+		return err
 	default:
 		return fmt.Errorf("unsupported payment provider: %s", provider)
 	}
@@ -440,90 +475,6 @@ func (ps *PaymentService) GetUsageStats(userID string) (map[string]interface{},
 	return stats, nil
 }
 
-// StripeClient handles Stripe payment operations
-type StripeClient struct {
-	secretKey string
-}
-
-// NewStripeClient creates a new Stripe client
-func NewStripeClient(secretKey string) *StripeClient {
-	return &StripeClient{
-		secretKey: secretKey,
-	}
-}
-
-// CreateCheckoutSession creates a Stripe checkout session
-func (sc *StripeClient) CreateCheckoutSession(ctx context.Context, payment *Payment) (string, error) {
-	// This would integrate with the actual Stripe API
-	// For now, return a mock checkout URL
-	return fmt.Sprintf("https://checkout.stripe.com/mock/%s", payment.ID), nil
-}
-
-// ProcessWebhook processes a Stripe webhook
-func (sc *StripeClient) ProcessWebhook(ctx context.Context, payload []byte, signature string) error {
-	// This would verify the webhook signature and process the event
-	// For now, just log the event
-	fmt.Printf("Processing Stripe webhook: %s\n", string(payload))
-	return nil
-}
-
-// CancelSubscription cancels a Stripe subscription
-func (sc *StripeClient) CancelSubscription(ctx context.Context, subscriptionID string, cancelAtPeriodEnd bool) error {
-	// This would call the Stripe API to cancel the subscription
-	fmt.Printf("Cancelling Stripe subscription: %s\n", subscriptionID)
-	return nil
-}
-
-// RefundPayment refunds a Stripe payment
-func (sc *StripeClient) RefundPayment(ctx context.Context, paymentIntentID string, amount float64) error {
-	// This would call the Stripe API to process the refund
-	fmt.Printf("Refunding Stripe payment: %s, amount: %.2f\n", paymentIntentID, amount)
-	return nil
-}
-
-// PaddleClient handles Paddle payment operations
-type PaddleClient struct {
-	vendorID       string
-	vendorAuthCode string
-}
-
-// NewPaddleClient creates a new Paddle client
-func NewPaddleClient(vendorID, vendorAuthCode string) *PaddleClient {
-	return &PaddleClient{
-		vendorID:       vendorID,
-		vendorAuthCode: vendorAuthCode,
-	}
-}
-
-// CreateCheckoutSession creates a Paddle checkout session
-func (pc *PaddleClient) CreateCheckoutSession(ctx context.Context, payment *Payment) (string, error) {
-	// This would integrate with the actual Paddle API
-	// For now, return a mock checkout URL
-	return fmt.Sprintf("https://checkout.paddle.com/mock/%s", payment.ID), nil
-}
-
-// ProcessWebhook processes a Paddle webhook
-func (pc *PaddleClient) ProcessWebhook(ctx context.Context, payload []byte, signature string) error {
-	// This would verify the webhook signature and process the event
-	// For now, just log the event
-	fmt.Printf("Processing Paddle webhook: %s\n", string(payload))
-	return nil
-}
-
-// CancelSubscription cancels a Paddle subscription
-func (pc *PaddleClient) CancelSubscription(ctx context.Context, subscriptionID string, cancelAtPeriodEnd bool) error {
-	// This would call the Paddle API to cancel the subscription
-	fmt.Printf("Cancelling Paddle subscription: %s\n", subscriptionID)
-	return nil
-}
-
-// RefundPayment refunds a Paddle payment
-func (pc *PaddleClient) RefundPayment(ctx context.Context, transactionID string, amount float64) error {
-	// This would call the Paddle API to process the refund
-	fmt.Printf("Refunding Paddle payment: %s, amount: %.2f\n", transactionID, amount)
-	return nil
-}
-
 // generatePaymentID generates a unique payment ID
 func generatePaymentID() string {
 	return fmt.Sprintf("pay_%d", time.Now().UnixNano())
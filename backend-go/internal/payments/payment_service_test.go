@@ -0,0 +1,25 @@
+// Package payments_test provides unit tests for plan limits
+package payments_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/payments"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanExportFormats(t *testing.T) {
+	assert.NotContains(t, payments.PlanExportFormats("free"), "parquet")
+	assert.Contains(t, payments.PlanExportFormats("starter"), "parquet")
+	assert.Contains(t, payments.PlanExportFormats("starter"), "xlsx")
+	assert.NotContains(t, payments.PlanExportFormats("starter"), "avro")
+	assert.Contains(t, payments.PlanExportFormats("professional"), "avro")
+	assert.Equal(t, payments.PlanExportFormats("free"), payments.PlanExportFormats("unknown"))
+}
+
+func TestPlanWatermarked(t *testing.T) {
+	assert.True(t, payments.PlanWatermarked("free"))
+	assert.True(t, payments.PlanWatermarked("unknown"))
+	assert.False(t, payments.PlanWatermarked("starter"))
+	assert.False(t, payments.PlanWatermarked("enterprise"))
+}
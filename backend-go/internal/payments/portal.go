@@ -0,0 +1,35 @@
+package payments
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidReturnURL is returned for a billing portal return URL outside
+// the allowed origins
+var ErrInvalidReturnURL = errors.New("return url is not on an allowed origin")
+
+// PortalSession is a hosted page where a customer updates payment methods,
+// reads invoices and manages their subscription
+type PortalSession struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// ValidateReturnURL checks that a customer leaving the billing portal is
+// sent back to one of origins, given as scheme://host[:port], so the portal
+// cannot be used to redirect them anywhere else
+func ValidateReturnURL(raw string, origins []string) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.User != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return ErrInvalidReturnURL
+	}
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, o := range origins {
+		if strings.ToLower(strings.TrimRight(strings.TrimSpace(o), "/")) == origin {
+			return nil
+		}
+	}
+	return ErrInvalidReturnURL
+}
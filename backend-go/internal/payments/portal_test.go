@@ -0,0 +1,63 @@
+// Package payments_test provides unit tests for billing portal sessions
+package payments_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/payments"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateReturnURL(t *testing.T) {
+	origins := []string{"https://app.example.com", "http://localhost:3000/"}
+	for _, ok := range []string{"https://app.example.com/billing", "https://APP.example.com", "http://localhost:3000/settings?tab=billing"} {
+		assert.NoError(t, payments.ValidateReturnURL(ok, origins), ok)
+	}
+	for _, bad := range []string{
+		"", "/billing", "https://evil.example.com/billing", "http://app.example.com/billing",
+		"https://app.example.com.evil.com", "https://user@app.example.com", "javascript:alert(1)", "http://localhost:3001",
+	} {
+		assert.ErrorIs(t, payments.ValidateReturnURL(bad, origins), payments.ErrInvalidReturnURL, bad)
+	}
+}
+
+func TestStripeCreatePortalSession(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "/v1/billing_portal/sessions", r.URL.Path)
+		assert.Equal(t, "cus_1", r.PostForm.Get("customer"))
+		assert.Equal(t, "https://app.example.com/billing", r.PostForm.Get("return_url"))
+		_, _ = w.Write([]byte(`{"id":"bps_1","object":"billing_portal.session","url":"https://billing.stripe.com/p/session/bps_1"}`))
+	}))
+	defer srv.Close()
+
+	sc := payments.NewStripeClient(payments.StripeConfig{SecretKey: "sk_test", BaseURL: srv.URL})
+	session, err := sc.CreatePortalSession(context.Background(), "cus_1", "https://app.example.com/billing")
+	require.NoError(t, err)
+	assert.Equal(t, &payments.PortalSession{ID: "bps_1", URL: "https://billing.stripe.com/p/session/bps_1"}, session)
+
+	_, err = payments.NewStripeClient(payments.StripeConfig{}).CreatePortalSession(context.Background(), "cus_1", "")
+	assert.ErrorIs(t, err, payments.ErrStripeNotConfigured)
+}
+
+func TestPaddleCreatePortalSession(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/customers/ctm_1/portal-sessions", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"data":{"id":"cpls_1","customer_id":"ctm_1","urls":{"general":{"overview":"https://customer-portal.paddle.com/cpl_1"},"subscriptions":[]}}}`))
+	}))
+	defer srv.Close()
+
+	pc := payments.NewPaddleClient(payments.PaddleConfig{APIKey: "pdl_key", BaseURL: srv.URL})
+	session, err := pc.CreatePortalSession(context.Background(), "ctm_1", []string{"sub_1"})
+	require.NoError(t, err)
+	assert.Equal(t, &payments.PortalSession{ID: "cpls_1", URL: "https://customer-portal.paddle.com/cpl_1"}, session)
+	assert.Equal(t, []interface{}{"sub_1"}, body["subscription_ids"])
+}
@@ -0,0 +1,488 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// StripeAPIBase is the Stripe REST API
+	StripeAPIBase = "https://api.stripe.com"
+	// StripeSignatureTolerance is how old a signed webhook may be
+	StripeSignatureTolerance = 5 * time.Minute
+)
+
+// Stripe webhook event types handled
+const (
+	StripeCheckoutCompleted   = "checkout.session.completed"
+	StripeSubscriptionCreated = "customer.subscription.created"
+	StripeSubscriptionUpdated = "customer.subscription.updated"
+	StripeSubscriptionDeleted = "customer.subscription.deleted"
+)
+
+var (
+	ErrStripeNotConfigured = errors.New("stripe is not configured")
+	ErrInvalidSignature    = errors.New("invalid stripe signature")
+	ErrSignatureExpired    = errors.New("stripe signature timestamp is outside the tolerance")
+	ErrUnknownPrice        = errors.New("no stripe price is configured for the plan")
+)
+
+// StripeConfig configures the Stripe client
+type StripeConfig struct {
+	SecretKey     string
+	WebhookSecret string
+	// PriceIDs maps plan tiers to the recurring Stripe price they are sold at
+	PriceIDs map[string]string
+	// SuccessURL and CancelURL are where checkout returns; Stripe replaces
+	// {CHECKOUT_SESSION_ID} in them
+	SuccessURL string
+	CancelURL  string
+	// BaseURL overrides StripeAPIBase
+	BaseURL string
+}
+
+// StripeError is an error returned by the Stripe API
+type StripeError struct {
+	Status  int    `json:"-"`
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *StripeError) Error() string {
+	return fmt.Sprintf("stripe: %s (status %d, type %s)", e.Message, e.Status, e.Type)
+}
+
+// StripeClient calls the Stripe REST API and verifies its webhooks
+type StripeClient struct {
+	cfg    StripeConfig
+	client *http.Client
+}
+
+// NewStripeClient creates a new Stripe client
+func NewStripeClient(cfg StripeConfig) *StripeClient {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = StripeAPIBase
+	}
+	return &StripeClient{cfg: cfg, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// Configured reports whether API calls can be made
+func (sc *StripeClient) Configured() bool {
+	return sc != nil && sc.cfg.SecretKey != ""
+}
+
+// PriceID returns the Stripe price of a plan tier
+func (sc *StripeClient) PriceID(tier string) (string, bool) {
+	id, ok := sc.cfg.PriceIDs[tier]
+	return id, ok && id != ""
+}
+
+// TierForPrice returns the plan tier sold at a Stripe price
+func (sc *StripeClient) TierForPrice(priceID string) (string, bool) {
+	for tier, id := range sc.cfg.PriceIDs {
+		if id == priceID {
+			return tier, true
+		}
+	}
+	return "", false
+}
+
+// do sends a form-encoded request and decodes the JSON response into out.
+// POSTs carry an idempotency key so a retried call is not applied twice.
+func (sc *StripeClient) do(ctx context.Context, method, path string, form url.Values, out interface{}) error {
+	if !sc.Configured() {
+		return ErrStripeNotConfigured
+	}
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, sc.cfg.BaseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create stripe request: %w", err)
+	}
+	req.SetBasicAuth(sc.cfg.SecretKey, "")
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if method == http.MethodPost {
+		req.Header.Set("Idempotency-Key", uuid.NewString())
+	}
+	resp, err := sc.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("stripe request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read stripe response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		var e struct {
+			Error StripeError `json:"error"`
+		}
+		_ = json.Unmarshal(raw, &e)
+		e.Error.Status = resp.StatusCode
+		return &e.Error
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// CustomerParams describes a Stripe customer for a user
+type CustomerParams struct {
+	UserID string
+	Email  string
+	Name   string
+}
+
+// CreateCustomer creates a Stripe customer and returns its ID
+func (sc *StripeClient) CreateCustomer(ctx context.Context, p CustomerParams) (string, error) {
+	form := url.Values{}
+	form.Set("email", p.Email)
+	if p.Name != "" {
+		form.Set("name", p.Name)
+	}
+	form.Set("metadata[user_id]", p.UserID)
+	var out struct {
+		ID string `json:"id"`
+	}
+	if err := sc.do(ctx, http.MethodPost, "/v1/customers", form, &out); err != nil {
+		return "", err
+	}
+	return out.ID, nil
+}
+
+// CheckoutParams describes a subscription checkout
+type CheckoutParams struct {
+	UserID     string
+	CustomerID string
+	Tier       string
+}
+
+// CheckoutSession is a hosted Stripe checkout page
+type CheckoutSession struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+// CreateCheckoutSession starts a subscription checkout for a plan tier. The
+// user is recorded on the session and the subscription, so webhooks can be
+// matched to them.
+func (sc *StripeClient) CreateCheckoutSession(ctx context.Context, p CheckoutParams) (*CheckoutSession, error) {
+	price, ok := sc.PriceID(p.Tier)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPrice, p.Tier)
+	}
+	form := url.Values{}
+	form.Set("mode", "subscription")
+	form.Set("line_items[0][price]", price)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("success_url", sc.cfg.SuccessURL)
+	form.Set("cancel_url", sc.cfg.CancelURL)
+	form.Set("client_reference_id", p.UserID)
+	form.Set("metadata[user_id]", p.UserID)
+	form.Set("metadata[tier]", p.Tier)
+	form.Set("subscription_data[metadata][user_id]", p.UserID)
+	form.Set("subscription_data[metadata][tier]", p.Tier)
+	if p.CustomerID != "" {
+		form.Set("customer", p.CustomerID)
+	}
+	var out CheckoutSession
+	if err := sc.do(ctx, http.MethodPost, "/v1/checkout/sessions", form, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CreatePortalSession opens the Stripe billing portal for a customer;
+// leaving it sends them to returnURL
+func (sc *StripeClient) CreatePortalSession(ctx context.Context, customerID, returnURL string) (*PortalSession, error) {
+	form := url.Values{}
+	form.Set("customer", customerID)
+	form.Set("return_url", returnURL)
+	var out PortalSession
+	if err := sc.do(ctx, http.MethodPost, "/v1/billing_portal/sessions", form, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// CancelSubscription cancels a Stripe subscription, at once or when the
+// current period ends
+func (sc *StripeClient) CancelSubscription(ctx context.Context, subscriptionID string, cancelAtPeriodEnd bool) error {
+	path := "/v1/subscriptions/" + url.PathEscape(subscriptionID)
+	if cancelAtPeriodEnd {
+		form := url.Values{}
+		form.Set("cancel_at_period_end", "true")
+		return sc.do(ctx, http.MethodPost, path, form, nil)
+	}
+	return sc.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// RefundPayment refunds a Stripe payment; a zero amount refunds it in full
+func (sc *StripeClient) RefundPayment(ctx context.Context, paymentIntentID string, amount float64) error {
+	form := url.Values{}
+	form.Set("payment_intent", paymentIntentID)
+	if amount > 0 {
+		form.Set("amount", strconv.FormatInt(int64(math.Round(amount*100)), 10))
+	}
+	return sc.do(ctx, http.MethodPost, "/v1/refunds", form, nil)
+}
+
+// MeterEvent is usage reported to a Stripe billing meter
+type MeterEvent struct {
+	// EventName is the event name of the meter
+	EventName  string
+	CustomerID string
+	Value      int64
+	// Identifier makes the event unique; Stripe ignores a second event with
+	// the same identifier
+	Identifier string
+	Timestamp  time.Time
+}
+
+// ReportMeterEvent reports usage to a Stripe billing meter, to be billed
+// with the customer's metered prices in the period of its timestamp
+func (sc *StripeClient) ReportMeterEvent(ctx context.Context, e MeterEvent) error {
+	form := url.Values{}
+	form.Set("event_name", e.EventName)
+	form.Set("payload[stripe_customer_id]", e.CustomerID)
+	form.Set("payload[value]", strconv.FormatInt(e.Value, 10))
+	form.Set("identifier", e.Identifier)
+	form.Set("timestamp", strconv.FormatInt(e.Timestamp.Unix(), 10))
+	return sc.do(ctx, http.MethodPost, "/v1/billing/meter_events", form, nil)
+}
+
+// StripeEvent is a verified webhook event
+type StripeEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// VerifyWebhook checks the Stripe-Signature header of a webhook against the
+// webhook secret and returns the event. The header carries a timestamp and
+// one or more v1 signatures of "timestamp.payload".
+func (sc *StripeClient) VerifyWebhook(payload []byte, header string, now time.Time) (*StripeEvent, error) {
+	if sc == nil || sc.cfg.WebhookSecret == "" {
+		return nil, ErrStripeNotConfigured
+	}
+	if err := VerifyStripeSignature(payload, header, sc.cfg.WebhookSecret, now); err != nil {
+		return nil, err
+	}
+	var event StripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid stripe event: %w", err)
+	}
+	return &event, nil
+}
+
+// VerifyStripeSignature verifies a Stripe-Signature header
+func VerifyStripeSignature(payload []byte, header, secret string, now time.Time) error {
+	var timestamp int64
+	var signatures [][]byte
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch k {
+		case "t":
+			timestamp, _ = strconv.ParseInt(v, 10, 64)
+		case "v1":
+			if sig, err := hex.DecodeString(v); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+	signedAt := time.Unix(timestamp, 0)
+	if now.Sub(signedAt) > StripeSignatureTolerance || signedAt.Sub(now) > StripeSignatureTolerance {
+		return ErrSignatureExpired
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// SignStripePayload returns a Stripe-Signature header for a payload, as
+// Stripe would send it
+func SignStripePayload(payload []byte, secret string, at time.Time) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// StripeCheckout is the part of a completed checkout session kept
+type StripeCheckout struct {
+	ID                string            `json:"id"`
+	Customer          string            `json:"customer"`
+	ClientReferenceID string            `json:"client_reference_id"`
+	Subscription      string            `json:"subscription"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+// StripeSubscription is the part of a Stripe subscription kept
+type StripeSubscription struct {
+	ID                 string            `json:"id"`
+	Customer           string            `json:"customer"`
+	Status             string            `json:"status"`
+	CancelAtPeriodEnd  bool              `json:"cancel_at_period_end"`
+	CurrentPeriodStart int64             `json:"current_period_start"`
+	CurrentPeriodEnd   int64             `json:"current_period_end"`
+	Metadata           map[string]string `json:"metadata"`
+	Items              struct {
+		Data []StripeItem `json:"data"`
+	} `json:"items"`
+}
+
+// StripeItem is a subscription item. Newer API versions keep the billing
+// period on items rather than the subscription.
+type StripeItem struct {
+	CurrentPeriodStart int64       `json:"current_period_start"`
+	CurrentPeriodEnd   int64       `json:"current_period_end"`
+	Quantity           int64       `json:"quantity"`
+	Price              StripePrice `json:"price"`
+}
+
+// StripePrice is the price of a subscription item, in cents
+type StripePrice struct {
+	ID         string           `json:"id"`
+	UnitAmount int64            `json:"unit_amount"`
+	Recurring  *StripeRecurring `json:"recurring"`
+}
+
+// StripeRecurring is how often a price is billed
+type StripeRecurring struct {
+	Interval      string `json:"interval"`
+	IntervalCount int64  `json:"interval_count"`
+}
+
+// UserID returns the user a subscription was bought for, from its metadata
+func (s StripeSubscription) UserID() int64 {
+	id, _ := strconv.ParseInt(s.Metadata["user_id"], 10, 64)
+	return id
+}
+
+// StripeStatus maps a Stripe subscription status onto ours
+func StripeStatus(status string) models.SubscriptionStatus {
+	switch status {
+	case "active":
+		return models.SubStatusActive
+	case "trialing":
+		return models.SubStatusTrial
+	case "past_due", "unpaid":
+		return models.SubStatusPastDue
+	case "canceled", "incomplete_expired":
+		return models.SubStatusCancelled
+	}
+	return models.SubStatusInactive
+}
+
+// Record turns a Stripe subscription into a subscription record for a user.
+// The tier comes from the price, falling back to the checkout metadata; the
+// monthly amount is normalized from the price's interval.
+func (sc *StripeClient) Record(userID int64, s StripeSubscription) (*models.UserSubscription, error) {
+	rec := &models.UserSubscription{
+		UserID:            userID,
+		Status:            StripeStatus(s.Status),
+		Provider:          string(ProviderStripe),
+		ProviderID:        s.ID,
+		CancelAtPeriodEnd: s.CancelAtPeriodEnd,
+	}
+	start, end := s.CurrentPeriodStart, s.CurrentPeriodEnd
+	tier := s.Metadata["tier"]
+	if len(s.Items.Data) > 0 {
+		item := s.Items.Data[0]
+		if t, ok := sc.TierForPrice(item.Price.ID); ok {
+			tier = t
+		}
+		if start == 0 {
+			start, end = item.CurrentPeriodStart, item.CurrentPeriodEnd
+		}
+		rec.MonthlyAmount = item.monthlyAmount()
+	}
+	if tier == "" {
+		return nil, fmt.Errorf("%w: subscription %s", ErrUnknownPrice, s.ID)
+	}
+	rec.SubscriptionTier = models.SubscriptionTier(tier)
+	rec.CurrentPeriodStart = time.Unix(start, 0).UTC()
+	rec.CurrentPeriodEnd = time.Unix(end, 0).UTC()
+	return rec, nil
+}
+
+// monthlyAmount converts the item's recurring price to dollars per month
+func (item StripeItem) monthlyAmount() float64 {
+	interval, count := "month", int64(1)
+	if r := item.Price.Recurring; r != nil {
+		interval, count = r.Interval, r.IntervalCount
+	}
+	return monthly(item.Price.UnitAmount, item.Quantity, interval, count)
+}
+
+// monthly converts a recurring price in cents, billed every count
+// intervals, to dollars per month
+func monthly(cents, quantity int64, interval string, count int64) float64 {
+	if quantity <= 0 {
+		quantity = 1
+	}
+	if count <= 0 {
+		count = 1
+	}
+	amount := float64(cents*quantity) / 100
+	switch interval {
+	case "year":
+		amount /= 12 * float64(count)
+	case "week":
+		amount *= 52.0 / 12 / float64(count)
+	case "day":
+		amount *= 365.0 / 12 / float64(count)
+	default:
+		amount /= float64(count)
+	}
+	return math.Round(amount*100) / 100
+}
+
+// ParseStripeObject decodes the object of an event
+func ParseStripeObject(event *StripeEvent, out interface{}) error {
+	if len(bytes.TrimSpace(event.Data.Object)) == 0 {
+		return errors.New("stripe event has no object")
+	}
+	return json.Unmarshal(event.Data.Object, out)
+}
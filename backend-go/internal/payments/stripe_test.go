@@ -0,0 +1,143 @@
+// Package payments_test provides unit tests for the Stripe integration
+package payments_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/payments"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const secret = "whsec_test_secret"
+
+func TestVerifyWebhook(t *testing.T) {
+	sc := payments.NewStripeClient(payments.StripeConfig{WebhookSecret: secret})
+	payload := []byte(`{"id":"evt_1","type":"customer.subscription.updated","data":{"object":{"id":"sub_1"}}}`)
+	now := time.Unix(1700000000, 0)
+
+	event, err := sc.VerifyWebhook(payload, payments.SignStripePayload(payload, secret, now), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, "evt_1", event.ID)
+	assert.Equal(t, payments.StripeSubscriptionUpdated, event.Type)
+
+	// A rolled secret sends several signatures; any one may match
+	header := payments.SignStripePayload(payload, secret, now)
+	header = header[:len("t=1700000000")] + ",v1=00ff" + header[len("t=1700000000"):]
+	_, err = sc.VerifyWebhook(payload, header, now)
+	assert.NoError(t, err)
+
+	_, err = sc.VerifyWebhook([]byte(`{"id":"evt_2"}`), payments.SignStripePayload(payload, secret, now), now)
+	assert.ErrorIs(t, err, payments.ErrInvalidSignature)
+	_, err = sc.VerifyWebhook(payload, payments.SignStripePayload(payload, "whsec_other", now), now)
+	assert.ErrorIs(t, err, payments.ErrInvalidSignature)
+	_, err = sc.VerifyWebhook(payload, payments.SignStripePayload(payload, secret, now), now.Add(time.Hour))
+	assert.ErrorIs(t, err, payments.ErrSignatureExpired)
+	_, err = sc.VerifyWebhook(payload, "garbage", now)
+	assert.ErrorIs(t, err, payments.ErrInvalidSignature)
+
+	_, err = payments.NewStripeClient(payments.StripeConfig{}).VerifyWebhook(payload, "", now)
+	assert.ErrorIs(t, err, payments.ErrStripeNotConfigured)
+}
+
+func TestRecord(t *testing.T) {
+	sc := payments.NewStripeClient(payments.StripeConfig{PriceIDs: map[string]string{"growth": "price_growth_yearly"}})
+	sub := payments.StripeSubscription{ID: "sub_1", Status: "past_due", Metadata: map[string]string{"user_id": "42", "tier": "starter"}}
+	item := payments.StripeItem{CurrentPeriodStart: 1700000000, CurrentPeriodEnd: 1731536000, Quantity: 1}
+	item.Price.ID = "price_growth_yearly"
+	item.Price.UnitAmount = 1558800
+	item.Price.Recurring = &payments.StripeRecurring{Interval: "year", IntervalCount: 1}
+	sub.Items.Data = append(sub.Items.Data, item)
+
+	assert.Equal(t, int64(42), sub.UserID())
+	rec, err := sc.Record(sub.UserID(), sub)
+	require.NoError(t, err)
+	assert.Equal(t, models.SubscriptionTier("growth"), rec.SubscriptionTier, "the price decides the tier")
+	assert.Equal(t, models.SubStatusPastDue, rec.Status)
+	assert.Equal(t, 1299.0, rec.MonthlyAmount)
+	assert.Equal(t, time.Unix(1731536000, 0).UTC(), rec.CurrentPeriodEnd, "period read from the item")
+
+	_, err = sc.Record(1, payments.StripeSubscription{ID: "sub_2"})
+	assert.ErrorIs(t, err, payments.ErrUnknownPrice)
+
+	assert.Equal(t, models.SubStatusTrial, payments.StripeStatus("trialing"))
+	assert.Equal(t, models.SubStatusCancelled, payments.StripeStatus("canceled"))
+	assert.Equal(t, models.SubStatusInactive, payments.StripeStatus("incomplete"))
+}
+
+func TestCreateCheckoutSession(t *testing.T) {
+	var form map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _, _ := r.BasicAuth()
+		if user != "sk_test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"type":"invalid_request_error","message":"Invalid API Key"}}`))
+			return
+		}
+		require.NoError(t, r.ParseForm())
+		form = map[string]string{}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		assert.Equal(t, "/v1/checkout/sessions", r.URL.Path)
+		assert.NotEmpty(t, r.Header.Get("Idempotency-Key"))
+		_, _ = w.Write([]byte(`{"id":"cs_1","url":"https://checkout.stripe.com/c/pay/cs_1"}`))
+	}))
+	defer srv.Close()
+
+	cfg := payments.StripeConfig{
+		SecretKey:  "sk_test",
+		PriceIDs:   map[string]string{"starter": "price_starter"},
+		SuccessURL: "https://app.example.com/billing?session_id={CHECKOUT_SESSION_ID}",
+		CancelURL:  "https://app.example.com/billing",
+		BaseURL:    srv.URL,
+	}
+	sc := payments.NewStripeClient(cfg)
+	session, err := sc.CreateCheckoutSession(context.Background(), payments.CheckoutParams{UserID: "7", CustomerID: "cus_1", Tier: "starter"})
+	require.NoError(t, err)
+	assert.Equal(t, "cs_1", session.ID)
+	assert.Equal(t, "price_starter", form["line_items[0][price]"])
+	assert.Equal(t, "subscription", form["mode"])
+	assert.Equal(t, "7", form["subscription_data[metadata][user_id]"])
+	assert.Equal(t, "cus_1", form["customer"])
+
+	_, err = sc.CreateCheckoutSession(context.Background(), payments.CheckoutParams{UserID: "7", Tier: "growth"})
+	assert.ErrorIs(t, err, payments.ErrUnknownPrice)
+
+	cfg.SecretKey = "sk_wrong"
+	_, err = payments.NewStripeClient(cfg).CreateCheckoutSession(context.Background(), payments.CheckoutParams{UserID: "7", Tier: "starter"})
+	var stripeErr *payments.StripeError
+	require.ErrorAs(t, err, &stripeErr)
+	assert.Equal(t, http.StatusUnauthorized, stripeErr.Status)
+	assert.Equal(t, "Invalid API Key", stripeErr.Message)
+}
+
+func TestReportMeterEvent(t *testing.T) {
+	var form map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		form = map[string]string{}
+		for k := range r.PostForm {
+			form[k] = r.PostForm.Get(k)
+		}
+		assert.Equal(t, "/v1/billing/meter_events", r.URL.Path)
+		_, _ = w.Write([]byte(`{"object":"billing.meter_event"}`))
+	}))
+	defer srv.Close()
+
+	sc := payments.NewStripeClient(payments.StripeConfig{SecretKey: "sk_test", BaseURL: srv.URL})
+	at := time.Unix(1792000000, 0)
+	require.NoError(t, sc.ReportMeterEvent(context.Background(), payments.MeterEvent{EventName: "api_overage", CustomerID: "cus_1", Value: 250, Identifier: "usage-1", Timestamp: at}))
+	assert.Equal(t, map[string]string{
+		"event_name":                  "api_overage",
+		"payload[stripe_customer_id]": "cus_1",
+		"payload[value]":              "250",
+		"identifier":                  "usage-1",
+		"timestamp":                   "1792000000",
+	}, form)
+}
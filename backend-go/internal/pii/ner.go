@@ -0,0 +1,118 @@
+package pii
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+)
+
+// DefaultTimeout bounds one call to the NER provider
+const DefaultTimeout = 30 * time.Second
+
+// labels maps the entity labels of common NER models to the kinds they are
+// reported as; other labels are ignored
+var labels = map[string]string{
+	"PERSON":  KindName,
+	"PER":     KindName,
+	"NAME":    KindName,
+	"ADDRESS": KindAddress,
+	"LOC":     KindAddress,
+	"GPE":     KindAddress,
+	"FAC":     KindAddress,
+	"EMAIL":   KindEmail,
+	"PHONE":   KindPhone,
+}
+
+// Config configures the NER provider client
+type Config struct {
+	// URL is the base URL of the provider; empty disables NER
+	URL string
+	// Token, when set, is sent as a bearer token
+	Token   string
+	Timeout time.Duration
+	// Transport, when set, carries requests to the provider
+	Transport http.RoundTripper
+}
+
+// HTTPRecognizer asks an NER service for the entities of texts. It posts
+// {"texts": [...]} to /v1/ner and reads the entities of each text from
+// {"entities": [[{"label": "PERSON", "text": "..."}], ...]}.
+type HTTPRecognizer struct {
+	endpoint string
+	token    string
+	http     *http.Client
+}
+
+// NewRecognizer returns a client for the configured provider, or nil when
+// no URL is set
+func NewRecognizer(cfg Config) (*HTTPRecognizer, error) {
+	if cfg.URL == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid NER provider URL %q", cfg.URL)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	return &HTTPRecognizer{
+		endpoint: strings.TrimSuffix(cfg.URL, "/") + "/v1/ner",
+		token:    cfg.Token,
+		http:     &http.Client{Timeout: cfg.Timeout, Transport: cfg.Transport},
+	}, nil
+}
+
+func (r *HTTPRecognizer) Recognize(ctx context.Context, texts []string) ([][]Entity, error) {
+	payload, err := json.Marshal(map[string][]string{"texts": texts})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// Error bodies may quote the texts they were sent
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4*1024))
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, redact.String(strings.TrimSpace(string(raw))))
+	}
+	var body struct {
+		Entities [][]struct {
+			Label string `json:"label"`
+			Text  string `json:"text"`
+		} `json:"entities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("malformed response: %w", err)
+	}
+	if len(body.Entities) != len(texts) {
+		return nil, fmt.Errorf("malformed response: entities for %d of %d texts", len(body.Entities), len(texts))
+	}
+	out := make([][]Entity, len(texts))
+	for i, found := range body.Entities {
+		for _, e := range found {
+			if kind, ok := labels[strings.ToUpper(e.Label)]; ok {
+				out[i] = append(out[i], Entity{Kind: kind, Text: e.Text})
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,245 @@
+// Package pii classifies the columns of a dataset by the personal data they
+// hold when it is ingested. Values are matched against the patterns the
+// service already scrubs text with, column names are matched against the
+// names personal data is usually stored under, and an optional NER provider
+// finds the names and addresses patterns cannot. The classification marks
+// columns as sensitive for the privacy controls of later jobs.
+package pii
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/freetext"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Kinds of personal data
+const (
+	KindEmail   = "email"
+	KindPhone   = "phone"
+	KindSSN     = "ssn"
+	KindCard    = "card"
+	KindName    = "name"
+	KindAddress = "address"
+)
+
+// Kinds are the kinds the scanner reports, in the order they are listed
+var Kinds = []string{KindEmail, KindPhone, KindSSN, KindCard, KindName, KindAddress}
+
+// Detectors
+const (
+	DetectorColumnName = "column_name"
+	DetectorRegex      = "regex"
+	DetectorNER        = "ner"
+)
+
+const (
+	// DefaultMinShare is the share of a column's values that must hold a
+	// kind of PII for its values to flag the column
+	DefaultMinShare = 0.3
+	// MaxNERValues caps the values of a column sent to the NER provider
+	MaxNERValues = 50
+)
+
+// ErrRecognizer matches errors from the NER provider
+var ErrRecognizer = errors.New("NER provider failed")
+
+// columnNames match the names columns of each kind are usually stored under
+var columnNames = map[string]*regexp.Regexp{
+	KindEmail:   regexp.MustCompile(`(?i)e-?mail`),
+	KindPhone:   regexp.MustCompile(`(?i)phone|mobile|(^|_)(tel|fax)($|_)`),
+	KindSSN:     regexp.MustCompile(`(?i)(^|_)ssn($|_)|social_?security`),
+	KindCard:    regexp.MustCompile(`(?i)credit_?card|card_?(number|num|no)($|_)|(^|_)pan($|_)`),
+	KindName:    regexp.MustCompile(`(?i)(first|last|full|given|middle|customer|patient|contact)_?name|surname|^name$`),
+	KindAddress: regexp.MustCompile(`(?i)address|street|(^|_)addr($|_)`),
+}
+
+// Entity is a span of personal data a NER provider found in a text
+type Entity struct {
+	Kind string `json:"kind"`
+	Text string `json:"text"`
+}
+
+// Recognizer finds named entities in texts, returning the entities of each
+// text in order
+type Recognizer interface {
+	Recognize(ctx context.Context, texts []string) ([][]Entity, error)
+}
+
+// Scanner classifies columns. Recognizer is optional; without it names and
+// addresses are only found by their column names and the patterns of
+// addresses and titled names.
+type Scanner struct {
+	Recognizer Recognizer
+	// MinShare defaults to DefaultMinShare
+	MinShare float64
+}
+
+// Scan classifies the columns of sampled rows and returns the columns that
+// hold personal data. When the NER provider fails the columns found without
+// it are returned with an error matching ErrRecognizer.
+func (s *Scanner) Scan(ctx context.Context, columns []string, rows []map[string]interface{}) ([]models.DatasetPII, error) {
+	minShare := s.MinShare
+	if minShare <= 0 {
+		minShare = DefaultMinShare
+	}
+	var (
+		out    []models.DatasetPII
+		nerErr error
+	)
+	for _, col := range columns {
+		values := columnValues(rows, col)
+		regex := map[string]float64{}
+		if len(values) > 0 {
+			counts := map[string]int{}
+			for _, v := range values {
+				_, found := freetext.Scrub(v)
+				for kind := range found {
+					counts[kind]++
+				}
+			}
+			for kind, n := range counts {
+				regex[kind] = float64(n) / float64(len(values))
+			}
+		}
+		var ner map[string]float64
+		if s.Recognizer != nil && nerErr == nil {
+			if ner, nerErr = s.recognize(ctx, values); nerErr != nil {
+				nerErr = fmt.Errorf("%w: %w", ErrRecognizer, nerErr)
+			}
+		}
+
+		c := models.DatasetPII{ColumnName: col, Kinds: []string{}, Detectors: []string{}}
+		detectors := map[string]bool{}
+		for _, kind := range Kinds {
+			named := columnNames[kind].MatchString(col)
+			share := max(regex[kind], ner[kind])
+			if !named && share < minShare {
+				continue
+			}
+			c.Kinds = append(c.Kinds, kind)
+			c.Share = max(c.Share, share)
+			detectors[DetectorColumnName] = detectors[DetectorColumnName] || named
+			detectors[DetectorRegex] = detectors[DetectorRegex] || regex[kind] >= minShare
+			detectors[DetectorNER] = detectors[DetectorNER] || ner[kind] >= minShare
+		}
+		if len(c.Kinds) == 0 {
+			continue
+		}
+		for _, d := range []string{DetectorColumnName, DetectorRegex, DetectorNER} {
+			if detectors[d] {
+				c.Detectors = append(c.Detectors, d)
+			}
+		}
+		c.Category = Category(c.Kinds)
+		c.Share = round(c.Share)
+		out = append(out, c)
+	}
+	return out, nerErr
+}
+
+// recognize returns the share of a column's text values the NER provider
+// finds each kind in
+func (s *Scanner) recognize(ctx context.Context, values []string) (map[string]float64, error) {
+	var texts []string
+	seen := map[string]bool{}
+	for _, v := range values {
+		if len(texts) == MaxNERValues {
+			break
+		}
+		if !seen[v] && strings.IndexFunc(v, unicode.IsLetter) >= 0 {
+			seen[v] = true
+			texts = append(texts, v)
+		}
+	}
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	entities, err := s.Recognizer.Recognize(ctx, texts)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, found := range entities {
+		kinds := map[string]bool{}
+		for _, e := range found {
+			kinds[e.Kind] = true
+		}
+		for kind := range kinds {
+			counts[kind]++
+		}
+	}
+	out := make(map[string]float64, len(counts))
+	for kind, n := range counts {
+		out[kind] = float64(n) / float64(len(texts))
+	}
+	return out, nil
+}
+
+// Category is the privacy category of a column holding kinds: financial
+// for card numbers, personal data otherwise
+func Category(kinds []string) models.PrivacyCategory {
+	for _, k := range kinds {
+		if k == KindCard {
+			return models.PrivacyCategoryFinancial
+		}
+	}
+	return models.PrivacyCategoryPII
+}
+
+// Columns names the classified columns
+func Columns(classified []models.DatasetPII) []string {
+	out := make([]string, 0, len(classified))
+	for _, c := range classified {
+		out = append(out, c.ColumnName)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Find returns the classification of a column, matched regardless of case
+func Find(classified []models.DatasetPII, column string) (models.DatasetPII, bool) {
+	for _, c := range classified {
+		if strings.EqualFold(c.ColumnName, column) {
+			return c, true
+		}
+	}
+	return models.DatasetPII{}, false
+}
+
+// columnValues returns the non-empty values of a column as text; nested
+// values are skipped
+func columnValues(rows []map[string]interface{}, col string) []string {
+	var out []string
+	for _, row := range rows {
+		var s string
+		switch v := row[col].(type) {
+		case string:
+			s = v
+		case float64:
+			s = strconv.FormatFloat(v, 'f', -1, 64)
+		case json.Number:
+			s = v.String()
+		case int64:
+			s = strconv.FormatInt(v, 10)
+		case int:
+			s = strconv.Itoa(v)
+		}
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func round(v float64) float64 {
+	return float64(int(v*10000+0.5)) / 10000
+}
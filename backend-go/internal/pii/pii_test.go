@@ -0,0 +1,129 @@
+// Package pii_test provides unit tests for the PII scanner
+package pii_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pii"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func customers() ([]string, []map[string]interface{}) {
+	columns := []string{"id", "contact", "ssn", "payment", "holder", "notes", "plan"}
+	rows := make([]map[string]interface{}, 10)
+	for i := range rows {
+		rows[i] = map[string]interface{}{
+			"id":      float64(i),
+			"contact": fmt.Sprintf("user%d@example.com", i),
+			"ssn":     "",
+			"payment": "4111 1111 1111 1111",
+			"holder":  fmt.Sprintf("Jordan Lee%d", i),
+			"notes":   "Delivered to 12 Oak Street on time",
+			"plan":    "pro",
+		}
+	}
+	rows[0]["notes"] = "Left with the neighbour"
+	return columns, rows
+}
+
+func TestScan(t *testing.T) {
+	columns, rows := customers()
+	out, err := (&pii.Scanner{}).Scan(context.Background(), columns, rows)
+	require.NoError(t, err)
+	require.Len(t, out, 4, "ids, plans and names without a recognizer are not flagged")
+
+	assert.Equal(t, "contact", out[0].ColumnName)
+	assert.Equal(t, []string{pii.KindEmail}, []string(out[0].Kinds))
+	assert.Equal(t, []string{pii.DetectorRegex}, []string(out[0].Detectors))
+	assert.Equal(t, 1.0, out[0].Share)
+	assert.Equal(t, models.PrivacyCategoryPII, out[0].Category)
+
+	assert.Equal(t, "ssn", out[1].ColumnName, "an empty column is flagged by its name")
+	assert.Equal(t, []string{pii.DetectorColumnName}, []string(out[1].Detectors))
+	assert.Equal(t, 0.0, out[1].Share)
+
+	assert.Equal(t, []string{pii.KindCard}, []string(out[2].Kinds))
+	assert.Equal(t, models.PrivacyCategoryFinancial, out[2].Category)
+
+	assert.Equal(t, "notes", out[3].ColumnName)
+	assert.Equal(t, []string{pii.KindAddress}, []string(out[3].Kinds))
+	assert.Equal(t, 0.9, out[3].Share)
+}
+
+// people finds a person in every text holding a capitalised surname
+type people struct{ calls int }
+
+func (p *people) Recognize(_ context.Context, texts []string) ([][]pii.Entity, error) {
+	p.calls++
+	out := make([][]pii.Entity, len(texts))
+	for i, t := range texts {
+		if strings.Contains(t, "Lee") {
+			out[i] = []pii.Entity{{Kind: pii.KindName, Text: t}}
+		}
+	}
+	return out, nil
+}
+
+type failing struct{}
+
+func (failing) Recognize(context.Context, []string) ([][]pii.Entity, error) {
+	return nil, errors.New("unavailable")
+}
+
+func TestScanWithRecognizer(t *testing.T) {
+	columns, rows := customers()
+	ner := &people{}
+	out, err := (&pii.Scanner{Recognizer: ner}).Scan(context.Background(), columns, rows)
+	require.NoError(t, err)
+	holder, ok := pii.Find(out, "Holder")
+	require.True(t, ok)
+	assert.Equal(t, []string{pii.KindName}, []string(holder.Kinds))
+	assert.Equal(t, []string{pii.DetectorNER}, []string(holder.Detectors))
+	assert.Equal(t, []string{"contact", "holder", "notes", "payment", "ssn"}, pii.Columns(out))
+
+	// Without the provider the pattern results still come back
+	out, err = (&pii.Scanner{Recognizer: failing{}}).Scan(context.Background(), columns, rows)
+	assert.ErrorIs(t, err, pii.ErrRecognizer)
+	assert.Len(t, out, 4)
+}
+
+func TestHTTPRecognizer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/ner", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		var body struct{ Texts []string }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if len(body.Texts) > 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("cannot read " + body.Texts[1]))
+			return
+		}
+		_, _ = w.Write([]byte(`{"entities":[[{"label":"PERSON","text":"Ana Ruiz"},{"label":"ORG","text":"Acme"},{"label":"gpe","text":"Lima"}]]}`))
+	}))
+	defer srv.Close()
+
+	r, err := pii.NewRecognizer(pii.Config{URL: srv.URL + "/", Token: "secret"})
+	require.NoError(t, err)
+	out, err := r.Recognize(context.Background(), []string{"Ana Ruiz of Acme lives in Lima"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]pii.Entity{{{Kind: pii.KindName, Text: "Ana Ruiz"}, {Kind: pii.KindAddress, Text: "Lima"}}}, out)
+
+	_, err = r.Recognize(context.Background(), []string{"a", "mail ana@example.com"})
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "ana@example.com")
+
+	r, err = pii.NewRecognizer(pii.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, r)
+	_, err = pii.NewRecognizer(pii.Config{URL: "ner:8080"})
+	assert.Error(t, err)
+}
@@ -14,6 +14,36 @@ type Plan struct {
 	PaddleProductID *string  `json:"paddle_product_id,omitempty"`
 	MostPopular     bool     `json:"most_popular"`
 	Badge           *string  `json:"badge,omitempty"`
+	SLA             *SLA     `json:"sla,omitempty"`
+	WhiteLabel      bool     `json:"white_label"`
+	// MockAPIs bounds the hosted mock endpoints of a plan; nil when the
+	// plan has none
+	MockAPIs *MockAPILimits `json:"mock_apis,omitempty"`
+	// Metering is the usage a plan includes each month and what usage past
+	// it costs; nil when the plan bills no overage
+	Metering *MeteringRates `json:"metering,omitempty"`
+}
+
+// MockAPILimits bound the mock REST endpoints a subscriber can host on
+// generated datasets
+type MockAPILimits struct {
+	// MaxMocks caps the mocks that have not expired
+	MaxMocks          int `json:"max_mocks"`
+	RequestsPerMinute int `json:"requests_per_minute"`
+	MaxTTLHours       int `json:"max_ttl_hours"`
+}
+
+// MeteringRates are the usage a plan includes each month, on top of the
+// rows of its MonthlyLimit, and the USD price of usage past it. An included
+// amount of -1 is unlimited.
+type MeteringRates struct {
+	IncludedAPIRequests     int64   `json:"included_api_requests"`
+	IncludedStorageGBDays   float64 `json:"included_storage_gb_days"`
+	IncludedTrainingMinutes int64   `json:"included_training_minutes"`
+	PricePer1000Rows        float64 `json:"price_per_1000_rows"`
+	PricePer1000APIRequests float64 `json:"price_per_1000_api_requests"`
+	PricePerGBDay           float64 `json:"price_per_gb_day"`
+	PricePerTrainingMinute  float64 `json:"price_per_training_minute"`
 }
 
 func SubscriptionPlans() []Plan {
@@ -57,6 +87,15 @@ func SubscriptionPlans() []Plan {
 			PaddleProductID: &starterPaddle,
 			MostPopular:     true,
 			Badge:           stringPtr("Most Popular"),
+			MockAPIs:        &MockAPILimits{MaxMocks: 1, RequestsPerMinute: 60, MaxTTLHours: 24},
+			Metering: &MeteringRates{
+				IncludedAPIRequests:     100000,
+				IncludedStorageGBDays:   150,
+				PricePer1000Rows:        2,
+				PricePer1000APIRequests: 0.5,
+				PricePerGBDay:           0.01,
+				PricePerTrainingMinute:  0.1,
+			},
 		},
 		{
 			ID:           "professional",
@@ -74,6 +113,16 @@ func SubscriptionPlans() []Plan {
 			APIRateLimit:    5000,
 			StripePriceID:   &profStripe,
 			PaddleProductID: &profPaddle,
+			WhiteLabel:      true,
+			MockAPIs:        &MockAPILimits{MaxMocks: 5, RequestsPerMinute: 600, MaxTTLHours: 7 * 24},
+			Metering: &MeteringRates{
+				IncludedAPIRequests:     2000000,
+				IncludedStorageGBDays:   1500,
+				PricePer1000Rows:        0.6,
+				PricePer1000APIRequests: 0.2,
+				PricePerGBDay:           0.008,
+				PricePerTrainingMinute:  0.1,
+			},
 		},
 		{
 			ID:           "growth",
@@ -92,6 +141,18 @@ func SubscriptionPlans() []Plan {
 			APIRateLimit:    10000,
 			StripePriceID:   &growthStripe,
 			PaddleProductID: &growthPaddle,
+			SLA:             growthSLA(),
+			WhiteLabel:      true,
+			MockAPIs:        &MockAPILimits{MaxMocks: 20, RequestsPerMinute: 3000, MaxTTLHours: 30 * 24},
+			Metering: &MeteringRates{
+				IncludedAPIRequests:     10000000,
+				IncludedStorageGBDays:   6000,
+				IncludedTrainingMinutes: 600,
+				PricePer1000Rows:        0.3,
+				PricePer1000APIRequests: 0.1,
+				PricePerGBDay:           0.006,
+				PricePerTrainingMinute:  0.08,
+			},
 		},
 		{
 			ID:           "enterprise",
@@ -110,6 +171,16 @@ func SubscriptionPlans() []Plan {
 			StripePriceID:   &entStripe,
 			PaddleProductID: &entPaddle,
 			Badge:           stringPtr("Contact Sales"),
+			SLA:             enterpriseSLA(),
+			WhiteLabel:      true,
+			MockAPIs:        &MockAPILimits{MaxMocks: 100, RequestsPerMinute: 30000, MaxTTLHours: 90 * 24},
+			Metering: &MeteringRates{
+				IncludedAPIRequests:     -1,
+				IncludedStorageGBDays:   30000,
+				IncludedTrainingMinutes: 6000,
+				PricePerGBDay:           0.004,
+				PricePerTrainingMinute:  0.05,
+			},
 		},
 	}
 }
@@ -133,3 +204,50 @@ func SupportTiers() []SupportTier {
 func stringPtr(s string) *string {
 	return &s
 }
+
+// StripePriceIDs maps plan IDs to their Stripe prices, with overrides such
+// as those configured per deployment taking precedence
+func StripePriceIDs(overrides map[string]string) map[string]string {
+	out := make(map[string]string)
+	for _, p := range SubscriptionPlans() {
+		if p.StripePriceID != nil {
+			out[p.ID] = *p.StripePriceID
+		}
+	}
+	for id, price := range overrides {
+		out[id] = price
+	}
+	return out
+}
+
+// PaddleProductIDs maps plan IDs to their Paddle products
+func PaddleProductIDs() map[string]string {
+	out := make(map[string]string)
+	for _, p := range SubscriptionPlans() {
+		if p.PaddleProductID != nil {
+			out[p.ID] = *p.PaddleProductID
+		}
+	}
+	return out
+}
+
+// PlanWhiteLabel reports whether a plan includes white-label branding
+func PlanWhiteLabel(planID string) bool {
+	for _, p := range SubscriptionPlans() {
+		if p.ID == planID {
+			return p.WhiteLabel
+		}
+	}
+	return false
+}
+
+// PlanMockAPIs returns the mock API limits of a plan, or nil if it has no
+// mock APIs
+func PlanMockAPIs(planID string) *MockAPILimits {
+	for _, p := range SubscriptionPlans() {
+		if p.ID == planID {
+			return p.MockAPIs
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package pricing
+
+// SLA is the service level a plan promises. Missing a target earns the
+// subscriber a credit worth a percentage of that month's fee.
+type SLA struct {
+	// AvailabilityTarget is the monthly uptime promised, in percent
+	AvailabilityTarget float64 `json:"availability_target"`
+	// P95JobLatencySeconds bounds the 95th percentile time from submitting a
+	// generation job to its completion
+	P95JobLatencySeconds float64 `json:"p95_job_latency_seconds"`
+	// AvailabilityCredits are checked in order; the first tier whose floor
+	// the measured availability falls below applies
+	AvailabilityCredits []SLACreditTier `json:"availability_credits"`
+	// LatencyCreditPercent is credited when the latency target is missed
+	LatencyCreditPercent float64 `json:"latency_credit_percent"`
+	// MaxCreditPercent caps the total credit for one month
+	MaxCreditPercent float64 `json:"max_credit_percent"`
+}
+
+// SLACreditTier credits CreditPercent of the monthly fee when availability
+// drops below BelowPercent
+type SLACreditTier struct {
+	BelowPercent  float64 `json:"below_percent"`
+	CreditPercent float64 `json:"credit_percent"`
+}
+
+func growthSLA() *SLA {
+	return &SLA{
+		AvailabilityTarget:   99.9,
+		P95JobLatencySeconds: 600,
+		AvailabilityCredits: []SLACreditTier{
+			{BelowPercent: 95, CreditPercent: 50},
+			{BelowPercent: 99, CreditPercent: 25},
+			{BelowPercent: 99.9, CreditPercent: 10},
+		},
+		LatencyCreditPercent: 10,
+		MaxCreditPercent:     50,
+	}
+}
+
+func enterpriseSLA() *SLA {
+	return &SLA{
+		AvailabilityTarget:   99.95,
+		P95JobLatencySeconds: 300,
+		AvailabilityCredits: []SLACreditTier{
+			{BelowPercent: 95, CreditPercent: 100},
+			{BelowPercent: 99, CreditPercent: 30},
+			{BelowPercent: 99.95, CreditPercent: 10},
+		},
+		LatencyCreditPercent: 15,
+		MaxCreditPercent:     100,
+	}
+}
+
+// PlanSLA returns the SLA promised by a plan, or nil if it has none
+func PlanSLA(planID string) *SLA {
+	for _, p := range SubscriptionPlans() {
+		if p.ID == planID {
+			return p.SLA
+		}
+	}
+	return nil
+}
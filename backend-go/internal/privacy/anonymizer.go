@@ -0,0 +1,166 @@
+package privacy
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// hashedPrefix marks values that have already been replaced by a keyed hash
+const hashedPrefix = "h:"
+
+// versionPattern matches dotted version numbers such as 118.0.5993.88 or 10_15_7
+var versionPattern = regexp.MustCompile(`(\d+)(?:[._]\d+)+`)
+
+// Anonymizer reduces IP addresses and user agents according to an
+// AnonymizationPolicy. Truncation keeps the network prefix (/24 for IPv4, /48
+// for IPv6) and the major browser/OS versions so security analytics can still
+// group traffic by network and client family. Hashing uses a keyed HMAC so the
+// same client maps to the same pseudonym without being reversible.
+type Anonymizer struct {
+	key      []byte
+	defaults models.AnonymizationPolicy
+	policies PolicyStore
+}
+
+// PolicyStore provides stored per-organization policies
+type PolicyStore interface {
+	GetByOrgID(ctx context.Context, orgID int64) (*models.AnonymizationPolicy, error)
+	List(ctx context.Context) ([]models.AnonymizationPolicy, error)
+}
+
+// AuditLogStore provides access to persisted audit records awaiting anonymization
+type AuditLogStore interface {
+	ListPendingAnonymization(ctx context.Context, orgID *int64, before time.Time, limit int) ([]models.AuditLog, error)
+	MarkAnonymized(ctx context.Context, id int64, ipAddress, userAgent string) error
+}
+
+// NewAnonymizer creates an anonymizer keyed with the deployment salt. The
+// defaults apply to records without an organization and to organizations
+// without a stored policy. policies may be nil.
+func NewAnonymizer(salt string, defaults models.AnonymizationPolicy, policies PolicyStore) *Anonymizer {
+	return &Anonymizer{key: []byte(salt), defaults: defaults, policies: policies}
+}
+
+// PolicyFor resolves the policy for an organization, falling back to the defaults
+func (a *Anonymizer) PolicyFor(ctx context.Context, orgID int64) models.AnonymizationPolicy {
+	if orgID == 0 || a.policies == nil {
+		return a.defaults
+	}
+	p, err := a.policies.GetByOrgID(ctx, orgID)
+	if err != nil || p == nil {
+		d := a.defaults
+		d.OrgID = orgID
+		return d
+	}
+	return *p
+}
+
+// Immediate reports whether records must be anonymized at write time
+func Immediate(p models.AnonymizationPolicy) bool {
+	return p.EUTenant || p.AnonymizeAfterDays <= 0
+}
+
+// Due reports whether a record written at recordedAt must be anonymized by now
+func Due(p models.AnonymizationPolicy, recordedAt, now time.Time) bool {
+	if Immediate(p) {
+		return true
+	}
+	return !recordedAt.After(now.Add(-time.Duration(p.AnonymizeAfterDays) * 24 * time.Hour))
+}
+
+// Apply anonymizes an IP address and user agent pair according to the policy
+func (a *Anonymizer) Apply(p models.AnonymizationPolicy, ip, userAgent string) (string, string) {
+	return a.AnonymizeIP(ip, p.IPMode), a.AnonymizeUserAgent(userAgent, p.UserAgentMode)
+}
+
+// AnonymizeIP truncates or hashes an IP address. Values that are not valid IPs
+// are hashed in either mode so nothing identifying is left behind.
+func (a *Anonymizer) AnonymizeIP(ip string, mode models.AnonymizationMode) string {
+	ip = strings.TrimSpace(ip)
+	if ip == "" || mode == models.AnonymizeNone || mode == "" || strings.HasPrefix(ip, hashedPrefix) {
+		return ip
+	}
+
+	parsed := net.ParseIP(ip)
+	if mode == models.AnonymizeTruncate && parsed != nil {
+		if v4 := parsed.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return parsed.Mask(net.CIDRMask(48, 128)).String()
+	}
+	return a.hash(ip)
+}
+
+// AnonymizeUserAgent truncates a user agent to its product tokens with major
+// versions only, or replaces it with a keyed hash
+func (a *Anonymizer) AnonymizeUserAgent(userAgent string, mode models.AnonymizationMode) string {
+	if userAgent == "" || mode == models.AnonymizeNone || mode == "" || strings.HasPrefix(userAgent, hashedPrefix) {
+		return userAgent
+	}
+	if mode == models.AnonymizeTruncate {
+		return versionPattern.ReplaceAllString(userAgent, "$1")
+	}
+	return a.hash(userAgent)
+}
+
+func (a *Anonymizer) hash(value string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(value))
+	// 64 bits keeps collisions negligible for correlation while staying compact
+	return hashedPrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// SweepAuditLogs anonymizes persisted audit records whose retention window has
+// elapsed under their organization's policy. It returns the number of records updated.
+func (a *Anonymizer) SweepAuditLogs(ctx context.Context, logs AuditLogStore, now time.Time) (int, error) {
+	const batchSize = 500
+
+	scopes := []models.AnonymizationPolicy{a.defaults}
+	if a.policies != nil {
+		stored, err := a.policies.List(ctx)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list anonymization policies: %w", err)
+		}
+		scopes = append(scopes, stored...)
+	}
+
+	total := 0
+	for _, p := range scopes {
+		var orgID *int64
+		if p.OrgID != 0 {
+			id := p.OrgID
+			orgID = &id
+		}
+		cutoff := now
+		if !Immediate(p) {
+			cutoff = now.Add(-time.Duration(p.AnonymizeAfterDays) * 24 * time.Hour)
+		}
+
+		for {
+			pending, err := logs.ListPendingAnonymization(ctx, orgID, cutoff, batchSize)
+			if err != nil {
+				return total, fmt.Errorf("failed to list audit logs for anonymization: %w", err)
+			}
+			for _, rec := range pending {
+				ip, ua := a.Apply(p, rec.IPAddress, rec.UserAgent)
+				if err := logs.MarkAnonymized(ctx, rec.ID, ip, ua); err != nil {
+					return total, fmt.Errorf("failed to anonymize audit log %d: %w", rec.ID, err)
+				}
+				total++
+			}
+			if len(pending) < batchSize {
+				break
+			}
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,58 @@
+// Package privacy_test provides unit tests for client identifier anonymization
+package privacy_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymizer_AnonymizeIP(t *testing.T) {
+	a := privacy.NewAnonymizer("test-salt", models.AnonymizationPolicy{}, nil)
+
+	t.Run("truncate ipv4 keeps /24", func(t *testing.T) {
+		assert.Equal(t, "203.0.113.0", a.AnonymizeIP("203.0.113.77", models.AnonymizeTruncate))
+	})
+
+	t.Run("truncate ipv6 keeps /48", func(t *testing.T) {
+		assert.Equal(t, "2001:db8:85a3::", a.AnonymizeIP("2001:db8:85a3:8d3:1319:8a2e:370:7348", models.AnonymizeTruncate))
+	})
+
+	t.Run("hash is stable and keyed", func(t *testing.T) {
+		h1 := a.AnonymizeIP("203.0.113.77", models.AnonymizeHash)
+		h2 := a.AnonymizeIP("203.0.113.77", models.AnonymizeHash)
+		other := privacy.NewAnonymizer("other-salt", models.AnonymizationPolicy{}, nil).AnonymizeIP("203.0.113.77", models.AnonymizeHash)
+
+		assert.True(t, strings.HasPrefix(h1, "h:"))
+		assert.Equal(t, h1, h2)
+		assert.NotEqual(t, h1, other)
+		assert.Equal(t, h1, a.AnonymizeIP(h1, models.AnonymizeHash), "already hashed values are left alone")
+	})
+
+	t.Run("none leaves value untouched", func(t *testing.T) {
+		assert.Equal(t, "203.0.113.77", a.AnonymizeIP("203.0.113.77", models.AnonymizeNone))
+	})
+}
+
+func TestAnonymizer_AnonymizeUserAgent(t *testing.T) {
+	a := privacy.NewAnonymizer("test-salt", models.AnonymizationPolicy{}, nil)
+
+	ua := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) Chrome/118.0.5993.88 Safari/537.36"
+	assert.Equal(t, "Mozilla/5 (Macintosh; Intel Mac OS X 10) Chrome/118 Safari/537", a.AnonymizeUserAgent(ua, models.AnonymizeTruncate))
+	assert.True(t, strings.HasPrefix(a.AnonymizeUserAgent(ua, models.AnonymizeHash), "h:"))
+}
+
+func TestDue(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	p := models.AnonymizationPolicy{AnonymizeAfterDays: 30}
+
+	assert.False(t, privacy.Due(p, now.Add(-29*24*time.Hour), now))
+	assert.True(t, privacy.Due(p, now.Add(-30*24*time.Hour), now))
+
+	p.EUTenant = true
+	assert.True(t, privacy.Due(p, now, now), "EU tenants are anonymized immediately")
+}
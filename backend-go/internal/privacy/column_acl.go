@@ -0,0 +1,239 @@
+package privacy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// MaskedValue replaces restricted values in previews
+const MaskedValue = "***"
+
+// tokenPrefix marks values replaced by a column token
+const tokenPrefix = "tok_"
+
+// ErrRestrictedColumnReference is returned when a prompt names a column the
+// requester is not cleared to see
+var ErrRestrictedColumnReference = errors.New("prompt references a restricted column")
+
+// ColumnACL applies column-level restrictions for one viewer of one dataset.
+// A nil *ColumnACL grants full access, which is what owners get.
+type ColumnACL struct {
+	datasetID int64
+	hidden    map[string]models.ColumnExportAction
+	key       []byte
+}
+
+// NewColumnACL builds the ACL for a viewer from the dataset's restrictions and
+// the columns the viewer is cleared for. Without a tokenization key, columns
+// configured for tokenization are excluded instead.
+func NewColumnACL(datasetID int64, restrictions []models.ColumnRestriction, cleared []string, tokenKey []byte) *ColumnACL {
+	ok := make(map[string]bool, len(cleared))
+	for _, c := range cleared {
+		ok[strings.ToLower(c)] = true
+	}
+	hidden := make(map[string]models.ColumnExportAction)
+	for _, r := range restrictions {
+		if ok[strings.ToLower(r.ColumnName)] {
+			continue
+		}
+		action := r.ExportAction
+		if action != models.ColumnExportTokenize || len(tokenKey) == 0 {
+			action = models.ColumnExportExclude
+		}
+		hidden[strings.ToLower(r.ColumnName)] = action
+	}
+	return &ColumnACL{datasetID: datasetID, hidden: hidden, key: tokenKey}
+}
+
+// Restricted reports whether any column is hidden from the viewer
+func (a *ColumnACL) Restricted() bool {
+	return a != nil && len(a.hidden) > 0
+}
+
+// Hidden returns the hidden column names in sorted order
+func (a *ColumnACL) Hidden() []string {
+	if a == nil {
+		return nil
+	}
+	out := make([]string, 0, len(a.hidden))
+	for c := range a.hidden {
+		out = append(out, c)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (a *ColumnACL) action(column string) (models.ColumnExportAction, bool) {
+	if a == nil {
+		return "", false
+	}
+	act, ok := a.hidden[strings.ToLower(column)]
+	return act, ok
+}
+
+// MaskRows replaces hidden values with MaskedValue for previews; columns stay
+// in place so the viewer can see the shape of the data
+func (a *ColumnACL) MaskRows(rows []map[string]interface{}) []map[string]interface{} {
+	if !a.Restricted() {
+		return rows
+	}
+	out := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		masked := make(map[string]interface{}, len(row))
+		for k, v := range row {
+			if _, hidden := a.action(k); hidden {
+				masked[k] = MaskedValue
+				continue
+			}
+			masked[k] = v
+		}
+		out[i] = masked
+	}
+	return out
+}
+
+// Token returns the stable export token for a value of a hidden column.
+// Tokens are scoped to the dataset and column so they cannot be joined
+// across datasets.
+func (a *ColumnACL) Token(column string, value interface{}) string {
+	m := hmac.New(sha256.New, a.key)
+	fmt.Fprintf(m, "%d\x00%s\x00%v", a.datasetID, strings.ToLower(column), value)
+	return tokenPrefix + hex.EncodeToString(m.Sum(nil))[:20]
+}
+
+// ExportColumns returns the columns that remain in an export
+func (a *ColumnACL) ExportColumns(columns []string) []string {
+	out := make([]string, 0, len(columns))
+	for _, c := range columns {
+		if act, hidden := a.action(c); hidden && act == models.ColumnExportExclude {
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// ExportRow applies export actions to a single row
+func (a *ColumnACL) ExportRow(row map[string]interface{}) map[string]interface{} {
+	if !a.Restricted() {
+		return row
+	}
+	out := make(map[string]interface{}, len(row))
+	for k, v := range row {
+		act, hidden := a.action(k)
+		switch {
+		case !hidden:
+			out[k] = v
+		case act == models.ColumnExportTokenize && v != nil:
+			out[k] = a.Token(k, v)
+		case act == models.ColumnExportTokenize:
+			out[k] = nil
+		}
+	}
+	return out
+}
+
+// ExportCSV copies a CSV file, excluding or tokenizing hidden columns
+func (a *ColumnACL) ExportCSV(r io.Reader, w io.Writer) error {
+	in := csv.NewReader(r)
+	in.ReuseRecord = true
+	header, err := in.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	header = append([]string(nil), header...)
+
+	keep := a.ExportColumns(header)
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[h] = i
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(keep); err != nil {
+		return err
+	}
+	record := make([]string, len(keep))
+	for {
+		row, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read CSV row: %w", err)
+		}
+		for i, col := range keep {
+			v := ""
+			if j := index[col]; j < len(row) {
+				v = row[j]
+			}
+			if act, hidden := a.action(col); hidden && act == models.ColumnExportTokenize && v != "" {
+				v = a.Token(col, v)
+			}
+			record[i] = v
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// ExportJSON copies a JSON array of objects, excluding or tokenizing hidden columns
+func (a *ColumnACL) ExportJSON(r io.Reader, w io.Writer) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return fmt.Errorf("expected a JSON array of objects")
+	}
+	enc := json.NewEncoder(w)
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for i := 0; dec.More(); i++ {
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err != nil {
+			return fmt.Errorf("failed to read JSON row: %w", err)
+		}
+		if i > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		if err := enc.Encode(a.ExportRow(row)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// CheckPrompt rejects free text that names a hidden column, so a viewer cannot
+// ask a generation job to reproduce or reveal restricted values
+func (a *ColumnACL) CheckPrompt(texts ...string) error {
+	if !a.Restricted() {
+		return nil
+	}
+	for column := range a.hidden {
+		pattern := regexp.MustCompile(`(?i)(^|[^a-z0-9_])` + regexp.QuoteMeta(column) + `($|[^a-z0-9_])`)
+		for _, t := range texts {
+			if pattern.MatchString(t) {
+				return fmt.Errorf("%w: %s", ErrRestrictedColumnReference, strconv.Quote(column))
+			}
+		}
+	}
+	return nil
+}
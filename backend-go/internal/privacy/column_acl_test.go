@@ -0,0 +1,87 @@
+// Package privacy_test provides unit tests for column-level access control
+package privacy_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRestrictions() []models.ColumnRestriction {
+	return []models.ColumnRestriction{
+		{ColumnName: "ssn", ExportAction: models.ColumnExportExclude},
+		{ColumnName: "email", ExportAction: models.ColumnExportTokenize},
+	}
+}
+
+func TestColumnACL(t *testing.T) {
+	key := []byte("column-token-key")
+
+	t.Run("nil acl grants full access", func(t *testing.T) {
+		var acl *privacy.ColumnACL
+		rows := []map[string]interface{}{{"ssn": "123"}}
+		assert.False(t, acl.Restricted())
+		assert.Equal(t, rows, acl.MaskRows(rows))
+		assert.NoError(t, acl.CheckPrompt("copy the ssn column"))
+	})
+
+	t.Run("cleared columns are not hidden", func(t *testing.T) {
+		acl := privacy.NewColumnACL(1, testRestrictions(), []string{"SSN"}, key)
+		assert.Equal(t, []string{"email"}, acl.Hidden())
+	})
+
+	t.Run("previews mask hidden values", func(t *testing.T) {
+		acl := privacy.NewColumnACL(1, testRestrictions(), nil, key)
+		out := acl.MaskRows([]map[string]interface{}{{"ssn": "123", "email": "a@b.c", "age": 40}})
+		assert.Equal(t, privacy.MaskedValue, out[0]["ssn"])
+		assert.Equal(t, privacy.MaskedValue, out[0]["email"])
+		assert.Equal(t, 40, out[0]["age"])
+	})
+
+	t.Run("csv export excludes and tokenizes", func(t *testing.T) {
+		acl := privacy.NewColumnACL(1, testRestrictions(), nil, key)
+		var out bytes.Buffer
+		require.NoError(t, acl.ExportCSV(strings.NewReader("ssn,email,age\n123,a@b.c,40\n456,a@b.c,41\n"), &out))
+
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		require.Len(t, lines, 3)
+		assert.Equal(t, "email,age", lines[0])
+		assert.NotContains(t, out.String(), "123")
+		assert.NotContains(t, out.String(), "a@b.c")
+
+		first := strings.Split(lines[1], ",")
+		second := strings.Split(lines[2], ",")
+		assert.True(t, strings.HasPrefix(first[0], "tok_"))
+		assert.Equal(t, first[0], second[0], "tokens are stable so joins still work")
+	})
+
+	t.Run("json export excludes and tokenizes", func(t *testing.T) {
+		acl := privacy.NewColumnACL(1, testRestrictions(), nil, key)
+		var out bytes.Buffer
+		require.NoError(t, acl.ExportJSON(strings.NewReader(`[{"ssn":"123","email":"a@b.c","age":40}]`), &out))
+
+		var rows []map[string]interface{}
+		require.NoError(t, json.Unmarshal(out.Bytes(), &rows))
+		require.Len(t, rows, 1)
+		assert.NotContains(t, rows[0], "ssn")
+		assert.Equal(t, acl.Token("email", "a@b.c"), rows[0]["email"])
+		assert.EqualValues(t, 40, rows[0]["age"])
+	})
+
+	t.Run("tokenize falls back to exclude without a key", func(t *testing.T) {
+		acl := privacy.NewColumnACL(1, testRestrictions(), nil, nil)
+		assert.Equal(t, []string{"age"}, acl.ExportColumns([]string{"ssn", "email", "age"}))
+	})
+
+	t.Run("prompts cannot reference hidden columns", func(t *testing.T) {
+		acl := privacy.NewColumnACL(1, testRestrictions(), nil, key)
+		assert.ErrorIs(t, acl.CheckPrompt("keep the real SSN values"), privacy.ErrRestrictedColumnReference)
+		assert.NoError(t, acl.CheckPrompt("generate realistic ages", "emails_sent should be positive"))
+	})
+}
@@ -0,0 +1,331 @@
+package privacy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+var (
+	ErrUnknownPrivacyCategory  = errors.New("unknown privacy category")
+	ErrUnknownPrivacyMechanism = errors.New("unknown privacy mechanism")
+	ErrInvalidPrivacyParameter = errors.New("invalid privacy parameter")
+	// ErrPrivacyBudgetExceeded is returned when the column budgets of a job
+	// add up to more than its privacy level allows
+	ErrPrivacyBudgetExceeded = errors.New("column privacy budgets exceed the privacy level")
+)
+
+// Category defaults for columns configured without an epsilon, the same
+// budgets the engine gives sensitive columns it detects itself
+var categoryEpsilon = map[models.PrivacyCategory]float64{
+	models.PrivacyCategoryPII:       0.1,
+	models.PrivacyCategoryFinancial: 0.2,
+	models.PrivacyCategoryHealth:    0.05,
+}
+
+const (
+	defaultDelta       = 1e-6
+	defaultSensitivity = 1.0
+	// maxResponseDomain caps the distinct values randomized response draws
+	// replacements from
+	maxResponseDomain = 1000
+)
+
+// ColumnPolicy is the protection a job applies to one column: a column's
+// privacy setting with the category defaults filled in
+type ColumnPolicy struct {
+	Column      string                  `json:"column"`
+	Category    models.PrivacyCategory  `json:"category"`
+	Mechanism   models.PrivacyMechanism `json:"mechanism"`
+	Epsilon     float64                 `json:"epsilon,omitempty"`
+	Delta       float64                 `json:"delta,omitempty"`
+	Sensitivity float64                 `json:"sensitivity,omitempty"`
+}
+
+// noisy reports whether a mechanism spends privacy budget
+func noisy(m models.PrivacyMechanism) bool {
+	return m == models.MechanismLaplace || m == models.MechanismGaussian || m == models.MechanismRandomizedResponse
+}
+
+// ValidateColumnPrivacy checks a column setting. Epsilon is only taken by
+// the mechanisms that spend budget, delta only by the Gaussian mechanism
+// and sensitivity only by the two noise mechanisms.
+func ValidateColumnPrivacy(p models.ColumnPrivacy) error {
+	if _, ok := categoryEpsilon[p.Category]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownPrivacyCategory, p.Category)
+	}
+	switch p.Mechanism {
+	case models.MechanismLaplace, models.MechanismGaussian, models.MechanismRandomizedResponse,
+		models.MechanismSuppression, models.MechanismMasking:
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownPrivacyMechanism, p.Mechanism)
+	}
+	switch {
+	case p.Epsilon != nil && !noisy(p.Mechanism):
+		return fmt.Errorf("%w: %s takes no epsilon", ErrInvalidPrivacyParameter, p.Mechanism)
+	case p.Epsilon != nil && (*p.Epsilon <= 0 || math.IsInf(*p.Epsilon, 0) || math.IsNaN(*p.Epsilon)):
+		return fmt.Errorf("%w: epsilon must be positive", ErrInvalidPrivacyParameter)
+	case p.Delta != nil && p.Mechanism != models.MechanismGaussian:
+		return fmt.Errorf("%w: %s takes no delta", ErrInvalidPrivacyParameter, p.Mechanism)
+	case p.Delta != nil && !(*p.Delta > 0 && *p.Delta < 1):
+		return fmt.Errorf("%w: delta must be between 0 and 1", ErrInvalidPrivacyParameter)
+	case p.Sensitivity != nil && p.Mechanism != models.MechanismLaplace && p.Mechanism != models.MechanismGaussian:
+		return fmt.Errorf("%w: %s takes no sensitivity", ErrInvalidPrivacyParameter, p.Mechanism)
+	case p.Sensitivity != nil && (*p.Sensitivity <= 0 || math.IsInf(*p.Sensitivity, 0) || math.IsNaN(*p.Sensitivity)):
+		return fmt.Errorf("%w: sensitivity must be positive", ErrInvalidPrivacyParameter)
+	}
+	return nil
+}
+
+// ColumnPolicies resolves column settings into the policies of a job
+func ColumnPolicies(settings []models.ColumnPrivacy) []ColumnPolicy {
+	if len(settings) == 0 {
+		return nil
+	}
+	out := make([]ColumnPolicy, 0, len(settings))
+	for _, s := range settings {
+		p := ColumnPolicy{Column: s.ColumnName, Category: s.Category, Mechanism: s.Mechanism}
+		if noisy(s.Mechanism) {
+			p.Epsilon = categoryEpsilon[s.Category]
+			if s.Epsilon != nil {
+				p.Epsilon = *s.Epsilon
+			}
+		}
+		if s.Mechanism == models.MechanismGaussian {
+			p.Delta = defaultDelta
+			if s.Delta != nil {
+				p.Delta = *s.Delta
+			}
+		}
+		if s.Mechanism == models.MechanismLaplace || s.Mechanism == models.MechanismGaussian {
+			p.Sensitivity = defaultSensitivity
+			if s.Sensitivity != nil {
+				p.Sensitivity = *s.Sensitivity
+			}
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// PlanColumns spends the column budgets of a job against its privacy
+// level. Every column of a row describes the same record, so the budgets
+// add up; rows are distinct records, so each column spends its epsilon once
+// however many rows are generated. An empty level is medium.
+func (p *PrivacyEngine) PlanColumns(level PrivacyLevel, policies []ColumnPolicy) (*PrivacyBudget, error) {
+	if level == "" {
+		level = PrivacyLevelMedium
+	}
+	limit := p.privacyLevels[level]
+	if limit == nil {
+		return nil, fmt.Errorf("invalid privacy level: %s", level)
+	}
+	budget := &PrivacyBudget{Epsilon: limit.Epsilon, Delta: limit.Delta}
+	for _, pol := range policies {
+		if !noisy(pol.Mechanism) {
+			continue
+		}
+		if !budget.spend(pol.Epsilon, pol.Delta, fmt.Sprintf("%s_%s", pol.Mechanism, pol.Column)) {
+			return nil, fmt.Errorf("%w: %s needs epsilon %g with %g of %g left at %s", ErrPrivacyBudgetExceeded,
+				pol.Column, pol.Epsilon, budget.Epsilon-budget.SpentEpsilon, budget.Epsilon, level)
+		}
+	}
+	return budget, nil
+}
+
+// ColumnProtector applies the configured mechanisms to generated rows. A
+// nil *ColumnProtector leaves rows as they are.
+type ColumnProtector struct {
+	engine   *PrivacyEngine
+	level    PrivacyLevel
+	budget   *PrivacyBudget
+	policies []ColumnPolicy
+	domains  map[string][]interface{}
+	seen     map[string]map[string]struct{}
+	reports  map[string]*models.ColumnPrivacyReport
+}
+
+// NewColumnProtector plans the budgets of policies; nil without policies
+func NewColumnProtector(level PrivacyLevel, policies []ColumnPolicy) (*ColumnProtector, error) {
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	engine := NewPrivacyEngine()
+	budget, err := engine.PlanColumns(level, policies)
+	if err != nil {
+		return nil, err
+	}
+	if level == "" {
+		level = PrivacyLevelMedium
+	}
+	p := &ColumnProtector{
+		engine:   engine,
+		level:    level,
+		budget:   budget,
+		policies: policies,
+		domains:  make(map[string][]interface{}),
+		seen:     make(map[string]map[string]struct{}),
+		reports:  make(map[string]*models.ColumnPrivacyReport),
+	}
+	for _, pol := range policies {
+		p.reports[pol.Column] = &models.ColumnPrivacyReport{
+			Column:    pol.Column,
+			Category:  string(pol.Category),
+			Mechanism: string(pol.Mechanism),
+			Epsilon:   pol.Epsilon,
+			Delta:     pol.Delta,
+		}
+	}
+	return p, nil
+}
+
+// Filter protects the configured columns of rows in place. Noise
+// mechanisms suppress values that are not numbers rather than pass them
+// through unprotected.
+func (p *ColumnProtector) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if p == nil {
+		return rows
+	}
+	for _, row := range rows {
+		for _, pol := range p.policies {
+			v, ok := row[pol.Column]
+			if !ok || v == nil {
+				continue
+			}
+			out, suppressed := p.protect(pol, v)
+			row[pol.Column] = out
+			report := p.reports[pol.Column]
+			report.Protected++
+			if suppressed {
+				report.Suppressed++
+			}
+		}
+	}
+	return rows
+}
+
+func (p *ColumnProtector) protect(pol ColumnPolicy, v interface{}) (interface{}, bool) {
+	switch pol.Mechanism {
+	case models.MechanismSuppression:
+		return nil, true
+	case models.MechanismMasking:
+		return MaskedValue, false
+	case models.MechanismLaplace, models.MechanismGaussian:
+		n, ok := numericValue(v)
+		if !ok {
+			return nil, true
+		}
+		noise := p.engine.laplace(pol.Epsilon, pol.Sensitivity)
+		if pol.Mechanism == models.MechanismGaussian {
+			noise = p.engine.gaussian(pol.Epsilon, pol.Delta, pol.Sensitivity)
+		}
+		// Whole numbers stay whole so counts and ages keep their type
+		if n == math.Trunc(n) {
+			return math.Round(n + noise), false
+		}
+		return n + noise, false
+	case models.MechanismRandomizedResponse:
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, true
+		}
+		domain := p.observe(pol.Column, v)
+		if len(domain) < 2 {
+			return v, false
+		}
+		out, err := p.engine.randomizedResponse(v, pol.Epsilon, domain)
+		if err != nil {
+			return nil, true
+		}
+		return out, false
+	}
+	return nil, true
+}
+
+// observe adds a value to the domain of a column and returns the domain.
+// Replacements are drawn from the values generated so far, so no source
+// value is ever introduced.
+func (p *ColumnProtector) observe(column string, v interface{}) []interface{} {
+	seen := p.seen[column]
+	if seen == nil {
+		seen = make(map[string]struct{})
+		p.seen[column] = seen
+	}
+	key := fmt.Sprint(v)
+	if _, ok := seen[key]; !ok && len(seen) < maxResponseDomain {
+		seen[key] = struct{}{}
+		p.domains[column] = append(p.domains[column], v)
+	}
+	return p.domains[column]
+}
+
+func numericValue(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case float32:
+		return float64(x), true
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case json.Number:
+		n, err := x.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return n, err == nil && !math.IsInf(n, 0) && !math.IsNaN(n)
+	}
+	return 0, false
+}
+
+// Report describes the budget the job spent and what was done to each
+// column; nil for a nil protector
+func (p *ColumnProtector) Report() *models.PrivacyReport {
+	if p == nil {
+		return nil
+	}
+	out := &models.PrivacyReport{
+		Level:        string(p.level),
+		Epsilon:      p.budget.Epsilon,
+		Delta:        p.budget.Delta,
+		SpentEpsilon: p.budget.SpentEpsilon,
+		SpentDelta:   p.budget.SpentDelta,
+	}
+	for _, pol := range p.policies {
+		out.Columns = append(out.Columns, *p.reports[pol.Column])
+	}
+	return out
+}
+
+// SpendingColumns names the columns of policies that spend budget
+func SpendingColumns(policies []ColumnPolicy) []string {
+	out := []string{}
+	for _, pol := range policies {
+		if noisy(pol.Mechanism) {
+			out = append(out, pol.Column)
+		}
+	}
+	return out
+}
+
+// Balance sets what is spent of a lifetime budget against its limits.
+// Nothing remains once a limit is reached, even if a change of limits has
+// left the spend above it.
+func Balance(datasetID, userID int64, epsilon, delta, spentEpsilon, spentDelta float64) models.PrivacyBudgetBalance {
+	return models.PrivacyBudgetBalance{
+		DatasetID:        datasetID,
+		UserID:           userID,
+		Epsilon:          epsilon,
+		Delta:            delta,
+		SpentEpsilon:     spentEpsilon,
+		SpentDelta:       spentDelta,
+		RemainingEpsilon: math.Max(epsilon-spentEpsilon, 0),
+		RemainingDelta:   math.Max(delta-spentDelta, 0),
+	}
+}
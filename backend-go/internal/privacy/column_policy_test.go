@@ -0,0 +1,141 @@
+// Package privacy_test provides unit tests for per-column privacy settings
+package privacy_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setting(column string, category models.PrivacyCategory, mechanism models.PrivacyMechanism, epsilon *float64) models.ColumnPrivacy {
+	return models.ColumnPrivacy{ColumnName: column, Category: category, Mechanism: mechanism, Epsilon: epsilon}
+}
+
+func ptr(v float64) *float64 { return &v }
+
+func TestValidateColumnPrivacy(t *testing.T) {
+	assert.NoError(t, privacy.ValidateColumnPrivacy(setting("ssn", models.PrivacyCategoryPII, models.MechanismMasking, nil)))
+	assert.NoError(t, privacy.ValidateColumnPrivacy(setting("salary", models.PrivacyCategoryFinancial, models.MechanismLaplace, ptr(0.5))))
+
+	assert.ErrorIs(t, privacy.ValidateColumnPrivacy(setting("x", "secret", models.MechanismMasking, nil)), privacy.ErrUnknownPrivacyCategory)
+	assert.ErrorIs(t, privacy.ValidateColumnPrivacy(setting("x", models.PrivacyCategoryPII, "shuffle", nil)), privacy.ErrUnknownPrivacyMechanism)
+	assert.ErrorIs(t, privacy.ValidateColumnPrivacy(setting("x", models.PrivacyCategoryPII, models.MechanismMasking, ptr(1))), privacy.ErrInvalidPrivacyParameter)
+	assert.ErrorIs(t, privacy.ValidateColumnPrivacy(setting("x", models.PrivacyCategoryPII, models.MechanismLaplace, ptr(0))), privacy.ErrInvalidPrivacyParameter)
+
+	delta := setting("x", models.PrivacyCategoryHealth, models.MechanismLaplace, nil)
+	delta.Delta = ptr(1e-6)
+	assert.ErrorIs(t, privacy.ValidateColumnPrivacy(delta), privacy.ErrInvalidPrivacyParameter)
+}
+
+func TestColumnPolicies(t *testing.T) {
+	policies := privacy.ColumnPolicies([]models.ColumnPrivacy{
+		setting("diagnosis", models.PrivacyCategoryHealth, models.MechanismRandomizedResponse, nil),
+		setting("balance", models.PrivacyCategoryFinancial, models.MechanismGaussian, ptr(0.3)),
+		setting("email", models.PrivacyCategoryPII, models.MechanismSuppression, nil),
+	})
+	require.Len(t, policies, 3)
+	assert.Equal(t, 0.05, policies[0].Epsilon, "category default")
+	assert.Equal(t, 0.3, policies[1].Epsilon)
+	assert.Equal(t, 1e-6, policies[1].Delta)
+	assert.Equal(t, 1.0, policies[1].Sensitivity)
+	assert.Zero(t, policies[2].Epsilon, "suppression spends no budget")
+}
+
+func TestPlanColumns(t *testing.T) {
+	engine := privacy.NewPrivacyEngine()
+	policies := []privacy.ColumnPolicy{
+		{Column: "a", Mechanism: models.MechanismLaplace, Epsilon: 0.6},
+		{Column: "b", Mechanism: models.MechanismLaplace, Epsilon: 0.3},
+		{Column: "c", Mechanism: models.MechanismMasking},
+	}
+	budget, err := engine.PlanColumns("", policies)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.9, budget.SpentEpsilon, 1e-9)
+
+	_, err = engine.PlanColumns(privacy.PrivacyLevelHigh, policies)
+	assert.ErrorIs(t, err, privacy.ErrPrivacyBudgetExceeded)
+}
+
+func TestColumnProtector(t *testing.T) {
+	t.Run("nil without policies", func(t *testing.T) {
+		p, err := privacy.NewColumnProtector(privacy.PrivacyLevelMedium, nil)
+		require.NoError(t, err)
+		rows := []map[string]interface{}{{"a": 1.0}}
+		assert.Equal(t, rows, p.Filter(rows))
+		assert.Nil(t, p.Report())
+	})
+
+	t.Run("applies each mechanism", func(t *testing.T) {
+		p, err := privacy.NewColumnProtector(privacy.PrivacyLevelLow, []privacy.ColumnPolicy{
+			{Column: "email", Category: models.PrivacyCategoryPII, Mechanism: models.MechanismSuppression},
+			{Column: "ssn", Category: models.PrivacyCategoryPII, Mechanism: models.MechanismMasking},
+			{Column: "age", Category: models.PrivacyCategoryHealth, Mechanism: models.MechanismLaplace, Epsilon: 5, Sensitivity: 1},
+			{Column: "income", Category: models.PrivacyCategoryFinancial, Mechanism: models.MechanismLaplace, Epsilon: 1, Sensitivity: 1},
+		})
+		require.NoError(t, err)
+		rows := p.Filter([]map[string]interface{}{
+			{"email": "a@example.com", "ssn": "123-45-6789", "age": 40.0, "income": "unknown", "id": 1.0},
+			{"email": nil, "ssn": "987-65-4321", "age": 52.0, "income": 1000.5, "id": 2.0},
+		})
+		assert.Nil(t, rows[0]["email"])
+		assert.Equal(t, privacy.MaskedValue, rows[0]["ssn"])
+		assert.Nil(t, rows[0]["income"], "noise cannot protect text, so it is suppressed")
+		assert.Equal(t, 1.0, rows[0]["id"])
+		age, ok := rows[1]["age"].(float64)
+		require.True(t, ok)
+		assert.Equal(t, float64(int64(age)), age, "whole numbers stay whole")
+
+		report := p.Report()
+		require.NotNil(t, report)
+		assert.Equal(t, "low", report.Level)
+		assert.InDelta(t, 6.0, report.SpentEpsilon, 1e-9)
+		require.Len(t, report.Columns, 4)
+		assert.Equal(t, int64(1), report.Columns[0].Protected, "nulls are left alone")
+		assert.Equal(t, int64(1), report.Columns[0].Suppressed)
+		assert.Equal(t, int64(2), report.Columns[3].Protected)
+		assert.Equal(t, int64(1), report.Columns[3].Suppressed)
+	})
+
+	t.Run("randomized response keeps generated values", func(t *testing.T) {
+		p, err := privacy.NewColumnProtector(privacy.PrivacyLevelLow, []privacy.ColumnPolicy{
+			{Column: "smoker", Category: models.PrivacyCategoryHealth, Mechanism: models.MechanismRandomizedResponse, Epsilon: 0.5},
+		})
+		require.NoError(t, err)
+		var rows []map[string]interface{}
+		for i := 0; i < 50; i++ {
+			rows = append(rows, map[string]interface{}{"smoker": []string{"yes", "no"}[i%2]})
+		}
+		for _, row := range p.Filter(rows) {
+			assert.Contains(t, []interface{}{"yes", "no"}, row["smoker"])
+		}
+	})
+
+	t.Run("budgets over the level are refused", func(t *testing.T) {
+		_, err := privacy.NewColumnProtector(privacy.PrivacyLevelMaximum, []privacy.ColumnPolicy{
+			{Column: "a", Mechanism: models.MechanismLaplace, Epsilon: 0.1},
+		})
+		assert.ErrorIs(t, err, privacy.ErrPrivacyBudgetExceeded)
+	})
+}
+
+func TestSpendingColumns(t *testing.T) {
+	cols := privacy.SpendingColumns([]privacy.ColumnPolicy{
+		{Column: "a", Mechanism: models.MechanismLaplace, Epsilon: 0.1},
+		{Column: "b", Mechanism: models.MechanismMasking},
+		{Column: "c", Mechanism: models.MechanismRandomizedResponse, Epsilon: 0.2},
+	})
+	assert.Equal(t, []string{"a", "c"}, cols)
+}
+
+func TestBalance(t *testing.T) {
+	b := privacy.Balance(7, 3, 10, 1e-3, 4, 2e-4)
+	assert.Equal(t, int64(7), b.DatasetID)
+	assert.InDelta(t, 6.0, b.RemainingEpsilon, 1e-9)
+	assert.InDelta(t, 8e-4, b.RemainingDelta, 1e-12)
+
+	over := privacy.Balance(7, 3, 2, 1e-3, 4, 0)
+	assert.Zero(t, over.RemainingEpsilon, "a lowered limit leaves nothing rather than a negative balance")
+}
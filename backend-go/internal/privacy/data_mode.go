@@ -0,0 +1,63 @@
+package privacy
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// ErrRealDataForbidden is returned when source rows would reach a provider
+// for a zero-real-data job
+var ErrRealDataForbidden = errors.New("source rows may not be sent to a provider in zero-real-data mode")
+
+// ResolveDataMode decides a job's data mode. An organization policy or a
+// dataset setting enforces zero-real-data mode; a request may opt into it
+// but never out of it. The source names the strongest reason that applied.
+func ResolveDataMode(orgPolicy, datasetFlag, requested bool) (models.DataMode, models.DataModeSource) {
+	switch {
+	case orgPolicy:
+		return models.DataModeZeroRealData, models.DataModeSourceOrg
+	case datasetFlag:
+		return models.DataModeZeroRealData, models.DataModeSourceDataset
+	case requested:
+		return models.DataModeZeroRealData, models.DataModeSourceRequest
+	}
+	return models.DataModeStandard, models.DataModeSourceDefault
+}
+
+// sourceValueStatistics are profile statistics that carry literal values
+// from the source data rather than aggregates
+var sourceValueStatistics = []string{"sample", "example", "top_value", "unique_value", "distinct_value", "mode", "value_counts"}
+
+// StripSourceValues returns a copy of a column's profiled statistics without
+// entries that quote source values, leaving numeric aggregates such as
+// mean, stddev, percentiles and null ratios
+func StripSourceValues(stats map[string]interface{}) map[string]interface{} {
+	if stats == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(stats))
+	for k, v := range stats {
+		if quotesSourceValues(k, v) {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func quotesSourceValues(key string, v interface{}) bool {
+	k := strings.ToLower(key)
+	for _, s := range sourceValueStatistics {
+		if strings.HasPrefix(k, s) {
+			return true
+		}
+	}
+	// Anything that is not a plain number could be a copied value
+	switch v.(type) {
+	case nil, bool, int, int32, int64, float32, float64:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+// Package privacy_test provides unit tests for zero-real-data mode
+package privacy_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveDataMode(t *testing.T) {
+	t.Run("standard unless something enforces or requests it", func(t *testing.T) {
+		mode, source := privacy.ResolveDataMode(false, false, false)
+		assert.Equal(t, models.DataModeStandard, mode)
+		assert.Equal(t, models.DataModeSourceDefault, source)
+	})
+
+	t.Run("org policy outranks dataset and request", func(t *testing.T) {
+		mode, source := privacy.ResolveDataMode(true, true, true)
+		assert.Equal(t, models.DataModeZeroRealData, mode)
+		assert.Equal(t, models.DataModeSourceOrg, source)
+	})
+
+	t.Run("dataset setting outranks request", func(t *testing.T) {
+		_, source := privacy.ResolveDataMode(false, true, true)
+		assert.Equal(t, models.DataModeSourceDataset, source)
+		_, source = privacy.ResolveDataMode(false, false, true)
+		assert.Equal(t, models.DataModeSourceRequest, source)
+	})
+}
+
+func TestStripSourceValues(t *testing.T) {
+	stats := map[string]interface{}{
+		"mean":          12.5,
+		"stddev":        3.1,
+		"null_ratio":    0.02,
+		"min":           1,
+		"sample_values": []interface{}{"alice", "bob"},
+		"top_values":    map[string]interface{}{"eu": 10},
+		"mode":          4.0,
+		"max":           "zz-last",
+	}
+	out := privacy.StripSourceValues(stats)
+	assert.Equal(t, map[string]interface{}{"mean": 12.5, "stddev": 3.1, "null_ratio": 0.02, "min": 1}, out)
+	assert.Len(t, stats, 8, "input is left untouched")
+	assert.Nil(t, privacy.StripSourceValues(nil))
+}
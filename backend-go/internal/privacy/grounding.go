@@ -0,0 +1,342 @@
+package privacy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GroundingStrategy selects which real rows are shown to a provider as
+// examples when grounding a generation prompt
+type GroundingStrategy string
+
+const (
+	GroundingRandom           GroundingStrategy = "random"
+	GroundingStratified       GroundingStrategy = "stratified"
+	GroundingOutlierInclusive GroundingStrategy = "outlier_inclusive"
+)
+
+// MaxGroundingRows is the ceiling on real rows sent to a provider for one
+// job. Configuration can lower it but never raise it.
+const MaxGroundingRows = 50
+
+// outlierZScore is how far from the mean a numeric value must be for its row
+// to count as an outlier
+const outlierZScore = 2.0
+
+var (
+	ErrUnknownGroundingStrategy = errors.New("unknown grounding strategy")
+	ErrStratifyColumnRequired   = errors.New("stratified sampling requires a visible stratify_by column")
+)
+
+// sensitiveColumnName matches column names that usually hold personal or
+// secret data; these are masked in grounding samples whatever the viewer's
+// clearance
+var sensitiveColumnName = regexp.MustCompile(`(?i)(e-?mail|phone|mobile|ssn|social_?security|passport|national_?id|tax_?id|` +
+	`first_?name|last_?name|full_?name|surname|^name$|address|street|zip|postal|birth|dob|` +
+	`credit_?card|card_?number|cvv|iban|account_?number|routing|ip_?addr|password|secret|token|licen[cs]e)`)
+
+// GroundingOptions is a caller's request for example rows
+type GroundingOptions struct {
+	Strategy   GroundingStrategy `json:"strategy"`
+	Rows       int               `json:"rows"`
+	StratifyBy string            `json:"stratify_by,omitempty"`
+}
+
+// GroundingSample is exactly what was shared with a provider: the masked rows,
+// which source rows they came from and a digest of the shared payload
+type GroundingSample struct {
+	Strategy      GroundingStrategy        `json:"strategy"`
+	StratifyBy    string                   `json:"stratify_by,omitempty"`
+	Seed          int64                    `json:"seed"`
+	SourceRows    []int64                  `json:"source_rows"`
+	MaskedColumns []string                 `json:"masked_columns"`
+	Rows          []map[string]interface{} `json:"rows"`
+	Digest        string                   `json:"digest"`
+}
+
+// SensitiveColumns returns the columns whose names suggest personal or
+// secret data
+func SensitiveColumns(columns []string) []string {
+	var out []string
+	for _, c := range columns {
+		if sensitiveColumnName.MatchString(c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// SampleForGrounding picks example rows from pool, the first rows scanned
+// from a dataset, and masks every column that is hidden by acl, matches a
+// sensitive name or appears in extraMasked. At most min(opts.Rows, limit,
+// MaxGroundingRows) rows are returned. seed makes the choice reproducible.
+func SampleForGrounding(pool []map[string]interface{}, columns []string, opts GroundingOptions, limit int, acl *ColumnACL, extraMasked []string, seed int64) (*GroundingSample, error) {
+	masked := maskedColumnSet(columns, acl, extraMasked)
+
+	n := opts.Rows
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	if n > MaxGroundingRows {
+		n = MaxGroundingRows
+	}
+	if n > len(pool) {
+		n = len(pool)
+	}
+	if n < 0 {
+		n = 0
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	var picked []int
+	switch opts.Strategy {
+	case GroundingRandom, "":
+		opts.Strategy = GroundingRandom
+		picked = rng.Perm(len(pool))[:n]
+	case GroundingStratified:
+		if opts.StratifyBy == "" || masked[strings.ToLower(opts.StratifyBy)] || !hasColumn(columns, opts.StratifyBy) {
+			return nil, ErrStratifyColumnRequired
+		}
+		picked = stratifiedSample(pool, opts.StratifyBy, n, rng)
+	case GroundingOutlierInclusive:
+		picked = outlierInclusiveSample(pool, columns, masked, n, rng)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownGroundingStrategy, opts.Strategy)
+	}
+	sort.Ints(picked)
+
+	sample := &GroundingSample{
+		Strategy:      opts.Strategy,
+		Seed:          seed,
+		SourceRows:    make([]int64, len(picked)),
+		MaskedColumns: make([]string, 0, len(masked)),
+		Rows:          make([]map[string]interface{}, len(picked)),
+	}
+	if opts.Strategy == GroundingStratified {
+		sample.StratifyBy = opts.StratifyBy
+	}
+	for c := range masked {
+		sample.MaskedColumns = append(sample.MaskedColumns, c)
+	}
+	sort.Strings(sample.MaskedColumns)
+	for i, idx := range picked {
+		sample.SourceRows[i] = int64(idx)
+		row := make(map[string]interface{}, len(pool[idx]))
+		for k, v := range pool[idx] {
+			if masked[strings.ToLower(k)] {
+				row[k] = MaskedValue
+				continue
+			}
+			row[k] = v
+		}
+		sample.Rows[i] = row
+	}
+
+	payload, err := json.Marshal(sample.Rows)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(payload)
+	sample.Digest = hex.EncodeToString(sum[:])
+	return sample, nil
+}
+
+func maskedColumnSet(columns []string, acl *ColumnACL, extra []string) map[string]bool {
+	masked := make(map[string]bool)
+	for _, c := range acl.Hidden() {
+		masked[strings.ToLower(c)] = true
+	}
+	for _, c := range SensitiveColumns(columns) {
+		masked[strings.ToLower(c)] = true
+	}
+	for _, c := range extra {
+		masked[strings.ToLower(c)] = true
+	}
+	return masked
+}
+
+func hasColumn(columns []string, name string) bool {
+	for _, c := range columns {
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// stratifiedSample allocates n rows across the values of column in
+// proportion to their frequency, giving every stratum at least one row when
+// n allows
+func stratifiedSample(pool []map[string]interface{}, column string, n int, rng *rand.Rand) []int {
+	strata := make(map[string][]int)
+	var keys []string
+	for i, row := range pool {
+		k := fmt.Sprint(lookup(row, column))
+		if _, ok := strata[k]; !ok {
+			keys = append(keys, k)
+		}
+		strata[k] = append(strata[k], i)
+	}
+	if n == 0 || len(keys) == 0 {
+		return nil
+	}
+	// Largest strata first; ties broken by value for determinism
+	sort.Slice(keys, func(i, j int) bool {
+		if len(strata[keys[i]]) != len(strata[keys[j]]) {
+			return len(strata[keys[i]]) > len(strata[keys[j]])
+		}
+		return keys[i] < keys[j]
+	})
+
+	quota := make(map[string]int, len(keys))
+	assigned := 0
+	if n >= len(keys) {
+		for _, k := range keys {
+			quota[k] = 1
+		}
+		assigned = len(keys)
+	}
+	// Hand out the remainder proportionally, largest strata first
+	for assigned < n {
+		progressed := false
+		for _, k := range keys {
+			if assigned == n {
+				break
+			}
+			want := int(math.Ceil(float64(n) * float64(len(strata[k])) / float64(len(pool))))
+			if quota[k] < want && quota[k] < len(strata[k]) {
+				quota[k]++
+				assigned++
+				progressed = true
+			}
+		}
+		if !progressed {
+			for _, k := range keys {
+				if assigned < n && quota[k] < len(strata[k]) {
+					quota[k]++
+					assigned++
+				}
+			}
+		}
+	}
+
+	var picked []int
+	for _, k := range keys {
+		members := strata[k]
+		for _, j := range rng.Perm(len(members))[:quota[k]] {
+			picked = append(picked, members[j])
+		}
+	}
+	return picked
+}
+
+// outlierInclusiveSample fills up to a quarter of the sample with the rows
+// whose visible numeric values are furthest from the column mean and the
+// rest at random, so examples show the tails as well as the bulk
+func outlierInclusiveSample(pool []map[string]interface{}, columns []string, masked map[string]bool, n int, rng *rand.Rand) []int {
+	if n == 0 {
+		return nil
+	}
+	scores := make([]float64, len(pool))
+	for _, col := range columns {
+		if masked[strings.ToLower(col)] {
+			continue
+		}
+		values := make([]float64, len(pool))
+		present := make([]bool, len(pool))
+		var sum, count float64
+		for i, row := range pool {
+			if v, ok := numeric(lookup(row, col)); ok {
+				values[i], present[i] = v, true
+				sum += v
+				count++
+			}
+		}
+		if count < 2 {
+			continue
+		}
+		mean := sum / count
+		var variance float64
+		for i := range pool {
+			if present[i] {
+				variance += (values[i] - mean) * (values[i] - mean)
+			}
+		}
+		std := math.Sqrt(variance / count)
+		if std == 0 {
+			continue
+		}
+		for i := range pool {
+			if present[i] {
+				if z := math.Abs(values[i]-mean) / std; z > scores[i] {
+					scores[i] = z
+				}
+			}
+		}
+	}
+
+	order := make([]int, len(pool))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+
+	maxOutliers := (n + 3) / 4
+	taken := make(map[int]bool, n)
+	var picked []int
+	for _, i := range order {
+		if len(picked) == maxOutliers || scores[i] < outlierZScore {
+			break
+		}
+		picked = append(picked, i)
+		taken[i] = true
+	}
+	for _, i := range rng.Perm(len(pool)) {
+		if len(picked) == n {
+			break
+		}
+		if !taken[i] {
+			picked = append(picked, i)
+		}
+	}
+	return picked
+}
+
+func lookup(row map[string]interface{}, column string) interface{} {
+	if v, ok := row[column]; ok {
+		return v
+	}
+	for k, v := range row {
+		if strings.EqualFold(k, column) {
+			return v
+		}
+	}
+	return nil
+}
+
+func numeric(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case json.Number:
+		f, err := t.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
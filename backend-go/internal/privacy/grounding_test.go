@@ -0,0 +1,100 @@
+// Package privacy_test provides unit tests for grounding sample selection
+package privacy_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func groundingPool(n int) ([]string, []map[string]interface{}) {
+	columns := []string{"id", "email", "region", "amount", "notes"}
+	rows := make([]map[string]interface{}, n)
+	for i := range rows {
+		region := "eu"
+		if i%4 == 0 {
+			region = "us"
+		}
+		rows[i] = map[string]interface{}{
+			"id":     fmt.Sprint(i),
+			"email":  fmt.Sprintf("user%d@example.com", i),
+			"region": region,
+			"amount": fmt.Sprint(100 + i%5),
+			"notes":  "ok",
+		}
+	}
+	return columns, rows
+}
+
+func TestSampleForGrounding(t *testing.T) {
+	columns, pool := groundingPool(200)
+
+	t.Run("caps rows and masks sensitive and restricted columns", func(t *testing.T) {
+		acl := privacy.NewColumnACL(1, []models.ColumnRestriction{{ColumnName: "notes", ExportAction: models.ColumnExportExclude}}, nil, nil)
+		s, err := privacy.SampleForGrounding(pool, columns, privacy.GroundingOptions{Strategy: privacy.GroundingRandom, Rows: 500}, 20, acl, []string{"id"}, 1)
+		require.NoError(t, err)
+		assert.Len(t, s.Rows, 20)
+		assert.Len(t, s.SourceRows, 20)
+		assert.Equal(t, []string{"email", "id", "notes"}, s.MaskedColumns)
+		for _, row := range s.Rows {
+			assert.Equal(t, privacy.MaskedValue, row["email"])
+			assert.Equal(t, privacy.MaskedValue, row["notes"])
+			assert.Equal(t, privacy.MaskedValue, row["id"])
+			assert.NotEqual(t, privacy.MaskedValue, row["region"])
+		}
+		assert.Len(t, s.Digest, 64)
+	})
+
+	t.Run("hard cap applies without a configured limit", func(t *testing.T) {
+		s, err := privacy.SampleForGrounding(pool, columns, privacy.GroundingOptions{Rows: 1000}, 0, nil, nil, 1)
+		require.NoError(t, err)
+		assert.Len(t, s.Rows, privacy.MaxGroundingRows)
+	})
+
+	t.Run("same seed gives the same sample", func(t *testing.T) {
+		opts := privacy.GroundingOptions{Strategy: privacy.GroundingRandom, Rows: 10}
+		a, err := privacy.SampleForGrounding(pool, columns, opts, 0, nil, nil, 42)
+		require.NoError(t, err)
+		b, err := privacy.SampleForGrounding(pool, columns, opts, 0, nil, nil, 42)
+		require.NoError(t, err)
+		assert.Equal(t, a.SourceRows, b.SourceRows)
+		assert.Equal(t, a.Digest, b.Digest)
+	})
+
+	t.Run("stratified covers every stratum", func(t *testing.T) {
+		s, err := privacy.SampleForGrounding(pool, columns, privacy.GroundingOptions{Strategy: privacy.GroundingStratified, Rows: 8, StratifyBy: "region"}, 0, nil, nil, 7)
+		require.NoError(t, err)
+		counts := map[interface{}]int{}
+		for _, row := range s.Rows {
+			counts[row["region"]]++
+		}
+		assert.Equal(t, 6, counts["eu"])
+		assert.Equal(t, 2, counts["us"])
+		assert.Equal(t, "region", s.StratifyBy)
+	})
+
+	t.Run("stratified rejects masked or missing columns", func(t *testing.T) {
+		_, err := privacy.SampleForGrounding(pool, columns, privacy.GroundingOptions{Strategy: privacy.GroundingStratified, Rows: 5, StratifyBy: "email"}, 0, nil, nil, 1)
+		assert.ErrorIs(t, err, privacy.ErrStratifyColumnRequired)
+		_, err = privacy.SampleForGrounding(pool, columns, privacy.GroundingOptions{Strategy: privacy.GroundingStratified, Rows: 5}, 0, nil, nil, 1)
+		assert.ErrorIs(t, err, privacy.ErrStratifyColumnRequired)
+	})
+
+	t.Run("outlier inclusive includes extreme rows", func(t *testing.T) {
+		withOutlier := append([]map[string]interface{}{}, pool...)
+		withOutlier[137] = map[string]interface{}{"id": "137", "email": "x", "region": "eu", "amount": "99999", "notes": "ok"}
+		s, err := privacy.SampleForGrounding(withOutlier, columns, privacy.GroundingOptions{Strategy: privacy.GroundingOutlierInclusive, Rows: 8}, 0, nil, nil, 3)
+		require.NoError(t, err)
+		assert.Contains(t, s.SourceRows, int64(137))
+		assert.Len(t, s.Rows, 8)
+	})
+
+	t.Run("unknown strategy", func(t *testing.T) {
+		_, err := privacy.SampleForGrounding(pool, columns, privacy.GroundingOptions{Strategy: "everything", Rows: 5}, 0, nil, nil, 1)
+		assert.ErrorIs(t, err, privacy.ErrUnknownGroundingStrategy)
+	})
+}
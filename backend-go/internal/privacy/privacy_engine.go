@@ -210,20 +210,25 @@ func (p *PrivacyEngine) applyLaplaceNoise(value interface{}, epsilon, sensitivit
 
 	budget.spend(epsilon, 0.0, fmt.Sprintf("laplace_noise_%s", "column"))
 
-	// Generate Laplace noise
-	scale := sensitivity / epsilon
-	noise := p.generateLaplaceNoise(scale)
+	return addNoise(value, p.laplace(epsilon, sensitivity)), nil
+}
+
+// laplace draws Laplace noise calibrated to epsilon and sensitivity
+func (p *PrivacyEngine) laplace(epsilon, sensitivity float64) float64 {
+	return p.generateLaplaceNoise(sensitivity / epsilon)
+}
 
-	// Apply noise based on value type
+// addNoise adds noise to numeric values and leaves others unchanged
+func addNoise(value interface{}, noise float64) interface{} {
 	switch v := value.(type) {
 	case float64:
-		return v + noise, nil
+		return v + noise
 	case int:
-		return int(float64(v) + noise), nil
+		return int(float64(v) + noise)
 	case int64:
-		return int64(float64(v) + noise), nil
+		return int64(float64(v) + noise)
 	default:
-		return value, nil
+		return value
 	}
 }
 
@@ -235,27 +240,17 @@ func (p *PrivacyEngine) applyGaussianNoise(value interface{}, epsilon, delta, se
 
 	budget.spend(epsilon, delta, fmt.Sprintf("gaussian_noise_%s", "column"))
 
-	// Calculate noise scale for Gaussian mechanism
 	if epsilon == 0 {
 		return value, nil
 	}
+	return addNoise(value, p.gaussian(epsilon, delta, sensitivity)), nil
+}
 
+// gaussian draws Gaussian noise calibrated to (ε,δ) and sensitivity
+func (p *PrivacyEngine) gaussian(epsilon, delta, sensitivity float64) float64 {
 	c := math.Sqrt(2 * math.Log(1.25/delta))
 	sigma := c * sensitivity / epsilon
-
-	noise := p.generateGaussianNoise(sigma)
-
-	// Apply noise based on value type
-	switch v := value.(type) {
-	case float64:
-		return v + noise, nil
-	case int:
-		return int(float64(v) + noise), nil
-	case int64:
-		return int64(float64(v) + noise), nil
-	default:
-		return value, nil
-	}
+	return p.generateGaussianNoise(sigma)
 }
 
 // applyRandomizedResponse applies randomized response for categorical data
@@ -266,7 +261,12 @@ func (p *PrivacyEngine) applyRandomizedResponse(value interface{}, epsilon float
 
 	budget.spend(epsilon, 0.0, fmt.Sprintf("randomized_response_%s", "column"))
 
-	// Randomized response mechanism
+	return p.randomizedResponse(value, epsilon, uniqueValues)
+}
+
+// randomizedResponse keeps a value with probability e^ε/(e^ε+1) and
+// replaces it from uniqueValues otherwise
+func (p *PrivacyEngine) randomizedResponse(value interface{}, epsilon float64, uniqueValues []interface{}) (interface{}, error) {
 	probability := math.Exp(epsilon) / (math.Exp(epsilon) + 1)
 
 	// Random decision
@@ -421,8 +421,8 @@ func (b *PrivacyBudget) spend(epsilon, delta float64, operation string) bool {
 
 // Helper methods for random number generation
 func (p *PrivacyEngine) generateLaplaceNoise(scale float64) float64 {
-	// Generate uniform random number in [0, 1)
-	u, _ := p.generateRandomFloat()
+	// Generate uniform random number in (0, 1)
+	u := p.generateOpenFloat()
 
 	// Transform to Laplace distribution
 	if u < 0.5 {
@@ -434,7 +434,7 @@ func (p *PrivacyEngine) generateLaplaceNoise(scale float64) float64 {
 
 func (p *PrivacyEngine) generateGaussianNoise(sigma float64) float64 {
 	// Box-Muller transform for Gaussian distribution
-	u1, _ := p.generateRandomFloat()
+	u1 := p.generateOpenFloat()
 	u2, _ := p.generateRandomFloat()
 
 	z0 := math.Sqrt(-2*math.Log(u1)) * math.Cos(2*math.Pi*u2)
@@ -449,6 +449,16 @@ func (p *PrivacyEngine) generateRandomFloat() (float64, error) {
 	return float64(n.Int64()) / 1000000.0, nil
 }
 
+// generateOpenFloat never returns 0, whose logarithm would make the noise
+// infinite
+func (p *PrivacyEngine) generateOpenFloat() float64 {
+	u, _ := p.generateRandomFloat()
+	if u == 0 {
+		return 0.5 / 1000000.0
+	}
+	return u
+}
+
 func (p *PrivacyEngine) generateRandomInt(max int) (int, error) {
 	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
 	if err != nil {
@@ -0,0 +1,255 @@
+// Package profiling supports diagnosing memory and goroutine issues in
+// production: an allowlist of the networks profiles may be requested from,
+// and heap dumps captured on demand or when the memory health check fails.
+package profiling
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/monitoring"
+)
+
+// MemoryCheck is the health check whose failure captures a heap dump
+const MemoryCheck = "memory"
+
+var (
+	ErrInvalidAllowlist = errors.New("invalid profiling allowlist entry")
+	ErrDumpNotFound     = errors.New("heap dump not found")
+	// ErrTooSoon is returned when a dump was captured less than the minimum
+	// interval ago
+	ErrTooSoon = errors.New("heap dump captured too recently")
+)
+
+// Allowlist holds the networks profiling endpoints answer to
+type Allowlist struct {
+	nets []*net.IPNet
+}
+
+// ParseAllowlist reads addresses and CIDR ranges; an empty list allows no one
+func ParseAllowlist(entries []string) (*Allowlist, error) {
+	a := &Allowlist{}
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if e == "" {
+			continue
+		}
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidAllowlist, e)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			a.nets = append(a.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAllowlist, e)
+		}
+		a.nets = append(a.nets, n)
+	}
+	return a, nil
+}
+
+// Allows reports whether an address is on the allowlist
+func (a *Allowlist) Allows(addr string) bool {
+	if a == nil {
+		return false
+	}
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	if ip == nil {
+		return false
+	}
+	for _, n := range a.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dump is a captured heap profile
+type Dump struct {
+	Name       string    `json:"name"`
+	Reason     string    `json:"reason"`
+	Size       int64     `json:"size"`
+	CapturedAt time.Time `json:"captured_at"`
+}
+
+// HeapDumper writes heap profiles to a directory, at most one per interval,
+// keeping the most recent ones. Dumps open in go tool pprof.
+type HeapDumper struct {
+	dir      string
+	keep     int
+	interval time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// NewHeapDumper returns a dumper writing to dir; keep and interval default
+// to 5 dumps and 30 minutes
+func NewHeapDumper(dir string, keep int, interval time.Duration) *HeapDumper {
+	if keep <= 0 {
+		keep = 5
+	}
+	if interval <= 0 {
+		interval = 30 * time.Minute
+	}
+	return &HeapDumper{dir: dir, keep: keep, interval: interval, now: time.Now}
+}
+
+// Capture writes a heap profile after a garbage collection, so it shows
+// what is live. Automatic captures within the interval of the last one are
+// refused with ErrTooSoon; forced ones are not.
+func (h *HeapDumper) Capture(reason string, force bool) (*Dump, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now().UTC()
+	if !force && !h.last.IsZero() && now.Sub(h.last) < h.interval {
+		return nil, ErrTooSoon
+	}
+	if err := os.MkdirAll(h.dir, 0o700); err != nil {
+		return nil, err
+	}
+	name := fmt.Sprintf("heap-%s-%s.pb.gz", now.Format("20060102T150405.000Z"), slug(reason))
+	f, err := os.OpenFile(filepath.Join(h.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	runtime.GC()
+	if err := pprof.Lookup("heap").WriteTo(f, 0); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	h.last = now
+	h.prune()
+	info, err := os.Stat(filepath.Join(h.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	return &Dump{Name: name, Reason: slug(reason), Size: info.Size(), CapturedAt: now}, nil
+}
+
+// slug keeps a reason safe for a file name
+func slug(reason string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(reason) {
+		if b.Len() >= 32 {
+			break
+		}
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	out := strings.Trim(b.String(), "_")
+	if out == "" {
+		return "manual"
+	}
+	return out
+}
+
+// prune removes all but the most recent dumps
+func (h *HeapDumper) prune() {
+	dumps, err := h.List()
+	if err != nil || len(dumps) <= h.keep {
+		return
+	}
+	for _, d := range dumps[h.keep:] {
+		os.Remove(filepath.Join(h.dir, d.Name))
+	}
+}
+
+// List returns the dumps on disk, newest first
+func (h *HeapDumper) List() ([]Dump, error) {
+	entries, err := os.ReadDir(h.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Dump{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := []Dump{}
+	for _, e := range entries {
+		d, ok := parseDump(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			d.Size = info.Size()
+		}
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name > out[j].Name })
+	return out, nil
+}
+
+func parseDump(name string) (Dump, bool) {
+	rest, ok := strings.CutPrefix(name, "heap-")
+	if !ok {
+		return Dump{}, false
+	}
+	rest, ok = strings.CutSuffix(rest, ".pb.gz")
+	if !ok {
+		return Dump{}, false
+	}
+	stamp, reason, ok := strings.Cut(rest, "-")
+	if !ok {
+		return Dump{}, false
+	}
+	at, err := time.Parse("20060102T150405.000Z", stamp)
+	if err != nil {
+		return Dump{}, false
+	}
+	return Dump{Name: name, Reason: reason, CapturedAt: at}, true
+}
+
+// Path resolves a dump by name; names are checked so only dumps in the
+// directory can be read
+func (h *HeapDumper) Path(name string) (string, error) {
+	if _, ok := parseDump(name); !ok || filepath.Base(name) != name {
+		return "", ErrDumpNotFound
+	}
+	path := filepath.Join(h.dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrDumpNotFound
+	}
+	return path, nil
+}
+
+// SendAlert implements monitoring.Notifier; alerts do not capture dumps
+func (h *HeapDumper) SendAlert(*monitoring.Alert) error { return nil }
+
+// SendHealthCheck implements monitoring.Notifier, capturing a heap dump
+// when the memory check fails
+func (h *HeapDumper) SendHealthCheck(hc *monitoring.HealthCheck) error {
+	if hc == nil || hc.Name != MemoryCheck || hc.Status != "unhealthy" {
+		return nil
+	}
+	_, err := h.Capture("memory_check", false)
+	if errors.Is(err, ErrTooSoon) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+// Package profiling_test provides unit tests for profiling support
+package profiling_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/monitoring"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/profiling"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowlist(t *testing.T) {
+	a, err := profiling.ParseAllowlist([]string{"127.0.0.1", " 10.0.0.0/8 ", "::1", ""})
+	require.NoError(t, err)
+	assert.True(t, a.Allows("127.0.0.1"))
+	assert.True(t, a.Allows("10.20.30.40"))
+	assert.True(t, a.Allows("::1"))
+	assert.False(t, a.Allows("192.168.1.1"))
+	assert.False(t, a.Allows("not-an-ip"))
+
+	empty, err := profiling.ParseAllowlist(nil)
+	require.NoError(t, err)
+	assert.False(t, empty.Allows("127.0.0.1"))
+	var none *profiling.Allowlist
+	assert.False(t, none.Allows("127.0.0.1"))
+
+	_, err = profiling.ParseAllowlist([]string{"10.0.0.0/33"})
+	assert.ErrorIs(t, err, profiling.ErrInvalidAllowlist)
+	_, err = profiling.ParseAllowlist([]string{"localhost"})
+	assert.ErrorIs(t, err, profiling.ErrInvalidAllowlist)
+}
+
+func TestHeapDumperCapturesAndPrunes(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "dumps")
+	h := profiling.NewHeapDumper(dir, 2, time.Hour)
+
+	var names []string
+	for _, reason := range []string{"first", "Second dump!", ""} {
+		d, err := h.Capture(reason, true)
+		require.NoError(t, err)
+		assert.Greater(t, d.Size, int64(0))
+		names = append(names, d.Name)
+		time.Sleep(2 * time.Millisecond)
+	}
+	assert.Contains(t, names[1], "-second_dump.pb.gz")
+	assert.Contains(t, names[2], "-manual.pb.gz")
+
+	dumps, err := h.List()
+	require.NoError(t, err)
+	require.Len(t, dumps, 2)
+	assert.Equal(t, names[2], dumps[0].Name)
+	assert.Equal(t, "manual", dumps[0].Reason)
+	assert.Equal(t, names[1], dumps[1].Name)
+
+	path, err := h.Path(names[2])
+	require.NoError(t, err)
+	_, err = os.Stat(path)
+	assert.NoError(t, err)
+	for _, name := range []string{names[0], "../secrets", "heap-x-y.pb.gz"} {
+		_, err := h.Path(name)
+		assert.ErrorIs(t, err, profiling.ErrDumpNotFound, name)
+	}
+}
+
+func TestHeapDumperOnMemoryCheck(t *testing.T) {
+	h := profiling.NewHeapDumper(t.TempDir(), 5, time.Hour)
+
+	require.NoError(t, h.SendHealthCheck(&monitoring.HealthCheck{Name: "goroutines", Status: "unhealthy"}))
+	require.NoError(t, h.SendHealthCheck(&monitoring.HealthCheck{Name: profiling.MemoryCheck, Status: "healthy"}))
+	dumps, _ := h.List()
+	assert.Empty(t, dumps)
+
+	require.NoError(t, h.SendHealthCheck(&monitoring.HealthCheck{Name: profiling.MemoryCheck, Status: "unhealthy"}))
+	// A second failure within the interval does not dump again
+	require.NoError(t, h.SendHealthCheck(&monitoring.HealthCheck{Name: profiling.MemoryCheck, Status: "unhealthy"}))
+	dumps, _ = h.List()
+	require.Len(t, dumps, 1)
+	assert.Equal(t, "memory_check", dumps[0].Reason)
+
+	_, err := h.Capture("again", false)
+	assert.ErrorIs(t, err, profiling.ErrTooSoon)
+}
@@ -0,0 +1,168 @@
+// Package provenance tags generated rows with the context they were
+// generated in: the job, the batch, the prompt template and the time. Tags
+// are written either as extra columns of every row or only in a sidecar
+// manifest that maps ranges of output rows to their batches, so a suspicious
+// row can be traced back to the exact generation that produced it.
+package provenance
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Modes
+const (
+	ModeColumns  = "columns"
+	ModeManifest = "manifest"
+)
+
+// Columns written to each row in columns mode
+const (
+	ColumnJobID           = "_provenance_job_id"
+	ColumnChunkID         = "_provenance_chunk_id"
+	ColumnTemplateVersion = "_provenance_template_version"
+	ColumnGeneratedAt     = "_provenance_generated_at"
+)
+
+// Columns are the provenance columns in the order they are documented
+var Columns = []string{ColumnJobID, ColumnChunkID, ColumnTemplateVersion, ColumnGeneratedAt}
+
+// ColumnFormats are the export formats rows can carry extra columns in;
+// fixed layouts and message schemas take the manifest only
+var ColumnFormats = []string{"csv", "json"}
+
+var (
+	ErrUnknownMode   = errors.New("provenance mode must be columns or manifest")
+	ErrColumnsFormat = errors.New("provenance columns need csv or json output; use the manifest mode for other formats")
+)
+
+// Options asks for provenance tags. Every mode records the manifest; columns
+// mode also tags each row.
+type Options struct {
+	Mode string `json:"mode"`
+}
+
+func (o Options) Validate() error {
+	switch o.Mode {
+	case ModeColumns, ModeManifest:
+		return nil
+	}
+	return ErrUnknownMode
+}
+
+// CheckFormat reports whether rows exported in format can be tagged as o asks
+func (o Options) CheckFormat(format string) error {
+	if o.Mode != ModeColumns {
+		return nil
+	}
+	for _, f := range ColumnFormats {
+		if f == format {
+			return nil
+		}
+	}
+	return ErrColumnsFormat
+}
+
+// Context is what rows are traced back to besides their batch
+type Context struct {
+	JobID           int64
+	TemplateVersion string
+	Provider        string
+	Model           string
+}
+
+// Tagger tags the batches of a job's rows as they are delivered and
+// records them for Manifest
+type Tagger struct {
+	opts     Options
+	ctx      Context
+	now      func() time.Time
+	manifest models.ProvenanceManifest
+}
+
+// NewTagger returns nil when the job did not ask for provenance. now is the
+// clock batches are stamped with.
+func NewTagger(opts *Options, ctx Context, now func() time.Time) *Tagger {
+	if opts == nil {
+		return nil
+	}
+	t := &Tagger{opts: *opts, ctx: ctx, now: now, manifest: models.ProvenanceManifest{
+		JobID:           ctx.JobID,
+		Mode:            opts.Mode,
+		TemplateVersion: ctx.TemplateVersion,
+		Provider:        ctx.Provider,
+		Model:           ctx.Model,
+		Chunks:          []models.ProvenanceChunk{},
+	}}
+	if opts.Mode == ModeColumns {
+		t.manifest.Columns = Columns
+	}
+	return t
+}
+
+// Tag records the delivered rows of a batch as a chunk and, in columns
+// mode, writes its tags to each row. Batches without rows are not recorded.
+func (t *Tagger) Tag(batch int, rows []map[string]interface{}) []map[string]interface{} {
+	if t == nil || len(rows) == 0 {
+		return rows
+	}
+	at := t.now().UTC().Truncate(time.Millisecond)
+	if t.opts.Mode == ModeColumns {
+		stamp := at.Format(time.RFC3339Nano)
+		for _, row := range rows {
+			row[ColumnJobID] = t.ctx.JobID
+			row[ColumnChunkID] = batch
+			row[ColumnTemplateVersion] = t.ctx.TemplateVersion
+			row[ColumnGeneratedAt] = stamp
+		}
+	}
+	t.manifest.Chunks = append(t.manifest.Chunks, models.ProvenanceChunk{
+		ChunkID:     batch,
+		FirstRow:    t.manifest.Rows,
+		Rows:        len(rows),
+		GeneratedAt: at,
+		Digest:      Digest(rows),
+	})
+	t.manifest.Rows += int64(len(rows))
+	return rows
+}
+
+// Manifest returns the chunks recorded so far
+func (t *Tagger) Manifest() *models.ProvenanceManifest {
+	if t == nil {
+		return nil
+	}
+	m := t.manifest
+	return &m
+}
+
+// Digest is the SHA-256 of rows written as JSON lines, with their keys in
+// sorted order
+func Digest(rows []map[string]interface{}) string {
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	for _, row := range rows {
+		// Rows are generated values, which always encode
+		_ = enc.Encode(row)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Locate returns the chunk holding the output row at index, counted from
+// zero, or false when the manifest has no such row
+func Locate(m *models.ProvenanceManifest, index int64) (models.ProvenanceChunk, bool) {
+	if m == nil {
+		return models.ProvenanceChunk{}, false
+	}
+	for _, c := range m.Chunks {
+		if index >= c.FirstRow && index < c.FirstRow+int64(c.Rows) {
+			return c, true
+		}
+	}
+	return models.ProvenanceChunk{}, false
+}
@@ -0,0 +1,79 @@
+// Package provenance_test provides unit tests for row provenance tags
+package provenance_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/provenance"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func clock() func() time.Time {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		at = at.Add(time.Second)
+		return at
+	}
+}
+
+var jobContext = provenance.Context{JobID: 42, TemplateVersion: "generation-prompt/v1", Provider: "vertex_ai", Model: "m"}
+
+func TestOptions(t *testing.T) {
+	assert.NoError(t, provenance.Options{Mode: provenance.ModeColumns}.Validate())
+	assert.NoError(t, provenance.Options{Mode: provenance.ModeManifest}.Validate())
+	assert.ErrorIs(t, provenance.Options{Mode: "footer"}.Validate(), provenance.ErrUnknownMode)
+
+	columns := provenance.Options{Mode: provenance.ModeColumns}
+	assert.NoError(t, columns.CheckFormat("csv"))
+	assert.ErrorIs(t, columns.CheckFormat("fixed_width"), provenance.ErrColumnsFormat)
+	assert.NoError(t, provenance.Options{Mode: provenance.ModeManifest}.CheckFormat("fixed_width"))
+}
+
+func TestTaggerColumns(t *testing.T) {
+	tagger := provenance.NewTagger(&provenance.Options{Mode: provenance.ModeColumns}, jobContext, clock())
+	first := tagger.Tag(1, []map[string]interface{}{{"a": 1.0}, {"a": 2.0}})
+	tagger.Tag(2, nil)
+	second := tagger.Tag(3, []map[string]interface{}{{"a": 3.0}})
+
+	assert.Equal(t, int64(42), first[1][provenance.ColumnJobID])
+	assert.Equal(t, 1, first[1][provenance.ColumnChunkID])
+	assert.Equal(t, "generation-prompt/v1", first[1][provenance.ColumnTemplateVersion])
+	assert.Equal(t, "2026-03-01T12:00:01Z", first[1][provenance.ColumnGeneratedAt])
+	assert.Equal(t, 3, second[0][provenance.ColumnChunkID])
+
+	m := tagger.Manifest()
+	assert.Equal(t, provenance.Columns, m.Columns)
+	assert.Equal(t, int64(3), m.Rows)
+	require.Len(t, m.Chunks, 2, "batches without rows are not recorded")
+	assert.Equal(t, int64(2), m.Chunks[1].FirstRow)
+	assert.Equal(t, provenance.Digest(second), m.Chunks[1].Digest)
+
+	chunk, ok := provenance.Locate(m, 1)
+	require.True(t, ok)
+	assert.Equal(t, 1, chunk.ChunkID)
+	chunk, ok = provenance.Locate(m, 2)
+	require.True(t, ok)
+	assert.Equal(t, 3, chunk.ChunkID)
+	_, ok = provenance.Locate(m, 3)
+	assert.False(t, ok)
+}
+
+func TestTaggerManifestOnly(t *testing.T) {
+	tagger := provenance.NewTagger(&provenance.Options{Mode: provenance.ModeManifest}, jobContext, clock())
+	rows := tagger.Tag(1, []map[string]interface{}{{"a": 1.0}})
+	assert.Equal(t, map[string]interface{}{"a": 1.0}, rows[0], "rows are left as generated")
+	m := tagger.Manifest()
+	assert.Empty(t, m.Columns)
+	assert.Equal(t, "vertex_ai", m.Provider)
+	require.Len(t, m.Chunks, 1)
+	assert.Len(t, m.Chunks[0].Digest, 64)
+
+	// Digests follow the values, not the order keys were set in
+	assert.Equal(t, provenance.Digest([]map[string]interface{}{{"a": 1.0, "b": "x"}}), provenance.Digest([]map[string]interface{}{{"b": "x", "a": 1.0}}))
+	assert.NotEqual(t, provenance.Digest([]map[string]interface{}{{"a": 1.0}}), provenance.Digest([]map[string]interface{}{{"a": 2.0}}))
+
+	assert.Nil(t, provenance.NewTagger(nil, jobContext, clock()))
+	assert.Nil(t, provenance.NewTagger(nil, jobContext, clock()).Manifest())
+}
@@ -0,0 +1,198 @@
+// Package qualitygate holds generated rows to the quality policy of their
+// dataset: minimum statistical similarity to the source, maximum drift of
+// any correlation, a ceiling on the share of rows that copy a source row
+// and a minimum quality score. Output that fails is generated again with
+// the policy's fallback strategies or its job failed with the checks that
+// failed.
+package qualitygate
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// MaxFallbacks bounds the strategies a policy retries with
+const MaxFallbacks = 4
+
+var ErrInvalidPolicy = errors.New("invalid quality policy")
+
+// strategies are the strategies a policy may fall back to
+var strategies = []agents.GenerationStrategy{
+	agents.StrategyStatistical, agents.StrategyAICreative, agents.StrategyHybrid,
+	agents.StrategyPatternBased, agents.StrategyConstraintDriven,
+}
+
+// Validate checks a policy sets at least one threshold, each within [0, 1],
+// and falls back only to known strategies, each once. OnFailure defaults to
+// fail.
+func Validate(p *models.QualityPolicy) error {
+	thresholds := map[string]*float64{
+		models.MetricStatisticalSimilarity: p.MinStatisticalSimilarity,
+		models.MetricCorrelationDrift:      p.MaxCorrelationDrift,
+		models.MetricPrivacyRisk:           p.MaxPrivacyRisk,
+		models.MetricQualityScore:          p.MinQualityScore,
+	}
+	set := false
+	for metric, t := range thresholds {
+		if t == nil {
+			continue
+		}
+		if *t < 0 || *t > 1 {
+			return fmt.Errorf("%w: %s must be between 0 and 1", ErrInvalidPolicy, metric)
+		}
+		set = true
+	}
+	if !set {
+		return fmt.Errorf("%w: no threshold set", ErrInvalidPolicy)
+	}
+	if p.OnFailure == "" {
+		p.OnFailure = models.QualityGateFail
+	}
+	switch p.OnFailure {
+	case models.QualityGateFail:
+		if len(p.FallbackStrategies) > 0 {
+			return fmt.Errorf("%w: fallback strategies need on_failure %q", ErrInvalidPolicy, models.QualityGateRetry)
+		}
+	case models.QualityGateRetry:
+		if len(p.FallbackStrategies) == 0 {
+			return fmt.Errorf("%w: on_failure %q needs fallback strategies", ErrInvalidPolicy, models.QualityGateRetry)
+		}
+		if len(p.FallbackStrategies) > MaxFallbacks {
+			return fmt.Errorf("%w: at most %d fallback strategies", ErrInvalidPolicy, MaxFallbacks)
+		}
+	default:
+		return fmt.Errorf("%w: unknown on_failure %q", ErrInvalidPolicy, p.OnFailure)
+	}
+	for i, s := range p.FallbackStrategies {
+		if !slices.Contains(strategies, agents.GenerationStrategy(s)) {
+			return fmt.Errorf("%w: unknown strategy %q", ErrInvalidPolicy, s)
+		}
+		if slices.Contains(p.FallbackStrategies[:i], s) {
+			return fmt.Errorf("%w: strategy %q repeated", ErrInvalidPolicy, s)
+		}
+	}
+	return nil
+}
+
+// Measures are the metrics of generated rows a policy is checked against;
+// nil when they could not be measured
+type Measures struct {
+	StatisticalSimilarity *float64
+	CorrelationDrift      *float64
+	PrivacyRisk           *float64
+	QualityScore          *float64
+}
+
+// Measure takes the metrics of rows from their fidelity report and quality
+// score and measures their privacy risk against the source rows. Rows
+// generated without source rows have no fidelity or privacy risk.
+func Measure(reference, rows []map[string]interface{}, report *fidelity.Report, score *float64) Measures {
+	m := Measures{QualityScore: score, PrivacyRisk: CopyRate(reference, rows)}
+	if report != nil {
+		similarity, drift := report.StatisticalSimilarity, report.MaxCorrelationDelta
+		m.StatisticalSimilarity, m.CorrelationDrift = &similarity, &drift
+	}
+	return m
+}
+
+// CopyRate is the share of generated rows equal to a source row in every
+// column both have; nil without rows on either side or shared columns
+func CopyRate(reference, rows []map[string]interface{}) *float64 {
+	if len(reference) == 0 || len(rows) == 0 {
+		return nil
+	}
+	var columns []string
+	for name := range reference[0] {
+		if _, ok := rows[0][name]; ok {
+			columns = append(columns, name)
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	sort.Strings(columns)
+	key := func(row map[string]interface{}) string {
+		var b strings.Builder
+		for _, c := range columns {
+			fmt.Fprintf(&b, "%v\x00", row[c])
+		}
+		return b.String()
+	}
+	source := make(map[string]struct{}, len(reference))
+	for _, row := range reference {
+		source[key(row)] = struct{}{}
+	}
+	copied := 0
+	for _, row := range rows {
+		if _, ok := source[key(row)]; ok {
+			copied++
+		}
+	}
+	rate := float64(copied) / float64(len(rows))
+	return &rate
+}
+
+// Check checks measures against each threshold a policy sets. A metric
+// that could not be measured passes, with the reason in its message.
+func Check(p models.QualityPolicy, m Measures) []models.QualityGateCheck {
+	var out []models.QualityGateCheck
+	check := func(metric string, threshold *float64, value *float64, minimum bool, unmeasured string) {
+		if threshold == nil {
+			return
+		}
+		c := models.QualityGateCheck{Metric: metric, Threshold: *threshold, Value: value, Passed: true}
+		switch {
+		case value == nil:
+			c.Message = fmt.Sprintf("%s not measured: %s", metric, unmeasured)
+		case minimum && *value < *threshold:
+			c.Passed, c.Message = false, fmt.Sprintf("%s %.3f is below the minimum %.3f", metric, *value, *threshold)
+		case !minimum && *value > *threshold:
+			c.Passed, c.Message = false, fmt.Sprintf("%s %.3f is above the maximum %.3f", metric, *value, *threshold)
+		default:
+			c.Message = fmt.Sprintf("%s %.3f is within %.3f", metric, *value, *threshold)
+		}
+		out = append(out, c)
+	}
+	const noSource = "no source rows to compare with"
+	check(models.MetricStatisticalSimilarity, p.MinStatisticalSimilarity, m.StatisticalSimilarity, true, noSource)
+	check(models.MetricCorrelationDrift, p.MaxCorrelationDrift, m.CorrelationDrift, false, noSource)
+	check(models.MetricPrivacyRisk, p.MaxPrivacyRisk, m.PrivacyRisk, false, noSource)
+	check(models.MetricQualityScore, p.MinQualityScore, m.QualityScore, true, "the generator reported none")
+	return out
+}
+
+// Passed reports whether every check passed
+func Passed(checks []models.QualityGateCheck) bool {
+	for _, c := range checks {
+		if !c.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// RejectedError fails a job whose output failed its quality policy with
+// every strategy tried
+type RejectedError struct {
+	Report models.QualityGateReport
+}
+
+// Error explains the checks the last attempt failed
+func (e *RejectedError) Error() string {
+	var failed []string
+	if n := len(e.Report.Attempts); n > 0 {
+		for _, c := range e.Report.Attempts[n-1].Checks {
+			if !c.Passed {
+				failed = append(failed, c.Message)
+			}
+		}
+	}
+	return fmt.Sprintf("output failed the quality policy after %d attempt(s): %s", len(e.Report.Attempts), strings.Join(failed, "; "))
+}
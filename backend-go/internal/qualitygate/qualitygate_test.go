@@ -0,0 +1,60 @@
+// Package qualitygate_test provides unit tests for dataset quality policies
+package qualitygate_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/fidelity"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/qualitygate"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr(v float64) *float64 { return &v }
+
+func TestValidate(t *testing.T) {
+	p := &models.QualityPolicy{MinStatisticalSimilarity: ptr(0.8)}
+	require.NoError(t, qualitygate.Validate(p))
+	assert.Equal(t, models.QualityGateFail, p.OnFailure)
+
+	for name, p := range map[string]*models.QualityPolicy{
+		"no threshold":          {},
+		"out of range":          {MaxPrivacyRisk: ptr(1.5)},
+		"unknown action":        {MinQualityScore: ptr(0.5), OnFailure: "ignore"},
+		"retry without options": {MinQualityScore: ptr(0.5), OnFailure: models.QualityGateRetry},
+		"fallbacks on fail":     {MinQualityScore: ptr(0.5), OnFailure: models.QualityGateFail, FallbackStrategies: pq.StringArray{"hybrid"}},
+		"unknown strategy":      {MinQualityScore: ptr(0.5), OnFailure: models.QualityGateRetry, FallbackStrategies: pq.StringArray{"magic"}},
+		"repeated strategy":     {MinQualityScore: ptr(0.5), OnFailure: models.QualityGateRetry, FallbackStrategies: pq.StringArray{"hybrid", "hybrid"}},
+	} {
+		assert.ErrorIs(t, qualitygate.Validate(p), qualitygate.ErrInvalidPolicy, name)
+	}
+}
+
+func TestCopyRate(t *testing.T) {
+	reference := []map[string]interface{}{{"a": 1.0, "b": "x"}, {"a": 2.0, "b": "y"}}
+	rows := []map[string]interface{}{{"a": 1.0, "b": "x", "extra": 1}, {"a": 2.0, "b": "z"}, {"a": 3.0, "b": "x"}, {"a": 2.0, "b": "y"}}
+	rate := qualitygate.CopyRate(reference, rows)
+	require.NotNil(t, rate)
+	assert.InDelta(t, 0.5, *rate, 1e-9)
+
+	assert.Nil(t, qualitygate.CopyRate(nil, rows))
+	assert.Nil(t, qualitygate.CopyRate(reference, []map[string]interface{}{{"c": 1}}))
+}
+
+func TestCheck(t *testing.T) {
+	policy := models.QualityPolicy{MinStatisticalSimilarity: ptr(0.8), MaxCorrelationDrift: ptr(0.2), MaxPrivacyRisk: ptr(0.05)}
+	m := qualitygate.Measure(nil, nil, &fidelity.Report{StatisticalSimilarity: 0.7, MaxCorrelationDelta: 0.1}, ptr(0.9))
+	checks := qualitygate.Check(policy, m)
+	require.Len(t, checks, 3)
+	assert.False(t, checks[0].Passed)
+	assert.Equal(t, "statistical_similarity 0.700 is below the minimum 0.800", checks[0].Message)
+	assert.True(t, checks[1].Passed)
+	assert.True(t, checks[2].Passed, "privacy risk without source rows is not measured")
+	assert.Nil(t, checks[2].Value)
+	assert.False(t, qualitygate.Passed(checks))
+
+	err := &qualitygate.RejectedError{Report: models.QualityGateReport{Attempts: []models.QualityGateAttempt{{Checks: checks}}}}
+	assert.Equal(t, "output failed the quality policy after 1 attempt(s): statistical_similarity 0.700 is below the minimum 0.800", err.Error())
+}
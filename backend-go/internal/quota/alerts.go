@@ -0,0 +1,166 @@
+// Package quota warns users as they approach the limits of their plan. Each
+// time usage is checked, the thresholds it reached of the monthly row limit
+// and the dataset limit are claimed once per calendar month; a newly reached
+// threshold is emailed and published to the user's webhooks.
+package quota
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/usage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
+	"go.uber.org/zap"
+)
+
+// Thresholds are the percentages of a limit users are warned at, ascending
+var Thresholds = []int{80, 90, 100}
+
+// Reached returns the thresholds used has reached of limit, ascending; none
+// when the limit is unlimited
+func Reached(used, limit int64) []int {
+	if limit <= 0 {
+		return nil
+	}
+	var out []int
+	for _, t := range Thresholds {
+		if used*100 >= int64(t)*limit {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Usage reads a user's usage and the limits of their plan
+type Usage interface {
+	GetUsageStats(ctx context.Context, userID int64) (*usage.UsageStats, error)
+}
+
+// Users looks up who to warn
+type Users interface {
+	GetByID(ctx context.Context, id int64) (*models.User, error)
+}
+
+// Store claims each alert once
+type Store interface {
+	Claim(ctx context.Context, a *models.QuotaAlert) (bool, error)
+	Release(ctx context.Context, userID int64, resource models.QuotaResource, period time.Time, threshold int) error
+}
+
+// Mailer sends the warning emails
+type Mailer interface {
+	SendQuotaWarningEmail(to, limitName string, threshold int, used, limit int64, resets string) error
+}
+
+// Publisher queues webhook events; an event published again under the same
+// ID is not delivered twice
+type Publisher interface {
+	PublishEvent(ctx context.Context, eventID string, userID int64, eventType string, data map[string]interface{}) error
+}
+
+// Notifier checks users' usage against their limits
+type Notifier struct {
+	usage    Usage
+	users    Users
+	store    Store
+	mailer   Mailer
+	webhooks Publisher
+	logger   *zap.Logger
+}
+
+// NewNotifier creates a notifier; webhooks may be nil
+func NewNotifier(usage Usage, users Users, store Store, mailer Mailer, webhooks Publisher, logger *zap.Logger) *Notifier {
+	return &Notifier{usage: usage, users: users, store: store, mailer: mailer, webhooks: webhooks, logger: logger}
+}
+
+type limitCheck struct {
+	resource    models.QuotaResource
+	name        string
+	used, limit int64
+	resets      string
+}
+
+// Check warns a user of the thresholds their usage newly reached in the
+// month of now, at most one email per limit: the highest threshold, with
+// the lower ones claimed alongside it. Alerts whose email failed are
+// released so the next check sends them. It returns how many warnings were
+// sent; a nil notifier sends none.
+func (n *Notifier) Check(ctx context.Context, userID int64, now time.Time) (int, error) {
+	if n == nil || userID == 0 {
+		return 0, nil
+	}
+	stats, err := n.usage.GetUsageStats(ctx, userID)
+	if err != nil {
+		return 0, fmt.Errorf("read usage: %w", err)
+	}
+	// Months follow GetUsageStats, which counts rows from the start of the
+	// local month
+	period := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	checks := []limitCheck{
+		{models.QuotaMonthlyRows, "monthly row limit", stats.MonthlyRowsGenerated, stats.PlanLimits.MonthlyRowLimit, period.AddDate(0, 1, 0).Format("January 2, 2006")},
+		{models.QuotaDatasets, "dataset limit", stats.TotalDatasets, stats.PlanLimits.MaxDatasets, ""},
+	}
+
+	var user *models.User
+	sent := 0
+	for _, c := range checks {
+		reached := Reached(c.used, c.limit)
+		if len(reached) == 0 {
+			continue
+		}
+		if user == nil {
+			if user, err = n.users.GetByID(ctx, userID); err != nil {
+				return sent, fmt.Errorf("read user: %w", err)
+			}
+			if !user.IsActive {
+				return 0, nil
+			}
+		}
+		var claimed []int
+		for _, t := range reached {
+			a := &models.QuotaAlert{UserID: userID, Resource: c.resource, Period: period, Threshold: t, Used: c.used, Limit: c.limit}
+			ok, err := n.store.Claim(ctx, a)
+			if err != nil {
+				n.release(ctx, userID, c.resource, period, claimed)
+				return sent, fmt.Errorf("claim quota alert: %w", err)
+			}
+			if ok {
+				claimed = append(claimed, t)
+			}
+		}
+		if len(claimed) == 0 {
+			continue
+		}
+		top := claimed[len(claimed)-1]
+		if err := n.mailer.SendQuotaWarningEmail(user.Email, c.name, top, c.used, c.limit, c.resets); err != nil {
+			n.release(ctx, userID, c.resource, period, claimed)
+			return sent, fmt.Errorf("send quota warning: %w", err)
+		}
+		sent++
+		if n.webhooks == nil {
+			continue
+		}
+		eventID := fmt.Sprintf("quota-%d-%s-%s-%d", userID, c.resource, period.Format("2006-01"), top)
+		err := n.webhooks.PublishEvent(ctx, eventID, userID, webhooks.EventQuotaThreshold, map[string]interface{}{
+			"resource":  c.resource,
+			"threshold": top,
+			"used":      c.used,
+			"limit":     c.limit,
+			"period":    period.Format("2006-01"),
+		})
+		if err != nil {
+			n.logger.Warn("failed to publish quota webhook", zap.Int64("user_id", userID), zap.String("resource", string(c.resource)), zap.Error(err))
+		}
+	}
+	return sent, nil
+}
+
+func (n *Notifier) release(ctx context.Context, userID int64, resource models.QuotaResource, period time.Time, thresholds []int) {
+	for _, t := range thresholds {
+		if err := n.store.Release(ctx, userID, resource, period, t); err != nil {
+			n.logger.Warn("failed to release quota alert", zap.Int64("user_id", userID), zap.String("resource", string(resource)), zap.Int("threshold", t), zap.Error(err))
+		}
+	}
+}
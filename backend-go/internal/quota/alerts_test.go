@@ -0,0 +1,161 @@
+// Package quota_test provides unit tests for quota warnings
+package quota_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/quota"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/usage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestReached(t *testing.T) {
+	assert.Empty(t, quota.Reached(7999, 10000))
+	assert.Equal(t, []int{80}, quota.Reached(8000, 10000))
+	assert.Equal(t, []int{80, 90}, quota.Reached(9500, 10000))
+	assert.Equal(t, []int{80, 90, 100}, quota.Reached(12000, 10000))
+	assert.Empty(t, quota.Reached(500, 0), "unlimited plans are never warned")
+}
+
+type fakeUsage struct{ stats usage.UsageStats }
+
+func (f *fakeUsage) GetUsageStats(context.Context, int64) (*usage.UsageStats, error) {
+	s := f.stats
+	return &s, nil
+}
+
+type fakeUsers struct{ active bool }
+
+func (f fakeUsers) GetByID(_ context.Context, id int64) (*models.User, error) {
+	return &models.User{ID: id, Email: "ada@example.com", IsActive: f.active}, nil
+}
+
+type memoryStore map[string]models.QuotaAlert
+
+func key(userID int64, resource models.QuotaResource, period time.Time, threshold int) string {
+	return fmt.Sprintf("%d/%s/%s/%d", userID, resource, period.Format("2006-01"), threshold)
+}
+
+func (s memoryStore) Claim(_ context.Context, a *models.QuotaAlert) (bool, error) {
+	k := key(a.UserID, a.Resource, a.Period, a.Threshold)
+	if _, ok := s[k]; ok {
+		return false, nil
+	}
+	s[k] = *a
+	return true, nil
+}
+
+func (s memoryStore) Release(_ context.Context, userID int64, resource models.QuotaResource, period time.Time, threshold int) error {
+	delete(s, key(userID, resource, period, threshold))
+	return nil
+}
+
+type sentEmail struct {
+	limitName   string
+	threshold   int
+	used, limit int64
+	resets      string
+}
+
+type fakeMailer struct {
+	sent    []sentEmail
+	failing bool
+}
+
+func (m *fakeMailer) SendQuotaWarningEmail(_, limitName string, threshold int, used, limit int64, resets string) error {
+	if m.failing {
+		return errors.New("smtp unavailable")
+	}
+	m.sent = append(m.sent, sentEmail{limitName, threshold, used, limit, resets})
+	return nil
+}
+
+type fakeHooks []string
+
+func (f *fakeHooks) PublishEvent(_ context.Context, eventID string, _ int64, eventType string, _ map[string]interface{}) error {
+	*f = append(*f, eventType+" "+eventID)
+	return nil
+}
+
+func TestCheckWarnsOncePerThreshold(t *testing.T) {
+	u := &fakeUsage{stats: usage.UsageStats{
+		MonthlyRowsGenerated: 8500,
+		TotalDatasets:        2,
+		PlanLimits:           usage.PlanLimits{MonthlyRowLimit: 10000, MaxDatasets: 10},
+	}}
+	store := memoryStore{}
+	mailer := &fakeMailer{}
+	hooks := &fakeHooks{}
+	n := quota.NewNotifier(u, fakeUsers{active: true}, store, mailer, hooks, zap.NewNop())
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	ctx := context.Background()
+
+	sent, err := n.Check(ctx, 3, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []sentEmail{{"monthly row limit", 80, 8500, 10000, "November 1, 2026"}}, mailer.sent)
+	assert.Equal(t, []string{webhooks.EventQuotaThreshold + " quota-3-monthly_rows-2026-10-80"}, []string(*hooks))
+
+	sent, err = n.Check(ctx, 3, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Zero(t, sent, "a threshold is warned of once a month")
+
+	u.stats.MonthlyRowsGenerated, u.stats.TotalDatasets = 10000, 10
+	sent, err = n.Check(ctx, 3, now.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	require.Len(t, mailer.sent, 3)
+	assert.Equal(t, 100, mailer.sent[1].threshold, "thresholds passed at once send only the highest")
+	assert.Equal(t, sentEmail{"dataset limit", 100, 10, 10, ""}, mailer.sent[2])
+	assert.Len(t, store, 6, "the skipped thresholds are claimed too")
+
+	sent, err = n.Check(ctx, 3, time.Date(2026, 11, 2, 9, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent, "a new month warns again")
+}
+
+func TestCheckRetriesFailedEmails(t *testing.T) {
+	u := &fakeUsage{stats: usage.UsageStats{MonthlyRowsGenerated: 950, PlanLimits: usage.PlanLimits{MonthlyRowLimit: 1000}}}
+	store := memoryStore{}
+	mailer := &fakeMailer{failing: true}
+	n := quota.NewNotifier(u, fakeUsers{active: true}, store, mailer, nil, zap.NewNop())
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+
+	_, err := n.Check(context.Background(), 3, now)
+	require.Error(t, err)
+	assert.Empty(t, store, "alerts whose email failed are released")
+
+	mailer.failing = false
+	sent, err := n.Check(context.Background(), 3, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, 90, mailer.sent[0].threshold)
+}
+
+func TestCheckSkipsInactiveAndUnlimited(t *testing.T) {
+	mailer := &fakeMailer{}
+	now := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+	over := &fakeUsage{stats: usage.UsageStats{MonthlyRowsGenerated: 2000, PlanLimits: usage.PlanLimits{MonthlyRowLimit: 1000}}}
+	sent, err := quota.NewNotifier(over, fakeUsers{}, memoryStore{}, mailer, nil, zap.NewNop()).Check(context.Background(), 3, now)
+	require.NoError(t, err)
+	assert.Zero(t, sent, "deactivated users are not warned")
+
+	unlimited := &fakeUsage{stats: usage.UsageStats{MonthlyRowsGenerated: 5000000}}
+	sent, err = quota.NewNotifier(unlimited, fakeUsers{active: true}, memoryStore{}, mailer, nil, zap.NewNop()).Check(context.Background(), 3, now)
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+	assert.Empty(t, mailer.sent)
+
+	var nilNotifier *quota.Notifier
+	sent, err = nilNotifier.Check(context.Background(), 3, now)
+	require.NoError(t, err)
+	assert.Zero(t, sent)
+}
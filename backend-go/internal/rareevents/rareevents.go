@@ -0,0 +1,379 @@
+// Package rareevents controls how generation treats rare categories and
+// numeric outliers. Rare events are profiled from the source, passed to
+// generation as target rates, enforced on generated rows and reported per
+// column with the job's quality.
+package rareevents
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Modes
+const (
+	// ModePreserve keeps rare events at their source proportions
+	ModePreserve = "preserve"
+	// ModeAmplify raises rare events above their source proportions, for
+	// testing edge cases
+	ModeAmplify = "amplify"
+	// ModeSuppress removes rare events, which can single out individuals
+	ModeSuppress = "suppress"
+)
+
+// Kinds of rare event
+const (
+	KindCategory = "category"
+	KindOutlier  = "outlier"
+)
+
+const (
+	// DefaultThreshold is the share of rows below which a category is rare
+	DefaultThreshold = 0.05
+	// MaxThreshold caps the rare-category threshold
+	MaxThreshold = 0.25
+	// DefaultAmplifyFactor and MaxAmplifyFactor bound how far amplify
+	// raises rare events
+	DefaultAmplifyFactor = 3
+	MaxAmplifyFactor     = 10
+	// MaxAmplifiedRate caps the rate of an amplified rare event
+	MaxAmplifiedRate = 0.5
+	// IQRMultiplier sets the outlier fences at this many interquartile
+	// ranges beyond the quartiles
+	IQRMultiplier = 1.5
+	// Tolerance is how far, relative to the target, a generated rate may
+	// drift
+	Tolerance = 0.5
+	// MinRows is the fewest source rows rare events are profiled from
+	MinRows = 20
+	// MaxCategoryShare skips columns whose distinct values exceed this share
+	// of rows, such as identifiers, where every value is rare
+	MaxCategoryShare = 0.5
+)
+
+var (
+	ErrUnknownMode      = errors.New("unknown rare event mode")
+	ErrInvalidFactor    = errors.New("amplify_factor is out of range")
+	ErrInvalidThreshold = errors.New("threshold is out of range")
+)
+
+// Options selects how rare events are handled in a job. Columns overrides
+// the mode per column.
+type Options struct {
+	Mode          string            `json:"mode"`
+	Columns       map[string]string `json:"columns,omitempty"`
+	Threshold     float64           `json:"threshold,omitempty"`
+	AmplifyFactor float64           `json:"amplify_factor,omitempty"`
+}
+
+// Validate checks the modes and bounds of the options
+func (o Options) Validate() error {
+	if !validMode(o.Mode) {
+		return fmt.Errorf("%w: %s", ErrUnknownMode, strconv.Quote(o.Mode))
+	}
+	for col, mode := range o.Columns {
+		if !validMode(mode) {
+			return fmt.Errorf("%w: %s for column %s", ErrUnknownMode, strconv.Quote(mode), strconv.Quote(col))
+		}
+	}
+	if o.Threshold < 0 || o.Threshold > MaxThreshold {
+		return fmt.Errorf("%w: at most %v", ErrInvalidThreshold, MaxThreshold)
+	}
+	if o.AmplifyFactor != 0 && (o.AmplifyFactor < 1 || o.AmplifyFactor > MaxAmplifyFactor) {
+		return fmt.Errorf("%w: between 1 and %d", ErrInvalidFactor, MaxAmplifyFactor)
+	}
+	return nil
+}
+
+func validMode(mode string) bool {
+	return mode == ModePreserve || mode == ModeAmplify || mode == ModeSuppress
+}
+
+func (o Options) modeFor(column string) string {
+	for col, mode := range o.Columns {
+		if strings.EqualFold(col, column) {
+			return mode
+		}
+	}
+	return o.Mode
+}
+
+// Profile finds the rare events of sampled rows and returns a rule per
+// column that has any. Numeric columns are checked for values beyond the
+// interquartile fences; other columns for categories under the threshold.
+func Profile(columns []string, rows []map[string]interface{}, opts Options) []agents.RareEventRule {
+	if len(rows) < MinRows {
+		return nil
+	}
+	threshold := opts.Threshold
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+	factor := opts.AmplifyFactor
+	if factor <= 0 {
+		factor = DefaultAmplifyFactor
+	}
+	var out []agents.RareEventRule
+	for _, col := range columns {
+		rule, ok := profileColumn(col, rows, threshold)
+		if !ok {
+			continue
+		}
+		rule.Mode = opts.modeFor(col)
+		switch rule.Mode {
+		case ModeAmplify:
+			rule.TargetRate = round(math.Min(math.Max(rule.SourceRate*factor, rule.SourceRate), MaxAmplifiedRate))
+		case ModeSuppress:
+			rule.TargetRate = 0
+		default:
+			rule.TargetRate = rule.SourceRate
+		}
+		out = append(out, rule)
+	}
+	return out
+}
+
+func profileColumn(col string, rows []map[string]interface{}, threshold float64) (agents.RareEventRule, bool) {
+	var nums []float64
+	counts := make(map[string]int)
+	numeric := true
+	for _, row := range rows {
+		v := text(row[col])
+		if v == "" {
+			continue
+		}
+		counts[v]++
+		if n, err := strconv.ParseFloat(v, 64); err == nil && numeric {
+			nums = append(nums, n)
+		} else {
+			numeric = false
+		}
+	}
+	n := 0
+	for _, c := range counts {
+		n += c
+	}
+	if n < MinRows {
+		return agents.RareEventRule{}, false
+	}
+
+	if numeric {
+		sort.Float64s(nums)
+		q1, q3 := quantile(nums, 0.25), quantile(nums, 0.75)
+		iqr := q3 - q1
+		if iqr <= 0 {
+			return agents.RareEventRule{}, false
+		}
+		lower, upper := q1-IQRMultiplier*iqr, q3+IQRMultiplier*iqr
+		outliers := 0
+		for _, x := range nums {
+			if x < lower || x > upper {
+				outliers++
+			}
+		}
+		return agents.RareEventRule{
+			Column:     col,
+			Kind:       KindOutlier,
+			Lower:      &lower,
+			Upper:      &upper,
+			SourceRate: round(float64(outliers) / float64(n)),
+		}, true
+	}
+
+	if float64(len(counts)) > MaxCategoryShare*float64(n) {
+		return agents.RareEventRule{}, false
+	}
+	var rare []string
+	rareRows := 0
+	for v, c := range counts {
+		if float64(c)/float64(n) < threshold {
+			rare = append(rare, v)
+			rareRows += c
+		}
+	}
+	if len(rare) == 0 {
+		return agents.RareEventRule{}, false
+	}
+	sort.Strings(rare)
+	return agents.RareEventRule{
+		Column:     col,
+		Kind:       KindCategory,
+		Values:     rare,
+		SourceRate: round(float64(rareRows) / float64(n)),
+	}, true
+}
+
+// quantile interpolates the q-th quantile of sorted values
+func quantile(sorted []float64, q float64) float64 {
+	pos := q * float64(len(sorted)-1)
+	i := int(pos)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (pos-float64(i))*(sorted[i+1]-sorted[i])
+}
+
+// Apply adds rare event rules to a generation request, as checks on the
+// output and as rules in the prompt. Rare categories are only named in the
+// prompt when source values may be quoted and the column is not restricted.
+func Apply(req *agents.GenerationRequest, rules []agents.RareEventRule) {
+	restricted := make(map[string]bool, len(req.RestrictedColumns))
+	for _, c := range req.RestrictedColumns {
+		restricted[strings.ToLower(c)] = true
+	}
+	for _, rule := range rules {
+		req.SchemaAnalysis.RareEvents = append(req.SchemaAnalysis.RareEvents, rule)
+		var events string
+		switch rule.Kind {
+		case KindOutlier:
+			events = fmt.Sprintf("values outside [%.4g, %.4g]", *rule.Lower, *rule.Upper)
+		default:
+			events = "rare categories"
+			if !req.ZeroRealData && !restricted[strings.ToLower(rule.Column)] {
+				events = fmt.Sprintf("rare categories (%s)", strings.Join(rule.Values, ", "))
+			}
+		}
+		var instruction string
+		switch rule.Mode {
+		case ModeSuppress:
+			instruction = "never generate " + events
+		case ModeAmplify:
+			instruction = fmt.Sprintf("generate %s in about %.1f%% of rows (%.1f%% in the source)", events, rule.TargetRate*100, rule.SourceRate*100)
+		default:
+			instruction = fmt.Sprintf("generate %s in about %.1f%% of rows, as in the source", events, rule.TargetRate*100)
+		}
+		req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints, fmt.Sprintf("%s: %s", rule.Column, instruction))
+	}
+}
+
+// Controller enforces rare event rules on generated rows: rows carrying a
+// suppressed event are dropped, as are rows that would take an event past
+// its target for the requested row count. It counts what it keeps for
+// Report.
+type Controller struct {
+	rules   []agents.RareEventRule
+	values  []map[string]bool
+	budget  []int64
+	events  []int64
+	dropped []int64
+	rows    int64
+}
+
+// NewController returns nil when there are no rules. rows is the number of
+// rows requested.
+func NewController(rules []agents.RareEventRule, rows int64) *Controller {
+	if len(rules) == 0 {
+		return nil
+	}
+	c := &Controller{
+		rules:   rules,
+		values:  make([]map[string]bool, len(rules)),
+		budget:  make([]int64, len(rules)),
+		events:  make([]int64, len(rules)),
+		dropped: make([]int64, len(rules)),
+	}
+	for i, rule := range rules {
+		c.values[i] = make(map[string]bool, len(rule.Values))
+		for _, v := range rule.Values {
+			c.values[i][v] = true
+		}
+		c.budget[i] = int64(math.Ceil(rule.TargetRate*(1+Tolerance)*float64(rows))) + 1
+		if rule.Mode == ModeSuppress {
+			c.budget[i] = 0
+		}
+	}
+	return c
+}
+
+// Filter returns the rows within every rule
+func (c *Controller) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if c == nil {
+		return rows
+	}
+	kept := rows[:0:0]
+	hits := make([]bool, len(c.rules))
+rows:
+	for _, row := range rows {
+		for i := range c.rules {
+			hits[i] = c.isEvent(i, row)
+			if hits[i] && c.events[i] >= c.budget[i] {
+				c.dropped[i]++
+				continue rows
+			}
+		}
+		for i, hit := range hits {
+			if hit {
+				c.events[i]++
+			}
+		}
+		c.rows++
+		kept = append(kept, row)
+	}
+	return kept
+}
+
+func (c *Controller) isEvent(i int, row map[string]interface{}) bool {
+	rule := c.rules[i]
+	v := text(row[rule.Column])
+	if v == "" {
+		return false
+	}
+	if rule.Kind == KindOutlier {
+		n, err := strconv.ParseFloat(v, 64)
+		return err == nil && (n < *rule.Lower || n > *rule.Upper)
+	}
+	return c.values[i][v]
+}
+
+// Report compares the kept rows with each rule. A rate is within tolerance
+// when it is within Tolerance of the target, or one row of it.
+func (c *Controller) Report() []models.RareEventReport {
+	if c == nil {
+		return nil
+	}
+	out := make([]models.RareEventReport, len(c.rules))
+	for i, rule := range c.rules {
+		var rate float64
+		if c.rows > 0 {
+			rate = float64(c.events[i]) / float64(c.rows)
+		}
+		slack := rule.TargetRate * Tolerance
+		if c.rows > 0 {
+			slack = math.Max(slack, 1/float64(c.rows))
+		}
+		out[i] = models.RareEventReport{
+			Column:          rule.Column,
+			Kind:            rule.Kind,
+			Mode:            rule.Mode,
+			SourceRate:      rule.SourceRate,
+			TargetRate:      rule.TargetRate,
+			GeneratedRate:   round(rate),
+			Events:          c.events[i],
+			Dropped:         c.dropped[i],
+			WithinTolerance: math.Abs(rate-rule.TargetRate) <= slack,
+		}
+	}
+	return out
+}
+
+func text(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
@@ -0,0 +1,107 @@
+// Package rareevents_test provides unit tests for rare event controls
+package rareevents_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rareevents"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// source has 40 rows: plan "enterprise" appears once, and amount has one
+// outlier of 1000 among values 10..48
+func source() []map[string]interface{} {
+	var rows []map[string]interface{}
+	for i := 0; i < 40; i++ {
+		plan, amount := "free", float64(10+i)
+		if i%2 == 1 {
+			plan = "pro"
+		}
+		if i == 7 {
+			plan, amount = "enterprise", 1000
+		}
+		rows = append(rows, map[string]interface{}{"id": fmt.Sprint(i), "plan": plan, "amount": amount})
+	}
+	return rows
+}
+
+func TestProfile(t *testing.T) {
+	rules := rareevents.Profile([]string{"id", "plan", "amount"}, source(), rareevents.Options{
+		Mode:    rareevents.ModePreserve,
+		Columns: map[string]string{"AMOUNT": rareevents.ModeSuppress},
+	})
+	require.Len(t, rules, 3)
+
+	id := rules[0]
+	assert.Equal(t, rareevents.KindOutlier, id.Kind)
+	assert.Zero(t, id.SourceRate, "id has no outliers, so preserving keeps it that way")
+
+	plan := rules[1]
+	assert.Equal(t, rareevents.KindCategory, plan.Kind)
+	assert.Equal(t, []string{"enterprise"}, plan.Values)
+	assert.InDelta(t, 0.025, plan.SourceRate, 1e-9)
+	assert.Equal(t, plan.SourceRate, plan.TargetRate)
+
+	amount := rules[2]
+	assert.Equal(t, rareevents.KindOutlier, amount.Kind)
+	assert.Equal(t, rareevents.ModeSuppress, amount.Mode)
+	assert.Greater(t, 1000.0, *amount.Upper)
+	assert.Zero(t, amount.TargetRate)
+
+	amplified := rareevents.Profile([]string{"plan"}, source(), rareevents.Options{Mode: rareevents.ModeAmplify, AmplifyFactor: 4})
+	require.Len(t, amplified, 1)
+	assert.InDelta(t, 0.1, amplified[0].TargetRate, 1e-9)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, rareevents.Options{Mode: rareevents.ModeAmplify, AmplifyFactor: 2}.Validate())
+	assert.ErrorIs(t, rareevents.Options{Mode: "drop"}.Validate(), rareevents.ErrUnknownMode)
+	assert.ErrorIs(t, rareevents.Options{Mode: rareevents.ModePreserve, Columns: map[string]string{"a": "x"}}.Validate(), rareevents.ErrUnknownMode)
+	assert.ErrorIs(t, rareevents.Options{Mode: rareevents.ModePreserve, Threshold: 0.9}.Validate(), rareevents.ErrInvalidThreshold)
+	assert.ErrorIs(t, rareevents.Options{Mode: rareevents.ModeAmplify, AmplifyFactor: 50}.Validate(), rareevents.ErrInvalidFactor)
+}
+
+func TestApplyWithholdsValues(t *testing.T) {
+	rules := rareevents.Profile([]string{"plan"}, source(), rareevents.Options{Mode: rareevents.ModePreserve})
+	req := &agents.GenerationRequest{}
+	rareevents.Apply(req, rules)
+	require.Len(t, req.SchemaAnalysis.Constraints, 1)
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "enterprise")
+	assert.Len(t, req.SchemaAnalysis.RareEvents, 1)
+
+	req = &agents.GenerationRequest{ZeroRealData: true}
+	rareevents.Apply(req, rules)
+	assert.NotContains(t, req.SchemaAnalysis.Constraints[0], "enterprise", "source values stay out of zero-real-data prompts")
+}
+
+func TestController(t *testing.T) {
+	upper := 100.0
+	lower := 0.0
+	c := rareevents.NewController([]agents.RareEventRule{
+		{Column: "plan", Kind: rareevents.KindCategory, Mode: rareevents.ModePreserve, Values: []string{"enterprise"}, SourceRate: 0.1, TargetRate: 0.1},
+		{Column: "amount", Kind: rareevents.KindOutlier, Mode: rareevents.ModeSuppress, Lower: &lower, Upper: &upper, SourceRate: 0.05},
+	}, 10)
+
+	var rows []map[string]interface{}
+	for i := 0; i < 10; i++ {
+		rows = append(rows, map[string]interface{}{"plan": "enterprise", "amount": 50.0})
+	}
+	rows = append(rows, map[string]interface{}{"plan": "free", "amount": 500.0})
+	kept := c.Filter(rows)
+	// The budget for 10 rows at 10% with tolerance is 3 events
+	assert.Len(t, kept, 3)
+
+	report := c.Report()
+	require.Len(t, report, 2)
+	assert.Equal(t, int64(3), report[0].Events)
+	assert.Equal(t, int64(7), report[0].Dropped)
+	assert.False(t, report[0].WithinTolerance, "every kept row is rare")
+	assert.Equal(t, int64(1), report[1].Dropped)
+	assert.Zero(t, report[1].Events)
+	assert.True(t, report[1].WithinTolerance)
+
+	assert.Nil(t, rareevents.NewController(nil, 10))
+}
@@ -0,0 +1,210 @@
+// Package rbac decides what a caller may do from the permissions of their
+// roles. A user holds their account role plus any roles assigned to them,
+// each role grants permissions such as dataset:read or admin:users, and an
+// API key can be scoped down to a subset of its owner's permissions.
+package rbac
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// Permission is an action on a kind of resource, written resource:action.
+// "resource:*" covers every action on a resource and "*" covers everything.
+type Permission string
+
+const (
+	All Permission = "*"
+
+	DatasetRead      Permission = "dataset:read"
+	DatasetWrite     Permission = "dataset:write"
+	GenerationRead   Permission = "generation:read"
+	GenerationCreate Permission = "generation:create"
+	CustomModelRead  Permission = "custom_model:read"
+	CustomModelWrite Permission = "custom_model:write"
+
+	AdminUsers        Permission = "admin:users"
+	AdminRoles        Permission = "admin:roles"
+	AdminOrgs         Permission = "admin:orgs"
+	AdminBilling      Permission = "admin:billing"
+	AdminReports      Permission = "admin:reports"
+	AdminSLA          Permission = "admin:sla"
+	AdminOutputAccess Permission = "admin:output_access"
+	AdminDebug        Permission = "admin:debug"
+	AdminAudit        Permission = "admin:audit"
+	AdminChangelog    Permission = "admin:changelog"
+	AdminIncidents    Permission = "admin:incidents"
+	AdminImpersonate  Permission = "admin:impersonate"
+	AdminHousekeeping Permission = "admin:housekeeping"
+)
+
+// Built-in roles; every user holds one of them as their account role
+const (
+	RoleAdmin      = "admin"
+	RoleUser       = "user"
+	RoleEnterprise = "enterprise"
+)
+
+var (
+	ErrUnknownPermission = errors.New("unknown permission")
+	ErrInvalidRoleName   = errors.New("role names are 1-50 lowercase letters, digits, '-' or '_'")
+)
+
+// Definition describes a permission for the admin console
+type Definition struct {
+	Permission  Permission `json:"permission"`
+	Description string     `json:"description"`
+}
+
+// Catalog lists every permission a role can grant
+var Catalog = []Definition{
+	{DatasetRead, "Read, preview and download datasets"},
+	{DatasetWrite, "Upload, change and delete datasets"},
+	{GenerationRead, "Read generation jobs and their output"},
+	{GenerationCreate, "Start and control generation jobs"},
+	{CustomModelRead, "Read custom models"},
+	{CustomModelWrite, "Upload and delete custom models"},
+	{AdminUsers, "Manage user accounts and their organizations"},
+	{AdminRoles, "Manage roles, their permissions and who holds them"},
+	{AdminOrgs, "Manage organization policies and settings"},
+	{AdminBilling, "Read revenue analytics and change users' plans and quotas"},
+	{AdminReports, "Manage and run report templates"},
+	{AdminSLA, "Read and generate SLA reports"},
+	{AdminOutputAccess, "Decide requests for generated output"},
+	{AdminDebug, "Profile the running service"},
+	{AdminAudit, "Export signed audit evidence packages"},
+	{AdminChangelog, "Write and publish changelog entries"},
+	{AdminIncidents, "Read the incident timeline and record deployment markers"},
+	{AdminImpersonate, "Act as a user for support, with every change audited"},
+	{AdminHousekeeping, "Review stale resource cleanup suggestions and set cleanup policies"},
+}
+
+// userPermissions are what every signed-up account may do with its own
+// resources
+var userPermissions = []Permission{"dataset:*", "generation:*", "custom_model:*"}
+
+// BuiltinRoles are created with these permissions the first time the
+// service starts; admins may change them afterwards
+var BuiltinRoles = map[string][]Permission{
+	RoleAdmin:      {All},
+	RoleUser:       userPermissions,
+	RoleEnterprise: userPermissions,
+}
+
+// Parse validates a permission: one from the catalog, a resource wildcard
+// such as "dataset:*", or "*"
+func Parse(s string) (Permission, error) {
+	p := Permission(strings.ToLower(strings.TrimSpace(s)))
+	if p == All {
+		return p, nil
+	}
+	for _, def := range Catalog {
+		if def.Permission == p || resource(def.Permission)+":*" == string(p) {
+			return p, nil
+		}
+	}
+	return "", ErrUnknownPermission
+}
+
+// ParseAll validates a list of permissions, dropping duplicates
+func ParseAll(in []string) (Set, error) {
+	seen := map[Permission]bool{}
+	out := Set{}
+	for _, s := range in {
+		p, err := Parse(s)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out, nil
+}
+
+func resource(p Permission) string {
+	r, _, _ := strings.Cut(string(p), ":")
+	return r
+}
+
+// ValidRoleName reports whether name can name a role
+func ValidRoleName(name string) error {
+	if name == "" || len(name) > 50 {
+		return ErrInvalidRoleName
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return ErrInvalidRoleName
+		}
+	}
+	return nil
+}
+
+// Matches reports whether granted covers want. A wildcard want, such as an
+// API key scope of "dataset:*", is only covered by an equal or wider grant.
+func Matches(granted, want Permission) bool {
+	switch {
+	case granted == All || granted == want:
+		return true
+	case want == All:
+		return false
+	case strings.HasSuffix(string(granted), ":*"):
+		return resource(granted) == resource(want)
+	}
+	return false
+}
+
+// Set is a list of granted permissions
+type Set []Permission
+
+// Has reports whether any permission in s covers want
+func (s Set) Has(want Permission) bool {
+	for _, p := range s {
+		if Matches(p, want) {
+			return true
+		}
+	}
+	return false
+}
+
+// Staff reports whether s grants any admin permission
+func (s Set) Staff() bool {
+	for _, def := range Catalog {
+		if resource(def.Permission) == "admin" && s.Has(def.Permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// Principal is an authenticated caller and what they may do
+type Principal struct {
+	UserID      int64    `json:"user_id"`
+	Roles       []string `json:"roles"`
+	Permissions Set      `json:"permissions"`
+	// Scopes limits an API key to part of its owner's permissions; nil for
+	// sessions and unscoped keys
+	Scopes Set `json:"scopes,omitempty"`
+}
+
+// Can reports whether the principal may do want
+func (p *Principal) Can(want Permission) bool {
+	if p == nil || !p.Permissions.Has(want) {
+		return false
+	}
+	return p.Scopes == nil || p.Scopes.Has(want)
+}
+
+// Effective lists the catalog permissions the principal holds
+func (p *Principal) Effective() []Permission {
+	out := []Permission{}
+	for _, def := range Catalog {
+		if p.Can(def.Permission) {
+			out = append(out, def.Permission)
+		}
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+// Package rbac_test provides unit tests for roles and permissions
+package rbac_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rbac"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	p, err := rbac.Parse(" Dataset:Read ")
+	require.NoError(t, err)
+	assert.Equal(t, rbac.DatasetRead, p)
+
+	for _, ok := range []string{"*", "dataset:*", "admin:*", "admin:users"} {
+		_, err := rbac.Parse(ok)
+		assert.NoError(t, err, ok)
+	}
+	for _, bad := range []string{"", "dataset", "dataset:drop", "billing:*", "*:read"} {
+		_, err := rbac.Parse(bad)
+		assert.ErrorIs(t, err, rbac.ErrUnknownPermission, bad)
+	}
+}
+
+func TestParseAll(t *testing.T) {
+	set, err := rbac.ParseAll([]string{"generation:create", "dataset:read", "dataset:read"})
+	require.NoError(t, err)
+	assert.Equal(t, rbac.Set{rbac.DatasetRead, rbac.GenerationCreate}, set)
+
+	_, err = rbac.ParseAll([]string{"dataset:read", "nope"})
+	assert.ErrorIs(t, err, rbac.ErrUnknownPermission)
+}
+
+func TestMatches(t *testing.T) {
+	assert.True(t, rbac.Matches(rbac.All, rbac.AdminUsers))
+	assert.True(t, rbac.Matches("dataset:*", rbac.DatasetWrite))
+	assert.True(t, rbac.Matches("dataset:*", "dataset:*"))
+	assert.False(t, rbac.Matches("dataset:*", rbac.GenerationRead))
+	assert.False(t, rbac.Matches(rbac.DatasetRead, "dataset:*"), "a single action does not cover the wildcard")
+	assert.False(t, rbac.Matches("admin:*", rbac.All))
+}
+
+func TestPrincipalCan(t *testing.T) {
+	user := &rbac.Principal{UserID: 1, Roles: []string{rbac.RoleUser}, Permissions: rbac.BuiltinRoles[rbac.RoleUser]}
+	assert.True(t, user.Can(rbac.DatasetWrite))
+	assert.False(t, user.Can(rbac.AdminUsers))
+
+	// An API key scoped to reads cannot write, even for an admin
+	key := &rbac.Principal{UserID: 2, Permissions: rbac.Set{rbac.All}, Scopes: rbac.Set{rbac.DatasetRead, rbac.GenerationRead}}
+	assert.True(t, key.Can(rbac.DatasetRead))
+	assert.False(t, key.Can(rbac.DatasetWrite))
+	assert.Equal(t, []rbac.Permission{rbac.DatasetRead, rbac.GenerationRead}, key.Effective())
+
+	var nobody *rbac.Principal
+	assert.False(t, nobody.Can(rbac.DatasetRead))
+}
+
+func TestSetStaff(t *testing.T) {
+	assert.False(t, rbac.Set(rbac.BuiltinRoles[rbac.RoleUser]).Staff())
+	assert.True(t, rbac.Set(rbac.BuiltinRoles[rbac.RoleAdmin]).Staff())
+	assert.True(t, rbac.Set{rbac.DatasetRead, rbac.AdminIncidents}.Staff())
+	assert.True(t, rbac.Set{"admin:*"}.Staff())
+}
+
+func TestValidRoleName(t *testing.T) {
+	assert.NoError(t, rbac.ValidRoleName("support_tier-2"))
+	assert.ErrorIs(t, rbac.ValidRoleName("Support"), rbac.ErrInvalidRoleName)
+	assert.ErrorIs(t, rbac.ValidRoleName(""), rbac.ErrInvalidRoleName)
+}
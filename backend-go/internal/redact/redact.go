@@ -0,0 +1,156 @@
+// Package redact keeps personal data out of logs and error messages. Free
+// text is scanned for values that look like PII, values known to come from
+// dataset rows are masked wherever they appear, and a zap core applies both
+// to every log entry, so modules do not need to remember to.
+//
+// Masked values become a kind and a short keyed hash, such as
+// [email:3f9a1c2e]: the same value masks the same way within a process, so
+// repeated failures can still be correlated without storing the value.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+var (
+	keyMu sync.RWMutex
+	key   = newKey()
+)
+
+func newKey() []byte {
+	k := make([]byte, 32)
+	if _, err := rand.Read(k); err != nil {
+		panic(fmt.Sprintf("redact: no randomness for the hash key: %v", err))
+	}
+	return k
+}
+
+// SetKey sets the key masked values are hashed with. By default each process
+// draws a random key; sharing one lets masks be matched across instances.
+func SetKey(k []byte) {
+	if len(k) == 0 {
+		return
+	}
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	key = append([]byte(nil), k...)
+}
+
+// Hash masks a value as [kind:hash]
+func Hash(kind, value string) string {
+	keyMu.RLock()
+	mac := hmac.New(sha256.New, key)
+	keyMu.RUnlock()
+	mac.Write([]byte(value))
+	return "[" + kind + ":" + hex.EncodeToString(mac.Sum(nil))[:8] + "]"
+}
+
+type pattern struct {
+	kind  string
+	re    *regexp.Regexp
+	match func(string) bool
+}
+
+// patterns are tried in order, so card numbers are masked before their
+// digits can be read as phone numbers
+var patterns = []pattern{
+	{kind: "email", re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)},
+	{kind: "card", re: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`), match: luhn},
+	{kind: "ssn", re: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{kind: "phone", re: regexp.MustCompile(`(?:\+\d{1,3}[ .\-]?)?(?:\(\d{3}\)|\b\d{3})[ .\-]\d{3}[ .\-]\d{4}\b`)},
+}
+
+// String masks suspected PII in free text: email addresses, payment card
+// numbers, US social security numbers and phone numbers
+func String(s string) string {
+	for _, p := range patterns {
+		s = p.re.ReplaceAllStringFunc(s, func(m string) string {
+			if p.match != nil && !p.match(m) {
+				return m
+			}
+			return Hash(p.kind, m)
+		})
+	}
+	return s
+}
+
+// Scrub replaces suspected PII in free text with a placeholder naming its
+// kind, such as [email], and counts the replacements by kind. Unlike String
+// it keeps nothing of the value, for text that leaves the process.
+func Scrub(s string) (string, map[string]int) {
+	found := map[string]int{}
+	for _, p := range patterns {
+		s = p.re.ReplaceAllStringFunc(s, func(m string) string {
+			if p.match != nil && !p.match(m) {
+				return m
+			}
+			found[p.kind]++
+			return "[" + p.kind + "]"
+		})
+	}
+	return s, found
+}
+
+// Values masks each value wherever it appears in s, then masks suspected PII
+// in what is left. It is for messages that may quote dataset cells, whose
+// values carry no recognisable pattern.
+func Values(s string, values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) == "" {
+			continue
+		}
+		s = strings.ReplaceAll(s, v, Hash("value", v))
+	}
+	return String(s)
+}
+
+// Error returns err with its message masked by String. errors.Is and
+// errors.As still see the original error.
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	var r *redacted
+	if errors.As(err, &r) {
+		return err
+	}
+	return &redacted{err: err, msg: String(err.Error())}
+}
+
+type redacted struct {
+	err error
+	msg string
+}
+
+func (r *redacted) Error() string { return r.msg }
+func (r *redacted) Unwrap() error { return r.err }
+
+// luhn reports whether the digits of s pass the Luhn checksum, which every
+// payment card number does
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		r := rune(s[i])
+		if !unicode.IsDigit(r) {
+			continue
+		}
+		d := int(r - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
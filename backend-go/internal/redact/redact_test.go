@@ -0,0 +1,70 @@
+// Package redact_test provides unit tests for PII redaction
+package redact_test
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/redact"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestString(t *testing.T) {
+	in := "row 3: jane.doe@example.com paid with 4111 1111 1111 1111, ssn 123-45-6789, call (555) 123-4567"
+	out := redact.String(in)
+	for _, leaked := range []string{"jane.doe@example.com", "4111 1111 1111 1111", "123-45-6789", "(555) 123-4567"} {
+		assert.NotContains(t, out, leaked)
+	}
+	assert.Contains(t, out, redact.Hash("email", "jane.doe@example.com"))
+	assert.Contains(t, out, redact.Hash("card", "4111 1111 1111 1111"))
+	assert.True(t, strings.HasPrefix(out, "row 3: [email:"))
+
+	// Digit runs that fail the card checksum, dates and IDs are kept
+	for _, keep := range []string{"order 4111111111111112", "job 1234 failed at 2024-05-01T10:00:00Z", "expected 100 rows, got 98"} {
+		assert.Equal(t, keep, redact.String(keep))
+	}
+}
+
+func TestScrub(t *testing.T) {
+	out, found := redact.Scrub("reach jane.doe@example.com or (555) 123-4567, card 4111 1111 1111 1111, order 4111111111111112")
+	assert.Equal(t, "reach [email] or [phone], card [card], order 4111111111111112", out)
+	assert.Equal(t, map[string]int{"email": 1, "phone": 1, "card": 1}, found)
+}
+
+func TestValues(t *testing.T) {
+	msg := `row 2, column "diagnosis": expected a number, got string "Type 2 diabetes"`
+	out := redact.Values(msg, "Type 2 diabetes", "")
+	assert.Equal(t, `row 2, column "diagnosis": expected a number, got string "`+redact.Hash("value", "Type 2 diabetes")+`"`, out)
+	assert.Equal(t, redact.Hash("value", "x"), redact.Hash("value", "x"), "masks are stable")
+	assert.NotEqual(t, redact.Hash("value", "x"), redact.Hash("value", "y"))
+}
+
+func TestError(t *testing.T) {
+	err := redact.Error(errors.Join(io.EOF, errors.New("bad row for bob@example.com")))
+	assert.NotContains(t, err.Error(), "bob@example.com")
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Same(t, err, redact.Error(err))
+	assert.NoError(t, redact.Error(nil))
+}
+
+func TestCore(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(obs, zap.WrapCore(redact.Core)).With(zap.String("user", "ann@example.com"))
+
+	logger.Debug("failed for 123-45-6789", zap.Error(errors.New("provider echoed ann@example.com")), zap.Int("row", 4))
+
+	entries := logs.AllUntimed()
+	if assert.Len(t, entries, 1) {
+		e := entries[0]
+		assert.Equal(t, "failed for "+redact.Hash("ssn", "123-45-6789"), e.Message)
+		fields := e.ContextMap()
+		assert.Equal(t, redact.Hash("email", "ann@example.com"), fields["user"])
+		assert.Equal(t, "provider echoed "+redact.Hash("email", "ann@example.com"), fields["error"])
+		assert.Equal(t, int64(4), fields["row"])
+	}
+}
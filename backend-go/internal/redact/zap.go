@@ -0,0 +1,60 @@
+package redact
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Core wraps a zap core so that the message, string fields and errors of
+// every entry are masked by String before they are written. Use it with
+// zap.WrapCore.
+func Core(c zapcore.Core) zapcore.Core {
+	return &core{Core: c}
+}
+
+type core struct {
+	zapcore.Core
+}
+
+func (c *core) With(fields []zapcore.Field) zapcore.Core {
+	return &core{Core: c.Core.With(Fields(fields))}
+}
+
+// Check adds this core rather than the wrapped one, so Write sees the entry
+func (c *core) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *core) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	e.Message = String(e.Message)
+	return c.Core.Write(e, Fields(fields))
+}
+
+// Fields masks string, byte string, stringer and error fields
+func Fields(fields []zapcore.Field) []zapcore.Field {
+	out := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		switch f.Type {
+		case zapcore.StringType:
+			f.String = String(f.String)
+		case zapcore.ByteStringType:
+			if b, ok := f.Interface.([]byte); ok {
+				f.Interface = []byte(String(string(b)))
+			}
+		case zapcore.StringerType:
+			if s, ok := f.Interface.(fmt.Stringer); ok {
+				f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: String(s.String())}
+			}
+		case zapcore.ErrorType:
+			if err, ok := f.Interface.(error); ok && err != nil {
+				f = zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: String(err.Error())}
+			}
+		}
+		out[i] = f
+	}
+	return out
+}
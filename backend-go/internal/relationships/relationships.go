@@ -0,0 +1,392 @@
+// Package relationships discovers correlations and functional dependencies
+// between dataset columns. Discovered relationships are offered to users as
+// hints; accepted ones are passed to generation, enforced on generated rows
+// where a row-level check exists, and verified on the finished output.
+package relationships
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+)
+
+// Relationship kinds
+const (
+	KindPearson              = "pearson"
+	KindSpearman             = "spearman"
+	KindCramersV             = "cramers_v"
+	KindFunctionalDependency = "functional_dependency"
+)
+
+const (
+	// MinRows is the fewest rows relationships are discovered or verified on
+	MinRows = 10
+	// MaxColumns caps the columns compared pairwise
+	MaxColumns = 50
+	// MaxCategories is the most distinct values a categorical column may
+	// have to be compared with Cramér's V
+	MaxCategories = 50
+	// CorrelationThreshold and AssociationThreshold are the weakest
+	// correlation and association reported as hints
+	CorrelationThreshold = 0.5
+	AssociationThreshold = 0.3
+	// Tolerance is how far a generated correlation may drift from the
+	// accepted one
+	Tolerance = 0.2
+)
+
+// Discover finds relationships between the columns of sampled rows. Numeric
+// pairs are measured with Pearson, or Spearman when the relation is
+// monotonic rather than linear; categorical pairs with Cramér's V. A
+// functional dependency is reported when every value of the source column
+// maps to a single target value and the source is not itself a key.
+func Discover(columns []string, rows []map[string]interface{}) []agents.Relationship {
+	if len(rows) < MinRows {
+		return nil
+	}
+	if len(columns) > MaxColumns {
+		columns = columns[:MaxColumns]
+	}
+	numeric := make(map[string][]float64)
+	values := make(map[string][]string)
+	for _, col := range columns {
+		vals := make([]string, len(rows))
+		nums := make([]float64, 0, len(rows))
+		isNumeric := true
+		for i, row := range rows {
+			vals[i] = text(row[col])
+			if n, ok := number(row[col]); ok && isNumeric {
+				nums = append(nums, n)
+			} else {
+				isNumeric = false
+			}
+		}
+		values[col] = vals
+		if isNumeric {
+			numeric[col] = nums
+		}
+	}
+
+	var out []agents.Relationship
+	for i, a := range columns {
+		for _, b := range columns[i+1:] {
+			xa, aNum := numeric[a]
+			xb, bNum := numeric[b]
+			switch {
+			case aNum && bNum:
+				r, rho := Pearson(xa, xb), Spearman(xa, xb)
+				if math.Abs(r) >= CorrelationThreshold && math.Abs(r) >= math.Abs(rho)-0.1 {
+					out = append(out, agents.Relationship{Kind: KindPearson, Source: a, Target: b, Strength: round(r)})
+				} else if math.Abs(rho) >= CorrelationThreshold {
+					out = append(out, agents.Relationship{Kind: KindSpearman, Source: a, Target: b, Strength: round(rho)})
+				}
+			case !aNum && !bNum:
+				if v, ok := CramersV(values[a], values[b]); ok && v >= AssociationThreshold {
+					out = append(out, agents.Relationship{Kind: KindCramersV, Source: a, Target: b, Strength: round(v)})
+				}
+			}
+		}
+	}
+	for _, a := range columns {
+		for _, b := range columns {
+			if a != b && determines(values[a], values[b]) {
+				out = append(out, agents.Relationship{Kind: KindFunctionalDependency, Source: a, Target: b, Strength: 1})
+			}
+		}
+	}
+	return out
+}
+
+// determines reports a non-trivial functional dependency a -> b: blanks in
+// a are ignored, a repeats, and both sides vary
+func determines(a, b []string) bool {
+	mapping := make(map[string]string)
+	targets := make(map[string]bool)
+	n := 0
+	for i, v := range a {
+		if v == "" {
+			continue
+		}
+		n++
+		if t, ok := mapping[v]; ok && t != b[i] {
+			return false
+		}
+		mapping[v] = b[i]
+		targets[b[i]] = true
+	}
+	return n >= MinRows && len(mapping) > 1 && len(mapping) < n && len(targets) > 1
+}
+
+// Pearson returns the linear correlation of two equally long series; a
+// constant series has no correlation
+func Pearson(x, y []float64) float64 {
+	n := float64(len(x))
+	if len(x) == 0 || len(x) != len(y) {
+		return 0
+	}
+	var sx, sy float64
+	for i := range x {
+		sx += x[i]
+		sy += y[i]
+	}
+	mx, my := sx/n, sy/n
+	var cov, vx, vy float64
+	for i := range x {
+		dx, dy := x[i]-mx, y[i]-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return 0
+	}
+	return cov / math.Sqrt(vx*vy)
+}
+
+// Spearman returns the rank correlation of two series, ties sharing their
+// average rank
+func Spearman(x, y []float64) float64 {
+	return Pearson(ranks(x), ranks(y))
+}
+
+func ranks(x []float64) []float64 {
+	idx := make([]int, len(x))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return x[idx[i]] < x[idx[j]] })
+	out := make([]float64, len(x))
+	for i := 0; i < len(idx); {
+		j := i
+		for j+1 < len(idx) && x[idx[j+1]] == x[idx[i]] {
+			j++
+		}
+		avg := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			out[idx[k]] = avg
+		}
+		i = j + 1
+	}
+	return out
+}
+
+// CramersV returns the association of two categorical series; ok is false
+// when either has a single category or too many to compare
+func CramersV(a, b []string) (float64, bool) {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0, false
+	}
+	rowTotals, colTotals := map[string]float64{}, map[string]float64{}
+	cells := map[[2]string]float64{}
+	for i := range a {
+		rowTotals[a[i]]++
+		colTotals[b[i]]++
+		cells[[2]string{a[i], b[i]}]++
+	}
+	r, k := len(rowTotals), len(colTotals)
+	if r < 2 || k < 2 || r > MaxCategories || k > MaxCategories {
+		return 0, false
+	}
+	n := float64(len(a))
+	var chi2 float64
+	for av, rt := range rowTotals {
+		for bv, ct := range colTotals {
+			expected := rt * ct / n
+			d := cells[[2]string{av, bv}] - expected
+			chi2 += d * d / expected
+		}
+	}
+	return math.Sqrt(chi2 / (n * float64(min(r, k)-1))), true
+}
+
+// Apply adds accepted relationships to a generation request, as checks on
+// the output and as rules in the prompt
+func Apply(req *agents.GenerationRequest, rels []agents.Relationship) {
+	for _, rel := range rels {
+		req.SchemaAnalysis.Relationships = append(req.SchemaAnalysis.Relationships, rel)
+		switch rel.Kind {
+		case KindFunctionalDependency:
+			req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints,
+				fmt.Sprintf("%s determines %s: rows with the same %s must have the same %s", rel.Source, rel.Target, rel.Source, rel.Target))
+		default:
+			if req.SchemaAnalysis.Correlations == nil {
+				req.SchemaAnalysis.Correlations = make(map[string]float64)
+			}
+			req.SchemaAnalysis.Correlations[rel.Source+":"+rel.Target] = rel.Strength
+			req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints,
+				fmt.Sprintf("%s and %s: preserve a %s of %.2f", rel.Source, rel.Target, strings.ReplaceAll(rel.Kind, "_", " "), rel.Strength))
+		}
+	}
+}
+
+// Enforcer drops generated rows that break an accepted functional
+// dependency with the rows kept before them
+type Enforcer struct {
+	deps    []agents.Relationship
+	mapping []map[string]string
+}
+
+// NewEnforcer returns nil when there are no functional dependencies
+func NewEnforcer(rels []agents.Relationship) *Enforcer {
+	e := &Enforcer{}
+	for _, rel := range rels {
+		if rel.Kind == KindFunctionalDependency {
+			e.deps = append(e.deps, rel)
+			e.mapping = append(e.mapping, make(map[string]string))
+		}
+	}
+	if len(e.deps) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Filter returns the rows consistent with every dependency
+func (e *Enforcer) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if e == nil {
+		return rows
+	}
+	kept := rows[:0:0]
+rows:
+	for _, row := range rows {
+		for i, dep := range e.deps {
+			src := text(row[dep.Source])
+			if t, ok := e.mapping[i][src]; ok && src != "" && t != text(row[dep.Target]) {
+				continue rows
+			}
+		}
+		for i, dep := range e.deps {
+			if src := text(row[dep.Source]); src != "" {
+				e.mapping[i][src] = text(row[dep.Target])
+			}
+		}
+		kept = append(kept, row)
+	}
+	return kept
+}
+
+// VerificationError lists the relationships generated rows did not preserve
+type VerificationError struct {
+	Failed []string
+}
+
+func (e *VerificationError) Error() string {
+	return "relationships not preserved: " + strings.Join(e.Failed, "; ")
+}
+
+// Verify measures accepted relationships on generated rows. Correlations
+// must keep their sign and stay within Tolerance; associations may not
+// weaken by more than Tolerance; dependencies must hold on every row.
+// Outputs too small to measure are not verified.
+func Verify(rows []map[string]interface{}, rels []agents.Relationship) error {
+	if len(rows) < MinRows {
+		return nil
+	}
+	var failed []string
+	for _, rel := range rels {
+		a, b := column(rows, rel.Source), column(rows, rel.Target)
+		var got float64
+		ok := true
+		switch rel.Kind {
+		case KindPearson, KindSpearman:
+			x, xok := numbers(a)
+			y, yok := numbers(b)
+			if !xok || !yok {
+				ok = false
+				break
+			}
+			if rel.Kind == KindPearson {
+				got = Pearson(x, y)
+			} else {
+				got = Spearman(x, y)
+			}
+			ok = math.Abs(got-rel.Strength) <= Tolerance && (got >= 0) == (rel.Strength >= 0)
+		case KindCramersV:
+			got, ok = CramersV(a, b)
+			ok = ok && got >= rel.Strength-Tolerance
+		case KindFunctionalDependency:
+			ok = consistent(a, b)
+			if ok {
+				got = 1
+			}
+		default:
+			continue
+		}
+		if !ok {
+			failed = append(failed, fmt.Sprintf("%s %s~%s %.2f (accepted %.2f)", rel.Kind, rel.Source, rel.Target, got, rel.Strength))
+		}
+	}
+	if len(failed) > 0 {
+		return &VerificationError{Failed: failed}
+	}
+	return nil
+}
+
+func consistent(a, b []string) bool {
+	mapping := make(map[string]string)
+	for i, v := range a {
+		if v == "" {
+			continue
+		}
+		if t, ok := mapping[v]; ok && t != b[i] {
+			return false
+		}
+		mapping[v] = b[i]
+	}
+	return true
+}
+
+func column(rows []map[string]interface{}, name string) []string {
+	out := make([]string, len(rows))
+	for i, row := range rows {
+		out[i] = text(row[name])
+	}
+	return out
+}
+
+func numbers(vals []string) ([]float64, bool) {
+	out := make([]float64, len(vals))
+	for i, v := range vals {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, false
+		}
+		out[i] = n
+	}
+	return out, true
+}
+
+func text(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, true
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,96 @@
+// Package relationships_test provides unit tests for relationship discovery
+package relationships_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/relationships"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoefficients(t *testing.T) {
+	x := []float64{1, 2, 3, 4, 5}
+	assert.InDelta(t, 1, relationships.Pearson(x, []float64{2, 4, 6, 8, 10}), 1e-9)
+	assert.InDelta(t, -1, relationships.Pearson(x, []float64{5, 4, 3, 2, 1}), 1e-9)
+	assert.Zero(t, relationships.Pearson(x, []float64{3, 3, 3, 3, 3}))
+	assert.InDelta(t, 1, relationships.Spearman(x, []float64{1, 8, 27, 64, 125}), 1e-9)
+
+	v, ok := relationships.CramersV([]string{"a", "a", "b", "b"}, []string{"x", "x", "y", "y"})
+	require.True(t, ok)
+	assert.InDelta(t, 1, v, 1e-9)
+	_, ok = relationships.CramersV([]string{"a", "a"}, []string{"x", "y"})
+	assert.False(t, ok, "a single category has no association")
+}
+
+func sample() []map[string]interface{} {
+	var rows []map[string]interface{}
+	for i := 0; i < 20; i++ {
+		city, country := "Oslo", "NO"
+		if i%2 == 1 {
+			city, country = "Lyon", "FR"
+		}
+		if i%4 == 3 {
+			city = "Paris"
+		}
+		rows = append(rows, map[string]interface{}{
+			"id":      fmt.Sprint(i),
+			"age":     fmt.Sprint(20 + i),
+			"income":  fmt.Sprint(1000 + 50*i + (i%3)*10),
+			"city":    city,
+			"country": country,
+		})
+	}
+	return rows
+}
+
+func TestDiscover(t *testing.T) {
+	found := relationships.Discover([]string{"id", "age", "income", "city", "country"}, sample())
+	has := func(kind, src, dst string) bool {
+		for _, r := range found {
+			if r.Kind == kind && r.Source == src && r.Target == dst {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, has(relationships.KindPearson, "age", "income"))
+	assert.True(t, has(relationships.KindFunctionalDependency, "city", "country"))
+	assert.False(t, has(relationships.KindFunctionalDependency, "country", "city"))
+	assert.False(t, has(relationships.KindFunctionalDependency, "id", "age"), "keys determine everything trivially")
+	assert.True(t, has(relationships.KindCramersV, "city", "country"))
+
+	assert.Nil(t, relationships.Discover([]string{"a"}, sample()[:3]))
+}
+
+func TestEnforceAndVerify(t *testing.T) {
+	rels := []agents.Relationship{
+		{Kind: relationships.KindFunctionalDependency, Source: "city", Target: "country", Strength: 1},
+		{Kind: relationships.KindPearson, Source: "age", Target: "income", Strength: 0.99},
+	}
+	req := &agents.GenerationRequest{}
+	relationships.Apply(req, rels)
+	assert.Len(t, req.SchemaAnalysis.Constraints, 2)
+	assert.Equal(t, 0.99, req.SchemaAnalysis.Correlations["age:income"])
+
+	e := relationships.NewEnforcer(rels)
+	kept := e.Filter([]map[string]interface{}{
+		{"city": "Oslo", "country": "NO"},
+		{"city": "Oslo", "country": "SE"},
+	})
+	assert.Len(t, kept, 1)
+	assert.Len(t, e.Filter([]map[string]interface{}{{"city": "Oslo", "country": "DK"}}), 0, "dependencies hold across batches")
+
+	rows := sample()
+	assert.NoError(t, relationships.Verify(rows, rels))
+
+	for i, row := range rows {
+		row["income"] = fmt.Sprint(1000 - 50*i)
+	}
+	var verr *relationships.VerificationError
+	require.ErrorAs(t, relationships.Verify(rows, rels), &verr)
+	assert.Len(t, verr.Failed, 1)
+	assert.NoError(t, relationships.Verify(rows[:5], rels), "outputs below MinRows are not verified")
+}
@@ -0,0 +1,240 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// AccountRepo stores email changes and account merges
+type AccountRepo struct{ db *sqlx.DB }
+
+func NewAccountRepo(db *sqlx.DB) *AccountRepo { return &AccountRepo{db: db} }
+
+func (r *AccountRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS email_changes (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        old_email TEXT NOT NULL,
+        new_email TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        token_hash TEXT NOT NULL UNIQUE,
+        cancel_hash TEXT NOT NULL UNIQUE,
+        expires_at TIMESTAMPTZ NOT NULL,
+        verified_at TIMESTAMPTZ NULL,
+        effective_at TIMESTAMPTZ NULL,
+        applied_at TIMESTAMPTZ NULL,
+        cancelled_at TIMESTAMPTZ NULL,
+        cancel_reason TEXT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_email_changes_user ON email_changes(user_id, created_at DESC);
+    CREATE INDEX IF NOT EXISTS idx_email_changes_due ON email_changes(effective_at) WHERE status='held';
+    CREATE TABLE IF NOT EXISTS account_merges (
+        id BIGSERIAL PRIMARY KEY,
+        target_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        source_user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        source_email TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        token_hash TEXT NOT NULL UNIQUE,
+        expires_at TIMESTAMPTZ NOT NULL,
+        transferred TEXT NULL,
+        completed_at TIMESTAMPTZ NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_account_merges_target ON account_merges(target_user_id, created_at DESC)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("account create schema", err)
+}
+
+const emailChangeColumns = `id, user_id, old_email, new_email, status, token_hash, cancel_hash, expires_at, verified_at, effective_at, applied_at, cancelled_at, cancel_reason, created_at`
+
+const accountMergeColumns = `id, target_user_id, source_user_id, source_email, status, token_hash, expires_at, transferred, completed_at, created_at`
+
+// CreateEmailChange starts an email change; an open change of the same user
+// is cancelled as superseded
+func (r *AccountRepo) CreateEmailChange(ctx context.Context, c *models.EmailChange) (*models.EmailChange, error) {
+	var out models.EmailChange
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE email_changes SET status='cancelled', cancelled_at=NOW(), cancel_reason='superseded'
+              WHERE user_id=$1 AND status IN ('pending','held')`, c.UserID); err != nil {
+			return err
+		}
+		q := `INSERT INTO email_changes (user_id, old_email, new_email, token_hash, cancel_hash, expires_at)
+              VALUES ($1,$2,$3,$4,$5,$6)
+              RETURNING ` + emailChangeColumns
+		return conn(ctx, r.db).QueryRowxContext(ctx, q, c.UserID, c.OldEmail, c.NewEmail, c.TokenHash, c.CancelHash, c.ExpiresAt).StructScan(&out)
+	})
+	if err != nil {
+		return nil, wrap("account create email change", err)
+	}
+	return &out, nil
+}
+
+// OpenEmailChange returns a user's pending or held email change
+func (r *AccountRepo) OpenEmailChange(ctx context.Context, userID int64) (*models.EmailChange, error) {
+	var out models.EmailChange
+	q := `SELECT ` + emailChangeColumns + ` FROM email_changes
+          WHERE user_id=$1 AND status IN ('pending','held')
+          ORDER BY created_at DESC, id DESC LIMIT 1`
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, userID); err != nil {
+		return nil, wrap("account open email change", err)
+	}
+	return &out, nil
+}
+
+// VerifyEmailChange holds the unexpired pending change a verification token
+// belongs to for hold; it returns sql.ErrNoRows when there is none
+func (r *AccountRepo) VerifyEmailChange(ctx context.Context, tokenHash string, hold time.Duration) (*models.EmailChange, error) {
+	q := `UPDATE email_changes SET status='held', verified_at=NOW(), effective_at=NOW() + make_interval(secs => $2)
+          WHERE token_hash=$1 AND status='pending' AND expires_at > NOW()
+          RETURNING ` + emailChangeColumns
+	var out models.EmailChange
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, tokenHash, hold.Seconds()).StructScan(&out); err != nil {
+		return nil, wrap("account verify email change", err)
+	}
+	return &out, nil
+}
+
+// CancelEmailChange cancels a user's open email change; it returns
+// sql.ErrNoRows when there is none
+func (r *AccountRepo) CancelEmailChange(ctx context.Context, userID int64, reason string) (*models.EmailChange, error) {
+	q := `UPDATE email_changes SET status='cancelled', cancelled_at=NOW(), cancel_reason=$2
+          WHERE user_id=$1 AND status IN ('pending','held')
+          RETURNING ` + emailChangeColumns
+	var out models.EmailChange
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, userID, reason).StructScan(&out); err != nil {
+		return nil, wrap("account cancel email change", err)
+	}
+	return &out, nil
+}
+
+// CancelEmailChangeByToken cancels the open email change a cancel token
+// sent to the old address belongs to
+func (r *AccountRepo) CancelEmailChangeByToken(ctx context.Context, cancelHash, reason string) (*models.EmailChange, error) {
+	q := `UPDATE email_changes SET status='cancelled', cancelled_at=NOW(), cancel_reason=$2
+          WHERE cancel_hash=$1 AND status IN ('pending','held')
+          RETURNING ` + emailChangeColumns
+	var out models.EmailChange
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, cancelHash, reason).StructScan(&out); err != nil {
+		return nil, wrap("account cancel email change by token", err)
+	}
+	return &out, nil
+}
+
+// DueEmailChanges returns up to limit held changes whose hold has ended
+func (r *AccountRepo) DueEmailChanges(ctx context.Context, limit int) ([]models.EmailChange, error) {
+	q := `SELECT ` + emailChangeColumns + ` FROM email_changes
+          WHERE status='held' AND effective_at <= NOW()
+          ORDER BY effective_at LIMIT $1`
+	var out []models.EmailChange
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, limit)
+	return out, wrap("account due email changes", err)
+}
+
+// ApplyEmailChange moves the account of a held change to its new address.
+// When another account took the address during the hold the change is
+// cancelled instead. It returns sql.ErrNoRows when the change is no longer
+// held.
+func (r *AccountRepo) ApplyEmailChange(ctx context.Context, id int64) (*models.EmailChange, error) {
+	var out models.EmailChange
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		db := conn(ctx, r.db)
+		var c models.EmailChange
+		q := `SELECT ` + emailChangeColumns + ` FROM email_changes WHERE id=$1 AND status='held' FOR UPDATE`
+		if err := db.GetContext(ctx, &c, q, id); err != nil {
+			return err
+		}
+		res, err := db.ExecContext(ctx, `UPDATE users SET email=$1, updated_at=NOW()
+          WHERE id=$2 AND NOT EXISTS (SELECT 1 FROM users WHERE email=$1)`, c.NewEmail, c.UserID)
+		if err != nil {
+			return err
+		}
+		q = `UPDATE email_changes SET status='applied', applied_at=NOW() WHERE id=$1 RETURNING ` + emailChangeColumns
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			q = `UPDATE email_changes SET status='cancelled', cancelled_at=NOW(), cancel_reason='email_unavailable'
+              WHERE id=$1 RETURNING ` + emailChangeColumns
+		}
+		return db.QueryRowxContext(ctx, q, id).StructScan(&out)
+	})
+	if err != nil {
+		return nil, wrap("account apply email change", err)
+	}
+	return &out, nil
+}
+
+// CreateMerge records a merge awaiting approval from the source account
+func (r *AccountRepo) CreateMerge(ctx context.Context, m *models.AccountMerge) (*models.AccountMerge, error) {
+	q := `INSERT INTO account_merges (target_user_id, source_user_id, source_email, token_hash, expires_at)
+          VALUES ($1,$2,$3,$4,$5)
+          RETURNING ` + accountMergeColumns
+	var out models.AccountMerge
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, m.TargetUserID, m.SourceUserID, m.SourceEmail, m.TokenHash, m.ExpiresAt).StructScan(&out); err != nil {
+		return nil, wrap("account create merge", err)
+	}
+	return &out, nil
+}
+
+// accountTransfers hand what one account owns to another. Each statement
+// takes the source user as $1 and the target as $2.
+var accountTransfers = []struct{ name, stmt string }{
+	{"datasets", `UPDATE datasets SET owner_id=$2, updated_at=NOW() WHERE owner_id=$1`},
+	{"generation_jobs", `UPDATE generation_jobs SET user_id=$2 WHERE user_id=$1`},
+	{"api_keys", `UPDATE api_keys SET user_id=$2 WHERE user_id=$1`},
+	{"custom_models", `UPDATE custom_models SET owner_id=$2, updated_at=NOW() WHERE owner_id=$1`},
+	{"user_subscriptions", `UPDATE user_subscriptions SET user_id=$2, updated_at=NOW() WHERE user_id=$1`},
+	{"billing_credits", `UPDATE billing_credits SET user_id=$2 WHERE user_id=$1`},
+	{"webhook_endpoints", `UPDATE webhook_endpoints SET user_id=$2, updated_at=NOW() WHERE user_id=$1`},
+	{"privacy_budget_ledger", `UPDATE privacy_budget_ledger SET user_id=$2 WHERE user_id=$1`},
+	// Budgets are per dataset and user, so spending on a dataset both
+	// accounts used adds up rather than moving over
+	{"privacy_budgets", `WITH moved AS (DELETE FROM privacy_budgets WHERE user_id=$1 RETURNING dataset_id, spent_epsilon, spent_delta)
+        INSERT INTO privacy_budgets (dataset_id, user_id, spent_epsilon, spent_delta)
+        SELECT dataset_id, $2, spent_epsilon, spent_delta FROM moved
+        ON CONFLICT (dataset_id, user_id) DO UPDATE SET
+            spent_epsilon = privacy_budgets.spent_epsilon + EXCLUDED.spent_epsilon,
+            spent_delta = privacy_budgets.spent_delta + EXCLUDED.spent_delta,
+            updated_at = NOW()`},
+}
+
+// CompleteMerge approves the unexpired pending merge into targetID a token
+// belongs to: everything the source account owns moves to the target, the
+// source is deactivated and the merge records how many rows each table
+// handed over. It returns sql.ErrNoRows when there is no such merge or the
+// source has been deactivated since.
+func (r *AccountRepo) CompleteMerge(ctx context.Context, targetID int64, tokenHash string) (*models.AccountMerge, error) {
+	var out models.AccountMerge
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		db := conn(ctx, r.db)
+		var m models.AccountMerge
+		q := `SELECT ` + accountMergeColumns + ` FROM account_merges
+              WHERE token_hash=$1 AND target_user_id=$2 AND status='pending' AND expires_at > NOW()
+                AND EXISTS (SELECT 1 FROM users WHERE id=source_user_id AND is_active)
+              FOR UPDATE`
+		if err := db.GetContext(ctx, &m, q, tokenHash, targetID); err != nil {
+			return err
+		}
+		transferred := models.AccountTransfers{}
+		for _, t := range accountTransfers {
+			res, err := db.ExecContext(ctx, t.stmt, m.SourceUserID, m.TargetUserID)
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err == nil && n > 0 {
+				transferred[t.name] = n
+			}
+		}
+		if _, err := db.ExecContext(ctx, `UPDATE users SET is_active=false, updated_at=NOW() WHERE id=$1`, m.SourceUserID); err != nil {
+			return err
+		}
+		q = `UPDATE account_merges SET status='completed', completed_at=NOW(), transferred=$2
+             WHERE id=$1 RETURNING ` + accountMergeColumns
+		return db.QueryRowxContext(ctx, q, m.ID, transferred).StructScan(&out)
+	})
+	if err != nil {
+		return nil, wrap("account complete merge", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,86 @@
+// Package repo_test provides unit tests for email changes and account merges
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var accountMergeCols = []string{"id", "target_user_id", "source_user_id", "source_email", "status", "token_hash", "expires_at", "transferred", "completed_at", "created_at"}
+
+var emailChangeCols = []string{"id", "user_id", "old_email", "new_email", "status", "token_hash", "cancel_hash", "expires_at", "verified_at", "effective_at", "applied_at", "cancelled_at", "cancel_reason", "created_at"}
+
+func TestAccountRepo_CompleteMerge(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	accounts := repo.NewAccountRepo(testDB.DB)
+	now := time.Now()
+
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectQuery("SELECT (.+) FROM account_merges").WithArgs("hash", int64(1)).
+		WillReturnRows(sqlmock.NewRows(accountMergeCols).AddRow(9, 1, 2, "ada@sso.example.com", "pending", "hash", now.Add(time.Hour), nil, nil, now))
+	moved := map[string]int64{"datasets": 3, "generation_jobs": 5, "api_keys": 1, "billing_credits": 2}
+	for _, table := range []string{"datasets", "generation_jobs", "api_keys", "custom_models", "user_subscriptions",
+		"billing_credits", "webhook_endpoints", "privacy_budget_ledger"} {
+		testDB.Mock.ExpectExec("UPDATE "+table+" SET").WithArgs(int64(2), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, moved[table]))
+	}
+	testDB.Mock.ExpectExec("DELETE FROM privacy_budgets").WithArgs(int64(2), int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+	testDB.Mock.ExpectExec("UPDATE users SET is_active=false").WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	transferred := `{"api_keys":1,"billing_credits":2,"datasets":3,"generation_jobs":5}`
+	testDB.Mock.ExpectQuery("UPDATE account_merges SET status='completed'").WithArgs(int64(9), transferred).
+		WillReturnRows(sqlmock.NewRows(accountMergeCols).AddRow(9, 1, 2, "ada@sso.example.com", "completed", "hash", now.Add(time.Hour), transferred, now, now))
+	testDB.Mock.ExpectCommit()
+
+	merge, err := accounts.CompleteMerge(context.Background(), 1, "hash")
+	require.NoError(t, err)
+	assert.Equal(t, models.AccountMergeCompleted, merge.Status)
+	assert.Equal(t, models.AccountTransfers{"datasets": 3, "generation_jobs": 5, "api_keys": 1, "billing_credits": 2}, merge.Transferred)
+	testDB.AssertExpectations(t)
+}
+
+func TestAccountRepo_CompleteMergeUnknownToken(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	accounts := repo.NewAccountRepo(testDB.DB)
+
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectQuery("SELECT (.+) FROM account_merges").WillReturnRows(sqlmock.NewRows(accountMergeCols))
+	testDB.Mock.ExpectRollback()
+
+	_, err := accounts.CompleteMerge(context.Background(), 1, "stale")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	testDB.AssertExpectations(t)
+}
+
+func TestAccountRepo_ApplyEmailChangeTakenAddress(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	accounts := repo.NewAccountRepo(testDB.DB)
+	now := time.Now()
+
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectQuery("SELECT (.+) FROM email_changes").WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows(emailChangeCols).AddRow(4, 1, "ada@example.com", "ada@newco.io", "held", "t", "c", now, now, now, nil, nil, nil, now))
+	// Another account signed up with the address during the hold
+	testDB.Mock.ExpectExec("UPDATE users SET email").WithArgs("ada@newco.io", int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+	testDB.Mock.ExpectQuery("UPDATE email_changes SET status='cancelled'").WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows(emailChangeCols).AddRow(4, 1, "ada@example.com", "ada@newco.io", "cancelled", "t", "c", now, now, now, nil, now, "email_unavailable", now))
+	testDB.Mock.ExpectCommit()
+
+	change, err := accounts.ApplyEmailChange(context.Background(), 4)
+	require.NoError(t, err)
+	assert.Equal(t, models.EmailChangeCancelled, change.Status)
+	require.NotNil(t, change.CancelReason)
+	assert.Equal(t, "email_unavailable", *change.CancelReason)
+	testDB.AssertExpectations(t)
+}
@@ -2,10 +2,12 @@ package repo
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 // UserUsageRepo handles user usage tracking
@@ -29,14 +31,14 @@ func (r *UserUsageRepo) CreateSchema(ctx context.Context) error {
         updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
         UNIQUE(user_id, month, year)
     )`
-	_, err := r.db.ExecContext(ctx, stmt)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("user usage create schema", err)
 }
 
 func (r *UserUsageRepo) GetOrCreate(ctx context.Context, userID int64, month, year int) (*models.UserUsage, error) {
 	query := `SELECT * FROM user_usage WHERE user_id = $1 AND month = $2 AND year = $3`
 	var usage models.UserUsage
-	err := r.db.GetContext(ctx, &usage, query, userID, month, year)
+	err := conn(ctx, r.db).GetContext(ctx, &usage, query, userID, month, year)
 	if err == nil {
 		return &usage, nil
 	}
@@ -52,8 +54,8 @@ func (r *UserUsageRepo) GetOrCreate(ctx context.Context, userID int64, month, ye
 		RETURNING id, user_id, month, year, rows_generated, datasets_created, custom_models_created, 
 		api_requests, storage_used_bytes, processing_time_seconds, created_at, updated_at`
 
-	err = r.db.GetContext(ctx, &usage, insertQuery, userID, month, year)
-	return &usage, err
+	err = conn(ctx, r.db).GetContext(ctx, &usage, insertQuery, userID, month, year)
+	return &usage, wrap("user usage get or create", err)
 }
 
 func (r *UserUsageRepo) IncrementRowsGenerated(ctx context.Context, userID int64, rows int64) error {
@@ -66,8 +68,8 @@ func (r *UserUsageRepo) IncrementRowsGenerated(ctx context.Context, userID int64
 		ON CONFLICT (user_id, month, year) 
 		DO UPDATE SET rows_generated = user_usage.rows_generated + $4, updated_at = NOW()`
 
-	_, err := r.db.ExecContext(ctx, query, userID, month, year, rows)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, month, year, rows)
+	return wrap("user usage increment rows generated", err)
 }
 
 // UserSubscriptionRepo handles user subscriptions
@@ -88,29 +90,52 @@ func (r *UserSubscriptionRepo) CreateSchema(ctx context.Context) error {
         cancel_at_period_end BOOLEAN NOT NULL DEFAULT FALSE,
         created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
         updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-    )`
-	_, err := r.db.ExecContext(ctx, stmt)
-	return err
+    );
+    ALTER TABLE user_subscriptions ADD COLUMN IF NOT EXISTS monthly_amount NUMERIC(12,2) NOT NULL DEFAULT 0;
+    CREATE INDEX IF NOT EXISTS idx_user_subscriptions_user_created ON user_subscriptions(user_id, created_at)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("user subscription create schema", err)
 }
 
 func (r *UserSubscriptionRepo) Insert(ctx context.Context, sub *models.UserSubscription) (*models.UserSubscription, error) {
 	query := `INSERT INTO user_subscriptions (user_id, subscription_tier, status, provider, provider_id, 
-		current_period_start, current_period_end, cancel_at_period_end)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		current_period_start, current_period_end, cancel_at_period_end, monthly_amount)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, user_id, subscription_tier, status, provider, provider_id, 
-		current_period_start, current_period_end, cancel_at_period_end, created_at, updated_at`
+		current_period_start, current_period_end, cancel_at_period_end, monthly_amount, created_at, updated_at`
 
 	var result models.UserSubscription
-	err := r.db.GetContext(ctx, &result, query, sub.UserID, sub.SubscriptionTier, sub.Status,
-		sub.Provider, sub.ProviderID, sub.CurrentPeriodStart, sub.CurrentPeriodEnd, sub.CancelAtPeriodEnd)
-	return &result, err
+	err := conn(ctx, r.db).GetContext(ctx, &result, query, sub.UserID, sub.SubscriptionTier, sub.Status,
+		sub.Provider, sub.ProviderID, sub.CurrentPeriodStart, sub.CurrentPeriodEnd, sub.CancelAtPeriodEnd, sub.MonthlyAmount)
+	return &result, wrap("user subscription insert", err)
+}
+
+// ListCurrent returns each user's latest subscription record as of the given time
+func (r *UserSubscriptionRepo) ListCurrent(ctx context.Context, at time.Time) ([]models.UserSubscription, error) {
+	query := `SELECT DISTINCT ON (user_id) id, user_id, subscription_tier, status, provider, provider_id,
+		current_period_start, current_period_end, cancel_at_period_end, monthly_amount, created_at, updated_at
+		FROM user_subscriptions WHERE created_at < $1 ORDER BY user_id, created_at DESC`
+	var out []models.UserSubscription
+	err := conn(ctx, r.db).SelectContext(ctx, &out, query, at)
+	return out, wrap("user subscription list current", err)
+}
+
+// ListHistory returns every subscription change recorded before the given
+// time, ordered by user and then by time
+func (r *UserSubscriptionRepo) ListHistory(ctx context.Context, before time.Time) ([]models.UserSubscription, error) {
+	query := `SELECT id, user_id, subscription_tier, status, provider, provider_id,
+		current_period_start, current_period_end, cancel_at_period_end, monthly_amount, created_at, updated_at
+		FROM user_subscriptions WHERE created_at < $1 ORDER BY user_id, created_at`
+	var out []models.UserSubscription
+	err := conn(ctx, r.db).SelectContext(ctx, &out, query, before)
+	return out, wrap("user subscription list history", err)
 }
 
 func (r *UserSubscriptionRepo) GetByUserID(ctx context.Context, userID int64) (*models.UserSubscription, error) {
 	query := `SELECT * FROM user_subscriptions WHERE user_id = $1 ORDER BY created_at DESC LIMIT 1`
 	var sub models.UserSubscription
-	err := r.db.GetContext(ctx, &sub, query, userID)
-	return &sub, err
+	err := conn(ctx, r.db).GetContext(ctx, &sub, query, userID)
+	return &sub, wrap("user subscription get by user id", err)
 }
 
 // APIKeyRepo handles API key management
@@ -128,45 +153,149 @@ func (r *APIKeyRepo) CreateSchema(ctx context.Context) error {
         is_active BOOLEAN NOT NULL DEFAULT TRUE,
         created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
         expires_at TIMESTAMPTZ NULL
-    )`
-	_, err := r.db.ExecContext(ctx, stmt)
-	return err
+    );
+    ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT '{}';
+    ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotation_days INT NULL;
+    ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS overlap_hours INT NOT NULL DEFAULT 0;
+    ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotation_due_at TIMESTAMPTZ NULL;
+    ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotation_reminded_at TIMESTAMPTZ NULL;
+    ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotation_enforced_at TIMESTAMPTZ NULL;
+    ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotated_from BIGINT NULL;
+    ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotated_to BIGINT NULL;
+    ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMPTZ NULL;
+    ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS rotation_acknowledged_at TIMESTAMPTZ NULL;
+    CREATE INDEX IF NOT EXISTS idx_api_keys_rotation_due ON api_keys(rotation_due_at) WHERE is_active AND rotated_to IS NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("api key create schema", err)
 }
 
 func (r *APIKeyRepo) Insert(ctx context.Context, key *models.APIKey) (*models.APIKey, error) {
-	query := `INSERT INTO api_keys (user_id, name, key_hash, is_active, expires_at)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id, user_id, name, key_hash, last_used, is_active, created_at, expires_at`
+	scopes := key.Scopes
+	if scopes == nil {
+		scopes = pq.StringArray{}
+	}
+	query := `INSERT INTO api_keys (user_id, name, key_hash, is_active, expires_at, scopes,
+		rotation_days, overlap_hours, rotation_due_at, rotated_from)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING *`
 
 	var result models.APIKey
-	err := r.db.GetContext(ctx, &result, query, key.UserID, key.Name, key.KeyHash, key.IsActive, key.ExpiresAt)
-	return &result, err
+	err := conn(ctx, r.db).GetContext(ctx, &result, query, key.UserID, key.Name, key.KeyHash, key.IsActive, key.ExpiresAt, scopes,
+		key.RotationDays, key.OverlapHours, key.RotationDueAt, key.RotatedFrom)
+	return &result, wrap("api key insert", err)
+}
+
+// GetOwned returns one of userID's keys
+func (r *APIKeyRepo) GetOwned(ctx context.Context, userID, keyID int64) (*models.APIKey, error) {
+	query := `SELECT * FROM api_keys WHERE id = $1 AND user_id = $2`
+	var key models.APIKey
+	err := conn(ctx, r.db).GetContext(ctx, &key, query, keyID, userID)
+	return &key, wrap("api key get owned", err)
+}
+
+// SetRotationPolicy makes an active key auto-rotate, due at dueAt, or stops
+// it auto-rotating when days is nil. It returns sql.ErrNoRows when the key
+// is inactive or already rotated.
+func (r *APIKeyRepo) SetRotationPolicy(ctx context.Context, userID, keyID int64, days *int, overlapHours int, dueAt *time.Time) (*models.APIKey, error) {
+	query := `UPDATE api_keys SET rotation_days = $3, overlap_hours = $4, rotation_due_at = $5,
+		rotation_reminded_at = NULL
+		WHERE id = $1 AND user_id = $2 AND is_active = TRUE AND rotated_to IS NULL AND rotation_enforced_at IS NULL
+		RETURNING *`
+	var key models.APIKey
+	err := conn(ctx, r.db).GetContext(ctx, &key, query, keyID, userID, days, overlapHours, dueAt)
+	return &key, wrap("api key set rotation policy", err)
+}
+
+// Rotate inserts successor in place of the key it was rotated from, which
+// stays valid until graceEnd. It returns sql.ErrNoRows when that key is
+// inactive or already rotated.
+func (r *APIKeyRepo) Rotate(ctx context.Context, successor *models.APIKey, graceEnd time.Time) (*models.APIKey, error) {
+	var created *models.APIKey
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE api_keys SET rotated_at = NOW(),
+			expires_at = LEAST(COALESCE(expires_at, $3), $3)
+			WHERE id = $1 AND user_id = $2 AND is_active = TRUE AND rotated_to IS NULL`,
+			*successor.RotatedFrom, successor.UserID, graceEnd)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return sql.ErrNoRows
+		}
+		if created, err = r.Insert(ctx, successor); err != nil {
+			return err
+		}
+		_, err = conn(ctx, r.db).ExecContext(ctx, `UPDATE api_keys SET rotated_to = $2 WHERE id = $1`, *successor.RotatedFrom, created.ID)
+		return err
+	})
+	return created, wrap("api key rotate", err)
+}
+
+// AcknowledgeRotation records that userID's clients moved off a rotated
+// key and deactivates it, ending its overlap. It returns sql.ErrNoRows when
+// the key was not rotated or is already acknowledged.
+func (r *APIKeyRepo) AcknowledgeRotation(ctx context.Context, userID, keyID int64) (*models.APIKey, error) {
+	query := `UPDATE api_keys SET rotation_acknowledged_at = NOW(), is_active = FALSE
+		WHERE id = $1 AND user_id = $2 AND rotation_acknowledged_at IS NULL
+		AND (rotated_to IS NOT NULL OR rotation_enforced_at IS NOT NULL)
+		RETURNING *`
+	var key models.APIKey
+	err := conn(ctx, r.db).GetContext(ctx, &key, query, keyID, userID)
+	return &key, wrap("api key acknowledge rotation", err)
+}
+
+// ListRotationDue returns active, unrotated keys falling due before before
+// that still need a reminder or enforcing
+func (r *APIKeyRepo) ListRotationDue(ctx context.Context, before time.Time, limit int) ([]models.APIKey, error) {
+	query := `SELECT * FROM api_keys
+		WHERE is_active = TRUE AND rotated_to IS NULL AND rotation_enforced_at IS NULL AND rotation_due_at < $1
+		ORDER BY rotation_due_at LIMIT $2`
+	var keys []models.APIKey
+	err := conn(ctx, r.db).SelectContext(ctx, &keys, query, before, limit)
+	return keys, wrap("api key list rotation due", err)
+}
+
+// MarkRotationReminded records the rotation reminder sent for a key
+func (r *APIKeyRepo) MarkRotationReminded(ctx context.Context, keyID int64, at time.Time) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE api_keys SET rotation_reminded_at = $2 WHERE id = $1`, keyID, at)
+	return wrap("api key mark rotation reminded", err)
+}
+
+// EnforceRotation makes a key past its rotation date expire at expiresAt
+func (r *APIKeyRepo) EnforceRotation(ctx context.Context, keyID int64, at, expiresAt time.Time) error {
+	query := `UPDATE api_keys SET rotation_enforced_at = $2, expires_at = LEAST(COALESCE(expires_at, $3), $3)
+		WHERE id = $1 AND rotated_to IS NULL AND rotation_enforced_at IS NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, keyID, at, expiresAt)
+	return wrap("api key enforce rotation", err)
 }
 
 func (r *APIKeyRepo) GetByUserID(ctx context.Context, userID int64) ([]models.APIKey, error) {
 	query := `SELECT * FROM api_keys WHERE user_id = $1 ORDER BY created_at DESC`
 	var keys []models.APIKey
-	err := r.db.SelectContext(ctx, &keys, query, userID)
-	return keys, err
+	err := conn(ctx, r.db).SelectContext(ctx, &keys, query, userID)
+	return keys, wrap("api key get by user id", err)
 }
 
+// GetByHash returns the active key with a hash; keys of deactivated users
+// are not returned, so suspending an account cuts off its keys too
 func (r *APIKeyRepo) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
-	query := `SELECT * FROM api_keys WHERE key_hash = $1 AND is_active = TRUE`
+	query := `SELECT k.* FROM api_keys k JOIN users u ON u.id = k.user_id
+              WHERE k.key_hash = $1 AND k.is_active = TRUE AND u.is_active = TRUE`
 	var key models.APIKey
-	err := r.db.GetContext(ctx, &key, query, keyHash)
-	return &key, err
+	err := conn(ctx, r.db).GetContext(ctx, &key, query, keyHash)
+	return &key, wrap("api key get by hash", err)
 }
 
 func (r *APIKeyRepo) UpdateLastUsed(ctx context.Context, keyID int64) error {
 	query := `UPDATE api_keys SET last_used = NOW() WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, keyID)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, keyID)
+	return wrap("api key update last used", err)
 }
 
 func (r *APIKeyRepo) Deactivate(ctx context.Context, keyID int64, userID int64) error {
 	query := `UPDATE api_keys SET is_active = FALSE WHERE id = $1 AND user_id = $2`
-	_, err := r.db.ExecContext(ctx, query, keyID, userID)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, keyID, userID)
+	return wrap("api key deactivate", err)
 }
 
 // AuditLogRepo handles audit logging
@@ -178,32 +307,71 @@ func (r *AuditLogRepo) CreateSchema(ctx context.Context) error {
 	stmt := `CREATE TABLE IF NOT EXISTS audit_logs (
         id BIGSERIAL PRIMARY KEY,
         user_id BIGINT NULL,
+        org_id BIGINT NULL,
         action TEXT NOT NULL,
         resource TEXT NOT NULL,
         resource_id TEXT NULL,
         ip_address TEXT NOT NULL,
         user_agent TEXT NOT NULL,
         metadata TEXT NOT NULL,
+        anonymized_at TIMESTAMPTZ NULL,
         created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-    )`
-	_, err := r.db.ExecContext(ctx, stmt)
-	return err
+    );
+    ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS org_id BIGINT NULL;
+    ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMPTZ NULL;
+    CREATE INDEX IF NOT EXISTS idx_audit_logs_pending_anon ON audit_logs(org_id, created_at) WHERE anonymized_at IS NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("audit log create schema", err)
 }
 
 func (r *AuditLogRepo) Insert(ctx context.Context, log *models.AuditLog) (*models.AuditLog, error) {
-	query := `INSERT INTO audit_logs (user_id, action, resource, resource_id, ip_address, user_agent, metadata)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, user_id, action, resource, resource_id, ip_address, user_agent, metadata, created_at`
+	query := `INSERT INTO audit_logs (user_id, org_id, action, resource, resource_id, ip_address, user_agent, metadata, anonymized_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, user_id, org_id, action, resource, resource_id, ip_address, user_agent, metadata, anonymized_at, created_at`
 
 	var result models.AuditLog
-	err := r.db.GetContext(ctx, &result, query, log.UserID, log.Action, log.Resource, log.ResourceID,
-		log.IPAddress, log.UserAgent, log.Metadata)
-	return &result, err
+	err := conn(ctx, r.db).GetContext(ctx, &result, query, log.UserID, log.OrgID, log.Action, log.Resource, log.ResourceID,
+		log.IPAddress, log.UserAgent, log.Metadata, log.AnonymizedAt)
+	return &result, wrap("audit log insert", err)
 }
 
 func (r *AuditLogRepo) GetByUserID(ctx context.Context, userID int64, limit, offset int) ([]models.AuditLog, error) {
 	query := `SELECT * FROM audit_logs WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
 	var logs []models.AuditLog
-	err := r.db.SelectContext(ctx, &logs, query, userID, limit, offset)
-	return logs, err
+	err := conn(ctx, r.db).SelectContext(ctx, &logs, query, userID, limit, offset)
+	return logs, wrap("audit log get by user id", err)
+}
+
+// ListBetween returns up to limit records written in [start, end) with an ID
+// above afterID, in ID order, for paging through a period
+func (r *AuditLogRepo) ListBetween(ctx context.Context, start, end time.Time, afterID int64, limit int) ([]models.AuditLog, error) {
+	query := `SELECT * FROM audit_logs WHERE created_at >= $1 AND created_at < $2 AND id > $3 ORDER BY id LIMIT $4`
+	var logs []models.AuditLog
+	err := conn(ctx, r.db).SelectContext(ctx, &logs, query, start, end, afterID, limit)
+	return logs, wrap("audit log list between", err)
+}
+
+// ListPendingAnonymization returns records of an organization written before
+// the cutoff that still carry raw client identifiers. A nil orgID selects the
+// records governed by the default policy: those without an organization or
+// whose organization has no stored anonymization policy.
+func (r *AuditLogRepo) ListPendingAnonymization(ctx context.Context, orgID *int64, before time.Time, limit int) ([]models.AuditLog, error) {
+	scope := `org_id = $1`
+	if orgID == nil {
+		scope = `($1::BIGINT IS NULL AND (org_id IS NULL OR NOT EXISTS (
+			SELECT 1 FROM anonymization_policies p WHERE p.org_id = audit_logs.org_id)))`
+	}
+	query := `SELECT * FROM audit_logs
+		WHERE ` + scope + ` AND anonymized_at IS NULL AND created_at < $2
+		ORDER BY created_at LIMIT $3`
+	var logs []models.AuditLog
+	err := conn(ctx, r.db).SelectContext(ctx, &logs, query, orgID, before, limit)
+	return logs, wrap("audit log list pending anonymization", err)
+}
+
+// MarkAnonymized replaces the client identifiers of a record with their anonymized form
+func (r *AuditLogRepo) MarkAnonymized(ctx context.Context, id int64, ipAddress, userAgent string) error {
+	query := `UPDATE audit_logs SET ip_address = $2, user_agent = $3, anonymized_at = NOW() WHERE id = $1`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, ipAddress, userAgent)
+	return wrap("audit log mark anonymized", err)
 }
@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/db"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// AnalyticsRepo stores tracked analytics events
+type AnalyticsRepo struct{ db *sqlx.DB }
+
+func NewAnalyticsRepo(db *sqlx.DB) *AnalyticsRepo { return &AnalyticsRepo{db: db} }
+
+const analyticsEventColumns = `id, user_id, org_id, event, category, properties, occurred_at, session_id, ip_address, user_agent`
+
+// analyticsInsertChunk keeps a multi-row insert well under the Postgres
+// limit of 65535 parameters
+const analyticsInsertChunk = 500
+
+func (r *AnalyticsRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS analytics_events (
+        id TEXT PRIMARY KEY,
+        user_id TEXT NOT NULL DEFAULT '',
+        org_id BIGINT NOT NULL DEFAULT 0,
+        event TEXT NOT NULL,
+        category TEXT NOT NULL DEFAULT '',
+        properties JSONB NOT NULL DEFAULT '{}',
+        occurred_at TIMESTAMPTZ NOT NULL,
+        session_id TEXT NOT NULL DEFAULT '',
+        ip_address TEXT NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        anonymized_at TIMESTAMPTZ NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_analytics_events_time ON analytics_events(occurred_at);
+    CREATE INDEX IF NOT EXISTS idx_analytics_events_event_time ON analytics_events(event, occurred_at);
+    CREATE INDEX IF NOT EXISTS idx_analytics_events_user_time ON analytics_events(user_id, occurred_at);
+    CREATE INDEX IF NOT EXISTS idx_analytics_events_pending_anon ON analytics_events(occurred_at, id) WHERE anonymized_at IS NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("analytics create schema", err)
+}
+
+// InsertEvents stores events in multi-row inserts within one transaction.
+// Events already stored are skipped.
+func (r *AnalyticsRepo) InsertEvents(ctx context.Context, events []models.AnalyticsEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return wrap("analytics insert events", WithTx(ctx, r.db, func(ctx context.Context) error {
+		for start := 0; start < len(events); start += analyticsInsertChunk {
+			chunk := events[start:min(start+analyticsInsertChunk, len(events))]
+			values := make([]string, len(chunk))
+			args := make([]interface{}, 0, len(chunk)*10)
+			for i, e := range chunk {
+				n := i * 10
+				values[i] = fmt.Sprintf("($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10)
+				args = append(args, e.ID, e.UserID, e.OrgID, e.Event, e.Category, e.Properties, e.Timestamp, e.SessionID, e.IPAddress, e.UserAgent)
+			}
+			q := `INSERT INTO analytics_events (` + analyticsEventColumns + `) VALUES ` + strings.Join(values, ",") + `
+          ON CONFLICT (id) DO NOTHING`
+			if _, err := conn(ctx, r.db).ExecContext(ctx, q, args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// analyticsWhere builds the WHERE clause of a filter; the time range is
+// inclusive at both ends
+func analyticsWhere(f models.AnalyticsEventFilter) (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if f.UserID != "" {
+		add("user_id = $%d", f.UserID)
+	}
+	if f.Event != "" {
+		add("event = $%d", f.Event)
+	}
+	if f.Category != "" {
+		add("category = $%d", f.Category)
+	}
+	if f.StartTime != nil {
+		add("occurred_at >= $%d", *f.StartTime)
+	}
+	if f.EndTime != nil {
+		add("occurred_at <= $%d", *f.EndTime)
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// QueryEvents returns the events matching a filter, oldest first
+func (r *AnalyticsRepo) QueryEvents(ctx context.Context, f models.AnalyticsEventFilter) ([]models.AnalyticsEvent, error) {
+	where, args := analyticsWhere(f)
+	q := `SELECT ` + analyticsEventColumns + ` FROM analytics_events` + where + ` ORDER BY occurred_at, id`
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		q += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if f.Offset > 0 {
+		args = append(args, f.Offset)
+		q += fmt.Sprintf(" OFFSET $%d", len(args))
+	}
+	var out []models.AnalyticsEvent
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, args...)
+	return out, wrap("analytics query events", err)
+}
+
+// Downsample counts the events matching a filter and their distinct users
+// per event name and time bucket (minute, hour, day, week or month)
+func (r *AnalyticsRepo) Downsample(ctx context.Context, f models.AnalyticsEventFilter, interval string) ([]models.AnalyticsBucket, error) {
+	where, args := analyticsWhere(f)
+	args = append(args, interval)
+	q := fmt.Sprintf(`SELECT date_trunc($%d::text, occurred_at) AS bucket, event, COUNT(*) AS events, COUNT(DISTINCT user_id) AS users
+          FROM analytics_events%s
+          GROUP BY 1, 2
+          ORDER BY 1, 2`, len(args), where)
+	var out []models.AnalyticsBucket
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, args...)
+	return out, wrap("analytics downsample", err)
+}
+
+// Stats counts the stored events and their time span
+func (r *AnalyticsRepo) Stats(ctx context.Context) (*models.AnalyticsStats, error) {
+	var out models.AnalyticsStats
+	err := conn(ctx, r.db).GetContext(ctx, &out, `SELECT COUNT(*) AS events, MIN(occurred_at) AS oldest, MAX(occurred_at) AS newest FROM analytics_events`)
+	if err != nil {
+		return nil, wrap("analytics stats", err)
+	}
+	return &out, nil
+}
+
+// ListPendingAnonymization returns events recorded before a time whose client
+// identifiers have not been anonymized, ordered after the (afterTime, afterID)
+// cursor
+func (r *AnalyticsRepo) ListPendingAnonymization(ctx context.Context, before, afterTime time.Time, afterID string, limit int) ([]models.AnalyticsEvent, error) {
+	q := `SELECT ` + analyticsEventColumns + ` FROM analytics_events
+          WHERE anonymized_at IS NULL AND (ip_address <> '' OR user_agent <> '')
+            AND occurred_at < $1 AND (occurred_at, id) > ($2, $3)
+          ORDER BY occurred_at, id LIMIT $4`
+	var out []models.AnalyticsEvent
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, before, afterTime, afterID, limit)
+	return out, wrap("analytics list pending anonymization", err)
+}
+
+// MarkAnonymized replaces the client identifiers of an event with their
+// anonymized form
+func (r *AnalyticsRepo) MarkAnonymized(ctx context.Context, id, ipAddress, userAgent string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE analytics_events SET ip_address = $2, user_agent = $3, anonymized_at = NOW() WHERE id = $1`,
+		id, ipAddress, userAgent)
+	return wrap("analytics mark anonymized", err)
+}
+
+// DeleteBefore removes events recorded before a time and returns how many.
+// The first purge of a large table can outlast the query timeout, so it is
+// bounded by ctx alone.
+func (r *AnalyticsRepo) DeleteBefore(ctx context.Context, before time.Time) (int64, error) {
+	res, err := conn(ctx, r.db).ExecContext(db.WithQueryTimeout(ctx, 0), `DELETE FROM analytics_events WHERE occurred_at < $1`, before)
+	if err != nil {
+		return 0, wrap("analytics delete before", err)
+	}
+	return res.RowsAffected()
+}
+
+// ActiveUsers returns the users who recorded events in any of categories
+// since a time. Events from anonymous visitors carry no numeric user ID and
+// are left out.
+func (r *AnalyticsRepo) ActiveUsers(ctx context.Context, categories []string, since time.Time) ([]int64, error) {
+	q := `SELECT DISTINCT user_id::bigint FROM analytics_events
+          WHERE category = ANY($1) AND occurred_at >= $2 AND user_id ~ '^[0-9]{1,18}$'`
+	var out []int64
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, pq.Array(categories), since)
+	return out, wrap("analytics active users", err)
+}
@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// AnonymizationPolicyRepo stores per-organization IP/user agent anonymization policies
+type AnonymizationPolicyRepo struct{ db *sqlx.DB }
+
+func NewAnonymizationPolicyRepo(db *sqlx.DB) *AnonymizationPolicyRepo {
+	return &AnonymizationPolicyRepo{db: db}
+}
+
+func (r *AnonymizationPolicyRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS anonymization_policies (
+        org_id BIGINT PRIMARY KEY,
+        ip_mode TEXT NOT NULL DEFAULT 'truncate',
+        user_agent_mode TEXT NOT NULL DEFAULT 'truncate',
+        anonymize_after_days INT NOT NULL DEFAULT 30,
+        eu_tenant BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("anonymization policy create schema", err)
+}
+
+func (r *AnonymizationPolicyRepo) GetByOrgID(ctx context.Context, orgID int64) (*models.AnonymizationPolicy, error) {
+	q := `SELECT org_id, ip_mode, user_agent_mode, anonymize_after_days, eu_tenant, created_at, updated_at
+          FROM anonymization_policies WHERE org_id=$1`
+	var p models.AnonymizationPolicy
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, orgID).StructScan(&p); err != nil {
+		return nil, wrap("anonymization policy get by org id", err)
+	}
+	return &p, nil
+}
+
+func (r *AnonymizationPolicyRepo) List(ctx context.Context) ([]models.AnonymizationPolicy, error) {
+	q := `SELECT org_id, ip_mode, user_agent_mode, anonymize_after_days, eu_tenant, created_at, updated_at
+          FROM anonymization_policies ORDER BY org_id`
+	var out []models.AnonymizationPolicy
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q)
+	return out, wrap("anonymization policy list", err)
+}
+
+func (r *AnonymizationPolicyRepo) Upsert(ctx context.Context, p *models.AnonymizationPolicy) (*models.AnonymizationPolicy, error) {
+	q := `INSERT INTO anonymization_policies (org_id, ip_mode, user_agent_mode, anonymize_after_days, eu_tenant)
+          VALUES ($1,$2,$3,$4,$5)
+          ON CONFLICT (org_id) DO UPDATE SET ip_mode=EXCLUDED.ip_mode, user_agent_mode=EXCLUDED.user_agent_mode,
+              anonymize_after_days=EXCLUDED.anonymize_after_days, eu_tenant=EXCLUDED.eu_tenant, updated_at=NOW()
+          RETURNING org_id, ip_mode, user_agent_mode, anonymize_after_days, eu_tenant, created_at, updated_at`
+	var out models.AnonymizationPolicy
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, p.OrgID, p.IPMode, p.UserAgentMode, p.AnonymizeAfterDays, p.EUTenant).StructScan(&out); err != nil {
+		return nil, wrap("anonymization policy upsert", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,76 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// BillingCreditRepo is the billing credits ledger
+type BillingCreditRepo struct{ db *sqlx.DB }
+
+func NewBillingCreditRepo(db *sqlx.DB) *BillingCreditRepo { return &BillingCreditRepo{db: db} }
+
+func (r *BillingCreditRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS billing_credits (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL,
+        amount NUMERIC(12,2) NOT NULL,
+        currency TEXT NOT NULL DEFAULT 'USD',
+        reason TEXT NOT NULL,
+        source TEXT NOT NULL,
+        source_id TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (source, source_id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_billing_credits_user ON billing_credits(user_id, created_at DESC)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("billing credit create schema", err)
+}
+
+// Insert adds a credit unless one already exists for the same source entry,
+// in which case it returns the existing credit and false
+func (r *BillingCreditRepo) Insert(ctx context.Context, c *models.BillingCredit) (*models.BillingCredit, bool, error) {
+	q := `INSERT INTO billing_credits (user_id, amount, currency, reason, source, source_id)
+          VALUES ($1,$2,$3,$4,$5,$6)
+          ON CONFLICT (source, source_id) DO NOTHING
+          RETURNING id, user_id, amount, currency, reason, source, source_id, created_at`
+	var out models.BillingCredit
+	err := conn(ctx, r.db).QueryRowxContext(ctx, q, c.UserID, c.Amount, c.Currency, c.Reason, c.Source, c.SourceID).StructScan(&out)
+	if errors.Is(err, sql.ErrNoRows) {
+		existing, getErr := r.GetBySource(ctx, c.Source, c.SourceID)
+		return existing, false, getErr
+	}
+	if err != nil {
+		return nil, false, wrap("billing credit insert", err)
+	}
+	return &out, true, nil
+}
+
+func (r *BillingCreditRepo) GetBySource(ctx context.Context, source, sourceID string) (*models.BillingCredit, error) {
+	q := `SELECT id, user_id, amount, currency, reason, source, source_id, created_at
+          FROM billing_credits WHERE source=$1 AND source_id=$2`
+	var out models.BillingCredit
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, source, sourceID).StructScan(&out); err != nil {
+		return nil, wrap("billing credit get by source", err)
+	}
+	return &out, nil
+}
+
+func (r *BillingCreditRepo) ListByUser(ctx context.Context, userID int64, limit int) ([]models.BillingCredit, error) {
+	q := `SELECT id, user_id, amount, currency, reason, source, source_id, created_at
+          FROM billing_credits WHERE user_id=$1 ORDER BY created_at DESC LIMIT $2`
+	var out []models.BillingCredit
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID, limit)
+	return out, wrap("billing credit list by user", err)
+}
+
+// Balance returns the sum of a user's credits
+func (r *BillingCreditRepo) Balance(ctx context.Context, userID int64) (float64, error) {
+	var total float64
+	err := conn(ctx, r.db).GetContext(ctx, &total, `SELECT COALESCE(SUM(amount), 0) FROM billing_credits WHERE user_id=$1`, userID)
+	return total, wrap("billing credit balance", err)
+}
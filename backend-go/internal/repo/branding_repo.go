@@ -0,0 +1,150 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrHostnameTaken is returned when another organization already verified
+// a branded hostname
+var ErrHostnameTaken = errors.New("hostname is verified by another organization")
+
+// BrandingRepo stores the white-label branding of organizations
+type BrandingRepo struct{ db *sqlx.DB }
+
+func NewBrandingRepo(db *sqlx.DB) *BrandingRepo { return &BrandingRepo{db: db} }
+
+// CreateSchema creates the branding table. Any number of organizations may
+// claim a hostname, but only one can verify it.
+func (r *BrandingRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS org_branding (
+        org_id BIGINT PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+        display_name TEXT NULL,
+        logo_url TEXT NULL,
+        logo_dark_url TEXT NULL,
+        email_from_address TEXT NULL,
+        api_hostname TEXT NULL,
+        hostname_token TEXT NULL,
+        hostname_verified_at TIMESTAMPTZ NULL,
+        updated_by BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS idx_org_branding_verified_hostname ON org_branding(api_hostname)
+        WHERE hostname_verified_at IS NOT NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("branding create schema", err)
+}
+
+const brandingColumns = `org_id, display_name, logo_url, logo_dark_url, email_from_address, api_hostname,
+    hostname_token, hostname_verified_at, updated_by, created_at, updated_at`
+
+// whiteLabelOwner limits a query on org_branding to organizations with an
+// owner subscribed to one of the tiers in $2
+const whiteLabelOwner = `EXISTS (SELECT 1 FROM org_members o JOIN users ou ON ou.id = o.user_id
+          WHERE o.org_id = org_branding.org_id AND o.role = 'owner' AND ou.subscription_tier = ANY($2))`
+
+// Get returns an organization's branding
+func (r *BrandingRepo) Get(ctx context.Context, orgID int64) (*models.OrgBranding, error) {
+	q := `SELECT ` + brandingColumns + ` FROM org_branding WHERE org_id=$1`
+	var out models.OrgBranding
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, orgID); err != nil {
+		return nil, wrap("branding get", err)
+	}
+	return &out, nil
+}
+
+// Upsert saves an organization's branding. A changed hostname takes the new
+// token and has to be verified again; an unchanged one keeps its token and
+// verification.
+func (r *BrandingRepo) Upsert(ctx context.Context, b *models.OrgBranding) (*models.OrgBranding, error) {
+	q := `INSERT INTO org_branding (org_id, display_name, logo_url, logo_dark_url, email_from_address, api_hostname, hostname_token, updated_by)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+          ON CONFLICT (org_id) DO UPDATE SET
+            display_name=EXCLUDED.display_name, logo_url=EXCLUDED.logo_url, logo_dark_url=EXCLUDED.logo_dark_url,
+            email_from_address=EXCLUDED.email_from_address, api_hostname=EXCLUDED.api_hostname,
+            hostname_token=CASE WHEN org_branding.api_hostname IS NOT DISTINCT FROM EXCLUDED.api_hostname
+                THEN org_branding.hostname_token ELSE EXCLUDED.hostname_token END,
+            hostname_verified_at=CASE WHEN org_branding.api_hostname IS NOT DISTINCT FROM EXCLUDED.api_hostname
+                THEN org_branding.hostname_verified_at ELSE NULL END,
+            updated_by=EXCLUDED.updated_by, updated_at=NOW()
+          RETURNING ` + brandingColumns
+	var out models.OrgBranding
+	err := conn(ctx, r.db).QueryRowxContext(ctx, q, b.OrgID, b.DisplayName, b.LogoURL, b.LogoDarkURL,
+		b.EmailFromAddress, b.APIHostname, b.HostnameToken, b.UpdatedBy).StructScan(&out)
+	if err != nil {
+		return nil, wrap("branding upsert", err)
+	}
+	return &out, nil
+}
+
+// Delete removes an organization's branding
+func (r *BrandingRepo) Delete(ctx context.Context, orgID int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM org_branding WHERE org_id=$1`, orgID)
+	if err != nil {
+		return wrap("branding delete", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkVerified records that an organization proved its hostname, unless
+// another organization verified it first or the hostname has changed since
+func (r *BrandingRepo) MarkVerified(ctx context.Context, orgID int64, hostname string) (*models.OrgBranding, error) {
+	q := `UPDATE org_branding SET hostname_verified_at=NOW(), updated_at=NOW()
+          WHERE org_id=$1 AND api_hostname=$2
+            AND NOT EXISTS (SELECT 1 FROM org_branding o
+                WHERE o.api_hostname=$2 AND o.org_id<>$1 AND o.hostname_verified_at IS NOT NULL)
+          RETURNING ` + brandingColumns
+	var out models.OrgBranding
+	err := conn(ctx, r.db).QueryRowxContext(ctx, q, orgID, hostname).StructScan(&out)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrHostnameTaken
+	}
+	if err != nil {
+		return nil, wrap("branding mark verified", err)
+	}
+	return &out, nil
+}
+
+// Entitled reports whether an organization has an owner on one of tiers
+func (r *BrandingRepo) Entitled(ctx context.Context, orgID int64, tiers []string) (bool, error) {
+	q := `SELECT EXISTS (SELECT 1 FROM org_members o JOIN users ou ON ou.id = o.user_id
+          WHERE o.org_id=$1 AND o.role = 'owner' AND ou.subscription_tier = ANY($2))`
+	var ok bool
+	err := conn(ctx, r.db).GetContext(ctx, &ok, q, orgID, pq.Array(tiers))
+	return ok, wrap("branding entitled", err)
+}
+
+// ForEmail returns the branding of the organization the user with email
+// belongs to, when an owner of it is on one of tiers
+func (r *BrandingRepo) ForEmail(ctx context.Context, email string, tiers []string) (*models.OrgBranding, error) {
+	q := `SELECT ` + brandingColumns + ` FROM org_branding
+          WHERE org_id = (SELECT m.org_id FROM org_members m JOIN users u ON u.id = m.user_id WHERE u.email=$1)
+            AND ` + whiteLabelOwner
+	var out models.OrgBranding
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, email, pq.Array(tiers)); err != nil {
+		return nil, wrap("branding for email", err)
+	}
+	return &out, nil
+}
+
+// ForUser returns the branding of the organization a user belongs to, when
+// an owner of it is on one of tiers
+func (r *BrandingRepo) ForUser(ctx context.Context, userID int64, tiers []string) (*models.OrgBranding, error) {
+	q := `SELECT ` + brandingColumns + ` FROM org_branding
+          WHERE org_id = (SELECT org_id FROM org_members WHERE user_id=$1)
+            AND ` + whiteLabelOwner
+	var out models.OrgBranding
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, userID, pq.Array(tiers)); err != nil {
+		return nil, wrap("branding for user", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,62 @@
+// Package repo_test provides unit tests for organization branding
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var brandingCols = []string{"org_id", "display_name", "logo_url", "logo_dark_url", "email_from_address", "api_hostname",
+	"hostname_token", "hostname_verified_at", "updated_by", "created_at", "updated_at"}
+
+func TestBrandingRepo_MarkVerified(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	brands := repo.NewBrandingRepo(testDB.DB)
+	now := time.Now()
+
+	testDB.Mock.ExpectQuery("UPDATE org_branding SET hostname_verified_at=NOW()").WithArgs(int64(7), "api.acme.com").
+		WillReturnRows(sqlmock.NewRows(brandingCols).AddRow(7, "Acme", nil, nil, nil, "api.acme.com", "tok", now, 2, now, now))
+
+	b, err := brands.MarkVerified(context.Background(), 7, "api.acme.com")
+	require.NoError(t, err)
+	assert.Equal(t, "api.acme.com", *b.APIHostname)
+	assert.NotNil(t, b.HostnameVerifiedAt)
+	testDB.AssertExpectations(t)
+}
+
+func TestBrandingRepo_MarkVerifiedTaken(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	brands := repo.NewBrandingRepo(testDB.DB)
+
+	testDB.Mock.ExpectQuery("UPDATE org_branding SET hostname_verified_at=NOW()").WithArgs(int64(7), "api.acme.com").
+		WillReturnRows(sqlmock.NewRows(brandingCols))
+
+	_, err := brands.MarkVerified(context.Background(), 7, "api.acme.com")
+	assert.ErrorIs(t, err, repo.ErrHostnameTaken)
+	testDB.AssertExpectations(t)
+}
+
+func TestBrandingRepo_ForEmail(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	brands := repo.NewBrandingRepo(testDB.DB)
+	now := time.Now()
+
+	testDB.Mock.ExpectQuery("SELECT (.+) FROM org_branding").WithArgs("ana@acme.com", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(brandingCols).AddRow(7, "Acme", "https://cdn.acme.com/logo.png", nil, nil, nil, nil, nil, 2, now, now))
+
+	b, err := brands.ForEmail(context.Background(), "ana@acme.com", []string{"professional"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), b.OrgID)
+	assert.Equal(t, "Acme", *b.DisplayName)
+	testDB.AssertExpectations(t)
+}
@@ -0,0 +1,165 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/changelog"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// ChangelogRepo stores customer-facing release notes
+type ChangelogRepo struct{ db *sqlx.DB }
+
+func NewChangelogRepo(db *sqlx.DB) *ChangelogRepo { return &ChangelogRepo{db: db} }
+
+const changelogColumns = `id, version, title, body, features, published_at, announced_at, notified, created_by, created_at, updated_at`
+
+// Versions are also kept as numbers so they compare as versions, not text
+func (r *ChangelogRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS changelog_entries (
+        id BIGSERIAL PRIMARY KEY,
+        version TEXT NOT NULL,
+        version_major INT NOT NULL,
+        version_minor INT NOT NULL,
+        version_patch INT NOT NULL,
+        title TEXT NOT NULL,
+        body TEXT NOT NULL DEFAULT '',
+        features TEXT[] NOT NULL DEFAULT '{}',
+        published_at TIMESTAMPTZ NULL,
+        announced_at TIMESTAMPTZ NULL,
+        notified INT NOT NULL DEFAULT 0,
+        created_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_changelog_entries_version ON changelog_entries(version_major, version_minor, version_patch) WHERE published_at IS NOT NULL;
+    CREATE INDEX IF NOT EXISTS idx_changelog_entries_unannounced ON changelog_entries(published_at) WHERE published_at IS NOT NULL AND announced_at IS NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("changelog create schema", err)
+}
+
+// Insert stores a draft entry at its parsed version v
+func (r *ChangelogRepo) Insert(ctx context.Context, e *models.ChangelogEntry, v changelog.Version) (*models.ChangelogEntry, error) {
+	q := `INSERT INTO changelog_entries (version, version_major, version_minor, version_patch, title, body, features, created_by)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+          RETURNING ` + changelogColumns
+	var out models.ChangelogEntry
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, e.Version, v.Major, v.Minor, v.Patch, e.Title, e.Body, e.Features, e.CreatedBy).StructScan(&out); err != nil {
+		return nil, wrap("changelog insert", err)
+	}
+	return &out, nil
+}
+
+// Update changes an entry's text, version and feature areas
+func (r *ChangelogRepo) Update(ctx context.Context, e *models.ChangelogEntry, v changelog.Version) (*models.ChangelogEntry, error) {
+	q := `UPDATE changelog_entries SET version=$2, version_major=$3, version_minor=$4, version_patch=$5, title=$6, body=$7, features=$8, updated_at=NOW()
+          WHERE id=$1
+          RETURNING ` + changelogColumns
+	var out models.ChangelogEntry
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, e.ID, e.Version, v.Major, v.Minor, v.Patch, e.Title, e.Body, e.Features).StructScan(&out); err != nil {
+		return nil, wrap("changelog update", err)
+	}
+	return &out, nil
+}
+
+func (r *ChangelogRepo) Get(ctx context.Context, id int64) (*models.ChangelogEntry, error) {
+	q := `SELECT ` + changelogColumns + ` FROM changelog_entries WHERE id=$1`
+	var out models.ChangelogEntry
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, id).StructScan(&out); err != nil {
+		return nil, wrap("changelog get", err)
+	}
+	return &out, nil
+}
+
+// List returns drafts and published entries, newest version first
+func (r *ChangelogRepo) List(ctx context.Context, limit, offset int) ([]models.ChangelogEntry, error) {
+	q := `SELECT ` + changelogColumns + ` FROM changelog_entries
+          ORDER BY version_major DESC, version_minor DESC, version_patch DESC, id DESC LIMIT $1 OFFSET $2`
+	var out []models.ChangelogEntry
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, limit, offset)
+	return out, wrap("changelog list", err)
+}
+
+// ListPublished returns published entries newer than since, or all of them
+// when since is nil, newest version first. A non-empty feature keeps the
+// entries tagged with it.
+func (r *ChangelogRepo) ListPublished(ctx context.Context, since *changelog.Version, feature string, limit int) ([]models.ChangelogEntry, error) {
+	q := `SELECT ` + changelogColumns + ` FROM changelog_entries
+          WHERE published_at IS NOT NULL
+            AND ($1::boolean IS FALSE OR (version_major, version_minor, version_patch) > ($2, $3, $4))
+            AND ($5 = '' OR $5 = ANY(features))
+          ORDER BY version_major DESC, version_minor DESC, version_patch DESC, published_at DESC LIMIT $6`
+	var v changelog.Version
+	if since != nil {
+		v = *since
+	}
+	var out []models.ChangelogEntry
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, since != nil, v.Major, v.Minor, v.Patch, feature, limit)
+	return out, wrap("changelog list published", err)
+}
+
+// LatestVersion returns the newest published version, or "" when nothing is
+// published
+func (r *ChangelogRepo) LatestVersion(ctx context.Context) (string, error) {
+	var v string
+	err := conn(ctx, r.db).GetContext(ctx, &v, `SELECT version FROM changelog_entries WHERE published_at IS NOT NULL
+        ORDER BY version_major DESC, version_minor DESC, version_patch DESC LIMIT 1`)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return v, wrap("changelog latest version", err)
+}
+
+// Publish makes a draft visible at a time; entries already published keep
+// their time
+func (r *ChangelogRepo) Publish(ctx context.Context, id int64, at time.Time) (*models.ChangelogEntry, error) {
+	q := `UPDATE changelog_entries SET published_at=COALESCE(published_at, $2), updated_at=NOW()
+          WHERE id=$1
+          RETURNING ` + changelogColumns
+	var out models.ChangelogEntry
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, id, at).StructScan(&out); err != nil {
+		return nil, wrap("changelog publish", err)
+	}
+	return &out, nil
+}
+
+func (r *ChangelogRepo) Delete(ctx context.Context, id int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM changelog_entries WHERE id=$1`, id)
+	if err != nil {
+		return wrap("changelog delete", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ClaimUnannounced marks the earliest published entry that has not been
+// announced as announced and returns it, or nil when there is none. Rows
+// claimed by another instance are skipped.
+func (r *ChangelogRepo) ClaimUnannounced(ctx context.Context) (*models.ChangelogEntry, error) {
+	q := `UPDATE changelog_entries SET announced_at=NOW()
+          WHERE id = (SELECT id FROM changelog_entries
+                      WHERE published_at IS NOT NULL AND announced_at IS NULL
+                      ORDER BY published_at, id LIMIT 1 FOR UPDATE SKIP LOCKED)
+          RETURNING ` + changelogColumns
+	var out models.ChangelogEntry
+	err := conn(ctx, r.db).QueryRowxContext(ctx, q).StructScan(&out)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, wrap("changelog claim unannounced", err)
+	}
+	return &out, nil
+}
+
+// RecordNotified records how many users an entry was announced to
+func (r *ChangelogRepo) RecordNotified(ctx context.Context, id int64, notified int) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE changelog_entries SET notified=$2 WHERE id=$1`, id, notified)
+	return wrap("changelog record notified", err)
+}
@@ -0,0 +1,132 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// ColumnAnnotationRepo stores schema annotations on dataset columns and
+// the history of every change to them
+type ColumnAnnotationRepo struct{ db *sqlx.DB }
+
+func NewColumnAnnotationRepo(db *sqlx.DB) *ColumnAnnotationRepo { return &ColumnAnnotationRepo{db: db} }
+
+func (r *ColumnAnnotationRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS column_annotations (
+        id BIGSERIAL PRIMARY KEY,
+        dataset_id BIGINT NOT NULL,
+        column_name TEXT NOT NULL,
+        is_unique BOOLEAN NOT NULL DEFAULT FALSE,
+        min_value DOUBLE PRECISION,
+        max_value DOUBLE PRECISION,
+        description TEXT,
+        sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+        version INT NOT NULL DEFAULT 1,
+        updated_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (dataset_id, column_name)
+    );
+    CREATE TABLE IF NOT EXISTS column_annotation_history (
+        id BIGSERIAL PRIMARY KEY,
+        dataset_id BIGINT NOT NULL,
+        column_name TEXT NOT NULL,
+        version INT NOT NULL,
+        is_unique BOOLEAN NOT NULL DEFAULT FALSE,
+        min_value DOUBLE PRECISION,
+        max_value DOUBLE PRECISION,
+        description TEXT,
+        sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+        deleted BOOLEAN NOT NULL DEFAULT FALSE,
+        changed_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (dataset_id, column_name, version)
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("column annotation create schema", err)
+}
+
+const columnAnnotationColumns = `id, dataset_id, column_name, is_unique, min_value, max_value, description, sensitive,
+              version, updated_by, created_at, updated_at`
+
+const columnAnnotationVersionColumns = `id, dataset_id, column_name, version, is_unique, min_value, max_value, description,
+              sensitive, deleted, changed_by, created_at`
+
+// nextVersionQuery numbers versions per column across deletions, so a
+// re-created annotation continues its history
+const nextVersionQuery = `SELECT COALESCE(MAX(version), 0) + 1 FROM column_annotation_history WHERE dataset_id=$1 AND column_name=$2`
+
+// Upsert writes an annotation as a new version and records it in the history
+func (r *ColumnAnnotationRepo) Upsert(ctx context.Context, a *models.ColumnAnnotation) (*models.ColumnAnnotation, error) {
+	var out models.ColumnAnnotation
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		var version int
+		if err := conn(ctx, r.db).GetContext(ctx, &version, nextVersionQuery, a.DatasetID, a.ColumnName); err != nil {
+			return err
+		}
+		q := `INSERT INTO column_annotations (dataset_id, column_name, is_unique, min_value, max_value, description, sensitive, version, updated_by)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+          ON CONFLICT (dataset_id, column_name) DO UPDATE SET
+              is_unique=EXCLUDED.is_unique, min_value=EXCLUDED.min_value, max_value=EXCLUDED.max_value,
+              description=EXCLUDED.description, sensitive=EXCLUDED.sensitive, version=EXCLUDED.version,
+              updated_by=EXCLUDED.updated_by, updated_at=NOW()
+          RETURNING ` + columnAnnotationColumns
+		if err := conn(ctx, r.db).QueryRowxContext(ctx, q, a.DatasetID, a.ColumnName, a.Unique, a.MinValue, a.MaxValue, a.Description,
+			a.Sensitive, version, a.UpdatedBy).StructScan(&out); err != nil {
+			return err
+		}
+		hq := `INSERT INTO column_annotation_history (dataset_id, column_name, version, is_unique, min_value, max_value, description, sensitive, changed_by)
+           VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+		_, err := conn(ctx, r.db).ExecContext(ctx, hq, out.DatasetID, out.ColumnName, out.Version, out.Unique, out.MinValue, out.MaxValue,
+			out.Description, out.Sensitive, out.UpdatedBy)
+		return err
+	})
+	if err != nil {
+		return nil, wrap("column annotation upsert", err)
+	}
+	return &out, nil
+}
+
+func (r *ColumnAnnotationRepo) List(ctx context.Context, datasetID int64) ([]models.ColumnAnnotation, error) {
+	q := `SELECT ` + columnAnnotationColumns + ` FROM column_annotations WHERE dataset_id=$1 ORDER BY column_name`
+	var out []models.ColumnAnnotation
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID)
+	return out, wrap("column annotation list", err)
+}
+
+// Delete removes an annotation and records the removal as a version
+func (r *ColumnAnnotationRepo) Delete(ctx context.Context, datasetID int64, column string, by int64) (*models.ColumnAnnotationVersion, error) {
+	var out models.ColumnAnnotationVersion
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		var deleted models.ColumnAnnotation
+		q := `DELETE FROM column_annotations WHERE dataset_id=$1 AND column_name=$2 RETURNING ` + columnAnnotationColumns
+		if err := conn(ctx, r.db).QueryRowxContext(ctx, q, datasetID, column).StructScan(&deleted); err != nil {
+			return err
+		}
+		var version int
+		if err := conn(ctx, r.db).GetContext(ctx, &version, nextVersionQuery, datasetID, column); err != nil {
+			return err
+		}
+		hq := `INSERT INTO column_annotation_history (dataset_id, column_name, version, deleted, changed_by)
+           VALUES ($1,$2,$3,TRUE,$4)
+           RETURNING ` + columnAnnotationVersionColumns
+		return conn(ctx, r.db).QueryRowxContext(ctx, hq, datasetID, column, version, by).StructScan(&out)
+	})
+	if err != nil {
+		return nil, wrap("column annotation delete", err)
+	}
+	return &out, nil
+}
+
+// History lists the versions of a dataset's annotations, newest first;
+// an empty column lists every column
+func (r *ColumnAnnotationRepo) History(ctx context.Context, datasetID int64, column string) ([]models.ColumnAnnotationVersion, error) {
+	q := `SELECT ` + columnAnnotationVersionColumns + ` FROM column_annotation_history
+          WHERE dataset_id=$1 AND ($2='' OR column_name=$2)
+          ORDER BY created_at DESC, version DESC LIMIT 500`
+	var out []models.ColumnAnnotationVersion
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID, column)
+	return out, wrap("column annotation history", err)
+}
@@ -0,0 +1,70 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// ColumnPrivacyRepo stores the per-column privacy settings of datasets
+type ColumnPrivacyRepo struct{ db *sqlx.DB }
+
+func NewColumnPrivacyRepo(db *sqlx.DB) *ColumnPrivacyRepo { return &ColumnPrivacyRepo{db: db} }
+
+func (r *ColumnPrivacyRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS column_privacy (
+        id BIGSERIAL PRIMARY KEY,
+        dataset_id BIGINT NOT NULL,
+        column_name TEXT NOT NULL,
+        category TEXT NOT NULL,
+        mechanism TEXT NOT NULL,
+        epsilon DOUBLE PRECISION,
+        delta DOUBLE PRECISION,
+        sensitivity DOUBLE PRECISION,
+        updated_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (dataset_id, column_name)
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("column privacy create schema", err)
+}
+
+const columnPrivacyColumns = `id, dataset_id, column_name, category, mechanism, epsilon, delta, sensitivity,
+              updated_by, created_at, updated_at`
+
+func (r *ColumnPrivacyRepo) Upsert(ctx context.Context, p *models.ColumnPrivacy) (*models.ColumnPrivacy, error) {
+	q := `INSERT INTO column_privacy (dataset_id, column_name, category, mechanism, epsilon, delta, sensitivity, updated_by)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+          ON CONFLICT (dataset_id, column_name) DO UPDATE SET
+              category=EXCLUDED.category, mechanism=EXCLUDED.mechanism, epsilon=EXCLUDED.epsilon,
+              delta=EXCLUDED.delta, sensitivity=EXCLUDED.sensitivity, updated_by=EXCLUDED.updated_by, updated_at=NOW()
+          RETURNING ` + columnPrivacyColumns
+	var out models.ColumnPrivacy
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, p.DatasetID, p.ColumnName, p.Category, p.Mechanism, p.Epsilon, p.Delta,
+		p.Sensitivity, p.UpdatedBy).StructScan(&out); err != nil {
+		return nil, wrap("column privacy upsert", err)
+	}
+	return &out, nil
+}
+
+func (r *ColumnPrivacyRepo) List(ctx context.Context, datasetID int64) ([]models.ColumnPrivacy, error) {
+	q := `SELECT ` + columnPrivacyColumns + ` FROM column_privacy WHERE dataset_id=$1 ORDER BY column_name`
+	var out []models.ColumnPrivacy
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID)
+	return out, wrap("column privacy list", err)
+}
+
+// Delete removes a column's setting; sql.ErrNoRows when it has none
+func (r *ColumnPrivacyRepo) Delete(ctx context.Context, datasetID int64, column string) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM column_privacy WHERE dataset_id=$1 AND column_name=$2`, datasetID, column)
+	if err != nil {
+		return wrap("column privacy delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
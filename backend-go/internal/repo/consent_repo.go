@@ -0,0 +1,88 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// ConsentRepo stores the append-only history of document acceptances and
+// email consent flags
+type ConsentRepo struct{ db *sqlx.DB }
+
+func NewConsentRepo(db *sqlx.DB) *ConsentRepo { return &ConsentRepo{db: db} }
+
+func (r *ConsentRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS consent_records (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        kind TEXT NOT NULL,
+        version TEXT NOT NULL DEFAULT '',
+        granted BOOLEAN NOT NULL,
+        ip_address TEXT NOT NULL DEFAULT '',
+        user_agent TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_consent_records_user ON consent_records(user_id, kind, created_at DESC)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("consent create schema", err)
+}
+
+const consentRecordColumns = `id, user_id, kind, version, granted, ip_address, user_agent, created_at`
+
+// Record appends consent records together
+func (r *ConsentRepo) Record(ctx context.Context, recs []models.ConsentRecord) ([]models.ConsentRecord, error) {
+	q := `INSERT INTO consent_records (user_id, kind, version, granted, ip_address, user_agent)
+          VALUES ($1,$2,$3,$4,$5,$6)
+          RETURNING ` + consentRecordColumns
+	out := make([]models.ConsentRecord, 0, len(recs))
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		for _, rec := range recs {
+			var saved models.ConsentRecord
+			if err := conn(ctx, r.db).QueryRowxContext(ctx, q, rec.UserID, rec.Kind, rec.Version, rec.Granted, rec.IPAddress, rec.UserAgent).StructScan(&saved); err != nil {
+				return err
+			}
+			out = append(out, saved)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrap("consent record", err)
+	}
+	return out, nil
+}
+
+// Latest returns a user's most recent record of each kind
+func (r *ConsentRepo) Latest(ctx context.Context, userID int64) (map[models.ConsentKind]models.ConsentRecord, error) {
+	q := `SELECT DISTINCT ON (kind) ` + consentRecordColumns + ` FROM consent_records
+          WHERE user_id=$1 ORDER BY kind, created_at DESC, id DESC`
+	var recs []models.ConsentRecord
+	if err := conn(ctx, r.db).SelectContext(ctx, &recs, q, userID); err != nil {
+		return nil, wrap("consent latest", err)
+	}
+	out := make(map[models.ConsentKind]models.ConsentRecord, len(recs))
+	for _, rec := range recs {
+		out[rec.Kind] = rec
+	}
+	return out, nil
+}
+
+// History returns a user's consent records, newest first
+func (r *ConsentRepo) History(ctx context.Context, userID int64, limit int) ([]models.ConsentRecord, error) {
+	q := `SELECT ` + consentRecordColumns + ` FROM consent_records
+          WHERE user_id=$1 ORDER BY created_at DESC, id DESC LIMIT $2`
+	var out []models.ConsentRecord
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID, limit)
+	return out, wrap("consent history", err)
+}
+
+// Granted reports whether a user's latest record of a kind grants it; a
+// user with no record has not consented
+func (r *ConsentRepo) Granted(ctx context.Context, userID int64, kind models.ConsentKind) (bool, error) {
+	q := `SELECT COALESCE((SELECT granted FROM consent_records
+          WHERE user_id=$1 AND kind=$2 ORDER BY created_at DESC, id DESC LIMIT 1), FALSE)`
+	var granted bool
+	err := conn(ctx, r.db).GetContext(ctx, &granted, q, userID, kind)
+	return granted, wrap("consent granted", err)
+}
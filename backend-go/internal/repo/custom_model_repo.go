@@ -39,75 +39,92 @@ func (r *CustomModelRepo) CreateSchema(ctx context.Context) error {
         model_metadata TEXT NULL,
         created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
         updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-    )`
-	_, err := r.db.ExecContext(ctx, stmt)
-	return err
+    );
+    ALTER TABLE custom_models ADD COLUMN IF NOT EXISTS org_id BIGINT NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("custom model create schema", err)
 }
 
 func (r *CustomModelRepo) Insert(ctx context.Context, model *models.CustomModel) (*models.CustomModel, error) {
 	query := `INSERT INTO custom_models (owner_id, name, description, model_type, status, version,
 		framework_version, accuracy_score, validation_metrics, model_s3_key, config_s3_key,
 		requirements_s3_key, file_size, supported_column_types, max_columns, max_rows,
-		requires_gpu, tags, model_metadata)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
-		RETURNING id, owner_id, name, description, model_type, status, version, framework_version,
+		requires_gpu, tags, model_metadata, org_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19,
+		(SELECT org_id FROM org_members WHERE user_id = $1))
+		RETURNING id, owner_id, org_id, name, description, model_type, status, version, framework_version,
 		accuracy_score, validation_metrics, model_s3_key, config_s3_key, requirements_s3_key,
 		file_size, supported_column_types, max_columns, max_rows, requires_gpu, usage_count,
 		last_used_at, tags, model_metadata, created_at, updated_at`
 
 	var result models.CustomModel
-	err := r.db.GetContext(ctx, &result, query,
+	err := conn(ctx, r.db).GetContext(ctx, &result, query,
 		model.OwnerID, model.Name, model.Description, model.ModelType, model.Status,
 		model.Version, model.FrameworkVersion, model.AccuracyScore, model.ValidationMetrics,
 		model.ModelS3Key, model.ConfigS3Key, model.RequirementsS3Key, model.FileSize,
 		model.SupportedColumnTypes, model.MaxColumns, model.MaxRows, model.RequiresGPU,
 		model.Tags, model.ModelMetadata)
 
-	return &result, err
+	return &result, wrap("custom model insert", err)
 }
 
 func (r *CustomModelRepo) GetByID(ctx context.Context, id int64) (*models.CustomModel, error) {
 	query := `SELECT * FROM custom_models WHERE id = $1`
 	var model models.CustomModel
-	err := r.db.GetContext(ctx, &model, query, id)
-	return &model, err
+	err := conn(ctx, r.db).GetContext(ctx, &model, query, id)
+	return &model, wrap("custom model get by id", err)
 }
 
 func (r *CustomModelRepo) GetByOwner(ctx context.Context, ownerID int64) ([]models.CustomModel, error) {
 	query := `SELECT * FROM custom_models WHERE owner_id = $1 ORDER BY created_at DESC`
 	var models []models.CustomModel
-	err := r.db.SelectContext(ctx, &models, query, ownerID)
-	return models, err
+	err := conn(ctx, r.db).SelectContext(ctx, &models, query, ownerID)
+	return models, wrap("custom model get by owner", err)
+}
+
+// GetByOrg returns the custom models shared with an organization
+func (r *CustomModelRepo) GetByOrg(ctx context.Context, orgID int64) ([]models.CustomModel, error) {
+	query := `SELECT * FROM custom_models WHERE org_id = $1 ORDER BY created_at DESC`
+	var models []models.CustomModel
+	err := conn(ctx, r.db).SelectContext(ctx, &models, query, orgID)
+	return models, wrap("custom model get by org", err)
 }
 
 func (r *CustomModelRepo) UpdateStatus(ctx context.Context, id int64, status models.CustomModelStatus) error {
 	query := `UPDATE custom_models SET status = $1, updated_at = NOW() WHERE id = $2`
-	_, err := r.db.ExecContext(ctx, query, status, id)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, status, id)
+	return wrap("custom model update status", err)
 }
 
 func (r *CustomModelRepo) UpdateValidationMetrics(ctx context.Context, id int64, metrics string) error {
 	query := `UPDATE custom_models SET validation_metrics = $1, updated_at = NOW() WHERE id = $2`
-	_, err := r.db.ExecContext(ctx, query, metrics, id)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, metrics, id)
+	return wrap("custom model update validation metrics", err)
+}
+
+// UpdateModelKey records the storage key of a model's uploaded artifact
+func (r *CustomModelRepo) UpdateModelKey(ctx context.Context, id int64, key string) error {
+	query := `UPDATE custom_models SET model_s3_key = $1, updated_at = NOW() WHERE id = $2`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, key, id)
+	return wrap("custom model update model key", err)
 }
 
 func (r *CustomModelRepo) UpdateAccuracyScore(ctx context.Context, id int64, score float64) error {
 	query := `UPDATE custom_models SET accuracy_score = $1, updated_at = NOW() WHERE id = $2`
-	_, err := r.db.ExecContext(ctx, query, score, id)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, score, id)
+	return wrap("custom model update accuracy score", err)
 }
 
 func (r *CustomModelRepo) IncrementUsage(ctx context.Context, id int64) error {
 	query := `UPDATE custom_models SET usage_count = usage_count + 1, last_used_at = NOW() WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id)
+	return wrap("custom model increment usage", err)
 }
 
 func (r *CustomModelRepo) Delete(ctx context.Context, id int64, ownerID int64) error {
 	query := `DELETE FROM custom_models WHERE id = $1 AND owner_id = $2`
-	_, err := r.db.ExecContext(ctx, query, id, ownerID)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, id, ownerID)
+	return wrap("custom model delete", err)
 }
 
 func (r *CustomModelRepo) GetSupportedFrameworks() []string {
@@ -148,6 +165,6 @@ func (r *CustomModelRepo) ValidateModel(ctx context.Context, model *models.Custo
 func (r *CustomModelRepo) GetCountByOwner(ctx context.Context, ownerID int64) (int64, error) {
 	query := `SELECT COUNT(*) FROM custom_models WHERE owner_id = $1`
 	var count int64
-	err := r.db.GetContext(ctx, &count, query, ownerID)
-	return count, err
+	err := conn(ctx, r.db).GetContext(ctx, &count, query, ownerID)
+	return count, wrap("custom model get count by owner", err)
 }
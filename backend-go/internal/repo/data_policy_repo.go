@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// DataPolicyRepo stores per-organization policies on real data reaching
+// generation providers
+type DataPolicyRepo struct{ db *sqlx.DB }
+
+func NewDataPolicyRepo(db *sqlx.DB) *DataPolicyRepo { return &DataPolicyRepo{db: db} }
+
+func (r *DataPolicyRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS org_data_policies (
+        org_id BIGINT PRIMARY KEY,
+        zero_real_data BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("data policy create schema", err)
+}
+
+func (r *DataPolicyRepo) GetByOrgID(ctx context.Context, orgID int64) (*models.DataPolicy, error) {
+	q := `SELECT org_id, zero_real_data, created_at, updated_at FROM org_data_policies WHERE org_id=$1`
+	var p models.DataPolicy
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, orgID).StructScan(&p); err != nil {
+		return nil, wrap("data policy get by org id", err)
+	}
+	return &p, nil
+}
+
+func (r *DataPolicyRepo) Upsert(ctx context.Context, p *models.DataPolicy) (*models.DataPolicy, error) {
+	q := `INSERT INTO org_data_policies (org_id, zero_real_data) VALUES ($1,$2)
+          ON CONFLICT (org_id) DO UPDATE SET zero_real_data=EXCLUDED.zero_real_data, updated_at=NOW()
+          RETURNING org_id, zero_real_data, created_at, updated_at`
+	var out models.DataPolicy
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, p.OrgID, p.ZeroRealData).StructScan(&out); err != nil {
+		return nil, wrap("data policy upsert", err)
+	}
+	return &out, nil
+}
+
+// ZeroRealDataForUser reports whether the organization of a user enforces
+// zero-real-data generation. Users outside any organization are never bound.
+func (r *DataPolicyRepo) ZeroRealDataForUser(ctx context.Context, userID int64) (bool, error) {
+	q := `SELECT p.zero_real_data FROM users u JOIN org_data_policies p ON p.org_id = u.org_id WHERE u.id=$1`
+	var on bool
+	err := conn(ctx, r.db).GetContext(ctx, &on, q, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return on, wrap("data policy zero real data for user", err)
+}
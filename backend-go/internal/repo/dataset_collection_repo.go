@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// DatasetCollectionRepo stores saved dataset searches
+type DatasetCollectionRepo struct{ db *sqlx.DB }
+
+func NewDatasetCollectionRepo(db *sqlx.DB) *DatasetCollectionRepo {
+	return &DatasetCollectionRepo{db: db}
+}
+
+func (r *DatasetCollectionRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS dataset_collections (
+        id BIGSERIAL PRIMARY KEY,
+        owner_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        org_id BIGINT NULL,
+        name TEXT NOT NULL,
+        description TEXT NULL,
+        filter JSONB NOT NULL DEFAULT '{}',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_dataset_collections_owner ON dataset_collections(owner_id);
+    CREATE INDEX IF NOT EXISTS idx_dataset_collections_org ON dataset_collections(org_id) WHERE org_id IS NOT NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("dataset collection create schema", err)
+}
+
+const collectionColumns = `id, owner_id, org_id, name, description, filter, created_at, updated_at`
+
+// Insert saves a collection; shared collections carry the organization they
+// are shared with
+func (r *DatasetCollectionRepo) Insert(ctx context.Context, c *models.DatasetCollection) (*models.DatasetCollection, error) {
+	q := `INSERT INTO dataset_collections (owner_id, org_id, name, description, filter)
+          VALUES ($1,$2,$3,$4,$5) RETURNING ` + collectionColumns
+	var out models.DatasetCollection
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, c.OwnerID, c.OrgID, c.Name, c.Description, c.Filter); err != nil {
+		return nil, wrap("dataset collection insert", err)
+	}
+	return &out, nil
+}
+
+// Get returns a collection the user owns or that is shared with orgID
+func (r *DatasetCollectionRepo) Get(ctx context.Context, id, userID int64, orgID *int64) (*models.DatasetCollection, error) {
+	q := `SELECT ` + collectionColumns + ` FROM dataset_collections WHERE id=$1 AND (owner_id=$2 OR org_id=$3)`
+	var out models.DatasetCollection
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, id, userID, orgID); err != nil {
+		return nil, wrap("dataset collection get", err)
+	}
+	return &out, nil
+}
+
+// List returns the collections a user owns and those shared with orgID, by
+// name
+func (r *DatasetCollectionRepo) List(ctx context.Context, userID int64, orgID *int64) ([]models.DatasetCollection, error) {
+	q := `SELECT ` + collectionColumns + ` FROM dataset_collections
+          WHERE owner_id=$1 OR org_id=$2 ORDER BY lower(name), id`
+	out := []models.DatasetCollection{}
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID, orgID)
+	return out, wrap("dataset collection list", err)
+}
+
+// Update replaces the name, description, filter and sharing of a collection.
+// It returns sql.ErrNoRows when the owner has no such collection.
+func (r *DatasetCollectionRepo) Update(ctx context.Context, c *models.DatasetCollection) (*models.DatasetCollection, error) {
+	q := `UPDATE dataset_collections SET org_id=$1, name=$2, description=$3, filter=$4, updated_at=NOW()
+          WHERE id=$5 AND owner_id=$6 RETURNING ` + collectionColumns
+	var out models.DatasetCollection
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, c.OrgID, c.Name, c.Description, c.Filter, c.ID, c.OwnerID); err != nil {
+		return nil, wrap("dataset collection update", err)
+	}
+	return &out, nil
+}
+
+// Delete removes a collection. It returns sql.ErrNoRows when the owner has
+// no such collection.
+func (r *DatasetCollectionRepo) Delete(ctx context.Context, owner, id int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM dataset_collections WHERE id=$1 AND owner_id=$2`, id, owner)
+	if err != nil {
+		return wrap("dataset collection delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Package repo_test provides unit tests for saved dataset searches
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatasetRepo_Search(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	datasets := repo.NewDatasetRepo(testDB.DB)
+
+	org := int64(9)
+	f := models.DatasetFilter{
+		Query:             "50%_off",
+		PrivacyCategories: []models.PrivacyCategory{models.PrivacyCategoryHealth},
+		UpdatedPeriod:     "month",
+	}
+	testDB.Mock.ExpectQuery(`FROM datasets d WHERE \(d.owner_id = \$1 OR d.org_id = \$2\) AND d.status <> 'archived' AND \(d.name ILIKE \$3 OR d.description ILIKE \$3\) AND EXISTS \(SELECT 1 FROM column_privacy cp .* AND d.updated_at >= date_trunc\(\$5::text, NOW\(\)\) ORDER BY d.created_at DESC LIMIT \$6 OFFSET \$7`).
+		WithArgs(int64(3), &org, `%50\%\_off%`, sqlmock.AnyArg(), "month", 100, 0).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "owner_id", "org_id", "name", "status"}).AddRow(1, 4, 9, "claims", "ready"))
+
+	items, err := datasets.Search(context.Background(), f, 3, &org, 100, 0)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "claims", items[0].Name)
+	testDB.AssertExpectations(t)
+}
+
+func TestDatasetRepo_CountMatchingArchived(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	datasets := repo.NewDatasetRepo(testDB.DB)
+
+	f := models.DatasetFilter{Statuses: []models.DatasetStatus{models.DatasetArchived}, MinRows: 1000}
+	testDB.Mock.ExpectQuery(`SELECT COUNT\(\*\) FROM datasets d WHERE \(d.owner_id = \$1 OR d.org_id = \$2\) AND d.status = ANY\(\$3\) AND d.row_count >= \$4$`).
+		WithArgs(int64(3), nil, sqlmock.AnyArg(), int64(1000)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	count, err := datasets.CountMatching(context.Background(), f, 3, nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+	testDB.AssertExpectations(t)
+}
+
+func TestDatasetCollectionRepo_DeleteNotOwner(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	collections := repo.NewDatasetCollectionRepo(testDB.DB)
+
+	testDB.Mock.ExpectExec("DELETE FROM dataset_collections").WithArgs(int64(5), int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.ErrorIs(t, collections.Delete(context.Background(), 3, 5), sql.ErrNoRows)
+	testDB.AssertExpectations(t)
+}
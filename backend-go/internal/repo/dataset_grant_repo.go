@@ -0,0 +1,271 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/jmoiron/sqlx"
+)
+
+// DatasetGrantRepo manages per-dataset and per-column ACLs and the groups they can target
+type DatasetGrantRepo struct{ db *sqlx.DB }
+
+func NewDatasetGrantRepo(db *sqlx.DB) *DatasetGrantRepo { return &DatasetGrantRepo{db: db} }
+
+func (r *DatasetGrantRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS user_groups (
+        id BIGSERIAL PRIMARY KEY,
+        owner_id BIGINT NOT NULL,
+        name TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (owner_id, name)
+    );
+    CREATE TABLE IF NOT EXISTS user_group_members (
+        group_id BIGINT NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+        user_id BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (group_id, user_id)
+    );
+    CREATE TABLE IF NOT EXISTS dataset_grants (
+        id BIGSERIAL PRIMARY KEY,
+        dataset_id BIGINT NOT NULL,
+        grantee_type TEXT NOT NULL,
+        grantee_id BIGINT NOT NULL,
+        permission TEXT NOT NULL,
+        granted_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (dataset_id, grantee_type, grantee_id, permission)
+    );
+    CREATE INDEX IF NOT EXISTS idx_dataset_grants_grantee ON dataset_grants(grantee_type, grantee_id);
+    CREATE TABLE IF NOT EXISTS column_restrictions (
+        id BIGSERIAL PRIMARY KEY,
+        dataset_id BIGINT NOT NULL,
+        column_name TEXT NOT NULL,
+        export_action TEXT NOT NULL DEFAULT 'exclude',
+        created_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (dataset_id, column_name)
+    );
+    CREATE TABLE IF NOT EXISTS column_clearances (
+        id BIGSERIAL PRIMARY KEY,
+        dataset_id BIGINT NOT NULL,
+        column_name TEXT NOT NULL,
+        grantee_type TEXT NOT NULL,
+        grantee_id BIGINT NOT NULL,
+        granted_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (dataset_id, column_name, grantee_type, grantee_id)
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("dataset grant create schema", err)
+}
+
+func (r *DatasetGrantRepo) Insert(ctx context.Context, g *models.DatasetGrant) (*models.DatasetGrant, error) {
+	q := `INSERT INTO dataset_grants (dataset_id, grantee_type, grantee_id, permission, granted_by)
+          VALUES ($1,$2,$3,$4,$5)
+          ON CONFLICT (dataset_id, grantee_type, grantee_id, permission) DO UPDATE SET granted_by=EXCLUDED.granted_by
+          RETURNING id, dataset_id, grantee_type, grantee_id, permission, granted_by, created_at`
+	var out models.DatasetGrant
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, g.DatasetID, g.GranteeType, g.GranteeID, g.Permission, g.GrantedBy).StructScan(&out); err != nil {
+		return nil, wrap("dataset grant insert", err)
+	}
+	return &out, nil
+}
+
+func (r *DatasetGrantRepo) ListByDataset(ctx context.Context, datasetID int64) ([]models.DatasetGrant, error) {
+	q := `SELECT id, dataset_id, grantee_type, grantee_id, permission, granted_by, created_at
+          FROM dataset_grants WHERE dataset_id=$1 ORDER BY created_at`
+	var out []models.DatasetGrant
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID)
+	return out, wrap("dataset grant list by dataset", err)
+}
+
+// Delete removes a grant and returns it so the change can be audited
+func (r *DatasetGrantRepo) Delete(ctx context.Context, datasetID, grantID int64) (*models.DatasetGrant, error) {
+	q := `DELETE FROM dataset_grants WHERE dataset_id=$1 AND id=$2
+          RETURNING id, dataset_id, grantee_type, grantee_id, permission, granted_by, created_at`
+	var out models.DatasetGrant
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, datasetID, grantID).StructScan(&out); err != nil {
+		return nil, wrap("dataset grant delete", err)
+	}
+	return &out, nil
+}
+
+// GetAccessibleDataset returns a dataset the user owns or holds the permission
+// on, directly, through a group or through a role in the organization it is
+// shared with. Generate grants imply read.
+func (r *DatasetGrantRepo) GetAccessibleDataset(ctx context.Context, userID, datasetID int64, perm models.DatasetPermission) (*models.Dataset, error) {
+	perms := []string{string(models.DatasetPermGenerate)}
+	roles := orgs.Roles(orgs.ActionWrite)
+	if perm == models.DatasetPermRead {
+		perms = append(perms, string(models.DatasetPermRead))
+		roles = orgs.Roles(orgs.ActionRead)
+	}
+	q, args, err := sqlx.In(`SELECT d.id, d.owner_id, d.org_id, d.name, d.description, d.status, d.original_filename, d.file_size, d.file_type, d.object_key, d.row_count, d.column_count, d.retention_days, d.created_at, d.updated_at
+          FROM datasets d
+          WHERE d.id = ? AND d.status <> 'archived' AND (
+              d.owner_id = ?
+              OR EXISTS (
+                  SELECT 1 FROM dataset_grants g
+                  WHERE g.dataset_id = d.id AND g.permission IN (?) AND (
+                      (g.grantee_type = 'user' AND g.grantee_id = ?)
+                      OR (g.grantee_type = 'group' AND g.grantee_id IN (
+                          SELECT group_id FROM user_group_members WHERE user_id = ?))
+                  )
+              )
+              OR (d.org_id IS NOT NULL AND EXISTS (
+                  SELECT 1 FROM org_members m
+                  WHERE m.org_id = d.org_id AND m.user_id = ? AND m.role IN (?)
+              ))
+          )`, datasetID, userID, perms, userID, userID, userID, roles)
+	if err != nil {
+		return nil, wrap("dataset grant get accessible dataset", err)
+	}
+	var d models.Dataset
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, r.db.Rebind(q), args...).StructScan(&d); err != nil {
+		return nil, wrap("dataset grant get accessible dataset", err)
+	}
+	return &d, nil
+}
+
+// ListSharedWith returns datasets shared with the user that they do not own
+func (r *DatasetGrantRepo) ListSharedWith(ctx context.Context, userID int64, limit, offset int) ([]models.Dataset, error) {
+	q := `SELECT d.id, d.owner_id, d.org_id, d.name, d.description, d.status, d.original_filename, d.file_size, d.file_type, d.object_key, d.row_count, d.column_count, d.retention_days, d.created_at, d.updated_at
+          FROM datasets d
+          WHERE d.owner_id <> $1 AND d.status <> 'archived' AND EXISTS (
+              SELECT 1 FROM dataset_grants g
+              WHERE g.dataset_id = d.id AND (
+                  (g.grantee_type = 'user' AND g.grantee_id = $1)
+                  OR (g.grantee_type = 'group' AND g.grantee_id IN (
+                      SELECT group_id FROM user_group_members WHERE user_id = $1))
+              )
+          )
+          ORDER BY d.created_at DESC LIMIT $2 OFFSET $3`
+	var out []models.Dataset
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID, limit, offset)
+	return out, wrap("dataset grant list shared with", err)
+}
+
+func (r *DatasetGrantRepo) UpsertColumnRestriction(ctx context.Context, cr *models.ColumnRestriction) (*models.ColumnRestriction, error) {
+	q := `INSERT INTO column_restrictions (dataset_id, column_name, export_action, created_by)
+          VALUES ($1,$2,$3,$4)
+          ON CONFLICT (dataset_id, column_name) DO UPDATE SET export_action=EXCLUDED.export_action
+          RETURNING id, dataset_id, column_name, export_action, created_by, created_at`
+	var out models.ColumnRestriction
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, cr.DatasetID, cr.ColumnName, cr.ExportAction, cr.CreatedBy).StructScan(&out); err != nil {
+		return nil, wrap("dataset grant upsert column restriction", err)
+	}
+	return &out, nil
+}
+
+func (r *DatasetGrantRepo) ListColumnRestrictions(ctx context.Context, datasetID int64) ([]models.ColumnRestriction, error) {
+	q := `SELECT id, dataset_id, column_name, export_action, created_by, created_at
+          FROM column_restrictions WHERE dataset_id=$1 ORDER BY column_name`
+	var out []models.ColumnRestriction
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID)
+	return out, wrap("dataset grant list column restrictions", err)
+}
+
+// DeleteColumnRestriction lifts a restriction along with its clearances
+func (r *DatasetGrantRepo) DeleteColumnRestriction(ctx context.Context, datasetID int64, column string) (*models.ColumnRestriction, error) {
+	q := `WITH cleared AS (
+              DELETE FROM column_clearances WHERE dataset_id=$1 AND column_name=$2
+          )
+          DELETE FROM column_restrictions WHERE dataset_id=$1 AND column_name=$2
+          RETURNING id, dataset_id, column_name, export_action, created_by, created_at`
+	var out models.ColumnRestriction
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, datasetID, column).StructScan(&out); err != nil {
+		return nil, wrap("dataset grant delete column restriction", err)
+	}
+	return &out, nil
+}
+
+func (r *DatasetGrantRepo) InsertColumnClearance(ctx context.Context, cc *models.ColumnClearance) (*models.ColumnClearance, error) {
+	q := `INSERT INTO column_clearances (dataset_id, column_name, grantee_type, grantee_id, granted_by)
+          VALUES ($1,$2,$3,$4,$5)
+          ON CONFLICT (dataset_id, column_name, grantee_type, grantee_id) DO UPDATE SET granted_by=EXCLUDED.granted_by
+          RETURNING id, dataset_id, column_name, grantee_type, grantee_id, granted_by, created_at`
+	var out models.ColumnClearance
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, cc.DatasetID, cc.ColumnName, cc.GranteeType, cc.GranteeID, cc.GrantedBy).StructScan(&out); err != nil {
+		return nil, wrap("dataset grant insert column clearance", err)
+	}
+	return &out, nil
+}
+
+func (r *DatasetGrantRepo) ListColumnClearances(ctx context.Context, datasetID int64) ([]models.ColumnClearance, error) {
+	q := `SELECT id, dataset_id, column_name, grantee_type, grantee_id, granted_by, created_at
+          FROM column_clearances WHERE dataset_id=$1 ORDER BY column_name, created_at`
+	var out []models.ColumnClearance
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID)
+	return out, wrap("dataset grant list column clearances", err)
+}
+
+func (r *DatasetGrantRepo) DeleteColumnClearance(ctx context.Context, datasetID, clearanceID int64) (*models.ColumnClearance, error) {
+	q := `DELETE FROM column_clearances WHERE dataset_id=$1 AND id=$2
+          RETURNING id, dataset_id, column_name, grantee_type, grantee_id, granted_by, created_at`
+	var out models.ColumnClearance
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, datasetID, clearanceID).StructScan(&out); err != nil {
+		return nil, wrap("dataset grant delete column clearance", err)
+	}
+	return &out, nil
+}
+
+// ClearedColumns returns the restricted columns of a dataset the user may see
+// unmasked, directly or through a group
+func (r *DatasetGrantRepo) ClearedColumns(ctx context.Context, userID, datasetID int64) ([]string, error) {
+	q := `SELECT DISTINCT column_name FROM column_clearances
+          WHERE dataset_id=$1 AND (
+              (grantee_type = 'user' AND grantee_id = $2)
+              OR (grantee_type = 'group' AND grantee_id IN (
+                  SELECT group_id FROM user_group_members WHERE user_id = $2))
+          )`
+	var out []string
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID, userID)
+	return out, wrap("dataset grant cleared columns", err)
+}
+
+func (r *DatasetGrantRepo) CreateGroup(ctx context.Context, ownerID int64, name string) (*models.UserGroup, error) {
+	q := `INSERT INTO user_groups (owner_id, name) VALUES ($1,$2)
+          RETURNING id, owner_id, name, created_at`
+	var out models.UserGroup
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, ownerID, name).StructScan(&out); err != nil {
+		return nil, wrap("dataset grant create group", err)
+	}
+	return &out, nil
+}
+
+func (r *DatasetGrantRepo) ListGroups(ctx context.Context, ownerID int64) ([]models.UserGroup, error) {
+	q := `SELECT id, owner_id, name, created_at FROM user_groups WHERE owner_id=$1 ORDER BY name`
+	var out []models.UserGroup
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, ownerID)
+	return out, wrap("dataset grant list groups", err)
+}
+
+func (r *DatasetGrantRepo) GetGroup(ctx context.Context, ownerID, groupID int64) (*models.UserGroup, error) {
+	q := `SELECT id, owner_id, name, created_at FROM user_groups WHERE owner_id=$1 AND id=$2`
+	var out models.UserGroup
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, ownerID, groupID).StructScan(&out); err != nil {
+		return nil, wrap("dataset grant get group", err)
+	}
+	return &out, nil
+}
+
+func (r *DatasetGrantRepo) AddGroupMember(ctx context.Context, groupID, userID int64) error {
+	q := `INSERT INTO user_group_members (group_id, user_id) VALUES ($1,$2) ON CONFLICT DO NOTHING`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, groupID, userID)
+	return wrap("dataset grant add group member", err)
+}
+
+func (r *DatasetGrantRepo) RemoveGroupMember(ctx context.Context, groupID, userID int64) error {
+	q := `DELETE FROM user_group_members WHERE group_id=$1 AND user_id=$2`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, groupID, userID)
+	return wrap("dataset grant remove group member", err)
+}
+
+func (r *DatasetGrantRepo) ListGroupMembers(ctx context.Context, groupID int64) ([]int64, error) {
+	q := `SELECT user_id FROM user_group_members WHERE group_id=$1 ORDER BY user_id`
+	var out []int64
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, groupID)
+	return out, wrap("dataset grant list group members", err)
+}
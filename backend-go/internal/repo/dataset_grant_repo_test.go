@@ -0,0 +1,87 @@
+// Package repo_test provides unit tests for dataset sharing
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// accessibleArgs are the arguments GetAccessibleDataset binds for a user
+// asking for a dataset with the grants and org roles that allow it
+func accessibleArgs(userID, datasetID int64, perms []string, action orgs.Action) []driver.Value {
+	args := []driver.Value{datasetID, userID}
+	for _, p := range perms {
+		args = append(args, p)
+	}
+	args = append(args, userID, userID, userID)
+	for _, role := range orgs.Roles(action) {
+		args = append(args, string(role))
+	}
+	return args
+}
+
+func datasetRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "owner_id", "name", "status"})
+}
+
+func TestDatasetGrantRepo_GetAccessibleDatasetGenerateImpliesRead(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	grants := repo.NewDatasetGrantRepo(testDB.DB)
+
+	// Reading is allowed by a read or a generate grant
+	testDB.Mock.ExpectQuery(`FROM datasets d\s+WHERE d.id = \? AND d.status <> 'archived'.*g.permission IN \(\?, \?\)`).
+		WithArgs(accessibleArgs(3, 5, []string{"generate", "read"}, orgs.ActionRead)...).
+		WillReturnRows(datasetRows().AddRow(5, 4, "claims", "ready"))
+	ds, err := grants.GetAccessibleDataset(context.Background(), 3, 5, models.DatasetPermRead)
+	require.NoError(t, err)
+	assert.Equal(t, "claims", ds.Name)
+
+	// Generating needs a generate grant; a read grant is not enough
+	testDB.Mock.ExpectQuery(`g.permission IN \(\?\)`).
+		WithArgs(accessibleArgs(3, 5, []string{"generate"}, orgs.ActionWrite)...).
+		WillReturnError(sql.ErrNoRows)
+	_, err = grants.GetAccessibleDataset(context.Background(), 3, 5, models.DatasetPermGenerate)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	testDB.AssertExpectations(t)
+}
+
+func TestDatasetGrantRepo_GetAccessibleDatasetThroughGroup(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	grants := repo.NewDatasetGrantRepo(testDB.DB)
+
+	testDB.Mock.ExpectQuery(`\(g.grantee_type = 'group' AND g.grantee_id IN \(\s+SELECT group_id FROM user_group_members WHERE user_id = \?\)\)`).
+		WithArgs(accessibleArgs(8, 5, []string{"generate"}, orgs.ActionWrite)...).
+		WillReturnRows(datasetRows().AddRow(5, 4, "claims", "ready"))
+
+	ds, err := grants.GetAccessibleDataset(context.Background(), 8, 5, models.DatasetPermGenerate)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), ds.OwnerID, "a group member reaches a dataset they do not own")
+	testDB.AssertExpectations(t)
+}
+
+func TestDatasetGrantRepo_GetAccessibleDatasetArchived(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	grants := repo.NewDatasetGrantRepo(testDB.DB)
+
+	// Archived datasets match no grant, not even their owner's
+	testDB.Mock.ExpectQuery(`WHERE d.id = \? AND d.status <> 'archived' AND \(\s+d.owner_id = \?`).
+		WithArgs(accessibleArgs(4, 5, []string{"generate", "read"}, orgs.ActionRead)...).
+		WillReturnRows(datasetRows())
+
+	_, err := grants.GetAccessibleDataset(context.Background(), 4, 5, models.DatasetPermRead)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	testDB.AssertExpectations(t)
+}
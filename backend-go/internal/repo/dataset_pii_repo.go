@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// DatasetPIIRepo stores the PII classification of dataset columns
+type DatasetPIIRepo struct{ db *sqlx.DB }
+
+func NewDatasetPIIRepo(db *sqlx.DB) *DatasetPIIRepo { return &DatasetPIIRepo{db: db} }
+
+func (r *DatasetPIIRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS dataset_pii (
+        dataset_id BIGINT NOT NULL,
+        column_name TEXT NOT NULL,
+        kinds TEXT[] NOT NULL,
+        category TEXT NOT NULL,
+        share DOUBLE PRECISION NOT NULL,
+        detectors TEXT[] NOT NULL,
+        scanned_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (dataset_id, column_name)
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("dataset pii create schema", err)
+}
+
+const datasetPIIColumns = `dataset_id, column_name, kinds, category, share, detectors, scanned_at`
+
+// Replace stores the result of a scan in place of the last one
+func (r *DatasetPIIRepo) Replace(ctx context.Context, datasetID int64, columns []models.DatasetPII) ([]models.DatasetPII, error) {
+	out := []models.DatasetPII{}
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM dataset_pii WHERE dataset_id=$1`, datasetID); err != nil {
+			return err
+		}
+		q := `INSERT INTO dataset_pii (dataset_id, column_name, kinds, category, share, detectors)
+              VALUES ($1,$2,$3,$4,$5,$6)
+              RETURNING ` + datasetPIIColumns
+		for _, c := range columns {
+			var row models.DatasetPII
+			if err := conn(ctx, r.db).QueryRowxContext(ctx, q, datasetID, c.ColumnName, c.Kinds, c.Category, c.Share,
+				c.Detectors).StructScan(&row); err != nil {
+				return err
+			}
+			out = append(out, row)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrap("dataset pii replace", err)
+	}
+	return out, nil
+}
+
+func (r *DatasetPIIRepo) List(ctx context.Context, datasetID int64) ([]models.DatasetPII, error) {
+	q := `SELECT ` + datasetPIIColumns + ` FROM dataset_pii WHERE dataset_id=$1 ORDER BY column_name`
+	var out []models.DatasetPII
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID)
+	return out, wrap("dataset pii list", err)
+}
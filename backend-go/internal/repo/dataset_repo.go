@@ -2,9 +2,13 @@ package repo
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
+	"strings"
 
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
 type DatasetRepo struct{ db *sqlx.DB }
@@ -26,66 +30,209 @@ func (r *DatasetRepo) CreateSchema(ctx context.Context) error {
         column_count BIGINT NOT NULL DEFAULT 0,
         created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
         updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-    )`
-	_, err := r.db.ExecContext(ctx, stmt)
-	return err
+    );
+    ALTER TABLE datasets ADD COLUMN IF NOT EXISTS zero_real_data BOOLEAN NOT NULL DEFAULT FALSE;
+    ALTER TABLE datasets ADD COLUMN IF NOT EXISTS retention_days INT NULL;
+    ALTER TABLE datasets ADD COLUMN IF NOT EXISTS weight_column TEXT NULL;
+    ALTER TABLE datasets ADD COLUMN IF NOT EXISTS org_id BIGINT NULL;
+    CREATE INDEX IF NOT EXISTS idx_datasets_org ON datasets(org_id, created_at DESC) WHERE org_id IS NOT NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("dataset create schema", err)
 }
 
 func (r *DatasetRepo) Insert(ctx context.Context, d *models.Dataset) (*models.Dataset, error) {
-	q := `INSERT INTO datasets (owner_id, name, description, status, original_filename, file_size, file_type, row_count, column_count)
-          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
-          RETURNING id, owner_id, name, description, status, original_filename, file_size, file_type, object_key, row_count, column_count, created_at, updated_at`
+	q := `INSERT INTO datasets (owner_id, name, description, status, original_filename, file_size, file_type, row_count, column_count, retention_days, org_id)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,(SELECT org_id FROM org_members WHERE user_id=$1))
+          RETURNING id, owner_id, org_id, name, description, status, original_filename, file_size, file_type, object_key, row_count, column_count, retention_days, created_at, updated_at`
 	var out models.Dataset
-	if err := r.db.QueryRowxContext(ctx, q, d.OwnerID, d.Name, d.Description, d.Status, d.OriginalFile, d.FileSize, d.FileType, d.RowCount, d.ColumnCount).StructScan(&out); err != nil {
-		return nil, err
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, d.OwnerID, d.Name, d.Description, d.Status, d.OriginalFile, d.FileSize, d.FileType, d.RowCount, d.ColumnCount, d.RetentionDays).StructScan(&out); err != nil {
+		return nil, wrap("dataset insert", err)
 	}
 	return &out, nil
 }
 
 func (r *DatasetRepo) UpdateObjectKey(ctx context.Context, id int64, key string, status models.DatasetStatus) error {
 	q := `UPDATE datasets SET object_key=$1, status=$2, updated_at=NOW() WHERE id=$3`
-	_, err := r.db.ExecContext(ctx, q, key, status, id)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, key, status, id)
+	return wrap("dataset update object key", err)
 }
 
 func (r *DatasetRepo) ListByOwner(ctx context.Context, owner int64, limit, offset int) ([]models.Dataset, error) {
-	q := `SELECT id, owner_id, name, description, status, original_filename, file_size, file_type, object_key, row_count, column_count, created_at, updated_at
+	q := `SELECT id, owner_id, org_id, name, description, status, original_filename, file_size, file_type, object_key, row_count, column_count, retention_days, created_at, updated_at
           FROM datasets WHERE owner_id=$1 AND status <> 'archived' ORDER BY created_at DESC LIMIT $2 OFFSET $3`
-	rows, err := r.db.QueryxContext(ctx, q, owner, limit, offset)
+	rows, err := conn(ctx, r.db).QueryxContext(ctx, q, owner, limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, wrap("dataset list by owner", err)
 	}
 	defer rows.Close()
 	var res []models.Dataset
 	for rows.Next() {
 		var d models.Dataset
 		if err := rows.StructScan(&d); err != nil {
-			return nil, err
+			return nil, wrap("dataset list by owner", err)
 		}
 		res = append(res, d)
 	}
-	return res, rows.Err()
+	return res, wrap("dataset list by owner", rows.Err())
+}
+
+// ListByOrg returns the live datasets shared with an organization
+func (r *DatasetRepo) ListByOrg(ctx context.Context, orgID int64, limit, offset int) ([]models.Dataset, error) {
+	q := `SELECT id, owner_id, org_id, name, description, status, original_filename, file_size, file_type, object_key, row_count, column_count, retention_days, created_at, updated_at
+          FROM datasets WHERE org_id=$1 AND status <> 'archived' ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	var res []models.Dataset
+	err := conn(ctx, r.db).SelectContext(ctx, &res, q, orgID, limit, offset)
+	return res, wrap("dataset list by org", err)
 }
 
 func (r *DatasetRepo) GetByOwnerID(ctx context.Context, owner, id int64) (*models.Dataset, error) {
-	q := `SELECT id, owner_id, name, description, status, original_filename, file_size, file_type, object_key, row_count, column_count, created_at, updated_at
+	q := `SELECT id, owner_id, org_id, name, description, status, original_filename, file_size, file_type, object_key, row_count, column_count, retention_days, created_at, updated_at
           FROM datasets WHERE owner_id=$1 AND id=$2`
 	var d models.Dataset
-	if err := r.db.QueryRowxContext(ctx, q, owner, id).StructScan(&d); err != nil {
-		return nil, err
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, owner, id).StructScan(&d); err != nil {
+		return nil, wrap("dataset get by owner id", err)
 	}
 	return &d, nil
 }
 
 func (r *DatasetRepo) Archive(ctx context.Context, owner, id int64) error {
 	q := `UPDATE datasets SET status='archived', updated_at=NOW() WHERE owner_id=$1 AND id=$2`
-	_, err := r.db.ExecContext(ctx, q, owner, id)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, owner, id)
+	return wrap("dataset archive", err)
+}
+
+// ArchiveExpired archives datasets kept longer than their retention period
+// and returns how many were archived
+func (r *DatasetRepo) ArchiveExpired(ctx context.Context) (int64, error) {
+	q := `UPDATE datasets SET status='archived', updated_at=NOW()
+          WHERE retention_days IS NOT NULL AND status <> 'archived'
+            AND created_at + make_interval(days => retention_days) < NOW()`
+	res, err := conn(ctx, r.db).ExecContext(ctx, q)
+	if err != nil {
+		return 0, wrap("dataset archive expired", err)
+	}
+	return res.RowsAffected()
+}
+
+// SetZeroRealData marks whether no source rows of a dataset may ever be sent
+// to a generation provider. It returns sql.ErrNoRows when the owner has no
+// such dataset.
+func (r *DatasetRepo) SetZeroRealData(ctx context.Context, owner, id int64, on bool) error {
+	q := `UPDATE datasets SET zero_real_data=$1, updated_at=NOW() WHERE owner_id=$2 AND id=$3`
+	res, err := conn(ctx, r.db).ExecContext(ctx, q, on, owner, id)
+	if err != nil {
+		return wrap("dataset set zero real data", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DataPolicy returns the owner of a dataset and whether it is restricted to
+// schema-only generation
+func (r *DatasetRepo) DataPolicy(ctx context.Context, id int64) (owner int64, zeroRealData bool, err error) {
+	row := conn(ctx, r.db).QueryRowxContext(ctx, `SELECT owner_id, zero_real_data FROM datasets WHERE id=$1`, id)
+	err = row.Scan(&owner, &zeroRealData)
+	return owner, zeroRealData, wrap("dataset data policy", err)
+}
+
+// SetWeightColumn sets the column holding the sampling weight of each row,
+// or clears it with nil. It returns sql.ErrNoRows when the owner has no such
+// dataset.
+func (r *DatasetRepo) SetWeightColumn(ctx context.Context, owner, id int64, column *string) error {
+	q := `UPDATE datasets SET weight_column=$1, updated_at=NOW() WHERE owner_id=$2 AND id=$3`
+	res, err := conn(ctx, r.db).ExecContext(ctx, q, column, owner, id)
+	if err != nil {
+		return wrap("dataset set weight column", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// WeightColumn returns the sampling weight column of a dataset, nil when its
+// rows are unweighted
+func (r *DatasetRepo) WeightColumn(ctx context.Context, id int64) (*string, error) {
+	var column *string
+	err := conn(ctx, r.db).QueryRowxContext(ctx, `SELECT weight_column FROM datasets WHERE id=$1`, id).Scan(&column)
+	return column, wrap("dataset weight column", err)
 }
 
 func (r *DatasetRepo) GetCountByOwner(ctx context.Context, owner int64) (int64, error) {
 	query := `SELECT COUNT(*) FROM datasets WHERE owner_id = $1 AND status <> 'archived'`
 	var count int64
-	err := r.db.GetContext(ctx, &count, query, owner)
-	return count, err
+	err := conn(ctx, r.db).GetContext(ctx, &count, query, owner)
+	return count, wrap("dataset get count by owner", err)
+}
+
+// datasetFilterWhere builds the WHERE clause of a saved search over the
+// datasets a user can read: their own and those shared with orgID. Archived
+// datasets only match a filter that asks for them.
+func datasetFilterWhere(f models.DatasetFilter, viewer int64, orgID *int64) (string, []interface{}) {
+	args := []interface{}{viewer, orgID}
+	conds := []string{"(d.owner_id = $1 OR d.org_id = $2)"}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if len(f.Statuses) == 0 {
+		conds = append(conds, "d.status <> 'archived'")
+	} else {
+		statuses := make([]string, len(f.Statuses))
+		for i, st := range f.Statuses {
+			statuses[i] = string(st)
+		}
+		add("d.status = ANY($%d)", pq.Array(statuses))
+	}
+	if f.Query != "" {
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(f.Query) + "%"
+		add("(d.name ILIKE $%[1]d OR d.description ILIKE $%[1]d)", pattern)
+	}
+	if len(f.FileTypes) > 0 {
+		add("d.file_type = ANY($%d)", pq.Array(f.FileTypes))
+	}
+	if len(f.PrivacyCategories) > 0 {
+		categories := make([]string, len(f.PrivacyCategories))
+		for i, c := range f.PrivacyCategories {
+			categories[i] = string(c)
+		}
+		add("EXISTS (SELECT 1 FROM column_privacy cp WHERE cp.dataset_id = d.id AND cp.category = ANY($%d))", pq.Array(categories))
+	}
+	if f.ZeroRealData != nil {
+		add("d.zero_real_data = $%d", *f.ZeroRealData)
+	}
+	if f.UpdatedPeriod != "" {
+		add("d.updated_at >= date_trunc($%d::text, NOW())", f.UpdatedPeriod)
+	}
+	if f.UpdatedWithinDays > 0 {
+		add("d.updated_at >= NOW() - make_interval(days => $%d)", f.UpdatedWithinDays)
+	}
+	if f.MinRows > 0 {
+		add("d.row_count >= $%d", f.MinRows)
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// Search returns the datasets a user can read that match a saved search,
+// newest first. The filter is evaluated now, so a collection follows the
+// catalog as datasets are added, changed and archived.
+func (r *DatasetRepo) Search(ctx context.Context, f models.DatasetFilter, viewer int64, orgID *int64, limit, offset int) ([]models.Dataset, error) {
+	where, args := datasetFilterWhere(f, viewer, orgID)
+	args = append(args, limit, offset)
+	q := fmt.Sprintf(`SELECT d.id, d.owner_id, d.org_id, d.name, d.description, d.status, d.original_filename, d.file_size, d.file_type, d.object_key, d.row_count, d.column_count, d.retention_days, d.created_at, d.updated_at
+          FROM datasets d%s ORDER BY d.created_at DESC LIMIT $%d OFFSET $%d`, where, len(args)-1, len(args))
+	res := []models.Dataset{}
+	err := conn(ctx, r.db).SelectContext(ctx, &res, q, args...)
+	return res, wrap("dataset search", err)
+}
+
+// CountMatching counts the datasets a user can read that match a saved
+// search
+func (r *DatasetRepo) CountMatching(ctx context.Context, f models.DatasetFilter, viewer int64, orgID *int64) (int64, error) {
+	where, args := datasetFilterWhere(f, viewer, orgID)
+	var count int64
+	err := conn(ctx, r.db).GetContext(ctx, &count, `SELECT COUNT(*) FROM datasets d`+where, args...)
+	return count, wrap("dataset count matching", err)
 }
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// DatasetSourceRepo stores the database connections datasets are sampled
+// from
+type DatasetSourceRepo struct{ db *sqlx.DB }
+
+func NewDatasetSourceRepo(db *sqlx.DB) *DatasetSourceRepo { return &DatasetSourceRepo{db: db} }
+
+func (r *DatasetSourceRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS dataset_sources (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL,
+        name TEXT NOT NULL,
+        kind TEXT NOT NULL,
+        settings JSONB NOT NULL DEFAULT '{}',
+        credentials TEXT NOT NULL,
+        wrapped_key TEXT NOT NULL,
+        key_id TEXT NOT NULL,
+        last_tested_at TIMESTAMPTZ NULL,
+        last_test_error TEXT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_dataset_sources_user ON dataset_sources(user_id)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("dataset source create schema", err)
+}
+
+const datasetSourceColumns = `id, user_id, name, kind, settings, credentials, wrapped_key, key_id, last_tested_at, last_test_error,
+          created_at, updated_at`
+
+func (r *DatasetSourceRepo) Create(ctx context.Context, s *models.DatasetSource) (*models.DatasetSource, error) {
+	q := `INSERT INTO dataset_sources (user_id, name, kind, settings, credentials, wrapped_key, key_id, last_tested_at, last_test_error)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+          RETURNING ` + datasetSourceColumns
+	var out models.DatasetSource
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, s.UserID, s.Name, s.Kind, s.Settings, s.Credentials, s.WrappedKey, s.KeyID,
+		s.LastTestedAt, s.LastTestError); err != nil {
+		return nil, wrap("dataset source create", err)
+	}
+	return &out, nil
+}
+
+func (r *DatasetSourceRepo) Get(ctx context.Context, userID, id int64) (*models.DatasetSource, error) {
+	var out models.DatasetSource
+	q := `SELECT ` + datasetSourceColumns + ` FROM dataset_sources WHERE id=$1 AND user_id=$2`
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, id, userID); err != nil {
+		return nil, wrap("dataset source get", err)
+	}
+	return &out, nil
+}
+
+func (r *DatasetSourceRepo) List(ctx context.Context, userID int64) ([]models.DatasetSource, error) {
+	q := `SELECT ` + datasetSourceColumns + ` FROM dataset_sources WHERE user_id=$1 ORDER BY id`
+	var out []models.DatasetSource
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID)
+	return out, wrap("dataset source list", err)
+}
+
+// Delete removes a source; datasets sampled from it are kept. It returns
+// sql.ErrNoRows when the user has no such source.
+func (r *DatasetSourceRepo) Delete(ctx context.Context, userID, id int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM dataset_sources WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return wrap("dataset source delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecordTest stores the outcome of a connection test; testError is nil
+// when it passed
+func (r *DatasetSourceRepo) RecordTest(ctx context.Context, id int64, testError *string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE dataset_sources SET last_tested_at=NOW(), last_test_error=$1 WHERE id=$2`, testError, id)
+	return wrap("dataset source record test", err)
+}
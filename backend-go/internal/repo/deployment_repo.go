@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// DeploymentRepo stores deployment markers
+type DeploymentRepo struct{ db *sqlx.DB }
+
+func NewDeploymentRepo(db *sqlx.DB) *DeploymentRepo { return &DeploymentRepo{db: db} }
+
+func (r *DeploymentRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS deployment_markers (
+        id BIGSERIAL PRIMARY KEY,
+        service TEXT NOT NULL,
+        version TEXT NOT NULL,
+        description TEXT NULL,
+        created_by BIGINT NULL,
+        deployed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_deployment_markers_deployed ON deployment_markers(deployed_at)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("deployment create schema", err)
+}
+
+// Record stores a deployment marker; a zero DeployedAt is now
+func (r *DeploymentRepo) Record(ctx context.Context, m *models.DeploymentMarker) (*models.DeploymentMarker, error) {
+	at := m.DeployedAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	q := `INSERT INTO deployment_markers (service, version, description, created_by, deployed_at) VALUES ($1,$2,$3,$4,$5)
+          RETURNING id, service, version, description, created_by, deployed_at`
+	var out models.DeploymentMarker
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, m.Service, m.Version, m.Description, m.CreatedBy, at); err != nil {
+		return nil, wrap("deployment record", err)
+	}
+	return &out, nil
+}
+
+// RecordRelease records that a service started running a version, unless
+// it was already the service's latest deployment, so instances of one
+// release starting one after another are marked once
+func (r *DeploymentRepo) RecordRelease(ctx context.Context, service, version string) error {
+	q := `INSERT INTO deployment_markers (service, version)
+          SELECT $1::text, $2::text
+          WHERE $2::text IS DISTINCT FROM (SELECT version FROM deployment_markers WHERE service=$1 ORDER BY deployed_at DESC, id DESC LIMIT 1)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, service, version)
+	return wrap("deployment record release", err)
+}
+
+// Between returns the deployments in [from, to), oldest first
+func (r *DeploymentRepo) Between(ctx context.Context, from, to time.Time) ([]models.DeploymentMarker, error) {
+	q := `SELECT id, service, version, description, created_by, deployed_at FROM deployment_markers
+          WHERE deployed_at >= $1 AND deployed_at < $2 ORDER BY deployed_at, id`
+	var out []models.DeploymentMarker
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, from, to)
+	return out, wrap("deployment between", err)
+}
@@ -0,0 +1,13 @@
+package repo
+
+import "fmt"
+
+// wrap names the repo operation that failed in err, keeping the error it
+// wraps, such as sql.ErrNoRows, matchable with errors.Is; a nil err stays
+// nil
+func wrap(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// FHIRMappingRepo stores the FHIR export mapping of datasets
+type FHIRMappingRepo struct{ db *sqlx.DB }
+
+func NewFHIRMappingRepo(db *sqlx.DB) *FHIRMappingRepo { return &FHIRMappingRepo{db: db} }
+
+func (r *FHIRMappingRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS fhir_mappings (
+        dataset_id BIGINT PRIMARY KEY,
+        fields TEXT NOT NULL,
+        updated_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("fhir mapping create schema", err)
+}
+
+const fhirMappingColumns = `dataset_id, fields, updated_by, created_at, updated_at`
+
+// Get returns a dataset's mapping; sql.ErrNoRows when it has none
+func (r *FHIRMappingRepo) Get(ctx context.Context, datasetID int64) (*models.FHIRMapping, error) {
+	q := `SELECT ` + fhirMappingColumns + ` FROM fhir_mappings WHERE dataset_id=$1`
+	var out models.FHIRMapping
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, datasetID).StructScan(&out); err != nil {
+		return nil, wrap("fhir mapping get", err)
+	}
+	return &out, nil
+}
+
+func (r *FHIRMappingRepo) Upsert(ctx context.Context, m *models.FHIRMapping) (*models.FHIRMapping, error) {
+	q := `INSERT INTO fhir_mappings (dataset_id, fields, updated_by)
+          VALUES ($1,$2,$3)
+          ON CONFLICT (dataset_id) DO UPDATE SET fields=EXCLUDED.fields, updated_by=EXCLUDED.updated_by, updated_at=NOW()
+          RETURNING ` + fhirMappingColumns
+	var out models.FHIRMapping
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, m.DatasetID, m.Fields, m.UpdatedBy).StructScan(&out); err != nil {
+		return nil, wrap("fhir mapping upsert", err)
+	}
+	return &out, nil
+}
+
+// Delete removes a dataset's mapping; sql.ErrNoRows when it has none
+func (r *FHIRMappingRepo) Delete(ctx context.Context, datasetID int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM fhir_mappings WHERE dataset_id=$1`, datasetID)
+	if err != nil {
+		return wrap("fhir mapping delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
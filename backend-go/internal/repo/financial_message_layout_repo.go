@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// FinancialMessageLayoutRepo stores the payment message layout of datasets
+type FinancialMessageLayoutRepo struct{ db *sqlx.DB }
+
+func NewFinancialMessageLayoutRepo(db *sqlx.DB) *FinancialMessageLayoutRepo {
+	return &FinancialMessageLayoutRepo{db: db}
+}
+
+func (r *FinancialMessageLayoutRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS financial_message_layouts (
+        dataset_id BIGINT PRIMARY KEY,
+        message_type TEXT NOT NULL,
+        columns TEXT NOT NULL,
+        envelope TEXT NOT NULL DEFAULT '{}',
+        updated_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("financial message layout create schema", err)
+}
+
+const financialMessageLayoutColumns = `dataset_id, message_type, columns, envelope, updated_by, created_at, updated_at`
+
+// Get returns a dataset's layout; sql.ErrNoRows when it has none
+func (r *FinancialMessageLayoutRepo) Get(ctx context.Context, datasetID int64) (*models.FinancialMessageLayout, error) {
+	q := `SELECT ` + financialMessageLayoutColumns + ` FROM financial_message_layouts WHERE dataset_id=$1`
+	var out models.FinancialMessageLayout
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, datasetID).StructScan(&out); err != nil {
+		return nil, wrap("financial message layout get", err)
+	}
+	return &out, nil
+}
+
+func (r *FinancialMessageLayoutRepo) Upsert(ctx context.Context, l *models.FinancialMessageLayout) (*models.FinancialMessageLayout, error) {
+	q := `INSERT INTO financial_message_layouts (dataset_id, message_type, columns, envelope, updated_by)
+          VALUES ($1,$2,$3,$4,$5)
+          ON CONFLICT (dataset_id) DO UPDATE SET message_type=EXCLUDED.message_type, columns=EXCLUDED.columns,
+              envelope=EXCLUDED.envelope, updated_by=EXCLUDED.updated_by, updated_at=NOW()
+          RETURNING ` + financialMessageLayoutColumns
+	var out models.FinancialMessageLayout
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, l.DatasetID, l.MessageType, l.Columns, l.Envelope,
+		l.UpdatedBy).StructScan(&out); err != nil {
+		return nil, wrap("financial message layout upsert", err)
+	}
+	return &out, nil
+}
+
+// Delete removes a dataset's layout; sql.ErrNoRows when it has none
+func (r *FinancialMessageLayoutRepo) Delete(ctx context.Context, datasetID int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM financial_message_layouts WHERE dataset_id=$1`, datasetID)
+	if err != nil {
+		return wrap("financial message layout delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
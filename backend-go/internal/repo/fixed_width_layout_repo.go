@@ -0,0 +1,68 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// FixedWidthLayoutRepo stores the fixed-width export layout of datasets
+type FixedWidthLayoutRepo struct{ db *sqlx.DB }
+
+func NewFixedWidthLayoutRepo(db *sqlx.DB) *FixedWidthLayoutRepo { return &FixedWidthLayoutRepo{db: db} }
+
+func (r *FixedWidthLayoutRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS fixed_width_layouts (
+        dataset_id BIGINT PRIMARY KEY,
+        fields TEXT NOT NULL,
+        encoding TEXT NOT NULL DEFAULT 'ascii',
+        record_terminator TEXT NOT NULL DEFAULT 'lf',
+        overflow TEXT NOT NULL DEFAULT 'reject',
+        updated_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("fixed width layout create schema", err)
+}
+
+const fixedWidthLayoutColumns = `dataset_id, fields, encoding, record_terminator, overflow, updated_by, created_at, updated_at`
+
+// Get returns a dataset's layout; sql.ErrNoRows when it has none
+func (r *FixedWidthLayoutRepo) Get(ctx context.Context, datasetID int64) (*models.FixedWidthLayout, error) {
+	q := `SELECT ` + fixedWidthLayoutColumns + ` FROM fixed_width_layouts WHERE dataset_id=$1`
+	var out models.FixedWidthLayout
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, datasetID).StructScan(&out); err != nil {
+		return nil, wrap("fixed width layout get", err)
+	}
+	return &out, nil
+}
+
+func (r *FixedWidthLayoutRepo) Upsert(ctx context.Context, l *models.FixedWidthLayout) (*models.FixedWidthLayout, error) {
+	q := `INSERT INTO fixed_width_layouts (dataset_id, fields, encoding, record_terminator, overflow, updated_by)
+          VALUES ($1,$2,$3,$4,$5,$6)
+          ON CONFLICT (dataset_id) DO UPDATE SET fields=EXCLUDED.fields, encoding=EXCLUDED.encoding,
+              record_terminator=EXCLUDED.record_terminator, overflow=EXCLUDED.overflow,
+              updated_by=EXCLUDED.updated_by, updated_at=NOW()
+          RETURNING ` + fixedWidthLayoutColumns
+	var out models.FixedWidthLayout
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, l.DatasetID, l.Fields, l.Encoding, l.RecordTerminator, l.Overflow,
+		l.UpdatedBy).StructScan(&out); err != nil {
+		return nil, wrap("fixed width layout upsert", err)
+	}
+	return &out, nil
+}
+
+// Delete removes a dataset's layout; sql.ErrNoRows when it has none
+func (r *FixedWidthLayoutRepo) Delete(ctx context.Context, datasetID int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM fixed_width_layouts WHERE dataset_id=$1`, datasetID)
+	if err != nil {
+		return wrap("fixed width layout delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
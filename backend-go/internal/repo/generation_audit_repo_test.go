@@ -0,0 +1,41 @@
+// Package repo_test provides unit tests for the generation audit
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var generationAuditCols = []string{"id", "job_id", "user_id", "org_id", "dataset_id", "columns", "masked_columns", "rows_requested",
+	"privacy_level", "column_privacy", "data_mode", "sample_sharing", "source_rows_shared", "provider", "strategy", "custom_model_id",
+	"ip_address", "created_at", "status", "rows_generated"}
+
+func TestGenerationAuditRepo_SearchByColumn(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	audits := repo.NewGenerationAuditRepo(testDB.DB)
+	start := time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	testDB.Mock.ExpectQuery(`FROM generation_audit a LEFT JOIN generation_jobs j ON j.id = a.job_id\s+WHERE a.id > \$1 AND EXISTS \(SELECT 1 FROM unnest\(a.columns\) c WHERE lower\(c\) = lower\(\$2\)\) AND a.org_id = \$3 AND a.created_at >= \$4 AND a.created_at < \$5 ORDER BY a.id LIMIT \$6`).
+		WithArgs(int64(0), "salary", int64(4), start, end, 100).
+		WillReturnRows(sqlmock.NewRows(generationAuditCols).AddRow(1, 31, 7, 4, 9, "{name,salary}", "{ssn}", 1000,
+			"high", `{"salary":"laplace"}`, "standard", "grounded", 20, nil, nil, nil, "10.0.0.1", start.Add(time.Hour), "completed", 1000))
+
+	records, err := audits.Search(context.Background(), models.GenerationAuditFilter{Column: "salary", OrgID: 4, Start: start, End: end, Limit: 100})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, []string{"name", "salary"}, []string(records[0].Columns))
+	assert.Equal(t, models.MechanismLaplace, records[0].ColumnPrivacy["salary"])
+	assert.Equal(t, models.SampleSharingGrounded, records[0].SampleSharing)
+	assert.Equal(t, models.GenCompleted, records[0].Status)
+	testDB.AssertExpectations(t)
+}
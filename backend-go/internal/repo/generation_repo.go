@@ -2,6 +2,8 @@ package repo
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
@@ -10,6 +12,13 @@ import (
 
 type GenerationRepo struct{ db *sqlx.DB }
 
+// ErrProviderRequired is returned when a job is completed without recording
+// the provider and model that produced it
+var ErrProviderRequired = errors.New("provider and model are required to complete a job")
+
+const generationJobColumns = `id, dataset_id, user_id, org_id, rows_requested, prompt, masked_columns, data_mode, data_mode_source, privacy_level, requested_provider, status, output_key, output_format, rows_generated, processing_time,
+          progress, attempts, last_error, provider, model, tokens_used, cost_usd, quality_score, quality_details, created_at, started_at, completed_at`
+
 func NewGenerationRepo(db *sqlx.DB) *GenerationRepo { return &GenerationRepo{db: db} }
 
 func (r *GenerationRepo) CreateSchema(ctx context.Context) error {
@@ -26,55 +35,354 @@ func (r *GenerationRepo) CreateSchema(ctx context.Context) error {
         created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
         started_at TIMESTAMPTZ NULL,
         completed_at TIMESTAMPTZ NULL
+    );
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS prompt TEXT NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS masked_columns TEXT[] NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS provider TEXT NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS model TEXT NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS tokens_used BIGINT NOT NULL DEFAULT 0;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS quality_score DOUBLE PRECISION NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS data_mode TEXT NOT NULL DEFAULT 'standard';
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS data_mode_source TEXT NOT NULL DEFAULT 'default';
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS progress DOUBLE PRECISION NOT NULL DEFAULT 0;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS last_error TEXT NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS payload TEXT NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS locked_by TEXT NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS lease_until TIMESTAMPTZ NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS privacy_level TEXT NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS requested_provider TEXT NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS quality_details TEXT NULL;
+    ALTER TABLE generation_jobs ADD COLUMN IF NOT EXISTS org_id BIGINT NULL;
+    CREATE INDEX IF NOT EXISTS idx_generation_jobs_org ON generation_jobs(org_id, created_at DESC) WHERE org_id IS NOT NULL;
+    CREATE INDEX IF NOT EXISTS idx_generation_jobs_queue ON generation_jobs(next_attempt_at) WHERE status IN ('queued','running');
+    CREATE INDEX IF NOT EXISTS idx_generation_jobs_user_completed ON generation_jobs(user_id, completed_at) WHERE status = 'completed';
+    CREATE TABLE IF NOT EXISTS generation_grounding_samples (
+        job_id BIGINT PRIMARY KEY REFERENCES generation_jobs(id) ON DELETE CASCADE,
+        dataset_id BIGINT NOT NULL,
+        strategy TEXT NOT NULL,
+        stratify_by TEXT NULL,
+        seed BIGINT NOT NULL,
+        source_rows BIGINT[] NOT NULL,
+        masked_columns TEXT[] NOT NULL,
+        rows TEXT NOT NULL,
+        digest TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
     )`
-	_, err := r.db.ExecContext(ctx, stmt)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("generation create schema", err)
+}
+
+func jobDataMode(m models.DataMode) models.DataMode {
+	if m == "" {
+		return models.DataModeStandard
+	}
+	return m
+}
+
+func jobDataModeSource(s models.DataModeSource) models.DataModeSource {
+	if s == "" {
+		return models.DataModeSourceDefault
+	}
+	return s
 }
 
 func (r *GenerationRepo) Insert(ctx context.Context, job *models.GenerationJob) (*models.GenerationJob, error) {
-	q := `INSERT INTO generation_jobs (dataset_id, user_id, rows_requested, status)
-          VALUES ($1,$2,$3,'pending')
-          RETURNING id, dataset_id, user_id, rows_requested, status, output_key, output_format, rows_generated, processing_time, created_at, started_at, completed_at`
+	q := `INSERT INTO generation_jobs (dataset_id, user_id, rows_requested, prompt, masked_columns, data_mode, data_mode_source,
+              privacy_level, requested_provider, output_format, status, org_id)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,'pending',(SELECT org_id FROM org_members WHERE user_id=$2))
+          RETURNING ` + generationJobColumns
 	var out models.GenerationJob
-	if err := r.db.QueryRowxContext(ctx, q, job.DatasetID, job.UserID, job.RowsRequested).StructScan(&out); err != nil {
-		return nil, err
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, job.DatasetID, job.UserID, job.RowsRequested, job.Prompt, job.MaskedColumns,
+		jobDataMode(job.DataMode), jobDataModeSource(job.DataModeSource), job.PrivacyLevel, job.RequestedProvider, job.OutputFormat).StructScan(&out); err != nil {
+		return nil, wrap("generation insert", err)
+	}
+	return &out, nil
+}
+
+// InsertWithGroundingSample creates a job together with the record of the
+// sample that will ground its prompt, so a job never runs with an
+// unrecorded sample
+func (r *GenerationRepo) InsertWithGroundingSample(ctx context.Context, job *models.GenerationJob, sample *models.GroundingSampleRecord) (*models.GenerationJob, error) {
+	var out *models.GenerationJob
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		var err error
+		if out, err = r.Insert(ctx, job); err != nil {
+			return err
+		}
+		sq := `INSERT INTO generation_grounding_samples (job_id, dataset_id, strategy, stratify_by, seed, source_rows, masked_columns, rows, digest)
+           VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)`
+		_, err = conn(ctx, r.db).ExecContext(ctx, sq, out.ID, sample.DatasetID, sample.Strategy, sample.StratifyBy, sample.Seed,
+			sample.SourceRows, sample.MaskedColumns, sample.Rows, sample.Digest)
+		return err
+	})
+	if err != nil {
+		return nil, wrap("generation insert with grounding sample", err)
+	}
+	return out, nil
+}
+
+// GetGroundingSample returns the grounding sample recorded for a job
+func (r *GenerationRepo) GetGroundingSample(ctx context.Context, jobID int64) (*models.GroundingSampleRecord, error) {
+	q := `SELECT job_id, dataset_id, strategy, stratify_by, seed, source_rows, masked_columns, rows, digest, created_at
+          FROM generation_grounding_samples WHERE job_id=$1`
+	var out models.GroundingSampleRecord
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, jobID).StructScan(&out); err != nil {
+		return nil, wrap("generation get grounding sample", err)
 	}
 	return &out, nil
 }
 
 func (r *GenerationRepo) GetByOwner(ctx context.Context, userID, jobID int64) (*models.GenerationJob, error) {
-	q := `SELECT id, dataset_id, user_id, rows_requested, status, output_key, output_format, rows_generated, processing_time, created_at, started_at, completed_at
+	q := `SELECT ` + generationJobColumns + `
           FROM generation_jobs WHERE id=$1 AND user_id=$2`
 	var out models.GenerationJob
-	if err := r.db.QueryRowxContext(ctx, q, jobID, userID).StructScan(&out); err != nil {
-		return nil, err
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, jobID, userID).StructScan(&out); err != nil {
+		return nil, wrap("generation get by owner", err)
+	}
+	return &out, nil
+}
+
+// GetByID returns any user's job, for staff
+func (r *GenerationRepo) GetByID(ctx context.Context, jobID int64) (*models.GenerationJob, error) {
+	q := `SELECT ` + generationJobColumns + ` FROM generation_jobs WHERE id=$1`
+	var out models.GenerationJob
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, jobID).StructScan(&out); err != nil {
+		return nil, wrap("generation get by id", err)
 	}
 	return &out, nil
 }
 
 func (r *GenerationRepo) ListByOwner(ctx context.Context, userID int64, limit, offset int) ([]models.GenerationJob, error) {
-	q := `SELECT id, dataset_id, user_id, rows_requested, status, output_key, output_format, rows_generated, processing_time, created_at, started_at, completed_at
+	q := `SELECT ` + generationJobColumns + `
           FROM generation_jobs WHERE user_id=$1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
-	rows, err := r.db.QueryxContext(ctx, q, userID, limit, offset)
+	rows, err := conn(ctx, r.db).QueryxContext(ctx, q, userID, limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, wrap("generation list by owner", err)
 	}
 	defer rows.Close()
 	var list []models.GenerationJob
 	for rows.Next() {
 		var j models.GenerationJob
 		if err := rows.StructScan(&j); err != nil {
-			return nil, err
+			return nil, wrap("generation list by owner", err)
 		}
 		list = append(list, j)
 	}
-	return list, rows.Err()
+	return list, wrap("generation list by owner", rows.Err())
+}
+
+// GetAccessible returns a job the user started, or one shared with an
+// organization where the user holds one of roles
+func (r *GenerationRepo) GetAccessible(ctx context.Context, userID, jobID int64, roles []models.OrgRole) (*models.GenerationJob, error) {
+	q, args, err := sqlx.In(`SELECT `+generationJobColumns+`
+          FROM generation_jobs j
+          WHERE j.id = ? AND (j.user_id = ? OR (j.org_id IS NOT NULL AND EXISTS (
+              SELECT 1 FROM org_members m WHERE m.org_id = j.org_id AND m.user_id = ? AND m.role IN (?)
+          )))`, jobID, userID, userID, roles)
+	if err != nil {
+		return nil, wrap("generation get accessible", err)
+	}
+	var out models.GenerationJob
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, r.db.Rebind(q), args...).StructScan(&out); err != nil {
+		return nil, wrap("generation get accessible", err)
+	}
+	return &out, nil
+}
+
+// ListByOrg returns the jobs shared with an organization, newest first
+func (r *GenerationRepo) ListByOrg(ctx context.Context, orgID int64, limit, offset int) ([]models.GenerationJob, error) {
+	q := `SELECT ` + generationJobColumns + `
+          FROM generation_jobs WHERE org_id=$1 ORDER BY created_at DESC LIMIT $2 OFFSET $3`
+	var list []models.GenerationJob
+	err := conn(ctx, r.db).SelectContext(ctx, &list, q, orgID, limit, offset)
+	return list, wrap("generation list by org", err)
+}
+
+// Cancel stops an owner's unfinished job for good and returns it;
+// sql.ErrNoRows when there is no such job or it already finished
+func (r *GenerationRepo) Cancel(ctx context.Context, userID, jobID int64) (*models.GenerationJob, error) {
+	q := `UPDATE generation_jobs SET status='cancelled', locked_by=NULL, lease_until=NULL, completed_at=NOW()
+          WHERE id=$1 AND user_id=$2 AND status IN ('pending','queued','running','paused')
+          RETURNING ` + generationJobColumns
+	return r.transition(ctx, "generation cancel", q, jobID, userID)
+}
+
+// Pause takes an owner's queued or running job off the queue and returns
+// it; sql.ErrNoRows when there is no such job. A running job gives up its
+// worker and its progress, and the attempt it was on is not counted.
+func (r *GenerationRepo) Pause(ctx context.Context, userID, jobID int64) (*models.GenerationJob, error) {
+	q := `UPDATE generation_jobs SET status='paused', locked_by=NULL, lease_until=NULL, progress=0,
+              attempts=CASE WHEN status='running' THEN GREATEST(attempts-1, 0) ELSE attempts END
+          WHERE id=$1 AND user_id=$2 AND status IN ('queued','running')
+          RETURNING ` + generationJobColumns
+	return r.transition(ctx, "generation pause", q, jobID, userID)
+}
+
+// Resume puts an owner's paused job back on the queue, due at once, and
+// returns it; sql.ErrNoRows when there is no such job
+func (r *GenerationRepo) Resume(ctx context.Context, userID, jobID int64) (*models.GenerationJob, error) {
+	q := `UPDATE generation_jobs SET status='queued', next_attempt_at=NOW()
+          WHERE id=$1 AND user_id=$2 AND status='paused'
+          RETURNING ` + generationJobColumns
+	return r.transition(ctx, "generation resume", q, jobID, userID)
+}
+
+func (r *GenerationRepo) transition(ctx context.Context, op, q string, jobID, userID int64) (*models.GenerationJob, error) {
+	var out models.GenerationJob
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, jobID, userID).StructScan(&out); err != nil {
+		return nil, wrap(op, err)
+	}
+	return &out, nil
+}
+
+// Complete marks a pending, queued or running job completed with its output and the
+// provider, model, token usage, cost and quality that produced it
+func (r *GenerationRepo) Complete(ctx context.Context, job *models.GenerationJob) error {
+	if job.Provider == nil || *job.Provider == "" || job.Model == nil || *job.Model == "" {
+		return ErrProviderRequired
+	}
+	q := `UPDATE generation_jobs SET status='completed', output_key=$2, output_format=$3, rows_generated=$4, processing_time=$5,
+              provider=$6, model=$7, tokens_used=$8, cost_usd=$9, quality_score=$10, quality_details=$11, progress=1,
+              locked_by=NULL, lease_until=NULL, completed_at=NOW()
+          WHERE id=$1 AND status IN ('pending','queued','running')`
+	res, err := conn(ctx, r.db).ExecContext(ctx, q, job.ID, job.OutputKey, job.OutputFormat, job.RowsGenerated, job.ProcessingTime,
+		job.Provider, job.Model, job.TokensUsed, job.CostUSD, job.QualityScore, job.QualityDetails)
+	if err != nil {
+		return wrap("generation complete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Enqueue hands a pending job and the request it runs to the worker pool
+func (r *GenerationRepo) Enqueue(ctx context.Context, jobID int64, payload []byte) error {
+	q := `UPDATE generation_jobs SET status='queued', payload=$2, next_attempt_at=NOW() WHERE id=$1 AND status='pending'`
+	return wrap("generation enqueue", expectOne(conn(ctx, r.db).ExecContext(ctx, q, jobID, string(payload))))
+}
+
+// Claim marks the next due queued job running for worker and returns it
+// with its payload. A running job whose lease has expired, because its
+// worker died, is claimed again. Concurrent workers never claim the same
+// job. It returns sql.ErrNoRows when nothing is due.
+func (r *GenerationRepo) Claim(ctx context.Context, worker string, lease time.Duration) (*models.GenerationJob, []byte, error) {
+	q := `UPDATE generation_jobs SET status='running', attempts=attempts+1, locked_by=$1,
+              lease_until=NOW() + $2 * INTERVAL '1 millisecond', started_at=COALESCE(started_at, NOW())
+          WHERE id = (
+              SELECT id FROM generation_jobs
+              WHERE (status='queued' AND next_attempt_at <= NOW()) OR (status='running' AND lease_until < NOW())
+              ORDER BY next_attempt_at, id
+              LIMIT 1
+              FOR UPDATE SKIP LOCKED)
+          RETURNING ` + generationJobColumns + `, COALESCE(payload, '') AS payload`
+	var out struct {
+		models.GenerationJob
+		Payload string `db:"payload"`
+	}
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, worker, lease.Milliseconds()).StructScan(&out); err != nil {
+		return nil, nil, wrap("generation claim", err)
+	}
+	return &out.GenerationJob, []byte(out.Payload), nil
+}
+
+// UpdateProgress records a running job's progress (0 to 1) and extends its
+// lease. It returns sql.ErrNoRows once the job is no longer held by worker,
+// for instance because it was cancelled.
+func (r *GenerationRepo) UpdateProgress(ctx context.Context, jobID int64, worker string, progress float64, lease time.Duration) error {
+	q := `UPDATE generation_jobs SET progress=$3, lease_until=NOW() + $4 * INTERVAL '1 millisecond'
+          WHERE id=$1 AND locked_by=$2 AND status='running'`
+	return wrap("generation update progress", expectOne(conn(ctx, r.db).ExecContext(ctx, q, jobID, worker, progress, lease.Milliseconds())))
+}
+
+// Retry puts a running job back on the queue to be attempted again at the
+// given time
+func (r *GenerationRepo) Retry(ctx context.Context, jobID int64, at time.Time, reason string) error {
+	q := `UPDATE generation_jobs SET status='queued', next_attempt_at=$2, last_error=$3, locked_by=NULL, lease_until=NULL
+          WHERE id=$1 AND status='running'`
+	return wrap("generation retry", expectOne(conn(ctx, r.db).ExecContext(ctx, q, jobID, at, reason)))
+}
+
+// Fail marks a running job failed for good
+func (r *GenerationRepo) Fail(ctx context.Context, jobID int64, reason string) error {
+	q := `UPDATE generation_jobs SET status='failed', last_error=$2, locked_by=NULL, lease_until=NULL, completed_at=NOW()
+          WHERE id=$1 AND status='running'`
+	return wrap("generation fail", expectOne(conn(ctx, r.db).ExecContext(ctx, q, jobID, reason)))
+}
+
+func expectOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-func (r *GenerationRepo) Cancel(ctx context.Context, userID, jobID int64) error {
-	q := `UPDATE generation_jobs SET status='cancelled', completed_at=NOW() WHERE id=$1 AND user_id=$2 AND status IN ('pending','running')`
-	_, err := r.db.ExecContext(ctx, q, jobID, userID)
-	return err
+// UsageByProvider aggregates a user's completed jobs since the given time by
+// provider, model and time bucket (day, week or month)
+func (r *GenerationRepo) UsageByProvider(ctx context.Context, userID int64, since time.Time, interval string) ([]models.ProviderUsage, error) {
+	q := `SELECT date_trunc($3::text, completed_at) AS period, provider, model, COUNT(*) AS jobs,
+              COALESCE(SUM(rows_generated), 0) AS rows, COALESCE(SUM(tokens_used), 0) AS tokens,
+              COALESCE(SUM(cost_usd), 0) AS cost_usd, AVG(quality_score) AS avg_quality, COUNT(quality_score) AS scored_jobs
+          FROM generation_jobs
+          WHERE user_id=$1 AND status='completed' AND completed_at >= $2 AND provider IS NOT NULL AND model IS NOT NULL
+          GROUP BY 1, 2, 3
+          ORDER BY 1, 2, 3`
+	var out []models.ProviderUsage
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID, since, interval)
+	return out, wrap("generation usage by provider", err)
+}
+
+// OrgUsageByProvider aggregates the completed jobs of an organization's
+// members like UsageByProvider
+func (r *GenerationRepo) OrgUsageByProvider(ctx context.Context, orgID int64, since time.Time, interval string) ([]models.ProviderUsage, error) {
+	q := `SELECT date_trunc($3::text, completed_at) AS period, provider, model, COUNT(*) AS jobs,
+              COALESCE(SUM(rows_generated), 0) AS rows, COALESCE(SUM(tokens_used), 0) AS tokens,
+              COALESCE(SUM(cost_usd), 0) AS cost_usd, AVG(quality_score) AS avg_quality, COUNT(quality_score) AS scored_jobs
+          FROM generation_jobs
+          WHERE org_id=$1 AND status='completed' AND completed_at >= $2 AND provider IS NOT NULL AND model IS NOT NULL
+          GROUP BY 1, 2, 3
+          ORDER BY 1, 2, 3`
+	var out []models.ProviderUsage
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, orgID, since, interval)
+	return out, wrap("generation org usage by provider", err)
+}
+
+// ModelQualityStats aggregates completed jobs since the given time by
+// provider and model across all users, or those of one dataset when
+// datasetID is not zero. Period is left zero.
+func (r *GenerationRepo) ModelQualityStats(ctx context.Context, since time.Time, datasetID int64) ([]models.ProviderUsage, error) {
+	q := `SELECT provider, model, COUNT(*) AS jobs,
+              COALESCE(SUM(rows_generated), 0) AS rows, COALESCE(SUM(tokens_used), 0) AS tokens,
+              COALESCE(SUM(cost_usd), 0) AS cost_usd, AVG(quality_score) AS avg_quality, COUNT(quality_score) AS scored_jobs
+          FROM generation_jobs
+          WHERE status='completed' AND completed_at >= $1 AND provider IS NOT NULL AND model IS NOT NULL
+            AND ($2::bigint = 0 OR dataset_id=$2)
+          GROUP BY 1, 2
+          ORDER BY 1, 2`
+	var out []models.ProviderUsage
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, since, datasetID)
+	return out, wrap("generation model quality stats", err)
+}
+
+// JobFailureBuckets counts the jobs that completed or failed in [from, to)
+// per bucket of the given size, leaving out buckets in which none finished
+func (r *GenerationRepo) JobFailureBuckets(ctx context.Context, from, to time.Time, bucket time.Duration) ([]models.JobFailureBucket, error) {
+	q := `SELECT to_timestamp(floor(extract(epoch FROM completed_at) / $3) * $3) AS bucket,
+              COUNT(*) AS finished, COUNT(*) FILTER (WHERE status='failed') AS failed,
+              mode() WITHIN GROUP (ORDER BY last_error) FILTER (WHERE status='failed') AS top_error
+          FROM generation_jobs
+          WHERE status IN ('completed','failed') AND completed_at >= $1 AND completed_at < $2
+          GROUP BY 1
+          ORDER BY 1`
+	var out []models.JobFailureBucket
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, from, to, bucket.Seconds())
+	return out, wrap("generation job failure buckets", err)
 }
 
 func (r *GenerationRepo) GetMonthlyRowsGenerated(ctx context.Context, userID int64, startOfMonth time.Time) (int64, error) {
@@ -84,6 +392,17 @@ func (r *GenerationRepo) GetMonthlyRowsGenerated(ctx context.Context, userID int
 		WHERE user_id = $1 AND status = 'completed' AND created_at >= $2
 	`
 	var total int64
-	err := r.db.GetContext(ctx, &total, query, userID, startOfMonth)
-	return total, err
+	err := conn(ctx, r.db).GetContext(ctx, &total, query, userID, startOfMonth)
+	return total, wrap("generation get monthly rows generated", err)
+}
+
+// GetMonthlyRowsReserved sums the rows requested by a user's jobs created
+// since startOfMonth that have not finished. They hold quota until they
+// complete, when their generated rows count instead, or are cancelled.
+func (r *GenerationRepo) GetMonthlyRowsReserved(ctx context.Context, userID int64, startOfMonth time.Time) (int64, error) {
+	q := `SELECT COALESCE(SUM(rows_requested), 0) FROM generation_jobs
+          WHERE user_id=$1 AND status IN ('pending','queued','running','paused') AND created_at >= $2`
+	var total int64
+	err := conn(ctx, r.db).GetContext(ctx, &total, q, userID, startOfMonth)
+	return total, wrap("generation get monthly rows reserved", err)
 }
@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// GenerationTemplateRepo stores saved generation settings and every
+// version of them
+type GenerationTemplateRepo struct{ db *sqlx.DB }
+
+func NewGenerationTemplateRepo(db *sqlx.DB) *GenerationTemplateRepo {
+	return &GenerationTemplateRepo{db: db}
+}
+
+func (r *GenerationTemplateRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS generation_templates (
+        id BIGSERIAL PRIMARY KEY,
+        owner_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        org_id BIGINT NULL,
+        name TEXT NOT NULL,
+        description TEXT NULL,
+        version INT NOT NULL DEFAULT 1,
+        settings JSONB NOT NULL,
+        updated_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_generation_templates_owner ON generation_templates(owner_id);
+    CREATE INDEX IF NOT EXISTS idx_generation_templates_org ON generation_templates(org_id) WHERE org_id IS NOT NULL;
+    CREATE TABLE IF NOT EXISTS generation_template_versions (
+        template_id BIGINT NOT NULL REFERENCES generation_templates(id) ON DELETE CASCADE,
+        version INT NOT NULL,
+        name TEXT NOT NULL,
+        description TEXT NULL,
+        settings JSONB NOT NULL,
+        created_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (template_id, version)
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("generation template create schema", err)
+}
+
+const (
+	generationTemplateColumns        = `id, owner_id, org_id, name, description, version, settings, updated_by, created_at, updated_at`
+	generationTemplateVersionColumns = `template_id, version, name, description, settings, created_by, created_at`
+)
+
+// orgOf is the organization a template is shared with: the owner's, when
+// shared
+const orgOf = `CASE WHEN $2 THEN (SELECT org_id FROM org_members WHERE user_id=$1) END`
+
+// Insert creates a template at version 1, shared with the owner's
+// organization when shared is set
+func (r *GenerationTemplateRepo) Insert(ctx context.Context, t *models.GenerationTemplate, shared bool) (*models.GenerationTemplate, error) {
+	var out models.GenerationTemplate
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		q := `INSERT INTO generation_templates (owner_id, org_id, name, description, settings, updated_by)
+              VALUES ($1,` + orgOf + `,$3,$4,$5,$1)
+              RETURNING ` + generationTemplateColumns
+		if err := conn(ctx, r.db).GetContext(ctx, &out, q, t.OwnerID, shared, t.Name, t.Description, t.Settings); err != nil {
+			return err
+		}
+		return r.record(ctx, &out)
+	})
+	if err != nil {
+		return nil, wrap("generation template insert", err)
+	}
+	return &out, nil
+}
+
+// Update saves a template's new settings as its next version
+func (r *GenerationTemplateRepo) Update(ctx context.Context, t *models.GenerationTemplate, shared bool) (*models.GenerationTemplate, error) {
+	var out models.GenerationTemplate
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		q := `UPDATE generation_templates SET org_id=` + orgOf + `, name=$3, description=$4, settings=$5,
+                  updated_by=$6, version=version+1, updated_at=NOW()
+              WHERE id=$7 AND owner_id=$1
+              RETURNING ` + generationTemplateColumns
+		if err := conn(ctx, r.db).GetContext(ctx, &out, q, t.OwnerID, shared, t.Name, t.Description, t.Settings,
+			t.UpdatedBy, t.ID); err != nil {
+			return err
+		}
+		return r.record(ctx, &out)
+	})
+	if err != nil {
+		return nil, wrap("generation template update", err)
+	}
+	return &out, nil
+}
+
+func (r *GenerationTemplateRepo) record(ctx context.Context, t *models.GenerationTemplate) error {
+	q := `INSERT INTO generation_template_versions (template_id, version, name, description, settings, created_by)
+          VALUES ($1,$2,$3,$4,$5,$6)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, t.ID, t.Version, t.Name, t.Description, t.Settings, t.UpdatedBy)
+	return err
+}
+
+func (r *GenerationTemplateRepo) Get(ctx context.Context, id int64) (*models.GenerationTemplate, error) {
+	q := `SELECT ` + generationTemplateColumns + ` FROM generation_templates WHERE id=$1`
+	var out models.GenerationTemplate
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, id); err != nil {
+		return nil, wrap("generation template get", err)
+	}
+	return &out, nil
+}
+
+// ListByOwner returns the owner's templates by name
+func (r *GenerationTemplateRepo) ListByOwner(ctx context.Context, owner int64) ([]models.GenerationTemplate, error) {
+	q := `SELECT ` + generationTemplateColumns + ` FROM generation_templates WHERE owner_id=$1 ORDER BY lower(name), id`
+	out := []models.GenerationTemplate{}
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, owner)
+	return out, wrap("generation template list by owner", err)
+}
+
+// ListByOrg returns the templates shared with an organization by name
+func (r *GenerationTemplateRepo) ListByOrg(ctx context.Context, orgID int64) ([]models.GenerationTemplate, error) {
+	q := `SELECT ` + generationTemplateColumns + ` FROM generation_templates WHERE org_id=$1 ORDER BY lower(name), id`
+	out := []models.GenerationTemplate{}
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, orgID)
+	return out, wrap("generation template list by org", err)
+}
+
+// Versions returns the history of a template, newest first
+func (r *GenerationTemplateRepo) Versions(ctx context.Context, id int64) ([]models.GenerationTemplateVersion, error) {
+	q := `SELECT ` + generationTemplateVersionColumns + ` FROM generation_template_versions
+          WHERE template_id=$1 ORDER BY version DESC`
+	out := []models.GenerationTemplateVersion{}
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, id)
+	return out, wrap("generation template versions", err)
+}
+
+// Version returns one version of a template
+func (r *GenerationTemplateRepo) Version(ctx context.Context, id int64, version int) (*models.GenerationTemplateVersion, error) {
+	q := `SELECT ` + generationTemplateVersionColumns + ` FROM generation_template_versions WHERE template_id=$1 AND version=$2`
+	var out models.GenerationTemplateVersion
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, id, version); err != nil {
+		return nil, wrap("generation template version", err)
+	}
+	return &out, nil
+}
+
+// Delete removes a template and its history; sql.ErrNoRows when there is
+// no such template
+func (r *GenerationTemplateRepo) Delete(ctx context.Context, id int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM generation_templates WHERE id=$1`, id)
+	if err != nil {
+		return wrap("generation template delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
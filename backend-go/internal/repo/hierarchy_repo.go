@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// HierarchyRepo stores the categorical hierarchies declared on datasets
+type HierarchyRepo struct{ db *sqlx.DB }
+
+func NewHierarchyRepo(db *sqlx.DB) *HierarchyRepo { return &HierarchyRepo{db: db} }
+
+func (r *HierarchyRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS column_hierarchies (
+        id BIGSERIAL PRIMARY KEY,
+        dataset_id BIGINT NOT NULL,
+        levels TEXT[] NOT NULL,
+        taxonomy TEXT NULL,
+        created_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_column_hierarchies_dataset ON column_hierarchies(dataset_id)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("hierarchy create schema", err)
+}
+
+const hierarchyColumns = `id, dataset_id, levels, taxonomy, created_by, created_at`
+
+func (r *HierarchyRepo) Create(ctx context.Context, h *models.ColumnHierarchy) (*models.ColumnHierarchy, error) {
+	q := `INSERT INTO column_hierarchies (dataset_id, levels, taxonomy, created_by)
+          VALUES ($1,$2,$3,$4)
+          RETURNING ` + hierarchyColumns
+	var out models.ColumnHierarchy
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, h.DatasetID, h.Levels, h.Taxonomy, h.CreatedBy).StructScan(&out); err != nil {
+		return nil, wrap("hierarchy create", err)
+	}
+	return &out, nil
+}
+
+// List returns a dataset's hierarchies, oldest first
+func (r *HierarchyRepo) List(ctx context.Context, datasetID int64) ([]models.ColumnHierarchy, error) {
+	q := `SELECT ` + hierarchyColumns + ` FROM column_hierarchies WHERE dataset_id=$1 ORDER BY id`
+	var out []models.ColumnHierarchy
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID)
+	return out, wrap("hierarchy list", err)
+}
+
+// Delete removes a hierarchy; sql.ErrNoRows when the dataset has no such
+// hierarchy
+func (r *HierarchyRepo) Delete(ctx context.Context, datasetID, id int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM column_hierarchies WHERE id=$1 AND dataset_id=$2`, id, datasetID)
+	if err != nil {
+		return wrap("hierarchy delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// HousekeepingRepo finds stale resources, cleans them up and stores the
+// cleanup policies
+type HousekeepingRepo struct{ db *sqlx.DB }
+
+func NewHousekeepingRepo(db *sqlx.DB) *HousekeepingRepo { return &HousekeepingRepo{db: db} }
+
+func (r *HousekeepingRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS cleanup_policies (
+        kind TEXT PRIMARY KEY,
+        enabled BOOLEAN NOT NULL DEFAULT FALSE,
+        idle_days INT NOT NULL,
+        updated_by BIGINT NULL,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_generation_jobs_dataset_created ON generation_jobs(dataset_id, created_at)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("housekeeping create schema", err)
+}
+
+// Policies returns the cleanup policies staff have set
+func (r *HousekeepingRepo) Policies(ctx context.Context) ([]models.CleanupPolicy, error) {
+	out := []models.CleanupPolicy{}
+	q := `SELECT kind, enabled, idle_days, updated_by, updated_at FROM cleanup_policies ORDER BY kind`
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q)
+	return out, wrap("housekeeping policies", err)
+}
+
+// UpsertPolicy creates or replaces the cleanup policy of a kind
+func (r *HousekeepingRepo) UpsertPolicy(ctx context.Context, p *models.CleanupPolicy) (*models.CleanupPolicy, error) {
+	q := `INSERT INTO cleanup_policies (kind, enabled, idle_days, updated_by) VALUES ($1,$2,$3,$4)
+          ON CONFLICT (kind) DO UPDATE SET enabled=EXCLUDED.enabled, idle_days=EXCLUDED.idle_days,
+              updated_by=EXCLUDED.updated_by, updated_at=NOW()
+          RETURNING kind, enabled, idle_days, updated_by, updated_at`
+	var out models.CleanupPolicy
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, p.Kind, p.Enabled, p.IdleDays, p.UpdatedBy); err != nil {
+		return nil, wrap("housekeeping upsert policy", err)
+	}
+	return &out, nil
+}
+
+// UnusedDatasets lists datasets created before before that no generation
+// job has used since, largest first. Archived datasets are left out.
+func (r *HousekeepingRepo) UnusedDatasets(ctx context.Context, before time.Time, limit int) ([]models.StaleResource, error) {
+	var rows []struct {
+		models.StaleResource
+		ObjectKey *string `db:"object_key"`
+	}
+	q := `SELECT d.id, d.owner_id, d.name, 'no_recent_jobs' AS reason,
+              CASE WHEN d.object_key IS NULL THEN 0 ELSE d.file_size END AS bytes,
+              d.created_at, j.last_job AS last_activity, d.object_key
+          FROM datasets d
+          LEFT JOIN LATERAL (SELECT MAX(created_at) AS last_job FROM generation_jobs WHERE dataset_id = d.id) j ON TRUE
+          WHERE d.status <> 'archived' AND d.created_at < $1 AND (j.last_job IS NULL OR j.last_job < $1)
+          ORDER BY bytes DESC, d.id LIMIT $2`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, q, before, limit); err != nil {
+		return nil, wrap("housekeeping unused datasets", err)
+	}
+	out := make([]models.StaleResource, len(rows))
+	for i, row := range rows {
+		out[i] = row.StaleResource
+		out[i].Kind = models.StaleDataset
+		out[i].ObjectKeys = objectKeys(row.ObjectKey)
+	}
+	return out, nil
+}
+
+// OrphanedOutputs lists the outputs in platform storage of jobs that
+// finished before before and failed, were cancelled, or lost their dataset
+// or owner. Outputs delivered to an organization's bucket are left out.
+func (r *HousekeepingRepo) OrphanedOutputs(ctx context.Context, before time.Time, limit int) ([]models.StaleResource, error) {
+	var rows []struct {
+		models.StaleResource
+		OutputKey string                 `db:"output_key"`
+		Details   *models.QualityDetails `db:"quality_details"`
+	}
+	q := `SELECT j.id, j.user_id AS owner_id, 'job ' || j.id AS name,
+              CASE WHEN j.status = 'failed' THEN 'job_failed'
+                   WHEN j.status = 'cancelled' THEN 'job_cancelled'
+                   WHEN NOT EXISTS (SELECT 1 FROM datasets d WHERE d.id = j.dataset_id) THEN 'dataset_deleted'
+                   ELSE 'owner_deleted' END AS reason,
+              0::BIGINT AS bytes, j.created_at, COALESCE(j.completed_at, j.started_at) AS last_activity,
+              j.output_key, j.quality_details
+          FROM generation_jobs j
+          WHERE j.output_key IS NOT NULL AND COALESCE(j.completed_at, j.created_at) < $1
+            AND (j.status IN ('failed','cancelled')
+                 OR NOT EXISTS (SELECT 1 FROM datasets d WHERE d.id = j.dataset_id)
+                 OR NOT EXISTS (SELECT 1 FROM users u WHERE u.id = j.user_id))
+            AND COALESCE(j.quality_details, '{}')::jsonb->'delivery' IS NULL
+          ORDER BY j.id LIMIT $2`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, q, before, limit); err != nil {
+		return nil, wrap("housekeeping orphaned outputs", err)
+	}
+	out := make([]models.StaleResource, len(rows))
+	for i, row := range rows {
+		out[i] = row.StaleResource
+		out[i].Kind = models.StaleOutput
+		out[i].ObjectKeys = []string{row.OutputKey}
+		if d := row.Details; d != nil {
+			if d.Output != nil {
+				out[i].Bytes += d.Output.Bytes
+			}
+			for _, e := range append(append([]models.JobExport{}, d.Exports...), d.Reports...) {
+				if e.ObjectKey != "" && e.ObjectKey != row.OutputKey {
+					out[i].Bytes += e.Bytes
+					out[i].ObjectKeys = append(out[i].ObjectKeys, e.ObjectKey)
+				}
+			}
+		}
+	}
+	return out, nil
+}
+
+// UnusedAPIKeys lists active, unexpired API keys created before before
+// that were never used, oldest first
+func (r *HousekeepingRepo) UnusedAPIKeys(ctx context.Context, before time.Time, limit int) ([]models.StaleResource, error) {
+	out := []models.StaleResource{}
+	q := `SELECT id, user_id AS owner_id, name, 'never_used' AS reason, 0::BIGINT AS bytes, created_at, NULL::TIMESTAMPTZ AS last_activity
+          FROM api_keys
+          WHERE is_active AND last_used IS NULL AND created_at < $1 AND (expires_at IS NULL OR expires_at > NOW())
+          ORDER BY created_at, id LIMIT $2`
+	if err := conn(ctx, r.db).SelectContext(ctx, &out, q, before, limit); err != nil {
+		return nil, wrap("housekeeping unused api keys", err)
+	}
+	for i := range out {
+		out[i].Kind = models.StaleAPIKey
+	}
+	return out, nil
+}
+
+// IdleCustomModels lists custom models not used since before, or never used
+// and created before it, largest first. Archived models are left out.
+func (r *HousekeepingRepo) IdleCustomModels(ctx context.Context, before time.Time, limit int) ([]models.StaleResource, error) {
+	var rows []struct {
+		models.StaleResource
+		ModelKey        *string `db:"model_s3_key"`
+		ConfigKey       *string `db:"config_s3_key"`
+		RequirementsKey *string `db:"requirements_s3_key"`
+	}
+	q := `SELECT id, owner_id, name, CASE WHEN last_used_at IS NULL THEN 'never_used' ELSE 'not_used_recently' END AS reason,
+              COALESCE(file_size, 0) AS bytes, created_at, last_used_at AS last_activity,
+              model_s3_key, config_s3_key, requirements_s3_key
+          FROM custom_models
+          WHERE status <> 'archived' AND COALESCE(last_used_at, created_at) < $1
+          ORDER BY bytes DESC, id LIMIT $2`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, q, before, limit); err != nil {
+		return nil, wrap("housekeeping idle custom models", err)
+	}
+	out := make([]models.StaleResource, len(rows))
+	for i, row := range rows {
+		out[i] = row.StaleResource
+		out[i].Kind = models.StaleCustomModel
+		out[i].ObjectKeys = objectKeys(row.ModelKey, row.ConfigKey, row.RequirementsKey)
+	}
+	return out, nil
+}
+
+// ArchiveUnusedDataset archives a dataset and forgets its file, as long as
+// it is still unused since before and still points at the file it was
+// listed with. The file itself is left for the caller to delete.
+func (r *HousekeepingRepo) ArchiveUnusedDataset(ctx context.Context, res models.StaleResource, before time.Time) (bool, error) {
+	q := `UPDATE datasets SET status='archived', object_key=NULL, file_size=0, updated_at=NOW()
+          WHERE id=$1 AND status <> 'archived' AND created_at < $2 AND object_key IS NOT DISTINCT FROM $3
+            AND NOT EXISTS (SELECT 1 FROM generation_jobs j WHERE j.dataset_id = datasets.id AND j.created_at >= $2)`
+	return r.update(ctx, "housekeeping archive unused dataset", q, res.ID, before, firstKey(res.ObjectKeys))
+}
+
+// ClearOrphanedOutput forgets the outputs of a job, as long as it still
+// points at the object it was listed with and was not delivered since. The
+// main output, exports and reports its quality details record keep their
+// checksums but lose their object keys and are marked deleted.
+func (r *HousekeepingRepo) ClearOrphanedOutput(ctx context.Context, res models.StaleResource, _ time.Time) (bool, error) {
+	q := `UPDATE generation_jobs SET output_key=NULL, quality_details=(
+              SELECT (d - 'output' - 'exports' - 'reports')
+                  || CASE WHEN d->'output' IS NULL THEN '{}' ELSE jsonb_build_object('output', ` + deletedExport("d->'output'") + `) END
+                  || ` + deletedExports("exports") + `
+                  || ` + deletedExports("reports") + `
+              FROM (SELECT quality_details::jsonb AS d) details
+          )::text
+          WHERE id=$1 AND output_key=$2 AND COALESCE(quality_details, '{}')::jsonb->'delivery' IS NULL`
+	return r.update(ctx, "housekeeping clear orphaned output", q, res.ID, firstKey(res.ObjectKeys))
+}
+
+// deletedExport is the SQL rewriting the export entry e as deleted when it
+// points at an object, or leaving it as it is
+func deletedExport(e string) string {
+	return `CASE WHEN ` + e + `->>'object_key' IS NULL THEN ` + e + `
+                  ELSE (` + e + ` - 'object_key') || '{"status":"` + models.ExportDeleted + `"}' END`
+}
+
+// deletedExports is the SQL rewriting the export entries under key in the
+// quality details d with deletedExport
+func deletedExports(key string) string {
+	return `CASE WHEN jsonb_typeof(d->'` + key + `') = 'array' THEN jsonb_build_object('` + key + `',
+                  (SELECT COALESCE(jsonb_agg(` + deletedExport("e") + ` ORDER BY n), '[]')
+                   FROM jsonb_array_elements(d->'` + key + `') WITH ORDINALITY AS x(e, n))) ELSE '{}' END`
+}
+
+// DeactivateUnusedAPIKey deactivates an API key, as long as it still was
+// never used
+func (r *HousekeepingRepo) DeactivateUnusedAPIKey(ctx context.Context, res models.StaleResource, before time.Time) (bool, error) {
+	q := `UPDATE api_keys SET is_active=FALSE WHERE id=$1 AND is_active AND last_used IS NULL AND created_at < $2`
+	return r.update(ctx, "housekeeping deactivate unused api key", q, res.ID, before)
+}
+
+// ArchiveIdleCustomModel archives a custom model and forgets its files, as
+// long as it is still idle since before
+func (r *HousekeepingRepo) ArchiveIdleCustomModel(ctx context.Context, res models.StaleResource, before time.Time) (bool, error) {
+	q := `UPDATE custom_models SET status='archived', model_s3_key=NULL, config_s3_key=NULL, requirements_s3_key=NULL,
+              file_size=NULL, updated_at=NOW()
+          WHERE id=$1 AND status <> 'archived' AND COALESCE(last_used_at, created_at) < $2`
+	return r.update(ctx, "housekeeping archive idle custom model", q, res.ID, before)
+}
+
+// update runs a conditional update, reporting whether it changed a row
+func (r *HousekeepingRepo) update(ctx context.Context, op, q string, args ...any) (bool, error) {
+	res, err := conn(ctx, r.db).ExecContext(ctx, q, args...)
+	if err != nil {
+		return false, wrap(op, err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, wrap(op, err)
+}
+
+func objectKeys(keys ...*string) []string {
+	var out []string
+	for _, k := range keys {
+		if k != nil && *k != "" {
+			out = append(out, *k)
+		}
+	}
+	return out
+}
+
+func firstKey(keys []string) *string {
+	if len(keys) == 0 {
+		return nil
+	}
+	return &keys[0]
+}
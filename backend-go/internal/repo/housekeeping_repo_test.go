@@ -0,0 +1,40 @@
+// Package repo_test provides unit tests for stale resource cleanup
+package repo_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHousekeepingRepo_ClearOrphanedOutputForgetsEveryObject(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	housekeeping := repo.NewHousekeepingRepo(testDB.DB)
+	res := models.StaleResource{Kind: models.StaleOutput, ID: 40, ObjectKeys: []string{"outputs/7/40.enc", "outputs/7/40.parquet.enc"}}
+
+	// The exports and reports lose their keys in the update that clears the
+	// output, and a job delivered since is left alone
+	testDB.Mock.ExpectExec(`UPDATE generation_jobs SET output_key=NULL, quality_details=\(.*`+
+		`jsonb_build_object\('output'.*jsonb_build_object\('exports'.*jsonb_build_object\('reports'.*`+
+		`WHERE id=\$1 AND output_key=\$2 AND COALESCE\(quality_details, '\{\}'\)::jsonb->'delivery' IS NULL`).
+		WithArgs(int64(40), "outputs/7/40.enc").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	ok, err := housekeeping.ClearOrphanedOutput(context.Background(), res, time.Now())
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	testDB.Mock.ExpectExec(`UPDATE generation_jobs SET output_key=NULL`).WithArgs(int64(40), "outputs/7/40.enc").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	ok, err = housekeeping.ClearOrphanedOutput(context.Background(), res, time.Now())
+	require.NoError(t, err)
+	assert.False(t, ok, "an output that changed since it was listed is kept")
+	testDB.AssertExpectations(t)
+}
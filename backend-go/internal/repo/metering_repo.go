@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// MeteringRepo stores usage events and their totals per user, meter and
+// billing period
+type MeteringRepo struct{ db *sqlx.DB }
+
+func NewMeteringRepo(db *sqlx.DB) *MeteringRepo { return &MeteringRepo{db: db} }
+
+func (r *MeteringRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS usage_events (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        meter TEXT NOT NULL,
+        quantity DOUBLE PRECISION NOT NULL,
+        idempotency_key TEXT NOT NULL,
+        occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (user_id, meter, idempotency_key)
+    );
+    CREATE INDEX IF NOT EXISTS idx_usage_events_user ON usage_events(user_id, occurred_at DESC);
+    CREATE TABLE IF NOT EXISTS usage_period_totals (
+        user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        period DATE NOT NULL,
+        meter TEXT NOT NULL,
+        quantity DOUBLE PRECISION NOT NULL DEFAULT 0,
+        reported BIGINT NOT NULL DEFAULT 0,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (user_id, period, meter)
+    );
+    CREATE INDEX IF NOT EXISTS idx_usage_period_totals_period ON usage_period_totals(period)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("metering create schema", err)
+}
+
+// Record stores a usage event and adds it to the total of its calendar
+// month in UTC. It reports false, without counting the event again, when
+// the user already recorded one with the same meter and idempotency key.
+func (r *MeteringRepo) Record(ctx context.Context, e *models.UsageEvent) (bool, error) {
+	at := e.OccurredAt
+	if at.IsZero() {
+		at = time.Now()
+	}
+	q := `WITH ev AS (
+              INSERT INTO usage_events (user_id, meter, quantity, idempotency_key, occurred_at) VALUES ($1,$2,$3,$4,$5)
+              ON CONFLICT (user_id, meter, idempotency_key) DO NOTHING
+              RETURNING user_id, meter, quantity, occurred_at
+          )
+          INSERT INTO usage_period_totals (user_id, period, meter, quantity)
+          SELECT user_id, date_trunc('month', occurred_at AT TIME ZONE 'UTC')::date, meter, quantity FROM ev
+          ON CONFLICT (user_id, period, meter) DO UPDATE
+          SET quantity = usage_period_totals.quantity + EXCLUDED.quantity, updated_at = NOW()`
+	res, err := conn(ctx, r.db).ExecContext(ctx, q, e.UserID, e.Meter, e.Quantity, e.IdempotencyKey, at)
+	if err != nil {
+		return false, wrap("metering record", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, wrap("metering record", err)
+}
+
+// Totals returns a user's usage of each meter in the billing period
+// starting at period
+func (r *MeteringRepo) Totals(ctx context.Context, userID int64, period time.Time) ([]models.UsagePeriodTotal, error) {
+	q := `SELECT user_id, period, meter, quantity, reported, updated_at FROM usage_period_totals
+          WHERE user_id=$1 AND period=$2::date ORDER BY meter`
+	var out []models.UsagePeriodTotal
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID, period)
+	return out, wrap("metering totals", err)
+}
+
+// Billable returns the totals of billing periods starting at or after since
+// of users with a Stripe customer
+func (r *MeteringRepo) Billable(ctx context.Context, since time.Time) ([]models.BillableUsage, error) {
+	q := `SELECT t.user_id, t.period, t.meter, t.quantity, t.reported, t.updated_at, u.subscription_tier, u.stripe_customer_id
+          FROM usage_period_totals t JOIN users u ON u.id = t.user_id
+          WHERE t.period >= $1::date AND u.stripe_customer_id IS NOT NULL
+          ORDER BY t.user_id, t.period, t.meter`
+	var out []models.BillableUsage
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, since)
+	return out, wrap("metering billable", err)
+}
+
+// MarkReported records how much of a total's overage was sent to the
+// payment provider; it never decreases
+func (r *MeteringRepo) MarkReported(ctx context.Context, userID int64, period time.Time, meter models.UsageMeter, reported int64) error {
+	q := `UPDATE usage_period_totals SET reported=GREATEST(reported, $4)
+          WHERE user_id=$1 AND period=$2::date AND meter=$3`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, userID, period, meter, reported)
+	return wrap("metering mark reported", err)
+}
+
+// StorageBytes returns the bytes of datasets and custom models each user
+// stores, leaving out users who store none
+func (r *MeteringRepo) StorageBytes(ctx context.Context) (map[int64]int64, error) {
+	var rows []struct {
+		OwnerID int64 `db:"owner_id"`
+		Bytes   int64 `db:"bytes"`
+	}
+	q := `SELECT owner_id, SUM(size)::BIGINT AS bytes FROM (
+              SELECT owner_id, file_size AS size FROM datasets
+              UNION ALL
+              SELECT owner_id, file_size AS size FROM custom_models WHERE file_size IS NOT NULL
+          ) s GROUP BY owner_id HAVING SUM(size) > 0`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, q); err != nil {
+		return nil, wrap("metering storage bytes", err)
+	}
+	out := make(map[int64]int64, len(rows))
+	for _, row := range rows {
+		out[row.OwnerID] = row.Bytes
+	}
+	return out, nil
+}
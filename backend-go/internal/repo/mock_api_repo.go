@@ -0,0 +1,100 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// MockAPIRepo stores the mock endpoints hosted on generated datasets
+type MockAPIRepo struct{ db *sqlx.DB }
+
+func NewMockAPIRepo(db *sqlx.DB) *MockAPIRepo { return &MockAPIRepo{db: db} }
+
+func (r *MockAPIRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS mock_apis (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL,
+        job_id BIGINT NOT NULL REFERENCES generation_jobs(id) ON DELETE CASCADE,
+        name TEXT NOT NULL,
+        public_id TEXT NOT NULL UNIQUE,
+        requests_per_minute INT NOT NULL,
+        expires_at TIMESTAMPTZ NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_mock_apis_user ON mock_apis(user_id);
+    CREATE INDEX IF NOT EXISTS idx_mock_apis_expires ON mock_apis(expires_at)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("mock api create schema", err)
+}
+
+const mockAPIColumns = `id, user_id, job_id, name, public_id, requests_per_minute, expires_at, created_at`
+
+func (r *MockAPIRepo) Create(ctx context.Context, m *models.MockAPI) (*models.MockAPI, error) {
+	q := `INSERT INTO mock_apis (user_id, job_id, name, public_id, requests_per_minute, expires_at)
+          VALUES ($1,$2,$3,$4,$5,$6)
+          RETURNING ` + mockAPIColumns
+	var out models.MockAPI
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, m.UserID, m.JobID, m.Name, m.PublicID, m.RequestsPerMinute, m.ExpiresAt); err != nil {
+		return nil, wrap("mock api create", err)
+	}
+	return &out, nil
+}
+
+func (r *MockAPIRepo) Get(ctx context.Context, userID, id int64) (*models.MockAPI, error) {
+	var out models.MockAPI
+	q := `SELECT ` + mockAPIColumns + ` FROM mock_apis WHERE id=$1 AND user_id=$2`
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, id, userID); err != nil {
+		return nil, wrap("mock api get", err)
+	}
+	return &out, nil
+}
+
+// GetByPublicID returns the mock served at a public ID, expired or not
+func (r *MockAPIRepo) GetByPublicID(ctx context.Context, publicID string) (*models.MockAPI, error) {
+	var out models.MockAPI
+	q := `SELECT ` + mockAPIColumns + ` FROM mock_apis WHERE public_id=$1`
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, publicID); err != nil {
+		return nil, wrap("mock api get by public id", err)
+	}
+	return &out, nil
+}
+
+func (r *MockAPIRepo) List(ctx context.Context, userID int64) ([]models.MockAPI, error) {
+	q := `SELECT ` + mockAPIColumns + ` FROM mock_apis WHERE user_id=$1 ORDER BY id`
+	var out []models.MockAPI
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID)
+	return out, wrap("mock api list", err)
+}
+
+// CountActive counts a user's mocks that have not expired
+func (r *MockAPIRepo) CountActive(ctx context.Context, userID int64) (int, error) {
+	var n int
+	err := conn(ctx, r.db).GetContext(ctx, &n, `SELECT COUNT(*) FROM mock_apis WHERE user_id=$1 AND expires_at > NOW()`, userID)
+	return n, wrap("mock api count active", err)
+}
+
+// Delete removes a mock; it returns sql.ErrNoRows when the user has no
+// such mock
+func (r *MockAPIRepo) Delete(ctx context.Context, userID, id int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM mock_apis WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return wrap("mock api delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// PurgeExpired deletes mocks that expired before t and returns how many
+func (r *MockAPIRepo) PurgeExpired(ctx context.Context, t time.Time) (int64, error) {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM mock_apis WHERE expires_at < $1`, t)
+	if err != nil {
+		return 0, wrap("mock api purge expired", err)
+	}
+	return res.RowsAffected()
+}
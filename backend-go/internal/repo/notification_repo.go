@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// NotificationRepo stores user notifications and delivery preferences
+type NotificationRepo struct{ db *sqlx.DB }
+
+func NewNotificationRepo(db *sqlx.DB) *NotificationRepo { return &NotificationRepo{db: db} }
+
+const notificationColumns = `id, user_id, category, severity, dedupe_key, title, body, status, occurrences, last_seen_at, delivered_at, created_at`
+
+// Defaults for users who never set a preference
+const (
+	DefaultDigestFrequency = models.DigestHourly
+	DefaultDigestHour      = 8
+)
+
+func (r *NotificationRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS notifications (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        category TEXT NOT NULL,
+        severity TEXT NOT NULL DEFAULT 'info',
+        dedupe_key TEXT NULL,
+        title TEXT NOT NULL,
+        body TEXT NOT NULL DEFAULT '',
+        status TEXT NOT NULL DEFAULT 'pending',
+        occurrences INT NOT NULL DEFAULT 1,
+        last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        delivered_at TIMESTAMPTZ NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_notifications_user ON notifications(user_id, created_at DESC);
+    CREATE INDEX IF NOT EXISTS idx_notifications_pending ON notifications(user_id) WHERE status = 'pending';
+    CREATE INDEX IF NOT EXISTS idx_notifications_dedupe ON notifications(user_id, dedupe_key, created_at DESC) WHERE dedupe_key IS NOT NULL;
+    CREATE TABLE IF NOT EXISTS notification_preferences (
+        user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+        frequency TEXT NOT NULL DEFAULT 'hourly',
+        daily_hour INT NOT NULL DEFAULT 8,
+        last_digest_at TIMESTAMPTZ NULL,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("notification create schema", err)
+}
+
+// Record inserts a pending notification. With a dedupe key and a positive
+// window, a notification with the same key created within the window is
+// counted again instead and returned with folded set.
+func (r *NotificationRepo) Record(ctx context.Context, n *models.Notification, window time.Duration) (*models.Notification, bool, error) {
+	var out models.Notification
+	if n.DedupeKey != nil && window > 0 {
+		q := `UPDATE notifications SET occurrences = occurrences + 1, last_seen_at = NOW()
+              WHERE id = (SELECT id FROM notifications WHERE user_id=$1 AND dedupe_key=$2 AND status <> 'failed'
+                          AND created_at > NOW() - make_interval(secs => $3) ORDER BY id DESC LIMIT 1)
+              RETURNING ` + notificationColumns
+		err := conn(ctx, r.db).QueryRowxContext(ctx, q, n.UserID, *n.DedupeKey, window.Seconds()).StructScan(&out)
+		if err == nil {
+			return &out, true, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return nil, false, wrap("notification record", err)
+		}
+	}
+	q := `INSERT INTO notifications (user_id, category, severity, dedupe_key, title, body)
+          VALUES ($1,$2,$3,$4,$5,$6) RETURNING ` + notificationColumns
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, n.UserID, n.Category, n.Severity, n.DedupeKey, n.Title, n.Body).StructScan(&out); err != nil {
+		return nil, false, wrap("notification record", err)
+	}
+	return &out, false, nil
+}
+
+// SetStatus moves notifications to a delivery status; delivered_at is set
+// for sent and digested notifications
+func (r *NotificationRepo) SetStatus(ctx context.Context, ids []int64, status models.NotificationStatus) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	delivered := status == models.NotificationSent || status == models.NotificationDigested
+	q, args, err := sqlx.In(`UPDATE notifications SET status = ?,
+          delivered_at = CASE WHEN ? THEN NOW() ELSE delivered_at END
+          WHERE id IN (?)`, status, delivered, ids)
+	if err != nil {
+		return wrap("notification set status", err)
+	}
+	_, err = conn(ctx, r.db).ExecContext(ctx, r.db.Rebind(q), args...)
+	return wrap("notification set status", err)
+}
+
+// Preference returns a user's delivery preference, or the defaults
+func (r *NotificationRepo) Preference(ctx context.Context, userID int64) (*models.NotificationPreference, error) {
+	q := `SELECT user_id, frequency, daily_hour, last_digest_at, updated_at FROM notification_preferences WHERE user_id=$1`
+	var p models.NotificationPreference
+	err := conn(ctx, r.db).QueryRowxContext(ctx, q, userID).StructScan(&p)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &models.NotificationPreference{UserID: userID, Frequency: DefaultDigestFrequency, DailyHour: DefaultDigestHour}, nil
+	}
+	if err != nil {
+		return nil, wrap("notification preference", err)
+	}
+	return &p, nil
+}
+
+func (r *NotificationRepo) UpsertPreference(ctx context.Context, p *models.NotificationPreference) (*models.NotificationPreference, error) {
+	q := `INSERT INTO notification_preferences (user_id, frequency, daily_hour) VALUES ($1,$2,$3)
+          ON CONFLICT (user_id) DO UPDATE SET frequency=EXCLUDED.frequency, daily_hour=EXCLUDED.daily_hour, updated_at=NOW()
+          RETURNING user_id, frequency, daily_hour, last_digest_at, updated_at`
+	var out models.NotificationPreference
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, p.UserID, p.Frequency, p.DailyHour).StructScan(&out); err != nil {
+		return nil, wrap("notification upsert preference", err)
+	}
+	return &out, nil
+}
+
+// MarkDigestSent records when a user's last digest went out
+func (r *NotificationRepo) MarkDigestSent(ctx context.Context, userID int64, at time.Time) error {
+	q := `INSERT INTO notification_preferences (user_id, frequency, daily_hour, last_digest_at) VALUES ($1,$2,$3,$4)
+          ON CONFLICT (user_id) DO UPDATE SET last_digest_at=EXCLUDED.last_digest_at`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, userID, DefaultDigestFrequency, DefaultDigestHour, at)
+	return wrap("notification mark digest sent", err)
+}
+
+func (r *NotificationRepo) SentSince(ctx context.Context, userID int64, since time.Time) (int, error) {
+	q := `SELECT COUNT(*) FROM notifications WHERE user_id=$1 AND status='sent' AND severity <> 'critical' AND delivered_at >= $2`
+	var n int
+	err := conn(ctx, r.db).GetContext(ctx, &n, q, userID, since)
+	return n, wrap("notification sent since", err)
+}
+
+// PendingUsers lists users with notifications waiting for a digest
+func (r *NotificationRepo) PendingUsers(ctx context.Context) ([]int64, error) {
+	q := `SELECT DISTINCT user_id FROM notifications WHERE status='pending' ORDER BY user_id`
+	var out []int64
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q)
+	return out, wrap("notification pending users", err)
+}
+
+func (r *NotificationRepo) Pending(ctx context.Context, userID int64) ([]models.Notification, error) {
+	q := `SELECT ` + notificationColumns + ` FROM notifications WHERE user_id=$1 AND status='pending' ORDER BY created_at`
+	var out []models.Notification
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID)
+	return out, wrap("notification pending", err)
+}
+
+func (r *NotificationRepo) ListByUser(ctx context.Context, userID int64, limit int) ([]models.Notification, error) {
+	q := `SELECT ` + notificationColumns + ` FROM notifications WHERE user_id=$1 ORDER BY created_at DESC LIMIT $2`
+	var out []models.Notification
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID, limit)
+	return out, wrap("notification list by user", err)
+}
@@ -0,0 +1,164 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// OrgImportRepo stores CSV member imports and the invitation state of
+// their rows
+type OrgImportRepo struct{ db *sqlx.DB }
+
+func NewOrgImportRepo(db *sqlx.DB) *OrgImportRepo { return &OrgImportRepo{db: db} }
+
+func (r *OrgImportRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS org_imports (
+        id BIGSERIAL PRIMARY KEY,
+        org_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+        created_by BIGINT NOT NULL,
+        filename TEXT NOT NULL,
+        total_rows BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        completed_at TIMESTAMPTZ NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_org_imports_org ON org_imports(org_id, created_at DESC);
+    CREATE TABLE IF NOT EXISTS org_import_rows (
+        id BIGSERIAL PRIMARY KEY,
+        import_id BIGINT NOT NULL REFERENCES org_imports(id) ON DELETE CASCADE,
+        line INT NOT NULL,
+        email TEXT NOT NULL,
+        role TEXT NOT NULL,
+        team TEXT NULL,
+        status TEXT NOT NULL,
+        reason TEXT NULL,
+        invitation_id BIGINT NULL,
+        attempts INT NOT NULL DEFAULT 0,
+        claimed_at TIMESTAMPTZ NULL,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_org_import_rows_import ON org_import_rows(import_id, line);
+    CREATE INDEX IF NOT EXISTS idx_org_import_rows_open ON org_import_rows(id) WHERE status IN ('pending','sending')`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("org import create schema", err)
+}
+
+const orgImportRowColumns = `id, import_id, line, email, role, team, status, reason, invitation_id, attempts, updated_at`
+
+// orgImportSelect reads imports with their row counts
+const orgImportSelect = `SELECT i.id, i.org_id, i.created_by, i.filename, i.total_rows, i.created_at, i.completed_at,
+          COUNT(r.id) FILTER (WHERE r.status IN ('pending','sending')) AS pending,
+          COUNT(r.id) FILTER (WHERE r.status='invited') AS invited,
+          COUNT(r.id) FILTER (WHERE r.status='skipped') AS skipped,
+          COUNT(r.id) FILTER (WHERE r.status='failed') AS failed,
+          COUNT(r.id) FILTER (WHERE r.status='invalid') AS invalid
+        FROM org_imports i LEFT JOIN org_import_rows r ON r.import_id = i.id`
+
+// Create stores an import with its rows. An import without rows to invite
+// is complete at once.
+func (r *OrgImportRepo) Create(ctx context.Context, imp *models.OrgImport, rows []models.OrgImportRow) (*models.OrgImport, error) {
+	var id int64
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		q := `INSERT INTO org_imports (org_id, created_by, filename, total_rows) VALUES ($1,$2,$3,$4) RETURNING id`
+		if err := conn(ctx, r.db).GetContext(ctx, &id, q, imp.OrgID, imp.CreatedBy, imp.Filename, len(rows)); err != nil {
+			return err
+		}
+		pending := false
+		for _, row := range rows {
+			q := `INSERT INTO org_import_rows (import_id, line, email, role, team, status, reason) VALUES ($1,$2,$3,$4,$5,$6,$7)`
+			if _, err := conn(ctx, r.db).ExecContext(ctx, q, id, row.Line, row.Email, row.Role, row.Team, row.Status, row.Reason); err != nil {
+				return err
+			}
+			pending = pending || row.Status == models.OrgImportRowPending
+		}
+		if !pending {
+			_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE org_imports SET completed_at=NOW() WHERE id=$1`, id)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, wrap("org import create", err)
+	}
+	return r.Get(ctx, id)
+}
+
+// Get returns an import with its row counts
+func (r *OrgImportRepo) Get(ctx context.Context, id int64) (*models.OrgImport, error) {
+	var out models.OrgImport
+	if err := conn(ctx, r.db).GetContext(ctx, &out, orgImportSelect+` WHERE i.id=$1 GROUP BY i.id`, id); err != nil {
+		return nil, wrap("org import get", err)
+	}
+	return &out, nil
+}
+
+// List returns an organization's imports, newest first
+func (r *OrgImportRepo) List(ctx context.Context, orgID int64, limit int) ([]models.OrgImport, error) {
+	q := orgImportSelect + ` WHERE i.org_id=$1 GROUP BY i.id ORDER BY i.created_at DESC, i.id DESC LIMIT $2`
+	var out []models.OrgImport
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, orgID, limit)
+	return out, wrap("org import list", err)
+}
+
+// Rows returns the rows of an import in file order, those with one status
+// when status is not empty
+func (r *OrgImportRepo) Rows(ctx context.Context, importID int64, status string) ([]models.OrgImportRow, error) {
+	q := `SELECT ` + orgImportRowColumns + ` FROM org_import_rows
+          WHERE import_id=$1 AND ($2 = '' OR status=$2)
+          ORDER BY line`
+	var out []models.OrgImportRow
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, importID, status)
+	return out, wrap("org import rows", err)
+}
+
+// ClaimRows marks up to limit rows waiting for their invitation as being
+// sent, oldest first, with those a worker claimed before staleBefore and
+// never finished
+func (r *OrgImportRepo) ClaimRows(ctx context.Context, limit int, staleBefore time.Time) ([]models.OrgImportRow, error) {
+	q := `UPDATE org_import_rows SET status='sending', claimed_at=NOW(), attempts=attempts+1, updated_at=NOW()
+          WHERE id IN (
+              SELECT id FROM org_import_rows
+              WHERE status='pending' OR (status='sending' AND claimed_at < $2)
+              ORDER BY id LIMIT $1
+              FOR UPDATE SKIP LOCKED)
+          RETURNING ` + orgImportRowColumns
+	var out []models.OrgImportRow
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, limit, staleBefore)
+	return out, wrap("org import claim rows", err)
+}
+
+// FinishRow records how a claimed row went, and completes its import once
+// no row is left to invite
+func (r *OrgImportRepo) FinishRow(ctx context.Context, row *models.OrgImportRow) error {
+	return wrap("org import finish row", WithTx(ctx, r.db, func(ctx context.Context) error {
+		q := `UPDATE org_import_rows SET status=$2, reason=$3, invitation_id=$4, claimed_at=NULL, updated_at=NOW()
+              WHERE id=$1 AND status='sending'`
+		if err := expectOne(conn(ctx, r.db).ExecContext(ctx, q, row.ID, row.Status, row.Reason, row.InvitationID)); err != nil {
+			return err
+		}
+		_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE org_imports SET completed_at=NOW()
+              WHERE id=$1 AND completed_at IS NULL
+                AND NOT EXISTS (SELECT 1 FROM org_import_rows WHERE import_id=$1 AND status IN ('pending','sending'))`, row.ImportID)
+		return err
+	}))
+}
+
+// Retry queues the failed rows of an import again and returns how many
+func (r *OrgImportRepo) Retry(ctx context.Context, importID int64) (int64, error) {
+	var n int64
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE org_import_rows SET status='pending', reason=NULL, updated_at=NOW()
+              WHERE import_id=$1 AND status='failed'`, importID)
+		if err != nil {
+			return err
+		}
+		if n, err = res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+		_, err = conn(ctx, r.db).ExecContext(ctx, `UPDATE org_imports SET completed_at=NULL WHERE id=$1`, importID)
+		return err
+	})
+	return n, wrap("org import retry", err)
+}
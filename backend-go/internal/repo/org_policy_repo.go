@@ -0,0 +1,112 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// OrgPolicyRepo stores the capabilities organization admins disabled and
+// the attempts of members to use them
+type OrgPolicyRepo struct{ db *sqlx.DB }
+
+func NewOrgPolicyRepo(db *sqlx.DB) *OrgPolicyRepo { return &OrgPolicyRepo{db: db} }
+
+func (r *OrgPolicyRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS org_policies (
+        org_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+        capability TEXT NOT NULL,
+        reason TEXT NULL,
+        disabled_by BIGINT NOT NULL,
+        disabled_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (org_id, capability)
+    );
+    CREATE TABLE IF NOT EXISTS org_policy_violations (
+        id BIGSERIAL PRIMARY KEY,
+        org_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+        user_id BIGINT NOT NULL,
+        capability TEXT NOT NULL,
+        action TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_org_policy_violations_org ON org_policy_violations(org_id, created_at DESC)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("org policy create schema", err)
+}
+
+const orgPolicyColumns = `org_id, capability, reason, disabled_by, disabled_at`
+
+// Get returns the policy disabling a capability in an organization;
+// sql.ErrNoRows when the capability is allowed
+func (r *OrgPolicyRepo) Get(ctx context.Context, orgID int64, capability string) (*models.OrgPolicy, error) {
+	q := `SELECT ` + orgPolicyColumns + ` FROM org_policies WHERE org_id=$1 AND capability=$2`
+	var out models.OrgPolicy
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, orgID, capability); err != nil {
+		return nil, wrap("org policy get", err)
+	}
+	return &out, nil
+}
+
+// List returns the capabilities an organization disabled
+func (r *OrgPolicyRepo) List(ctx context.Context, orgID int64) ([]models.OrgPolicy, error) {
+	q := `SELECT ` + orgPolicyColumns + ` FROM org_policies WHERE org_id=$1 ORDER BY capability`
+	var out []models.OrgPolicy
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, orgID)
+	return out, wrap("org policy list", err)
+}
+
+// Disable disables a capability, or updates the reason it is disabled for
+func (r *OrgPolicyRepo) Disable(ctx context.Context, p *models.OrgPolicy) (*models.OrgPolicy, error) {
+	q := `INSERT INTO org_policies (org_id, capability, reason, disabled_by) VALUES ($1,$2,$3,$4)
+          ON CONFLICT (org_id, capability) DO UPDATE SET reason=EXCLUDED.reason
+          RETURNING ` + orgPolicyColumns
+	var out models.OrgPolicy
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, p.OrgID, p.Capability, p.Reason, p.DisabledBy); err != nil {
+		return nil, wrap("org policy disable", err)
+	}
+	return &out, nil
+}
+
+// Enable allows a capability again; sql.ErrNoRows when it was not disabled
+func (r *OrgPolicyRepo) Enable(ctx context.Context, orgID int64, capability string) error {
+	return wrap("org policy enable", expectOne(conn(ctx, r.db).ExecContext(ctx, `DELETE FROM org_policies WHERE org_id=$1 AND capability=$2`, orgID, capability)))
+}
+
+// RecordViolation stores a refused attempt to use a disabled capability
+func (r *OrgPolicyRepo) RecordViolation(ctx context.Context, v *models.OrgPolicyViolation) error {
+	q := `INSERT INTO org_policy_violations (org_id, user_id, capability, action) VALUES ($1,$2,$3,$4)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, v.OrgID, v.UserID, v.Capability, v.Action)
+	return wrap("org policy record violation", err)
+}
+
+// Violations returns an organization's violations, newest first, of one
+// capability when capability is not empty
+func (r *OrgPolicyRepo) Violations(ctx context.Context, orgID int64, capability string, limit int) ([]models.OrgPolicyViolation, error) {
+	q := `SELECT v.id, v.org_id, v.user_id, COALESCE(u.email, '') AS email, v.capability, v.action, v.created_at
+          FROM org_policy_violations v LEFT JOIN users u ON u.id = v.user_id
+          WHERE v.org_id=$1 AND ($2 = '' OR v.capability=$2)
+          ORDER BY v.created_at DESC, v.id DESC LIMIT $3`
+	var out []models.OrgPolicyViolation
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, orgID, capability, limit)
+	return out, wrap("org policy violations", err)
+}
+
+// ViolationCounts returns how many violations of each capability an
+// organization had since a time
+func (r *OrgPolicyRepo) ViolationCounts(ctx context.Context, orgID int64, since time.Time) (map[string]int64, error) {
+	var rows []struct {
+		Capability string `db:"capability"`
+		N          int64  `db:"n"`
+	}
+	q := `SELECT capability, COUNT(*) AS n FROM org_policy_violations WHERE org_id=$1 AND created_at >= $2 GROUP BY capability`
+	if err := conn(ctx, r.db).SelectContext(ctx, &rows, q, orgID, since); err != nil {
+		return nil, wrap("org policy violation counts", err)
+	}
+	out := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		out[row.Capability] = row.N
+	}
+	return out, nil
+}
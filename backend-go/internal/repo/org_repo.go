@@ -0,0 +1,348 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrOrgMemberExists is returned when a user who already belongs to an
+	// organization is added to one
+	ErrOrgMemberExists = errors.New("user already belongs to an organization")
+	// ErrLastOrgOwner is returned when the last owner of an organization
+	// would be demoted or removed
+	ErrLastOrgOwner = errors.New("an organization needs at least one owner")
+)
+
+// OrgRepo stores organizations, their members and invitations. Membership
+// is mirrored in users.org_id, which organization policies follow.
+type OrgRepo struct{ db *sqlx.DB }
+
+func NewOrgRepo(db *sqlx.DB) *OrgRepo { return &OrgRepo{db: db} }
+
+// CreateSchema creates the organization tables. Users assigned to an
+// organization before they existed become members of it.
+func (r *OrgRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS organizations (
+        id BIGSERIAL PRIMARY KEY,
+        name TEXT NOT NULL,
+        created_by BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE TABLE IF NOT EXISTS org_members (
+        org_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+        user_id BIGINT NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+        role TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (org_id, user_id)
+    );
+    CREATE TABLE IF NOT EXISTS org_invitations (
+        id BIGSERIAL PRIMARY KEY,
+        org_id BIGINT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+        email TEXT NOT NULL,
+        role TEXT NOT NULL,
+        token_hash TEXT NOT NULL UNIQUE,
+        invited_by BIGINT NOT NULL,
+        expires_at TIMESTAMPTZ NOT NULL,
+        accepted_at TIMESTAMPTZ NULL,
+        revoked_at TIMESTAMPTZ NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_org_invitations_org ON org_invitations(org_id, created_at DESC);
+    ALTER TABLE org_invitations ADD COLUMN IF NOT EXISTS team TEXT NULL;
+    ALTER TABLE org_members ADD COLUMN IF NOT EXISTS team TEXT NULL;
+    INSERT INTO organizations (id, name)
+        SELECT DISTINCT org_id, 'Organization ' || org_id FROM users WHERE org_id IS NOT NULL
+        ON CONFLICT (id) DO NOTHING;
+    SELECT setval(pg_get_serial_sequence('organizations', 'id'), COALESCE((SELECT MAX(id) FROM organizations), 0) + 1, false);
+    INSERT INTO org_members (org_id, user_id, role)
+        SELECT org_id, id, 'member' FROM users WHERE org_id IS NOT NULL
+        ON CONFLICT DO NOTHING`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("org create schema", err)
+}
+
+const orgInvitationColumns = `id, org_id, email, role, team, token_hash, invited_by, expires_at, accepted_at, revoked_at, created_at`
+
+// Create starts an organization with owner as its first owner
+func (r *OrgRepo) Create(ctx context.Context, name string, owner int64) (*models.Organization, error) {
+	var out models.Organization
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		q := `INSERT INTO organizations (name, created_by) VALUES ($1,$2) RETURNING id, name, created_by, created_at`
+		if err := conn(ctx, r.db).QueryRowxContext(ctx, q, name, owner).StructScan(&out); err != nil {
+			return err
+		}
+		return r.AddMember(ctx, out.ID, owner, models.OrgRoleOwner)
+	})
+	if err != nil {
+		return nil, wrap("org create", err)
+	}
+	return &out, nil
+}
+
+// Get returns an organization
+func (r *OrgRepo) Get(ctx context.Context, id int64) (*models.Organization, error) {
+	var out models.Organization
+	if err := conn(ctx, r.db).GetContext(ctx, &out, `SELECT id, name, created_by, created_at FROM organizations WHERE id=$1`, id); err != nil {
+		return nil, wrap("org get", err)
+	}
+	return &out, nil
+}
+
+// AddMember adds a user to an organization; ErrOrgMemberExists when the
+// user already belongs to one
+func (r *OrgRepo) AddMember(ctx context.Context, orgID, userID int64, role models.OrgRole) error {
+	return wrap("org add member", WithTx(ctx, r.db, func(ctx context.Context) error {
+		res, err := conn(ctx, r.db).ExecContext(ctx, `INSERT INTO org_members (org_id, user_id, role) VALUES ($1,$2,$3)
+              ON CONFLICT (user_id) DO NOTHING`, orgID, userID, role)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrOrgMemberExists
+		}
+		_, err = conn(ctx, r.db).ExecContext(ctx, `UPDATE users SET org_id=$1, updated_at=NOW() WHERE id=$2`, orgID, userID)
+		return err
+	}))
+}
+
+// Assign moves a user into an organization as a member, keeping their role
+// when they already belong to it, or out of any organization when orgID is
+// nil. It is for platform admins and skips the owner checks members are
+// held to. sql.ErrNoRows when the organization does not exist.
+func (r *OrgRepo) Assign(ctx context.Context, userID int64, orgID *int64) error {
+	return wrap("org assign", WithTx(ctx, r.db, func(ctx context.Context) error {
+		if orgID != nil {
+			if _, err := r.Get(ctx, *orgID); err != nil {
+				return err
+			}
+		}
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM org_members WHERE user_id=$1 AND org_id IS DISTINCT FROM $2`, userID, orgID); err != nil {
+			return err
+		}
+		if orgID != nil {
+			if _, err := conn(ctx, r.db).ExecContext(ctx, `INSERT INTO org_members (org_id, user_id, role) VALUES ($1,$2,'member')
+                  ON CONFLICT (user_id) DO NOTHING`, *orgID, userID); err != nil {
+				return err
+			}
+		}
+		_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE users SET org_id=$1, updated_at=NOW() WHERE id=$2`, orgID, userID)
+		return err
+	}))
+}
+
+// Membership returns the organization membership of a user; sql.ErrNoRows
+// when the user belongs to none
+func (r *OrgRepo) Membership(ctx context.Context, userID int64) (*models.OrgMember, error) {
+	q := `SELECT m.org_id, m.user_id, u.email, m.role, m.team, m.created_at
+          FROM org_members m JOIN users u ON u.id = m.user_id WHERE m.user_id=$1`
+	var out models.OrgMember
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, userID); err != nil {
+		return nil, wrap("org membership", err)
+	}
+	return &out, nil
+}
+
+// Members lists the members of an organization, owners first
+func (r *OrgRepo) Members(ctx context.Context, orgID int64) ([]models.OrgMember, error) {
+	q := `SELECT m.org_id, m.user_id, u.email, m.role, m.team, m.created_at
+          FROM org_members m JOIN users u ON u.id = m.user_id WHERE m.org_id=$1
+          ORDER BY CASE m.role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 WHEN 'member' THEN 2 ELSE 3 END, m.created_at`
+	var out []models.OrgMember
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, orgID)
+	return out, wrap("org members", err)
+}
+
+// SetRole changes a member's role; sql.ErrNoRows when the user is not a
+// member and ErrLastOrgOwner when it would leave the organization without
+// an owner
+func (r *OrgRepo) SetRole(ctx context.Context, orgID, userID int64, role models.OrgRole) error {
+	return wrap("org set role", WithTx(ctx, r.db, func(ctx context.Context) error {
+		if role != models.OrgRoleOwner {
+			if err := r.keepOwner(ctx, orgID, userID); err != nil {
+				return err
+			}
+		}
+		_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE org_members SET role=$3 WHERE org_id=$1 AND user_id=$2`, orgID, userID, role)
+		return err
+	}))
+}
+
+// RemoveMember takes a user out of an organization. What they created stays
+// shared with it.
+func (r *OrgRepo) RemoveMember(ctx context.Context, orgID, userID int64) error {
+	return wrap("org remove member", WithTx(ctx, r.db, func(ctx context.Context) error {
+		if err := r.keepOwner(ctx, orgID, userID); err != nil {
+			return err
+		}
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM org_members WHERE org_id=$1 AND user_id=$2`, orgID, userID); err != nil {
+			return err
+		}
+		_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE users SET org_id=NULL, updated_at=NOW() WHERE id=$1`, userID)
+		return err
+	}))
+}
+
+// keepOwner locks the organization's memberships and fails when userID is
+// a member and its only owner
+func (r *OrgRepo) keepOwner(ctx context.Context, orgID, userID int64) error {
+	var roles []struct {
+		UserID int64          `db:"user_id"`
+		Role   models.OrgRole `db:"role"`
+	}
+	if err := conn(ctx, r.db).SelectContext(ctx, &roles, `SELECT user_id, role FROM org_members WHERE org_id=$1 FOR UPDATE`, orgID); err != nil {
+		return err
+	}
+	found, owners, isOwner := false, 0, false
+	for _, m := range roles {
+		if m.Role == models.OrgRoleOwner {
+			owners++
+		}
+		if m.UserID == userID {
+			found, isOwner = true, m.Role == models.OrgRoleOwner
+		}
+	}
+	if !found {
+		return sql.ErrNoRows
+	}
+	if isOwner && owners == 1 {
+		return ErrLastOrgOwner
+	}
+	return nil
+}
+
+// CreateInvitation stores an invitation; an open invitation of the same
+// address to the organization is revoked as superseded
+func (r *OrgRepo) CreateInvitation(ctx context.Context, inv *models.OrgInvitation) (*models.OrgInvitation, error) {
+	var out models.OrgInvitation
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE org_invitations SET revoked_at=NOW()
+              WHERE org_id=$1 AND lower(email)=lower($2) AND accepted_at IS NULL AND revoked_at IS NULL`, inv.OrgID, inv.Email); err != nil {
+			return err
+		}
+		q := `INSERT INTO org_invitations (org_id, email, role, team, token_hash, invited_by, expires_at)
+              VALUES ($1,$2,$3,$4,$5,$6,$7)
+              RETURNING ` + orgInvitationColumns
+		return conn(ctx, r.db).QueryRowxContext(ctx, q, inv.OrgID, inv.Email, inv.Role, inv.Team, inv.TokenHash, inv.InvitedBy, inv.ExpiresAt).StructScan(&out)
+	})
+	if err != nil {
+		return nil, wrap("org create invitation", err)
+	}
+	return &out, nil
+}
+
+// Invitations lists an organization's invitations that can still be
+// accepted
+func (r *OrgRepo) Invitations(ctx context.Context, orgID int64) ([]models.OrgInvitation, error) {
+	q := `SELECT ` + orgInvitationColumns + ` FROM org_invitations
+          WHERE org_id=$1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+          ORDER BY created_at DESC`
+	var out []models.OrgInvitation
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, orgID)
+	return out, wrap("org invitations", err)
+}
+
+// InvitationByToken returns the invitation a token belongs to
+func (r *OrgRepo) InvitationByToken(ctx context.Context, tokenHash string) (*models.OrgInvitation, error) {
+	var out models.OrgInvitation
+	if err := conn(ctx, r.db).GetContext(ctx, &out, `SELECT `+orgInvitationColumns+` FROM org_invitations WHERE token_hash=$1`, tokenHash); err != nil {
+		return nil, wrap("org invitation by token", err)
+	}
+	return &out, nil
+}
+
+// RevokeInvitation revokes an open invitation of an organization;
+// sql.ErrNoRows when there is none
+func (r *OrgRepo) RevokeInvitation(ctx context.Context, orgID, id int64) error {
+	q := `UPDATE org_invitations SET revoked_at=NOW()
+          WHERE id=$1 AND org_id=$2 AND accepted_at IS NULL AND revoked_at IS NULL
+          RETURNING id`
+	var revoked int64
+	return wrap("org revoke invitation", conn(ctx, r.db).GetContext(ctx, &revoked, q, id, orgID))
+}
+
+// OpenInvitation returns the invitation of an address to an organization
+// that can still be accepted; sql.ErrNoRows when there is none
+func (r *OrgRepo) OpenInvitation(ctx context.Context, orgID int64, email string) (*models.OrgInvitation, error) {
+	q := `SELECT ` + orgInvitationColumns + ` FROM org_invitations
+          WHERE org_id=$1 AND lower(email)=lower($2) AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+          ORDER BY created_at DESC LIMIT 1`
+	var out models.OrgInvitation
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, orgID, email); err != nil {
+		return nil, wrap("org open invitation", err)
+	}
+	return &out, nil
+}
+
+// IsMemberEmail reports whether the user with an address is a member of an
+// organization
+func (r *OrgRepo) IsMemberEmail(ctx context.Context, orgID int64, email string) (bool, error) {
+	q := `SELECT EXISTS (SELECT 1 FROM org_members m JOIN users u ON u.id = m.user_id
+          WHERE m.org_id=$1 AND lower(u.email)=lower($2))`
+	var ok bool
+	err := conn(ctx, r.db).GetContext(ctx, &ok, q, orgID, email)
+	return ok, wrap("org is member email", err)
+}
+
+// AcceptInvitation makes userID a member with the invitation's role and
+// team. It returns sql.ErrNoRows when the invitation can no longer be
+// accepted and ErrOrgMemberExists when the user belongs to an organization
+// already.
+func (r *OrgRepo) AcceptInvitation(ctx context.Context, id, userID int64) (*models.OrgInvitation, error) {
+	var out models.OrgInvitation
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		q := `UPDATE org_invitations SET accepted_at=NOW()
+              WHERE id=$1 AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > NOW()
+              RETURNING ` + orgInvitationColumns
+		if err := conn(ctx, r.db).QueryRowxContext(ctx, q, id).StructScan(&out); err != nil {
+			return err
+		}
+		if err := r.AddMember(ctx, out.OrgID, userID, out.Role); err != nil || out.Team == nil {
+			return err
+		}
+		_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE org_members SET team=$3 WHERE org_id=$1 AND user_id=$2`, out.OrgID, userID, out.Team)
+		return err
+	})
+	if err != nil {
+		return nil, wrap("org accept invitation", err)
+	}
+	return &out, nil
+}
+
+// Usage sums the rows generated and reserved since since by jobs shared
+// with an organization, and counts its live datasets and custom models, in
+// total and per member
+func (r *OrgRepo) Usage(ctx context.Context, orgID int64, since time.Time) (*models.OrgUsage, error) {
+	out := models.OrgUsage{OrgID: orgID, Since: since}
+	q := `SELECT
+            (SELECT COALESCE(SUM(rows_generated), 0) FROM generation_jobs
+               WHERE org_id=$1 AND status='completed' AND completed_at >= $2) AS rows_generated,
+            (SELECT COALESCE(SUM(rows_requested), 0) FROM generation_jobs
+               WHERE org_id=$1 AND status IN ('pending','queued','running','paused')) AS rows_reserved,
+            (SELECT COUNT(*) FROM generation_jobs WHERE org_id=$1 AND created_at >= $2) AS generation_jobs,
+            (SELECT COUNT(*) FROM datasets WHERE org_id=$1 AND status <> 'archived') AS datasets,
+            (SELECT COUNT(*) FROM custom_models WHERE org_id=$1) AS custom_models`
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, orgID, since).StructScan(&out); err != nil {
+		return nil, wrap("org usage", err)
+	}
+	mq := `SELECT m.user_id, u.email,
+            COALESCE((SELECT SUM(j.rows_generated) FROM generation_jobs j
+               WHERE j.org_id=m.org_id AND j.user_id=m.user_id AND j.status='completed' AND j.completed_at >= $2), 0) AS rows_generated,
+            (SELECT COUNT(*) FROM generation_jobs j
+               WHERE j.org_id=m.org_id AND j.user_id=m.user_id AND j.created_at >= $2) AS generation_jobs,
+            (SELECT COUNT(*) FROM datasets d
+               WHERE d.org_id=m.org_id AND d.owner_id=m.user_id AND d.status <> 'archived') AS datasets
+          FROM org_members m JOIN users u ON u.id = m.user_id
+          WHERE m.org_id=$1 ORDER BY rows_generated DESC, m.user_id`
+	if err := conn(ctx, r.db).SelectContext(ctx, &out.Members, mq, orgID, since); err != nil {
+		return nil, wrap("org usage", err)
+	}
+	return &out, nil
+}
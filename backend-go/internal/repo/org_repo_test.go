@@ -0,0 +1,84 @@
+// Package repo_test provides unit tests for organization membership
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var orgInvitationCols = []string{"id", "org_id", "email", "role", "team", "token_hash", "invited_by", "expires_at", "accepted_at", "revoked_at", "created_at"}
+
+func TestOrgRepo_AcceptInvitation(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	orgs := repo.NewOrgRepo(testDB.DB)
+	now := time.Now()
+
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectQuery("UPDATE org_invitations SET accepted_at=NOW()").WithArgs(int64(4)).
+		WillReturnRows(sqlmock.NewRows(orgInvitationCols).AddRow(4, 7, "ana@example.com", "admin", nil, "hash", 1, now.Add(time.Hour), now, nil, now))
+	testDB.Mock.ExpectExec("INSERT INTO org_members").WithArgs(int64(7), int64(2), models.OrgRoleAdmin).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	testDB.Mock.ExpectExec("UPDATE users SET org_id").WithArgs(int64(7), int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	testDB.Mock.ExpectCommit()
+
+	inv, err := orgs.AcceptInvitation(context.Background(), 4, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), inv.OrgID)
+	assert.Equal(t, models.OrgRoleAdmin, inv.Role)
+	testDB.AssertExpectations(t)
+}
+
+func TestOrgRepo_AcceptInvitationAlreadyMember(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	orgs := repo.NewOrgRepo(testDB.DB)
+	now := time.Now()
+
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectQuery("UPDATE org_invitations SET accepted_at=NOW()").
+		WillReturnRows(sqlmock.NewRows(orgInvitationCols).AddRow(4, 7, "ana@example.com", "member", nil, "hash", 1, now.Add(time.Hour), now, nil, now))
+	testDB.Mock.ExpectExec("INSERT INTO org_members").WillReturnResult(sqlmock.NewResult(0, 0))
+	testDB.Mock.ExpectRollback()
+
+	_, err := orgs.AcceptInvitation(context.Background(), 4, 2)
+	assert.ErrorIs(t, err, repo.ErrOrgMemberExists)
+	testDB.AssertExpectations(t)
+}
+
+func TestOrgRepo_RemoveLastOwner(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	orgs := repo.NewOrgRepo(testDB.DB)
+
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectQuery("SELECT user_id, role FROM org_members").WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "role"}).AddRow(1, "owner").AddRow(2, "admin"))
+	testDB.Mock.ExpectRollback()
+
+	assert.ErrorIs(t, orgs.RemoveMember(context.Background(), 7, 1), repo.ErrLastOrgOwner)
+	testDB.AssertExpectations(t)
+}
+
+func TestOrgRepo_SetRoleUnknownMember(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	orgs := repo.NewOrgRepo(testDB.DB)
+
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectQuery("SELECT user_id, role FROM org_members").WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "role"}).AddRow(1, "owner"))
+	testDB.Mock.ExpectRollback()
+
+	assert.ErrorIs(t, orgs.SetRole(context.Background(), 7, 9, models.OrgRoleViewer), sql.ErrNoRows)
+	testDB.AssertExpectations(t)
+}
@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// OrgSettingsRepo stores organization defaults for new jobs and datasets
+type OrgSettingsRepo struct{ db *sqlx.DB }
+
+func NewOrgSettingsRepo(db *sqlx.DB) *OrgSettingsRepo { return &OrgSettingsRepo{db: db} }
+
+const orgSettingsColumns = `org_id, privacy_level, provider, retention_days, export_formats, mandatory, created_at, updated_at`
+
+func (r *OrgSettingsRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS org_settings (
+        org_id BIGINT PRIMARY KEY,
+        privacy_level TEXT NULL,
+        provider TEXT NULL,
+        retention_days INT NULL,
+        export_formats TEXT[] NOT NULL DEFAULT '{}',
+        mandatory TEXT[] NOT NULL DEFAULT '{}',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("org settings create schema", err)
+}
+
+func (r *OrgSettingsRepo) GetByOrgID(ctx context.Context, orgID int64) (*models.OrgSettings, error) {
+	q := `SELECT ` + orgSettingsColumns + ` FROM org_settings WHERE org_id=$1`
+	var s models.OrgSettings
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, orgID).StructScan(&s); err != nil {
+		return nil, wrap("org settings get by org id", err)
+	}
+	return &s, nil
+}
+
+func (r *OrgSettingsRepo) Upsert(ctx context.Context, s *models.OrgSettings) (*models.OrgSettings, error) {
+	q := `INSERT INTO org_settings (org_id, privacy_level, provider, retention_days, export_formats, mandatory)
+          VALUES ($1,$2,$3,$4,$5,$6)
+          ON CONFLICT (org_id) DO UPDATE SET privacy_level=EXCLUDED.privacy_level, provider=EXCLUDED.provider,
+              retention_days=EXCLUDED.retention_days, export_formats=EXCLUDED.export_formats,
+              mandatory=EXCLUDED.mandatory, updated_at=NOW()
+          RETURNING ` + orgSettingsColumns
+	formats, mandatory := s.ExportFormats, s.Mandatory
+	if formats == nil {
+		formats = []string{}
+	}
+	if mandatory == nil {
+		mandatory = []string{}
+	}
+	var out models.OrgSettings
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, s.OrgID, s.PrivacyLevel, s.Provider, s.RetentionDays, formats, mandatory).StructScan(&out); err != nil {
+		return nil, wrap("org settings upsert", err)
+	}
+	return &out, nil
+}
+
+// ForUser returns the settings of a user's organization, or nil when the
+// user is outside any organization or it has no settings
+func (r *OrgSettingsRepo) ForUser(ctx context.Context, userID int64) (*models.OrgSettings, error) {
+	q := `SELECT s.org_id, s.privacy_level, s.provider, s.retention_days, s.export_formats, s.mandatory, s.created_at, s.updated_at
+          FROM users u JOIN org_settings s ON s.org_id = u.org_id WHERE u.id=$1`
+	var s models.OrgSettings
+	err := conn(ctx, r.db).QueryRowxContext(ctx, q, userID).StructScan(&s)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, wrap("org settings for user", err)
+	}
+	return &s, nil
+}
@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// OutboxRepo stores domain events until the outbox dispatcher has
+// published them
+type OutboxRepo struct{ db *sqlx.DB }
+
+func NewOutboxRepo(db *sqlx.DB) *OutboxRepo { return &OutboxRepo{db: db} }
+
+const outboxColumns = `id, topic, user_id, payload, status, attempts, done, next_attempt_at, last_error, dispatched_at, created_at`
+
+func (r *OutboxRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS outbox_events (
+        id BIGSERIAL PRIMARY KEY,
+        topic TEXT NOT NULL,
+        user_id BIGINT NOT NULL DEFAULT 0,
+        payload TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INT NOT NULL DEFAULT 0,
+        done TEXT[] NOT NULL DEFAULT '{}',
+        next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        last_error TEXT NULL,
+        dispatched_at TIMESTAMPTZ NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_outbox_events_due ON outbox_events(next_attempt_at) WHERE status='pending';
+    CREATE INDEX IF NOT EXISTS idx_outbox_events_dispatched ON outbox_events(dispatched_at) WHERE status='dispatched'`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("outbox create schema", err)
+}
+
+// Append writes events; called inside WithTx they commit or roll back with
+// the state change they describe
+func (r *OutboxRepo) Append(ctx context.Context, events ...*models.OutboxEvent) error {
+	q := `INSERT INTO outbox_events (topic, user_id, payload) VALUES ($1,$2,$3)`
+	return wrap("outbox append", WithTx(ctx, r.db, func(ctx context.Context) error {
+		for _, e := range events {
+			if _, err := conn(ctx, r.db).ExecContext(ctx, q, e.Topic, e.UserID, e.Payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// ClaimDue returns up to limit due events, oldest first, and pushes them
+// lease into the future so another dispatcher skips them meanwhile
+func (r *OutboxRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.OutboxEvent, error) {
+	q := `UPDATE outbox_events SET next_attempt_at = NOW() + make_interval(secs => $2)
+          WHERE id IN (SELECT id FROM outbox_events
+                       WHERE status='pending' AND next_attempt_at <= NOW()
+                       ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED)
+          RETURNING ` + outboxColumns
+	var out []models.OutboxEvent
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, limit, lease.Seconds())
+	return out, wrap("outbox claim due", err)
+}
+
+// RecordAttempt stores the outcome of an attempt: the handlers done so far
+// and the new status. A pending event is due again at next.
+func (r *OutboxRepo) RecordAttempt(ctx context.Context, id int64, done []string, status models.OutboxStatus, lastError *string, next time.Time) error {
+	q := `UPDATE outbox_events SET done=$2, status=$3, attempts=attempts+1, last_error=$4, next_attempt_at=$5,
+          dispatched_at = CASE WHEN $3='dispatched' THEN NOW() ELSE dispatched_at END
+          WHERE id=$1`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, id, pq.StringArray(done), status, lastError, next)
+	return wrap("outbox record attempt", err)
+}
+
+// PurgeDispatched deletes events dispatched before before and returns how
+// many it deleted; failed events are kept
+func (r *OutboxRepo) PurgeDispatched(ctx context.Context, before time.Time) (int64, error) {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM outbox_events WHERE status='dispatched' AND dispatched_at < $1`, before)
+	if err != nil {
+		return 0, wrap("outbox purge dispatched", err)
+	}
+	return res.RowsAffected()
+}
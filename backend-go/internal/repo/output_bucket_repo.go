@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// OutputBucketRepo stores the buckets organizations have job outputs
+// delivered to
+type OutputBucketRepo struct{ db *sqlx.DB }
+
+func NewOutputBucketRepo(db *sqlx.DB) *OutputBucketRepo { return &OutputBucketRepo{db: db} }
+
+// CreateSchema creates the output bucket table; an organization has at
+// most one
+func (r *OutputBucketRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS org_output_buckets (
+        org_id BIGINT PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+        provider TEXT NOT NULL,
+        bucket TEXT NOT NULL,
+        region TEXT NULL,
+        prefix TEXT NOT NULL DEFAULT '',
+        role_arn TEXT NULL,
+        external_id TEXT NOT NULL,
+        service_account TEXT NULL,
+        status TEXT NOT NULL DEFAULT 'unverified',
+        last_checked_at TIMESTAMPTZ NULL,
+        last_error TEXT NULL,
+        updated_by BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("output bucket create schema", err)
+}
+
+const outputBucketColumns = `org_id, provider, bucket, region, prefix, role_arn, external_id, service_account,
+    status, last_checked_at, last_error, updated_by, created_at, updated_at`
+
+// Get returns an organization's bucket
+func (r *OutputBucketRepo) Get(ctx context.Context, orgID int64) (*models.OutputBucket, error) {
+	q := `SELECT ` + outputBucketColumns + ` FROM org_output_buckets WHERE org_id=$1`
+	var out models.OutputBucket
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, orgID); err != nil {
+		return nil, wrap("output bucket get", err)
+	}
+	return &out, nil
+}
+
+// ForUser returns the bucket of the organization a user belongs to
+func (r *OutputBucketRepo) ForUser(ctx context.Context, userID int64) (*models.OutputBucket, error) {
+	q := `SELECT ` + outputBucketColumns + ` FROM org_output_buckets
+          WHERE org_id = (SELECT org_id FROM org_members WHERE user_id=$1)`
+	var out models.OutputBucket
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, userID); err != nil {
+		return nil, wrap("output bucket for user", err)
+	}
+	return &out, nil
+}
+
+// Upsert registers or replaces an organization's bucket with the result of
+// its permission check. The external ID an organization was first given is
+// kept, so its role's trust policy stays valid across changes.
+func (r *OutputBucketRepo) Upsert(ctx context.Context, b *models.OutputBucket) (*models.OutputBucket, error) {
+	q := `INSERT INTO org_output_buckets (org_id, provider, bucket, region, prefix, role_arn, external_id, service_account,
+            status, last_checked_at, last_error, updated_by)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+          ON CONFLICT (org_id) DO UPDATE SET
+            provider=EXCLUDED.provider, bucket=EXCLUDED.bucket, region=EXCLUDED.region, prefix=EXCLUDED.prefix,
+            role_arn=EXCLUDED.role_arn, service_account=EXCLUDED.service_account, status=EXCLUDED.status,
+            last_checked_at=EXCLUDED.last_checked_at, last_error=EXCLUDED.last_error,
+            updated_by=EXCLUDED.updated_by, updated_at=NOW()
+          RETURNING ` + outputBucketColumns
+	var out models.OutputBucket
+	err := conn(ctx, r.db).QueryRowxContext(ctx, q, b.OrgID, b.Provider, b.Bucket, b.Region, b.Prefix, b.RoleARN,
+		b.ExternalID, b.ServiceAccount, b.Status, b.LastCheckedAt, b.LastError, b.UpdatedBy).StructScan(&out)
+	if err != nil {
+		return nil, wrap("output bucket upsert", err)
+	}
+	return &out, nil
+}
+
+// RecordCheck records the outcome of a permission check or delivery
+func (r *OutputBucketRepo) RecordCheck(ctx context.Context, orgID int64, status string, lastError *string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE org_output_buckets
+          SET status=$2, last_error=$3, last_checked_at=NOW(), updated_at=NOW() WHERE org_id=$1`, orgID, status, lastError)
+	return wrap("output bucket record check", err)
+}
+
+// Delete removes an organization's bucket; outputs of its members go to
+// platform storage again
+func (r *OutputBucketRepo) Delete(ctx context.Context, orgID int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM org_output_buckets WHERE org_id=$1`, orgID)
+	if err != nil {
+		return wrap("output bucket delete", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
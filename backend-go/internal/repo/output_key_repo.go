@@ -0,0 +1,160 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// OutputKeyRepo stores wrapped job output keys and the grants that release them
+type OutputKeyRepo struct{ db *sqlx.DB }
+
+func NewOutputKeyRepo(db *sqlx.DB) *OutputKeyRepo { return &OutputKeyRepo{db: db} }
+
+const outputAccessColumns = `id, job_id, user_id, status, reason, requires_approval, decided_by, decided_at, expires_at,
+          key_releases, last_released_at, created_at`
+
+func (r *OutputKeyRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS job_output_keys (
+        job_id BIGINT PRIMARY KEY REFERENCES generation_jobs(id) ON DELETE CASCADE,
+        master_key_id TEXT NOT NULL,
+        wrapped_key TEXT NOT NULL,
+        algorithm TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE TABLE IF NOT EXISTS job_output_access (
+        id BIGSERIAL PRIMARY KEY,
+        job_id BIGINT NOT NULL REFERENCES generation_jobs(id) ON DELETE CASCADE,
+        user_id BIGINT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'requested',
+        reason TEXT NULL,
+        requires_approval BOOLEAN NOT NULL DEFAULT FALSE,
+        decided_by BIGINT NULL,
+        decided_at TIMESTAMPTZ NULL,
+        expires_at TIMESTAMPTZ NULL,
+        key_releases INT NOT NULL DEFAULT 0,
+        last_released_at TIMESTAMPTZ NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_job_output_access_job_user ON job_output_access(job_id, user_id);
+    CREATE INDEX IF NOT EXISTS idx_job_output_access_status ON job_output_access(status, expires_at)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("output key create schema", err)
+}
+
+// UpsertKey stores the wrapped key of a job's output, replacing the key of
+// an earlier attempt
+func (r *OutputKeyRepo) UpsertKey(ctx context.Context, k *models.JobOutputKey) error {
+	q := `INSERT INTO job_output_keys (job_id, master_key_id, wrapped_key, algorithm) VALUES ($1,$2,$3,$4)
+          ON CONFLICT (job_id) DO UPDATE SET master_key_id=EXCLUDED.master_key_id, wrapped_key=EXCLUDED.wrapped_key,
+              algorithm=EXCLUDED.algorithm, created_at=NOW()`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, k.JobID, k.MasterKeyID, k.WrappedKey, k.Algorithm)
+	return wrap("output key upsert key", err)
+}
+
+func (r *OutputKeyRepo) GetKey(ctx context.Context, jobID int64) (*models.JobOutputKey, error) {
+	q := `SELECT job_id, master_key_id, wrapped_key, algorithm, created_at FROM job_output_keys WHERE job_id=$1`
+	var out models.JobOutputKey
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, jobID).StructScan(&out); err != nil {
+		return nil, wrap("output key get key", err)
+	}
+	return &out, nil
+}
+
+func (r *OutputKeyRepo) CreateGrant(ctx context.Context, g *models.OutputAccessGrant) (*models.OutputAccessGrant, error) {
+	q := `INSERT INTO job_output_access (job_id, user_id, status, reason, requires_approval, expires_at)
+          VALUES ($1,$2,$3,$4,$5,$6)
+          RETURNING ` + outputAccessColumns
+	var out models.OutputAccessGrant
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, g.JobID, g.UserID, g.Status, g.Reason, g.RequiresApproval, g.ExpiresAt).StructScan(&out); err != nil {
+		return nil, wrap("output key create grant", err)
+	}
+	return &out, nil
+}
+
+func (r *OutputKeyRepo) GetGrant(ctx context.Context, id int64) (*models.OutputAccessGrant, error) {
+	q := `SELECT ` + outputAccessColumns + ` FROM job_output_access WHERE id=$1`
+	var out models.OutputAccessGrant
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, id).StructScan(&out); err != nil {
+		return nil, wrap("output key get grant", err)
+	}
+	return &out, nil
+}
+
+// ListGrants lists a user's grants for a job, newest first
+func (r *OutputKeyRepo) ListGrants(ctx context.Context, jobID, userID int64) ([]models.OutputAccessGrant, error) {
+	q := `SELECT ` + outputAccessColumns + ` FROM job_output_access WHERE job_id=$1 AND user_id=$2 ORDER BY created_at DESC`
+	out := make([]models.OutputAccessGrant, 0)
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, jobID, userID)
+	return out, wrap("output key list grants", err)
+}
+
+// ListByStatus lists grants in a status across all jobs, oldest first
+func (r *OutputKeyRepo) ListByStatus(ctx context.Context, status models.OutputAccessStatus, limit int) ([]models.OutputAccessGrant, error) {
+	q := `SELECT ` + outputAccessColumns + ` FROM job_output_access WHERE status=$1 ORDER BY created_at LIMIT $2`
+	out := make([]models.OutputAccessGrant, 0)
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, status, limit)
+	return out, wrap("output key list by status", err)
+}
+
+// ActiveGrant returns a user's unexpired approved grant for a job
+func (r *OutputKeyRepo) ActiveGrant(ctx context.Context, jobID, userID int64) (*models.OutputAccessGrant, error) {
+	q := `SELECT ` + outputAccessColumns + ` FROM job_output_access
+          WHERE job_id=$1 AND user_id=$2 AND status='approved' AND expires_at > NOW()
+          ORDER BY expires_at DESC LIMIT 1`
+	var out models.OutputAccessGrant
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, jobID, userID).StructScan(&out); err != nil {
+		return nil, wrap("output key active grant", err)
+	}
+	return &out, nil
+}
+
+// Decide approves or denies a requested grant. It returns sql.ErrNoRows when
+// the grant is not awaiting a decision.
+func (r *OutputKeyRepo) Decide(ctx context.Context, id, decidedBy int64, status models.OutputAccessStatus, expiresAt *time.Time) (*models.OutputAccessGrant, error) {
+	q := `UPDATE job_output_access SET status=$3, decided_by=$2, decided_at=NOW(), expires_at=$4
+          WHERE id=$1 AND status='requested'
+          RETURNING ` + outputAccessColumns
+	var out models.OutputAccessGrant
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, id, decidedBy, status, expiresAt).StructScan(&out); err != nil {
+		return nil, wrap("output key decide", err)
+	}
+	return &out, nil
+}
+
+// Revoke ends a requested or approved grant early
+func (r *OutputKeyRepo) Revoke(ctx context.Context, id, revokedBy int64) (*models.OutputAccessGrant, error) {
+	q := `UPDATE job_output_access SET status='revoked', decided_by=$2, decided_at=NOW()
+          WHERE id=$1 AND status IN ('requested','approved')
+          RETURNING ` + outputAccessColumns
+	var out models.OutputAccessGrant
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, id, revokedBy).StructScan(&out); err != nil {
+		return nil, wrap("output key revoke", err)
+	}
+	return &out, nil
+}
+
+// RecordRelease counts a key release against a grant that is still active.
+// It returns sql.ErrNoRows when the grant is no longer active.
+func (r *OutputKeyRepo) RecordRelease(ctx context.Context, id int64) (*models.OutputAccessGrant, error) {
+	q := `UPDATE job_output_access SET key_releases=key_releases+1, last_released_at=NOW()
+          WHERE id=$1 AND status='approved' AND expires_at > NOW()
+          RETURNING ` + outputAccessColumns
+	var out models.OutputAccessGrant
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, id).StructScan(&out); err != nil {
+		return nil, wrap("output key record release", err)
+	}
+	return &out, nil
+}
+
+// ExpireDue marks approved grants past their expiry as expired and returns
+// how many were updated
+func (r *OutputKeyRepo) ExpireDue(ctx context.Context, now time.Time) (int64, error) {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE job_output_access SET status='expired' WHERE status='approved' AND expires_at <= $1`, now)
+	if err != nil {
+		return 0, wrap("output key expire due", err)
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,125 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrPrivacyBudgetExhausted is returned when a charge would take a user
+// past their privacy budget on a dataset
+var ErrPrivacyBudgetExhausted = errors.New("privacy budget exhausted")
+
+// PrivacyBudgetRepo keeps the ledger of privacy budget spent per dataset
+// and user, with running totals that charges are checked against
+type PrivacyBudgetRepo struct{ db *sqlx.DB }
+
+func NewPrivacyBudgetRepo(db *sqlx.DB) *PrivacyBudgetRepo { return &PrivacyBudgetRepo{db: db} }
+
+func (r *PrivacyBudgetRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS privacy_budgets (
+        dataset_id BIGINT NOT NULL,
+        user_id BIGINT NOT NULL,
+        spent_epsilon DOUBLE PRECISION NOT NULL DEFAULT 0,
+        spent_delta DOUBLE PRECISION NOT NULL DEFAULT 0,
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (dataset_id, user_id)
+    );
+    CREATE TABLE IF NOT EXISTS privacy_budget_ledger (
+        id BIGSERIAL PRIMARY KEY,
+        dataset_id BIGINT NOT NULL,
+        user_id BIGINT NOT NULL,
+        job_id BIGINT NULL,
+        epsilon DOUBLE PRECISION NOT NULL,
+        delta DOUBLE PRECISION NOT NULL,
+        columns TEXT[] NOT NULL DEFAULT '{}',
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_privacy_budget_ledger_owner ON privacy_budget_ledger(dataset_id, user_id, created_at DESC)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("privacy budget create schema", err)
+}
+
+const privacyBudgetEntryColumns = `id, dataset_id, user_id, job_id, epsilon, delta, columns, created_at`
+
+// Charge records a spend if it keeps the running totals within the limits;
+// ErrPrivacyBudgetExhausted otherwise. The totals row is updated in place,
+// so concurrent charges are serialized and cannot overspend together.
+func (r *PrivacyBudgetRepo) Charge(ctx context.Context, e *models.PrivacyBudgetEntry, maxEpsilon, maxDelta float64) (*models.PrivacyBudgetEntry, error) {
+	var out models.PrivacyBudgetEntry
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `INSERT INTO privacy_budgets (dataset_id, user_id) VALUES ($1,$2)
+          ON CONFLICT (dataset_id, user_id) DO NOTHING`, e.DatasetID, e.UserID); err != nil {
+			return err
+		}
+		res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE privacy_budgets
+          SET spent_epsilon=spent_epsilon+$3, spent_delta=spent_delta+$4, updated_at=NOW()
+          WHERE dataset_id=$1 AND user_id=$2 AND spent_epsilon+$3 <= $5 AND spent_delta+$4 <= $6`,
+			e.DatasetID, e.UserID, e.Epsilon, e.Delta, maxEpsilon, maxDelta)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return ErrPrivacyBudgetExhausted
+		}
+		q := `INSERT INTO privacy_budget_ledger (dataset_id, user_id, job_id, epsilon, delta, columns)
+          VALUES ($1,$2,$3,$4,$5,$6)
+          RETURNING ` + privacyBudgetEntryColumns
+		return conn(ctx, r.db).QueryRowxContext(ctx, q, e.DatasetID, e.UserID, e.JobID, e.Epsilon, e.Delta, e.Columns).StructScan(&out)
+	})
+	if err != nil {
+		return nil, wrap("privacy budget charge", err)
+	}
+	return &out, nil
+}
+
+// AttachJob links a charge to the job it was made for
+func (r *PrivacyBudgetRepo) AttachJob(ctx context.Context, entryID, jobID int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE privacy_budget_ledger SET job_id=$2 WHERE id=$1`, entryID, jobID)
+	if err != nil {
+		return wrap("privacy budget attach job", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Refund reverses a charge whose job was never created; sql.ErrNoRows when
+// there is no such charge
+func (r *PrivacyBudgetRepo) Refund(ctx context.Context, entryID int64) error {
+	return wrap("privacy budget refund", WithTx(ctx, r.db, func(ctx context.Context) error {
+		var e models.PrivacyBudgetEntry
+		q := `DELETE FROM privacy_budget_ledger WHERE id=$1 AND job_id IS NULL RETURNING ` + privacyBudgetEntryColumns
+		if err := conn(ctx, r.db).QueryRowxContext(ctx, q, entryID).StructScan(&e); err != nil {
+			return err
+		}
+		_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE privacy_budgets
+          SET spent_epsilon=GREATEST(spent_epsilon-$3, 0), spent_delta=GREATEST(spent_delta-$4, 0), updated_at=NOW()
+          WHERE dataset_id=$1 AND user_id=$2`, e.DatasetID, e.UserID, e.Epsilon, e.Delta)
+		return err
+	}))
+}
+
+// Spent returns a user's running totals on a dataset; zero before any
+// charge
+func (r *PrivacyBudgetRepo) Spent(ctx context.Context, datasetID, userID int64) (epsilon, delta float64, err error) {
+	err = conn(ctx, r.db).QueryRowxContext(ctx, `SELECT spent_epsilon, spent_delta FROM privacy_budgets WHERE dataset_id=$1 AND user_id=$2`,
+		datasetID, userID).Scan(&epsilon, &delta)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, nil
+	}
+	return epsilon, delta, wrap("privacy budget spent", err)
+}
+
+// Entries lists a user's charges on a dataset, newest first
+func (r *PrivacyBudgetRepo) Entries(ctx context.Context, datasetID, userID int64, limit int) ([]models.PrivacyBudgetEntry, error) {
+	q := `SELECT ` + privacyBudgetEntryColumns + ` FROM privacy_budget_ledger
+          WHERE dataset_id=$1 AND user_id=$2 ORDER BY created_at DESC, id DESC LIMIT $3`
+	var out []models.PrivacyBudgetEntry
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID, userID, limit)
+	return out, wrap("privacy budget entries", err)
+}
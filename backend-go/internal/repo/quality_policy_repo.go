@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// QualityPolicyRepo stores the quality policy of datasets
+type QualityPolicyRepo struct{ db *sqlx.DB }
+
+func NewQualityPolicyRepo(db *sqlx.DB) *QualityPolicyRepo { return &QualityPolicyRepo{db: db} }
+
+func (r *QualityPolicyRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS dataset_quality_policies (
+        dataset_id BIGINT PRIMARY KEY,
+        min_statistical_similarity DOUBLE PRECISION NULL,
+        max_correlation_drift DOUBLE PRECISION NULL,
+        max_privacy_risk DOUBLE PRECISION NULL,
+        min_quality_score DOUBLE PRECISION NULL,
+        on_failure TEXT NOT NULL DEFAULT 'fail',
+        fallback_strategies TEXT[] NOT NULL DEFAULT '{}',
+        updated_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("quality policy create schema", err)
+}
+
+const qualityPolicyColumns = `dataset_id, min_statistical_similarity, max_correlation_drift, max_privacy_risk, min_quality_score,
+    on_failure, fallback_strategies, updated_by, created_at, updated_at`
+
+// Get returns a dataset's policy; sql.ErrNoRows when it has none
+func (r *QualityPolicyRepo) Get(ctx context.Context, datasetID int64) (*models.QualityPolicy, error) {
+	q := `SELECT ` + qualityPolicyColumns + ` FROM dataset_quality_policies WHERE dataset_id=$1`
+	var out models.QualityPolicy
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, datasetID); err != nil {
+		return nil, wrap("quality policy get", err)
+	}
+	return &out, nil
+}
+
+func (r *QualityPolicyRepo) Upsert(ctx context.Context, p *models.QualityPolicy) (*models.QualityPolicy, error) {
+	q := `INSERT INTO dataset_quality_policies (dataset_id, min_statistical_similarity, max_correlation_drift, max_privacy_risk,
+              min_quality_score, on_failure, fallback_strategies, updated_by)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+          ON CONFLICT (dataset_id) DO UPDATE SET min_statistical_similarity=EXCLUDED.min_statistical_similarity,
+              max_correlation_drift=EXCLUDED.max_correlation_drift, max_privacy_risk=EXCLUDED.max_privacy_risk,
+              min_quality_score=EXCLUDED.min_quality_score, on_failure=EXCLUDED.on_failure,
+              fallback_strategies=EXCLUDED.fallback_strategies, updated_by=EXCLUDED.updated_by, updated_at=NOW()
+          RETURNING ` + qualityPolicyColumns
+	var out models.QualityPolicy
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, p.DatasetID, p.MinStatisticalSimilarity, p.MaxCorrelationDrift,
+		p.MaxPrivacyRisk, p.MinQualityScore, p.OnFailure, p.FallbackStrategies, p.UpdatedBy); err != nil {
+		return nil, wrap("quality policy upsert", err)
+	}
+	return &out, nil
+}
+
+// Delete removes a dataset's policy; sql.ErrNoRows when it has none
+func (r *QualityPolicyRepo) Delete(ctx context.Context, datasetID int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM dataset_quality_policies WHERE dataset_id=$1`, datasetID)
+	if err != nil {
+		return wrap("quality policy delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
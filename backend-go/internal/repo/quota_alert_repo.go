@@ -0,0 +1,49 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// QuotaAlertRepo stores the quota thresholds users were warned about
+type QuotaAlertRepo struct{ db *sqlx.DB }
+
+func NewQuotaAlertRepo(db *sqlx.DB) *QuotaAlertRepo { return &QuotaAlertRepo{db: db} }
+
+func (r *QuotaAlertRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS quota_alerts (
+        user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        resource TEXT NOT NULL,
+        period DATE NOT NULL,
+        threshold INT NOT NULL,
+        used BIGINT NOT NULL,
+        limit_value BIGINT NOT NULL,
+        sent_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (user_id, resource, period, threshold)
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("quota alert create schema", err)
+}
+
+// Claim records an alert unless one was already recorded for its user,
+// resource, period and threshold; it reports whether this call recorded it
+func (r *QuotaAlertRepo) Claim(ctx context.Context, a *models.QuotaAlert) (bool, error) {
+	q := `INSERT INTO quota_alerts (user_id, resource, period, threshold, used, limit_value) VALUES ($1,$2,$3::date,$4,$5,$6)
+          ON CONFLICT (user_id, resource, period, threshold) DO NOTHING`
+	res, err := conn(ctx, r.db).ExecContext(ctx, q, a.UserID, a.Resource, a.Period, a.Threshold, a.Used, a.Limit)
+	if err != nil {
+		return false, wrap("quota alert claim", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, wrap("quota alert claim", err)
+}
+
+// Release forgets a claimed alert so it can be sent again
+func (r *QuotaAlertRepo) Release(ctx context.Context, userID int64, resource models.QuotaResource, period time.Time, threshold int) error {
+	q := `DELETE FROM quota_alerts WHERE user_id=$1 AND resource=$2 AND period=$3::date AND threshold=$4`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, userID, resource, period, threshold)
+	return wrap("quota alert release", err)
+}
@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// QuotaOverrideRepo stores the plan limits staff replaced for a user
+type QuotaOverrideRepo struct{ db *sqlx.DB }
+
+func NewQuotaOverrideRepo(db *sqlx.DB) *QuotaOverrideRepo { return &QuotaOverrideRepo{db: db} }
+
+func (r *QuotaOverrideRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS quota_overrides (
+        user_id BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+        monthly_row_limit BIGINT NULL,
+        max_datasets BIGINT NULL,
+        max_custom_models BIGINT NULL,
+        api_rate_limit BIGINT NULL,
+        reason TEXT NOT NULL,
+        granted_by BIGINT NOT NULL,
+        expires_at TIMESTAMPTZ NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("quota override create schema", err)
+}
+
+const quotaOverrideColumns = `user_id, monthly_row_limit, max_datasets, max_custom_models, api_rate_limit, reason, granted_by, expires_at, created_at, updated_at`
+
+// Upsert creates or replaces the override of a user
+func (r *QuotaOverrideRepo) Upsert(ctx context.Context, o *models.QuotaOverride) (*models.QuotaOverride, error) {
+	q := `INSERT INTO quota_overrides (user_id, monthly_row_limit, max_datasets, max_custom_models, api_rate_limit, reason, granted_by, expires_at)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+          ON CONFLICT (user_id) DO UPDATE SET monthly_row_limit=EXCLUDED.monthly_row_limit, max_datasets=EXCLUDED.max_datasets,
+              max_custom_models=EXCLUDED.max_custom_models, api_rate_limit=EXCLUDED.api_rate_limit, reason=EXCLUDED.reason,
+              granted_by=EXCLUDED.granted_by, expires_at=EXCLUDED.expires_at, updated_at=NOW()
+          RETURNING ` + quotaOverrideColumns
+	var out models.QuotaOverride
+	err := conn(ctx, r.db).GetContext(ctx, &out, q, o.UserID, o.MonthlyRowLimit, o.MaxDatasets, o.MaxCustomModels, o.APIRateLimit, o.Reason, o.GrantedBy, o.ExpiresAt)
+	if err != nil {
+		return nil, wrap("quota override upsert", err)
+	}
+	return &out, nil
+}
+
+// Get returns the override of a user, expired or not, or sql.ErrNoRows
+func (r *QuotaOverrideRepo) Get(ctx context.Context, userID int64) (*models.QuotaOverride, error) {
+	var out models.QuotaOverride
+	q := `SELECT ` + quotaOverrideColumns + ` FROM quota_overrides WHERE user_id=$1`
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, userID); err != nil {
+		return nil, wrap("quota override get", err)
+	}
+	return &out, nil
+}
+
+// Active returns the override of a user that applies at now, or nil
+func (r *QuotaOverrideRepo) Active(ctx context.Context, userID int64, now time.Time) (*models.QuotaOverride, error) {
+	var out models.QuotaOverride
+	q := `SELECT ` + quotaOverrideColumns + ` FROM quota_overrides WHERE user_id=$1 AND (expires_at IS NULL OR expires_at > $2)`
+	err := conn(ctx, r.db).GetContext(ctx, &out, q, userID, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, wrap("quota override active", err)
+	}
+	return &out, nil
+}
+
+// Delete removes the override of a user, reporting whether there was one
+func (r *QuotaOverrideRepo) Delete(ctx context.Context, userID int64) (bool, error) {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM quota_overrides WHERE user_id=$1`, userID)
+	if err != nil {
+		return false, wrap("quota override delete", err)
+	}
+	n, err := res.RowsAffected()
+	return n > 0, wrap("quota override delete", err)
+}
@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// RelationshipHintRepo stores relationships discovered between dataset
+// columns and the owner's decisions on them
+type RelationshipHintRepo struct{ db *sqlx.DB }
+
+func NewRelationshipHintRepo(db *sqlx.DB) *RelationshipHintRepo { return &RelationshipHintRepo{db: db} }
+
+func (r *RelationshipHintRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS relationship_hints (
+        id BIGSERIAL PRIMARY KEY,
+        dataset_id BIGINT NOT NULL,
+        kind TEXT NOT NULL,
+        source_column TEXT NOT NULL,
+        target_column TEXT NOT NULL,
+        strength DOUBLE PRECISION NOT NULL,
+        status TEXT NOT NULL DEFAULT 'suggested',
+        decided_by BIGINT,
+        decided_at TIMESTAMPTZ,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (dataset_id, kind, source_column, target_column)
+    );
+    CREATE INDEX IF NOT EXISTS idx_relationship_hints_dataset ON relationship_hints(dataset_id, status)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("relationship hint create schema", err)
+}
+
+const relationshipHintColumns = `id, dataset_id, kind, source_column, target_column, strength, status, decided_by, decided_at, created_at, updated_at`
+
+// ReplaceSuggestions records a discovery run: undecided hints that were not
+// found again are dropped, decided hints keep their decision and take the
+// newly measured strength
+func (r *RelationshipHintRepo) ReplaceSuggestions(ctx context.Context, datasetID int64, hints []models.RelationshipHint) error {
+	return wrap("relationship hint replace suggestions", WithTx(ctx, r.db, func(ctx context.Context) error {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM relationship_hints WHERE dataset_id=$1 AND status='suggested'`, datasetID); err != nil {
+			return err
+		}
+		q := `INSERT INTO relationship_hints (dataset_id, kind, source_column, target_column, strength, status)
+          VALUES ($1,$2,$3,$4,$5,'suggested')
+          ON CONFLICT (dataset_id, kind, source_column, target_column) DO UPDATE SET strength=EXCLUDED.strength, updated_at=NOW()`
+		for _, h := range hints {
+			if _, err := conn(ctx, r.db).ExecContext(ctx, q, datasetID, h.Kind, h.SourceColumn, h.TargetColumn, h.Strength); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// List returns a dataset's hints; an empty status lists all of them
+func (r *RelationshipHintRepo) List(ctx context.Context, datasetID int64, status models.RelationshipHintStatus) ([]models.RelationshipHint, error) {
+	q := `SELECT ` + relationshipHintColumns + ` FROM relationship_hints
+          WHERE dataset_id=$1 AND ($2='' OR status=$2)
+          ORDER BY kind, source_column, target_column`
+	var out []models.RelationshipHint
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID, string(status))
+	return out, wrap("relationship hint list", err)
+}
+
+// Decide accepts or rejects a hint
+func (r *RelationshipHintRepo) Decide(ctx context.Context, datasetID, id, by int64, status models.RelationshipHintStatus) (*models.RelationshipHint, error) {
+	q := `UPDATE relationship_hints SET status=$1, decided_by=$2, decided_at=NOW(), updated_at=NOW()
+          WHERE id=$3 AND dataset_id=$4
+          RETURNING ` + relationshipHintColumns
+	var out models.RelationshipHint
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, status, by, id, datasetID).StructScan(&out); err != nil {
+		return nil, wrap("relationship hint decide", err)
+	}
+	return &out, nil
+}
@@ -0,0 +1,133 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// ReportRepo stores custom report templates and their runs
+type ReportRepo struct{ db *sqlx.DB }
+
+func NewReportRepo(db *sqlx.DB) *ReportRepo { return &ReportRepo{db: db} }
+
+const reportTemplateColumns = `id, name, description, metrics, group_by, filters, chart_type, period, schedule, email_to, webhook_url, webhook_secret, created_by, last_run_at, next_run_at, created_at, updated_at`
+
+func (r *ReportRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS report_templates (
+        id BIGSERIAL PRIMARY KEY,
+        name TEXT NOT NULL,
+        description TEXT NULL,
+        metrics TEXT[] NOT NULL,
+        group_by TEXT[] NOT NULL DEFAULT '{}',
+        filters TEXT NOT NULL DEFAULT '{}',
+        chart_type TEXT NOT NULL DEFAULT 'table',
+        period TEXT NOT NULL DEFAULT 'last_30_days',
+        schedule TEXT NOT NULL DEFAULT '',
+        email_to TEXT[] NOT NULL DEFAULT '{}',
+        webhook_url TEXT NULL,
+        webhook_secret TEXT NULL,
+        created_by BIGINT NOT NULL,
+        last_run_at TIMESTAMPTZ NULL,
+        next_run_at TIMESTAMPTZ NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_report_templates_next_run ON report_templates(next_run_at) WHERE next_run_at IS NOT NULL;
+    CREATE TABLE IF NOT EXISTS report_runs (
+        id BIGSERIAL PRIMARY KEY,
+        template_id BIGINT NOT NULL REFERENCES report_templates(id) ON DELETE CASCADE,
+        trigger TEXT NOT NULL,
+        status TEXT NOT NULL,
+        result TEXT NOT NULL DEFAULT '{}',
+        error TEXT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_report_runs_template ON report_runs(template_id, created_at DESC)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("report create schema", err)
+}
+
+func (r *ReportRepo) InsertTemplate(ctx context.Context, t *models.ReportTemplate) (*models.ReportTemplate, error) {
+	q := `INSERT INTO report_templates (name, description, metrics, group_by, filters, chart_type, period, schedule, email_to, webhook_url, webhook_secret, created_by, next_run_at)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
+          RETURNING ` + reportTemplateColumns
+	var out models.ReportTemplate
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, t.Name, t.Description, t.Metrics, t.GroupBy, t.Filters, t.ChartType, t.Period, t.Schedule,
+		t.EmailTo, t.WebhookURL, t.WebhookSecret, t.CreatedBy, t.NextRunAt).StructScan(&out); err != nil {
+		return nil, wrap("report insert template", err)
+	}
+	return &out, nil
+}
+
+func (r *ReportRepo) UpdateTemplate(ctx context.Context, t *models.ReportTemplate) (*models.ReportTemplate, error) {
+	q := `UPDATE report_templates SET name=$2, description=$3, metrics=$4, group_by=$5, filters=$6, chart_type=$7, period=$8,
+              schedule=$9, email_to=$10, webhook_url=$11, webhook_secret=$12, next_run_at=$13, updated_at=NOW()
+          WHERE id=$1
+          RETURNING ` + reportTemplateColumns
+	var out models.ReportTemplate
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, t.ID, t.Name, t.Description, t.Metrics, t.GroupBy, t.Filters, t.ChartType, t.Period,
+		t.Schedule, t.EmailTo, t.WebhookURL, t.WebhookSecret, t.NextRunAt).StructScan(&out); err != nil {
+		return nil, wrap("report update template", err)
+	}
+	return &out, nil
+}
+
+func (r *ReportRepo) GetTemplate(ctx context.Context, id int64) (*models.ReportTemplate, error) {
+	q := `SELECT ` + reportTemplateColumns + ` FROM report_templates WHERE id=$1`
+	var out models.ReportTemplate
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, id).StructScan(&out); err != nil {
+		return nil, wrap("report get template", err)
+	}
+	return &out, nil
+}
+
+func (r *ReportRepo) ListTemplates(ctx context.Context, limit, offset int) ([]models.ReportTemplate, error) {
+	q := `SELECT ` + reportTemplateColumns + ` FROM report_templates ORDER BY name LIMIT $1 OFFSET $2`
+	var out []models.ReportTemplate
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, limit, offset)
+	return out, wrap("report list templates", err)
+}
+
+func (r *ReportRepo) DeleteTemplate(ctx context.Context, id int64) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM report_templates WHERE id=$1`, id)
+	return wrap("report delete template", err)
+}
+
+// ListDueTemplates returns scheduled templates whose next run is at or before now
+func (r *ReportRepo) ListDueTemplates(ctx context.Context, now time.Time, limit int) ([]models.ReportTemplate, error) {
+	q := `SELECT ` + reportTemplateColumns + ` FROM report_templates
+          WHERE next_run_at IS NOT NULL AND next_run_at <= $1
+          ORDER BY next_run_at LIMIT $2`
+	var out []models.ReportTemplate
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, now, limit)
+	return out, wrap("report list due templates", err)
+}
+
+// MarkTemplateRun records a scheduled run and moves the template to its next slot
+func (r *ReportRepo) MarkTemplateRun(ctx context.Context, id int64, ranAt time.Time, nextRunAt *time.Time) error {
+	q := `UPDATE report_templates SET last_run_at=$2, next_run_at=$3 WHERE id=$1`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, id, ranAt, nextRunAt)
+	return wrap("report mark template run", err)
+}
+
+func (r *ReportRepo) InsertRun(ctx context.Context, run *models.ReportRun) (*models.ReportRun, error) {
+	q := `INSERT INTO report_runs (template_id, trigger, status, result, error)
+          VALUES ($1,$2,$3,$4,$5)
+          RETURNING id, template_id, trigger, status, result, error, created_at`
+	var out models.ReportRun
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, run.TemplateID, run.Trigger, run.Status, run.Result, run.Error).StructScan(&out); err != nil {
+		return nil, wrap("report insert run", err)
+	}
+	return &out, nil
+}
+
+func (r *ReportRepo) ListRuns(ctx context.Context, templateID int64, limit int) ([]models.ReportRun, error) {
+	q := `SELECT id, template_id, trigger, status, result, error, created_at
+          FROM report_runs WHERE template_id=$1 ORDER BY created_at DESC LIMIT $2`
+	var out []models.ReportRun
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, templateID, limit)
+	return out, wrap("report list runs", err)
+}
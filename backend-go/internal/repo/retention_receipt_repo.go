@@ -0,0 +1,46 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// RetentionReceiptRepo stores a receipt for every run of a retention task
+type RetentionReceiptRepo struct{ db *sqlx.DB }
+
+func NewRetentionReceiptRepo(db *sqlx.DB) *RetentionReceiptRepo {
+	return &RetentionReceiptRepo{db: db}
+}
+
+func (r *RetentionReceiptRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS retention_receipts (
+        id BIGSERIAL PRIMARY KEY,
+        task TEXT NOT NULL,
+        started_at TIMESTAMPTZ NOT NULL,
+        finished_at TIMESTAMPTZ NOT NULL,
+        affected BIGINT NOT NULL DEFAULT 0,
+        error TEXT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_retention_receipts_started ON retention_receipts(started_at)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("retention receipt create schema", err)
+}
+
+func (r *RetentionReceiptRepo) Insert(ctx context.Context, rec *models.RetentionReceipt) error {
+	q := `INSERT INTO retention_receipts (task, started_at, finished_at, affected, error)
+          VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	return wrap("retention receipt insert", conn(ctx, r.db).GetContext(ctx, &rec.ID, q, rec.Task, rec.StartedAt, rec.FinishedAt, rec.Affected, rec.Error))
+}
+
+// ListBetween returns the receipts of runs started in [start, end), oldest
+// first
+func (r *RetentionReceiptRepo) ListBetween(ctx context.Context, start, end time.Time) ([]models.RetentionReceipt, error) {
+	q := `SELECT id, task, started_at, finished_at, affected, error FROM retention_receipts
+          WHERE started_at >= $1 AND started_at < $2 ORDER BY started_at, id`
+	var out []models.RetentionReceipt
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, start, end)
+	return out, wrap("retention receipt list between", err)
+}
@@ -0,0 +1,213 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rbac"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrBuiltinRole is returned when a built-in role would be deleted
+	ErrBuiltinRole = errors.New("built-in roles cannot be deleted")
+	// ErrUnknownRole is returned when a role that does not exist is assigned
+	ErrUnknownRole = errors.New("unknown role")
+)
+
+// RoleRepo stores roles, the permissions they grant and the roles assigned
+// to users on top of their account role
+type RoleRepo struct{ db *sqlx.DB }
+
+func NewRoleRepo(db *sqlx.DB) *RoleRepo { return &RoleRepo{db: db} }
+
+func (r *RoleRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS rbac_roles (
+        name TEXT PRIMARY KEY,
+        description TEXT NOT NULL DEFAULT '',
+        builtin BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE TABLE IF NOT EXISTS rbac_role_permissions (
+        role TEXT NOT NULL REFERENCES rbac_roles(name) ON DELETE CASCADE,
+        permission TEXT NOT NULL,
+        PRIMARY KEY (role, permission)
+    );
+    CREATE TABLE IF NOT EXISTS rbac_user_roles (
+        user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        role TEXT NOT NULL REFERENCES rbac_roles(name) ON DELETE CASCADE,
+        granted_by BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        PRIMARY KEY (user_id, role)
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("role create schema", err)
+}
+
+// SeedBuiltins creates the built-in roles that do not exist yet with their
+// default permissions. Roles already there keep the permissions admins gave
+// them.
+func (r *RoleRepo) SeedBuiltins(ctx context.Context, roles map[string][]rbac.Permission) error {
+	return wrap("role seed builtins", WithTx(ctx, r.db, func(ctx context.Context) error {
+		for name, perms := range roles {
+			res, err := conn(ctx, r.db).ExecContext(ctx,
+				`INSERT INTO rbac_roles (name, builtin) VALUES ($1, TRUE) ON CONFLICT (name) DO NOTHING`, name)
+			if err != nil {
+				return err
+			}
+			if n, _ := res.RowsAffected(); n == 0 {
+				continue
+			}
+			if err := r.insertPermissions(ctx, name, perms); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func (r *RoleRepo) insertPermissions(ctx context.Context, role string, perms []rbac.Permission) error {
+	for _, p := range perms {
+		if _, err := conn(ctx, r.db).ExecContext(ctx,
+			`INSERT INTO rbac_role_permissions (role, permission) VALUES ($1,$2) ON CONFLICT DO NOTHING`, role, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const roleSelect = `SELECT ro.name, ro.description, ro.builtin, ro.created_at, ro.updated_at,
+          COALESCE(ARRAY(SELECT permission FROM rbac_role_permissions p WHERE p.role = ro.name ORDER BY permission), '{}') AS permissions
+          FROM rbac_roles ro`
+
+// List returns every role with its permissions, built-in roles first
+func (r *RoleRepo) List(ctx context.Context) ([]models.Role, error) {
+	var out []models.Role
+	err := conn(ctx, r.db).SelectContext(ctx, &out, roleSelect+` ORDER BY ro.builtin DESC, ro.name`)
+	return out, wrap("role list", err)
+}
+
+// Get returns a role with its permissions
+func (r *RoleRepo) Get(ctx context.Context, name string) (*models.Role, error) {
+	var out models.Role
+	if err := conn(ctx, r.db).GetContext(ctx, &out, roleSelect+` WHERE ro.name=$1`, name); err != nil {
+		return nil, wrap("role get", err)
+	}
+	return &out, nil
+}
+
+// Put creates a role or replaces its description and permissions
+func (r *RoleRepo) Put(ctx context.Context, name, description string, perms []rbac.Permission) (*models.Role, error) {
+	var out *models.Role
+	err := WithTx(ctx, r.db, func(ctx context.Context) error {
+		q := `INSERT INTO rbac_roles (name, description) VALUES ($1,$2)
+              ON CONFLICT (name) DO UPDATE SET description=EXCLUDED.description, updated_at=NOW()`
+		if _, err := conn(ctx, r.db).ExecContext(ctx, q, name, description); err != nil {
+			return err
+		}
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM rbac_role_permissions WHERE role=$1`, name); err != nil {
+			return err
+		}
+		if err := r.insertPermissions(ctx, name, perms); err != nil {
+			return err
+		}
+		var err error
+		out, err = r.Get(ctx, name)
+		return err
+	})
+	if err != nil {
+		return nil, wrap("role put", err)
+	}
+	return out, nil
+}
+
+// Delete removes a role that is not built in, and with it every assignment
+func (r *RoleRepo) Delete(ctx context.Context, name string) error {
+	var builtin bool
+	err := conn(ctx, r.db).GetContext(ctx, &builtin,
+		`DELETE FROM rbac_roles WHERE name=$1 AND NOT builtin RETURNING builtin`, name)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return wrap("role delete", err)
+	}
+	if err := conn(ctx, r.db).GetContext(ctx, &builtin, `SELECT builtin FROM rbac_roles WHERE name=$1`, name); err != nil {
+		return wrap("role delete", err)
+	}
+	return ErrBuiltinRole
+}
+
+// UserRoles returns the roles assigned to a user on top of their account role
+func (r *RoleRepo) UserRoles(ctx context.Context, userID int64) ([]string, error) {
+	out := []string{}
+	err := conn(ctx, r.db).SelectContext(ctx, &out,
+		`SELECT role FROM rbac_user_roles WHERE user_id=$1 ORDER BY role`, userID)
+	return out, wrap("role user roles", err)
+}
+
+// SetUserRoles replaces the roles assigned to a user on top of their account
+// role
+func (r *RoleRepo) SetUserRoles(ctx context.Context, userID int64, roles []string, grantedBy int64) error {
+	return wrap("role set user roles", WithTx(ctx, r.db, func(ctx context.Context) error {
+		var known int
+		if err := conn(ctx, r.db).GetContext(ctx, &known,
+			`SELECT COUNT(*) FROM rbac_roles WHERE name = ANY($1)`, pq.Array(roles)); err != nil {
+			return err
+		}
+		if known != len(roles) {
+			return ErrUnknownRole
+		}
+		if _, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM rbac_user_roles WHERE user_id=$1`, userID); err != nil {
+			return err
+		}
+		for _, role := range roles {
+			if _, err := conn(ctx, r.db).ExecContext(ctx,
+				`INSERT INTO rbac_user_roles (user_id, role, granted_by) VALUES ($1,$2,$3)`, userID, role, grantedBy); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// Resolve returns the roles an active user holds, their account role first,
+// and every permission those roles grant. An inactive or unknown user holds
+// nothing.
+func (r *RoleRepo) Resolve(ctx context.Context, userID int64) ([]string, rbac.Set, error) {
+	q := `SELECT u.role AS name, 0 AS rank FROM users u WHERE u.id=$1 AND u.is_active
+          UNION
+          SELECT ur.role, 1 FROM rbac_user_roles ur JOIN users u ON u.id = ur.user_id
+          WHERE ur.user_id=$1 AND u.is_active
+          ORDER BY rank, name`
+	var held []struct {
+		Name string `db:"name"`
+		Rank int    `db:"rank"`
+	}
+	if err := conn(ctx, r.db).SelectContext(ctx, &held, q, userID); err != nil {
+		return nil, nil, wrap("role resolve", err)
+	}
+	roles := make([]string, 0, len(held))
+	seen := map[string]bool{}
+	for _, h := range held {
+		if !seen[h.Name] {
+			seen[h.Name] = true
+			roles = append(roles, h.Name)
+		}
+	}
+	perms := rbac.Set{}
+	if len(roles) == 0 {
+		return roles, perms, nil
+	}
+	var granted []string
+	err := conn(ctx, r.db).SelectContext(ctx, &granted,
+		`SELECT DISTINCT permission FROM rbac_role_permissions WHERE role = ANY($1) ORDER BY permission`, pq.Array(roles))
+	if err != nil {
+		return nil, nil, wrap("role resolve", err)
+	}
+	for _, p := range granted {
+		perms = append(perms, rbac.Permission(p))
+	}
+	return roles, perms, nil
+}
@@ -0,0 +1,74 @@
+// Package repo_test provides unit tests for roles and permissions
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rbac"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleRepo_Resolve(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	roles := repo.NewRoleRepo(testDB.DB)
+
+	testDB.Mock.ExpectQuery("SELECT u.role AS name").WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "rank"}).AddRow("user", 0).AddRow("support", 1).AddRow("user", 1))
+	testDB.Mock.ExpectQuery("SELECT DISTINCT permission FROM rbac_role_permissions").WithArgs(sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("admin:users").AddRow("dataset:*"))
+
+	held, perms, err := roles.Resolve(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user", "support"}, held)
+	assert.Equal(t, rbac.Set{rbac.AdminUsers, "dataset:*"}, perms)
+	testDB.AssertExpectations(t)
+}
+
+func TestRoleRepo_ResolveInactive(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	roles := repo.NewRoleRepo(testDB.DB)
+
+	testDB.Mock.ExpectQuery("SELECT u.role AS name").WithArgs(int64(3)).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "rank"}))
+
+	held, perms, err := roles.Resolve(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Empty(t, held)
+	assert.Empty(t, perms)
+	testDB.AssertExpectations(t)
+}
+
+func TestRoleRepo_DeleteBuiltin(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	roles := repo.NewRoleRepo(testDB.DB)
+
+	testDB.Mock.ExpectQuery("DELETE FROM rbac_roles").WithArgs("admin").WillReturnError(sql.ErrNoRows)
+	testDB.Mock.ExpectQuery("SELECT builtin FROM rbac_roles").WithArgs("admin").
+		WillReturnRows(sqlmock.NewRows([]string{"builtin"}).AddRow(true))
+
+	assert.ErrorIs(t, roles.Delete(context.Background(), "admin"), repo.ErrBuiltinRole)
+	testDB.AssertExpectations(t)
+}
+
+func TestRoleRepo_SetUserRolesUnknown(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	roles := repo.NewRoleRepo(testDB.DB)
+
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	testDB.Mock.ExpectRollback()
+
+	err := roles.SetUserRoles(context.Background(), 3, []string{"support", "ghost"}, 1)
+	assert.ErrorIs(t, err, repo.ErrUnknownRole)
+	testDB.AssertExpectations(t)
+}
@@ -0,0 +1,122 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// SLARepo stores availability samples and monthly SLA attainment reports
+type SLARepo struct{ db *sqlx.DB }
+
+func NewSLARepo(db *sqlx.DB) *SLARepo { return &SLARepo{db: db} }
+
+const slaReportColumns = `id, user_id, month, subscription_tier, availability_target, availability, p95_latency_target, p95_latency_seconds,
+          completed_jobs, availability_met, latency_met, credit_percent, credit_amount, monthly_fee, created_at`
+
+func (r *SLARepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS sla_availability_samples (
+        id BIGSERIAL PRIMARY KEY,
+        sampled_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        healthy BOOLEAN NOT NULL
+    );
+    CREATE INDEX IF NOT EXISTS idx_sla_samples_time ON sla_availability_samples(sampled_at);
+    CREATE TABLE IF NOT EXISTS sla_reports (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL,
+        month DATE NOT NULL,
+        subscription_tier TEXT NOT NULL,
+        availability_target DOUBLE PRECISION NOT NULL,
+        availability DOUBLE PRECISION NULL,
+        p95_latency_target DOUBLE PRECISION NOT NULL,
+        p95_latency_seconds DOUBLE PRECISION NULL,
+        completed_jobs BIGINT NOT NULL DEFAULT 0,
+        availability_met BOOLEAN NOT NULL,
+        latency_met BOOLEAN NOT NULL,
+        credit_percent DOUBLE PRECISION NOT NULL DEFAULT 0,
+        credit_amount NUMERIC(12,2) NOT NULL DEFAULT 0,
+        monthly_fee NUMERIC(12,2) NOT NULL DEFAULT 0,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (user_id, month)
+    )`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("sla create schema", err)
+}
+
+// InsertSample records one availability probe
+func (r *SLARepo) InsertSample(ctx context.Context, at time.Time, healthy bool) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `INSERT INTO sla_availability_samples (sampled_at, healthy) VALUES ($1,$2)`, at, healthy)
+	return wrap("sla insert sample", err)
+}
+
+// Availability returns the percentage of healthy samples in [start, end), or
+// nil if nothing was sampled
+func (r *SLARepo) Availability(ctx context.Context, start, end time.Time) (*float64, error) {
+	q := `SELECT 100.0 * COUNT(*) FILTER (WHERE healthy) / NULLIF(COUNT(*), 0)
+          FROM sla_availability_samples WHERE sampled_at >= $1 AND sampled_at < $2`
+	var pct sql.NullFloat64
+	if err := conn(ctx, r.db).GetContext(ctx, &pct, q, start, end); err != nil {
+		return nil, wrap("sla availability", err)
+	}
+	if !pct.Valid {
+		return nil, nil
+	}
+	return &pct.Float64, nil
+}
+
+// JobLatency returns the number of a user's jobs completed in [start, end)
+// and the 95th percentile of their submit-to-completion time in seconds
+func (r *SLARepo) JobLatency(ctx context.Context, userID int64, start, end time.Time) (int64, *float64, error) {
+	q := `SELECT COUNT(*) AS jobs,
+              percentile_cont(0.95) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM completed_at - created_at)) AS p95
+          FROM generation_jobs
+          WHERE user_id=$1 AND status='completed' AND completed_at >= $2 AND completed_at < $3`
+	var row struct {
+		Jobs int64           `db:"jobs"`
+		P95  sql.NullFloat64 `db:"p95"`
+	}
+	if err := conn(ctx, r.db).GetContext(ctx, &row, q, userID, start, end); err != nil {
+		return 0, nil, wrap("sla job latency", err)
+	}
+	if !row.P95.Valid {
+		return row.Jobs, nil, nil
+	}
+	return row.Jobs, &row.P95.Float64, nil
+}
+
+// UpsertReport stores a user's report for a month, replacing an earlier one
+func (r *SLARepo) UpsertReport(ctx context.Context, rep *models.SLAReport) (*models.SLAReport, error) {
+	q := `INSERT INTO sla_reports (user_id, month, subscription_tier, availability_target, availability, p95_latency_target,
+              p95_latency_seconds, completed_jobs, availability_met, latency_met, credit_percent, credit_amount, monthly_fee)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)
+          ON CONFLICT (user_id, month) DO UPDATE SET subscription_tier=EXCLUDED.subscription_tier,
+              availability_target=EXCLUDED.availability_target, availability=EXCLUDED.availability,
+              p95_latency_target=EXCLUDED.p95_latency_target, p95_latency_seconds=EXCLUDED.p95_latency_seconds,
+              completed_jobs=EXCLUDED.completed_jobs, availability_met=EXCLUDED.availability_met, latency_met=EXCLUDED.latency_met,
+              credit_percent=EXCLUDED.credit_percent, credit_amount=EXCLUDED.credit_amount, monthly_fee=EXCLUDED.monthly_fee
+          RETURNING ` + slaReportColumns
+	var out models.SLAReport
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, rep.UserID, rep.Month, rep.SubscriptionTier, rep.AvailabilityTarget, rep.Availability,
+		rep.P95LatencyTarget, rep.P95LatencySeconds, rep.CompletedJobs, rep.AvailabilityMet, rep.LatencyMet,
+		rep.CreditPercent, rep.CreditAmount, rep.MonthlyFee).StructScan(&out); err != nil {
+		return nil, wrap("sla upsert report", err)
+	}
+	return &out, nil
+}
+
+func (r *SLARepo) ListReportsByMonth(ctx context.Context, month time.Time) ([]models.SLAReport, error) {
+	q := `SELECT ` + slaReportColumns + ` FROM sla_reports WHERE month=$1 ORDER BY user_id`
+	var out []models.SLAReport
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, month)
+	return out, wrap("sla list reports by month", err)
+}
+
+func (r *SLARepo) ListReportsByUser(ctx context.Context, userID int64, limit int) ([]models.SLAReport, error) {
+	q := `SELECT ` + slaReportColumns + ` FROM sla_reports WHERE user_id=$1 ORDER BY month DESC LIMIT $2`
+	var out []models.SLAReport
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID, limit)
+	return out, wrap("sla list reports by user", err)
+}
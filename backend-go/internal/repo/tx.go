@@ -0,0 +1,62 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// querier runs statements on the pool or on a transaction
+type querier interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+type txKey struct{}
+
+// conn returns the transaction ctx carries, so repos called inside WithTx
+// take part in it, or the pool otherwise
+func conn(ctx context.Context, db *sqlx.DB) querier {
+	if tx, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// WithTx runs fn in a transaction that every repo method called with the
+// ctx fn is given takes part in. The transaction commits when fn returns
+// nil and rolls back otherwise; a WithTx inside fn joins it instead of
+// starting another.
+func WithTx(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sqlx.Tx); ok {
+		return fn(ctx)
+	}
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Transactor lets handlers make the calls of several repos atomic
+type Transactor struct{ db *sqlx.DB }
+
+func NewTransactor(db *sqlx.DB) *Transactor { return &Transactor{db: db} }
+
+// WithTx runs fn in a transaction; see WithTx. A nil Transactor runs fn
+// without one.
+func (t *Transactor) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if t == nil {
+		return fn(ctx)
+	}
+	return WithTx(ctx, t.db, fn)
+}
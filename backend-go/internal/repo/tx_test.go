@@ -0,0 +1,101 @@
+// Package repo_test provides unit tests for repository transactions and
+// errors
+package repo_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTxCommitsReposTogether(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	tx := repo.NewTransactor(testDB.DB)
+	relationships := repo.NewRelationshipHintRepo(testDB.DB)
+	webhooks := repo.NewWebhookRepo(testDB.DB)
+
+	// The repos' own transactions join the outer one
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectExec("DELETE FROM relationship_hints").WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 0))
+	testDB.Mock.ExpectExec("INSERT INTO webhook_deliveries").WithArgs(int64(3), "evt-1", "dataset.uploaded", "{}").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	testDB.Mock.ExpectCommit()
+
+	err := tx.WithTx(context.Background(), func(ctx context.Context) error {
+		if err := relationships.ReplaceSuggestions(ctx, 7, nil); err != nil {
+			return err
+		}
+		return webhooks.Enqueue(ctx, []int64{3}, "evt-1", "dataset.uploaded", "{}")
+	})
+	require.NoError(t, err)
+	testDB.AssertExpectations(t)
+}
+
+func TestWithTxRollsBackOnError(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	relationships := repo.NewRelationshipHintRepo(testDB.DB)
+	failed := errors.New("audit insert failed")
+
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectExec("DELETE FROM relationship_hints").WillReturnResult(sqlmock.NewResult(0, 2))
+	testDB.Mock.ExpectExec("INSERT INTO relationship_hints").WillReturnResult(sqlmock.NewResult(1, 1))
+	testDB.Mock.ExpectRollback()
+
+	err := repo.WithTx(context.Background(), testDB.DB, func(ctx context.Context) error {
+		hints := []models.RelationshipHint{{Kind: "correlation", SourceColumn: "age", TargetColumn: "income", Strength: 0.8}}
+		if err := relationships.ReplaceSuggestions(ctx, 7, hints); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+	testDB.AssertExpectations(t)
+}
+
+func TestWithTxWrapsBeginErrors(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	testDB.Mock.ExpectBegin().WillReturnError(errors.New("connection refused"))
+
+	called := false
+	err := repo.WithTx(context.Background(), testDB.DB, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+	assert.ErrorContains(t, err, "begin transaction")
+	assert.False(t, called)
+
+	var none *repo.Transactor
+	assert.NoError(t, none.WithTx(context.Background(), func(ctx context.Context) error { return nil }),
+		"without a transactor fn runs on its own")
+}
+
+func TestRepoErrorsNameTheOperation(t *testing.T) {
+	testDB := testutil.NewTestDB(t)
+	defer testDB.Close()
+	mappings := repo.NewFHIRMappingRepo(testDB.DB)
+	relationships := repo.NewRelationshipHintRepo(testDB.DB)
+
+	testDB.Mock.ExpectQuery("SELECT .* FROM fhir_mappings").WithArgs(int64(7)).WillReturnError(sql.ErrNoRows)
+	_, err := mappings.Get(context.Background(), 7)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "missing rows stay detectable")
+	assert.ErrorContains(t, err, "fhir mapping get")
+
+	// Errors inside a transaction are named once, by the method that ran it
+	testDB.Mock.ExpectBegin()
+	testDB.Mock.ExpectExec("DELETE FROM relationship_hints").WillReturnError(errors.New("connection reset"))
+	testDB.Mock.ExpectRollback()
+	err = relationships.ReplaceSuggestions(context.Background(), 7, nil)
+	assert.EqualError(t, err, "relationship hint replace suggestions: connection reset")
+	testDB.AssertExpectations(t)
+}
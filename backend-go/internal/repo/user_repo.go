@@ -43,8 +43,8 @@ func (r *UserRepo) Create(ctx context.Context, email, hashedPassword string, ful
 	q := `INSERT INTO users (email, hashed_password, full_name, company, role, is_active, is_verified, subscription_tier, created_at, updated_at)
 	VALUES ($1,$2,$3,$4,'user',true,false,'free',NOW(),NOW()) RETURNING id, email, hashed_password, full_name, company, role, is_active, is_verified, subscription_tier, created_at, updated_at`
 	var u models.User
-	if err := r.db.QueryRowxContext(ctx, q, strings.ToLower(email), hashedPassword, fullName, company).StructScan(&u); err != nil {
-		return nil, err
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, strings.ToLower(email), hashedPassword, fullName, company).StructScan(&u); err != nil {
+		return nil, wrap("user create", err)
 	}
 	return &u, nil
 }
@@ -56,8 +56,8 @@ func (r *UserRepo) Create(ctx context.Context, email, hashedPassword string, ful
 func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	q := `SELECT id, email, hashed_password, full_name, company, role, is_active, is_verified, subscription_tier, created_at, updated_at FROM users WHERE email=$1 LIMIT 1`
 	var u models.User
-	if err := r.db.QueryRowxContext(ctx, q, strings.ToLower(email)).StructScan(&u); err != nil {
-		return nil, err
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, strings.ToLower(email)).StructScan(&u); err != nil {
+		return nil, wrap("user get by email", err)
 	}
 	return &u, nil
 }
@@ -68,8 +68,8 @@ func (r *UserRepo) GetByEmail(ctx context.Context, email string) (*models.User,
 func (r *UserRepo) GetByID(ctx context.Context, id int64) (*models.User, error) {
 	q := `SELECT id, email, hashed_password, full_name, company, role, is_active, is_verified, subscription_tier, created_at, updated_at FROM users WHERE id=$1`
 	var u models.User
-	if err := r.db.QueryRowxContext(ctx, q, id).StructScan(&u); err != nil {
-		return nil, err
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, id).StructScan(&u); err != nil {
+		return nil, wrap("user get by id", err)
 	}
 	return &u, nil
 }
@@ -78,8 +78,8 @@ func (r *UserRepo) GetByID(ctx context.Context, id int64) (*models.User, error)
 // This is typically called after successful authentication to track user activity.
 func (r *UserRepo) UpdateLastLogin(ctx context.Context, id int64) error {
 	q := `UPDATE users SET updated_at=NOW() WHERE id=$1`
-	_, err := r.db.ExecContext(ctx, q, id)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, id)
+	return wrap("user update last login", err)
 }
 
 // CreateSchema creates the users table if it doesn't exist.
@@ -98,9 +98,15 @@ func (r *UserRepo) CreateSchema(ctx context.Context) error {
 		subscription_tier TEXT NOT NULL DEFAULT 'free',
 		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
 		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
-	)`
-	_, err := r.db.ExecContext(ctx, stmt)
-	return err
+	);
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS org_id BIGINT NULL;
+	CREATE INDEX IF NOT EXISTS idx_users_org_id ON users(org_id) WHERE org_id IS NOT NULL;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS stripe_customer_id TEXT NULL;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_users_stripe_customer ON users(stripe_customer_id) WHERE stripe_customer_id IS NOT NULL;
+	ALTER TABLE users ADD COLUMN IF NOT EXISTS paddle_customer_id TEXT NULL;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_users_paddle_customer ON users(paddle_customer_id) WHERE paddle_customer_id IS NOT NULL`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("user create schema", err)
 }
 
 // Ping checks the database connection health with a 2-second timeout.
@@ -108,7 +114,7 @@ func (r *UserRepo) CreateSchema(ctx context.Context) error {
 func (r *UserRepo) Ping(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
-	return r.db.PingContext(ctx)
+	return wrap("user ping", r.db.PingContext(ctx))
 }
 
 // List retrieves a paginated list of users ordered by creation date (newest first).
@@ -119,20 +125,43 @@ func (r *UserRepo) Ping(ctx context.Context) error {
 //   - offset: Number of users to skip (for pagination)
 func (r *UserRepo) List(ctx context.Context, limit, offset int) ([]models.User, error) {
 	q := `SELECT id, email, full_name, company, role, is_active, is_verified, subscription_tier, created_at, updated_at FROM users ORDER BY created_at DESC LIMIT $1 OFFSET $2`
-	rows, err := r.db.QueryxContext(ctx, q, limit, offset)
+	rows, err := conn(ctx, r.db).QueryxContext(ctx, q, limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, wrap("user list", err)
 	}
 	defer rows.Close()
 	var res []models.User
 	for rows.Next() {
 		var u models.User
 		if err := rows.StructScan(&u); err != nil {
-			return nil, err
+			return nil, wrap("user list", err)
 		}
 		res = append(res, u)
 	}
-	return res, rows.Err()
+	return res, wrap("user list", rows.Err())
+}
+
+// UserSearch filters the users an admin lists. Query matches part of the
+// email, full name or company; empty filters match everyone.
+type UserSearch struct {
+	Query  string
+	Tier   models.SubscriptionTier
+	Active *bool
+	Limit  int
+	Offset int
+}
+
+// Search lists the users matching s, newest first, without their password
+// hashes.
+func (r *UserRepo) Search(ctx context.Context, s UserSearch) ([]models.User, error) {
+	q := `SELECT id, email, full_name, company, role, is_active, is_verified, subscription_tier, created_at, updated_at FROM users
+	WHERE ($1 = '' OR email ILIKE '%' || $1 || '%' OR full_name ILIKE '%' || $1 || '%' OR company ILIKE '%' || $1 || '%')
+	AND ($2 = '' OR subscription_tier = $2) AND ($3::boolean IS NULL OR is_active = $3)
+	ORDER BY created_at DESC LIMIT $4 OFFSET $5`
+	query := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.TrimSpace(s.Query))
+	res := []models.User{}
+	err := conn(ctx, r.db).SelectContext(ctx, &res, q, query, string(s.Tier), s.Active, s.Limit, s.Offset)
+	return res, wrap("user search", err)
 }
 
 // UpdateActive updates the is_active status of a user.
@@ -140,24 +169,94 @@ func (r *UserRepo) List(ctx context.Context, limit, offset int) ([]models.User,
 // This is typically used for account suspension or deactivation.
 func (r *UserRepo) UpdateActive(ctx context.Context, id int64, active bool) error {
 	q := `UPDATE users SET is_active=$1, updated_at=NOW() WHERE id=$2`
-	_, err := r.db.ExecContext(ctx, q, active, id)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, active, id)
+	return wrap("user update active", err)
 }
 
 // UpdateRole updates the role of a user (e.g., 'user', 'admin').
 // This affects the user's permissions and access levels.
 func (r *UserRepo) UpdateRole(ctx context.Context, id int64, role string) error {
 	q := `UPDATE users SET role=$1, updated_at=NOW() WHERE id=$2`
-	_, err := r.db.ExecContext(ctx, q, role, id)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, role, id)
+	return wrap("user update role", err)
+}
+
+// GetOrgID returns the organization a user belongs to, or nil when the user
+// is not part of one.
+func (r *UserRepo) GetOrgID(ctx context.Context, id int64) (*int64, error) {
+	var orgID *int64
+	err := conn(ctx, r.db).GetContext(ctx, &orgID, `SELECT org_id FROM users WHERE id=$1`, id)
+	return orgID, wrap("user get org id", err)
+}
+
+// SetOrgID assigns a user to an organization; nil removes the membership.
+// Organization policies such as zero-real-data generation follow it.
+func (r *UserRepo) SetOrgID(ctx context.Context, id int64, orgID *int64) error {
+	q := `UPDATE users SET org_id=$1, updated_at=NOW() WHERE id=$2`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, orgID, id)
+	return wrap("user set org id", err)
+}
+
+// UpdateSubscriptionTier sets the tier a user's limits are drawn from.
+// Billing webhooks call it as subscriptions start, change and end.
+func (r *UserRepo) UpdateSubscriptionTier(ctx context.Context, id int64, tier models.SubscriptionTier) error {
+	q := `UPDATE users SET subscription_tier=$1, updated_at=NOW() WHERE id=$2`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, tier, id)
+	return wrap("user update subscription tier", err)
+}
+
+// StripeCustomerID returns the Stripe customer of a user, or nil when one
+// has not been created yet.
+func (r *UserRepo) StripeCustomerID(ctx context.Context, id int64) (*string, error) {
+	var customerID *string
+	err := conn(ctx, r.db).GetContext(ctx, &customerID, `SELECT stripe_customer_id FROM users WHERE id=$1`, id)
+	return customerID, wrap("user stripe customer id", err)
+}
+
+// SetStripeCustomerID links a user to their Stripe customer.
+func (r *UserRepo) SetStripeCustomerID(ctx context.Context, id int64, customerID string) error {
+	q := `UPDATE users SET stripe_customer_id=$1, updated_at=NOW() WHERE id=$2`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, customerID, id)
+	return wrap("user set stripe customer id", err)
+}
+
+// GetIDByStripeCustomer returns the user linked to a Stripe customer, or
+// sql.ErrNoRows when there is none.
+func (r *UserRepo) GetIDByStripeCustomer(ctx context.Context, customerID string) (int64, error) {
+	var id int64
+	err := conn(ctx, r.db).GetContext(ctx, &id, `SELECT id FROM users WHERE stripe_customer_id=$1`, customerID)
+	return id, wrap("user get id by stripe customer", err)
+}
+
+// PaddleCustomerID returns the Paddle customer of a user, or nil when one
+// has not been created yet.
+func (r *UserRepo) PaddleCustomerID(ctx context.Context, id int64) (*string, error) {
+	var customerID *string
+	err := conn(ctx, r.db).GetContext(ctx, &customerID, `SELECT paddle_customer_id FROM users WHERE id=$1`, id)
+	return customerID, wrap("user paddle customer id", err)
+}
+
+// SetPaddleCustomerID links a user to their Paddle customer.
+func (r *UserRepo) SetPaddleCustomerID(ctx context.Context, id int64, customerID string) error {
+	q := `UPDATE users SET paddle_customer_id=$1, updated_at=NOW() WHERE id=$2`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, customerID, id)
+	return wrap("user set paddle customer id", err)
+}
+
+// GetIDByPaddleCustomer returns the user linked to a Paddle customer, or
+// sql.ErrNoRows when there is none.
+func (r *UserRepo) GetIDByPaddleCustomer(ctx context.Context, customerID string) (int64, error) {
+	var id int64
+	err := conn(ctx, r.db).GetContext(ctx, &id, `SELECT id FROM users WHERE paddle_customer_id=$1`, customerID)
+	return id, wrap("user get id by paddle customer", err)
 }
 
 // UpdateVerified updates the email verification status of a user.
 // This is typically set to true after a user confirms their email address.
 func (r *UserRepo) UpdateVerified(ctx context.Context, userID int64, isVerified bool) error {
 	q := `UPDATE users SET is_verified=$1, updated_at=NOW() WHERE id=$2`
-	_, err := r.db.ExecContext(ctx, q, isVerified, userID)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, isVerified, userID)
+	return wrap("user update verified", err)
 }
 
 // UpdatePassword updates the hashed password for a user.
@@ -165,8 +264,8 @@ func (r *UserRepo) UpdateVerified(ctx context.Context, userID int64, isVerified
 // This is used for password reset and password change operations.
 func (r *UserRepo) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) error {
 	q := `UPDATE users SET hashed_password=$1, updated_at=NOW() WHERE id=$2`
-	_, err := r.db.ExecContext(ctx, q, hashedPassword, userID)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, hashedPassword, userID)
+	return wrap("user update password", err)
 }
 
 // Update updates the basic profile information for a user.
@@ -174,8 +273,8 @@ func (r *UserRepo) UpdatePassword(ctx context.Context, userID int64, hashedPassw
 // The email is automatically normalized to lowercase.
 func (r *UserRepo) Update(ctx context.Context, user *models.User) error {
 	q := `UPDATE users SET email=$1, full_name=$2, company=$3, updated_at=NOW() WHERE id=$4`
-	_, err := r.db.ExecContext(ctx, q, strings.ToLower(user.Email), user.FullName, user.Company, user.ID)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, strings.ToLower(user.Email), user.FullName, user.Company, user.ID)
+	return wrap("user update", err)
 }
 
 // Delete permanently removes a user from the database.
@@ -183,6 +282,6 @@ func (r *UserRepo) Update(ctx context.Context, user *models.User) error {
 // instead for production use to maintain referential integrity and audit trails.
 func (r *UserRepo) Delete(ctx context.Context, id int64) error {
 	q := `DELETE FROM users WHERE id=$1`
-	_, err := r.db.ExecContext(ctx, q, id)
-	return err
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, id)
+	return wrap("user delete", err)
 }
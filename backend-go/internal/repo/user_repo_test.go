@@ -114,7 +114,7 @@ func TestUserRepo_GetByEmail(t *testing.T) {
 
 		require.Error(t, err)
 		require.Nil(t, user)
-		assert.Equal(t, sql.ErrNoRows, err)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
 
 		testDB.AssertExpectations(t)
 	})
@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// VocabularyRepo stores users' controlled vocabularies and the dataset
+// columns bound to them
+type VocabularyRepo struct{ db *sqlx.DB }
+
+func NewVocabularyRepo(db *sqlx.DB) *VocabularyRepo { return &VocabularyRepo{db: db} }
+
+func (r *VocabularyRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS vocabularies (
+        id BIGSERIAL PRIMARY KEY,
+        owner_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+        name TEXT NOT NULL,
+        description TEXT NULL,
+        entry_count INT NOT NULL,
+        entries TEXT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_vocabularies_owner ON vocabularies(owner_id);
+    CREATE TABLE IF NOT EXISTS column_vocabularies (
+        id BIGSERIAL PRIMARY KEY,
+        dataset_id BIGINT NOT NULL,
+        column_name TEXT NOT NULL,
+        vocabulary_id BIGINT NOT NULL REFERENCES vocabularies(id),
+        weighting TEXT NOT NULL,
+        created_by BIGINT NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (dataset_id, column_name)
+    );
+    CREATE INDEX IF NOT EXISTS idx_column_vocabularies_vocabulary ON column_vocabularies(vocabulary_id)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("vocabulary create schema", err)
+}
+
+const (
+	vocabularyColumns       = `id, owner_id, name, description, entry_count, created_at`
+	columnVocabularyColumns = `id, dataset_id, column_name, vocabulary_id, weighting, created_by, created_at`
+)
+
+func (r *VocabularyRepo) Insert(ctx context.Context, v *models.Vocabulary) (*models.Vocabulary, error) {
+	q := `INSERT INTO vocabularies (owner_id, name, description, entry_count, entries)
+          VALUES ($1,$2,$3,$4,$5) RETURNING ` + vocabularyColumns
+	var out models.Vocabulary
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, v.OwnerID, v.Name, v.Description, len(v.Entries), v.Entries); err != nil {
+		return nil, wrap("vocabulary insert", err)
+	}
+	out.Entries = v.Entries
+	return &out, nil
+}
+
+// Get returns a vocabulary of the owner with its entries
+func (r *VocabularyRepo) Get(ctx context.Context, owner, id int64) (*models.Vocabulary, error) {
+	q := `SELECT ` + vocabularyColumns + `, entries FROM vocabularies WHERE id=$1 AND owner_id=$2`
+	var out models.Vocabulary
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, id, owner); err != nil {
+		return nil, wrap("vocabulary get", err)
+	}
+	return &out, nil
+}
+
+// List returns the owner's vocabularies by name, without their entries
+func (r *VocabularyRepo) List(ctx context.Context, owner int64) ([]models.Vocabulary, error) {
+	q := `SELECT ` + vocabularyColumns + ` FROM vocabularies WHERE owner_id=$1 ORDER BY lower(name), id`
+	out := []models.Vocabulary{}
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, owner)
+	return out, wrap("vocabulary list", err)
+}
+
+// Delete removes a vocabulary; sql.ErrNoRows when the owner has no such
+// vocabulary
+func (r *VocabularyRepo) Delete(ctx context.Context, owner, id int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM vocabularies WHERE id=$1 AND owner_id=$2`, id, owner)
+	if err != nil {
+		return wrap("vocabulary delete", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CountBindings returns how many dataset columns are bound to a vocabulary
+func (r *VocabularyRepo) CountBindings(ctx context.Context, id int64) (int64, error) {
+	var n int64
+	err := conn(ctx, r.db).GetContext(ctx, &n, `SELECT COUNT(*) FROM column_vocabularies WHERE vocabulary_id=$1`, id)
+	return n, wrap("vocabulary count bindings", err)
+}
+
+// Bind binds a dataset column to a vocabulary, replacing its binding
+func (r *VocabularyRepo) Bind(ctx context.Context, b *models.ColumnVocabulary) (*models.ColumnVocabulary, error) {
+	q := `INSERT INTO column_vocabularies (dataset_id, column_name, vocabulary_id, weighting, created_by)
+          VALUES ($1,$2,$3,$4,$5)
+          ON CONFLICT (dataset_id, column_name) DO UPDATE SET vocabulary_id=EXCLUDED.vocabulary_id,
+              weighting=EXCLUDED.weighting, created_by=EXCLUDED.created_by, created_at=NOW()
+          RETURNING ` + columnVocabularyColumns
+	var out models.ColumnVocabulary
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, b.DatasetID, b.ColumnName, b.VocabularyID, b.Weighting, b.CreatedBy); err != nil {
+		return nil, wrap("vocabulary bind", err)
+	}
+	return &out, nil
+}
+
+// Bindings returns the vocabulary bindings of a dataset's columns, by column
+func (r *VocabularyRepo) Bindings(ctx context.Context, datasetID int64) ([]models.ColumnVocabulary, error) {
+	q := `SELECT ` + columnVocabularyColumns + ` FROM column_vocabularies WHERE dataset_id=$1 ORDER BY column_name`
+	var out []models.ColumnVocabulary
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, datasetID)
+	return out, wrap("vocabulary bindings", err)
+}
+
+// Unbind removes a column's binding; sql.ErrNoRows when it has none
+func (r *VocabularyRepo) Unbind(ctx context.Context, datasetID int64, column string) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM column_vocabularies WHERE dataset_id=$1 AND column_name=$2`, datasetID, column)
+	if err != nil {
+		return wrap("vocabulary unbind", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// WarehouseRepo stores warehouse destinations and the job exports queued
+// for them
+type WarehouseRepo struct{ db *sqlx.DB }
+
+func NewWarehouseRepo(db *sqlx.DB) *WarehouseRepo { return &WarehouseRepo{db: db} }
+
+func (r *WarehouseRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS warehouse_destinations (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL,
+        name TEXT NOT NULL,
+        kind TEXT NOT NULL,
+        settings JSONB NOT NULL DEFAULT '{}',
+        credentials TEXT NOT NULL,
+        wrapped_key TEXT NOT NULL,
+        master_key_id TEXT NOT NULL,
+        auto_export BOOLEAN NOT NULL DEFAULT FALSE,
+        last_tested_at TIMESTAMPTZ NULL,
+        last_test_error TEXT NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_warehouse_destinations_user ON warehouse_destinations(user_id);
+    CREATE TABLE IF NOT EXISTS warehouse_deliveries (
+        id BIGSERIAL PRIMARY KEY,
+        destination_id BIGINT NOT NULL REFERENCES warehouse_destinations(id) ON DELETE CASCADE,
+        job_id BIGINT NOT NULL REFERENCES generation_jobs(id) ON DELETE CASCADE,
+        user_id BIGINT NOT NULL,
+        table_name TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INT NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        rows_loaded BIGINT NOT NULL DEFAULT 0,
+        last_error TEXT NULL,
+        delivered_at TIMESTAMPTZ NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (destination_id, job_id, table_name)
+    );
+    CREATE INDEX IF NOT EXISTS idx_warehouse_deliveries_due ON warehouse_deliveries(next_attempt_at) WHERE status='pending';
+    CREATE INDEX IF NOT EXISTS idx_warehouse_deliveries_job ON warehouse_deliveries(job_id)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("warehouse create schema", err)
+}
+
+const warehouseDestinationColumns = `id, user_id, name, kind, settings, credentials, wrapped_key, master_key_id, auto_export,
+          last_tested_at, last_test_error, created_at, updated_at`
+
+const warehouseDeliveryColumns = `id, destination_id, job_id, user_id, table_name, status, attempts, next_attempt_at, rows_loaded,
+          last_error, delivered_at, created_at`
+
+func (r *WarehouseRepo) CreateDestination(ctx context.Context, d *models.WarehouseDestination) (*models.WarehouseDestination, error) {
+	q := `INSERT INTO warehouse_destinations (user_id, name, kind, settings, credentials, wrapped_key, master_key_id, auto_export)
+          VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+          RETURNING ` + warehouseDestinationColumns
+	var out models.WarehouseDestination
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, d.UserID, d.Name, d.Kind, d.Settings, d.Credentials, d.WrappedKey, d.MasterKeyID, d.AutoExport); err != nil {
+		return nil, wrap("warehouse create destination", err)
+	}
+	return &out, nil
+}
+
+func (r *WarehouseRepo) GetDestination(ctx context.Context, userID, id int64) (*models.WarehouseDestination, error) {
+	var out models.WarehouseDestination
+	q := `SELECT ` + warehouseDestinationColumns + ` FROM warehouse_destinations WHERE id=$1 AND user_id=$2`
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, id, userID); err != nil {
+		return nil, wrap("warehouse get destination", err)
+	}
+	return &out, nil
+}
+
+func (r *WarehouseRepo) ListDestinations(ctx context.Context, userID int64) ([]models.WarehouseDestination, error) {
+	q := `SELECT ` + warehouseDestinationColumns + ` FROM warehouse_destinations WHERE user_id=$1 ORDER BY id`
+	var out []models.WarehouseDestination
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID)
+	return out, wrap("warehouse list destinations", err)
+}
+
+// UpdateDestination saves the name, settings, credentials and auto export
+// flag of a destination; a changed destination has to be tested again
+func (r *WarehouseRepo) UpdateDestination(ctx context.Context, d *models.WarehouseDestination) (*models.WarehouseDestination, error) {
+	q := `UPDATE warehouse_destinations SET name=$1, settings=$2, credentials=$3, wrapped_key=$4, master_key_id=$5, auto_export=$6,
+              last_tested_at=NULL, last_test_error=NULL, updated_at=NOW()
+          WHERE id=$7 AND user_id=$8
+          RETURNING ` + warehouseDestinationColumns
+	var out models.WarehouseDestination
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, d.Name, d.Settings, d.Credentials, d.WrappedKey, d.MasterKeyID, d.AutoExport, d.ID, d.UserID); err != nil {
+		return nil, wrap("warehouse update destination", err)
+	}
+	return &out, nil
+}
+
+// DeleteDestination removes a destination with its deliveries; it returns
+// sql.ErrNoRows when the user has no such destination
+func (r *WarehouseRepo) DeleteDestination(ctx context.Context, userID, id int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM warehouse_destinations WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return wrap("warehouse delete destination", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RecordTest stores the outcome of a connection test; testError is nil
+// when it passed
+func (r *WarehouseRepo) RecordTest(ctx context.Context, id int64, testError *string) error {
+	_, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE warehouse_destinations SET last_tested_at=NOW(), last_test_error=$1 WHERE id=$2`, testError, id)
+	return wrap("warehouse record test", err)
+}
+
+// AutoExportDestinations returns a user's destinations completed jobs are
+// loaded into, none when the user's organization disabled warehouse
+// delivery
+func (r *WarehouseRepo) AutoExportDestinations(ctx context.Context, userID int64) ([]models.WarehouseDestination, error) {
+	q := `SELECT ` + warehouseDestinationColumns + ` FROM warehouse_destinations
+          WHERE user_id=$1 AND auto_export
+            AND NOT EXISTS (SELECT 1 FROM org_members m JOIN org_policies p ON p.org_id = m.org_id
+                            WHERE m.user_id=$1 AND p.capability='warehouse_delivery')
+          ORDER BY id`
+	var out []models.WarehouseDestination
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID)
+	return out, wrap("warehouse auto export destinations", err)
+}
+
+// Enqueue queues a job's export to a table of a destination, due at once.
+// An export that failed is queued again; one pending or delivered is
+// returned as it is, so a job is not loaded into a table twice.
+func (r *WarehouseRepo) Enqueue(ctx context.Context, destinationID, jobID, userID int64, table string) (*models.WarehouseDelivery, error) {
+	q := `INSERT INTO warehouse_deliveries (destination_id, job_id, user_id, table_name) VALUES ($1,$2,$3,$4)
+          ON CONFLICT (destination_id, job_id, table_name) DO UPDATE
+              SET status='pending', attempts=0, next_attempt_at=NOW(), last_error=NULL
+              WHERE warehouse_deliveries.status='failed'
+          RETURNING ` + warehouseDeliveryColumns
+	var out models.WarehouseDelivery
+	err := conn(ctx, r.db).GetContext(ctx, &out, q, destinationID, jobID, userID, table)
+	if errors.Is(err, sql.ErrNoRows) {
+		q = `SELECT ` + warehouseDeliveryColumns + ` FROM warehouse_deliveries WHERE destination_id=$1 AND job_id=$2 AND table_name=$3`
+		err = conn(ctx, r.db).GetContext(ctx, &out, q, destinationID, jobID, table)
+	}
+	if err != nil {
+		return nil, wrap("warehouse enqueue", err)
+	}
+	return &out, nil
+}
+
+// ClaimDue returns up to limit due deliveries and pushes them lease into
+// the future, so another exporter skips them while they are attempted
+func (r *WarehouseRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.WarehouseDelivery, error) {
+	q := `UPDATE warehouse_deliveries SET next_attempt_at = NOW() + make_interval(secs => $2)
+          WHERE id IN (SELECT id FROM warehouse_deliveries
+                       WHERE status='pending' AND next_attempt_at <= NOW()
+                       ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+          RETURNING ` + warehouseDeliveryColumns
+	var out []models.WarehouseDelivery
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, limit, lease.Seconds())
+	return out, wrap("warehouse claim due", err)
+}
+
+// DestinationByID loads the destination of a delivery, whoever owns it
+func (r *WarehouseRepo) DestinationByID(ctx context.Context, id int64) (*models.WarehouseDestination, error) {
+	var out models.WarehouseDestination
+	if err := conn(ctx, r.db).GetContext(ctx, &out, `SELECT `+warehouseDestinationColumns+` FROM warehouse_destinations WHERE id=$1`, id); err != nil {
+		return nil, wrap("warehouse destination by id", err)
+	}
+	return &out, nil
+}
+
+// RecordAttempt stores the outcome of an attempt. A pending delivery is
+// due again at next.
+func (r *WarehouseRepo) RecordAttempt(ctx context.Context, id int64, status models.WarehouseDeliveryStatus, rows int64, lastError *string, next time.Time) error {
+	q := `UPDATE warehouse_deliveries SET status=$1, attempts=attempts+1, rows_loaded=$2, last_error=$3, next_attempt_at=$4,
+          delivered_at = CASE WHEN $1='delivered' THEN NOW() ELSE delivered_at END
+          WHERE id=$5`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, status, rows, lastError, next, id)
+	return wrap("warehouse record attempt", err)
+}
+
+// ListDeliveries returns a destination's latest deliveries, newest first
+func (r *WarehouseRepo) ListDeliveries(ctx context.Context, destinationID int64, limit int) ([]models.WarehouseDelivery, error) {
+	q := `SELECT ` + warehouseDeliveryColumns + ` FROM warehouse_deliveries WHERE destination_id=$1 ORDER BY created_at DESC, id DESC LIMIT $2`
+	var out []models.WarehouseDelivery
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, destinationID, limit)
+	return out, wrap("warehouse list deliveries", err)
+}
+
+// JobDeliveries returns the exports of one of a user's jobs, oldest first
+func (r *WarehouseRepo) JobDeliveries(ctx context.Context, userID, jobID int64) ([]models.WarehouseDelivery, error) {
+	q := `SELECT ` + warehouseDeliveryColumns + ` FROM warehouse_deliveries WHERE job_id=$1 AND user_id=$2 ORDER BY id`
+	var out []models.WarehouseDelivery
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, jobID, userID)
+	return out, wrap("warehouse job deliveries", err)
+}
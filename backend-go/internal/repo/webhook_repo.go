@@ -0,0 +1,186 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// WebhookRepo stores webhook endpoints and the deliveries queued for them
+type WebhookRepo struct{ db *sqlx.DB }
+
+func NewWebhookRepo(db *sqlx.DB) *WebhookRepo { return &WebhookRepo{db: db} }
+
+func (r *WebhookRepo) CreateSchema(ctx context.Context) error {
+	stmt := `CREATE TABLE IF NOT EXISTS webhook_endpoints (
+        id BIGSERIAL PRIMARY KEY,
+        user_id BIGINT NOT NULL,
+        url TEXT NOT NULL,
+        description TEXT NULL,
+        events TEXT[] NOT NULL,
+        secret TEXT NOT NULL,
+        active BOOLEAN NOT NULL DEFAULT TRUE,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+    );
+    CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_user ON webhook_endpoints(user_id);
+    CREATE TABLE IF NOT EXISTS webhook_deliveries (
+        id BIGSERIAL PRIMARY KEY,
+        endpoint_id BIGINT NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+        event_id TEXT NOT NULL,
+        event_type TEXT NOT NULL,
+        payload TEXT NOT NULL,
+        status TEXT NOT NULL DEFAULT 'pending',
+        attempts INT NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        response_code INT NULL,
+        last_error TEXT NULL,
+        delivered_at TIMESTAMPTZ NULL,
+        created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+        UNIQUE (endpoint_id, event_id)
+    );
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status='pending';
+    CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint ON webhook_deliveries(endpoint_id, created_at)`
+	_, err := conn(ctx, r.db).ExecContext(ctx, stmt)
+	return wrap("webhook create schema", err)
+}
+
+const webhookEndpointColumns = `id, user_id, url, description, events, secret, active, created_at, updated_at`
+
+const webhookDeliveryColumns = `id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, response_code, last_error, delivered_at, created_at`
+
+func (r *WebhookRepo) CreateEndpoint(ctx context.Context, e *models.WebhookEndpoint) (*models.WebhookEndpoint, error) {
+	q := `INSERT INTO webhook_endpoints (user_id, url, description, events, secret, active)
+          VALUES ($1,$2,$3,$4,$5,$6)
+          RETURNING ` + webhookEndpointColumns
+	var out models.WebhookEndpoint
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, e.UserID, e.URL, e.Description, e.Events, e.Secret, e.Active).StructScan(&out); err != nil {
+		return nil, wrap("webhook create endpoint", err)
+	}
+	return &out, nil
+}
+
+func (r *WebhookRepo) GetEndpoint(ctx context.Context, userID, id int64) (*models.WebhookEndpoint, error) {
+	var out models.WebhookEndpoint
+	q := `SELECT ` + webhookEndpointColumns + ` FROM webhook_endpoints WHERE id=$1 AND user_id=$2`
+	if err := conn(ctx, r.db).GetContext(ctx, &out, q, id, userID); err != nil {
+		return nil, wrap("webhook get endpoint", err)
+	}
+	return &out, nil
+}
+
+func (r *WebhookRepo) ListEndpoints(ctx context.Context, userID int64) ([]models.WebhookEndpoint, error) {
+	q := `SELECT ` + webhookEndpointColumns + ` FROM webhook_endpoints WHERE user_id=$1 ORDER BY id`
+	var out []models.WebhookEndpoint
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID)
+	return out, wrap("webhook list endpoints", err)
+}
+
+// UpdateEndpoint saves the URL, description, events and active flag of an
+// endpoint
+func (r *WebhookRepo) UpdateEndpoint(ctx context.Context, e *models.WebhookEndpoint) (*models.WebhookEndpoint, error) {
+	q := `UPDATE webhook_endpoints SET url=$1, description=$2, events=$3, active=$4, updated_at=NOW()
+          WHERE id=$5 AND user_id=$6
+          RETURNING ` + webhookEndpointColumns
+	var out models.WebhookEndpoint
+	if err := conn(ctx, r.db).QueryRowxContext(ctx, q, e.URL, e.Description, e.Events, e.Active, e.ID, e.UserID).StructScan(&out); err != nil {
+		return nil, wrap("webhook update endpoint", err)
+	}
+	return &out, nil
+}
+
+// DeleteEndpoint removes an endpoint with its delivery history; it returns
+// sql.ErrNoRows when the user has no such endpoint
+func (r *WebhookRepo) DeleteEndpoint(ctx context.Context, userID, id int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `DELETE FROM webhook_endpoints WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return wrap("webhook delete endpoint", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Subscribed returns a user's active endpoints listening to an event type,
+// by name or with the * wildcard
+func (r *WebhookRepo) Subscribed(ctx context.Context, userID int64, eventType string) ([]models.WebhookEndpoint, error) {
+	q := `SELECT ` + webhookEndpointColumns + ` FROM webhook_endpoints
+          WHERE user_id=$1 AND active AND ($2 = ANY(events) OR '*' = ANY(events))
+          ORDER BY id`
+	var out []models.WebhookEndpoint
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, userID, eventType)
+	return out, wrap("webhook subscribed", err)
+}
+
+// Enqueue queues an event for endpoints, due at once. An event already
+// queued for an endpoint is skipped.
+func (r *WebhookRepo) Enqueue(ctx context.Context, endpointIDs []int64, eventID, eventType, payload string) error {
+	q := `INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+          VALUES ($1,$2,$3,$4)
+          ON CONFLICT (endpoint_id, event_id) DO NOTHING`
+	return wrap("webhook enqueue", WithTx(ctx, r.db, func(ctx context.Context) error {
+		for _, id := range endpointIDs {
+			if _, err := conn(ctx, r.db).ExecContext(ctx, q, id, eventID, eventType, payload); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+// ClaimDue returns up to limit due deliveries with their endpoints and
+// pushes them lease into the future, so another dispatcher skips them while
+// they are attempted
+func (r *WebhookRepo) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	q := `UPDATE webhook_deliveries SET next_attempt_at = NOW() + make_interval(secs => $2)
+          WHERE id IN (SELECT id FROM webhook_deliveries
+                       WHERE status='pending' AND next_attempt_at <= NOW()
+                       ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+          RETURNING ` + webhookDeliveryColumns
+	var out []models.WebhookDelivery
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, limit, lease.Seconds())
+	return out, wrap("webhook claim due", err)
+}
+
+// EndpointByID loads the endpoint of a delivery, whoever owns it
+func (r *WebhookRepo) EndpointByID(ctx context.Context, id int64) (*models.WebhookEndpoint, error) {
+	var out models.WebhookEndpoint
+	if err := conn(ctx, r.db).GetContext(ctx, &out, `SELECT `+webhookEndpointColumns+` FROM webhook_endpoints WHERE id=$1`, id); err != nil {
+		return nil, wrap("webhook endpoint by id", err)
+	}
+	return &out, nil
+}
+
+// RecordAttempt stores the outcome of an attempt. A pending delivery is
+// due again at next.
+func (r *WebhookRepo) RecordAttempt(ctx context.Context, id int64, status models.WebhookDeliveryStatus, code *int, lastError *string, next time.Time) error {
+	q := `UPDATE webhook_deliveries SET status=$1, attempts=attempts+1, response_code=$2, last_error=$3, next_attempt_at=$4,
+          delivered_at = CASE WHEN $1='delivered' THEN NOW() ELSE delivered_at END
+          WHERE id=$5`
+	_, err := conn(ctx, r.db).ExecContext(ctx, q, status, code, lastError, next, id)
+	return wrap("webhook record attempt", err)
+}
+
+// ListDeliveries returns an endpoint's latest deliveries, newest first
+func (r *WebhookRepo) ListDeliveries(ctx context.Context, endpointID int64, limit int) ([]models.WebhookDelivery, error) {
+	q := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries WHERE endpoint_id=$1 ORDER BY created_at DESC, id DESC LIMIT $2`
+	var out []models.WebhookDelivery
+	err := conn(ctx, r.db).SelectContext(ctx, &out, q, endpointID, limit)
+	return out, wrap("webhook list deliveries", err)
+}
+
+// Redeliver queues a delivery of an endpoint for another round of attempts
+func (r *WebhookRepo) Redeliver(ctx context.Context, endpointID, id int64) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE webhook_deliveries SET status='pending', attempts=0, next_attempt_at=NOW() WHERE id=$1 AND endpoint_id=$2`, id, endpointID)
+	if err != nil {
+		return wrap("webhook redeliver", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
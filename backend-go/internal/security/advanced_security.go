@@ -1,6 +1,7 @@
 package security
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -9,7 +10,10 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 // ThreatLevel represents the severity of a security threat
@@ -42,8 +46,20 @@ type SecurityService struct {
 	rateLimits     map[string]*RateLimit
 	threatPatterns []ThreatPattern
 	securityEvents []SecurityEvent
+	// exports queues high and critical events for the exporter's worker
+	exports  chan SecurityEvent
+	logger   *zap.Logger
+	eventsMu sync.Mutex
 }
 
+const (
+	// exportQueueSize bounds the events waiting to be exported; events
+	// raised while it is full are dropped and logged
+	exportQueueSize = 256
+	// exportTimeout bounds each export
+	exportTimeout = 10 * time.Second
+)
+
 // RateLimit represents rate limiting information
 type RateLimit struct {
 	IPAddress   string    `json:"ip_address"`
@@ -376,6 +392,9 @@ func (ss *SecurityService) GetBlockedIPs() []string {
 
 // GetSecurityEvents returns security events with filtering
 func (ss *SecurityService) GetSecurityEvents(filters SecurityEventFilters) []SecurityEvent {
+	ss.eventsMu.Lock()
+	defer ss.eventsMu.Unlock()
+
 	var filteredEvents []SecurityEvent
 
 	for _, event := range ss.securityEvents {
@@ -422,10 +441,64 @@ func (ss *SecurityService) matchesFilters(event SecurityEvent, filters SecurityE
 	return true
 }
 
+// SetExporter forwards high and critical events to an external system such
+// as SCC, one at a time from a single worker, logging failures to logger. It
+// replaces any exporter set before.
+func (ss *SecurityService) SetExporter(exporter EventExporter, logger *zap.Logger) {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	queue := make(chan SecurityEvent, exportQueueSize)
+	ss.eventsMu.Lock()
+	if ss.exports != nil {
+		close(ss.exports)
+	}
+	ss.exports, ss.logger = queue, logger
+	ss.eventsMu.Unlock()
+	go exportEvents(exporter, queue, logger)
+}
+
+// exportEvents exports the events queued until the queue is closed
+func exportEvents(exporter EventExporter, queue <-chan SecurityEvent, logger *zap.Logger) {
+	for event := range queue {
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		if err := exporter.Export(ctx, event); err != nil {
+			logger.Error("failed to export security event",
+				zap.String("event_id", event.ID), zap.String("type", event.Type), zap.Error(err))
+		}
+		cancel()
+	}
+}
+
+// RecordEvent records a security event raised outside of request analysis
+func (ss *SecurityService) RecordEvent(event SecurityEvent) {
+	if event.ID == "" {
+		event.ID = generateEventID()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	ss.logSecurityEvent(event)
+}
+
 // logSecurityEvent logs a security event
 func (ss *SecurityService) logSecurityEvent(event SecurityEvent) {
+	ss.eventsMu.Lock()
+	defer ss.eventsMu.Unlock()
+
 	ss.securityEvents = append(ss.securityEvents, event)
 
+	// Queue for export so request handling never waits on the exporter,
+	// and a burst of events never waits at all
+	if ss.exports != nil && (event.Level == ThreatLevelHigh || event.Level == ThreatLevelCritical) {
+		select {
+		case ss.exports <- event:
+		default:
+			ss.logger.Warn("security event export queue full, dropping event",
+				zap.String("event_id", event.ID), zap.String("type", event.Type))
+		}
+	}
+
 	// Keep only last 1000 events to prevent memory issues
 	if len(ss.securityEvents) > 1000 {
 		ss.securityEvents = ss.securityEvents[1:]
@@ -508,6 +581,8 @@ func (ss *SecurityService) VerifyPassword(password, hash string) bool {
 
 // GetSecurityStats returns security statistics
 func (ss *SecurityService) GetSecurityStats() map[string]interface{} {
+	ss.eventsMu.Lock()
+	defer ss.eventsMu.Unlock()
 	stats := map[string]interface{}{
 		"total_events":     len(ss.securityEvents),
 		"blocked_ips":      len(ss.blockedIPs),
@@ -0,0 +1,134 @@
+// Package security_test provides unit tests for recording and exporting
+// security events
+package security_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// fakeExporter records the events exported to it. While hold is open every
+// export waits on it.
+type fakeExporter struct {
+	mu     sync.Mutex
+	events []security.SecurityEvent
+	err    error
+	hold   chan struct{}
+}
+
+func (f *fakeExporter) Export(ctx context.Context, event security.SecurityEvent) error {
+	if f.hold != nil {
+		<-f.hold
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+	return f.err
+}
+
+func (f *fakeExporter) exported() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []string
+	for _, e := range f.events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestRecordEventExportsHighAndCritical(t *testing.T) {
+	svc := security.NewSecurityService()
+	fake := &fakeExporter{}
+	svc.SetExporter(fake, nil)
+
+	svc.RecordEvent(security.SecurityEvent{ID: "low", Level: security.ThreatLevelLow, Type: "scan"})
+	svc.RecordEvent(security.SecurityEvent{ID: "medium", Level: security.ThreatLevelMedium, Type: "scan"})
+	svc.RecordEvent(security.SecurityEvent{ID: "high", Level: security.ThreatLevelHigh, Type: "scan"})
+	svc.RecordEvent(security.SecurityEvent{ID: "critical", Level: security.ThreatLevelCritical, Type: "scan"})
+
+	assert.Eventually(t, func() bool { return len(fake.exported()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []string{"high", "critical"}, fake.exported(), "exported in order by one worker")
+	assert.Len(t, svc.GetSecurityEvents(security.SecurityEventFilters{}), 4, "every event is still recorded")
+}
+
+func TestExportFailuresAreLogged(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	svc := security.NewSecurityService()
+	svc.SetExporter(&fakeExporter{err: errors.New("scc unavailable")}, zap.New(core))
+
+	svc.RecordEvent(security.SecurityEvent{ID: "e1", Level: security.ThreatLevelHigh, Type: "brute_force"})
+
+	require.Eventually(t, func() bool { return logs.Len() == 1 }, time.Second, 5*time.Millisecond)
+	entry := logs.All()[0]
+	assert.Equal(t, "failed to export security event", entry.Message)
+	assert.Equal(t, "e1", entry.ContextMap()["event_id"])
+	assert.Equal(t, "scc unavailable", entry.ContextMap()["error"])
+}
+
+func TestExportQueueIsBounded(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	svc := security.NewSecurityService()
+	fake := &fakeExporter{hold: make(chan struct{})}
+	svc.SetExporter(fake, zap.New(core))
+
+	// The worker holds one event while the queue fills; a burst beyond that
+	// is dropped instead of piling up goroutines
+	const burst = 400
+	for i := 0; i < burst; i++ {
+		svc.RecordEvent(security.SecurityEvent{ID: fmt.Sprintf("e%d", i), Level: security.ThreatLevelCritical, Type: "brute_force"})
+	}
+	dropped := logs.FilterMessage("security event export queue full, dropping event").Len()
+	assert.Greater(t, dropped, 0)
+
+	close(fake.hold)
+	assert.Eventually(t, func() bool { return len(fake.exported())+dropped == burst }, 5*time.Second, 10*time.Millisecond)
+	assert.LessOrEqual(t, len(fake.exported()), 257, "at most the queue and the event in hand")
+}
+
+func TestSetExporterReplacesThePreviousOne(t *testing.T) {
+	svc := security.NewSecurityService()
+	first, second := &fakeExporter{}, &fakeExporter{}
+	svc.SetExporter(first, nil)
+	svc.SetExporter(second, nil)
+
+	svc.RecordEvent(security.SecurityEvent{ID: "e1", Level: security.ThreatLevelHigh, Type: "scan"})
+	assert.Eventually(t, func() bool { return len(second.exported()) == 1 }, time.Second, 5*time.Millisecond)
+	assert.Empty(t, first.exported())
+}
+
+func TestSecurityStatsWhileRecording(t *testing.T) {
+	svc := security.NewSecurityService()
+	svc.SetExporter(&fakeExporter{}, nil)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			svc.RecordEvent(security.SecurityEvent{Level: security.ThreatLevelHigh, Type: "scan"})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			_ = svc.GetSecurityStats()
+		}
+	}()
+	wg.Wait()
+
+	stats := svc.GetSecurityStats()
+	assert.Equal(t, 200, stats["total_events"])
+	assert.Equal(t, 200, stats["events_by_level"].(map[security.ThreatLevel]int)[security.ThreatLevelHigh])
+	assert.Equal(t, 200, stats["recent_threats"])
+}
@@ -0,0 +1,204 @@
+package security
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"google.golang.org/api/option"
+	securitycenter "google.golang.org/api/securitycenter/v1"
+)
+
+// EventExporter forwards security events to an external system
+type EventExporter interface {
+	Export(ctx context.Context, event SecurityEvent) error
+}
+
+// SCCConfig configures forwarding of security events to Security Command Center.
+// Each deployment uses its own source and service account so enterprise tenants
+// receive findings in their own organization.
+type SCCConfig struct {
+	// SourceName is the SCC source findings are written to,
+	// e.g. organizations/123/sources/456
+	SourceName string
+	// CredentialsFile is a service account key with the
+	// securitycenter.findingsEditor role on the source. Empty uses ADC.
+	CredentialsFile string
+	// ResourceName is the full resource name of this deployment, e.g.
+	// //run.googleapis.com/projects/p/locations/us-central1/services/synthos-api
+	ResourceName string
+	// ExternalURI links findings back to the admin console
+	ExternalURI string
+	// MinLevel is the lowest threat level exported (defaults to high)
+	MinLevel ThreatLevel
+}
+
+// SCCExporter writes high and critical security events as SCC findings
+type SCCExporter struct {
+	findings *securitycenter.OrganizationsSourcesFindingsService
+	cfg      SCCConfig
+}
+
+var (
+	sccSourcePattern   = regexp.MustCompile(`^organizations/[0-9]+/sources/[0-9]+$`)
+	sccCategoryInvalid = regexp.MustCompile(`[^A-Z0-9]+`)
+	sccFindingInvalid  = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+)
+
+// NewSCCExporter creates an exporter authenticated with the configured
+// credentials; opts are added to the client options, such as another endpoint
+func NewSCCExporter(ctx context.Context, cfg SCCConfig, opts ...option.ClientOption) (*SCCExporter, error) {
+	if !sccSourcePattern.MatchString(cfg.SourceName) {
+		return nil, fmt.Errorf("invalid SCC source name %q", cfg.SourceName)
+	}
+	if cfg.ResourceName == "" {
+		return nil, fmt.Errorf("SCC resource name is required")
+	}
+	if cfg.MinLevel == "" {
+		cfg.MinLevel = ThreatLevelHigh
+	}
+	clientOpts := []option.ClientOption{option.WithScopes(securitycenter.CloudPlatformScope)}
+	if cfg.CredentialsFile != "" {
+		clientOpts = append(clientOpts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	svc, err := securitycenter.NewService(ctx, append(clientOpts, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SCC client: %w", err)
+	}
+
+	return &SCCExporter{
+		findings: securitycenter.NewOrganizationsSourcesFindingsService(svc),
+		cfg:      cfg,
+	}, nil
+}
+
+// Export creates or updates the finding for an event. Events below the
+// configured minimum level are ignored.
+func (e *SCCExporter) Export(ctx context.Context, event SecurityEvent) error {
+	if threatRank(event.Level) < threatRank(e.cfg.MinLevel) {
+		return nil
+	}
+
+	finding, err := e.toFinding(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = e.findings.Patch(finding.Name, finding).
+		UpdateMask("state,category,severity,eventTime,resourceName,findingClass,externalUri,description,sourceProperties").
+		Context(ctx).
+		Do()
+	if err != nil {
+		return fmt.Errorf("failed to export security event %s: %w", event.ID, err)
+	}
+	return nil
+}
+
+func (e *SCCExporter) toFinding(event SecurityEvent) (*securitycenter.Finding, error) {
+	findingID := sccFindingInvalid.ReplaceAllString(event.ID, "")
+	if findingID == "" {
+		findingID = generateEventID()
+	}
+	if len(findingID) > 32 {
+		findingID = findingID[:32]
+	}
+
+	props := map[string]interface{}{
+		"event_type": event.Type,
+		"source":     event.Source,
+		"action":     event.Action,
+		"blocked":    event.Blocked,
+		"ip_address": event.IPAddress,
+		"user_agent": event.UserAgent,
+		"details":    event.Details,
+	}
+	raw, err := json.Marshal(props)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode finding properties: %w", err)
+	}
+
+	eventTime := event.Timestamp
+	if eventTime.IsZero() {
+		eventTime = time.Now()
+	}
+
+	return &securitycenter.Finding{
+		Name:             e.cfg.SourceName + "/findings/" + findingID,
+		Parent:           e.cfg.SourceName,
+		State:            "ACTIVE",
+		Category:         sccCategory(event),
+		Severity:         SCCSeverity(event.Level),
+		FindingClass:     "THREAT",
+		EventTime:        eventTime.UTC().Format(time.RFC3339Nano),
+		ResourceName:     e.resourceName(event),
+		ExternalUri:      e.cfg.ExternalURI,
+		Description:      sccDescription(event),
+		SourceProperties: raw,
+	}, nil
+}
+
+// resourceName maps an event onto a GCP resource. Events may carry their own
+// resource in Details["resource_name"]; otherwise the deployment resource is used.
+func (e *SCCExporter) resourceName(event SecurityEvent) string {
+	if rn, ok := event.Details["resource_name"].(string); ok && strings.HasPrefix(rn, "//") {
+		return rn
+	}
+	return e.cfg.ResourceName
+}
+
+// SCCSeverity translates a threat level into an SCC finding severity
+func SCCSeverity(level ThreatLevel) string {
+	switch level {
+	case ThreatLevelCritical:
+		return "CRITICAL"
+	case ThreatLevelHigh:
+		return "HIGH"
+	case ThreatLevelMedium:
+		return "MEDIUM"
+	case ThreatLevelLow:
+		return "LOW"
+	default:
+		return "SEVERITY_UNSPECIFIED"
+	}
+}
+
+// sccCategory derives an upper snake case category, preferring the name of the
+// first detected threat pattern over the generic event type
+func sccCategory(event SecurityEvent) string {
+	name := event.Type
+	if threats, ok := event.Details["threats"].([]map[string]interface{}); ok && len(threats) > 0 {
+		if pattern, ok := threats[0]["pattern"].(string); ok && pattern != "" {
+			name = pattern
+		}
+	}
+	category := strings.Trim(sccCategoryInvalid.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+	if category == "" {
+		return "SECURITY_EVENT"
+	}
+	return category
+}
+
+func sccDescription(event SecurityEvent) string {
+	if reason, ok := event.Details["reason"].(string); ok && reason != "" {
+		return reason
+	}
+	return fmt.Sprintf("Synthos security event %s (%s) from %s", event.Type, event.Action, event.Source)
+}
+
+func threatRank(level ThreatLevel) int {
+	switch level {
+	case ThreatLevelLow:
+		return 1
+	case ThreatLevelMedium:
+		return 2
+	case ThreatLevelHigh:
+		return 3
+	case ThreatLevelCritical:
+		return 4
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,158 @@
+// Package security_test provides unit tests for exporting security events
+// to Security Command Center
+package security_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	securitycenter "google.golang.org/api/securitycenter/v1"
+)
+
+const testSource = "organizations/123/sources/456"
+
+// sccServer records the findings patched into it
+type sccServer struct {
+	mu       sync.Mutex
+	paths    []string
+	findings []securitycenter.Finding
+	status   int
+}
+
+func (s *sccServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	raw, _ := io.ReadAll(r.Body)
+	var f securitycenter.Finding
+	_ = json.Unmarshal(raw, &f)
+	s.mu.Lock()
+	s.paths = append(s.paths, r.Method+" "+r.URL.Path)
+	s.findings = append(s.findings, f)
+	status := s.status
+	s.mu.Unlock()
+	if status != 0 {
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"error":{"code":403,"message":"denied"}}`))
+		return
+	}
+	_, _ = w.Write(raw)
+}
+
+func newSCCExporter(t *testing.T, cfg security.SCCConfig) (*security.SCCExporter, *sccServer) {
+	t.Helper()
+	fake := &sccServer{}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	if cfg.SourceName == "" {
+		cfg.SourceName = testSource
+	}
+	if cfg.ResourceName == "" {
+		cfg.ResourceName = "//run.googleapis.com/projects/p/locations/us-central1/services/synthos-api"
+	}
+	exporter, err := security.NewSCCExporter(context.Background(), cfg,
+		option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	require.NoError(t, err)
+	return exporter, fake
+}
+
+func TestNewSCCExporterValidatesConfig(t *testing.T) {
+	_, err := security.NewSCCExporter(context.Background(), security.SCCConfig{SourceName: "projects/1/sources/2", ResourceName: "//x"})
+	assert.Error(t, err)
+	_, err = security.NewSCCExporter(context.Background(), security.SCCConfig{SourceName: testSource})
+	assert.Error(t, err, "a resource name is required")
+}
+
+func TestSCCSeverity(t *testing.T) {
+	assert.Equal(t, "CRITICAL", security.SCCSeverity(security.ThreatLevelCritical))
+	assert.Equal(t, "HIGH", security.SCCSeverity(security.ThreatLevelHigh))
+	assert.Equal(t, "MEDIUM", security.SCCSeverity(security.ThreatLevelMedium))
+	assert.Equal(t, "LOW", security.SCCSeverity(security.ThreatLevelLow))
+	assert.Equal(t, "SEVERITY_UNSPECIFIED", security.SCCSeverity("unknown"))
+}
+
+func TestSCCExportWritesFinding(t *testing.T) {
+	exporter, fake := newSCCExporter(t, security.SCCConfig{ExternalURI: "https://admin.example.com/security"})
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	err := exporter.Export(context.Background(), security.SecurityEvent{
+		ID:        "ab-cd_ef.01",
+		Timestamp: at,
+		Level:     security.ThreatLevelCritical,
+		Type:      "api_key_brute_force_ban",
+		Source:    "api_key_auth",
+		IPAddress: "203.0.113.9",
+		Action:    "throttled",
+		Blocked:   true,
+		Details:   map[string]interface{}{"reason": "Repeated failed API key authentication"},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, fake.findings, 1)
+	// Characters SCC does not allow in finding IDs are dropped
+	assert.Equal(t, "PATCH /v1/"+testSource+"/findings/abcdef01", fake.paths[0])
+	f := fake.findings[0]
+	assert.Equal(t, "API_KEY_BRUTE_FORCE_BAN", f.Category)
+	assert.Equal(t, "CRITICAL", f.Severity)
+	assert.Equal(t, "ACTIVE", f.State)
+	assert.Equal(t, "THREAT", f.FindingClass)
+	assert.Equal(t, "2026-03-01T12:00:00Z", f.EventTime)
+	assert.Equal(t, "//run.googleapis.com/projects/p/locations/us-central1/services/synthos-api", f.ResourceName)
+	assert.Equal(t, "https://admin.example.com/security", f.ExternalUri)
+	assert.Equal(t, "Repeated failed API key authentication", f.Description)
+
+	var props map[string]any
+	require.NoError(t, json.Unmarshal(f.SourceProperties, &props))
+	assert.Equal(t, "203.0.113.9", props["ip_address"])
+	assert.Equal(t, true, props["blocked"])
+}
+
+func TestSCCExportCategoryAndResource(t *testing.T) {
+	exporter, fake := newSCCExporter(t, security.SCCConfig{})
+
+	err := exporter.Export(context.Background(), security.SecurityEvent{
+		ID:    strings.Repeat("a", 40),
+		Level: security.ThreatLevelHigh,
+		Type:  "threat_detected",
+		Details: map[string]interface{}{
+			"threats":       []map[string]interface{}{{"pattern": "sql injection"}},
+			"resource_name": "//storage.googleapis.com/projects/_/buckets/exports",
+		},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, fake.findings, 1)
+	assert.Equal(t, "PATCH /v1/"+testSource+"/findings/"+strings.Repeat("a", 32), fake.paths[0], "finding IDs are cut to 32 characters")
+	f := fake.findings[0]
+	assert.Equal(t, "SQL_INJECTION", f.Category, "the first threat pattern names the category")
+	assert.Equal(t, "//storage.googleapis.com/projects/_/buckets/exports", f.ResourceName)
+	assert.Contains(t, f.Description, "threat_detected")
+}
+
+func TestSCCExportSkipsEventsBelowMinLevel(t *testing.T) {
+	exporter, fake := newSCCExporter(t, security.SCCConfig{})
+	require.NoError(t, exporter.Export(context.Background(), security.SecurityEvent{ID: "m1", Level: security.ThreatLevelMedium, Type: "scan"}))
+	assert.Empty(t, fake.findings, "high is the default minimum")
+
+	exporter, fake = newSCCExporter(t, security.SCCConfig{MinLevel: security.ThreatLevelCritical})
+	require.NoError(t, exporter.Export(context.Background(), security.SecurityEvent{ID: "h1", Level: security.ThreatLevelHigh, Type: "scan"}))
+	assert.Empty(t, fake.findings)
+	require.NoError(t, exporter.Export(context.Background(), security.SecurityEvent{ID: "c1", Level: security.ThreatLevelCritical, Type: "scan"}))
+	assert.Len(t, fake.findings, 1)
+}
+
+func TestSCCExportReturnsFailures(t *testing.T) {
+	exporter, fake := newSCCExporter(t, security.SCCConfig{})
+	fake.status = http.StatusForbidden
+	err := exporter.Export(context.Background(), security.SecurityEvent{ID: "e1", Level: security.ThreatLevelHigh, Type: "scan"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "e1")
+}
@@ -2,10 +2,15 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	htmltemplate "html/template"
 	"net/smtp"
+	"strings"
 	texttemplate "text/template"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/branding"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
 )
 
 type EmailService struct {
@@ -15,6 +20,13 @@ type EmailService struct {
 	SMTPPassword string
 	FromEmail    string
 	FromName     string
+	brands       BrandSource
+}
+
+// BrandSource finds the white-label branding that applies to the user with
+// an address, or nil when none does
+type BrandSource interface {
+	ForEmail(ctx context.Context, email string) (*models.OrgBranding, error)
 }
 
 type EmailTemplate struct {
@@ -34,6 +46,12 @@ func NewEmailService(smtpHost, smtpPort, smtpUsername, smtpPassword, fromEmail,
 	}
 }
 
+// SetBranding makes email to members of white-label organizations carry
+// their organization's name, logo, sender and links
+func (e *EmailService) SetBranding(brands BrandSource) {
+	e.brands = brands
+}
+
 // SendVerificationEmail sends email verification link
 func (e *EmailService) SendVerificationEmail(to, verificationToken string) error {
 	template := EmailTemplate{
@@ -74,7 +92,7 @@ If you didn't create an account with Synthos, you can safely ignore this email.`
 	}
 
 	data := map[string]string{
-		"VerificationURL": fmt.Sprintf("https://synthos.dev/verify-email?token=%s", verificationToken),
+		"VerificationURL": fmt.Sprintf("%s/verify-email?token=%s", branding.DefaultBaseURL, verificationToken),
 	}
 
 	return e.sendEmail(to, template, data)
@@ -120,7 +138,7 @@ If you didn't request a password reset, you can safely ignore this email.`,
 	}
 
 	data := map[string]string{
-		"ResetURL": fmt.Sprintf("https://synthos.dev/reset-password?token=%s", resetToken),
+		"ResetURL": fmt.Sprintf("%s/reset-password?token=%s", branding.DefaultBaseURL, resetToken),
 	}
 
 	return e.sendEmail(to, template, data)
@@ -149,7 +167,7 @@ func (e *EmailService) SendWelcomeEmail(to, fullName string) error {
             <li>Check out our documentation</li>
         </ul>
         <div style="text-align: center; margin: 30px 0;">
-            <a href="https://synthos.dev/dashboard" style="background-color: #4F46E5; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; display: inline-block;">Get Started</a>
+            <a href="{{.DashboardURL}}" style="background-color: #4F46E5; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; display: inline-block;">Get Started</a>
         </div>
         <p>If you have any questions, feel free to reach out to our support team.</p>
         <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
@@ -167,21 +185,422 @@ Here's what you can do next:
 - Explore our advanced privacy features
 - Check out our documentation
 
-Get started: https://synthos.dev/dashboard
+Get started: {{.DashboardURL}}
 
 If you have any questions, feel free to reach out to our support team.`,
 	}
 
 	data := map[string]string{
-		"FullName": fullName,
-		"Email":    to,
+		"FullName":     fullName,
+		"Email":        to,
+		"DashboardURL": branding.DefaultBaseURL + "/dashboard",
+	}
+
+	return e.sendEmail(to, template, data)
+}
+
+// SendReportEmail sends a generated analytics report
+func (e *EmailService) SendReportEmail(to, reportName, summary string) error {
+	template := EmailTemplate{
+		Subject: "Synthos Report: " + reportName,
+		HTML: `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>{{.ReportName}}</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <h1 style="color: #4F46E5;">{{.ReportName}}</h1>
+        <pre style="font-family: monospace; white-space: pre-wrap;">{{.Summary}}</pre>
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+        <p style="font-size: 12px; color: #666;">You are receiving this report because an administrator subscribed {{.Email}} to it.</p>
+    </div>
+</body>
+</html>`,
+		Text: `{{.Summary}}
+
+You are receiving this report because an administrator subscribed {{.Email}} to it.`,
+	}
+
+	data := map[string]string{
+		"ReportName": reportName,
+		"Summary":    summary,
+		"Email":      to,
+	}
+
+	return e.sendEmail(to, template, data)
+}
+
+// SendNotificationEmail sends a single notification
+func (e *EmailService) SendNotificationEmail(to, subject, body string) error {
+	template := EmailTemplate{
+		Subject: "Synthos: " + headerSafe(subject),
+		HTML: `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>{{.Subject}}</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <h1 style="color: #4F46E5;">{{.Subject}}</h1>
+        <p style="white-space: pre-wrap;">{{.Body}}</p>
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+        <p style="font-size: 12px; color: #666;">You can choose to receive notifications as hourly or daily digests in your notification preferences.</p>
+    </div>
+</body>
+</html>`,
+		Text: `{{.Subject}}
+
+{{.Body}}
+
+You can choose to receive notifications as hourly or daily digests in your notification preferences.`,
+	}
+
+	data := map[string]string{
+		"Subject": subject,
+		"Body":    body,
+	}
+
+	return e.sendEmail(to, template, data)
+}
+
+// SendDigestEmail sends a summary of batched notifications
+func (e *EmailService) SendDigestEmail(to, subject, summary string) error {
+	template := EmailTemplate{
+		Subject: "Synthos " + headerSafe(subject),
+		HTML: `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>{{.Subject}}</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <h1 style="color: #4F46E5;">{{.Subject}}</h1>
+        <pre style="font-family: monospace; white-space: pre-wrap;">{{.Summary}}</pre>
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+        <p style="font-size: 12px; color: #666;">Security and billing notifications are always sent immediately and are not included in digests.</p>
+    </div>
+</body>
+</html>`,
+		Text: `{{.Subject}}
+
+{{.Summary}}
+
+Security and billing notifications are always sent immediately and are not included in digests.`,
+	}
+
+	data := map[string]string{
+		"Subject": subject,
+		"Summary": summary,
+	}
+
+	return e.sendEmail(to, template, data)
+}
+
+// SendEmailChangeVerification sends the link that proves a new account
+// address belongs to the user moving to it
+func (e *EmailService) SendEmailChangeVerification(to, token string) error {
+	template := EmailTemplate{
+		Subject: "Confirm Your New Synthos Email Address",
+		HTML: `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Confirm Your New Email Address</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <h1 style="color: #4F46E5;">Confirm Your New Email Address</h1>
+        <p>A Synthos account asked to use {{.Email}} as its email address. To confirm, please click the button below:</p>
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="{{.ConfirmURL}}" style="background-color: #4F46E5; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; display: inline-block;">Confirm Email</a>
+        </div>
+        <p>If the button doesn't work, you can also copy and paste this link into your browser:</p>
+        <p style="word-break: break-all; background-color: #f5f5f5; padding: 10px; border-radius: 4px;">{{.ConfirmURL}}</p>
+        <p>This link will expire in 24 hours. For your security the change takes effect a few days after you confirm it.</p>
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+        <p style="font-size: 12px; color: #666;">If you didn't ask for this change, you can safely ignore this email.</p>
+    </div>
+</body>
+</html>`,
+		Text: `Confirm Your New Email Address
+
+A Synthos account asked to use {{.Email}} as its email address. To confirm, please visit this link:
+{{.ConfirmURL}}
+
+This link will expire in 24 hours. For your security the change takes effect a few days after you confirm it.
+
+If you didn't ask for this change, you can safely ignore this email.`,
+	}
+
+	data := map[string]string{
+		"Email":      to,
+		"ConfirmURL": fmt.Sprintf("%s/email-change/confirm?token=%s", branding.DefaultBaseURL, token),
 	}
 
 	return e.sendEmail(to, template, data)
 }
 
-// sendEmail sends an email using SMTP
+// SendEmailChangeNotice tells the current address of an account that it is
+// being moved to newEmail, with a link to stop the change
+func (e *EmailService) SendEmailChangeNotice(to, newEmail, cancelToken string) error {
+	template := EmailTemplate{
+		Subject: "Your Synthos Email Address Is Changing",
+		HTML: `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Your Email Address Is Changing</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <h1 style="color: #4F46E5;">Your Email Address Is Changing</h1>
+        <p>We received a request to change the email address of your Synthos account from {{.Email}} to {{.NewEmail}}.</p>
+        <p>Once the new address is confirmed the change takes effect after a security hold. Until then you can stop it:</p>
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="{{.CancelURL}}" style="background-color: #DC2626; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; display: inline-block;">Cancel Change</a>
+        </div>
+        <p>If the button doesn't work, you can also copy and paste this link into your browser:</p>
+        <p style="word-break: break-all; background-color: #f5f5f5; padding: 10px; border-radius: 4px;">{{.CancelURL}}</p>
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+        <p style="font-size: 12px; color: #666;">If you made this request, no action is needed.</p>
+    </div>
+</body>
+</html>`,
+		Text: `Your Email Address Is Changing
+
+We received a request to change the email address of your Synthos account from {{.Email}} to {{.NewEmail}}.
+
+Once the new address is confirmed the change takes effect after a security hold. Until then you can stop it here:
+{{.CancelURL}}
+
+If you made this request, no action is needed.`,
+	}
+
+	data := map[string]string{
+		"Email":     to,
+		"NewEmail":  newEmail,
+		"CancelURL": fmt.Sprintf("%s/email-change/cancel?token=%s", branding.DefaultBaseURL, cancelToken),
+	}
+
+	return e.sendEmail(to, template, data)
+}
+
+// SendAccountMergeEmail asks the owner of a duplicate account to approve
+// merging it into the account at targetEmail
+func (e *EmailService) SendAccountMergeEmail(to, targetEmail, token string) error {
+	template := EmailTemplate{
+		Subject: "Approve Merging Your Synthos Accounts",
+		HTML: `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Approve Account Merge</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <h1 style="color: #4F46E5;">Approve Account Merge</h1>
+        <p>The Synthos account {{.TargetEmail}} asked to merge your account {{.Email}} into it.</p>
+        <p>Your datasets, generation jobs, API keys and billing history will move to {{.TargetEmail}} and this account will be closed. To approve, sign in as {{.TargetEmail}} and open this link:</p>
+        <p style="word-break: break-all; background-color: #f5f5f5; padding: 10px; border-radius: 4px;">{{.MergeURL}}</p>
+        <p>This link will expire in 1 hour.</p>
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+        <p style="font-size: 12px; color: #666;">If you didn't ask for this, ignore this email and your account stays as it is.</p>
+    </div>
+</body>
+</html>`,
+		Text: `Approve Account Merge
+
+The Synthos account {{.TargetEmail}} asked to merge your account {{.Email}} into it.
+
+Your datasets, generation jobs, API keys and billing history will move to {{.TargetEmail}} and this account will be closed. To approve, sign in as {{.TargetEmail}} and open this link:
+{{.MergeURL}}
+
+This link will expire in 1 hour.
+
+If you didn't ask for this, ignore this email and your account stays as it is.`,
+	}
+
+	data := map[string]string{
+		"Email":       to,
+		"TargetEmail": targetEmail,
+		"MergeURL":    fmt.Sprintf("%s/account/merge?token=%s", branding.DefaultBaseURL, token),
+	}
+
+	return e.sendEmail(to, template, data)
+}
+
+// SendOrgInvitationEmail invites someone to join an organization with a role
+func (e *EmailService) SendOrgInvitationEmail(to, orgName, inviterEmail, role, token string) error {
+	template := EmailTemplate{
+		Subject: "You're Invited to Join " + headerSafe(orgName) + " on Synthos",
+		HTML: `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Organization Invitation</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <h1 style="color: #4F46E5;">Join {{.OrgName}}</h1>
+        <p>{{.InviterEmail}} invited you to join the {{.OrgName}} organization on Synthos as {{.Role}}.</p>
+        <p>Members share datasets, generation jobs and custom models. To accept, sign in or sign up as {{.Email}} and open this link:</p>
+        <p style="word-break: break-all; background-color: #f5f5f5; padding: 10px; border-radius: 4px;">{{.InviteURL}}</p>
+        <p>This link will expire in 7 days.</p>
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+        <p style="font-size: 12px; color: #666;">If you weren't expecting this, you can ignore this email.</p>
+    </div>
+</body>
+</html>`,
+		Text: `Join {{.OrgName}}
+
+{{.InviterEmail}} invited you to join the {{.OrgName}} organization on Synthos as {{.Role}}.
+
+Members share datasets, generation jobs and custom models. To accept, sign in or sign up as {{.Email}} and open this link:
+{{.InviteURL}}
+
+This link will expire in 7 days.
+
+If you weren't expecting this, you can ignore this email.`,
+	}
+
+	data := map[string]string{
+		"Email":        to,
+		"OrgName":      orgName,
+		"InviterEmail": inviterEmail,
+		"Role":         role,
+		"InviteURL":    fmt.Sprintf("%s/orgs/invitations/accept?token=%s", branding.DefaultBaseURL, token),
+	}
+
+	// The invitee is not a member yet, so the inviting organization's brand
+	// is found through the inviter
+	return e.send(to, e.brandFor(inviterEmail), template, data)
+}
+
+// SendQuotaWarningEmail warns that a user has used threshold percent of a
+// plan limit. resets says when the usage starts over; empty for limits that
+// do not reset.
+func (e *EmailService) SendQuotaWarningEmail(to, limitName string, threshold int, used, limit int64, resets string) error {
+	headline := fmt.Sprintf("You've used %d%% of your %s", threshold, limitName)
+	if threshold >= 100 {
+		headline = "You've reached your " + limitName
+	}
+	template := EmailTemplate{
+		Subject: "Synthos: " + headerSafe(headline),
+		HTML: `
+<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>{{.Headline}}</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+    <div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+        <h1 style="color: #4F46E5;">{{.Headline}}</h1>
+        <p>Your account has used {{.Used}} of the {{.Limit}} your plan allows.{{if .Resets}} Your usage resets on {{.Resets}}.{{end}}</p>
+        <p>To keep working without interruption, you can upgrade your plan:</p>
+        <div style="text-align: center; margin: 30px 0;">
+            <a href="{{.BillingURL}}" style="background-color: #4F46E5; color: white; padding: 12px 24px; text-decoration: none; border-radius: 6px; display: inline-block;">View Plans</a>
+        </div>
+        <hr style="border: none; border-top: 1px solid #eee; margin: 30px 0;">
+        <p style="font-size: 12px; color: #666;">We send this warning once at 80%, 90% and 100% of each limit.</p>
+    </div>
+</body>
+</html>`,
+		Text: `{{.Headline}}
+
+Your account has used {{.Used}} of the {{.Limit}} your plan allows.{{if .Resets}} Your usage resets on {{.Resets}}.{{end}}
+
+To keep working without interruption, you can upgrade your plan:
+{{.BillingURL}}
+
+We send this warning once at 80%, 90% and 100% of each limit.`,
+	}
+
+	data := map[string]string{
+		"Headline":   headline,
+		"Used":       fmt.Sprintf("%d", used),
+		"Limit":      fmt.Sprintf("%d", limit),
+		"Resets":     resets,
+		"BillingURL": branding.DefaultBaseURL + "/billing",
+	}
+
+	return e.sendEmail(to, template, data)
+}
+
+// headerSafe keeps caller-supplied text on a single header line
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// emailContainer opens the body of every template; a brand's logo goes
+// right after it
+const emailContainer = `<div style="max-width: 600px; margin: 0 auto; padding: 20px;">`
+
+const emailLogo = `
+        <img src="{{.BrandLogoURL}}" alt="{{.BrandName}}" style="max-height: 48px; margin-bottom: 20px;">`
+
+// brandFor returns the brand email to an address is sent under. A failed
+// lookup falls back to the platform brand rather than failing the email.
+func (e *EmailService) brandFor(email string) branding.Brand {
+	def := branding.Brand{
+		Name:        branding.DefaultName,
+		FromName:    e.FromName,
+		FromAddress: e.FromEmail,
+		BaseURL:     branding.DefaultBaseURL,
+	}
+	if e.brands == nil {
+		return def
+	}
+	b, err := e.brands.ForEmail(context.Background(), email)
+	if err != nil {
+		return def
+	}
+	return branding.Apply(def, b)
+}
+
+// applyBrand rewrites a template and its data for brand: links move to the
+// brand's host, the product name becomes the brand's and its logo heads
+// the HTML body
+func applyBrand(brand branding.Brand, template EmailTemplate, data map[string]string) (EmailTemplate, map[string]string) {
+	out := make(map[string]string, len(data)+2)
+	for k, v := range data {
+		if rest, ok := strings.CutPrefix(v, branding.DefaultBaseURL); ok && (rest == "" || rest[0] == '/' || rest[0] == '?') {
+			v = brand.BaseURL + rest
+		}
+		out[k] = v
+	}
+	out["BrandName"] = brand.Name
+	out["BrandLogoURL"] = brand.LogoURL
+	if brand.Name != branding.DefaultName {
+		template.Subject = strings.ReplaceAll(template.Subject, branding.DefaultName, headerSafe(brand.Name))
+		template.HTML = strings.ReplaceAll(template.HTML, branding.DefaultName, "{{.BrandName}}")
+		template.Text = strings.ReplaceAll(template.Text, branding.DefaultName, "{{.BrandName}}")
+	}
+	if brand.LogoURL != "" {
+		template.HTML = strings.Replace(template.HTML, emailContainer, emailContainer+emailLogo, 1)
+	}
+	return template, out
+}
+
+// sendEmail sends an email using SMTP, under the recipient's brand
 func (e *EmailService) sendEmail(to string, template EmailTemplate, data map[string]string) error {
+	return e.send(to, e.brandFor(to), template, data)
+}
+
+func (e *EmailService) send(to string, brand branding.Brand, template EmailTemplate, data map[string]string) error {
+	template, data = applyBrand(brand, template, data)
+
 	// Parse HTML template
 	htmlTmpl, err := htmltemplate.New("html").Parse(template.HTML)
 	if err != nil {
@@ -204,7 +623,8 @@ func (e *EmailService) sendEmail(to string, template EmailTemplate, data map[str
 	}
 
 	// Create email message
-	message := fmt.Sprintf("From: %s <%s>\r\n", e.FromName, e.FromEmail)
+	// The envelope sender stays the platform's so bounces come back to it
+	message := fmt.Sprintf("From: %s <%s>\r\n", headerSafe(brand.FromName), brand.FromAddress)
 	message += fmt.Sprintf("To: %s\r\n", to)
 	message += fmt.Sprintf("Subject: %s\r\n", template.Subject)
 	message += "MIME-Version: 1.0\r\n"
@@ -0,0 +1,305 @@
+// Package signing signs the artifact manifests of generation jobs with a
+// platform Ed25519 key, so that whoever receives a synthetic dataset can
+// check that Synthos produced it and that no file has changed since. A
+// signed manifest lists every artifact with its SHA-256 digest and may
+// carry a detached signature per file for recipients that pass files on
+// one at a time.
+//
+// Keys rotate: the active key signs, and retired keys are kept by their
+// public half only so the manifests they signed keep verifying. A key
+// removed from the ring no longer verifies anything.
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/evidence"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Algorithm is the signature algorithm of every key
+const Algorithm = "Ed25519"
+
+// Issuer is who a manifest says produced the data
+const Issuer = "synthos"
+
+// ManifestType tells a signed manifest apart from anything else signed
+// with the same key
+const ManifestType = "synthos.export-manifest/v1"
+
+// fileContext prefixes the message a file signature covers
+const fileContext = "synthos.export-file/v1"
+
+// Key statuses
+const (
+	KeyActive  = "active"
+	KeyRetired = "retired"
+)
+
+var (
+	// ErrUnknownKey is returned for a signature by a key not in the ring
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrBadSignature is returned when a signature does not verify
+	ErrBadSignature = errors.New("signature does not verify")
+	// ErrNoChecksums is returned for a job whose artifacts were stored
+	// before checksums were recorded; there is nothing to sign
+	ErrNoChecksums = errors.New("artifacts have no recorded checksums")
+)
+
+// Key is a signing key. Retired keys hold only their public half.
+type Key struct {
+	ID      string
+	Public  ed25519.PublicKey
+	private ed25519.PrivateKey
+}
+
+// CanSign reports whether the key holds its private half
+func (k *Key) CanSign() bool { return k.private != nil }
+
+// ParseKeys parses "kid:seed,kid2:pub:key" into keys. A seed is the
+// base64 encoded 32-byte Ed25519 seed of a key that can sign; pub: names
+// the base64 encoded public key of a retired one.
+func ParseKeys(spec string) ([]*Key, error) {
+	var keys []*Key
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kid, material, ok := strings.Cut(part, ":")
+		if !ok || kid == "" || material == "" {
+			return nil, fmt.Errorf("invalid signing key entry %q", part)
+		}
+		public, isPublic := strings.CutPrefix(material, "pub:")
+		if isPublic {
+			material = public
+		}
+		raw, err := base64.StdEncoding.DecodeString(material)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %q: %w", kid, err)
+		}
+		switch {
+		case isPublic && len(raw) == ed25519.PublicKeySize:
+			keys = append(keys, &Key{ID: kid, Public: ed25519.PublicKey(raw)})
+		case !isPublic && len(raw) == ed25519.SeedSize:
+			private := ed25519.NewKeyFromSeed(raw)
+			keys = append(keys, &Key{ID: kid, Public: private.Public().(ed25519.PublicKey), private: private})
+		default:
+			return nil, fmt.Errorf("signing key %q must be %d bytes", kid, ed25519.SeedSize)
+		}
+	}
+	return keys, nil
+}
+
+// KeyRing signs with its active key and verifies with any of its keys
+type KeyRing struct {
+	active *Key
+	keys   []*Key
+}
+
+// NewKeyRing creates a key ring signing with the key named activeID
+func NewKeyRing(activeID string, keys []*Key) (*KeyRing, error) {
+	r := &KeyRing{}
+	for _, k := range keys {
+		if r.key(k.ID) != nil {
+			return nil, fmt.Errorf("duplicate signing key ID %q", k.ID)
+		}
+		if k.ID == activeID {
+			r.active = k
+		}
+		r.keys = append(r.keys, k)
+	}
+	if r.active == nil {
+		return nil, fmt.Errorf("active signing key %q not found", activeID)
+	}
+	if !r.active.CanSign() {
+		return nil, fmt.Errorf("active signing key %q has no private key", activeID)
+	}
+	return r, nil
+}
+
+// ActiveID returns the ID of the key new manifests are signed with
+func (r *KeyRing) ActiveID() string { return r.active.ID }
+
+func (r *KeyRing) key(id string) *Key {
+	for _, k := range r.keys {
+		if k.ID == id {
+			return k
+		}
+	}
+	return nil
+}
+
+// PublicKey is a key as published for verification
+type PublicKey struct {
+	KeyID       string `json:"key_id"`
+	Algorithm   string `json:"algorithm"`
+	PublicKey   string `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+	Status      string `json:"status"`
+}
+
+// PublicKeys lists every key of the ring, the active one first
+func (r *KeyRing) PublicKeys() []PublicKey {
+	out := make([]PublicKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		out = append(out, PublicKey{
+			KeyID:       k.ID,
+			Algorithm:   Algorithm,
+			PublicKey:   base64.StdEncoding.EncodeToString(k.Public),
+			Fingerprint: evidence.Fingerprint(k.Public),
+			Status:      r.status(k),
+		})
+	}
+	slices.SortStableFunc(out, func(a, b PublicKey) int {
+		return strings.Compare(a.Status, b.Status) // active before retired
+	})
+	return out
+}
+
+func (r *KeyRing) status(k *Key) string {
+	if k == r.active {
+		return KeyActive
+	}
+	return KeyRetired
+}
+
+// Status returns the status of the key named id, or "" when the ring does
+// not hold it
+func (r *KeyRing) Status(id string) string {
+	if k := r.key(id); k != nil {
+		return r.status(k)
+	}
+	return ""
+}
+
+// Manifest is what a signature covers: the job and every artifact it
+// produced
+type Manifest struct {
+	Type        string     `json:"type"`
+	Issuer      string     `json:"issuer"`
+	JobID       int64      `json:"job_id"`
+	DatasetID   int64      `json:"dataset_id"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	SignedAt    time.Time  `json:"signed_at"`
+	KeyID       string     `json:"key_id"`
+	Files       []File     `json:"files"`
+}
+
+// File is an artifact of a signed manifest. Signature, when present, is a
+// detached signature of the file alone; see FileMessage.
+type File struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Format    string `json:"format"`
+	Bytes     int64  `json:"bytes"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// Envelope is a signed manifest. The signature covers the decoded
+// Payload byte for byte; Manifest repeats it for reading and is not
+// itself verified.
+type Envelope struct {
+	Payload   string    `json:"payload"`
+	Signature string    `json:"signature"`
+	KeyID     string    `json:"key_id"`
+	Algorithm string    `json:"algorithm"`
+	Manifest  *Manifest `json:"manifest,omitempty"`
+}
+
+// FileMessage is the message a detached file signature covers: the
+// context, job, name and digest on their own lines
+func FileMessage(jobID int64, name, sha256 string) []byte {
+	return []byte(strings.Join([]string{fileContext, strconv.FormatInt(jobID, 10), name, strings.ToLower(sha256)}, "\n"))
+}
+
+// Sign signs the manifest of a job's artifacts with the active key, with
+// a detached signature per file when signFiles is set. Every artifact
+// must have a checksum.
+func (r *KeyRing) Sign(job *models.GenerationJob, artifacts []models.JobArtifact, signFiles bool, now time.Time) (*Envelope, error) {
+	m := Manifest{
+		Type:        ManifestType,
+		Issuer:      Issuer,
+		JobID:       job.ID,
+		DatasetID:   job.DatasetID,
+		CompletedAt: job.CompletedAt,
+		SignedAt:    now.UTC().Truncate(time.Second),
+		KeyID:       r.active.ID,
+		Files:       make([]File, 0, len(artifacts)),
+	}
+	for _, a := range artifacts {
+		if a.SHA256 == "" {
+			return nil, fmt.Errorf("%w: %s", ErrNoChecksums, a.Name)
+		}
+		f := File{Name: a.Name, Kind: a.Kind, Format: a.Format, Bytes: a.Bytes, SHA256: a.SHA256}
+		if signFiles {
+			f.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(r.active.private, FileMessage(job.ID, a.Name, a.SHA256)))
+		}
+		m.Files = append(m.Files, f)
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(r.active.private, payload)),
+		KeyID:     r.active.ID,
+		Algorithm: Algorithm,
+		Manifest:  &m,
+	}, nil
+}
+
+// Verify checks an envelope's signature with the key it names and returns
+// the manifest it signed
+func (r *KeyRing) Verify(env Envelope) (*Manifest, error) {
+	k := r.key(env.KeyID)
+	if k == nil {
+		return nil, ErrUnknownKey
+	}
+	payload, err := base64.StdEncoding.DecodeString(env.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: payload is not base64", ErrBadSignature)
+	}
+	signature, err := base64.StdEncoding.DecodeString(env.Signature)
+	if err != nil || (env.Algorithm != "" && env.Algorithm != Algorithm) || !ed25519.Verify(k.Public, payload, signature) {
+		return nil, ErrBadSignature
+	}
+	var m Manifest
+	if err := json.Unmarshal(payload, &m); err != nil || m.Type != ManifestType || m.KeyID != env.KeyID {
+		return nil, fmt.Errorf("%w: not a signed export manifest", ErrBadSignature)
+	}
+	return &m, nil
+}
+
+// VerifyFile checks the detached signature of one file
+func (r *KeyRing) VerifyFile(keyID string, jobID int64, name, sha256, signature string) error {
+	k := r.key(keyID)
+	if k == nil {
+		return ErrUnknownKey
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(k.Public, FileMessage(jobID, name, sha256), sig) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Find returns the file of a manifest by name
+func (m *Manifest) Find(name string) (File, bool) {
+	for _, f := range m.Files {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return File{}, false
+}
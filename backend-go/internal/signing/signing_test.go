@@ -0,0 +1,118 @@
+// Package signing_test provides unit tests for export manifest signing
+package signing_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/signing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seed(b byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune('a'+b)), 32)))
+}
+
+func ring(t *testing.T, active, spec string) *signing.KeyRing {
+	t.Helper()
+	keys, err := signing.ParseKeys(spec)
+	require.NoError(t, err)
+	r, err := signing.NewKeyRing(active, keys)
+	require.NoError(t, err)
+	return r
+}
+
+var artifactList = []models.JobArtifact{
+	{Name: "job-9.csv", Kind: models.ArtifactData, Format: "csv", Bytes: 12, SHA256: "aa"},
+	{Name: "quality-report.json", Kind: models.ArtifactReport, Format: "json", Bytes: 40, SHA256: "bb"},
+}
+
+func TestSignAndVerify(t *testing.T) {
+	r := ring(t, "k1", "k1:"+seed(1))
+	job := &models.GenerationJob{ID: 9, DatasetID: 3}
+	env, err := r.Sign(job, artifactList, true, time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, "k1", env.KeyID)
+	assert.Equal(t, signing.Algorithm, env.Algorithm)
+
+	m, err := r.Verify(*env)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), m.JobID)
+	assert.Equal(t, signing.Issuer, m.Issuer)
+	require.Len(t, m.Files, 2)
+	f, ok := m.Find("job-9.csv")
+	require.True(t, ok)
+	assert.Equal(t, "aa", f.SHA256)
+	require.NoError(t, r.VerifyFile("k1", 9, f.Name, f.SHA256, f.Signature))
+	assert.ErrorIs(t, r.VerifyFile("k1", 9, f.Name, "ab", f.Signature), signing.ErrBadSignature, "changed file")
+	assert.ErrorIs(t, r.VerifyFile("k1", 10, f.Name, f.SHA256, f.Signature), signing.ErrBadSignature, "another job")
+
+	// A payload edited after signing no longer verifies
+	payload, _ := base64.StdEncoding.DecodeString(env.Payload)
+	var edited map[string]any
+	require.NoError(t, json.Unmarshal(payload, &edited))
+	edited["job_id"] = 10
+	raw, _ := json.Marshal(edited)
+	tampered := *env
+	tampered.Payload = base64.StdEncoding.EncodeToString(raw)
+	_, err = r.Verify(tampered)
+	assert.ErrorIs(t, err, signing.ErrBadSignature)
+
+	tampered = *env
+	tampered.KeyID = "k9"
+	_, err = r.Verify(tampered)
+	assert.ErrorIs(t, err, signing.ErrUnknownKey)
+}
+
+func TestSignWithoutChecksums(t *testing.T) {
+	r := ring(t, "k1", "k1:"+seed(1))
+	_, err := r.Sign(&models.GenerationJob{ID: 4}, []models.JobArtifact{{Name: "job-4.json"}}, false, time.Now())
+	assert.ErrorIs(t, err, signing.ErrNoChecksums)
+}
+
+func TestKeyRotation(t *testing.T) {
+	old := ring(t, "k1", "k1:"+seed(1))
+	env, err := old.Sign(&models.GenerationJob{ID: 9}, artifactList, false, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, env.Manifest.Files[0].Signature)
+
+	// After rotation k1 is kept by its public half and still verifies
+	pub := old.PublicKeys()[0].PublicKey
+	rotated := ring(t, "k2", "k1:pub:"+pub+",k2:"+seed(2))
+	_, err = rotated.Verify(*env)
+	require.NoError(t, err)
+	assert.Equal(t, signing.KeyRetired, rotated.Status("k1"))
+
+	keys := rotated.PublicKeys()
+	require.Len(t, keys, 2)
+	assert.Equal(t, "k2", keys[0].KeyID)
+	assert.Equal(t, signing.KeyActive, keys[0].Status)
+	assert.NotEmpty(t, keys[0].Fingerprint)
+
+	next, err := rotated.Sign(&models.GenerationJob{ID: 9}, artifactList, false, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, "k2", next.KeyID)
+
+	// A key removed from the ring verifies nothing
+	_, err = ring(t, "k2", "k2:"+seed(2)).Verify(*env)
+	assert.ErrorIs(t, err, signing.ErrUnknownKey)
+}
+
+func TestParseKeys(t *testing.T) {
+	_, err := signing.ParseKeys("k1:" + base64.StdEncoding.EncodeToString([]byte("short")))
+	assert.Error(t, err)
+	_, err = signing.ParseKeys("k1")
+	assert.Error(t, err)
+
+	keys, err := signing.ParseKeys("k1:pub:" + seed(1))
+	require.NoError(t, err)
+	_, err = signing.NewKeyRing("k1", keys)
+	assert.Error(t, err, "a public key cannot sign")
+	_, err = signing.NewKeyRing("k1", append(keys, keys[0]))
+	assert.Error(t, err)
+}
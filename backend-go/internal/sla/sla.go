@@ -0,0 +1,211 @@
+// Package sla measures plan service levels and turns missed targets into
+// billing credits
+package sla
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/analytics"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pricing"
+	"go.uber.org/zap"
+)
+
+// Store measures availability and job latency and persists reports
+type Store interface {
+	InsertSample(ctx context.Context, at time.Time, healthy bool) error
+	Availability(ctx context.Context, start, end time.Time) (*float64, error)
+	JobLatency(ctx context.Context, userID int64, start, end time.Time) (int64, *float64, error)
+	UpsertReport(ctx context.Context, rep *models.SLAReport) (*models.SLAReport, error)
+}
+
+// Subscriptions lists the subscription each user held at a point in time
+type Subscriptions interface {
+	ListCurrent(ctx context.Context, at time.Time) ([]models.UserSubscription, error)
+}
+
+// Ledger records billing credits; inserting the same source entry twice
+// must not credit twice
+type Ledger interface {
+	Insert(ctx context.Context, c *models.BillingCredit) (*models.BillingCredit, bool, error)
+}
+
+// Notifier tells subscribers about credits issued to them
+type Notifier interface {
+	Notify(ctx context.Context, n *models.Notification) error
+}
+
+// maxPendingSamples bounds the samples buffered while the store is down
+// (one week at one sample per minute)
+const maxPendingSamples = 7 * 24 * 60
+
+type sample struct {
+	at      time.Time
+	healthy bool
+}
+
+// Service produces monthly SLA reports and credits
+type Service struct {
+	store  Store
+	subs   Subscriptions
+	ledger Ledger
+	notify Notifier
+	logger *zap.Logger
+
+	mu      sync.Mutex
+	pending []sample
+}
+
+func NewService(store Store, subs Subscriptions, ledger Ledger, logger *zap.Logger) *Service {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Service{store: store, subs: subs, ledger: ledger, logger: logger}
+}
+
+// SetNotifier notifies subscribers when they are credited
+func (s *Service) SetNotifier(n Notifier) {
+	s.notify = n
+}
+
+// RecordAvailability stores an availability sample. Samples that cannot be
+// written, typically because the database itself is down, are kept and
+// retried on the next call so outages are not lost from the record.
+func (s *Service) RecordAvailability(ctx context.Context, at time.Time, healthy bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = append(s.pending, sample{at: at, healthy: healthy})
+	if len(s.pending) > maxPendingSamples {
+		s.pending = s.pending[len(s.pending)-maxPendingSamples:]
+	}
+	for len(s.pending) > 0 {
+		if err := s.store.InsertSample(ctx, s.pending[0].at, s.pending[0].healthy); err != nil {
+			return fmt.Errorf("failed to record availability sample (%d pending): %w", len(s.pending), err)
+		}
+		s.pending = s.pending[1:]
+	}
+	return nil
+}
+
+// Evaluate checks measured figures against an SLA and returns which targets
+// were met and the credit earned as a percentage of the monthly fee. Figures
+// that were not measured count as met.
+func Evaluate(def *pricing.SLA, availability, p95LatencySeconds *float64) (availabilityMet, latencyMet bool, creditPercent float64) {
+	availabilityMet, latencyMet = true, true
+	if availability != nil && *availability < def.AvailabilityTarget {
+		availabilityMet = false
+		for _, tier := range def.AvailabilityCredits {
+			if *availability < tier.BelowPercent {
+				creditPercent = tier.CreditPercent
+				break
+			}
+		}
+	}
+	if p95LatencySeconds != nil && *p95LatencySeconds > def.P95JobLatencySeconds {
+		latencyMet = false
+		creditPercent += def.LatencyCreditPercent
+	}
+	if def.MaxCreditPercent > 0 && creditPercent > def.MaxCreditPercent {
+		creditPercent = def.MaxCreditPercent
+	}
+	return availabilityMet, latencyMet, creditPercent
+}
+
+// MonthStart returns the first instant of t's month in UTC
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// GenerateMonth reports SLA attainment for every paying subscriber whose plan
+// carries an SLA and credits the ledger for missed targets. Reports can be
+// regenerated; a month's credit is only ever issued once per subscriber.
+func (s *Service) GenerateMonth(ctx context.Context, month time.Time) ([]models.SLAReport, error) {
+	start := MonthStart(month)
+	end := start.AddDate(0, 1, 0)
+
+	availability, err := s.store.Availability(ctx, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure availability: %w", err)
+	}
+	subs, err := s.subs.ListCurrent(ctx, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+
+	reports := make([]models.SLAReport, 0)
+	for _, sub := range subs {
+		def := pricing.PlanSLA(string(sub.SubscriptionTier))
+		if def == nil || (sub.Status != models.SubStatusActive && sub.Status != models.SubStatusPastDue) {
+			continue
+		}
+		jobs, p95, err := s.store.JobLatency(ctx, sub.UserID, start, end)
+		if err != nil {
+			return reports, fmt.Errorf("failed to measure job latency for user %d: %w", sub.UserID, err)
+		}
+		availabilityMet, latencyMet, pct := Evaluate(def, availability, p95)
+		fee := analytics.SubscriptionMRR(sub)
+
+		stored, err := s.store.UpsertReport(ctx, &models.SLAReport{
+			UserID:             sub.UserID,
+			Month:              start,
+			SubscriptionTier:   sub.SubscriptionTier,
+			AvailabilityTarget: def.AvailabilityTarget,
+			Availability:       availability,
+			P95LatencyTarget:   def.P95JobLatencySeconds,
+			P95LatencySeconds:  p95,
+			CompletedJobs:      jobs,
+			AvailabilityMet:    availabilityMet,
+			LatencyMet:         latencyMet,
+			CreditPercent:      pct,
+			CreditAmount:       math.Round(fee*pct) / 100,
+			MonthlyFee:         fee,
+		})
+		if err != nil {
+			return reports, fmt.Errorf("failed to store SLA report for user %d: %w", sub.UserID, err)
+		}
+		reports = append(reports, *stored)
+
+		if stored.CreditAmount <= 0 || s.ledger == nil {
+			continue
+		}
+		_, created, err := s.ledger.Insert(ctx, &models.BillingCredit{
+			UserID:   sub.UserID,
+			Amount:   stored.CreditAmount,
+			Currency: "USD",
+			Reason:   fmt.Sprintf("SLA credit for %s", start.Format("January 2006")),
+			Source:   models.CreditSourceSLA,
+			SourceID: fmt.Sprintf("%d:%s", sub.UserID, start.Format("2006-01")),
+		})
+		if err != nil {
+			return reports, fmt.Errorf("failed to credit user %d: %w", sub.UserID, err)
+		}
+		if created {
+			s.logger.Info("issued SLA credit", zap.Int64("user_id", sub.UserID), zap.String("month", start.Format("2006-01")),
+				zap.Float64("amount", stored.CreditAmount))
+			s.notifyCredit(ctx, stored, start)
+		}
+	}
+	return reports, nil
+}
+
+func (s *Service) notifyCredit(ctx context.Context, rep *models.SLAReport, month time.Time) {
+	if s.notify == nil {
+		return
+	}
+	err := s.notify.Notify(ctx, &models.Notification{
+		UserID:   rep.UserID,
+		Category: models.NotificationCategoryBilling,
+		Title:    fmt.Sprintf("SLA credit issued for %s", month.Format("January 2006")),
+		Body: fmt.Sprintf("Your plan missed its service level targets in %s. A credit of $%.2f (%.0f%% of your monthly fee) will be applied to your next invoice.",
+			month.Format("January 2006"), rep.CreditAmount, rep.CreditPercent),
+	})
+	if err != nil {
+		s.logger.Warn("failed to notify SLA credit", zap.Int64("user_id", rep.UserID), zap.Error(err))
+	}
+}
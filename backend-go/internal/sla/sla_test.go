@@ -0,0 +1,143 @@
+// Package sla_test provides unit tests for SLA measurement and credits
+package sla_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pricing"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/sla"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStore struct {
+	failInserts  bool
+	samples      []bool
+	availability *float64
+	p95          map[int64]float64
+	reports      []models.SLAReport
+}
+
+func (f *fakeStore) InsertSample(ctx context.Context, at time.Time, healthy bool) error {
+	if f.failInserts {
+		return errors.New("db down")
+	}
+	f.samples = append(f.samples, healthy)
+	return nil
+}
+
+func (f *fakeStore) Availability(ctx context.Context, start, end time.Time) (*float64, error) {
+	return f.availability, nil
+}
+
+func (f *fakeStore) JobLatency(ctx context.Context, userID int64, start, end time.Time) (int64, *float64, error) {
+	if v, ok := f.p95[userID]; ok {
+		return 10, &v, nil
+	}
+	return 0, nil, nil
+}
+
+func (f *fakeStore) UpsertReport(ctx context.Context, rep *models.SLAReport) (*models.SLAReport, error) {
+	f.reports = append(f.reports, *rep)
+	return rep, nil
+}
+
+type fakeSubs []models.UserSubscription
+
+func (f fakeSubs) ListCurrent(ctx context.Context, at time.Time) ([]models.UserSubscription, error) {
+	return f, nil
+}
+
+type fakeLedger struct {
+	credits map[string]models.BillingCredit
+}
+
+func (f *fakeLedger) Insert(ctx context.Context, c *models.BillingCredit) (*models.BillingCredit, bool, error) {
+	key := c.Source + "/" + c.SourceID
+	if existing, ok := f.credits[key]; ok {
+		return &existing, false, nil
+	}
+	f.credits[key] = *c
+	return c, true, nil
+}
+
+func ptr(v float64) *float64 { return &v }
+
+func TestEvaluate(t *testing.T) {
+	def := pricing.PlanSLA("growth")
+	require.NotNil(t, def)
+
+	t.Run("met or unmeasured earns nothing", func(t *testing.T) {
+		a, l, pct := sla.Evaluate(def, ptr(99.95), ptr(100))
+		assert.True(t, a)
+		assert.True(t, l)
+		assert.Zero(t, pct)
+
+		a, l, pct = sla.Evaluate(def, nil, nil)
+		assert.True(t, a)
+		assert.True(t, l)
+		assert.Zero(t, pct)
+	})
+
+	t.Run("availability tiers", func(t *testing.T) {
+		_, _, pct := sla.Evaluate(def, ptr(99.5), nil)
+		assert.Equal(t, 10.0, pct)
+		_, _, pct = sla.Evaluate(def, ptr(98), nil)
+		assert.Equal(t, 25.0, pct)
+	})
+
+	t.Run("credits combine up to the cap", func(t *testing.T) {
+		a, l, pct := sla.Evaluate(def, ptr(90), ptr(1200))
+		assert.False(t, a)
+		assert.False(t, l)
+		assert.Equal(t, def.MaxCreditPercent, pct)
+	})
+
+	assert.Nil(t, pricing.PlanSLA("starter"))
+}
+
+func TestGenerateMonth(t *testing.T) {
+	store := &fakeStore{availability: ptr(99.5), p95: map[int64]float64{2: 900}}
+	ledger := &fakeLedger{credits: map[string]models.BillingCredit{}}
+	subs := fakeSubs{
+		{UserID: 1, SubscriptionTier: models.TierGrowth, Status: models.SubStatusActive},
+		{UserID: 2, SubscriptionTier: models.TierGrowth, Status: models.SubStatusActive},
+		{UserID: 3, SubscriptionTier: models.TierStarter, Status: models.SubStatusActive},
+		{UserID: 4, SubscriptionTier: models.TierGrowth, Status: models.SubStatusCancelled},
+	}
+	svc := sla.NewService(store, subs, ledger, nil)
+	month := time.Date(2026, 9, 15, 0, 0, 0, 0, time.UTC)
+
+	reports, err := svc.GenerateMonth(context.Background(), month)
+	require.NoError(t, err)
+	require.Len(t, reports, 2)
+
+	assert.Equal(t, time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), reports[0].Month)
+	assert.Equal(t, 129.9, reports[0].CreditAmount)
+	assert.True(t, reports[0].LatencyMet)
+	assert.Equal(t, 20.0, reports[1].CreditPercent)
+	assert.False(t, reports[1].LatencyMet)
+
+	// Regenerating does not credit twice
+	_, err = svc.GenerateMonth(context.Background(), month)
+	require.NoError(t, err)
+	assert.Len(t, ledger.credits, 2)
+	assert.Equal(t, 259.8, ledger.credits["sla/2:2026-09"].Amount)
+}
+
+func TestRecordAvailabilityBuffersDuringOutage(t *testing.T) {
+	store := &fakeStore{failInserts: true}
+	svc := sla.NewService(store, nil, nil, nil)
+	now := time.Now()
+
+	assert.Error(t, svc.RecordAvailability(context.Background(), now, false))
+	assert.Error(t, svc.RecordAvailability(context.Background(), now.Add(time.Minute), false))
+
+	store.failInserts = false
+	require.NoError(t, svc.RecordAvailability(context.Background(), now.Add(2*time.Minute), true))
+	assert.Equal(t, []bool{false, false, true}, store.samples)
+}
@@ -0,0 +1,69 @@
+package sources
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// mysqlPort is the default MySQL port
+const mysqlPort = 3306
+
+// mysqlDriver is the database/sql driver MySQL sources are opened with.
+// It is registered by the binary; without it MySQL sources are refused.
+const mysqlDriver = "mysql"
+
+var mysqlDialect = dialect{
+	tables: `SELECT c.TABLE_SCHEMA, c.TABLE_NAME, t.TABLE_TYPE = 'VIEW', COALESCE(t.TABLE_ROWS, 0), c.COLUMN_NAME, c.DATA_TYPE
+        FROM information_schema.COLUMNS c
+        JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME
+        WHERE c.TABLE_SCHEMA = DATABASE()
+        ORDER BY c.TABLE_NAME, c.ORDINAL_POSITION`,
+	quote: func(name string) string { return "`" + strings.ReplaceAll(name, "`", "``") + "`" },
+	sample: func(cols, target string, fraction float64, limit int) string {
+		q := "SELECT " + cols + " FROM " + target
+		if fraction < 1 {
+			q += " WHERE RAND() < " + formatFraction(fraction)
+		}
+		return q + " LIMIT " + strconv.Itoa(limit)
+	},
+}
+
+// MySQLAvailable reports whether MySQL sources can be opened
+func MySQLAvailable() bool {
+	return slices.Contains(sql.Drivers(), mysqlDriver)
+}
+
+func openMySQL(s models.DatasetSourceSettings, c Credentials) (Source, error) {
+	if !MySQLAvailable() {
+		return nil, fmt.Errorf("%w: %s", ErrDriverUnavailable, KindMySQL)
+	}
+	port := s.Port
+	if port == 0 {
+		port = mysqlPort
+	}
+	tls := "true"
+	if s.TLS == TLSRequire {
+		tls = "skip-verify"
+	}
+	params := url.Values{
+		"tls":          {tls},
+		"timeout":      {"10s"},
+		"readTimeout":  {statementTimeout.String()},
+		"writeTimeout": {(30 * time.Second).String()},
+	}
+	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?%s", s.User, c.Password, net.JoinHostPort(s.Host, strconv.Itoa(port)), s.Database, params.Encode())
+	db, err := sql.Open(mysqlDriver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSource, err)
+	}
+	db.SetMaxOpenConns(1)
+	return New(KindMySQL, db)
+}
@@ -0,0 +1,89 @@
+package sources
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/lib/pq"
+)
+
+// postgresPort is the default PostgreSQL port
+const postgresPort = 5432
+
+var postgresDialect = dialect{
+	tables: `SELECT c.table_schema, c.table_name, t.table_type = 'VIEW', COALESCE(s.n_live_tup, 0), c.column_name, c.data_type
+        FROM information_schema.columns c
+        JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+        LEFT JOIN pg_stat_user_tables s ON s.schemaname = c.table_schema AND s.relname = c.table_name
+        WHERE c.table_schema NOT IN ('pg_catalog', 'information_schema') AND t.table_type IN ('BASE TABLE', 'VIEW')
+        ORDER BY c.table_schema, c.table_name, c.ordinal_position`,
+	quote: func(name string) string { return `"` + strings.ReplaceAll(name, `"`, `""`) + `"` },
+	sample: func(cols, target string, fraction float64, limit int) string {
+		q := "SELECT " + cols + " FROM " + target
+		if fraction < 1 {
+			q += " TABLESAMPLE BERNOULLI (" + formatFraction(fraction*100) + ")"
+		}
+		return q + " LIMIT " + strconv.Itoa(limit)
+	},
+}
+
+// dialer adapts a dial function to the driver's dialer interfaces
+type dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (d dialer) Dial(network, addr string) (net.Conn, error) {
+	return d(context.Background(), network, addr)
+}
+
+func (d dialer) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d(ctx, network, addr)
+}
+
+func (d dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d(ctx, network, addr)
+}
+
+func openPostgres(s models.DatasetSourceSettings, c Credentials, n Network) (Source, error) {
+	port := s.Port
+	if port == 0 {
+		port = postgresPort
+	}
+	sslmode := s.TLS
+	if sslmode == "" {
+		sslmode = TLSVerifyFull
+	}
+	// Every session defaults to read-only transactions, besides the
+	// read-only transactions statements run in
+	params := url.Values{
+		"sslmode":                       {sslmode},
+		"connect_timeout":               {"10"},
+		"default_transaction_read_only": {"on"},
+		"statement_timeout":             {strconv.Itoa(int(statementTimeout / time.Millisecond))},
+		"application_name":              {"synthos-dataset-source"},
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(s.User, c.Password),
+		Host:     net.JoinHostPort(s.Host, strconv.Itoa(port)),
+		Path:     "/" + s.Database,
+		RawQuery: params.Encode(),
+	}
+	connector, err := pq.NewConnector(dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSource, err)
+	}
+	if n.Dial != nil {
+		connector.Dialer(dialer(n.Dial))
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(1)
+	return New(KindPostgres, db)
+}
@@ -0,0 +1,337 @@
+// Package sources samples datasets from customers' databases instead of
+// uploaded files. A source is a PostgreSQL or MySQL connection whose
+// credentials are sealed under a KMS key. Its tables are introspected from
+// the information schema and rows are sampled at random, up to a limit,
+// inside read-only transactions.
+package sources
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+)
+
+// Source kinds
+const (
+	KindPostgres = "postgres"
+	KindMySQL    = "mysql"
+)
+
+// Kinds are the databases datasets can be sampled from
+var Kinds = []string{KindPostgres, KindMySQL}
+
+// TLS modes of a connection
+const (
+	TLSVerifyFull = "verify-full"
+	TLSRequire    = "require"
+)
+
+var (
+	ErrInvalidSource = errors.New("invalid dataset source")
+	ErrUnknownTable  = errors.New("unknown table")
+	// ErrDriverUnavailable is returned for a kind whose database driver is
+	// not built in
+	ErrDriverUnavailable = errors.New("database driver unavailable")
+)
+
+// Credentials authenticate to a source. They are only kept sealed.
+type Credentials struct {
+	Password string `json:"password"`
+}
+
+// Column is a column of a source table with its database type
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Table is a table or view a source's user can read
+type Table struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+	View   bool   `json:"view"`
+	// EstimatedRows comes from the database's statistics and may be stale
+	EstimatedRows int64    `json:"estimated_rows"`
+	Columns       []Column `json:"columns"`
+}
+
+// Source reads one database
+type Source interface {
+	// Test checks the database can be reached with the credentials
+	Test(ctx context.Context) error
+	// Tables lists the tables and views the user can read
+	Tables(ctx context.Context) ([]Table, error)
+	// Sample returns up to limit rows of a table picked at random
+	Sample(ctx context.Context, t Table, limit int) ([]map[string]any, error)
+	Close() error
+}
+
+// Network carries connections to sources, such as through an egress
+// policy; a nil Dial uses the default dialer
+type Network struct {
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// maxTables caps the tables Tables returns
+const maxTables = 1000
+
+// statementTimeout bounds one statement on a source
+const statementTimeout = time.Minute
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]{0,63}$`)
+	hostPattern       = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]{0,251}[A-Za-z0-9])?$`)
+)
+
+// Validate checks the settings and credentials of a source of kind
+func Validate(kind string, s models.DatasetSourceSettings, c Credentials) error {
+	invalid := func(msg string) error { return fmt.Errorf("%w: %s", ErrInvalidSource, msg) }
+	if kind != KindPostgres && kind != KindMySQL {
+		return invalid("unknown kind " + strconv.Quote(kind))
+	}
+	if !hostPattern.MatchString(s.Host) || s.Port < 0 || s.Port > 65535 {
+		return invalid("host and port must name a database server")
+	}
+	if !identifierPattern.MatchString(s.Database) || s.User == "" || strings.ContainsAny(s.User, "@:/ ") {
+		return invalid("database and user are required")
+	}
+	if s.TLS != "" && s.TLS != TLSVerifyFull && s.TLS != TLSRequire {
+		return invalid("tls must be verify-full or require")
+	}
+	if c.Password == "" {
+		return invalid("password is required")
+	}
+	return nil
+}
+
+// Open connects to a source of kind. PostgreSQL connections are dialed
+// through n; MySQL connections use the driver's own dialer, so callers
+// check the host before opening them.
+func Open(kind string, s models.DatasetSourceSettings, c Credentials, n Network) (Source, error) {
+	if err := Validate(kind, s, c); err != nil {
+		return nil, err
+	}
+	if kind == KindMySQL {
+		return openMySQL(s, c)
+	}
+	return openPostgres(s, c, n)
+}
+
+// Find returns the table called name in schema
+func Find(tables []Table, schema, name string) (Table, error) {
+	for _, t := range tables {
+		if t.Schema == schema && t.Name == name {
+			return t, nil
+		}
+	}
+	return Table{}, fmt.Errorf("%w: %s.%s", ErrUnknownTable, schema, name)
+}
+
+// SealCredentials encrypts credentials with a fresh data key and returns
+// them with the key wrapped by the KMS
+func SealCredentials(ctx context.Context, kms storage.KMS, c Credentials) (sealed, wrappedKey, keyID string, err error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", "", "", err
+	}
+	plain, wrappedKey, keyID, err := kms.NewDataKey(ctx)
+	if err != nil {
+		return "", "", "", err
+	}
+	out, err := storage.Seal(plain, raw)
+	if err != nil {
+		return "", "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(out), wrappedKey, keyID, nil
+}
+
+// OpenCredentials decrypts the credentials of a source
+func OpenCredentials(ctx context.Context, kms storage.KMS, s *models.DatasetSource) (Credentials, error) {
+	var c Credentials
+	plain, err := kms.Unwrap(ctx, s.KeyID, s.WrappedKey)
+	if err != nil {
+		return c, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(s.Credentials)
+	if err != nil {
+		return c, fmt.Errorf("invalid sealed credentials: %w", err)
+	}
+	raw, err := storage.Open(plain, sealed)
+	if err != nil {
+		return c, fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+	return c, json.Unmarshal(raw, &c)
+}
+
+// dialect holds what differs between the databases
+type dialect struct {
+	// tables lists schema, table, whether it is a view, its estimated
+	// rows, and a column name and type per row, in column order
+	tables string
+	quote  func(name string) string
+	// sample selects cols from target, keeping each row with probability
+	// fraction, up to limit rows
+	sample func(cols, target string, fraction float64, limit int) string
+}
+
+// dbSource reads a source through database/sql
+type dbSource struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// New reads a source of kind through an open database
+func New(kind string, db *sql.DB) (Source, error) {
+	switch kind {
+	case KindPostgres:
+		return &dbSource{db: db, dialect: postgresDialect}, nil
+	case KindMySQL:
+		return &dbSource{db: db, dialect: mysqlDialect}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidSource, kind)
+}
+
+func (s *dbSource) Test(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, statementTimeout)
+	defer cancel()
+	return s.db.PingContext(ctx)
+}
+
+// readOnly runs fn in a read-only transaction that is always rolled back
+func (s *dbSource) readOnly(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	ctx, cancel := context.WithTimeout(ctx, statementTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return fn(tx)
+}
+
+func (s *dbSource) Tables(ctx context.Context) ([]Table, error) {
+	var out []Table
+	err := s.readOnly(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, s.dialect.tables)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var t Table
+			var col Column
+			if err := rows.Scan(&t.Schema, &t.Name, &t.View, &t.EstimatedRows, &col.Name, &col.Type); err != nil {
+				return err
+			}
+			if n := len(out); n > 0 && out[n-1].Schema == t.Schema && out[n-1].Name == t.Name {
+				out[n-1].Columns = append(out[n-1].Columns, col)
+				continue
+			}
+			if len(out) == maxTables {
+				break
+			}
+			t.Columns = []Column{col}
+			out = append(out, t)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+func (s *dbSource) Sample(ctx context.Context, t Table, limit int) ([]map[string]any, error) {
+	if limit <= 0 || len(t.Columns) == 0 {
+		return []map[string]any{}, nil
+	}
+	cols := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		cols[i] = s.dialect.quote(col.Name)
+	}
+	// Sampling twice the rows needed from the estimate leaves a margin
+	// for stale statistics; views have none and are read from the start
+	fraction := 1.0
+	if !t.View && t.EstimatedRows > int64(limit) {
+		fraction = min(1, 2*float64(limit)/float64(t.EstimatedRows))
+	}
+	q := s.dialect.sample(strings.Join(cols, ", "), s.dialect.quote(t.Schema)+"."+s.dialect.quote(t.Name), fraction, limit)
+	out := make([]map[string]any, 0, limit)
+	err := s.readOnly(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, q)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		types, err := rows.ColumnTypes()
+		if err != nil {
+			return err
+		}
+		values := make([]any, len(types))
+		ptrs := make([]any, len(types))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		for rows.Next() && len(out) < limit {
+			if err := rows.Scan(ptrs...); err != nil {
+				return err
+			}
+			row := make(map[string]any, len(types))
+			for i, typ := range types {
+				row[t.Columns[i].Name] = normalize(values[i], typ.DatabaseTypeName())
+			}
+			out = append(out, row)
+		}
+		return rows.Err()
+	})
+	return out, err
+}
+
+func (s *dbSource) Close() error { return s.db.Close() }
+
+// normalize converts a scanned value to one JSON keeps: numbers the driver
+// returns as text become numbers, times become RFC 3339 strings and binary
+// values become base64
+func normalize(v any, dbType string) any {
+	switch x := v.(type) {
+	case []byte:
+		if numericType(dbType) {
+			if n, err := strconv.ParseInt(string(x), 10, 64); err == nil {
+				return n
+			}
+			if f, err := strconv.ParseFloat(string(x), 64); err == nil {
+				return f
+			}
+		}
+		if utf8.Valid(x) {
+			return string(x)
+		}
+		return base64.StdEncoding.EncodeToString(x)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	}
+	return v
+}
+
+func numericType(dbType string) bool {
+	switch strings.TrimPrefix(strings.ToUpper(dbType), "UNSIGNED ") {
+	case "NUMERIC", "DECIMAL", "INT", "INTEGER", "INT2", "INT4", "INT8", "SMALLINT", "TINYINT", "MEDIUMINT", "BIGINT",
+		"FLOAT", "FLOAT4", "FLOAT8", "DOUBLE", "REAL":
+		return true
+	}
+	return false
+}
+
+// formatFraction renders a sampling fraction for a statement
+func formatFraction(f float64) string {
+	return strconv.FormatFloat(f, 'f', 8, 64)
+}
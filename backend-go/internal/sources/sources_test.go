@@ -0,0 +1,187 @@
+// Package sources_test provides unit tests for database dataset sources
+package sources_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/sources"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKMS wraps data keys under a local key, as a KMS would under its own
+type fakeKMS struct{ key []byte }
+
+func newFakeKMS(t *testing.T) *fakeKMS {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return &fakeKMS{key: key}
+}
+
+func (f *fakeKMS) NewDataKey(ctx context.Context) ([]byte, string, string, error) {
+	plain := make([]byte, 32)
+	if _, err := rand.Read(plain); err != nil {
+		return nil, "", "", err
+	}
+	sealed, err := storage.Seal(f.key, plain)
+	return plain, base64.StdEncoding.EncodeToString(sealed), "keys/1", err
+}
+
+func (f *fakeKMS) Unwrap(ctx context.Context, keyID, wrapped string) ([]byte, error) {
+	if keyID != "keys/1" {
+		return nil, errors.New("unknown key")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return storage.Open(f.key, sealed)
+}
+
+func TestValidate(t *testing.T) {
+	settings := models.DatasetSourceSettings{Host: "db.example.com", Database: "sales", User: "reader"}
+	creds := sources.Credentials{Password: "secret"}
+	assert.NoError(t, sources.Validate(sources.KindPostgres, settings, creds))
+	assert.NoError(t, sources.Validate(sources.KindMySQL, settings, creds))
+
+	cases := map[string]struct {
+		kind     string
+		settings models.DatasetSourceSettings
+		creds    sources.Credentials
+	}{
+		"unknown kind":     {"oracle", settings, creds},
+		"host with a path": {sources.KindPostgres, models.DatasetSourceSettings{Host: "db.example.com/x", Database: "sales", User: "reader"}, creds},
+		"user with an at":  {sources.KindMySQL, models.DatasetSourceSettings{Host: "db.example.com", Database: "sales", User: "a@b"}, creds},
+		"database quoted":  {sources.KindPostgres, models.DatasetSourceSettings{Host: "db.example.com", Database: `s"ales`, User: "reader"}, creds},
+		"unknown tls mode": {sources.KindPostgres, models.DatasetSourceSettings{Host: "db.example.com", Database: "sales", User: "reader", TLS: "disable"}, creds},
+		"missing password": {sources.KindPostgres, settings, sources.Credentials{}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, sources.Validate(tc.kind, tc.settings, tc.creds), sources.ErrInvalidSource)
+		})
+	}
+}
+
+func TestCredentialsRoundTrip(t *testing.T) {
+	kms := newFakeKMS(t)
+	sealed, wrapped, keyID, err := sources.SealCredentials(context.Background(), kms, sources.Credentials{Password: "hunter2"})
+	require.NoError(t, err)
+	assert.Equal(t, "keys/1", keyID)
+	assert.NotContains(t, sealed, "hunter2")
+
+	creds, err := sources.OpenCredentials(context.Background(), kms, &models.DatasetSource{Credentials: sealed, WrappedKey: wrapped, KeyID: keyID})
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", creds.Password)
+
+	_, err = sources.OpenCredentials(context.Background(), newFakeKMS(t), &models.DatasetSource{Credentials: sealed, WrappedKey: wrapped, KeyID: keyID})
+	assert.Error(t, err)
+}
+
+func TestTables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	src, err := sources.New(sources.KindPostgres, db)
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FROM information_schema.columns`).WillReturnRows(
+		sqlmock.NewRows([]string{"table_schema", "table_name", "view", "rows", "column_name", "data_type"}).
+			AddRow("public", "orders", false, 50000, "id", "bigint").
+			AddRow("public", "orders", false, 50000, "total", "numeric").
+			AddRow("reporting", "daily", true, 0, "day", "date"))
+	mock.ExpectRollback()
+
+	tables, err := src.Tables(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []sources.Table{
+		{Schema: "public", Name: "orders", EstimatedRows: 50000, Columns: []sources.Column{{Name: "id", Type: "bigint"}, {Name: "total", Type: "numeric"}}},
+		{Schema: "reporting", Name: "daily", View: true, Columns: []sources.Column{{Name: "day", Type: "date"}}},
+	}, tables)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	_, err = sources.Find(tables, "public", "users")
+	assert.ErrorIs(t, err, sources.ErrUnknownTable)
+}
+
+func TestSample(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	columns := func() *sqlmock.Rows {
+		return sqlmock.NewRowsWithColumnDefinition(
+			sqlmock.NewColumn("id").OfType("INT8", int64(0)),
+			sqlmock.NewColumn("total").OfType("NUMERIC", []byte{}),
+			sqlmock.NewColumn("note").OfType("TEXT", ""),
+			sqlmock.NewColumn("at").OfType("TIMESTAMPTZ", day),
+		)
+	}
+	table := sources.Table{Schema: "public", Name: `or"ders`, EstimatedRows: 50000, Columns: []sources.Column{
+		{Name: "id"}, {Name: "total"}, {Name: "note"}, {Name: "at"},
+	}}
+
+	t.Run("large postgres tables are sampled at random", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		src, err := sources.New(sources.KindPostgres, db)
+		require.NoError(t, err)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id", "total", "note", "at" FROM "public"."or""ders" TABLESAMPLE BERNOULLI (0.40000000) LIMIT 100`)).
+			WillReturnRows(columns().AddRow(int64(7), []byte("19.99"), "first", day).AddRow(int64(8), []byte("5"), nil, day))
+		mock.ExpectRollback()
+
+		rows, err := src.Sample(context.Background(), table, 100)
+		require.NoError(t, err)
+		assert.Equal(t, []map[string]any{
+			{"id": int64(7), "total": 19.99, "note": "first", "at": "2024-03-01T00:00:00Z"},
+			{"id": int64(8), "total": int64(5), "note": nil, "at": "2024-03-01T00:00:00Z"},
+		}, rows)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("small mysql tables are read whole", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		src, err := sources.New(sources.KindMySQL, db)
+		require.NoError(t, err)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT `id`, `total`, `note`, `at` FROM `shop`.`orders` LIMIT 100")).
+			WillReturnRows(columns())
+		mock.ExpectRollback()
+
+		rows, err := src.Sample(context.Background(), sources.Table{Schema: "shop", Name: "orders", EstimatedRows: 80, Columns: table.Columns}, 100)
+		require.NoError(t, err)
+		assert.Empty(t, rows)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("large mysql tables are sampled at random", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		src, err := sources.New(sources.KindMySQL, db)
+		require.NoError(t, err)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM `public`.`or\"ders` WHERE RAND() < 0.00400000 LIMIT 100")).WillReturnRows(columns())
+		mock.ExpectRollback()
+
+		_, err = src.Sample(context.Background(), table, 100)
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestMySQLNeedsDriver(t *testing.T) {
+	if sources.MySQLAvailable() {
+		t.Skip("mysql driver is registered")
+	}
+	_, err := sources.Open(sources.KindMySQL, models.DatasetSourceSettings{Host: "db.example.com", Database: "sales", User: "reader"}, sources.Credentials{Password: "secret"}, sources.Network{})
+	assert.ErrorIs(t, err, sources.ErrDriverUnavailable)
+}
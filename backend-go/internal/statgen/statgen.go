@@ -0,0 +1,523 @@
+// Package statgen generates tabular rows without a language model. Each
+// column of a source sample is fitted with a marginal distribution (a
+// gaussian for numeric columns with few values, empirical quantiles for the
+// rest, category frequencies for text) and the dependence between columns
+// is kept by a Gaussian copula fitted to their normal scores.
+package statgen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Marginal kinds
+const (
+	KindGaussian    = "gaussian"
+	KindQuantiles   = "empirical_quantiles"
+	KindCategorical = "categorical"
+	KindIdentifier  = "identifier"
+)
+
+const (
+	// minQuantileValues is the fewest values a numeric column is fitted
+	// with empirical quantiles at; below it a gaussian is fitted
+	minQuantileValues = 20
+	// numericShare is the share of values that must be numbers, or times,
+	// for a column to be fitted as numeric
+	numericShare = 0.9
+	// identifierShare is the distinct share above which a column with at
+	// least minQuantileValues values is taken for an identifier
+	identifierShare = 0.9
+	// maxDecimals caps the decimals numeric values are written with
+	maxDecimals = 6
+	// maxJitterSteps bounds the shrinkage applied to a correlation matrix
+	// that is not positive definite
+	maxJitterSteps = 10
+)
+
+// ErrNoSource is returned when there are no source rows to fit
+var ErrNoSource = errors.New("no source rows to fit")
+
+// timeLayouts are the layouts text columns are read as times with
+var timeLayouts = []string{time.RFC3339Nano, time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", time.DateOnly}
+
+// Category is one value of a categorical column with its share of the
+// column's values
+type Category struct {
+	Value interface{} `json:"value"`
+	Share float64     `json:"share"`
+}
+
+// Column is the fitted marginal of one column. Numeric columns are fitted
+// on numbers, or on Unix seconds when Layout is set; Text columns held
+// their numbers as strings, as CSV sources do.
+type Column struct {
+	Name     string     `json:"name"`
+	Kind     string     `json:"kind"`
+	Numeric  bool       `json:"numeric"`
+	NullRate float64    `json:"null_rate"`
+	Mean     float64    `json:"mean,omitempty"`
+	StdDev   float64    `json:"std_dev,omitempty"`
+	Min      float64    `json:"min,omitempty"`
+	Max      float64    `json:"max,omitempty"`
+	Decimals int        `json:"decimals,omitempty"`
+	Text     bool       `json:"text,omitempty"`
+	Layout   string     `json:"layout,omitempty"`
+	Values   []float64  `json:"-"`
+	Top      []Category `json:"categories,omitempty"`
+
+	// scores are the normal scores of the source values, 0 where null
+	scores []float64
+	// cum are the cumulative shares of Top
+	cum []float64
+}
+
+// Model is a fitted copula over the columns of a source sample
+type Model struct {
+	Columns []Column `json:"columns"`
+	// SourceRows is the size of the sample the model was fitted to
+	SourceRows int `json:"source_rows"`
+	// chol is the Cholesky factor of the correlation matrix of the copula
+	// columns, indexed by copula
+	chol   [][]float64
+	copula []int
+}
+
+// Fit fits a model to source rows; columns are the union of their keys
+func Fit(rows []map[string]interface{}) (*Model, error) {
+	if len(rows) == 0 {
+		return nil, ErrNoSource
+	}
+	names := map[string]bool{}
+	for _, row := range rows {
+		for k := range row {
+			names[k] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	m := &Model{SourceRows: len(rows)}
+	for _, name := range sorted {
+		col := fitColumn(name, rows)
+		if col.Kind != KindIdentifier {
+			m.copula = append(m.copula, len(m.Columns))
+		}
+		m.Columns = append(m.Columns, col)
+	}
+	m.chol = m.fitCopula(len(rows))
+	return m, nil
+}
+
+// isNull treats missing values and blank text as null
+func isNull(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	s, ok := v.(string)
+	return ok && strings.TrimSpace(s) == ""
+}
+
+// number reads a value as a number, and whether it was written as text
+func number(v interface{}) (f float64, text, ok bool) {
+	switch x := v.(type) {
+	case float64:
+		return x, false, !math.IsNaN(x) && !math.IsInf(x, 0)
+	case int:
+		return float64(x), false, true
+	case int64:
+		return float64(x), false, true
+	case json.Number:
+		f, err := x.Float64()
+		return f, false, err == nil
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+		return f, true, err == nil && !math.IsNaN(f) && !math.IsInf(f, 0)
+	}
+	return 0, false, false
+}
+
+// decimals counts the digits after the point of a number written as text
+func decimals(v interface{}) int {
+	s, ok := v.(string)
+	if !ok {
+		f, _, _ := number(v)
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return min(len(strings.TrimSpace(s))-i-1, maxDecimals)
+	}
+	return 0
+}
+
+// timeLayout is the layout every text value parses with, if any
+func timeLayout(vals []interface{}) string {
+layouts:
+	for _, layout := range timeLayouts {
+		for _, v := range vals {
+			s, ok := v.(string)
+			if !ok {
+				continue layouts
+			}
+			if _, err := time.Parse(layout, strings.TrimSpace(s)); err != nil {
+				continue layouts
+			}
+		}
+		return layout
+	}
+	return ""
+}
+
+// categoryKey identifies a category; nested values by their JSON
+func categoryKey(v interface{}) string {
+	switch x := v.(type) {
+	case string:
+		return strings.TrimSpace(x)
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(x)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+func fitColumn(name string, rows []map[string]interface{}) Column {
+	col := Column{Name: name}
+	var vals []interface{}
+	present := make([]bool, len(rows))
+	for i, row := range rows {
+		if v := row[name]; !isNull(v) {
+			vals = append(vals, v)
+			present[i] = true
+		}
+	}
+	col.NullRate = 1 - float64(len(vals))/float64(len(rows))
+	col.scores = make([]float64, len(rows))
+	if len(vals) == 0 {
+		col.Kind = KindCategorical
+		return col
+	}
+
+	// Numbers, or times read as Unix seconds
+	nums := make([]float64, 0, len(vals))
+	texts := 0
+	for _, v := range vals {
+		if f, text, ok := number(v); ok {
+			nums = append(nums, f)
+			if text {
+				texts++
+			}
+			col.Decimals = max(col.Decimals, decimals(v))
+		}
+	}
+	if len(nums) < int(math.Ceil(numericShare*float64(len(vals)))) {
+		nums, col.Decimals = nil, 0
+		if col.Layout = timeLayout(vals); col.Layout != "" {
+			for _, v := range vals {
+				t, _ := time.Parse(col.Layout, strings.TrimSpace(v.(string)))
+				nums = append(nums, float64(t.Unix()))
+			}
+		}
+	}
+	if nums != nil {
+		col.Numeric = true
+		col.Text = texts*2 > len(nums)
+		col.Min, col.Max = nums[0], nums[0]
+		for _, f := range nums {
+			col.Min, col.Max = math.Min(col.Min, f), math.Max(col.Max, f)
+		}
+		distinct := map[float64]bool{}
+		for _, f := range nums {
+			distinct[f] = true
+		}
+		// Distinct whole numbers packed into a range not much wider than
+		// their count are a key, not a measure
+		if col.Decimals == 0 && col.Layout == "" && len(nums) >= minQuantileValues && len(distinct) == len(nums) &&
+			col.Max-col.Min < 2*float64(len(nums)) {
+			col.Kind = KindIdentifier
+			return col
+		}
+		col.Values = append([]float64(nil), nums...)
+		sort.Float64s(col.Values)
+		col.Mean, col.StdDev = meanSD(nums)
+		col.Kind = KindQuantiles
+		if len(nums) < minQuantileValues {
+			col.Kind = KindGaussian
+		}
+		col.setScores(rows, present)
+		return col
+	}
+
+	// Categories, most frequent first
+	counts := map[string]int{}
+	first := map[string]interface{}{}
+	for _, v := range vals {
+		k := categoryKey(v)
+		if _, ok := first[k]; !ok {
+			first[k] = v
+		}
+		counts[k]++
+	}
+	if len(vals) >= minQuantileValues && float64(len(counts)) >= identifierShare*float64(len(vals)) {
+		col.Kind = KindIdentifier
+		return col
+	}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	col.Kind = KindCategorical
+	index := make(map[string]int, len(keys))
+	total := 0.0
+	for i, k := range keys {
+		share := float64(counts[k]) / float64(len(vals))
+		col.Top = append(col.Top, Category{Value: first[k], Share: share})
+		total += share
+		col.cum = append(col.cum, total)
+		index[k] = i
+	}
+	col.cum[len(col.cum)-1] = 1
+	for i, row := range rows {
+		if !present[i] {
+			continue
+		}
+		k := index[categoryKey(row[name])]
+		lo := 0.0
+		if k > 0 {
+			lo = col.cum[k-1]
+		}
+		col.scores[i] = probit((lo + col.cum[k]) / 2)
+	}
+	return col
+}
+
+// setScores gives each present value of a numeric column the normal score
+// of its mid-rank
+func (col *Column) setScores(rows []map[string]interface{}, present []bool) {
+	n := float64(len(col.Values))
+	for i, row := range rows {
+		if !present[i] {
+			continue
+		}
+		f, ok := col.numeric(row[col.Name])
+		if !ok {
+			continue
+		}
+		lo := sort.SearchFloat64s(col.Values, f)
+		hi := sort.Search(len(col.Values), func(j int) bool { return col.Values[j] > f })
+		col.scores[i] = probit((float64(lo+hi)/2 + 0.5) / (n + 1))
+	}
+}
+
+// numeric reads a source value of a numeric column
+func (col *Column) numeric(v interface{}) (float64, bool) {
+	if col.Layout != "" {
+		s, ok := v.(string)
+		if !ok {
+			return 0, false
+		}
+		t, err := time.Parse(col.Layout, strings.TrimSpace(s))
+		return float64(t.Unix()), err == nil
+	}
+	f, _, ok := number(v)
+	return f, ok
+}
+
+// fitCopula returns the Cholesky factor of the correlation matrix of the
+// normal scores, shrunk toward independence until it factors
+func (m *Model) fitCopula(n int) [][]float64 {
+	k := len(m.copula)
+	if k == 0 {
+		return nil
+	}
+	corr := make([][]float64, k)
+	for i := range corr {
+		corr[i] = make([]float64, k)
+		corr[i][i] = 1
+		for j := 0; j < i; j++ {
+			r := pearson(m.Columns[m.copula[i]].scores, m.Columns[m.copula[j]].scores, n)
+			corr[i][j], corr[j][i] = r, r
+		}
+	}
+	for step := 0; step <= maxJitterSteps; step++ {
+		shrink := float64(step) / maxJitterSteps
+		if l, ok := cholesky(corr, shrink); ok {
+			return l
+		}
+	}
+	// Independent columns when nothing factors
+	l, _ := cholesky(corr, 1)
+	return l
+}
+
+func pearson(a, b []float64, n int) float64 {
+	ma, sa := meanSD(a[:n])
+	mb, sb := meanSD(b[:n])
+	if sa == 0 || sb == 0 {
+		return 0
+	}
+	cov := 0.0
+	for i := 0; i < n; i++ {
+		cov += (a[i] - ma) * (b[i] - mb)
+	}
+	return math.Max(-1, math.Min(1, cov/float64(n)/(sa*sb)))
+}
+
+// cholesky factors corr with its off-diagonal scaled by 1-shrink
+func cholesky(corr [][]float64, shrink float64) ([][]float64, bool) {
+	k := len(corr)
+	l := make([][]float64, k)
+	for i := range l {
+		l[i] = make([]float64, k)
+	}
+	for i := 0; i < k; i++ {
+		for j := 0; j <= i; j++ {
+			sum := corr[i][j]
+			if i != j {
+				sum *= 1 - shrink
+			}
+			for p := 0; p < j; p++ {
+				sum -= l[i][p] * l[j][p]
+			}
+			if i == j {
+				if sum <= 1e-10 {
+					return nil, false
+				}
+				l[i][i] = math.Sqrt(sum)
+			} else {
+				l[i][j] = sum / l[j][j]
+			}
+		}
+	}
+	return l, true
+}
+
+func meanSD(xs []float64) (float64, float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	v := 0.0
+	for _, x := range xs {
+		v += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(v / float64(len(xs)))
+}
+
+// probit is the standard normal quantile function
+func probit(p float64) float64 {
+	p = math.Max(1e-9, math.Min(1-1e-9, p))
+	return math.Sqrt2 * math.Erfinv(2*p-1)
+}
+
+// phi is the standard normal distribution function
+func phi(z float64) float64 {
+	return 0.5 * (1 + math.Erf(z/math.Sqrt2))
+}
+
+// Sampler draws rows from a model. Identifiers continue across calls to
+// Rows, so they stay unique over a whole job.
+type Sampler struct {
+	model *Model
+	rng   *rand.Rand
+	next  int64
+}
+
+// NewSampler draws rows seeded with seed
+func NewSampler(m *Model, seed int64) *Sampler {
+	return &Sampler{model: m, rng: rand.New(rand.NewSource(seed))}
+}
+
+// Rows draws n rows
+func (s *Sampler) Rows(n int) []map[string]interface{} {
+	m := s.model
+	out := make([]map[string]interface{}, n)
+	eps := make([]float64, len(m.copula))
+	u := make([]float64, len(m.Columns))
+	for r := range out {
+		for i := range eps {
+			eps[i] = s.rng.NormFloat64()
+		}
+		for i, c := range m.copula {
+			z := 0.0
+			for j := 0; j <= i; j++ {
+				z += m.chol[i][j] * eps[j]
+			}
+			u[c] = phi(z)
+		}
+		s.next++
+		row := make(map[string]interface{}, len(m.Columns))
+		for c := range m.Columns {
+			col := &m.Columns[c]
+			if col.NullRate > 0 && s.rng.Float64() < col.NullRate {
+				row[col.Name] = nil
+				continue
+			}
+			row[col.Name] = col.value(u[c], s.next)
+		}
+		out[r] = row
+	}
+	return out
+}
+
+// value is the column's value at quantile u, or its seq-th identifier
+func (col *Column) value(u float64, seq int64) interface{} {
+	switch col.Kind {
+	case KindIdentifier:
+		// Numeric identifiers count up from the smallest source value;
+		// text ones are named after the column
+		if col.Numeric {
+			return col.format(col.Min + float64(seq-1))
+		}
+		return fmt.Sprintf("%s-%06d", col.Name, seq)
+	case KindCategorical:
+		if len(col.Top) == 0 {
+			return nil
+		}
+		k := sort.SearchFloat64s(col.cum, u)
+		if k >= len(col.Top) {
+			k = len(col.Top) - 1
+		}
+		return col.Top[k].Value
+	case KindGaussian:
+		x := col.Mean + col.StdDev*probit(u)
+		return col.format(math.Max(col.Min, math.Min(col.Max, x)))
+	default:
+		pos := u * float64(len(col.Values)-1)
+		lo := int(math.Floor(pos))
+		hi := min(lo+1, len(col.Values)-1)
+		return col.format(col.Values[lo] + (pos-float64(lo))*(col.Values[hi]-col.Values[lo]))
+	}
+}
+
+// format writes a numeric value the way the source wrote the column
+func (col *Column) format(x float64) interface{} {
+	if col.Layout != "" {
+		return time.Unix(int64(math.Round(x)), 0).UTC().Format(col.Layout)
+	}
+	scale := math.Pow(10, float64(col.Decimals))
+	x = math.Round(x*scale) / scale
+	if col.Text {
+		return strconv.FormatFloat(x, 'f', col.Decimals, 64)
+	}
+	return x
+}
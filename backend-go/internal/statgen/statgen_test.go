@@ -0,0 +1,136 @@
+// Package statgen_test provides unit tests for statistical generation
+package statgen_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/statgen"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// source has an id, a height and a correlated weight written as CSV text,
+// a plan category, a signup date and a sometimes missing score
+func source(n int) []map[string]interface{} {
+	rng := rand.New(rand.NewSource(1))
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	rows := make([]map[string]interface{}, n)
+	for i := range rows {
+		height := 170 + 10*rng.NormFloat64()
+		plan := "free"
+		if rng.Float64() < 0.25 {
+			plan = "pro"
+		}
+		var score interface{}
+		if rng.Float64() >= 0.2 {
+			score = float64(rng.Intn(5) + 1)
+		}
+		rows[i] = map[string]interface{}{
+			"id":     float64(1000 + i),
+			"height": math.Round(height*10) / 10,
+			"weight": strconv.FormatFloat(height-100+3*rng.NormFloat64(), 'f', 1, 64),
+			"plan":   plan,
+			"signup": day.AddDate(0, 0, rng.Intn(365)).Format(time.DateOnly),
+			"score":  score,
+		}
+	}
+	return rows
+}
+
+func column(t *testing.T, m *statgen.Model, name string) statgen.Column {
+	for _, col := range m.Columns {
+		if col.Name == name {
+			return col
+		}
+	}
+	t.Fatalf("no column %s", name)
+	return statgen.Column{}
+}
+
+func TestFitMarginals(t *testing.T) {
+	m, err := statgen.Fit(source(400))
+	require.NoError(t, err)
+	assert.Equal(t, 400, m.SourceRows)
+	assert.Equal(t, statgen.KindIdentifier, column(t, m, "id").Kind)
+	assert.Equal(t, statgen.KindQuantiles, column(t, m, "height").Kind)
+	weight := column(t, m, "weight")
+	assert.True(t, weight.Text)
+	assert.Equal(t, 1, weight.Decimals)
+	assert.Equal(t, statgen.KindCategorical, column(t, m, "plan").Kind)
+	assert.Equal(t, time.DateOnly, column(t, m, "signup").Layout)
+	assert.InDelta(t, 0.2, column(t, m, "score").NullRate, 0.06)
+
+	small, err := statgen.Fit(source(10))
+	require.NoError(t, err)
+	assert.Equal(t, statgen.KindGaussian, column(t, small, "height").Kind)
+	assert.NotEqual(t, statgen.KindIdentifier, column(t, small, "id").Kind, "too few rows to call a key")
+
+	_, err = statgen.Fit(nil)
+	assert.ErrorIs(t, err, statgen.ErrNoSource)
+}
+
+func TestSampleKeepsDistributionsAndCorrelation(t *testing.T) {
+	m, err := statgen.Fit(source(400))
+	require.NoError(t, err)
+	s := statgen.NewSampler(m, 7)
+	rows := append(s.Rows(1000), s.Rows(1000)...)
+
+	ids := map[interface{}]bool{}
+	var heights, weights []float64
+	pro, nulls := 0, 0
+	for _, row := range rows {
+		ids[row["id"]] = true
+		h := row["height"].(float64)
+		w, err := strconv.ParseFloat(row["weight"].(string), 64)
+		require.NoError(t, err)
+		heights, weights = append(heights, h), append(weights, w)
+		if row["plan"] == "pro" {
+			pro++
+		}
+		if row["score"] == nil {
+			nulls++
+		}
+		_, err = time.Parse(time.DateOnly, row["signup"].(string))
+		require.NoError(t, err)
+	}
+	assert.Len(t, ids, len(rows), "identifiers stay unique across batches")
+	assert.Equal(t, float64(1000), rows[0]["id"])
+
+	mean := 0.0
+	for _, h := range heights {
+		mean += h
+	}
+	mean /= float64(len(heights))
+	assert.InDelta(t, 170, mean, 1.5)
+	assert.InDelta(t, 0.25, float64(pro)/float64(len(rows)), 0.05)
+	assert.InDelta(t, 0.2, float64(nulls)/float64(len(rows)), 0.05)
+	assert.Greater(t, correlation(heights, weights), 0.8, "the copula keeps the height-weight dependence")
+}
+
+func TestSamplerIsSeeded(t *testing.T) {
+	m, err := statgen.Fit(source(50))
+	require.NoError(t, err)
+	a := statgen.NewSampler(m, 3).Rows(5)
+	b := statgen.NewSampler(m, 3).Rows(5)
+	assert.Equal(t, fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func correlation(a, b []float64) float64 {
+	n := float64(len(a))
+	var ma, mb float64
+	for i := range a {
+		ma, mb = ma+a[i]/n, mb+b[i]/n
+	}
+	var cov, va, vb float64
+	for i := range a {
+		cov += (a[i] - ma) * (b[i] - mb)
+		va += (a[i] - ma) * (a[i] - ma)
+		vb += (b[i] - mb) * (b[i] - mb)
+	}
+	return cov / math.Sqrt(va*vb)
+}
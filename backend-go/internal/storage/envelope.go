@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// OutputCipher names the cipher used for job outputs and data keys
+const OutputCipher = "AES-256-GCM"
+
+var ErrUnknownMasterKey = errors.New("unknown master key")
+
+// Envelope encrypts objects with per-object data keys and wraps those keys
+// under rotating master keys. Only wrapped keys are stored; retiring a master
+// key makes every data key wrapped with it unrecoverable.
+type Envelope struct {
+	activeKeyID string
+	keys        map[string][]byte
+}
+
+// NewEnvelope creates an envelope from a key set as returned by
+// ParseSigningKeys; activeKeyID wraps new data keys
+func NewEnvelope(activeKeyID string, keys map[string][]byte) (*Envelope, error) {
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active master key %q not found", activeKeyID)
+	}
+	derived := make(map[string][]byte, len(keys))
+	for kid, k := range keys {
+		if len(k) < 32 {
+			return nil, fmt.Errorf("master key %q must be at least 32 bytes", kid)
+		}
+		sum := sha256.Sum256(k)
+		derived[kid] = sum[:]
+	}
+	return &Envelope{activeKeyID: activeKeyID, keys: derived}, nil
+}
+
+// NewDataKey generates a fresh 256-bit data key and returns it in the clear
+// together with its wrapped form and the master key that wrapped it
+func (e *Envelope) NewDataKey() (plain []byte, wrapped, keyID string, err error) {
+	plain = make([]byte, 32)
+	if _, err := rand.Read(plain); err != nil {
+		return nil, "", "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	sealed, err := Seal(e.keys[e.activeKeyID], plain)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return plain, base64.StdEncoding.EncodeToString(sealed), e.activeKeyID, nil
+}
+
+// Unwrap recovers a data key wrapped by NewDataKey
+func (e *Envelope) Unwrap(keyID, wrapped string) ([]byte, error) {
+	master, ok := e.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMasterKey, keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key: %w", err)
+	}
+	return Open(master, sealed)
+}
+
+// Seal encrypts plaintext with a 256-bit key; the random nonce is prepended
+// to the ciphertext
+func Seal(key, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Open decrypts the output of Seal
+func Open(key, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, errors.New("key must be 32 bytes")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,61 @@
+// Package storage_test provides unit tests for job output envelope encryption
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvelope(t *testing.T) {
+	keys := map[string][]byte{"a": []byte(testKeyA), "b": []byte(testKeyB)}
+	env, err := storage.NewEnvelope("a", keys)
+	require.NoError(t, err)
+
+	t.Run("data keys round trip and encrypt outputs", func(t *testing.T) {
+		plain, wrapped, kid, err := env.NewDataKey()
+		require.NoError(t, err)
+		assert.Equal(t, "a", kid)
+		assert.Len(t, plain, 32)
+
+		sealed, err := storage.Seal(plain, []byte("id,amount\n1,10\n"))
+		require.NoError(t, err)
+		unwrapped, err := env.Unwrap(kid, wrapped)
+		require.NoError(t, err)
+		out, err := storage.Open(unwrapped, sealed)
+		require.NoError(t, err)
+		assert.Equal(t, "id,amount\n1,10\n", string(out))
+	})
+
+	t.Run("every job gets its own key", func(t *testing.T) {
+		k1, _, _, err := env.NewDataKey()
+		require.NoError(t, err)
+		k2, _, _, err := env.NewDataKey()
+		require.NoError(t, err)
+		assert.NotEqual(t, k1, k2)
+	})
+
+	t.Run("retired master keys cannot unwrap", func(t *testing.T) {
+		_, wrapped, _, err := env.NewDataKey()
+		require.NoError(t, err)
+		rotated, err := storage.NewEnvelope("b", map[string][]byte{"b": []byte(testKeyB)})
+		require.NoError(t, err)
+		_, err = rotated.Unwrap("a", wrapped)
+		assert.ErrorIs(t, err, storage.ErrUnknownMasterKey)
+	})
+
+	t.Run("tampered ciphertext is rejected", func(t *testing.T) {
+		key, _, _, err := env.NewDataKey()
+		require.NoError(t, err)
+		sealed, err := storage.Seal(key, []byte("secret"))
+		require.NoError(t, err)
+		sealed[len(sealed)-1] ^= 0xff
+		_, err = storage.Open(key, sealed)
+		assert.Error(t, err)
+	})
+
+	_, err = storage.NewEnvelope("a", map[string][]byte{"a": []byte("short")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	cloudkms "google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// KMS wraps data keys under a key that never leaves a cloud key management
+// service. Unlike Envelope, every wrap and unwrap is a call to the service,
+// so it suits small secrets read rarely, such as connection credentials.
+type KMS interface {
+	// NewDataKey returns a fresh 256-bit data key in the clear together
+	// with its wrapped form and the key that wrapped it
+	NewDataKey(ctx context.Context) (plain []byte, wrapped, keyID string, err error)
+	// Unwrap recovers a data key wrapped by NewDataKey
+	Unwrap(ctx context.Context, keyID, wrapped string) ([]byte, error)
+}
+
+// Key references accepted by NewKMS
+const (
+	GCPKMSScheme = "gcp-kms://"
+	AWSKMSScheme = "aws-kms://"
+)
+
+// NewKMS returns the KMS a key reference names:
+// gcp-kms://projects/p/locations/l/keyRings/r/cryptoKeys/k or
+// aws-kms://<key ID, alias or ARN>. Requests go through rt when it is set.
+func NewKMS(ctx context.Context, ref string, rt http.RoundTripper) (KMS, error) {
+	switch {
+	case strings.HasPrefix(ref, GCPKMSScheme):
+		var opts []option.ClientOption
+		if rt != nil {
+			authed, err := htransport.NewTransport(ctx, rt, option.WithScopes(cloudkms.CloudkmsScope))
+			if err != nil {
+				return nil, fmt.Errorf("failed to load Google credentials: %w", err)
+			}
+			opts = append(opts, option.WithHTTPClient(&http.Client{Transport: authed, Timeout: 10 * time.Second}))
+		}
+		return NewGCPKMS(ctx, strings.TrimPrefix(ref, GCPKMSScheme), opts...)
+	case strings.HasPrefix(ref, AWSKMSScheme):
+		keyID := strings.TrimPrefix(ref, AWSKMSScheme)
+		opts := []func(*awsconfig.LoadOptions) error{}
+		// arn:aws:kms:<region>:<account>:key/<id>
+		if parts := strings.SplitN(keyID, ":", 6); len(parts) == 6 && parts[0] == "arn" {
+			opts = append(opts, awsconfig.WithRegion(parts[3]))
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS credentials: %w", err)
+		}
+		return &AWSKMS{KeyID: keyID, Region: cfg.Region, Credentials: cfg.Credentials, Client: &http.Client{Transport: rt, Timeout: 10 * time.Second}}, nil
+	}
+	return nil, fmt.Errorf("unknown KMS key reference %q", ref)
+}
+
+// ValidKMSRef reports whether ref names a key NewKMS can use
+func ValidKMSRef(ref string) bool {
+	switch {
+	case strings.HasPrefix(ref, GCPKMSScheme):
+		parts := strings.Split(strings.TrimPrefix(ref, GCPKMSScheme), "/")
+		return len(parts) == 8 && parts[0] == "projects" && parts[2] == "locations" && parts[4] == "keyRings" && parts[6] == "cryptoKeys"
+	case strings.HasPrefix(ref, AWSKMSScheme):
+		return len(ref) > len(AWSKMSScheme)
+	}
+	return false
+}
+
+// newDataKey generates a 256-bit data key
+func newDataKey() ([]byte, error) {
+	plain := make([]byte, 32)
+	if _, err := rand.Read(plain); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	return plain, nil
+}
+
+// GCPKMS wraps data keys with a Cloud KMS symmetric key
+type GCPKMS struct {
+	keys *cloudkms.ProjectsLocationsKeyRingsCryptoKeysService
+	key  string
+}
+
+// NewGCPKMS creates a KMS for the crypto key called name, authenticated
+// with the application default credentials unless opts say otherwise
+func NewGCPKMS(ctx context.Context, name string, opts ...option.ClientOption) (*GCPKMS, error) {
+	opts = append([]option.ClientOption{option.WithScopes(cloudkms.CloudkmsScope)}, opts...)
+	svc, err := cloudkms.NewService(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Cloud KMS client: %w", err)
+	}
+	return &GCPKMS{keys: svc.Projects.Locations.KeyRings.CryptoKeys, key: name}, nil
+}
+
+func (g *GCPKMS) NewDataKey(ctx context.Context) ([]byte, string, string, error) {
+	plain, err := newDataKey()
+	if err != nil {
+		return nil, "", "", err
+	}
+	resp, err := g.keys.Encrypt(g.key, &cloudkms.EncryptRequest{Plaintext: base64.StdEncoding.EncodeToString(plain)}).Context(ctx).Do()
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	// Decryption picks the key version from the ciphertext, so the key
+	// itself is recorded rather than the version
+	return plain, resp.Ciphertext, g.key, nil
+}
+
+func (g *GCPKMS) Unwrap(ctx context.Context, keyID, wrapped string) ([]byte, error) {
+	resp, err := g.keys.Decrypt(keyID, &cloudkms.DecryptRequest{Ciphertext: wrapped}).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return base64.StdEncoding.DecodeString(resp.Plaintext)
+}
+
+// AWSKMS wraps data keys with an AWS KMS key through its JSON API
+type AWSKMS struct {
+	KeyID       string
+	Region      string
+	Credentials aws.CredentialsProvider
+	Client      *http.Client
+	// Endpoint overrides https://kms.<region>.amazonaws.com
+	Endpoint string
+}
+
+func (a *AWSKMS) NewDataKey(ctx context.Context) ([]byte, string, string, error) {
+	var out struct {
+		CiphertextBlob []byte `json:"CiphertextBlob"`
+		Plaintext      []byte `json:"Plaintext"`
+		KeyID          string `json:"KeyId"`
+	}
+	if err := a.call(ctx, "GenerateDataKey", map[string]any{"KeyId": a.KeyID, "KeySpec": "AES_256"}, &out); err != nil {
+		return nil, "", "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+	if len(out.Plaintext) != 32 {
+		return nil, "", "", errors.New("kms returned a data key of the wrong size")
+	}
+	return out.Plaintext, base64.StdEncoding.EncodeToString(out.CiphertextBlob), out.KeyID, nil
+}
+
+func (a *AWSKMS) Unwrap(ctx context.Context, keyID, wrapped string) ([]byte, error) {
+	blob, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key: %w", err)
+	}
+	var out struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	if err := a.call(ctx, "Decrypt", map[string]any{"KeyId": keyID, "CiphertextBlob": blob}, &out); err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return out.Plaintext, nil
+}
+
+// call sends one signed request to the KMS JSON API
+func (a *AWSKMS) call(ctx context.Context, action string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com/", a.Region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	creds, err := a.Credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	hash := sha256.Sum256(body)
+	if err := v4.NewSigner().SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "kms", a.Region, time.Now()); err != nil {
+		return err
+	}
+	client := a.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(raw, &e)
+		return fmt.Errorf("kms: %s (status %d): %s", e.Type, resp.StatusCode, e.Message)
+	}
+	return json.Unmarshal(raw, out)
+}
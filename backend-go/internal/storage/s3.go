@@ -2,32 +2,102 @@ package storage
 
 import (
 	"context"
+	"io"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 )
 
+// S3Provider stores objects in an S3 bucket. Objects larger than PartSize
+// are sent as multipart uploads, which are aborted on failure; Encryption
+// selects SSE-S3 or SSE-KMS.
 type S3Provider struct {
 	bucket    string
+	client    *s3.Client
 	presigner *s3.PresignClient
+	uploader  *manager.Uploader
+	opts      ProviderOptions
 }
 
-func NewS3Provider(ctx context.Context, bucket string, region string) (*S3Provider, error) {
+func NewS3Provider(ctx context.Context, bucket string, region string, opts ProviderOptions) (*S3Provider, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
 	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
 	if err != nil {
 		return nil, err
 	}
+	return newS3Provider(bucket, cfg, opts), nil
+}
+
+// NewS3ProviderAssumingRole stores objects in a bucket of another AWS
+// account through a role that account lets the platform assume. The
+// external ID guards the role against being assumed on behalf of anyone
+// else; credentials are refreshed before they expire.
+func NewS3ProviderAssumingRole(ctx context.Context, bucket, region, roleARN, externalID string, opts ProviderOptions) (*S3Provider, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Credentials = aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.ExternalID = aws.String(externalID)
+		o.RoleSessionName = "synthos-output-delivery"
+	}))
+	return newS3Provider(bucket, cfg, opts), nil
+}
+
+func newS3Provider(bucket string, cfg aws.Config, opts ProviderOptions) *S3Provider {
 	client := s3.NewFromConfig(cfg)
 	pres := s3.NewPresignClient(client)
-	return &S3Provider{bucket: bucket, presigner: pres}, nil
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		u.PartSize = opts.PartSize
+		if opts.Concurrency > 0 {
+			u.Concurrency = opts.Concurrency
+		}
+	})
+	return &S3Provider{bucket: bucket, client: client, presigner: pres, uploader: uploader, opts: opts}
 }
 
 func (p *S3Provider) GetSignedURL(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	ttl = p.opts.URLTTL(ttl)
 	req, err := p.presigner.PresignGetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(p.bucket), Key: aws.String(key)}, func(opts *s3.PresignOptions) { opts.Expires = ttl })
 	if err != nil {
 		return "", err
 	}
 	return req.URL, nil
 }
+
+func (p *S3Provider) OpenObject(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := p.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(p.bucket), Key: aws.String(key)})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (p *S3Provider) PutObject(ctx context.Context, key string, data io.Reader, contentType string) error {
+	in := &s3.PutObjectInput{Bucket: aws.String(p.bucket), Key: aws.String(key), Body: data, ContentType: aws.String(contentType)}
+	switch p.opts.Encryption {
+	case EncryptionManaged:
+		in.ServerSideEncryption = types.ServerSideEncryptionAes256
+	case EncryptionKMS:
+		in.ServerSideEncryption = types.ServerSideEncryptionAwsKms
+		in.SSEKMSKeyId = aws.String(p.opts.KMSKeyID)
+	}
+	_, err := p.uploader.Upload(ctx, in)
+	return err
+}
+
+func (p *S3Provider) DeleteObject(ctx context.Context, key string) error {
+	_, err := p.client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(p.bucket), Key: aws.String(key)})
+	return err
+}
@@ -2,9 +2,112 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"time"
 )
 
 type SignedURLProvider interface {
 	GetSignedURL(ctx context.Context, key string, ttl time.Duration) (string, error)
 }
+
+// ObjectReader streams stored objects; used when a download has to be
+// filtered by the API instead of served from a signed URL
+type ObjectReader interface {
+	OpenObject(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// ObjectWriter stores objects; used by workers to write job outputs and by
+// dataset uploads. Large objects are uploaded in parts.
+type ObjectWriter interface {
+	PutObject(ctx context.Context, key string, data io.Reader, contentType string) error
+}
+
+// ObjectDeleter removes stored objects
+type ObjectDeleter interface {
+	DeleteObject(ctx context.Context, key string) error
+}
+
+// Server-side encryption modes for objects written by the providers. Both
+// providers encrypt at rest with provider-managed keys by default;
+// EncryptionKMS uses a customer-managed key instead.
+const (
+	EncryptionDefault = ""
+	EncryptionManaged = "managed"
+	EncryptionKMS     = "kms"
+)
+
+const (
+	// MaxSignedURLTTL is the longest lifetime either provider accepts for a
+	// signed URL
+	MaxSignedURLTTL = 7 * 24 * time.Hour
+	// DefaultSignedURLTTL applies when neither the caller nor the provider
+	// options set a lifetime
+	DefaultSignedURLTTL = time.Hour
+	// DefaultPartSize is the part size of multipart and resumable uploads
+	DefaultPartSize = 16 << 20
+	// MinPartSize is the smallest part S3 accepts in a multipart upload
+	MinPartSize = 5 << 20
+	// gcsChunkAlign is the granularity of GCS resumable upload chunks
+	gcsChunkAlign = 256 << 10
+)
+
+// ProviderOptions configures the GCS and S3 providers
+type ProviderOptions struct {
+	// SignedURLTTL applies when GetSignedURL is called without a ttl
+	SignedURLTTL time.Duration
+	// Encryption selects server-side encryption; KMSKeyID is the KMS key
+	// name (GCS) or key ID/ARN (S3) used with EncryptionKMS
+	Encryption string
+	KMSKeyID   string
+	// Objects larger than PartSize are uploaded in parts; Concurrency is
+	// the number of parts uploaded at once (S3 only)
+	PartSize    int64
+	Concurrency int
+	// SignAs is the service account GCS URLs are signed as; when empty it
+	// is taken from the client credentials
+	SignAs string
+}
+
+// Validate checks the encryption settings and fills in defaults
+func (o *ProviderOptions) Validate() error {
+	switch o.Encryption {
+	case EncryptionDefault, EncryptionManaged:
+	case EncryptionKMS:
+		if o.KMSKeyID == "" {
+			return fmt.Errorf("a KMS key is required for %q encryption", EncryptionKMS)
+		}
+	default:
+		return fmt.Errorf("unsupported encryption mode %q", o.Encryption)
+	}
+	if o.PartSize <= 0 {
+		o.PartSize = DefaultPartSize
+	}
+	if o.PartSize < MinPartSize {
+		return fmt.Errorf("part size must be at least %d bytes", MinPartSize)
+	}
+	if o.SignedURLTTL <= 0 {
+		o.SignedURLTTL = DefaultSignedURLTTL
+	}
+	return nil
+}
+
+// URLTTL resolves the lifetime of a signed URL: ttl if set, the configured
+// default otherwise, never above MaxSignedURLTTL
+func (o ProviderOptions) URLTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = o.SignedURLTTL
+	}
+	if ttl <= 0 {
+		ttl = DefaultSignedURLTTL
+	}
+	if ttl > MaxSignedURLTTL {
+		ttl = MaxSignedURLTTL
+	}
+	return ttl
+}
+
+// gcsChunkSize rounds the part size up to a multiple of the GCS chunk size
+func (o ProviderOptions) gcsChunkSize() int {
+	return int((o.PartSize + gcsChunkAlign - 1) / gcsChunkAlign * gcsChunkAlign)
+}
@@ -0,0 +1,37 @@
+// Package storage_test provides unit tests for storage provider options
+package storage_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderOptionsValidate(t *testing.T) {
+	opts := storage.ProviderOptions{}
+	require.NoError(t, opts.Validate())
+	assert.Equal(t, int64(storage.DefaultPartSize), opts.PartSize)
+	assert.Equal(t, storage.DefaultSignedURLTTL, opts.SignedURLTTL)
+
+	opts = storage.ProviderOptions{Encryption: storage.EncryptionKMS}
+	assert.Error(t, opts.Validate(), "kms needs a key")
+	opts.KMSKeyID = "projects/p/locations/l/keyRings/r/cryptoKeys/k"
+	assert.NoError(t, opts.Validate())
+
+	opts = storage.ProviderOptions{Encryption: "rot13"}
+	assert.Error(t, opts.Validate())
+
+	opts = storage.ProviderOptions{PartSize: 1 << 20}
+	assert.Error(t, opts.Validate(), "parts below the S3 minimum")
+}
+
+func TestProviderOptionsURLTTL(t *testing.T) {
+	opts := storage.ProviderOptions{SignedURLTTL: 10 * time.Minute}
+	assert.Equal(t, 10*time.Minute, opts.URLTTL(0))
+	assert.Equal(t, time.Minute, opts.URLTTL(time.Minute))
+	assert.Equal(t, storage.MaxSignedURLTTL, opts.URLTTL(30*24*time.Hour))
+	assert.Equal(t, storage.DefaultSignedURLTTL, storage.ProviderOptions{}.URLTTL(0))
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MaxDownloadTTL caps the lifetime of a download ticket
+const MaxDownloadTTL = 15 * time.Minute
+
+var (
+	ErrInvalidDownloadToken = errors.New("invalid download token")
+	ErrDownloadTokenExpired = errors.New("download token expired")
+	ErrDownloadTokenRevoked = errors.New("download token revoked")
+	ErrDownloadIPMismatch   = errors.New("download token bound to another IP")
+)
+
+// DownloadClaims scope a download ticket to a single object. Tickets are
+// redeemed through the API, which re-checks expiry, IP binding and revocation
+// before handing out a provider URL that lives only long enough for a redirect.
+type DownloadClaims struct {
+	ID        string    `json:"jti"`
+	KeyID     string    `json:"kid"`
+	DatasetID int64     `json:"ds"`
+	UserID    int64     `json:"sub"`
+	ObjectKey string    `json:"obj"`
+	Filename  string    `json:"fn,omitempty"`
+	IPAddress string    `json:"ip,omitempty"`
+	IssuedAt  time.Time `json:"iat"`
+	ExpiresAt time.Time `json:"exp"`
+}
+
+// URLSigner signs download tickets with rotating HMAC keys. Dropping a key
+// from the key set invalidates every ticket signed with it.
+type URLSigner struct {
+	activeKeyID string
+	keys        map[string][]byte
+}
+
+// NewURLSigner creates a signer; activeKeyID must be present in keys
+func NewURLSigner(activeKeyID string, keys map[string][]byte) (*URLSigner, error) {
+	if _, ok := keys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active signing key %q not found", activeKeyID)
+	}
+	for kid, k := range keys {
+		if len(k) < 32 {
+			return nil, fmt.Errorf("signing key %q must be at least 32 bytes", kid)
+		}
+	}
+	return &URLSigner{activeKeyID: activeKeyID, keys: keys}, nil
+}
+
+// ParseSigningKeys parses "kid:secret,kid2:secret2" into a key set
+func ParseSigningKeys(spec string) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		kid, secret, ok := strings.Cut(part, ":")
+		if !ok || kid == "" || secret == "" {
+			return nil, fmt.Errorf("invalid signing key entry %q", part)
+		}
+		keys[kid] = []byte(secret)
+	}
+	return keys, nil
+}
+
+// Sign issues a ticket for the claims, filling in ID, key and issue time
+func (s *URLSigner) Sign(claims DownloadClaims) (string, *DownloadClaims, error) {
+	if claims.ObjectKey == "" {
+		return "", nil, fmt.Errorf("object key is required")
+	}
+	if claims.ExpiresAt.IsZero() || time.Until(claims.ExpiresAt) > MaxDownloadTTL {
+		claims.ExpiresAt = time.Now().Add(MaxDownloadTTL)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token id: %w", err)
+	}
+	claims.ID = hex.EncodeToString(id)
+	claims.KeyID = s.activeKeyID
+	claims.IssuedAt = time.Now()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to encode download claims: %w", err)
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + s.mac(s.keys[s.activeKeyID], body), &claims, nil
+}
+
+// Verify checks the signature and expiry of a ticket and its IP binding
+func (s *URLSigner) Verify(token, clientIP string) (*DownloadClaims, error) {
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidDownloadToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, ErrInvalidDownloadToken
+	}
+	var claims DownloadClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidDownloadToken
+	}
+	key, ok := s.keys[claims.KeyID]
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.mac(key, body))) {
+		return nil, ErrInvalidDownloadToken
+	}
+	if time.Now().After(claims.ExpiresAt) {
+		return nil, ErrDownloadTokenExpired
+	}
+	if claims.IPAddress != "" && claims.IPAddress != clientIP {
+		return nil, ErrDownloadIPMismatch
+	}
+	return &claims, nil
+}
+
+func (s *URLSigner) mac(key []byte, body string) string {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(body))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// URLRevocations is a Redis deny-list for leaked download tickets
+type URLRevocations struct {
+	redisClient *redis.Client
+}
+
+// NewURLRevocations creates a deny-list backed by Redis
+func NewURLRevocations(redisClient *redis.Client) *URLRevocations {
+	return &URLRevocations{redisClient: redisClient}
+}
+
+// Revoke denies a single ticket until it would have expired anyway
+func (r *URLRevocations) Revoke(ctx context.Context, tokenID string) error {
+	return r.redisClient.Set(ctx, "revoked_download:"+tokenID, "1", MaxDownloadTTL).Err()
+}
+
+// RevokeDataset denies every ticket for a dataset issued before now
+func (r *URLRevocations) RevokeDataset(ctx context.Context, datasetID int64) error {
+	key := fmt.Sprintf("revoked_downloads_before:dataset:%d", datasetID)
+	return r.redisClient.Set(ctx, key, time.Now().UnixNano(), MaxDownloadTTL).Err()
+}
+
+// Check returns ErrDownloadTokenRevoked if the ticket has been revoked
+func (r *URLRevocations) Check(ctx context.Context, claims *DownloadClaims) error {
+	pipe := r.redisClient.Pipeline()
+	single := pipe.Exists(ctx, "revoked_download:"+claims.ID)
+	before := pipe.Get(ctx, fmt.Sprintf("revoked_downloads_before:dataset:%d", claims.DatasetID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to check download revocation: %w", err)
+	}
+	if single.Val() > 0 {
+		return ErrDownloadTokenRevoked
+	}
+	if v, err := strconv.ParseInt(before.Val(), 10, 64); err == nil && claims.IssuedAt.UnixNano() <= v {
+		return ErrDownloadTokenRevoked
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Package storage_test provides unit tests for download ticket signing
+package storage_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testKeyA = "0123456789abcdef0123456789abcdef"
+	testKeyB = "fedcba9876543210fedcba9876543210"
+)
+
+func TestURLSigner(t *testing.T) {
+	signer, err := storage.NewURLSigner("a", map[string][]byte{"a": []byte(testKeyA)})
+	require.NoError(t, err)
+
+	t.Run("round trip", func(t *testing.T) {
+		token, issued, err := signer.Sign(storage.DownloadClaims{DatasetID: 7, UserID: 1, ObjectKey: "datasets/7.csv", ExpiresAt: time.Now().Add(time.Minute)})
+		require.NoError(t, err)
+
+		claims, err := signer.Verify(token, "198.51.100.1")
+		require.NoError(t, err)
+		assert.Equal(t, issued.ID, claims.ID)
+		assert.Equal(t, "datasets/7.csv", claims.ObjectKey)
+		assert.Equal(t, "a", claims.KeyID)
+	})
+
+	t.Run("ttl is capped", func(t *testing.T) {
+		_, issued, err := signer.Sign(storage.DownloadClaims{ObjectKey: "k", ExpiresAt: time.Now().Add(24 * time.Hour)})
+		require.NoError(t, err)
+		assert.LessOrEqual(t, time.Until(issued.ExpiresAt), storage.MaxDownloadTTL)
+	})
+
+	t.Run("tampered token rejected", func(t *testing.T) {
+		token, _, err := signer.Sign(storage.DownloadClaims{ObjectKey: "k"})
+		require.NoError(t, err)
+		_, err = signer.Verify(strings.Replace(token, ".", "x.", 1), "")
+		assert.ErrorIs(t, err, storage.ErrInvalidDownloadToken)
+	})
+
+	t.Run("expired token rejected", func(t *testing.T) {
+		token, _, err := signer.Sign(storage.DownloadClaims{ObjectKey: "k", ExpiresAt: time.Now().Add(-time.Second)})
+		require.NoError(t, err)
+		_, err = signer.Verify(token, "")
+		assert.ErrorIs(t, err, storage.ErrDownloadTokenExpired)
+	})
+
+	t.Run("ip binding enforced", func(t *testing.T) {
+		token, _, err := signer.Sign(storage.DownloadClaims{ObjectKey: "k", IPAddress: "198.51.100.1", ExpiresAt: time.Now().Add(time.Minute)})
+		require.NoError(t, err)
+		_, err = signer.Verify(token, "203.0.113.9")
+		assert.ErrorIs(t, err, storage.ErrDownloadIPMismatch)
+	})
+
+	t.Run("rotating out a key revokes its tokens", func(t *testing.T) {
+		token, _, err := signer.Sign(storage.DownloadClaims{ObjectKey: "k", ExpiresAt: time.Now().Add(time.Minute)})
+		require.NoError(t, err)
+
+		rotated, err := storage.NewURLSigner("b", map[string][]byte{"b": []byte(testKeyB)})
+		require.NoError(t, err)
+		_, err = rotated.Verify(token, "")
+		assert.ErrorIs(t, err, storage.ErrInvalidDownloadToken)
+	})
+}
@@ -0,0 +1,403 @@
+// Package structure reproduces how rows of a dataset depend on one another
+// instead of generating them independently: exact duplicates at a set rate,
+// and rows grouped under a shared key with realistic group sizes, as
+// households or orders per customer. Both are profiled from the source and
+// can be overridden per job.
+package structure
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+const (
+	// MaxDuplicateRate caps the share of rows that may be duplicates
+	MaxDuplicateRate = 0.5
+	// MaxGroupSize caps the group sizes a job may ask for
+	MaxGroupSize = 1000
+	// promptSizes caps the group sizes named in a prompt
+	promptSizes = 10
+)
+
+var (
+	ErrInvalidDuplicateRate = errors.New("duplicate_rate is out of range")
+	ErrInvalidGroupSizes    = errors.New("group_sizes must map sizes from 1 to 1000 to non-negative shares")
+	ErrGroupSizesWithoutKey = errors.New("group_sizes requires group_by")
+	ErrUnknownColumn        = errors.New("column not found")
+)
+
+// Options selects the structure of a job's rows. Unset values take the
+// source's.
+type Options struct {
+	// DuplicateRate is the share of rows that repeat an earlier row
+	DuplicateRate *float64 `json:"duplicate_rate,omitempty"`
+	// IgnoreColumns are left out when rows are compared, such as record
+	// identifiers that differ between duplicates
+	IgnoreColumns []string `json:"ignore_columns,omitempty"`
+	// GroupBy is the column whose value rows of one group share
+	GroupBy string `json:"group_by,omitempty"`
+	// GroupSizes maps a group size to its share of groups; shares are
+	// normalized
+	GroupSizes map[int]float64 `json:"group_sizes,omitempty"`
+}
+
+// Validate checks the bounds of the options
+func (o Options) Validate() error {
+	if o.DuplicateRate != nil && (*o.DuplicateRate < 0 || *o.DuplicateRate > MaxDuplicateRate) {
+		return fmt.Errorf("%w: between 0 and %v", ErrInvalidDuplicateRate, MaxDuplicateRate)
+	}
+	if len(o.GroupSizes) == 0 {
+		return nil
+	}
+	if strings.TrimSpace(o.GroupBy) == "" {
+		return ErrGroupSizesWithoutKey
+	}
+	total := 0.0
+	for size, share := range o.GroupSizes {
+		if size < 1 || size > MaxGroupSize || share < 0 || math.IsNaN(share) {
+			return ErrInvalidGroupSizes
+		}
+		total += share
+	}
+	if total == 0 {
+		return ErrInvalidGroupSizes
+	}
+	return nil
+}
+
+// Summary is the structure of sampled rows
+type Summary struct {
+	Rows          int             `json:"rows"`
+	Duplicates    int             `json:"duplicates"`
+	DuplicateRate float64         `json:"duplicate_rate"`
+	GroupBy       string          `json:"group_by,omitempty"`
+	Groups        int             `json:"groups,omitempty"`
+	GroupSizes    map[int]float64 `json:"group_sizes,omitempty"`
+	MeanGroupSize float64         `json:"mean_group_size,omitempty"`
+	MaxGroupSize  int             `json:"max_group_size,omitempty"`
+}
+
+// Profile counts the duplicate rows of sampled rows, ignoring the given
+// columns, and the sizes of the groups under groupBy when it is set. Rows
+// with a blank group key are in no group.
+func Profile(columns []string, rows []map[string]interface{}, ignore []string, groupBy string) (*Summary, error) {
+	known := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		known[c] = true
+	}
+	for _, c := range append(append([]string(nil), ignore...), groupBy) {
+		if c != "" && !known[c] {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownColumn, strconv.Quote(c))
+		}
+	}
+	s := &Summary{Rows: len(rows), GroupBy: groupBy}
+	seen := make(map[string]bool, len(rows))
+	skip := ignoreSet(ignore)
+	for _, row := range rows {
+		k := rowKey(row, skip)
+		if seen[k] {
+			s.Duplicates++
+		}
+		seen[k] = true
+	}
+	if len(rows) > 0 {
+		s.DuplicateRate = round(float64(s.Duplicates) / float64(len(rows)))
+	}
+	if groupBy == "" {
+		return s, nil
+	}
+	counts := make(map[string]int)
+	for _, row := range rows {
+		if k := text(row[groupBy]); k != "" {
+			counts[k]++
+		}
+	}
+	s.GroupSizes, s.MeanGroupSize, s.MaxGroupSize = sizeShares(counts)
+	s.Groups = len(counts)
+	return s, nil
+}
+
+// sizeShares returns the share of groups of each size, their mean and
+// largest size
+func sizeShares(counts map[string]int) (map[int]float64, float64, int) {
+	if len(counts) == 0 {
+		return nil, 0, 0
+	}
+	bySize := make(map[int]int)
+	total, largest := 0, 0
+	for _, n := range counts {
+		bySize[n]++
+		total += n
+		if n > largest {
+			largest = n
+		}
+	}
+	shares := make(map[int]float64, len(bySize))
+	for size, n := range bySize {
+		shares[size] = round(float64(n) / float64(len(counts)))
+	}
+	return shares, round(float64(total) / float64(len(counts))), largest
+}
+
+// Target returns the structure a job reproduces: the source's, with the
+// options overriding it
+func (s *Summary) Target(opts Options) *agents.RowStructure {
+	out := &agents.RowStructure{
+		DuplicateRate:       s.DuplicateRate,
+		SourceDuplicateRate: s.DuplicateRate,
+		DuplicateIgnore:     opts.IgnoreColumns,
+		GroupBy:             s.GroupBy,
+		GroupSizes:          s.GroupSizes,
+		MeanGroupSize:       s.MeanGroupSize,
+		MaxGroupSize:        s.MaxGroupSize,
+	}
+	if opts.DuplicateRate != nil {
+		out.DuplicateRate = *opts.DuplicateRate
+	}
+	if len(opts.GroupSizes) > 0 {
+		total := 0.0
+		for _, share := range opts.GroupSizes {
+			total += share
+		}
+		out.GroupSizes = make(map[int]float64, len(opts.GroupSizes))
+		out.MeanGroupSize, out.MaxGroupSize = 0, 0
+		for size, share := range opts.GroupSizes {
+			if share == 0 {
+				continue
+			}
+			out.GroupSizes[size] = round(share / total)
+			out.MeanGroupSize += float64(size) * share / total
+			if size > out.MaxGroupSize {
+				out.MaxGroupSize = size
+			}
+		}
+		out.MeanGroupSize = round(out.MeanGroupSize)
+	}
+	return out
+}
+
+// Apply adds a row structure to a generation request. Duplicates are added
+// after generation, so the prompt asks for distinct rows; groups are asked
+// for in the prompt and capped on the output.
+func Apply(req *agents.GenerationRequest, s *agents.RowStructure) {
+	if s == nil {
+		return
+	}
+	req.SchemaAnalysis.Structure = s
+	if s.DuplicateRate > 0 {
+		req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints,
+			"generate distinct rows; duplicates are added afterwards")
+	}
+	if s.GroupBy == "" || len(s.GroupSizes) == 0 {
+		return
+	}
+	req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints, fmt.Sprintf(
+		"rows are grouped by %s: rows of one group share its %s value and appear one after another; group sizes %s (mean %.2g); never more than %d rows per group",
+		s.GroupBy, s.GroupBy, formatSizes(s.GroupSizes), s.MeanGroupSize, s.MaxGroupSize))
+}
+
+func formatSizes(shares map[int]float64) string {
+	sizes := make([]int, 0, len(shares))
+	for size := range shares {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(a, b int) bool {
+		if shares[sizes[a]] != shares[sizes[b]] {
+			return shares[sizes[a]] > shares[sizes[b]]
+		}
+		return sizes[a] < sizes[b]
+	})
+	if len(sizes) > promptSizes {
+		sizes = sizes[:promptSizes]
+	}
+	parts := make([]string, len(sizes))
+	for i, size := range sizes {
+		parts[i] = fmt.Sprintf("%d %.1f%%", size, shares[size]*100)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Shaper gives generated rows their structure. Rows that would take a group
+// past the largest size are dropped; duplicates beyond the target rate are
+// dropped, and rows are replaced with copies of earlier ones until it is
+// met. It counts what it keeps for Report.
+type Shaper struct {
+	s          *agents.RowStructure
+	ignore     map[string]bool
+	rng        *rand.Rand
+	kept       []map[string]interface{}
+	seen       map[string]bool
+	duplicates int64
+	injected   int64
+	dropped    int64
+	oversize   int64
+	groups     map[string]int
+}
+
+// NewShaper returns nil when the job has no structure. Copies are chosen
+// with a generator seeded by seed, so reruns pick the same rows.
+func NewShaper(s *agents.RowStructure, seed int64) *Shaper {
+	if s == nil {
+		return nil
+	}
+	return &Shaper{
+		s:      s,
+		ignore: ignoreSet(s.DuplicateIgnore),
+		rng:    rand.New(rand.NewSource(seed)),
+		seen:   make(map[string]bool),
+		groups: make(map[string]int),
+	}
+}
+
+// Filter returns the rows with their structure applied
+func (sh *Shaper) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if sh == nil {
+		return rows
+	}
+	out := rows[:0:0]
+	for _, row := range rows {
+		if sh.s.GroupBy != "" && sh.s.MaxGroupSize > 0 {
+			if k := text(row[sh.s.GroupBy]); k != "" && sh.groups[k] >= sh.s.MaxGroupSize {
+				sh.oversize++
+				continue
+			}
+		}
+		key := rowKey(row, sh.ignore)
+		total := int64(len(sh.kept)) + 1
+		wanted := int64(math.Round(sh.s.DuplicateRate * float64(total)))
+		switch {
+		case sh.seen[key] && sh.duplicates >= wanted:
+			sh.dropped++
+			continue
+		case !sh.seen[key] && sh.duplicates < wanted && len(sh.kept) > 0:
+			if dup := sh.copyOf(row); dup != nil {
+				row, key = dup, rowKey(dup, sh.ignore)
+				sh.injected++
+			}
+		}
+		if sh.seen[key] {
+			sh.duplicates++
+		}
+		sh.seen[key] = true
+		if sh.s.GroupBy != "" {
+			if k := text(row[sh.s.GroupBy]); k != "" {
+				sh.groups[k]++
+			}
+		}
+		sh.kept = append(sh.kept, row)
+		out = append(out, row)
+	}
+	return out
+}
+
+// copyOf returns a copy of an earlier row that keeps row's ignored columns,
+// or nil when the copy would take its group past the largest size
+func (sh *Shaper) copyOf(row map[string]interface{}) map[string]interface{} {
+	src := sh.kept[sh.rng.Intn(len(sh.kept))]
+	if sh.s.GroupBy != "" && sh.s.MaxGroupSize > 0 {
+		if k := text(src[sh.s.GroupBy]); k != "" && sh.groups[k] >= sh.s.MaxGroupSize {
+			return nil
+		}
+	}
+	dup := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		dup[k] = v
+	}
+	for col := range sh.ignore {
+		if v, ok := row[col]; ok {
+			dup[col] = v
+		}
+	}
+	return dup
+}
+
+// Report compares the kept rows with the target structure. Group size
+// fidelity is one less the total variation distance between the generated
+// and target size shares.
+func (sh *Shaper) Report() *models.StructureReport {
+	if sh == nil {
+		return nil
+	}
+	r := &models.StructureReport{
+		TargetDuplicateRate: sh.s.DuplicateRate,
+		SourceDuplicateRate: sh.s.SourceDuplicateRate,
+		Duplicates:          sh.duplicates,
+		Injected:            sh.injected,
+		DroppedDuplicates:   sh.dropped,
+		GroupBy:             sh.s.GroupBy,
+		DroppedOversize:     sh.oversize,
+	}
+	if len(sh.kept) > 0 {
+		r.DuplicateRate = round(float64(sh.duplicates) / float64(len(sh.kept)))
+	}
+	if sh.s.GroupBy == "" || len(sh.groups) == 0 {
+		return r
+	}
+	shares, mean, _ := sizeShares(sh.groups)
+	r.Groups = int64(len(sh.groups))
+	r.MeanGroupSize = mean
+	r.TargetMeanGroupSize = sh.s.MeanGroupSize
+	if len(sh.s.GroupSizes) > 0 {
+		distance := 0.0
+		for size, share := range sh.s.GroupSizes {
+			distance += math.Abs(share - shares[size])
+		}
+		for size, share := range shares {
+			if _, ok := sh.s.GroupSizes[size]; !ok {
+				distance += share
+			}
+		}
+		fidelity := round(1 - math.Min(1, distance/2))
+		r.GroupSizeFidelity = &fidelity
+	}
+	return r
+}
+
+func ignoreSet(columns []string) map[string]bool {
+	out := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		out[c] = true
+	}
+	return out
+}
+
+// rowKey renders a row without its ignored columns for comparison. Values
+// are compared as text, so 1 and "1" match.
+func rowKey(row map[string]interface{}, ignore map[string]bool) string {
+	values := make(map[string]string, len(row))
+	for k, v := range row {
+		if !ignore[k] {
+			values[k] = text(v)
+		}
+	}
+	b, _ := json.Marshal(values)
+	return string(b)
+}
+
+func text(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(x)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
@@ -0,0 +1,111 @@
+// Package structure_test provides unit tests for duplicate and group
+// structure
+package structure_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/structure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// source has 3 households of sizes 1, 2 and 3, and one row repeating
+// another under a new id
+func source() []map[string]interface{} {
+	return []map[string]interface{}{
+		{"id": "1", "household": "a", "name": "Ann"},
+		{"id": "2", "household": "b", "name": "Bo"},
+		{"id": "3", "household": "b", "name": "Cy"},
+		{"id": "4", "household": "c", "name": "Di"},
+		{"id": "5", "household": "c", "name": "Ed"},
+		{"id": "6", "household": "c", "name": "Ed"},
+	}
+}
+
+func TestProfile(t *testing.T) {
+	cols := []string{"id", "household", "name"}
+	s, err := structure.Profile(cols, source(), []string{"id"}, "household")
+	require.NoError(t, err)
+	assert.Equal(t, 1, s.Duplicates)
+	assert.Equal(t, 0.1667, s.DuplicateRate)
+	assert.Equal(t, 3, s.Groups)
+	assert.Equal(t, map[int]float64{1: 0.3333, 2: 0.3333, 3: 0.3333}, s.GroupSizes)
+	assert.Equal(t, 2.0, s.MeanGroupSize)
+	assert.Equal(t, 3, s.MaxGroupSize)
+
+	s, err = structure.Profile(cols, source(), nil, "")
+	require.NoError(t, err)
+	assert.Zero(t, s.Duplicates, "ids tell the rows apart unless ignored")
+
+	_, err = structure.Profile(cols, source(), nil, "family")
+	assert.ErrorIs(t, err, structure.ErrUnknownColumn)
+}
+
+func TestOptions(t *testing.T) {
+	rate := 0.9
+	assert.ErrorIs(t, structure.Options{DuplicateRate: &rate}.Validate(), structure.ErrInvalidDuplicateRate)
+	assert.ErrorIs(t, structure.Options{GroupSizes: map[int]float64{2: 1}}.Validate(), structure.ErrGroupSizesWithoutKey)
+	assert.ErrorIs(t, structure.Options{GroupBy: "h", GroupSizes: map[int]float64{0: 1}}.Validate(), structure.ErrInvalidGroupSizes)
+
+	s, err := structure.Profile([]string{"id", "household", "name"}, source(), nil, "household")
+	require.NoError(t, err)
+	rate = 0.1
+	target := s.Target(structure.Options{DuplicateRate: &rate, GroupBy: "household", GroupSizes: map[int]float64{2: 3, 4: 1}})
+	assert.Equal(t, 0.1, target.DuplicateRate)
+	assert.Equal(t, map[int]float64{2: 0.75, 4: 0.25}, target.GroupSizes)
+	assert.Equal(t, 2.5, target.MeanGroupSize)
+	assert.Equal(t, 4, target.MaxGroupSize)
+
+	req := &agents.GenerationRequest{}
+	structure.Apply(req, target)
+	require.Len(t, req.SchemaAnalysis.Constraints, 2)
+	assert.Contains(t, req.SchemaAnalysis.Constraints[1], "2 75.0%, 4 25.0%")
+}
+
+func TestShaperDuplicates(t *testing.T) {
+	sh := structure.NewShaper(&agents.RowStructure{DuplicateRate: 0.2, DuplicateIgnore: []string{"id"}}, 1)
+	var rows []map[string]interface{}
+	for i := 0; i < 50; i++ {
+		rows = append(rows, map[string]interface{}{"id": fmt.Sprint(i), "name": fmt.Sprint("n", i)})
+	}
+	kept := sh.Filter(rows)
+	kept = append(kept, sh.Filter([]map[string]interface{}{{"id": "x", "name": "n1"}, {"id": "y", "name": "n3"}})...)
+
+	r := sh.Report()
+	assert.Equal(t, 0.2, r.TargetDuplicateRate)
+	assert.InDelta(t, 0.2, r.DuplicateRate, 0.02)
+	assert.Equal(t, int64(10), r.Injected)
+	assert.Equal(t, int64(2), r.DroppedDuplicates, "duplicates past the rate are dropped")
+	assert.Len(t, kept, 50)
+	ids := make(map[string]bool)
+	for _, row := range kept {
+		ids[row["id"].(string)] = true
+	}
+	assert.Len(t, ids, 50, "duplicates keep their own ids")
+}
+
+func TestShaperGroups(t *testing.T) {
+	sh := structure.NewShaper(&agents.RowStructure{
+		GroupBy:       "household",
+		GroupSizes:    map[int]float64{2: 1},
+		MeanGroupSize: 2,
+		MaxGroupSize:  2,
+	}, 1)
+	var rows []map[string]interface{}
+	for i := 0; i < 20; i++ {
+		rows = append(rows, map[string]interface{}{"id": fmt.Sprint(i), "household": fmt.Sprint(i / 2)})
+	}
+	rows = append(rows, map[string]interface{}{"id": "x", "household": "0"})
+	assert.Len(t, sh.Filter(rows), 20)
+
+	r := sh.Report()
+	assert.Equal(t, int64(1), r.DroppedOversize, "a third member of a household of two is dropped")
+	assert.Equal(t, int64(10), r.Groups)
+	require.NotNil(t, r.GroupSizeFidelity)
+	assert.Equal(t, 1.0, *r.GroupSizeFidelity)
+
+	assert.Nil(t, structure.NewShaper(nil, 1).Report())
+}
@@ -0,0 +1,117 @@
+// Package templates reads and checks the settings saved in generation
+// templates: a generation config, realism settings, privacy settings and
+// the job options a user starts jobs with again and again. A job started
+// from a template takes every setting its request leaves unset from it.
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/promptguard"
+)
+
+// MaxNameLength bounds template names
+const MaxNameLength = 200
+
+var (
+	ErrInvalidName     = errors.New("template name is required")
+	ErrInvalidSettings = errors.New("invalid template settings")
+)
+
+// domains are the industry domains realism settings may name
+var domains = []agents.IndustryDomain{
+	agents.DomainHealthcare, agents.DomainFinance, agents.DomainManufacturing, agents.DomainEnergy,
+	agents.DomainAerospace, agents.DomainAutomotive, agents.DomainPharmaceutical, agents.DomainRetail,
+	agents.DomainLogistics, agents.DomainGeneral,
+}
+
+// Settings are the settings a template saves. Rows, PrivacyLevel and
+// Strategy in Config are defaults a request can override.
+type Settings struct {
+	Config  agents.GenerationConfig `json:"config"`
+	Realism *agents.RealismConfig   `json:"realism,omitempty"`
+	// ZeroRealData and Grounding are the privacy settings besides the
+	// privacy level
+	ZeroRealData  bool                      `json:"zero_real_data,omitempty"`
+	Grounding     *privacy.GroundingOptions `json:"grounding,omitempty"`
+	Prompt        string                    `json:"prompt,omitempty"`
+	Provider      string                    `json:"provider,omitempty"`
+	ExportFormat  string                    `json:"export_format,omitempty"`
+	ExportFormats []string                  `json:"export_formats,omitempty"`
+}
+
+// Validate checks settings before they are saved. Settings that depend on
+// a dataset or plan are checked when a job starts from them.
+func (s Settings) Validate() error {
+	c := s.Config
+	switch {
+	case c.Rows < 0:
+		return fmt.Errorf("%w: rows cannot be negative", ErrInvalidSettings)
+	case c.Epsilon < 0 || c.Delta < 0:
+		return fmt.Errorf("%w: epsilon and delta cannot be negative", ErrInvalidSettings)
+	case c.Temperature < 0 || c.Temperature > 2:
+		return fmt.Errorf("%w: temperature must be between 0 and 2", ErrInvalidSettings)
+	case c.TopP < 0 || c.TopP > 1:
+		return fmt.Errorf("%w: top_p must be between 0 and 1", ErrInvalidSettings)
+	case c.TopK < 0 || c.MaxTokens < 0 || c.BatchSize < 0 || c.MaxRetries < 0:
+		return fmt.Errorf("%w: top_k, max_tokens, batch_size and max_retries cannot be negative", ErrInvalidSettings)
+	case c.QualityThreshold < 0 || c.QualityThreshold > 1:
+		return fmt.Errorf("%w: quality_threshold must be between 0 and 1", ErrInvalidSettings)
+	}
+	if r := s.Realism; r != nil {
+		if r.IndustryDomain != "" && !slices.Contains(domains, r.IndustryDomain) {
+			return fmt.Errorf("%w: unknown industry domain %q", ErrInvalidSettings, r.IndustryDomain)
+		}
+		if r.StatisticalAccuracyThreshold < 0 || r.StatisticalAccuracyThreshold > 1 ||
+			r.CorrelationPreservationThreshold < 0 || r.CorrelationPreservationThreshold > 1 {
+			return fmt.Errorf("%w: realism thresholds must be between 0 and 1", ErrInvalidSettings)
+		}
+	}
+	if s.Grounding != nil && s.Grounding.Rows < 0 {
+		return fmt.Errorf("%w: grounding rows cannot be negative", ErrInvalidSettings)
+	}
+	// The prompt and business rules reach the provider on every job, so
+	// ones that try to steer the model are refused when saved
+	if err := promptguard.Check(append([]string{s.Prompt}, c.BusinessRules...)...); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	return nil
+}
+
+// Decode reads the settings of a template. Unknown fields are refused so a
+// misspelt setting is not silently dropped.
+func Decode(raw models.TemplateSettings) (Settings, error) {
+	var s Settings
+	if len(raw) == 0 {
+		return s, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&s); err != nil {
+		return s, fmt.Errorf("%w: %v", ErrInvalidSettings, err)
+	}
+	return s, nil
+}
+
+// Encode writes settings as they are stored
+func Encode(s Settings) (models.TemplateSettings, error) {
+	raw, err := json.Marshal(s)
+	return models.TemplateSettings(raw), err
+}
+
+// CheckName trims and checks a template name
+func CheckName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > MaxNameLength {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
@@ -0,0 +1,259 @@
+// Package tradeoff estimates what a completed generation job would have cost
+// and scored under other provider models, from the history of completed
+// jobs: those of the same dataset, and so the same schema, when there are
+// enough of them, and the platform's otherwise.
+package tradeoff
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Providers whose quality depends too much on the dataset to be judged on
+// platform averages: the statistical generator fits each schema itself and
+// custom models are trained on one customer's data
+const (
+	localProvider  = "local"
+	customProvider = "custom"
+)
+
+// statisticalStrategy is the generation strategy that runs jobs on the
+// local statistical generator
+const statisticalStrategy = "statistical"
+
+// Options tune the recommendations made for a job
+type Options struct {
+	// MinDatasetJobs is how many scored jobs of the dataset both models
+	// need for them to be compared on that dataset
+	MinDatasetJobs int64
+	// MinJobs is how many scored jobs across the platform both models need
+	// for them to be compared on platform averages
+	MinJobs int64
+	// MinSavings is the least share of the job's cost a cheaper model must
+	// save to be recommended
+	MinSavings float64
+	// QualityTolerance is how much lower a cheaper model's average quality
+	// may be
+	QualityTolerance float64
+	// MinQualityGain is how much higher a model's average quality must be
+	// for it to be recommended whatever it costs
+	MinQualityGain float64
+	// Max caps the recommendations of a job
+	Max int
+}
+
+// DefaultOptions are the options of the job worker
+var DefaultOptions = Options{MinDatasetJobs: 2, MinJobs: 5, MinSavings: 0.1, QualityTolerance: 0.05, MinQualityGain: 0.02, Max: 3}
+
+// Recommend compares a completed job's model with the others in dataset,
+// the statistics of the job's dataset, and platform, those of all jobs.
+// Models are compared on the dataset when both have enough scored jobs of
+// it and on the platform otherwise. A model is recommended when it would
+// have saved at least MinSavings of the job's cost at a quality within
+// QualityTolerance, or when its quality is at least MinQualityGain higher.
+// Jobs that cost nothing or have no model get no recommendations.
+func Recommend(job *models.GenerationJob, dataset, platform []models.ProviderUsage, opts Options) []models.TradeoffRecommendation {
+	if job.Provider == nil || job.Model == nil || job.CostUSD <= 0 {
+		return nil
+	}
+	ownDataset := find(dataset, *job.Provider, *job.Model)
+	ownPlatform := find(platform, *job.Provider, *job.Model)
+
+	seen := make(map[string]bool)
+	var out []models.TradeoffRecommendation
+	for _, stats := range [][]models.ProviderUsage{dataset, platform} {
+		for _, alt := range stats {
+			key := alt.Provider + "/" + alt.Model
+			if seen[key] || (alt.Provider == *job.Provider && alt.Model == *job.Model) {
+				continue
+			}
+			seen[key] = true
+			altDataset := find(dataset, alt.Provider, alt.Model)
+			altPlatform := find(platform, alt.Provider, alt.Model)
+			var own, other *models.ProviderUsage
+			basis := models.TradeoffBasisDataset
+			switch {
+			case comparableStats(ownDataset, altDataset, opts.MinDatasetJobs):
+				own, other = ownDataset, altDataset
+			case alt.Provider != localProvider && alt.Provider != customProvider &&
+				comparableStats(ownPlatform, altPlatform, opts.MinJobs):
+				own, other, basis = ownPlatform, altPlatform, models.TradeoffBasisPlatform
+			default:
+				continue
+			}
+			if rec, ok := recommendation(job, own, other, basis, opts); ok {
+				out = append(out, rec)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].CostChange != out[j].CostChange {
+			return out[i].CostChange < out[j].CostChange
+		}
+		return out[i].QualityChange > out[j].QualityChange
+	})
+	if opts.Max > 0 && len(out) > opts.Max {
+		out = out[:opts.Max]
+	}
+	return out
+}
+
+func find(stats []models.ProviderUsage, provider, model string) *models.ProviderUsage {
+	for i := range stats {
+		if stats[i].Provider == provider && stats[i].Model == model {
+			return &stats[i]
+		}
+	}
+	return nil
+}
+
+func comparableStats(own, alt *models.ProviderUsage, min int64) bool {
+	return own != nil && alt != nil && own.AvgQuality != nil && alt.AvgQuality != nil &&
+		*own.AvgQuality > 0 && own.ScoredJobs >= min && alt.ScoredJobs >= min
+}
+
+func recommendation(job *models.GenerationJob, own, alt *models.ProviderUsage, basis string, opts Options) (models.TradeoffRecommendation, bool) {
+	cost, ok := estimateCost(job, alt)
+	if !ok {
+		return models.TradeoffRecommendation{}, false
+	}
+	costChange := cost/job.CostUSD - 1
+	qualityDiff := *alt.AvgQuality - *own.AvgQuality
+	cheaper := costChange <= -opts.MinSavings && qualityDiff >= -opts.QualityTolerance
+	better := qualityDiff >= opts.MinQualityGain
+	if !cheaper && !better {
+		return models.TradeoffRecommendation{}, false
+	}
+	rec := models.TradeoffRecommendation{
+		Provider:         alt.Provider,
+		Model:            alt.Model,
+		EstimatedCostUSD: math.Round(cost*10000) / 10000,
+		CostChange:       round(costChange),
+		QualityChange:    round(qualityDiff / *own.AvgQuality),
+		Basis:            basis,
+		SampleJobs:       alt.ScoredJobs,
+	}
+	if alt.Provider == localProvider {
+		rec.Strategy = statisticalStrategy
+	}
+	// The job's own score moved by the models' relative difference, or the
+	// other model's average when the job was not scored
+	quality := *alt.AvgQuality
+	if job.QualityScore != nil {
+		quality = *job.QualityScore * (1 + qualityDiff / *own.AvgQuality)
+	}
+	quality = math.Max(0, math.Min(1, round(quality)))
+	rec.EstimatedQuality = &quality
+	rec.Summary = summary(rec)
+	return rec, true
+}
+
+// estimateCost prices the job's tokens at the other model's average cost
+// per token, or its rows at the cost per row when that model reports no
+// tokens, such as the statistical generator
+func estimateCost(job *models.GenerationJob, alt *models.ProviderUsage) (float64, bool) {
+	switch {
+	case job.TokensUsed > 0 && alt.Tokens > 0:
+		return float64(job.TokensUsed) * alt.CostUSD / float64(alt.Tokens), true
+	case job.RowsGenerated > 0 && alt.Rows > 0:
+		return float64(job.RowsGenerated) * alt.CostUSD / float64(alt.Rows), true
+	}
+	return 0, false
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+func percent(v float64) int {
+	return int(math.Round(math.Abs(v) * 100))
+}
+
+// summary reads a recommendation out, such as "claude-haiku-4 would have
+// cost 70% less with an estimated 3% quality drop for this schema"
+func summary(r models.TradeoffRecommendation) string {
+	cost := "the same"
+	if p := percent(r.CostChange); p > 0 && r.CostChange < 0 {
+		cost = fmt.Sprintf("%d%% less", p)
+	} else if p > 0 {
+		cost = fmt.Sprintf("%d%% more", p)
+	}
+	quality := "no estimated quality change"
+	if p := percent(r.QualityChange); p > 0 && r.QualityChange < 0 {
+		quality = fmt.Sprintf("an estimated %d%% quality drop", p)
+	} else if p > 0 {
+		quality = fmt.Sprintf("an estimated %d%% quality gain", p)
+	}
+	scope := "for this schema"
+	if r.Basis == models.TradeoffBasisPlatform {
+		scope = "on platform averages"
+	}
+	return fmt.Sprintf("%s would have cost %s with %s %s", r.Model, cost, quality, scope)
+}
+
+// Stats aggregates completed jobs by provider and model
+type Stats interface {
+	// ModelQualityStats covers all datasets when datasetID is zero
+	ModelQualityStats(ctx context.Context, since time.Time, datasetID int64) ([]models.ProviderUsage, error)
+}
+
+// PlatformStatsTTL is how long the advisor reuses the platform statistics,
+// which every job shares and which move slowly
+const PlatformStatsTTL = 10 * time.Minute
+
+// Advisor recommends models for completed jobs from the jobs completed
+// within a lookback window
+type Advisor struct {
+	stats    Stats
+	lookback time.Duration
+	opts     Options
+
+	mu       sync.Mutex
+	platform []models.ProviderUsage
+	fetched  time.Time
+}
+
+// NewAdvisor creates an advisor with the default options
+func NewAdvisor(stats Stats, lookback time.Duration) *Advisor {
+	return &Advisor{stats: stats, lookback: lookback, opts: DefaultOptions}
+}
+
+// Recommend implements jobs.Advisor
+func (a *Advisor) Recommend(ctx context.Context, job *models.GenerationJob) ([]models.TradeoffRecommendation, error) {
+	if job.Provider == nil || job.Model == nil || job.CostUSD <= 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	dataset, err := a.stats.ModelQualityStats(ctx, now.Add(-a.lookback), job.DatasetID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dataset model statistics: %w", err)
+	}
+	platform, err := a.platformStats(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+	return Recommend(job, dataset, platform, a.opts), nil
+}
+
+func (a *Advisor) platformStats(ctx context.Context, now time.Time) ([]models.ProviderUsage, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.platform != nil && now.Sub(a.fetched) < PlatformStatsTTL {
+		return a.platform, nil
+	}
+	stats, err := a.stats.ModelQualityStats(ctx, now.Add(-a.lookback), 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load platform model statistics: %w", err)
+	}
+	if stats == nil {
+		stats = []models.ProviderUsage{}
+	}
+	a.platform, a.fetched = stats, now
+	return stats, nil
+}
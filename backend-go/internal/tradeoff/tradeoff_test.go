@@ -0,0 +1,125 @@
+// Package tradeoff_test provides unit tests for what-if model recommendations
+package tradeoff_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/tradeoff"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func opusJob() *models.GenerationJob {
+	return &models.GenerationJob{
+		ID: 1, DatasetID: 7, Provider: ptr("vertex"), Model: ptr("claude-opus-4-1"),
+		RowsGenerated: 1000, TokensUsed: 10000, CostUSD: 1.0, QualityScore: ptr(0.9),
+	}
+}
+
+func usage(provider, model string, rows, tokens int64, cost, quality float64, scored int64) models.ProviderUsage {
+	return models.ProviderUsage{Provider: provider, Model: model, Jobs: scored, Rows: rows, Tokens: tokens, CostUSD: cost, AvgQuality: &quality, ScoredJobs: scored}
+}
+
+var (
+	datasetStats = []models.ProviderUsage{
+		usage("vertex", "claude-opus-4-1", 3000, 30000, 3.0, 0.90, 3),
+		usage("vertex", "claude-haiku-4", 2000, 20000, 0.6, 0.873, 2),
+		// Too few jobs of the dataset, and never judged on the platform's
+		usage("local", "gaussian_copula", 1000, 0, 0, 0.95, 1),
+	}
+	platformStats = []models.ProviderUsage{
+		usage("vertex", "claude-opus-4-1", 100000, 1000000, 100, 0.88, 50),
+		usage("vertex", "claude-sonnet-4", 100000, 1000000, 40, 0.91, 40),
+		usage("vertex", "claude-haiku-4", 100000, 1000000, 5, 0.60, 80),
+		usage("vertex", "gemini-pro", 100000, 1000000, 10, 0.95, 3),
+		usage("local", "gaussian_copula", 500000, 0, 0, 0.99, 200),
+		usage("vertex", "legacy-large", 100000, 1000000, 150, 0.80, 20),
+	}
+)
+
+func TestRecommend(t *testing.T) {
+	recs := tradeoff.Recommend(opusJob(), datasetStats, platformStats, tradeoff.DefaultOptions)
+	require.Len(t, recs, 2)
+
+	haiku := recs[0]
+	assert.Equal(t, "claude-haiku-4", haiku.Model)
+	assert.Equal(t, models.TradeoffBasisDataset, haiku.Basis, "the dataset's own jobs win over the platform's")
+	assert.InDelta(t, 0.3, haiku.EstimatedCostUSD, 1e-9)
+	assert.InDelta(t, -0.7, haiku.CostChange, 1e-9)
+	assert.InDelta(t, -0.03, haiku.QualityChange, 1e-9)
+	require.NotNil(t, haiku.EstimatedQuality)
+	assert.InDelta(t, 0.873, *haiku.EstimatedQuality, 1e-9)
+	assert.Equal(t, int64(2), haiku.SampleJobs)
+	assert.Empty(t, haiku.Strategy)
+	assert.Equal(t, "claude-haiku-4 would have cost 70% less with an estimated 3% quality drop for this schema", haiku.Summary)
+
+	sonnet := recs[1]
+	assert.Equal(t, "claude-sonnet-4", sonnet.Model)
+	assert.Equal(t, models.TradeoffBasisPlatform, sonnet.Basis)
+	assert.InDelta(t, -0.6, sonnet.CostChange, 1e-9)
+	assert.Equal(t, "claude-sonnet-4 would have cost 60% less with an estimated 3% quality gain on platform averages", sonnet.Summary)
+}
+
+func TestRecommendStatisticalOnDataset(t *testing.T) {
+	dataset := append([]models.ProviderUsage{}, datasetStats...)
+	dataset[2] = usage("local", "gaussian_copula", 4000, 0, 0, 0.89, 4)
+
+	recs := tradeoff.Recommend(opusJob(), dataset, nil, tradeoff.DefaultOptions)
+	require.Len(t, recs, 2)
+	assert.Equal(t, "gaussian_copula", recs[0].Model)
+	assert.Equal(t, "statistical", recs[0].Strategy, "the strategy that selects the generator")
+	assert.Zero(t, recs[0].EstimatedCostUSD, "priced per row when the model uses no tokens")
+	assert.Equal(t, "gaussian_copula would have cost 100% less with an estimated 1% quality drop for this schema", recs[0].Summary)
+}
+
+func TestRecommendSkipsFreeAndUnknownJobs(t *testing.T) {
+	free := opusJob()
+	free.CostUSD = 0
+	assert.Empty(t, tradeoff.Recommend(free, datasetStats, platformStats, tradeoff.DefaultOptions))
+
+	unknown := opusJob()
+	unknown.Model = nil
+	assert.Empty(t, tradeoff.Recommend(unknown, datasetStats, platformStats, tradeoff.DefaultOptions))
+
+	capped := tradeoff.DefaultOptions
+	capped.Max = 1
+	assert.Len(t, tradeoff.Recommend(opusJob(), datasetStats, platformStats, capped), 1)
+}
+
+type fakeStats struct {
+	calls map[int64]int
+	fail  bool
+}
+
+func (f *fakeStats) ModelQualityStats(_ context.Context, _ time.Time, datasetID int64) ([]models.ProviderUsage, error) {
+	if f.fail {
+		return nil, errors.New("connection refused")
+	}
+	f.calls[datasetID]++
+	if datasetID == 0 {
+		return platformStats, nil
+	}
+	return datasetStats, nil
+}
+
+func TestAdvisorCachesPlatformStats(t *testing.T) {
+	stats := &fakeStats{calls: map[int64]int{}}
+	a := tradeoff.NewAdvisor(stats, 90*24*time.Hour)
+
+	for i := 0; i < 2; i++ {
+		recs, err := a.Recommend(context.Background(), opusJob())
+		require.NoError(t, err)
+		assert.Len(t, recs, 2)
+	}
+	assert.Equal(t, map[int64]int{7: 2, 0: 1}, stats.calls)
+
+	stats.fail = true
+	_, err := a.Recommend(context.Background(), opusJob())
+	assert.Error(t, err)
+}
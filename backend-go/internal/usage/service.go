@@ -2,8 +2,10 @@ package usage
 
 import (
 	"context"
+	"sort"
 	"time"
 
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pricing"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
 )
@@ -13,6 +15,7 @@ type UsageService struct {
 	genRepo         *repo.GenerationRepo
 	dsRepo          *repo.DatasetRepo
 	customModelRepo *repo.CustomModelRepo
+	overrides       Overrides
 }
 
 func NewUsageService(userRepo *repo.UserRepo, genRepo *repo.GenerationRepo, dsRepo *repo.DatasetRepo, customModelRepo *repo.CustomModelRepo) *UsageService {
@@ -24,8 +27,19 @@ func NewUsageService(userRepo *repo.UserRepo, genRepo *repo.GenerationRepo, dsRe
 	}
 }
 
+// Overrides finds the limits staff replaced for a user
+type Overrides interface {
+	Active(ctx context.Context, userID int64, now time.Time) (*models.QuotaOverride, error)
+}
+
+// SetOverrides makes the service apply quota overrides on top of plan limits
+func (s *UsageService) SetOverrides(o Overrides) {
+	s.overrides = o
+}
+
 type UsageStats struct {
 	MonthlyRowsGenerated int64      `json:"monthly_rows_generated"`
+	MonthlyRowsReserved  int64      `json:"monthly_rows_reserved"`
 	TotalDatasets        int64      `json:"total_datasets"`
 	TotalCustomModels    int64      `json:"total_custom_models"`
 	PlanLimits           PlanLimits `json:"plan_limits"`
@@ -36,6 +50,60 @@ type PlanLimits struct {
 	MaxDatasets     int64 `json:"max_datasets"`
 	MaxCustomModels int64 `json:"max_custom_models"`
 	APIRateLimit    int64 `json:"api_rate_limit"`
+	// Metering is the metered usage the plan includes each month and its
+	// overage prices; nil when the plan bills no overage
+	Metering *pricing.MeteringRates `json:"metering,omitempty"`
+}
+
+// Limits returns the limits of a subscription tier; zero when the tier has
+// no plan
+func Limits(tier models.SubscriptionTier) PlanLimits {
+	for _, plan := range pricing.SubscriptionPlans() {
+		if plan.ID == string(tier) {
+			return PlanLimits{
+				MonthlyRowLimit: int64(plan.MonthlyLimit),
+				MaxDatasets:     int64(plan.MaxDatasets),
+				MaxCustomModels: int64(plan.MaxCustomModels),
+				APIRateLimit:    int64(plan.APIRateLimit),
+				Metering:        plan.Metering,
+			}
+		}
+	}
+	return PlanLimits{}
+}
+
+// ApplyOverride returns limits with the limits an override sets in place of
+// the plan's
+func ApplyOverride(limits PlanLimits, o *models.QuotaOverride) PlanLimits {
+	if o == nil {
+		return limits
+	}
+	if o.MonthlyRowLimit != nil {
+		limits.MonthlyRowLimit = *o.MonthlyRowLimit
+	}
+	if o.MaxDatasets != nil {
+		limits.MaxDatasets = *o.MaxDatasets
+	}
+	if o.MaxCustomModels != nil {
+		limits.MaxCustomModels = *o.MaxCustomModels
+	}
+	if o.APIRateLimit != nil {
+		limits.APIRateLimit = *o.APIRateLimit
+	}
+	return limits
+}
+
+// limits returns the limits of a user on tier with their override applied
+func (s *UsageService) limits(ctx context.Context, userID int64, tier models.SubscriptionTier) (PlanLimits, error) {
+	limits := Limits(tier)
+	if s.overrides == nil {
+		return limits, nil
+	}
+	o, err := s.overrides.Active(ctx, userID, time.Now())
+	if err != nil {
+		return PlanLimits{}, err
+	}
+	return ApplyOverride(limits, o), nil
 }
 
 func (s *UsageService) GetUsageStats(ctx context.Context, userID int64) (*UsageStats, error) {
@@ -44,6 +112,11 @@ func (s *UsageService) GetUsageStats(ctx context.Context, userID int64) (*UsageS
 		return nil, err
 	}
 
+	limits, err := s.limits(ctx, userID, user.SubscriptionTier)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get current month's generation stats
 	now := time.Now()
 	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
@@ -52,6 +125,10 @@ func (s *UsageService) GetUsageStats(ctx context.Context, userID int64) (*UsageS
 	if err != nil {
 		return nil, err
 	}
+	reservedRows, err := s.genRepo.GetMonthlyRowsReserved(ctx, userID, startOfMonth)
+	if err != nil {
+		return nil, err
+	}
 
 	// Get dataset count
 	datasetCount, err := s.dsRepo.GetCountByOwner(ctx, userID)
@@ -65,44 +142,78 @@ func (s *UsageService) GetUsageStats(ctx context.Context, userID int64) (*UsageS
 		return nil, err
 	}
 
-	// Get plan limits
-	plans := pricing.SubscriptionPlans()
-	var planLimits PlanLimits
-	for _, plan := range plans {
-		if plan.ID == string(user.SubscriptionTier) {
-			planLimits = PlanLimits{
-				MonthlyRowLimit: int64(plan.MonthlyLimit),
-				MaxDatasets:     int64(plan.MaxDatasets),
-				MaxCustomModels: int64(plan.MaxCustomModels),
-				APIRateLimit:    int64(plan.APIRateLimit),
-			}
-			break
-		}
-	}
-
 	return &UsageStats{
 		MonthlyRowsGenerated: monthlyRows,
+		MonthlyRowsReserved:  reservedRows,
 		TotalDatasets:        datasetCount,
 		TotalCustomModels:    customModelCount,
-		PlanLimits:           planLimits,
+		PlanLimits:           limits,
 	}, nil
 }
 
+// UserLimits returns the subscription tier of a user and its limits, with
+// any quota override applied
+func (s *UsageService) UserLimits(ctx context.Context, userID int64) (models.SubscriptionTier, PlanLimits, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return "", PlanLimits{}, err
+	}
+	limits, err := s.limits(ctx, userID, user.SubscriptionTier)
+	if err != nil {
+		return "", PlanLimits{}, err
+	}
+	return user.SubscriptionTier, limits, nil
+}
+
+// APIRateLimit returns the requests per minute the user's subscription or
+// quota override allows on the API, or 0 when their tier has no plan
+func (s *UsageService) APIRateLimit(ctx context.Context, userID int64) (int, error) {
+	_, limits, err := s.UserLimits(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return int(limits.APIRateLimit), nil
+}
+
 func (s *UsageService) CanGenerateRows(ctx context.Context, userID int64, requestedRows int64) (bool, string, error) {
 	stats, err := s.GetUsageStats(ctx, userID)
 	if err != nil {
 		return false, "", err
 	}
 
-	// Check monthly row limit
+	// Check monthly row limit; rows of unfinished jobs are spoken for
 	if stats.PlanLimits.MonthlyRowLimit > 0 &&
-		stats.MonthlyRowsGenerated+requestedRows > stats.PlanLimits.MonthlyRowLimit {
+		stats.MonthlyRowsGenerated+stats.MonthlyRowsReserved+requestedRows > stats.PlanLimits.MonthlyRowLimit {
 		return false, "monthly_limit_exceeded", nil
 	}
 
 	return true, "", nil
 }
 
+// RowRefund is the row quota a cancelled job gave back
+type RowRefund struct {
+	RowsRefunded int64 `json:"rows_refunded"`
+	// RowsRemaining is the month's quota left afterwards; nil without a
+	// monthly limit
+	RowsRemaining *int64 `json:"rows_remaining,omitempty"`
+}
+
+// Refund reports the quota a cancelled job returned: the rows it reserved
+// and did not deliver. Cancelling the job is what releases them, since only
+// unfinished jobs hold a reservation.
+func (s *UsageService) Refund(ctx context.Context, job *models.GenerationJob) (*RowRefund, error) {
+	out := &RowRefund{RowsRefunded: max(job.RowsRequested-job.RowsGenerated, 0)}
+	stats, err := s.GetUsageStats(ctx, job.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if limit := stats.PlanLimits.MonthlyRowLimit; limit > 0 {
+		remaining := max(limit-stats.MonthlyRowsGenerated-stats.MonthlyRowsReserved, 0)
+		out.RowsRemaining = &remaining
+	}
+	return out, nil
+}
+
 func (s *UsageService) CanCreateDataset(ctx context.Context, userID int64) (bool, string, error) {
 	stats, err := s.GetUsageStats(ctx, userID)
 	if err != nil {
@@ -132,3 +243,82 @@ func (s *UsageService) CanCreateCustomModel(ctx context.Context, userID int64) (
 
 	return true, "", nil
 }
+
+// ProviderUsageReport breaks a user's generation usage down by provider and
+// model, both over time and in total
+type ProviderUsageReport struct {
+	Since    time.Time              `json:"since"`
+	Interval string                 `json:"interval"`
+	Series   []models.ProviderUsage `json:"series"`
+	Totals   []ProviderTotal        `json:"totals"`
+}
+
+// ProviderTotal is a provider and model's usage over the whole report window
+type ProviderTotal struct {
+	Provider      string   `json:"provider"`
+	Model         string   `json:"model"`
+	Jobs          int64    `json:"jobs"`
+	Rows          int64    `json:"rows"`
+	Tokens        int64    `json:"tokens"`
+	CostUSD       float64  `json:"cost_usd"`
+	CostPer1KRows float64  `json:"cost_per_1k_rows"`
+	AvgQuality    *float64 `json:"avg_quality,omitempty"`
+}
+
+func (s *UsageService) GetProviderUsage(ctx context.Context, userID int64, since time.Time, interval string) (*ProviderUsageReport, error) {
+	series, err := s.genRepo.UsageByProvider(ctx, userID, since, interval)
+	if err != nil {
+		return nil, err
+	}
+	if series == nil {
+		series = []models.ProviderUsage{}
+	}
+	return &ProviderUsageReport{
+		Since:    since,
+		Interval: interval,
+		Series:   series,
+		Totals:   SummarizeProviderUsage(series),
+	}, nil
+}
+
+// SummarizeProviderUsage totals bucketed usage per provider and model, ordered
+// from cheapest to most expensive per thousand rows
+func SummarizeProviderUsage(series []models.ProviderUsage) []ProviderTotal {
+	type key struct{ provider, model string }
+	totals := make(map[key]*ProviderTotal)
+	quality := make(map[key]float64)
+	scored := make(map[key]int64)
+	var order []key
+	for _, u := range series {
+		k := key{u.Provider, u.Model}
+		t, ok := totals[k]
+		if !ok {
+			t = &ProviderTotal{Provider: u.Provider, Model: u.Model}
+			totals[k] = t
+			order = append(order, k)
+		}
+		t.Jobs += u.Jobs
+		t.Rows += u.Rows
+		t.Tokens += u.Tokens
+		t.CostUSD += u.CostUSD
+		if u.AvgQuality != nil && u.ScoredJobs > 0 {
+			quality[k] += *u.AvgQuality * float64(u.ScoredJobs)
+			scored[k] += u.ScoredJobs
+		}
+	}
+
+	out := make([]ProviderTotal, 0, len(order))
+	for _, k := range order {
+		t := totals[k]
+		if t.Rows > 0 {
+			t.CostPer1KRows = t.CostUSD / float64(t.Rows) * 1000
+		}
+		if scored[k] > 0 {
+			avg := quality[k] / float64(scored[k])
+			t.AvgQuality = &avg
+		}
+		out = append(out, *t)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].CostPer1KRows < out[j].CostPer1KRows })
+	return out
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/testutil"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/usage"
@@ -54,6 +55,11 @@ func TestUsageService_GetUsageStats(t *testing.T) {
 			WithArgs(userID, sqlmock.AnyArg()).
 			WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(500))
 
+		// Mock rows reserved by unfinished jobs
+		genDB.Mock.ExpectQuery(`SELECT COALESCE\(SUM\(rows_requested\), 0\) FROM generation_jobs\s+WHERE user_id=\$1 AND status IN \('pending','queued','running','paused'\) AND created_at >= \$2`).
+			WithArgs(userID, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(300))
+
 		// Mock dataset count
 		dsDB.Mock.ExpectQuery(`SELECT COUNT\(\*\) FROM datasets WHERE owner_id = \$1 AND status <> 'archived'`).
 			WithArgs(userID).
@@ -69,6 +75,7 @@ func TestUsageService_GetUsageStats(t *testing.T) {
 		require.NoError(t, err)
 		require.NotNil(t, stats)
 		assert.Equal(t, int64(500), stats.MonthlyRowsGenerated)
+		assert.Equal(t, int64(300), stats.MonthlyRowsReserved)
 		assert.Equal(t, int64(2), stats.TotalDatasets)
 		assert.Equal(t, int64(1), stats.TotalCustomModels)
 		assert.Equal(t, int64(10000), stats.PlanLimits.MonthlyRowLimit)
@@ -331,3 +338,39 @@ func TestUsageService_CanCreateCustomModel(t *testing.T) {
 		modelDB.AssertExpectations(t)
 	})
 }
+
+func TestSummarizeProviderUsage(t *testing.T) {
+	q := func(v float64) *float64 { return &v }
+	series := []models.ProviderUsage{
+		{Provider: "anthropic", Model: "claude", Jobs: 2, Rows: 1000, Tokens: 5000, CostUSD: 4, AvgQuality: q(0.9), ScoredJobs: 2},
+		{Provider: "vertex", Model: "gemini", Jobs: 1, Rows: 2000, Tokens: 3000, CostUSD: 2, AvgQuality: q(0.7), ScoredJobs: 1},
+		{Provider: "anthropic", Model: "claude", Jobs: 1, Rows: 1000, Tokens: 2000, CostUSD: 2, AvgQuality: q(0.6), ScoredJobs: 1},
+	}
+
+	totals := usage.SummarizeProviderUsage(series)
+	require.Len(t, totals, 2)
+
+	// Cheapest per thousand rows first
+	assert.Equal(t, "vertex", totals[0].Provider)
+	assert.InDelta(t, 1.0, totals[0].CostPer1KRows, 1e-9)
+
+	claude := totals[1]
+	assert.Equal(t, int64(3), claude.Jobs)
+	assert.Equal(t, int64(2000), claude.Rows)
+	assert.Equal(t, int64(7000), claude.Tokens)
+	assert.InDelta(t, 3.0, claude.CostPer1KRows, 1e-9)
+	require.NotNil(t, claude.AvgQuality)
+	assert.InDelta(t, 0.8, *claude.AvgQuality, 1e-9)
+}
+
+func TestApplyOverride(t *testing.T) {
+	plan := usage.Limits(models.TierStarter)
+	assert.Equal(t, plan, usage.ApplyOverride(plan, nil))
+
+	rows, unlimited := int64(500000), int64(0)
+	got := usage.ApplyOverride(plan, &models.QuotaOverride{MonthlyRowLimit: &rows, MaxDatasets: &unlimited})
+	assert.Equal(t, int64(500000), got.MonthlyRowLimit)
+	assert.Equal(t, int64(0), got.MaxDatasets, "0 lifts a limit")
+	assert.Equal(t, plan.MaxCustomModels, got.MaxCustomModels, "limits the override leaves out keep the plan's")
+	assert.Equal(t, plan.APIRateLimit, got.APIRateLimit)
+}
@@ -0,0 +1,116 @@
+package vocabulary
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Sampler draws the values of vocabulary columns into generated rows, in
+// place of whatever the generator wrote
+type Sampler struct {
+	columns []agents.VocabularyColumn
+	// cumulative holds the running weight totals of each column
+	cumulative [][]float64
+	rng        *rand.Rand
+}
+
+// NewSampler returns nil when there are no vocabulary columns. The seed
+// makes a job's draws repeat when it is retried.
+func NewSampler(columns []agents.VocabularyColumn, seed int64) *Sampler {
+	if len(columns) == 0 {
+		return nil
+	}
+	s := &Sampler{columns: columns, cumulative: make([][]float64, len(columns)), rng: rand.New(rand.NewSource(seed))}
+	for i, col := range columns {
+		total := 0.0
+		s.cumulative[i] = make([]float64, len(col.Weights))
+		for j, w := range col.Weights {
+			total += w
+			s.cumulative[i][j] = total
+		}
+	}
+	return s
+}
+
+// Filter sets every vocabulary column of rows to a drawn value
+func (s *Sampler) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if s == nil {
+		return rows
+	}
+	for _, row := range rows {
+		for i, col := range s.columns {
+			cum := s.cumulative[i]
+			if len(cum) == 0 || cum[len(cum)-1] <= 0 {
+				continue
+			}
+			x := s.rng.Float64() * cum[len(cum)-1]
+			j := sort.Search(len(cum), func(k int) bool { return cum[k] > x })
+			if j == len(cum) {
+				j--
+			}
+			row[col.Column] = col.Values[j]
+		}
+	}
+	return rows
+}
+
+// Check validates delivered rows against their vocabulary columns, measuring
+// how closely the shares of the values follow their weights. It returns
+// ErrOutOfVocabulary with the reports when any value is not approved.
+func Check(rows []map[string]interface{}, columns []agents.VocabularyColumn) ([]models.VocabularyReport, error) {
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	out := make([]models.VocabularyReport, len(columns))
+	var broken []string
+	for i, col := range columns {
+		index := make(map[string]int, len(col.Values))
+		for j, v := range col.Values {
+			index[v] = j
+		}
+		counts := make([]int64, len(col.Values))
+		r := models.VocabularyReport{
+			Column:     col.Column,
+			Vocabulary: col.Vocabulary,
+			Weighting:  col.Weighting,
+			Entries:    len(col.Values),
+			Checked:    int64(len(rows)),
+		}
+		for _, row := range rows {
+			j, ok := index[text(row[col.Column])]
+			if !ok {
+				r.OutOfVocabulary++
+				continue
+			}
+			if counts[j] == 0 {
+				r.Distinct++
+			}
+			counts[j]++
+		}
+		total := 0.0
+		for _, w := range col.Weights {
+			total += w
+		}
+		r.Fidelity = 1
+		if r.Checked > 0 && total > 0 {
+			distance := float64(r.OutOfVocabulary) / float64(r.Checked)
+			for j, w := range col.Weights {
+				distance += math.Abs(float64(counts[j])/float64(r.Checked) - w/total)
+			}
+			r.Fidelity = math.Round((1-distance/2)*10000) / 10000
+		}
+		if r.OutOfVocabulary > 0 {
+			broken = append(broken, fmt.Sprintf("%s (%d)", col.Column, r.OutOfVocabulary))
+		}
+		out[i] = r
+	}
+	if len(broken) > 0 {
+		return out, fmt.Errorf("%w: %v", ErrOutOfVocabulary, broken)
+	}
+	return out, nil
+}
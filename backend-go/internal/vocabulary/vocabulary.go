@@ -0,0 +1,283 @@
+// Package vocabulary supports controlled vocabularies: dictionaries of
+// approved values, such as ICD-10 codes, NAICS codes or product SKUs, that
+// users upload and bind to dataset columns. Generated values of a bound
+// column are drawn from the vocabulary only, uniformly, by the weights listed
+// with its entries or by the frequencies observed in the source, and the
+// delivered rows are checked against it.
+package vocabulary
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Weightings of the values of a bound column
+const (
+	WeightingUniform = "uniform"
+	WeightingListed  = "listed"
+	WeightingSource  = "source"
+)
+
+const (
+	// MaxEntries caps the entries of one vocabulary, which every job
+	// generating a bound column carries
+	MaxEntries     = 50000
+	MaxValueLength = 200
+	MaxLabelLength = 500
+	maxNameLength  = 100
+	// promptValues caps the values listed in a prompt
+	promptValues = 50
+)
+
+// Weightings are the weightings a binding can use
+var Weightings = []string{WeightingUniform, WeightingListed, WeightingSource}
+
+var (
+	ErrInvalidName      = fmt.Errorf("a vocabulary needs a name of at most %d characters", maxNameLength)
+	ErrNoEntries        = errors.New("a vocabulary needs at least one entry")
+	ErrTooManyEntries   = fmt.Errorf("a vocabulary has at most %d entries", MaxEntries)
+	ErrInvalidEntry     = errors.New("invalid vocabulary entry")
+	ErrDuplicateEntry   = errors.New("a value appears twice in the vocabulary")
+	ErrInvalidFile      = errors.New("vocabulary files are CSV with a header naming a value or code column")
+	ErrUnknownWeighting = errors.New("weighting must be uniform, listed or source")
+	ErrNoWeights        = errors.New("listed weighting needs an entry of positive weight")
+	ErrNoSourceMatches  = errors.New("no source value of the column is in the vocabulary")
+	ErrOutOfVocabulary  = errors.New("generated values are not in the vocabulary")
+)
+
+// ValidName trims a vocabulary name and checks its length
+func ValidName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxNameLength {
+		return "", ErrInvalidName
+	}
+	return name, nil
+}
+
+// ValidWeighting checks a binding's weighting
+func ValidWeighting(w string) error {
+	for _, known := range Weightings {
+		if w == known {
+			return nil
+		}
+	}
+	return ErrUnknownWeighting
+}
+
+// Normalize trims the entries of a vocabulary and checks them: values are
+// distinct and not blank, and weights are finite and not negative
+func Normalize(entries models.VocabularyEntries) (models.VocabularyEntries, error) {
+	if len(entries) == 0 {
+		return nil, ErrNoEntries
+	}
+	if len(entries) > MaxEntries {
+		return nil, ErrTooManyEntries
+	}
+	seen := make(map[string]bool, len(entries))
+	out := make(models.VocabularyEntries, len(entries))
+	for i, e := range entries {
+		e.Value, e.Label = strings.TrimSpace(e.Value), strings.TrimSpace(e.Label)
+		if e.Value == "" || len(e.Value) > MaxValueLength || len(e.Label) > MaxLabelLength {
+			return nil, fmt.Errorf("%w: entry %d needs a value of at most %d characters and a label of at most %d",
+				ErrInvalidEntry, i+1, MaxValueLength, MaxLabelLength)
+		}
+		if e.Weight != nil && (math.IsNaN(*e.Weight) || math.IsInf(*e.Weight, 0) || *e.Weight < 0) {
+			return nil, fmt.Errorf("%w: weight of %s", ErrInvalidEntry, strconv.Quote(e.Value))
+		}
+		if seen[e.Value] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateEntry, strconv.Quote(e.Value))
+		}
+		seen[e.Value] = true
+		out[i] = e
+	}
+	return out, nil
+}
+
+// ParseCSV reads vocabulary entries from CSV. The header names the value
+// column as value or code, and optionally a label or description column and
+// a weight or frequency column.
+func ParseCSV(r io.Reader) (models.VocabularyEntries, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, ErrInvalidFile
+	}
+	value, label, weight := -1, -1, -1
+	for i, h := range header {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))) {
+		case "value", "code":
+			value = i
+		case "label", "description":
+			label = i
+		case "weight", "frequency":
+			weight = i
+		}
+	}
+	if value < 0 {
+		return nil, ErrInvalidFile
+	}
+	var out models.VocabularyEntries
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+		}
+		if len(out) == MaxEntries {
+			return nil, ErrTooManyEntries
+		}
+		e := models.VocabularyEntry{Value: field(record, value), Label: field(record, label)}
+		if w := field(record, weight); w != "" {
+			n, err := strconv.ParseFloat(w, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: weight on line %d is not a number", ErrInvalidEntry, line)
+			}
+			e.Weight = &n
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func field(record []string, i int) string {
+	if i < 0 || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
+
+// Resolve turns a binding into the rule generation follows. Source
+// weighting counts the vocabulary's values in rows; values never observed
+// stay approved but are not drawn.
+func Resolve(v *models.Vocabulary, b models.ColumnVocabulary, rows []map[string]interface{}) (agents.VocabularyColumn, error) {
+	out := agents.VocabularyColumn{
+		Column:     b.ColumnName,
+		Vocabulary: v.Name,
+		Weighting:  b.Weighting,
+		Values:     make([]string, len(v.Entries)),
+		Weights:    make([]float64, len(v.Entries)),
+	}
+	index := make(map[string]int, len(v.Entries))
+	for i, e := range v.Entries {
+		out.Values[i] = e.Value
+		index[e.Value] = i
+	}
+	total := 0.0
+	switch b.Weighting {
+	case WeightingUniform:
+		for i := range out.Weights {
+			out.Weights[i] = 1
+		}
+		total = float64(len(out.Weights))
+	case WeightingListed:
+		for i, e := range v.Entries {
+			out.Weights[i] = 1
+			if e.Weight != nil {
+				out.Weights[i] = *e.Weight
+			}
+			total += out.Weights[i]
+		}
+		if total == 0 {
+			return out, ErrNoWeights
+		}
+	case WeightingSource:
+		for _, row := range rows {
+			if i, ok := index[text(row[b.ColumnName])]; ok {
+				out.Weights[i]++
+				total++
+			}
+		}
+		if total == 0 {
+			return out, ErrNoSourceMatches
+		}
+	default:
+		return out, ErrUnknownWeighting
+	}
+	return out, nil
+}
+
+// Coverage is the share of the non-empty values of a column in rows that
+// are in the vocabulary, nil when there are none
+func Coverage(v *models.Vocabulary, column string, rows []map[string]interface{}) *float64 {
+	approved := make(map[string]bool, len(v.Entries))
+	for _, e := range v.Entries {
+		approved[e.Value] = true
+	}
+	var values, matched int
+	for _, row := range rows {
+		s := text(row[column])
+		if s == "" {
+			continue
+		}
+		values++
+		if approved[s] {
+			matched++
+		}
+	}
+	if values == 0 {
+		return nil
+	}
+	share := float64(matched) / float64(values)
+	return &share
+}
+
+// Apply adds vocabulary columns to a generation request, as columns whose
+// values are drawn from the vocabulary and as rules in the prompt. The most
+// frequent values are listed unless the column is restricted.
+func Apply(req *agents.GenerationRequest, columns []agents.VocabularyColumn) {
+	restricted := make(map[string]bool, len(req.RestrictedColumns))
+	for _, c := range req.RestrictedColumns {
+		restricted[strings.ToLower(c)] = true
+	}
+	for _, col := range columns {
+		req.SchemaAnalysis.Vocabularies = append(req.SchemaAnalysis.Vocabularies, col)
+		rule := fmt.Sprintf("%s takes only values of the controlled vocabulary %s", col.Column, strconv.Quote(col.Vocabulary))
+		if !restricted[strings.ToLower(col.Column)] {
+			rule += ", such as: " + strings.Join(leading(col), "; ")
+		}
+		req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints, rule)
+	}
+}
+
+// leading returns the values of a column that are drawn most often
+func leading(col agents.VocabularyColumn) []string {
+	order := make([]int, 0, len(col.Values))
+	for i := range col.Values {
+		if col.Weights[i] > 0 {
+			order = append(order, i)
+		}
+	}
+	sort.SliceStable(order, func(a, b int) bool { return col.Weights[order[a]] > col.Weights[order[b]] })
+	if len(order) > promptValues {
+		order = order[:promptValues]
+	}
+	out := make([]string, len(order))
+	for i, j := range order {
+		out[i] = col.Values[j]
+	}
+	return out
+}
+
+func text(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return strings.TrimSpace(fmt.Sprint(v))
+}
@@ -0,0 +1,142 @@
+// Package vocabulary_test provides unit tests for controlled vocabularies
+package vocabulary_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/vocabulary"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func weight(w float64) *float64 { return &w }
+
+func icd() *models.Vocabulary {
+	return &models.Vocabulary{Name: "ICD-10", Entries: models.VocabularyEntries{
+		{Value: "E11.9", Label: "Type 2 diabetes", Weight: weight(6)},
+		{Value: "I10", Label: "Hypertension", Weight: weight(3)},
+		{Value: "J45.909", Label: "Asthma", Weight: weight(1)},
+		{Value: "Z00.00", Weight: weight(0)},
+	}}
+}
+
+func TestParseCSV(t *testing.T) {
+	entries, err := vocabulary.ParseCSV(strings.NewReader("\ufeffCode,Description,Weight\nE11.9,Type 2 diabetes,6\nI10, Hypertension ,\n"))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, models.VocabularyEntry{Value: "E11.9", Label: "Type 2 diabetes", Weight: weight(6)}, entries[0])
+	assert.Equal(t, models.VocabularyEntry{Value: "I10", Label: "Hypertension"}, entries[1])
+
+	_, err = vocabulary.ParseCSV(strings.NewReader("label\nAsthma\n"))
+	assert.ErrorIs(t, err, vocabulary.ErrInvalidFile)
+	_, err = vocabulary.ParseCSV(strings.NewReader("value,weight\nA,often\n"))
+	assert.ErrorIs(t, err, vocabulary.ErrInvalidEntry)
+}
+
+func TestNormalize(t *testing.T) {
+	entries, err := vocabulary.Normalize(models.VocabularyEntries{{Value: " 541511 ", Label: " Custom programming "}})
+	require.NoError(t, err)
+	assert.Equal(t, "541511", entries[0].Value)
+	assert.Equal(t, "Custom programming", entries[0].Label)
+
+	cases := map[string]struct {
+		entries models.VocabularyEntries
+		err     error
+	}{
+		"empty":           {nil, vocabulary.ErrNoEntries},
+		"blank value":     {models.VocabularyEntries{{Value: " "}}, vocabulary.ErrInvalidEntry},
+		"negative weight": {models.VocabularyEntries{{Value: "A", Weight: weight(-1)}}, vocabulary.ErrInvalidEntry},
+		"duplicate":       {models.VocabularyEntries{{Value: "A"}, {Value: "A "}}, vocabulary.ErrDuplicateEntry},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := vocabulary.Normalize(tc.entries)
+			assert.ErrorIs(t, err, tc.err)
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	b := models.ColumnVocabulary{ColumnName: "diagnosis", Weighting: vocabulary.WeightingListed}
+	col, err := vocabulary.Resolve(icd(), b, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"E11.9", "I10", "J45.909", "Z00.00"}, col.Values)
+	assert.Equal(t, []float64{6, 3, 1, 0}, col.Weights)
+
+	b.Weighting = vocabulary.WeightingUniform
+	col, err = vocabulary.Resolve(icd(), b, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 1, 1, 1}, col.Weights)
+
+	b.Weighting = vocabulary.WeightingSource
+	rows := []map[string]interface{}{{"diagnosis": "I10"}, {"diagnosis": " I10"}, {"diagnosis": "Z00.00"}, {"diagnosis": "R51"}, {}}
+	col, err = vocabulary.Resolve(icd(), b, rows)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0, 2, 0, 1}, col.Weights)
+	_, err = vocabulary.Resolve(icd(), b, rows[3:])
+	assert.ErrorIs(t, err, vocabulary.ErrNoSourceMatches)
+
+	assert.InDelta(t, 0.75, *vocabulary.Coverage(icd(), "diagnosis", rows), 1e-9)
+	assert.Nil(t, vocabulary.Coverage(icd(), "diagnosis", rows[4:]))
+}
+
+func TestApply(t *testing.T) {
+	col, err := vocabulary.Resolve(icd(), models.ColumnVocabulary{ColumnName: "diagnosis", Weighting: vocabulary.WeightingListed}, nil)
+	require.NoError(t, err)
+	req := &agents.GenerationRequest{}
+	vocabulary.Apply(req, []agents.VocabularyColumn{col})
+	require.Len(t, req.SchemaAnalysis.Vocabularies, 1)
+	require.Len(t, req.SchemaAnalysis.Constraints, 1)
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], `"ICD-10"`)
+	// Values that are never drawn are not suggested
+	assert.Contains(t, req.SchemaAnalysis.Constraints[0], "E11.9; I10; J45.909")
+	assert.NotContains(t, req.SchemaAnalysis.Constraints[0], "Z00.00")
+
+	req = &agents.GenerationRequest{RestrictedColumns: []string{"Diagnosis"}}
+	vocabulary.Apply(req, []agents.VocabularyColumn{col})
+	assert.NotContains(t, req.SchemaAnalysis.Constraints[0], "E11.9")
+}
+
+func TestSamplerFollowsWeights(t *testing.T) {
+	col, err := vocabulary.Resolve(icd(), models.ColumnVocabulary{ColumnName: "diagnosis", Weighting: vocabulary.WeightingListed}, nil)
+	require.NoError(t, err)
+	columns := []agents.VocabularyColumn{col}
+	rows := make([]map[string]interface{}, 20000)
+	for i := range rows {
+		rows[i] = map[string]interface{}{"diagnosis": "made up", "age": float64(i % 90)}
+	}
+	rows = vocabulary.NewSampler(columns, 1).Filter(rows)
+
+	reports, err := vocabulary.Check(rows, columns)
+	require.NoError(t, err)
+	require.Len(t, reports, 1)
+	r := reports[0]
+	assert.Equal(t, int64(20000), r.Checked)
+	assert.Zero(t, r.OutOfVocabulary)
+	assert.Equal(t, 3, r.Distinct, "values of weight zero are never drawn")
+	assert.Equal(t, 4, r.Entries)
+	assert.Greater(t, r.Fidelity, 0.98)
+	assert.Equal(t, float64(0), rows[0]["age"], "other columns are kept")
+
+	// Draws repeat with the seed
+	again := []map[string]interface{}{{}, {}, {}}
+	first := []map[string]interface{}{{}, {}, {}}
+	vocabulary.NewSampler(columns, 7).Filter(first)
+	vocabulary.NewSampler(columns, 7).Filter(again)
+	assert.Equal(t, first, again)
+
+	assert.Nil(t, vocabulary.NewSampler(nil, 1))
+}
+
+func TestCheckFindsValuesOutsideTheVocabulary(t *testing.T) {
+	col, err := vocabulary.Resolve(icd(), models.ColumnVocabulary{ColumnName: "diagnosis", Weighting: vocabulary.WeightingUniform}, nil)
+	require.NoError(t, err)
+	rows := []map[string]interface{}{{"diagnosis": "I10"}, {"diagnosis": "R51"}, {}}
+	reports, err := vocabulary.Check(rows, []agents.VocabularyColumn{col})
+	assert.ErrorIs(t, err, vocabulary.ErrOutOfVocabulary)
+	assert.Equal(t, int64(2), reports[0].OutOfVocabulary)
+	assert.Equal(t, 1, reports[0].Distinct)
+}
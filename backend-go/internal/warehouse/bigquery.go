@@ -0,0 +1,140 @@
+package warehouse
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// bigQueryBatchRows caps the rows of one streaming insert request
+const bigQueryBatchRows = 500
+
+// googleTokenURI is the only token endpoint service account keys may name
+const googleTokenURI = "https://oauth2.googleapis.com/token"
+
+// checkServiceAccountKey accepts service account keys only. Other Google
+// credential files, such as external account configurations, make the
+// client fetch URLs or run commands they name.
+func checkServiceAccountKey(raw string) error {
+	var key struct {
+		Type        string `json:"type"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal([]byte(raw), &key); err != nil || key.Type != "service_account" || key.ClientEmail == "" || key.PrivateKey == "" {
+		return fmt.Errorf("%w: service_account_key must be a service account JSON key", ErrInvalidDestination)
+	}
+	if key.TokenURI != "" && key.TokenURI != googleTokenURI {
+		return fmt.Errorf("%w: service_account_key names an unknown token endpoint", ErrInvalidDestination)
+	}
+	return nil
+}
+
+type bigQueryConnector struct {
+	svc     *bigquery.Service
+	project string
+	dataset string
+}
+
+func openBigQuery(ctx context.Context, s models.WarehouseSettings, c Credentials, n Network) (*bigQueryConnector, error) {
+	base := n.HTTP
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	rt, err := htransport.NewTransport(ctx, base,
+		option.WithCredentialsJSON([]byte(c.ServiceAccountKey)), option.WithScopes(bigquery.BigqueryScope))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDestination, err)
+	}
+	svc, err := bigquery.NewService(ctx, option.WithHTTPClient(&http.Client{Transport: rt, Timeout: requestTimeout}))
+	if err != nil {
+		return nil, err
+	}
+	return &bigQueryConnector{svc: svc, project: s.ProjectID, dataset: s.Dataset}, nil
+}
+
+func (b *bigQueryConnector) Test(ctx context.Context) error {
+	_, err := b.svc.Datasets.Get(b.project, b.dataset).Context(ctx).Do()
+	return err
+}
+
+func (b *bigQueryConnector) Load(ctx context.Context, loadID, table string, schema export.Schema, rows []map[string]any) (int64, error) {
+	cols := columns(schema)
+	if err := b.ensureTable(ctx, table, cols); err != nil {
+		return 0, err
+	}
+	var loaded int64
+	err := batches(len(rows), bigQueryBatchRows, func(from, to int) error {
+		req := &bigquery.TableDataInsertAllRequest{Rows: make([]*bigquery.TableDataInsertAllRequestRows, 0, to-from)}
+		for i := from; i < to; i++ {
+			values := make(map[string]bigquery.JsonValue, len(cols))
+			for _, col := range cols {
+				v, err := export.Value(col.Column, rows[i][col.Name])
+				if err != nil {
+					return err
+				}
+				if v != nil {
+					values[col.name] = v
+				}
+			}
+			req.Rows = append(req.Rows, &bigquery.TableDataInsertAllRequestRows{InsertId: loadID + "-" + strconv.Itoa(i), Json: values})
+		}
+		resp, err := b.svc.Tabledata.InsertAll(b.project, b.dataset, table, req).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		if len(resp.InsertErrors) > 0 && len(resp.InsertErrors[0].Errors) > 0 {
+			first := resp.InsertErrors[0]
+			return fmt.Errorf("bigquery rejected %d rows, row %d: %s", len(resp.InsertErrors), int(first.Index)+from, first.Errors[0].Message)
+		}
+		loaded += int64(to - from)
+		return nil
+	})
+	return loaded, err
+}
+
+// ensureTable creates a missing table with the columns of the rows
+func (b *bigQueryConnector) ensureTable(ctx context.Context, table string, cols []column) error {
+	_, err := b.svc.Tables.Get(b.project, b.dataset, table).Context(ctx).Do()
+	var gerr *googleapi.Error
+	if err == nil || !errors.As(err, &gerr) || gerr.Code != http.StatusNotFound {
+		return err
+	}
+	fields := make([]*bigquery.TableFieldSchema, len(cols))
+	for i, col := range cols {
+		fields[i] = &bigquery.TableFieldSchema{Name: col.name, Type: bigQueryType(col.Type), Mode: "NULLABLE"}
+	}
+	_, err = b.svc.Tables.Insert(b.project, b.dataset, &bigquery.Table{
+		TableReference: &bigquery.TableReference{ProjectId: b.project, DatasetId: b.dataset, TableId: table},
+		Schema:         &bigquery.TableSchema{Fields: fields},
+	}).Context(ctx).Do()
+	if errors.As(err, &gerr) && gerr.Code == http.StatusConflict {
+		return nil
+	}
+	return err
+}
+
+func bigQueryType(t export.Type) string {
+	switch t {
+	case export.TypeInt:
+		return "INT64"
+	case export.TypeFloat:
+		return "FLOAT64"
+	case export.TypeBool:
+		return "BOOL"
+	}
+	return "STRING"
+}
+
+func (b *bigQueryConnector) Close() error { return nil }
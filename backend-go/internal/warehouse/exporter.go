@@ -0,0 +1,199 @@
+package warehouse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
+	"go.uber.org/zap"
+)
+
+// Store persists deliveries and the outcome of their attempts
+type Store interface {
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.WarehouseDelivery, error)
+	DestinationByID(ctx context.Context, id int64) (*models.WarehouseDestination, error)
+	RecordAttempt(ctx context.Context, id int64, status models.WarehouseDeliveryStatus, rows int64, lastError *string, next time.Time) error
+}
+
+// Outputs reads the rows of a user's completed job
+type Outputs interface {
+	Rows(ctx context.Context, userID, jobID int64) ([]map[string]any, error)
+}
+
+// Config tunes exports
+type Config struct {
+	// BatchSize caps the deliveries claimed per poll
+	BatchSize    int
+	PollInterval time.Duration
+	// Timeout bounds one load
+	Timeout time.Duration
+	// Failed loads are retried after BaseBackoff, doubling up to
+	// MaxBackoff, until MaxAttempts have been made
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		BatchSize:    5,
+		PollInterval: 10 * time.Second,
+		Timeout:      15 * time.Minute,
+		BaseBackoff:  time.Minute,
+		MaxBackoff:   6 * time.Hour,
+		MaxAttempts:  6,
+	}
+}
+
+// Exporter loads queued job outputs into their destinations in the
+// background
+type Exporter struct {
+	store    Store
+	outputs  Outputs
+	envelope *storage.Envelope
+	network  Network
+	cfg      Config
+	logger   *zap.Logger
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewExporter(store Store, outputs Outputs, envelope *storage.Envelope, network Network, cfg Config, logger *zap.Logger) *Exporter {
+	def := DefaultConfig()
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = def.PollInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = def.Timeout
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = def.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = def.MaxAttempts
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Exporter{store: store, outputs: outputs, envelope: envelope, network: network, cfg: cfg, logger: logger}
+}
+
+// Start polls for due deliveries until Stop is called or ctx ends
+func (e *Exporter) Start(ctx context.Context) {
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		for {
+			n, err := e.RunOnce(ctx)
+			if err != nil && ctx.Err() == nil {
+				e.logger.Error("warehouse export failed", zap.Error(err))
+			}
+			if n == e.cfg.BatchSize {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(e.cfg.PollInterval):
+			}
+		}
+	}()
+}
+
+// Stop cancels polling and waits for loads in flight
+func (e *Exporter) Stop() {
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.wg.Wait()
+}
+
+// RunOnce attempts the deliveries due now and returns how many it claimed
+func (e *Exporter) RunOnce(ctx context.Context) (int, error) {
+	due, err := e.store.ClaimDue(ctx, e.cfg.BatchSize, 2*e.cfg.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim warehouse deliveries: %w", err)
+	}
+	var wg sync.WaitGroup
+	for _, delivery := range due {
+		wg.Add(1)
+		go func(delivery models.WarehouseDelivery) {
+			defer wg.Done()
+			e.attempt(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+	return len(due), nil
+}
+
+func (e *Exporter) attempt(ctx context.Context, delivery models.WarehouseDelivery) {
+	ctx, cancel := context.WithTimeout(ctx, e.cfg.Timeout)
+	defer cancel()
+	attempt := delivery.Attempts + 1
+	rows, err := e.load(ctx, delivery)
+	if err == nil {
+		e.record(ctx, delivery.ID, models.WarehouseDeliveryDelivered, rows, nil, time.Now())
+		return
+	}
+	msg := err.Error()
+	// Outputs that cannot be read and rows a table cannot hold fail the
+	// same way every time
+	permanent := errors.Is(err, ErrOutputUnavailable) || errors.Is(err, ErrInvalidDestination) || errors.Is(err, export.ErrTypeMismatch)
+	if permanent || attempt >= e.cfg.MaxAttempts {
+		e.logger.Info("warehouse export failed", zap.Int64("delivery_id", delivery.ID), zap.Int("attempts", attempt), zap.Error(err))
+		e.record(ctx, delivery.ID, models.WarehouseDeliveryFailed, rows, &msg, time.Now())
+		return
+	}
+	next := time.Now().Add(webhooks.Backoff(e.cfg.BaseBackoff, e.cfg.MaxBackoff, attempt))
+	e.record(ctx, delivery.ID, models.WarehouseDeliveryPending, rows, &msg, next)
+}
+
+// load loads a delivery's job into its table
+func (e *Exporter) load(ctx context.Context, delivery models.WarehouseDelivery) (int64, error) {
+	dest, err := e.store.DestinationByID(ctx, delivery.DestinationID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load destination: %w", err)
+	}
+	if e.envelope == nil {
+		return 0, fmt.Errorf("%w: credentials cannot be decrypted", ErrInvalidDestination)
+	}
+	creds, err := OpenCredentials(e.envelope, dest)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidDestination, err)
+	}
+	rows, err := e.outputs.Rows(ctx, delivery.UserID, delivery.JobID)
+	if err != nil {
+		return 0, err
+	}
+	conn, err := Open(ctx, dest.Kind, dest.Settings, creds, e.network)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	loadID := "synthos-" + strconv.FormatInt(delivery.ID, 10)
+	return conn.Load(ctx, loadID, delivery.TableName, export.InferSchema(rows), rows)
+}
+
+func (e *Exporter) record(ctx context.Context, id int64, status models.WarehouseDeliveryStatus, rows int64, lastError *string, next time.Time) {
+	// The outcome is recorded even when the load used up its time
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := e.store.RecordAttempt(ctx, id, status, rows, lastError, next); err != nil {
+		e.logger.Warn("failed to record warehouse export", zap.Int64("delivery_id", id), zap.Error(err))
+	}
+}
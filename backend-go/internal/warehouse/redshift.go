@@ -0,0 +1,153 @@
+package warehouse
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/lib/pq"
+)
+
+// redshiftPort is the default port of Redshift clusters
+const redshiftPort = 5439
+
+// redshiftMaxParams is the most parameters one statement may bind
+const redshiftMaxParams = 32767
+
+// redshiftBatchRows caps the rows of one multi-row insert
+const redshiftBatchRows = 500
+
+// redshiftConnector loads rows over the PostgreSQL protocol Redshift
+// speaks, with TLS verified against the system roots
+type redshiftConnector struct {
+	db     *sql.DB
+	schema string
+}
+
+// dialer adapts a dial function to the driver's dialer interfaces
+type dialer func(ctx context.Context, network, addr string) (net.Conn, error)
+
+func (d dialer) Dial(network, addr string) (net.Conn, error) {
+	return d(context.Background(), network, addr)
+}
+
+func (d dialer) DialTimeout(network, addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return d(ctx, network, addr)
+}
+
+func (d dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return d(ctx, network, addr)
+}
+
+func openRedshift(s models.WarehouseSettings, c Credentials, n Network) (*redshiftConnector, error) {
+	port := s.Port
+	if port == 0 {
+		port = redshiftPort
+	}
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(s.User, c.Password),
+		Host:     net.JoinHostPort(s.Host, strconv.Itoa(port)),
+		Path:     "/" + s.Database,
+		RawQuery: "sslmode=verify-full&connect_timeout=10",
+	}
+	connector, err := pq.NewConnector(dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDestination, err)
+	}
+	if n.Dial != nil {
+		connector.Dialer(dialer(n.Dial))
+	}
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(1)
+	schema := s.Schema
+	if schema == "" {
+		schema = "public"
+	}
+	return &redshiftConnector{db: db, schema: schema}, nil
+}
+
+func (r *redshiftConnector) Test(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+func (r *redshiftConnector) Load(ctx context.Context, loadID, table string, schema export.Schema, rows []map[string]any) (int64, error) {
+	cols := columns(schema)
+	if len(cols) == 0 {
+		return 0, nil
+	}
+	create, insert := redshiftStatements(r.schema, table, cols)
+	size := min(redshiftBatchRows, redshiftMaxParams/len(cols))
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, create); err != nil {
+		return 0, err
+	}
+	// Rows are loaded in one transaction, so a failed load leaves none
+	// behind to be loaded again on retry
+	err = batches(len(rows), size, func(from, to int) error {
+		args := make([]any, 0, (to-from)*len(cols))
+		tuples := make([]string, 0, to-from)
+		for i := from; i < to; i++ {
+			marks := make([]string, len(cols))
+			for j, col := range cols {
+				v, err := export.Value(col.Column, rows[i][col.Name])
+				if err != nil {
+					return err
+				}
+				args = append(args, v)
+				marks[j] = "$" + strconv.Itoa(len(args))
+			}
+			tuples = append(tuples, "("+strings.Join(marks, ", ")+")")
+		}
+		_, err := tx.ExecContext(ctx, insert+strings.Join(tuples, ", "), args...)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(rows)), nil
+}
+
+// redshiftStatements returns the statement creating a table for cols and
+// the start of a multi-row insert into it
+func redshiftStatements(schema, table string, cols []column) (string, string) {
+	target := quote(schema) + "." + quote(strings.ToLower(table))
+	defs := make([]string, len(cols))
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = quote(col.name)
+		defs[i] = names[i] + " " + redshiftType(col.Type)
+	}
+	return "CREATE TABLE IF NOT EXISTS " + target + " (" + strings.Join(defs, ", ") + ")",
+		"INSERT INTO " + target + " (" + strings.Join(names, ", ") + ") VALUES "
+}
+
+func redshiftType(t export.Type) string {
+	switch t {
+	case export.TypeInt:
+		return "BIGINT"
+	case export.TypeFloat:
+		return "DOUBLE PRECISION"
+	case export.TypeBool:
+		return "BOOLEAN"
+	}
+	return "VARCHAR(65535)"
+}
+
+func (r *redshiftConnector) Close() error { return r.db.Close() }
@@ -0,0 +1,265 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// snowflakeBatchRows caps the rows bound to one insert statement
+const snowflakeBatchRows = 1000
+
+// snowflakePoll is how often a statement still running is checked
+const snowflakePoll = time.Second
+
+// parsePrivateKey reads an unencrypted PKCS#8 or PKCS#1 RSA private key
+func parsePrivateKey(raw string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(raw))
+	if block == nil {
+		return nil, errors.New("private_key must be a PEM encoded RSA key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.New("private_key must be an unencrypted RSA key")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private_key must be an RSA key")
+	}
+	return rsaKey, nil
+}
+
+// snowflakeConnector runs statements through the Snowflake SQL API,
+// authenticating with key pair JWTs
+type snowflakeConnector struct {
+	client   *http.Client
+	baseURL  string
+	settings models.WarehouseSettings
+	key      *rsa.PrivateKey
+	// issuer and subject identify the user's key to Snowflake
+	issuer  string
+	subject string
+}
+
+func openSnowflake(s models.WarehouseSettings, c Credentials, n Network) (*snowflakeConnector, error) {
+	key, err := parsePrivateKey(c.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDestination, err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(pub)
+	// The JWT names the account without its region or cloud
+	account, _, _ := strings.Cut(strings.ToUpper(s.Account), ".")
+	subject := account + "." + strings.ToUpper(s.User)
+	return &snowflakeConnector{
+		client:   &http.Client{Transport: n.HTTP, Timeout: requestTimeout},
+		baseURL:  "https://" + strings.ToLower(s.Account) + ".snowflakecomputing.com",
+		settings: s,
+		key:      key,
+		issuer:   subject + ".SHA256:" + base64.StdEncoding.EncodeToString(sum[:]),
+		subject:  subject,
+	}, nil
+}
+
+func (sf *snowflakeConnector) Test(ctx context.Context) error {
+	return sf.exec(ctx, "SELECT 1", nil)
+}
+
+func (sf *snowflakeConnector) Load(ctx context.Context, loadID, table string, schema export.Schema, rows []map[string]any) (int64, error) {
+	cols := columns(schema)
+	if len(cols) == 0 {
+		return 0, nil
+	}
+	defs := make([]string, len(cols))
+	names := make([]string, len(cols))
+	marks := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = quote(strings.ToUpper(col.name))
+		defs[i] = names[i] + " " + snowflakeType(col.Type)
+		marks[i] = "?"
+	}
+	target := quote(strings.ToUpper(table))
+	if err := sf.exec(ctx, "CREATE TABLE IF NOT EXISTS "+target+" ("+strings.Join(defs, ", ")+")", nil); err != nil {
+		return 0, err
+	}
+	insert := "INSERT INTO " + target + " (" + strings.Join(names, ", ") + ") VALUES (" + strings.Join(marks, ", ") + ")"
+	var loaded int64
+	err := batches(len(rows), snowflakeBatchRows, func(from, to int) error {
+		// Array bindings insert one row per element
+		bindings := make(map[string]snowflakeBinding, len(cols))
+		for i, col := range cols {
+			values := make([]*string, to-from)
+			for r := from; r < to; r++ {
+				v, err := export.Value(col.Column, rows[r][col.Name])
+				if err != nil {
+					return err
+				}
+				if v != nil {
+					s := bindText(v)
+					values[r-from] = &s
+				}
+			}
+			bindings[strconv.Itoa(i+1)] = snowflakeBinding{Type: snowflakeBindType(col.Type), Value: values}
+		}
+		if err := sf.exec(ctx, insert, bindings); err != nil {
+			return err
+		}
+		loaded += int64(to - from)
+		return nil
+	})
+	return loaded, err
+}
+
+type snowflakeBinding struct {
+	Type  string    `json:"type"`
+	Value []*string `json:"value"`
+}
+
+type snowflakeStatement struct {
+	Statement string                      `json:"statement"`
+	Timeout   int                         `json:"timeout"`
+	Database  string                      `json:"database,omitempty"`
+	Schema    string                      `json:"schema,omitempty"`
+	Warehouse string                      `json:"warehouse,omitempty"`
+	Role      string                      `json:"role,omitempty"`
+	Bindings  map[string]snowflakeBinding `json:"bindings,omitempty"`
+}
+
+// exec runs a statement and waits for it to finish
+func (sf *snowflakeConnector) exec(ctx context.Context, statement string, bindings map[string]snowflakeBinding) error {
+	body, err := json.Marshal(snowflakeStatement{
+		Statement: statement,
+		Timeout:   int(requestTimeout / time.Second),
+		Database:  sf.settings.Database,
+		Schema:    sf.settings.Schema,
+		Warehouse: sf.settings.Warehouse,
+		Role:      sf.settings.Role,
+		Bindings:  bindings,
+	})
+	if err != nil {
+		return err
+	}
+	status, handle, err := sf.do(ctx, http.MethodPost, "/api/v2/statements", body)
+	for err == nil && status == http.StatusAccepted {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(snowflakePoll):
+		}
+		status, handle, err = sf.do(ctx, http.MethodGet, "/api/v2/statements/"+handle, nil)
+	}
+	return err
+}
+
+// do sends one request to the SQL API and returns its status with the
+// statement handle
+func (sf *snowflakeConnector) do(ctx context.Context, method, path string, body []byte) (int, string, error) {
+	token, err := sf.token(time.Now())
+	if err != nil {
+		return 0, "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, sf.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Snowflake-Authorization-Token-Type", "KEYPAIR_JWT")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "Synthos-Warehouse/1.0")
+	resp, err := sf.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	var out struct {
+		Code            string `json:"code"`
+		Message         string `json:"message"`
+		StatementHandle string `json:"statementHandle"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	_ = json.Unmarshal(raw, &out)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		if out.Message == "" {
+			out.Message = http.StatusText(resp.StatusCode)
+		}
+		return resp.StatusCode, "", fmt.Errorf("snowflake returned status %d: %s", resp.StatusCode, out.Message)
+	}
+	if resp.StatusCode == http.StatusAccepted && out.StatementHandle == "" {
+		return resp.StatusCode, "", errors.New("snowflake returned no statement handle")
+	}
+	return resp.StatusCode, out.StatementHandle, nil
+}
+
+// token returns a key pair JWT valid for an hour
+func (sf *snowflakeConnector) token(now time.Time) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss": sf.issuer,
+		"sub": sf.subject,
+		"iat": now.Unix(),
+		"exp": now.Add(59 * time.Minute).Unix(),
+	}).SignedString(sf.key)
+}
+
+func snowflakeType(t export.Type) string {
+	switch t {
+	case export.TypeInt:
+		return "NUMBER(38,0)"
+	case export.TypeFloat:
+		return "FLOAT"
+	case export.TypeBool:
+		return "BOOLEAN"
+	}
+	return "VARCHAR"
+}
+
+func snowflakeBindType(t export.Type) string {
+	switch t {
+	case export.TypeInt:
+		return "FIXED"
+	case export.TypeFloat:
+		return "REAL"
+	case export.TypeBool:
+		return "BOOLEAN"
+	}
+	return "TEXT"
+}
+
+// bindText is a converted value as the SQL API binds it
+func bindText(v any) string {
+	switch x := v.(type) {
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	case string:
+		return x
+	}
+	return fmt.Sprint(v)
+}
+
+func (sf *snowflakeConnector) Close() error { return nil }
@@ -0,0 +1,220 @@
+// Package warehouse loads the rows of completed generation jobs into
+// customers' data warehouses: a BigQuery dataset, a Snowflake schema or a
+// Redshift database. Customers supply the credentials, which are sealed
+// under the output master keys. Exports are queued per destination and job
+// and loaded in the background with retries, each keeping its status.
+// Tables are created when missing, with a column per output column typed
+// from its values.
+package warehouse
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+)
+
+// Destination kinds
+const (
+	KindBigQuery  = "bigquery"
+	KindSnowflake = "snowflake"
+	KindRedshift  = "redshift"
+)
+
+// Kinds are the warehouses connectors exist for
+var Kinds = []string{KindBigQuery, KindSnowflake, KindRedshift}
+
+var (
+	ErrInvalidDestination = errors.New("invalid warehouse destination")
+	// ErrOutputUnavailable is returned for a job whose output cannot be
+	// read, such as an encrypted output without an active access grant;
+	// its export is not retried
+	ErrOutputUnavailable = errors.New("job output unavailable")
+)
+
+// Credentials authenticate to a destination. They are only kept sealed.
+type Credentials struct {
+	// ServiceAccountKey is the JSON key of a BigQuery service account
+	ServiceAccountKey string `json:"service_account_key,omitempty"`
+	// PrivateKey is the unencrypted PEM private key of a Snowflake user's
+	// RSA key pair
+	PrivateKey string `json:"private_key,omitempty"`
+	// Password is a Redshift user's password
+	Password string `json:"password,omitempty"`
+}
+
+// Connector loads rows into one destination
+type Connector interface {
+	// Test checks the destination can be reached with its credentials
+	Test(ctx context.Context) error
+	// Load creates table when it is missing and appends rows to it,
+	// returning how many were loaded. loadID identifies the load, so
+	// destinations that deduplicate inserts skip rows of a retried load.
+	Load(ctx context.Context, loadID, table string, schema export.Schema, rows []map[string]any) (int64, error)
+	Close() error
+}
+
+// Network carries connections to destinations, such as through an egress
+// policy; nil fields use the defaults
+type Network struct {
+	HTTP http.RoundTripper
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// requestTimeout bounds one request to a destination
+const requestTimeout = 2 * time.Minute
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,127}$`)
+	projectPattern    = regexp.MustCompile(`^[a-z][a-z0-9-]{4,28}[a-z0-9]$`)
+	accountPattern    = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,254}$`)
+	hostPattern       = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]{0,251}[A-Za-z0-9])?$`)
+)
+
+// ValidTable reports whether name can be used as a table name in every
+// warehouse: letters, digits and underscores, not starting with a digit
+func ValidTable(name string) bool {
+	return identifierPattern.MatchString(name)
+}
+
+// Validate checks the settings and credentials of a destination of kind
+func Validate(kind string, s models.WarehouseSettings, c Credentials) error {
+	invalid := func(msg string) error { return fmt.Errorf("%w: %s", ErrInvalidDestination, msg) }
+	if s.Table != "" && !ValidTable(s.Table) {
+		return invalid("table must be letters, digits and underscores")
+	}
+	switch kind {
+	case KindBigQuery:
+		if !projectPattern.MatchString(s.ProjectID) {
+			return invalid("project_id is not a Google Cloud project ID")
+		}
+		if !identifierPattern.MatchString(s.Dataset) {
+			return invalid("dataset must be letters, digits and underscores")
+		}
+		return checkServiceAccountKey(c.ServiceAccountKey)
+	case KindSnowflake:
+		if !accountPattern.MatchString(s.Account) || strings.Contains(s.Account, "..") {
+			return invalid("account is not a Snowflake account identifier")
+		}
+		if s.User == "" || !identifierPattern.MatchString(s.Database) || !identifierPattern.MatchString(s.Schema) {
+			return invalid("user, database and schema are required")
+		}
+		if (s.Warehouse != "" && !identifierPattern.MatchString(s.Warehouse)) || (s.Role != "" && !identifierPattern.MatchString(s.Role)) {
+			return invalid("warehouse and role must be letters, digits and underscores")
+		}
+		if _, err := parsePrivateKey(c.PrivateKey); err != nil {
+			return invalid(err.Error())
+		}
+	case KindRedshift:
+		if !hostPattern.MatchString(s.Host) || s.Port < 0 || s.Port > 65535 {
+			return invalid("host and port must name a cluster endpoint")
+		}
+		if s.User == "" || !identifierPattern.MatchString(s.Database) || (s.Schema != "" && !identifierPattern.MatchString(s.Schema)) {
+			return invalid("user and database are required")
+		}
+		if c.Password == "" {
+			return invalid("password is required")
+		}
+	default:
+		return invalid("unknown kind " + strconv.Quote(kind))
+	}
+	return nil
+}
+
+// Open returns a connector for a destination of kind
+func Open(ctx context.Context, kind string, s models.WarehouseSettings, c Credentials, n Network) (Connector, error) {
+	if err := Validate(kind, s, c); err != nil {
+		return nil, err
+	}
+	switch kind {
+	case KindBigQuery:
+		return openBigQuery(ctx, s, c, n)
+	case KindSnowflake:
+		return openSnowflake(s, c, n)
+	default:
+		return openRedshift(s, c, n)
+	}
+}
+
+// SealCredentials encrypts credentials with a fresh data key and returns
+// them with the key wrapped under the envelope's active master key
+func SealCredentials(env *storage.Envelope, c Credentials) (sealed, wrappedKey, masterKeyID string, err error) {
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return "", "", "", err
+	}
+	plain, wrappedKey, masterKeyID, err := env.NewDataKey()
+	if err != nil {
+		return "", "", "", err
+	}
+	out, err := storage.Seal(plain, raw)
+	if err != nil {
+		return "", "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(out), wrappedKey, masterKeyID, nil
+}
+
+// OpenCredentials decrypts the credentials of a destination
+func OpenCredentials(env *storage.Envelope, d *models.WarehouseDestination) (Credentials, error) {
+	var c Credentials
+	plain, err := env.Unwrap(d.MasterKeyID, d.WrappedKey)
+	if err != nil {
+		return c, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(d.Credentials)
+	if err != nil {
+		return c, fmt.Errorf("invalid sealed credentials: %w", err)
+	}
+	raw, err := storage.Open(plain, sealed)
+	if err != nil {
+		return c, fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+	return c, json.Unmarshal(raw, &c)
+}
+
+// column is an output column under its name in the warehouse
+type column struct {
+	export.Column
+	name string
+}
+
+// columns names the columns of schema in lower case, as warehouses that
+// ignore case would otherwise see names differing only in case as one
+func columns(schema export.Schema) []column {
+	lower := make(export.Schema, len(schema))
+	for i, col := range schema {
+		lower[i] = export.Column{Name: strings.ToLower(col.Name), Type: col.Type}
+	}
+	names := export.SafeNames(lower)
+	out := make([]column, len(schema))
+	for i, col := range schema {
+		out[i] = column{Column: col, name: names[i]}
+	}
+	return out
+}
+
+// quote quotes an identifier for Snowflake and Redshift
+func quote(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// batches splits n rows into runs of at most size
+func batches(n, size int, fn func(from, to int) error) error {
+	for from := 0; from < n; from += size {
+		if err := fn(from, min(from+size, n)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// Package warehouse_test provides unit tests for warehouse destinations and exports
+package warehouse_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/export"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/warehouse"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func privateKeyPEM(t *testing.T) (string, *rsa.PrivateKey) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), key
+}
+
+func TestValidate(t *testing.T) {
+	pemKey, _ := privateKeyPEM(t)
+	snowflake := models.WarehouseSettings{Account: "xy12345.eu-west-1", User: "loader", Database: "ANALYTICS", Schema: "PUBLIC", Table: "people"}
+	redshift := models.WarehouseSettings{Host: "cluster.abc.eu-west-1.redshift.amazonaws.com", User: "loader", Database: "dev"}
+
+	assert.NoError(t, warehouse.Validate(warehouse.KindSnowflake, snowflake, warehouse.Credentials{PrivateKey: pemKey}))
+	assert.NoError(t, warehouse.Validate(warehouse.KindRedshift, redshift, warehouse.Credentials{Password: "secret"}))
+
+	cases := map[string]struct {
+		kind     string
+		settings models.WarehouseSettings
+		creds    warehouse.Credentials
+	}{
+		"unknown kind":         {"oracle", redshift, warehouse.Credentials{Password: "secret"}},
+		"table with a quote":   {warehouse.KindRedshift, models.WarehouseSettings{Host: redshift.Host, User: "loader", Database: "dev", Table: `a"b`}, warehouse.Credentials{Password: "secret"}},
+		"host with a path":     {warehouse.KindRedshift, models.WarehouseSettings{Host: "evil.com/x", User: "loader", Database: "dev"}, warehouse.Credentials{Password: "secret"}},
+		"missing password":     {warehouse.KindRedshift, redshift, warehouse.Credentials{}},
+		"account with a slash": {warehouse.KindSnowflake, models.WarehouseSettings{Account: "evil.com/x", User: "loader", Database: "A", Schema: "B"}, warehouse.Credentials{PrivateKey: pemKey}},
+		"not a key":            {warehouse.KindSnowflake, snowflake, warehouse.Credentials{PrivateKey: "nope"}},
+		"external account": {warehouse.KindBigQuery, models.WarehouseSettings{ProjectID: "my-project", Dataset: "synthetic"},
+			warehouse.Credentials{ServiceAccountKey: `{"type":"external_account","credential_source":{"url":"http://169.254.169.254/"}}`}},
+		"foreign token endpoint": {warehouse.KindBigQuery, models.WarehouseSettings{ProjectID: "my-project", Dataset: "synthetic"},
+			warehouse.Credentials{ServiceAccountKey: `{"type":"service_account","client_email":"a@b","private_key":"k","token_uri":"https://evil.example/token"}`}},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, warehouse.Validate(tc.kind, tc.settings, tc.creds), warehouse.ErrInvalidDestination)
+		})
+	}
+
+	assert.True(t, warehouse.ValidTable("synthetic_people_2024"))
+	assert.False(t, warehouse.ValidTable("1people"))
+	assert.False(t, warehouse.ValidTable("people; DROP TABLE users"))
+}
+
+func TestCredentialsRoundTrip(t *testing.T) {
+	env, err := storage.NewEnvelope("a", map[string][]byte{"a": []byte("0123456789abcdef0123456789abcdef")})
+	require.NoError(t, err)
+
+	sealed, wrapped, kid, err := warehouse.SealCredentials(env, warehouse.Credentials{Password: "hunter2"})
+	require.NoError(t, err)
+	assert.Equal(t, "a", kid)
+	assert.NotContains(t, sealed, "hunter2")
+
+	creds, err := warehouse.OpenCredentials(env, &models.WarehouseDestination{Credentials: sealed, WrappedKey: wrapped, MasterKeyID: kid})
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", creds.Password)
+}
+
+// snowflakeAPI records the statements sent to the SQL API
+type snowflakeAPI struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []map[string]any
+}
+
+func (s *snowflakeAPI) RoundTrip(req *http.Request) (*http.Response, error) {
+	raw, _ := io.ReadAll(req.Body)
+	var body map[string]any
+	_ = json.Unmarshal(raw, &body)
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	s.bodies = append(s.bodies, body)
+	s.mu.Unlock()
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"code":"090001","statementHandle":"h"}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestSnowflakeLoad(t *testing.T) {
+	pemKey, key := privateKeyPEM(t)
+	api := &snowflakeAPI{}
+	settings := models.WarehouseSettings{Account: "xy12345.eu-west-1", User: "loader", Database: "ANALYTICS", Schema: "PUBLIC", Warehouse: "LOAD_WH"}
+
+	conn, err := warehouse.Open(context.Background(), warehouse.KindSnowflake, settings, warehouse.Credentials{PrivateKey: pemKey}, warehouse.Network{HTTP: api})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	rows := []map[string]any{{"Age": 41.0, "name": "Ada"}, {"Age": nil, "name": "Grace"}}
+	n, err := conn.Load(context.Background(), "synthos-1", "people", export.InferSchema(rows), rows)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, n)
+
+	require.Len(t, api.requests, 2)
+	req := api.requests[0]
+	assert.Equal(t, "https://xy12345.eu-west-1.snowflakecomputing.com/api/v2/statements", req.URL.String())
+	assert.Equal(t, "KEYPAIR_JWT", req.Header.Get("X-Snowflake-Authorization-Token-Type"))
+	token, err := jwt.Parse(strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "), func(*jwt.Token) (any, error) { return &key.PublicKey, nil })
+	require.NoError(t, err)
+	sub, _ := token.Claims.GetSubject()
+	iss, _ := token.Claims.GetIssuer()
+	assert.Equal(t, "XY12345.LOADER", sub)
+	assert.True(t, strings.HasPrefix(iss, "XY12345.LOADER.SHA256:"))
+
+	assert.Equal(t, `CREATE TABLE IF NOT EXISTS "PEOPLE" ("AGE" NUMBER(38,0), "NAME" VARCHAR)`, api.bodies[0]["statement"])
+	assert.Equal(t, "LOAD_WH", api.bodies[0]["warehouse"])
+	assert.Equal(t, `INSERT INTO "PEOPLE" ("AGE", "NAME") VALUES (?, ?)`, api.bodies[1]["statement"])
+	bindings := api.bodies[1]["bindings"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "FIXED", "value": []any{"41", nil}}, bindings["1"])
+	assert.Equal(t, map[string]any{"type": "TEXT", "value": []any{"Ada", "Grace"}}, bindings["2"])
+}
+
+type store struct {
+	mu         sync.Mutex
+	due        []models.WarehouseDelivery
+	dest       *models.WarehouseDestination
+	statuses   []models.WarehouseDeliveryStatus
+	lastErrors []string
+	next       []time.Time
+}
+
+func (s *store) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.WarehouseDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := s.due
+	s.due = nil
+	return due, nil
+}
+
+func (s *store) DestinationByID(ctx context.Context, id int64) (*models.WarehouseDestination, error) {
+	return s.dest, nil
+}
+
+func (s *store) RecordAttempt(ctx context.Context, id int64, status models.WarehouseDeliveryStatus, rows int64, lastError *string, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses = append(s.statuses, status)
+	msg := ""
+	if lastError != nil {
+		msg = *lastError
+	}
+	s.lastErrors = append(s.lastErrors, msg)
+	s.next = append(s.next, next)
+	return nil
+}
+
+type outputs struct{ err error }
+
+func (o outputs) Rows(ctx context.Context, userID, jobID int64) ([]map[string]any, error) {
+	return nil, o.err
+}
+
+func TestExporterRetries(t *testing.T) {
+	env, err := storage.NewEnvelope("a", map[string][]byte{"a": []byte("0123456789abcdef0123456789abcdef")})
+	require.NoError(t, err)
+	sealed, wrapped, kid, err := warehouse.SealCredentials(env, warehouse.Credentials{Password: "secret"})
+	require.NoError(t, err)
+	dest := &models.WarehouseDestination{ID: 3, Kind: warehouse.KindRedshift, Credentials: sealed, WrappedKey: wrapped, MasterKeyID: kid,
+		Settings: models.WarehouseSettings{Host: "cluster.example.com", User: "loader", Database: "dev"}}
+
+	t.Run("outputs that cannot be read fail at once", func(t *testing.T) {
+		s := &store{due: []models.WarehouseDelivery{{ID: 1, DestinationID: 3, JobID: 9, UserID: 2}}, dest: dest}
+		e := warehouse.NewExporter(s, outputs{err: warehouse.ErrOutputUnavailable}, env, warehouse.Network{}, warehouse.Config{}, nil)
+		n, err := e.RunOnce(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+		assert.Equal(t, []models.WarehouseDeliveryStatus{models.WarehouseDeliveryFailed}, s.statuses)
+	})
+
+	t.Run("other failures are retried later", func(t *testing.T) {
+		s := &store{due: []models.WarehouseDelivery{{ID: 1, DestinationID: 3, JobID: 9, UserID: 2}}, dest: dest}
+		e := warehouse.NewExporter(s, outputs{err: errors.New("storage unavailable")}, env, warehouse.Network{}, warehouse.Config{BaseBackoff: time.Minute}, nil)
+		_, err := e.RunOnce(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []models.WarehouseDeliveryStatus{models.WarehouseDeliveryPending}, s.statuses)
+		assert.Equal(t, "storage unavailable", s.lastErrors[0])
+		assert.True(t, s.next[0].After(time.Now()))
+	})
+
+	t.Run("the last attempt fails the delivery", func(t *testing.T) {
+		s := &store{due: []models.WarehouseDelivery{{ID: 1, DestinationID: 3, JobID: 9, UserID: 2, Attempts: 5}}, dest: dest}
+		e := warehouse.NewExporter(s, outputs{err: errors.New("storage unavailable")}, env, warehouse.Network{}, warehouse.Config{MaxAttempts: 6}, nil)
+		_, err := e.RunOnce(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, []models.WarehouseDeliveryStatus{models.WarehouseDeliveryFailed}, s.statuses)
+	})
+}
@@ -0,0 +1,292 @@
+// Package watermark marks the generated rows of free-plan jobs so their data
+// can be traced back to the job that produced it. A keyed hash of each
+// numeric value, without its last bit, selects about half the values and
+// the bit each of them must carry; a selected value whose last digit has
+// the wrong parity moves by one unit of that digit. The mark depends on the
+// value alone, so duplicated rows, group keys and values shared between
+// tables stay equal, and it survives rows being shuffled, subset, re-typed
+// through CSV or moved to renamed columns. Rows that carry the watermark
+// hold the job's bit in far more than half of the selected values, which
+// Verify measures.
+package watermark
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Scheme names the marking scheme recorded with jobs
+const Scheme = "parity-v1"
+
+const (
+	// MinMagnitude leaves small numbers such as flags, codes and counts of
+	// a few unmarked: a unit is too large a change for them
+	MinMagnitude = 10
+	// MaxDecimals and MaxDigits bound the numbers that are marked; longer
+	// ones are not written exactly by every format
+	MaxDecimals = 6
+	MaxDigits   = 15
+	// MinCells is the fewest checked cells Verify decides on
+	MinCells = 32
+	// Threshold is the z-score rows must reach to be reported as
+	// watermarked; chance reaches it about three times in 100,000
+	Threshold = 4.0
+)
+
+// identifier matches the names of key columns, which are never marked since
+// a mark could make two keys equal
+var identifier = regexp.MustCompile(`(^|_)(?i:id|key|uuid)$|[a-z](Id|Key)$`)
+
+// Marker marks the numeric values of generated rows. A nil *Marker leaves
+// rows as they are.
+type Marker struct {
+	key     []byte
+	exclude map[string]bool
+	columns map[string]bool
+	cells   int64
+	changed int64
+}
+
+// NewMarker returns a marker for a job's rows keyed by secret, or nil
+// without a secret. Excluded columns, such as unique columns and columns
+// with bounds, are never marked.
+func NewMarker(secret []byte, jobID int64, exclude []string) *Marker {
+	if len(secret) == 0 {
+		return nil
+	}
+	m := &Marker{key: JobKey(secret, jobID), exclude: make(map[string]bool), columns: make(map[string]bool)}
+	for _, c := range exclude {
+		m.exclude[strings.ToLower(c)] = true
+	}
+	return m
+}
+
+// JobKey derives the key of one job's watermark from the service secret
+func JobKey(secret []byte, jobID int64) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("watermark-job:" + strconv.FormatInt(jobID, 10)))
+	return mac.Sum(nil)
+}
+
+// Filter marks rows in place
+func (m *Marker) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if m == nil {
+		return rows
+	}
+	for _, row := range rows {
+		for col, v := range row {
+			if m.exclude[strings.ToLower(col)] || identifier.MatchString(col) {
+				continue
+			}
+			d, ok := parse(v)
+			if !ok {
+				continue
+			}
+			// Strings are left as generated; they are still checked
+			if _, isString := v.(string); isString {
+				continue
+			}
+			selected, bit := m.bit(d)
+			if !selected {
+				continue
+			}
+			m.cells++
+			m.columns[col] = true
+			if d.n&1 == bit {
+				continue
+			}
+			d.n ^= 1
+			row[col] = d.as(v)
+			m.changed++
+		}
+	}
+	return rows
+}
+
+// Report describes the marks; nil for a nil marker
+func (m *Marker) Report() *models.WatermarkReport {
+	if m == nil {
+		return nil
+	}
+	out := &models.WatermarkReport{Scheme: Scheme, Columns: []string{}, Cells: m.cells, Changed: m.changed}
+	for c := range m.columns {
+		out.Columns = append(out.Columns, c)
+	}
+	sort.Strings(out.Columns)
+	return out
+}
+
+// Merge adds the marks of another table of the same job
+func Merge(a, b *models.WatermarkReport) *models.WatermarkReport {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	out := &models.WatermarkReport{Scheme: a.Scheme, Cells: a.Cells + b.Cells, Changed: a.Changed + b.Changed}
+	seen := map[string]bool{}
+	for _, c := range append(append([]string{}, a.Columns...), b.Columns...) {
+		if !seen[c] {
+			seen[c] = true
+			out.Columns = append(out.Columns, c)
+		}
+	}
+	sort.Strings(out.Columns)
+	return out
+}
+
+// Verify tests rows for the watermark of a job. Only columns are checked
+// when rows hold any of them, as the others were never marked; otherwise,
+// for rows whose columns were renamed, every column is.
+func Verify(secret []byte, jobID int64, columns []string, rows []map[string]interface{}) models.WatermarkVerification {
+	out := models.WatermarkVerification{JobID: jobID, Scheme: Scheme, Rows: int64(len(rows))}
+	m := &Marker{key: JobKey(secret, jobID)}
+	only := make(map[string]bool, len(columns))
+	for _, c := range columns {
+		only[c] = true
+	}
+	held := false
+	for _, row := range rows {
+		for col := range row {
+			held = held || only[col]
+		}
+	}
+	for _, row := range rows {
+		for col, v := range row {
+			if held && !only[col] {
+				continue
+			}
+			d, ok := parse(v)
+			if !ok {
+				continue
+			}
+			if selected, bit := m.bit(d); selected {
+				out.Cells++
+				if d.n&1 == bit {
+					out.Matches++
+				}
+			}
+		}
+	}
+	if out.Cells > 0 {
+		// Without the watermark matches are binomial with p = 1/2
+		out.ZScore = round((2*float64(out.Matches) - float64(out.Cells)) / math.Sqrt(float64(out.Cells)))
+		out.PValue = 0.5 * math.Erfc(out.ZScore/math.Sqrt2)
+	} else {
+		out.PValue = 1
+	}
+	out.Watermarked = out.Cells >= MinCells && out.ZScore >= Threshold
+	return out
+}
+
+// bit reports whether a value carries a bit and which. The hash covers the
+// value without its last bit, which marking never changes.
+func (m *Marker) bit(d decimal) (bool, int64) {
+	var buf [18]byte
+	binary.BigEndian.PutUint64(buf[0:8], uint64(d.n>>1))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(d.decimals))
+	if d.neg {
+		buf[16] = 1
+	}
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write(buf[:])
+	sum := mac.Sum(nil)
+	return sum[0]&1 == 0, int64(sum[1] & 1)
+}
+
+// decimal is a number as written: its digits without the point, the
+// digits after it and its sign
+type decimal struct {
+	neg      bool
+	n        int64
+	decimals int
+}
+
+// parse reads a value that can be marked. Values with decimals ending in 1
+// are left out, as flipping their last bit would end them in a 0 that
+// writing the number drops.
+func parse(v interface{}) (decimal, bool) {
+	var s string
+	switch x := v.(type) {
+	case float64:
+		if math.IsInf(x, 0) || math.IsNaN(x) {
+			return decimal{}, false
+		}
+		s = strconv.FormatFloat(x, 'f', -1, 64)
+	case int:
+		s = strconv.Itoa(x)
+	case int64:
+		s = strconv.FormatInt(x, 10)
+	case json.Number:
+		s = x.String()
+	case string:
+		s = strings.TrimSpace(x)
+	default:
+		return decimal{}, false
+	}
+	var d decimal
+	if strings.HasPrefix(s, "-") {
+		d.neg, s = true, s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	digits := whole + frac
+	if whole == "" || len(frac) > MaxDecimals || len(digits) > MaxDigits || strings.HasSuffix(frac, "0") {
+		return decimal{}, false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return decimal{}, false
+		}
+	}
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || n < MinMagnitude || (len(frac) > 0 && n%10 == 1) {
+		return decimal{}, false
+	}
+	d.n, d.decimals = n, len(frac)
+	return d, true
+}
+
+// as writes the decimal back in the type of the value it was read from
+func (d decimal) as(v interface{}) interface{} {
+	digits := strconv.FormatInt(d.n, 10)
+	if d.decimals > 0 {
+		if pad := d.decimals + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		digits = digits[:len(digits)-d.decimals] + "." + digits[len(digits)-d.decimals:]
+	}
+	if d.neg {
+		digits = "-" + digits
+	}
+	switch v.(type) {
+	case int:
+		return int(d.signed())
+	case int64:
+		return d.signed()
+	case json.Number:
+		return json.Number(digits)
+	}
+	f, _ := strconv.ParseFloat(digits, 64)
+	return f
+}
+
+func (d decimal) signed() int64 {
+	if d.neg {
+		return -d.n
+	}
+	return d.n
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
@@ -0,0 +1,92 @@
+// Package watermark_test provides unit tests for output watermarking
+package watermark_test
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/watermark"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var secret = []byte("service-secret")
+
+func generated(n int) []map[string]interface{} {
+	rows := make([]map[string]interface{}, n)
+	for i := range rows {
+		rows[i] = map[string]interface{}{
+			"customer_id": i + 1,
+			"price":       float64(1000+i*37) / 100,
+			"quantity":    int64(10 + i%90),
+			"total":       json.Number(strconv.Itoa(5000 + i*13)),
+			"flag":        i % 2,
+			"plan":        "pro",
+		}
+	}
+	return rows
+}
+
+func TestMarkerFilter(t *testing.T) {
+	rows := generated(300)
+	original := generated(300)
+	m := watermark.NewMarker(secret, 7, []string{"Quantity"})
+	m.Filter(rows)
+
+	report := m.Report()
+	require.NotNil(t, report)
+	assert.Equal(t, watermark.Scheme, report.Scheme)
+	assert.Equal(t, []string{"price", "total"}, report.Columns, "keys, small and excluded columns are left alone")
+	assert.Positive(t, report.Changed)
+	assert.Less(t, report.Changed, report.Cells)
+
+	for i, row := range rows {
+		assert.Equal(t, original[i]["customer_id"], row["customer_id"])
+		assert.Equal(t, original[i]["quantity"], row["quantity"])
+		assert.Equal(t, original[i]["flag"], row["flag"])
+		assert.IsType(t, json.Number(""), row["total"])
+		// A mark moves a value by one unit of its last digit, here 0.1 at most
+		assert.InDelta(t, original[i]["price"].(float64), row["price"].(float64), 0.1000001)
+	}
+
+	// Equal values are marked alike
+	a := []map[string]interface{}{{"v": 123.45}, {"v": 123.45}}
+	watermark.NewMarker(secret, 7, nil).Filter(a)
+	assert.Equal(t, a[0]["v"], a[1]["v"])
+
+	assert.Nil(t, watermark.NewMarker(nil, 7, nil), "nothing is marked without a secret")
+	var none *watermark.Marker
+	assert.Equal(t, original, none.Filter(generated(300)))
+	assert.Nil(t, none.Report())
+}
+
+func TestVerify(t *testing.T) {
+	rows := generated(300)
+	m := watermark.NewMarker(secret, 7, nil)
+	m.Filter(rows)
+	columns := m.Report().Columns
+
+	v := watermark.Verify(secret, 7, columns, rows)
+	assert.True(t, v.Watermarked)
+	assert.Equal(t, v.Cells, v.Matches)
+	assert.Less(t, v.PValue, 1e-6)
+
+	assert.False(t, watermark.Verify(secret, 8, columns, rows).Watermarked, "another job's key does not match")
+	assert.False(t, watermark.Verify([]byte("other"), 7, columns, rows).Watermarked)
+	assert.False(t, watermark.Verify(secret, 7, columns, generated(300)).Watermarked, "unmarked rows do not match")
+
+	// Values read back from CSV under renamed columns still carry the mark
+	renamed := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		renamed[i] = map[string]interface{}{
+			"unit_price": strconv.FormatFloat(row["price"].(float64), 'f', -1, 64),
+			"amount":     row["total"].(json.Number).String(),
+		}
+	}
+	assert.True(t, watermark.Verify(secret, 7, columns, renamed).Watermarked)
+
+	// Too few values to decide
+	assert.False(t, watermark.Verify(secret, 7, columns, rows[:5]).Watermarked)
+	assert.Equal(t, 1.0, watermark.Verify(secret, 7, columns, nil).PValue)
+}
@@ -0,0 +1,306 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Event types users can subscribe endpoints to; EventAll matches every one
+const (
+	EventGenerationCompleted = "generation.completed"
+	EventGenerationFailed    = "generation.failed"
+	EventDatasetUploaded     = "dataset.uploaded"
+	EventSubscriptionChanged = "subscription.changed"
+	EventQuotaThreshold      = "quota.threshold_reached"
+	EventAll                 = "*"
+)
+
+// EventTypes lists the event types that are published
+var EventTypes = []string{EventGenerationCompleted, EventGenerationFailed, EventDatasetUploaded, EventSubscriptionChanged, EventQuotaThreshold}
+
+// ValidEventType reports whether an endpoint may subscribe to t
+func ValidEventType(t string) bool {
+	if t == EventAll {
+		return true
+	}
+	for _, e := range EventTypes {
+		if e == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists endpoints and the deliveries queued for them
+type Store interface {
+	Subscribed(ctx context.Context, userID int64, eventType string) ([]models.WebhookEndpoint, error)
+	Enqueue(ctx context.Context, endpointIDs []int64, eventID, eventType, payload string) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	EndpointByID(ctx context.Context, id int64) (*models.WebhookEndpoint, error)
+	RecordAttempt(ctx context.Context, id int64, status models.WebhookDeliveryStatus, code *int, lastError *string, next time.Time) error
+}
+
+// DispatcherConfig tunes delivery
+type DispatcherConfig struct {
+	// BatchSize caps the deliveries claimed per poll
+	BatchSize    int
+	PollInterval time.Duration
+	// Timeout bounds one request to an endpoint
+	Timeout time.Duration
+	// Failed attempts are retried after BaseBackoff, doubling up to
+	// MaxBackoff, until MaxAttempts have been made
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	MaxAttempts int
+	// Transport, when set, carries deliveries to endpoints
+	Transport http.RoundTripper
+}
+
+func DefaultDispatcherConfig() DispatcherConfig {
+	return DispatcherConfig{
+		BatchSize:    50,
+		PollInterval: 5 * time.Second,
+		Timeout:      10 * time.Second,
+		BaseBackoff:  30 * time.Second,
+		MaxBackoff:   6 * time.Hour,
+		MaxAttempts:  8,
+	}
+}
+
+// maxErrorBody caps the response body kept with a failed attempt
+const maxErrorBody = 1024
+
+// Dispatcher queues events for the endpoints subscribed to them and delivers
+// them in the background. Deliveries live in the store, so they survive
+// restarts and are retried with exponential backoff.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	cfg    DispatcherConfig
+	logger *zap.Logger
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewDispatcher(store Store, cfg DispatcherConfig, logger *zap.Logger) *Dispatcher {
+	def := DefaultDispatcherConfig()
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = def.BatchSize
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = def.PollInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = def.Timeout
+	}
+	if cfg.BaseBackoff <= 0 {
+		cfg.BaseBackoff = def.BaseBackoff
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = def.MaxAttempts
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	return &Dispatcher{
+		store: store,
+		// Redirects are not followed: an endpoint must not be able to point
+		// deliveries elsewhere
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: cfg.Transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		cfg:    cfg,
+		logger: logger,
+	}
+}
+
+// Sign returns the signature of a payload, sent in X-Webhook-Signature
+func Sign(payload []byte, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write(payload)
+	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Backoff is the delay before the attempt after the given one
+func Backoff(base, max time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Publish queues an event for the user's subscribed endpoints. A nil
+// dispatcher drops it.
+func (d *Dispatcher) Publish(ctx context.Context, userID int64, eventType string, data map[string]interface{}) error {
+	return d.PublishEvent(ctx, uuid.NewString(), userID, eventType, data)
+}
+
+// PublishEvent queues an event under eventID; an event queued again under
+// the same ID is not delivered twice to an endpoint
+func (d *Dispatcher) PublishEvent(ctx context.Context, eventID string, userID int64, eventType string, data map[string]interface{}) error {
+	if d == nil || userID == 0 {
+		return nil
+	}
+	endpoints, err := d.store.Subscribed(ctx, userID, eventType)
+	if err != nil || len(endpoints) == 0 {
+		return err
+	}
+	event := WebhookEvent{
+		ID:        eventID,
+		Type:      eventType,
+		Data:      data,
+		Timestamp: time.Now().UTC(),
+		Source:    "synthos",
+		Version:   "1",
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, len(endpoints))
+	for i, e := range endpoints {
+		ids[i] = e.ID
+	}
+	return d.store.Enqueue(ctx, ids, event.ID, eventType, string(payload))
+}
+
+// Start polls for due deliveries until Stop is called or ctx ends
+func (d *Dispatcher) Start(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for {
+			n, err := d.RunOnce(ctx)
+			if err != nil && ctx.Err() == nil {
+				d.logger.Error("webhook dispatch failed", zap.Error(err))
+			}
+			if n == d.cfg.BatchSize {
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.cfg.PollInterval):
+			}
+		}
+	}()
+}
+
+// Stop cancels polling and waits for attempts in flight
+func (d *Dispatcher) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.wg.Wait()
+}
+
+// RunOnce attempts the deliveries due now and returns how many it claimed
+func (d *Dispatcher) RunOnce(ctx context.Context) (int, error) {
+	due, err := d.store.ClaimDue(ctx, d.cfg.BatchSize, 2*d.cfg.Timeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to claim deliveries: %w", err)
+	}
+	var wg sync.WaitGroup
+	for _, delivery := range due {
+		wg.Add(1)
+		go func(delivery models.WebhookDelivery) {
+			defer wg.Done()
+			d.attempt(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+	return len(due), nil
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery models.WebhookDelivery) {
+	endpoint, err := d.store.EndpointByID(ctx, delivery.EndpointID)
+	if err != nil {
+		d.logger.Warn("webhook endpoint lookup failed", zap.Int64("delivery_id", delivery.ID), zap.Error(err))
+		return
+	}
+	attempt := delivery.Attempts + 1
+	var code *int
+	if !endpoint.Active {
+		err = fmt.Errorf("endpoint is disabled")
+	} else {
+		var status int
+		status, err = d.send(ctx, endpoint, delivery, attempt)
+		if status != 0 {
+			code = &status
+		}
+	}
+	if err == nil {
+		d.record(ctx, delivery.ID, models.WebhookDeliveryDelivered, code, nil, time.Now())
+		return
+	}
+	msg := err.Error()
+	if attempt >= d.cfg.MaxAttempts || !endpoint.Active {
+		d.logger.Info("webhook delivery failed", zap.Int64("delivery_id", delivery.ID), zap.Int("attempts", attempt), zap.Error(err))
+		d.record(ctx, delivery.ID, models.WebhookDeliveryFailed, code, &msg, time.Now())
+		return
+	}
+	next := time.Now().Add(Backoff(d.cfg.BaseBackoff, d.cfg.MaxBackoff, attempt))
+	d.record(ctx, delivery.ID, models.WebhookDeliveryPending, code, &msg, next)
+}
+
+func (d *Dispatcher) record(ctx context.Context, id int64, status models.WebhookDeliveryStatus, code *int, lastError *string, next time.Time) {
+	if err := d.store.RecordAttempt(ctx, id, status, code, lastError, next); err != nil {
+		d.logger.Warn("failed to record webhook attempt", zap.Int64("delivery_id", id), zap.Error(err))
+	}
+}
+
+// send posts a delivery's payload and returns the response status
+func (d *Dispatcher) send(ctx context.Context, endpoint *models.WebhookEndpoint, delivery models.WebhookDelivery, attempt int) (int, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Synthos-Webhook/1.0")
+	req.Header.Set("X-Webhook-Event", delivery.EventType)
+	req.Header.Set("X-Webhook-ID", delivery.EventID)
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Webhook-Attempt", strconv.Itoa(attempt))
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(time.Now().Unix(), 10))
+	req.Header.Set("X-Webhook-Signature", Sign(payload, endpoint.Secret))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	return resp.StatusCode, fmt.Errorf("endpoint returned status %d: %s", resp.StatusCode, string(body))
+}
@@ -0,0 +1,167 @@
+// Package webhooks_test provides unit tests for webhook delivery
+package webhooks_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps endpoints and deliveries in memory
+type memoryStore struct {
+	mu         sync.Mutex
+	endpoints  []models.WebhookEndpoint
+	deliveries []models.WebhookDelivery
+}
+
+func (s *memoryStore) Subscribed(_ context.Context, userID int64, eventType string) ([]models.WebhookEndpoint, error) {
+	var out []models.WebhookEndpoint
+	for _, e := range s.endpoints {
+		if e.UserID != userID || !e.Active {
+			continue
+		}
+		for _, t := range e.Events {
+			if t == eventType || t == webhooks.EventAll {
+				out = append(out, e)
+				break
+			}
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryStore) Enqueue(_ context.Context, endpointIDs []int64, eventID, eventType, payload string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range endpointIDs {
+		s.deliveries = append(s.deliveries, models.WebhookDelivery{
+			ID:            int64(len(s.deliveries) + 1),
+			EndpointID:    id,
+			EventID:       eventID,
+			EventType:     eventType,
+			Payload:       payload,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+	return nil
+}
+
+func (s *memoryStore) ClaimDue(_ context.Context, limit int, _ time.Duration) ([]models.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []models.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status == models.WebhookDeliveryPending && !d.NextAttemptAt.After(time.Now()) && len(out) < limit {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func (s *memoryStore) EndpointByID(_ context.Context, id int64) (*models.WebhookEndpoint, error) {
+	for i := range s.endpoints {
+		if s.endpoints[i].ID == id {
+			return &s.endpoints[i], nil
+		}
+	}
+	return nil, io.EOF
+}
+
+func (s *memoryStore) RecordAttempt(_ context.Context, id int64, status models.WebhookDeliveryStatus, code *int, lastError *string, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == id {
+			d := &s.deliveries[i]
+			d.Attempts++
+			d.Status = status
+			d.ResponseCode = code
+			d.LastError = lastError
+			d.NextAttemptAt = next
+		}
+	}
+	return nil
+}
+
+func TestEventTypes(t *testing.T) {
+	assert.True(t, webhooks.ValidEventType(webhooks.EventGenerationCompleted))
+	assert.True(t, webhooks.ValidEventType(webhooks.EventAll))
+	assert.False(t, webhooks.ValidEventType("generation.started"))
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, webhooks.Backoff(30*time.Second, time.Hour, 1))
+	assert.Equal(t, 2*time.Minute, webhooks.Backoff(30*time.Second, time.Hour, 3))
+	assert.Equal(t, time.Hour, webhooks.Backoff(30*time.Second, time.Hour, 20))
+}
+
+func TestDeliverSigned(t *testing.T) {
+	var mu sync.Mutex
+	var gotSig, gotEvent string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSig = r.Header.Get("X-Webhook-Signature")
+		gotEvent = r.Header.Get("X-Webhook-Event")
+	}))
+	defer srv.Close()
+
+	store := &memoryStore{endpoints: []models.WebhookEndpoint{
+		{ID: 1, UserID: 7, URL: srv.URL, Events: []string{webhooks.EventGenerationCompleted}, Secret: "whsec_test", Active: true},
+		{ID: 2, UserID: 7, URL: srv.URL, Events: []string{webhooks.EventDatasetUploaded}, Secret: "whsec_other", Active: true},
+	}}
+	d := webhooks.NewDispatcher(store, webhooks.DispatcherConfig{}, nil)
+	require.NoError(t, d.Publish(context.Background(), 7, webhooks.EventGenerationCompleted, map[string]interface{}{"job_id": 3}))
+	require.Len(t, store.deliveries, 1, "only subscribed endpoints get a delivery")
+
+	n, err := d.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, models.WebhookDeliveryDelivered, store.deliveries[0].Status)
+	assert.Equal(t, webhooks.EventGenerationCompleted, gotEvent)
+	assert.Equal(t, webhooks.Sign(gotBody, "whsec_test"), gotSig)
+	assert.Contains(t, string(gotBody), `"job_id":3`)
+}
+
+func TestRetryThenFail(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	store := &memoryStore{endpoints: []models.WebhookEndpoint{
+		{ID: 1, UserID: 7, URL: srv.URL, Events: []string{webhooks.EventAll}, Secret: "whsec_test", Active: true},
+	}}
+	d := webhooks.NewDispatcher(store, webhooks.DispatcherConfig{BaseBackoff: time.Hour, MaxAttempts: 2}, nil)
+	require.NoError(t, d.Publish(context.Background(), 7, webhooks.EventGenerationFailed, nil))
+
+	_, err := d.RunOnce(context.Background())
+	require.NoError(t, err)
+	first := store.deliveries[0]
+	assert.Equal(t, models.WebhookDeliveryPending, first.Status)
+	require.NotNil(t, first.ResponseCode)
+	assert.Equal(t, http.StatusInternalServerError, *first.ResponseCode)
+	assert.True(t, first.NextAttemptAt.After(time.Now().Add(59*time.Minute)))
+
+	// Not due again until the backoff passes
+	n, _ := d.RunOnce(context.Background())
+	assert.Equal(t, 0, n)
+
+	store.deliveries[0].NextAttemptAt = time.Now()
+	_, err = d.RunOnce(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, models.WebhookDeliveryFailed, store.deliveries[0].Status)
+	assert.Equal(t, 2, store.deliveries[0].Attempts)
+}
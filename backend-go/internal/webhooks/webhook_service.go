@@ -4,8 +4,6 @@ import (
 	"bytes"
 	"context"
 	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -84,6 +82,11 @@ func NewWebhookService() *WebhookService {
 	}
 }
 
+// SetTransport routes deliveries through rt, such as an egress policy
+func (ws *WebhookService) SetTransport(rt http.RoundTripper) {
+	ws.httpClient.Transport = rt
+}
+
 // RegisterWebhook registers a new webhook
 func (ws *WebhookService) RegisterWebhook(webhook *Webhook) error {
 	if webhook.ID == "" {
@@ -147,8 +150,21 @@ func (ws *WebhookService) TriggerWebhook(ctx context.Context, event *WebhookEven
 	return nil
 }
 
+// Deliver sends an event to one webhook and waits for the outcome, retrying
+// as configured on the webhook
+func (ws *WebhookService) Deliver(ctx context.Context, webhook *Webhook, event *WebhookEvent) error {
+	if webhook.MaxRetries < 1 {
+		webhook.MaxRetries = 1
+	}
+	delivery := ws.deliverWebhook(ctx, webhook, event)
+	if delivery.Status != StatusDelivered {
+		return fmt.Errorf("webhook delivery failed: %s", delivery.ErrorMessage)
+	}
+	return nil
+}
+
 // deliverWebhook delivers a webhook to a specific endpoint
-func (ws *WebhookService) deliverWebhook(ctx context.Context, webhook *Webhook, event *WebhookEvent) {
+func (ws *WebhookService) deliverWebhook(ctx context.Context, webhook *Webhook, event *WebhookEvent) *WebhookDelivery {
 	delivery := &WebhookDelivery{
 		ID:          generateID(),
 		WebhookID:   webhook.ID,
@@ -172,7 +188,7 @@ func (ws *WebhookService) deliverWebhook(ctx context.Context, webhook *Webhook,
 		if err == nil {
 			delivery.Status = StatusDelivered
 			delivery.UpdatedAt = time.Now()
-			return
+			return delivery
 		}
 
 		delivery.ErrorMessage = err.Error()
@@ -187,7 +203,7 @@ func (ws *WebhookService) deliverWebhook(ctx context.Context, webhook *Webhook,
 		select {
 		case <-ctx.Done():
 			delivery.Status = StatusFailed
-			return
+			return delivery
 		case <-time.After(retryDelay):
 			// Continue to next attempt
 		}
@@ -195,6 +211,7 @@ func (ws *WebhookService) deliverWebhook(ctx context.Context, webhook *Webhook,
 
 	delivery.Status = StatusFailed
 	delivery.UpdatedAt = time.Now()
+	return delivery
 }
 
 // sendWebhookRequest sends the actual HTTP request
@@ -256,9 +273,7 @@ func (ws *WebhookService) sendWebhookRequest(ctx context.Context, webhook *Webho
 
 // generateSignature generates HMAC signature for webhook payload
 func (ws *WebhookService) generateSignature(payload []byte, secret string) string {
-	h := hmac.New(sha256.New, []byte(secret))
-	h.Write(payload)
-	return "sha256=" + hex.EncodeToString(h.Sum(nil))
+	return Sign(payload, secret)
 }
 
 // VerifySignature verifies webhook signature
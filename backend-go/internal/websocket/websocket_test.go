@@ -0,0 +1,73 @@
+// Package websocket_test provides unit tests for the WebSocket server side
+package websocket_test
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455 section 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", websocket.AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+	assert.True(t, websocket.IsUpgrade("keep-alive, Upgrade", "websocket"))
+	assert.False(t, websocket.IsUpgrade("keep-alive", "websocket"))
+}
+
+func clientFrame(op byte, payload []byte) []byte {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | op, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	return frame
+}
+
+func readServerFrame(t *testing.T, r io.Reader) (byte, []byte) {
+	var head [2]byte
+	_, err := io.ReadFull(r, head[:])
+	require.NoError(t, err)
+	n := int(head[1] & 0x7F)
+	if n == 126 {
+		var ext [2]byte
+		_, err := io.ReadFull(r, ext[:])
+		require.NoError(t, err)
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, n)
+	_, err = io.ReadFull(r, payload)
+	require.NoError(t, err)
+	return head[0] & 0x0F, payload
+}
+
+func TestConn(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	ws := websocket.NewConn(server)
+	done := make(chan error, 1)
+	go func() { done <- ws.ReadLoop() }()
+
+	go func() { _ = ws.WriteText(make([]byte, 300)) }()
+	op, payload := readServerFrame(t, client)
+	assert.Equal(t, byte(0x1), op)
+	assert.Len(t, payload, 300)
+
+	_, err := client.Write(clientFrame(0x9, []byte("hi")))
+	require.NoError(t, err)
+	op, payload = readServerFrame(t, client)
+	assert.Equal(t, byte(0xA), op)
+	assert.Equal(t, "hi", string(payload))
+
+	_, err = client.Write(clientFrame(0x8, []byte{0x03, 0xE8}))
+	require.NoError(t, err)
+	op, payload = readServerFrame(t, client)
+	assert.Equal(t, byte(0x8), op)
+	assert.Equal(t, uint16(websocket.CloseNormal), binary.BigEndian.Uint16(payload))
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,457 @@
+// Package weights supports datasets whose rows carry sampling weights, as
+// survey data does. Profiles report weighted statistics next to the raw
+// ones, and generation targets either the weighted population or the raw
+// sample, with the generated distribution reported per column.
+package weights
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+)
+
+// Modes
+const (
+	// ModePopulation reproduces the population the weighted sample
+	// represents; generated rows are equally weighted
+	ModePopulation = "population"
+	// ModeSample reproduces the rows as sampled, weight column included
+	ModeSample = "sample"
+)
+
+const (
+	// MaxCategories is the most distinct values a column may have for its
+	// category shares to be targeted
+	MaxCategories = 20
+	// promptCategories caps the categories named per column in a prompt
+	promptCategories = 10
+)
+
+var (
+	ErrUnknownMode   = errors.New("weighting must be population or sample")
+	ErrMissingColumn = errors.New("weight column not found")
+	ErrInvalidWeight = errors.New("weights must be non-negative numbers")
+	ErrZeroWeight    = errors.New("weights sum to zero")
+)
+
+// ValidMode reports whether mode is a known weighting mode
+func ValidMode(mode string) bool {
+	return mode == ModePopulation || mode == ModeSample
+}
+
+// Weights reads the weight of every row. A blank weight counts as zero.
+func Weights(rows []map[string]interface{}, column string) ([]float64, error) {
+	out := make([]float64, len(rows))
+	found := false
+	total := 0.0
+	for i, row := range rows {
+		v, ok := row[column]
+		if !ok {
+			continue
+		}
+		found = true
+		s := text(v)
+		if s == "" {
+			continue
+		}
+		w, err := strconv.ParseFloat(s, 64)
+		if err != nil || w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("%w: row %d has %q", ErrInvalidWeight, i+1, s)
+		}
+		out[i] = w
+		total += w
+	}
+	if !found {
+		return nil, ErrMissingColumn
+	}
+	if total <= 0 {
+		return nil, ErrZeroWeight
+	}
+	return out, nil
+}
+
+// Mean is the weighted mean of x
+func Mean(x, w []float64) float64 {
+	var sum, total float64
+	for i := range x {
+		sum += x[i] * w[i]
+		total += w[i]
+	}
+	if total == 0 {
+		return 0
+	}
+	return sum / total
+}
+
+// StdDev is the weighted standard deviation of x around its weighted mean
+func StdDev(x, w []float64) float64 {
+	m := Mean(x, w)
+	var sum, total float64
+	for i := range x {
+		d := x[i] - m
+		sum += w[i] * d * d
+		total += w[i]
+	}
+	if total == 0 {
+		return 0
+	}
+	return math.Sqrt(sum / total)
+}
+
+// Quantile is the smallest value of x at which the cumulative weight
+// reaches q of the total
+func Quantile(x, w []float64, q float64) float64 {
+	if len(x) == 0 {
+		return 0
+	}
+	idx := make([]int, len(x))
+	total := 0.0
+	for i := range idx {
+		idx[i] = i
+		total += w[i]
+	}
+	sort.Slice(idx, func(a, b int) bool { return x[idx[a]] < x[idx[b]] })
+	cum := 0.0
+	for _, i := range idx {
+		cum += w[i]
+		if cum >= q*total {
+			return x[i]
+		}
+	}
+	return x[idx[len(idx)-1]]
+}
+
+// EffectiveSampleSize is Kish's effective sample size: the number of
+// equally weighted rows carrying as much information as the weighted rows
+func EffectiveSampleSize(w []float64) float64 {
+	var sum, squares float64
+	for _, x := range w {
+		sum += x
+		squares += x * x
+	}
+	if squares == 0 {
+		return 0
+	}
+	return sum * sum / squares
+}
+
+// ColumnSummary holds the raw and weighted statistics of one column: mean,
+// standard deviation and median when numeric, category shares when it has
+// at most MaxCategories values
+type ColumnSummary struct {
+	Column         string             `json:"column"`
+	Numeric        bool               `json:"numeric"`
+	Mean           *float64           `json:"mean,omitempty"`
+	WeightedMean   *float64           `json:"weighted_mean,omitempty"`
+	StdDev         *float64           `json:"std_dev,omitempty"`
+	WeightedStdDev *float64           `json:"weighted_std_dev,omitempty"`
+	Median         *float64           `json:"median,omitempty"`
+	WeightedMedian *float64           `json:"weighted_median,omitempty"`
+	Shares         map[string]float64 `json:"shares,omitempty"`
+	WeightedShares map[string]float64 `json:"weighted_shares,omitempty"`
+}
+
+// Summary is the weighted profile of sampled rows
+type Summary struct {
+	WeightColumn        string          `json:"weight_column"`
+	Rows                int             `json:"rows"`
+	TotalWeight         float64         `json:"total_weight"`
+	EffectiveSampleSize float64         `json:"effective_sample_size"`
+	Columns             []ColumnSummary `json:"columns"`
+}
+
+// Profile computes the raw and weighted statistics of every column but the
+// weight column
+func Profile(columns []string, rows []map[string]interface{}, weightColumn string) (*Summary, error) {
+	w, err := Weights(rows, weightColumn)
+	if err != nil {
+		return nil, err
+	}
+	s := &Summary{WeightColumn: weightColumn, Rows: len(rows), EffectiveSampleSize: round(EffectiveSampleSize(w))}
+	for _, x := range w {
+		s.TotalWeight += x
+	}
+	for _, col := range columns {
+		if col == weightColumn {
+			continue
+		}
+		if cs, ok := profileColumn(col, rows, w); ok {
+			s.Columns = append(s.Columns, cs)
+		}
+	}
+	return s, nil
+}
+
+func profileColumn(col string, rows []map[string]interface{}, w []float64) (ColumnSummary, bool) {
+	var vals []string
+	var rowWeights []float64
+	for i, row := range rows {
+		if v := text(row[col]); v != "" {
+			vals = append(vals, v)
+			rowWeights = append(rowWeights, w[i])
+		}
+	}
+	if len(vals) == 0 {
+		return ColumnSummary{}, false
+	}
+	cs := ColumnSummary{Column: col}
+	nums := make([]float64, 0, len(vals))
+	for _, v := range vals {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			break
+		}
+		nums = append(nums, n)
+	}
+	if len(nums) == len(vals) {
+		ones := make([]float64, len(nums))
+		for i := range ones {
+			ones[i] = 1
+		}
+		cs.Numeric = true
+		cs.Mean = ptr(Mean(nums, ones))
+		cs.WeightedMean = ptr(Mean(nums, rowWeights))
+		cs.StdDev = ptr(StdDev(nums, ones))
+		cs.WeightedStdDev = ptr(StdDev(nums, rowWeights))
+		cs.Median = ptr(Quantile(nums, ones, 0.5))
+		cs.WeightedMedian = ptr(Quantile(nums, rowWeights, 0.5))
+		return cs, true
+	}
+	counts := make(map[string]float64)
+	weighted := make(map[string]float64)
+	total := 0.0
+	for i, v := range vals {
+		counts[v]++
+		weighted[v] += rowWeights[i]
+		total += rowWeights[i]
+	}
+	if len(counts) > MaxCategories {
+		return cs, true
+	}
+	cs.Shares = make(map[string]float64, len(counts))
+	cs.WeightedShares = make(map[string]float64, len(counts))
+	for v, c := range counts {
+		cs.Shares[v] = round(c / float64(len(vals)))
+		if total > 0 {
+			cs.WeightedShares[v] = round(weighted[v] / total)
+		}
+	}
+	return cs, true
+}
+
+// Target returns the distributions a job in mode reproduces: the weighted
+// statistics for the population, the raw ones for the sample
+func (s *Summary) Target(mode string) *agents.Weighting {
+	out := &agents.Weighting{Mode: mode, WeightColumn: s.WeightColumn}
+	for _, cs := range s.Columns {
+		d := agents.ColumnDistribution{Column: cs.Column}
+		switch {
+		case cs.Numeric && mode == ModePopulation:
+			d.Mean, d.StdDev = cs.WeightedMean, cs.WeightedStdDev
+		case cs.Numeric:
+			d.Mean, d.StdDev = cs.Mean, cs.StdDev
+		case cs.Shares == nil:
+			continue
+		case mode == ModePopulation:
+			d.Shares = cs.WeightedShares
+		default:
+			d.Shares = cs.Shares
+		}
+		out.Columns = append(out.Columns, d)
+	}
+	return out
+}
+
+// Apply adds a weighting target to a generation request. In population mode
+// the weight column is dropped from the schema since generated rows are
+// equally weighted. Categories are only named in the prompt when source
+// values may be quoted and the column is not restricted.
+func Apply(req *agents.GenerationRequest, w *agents.Weighting) {
+	if w == nil {
+		return
+	}
+	req.SchemaAnalysis.Weighting = w
+	restricted := make(map[string]bool, len(req.RestrictedColumns))
+	for _, c := range req.RestrictedColumns {
+		restricted[strings.ToLower(c)] = true
+	}
+	if w.Mode == ModePopulation {
+		cols := req.SchemaAnalysis.Columns[:0:0]
+		for _, c := range req.SchemaAnalysis.Columns {
+			if c.Name != w.WeightColumn {
+				cols = append(cols, c)
+			}
+		}
+		if len(cols) < len(req.SchemaAnalysis.Columns) && req.SchemaAnalysis.ColumnCount > 0 {
+			req.SchemaAnalysis.ColumnCount--
+		}
+		req.SchemaAnalysis.Columns = cols
+		req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints,
+			fmt.Sprintf("rows represent the population weighted by %s: every generated row has equal weight and %s is not generated", w.WeightColumn, w.WeightColumn))
+	} else {
+		req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints,
+			fmt.Sprintf("reproduce the rows as sampled, including the sampling weight column %s", w.WeightColumn))
+	}
+	for _, d := range w.Columns {
+		var target string
+		switch {
+		case d.Mean != nil:
+			target = fmt.Sprintf("mean about %.4g", *d.Mean)
+			if d.StdDev != nil {
+				target += fmt.Sprintf(", standard deviation about %.4g", *d.StdDev)
+			}
+		case req.ZeroRealData || restricted[strings.ToLower(d.Column)]:
+			continue
+		default:
+			target = "category shares " + formatShares(d.Shares)
+		}
+		req.SchemaAnalysis.Constraints = append(req.SchemaAnalysis.Constraints, fmt.Sprintf("%s: %s", d.Column, target))
+	}
+}
+
+func formatShares(shares map[string]float64) string {
+	keys := make([]string, 0, len(shares))
+	for k := range shares {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if shares[keys[a]] != shares[keys[b]] {
+			return shares[keys[a]] > shares[keys[b]]
+		}
+		return keys[a] < keys[b]
+	})
+	if len(keys) > promptCategories {
+		keys = keys[:promptCategories]
+	}
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s %.1f%%", k, shares[k]*100)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Tracker follows the distribution of generated rows for Report. In
+// population mode it also drops the weight column from them.
+type Tracker struct {
+	weighting *agents.Weighting
+	sums      map[string]float64
+	counts    map[string]int
+	shares    map[string]map[string]int
+}
+
+// NewTracker returns nil when the job is not weighted
+func NewTracker(w *agents.Weighting) *Tracker {
+	if w == nil {
+		return nil
+	}
+	return &Tracker{
+		weighting: w,
+		sums:      make(map[string]float64),
+		counts:    make(map[string]int),
+		shares:    make(map[string]map[string]int),
+	}
+}
+
+// Filter returns the rows, without the weight column in population mode
+func (t *Tracker) Filter(rows []map[string]interface{}) []map[string]interface{} {
+	if t == nil {
+		return rows
+	}
+	for _, row := range rows {
+		if t.weighting.Mode == ModePopulation {
+			delete(row, t.weighting.WeightColumn)
+		}
+		for _, d := range t.weighting.Columns {
+			v := text(row[d.Column])
+			if v == "" {
+				continue
+			}
+			if d.Mean != nil {
+				if n, err := strconv.ParseFloat(v, 64); err == nil {
+					t.sums[d.Column] += n
+					t.counts[d.Column]++
+				}
+				continue
+			}
+			if t.shares[d.Column] == nil {
+				t.shares[d.Column] = make(map[string]int)
+			}
+			t.shares[d.Column][v]++
+			t.counts[d.Column]++
+		}
+	}
+	return rows
+}
+
+// Report compares the generated distribution of each targeted column with
+// its target. Numeric fidelity is one less the distance between the means
+// in target standard deviations; categorical fidelity is one less the total
+// variation distance between the shares.
+func (t *Tracker) Report() []models.DistributionReport {
+	if t == nil {
+		return nil
+	}
+	var out []models.DistributionReport
+	for _, d := range t.weighting.Columns {
+		n := t.counts[d.Column]
+		if n == 0 {
+			continue
+		}
+		r := models.DistributionReport{Column: d.Column, Target: t.weighting.Mode}
+		if d.Mean != nil {
+			mean := t.sums[d.Column] / float64(n)
+			r.TargetMean = d.Mean
+			r.GeneratedMean = ptr(mean)
+			spread := 0.0
+			if d.StdDev != nil {
+				spread = *d.StdDev
+			}
+			switch {
+			case spread > 0:
+				r.Fidelity = round(1 - math.Min(1, math.Abs(mean-*d.Mean)/spread))
+			case mean == *d.Mean:
+				r.Fidelity = 1
+			}
+		} else {
+			distance := 0.0
+			for v, share := range d.Shares {
+				distance += math.Abs(share - float64(t.shares[d.Column][v])/float64(n))
+			}
+			for v, c := range t.shares[d.Column] {
+				if _, ok := d.Shares[v]; !ok {
+					distance += float64(c) / float64(n)
+				}
+			}
+			r.Fidelity = round(1 - math.Min(1, distance/2))
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func text(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
+
+func ptr(v float64) *float64 {
+	v = round(v)
+	return &v
+}
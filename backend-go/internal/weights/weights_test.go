@@ -0,0 +1,90 @@
+// Package weights_test provides unit tests for weighted profiling
+package weights_test
+
+import (
+	"testing"
+
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/weights"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWeightedStatistics(t *testing.T) {
+	x := []float64{1, 2, 3}
+	w := []float64{1, 1, 2}
+	assert.InDelta(t, 2.25, weights.Mean(x, w), 1e-9)
+	assert.InDelta(t, 0.8292, weights.StdDev(x, w), 1e-4)
+	assert.Equal(t, 3.0, weights.Quantile(x, w, 0.6))
+	assert.InDelta(t, 16.0/6.0, weights.EffectiveSampleSize(w), 1e-9)
+}
+
+// survey oversamples region b: it is half the rows but a fifth of the
+// population
+func survey() []map[string]interface{} {
+	var rows []map[string]interface{}
+	for i := 0; i < 10; i++ {
+		rows = append(rows, map[string]interface{}{"region": "a", "income": 40.0, "w": 4.0})
+		rows = append(rows, map[string]interface{}{"region": "b", "income": 10.0, "w": 1.0})
+	}
+	return rows
+}
+
+func TestProfileTargets(t *testing.T) {
+	s, err := weights.Profile([]string{"region", "income", "w"}, survey(), "w")
+	require.NoError(t, err)
+	require.Len(t, s.Columns, 2, "the weight column is not profiled")
+	assert.Equal(t, 50.0, s.TotalWeight)
+
+	region := s.Columns[0]
+	assert.Equal(t, 0.5, region.Shares["b"])
+	assert.Equal(t, 0.2, region.WeightedShares["b"])
+	income := s.Columns[1]
+	assert.Equal(t, 25.0, *income.Mean)
+	assert.Equal(t, 34.0, *income.WeightedMean)
+
+	population := s.Target(weights.ModePopulation)
+	assert.Equal(t, 0.8, population.Columns[0].Shares["a"])
+	sample := s.Target(weights.ModeSample)
+	assert.Equal(t, 25.0, *sample.Columns[1].Mean)
+
+	_, err = weights.Profile([]string{"region"}, []map[string]interface{}{{"region": "a", "w": "-1"}}, "w")
+	assert.ErrorIs(t, err, weights.ErrInvalidWeight)
+	_, err = weights.Profile([]string{"region"}, survey(), "missing")
+	assert.ErrorIs(t, err, weights.ErrMissingColumn)
+}
+
+func TestApplyAndReport(t *testing.T) {
+	s, err := weights.Profile([]string{"region", "income", "w"}, survey(), "w")
+	require.NoError(t, err)
+	target := s.Target(weights.ModePopulation)
+
+	req := &agents.GenerationRequest{
+		ZeroRealData: true,
+		SchemaAnalysis: agents.SchemaAnalysis{
+			ColumnCount: 3,
+			Columns:     []agents.ColumnInfo{{Name: "region"}, {Name: "income"}, {Name: "w"}},
+		},
+	}
+	weights.Apply(req, target)
+	assert.Len(t, req.SchemaAnalysis.Columns, 2)
+	assert.Equal(t, 2, req.SchemaAnalysis.ColumnCount)
+	for _, c := range req.SchemaAnalysis.Constraints {
+		assert.NotContains(t, c, "region:", "categories are withheld without real data")
+	}
+
+	tracker := weights.NewTracker(target)
+	var rows []map[string]interface{}
+	for i := 0; i < 8; i++ {
+		rows = append(rows, map[string]interface{}{"region": "a", "income": 40.0, "w": 1.0})
+	}
+	rows = append(rows, map[string]interface{}{"region": "b", "income": 10.0}, map[string]interface{}{"region": "b", "income": 10.0})
+	rows = tracker.Filter(rows)
+	assert.NotContains(t, rows[0], "w")
+
+	report := tracker.Report()
+	require.Len(t, report, 2)
+	assert.Equal(t, 1.0, report[0].Fidelity)
+	assert.Equal(t, 1.0, report[1].Fidelity)
+	assert.Nil(t, weights.NewTracker(nil).Report())
+}
@@ -2,34 +2,103 @@ package main
 
 import (
 	"context"
-	"log"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/accounts"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/agents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/analytics"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/auth"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/branding"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/buckets"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/cache"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/changelog"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/config"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/consent"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/db"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/egress"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/errreport"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/evidence"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/housekeeping"
 	v1 "github.com/genovotechnologies/synthos_dev/backend-go/internal/http/v1"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/idempotency"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/incidents"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/jobs"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/loadshed"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/logger"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/metering"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/middleware"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/mockapi"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/models"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/modelserving"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/monitoring"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/notifications"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgimport"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/orgpolicy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/outbox"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/payments"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pii"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/pricing"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/privacy"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/profiling"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/quota"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/rbac"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/repo"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/security"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/services"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/signing"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/sla"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/sources"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/storage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/tradeoff"
 	"github.com/genovotechnologies/synthos_dev/backend-go/internal/usage"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/warehouse"
+	"github.com/genovotechnologies/synthos_dev/backend-go/internal/webhooks"
 )
 
 func main() {
+	// Deferred cleanup runs before a failed server exits non-zero; this
+	// defer runs last
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	cfg := config.Load()
 	logg, _ := logger.New(cfg.Environment)
 	defer logg.Sync()
 	sugar := logg.Sugar()
 
+	// Secrets read from a secret manager are fetched again in the background;
+	// settings resolved at startup keep their value until the next restart
+	if cfg.SecretsRefreshSec > 0 {
+		cfg.Secrets.OnChange(func(ref string) {
+			logg.Warn("secret rotated; restart to apply it to settings read at startup", zap.String("ref", ref))
+		})
+		go cfg.Secrets.Run(context.Background(), time.Duration(cfg.SecretsRefreshSec)*time.Second, func(err error) {
+			logg.Error("secret refresh failed", zap.Error(err))
+		})
+	}
+
 	// Init DB
-	database, err := db.New(cfg.DatabaseURL)
+	database, err := db.New(cfg.DatabaseURL, db.Options{
+		QueryTimeout: time.Duration(cfg.DBQueryTimeoutMS) * time.Millisecond,
+		SlowQuery:    time.Duration(cfg.DBSlowQueryMS) * time.Millisecond,
+		Logger:       logg,
+	})
 	if err != nil {
 		logg.Fatal("db init failed", zap.Error(err))
 	}
@@ -40,6 +109,21 @@ func main() {
 	if err != nil {
 		logg.Fatal("redis init failed", zap.Error(err))
 	}
+	defer redisClient.Client.Close()
+
+	// Panics and server errors go to Sentry when it is configured
+	var reporter *errreport.Reporter
+	if cfg.EnableSentry {
+		reporter, err = errreport.New(errreport.Config{
+			DSN:         cfg.SentryDSN,
+			Environment: cfg.SentryEnvironment,
+			Release:     cfg.SentryRelease,
+		})
+		if err != nil {
+			logg.Fatal("sentry init failed", zap.Error(err))
+		}
+		defer reporter.Close(5 * time.Second)
+	}
 
 	app := fiber.New(fiber.Config{AppName: "Synthos API (Go)"})
 
@@ -49,84 +133,564 @@ func main() {
 		AllowCredentials: true,
 		AllowHeaders:     "*",
 		AllowMethods:     "GET,POST,PUT,DELETE,PATCH,OPTIONS",
+		ExposeHeaders:    "X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset,Retry-After",
 	}))
 
+	// Under overload, low priority traffic is shed before auth and job
+	// status degrade
+	var shedder *loadshed.Shedder
+	if cfg.LoadShedEnabled {
+		shedder = loadshed.New(loadshed.Config{
+			MaxInFlight:   cfg.LoadShedMaxInFlight,
+			TargetLatency: time.Duration(cfg.LoadShedTargetLatencyMS) * time.Millisecond,
+			LowShedAt:     cfg.LoadShedLowAt,
+			NormalShedAt:  cfg.LoadShedNormalAt,
+			RetryAfter:    time.Duration(cfg.LoadShedRetryAfterSec) * time.Second,
+		})
+	}
+
+	// Idempotency keys are scoped by the caller's identity, which the
+	// authentication set up below resolves; no request is served before then
+	var authDeps v1.AuthDeps
+
 	// Register security & platform middlewares
 	_ = middleware.Register(app, middleware.Options{
 		AllowedHosts: cfg.CorsOrigins, // reuse for now or add separate env
 		ForceHTTPS:   cfg.Environment == "production",
-		RateLimitRPS: 100,
 		SessionKey:   cfg.JwtSecret,
 		RedisURL:     cfg.RedisURL,
+		Reporter:     reporter,
+		Logger:       logg,
+		Shedder:      shedder,
+		Idempotency:  idempotency.NewRedisStore(redisClient.Client),
+		Caller:       func(c *fiber.Ctx) string { return authDeps.Caller(c) },
+		OrgLookup: func(userID int64) int64 {
+			orgID, err := repo.NewUserRepo(database.SQL).GetOrgID(context.Background(), userID)
+			if err != nil || orgID == nil {
+				return 0
+			}
+			return *orgID
+		},
 	})
 
-	// Health endpoints
+	// Health endpoints; readiness fails while the instance drains so load
+	// balancers stop routing to it before it stops listening
+	var ready atomic.Bool
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "healthy"})
 	})
 	app.Get("/health/ready", func(c *fiber.Ctx) error {
+		if !ready.Load() {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"status": "draining"})
+		}
 		return c.JSON(fiber.Map{"status": "ready"})
 	})
 	app.Get("/health/live", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"status": "alive"})
 	})
 
+	// Prometheus metrics, including load shedding, for scrapers on
+	// allowlisted networks
+	metricsAllowlist, err := profiling.ParseAllowlist(cfg.MetricsAllowlist)
+	if err != nil {
+		logg.Fatal("invalid metrics allowlist", zap.Error(err))
+	}
+	metricsHandler := adaptor.HTTPHandler(promhttp.Handler())
+	app.Get("/metrics", func(c *fiber.Ctx) error {
+		if !metricsAllowlist.Allows(c.IP()) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "not_found"})
+		}
+		return metricsHandler(c)
+	})
+
 	// v1 router scaffold aligned with frontend expectations
 	// Create repositories and deps
+	// Schema changes may build indexes on large tables, so they run without
+	// the query timeout
+	schemaCtx := db.WithQueryTimeout(context.Background(), 0)
 	userRepo := repo.NewUserRepo(database.SQL)
-	if err := userRepo.CreateSchema(context.Background()); err != nil {
+	if err := userRepo.CreateSchema(schemaCtx); err != nil {
 		logg.Fatal("failed to create user schema", zap.Error(err))
 	}
 
 	datasetRepo := repo.NewDatasetRepo(database.SQL)
-	if err := datasetRepo.CreateSchema(context.Background()); err != nil {
+	if err := datasetRepo.CreateSchema(schemaCtx); err != nil {
 		logg.Fatal("failed to create dataset schema", zap.Error(err))
 	}
+	collectionRepo := repo.NewDatasetCollectionRepo(database.SQL)
+	if err := collectionRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create dataset collection schema", zap.Error(err))
+	}
 
 	genRepo := repo.NewGenerationRepo(database.SQL)
-	if err := genRepo.CreateSchema(context.Background()); err != nil {
+	if err := genRepo.CreateSchema(schemaCtx); err != nil {
 		logg.Fatal("failed to create generation schema", zap.Error(err))
 	}
+	// Every job's source columns, privacy settings and sample sharing are
+	// recorded for audits
+	generationAuditRepo := repo.NewGenerationAuditRepo(database.SQL)
+	if err := generationAuditRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create generation audit schema", zap.Error(err))
+	}
 
 	bl := auth.NewBlacklist(redisClient.Client)
 
 	// Initialize custom model repository
 	customModelRepo := repo.NewCustomModelRepo(database.SQL)
-	if err := customModelRepo.CreateSchema(context.Background()); err != nil {
+	if err := customModelRepo.CreateSchema(schemaCtx); err != nil {
 		logg.Fatal("failed to create custom model schema", zap.Error(err))
 	}
 
+	// Organizations share datasets, jobs and custom models among members
+	orgRepo := repo.NewOrgRepo(database.SQL)
+	if err := orgRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create organization schema", zap.Error(err))
+	}
+	// Hourly usage totals per organization feed heatmaps and capacity
+	// projections; the first run backfills a year, later ones the last hours
+	usageRollupRepo := repo.NewUsageRollupRepo(database.SQL)
+	if err := usageRollupRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create usage rollup schema", zap.Error(err))
+	}
+	go func() {
+		since := time.Now().AddDate(-1, 0, 0)
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			if _, err := usageRollupRepo.Rollup(context.Background(), since); err != nil {
+				logg.Error("usage rollup failed", zap.Error(err))
+			} else {
+				since = time.Now().Add(-2 * time.Hour)
+			}
+			<-ticker.C
+		}
+	}()
+	// White-label organizations brand email and links with their own
+	// name, logo, sender and verified hostname
+	brandingRepo := repo.NewBrandingRepo(database.SQL)
+	if err := brandingRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create branding schema", zap.Error(err))
+	}
+	brands := branding.NewResolver(brandingRepo)
+	// Organizations can have job outputs delivered to a bucket they own
+	outputBucketRepo := repo.NewOutputBucketRepo(database.SQL)
+	if err := outputBucketRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create output bucket schema", zap.Error(err))
+	}
+
 	usageService := usage.NewUsageService(userRepo, genRepo, datasetRepo, customModelRepo)
+	// Staff can grant users limits in place of their plan's
+	quotaOverrideRepo := repo.NewQuotaOverrideRepo(database.SQL)
+	if err := quotaOverrideRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create quota override schema", zap.Error(err))
+	}
+	usageService.SetOverrides(quotaOverrideRepo)
 
 	// Initialize advanced repositories
 	userUsageRepo := repo.NewUserUsageRepo(database.SQL)
-	if err := userUsageRepo.CreateSchema(context.Background()); err != nil {
+	if err := userUsageRepo.CreateSchema(schemaCtx); err != nil {
 		logg.Fatal("failed to create user usage schema", zap.Error(err))
 	}
 
 	userSubRepo := repo.NewUserSubscriptionRepo(database.SQL)
-	if err := userSubRepo.CreateSchema(context.Background()); err != nil {
+	if err := userSubRepo.CreateSchema(schemaCtx); err != nil {
 		logg.Fatal("failed to create user subscription schema", zap.Error(err))
 	}
 
 	apiKeyRepo := repo.NewAPIKeyRepo(database.SQL)
-	if err := apiKeyRepo.CreateSchema(context.Background()); err != nil {
+	if err := apiKeyRepo.CreateSchema(schemaCtx); err != nil {
 		logg.Fatal("failed to create API key schema", zap.Error(err))
 	}
+	// Roles and the permissions they grant; the built-in account roles are
+	// created on first start
+	roleRepo := repo.NewRoleRepo(database.SQL)
+	if err := roleRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create role schema", zap.Error(err))
+	}
+	if err := roleRepo.SeedBuiltins(schemaCtx, rbac.BuiltinRoles); err != nil {
+		logg.Fatal("failed to seed built-in roles", zap.Error(err))
+	}
+
+	datasetGrantRepo := repo.NewDatasetGrantRepo(database.SQL)
+	if err := datasetGrantRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create dataset grants schema", zap.Error(err))
+	}
 
 	auditLogRepo := repo.NewAuditLogRepo(database.SQL)
-	if err := auditLogRepo.CreateSchema(context.Background()); err != nil {
+	if err := auditLogRepo.CreateSchema(schemaCtx); err != nil {
 		logg.Fatal("failed to create audit log schema", zap.Error(err))
 	}
 
+	anonymizationPolicyRepo := repo.NewAnonymizationPolicyRepo(database.SQL)
+	if err := anonymizationPolicyRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create anonymization policy schema", zap.Error(err))
+	}
+	dataPolicyRepo := repo.NewDataPolicyRepo(database.SQL)
+	if err := dataPolicyRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create data policy schema", zap.Error(err))
+	}
+	orgSettingsRepo := repo.NewOrgSettingsRepo(database.SQL)
+	if err := orgSettingsRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create org settings schema", zap.Error(err))
+	}
+	annotationRepo := repo.NewColumnAnnotationRepo(database.SQL)
+	if err := annotationRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create column annotation schema", zap.Error(err))
+	}
+	relationshipRepo := repo.NewRelationshipHintRepo(database.SQL)
+	if err := relationshipRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create relationship hint schema", zap.Error(err))
+	}
+	hierarchyRepo := repo.NewHierarchyRepo(database.SQL)
+	if err := hierarchyRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create column hierarchy schema", zap.Error(err))
+	}
+	vocabularyRepo := repo.NewVocabularyRepo(database.SQL)
+	if err := vocabularyRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create vocabulary schema", zap.Error(err))
+	}
+	columnPrivacyRepo := repo.NewColumnPrivacyRepo(database.SQL)
+	if err := columnPrivacyRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create column privacy schema", zap.Error(err))
+	}
+	datasetPIIRepo := repo.NewDatasetPIIRepo(database.SQL)
+	if err := datasetPIIRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create dataset PII schema", zap.Error(err))
+	}
+	generationTemplateRepo := repo.NewGenerationTemplateRepo(database.SQL)
+	if err := generationTemplateRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create generation template schema", zap.Error(err))
+	}
+	fixedWidthRepo := repo.NewFixedWidthLayoutRepo(database.SQL)
+	if err := fixedWidthRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create fixed-width layout schema", zap.Error(err))
+	}
+	qualityPolicyRepo := repo.NewQualityPolicyRepo(database.SQL)
+	if err := qualityPolicyRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create quality policy schema", zap.Error(err))
+	}
+	fhirMappingRepo := repo.NewFHIRMappingRepo(database.SQL)
+	if err := fhirMappingRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create FHIR mapping schema", zap.Error(err))
+	}
+	financialMessageRepo := repo.NewFinancialMessageLayoutRepo(database.SQL)
+	if err := financialMessageRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create financial message layout schema", zap.Error(err))
+	}
+	privacyBudgetRepo := repo.NewPrivacyBudgetRepo(database.SQL)
+	if err := privacyBudgetRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create privacy budget schema", zap.Error(err))
+	}
+	// Every retention run leaves a receipt for audit evidence packages
+	retentionReceiptRepo := repo.NewRetentionReceiptRepo(database.SQL)
+	if err := retentionReceiptRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create retention receipt schema", zap.Error(err))
+	}
+	recordRetention := func(task string, started time.Time, affected int64, runErr error) {
+		rec := &models.RetentionReceipt{Task: task, StartedAt: started, FinishedAt: time.Now(), Affected: affected}
+		if runErr != nil {
+			msg := runErr.Error()
+			rec.Error = &msg
+		}
+		if err := retentionReceiptRepo.Insert(context.Background(), rec); err != nil {
+			logg.Error("failed to record retention receipt", zap.String("task", task), zap.Error(err))
+		}
+	}
+	// Datasets past their retention period are archived
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			started := time.Now()
+			n, err := datasetRepo.ArchiveExpired(context.Background())
+			recordRetention(models.RetentionDatasetArchive, started, n, err)
+			if err != nil {
+				logg.Error("dataset retention sweep failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("archived expired datasets", zap.Int64("count", n))
+			}
+		}
+	}()
+
+	// Anonymize client identifiers in audit records once their org's period elapses
+	anonymizer := privacy.NewAnonymizer(cfg.AnonymizationSalt, models.AnonymizationPolicy{
+		IPMode:             models.AnonymizationMode(cfg.AnonymizeIPMode),
+		UserAgentMode:      models.AnonymizationMode(cfg.AnonymizeUserAgentMode),
+		AnonymizeAfterDays: cfg.AnonymizeAfterDays,
+	}, anonymizationPolicyRepo)
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			started := time.Now()
+			n, err := anonymizer.SweepAuditLogs(context.Background(), auditLogRepo, started)
+			recordRetention(models.RetentionAuditAnonymization, started, int64(n), err)
+			if err != nil {
+				logg.Error("audit log anonymization sweep failed", zap.Error(err))
+				continue
+			}
+			if n > 0 {
+				logg.Info("anonymized audit logs", zap.Int("count", n))
+			}
+		}
+	}()
+
+	// Forward high/critical security events to Security Command Center when configured
+	securityService := security.NewSecurityService()
+	if cfg.SCCEnabled {
+		sccExporter, err := security.NewSCCExporter(context.Background(), security.SCCConfig{
+			SourceName:      cfg.SCCSourceName,
+			CredentialsFile: cfg.SCCCredentialsFile,
+			ResourceName:    cfg.SCCResourceName,
+			ExternalURI:     cfg.SCCExternalURI,
+		})
+		if err != nil {
+			logg.Fatal("failed to initialize SCC exporter", zap.Error(err))
+		}
+		securityService.SetExporter(sccExporter, logg)
+	}
+
+	// Outbound HTTP is held to the egress policy; the inference server and
+	// the NER provider are allowlisted by their URLs and may live on a
+	// private network
+	egressGateway, err := egress.New(egress.Config{
+		Mode:           egress.Mode(cfg.EgressMode),
+		AllowedHosts:   append(slices.Clone(cfg.EgressAllowedHosts), egress.HostOf(cfg.ModelServingURL), egress.HostOf(cfg.PIINERURL)),
+		Pins:           egress.ParsePins(cfg.EgressTLSPins),
+		SigningSecrets: cfg.EgressSigningSecrets,
+	}, securityService, logg)
+	if err != nil {
+		logg.Fatal("invalid egress policy", zap.Error(err))
+	}
+
+	// Load the keys session, email verification and password reset tokens
+	// are signed with
+	keySources, err := auth.ParseKeySources(cfg.JwtKeys)
+	if err != nil {
+		logg.Fatal("invalid JWT_KEYS", zap.Error(err))
+	}
+	tokenKeys, err := auth.LoadKeyRing(context.Background(), auth.KeyConfig{
+		Secret:        cfg.JwtSecret,
+		HMACAlgorithm: cfg.JwtAlg,
+		Sources:       keySources,
+		ActiveID:      cfg.JwtActiveKeyID,
+	})
+	if err != nil {
+		logg.Fatal("failed to load token signing keys", zap.Error(err))
+	}
+
 	// Initialize advanced auth service
-	advancedAuthService := auth.NewAdvancedAuthService(redisClient.Client, bl)
+	advancedAuthService := auth.NewAdvancedAuthService(redisClient.Client, bl, tokenKeys)
 
 	// Initialize email service
 	emailService := services.NewEmailService(
 		cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword,
 		cfg.FromEmail, cfg.FromName,
 	)
+	emailService.SetBranding(brands)
+
+	// Notifications: critical security and billing events are emailed at
+	// once, everything else is deduplicated and batched into digests
+	notificationRepo := repo.NewNotificationRepo(database.SQL)
+	if err := notificationRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create notification schema", zap.Error(err))
+	}
+	// Consent records: accepted legal document versions and the optional
+	// email users agreed to receive
+	consentRepo := repo.NewConsentRepo(database.SQL)
+	if err := consentRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create consent schema", zap.Error(err))
+	}
+	notifier := notifications.NewService(notificationRepo, emailService, userRepo, notifications.DefaultConfig(), logg)
+	notifier.SetConsents(consentRepo)
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := notifier.RunDigests(context.Background(), time.Now()); err != nil {
+				logg.Error("notification digest run failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("sent notification digests", zap.Int("count", n))
+			}
+		}
+	}()
+
+	// API key rotation: owners of auto-rotating keys are reminded before a
+	// key falls due, and keys past it start their overlap window
+	keyRotator := auth.NewKeyRotator(apiKeyRepo, notifier, time.Duration(cfg.APIKeyRotationReminderDays)*24*time.Hour, logg)
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := keyRotator.Run(context.Background(), time.Now()); err != nil {
+				logg.Error("api key rotation run failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("processed api key rotations", zap.Int("count", n))
+			}
+		}
+	}()
+
+	// Outbound webhooks: lifecycle events are queued per subscribed endpoint
+	// and delivered, signed and retried, by a background dispatcher
+	webhookRepo := repo.NewWebhookRepo(database.SQL)
+	if err := webhookRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create webhook schema", zap.Error(err))
+	}
+	webhookConfig := webhooks.DefaultDispatcherConfig()
+	webhookConfig.Transport = egressGateway.Transport("webhooks", egress.AnyPublicHost(), egress.HTTPSOnly())
+	webhookDispatcher := webhooks.NewDispatcher(webhookRepo, webhookConfig, logg)
+	webhookDispatcher.Start(context.Background())
+	defer webhookDispatcher.Stop()
+
+	// Custom analytics reports, generated on demand or on their schedule
+	// Analytics events are buffered and written to Postgres in batches
+	analyticsRepo := repo.NewAnalyticsRepo(database.SQL)
+	if err := analyticsRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create analytics schema", zap.Error(err))
+	}
+	analyticsService := analytics.NewAnalyticsService()
+	analyticsService.SetAnonymizer(anonymizer)
+	analyticsService.SetStore(analyticsRepo)
+	defer func() {
+		if err := analyticsService.Flush(context.Background()); err != nil {
+			logg.Error("analytics flush on shutdown failed", zap.Error(err))
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := analyticsService.AnonymizeExpired(context.Background(), time.Now()); err != nil {
+				logg.Error("analytics anonymization failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("anonymized analytics events", zap.Int("count", n))
+			}
+			if cfg.AnalyticsRetentionDays <= 0 {
+				continue
+			}
+			started := time.Now()
+			cutoff := started.AddDate(0, 0, -cfg.AnalyticsRetentionDays)
+			n, err := analyticsRepo.DeleteBefore(context.Background(), cutoff)
+			recordRetention(models.RetentionAnalyticsDeletion, started, n, err)
+			if err != nil {
+				logg.Error("analytics retention failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("deleted expired analytics events", zap.Int64("count", n))
+			}
+		}
+	}()
+
+	// Changelog: published entries are announced in the app to users who
+	// used one of their feature areas recently
+	changelogRepo := repo.NewChangelogRepo(database.SQL)
+	if err := changelogRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create changelog schema", zap.Error(err))
+	}
+	changelogAnnouncer := changelog.NewAnnouncer(changelogRepo, analyticsRepo, notifier, time.Duration(cfg.ChangelogUsageLookbackDays)*24*time.Hour, logg)
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := changelogAnnouncer.Run(context.Background(), time.Now()); err != nil {
+				logg.Error("changelog announcement failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("announced changelog entries", zap.Int("notified", n))
+			}
+		}
+	}()
+	reportRepo := repo.NewReportRepo(database.SQL)
+	if err := reportRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create report schema", zap.Error(err))
+	}
+	reportWebhooks := webhooks.NewWebhookService()
+	reportWebhooks.SetTransport(egressGateway.Transport("report_webhooks", egress.AnyPublicHost(), egress.HTTPSOnly()))
+	reportScheduler := analytics.NewReportScheduler(analyticsService, reportRepo, emailService, reportWebhooks, logg)
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := reportScheduler.RunDue(context.Background(), time.Now()); err != nil {
+				logg.Error("scheduled report run failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("generated scheduled reports", zap.Int("count", n))
+			}
+		}
+	}()
+
+	// SLA measurement for plans that promise one: availability is sampled
+	// every minute and each month's reports and credits are issued once the
+	// month has closed
+	slaRepo := repo.NewSLARepo(database.SQL)
+	if err := slaRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create SLA schema", zap.Error(err))
+	}
+	billingCreditRepo := repo.NewBillingCreditRepo(database.SQL)
+	if err := billingCreditRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create billing credit schema", zap.Error(err))
+	}
+	slaService := sla.NewService(slaRepo, userSubRepo, billingCreditRepo, logg)
+	// Audit evidence packages are only exported when a signing key is set
+	var evidenceBuilder *evidence.Builder
+	if cfg.EvidenceSigningKey != "" {
+		signingKey, err := evidence.ParseSigningKey([]byte(cfg.EvidenceSigningKey))
+		if err != nil {
+			logg.Fatal("invalid evidence signing key", zap.Error(err))
+		}
+		evidenceBuilder = evidence.NewBuilder(evidence.Sources{
+			AuditLogs:         auditLogRepo,
+			RetentionReceipts: retentionReceiptRepo,
+			SLAReports:        slaRepo,
+			SecurityEvents:    securityService,
+			Configuration:     cfg.Snapshot,
+		}, signingKey)
+	}
+	// Export manifests are only signed when signing keys are configured
+	var exportSigner *signing.KeyRing
+	if cfg.ExportSigningKeys != "" {
+		keys, err := signing.ParseKeys(cfg.ExportSigningKeys)
+		if err != nil {
+			logg.Fatal("invalid export signing keys", zap.Error(err))
+		}
+		if exportSigner, err = signing.NewKeyRing(cfg.ExportSigningKeyID, keys); err != nil {
+			logg.Fatal("failed to initialize export signing", zap.Error(err))
+		}
+	}
+	slaService.SetNotifier(notifier)
+	monitor := monitoring.NewMonitoringService()
+	// Heap dumps are captured when the memory health check fails, and with
+	// the runtime profiles served to admins from allowlisted networks
+	heapDumps := profiling.NewHeapDumper(cfg.HeapDumpDir, cfg.HeapDumpKeep, time.Duration(cfg.HeapDumpIntervalMinutes)*time.Minute)
+	monitor.AddNotifier(heapDumps)
+	var pprofAllowlist *profiling.Allowlist
+	if cfg.PprofEnabled {
+		if pprofAllowlist, err = profiling.ParseAllowlist(cfg.PprofAllowlist); err != nil {
+			logg.Fatal("invalid profiling allowlist", zap.Error(err))
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			monitor.PerformHealthCheck("database", func() error {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				return database.SQL.PingContext(ctx)
+			})
+			if err := slaService.RecordAvailability(context.Background(), time.Now(), monitor.Healthy("database")); err != nil {
+				logg.Warn("availability sample not recorded", zap.Error(err))
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(6 * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			lastMonth := sla.MonthStart(time.Now()).AddDate(0, -1, 0)
+			if _, err := slaService.GenerateMonth(context.Background(), lastMonth); err != nil {
+				logg.Error("SLA report generation failed", zap.Error(err))
+			}
+		}
+	}()
 
 	// Initialize Vertex AI handlers
 	// vertexAIHandlers, err := v1.NewVertexAIHandlers(cfg)
@@ -136,44 +700,587 @@ func main() {
 
 	// Initialize storage client based on provider
 	var storageClient v1.SignedURLProvider
+	storageOpts := storage.ProviderOptions{
+		SignedURLTTL: time.Duration(cfg.GCSSignedURLTTL) * time.Second,
+		Encryption:   cfg.StorageEncryption,
+		KMSKeyID:     cfg.StorageKMSKey,
+		PartSize:     int64(cfg.StoragePartSizeMB) << 20,
+		Concurrency:  cfg.StorageConcurrency,
+	}
+	// Organization buckets keep their own default encryption; the platform
+	// KMS key is not theirs to use
+	outputBuckets := &buckets.Registry{
+		Buckets: outputBucketRepo,
+		Options: storage.ProviderOptions{
+			SignedURLTTL: storageOpts.SignedURLTTL,
+			PartSize:     storageOpts.PartSize,
+			Concurrency:  storageOpts.Concurrency,
+		},
+		Principals: map[string]string{},
+	}
+	if cfg.OutputBucketAWSPrincipal != "" {
+		outputBuckets.Principals[models.BucketS3] = cfg.OutputBucketAWSPrincipal
+	}
+	if cfg.OutputBucketGCPPrincipal != "" {
+		outputBuckets.Principals[models.BucketGCS] = cfg.OutputBucketGCPPrincipal
+	}
 	if cfg.StorageProvider == "gcs" && cfg.GCSBucket != "" {
-		// GCS storage initialization would go here
-		// storageClient, _ = storage.NewGCSProvider(context.Background(), cfg.GCSBucket)
-	} else if cfg.StorageProvider == "s3" {
-		// S3 storage initialization would go here
-		// storageClient, _ = storage.NewS3Provider(context.Background(), cfg.S3Bucket, cfg.S3Region)
+		gcsProvider, err := storage.NewGCSProvider(context.Background(), cfg.GCSBucket, storageOpts)
+		if err != nil {
+			logg.Fatal("failed to initialize GCS storage", zap.Error(err))
+		}
+		storageClient = gcsProvider
+	} else if cfg.StorageProvider == "s3" && cfg.S3Bucket != "" {
+		s3Provider, err := storage.NewS3Provider(context.Background(), cfg.S3Bucket, cfg.S3Region, storageOpts)
+		if err != nil {
+			logg.Fatal("failed to initialize S3 storage", zap.Error(err))
+		}
+		storageClient = s3Provider
+	}
+
+	// Download tickets are only issued when signing keys are configured
+	var urlSigner *storage.URLSigner
+	if cfg.DownloadSigningKeys != "" {
+		keys, err := storage.ParseSigningKeys(cfg.DownloadSigningKeys)
+		if err != nil {
+			logg.Fatal("invalid download signing keys", zap.Error(err))
+		}
+		urlSigner, err = storage.NewURLSigner(cfg.DownloadSigningKeyID, keys)
+		if err != nil {
+			logg.Fatal("failed to initialize download URL signer", zap.Error(err))
+		}
+	}
+
+	// Each job output is encrypted with its own data key, wrapped under the
+	// master keys; downloads need an access grant that expires
+	outputKeyRepo := repo.NewOutputKeyRepo(database.SQL)
+	if err := outputKeyRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create output key schema", zap.Error(err))
+	}
+	var envelope *storage.Envelope
+	if cfg.OutputMasterKeys != "" {
+		keys, err := storage.ParseSigningKeys(cfg.OutputMasterKeys)
+		if err != nil {
+			logg.Fatal("invalid output master keys", zap.Error(err))
+		}
+		envelope, err = storage.NewEnvelope(cfg.OutputMasterKeyID, keys)
+		if err != nil {
+			logg.Fatal("failed to initialize output encryption", zap.Error(err))
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := outputKeyRepo.ExpireDue(context.Background(), time.Now()); err != nil {
+				logg.Error("output access expiry failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("expired output access grants", zap.Int64("count", n))
+			}
+		}
+	}()
+
+	// Datasets can also be sampled from customers' databases; connection
+	// credentials are sealed under a KMS key
+	datasetSourceRepo := repo.NewDatasetSourceRepo(database.SQL)
+	if err := datasetSourceRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create dataset source schema", zap.Error(err))
+	}
+	var sourceKeys storage.KMS
+	if cfg.DatasetSourceKMSKey != "" {
+		sourceKeys, err = storage.NewKMS(context.Background(), cfg.DatasetSourceKMSKey, egressGateway.Transport("kms"))
+		if err != nil {
+			logg.Fatal("failed to initialize dataset source KMS", zap.Error(err))
+		}
+	}
+
+	// Completed jobs are loaded into customers' warehouses; destinations
+	// are chosen by customers, so connections only reach public addresses
+	warehouseRepo := repo.NewWarehouseRepo(database.SQL)
+	if err := warehouseRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create warehouse schema", zap.Error(err))
+	}
+	warehouseNetwork := warehouse.Network{
+		HTTP: egressGateway.Transport("warehouse", egress.AnyPublicHost(), egress.HTTPSOnly()),
+		Dial: egressGateway.Dialer("warehouse", egress.AnyPublicHost()),
+	}
+	if reader, ok := storageClient.(storage.ObjectReader); ok && envelope != nil {
+		outputs := &jobs.OutputReader{Jobs: genRepo, Keys: outputKeyRepo, Envelope: envelope, Reader: reader, Audit: auditLogRepo, Buckets: outputBuckets}
+		warehouseExporter := warehouse.NewExporter(warehouseRepo, outputs, envelope, warehouseNetwork, warehouse.DefaultConfig(), logg)
+		warehouseExporter.Start(context.Background())
+		defer warehouseExporter.Stop()
+	}
+
+	// Completed jobs can be hosted as public mock APIs. Their rows are read
+	// like warehouse exports and kept in memory for a while; expired mocks
+	// stay listed for a week before they are purged.
+	mockAPIRepo := repo.NewMockAPIRepo(database.SQL)
+	if err := mockAPIRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create mock api schema", zap.Error(err))
+	}
+	var mockServer *mockapi.Server
+	if reader, ok := storageClient.(storage.ObjectReader); ok {
+		outputs := &jobs.OutputReader{Jobs: genRepo, Keys: outputKeyRepo, Envelope: envelope, Reader: reader, Audit: auditLogRepo, Destination: "mock_api", Buckets: outputBuckets}
+		mockServer = mockapi.NewServer(mockAPIRepo, outputs, mockapi.DefaultConfig())
+	}
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := mockAPIRepo.PurgeExpired(context.Background(), time.Now().AddDate(0, 0, -7)); err != nil {
+				logg.Error("mock api purge failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("purged expired mock apis", zap.Int64("count", n))
+			}
+		}
+	}()
+
+	transactor := repo.NewTransactor(database.SQL)
+
+	// CSV member imports are invited in the background, throttled so a
+	// large organization does not flood its mail servers
+	orgImportRepo := repo.NewOrgImportRepo(database.SQL)
+	if err := orgImportRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create organization import schema", zap.Error(err))
+	}
+	orgInviter := orgimport.NewInviter(orgImportRepo, orgRepo, transactor, emailService, auditLogRepo, cfg.OrgImportInvitesPerMinute, logg)
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := orgInviter.Run(context.Background(), time.Now()); err != nil {
+				logg.Error("organization import invitations failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("sent organization import invitations", zap.Int("invited", n))
+			}
+		}
+	}()
+
+	// Capabilities organization admins disabled are refused to their
+	// members, and each attempt is recorded for the admins
+	orgPolicyRepo := repo.NewOrgPolicyRepo(database.SQL)
+	if err := orgPolicyRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create organization policy schema", zap.Error(err))
+	}
+	orgPolicies := orgpolicy.NewEnforcer(orgPolicyRepo, orgRepo)
+
+	// Usage is metered per event and rolled up per billing period; the
+	// worker records counted API requests and daily storage samples, and
+	// reports overage to Stripe billing meters
+	meteringRepo := repo.NewMeteringRepo(database.SQL)
+	if err := meteringRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create metering schema", zap.Error(err))
+	}
+	// Quota warnings: users are emailed once a month as they reach 80%, 90%
+	// and 100% of their row and dataset limits
+	quotaAlertRepo := repo.NewQuotaAlertRepo(database.SQL)
+	if err := quotaAlertRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create quota alert schema", zap.Error(err))
+	}
+	quotaNotifier := quota.NewNotifier(usageService, userRepo, quotaAlertRepo, emailService, webhookDispatcher, logg)
+	stripeClient := payments.NewStripeClient(payments.StripeConfig{
+		SecretKey:     cfg.StripeSecretKey,
+		WebhookSecret: cfg.StripeWebhookSecret,
+		PriceIDs:      pricing.StripePriceIDs(cfg.StripePriceIDs),
+		SuccessURL:    cfg.StripeSuccessURL,
+		CancelURL:     cfg.StripeCancelURL,
+	})
+	var meterReporter metering.MeterReporter
+	if stripeClient.Configured() {
+		meterReporter = stripeClient
 	}
+	apiRequests := metering.NewRequestCounter()
+	meteringWorker := metering.NewWorker(meteringRepo, meterReporter, apiRequests, cfg.StripeMeterEvents, logg)
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := meteringWorker.Run(context.Background(), time.Now()); err != nil {
+				logg.Error("usage metering failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("reported metered usage", zap.Int("events", n))
+			}
+		}
+	}()
 
+	// The incident timeline lines up alerts, security events, deployments
+	// and job failure spikes; each release of the API marks itself
+	deploymentRepo := repo.NewDeploymentRepo(database.SQL)
+	if err := deploymentRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create deployment marker schema", zap.Error(err))
+	}
+	release := cfg.SentryRelease
+	if release == "" {
+		release = errreport.BuildRevision()
+	}
+	if release != "" {
+		if err := deploymentRepo.RecordRelease(schemaCtx, "api", release); err != nil {
+			logg.Warn("deployment marker not recorded", zap.Error(err))
+		}
+	}
+	incidentCorrelator := incidents.NewCorrelator(monitor, securityService, deploymentRepo, genRepo)
+
+	// Housekeeping suggests cleaning up stale resources and, for the kinds
+	// staff enabled a policy for, cleans them up every hour
+	housekeepingRepo := repo.NewHousekeepingRepo(database.SQL)
+	if err := housekeepingRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create housekeeping schema", zap.Error(err))
+	}
+	objectDeleter, _ := storageClient.(storage.ObjectDeleter)
+	housekeeper := housekeeping.NewAnalyzer(housekeepingRepo, objectDeleter, cfg.StorageCostPerGBMonth, logg)
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			started := time.Now()
+			n, err := housekeeper.Apply(context.Background(), started)
+			recordRetention(models.RetentionStaleCleanup, started, n, err)
+			if err != nil {
+				logg.Error("stale resource cleanup failed", zap.Error(err))
+			}
+			if n > 0 {
+				logg.Info("cleaned up stale resources", zap.Int64("count", n))
+			}
+		}
+	}()
+
+	// Domain events are written to the outbox in the transaction of the
+	// state change they describe and published from there, at least once,
+	// to notifications, webhooks, analytics and the audit log
+	outboxRepo := repo.NewOutboxRepo(database.SQL)
+	if err := outboxRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create outbox schema", zap.Error(err))
+	}
+	outboxDispatcher := outbox.NewDispatcher(outboxRepo, outbox.DefaultConfig(), logg)
+	jobTopics := []string{jobs.TopicJobCompleted, jobs.TopicJobFailed}
+	outboxDispatcher.Subscribe("notifications", jobs.NotificationHandler(notifier), jobTopics...)
+	outboxDispatcher.Subscribe("webhooks", jobs.WebhookHandler(webhookDispatcher), jobTopics...)
+	outboxDispatcher.Subscribe("analytics", jobs.AnalyticsHandler(analyticsService), jobTopics...)
+	outboxDispatcher.Subscribe("audit", jobs.AuditHandler(auditLogRepo), jobTopics...)
+	outboxDispatcher.Subscribe("warehouse", jobs.WarehouseHandler(warehouseRepo), jobs.TopicJobCompleted)
+	outboxDispatcher.Subscribe("metering", jobs.MeteringHandler(meteringRepo), jobs.TopicJobCompleted)
+	outboxDispatcher.Subscribe("quota", jobs.QuotaHandler(quotaNotifier), jobs.TopicJobCompleted)
+	outboxDispatcher.Start(context.Background())
+	defer outboxDispatcher.Stop()
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := outboxRepo.PurgeDispatched(context.Background(), time.Now().AddDate(0, 0, -7)); err != nil {
+				logg.Error("outbox purge failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("purged dispatched outbox events", zap.Int64("count", n))
+			}
+		}
+	}()
+
+	// Email changes take effect once their security hold ends; one whose
+	// address was taken meanwhile is cancelled instead
+	accountRepo := repo.NewAccountRepo(database.SQL)
+	if err := accountRepo.CreateSchema(schemaCtx); err != nil {
+		logg.Fatal("failed to create account schema", zap.Error(err))
+	}
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			if n, err := accounts.ApplyDue(context.Background(), transactor, accountRepo, auditLogRepo, 100); err != nil {
+				logg.Error("applying email changes failed", zap.Error(err))
+			} else if n > 0 {
+				logg.Info("applied email changes", zap.Int("count", n))
+			}
+		}
+	}()
+
+	// Uploaded custom models run on a separate inference server, which
+	// loads their files from object storage
+	modelServing, err := modelserving.New(modelserving.Config{
+		URL:        cfg.ModelServingURL,
+		Token:      cfg.ModelServingToken,
+		Timeout:    time.Duration(cfg.ModelServingTimeoutSec) * time.Second,
+		Frameworks: cfg.ModelServingFrameworks,
+		Transport:  egressGateway.Transport("model_serving"),
+	})
+	if err != nil {
+		logg.Fatal("invalid model serving configuration", zap.Error(err))
+	}
+	customModelWriter, _ := storageClient.(storage.ObjectWriter)
+
+	// Datasets are scanned for PII as they are ingested; the NER provider
+	// is optional
+	piiScanner := &pii.Scanner{}
+	ner, err := pii.NewRecognizer(pii.Config{
+		URL:       cfg.PIINERURL,
+		Token:     cfg.PIINERToken,
+		Timeout:   time.Duration(cfg.PIINERTimeoutSec) * time.Second,
+		Transport: egressGateway.Transport("pii_ner"),
+	})
+	if err != nil {
+		logg.Fatal("invalid NER provider configuration", zap.Error(err))
+	}
+	if ner != nil {
+		piiScanner.Recognizer = ner
+	}
+
+	// Generation jobs are queued in Postgres and run by background workers;
+	// without a configured agent they stay queued for another instance
+	if cfg.WatermarkKey == "" {
+		logg.Warn("WATERMARK_KEY is not set; free-plan output is not watermarked")
+	}
+	generationQueue := jobs.NewQueue(genRepo)
+	generationEvents := jobs.NewEvents()
+	var generationPool *jobs.Pool
+	if cfg.VertexProjectID != "" {
+		agent, err := agents.NewClaudeAgent(agents.VertexAIConfig{
+			ProjectID: cfg.VertexProjectID,
+			Location:  cfg.VertexLocation,
+			ModelName: cfg.VertexDefaultModel,
+			APIKey:    cfg.VertexAPIKey,
+		})
+		if err != nil {
+			logg.Error("generation agent unavailable; workers not started", zap.Error(err))
+		} else {
+			agent.Parallelism = cfg.GenerationParallelism
+			processor := jobs.AgentProcessor{Generator: agent, Provider: "vertex_ai", Model: cfg.VertexDefaultModel, Events: generationEvents, Statistical: agents.StatisticalGenerator{},
+				WatermarkKey: []byte(cfg.WatermarkKey)}
+			if modelServing != nil {
+				processor.Custom = agents.CustomModelGenerator{Server: modelServing}
+			}
+			// Delta jobs read the runs before them like warehouse exports,
+			// under the owner's access grants
+			if reader, ok := storageClient.(storage.ObjectReader); ok && envelope != nil {
+				processor.Previous = &jobs.OutputReader{Jobs: genRepo, Keys: outputKeyRepo, Envelope: envelope, Reader: reader, Audit: auditLogRepo, Destination: "delta", Buckets: outputBuckets}
+			}
+			pool := jobs.NewPool(genRepo, processor,
+				jobs.Config{Workers: cfg.GenerationWorkers, MaxAttempts: cfg.GenerationMaxAttempts}, logg)
+			if envelope != nil {
+				if writer, ok := storageClient.(storage.ObjectWriter); ok {
+					pool.SetSealer(&jobs.OutputSealer{Envelope: envelope, Keys: outputKeyRepo, Writer: writer, Buckets: outputBuckets})
+				}
+			}
+			pool.SetOutbox(transactor, outboxRepo)
+			pool.SetEvents(generationEvents)
+			pool.SetAdvisor(tradeoff.NewAdvisor(genRepo, 90*24*time.Hour))
+			pool.Start(context.Background())
+			defer pool.Stop()
+			generationPool = pool
+		}
+	}
+
+	authDeps = v1.AuthDeps{
+		Cfg:          cfg,
+		Keys:         tokenKeys,
+		Users:        userRepo,
+		APIKeys:      apiKeyRepo,
+		AuditLogs:    auditLogRepo,
+		AuthService:  advancedAuthService,
+		EmailService: emailService,
+		Blacklist:    bl,
+		APIKeyGuard:  auth.NewAPIKeyGuard(redisClient.Client, auth.DefaultAPIKeyGuardConfig()),
+		Security:     securityService,
+		Roles:        roleRepo,
+	}
 	v1.Register(app, v1.Deps{
-		Auth: v1.AuthDeps{
-			Users:        userRepo,
-			APIKeys:      apiKeyRepo,
-			AuditLogs:    auditLogRepo,
-			AuthService:  advancedAuthService,
-			EmailService: emailService,
-			Blacklist:    bl,
+		Auth:   authDeps,
+		Access: v1.AccessDeps{Roles: roleRepo, Users: userRepo, AuditLogs: auditLogRepo},
+		Users:  v1.UserDeps{Users: userRepo},
+		Accounts: v1.AccountDeps{
+			Users:           userRepo,
+			Accounts:        accountRepo,
+			AuditLogs:       auditLogRepo,
+			EmailService:    emailService,
+			Tx:              transactor,
+			EmailChangeHold: time.Duration(cfg.EmailChangeHoldHours) * time.Hour,
+		},
+		Orgs: v1.OrgDeps{
+			Orgs:               orgRepo,
+			Users:              userRepo,
+			AuditLogs:          auditLogRepo,
+			EmailService:       emailService,
+			Tx:                 transactor,
+			Branding:           brandingRepo,
+			ReservedDomains:    cfg.WhiteLabelReservedDomains,
+			Rollups:            usageRollupRepo,
+			GenerationAudit:    generationAuditRepo,
+			Generations:        genRepo,
+			CommitmentDiscount: cfg.CommittedUseDiscount,
+			OutputBuckets:      outputBucketRepo,
+			Buckets:            outputBuckets,
+			Imports:            orgImportRepo,
+			Policies:           orgPolicyRepo,
+		},
+		Consent: v1.ConsentDeps{
+			Consents: consentRepo,
+			Documents: consent.Documents{
+				models.ConsentTerms:         cfg.TermsVersion,
+				models.ConsentPrivacyPolicy: cfg.PrivacyPolicyVersion,
+			},
 		},
-		Users: v1.UserDeps{Users: userRepo},
 		Datasets: v1.DatasetDeps{
-			Datasets:      datasetRepo,
-			Usage:         usageService,
-			StorageClient: storageClient,
+			Datasets:                datasetRepo,
+			Usage:                   usageService,
+			StorageClient:           storageClient,
+			URLSigner:               urlSigner,
+			Revocations:             storage.NewURLRevocations(redisClient.Client),
+			AuditLogs:               auditLogRepo,
+			DownloadTTL:             time.Duration(cfg.DownloadURLTTL) * time.Second,
+			Grants:                  datasetGrantRepo,
+			Users:                   userRepo,
+			ColumnTokenKey:          []byte(cfg.ColumnTokenizationKey),
+			OrgSettings:             orgSettingsRepo,
+			Annotations:             annotationRepo,
+			Relationships:           relationshipRepo,
+			Hierarchies:             hierarchyRepo,
+			Vocabularies:            vocabularyRepo,
+			ColumnPrivacy:           columnPrivacyRepo,
+			PII:                     datasetPIIRepo,
+			PIIScanner:              piiScanner,
+			FixedWidthLayouts:       fixedWidthRepo,
+			QualityPolicies:         qualityPolicyRepo,
+			FHIRMappings:            fhirMappingRepo,
+			FinancialMessageLayouts: financialMessageRepo,
+			Webhooks:                webhookDispatcher,
+			SignedURLTTL:            storageOpts.SignedURLTTL,
+			Tx:                      transactor,
+			Orgs:                    orgRepo,
+			Branding:                brands,
+			Collections:             collectionRepo,
+			Sources:                 datasetSourceRepo,
+			SourceKeys:              sourceKeys,
+			SourceNetwork:           sources.Network{Dial: egressGateway.Dialer("dataset_sources", egress.AnyPublicHost())},
+			Egress:                  egressGateway,
+			MaxSampleRows:           cfg.DatasetSourceMaxSampleRows,
+			Quota:                   quotaNotifier,
 		},
 		Generations: v1.GenerationDeps{
-			Generations:   genRepo,
-			Usage:         usageService,
-			StorageClient: storageClient,
+			Generations:             genRepo,
+			Usage:                   usageService,
+			StorageClient:           storageClient,
+			SignedURLTTL:            storageOpts.SignedURLTTL,
+			Grants:                  datasetGrantRepo,
+			Datasets:                datasetRepo,
+			DataPolicies:            dataPolicyRepo,
+			OrgSettings:             orgSettingsRepo,
+			Annotations:             annotationRepo,
+			Relationships:           relationshipRepo,
+			Hierarchies:             hierarchyRepo,
+			Vocabularies:            vocabularyRepo,
+			ColumnPrivacy:           columnPrivacyRepo,
+			PII:                     datasetPIIRepo,
+			FixedWidthLayouts:       fixedWidthRepo,
+			QualityPolicies:         qualityPolicyRepo,
+			FHIRMappings:            fhirMappingRepo,
+			FinancialMessageLayouts: financialMessageRepo,
+			PrivacyBudgets:          privacyBudgetRepo,
+			PrivacyBudgetEpsilon:    cfg.PrivacyBudgetEpsilon,
+			PrivacyBudgetDelta:      cfg.PrivacyBudgetDelta,
+			Tx:                      transactor,
+			Queue:                   generationQueue,
+			Events:                  generationEvents,
+			Workers:                 generationPool,
+			OutputKeys:              outputKeyRepo,
+			Envelope:                envelope,
+			AuditLogs:               auditLogRepo,
+			OutputAccessApproval:    cfg.OutputAccessApproval,
+			OutputAccessWindow:      time.Duration(cfg.OutputAccessWindowMinutes) * time.Minute,
+			Signer:                  exportSigner,
+			OutputBuckets:           outputBuckets,
+			GroundingMaxRows:        cfg.GroundingMaxRows,
+			CustomModels:            customModelRepo,
+			ModelServing:            modelServing,
+			Orgs:                    orgRepo,
+			GenerationAudit:         generationAuditRepo,
+			Users:                   userRepo,
+			WatermarkKey:            []byte(cfg.WatermarkKey),
+			Templates:               generationTemplateRepo,
+			Policies:                orgPolicies,
+			ProviderLocation:        cfg.VertexLocation,
 		},
 		Payments: v1.PaymentDeps{
-			StripeWebhookSecret: cfg.StripeSecretKey,
-			PaddlePublicKey:     cfg.PaddlePublicKey,
+			Stripe: stripeClient,
+			Paddle: payments.NewPaddleClient(payments.PaddleConfig{
+				APIKey:        cfg.PaddleAPIKey,
+				WebhookSecret: cfg.PaddleWebhookSecret,
+				Environment:   cfg.PaddleEnvironment,
+				PriceIDs:      cfg.PaddlePriceIDs,
+				ProductIDs:    pricing.PaddleProductIDs(),
+				CheckoutURL:   cfg.PaddleCheckoutURL,
+			}),
+			Users:           userRepo,
+			Subscriptions:   userSubRepo,
+			Webhooks:        webhookDispatcher,
+			PortalReturnURL: cfg.BillingPortalReturnURL,
+			ReturnOrigins:   cfg.CorsOrigins,
+			AuditLogs:       auditLogRepo,
+		},
+		Analytics: v1.AnalyticsDeps{},
+		Privacy: v1.PrivacyDeps{
+			Datasets:      datasetRepo,
+			Grants:        datasetGrantRepo,
+			Budgets:       privacyBudgetRepo,
+			BudgetEpsilon: cfg.PrivacyBudgetEpsilon,
+			BudgetDelta:   cfg.PrivacyBudgetDelta,
+		},
+		Admin: v1.AdminDeps{
+			Users:                 userRepo,
+			AnonymizationPolicies: anonymizationPolicyRepo,
+			Reports:               reportRepo,
+			ReportScheduler:       reportScheduler,
+			Subscriptions:         userSubRepo,
+			DataPolicies:          dataPolicyRepo,
+			OrgSettings:           orgSettingsRepo,
+			Orgs:                  orgRepo,
+			Roles:                 roleRepo,
+			Egress:                egressGateway,
+			Usage:                 usageService,
+			Generations:           genRepo,
+			Datasets:              datasetRepo,
+			QuotaOverrides:        quotaOverrideRepo,
+			AuditLogs:             auditLogRepo,
+			Keys:                  tokenKeys,
+			Blacklist:             bl,
+			SessionTTL:            time.Duration(cfg.JwtRefreshDays) * 24 * time.Hour,
+		},
+		Usage:         v1.UsageDeps{Usage: usageService, Metering: meteringRepo},
+		SLA:           v1.SLADeps{Reports: slaRepo, Credits: billingCreditRepo, Service: slaService},
+		Evidence:      v1.EvidenceDeps{Builder: evidenceBuilder, AuditLogs: auditLogRepo},
+		Signatures:    v1.SignatureDeps{Keys: exportSigner},
+		Notifications: v1.NotificationDeps{Notifications: notificationRepo},
+		CustomModels:  v1.CustomModelDeps{CustomModels: customModelRepo, Storage: customModelWriter, Orgs: orgRepo},
+		Webhooks:      v1.WebhookDeps{Webhooks: webhookRepo, AuditLogs: auditLogRepo, Egress: egressGateway},
+		Profiling:     v1.ProfilingDeps{Allowlist: pprofAllowlist, HeapDumps: heapDumps},
+		Changelog:     v1.ChangelogDeps{Entries: changelogRepo},
+		Incidents:     v1.IncidentDeps{Correlator: incidentCorrelator, Deployments: deploymentRepo},
+		Housekeeping:  v1.HousekeepingDeps{Analyzer: housekeeper, Policies: housekeepingRepo, AuditLogs: auditLogRepo},
+		Warehouses: v1.WarehouseDeps{
+			Warehouses:  warehouseRepo,
+			Generations: genRepo,
+			OutputKeys:  outputKeyRepo,
+			Envelope:    envelope,
+			AuditLogs:   auditLogRepo,
+			Egress:      egressGateway,
+			Network:     warehouseNetwork,
+			Policies:    orgPolicies,
+		},
+		MockAPIs: v1.MockAPIDeps{
+			Mocks:       mockAPIRepo,
+			Generations: genRepo,
+			OutputKeys:  outputKeyRepo,
+			Users:       userRepo,
+			AuditLogs:   auditLogRepo,
+			Server:      mockServer,
+			Policies:    orgPolicies,
 		},
-		Analytics:    v1.AnalyticsDeps{},
-		Privacy:      v1.PrivacyDeps{},
-		Admin:        v1.AdminDeps{Users: userRepo},
-		Usage:        v1.UsageDeps{Usage: usageService},
-		CustomModels: v1.CustomModelDeps{CustomModels: customModelRepo},
 		// VertexAI:     vertexAIHandlers,
+		RateLimit: middleware.TierRateLimit(middleware.TierRateLimitConfig{
+			Limiter:        advancedAuthService.RateLimiter(),
+			Identify:       authDeps.Identify,
+			PlanLimit:      usageService.APIRateLimit,
+			Count:          apiRequests.Count,
+			AnonymousLimit: cfg.RateLimitAnonymousPerMinute,
+			DefaultLimit:   cfg.RateLimitDefaultPerMinute,
+			Logger:         logg,
+		}),
 	})
 
 	_ = redisClient // will be used in auth/token blacklist etc.
@@ -185,10 +1292,44 @@ func main() {
 	}
 
 	addr := ":" + port
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	listenErr := make(chan error, 1)
 	sugar.Infof("Starting Synthos Go API on %s", addr)
-	if err := app.Listen(addr); err != nil {
-		log.Fatal(err)
+	go func() { listenErr <- app.Listen(addr) }()
+	ready.Store(true)
+
+	select {
+	case err := <-listenErr:
+		logg.Error("server stopped", zap.Error(err))
+		exitCode = 1
+		return
+	case <-signals.Done():
+	}
+
+	// Drain: fail readiness, give the load balancer time to notice, then
+	// stop accepting connections and let in-flight requests and jobs finish
+	// within the timeout. Deferred cleanup then flushes buffers and closes
+	// Redis and the database, in that order.
+	timeout := time.Duration(cfg.ShutdownTimeoutSec) * time.Second
+	logg.Info("shutting down", zap.Duration("timeout", timeout))
+	ready.Store(false)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	// Workers stop claiming jobs at once; other instances pick up the queue
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		if generationPool != nil {
+			generationPool.Drain(shutdownCtx)
+		}
+	}()
+	time.Sleep(time.Duration(cfg.ShutdownDrainDelaySec) * time.Second)
+	if err := app.ShutdownWithContext(shutdownCtx); err != nil {
+		logg.Warn("in-flight requests cut off", zap.Error(err))
 	}
+	<-drained
+	logg.Info("shutdown complete")
 }
 
 // keep file local helpers minimal